@@ -0,0 +1,80 @@
+// Command loadtest drives one of the load test scenarios at a running
+// server for -duration with -concurrency workers, then prints the latencies
+// of each request and exits non-zero when any is over the scenario's
+// budget. The scenarios place real orders and sales, so point it at a
+// seeded staging server on PostgreSQL, with its rate limits raised, rather
+// than production; SQLite takes one writer at a time and times out under a
+// storm. pos-rush and analytics-refresh need a staff token in -token or
+// LOADTEST_TOKEN.
+//
+//	loadtest checkout-storm
+//	loadtest -url https://staging.example.com/api/v1 -concurrency 50 -duration 2m pos-rush
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"pharmacy-backend/internal/loadtest"
+)
+
+func main() {
+	var opts loadtest.Options
+	flag.StringVar(&opts.BaseURL, "url", "http://localhost:8080/api/v1", "base URL of the API")
+	flag.StringVar(&opts.Token, "token", os.Getenv("LOADTEST_TOKEN"), "staff access token")
+	flag.IntVar(&opts.Concurrency, "concurrency", 20, "workers running the scenario at once")
+	flag.DurationVar(&opts.Duration, "duration", 30*time.Second, "how long to run")
+	p95 := flag.Duration("p95", 0, "override the scenario's 95th percentile budget")
+	p99 := flag.Duration("p99", 0, "override the scenario's 99th percentile budget")
+	maxErrorRate := flag.Float64("max-error-rate", -1, "override the scenario's error rate budget, e.g. 0.01")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: loadtest [flags] <%s>\n", strings.Join(loadtest.ScenarioNames(), "|"))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	scenario, ok := loadtest.Scenarios[flag.Arg(0)]
+	if !ok {
+		fail("%v %s, use %s", loadtest.ErrUnknownScenario, flag.Arg(0), strings.Join(loadtest.ScenarioNames(), ", "))
+	}
+	if *p95 > 0 {
+		scenario.Budget.P95 = loadtest.Duration(*p95)
+	}
+	if *p99 > 0 {
+		scenario.Budget.P99 = loadtest.Duration(*p99)
+	}
+	if *maxErrorRate >= 0 {
+		scenario.Budget.ErrorRate = *maxErrorRate
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result, err := loadtest.Run(ctx, scenario, opts)
+	if err != nil {
+		fail("%v", err)
+	}
+	checkErr := result.Check()
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	if checkErr != nil {
+		fail("%v", checkErr)
+	}
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
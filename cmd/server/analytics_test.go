@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// TestSalesAnalytics rings up a sale and checks the sales analytics total
+// it rather than canned numbers
+func TestSalesAnalytics(t *testing.T) {
+	setDevelopmentEnv(t)
+	server, seed := startTestServer(t, nil)
+	ctx := context.Background()
+
+	staff := testutil.NewClient(server.BaseURL)
+	if err := staff.Login(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	product := seed.Products[2]
+	total := product.Price.Mul(2)
+	sale := map[string]interface{}{
+		"payment_method": "cash",
+		"subtotal":       total,
+		"total":          total,
+		"sale_items": []map[string]interface{}{{
+			"item_type":   "product",
+			"product_id":  product.ID,
+			"quantity":    2,
+			"unit_price":  product.Price,
+			"total_price": total,
+		}},
+	}
+	var rung struct {
+		Total models.Money `json:"total"`
+	}
+	till := http.Header{"Idempotency-Key": {uuid.NewString()}}
+	if err := staff.Do(ctx, http.MethodPost, "/sales", till, sale, &rung); err != nil {
+		t.Fatal(err)
+	}
+
+	var analytics struct {
+		TotalRevenue       models.Money `json:"totalRevenue"`
+		TotalOrders        int64        `json:"totalOrders"`
+		ProductRevenue     models.Money `json:"productRevenue"`
+		ProductPerformance []struct {
+			ProductID uuid.UUID    `json:"productId"`
+			UnitsSold int64        `json:"unitsSold"`
+			Revenue   models.Money `json:"revenue"`
+		} `json:"productPerformance"`
+	}
+	if err := staff.Do(ctx, http.MethodGet, "/analytics/sales?time_range=1d", nil, nil, &analytics); err != nil {
+		t.Fatal(err)
+	}
+	if analytics.TotalOrders != 1 || analytics.TotalRevenue != rung.Total {
+		t.Errorf("got %d sales taking %s, want 1 taking %s", analytics.TotalOrders, analytics.TotalRevenue, rung.Total)
+	}
+	if analytics.ProductRevenue != total {
+		t.Errorf("got %s of product lines, want %s", analytics.ProductRevenue, total)
+	}
+	if len(analytics.ProductPerformance) != 1 || analytics.ProductPerformance[0].ProductID != product.ID || analytics.ProductPerformance[0].UnitsSold != 2 {
+		t.Errorf("product performance is %+v, want 2 units of %s", analytics.ProductPerformance, product.ID)
+	}
+
+	if err := staff.Do(ctx, http.MethodGet, "/analytics/sales?time_range=week", nil, nil, nil); err == nil {
+		t.Error("GET /analytics/sales?time_range=week succeeded, want 400")
+	}
+}
@@ -0,0 +1,534 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestContracts from the responses")
+
+// contract is a request whose response shape the POS and mobile apps
+// depend on. Path and Body may use {username}, {password}, {product_id},
+// {price}, {customer_id}, the links of contractLinks and the values
+// captured by earlier contracts, e.g. {tracking_code}.
+type contract struct {
+	Name   string
+	Method string
+	Path   string
+	Body   map[string]interface{}
+	// Staff makes the request with the manager's token, otherwise it is
+	// made as a guest of the shop with a session of its own
+	Staff bool
+	// Capture names values of the response, by dotted path, for the
+	// contracts after it
+	Capture map[string]string
+}
+
+// contracts are checked in order for every API version, so the ones that
+// create the order and the sale come before those that read them
+var contracts = []contract{
+	{Name: "auth-login", Method: http.MethodPost, Path: "/auth/login",
+		Body:    map[string]interface{}{"username": "{username}", "password": "{password}"},
+		Capture: map[string]string{"refresh_token": "refresh_token"}},
+	{Name: "auth-refresh", Method: http.MethodPost, Path: "/auth/refresh",
+		Body: map[string]interface{}{"refresh_token": "{refresh_token}"}},
+	{Name: "terminals-pair", Method: http.MethodPost, Path: "/terminals/pair",
+		Body: map[string]interface{}{"code": "{pairing_code}"}},
+	{Name: "products-browse", Method: http.MethodGet, Path: "/products/browse?limit=5"},
+	{Name: "cart-add", Method: http.MethodPost, Path: "/cart/add",
+		Body: map[string]interface{}{"product_id": "{product_id}", "quantity": 1}},
+	{Name: "cart", Method: http.MethodGet, Path: "/cart"},
+	{Name: "order-delivery-quote", Method: http.MethodPost, Path: "/orders/delivery-quote",
+		Body: map[string]interface{}{
+			"delivery_address": "1 Ayala Avenue",
+			"delivery_city":    "Makati",
+			"delivery_state":   "Metro Manila",
+		}},
+	{Name: "order-create", Method: http.MethodPost, Path: "/orders",
+		Body: map[string]interface{}{
+			"order_type":  "pickup",
+			"guest_name":  "Contract Guest",
+			"guest_email": "contract-guest@example.com",
+			"guest_phone": "09170000000",
+		},
+		Capture: map[string]string{
+			"order_id":      "order.id",
+			"order_number":  "order.order_number",
+			"tracking_code": "order.tracking_code",
+			"order_qr_code": "qr_code",
+		}},
+	{Name: "order-track", Method: http.MethodGet, Path: "/orders/track/{tracking_code}"},
+	{Name: "order-by-number", Method: http.MethodGet, Path: "/orders/number/{order_number}", Staff: true},
+	{Name: "qr-track", Method: http.MethodGet, Path: "/qr/track/{tracking_code}"},
+	{Name: "qr-scan", Method: http.MethodPost, Path: "/qr/scan",
+		Body: map[string]interface{}{"code": "{order_qr_code}", "scan_method": "camera"}},
+	{Name: "refills-reorder", Method: http.MethodPost, Path: "/refills/reorder/{reorder_token}"},
+	{Name: "unsubscribe", Method: http.MethodPost, Path: "/unsubscribe/{unsubscribe_token}"},
+	{Name: "feedback-form", Method: http.MethodGet, Path: "/feedback/form/{feedback_token}"},
+	{Name: "feedback-published", Method: http.MethodGet, Path: "/feedback/published"},
+	{Name: "sale-create", Method: http.MethodPost, Path: "/sales", Staff: true,
+		Body: map[string]interface{}{
+			"payment_method": "cash",
+			"subtotal":       "{price}",
+			"total":          "{price}",
+			"sale_items": []interface{}{map[string]interface{}{
+				"item_type":   "product",
+				"product_id":  "{product_id}",
+				"quantity":    1,
+				"unit_price":  "{price}",
+				"total_price": "{price}",
+			}},
+		},
+		Capture: map[string]string{"sale_id": "id"}},
+	{Name: "sales", Method: http.MethodGet, Path: "/sales?limit=5", Staff: true},
+	{Name: "sales-cursor", Method: http.MethodGet, Path: "/sales?limit=5&cursor=", Staff: true},
+	{Name: "sale", Method: http.MethodGet, Path: "/sales/{sale_id}", Staff: true},
+	{Name: "products", Method: http.MethodGet, Path: "/products?limit=5", Staff: true},
+	{Name: "product", Method: http.MethodGet, Path: "/products/{product_id}", Staff: true},
+	{Name: "products-low-stock", Method: http.MethodGet, Path: "/products/low-stock", Staff: true},
+	{Name: "products-expiring", Method: http.MethodGet, Path: "/products/expiring", Staff: true},
+	{Name: "customers", Method: http.MethodGet, Path: "/customers?limit=5", Staff: true},
+	{Name: "customer", Method: http.MethodGet, Path: "/customers/{customer_id}", Staff: true},
+	{Name: "orders", Method: http.MethodGet, Path: "/orders?limit=5", Staff: true},
+	{Name: "suppliers", Method: http.MethodGet, Path: "/suppliers?limit=5", Staff: true},
+	{Name: "not-found", Method: http.MethodGet, Path: "/products/" + uuid.Nil.String(), Staff: true},
+}
+
+// probeContracts are the liveness and readiness probes, served outside the
+// API versions
+var probeContracts = []contract{
+	{Name: "healthz", Method: http.MethodGet, Path: "/healthz"},
+	{Name: "readyz", Method: http.MethodGet, Path: "/readyz"},
+}
+
+// TestContracts makes every contract's request to each API version and
+// compares the shape of the response with the golden file
+// testdata/contracts/<version>/<name>.json. The shape is the status and the
+// JSON body with every value replaced by its type, so data that differs
+// from run to run doesn't matter but a renamed, dropped, added or retyped
+// field does. When a change is intended, rerun with -update to rewrite the
+// golden files and commit them with it, so the diff shows what the apps
+// will see:
+//
+//	go test ./cmd/server -run TestContracts -update
+//
+// The server runs on a scratch SQLite database without Redis, and with a
+// stand-in for the Google geocoder, so the shapes don't depend on the
+// environment the tests run in.
+func TestContracts(t *testing.T) {
+	geocoder := httptest.NewServer(http.HandlerFunc(fakeGeocode))
+	defer geocoder.Close()
+	setDevelopmentEnv(t)
+	t.Setenv("GEOCODING_PROVIDER", "google")
+	t.Setenv("GOOGLE_MAPS_API_KEY", "contract-check")
+	t.Setenv("GEOCODING_API_URL", geocoder.URL)
+	golden, err := filepath.Abs(filepath.Join("testdata", "contracts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The links and pairing codes work once, so each version gets its own
+	var links map[string]map[string]interface{}
+	server, seed := startTestServer(t, func(ctx context.Context, fixtures *testutil.Fixtures, seed *testutil.Seed) error {
+		var err error
+		links, err = contractLinks(ctx, fixtures, seed)
+		return err
+	})
+
+	ctx := context.Background()
+	login := testutil.NewClient(server.URL + "/api/" + middleware.APIVersion1)
+	if err := login.Login(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	product := seed.Products[2]
+
+	for _, version := range middleware.APIVersions {
+		t.Run(version, func(t *testing.T) {
+			vars := map[string]interface{}{
+				"username":    seed.Username,
+				"password":    seed.Password,
+				"product_id":  product.ID.String(),
+				"price":       product.Price.Float64(),
+				"customer_id": seed.Customer.ID.String(),
+			}
+			for name, value := range links[version] {
+				vars[name] = value
+			}
+			staff := login.WithBaseURL(server.URL + "/api/" + version)
+			guest := testutil.NewClient(server.URL + "/api/" + version)
+			session := http.Header{"X-Session-ID": {"contract-" + uuid.NewString()}}
+
+			for _, c := range contracts {
+				client, header := guest, session.Clone()
+				if c.Staff {
+					client, header = staff, http.Header{}
+				}
+				if c.Method != http.MethodGet {
+					header.Set(middleware.IdempotencyKeyHeader, uuid.NewString())
+				}
+				checkContract(t, c, client, header, version, vars, filepath.Join(golden, version))
+			}
+		})
+	}
+
+	t.Run("probes", func(t *testing.T) {
+		for _, c := range probeContracts {
+			checkContract(t, c, testutil.NewClient(server.URL), http.Header{}, "", map[string]interface{}{}, filepath.Join(golden, "probes"))
+		}
+	})
+}
+
+// contractLinks creates the records behind the links and codes the public
+// contracts redeem, for each API version: a feedback link, a refill
+// reminder, an unsubscribe link and a register waiting to pair. One
+// published comment keeps the public feedback list from being empty.
+func contractLinks(ctx context.Context, fixtures *testutil.Fixtures, seed *testutil.Seed) (map[string]map[string]interface{}, error) {
+	published, err := fixtures.Order(ctx, seed.Customer.ID)
+	if err != nil {
+		return nil, err
+	}
+	rating, submitted := 5, time.Now().UTC()
+	if _, err := fixtures.Feedback(ctx, published, func(f *models.Feedback) {
+		f.Status = models.FeedbackStatusPublished
+		f.Rating = &rating
+		f.Comment = "Quick and friendly"
+		f.SubmittedAt = &submitted
+	}); err != nil {
+		return nil, err
+	}
+	branch, err := fixtures.Branch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	links := map[string]map[string]interface{}{}
+	for _, version := range middleware.APIVersions {
+		customer, err := fixtures.Customer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		order, err := fixtures.Order(ctx, customer.ID)
+		if err != nil {
+			return nil, err
+		}
+		feedback, err := fixtures.Feedback(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+		refill, err := fixtures.Refill(ctx, customer.ID, seed.Products[0].ID)
+		if err != nil {
+			return nil, err
+		}
+		pref, err := fixtures.CommunicationPreference(ctx, customer.ID)
+		if err != nil {
+			return nil, err
+		}
+		_, code, err := fixtures.Terminal(ctx, branch.ID)
+		if err != nil {
+			return nil, err
+		}
+		links[version] = map[string]interface{}{
+			"feedback_token":    feedback.Token,
+			"reorder_token":     refill.ReorderToken,
+			"unsubscribe_token": pref.UnsubscribeToken,
+			"pairing_code":      code,
+		}
+	}
+	return links, nil
+}
+
+// fakeGeocode answers the Google Geocoding API with one address in Makati
+func fakeGeocode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, `{
+		"status": "OK",
+		"results": [{
+			"formatted_address": "1 Ayala Ave, Makati City, Metro Manila, Philippines",
+			"address_components": [
+				{"long_name": "Makati City", "short_name": "Makati", "types": ["locality", "political"]},
+				{"long_name": "Metro Manila", "short_name": "Metro Manila", "types": ["administrative_area_level_1", "political"]},
+				{"long_name": "1226", "short_name": "1226", "types": ["postal_code"]}
+			],
+			"geometry": {"location": {"lat": 14.5547, "lng": 121.0244}, "location_type": "ROOFTOP"}
+		}]
+	}`)
+}
+
+// checkContract makes the contract's request and compares the shape of the
+// response with its golden file in dir, or rewrites the file with -update
+func checkContract(t *testing.T, c contract, client *testutil.Client, header http.Header, version string, vars map[string]interface{}, dir string) {
+	t.Helper()
+	path := filepath.Join(dir, c.Name+".json")
+	shape, err := c.record(context.Background(), client, header, version, vars)
+	if err != nil {
+		t.Errorf("%s: %v", c.Name, err)
+		return
+	}
+	if *update {
+		if err := writeShape(path, shape); err != nil {
+			t.Errorf("%s: %v", c.Name, err)
+		}
+		return
+	}
+	changes, err := compareShape(path, shape)
+	if err != nil {
+		t.Errorf("%s: %v", c.Name, err)
+		return
+	}
+	if len(changes) > 0 {
+		t.Errorf("%s changed, rerun with -update if that is intended:\n\t%s", c.Name, strings.Join(changes, "\n\t"))
+	}
+}
+
+// shapeFile is what a golden file holds
+type shapeFile struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body"`
+}
+
+// record makes the contract's request and returns the shape of the
+// response, capturing the values later contracts use
+func (c contract) record(ctx context.Context, client *testutil.Client, header http.Header, version string, vars map[string]interface{}) (*shapeFile, error) {
+	path, ok := expand(c.Path, vars).(string)
+	if !ok {
+		return nil, fmt.Errorf("path %s isn't text", c.Path)
+	}
+	var body interface{}
+	if c.Body != nil {
+		body = expand(c.Body, vars)
+	}
+	status, data, err := client.Raw(ctx, c.Method, path, header, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("%s %s answered %d with a body that isn't JSON: %w", c.Method, path, status, err)
+	}
+	if len(c.Capture) > 0 {
+		// v2 wraps what the handler wrote in {"data": ...}
+		payload := decoded
+		if version != middleware.APIVersion1 {
+			payload = lookup(decoded, "data")
+		}
+		for name, field := range c.Capture {
+			value := lookup(payload, field)
+			if value == nil {
+				return nil, fmt.Errorf("%s %s answered %d without %s", c.Method, path, status, field)
+			}
+			vars[name] = value
+		}
+	}
+	return &shapeFile{Status: status, Body: shapeOf(decoded)}, nil
+}
+
+// expand replaces the {name} placeholders in value with vars. A string
+// that is only a placeholder takes the variable's type, e.g. a price stays
+// a number.
+func expand(value interface{}, vars map[string]interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		if strings.HasPrefix(value, "{") && strings.HasSuffix(value, "}") {
+			if v, ok := vars[strings.Trim(value, "{}")]; ok {
+				return v
+			}
+		}
+		for name, v := range vars {
+			value = strings.ReplaceAll(value, "{"+name+"}", fmt.Sprint(v))
+		}
+		return value
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			expanded[key] = expand(v, vars)
+		}
+		return expanded
+	case []interface{}:
+		expanded := make([]interface{}, len(value))
+		for i, v := range value {
+			expanded[i] = expand(v, vars)
+		}
+		return expanded
+	}
+	return value
+}
+
+// lookup returns the value at a dotted path of decoded JSON, or nil
+func lookup(value interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// shapeOf replaces every value of decoded JSON with the name of its type.
+// The elements of an array are merged into one shape with every field any
+// of them has.
+func shapeOf(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		shape := make(map[string]interface{}, len(value))
+		for key, v := range value {
+			shape[key] = shapeOf(v)
+		}
+		return shape
+	case []interface{}:
+		var element interface{}
+		for _, v := range value {
+			element = mergeShapes(element, shapeOf(v))
+		}
+		if element == nil {
+			return []interface{}{}
+		}
+		return []interface{}{element}
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// mergeShapes combines the shapes of two elements of an array. A null
+// field takes the type the other element has for it.
+func mergeShapes(a, b interface{}) interface{} {
+	switch {
+	case a == nil || a == "null":
+		return b
+	case b == nil || b == "null":
+		return a
+	}
+	aObject, aOK := a.(map[string]interface{})
+	bObject, bOK := b.(map[string]interface{})
+	if aOK && bOK {
+		merged := make(map[string]interface{}, len(aObject))
+		for key, v := range aObject {
+			merged[key] = v
+		}
+		for key, v := range bObject {
+			merged[key] = mergeShapes(merged[key], v)
+		}
+		return merged
+	}
+	aArray, aOK := a.([]interface{})
+	bArray, bOK := b.([]interface{})
+	if aOK && bOK {
+		if len(aArray) == 0 {
+			return b
+		}
+		if len(bArray) == 0 {
+			return a
+		}
+		return []interface{}{mergeShapes(aArray[0], bArray[0])}
+	}
+	return a
+}
+
+// compareShape lists how shape differs from the golden file at path
+func compareShape(path string, shape *shapeFile) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []string{"no golden file, record it with -update"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var golden shapeFile
+	if err := json.Unmarshal(data, &golden); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var changes []string
+	if golden.Status != shape.Status {
+		changes = append(changes, fmt.Sprintf("status %d, was %d", shape.Status, golden.Status))
+	}
+	diffShapes("body", golden.Body, shape.Body, &changes)
+	sort.Strings(changes)
+	return changes, nil
+}
+
+// diffShapes records where got differs from want. Null matches any type, as
+// an optional field is null whenever the data doesn't have it, and an
+// empty array matches any array.
+func diffShapes(path string, want, got interface{}, changes *[]string) {
+	if want == "null" || got == "null" {
+		return
+	}
+	wantObject, wantOK := want.(map[string]interface{})
+	gotObject, gotOK := got.(map[string]interface{})
+	if wantOK && gotOK {
+		for key, v := range wantObject {
+			if g, ok := gotObject[key]; ok {
+				diffShapes(path+"."+key, v, g, changes)
+			} else {
+				*changes = append(*changes, path+"."+key+" removed")
+			}
+		}
+		for key := range gotObject {
+			if _, ok := wantObject[key]; !ok {
+				*changes = append(*changes, path+"."+key+" added")
+			}
+		}
+		return
+	}
+	wantArray, wantOK := want.([]interface{})
+	gotArray, gotOK := got.([]interface{})
+	if wantOK && gotOK {
+		if len(wantArray) > 0 && len(gotArray) > 0 {
+			diffShapes(path+"[]", wantArray[0], gotArray[0], changes)
+		}
+		return
+	}
+	if describeShape(want) != describeShape(got) {
+		*changes = append(*changes, fmt.Sprintf("%s is %s, was %s", path, describeShape(got), describeShape(want)))
+	}
+}
+
+func describeShape(shape interface{}) string {
+	switch shape := shape.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return shape
+	}
+	return "unknown"
+}
+
+// writeShape writes a golden file, with its keys sorted so that changes to
+// it read well in a diff
+func writeShape(path string, shape *shapeFile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(shape, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
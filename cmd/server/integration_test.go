@@ -0,0 +1,166 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"testing"
+
+	"pharmacy-backend/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+var useContainers = flag.Bool("containers", true,
+	"start PostgreSQL and Redis containers for the run, otherwise use the configured ones, e.g. a CI job's service containers")
+
+// TestFlows drives journeys through the API end to end, against the server
+// on PostgreSQL and Redis containers, which need docker
+func TestFlows(t *testing.T) {
+	if *useContainers {
+		started, err := testutil.StartContainers(context.Background(), testutil.ContainerOptions{})
+		if err != nil {
+			t.Fatalf("%v, run with -containers=false to use the configured database", err)
+		}
+		t.Cleanup(func() { started.Close() })
+		for key, value := range started.Env() {
+			t.Setenv(key, value)
+		}
+	}
+	server, seed := startTestServer(t, nil)
+
+	t.Run("OrderFulfillment", func(t *testing.T) { testOrderFulfillment(t, server, seed) })
+	t.Run("SaleRefund", func(t *testing.T) { testSaleRefund(t, server, seed) })
+}
+
+// testOrderFulfillment checks out a guest's cart as a pickup order, then
+// moves it from processing to ready to picked up as the pharmacy does,
+// checking the stock taken and the status the customer sees
+func testOrderFulfillment(t *testing.T, server *testutil.Server, seed *testutil.Seed) {
+	ctx := context.Background()
+	client := login(t, server, seed)
+	product := seed.Products[0]
+	before := stock(t, client, product.ID)
+
+	guest := http.Header{"X-Session-ID": {"it-" + uuid.NewString()}}
+	cart := map[string]interface{}{"product_id": product.ID, "quantity": 2}
+	if err := client.Anonymous(ctx, http.MethodPost, "/cart/add", guest, cart, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	checkout := guest.Clone()
+	checkout.Set("Idempotency-Key", uuid.NewString())
+	var created struct {
+		Order struct {
+			ID           uuid.UUID `json:"id"`
+			OrderNumber  string    `json:"order_number"`
+			TrackingCode string    `json:"tracking_code"`
+		} `json:"order"`
+	}
+	order := map[string]interface{}{
+		"order_type":  "pickup",
+		"guest_name":  "Integration Guest",
+		"guest_email": "it-guest@example.com",
+		"guest_phone": "09170000000",
+	}
+	if err := client.Anonymous(ctx, http.MethodPost, "/orders", checkout, order, &created); err != nil {
+		t.Fatal(err)
+	}
+	if got := stock(t, client, product.ID); got != before-2 {
+		t.Fatalf("after checkout: %d in stock, want %d", got, before-2)
+	}
+
+	for _, status := range []string{"processing", "ready", "picked_up"} {
+		path := "/orders/" + created.Order.ID.String() + "/status"
+		body := map[string]string{"status": status, "reason": "Integration run"}
+		if err := client.Do(ctx, http.MethodPut, path, nil, body, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var tracked struct {
+		Tracking struct {
+			Status string `json:"status"`
+		} `json:"tracking"`
+	}
+	if err := client.Anonymous(ctx, http.MethodGet, "/orders/track/"+created.Order.TrackingCode, nil, nil, &tracked); err != nil {
+		t.Fatal(err)
+	}
+	if tracked.Tracking.Status != "picked_up" {
+		t.Fatalf("order %s is %s, want picked_up", created.Order.OrderNumber, tracked.Tracking.Status)
+	}
+}
+
+// testSaleRefund rings up a cash sale of one unit and refunds it, checking
+// the stock goes out with the sale and comes back with the refund, and that
+// the sale can't be refunded twice
+func testSaleRefund(t *testing.T, server *testutil.Server, seed *testutil.Seed) {
+	ctx := context.Background()
+	client := login(t, server, seed)
+	product := seed.Products[1]
+	before := stock(t, client, product.ID)
+
+	price := product.Price.Float64()
+	var sale struct {
+		ID uuid.UUID `json:"id"`
+	}
+	body := map[string]interface{}{
+		"payment_method": "cash",
+		"subtotal":       price,
+		"total":          price,
+		"sale_items": []map[string]interface{}{{
+			"item_type":   "product",
+			"product_id":  product.ID,
+			"quantity":    1,
+			"unit_price":  price,
+			"total_price": price,
+		}},
+	}
+	till := http.Header{"Idempotency-Key": {uuid.NewString()}}
+	if err := client.Do(ctx, http.MethodPost, "/sales", till, body, &sale); err != nil {
+		t.Fatal(err)
+	}
+	if got := stock(t, client, product.ID); got != before-1 {
+		t.Fatalf("after the sale: %d in stock, want %d", got, before-1)
+	}
+
+	refund := func() error {
+		header := http.Header{"Idempotency-Key": {uuid.NewString()}}
+		return client.Do(ctx, http.MethodPost, "/sales/"+sale.ID.String()+"/refund", header, map[string]string{"reason": "Integration run"}, nil)
+	}
+	if err := refund(); err != nil {
+		t.Fatal(err)
+	}
+	if got := stock(t, client, product.ID); got != before {
+		t.Fatalf("after the refund: %d in stock, want %d", got, before)
+	}
+	var statusErr *testutil.StatusError
+	if err := refund(); !errors.As(err, &statusErr) || statusErr.Status != http.StatusConflict {
+		t.Fatalf("refunding the sale again: got %v, want a 409", err)
+	}
+	if got := stock(t, client, product.ID); got != before {
+		t.Fatalf("after refunding again: %d in stock, want %d", got, before)
+	}
+}
+
+// login returns a client signed in as the seeded manager
+func login(t *testing.T, server *testutil.Server, seed *testutil.Seed) *testutil.Client {
+	t.Helper()
+	client := testutil.NewClient(server.BaseURL)
+	if err := client.Login(context.Background(), seed); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func stock(t *testing.T, client *testutil.Client, productID uuid.UUID) int {
+	t.Helper()
+	got, err := client.Stock(context.Background(), productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
@@ -1,24 +1,42 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"pharmacy-backend/internal/api"
 	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/cache"
 	"pharmacy-backend/internal/config"
 	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/kvstore"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/logging"
 	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
 	"pharmacy-backend/internal/utils"
 
 	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
 	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
@@ -26,48 +44,421 @@ import (
 )
 
 func main() {
-	// Initialize logger
-	logger := logrus.New()
-	logger.SetFormatter(&logrus.JSONFormatter{})
-	
-	// Load configuration
-	cfg, err := config.LoadConfig()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := newRootCommand().ExecuteContext(ctx)
+	stop()
+	logging.Close()
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the command line. Without a subcommand the binary
+// runs the server, as it always has; the others are operational tasks that
+// read the same environment as the server.
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:          "pharmacy-backend",
+		Short:        "Pharmacy management system API server and admin tasks",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runServer()
+		},
+	}
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "server",
+			Short: "Run the API server",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return runServer()
+			},
+		},
+		newMigrateCommand(),
+		newSeedCommand(),
+		newCreateAdminCommand(),
+		newRotateKeysCommand(),
+		newBackupCommand(),
+		newSyncCommand(),
+		newMigrateFilesCommand(),
+	)
+	root.CompletionOptions.DisableDefaultCmd = true
+	return root
+}
+
+func newMigrateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "migrate",
+		Short: "Bring the primary database's schema up to date",
+		Long: "Bring the primary database's schema up to date, e.g. before starting a new version. " +
+			"The server also migrates on start, and migrates the synced databases when sync is on.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, db, err := setupDatabase()
+			if err != nil {
+				return err
+			}
+			if err := database.Migrate(db); err != nil {
+				return fmt.Errorf("failed to run database migrations: %w", err)
+			}
+			logger.WithField("database", cfg.Database.Name).Info("Database migrated")
+			return nil
+		},
+	}
+}
+
+func newSeedCommand() *cobra.Command {
+	var sample bool
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Add the starter reference data, and optionally sample data",
+		Long: "Add the drug interactions, customer segments, loyalty tiers and campaigns the features " +
+			"start from where they are missing, and backfill purchase history. With --sample, also " +
+			"add sample users, products and customers to an empty database.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, db, err := setupDatabase()
+			if err != nil {
+				return err
+			}
+			if sample && cfg.IsProduction() {
+				return fmt.Errorf("sample data can't be added to a production database")
+			}
+			if err := loadEncryptionKeys(cmd.Context(), cfg, db, logger); err != nil {
+				return fmt.Errorf("failed to load encryption keys: %w", err)
+			}
+
+			seedReferenceData(db, logger)
+			if sample {
+				if err := database.SeedSampleData(db); err != nil {
+					return fmt.Errorf("failed to seed sample data: %w", err)
+				}
+			}
+			logger.Info("Seeding finished")
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&sample, "sample", false, "also add sample data (not in production)")
+	return cmd
+}
+
+func newCreateAdminCommand() *cobra.Command {
+	var req auth.CreateAdminRequest
+	cmd := &cobra.Command{
+		Use:   "create-admin",
+		Short: "Create an admin account",
+		Long: "Create an admin account, e.g. the first one or to recover from a lost admin password. " +
+			"The password is read from ADMIN_PASSWORD or, when that is unset, the first line of stdin:\n\n" +
+			"  printf '%s\\n' \"$PASSWORD\" | pharmacy-backend create-admin --username jdoe --email jdoe@example.com " +
+			"--first-name Juan --last-name Doe",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			password, err := readAdminPassword(cmd.InOrStdin())
+			if err != nil {
+				return err
+			}
+			req.Password = password
+			if err := validator.New().Struct(req); err != nil {
+				return fmt.Errorf("invalid admin account: %w", err)
+			}
+
+			cfg, _, db, err := setupDatabase()
+			if err != nil {
+				return err
+			}
+			user, err := auth.NewAuthService(db, kvstore.NewMemory(), cfg).CreateAdmin(cmd.Context(), req)
+			if translator, ok := db.Dialector.(gorm.ErrorTranslator); ok && err != nil {
+				err = translator.Translate(err)
+			}
+			if err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) {
+					return fmt.Errorf("the username or email is already taken")
+				}
+				return fmt.Errorf("failed to create admin: %w", err)
+			}
+			return printJSON(cmd, user)
+		},
+	}
+	cmd.Flags().StringVar(&req.Username, "username", "", "login name")
+	cmd.Flags().StringVar(&req.Email, "email", "", "email address")
+	cmd.Flags().StringVar(&req.FirstName, "first-name", "", "first name")
+	cmd.Flags().StringVar(&req.LastName, "last-name", "", "last name")
+	for _, flag := range []string{"username", "email", "first-name", "last-name"} {
+		cmd.MarkFlagRequired(flag)
+	}
+	return cmd
+}
+
+func newRotateKeysCommand() *cobra.Command {
+	var rewrap, reencrypt bool
+	cmd := &cobra.Command{
+		Use:   "rotate-keys",
+		Short: "Rotate the data encryption key",
+		Long: "Create a new data key that new values are encrypted with. Existing values stay readable " +
+			"and are moved to the new key in the background, or now with --reencrypt. With --rewrap, " +
+			"the data keys are instead wrapped again with the configured master key, e.g. after rotating " +
+			"the Vault transit key. Needs ENCRYPTION_KEY_MANAGEMENT.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, db, err := setupDatabase()
+			if err != nil {
+				return err
+			}
+			if !cfg.Encryption.KeyManagement {
+				return services.ErrKeyManagementDisabled
+			}
+			if err := loadEncryptionKeys(cmd.Context(), cfg, db, logger); err != nil {
+				return fmt.Errorf("failed to load encryption keys: %w", err)
+			}
+			keys := newKeyManagementService(cfg, db)
+
+			if rewrap {
+				rewrapped, err := keys.RewrapDataKeys(cmd.Context())
+				if err != nil {
+					return err
+				}
+				return printJSON(cmd, gin.H{"rewrapped": rewrapped})
+			}
+
+			key, err := keys.RotateDataKey(cmd.Context())
+			if err != nil {
+				return err
+			}
+			result := gin.H{"key_id": key.KeyID, "version": key.Version}
+			if reencrypt {
+				total := services.ReencryptResult{KeyID: key.KeyID}
+				for {
+					batch, err := keys.ReencryptStale(cmd.Context())
+					if err != nil {
+						return err
+					}
+					total.Reencrypted += batch.Reencrypted
+					total.Failed += batch.Failed
+					total.Remaining = batch.Remaining
+					// Values that fail stay stale, stop once a batch moves nothing
+					if batch.Remaining == 0 || batch.Reencrypted == 0 {
+						break
+					}
+				}
+				result["reencryption"] = total
+			}
+			return printJSON(cmd, result)
+		},
+	}
+	cmd.Flags().BoolVar(&rewrap, "rewrap", false, "wrap the data keys with the master key again instead of rotating")
+	cmd.Flags().BoolVar(&reencrypt, "reencrypt", false, "move every value to the new key before returning")
+	cmd.MarkFlagsMutuallyExclusive("rewrap", "reencrypt")
+	return cmd
+}
+
+func newBackupCommand() *cobra.Command {
+	var prune bool
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the primary database to the backup bucket now",
+		Long: "Dump, encrypt and upload the primary database to S3_BACKUP_BUCKET, as the scheduled " +
+			"backups do. With --prune, backups past the retention period are deleted afterwards. " +
+			"Restore with pharmacy-restore.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, db, err := setupDatabase()
+			if err != nil {
+				return err
+			}
+			if cfg.Backup.S3Bucket == "" {
+				return fmt.Errorf("S3_BACKUP_BUCKET is not set")
+			}
+
+			backups := services.NewBackupService(db, services.NewBackupStore(cfg.Backup),
+				services.NewMasterKeyProvider(cfg.Encryption, cfg.Security.EncryptionKey),
+				cfg.Database, cfg.Backup, cfg.Sync.BackupInterval)
+			run, err := backups.RunBackup(cmd.Context())
+			if err != nil {
+				return err
+			}
+			result := gin.H{"backup": run}
+			if prune {
+				pruned, err := backups.PruneBackups(cmd.Context())
+				if err != nil {
+					return err
+				}
+				result["pruned"] = pruned
+			}
+			return printJSON(cmd, result)
+		},
+	}
+	cmd.Flags().BoolVar(&prune, "prune", false, "delete backups past the retention period afterwards")
+	return cmd
+}
+
+func newSyncCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Sync the primary database with the cloud and local databases now",
+		Long: "Run one sync between the primary and the configured cloud and local databases, as the " +
+			"server does every DB_SYNC_INTERVAL. Needs DB_SYNC_ENABLED.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, _, err := setup()
+			if err != nil {
+				return err
+			}
+			if !cfg.Sync.Enabled {
+				return fmt.Errorf("sync is not enabled, set DB_SYNC_ENABLED")
+			}
+
+			dbManager, err := database.NewDatabaseManager(cfg)
+			if err != nil {
+				return err
+			}
+			defer dbManager.Close()
+			if err := dbManager.SyncData(); err != nil {
+				return err
+			}
+			stats, err := dbManager.GetStats()
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, gin.H{"last_sync": stats.LastSyncTime, "healthy": stats.HealthStatus})
+		},
+	}
+}
+
+func newMigrateFilesCommand() *cobra.Command {
+	var deleteLocal bool
+	cmd := &cobra.Command{
+		Use:   "migrate-files",
+		Short: "Move uploads from local disk into the configured storage backend",
+		Long: "Copy the ID documents and prescription images still kept under uploads/ on this server " +
+			"into STORAGE_BACKEND, and point their records at the copies. Safe to run again; files " +
+			"already moved are skipped. With --delete-local, the files on disk are removed afterwards.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, logger, db, err := setupDatabase()
+			if err != nil {
+				return err
+			}
+			if err := loadEncryptionKeys(cmd.Context(), cfg, db, logger); err != nil {
+				return fmt.Errorf("failed to load encryption keys: %w", err)
+			}
+
+			files := services.NewFileService(db, services.NewFileStore(cfg.Storage, cfg.Security.JWTSecret), cfg.Storage)
+			result, err := files.MigrateLocalFiles(cmd.Context(), deleteLocal)
+			if err != nil {
+				return err
+			}
+			return printJSON(cmd, result)
+		},
+	}
+	cmd.Flags().BoolVar(&deleteLocal, "delete-local", false, "remove the files from local disk once copied")
+	return cmd
+}
+
+// setupDatabase is setup for commands that use the primary database
+func setupDatabase() (*config.Config, *logrus.Logger, *gorm.DB, error) {
+	cfg, logger, err := setup()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	db, err := connectDatabase(cfg, logger)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return cfg, logger, db, nil
+}
+
+// readAdminPassword reads the new admin's password from ADMIN_PASSWORD or
+// the first line of in
+func readAdminPassword(in io.Reader) (string, error) {
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		return password, nil
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password given, set ADMIN_PASSWORD or pass it on stdin")
+	}
+	return password, nil
+}
+
+// printJSON writes a command's result to stdout
+func printJSON(cmd *cobra.Command, v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
-		logger.WithError(err).Fatal("Failed to load configuration")
+		return err
 	}
+	fmt.Fprintln(cmd.OutOrStdout(), string(out))
+	return nil
+}
 
-	// Set log level based on environment
+func runServer() error {
+	cfg, logger, err := setup()
+	if err != nil {
+		return err
+	}
 	if cfg.IsDevelopment() {
-		logger.SetLevel(logrus.DebugLevel)
 		gin.SetMode(gin.DebugMode)
 	} else {
-		logger.SetLevel(logrus.InfoLevel)
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	logger.WithField("environment", cfg.Environment).Info("Starting pharmacy backend server")
 
-	// Initialize encryption
-	if err := utils.InitializeEncryption(cfg.Security.EncryptionKey); err != nil {
-		logger.WithError(err).Fatal("Failed to initialize encryption")
-	}
-
 	// Connect to PostgreSQL
 	db, err := connectDatabase(cfg, logger)
 	if err != nil {
 		logger.WithError(err).Fatal("Failed to connect to database")
 	}
 
+	// Background workers, and the connections closed once they have
+	// finished on shutdown
+	workers := lifecycle.New(logger)
+	workers.OnStop("database", func() error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.Close()
+	})
+
 	// Run database migrations
 	if err := database.Migrate(db); err != nil {
 		logger.WithError(err).Fatal("Failed to run database migrations")
 	}
 
-	// Create default admin user
-	if err := database.CreateDefaultAdmin(db); err != nil {
-		logger.WithError(err).Fatal("Failed to create default admin user")
+	// Limit branch staff's queries to their branch
+	if err := database.RegisterBranchScope(db); err != nil {
+		logger.WithError(err).Fatal("Failed to register branch scoping")
+	}
+
+	// Query latency for /metrics, and slow statements logged without
+	// their values
+	if err := database.TrackQueries(db, cfg.Database.SlowQueryThreshold); err != nil {
+		logger.WithError(err).Fatal("Failed to register query tracking")
+	}
+
+	// Load the managed data keys before anything is encrypted
+	if err := loadEncryptionKeys(context.Background(), cfg, db, logger); err != nil {
+		logger.WithError(err).Fatal("Failed to load encryption keys")
+	}
+
+	// Development databases get the well-known admin account. Elsewhere the
+	// first admin is created with the one-time bootstrap token.
+	if cfg.IsDevelopment() {
+		if err := database.CreateDefaultAdmin(db); err != nil {
+			logger.WithError(err).Fatal("Failed to create default admin user")
+		}
 	}
 
+	// Seed the reference data the features start from
+	seedReferenceData(db, logger)
+
 	// Seed sample data in development
 	if cfg.IsDevelopment() {
 		if err := database.SeedSampleData(db); err != nil {
@@ -75,20 +466,129 @@ func main() {
 		}
 	}
 
-	// Connect to Redis
+	// Connect to Redis, keeping shared state in memory without it
 	redisClient := connectRedis(cfg, logger)
+	if redisClient != nil {
+		workers.OnStop("redis", redisClient.Close)
+	}
+	store := kvstore.Open(redisClient, logger)
 
 	// Initialize services
-	authService := auth.NewAuthService(db, redisClient, cfg)
+	authService := auth.NewAuthService(db, store, cfg)
+	authService.SetAlertNotifier(services.DefaultNotifiers()[services.ChannelEmail])
+
+	// Arm the bootstrap token when there is no admin yet
+	bootstrapToken, err := authService.PrepareBootstrap(context.Background())
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to check for an admin account")
+	}
+	if bootstrapToken != "" {
+		logger.WithField("bootstrap_token", bootstrapToken).
+			Warn("No admin account exists. Create one with POST /api/v1/auth/bootstrap and this one-time token")
+	}
 
 	// Initialize middleware
-	securityMiddleware := middleware.NewSecurityMiddleware(authService, db, redisClient, cfg)
+	securityMiddleware := middleware.NewSecurityMiddleware(authService, db, store, cfg)
 
 	// Initialize API handlers
 	apiHandlers := api.NewHandlers(db, redisClient, cfg, authService)
+	apiHandlers.SetCache(cache.New(store, cfg.Cache))
+	apiHandlers.SetStore(store)
+	apiHandlers.SetWorkers(workers)
+
+	// Start background jobs. Jobs that must run once across the instances
+	// behind a load balancer run on the instance the elector picks; the
+	// outbox and job workers claim their work in the database, reencryption
+	// also reloads keys rotated elsewhere, and realtime events feed this
+	// instance's streams, so those run on every instance.
+	elector := kvstore.NewElector(store, cfg.Cluster.InstanceID, cfg.Cluster.LeaderLeaseTTL, logger)
+	runElected := func(name string, job func(ctx context.Context)) {
+		workers.Go(name, func(ctx context.Context) { elector.Run(ctx, name, job) })
+	}
+	if cfg.Refill.RemindersEnabled {
+		runElected("refill-reminders", apiHandlers.RunRefillReminders)
+	}
+	if cfg.Vaccination.RemindersEnabled {
+		runElected("vaccination-reminders", apiHandlers.RunVaccinationReminders)
+	}
+	if cfg.Segment.RefreshEnabled {
+		runElected("segment-refresh", apiHandlers.RunSegmentRefresh)
+	}
+	if cfg.Loyalty.RecalcEnabled {
+		runElected("loyalty-recalculation", apiHandlers.RunLoyaltyRecalculation)
+	}
+	if cfg.Campaign.SchedulerEnabled {
+		runElected("campaign-scheduler", apiHandlers.RunCampaignScheduler)
+	}
+	if cfg.AuditArchive.Enabled {
+		runElected("audit-archival", apiHandlers.RunAuditArchival)
+	}
+	if cfg.Encryption.KeyManagement && cfg.Encryption.ReencryptEnabled {
+		workers.Go("reencryption", apiHandlers.RunReencryption)
+	}
+	if cfg.Outbox.DispatchEnabled {
+		workers.Go("outbox-dispatcher", apiHandlers.RunOutboxDispatcher)
+	}
+	workers.Go("realtime-events", apiHandlers.RunRealtimeEvents)
+	if cfg.Jobs.WorkerEnabled {
+		workers.Go("job-workers", apiHandlers.RunJobWorkers)
+	}
+	if cfg.Sync.BackupEnabled {
+		if cfg.Backup.S3Bucket == "" {
+			logger.Error("DB_BACKUP_ENABLED is set but S3_BACKUP_BUCKET is not, database backups are off")
+		} else {
+			runElected("database-backups", apiHandlers.RunBackups)
+		}
+	}
+
+	// Sync with the cloud and local databases. With bidirectional sync a
+	// store keeps working on its own database through an outage.
+	if cfg.Sync.Enabled {
+		dbManager, err := database.NewDatabaseManager(cfg)
+		if err != nil {
+			logger.WithError(err).Error("Failed to start database sync")
+		} else {
+			workers.OnStop("database sync", dbManager.Close)
+			apiHandlers.SetDatabaseManager(dbManager)
+			runElected("database-sync", dbManager.RunSync)
+		}
+	}
+
+	// Send list and report reads to the read replica while it keeps up
+	if cfg.HasReadReplica() {
+		replica, err := database.ConnectReadReplica(cfg)
+		if err != nil {
+			logger.WithError(err).Warn("Read replica unavailable, reading from primary")
+		} else if replicaRouter, err := database.NewReadReplicaRouter(db, replica, cfg.ReadReplica.MaxLag); err != nil {
+			logger.WithError(err).Warn("Failed to route reads to the read replica")
+		} else {
+			workers.Go("read-replica-router", replicaRouter.Run)
+			apiHandlers.SetReadReplica(replicaRouter)
+		}
+	}
 
 	// Setup router
-	router := setupRouter(securityMiddleware, apiHandlers)
+	router := setupRouter(newEngine(cfg.Network, logger), securityMiddleware, apiHandlers)
+
+	// Profiling and runtime stats for admins, on the API's port or on their
+	// own listener
+	var debugServer *http.Server
+	if cfg.Monitoring.DebugEnabled {
+		if cfg.Monitoring.DebugAddr == "" {
+			registerDebugRoutes(router, securityMiddleware, apiHandlers)
+		} else {
+			debugRouter := newEngine(cfg.Network, logger)
+			debugRouter.Use(securityMiddleware.RequestID(), securityMiddleware.Logger(), securityMiddleware.Recovery())
+			registerDebugRoutes(debugRouter, securityMiddleware, apiHandlers)
+			// No write timeout, as CPU profiles and traces take as long
+			// as asked for
+			debugServer = &http.Server{
+				Addr:        cfg.Monitoring.DebugAddr,
+				Handler:     debugRouter,
+				ReadTimeout: 30 * time.Second,
+			}
+		}
+	}
 
 	// Create HTTP server
 	// Bind to all interfaces if host is empty or localhost
@@ -101,8 +601,35 @@ func main() {
 	server := &http.Server{
 		Addr:         addr,
 		Handler:      router,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		// Routes set their own write deadlines by class; this only bounds
+		// the rest
+		WriteTimeout: cfg.Server.ReportTimeout + 10*time.Second,
+	}
+	server.RegisterOnShutdown(apiHandlers.CloseStreams)
+
+	// Serve HTTPS directly when there is no reverse proxy to terminate
+	// TLS, with plain HTTP redirected on its own listener
+	var certificates *certificateFiles
+	var redirectServer *http.Server
+	if cfg.Server.TLSEnabled() {
+		tlsConfig, httpHandler, files, err := setupTLS(cfg.Server)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to set up TLS")
+		}
+		server.TLSConfig = tlsConfig
+		if !cfg.Server.HTTP2 {
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		certificates = files
+		if cfg.Server.HTTPPort != "" {
+			redirectServer = &http.Server{
+				Addr:         host + ":" + cfg.Server.HTTPPort,
+				Handler:      httpHandler,
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 30 * time.Second,
+			}
+		}
 	}
 
 	// Start server in a goroutine
@@ -111,11 +638,39 @@ func main() {
 			"address": addr,
 			"host": host,
 			"port": cfg.Server.Port,
+			"tls":  server.TLSConfig != nil,
 		}).Info("Starting HTTP server")
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.WithError(err).Fatal("Failed to start server")
 		}
 	}()
+	if redirectServer != nil {
+		go func() {
+			logger.WithField("address", redirectServer.Addr).Info("Redirecting plain HTTP to HTTPS")
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.WithError(err).Fatal("Failed to start HTTP redirect server")
+			}
+		}()
+	}
+
+	if debugServer != nil {
+		go func() {
+			logger.WithField("address", debugServer.Addr).Info("Serving debug endpoints")
+			if err := debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.WithError(err).Error("Failed to start debug server")
+			}
+		}()
+	}
+
+	// Reload rate limits, CORS settings, feature flags and the TLS
+	// certificate on SIGHUP
+	workers.Go("config-reload", func(ctx context.Context) { reloadOnHangup(ctx, cfg, certificates, logger) })
 
 	// Wait for interrupt signal to gracefully shutdown the server
 	quit := make(chan os.Signal, 1)
@@ -123,25 +678,228 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
+	// Workers stop starting new work while requests drain
+	workers.Stop()
 
-	// Give outstanding requests 30 seconds to complete
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Outstanding requests and the workers' work in progress share the
+	// time to finish
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+	if debugServer != nil {
+		debugServer.Close()
+	}
 	if err := server.Shutdown(ctx); err != nil {
-		logger.WithError(err).Fatal("Server forced to shutdown")
+		logger.WithError(err).Error("Requests still running at the shutdown deadline were cut off")
+	}
+	if err := workers.Shutdown(ctx); err != nil {
+		logger.WithError(err).Error("Failed to close connections cleanly")
 	}
 
 	logger.Info("Server exited")
+	return nil
+}
+
+// reloadOnHangup reloads the reloadable settings, and the certificate files
+// when there are any, each time the process gets SIGHUP, until ctx is done
+func reloadOnHangup(ctx context.Context, cfg *config.Config, certificates *certificateFiles, logger *logrus.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if certificates != nil {
+				if err := certificates.load(); err != nil {
+					logger.WithError(err).Error("Failed to reload the TLS certificate, keeping the current one")
+				} else {
+					logger.Info("TLS certificate reloaded")
+				}
+			}
+			if _, err := cfg.Reload(); err != nil {
+				logger.WithError(err).Error("Failed to reload configuration, keeping the current settings")
+				continue
+			}
+			logger.Info("Configuration reloaded")
+		}
+	}
+}
+
+// setupTLS returns the TLS settings for serving HTTPS directly, and the
+// handler for the plain HTTP listener, which answers ACME challenges and
+// redirects everything else. Certificate files are returned so they can be
+// reloaded after a renewal; with autocert, renewals are automatic.
+func setupTLS(cfg config.ServerConfig) (*tls.Config, http.Handler, *certificateFiles, error) {
+	redirect := redirectToHTTPS(cfg.Port)
+
+	var tlsConfig *tls.Config
+	var httpHandler http.Handler
+	var files *certificateFiles
+	if len(cfg.AutocertDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		if cfg.ACMEDirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: cfg.ACMEDirectoryURL}
+		}
+		tlsConfig = manager.TLSConfig()
+		httpHandler = manager.HTTPHandler(redirect)
+	} else {
+		files = &certificateFiles{certFile: cfg.TLSCertFile, keyFile: cfg.TLSKeyFile}
+		if err := files.load(); err != nil {
+			return nil, nil, nil, err
+		}
+		tlsConfig = &tls.Config{GetCertificate: files.getCertificate}
+		httpHandler = redirect
+	}
+
+	tlsConfig.MinVersion = tls.VersionTLS12
+	if cfg.TLSMinVersion == "1.3" {
+		tlsConfig.MinVersion = tls.VersionTLS13
+	}
+	if !cfg.HTTP2 {
+		var protos []string
+		for _, proto := range tlsConfig.NextProtos {
+			if proto != "h2" {
+				protos = append(protos, proto)
+			}
+		}
+		tlsConfig.NextProtos = protos
+	}
+	return tlsConfig, httpHandler, files, nil
+}
+
+// redirectToHTTPS redirects requests to the same URL over HTTPS on port
+func redirectToHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// certificateFiles serves the certificate in TLS_CERT_FILE and TLS_KEY_FILE,
+// loaded again on SIGHUP once a renewal has replaced them
+type certificateFiles struct {
+	certFile string
+	keyFile  string
+	current  atomic.Value // *tls.Certificate
+}
+
+func (f *certificateFiles) load() error {
+	certificate, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	f.current.Store(&certificate)
+	return nil
+}
+
+func (f *certificateFiles) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return f.current.Load().(*tls.Certificate), nil
+}
+
+// setup loads the configuration and sets up logging and encryption, for
+// the server and every admin command
+func setup() (*config.Config, *logrus.Logger, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// One logger for the server, shared by the packages that log through
+	// logrus directly
+	logger, err := logging.Setup(cfg.Logging, cfg.IsDevelopment())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up logging: %w", err)
+	}
+
+	// Initialize encryption. With key management and a Vault or KMS master
+	// key, ENCRYPTION_KEY is optional and only reads older data.
+	if cfg.Security.EncryptionKey != "" {
+		if err := utils.InitializeEncryption(cfg.Security.EncryptionKey); err != nil {
+			return nil, nil, fmt.Errorf("failed to initialize encryption: %w", err)
+		}
+	}
+	return cfg, logger, nil
+}
+
+// loadEncryptionKeys loads the managed data keys when key management is on
+func loadEncryptionKeys(ctx context.Context, cfg *config.Config, db *gorm.DB, logger *logrus.Logger) error {
+	if !cfg.Encryption.KeyManagement {
+		return nil
+	}
+	if err := newKeyManagementService(cfg, db).LoadKeys(ctx); err != nil {
+		return err
+	}
+	logger.WithField("key_id", utils.CurrentKeyID()).Info("Loaded encryption keys")
+	return nil
+}
+
+func newKeyManagementService(cfg *config.Config, db *gorm.DB) *services.KeyManagementService {
+	masterKey := services.NewMasterKeyProvider(cfg.Encryption, cfg.Security.EncryptionKey)
+	return services.NewKeyManagementService(db, masterKey, cfg.Encryption)
+}
+
+// seedReferenceData adds the starter data features rely on where it is
+// missing. Failures are logged, the server works without it.
+func seedReferenceData(db *gorm.DB, logger *logrus.Logger) {
+	// Seed the drug interaction dataset
+	if err := database.SeedDrugInteractions(db); err != nil {
+		logger.WithError(err).Warn("Failed to seed drug interactions")
+	}
+
+	// Seed the starter customer segments
+	if err := database.SeedSegments(db); err != nil {
+		logger.WithError(err).Warn("Failed to seed customer segments")
+	}
+
+	// Seed the starter loyalty tiers
+	if err := database.SeedLoyaltyTiers(db); err != nil {
+		logger.WithError(err).Warn("Failed to seed loyalty tiers")
+	}
+
+	// Seed the starter campaigns (inactive)
+	if err := database.SeedCampaigns(db); err != nil {
+		logger.WithError(err).Warn("Failed to seed campaigns")
+	}
+
+	// Seed the starter SMS templates
+	if err := database.SeedSMSTemplates(db); err != nil {
+		logger.WithError(err).Warn("Failed to seed SMS templates")
+	}
+
+	// Record purchase history for sales and orders that predate it
+	if created, err := database.BackfillPurchaseHistory(db); err != nil {
+		logger.WithError(err).Warn("Failed to backfill purchase history")
+	} else if created > 0 {
+		logger.WithField("rows", created).Info("Backfilled purchase history")
+	}
 }
 
 func connectDatabase(cfg *config.Config, logger *logrus.Logger) (*gorm.DB, error) {
-	// Configure GORM logger
-	var gormLogger gormlogger.Interface
+	// Configure GORM logger. Its slow query log would print the values of
+	// each statement, so it is left to database.TrackQueries.
+	gormLogger := gormlogger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), gormlogger.Config{
+		LogLevel: gormlogger.Warn,
+		Colorful: true,
+	})
 	if cfg.IsDevelopment() {
-		gormLogger = gormlogger.Default.LogMode(gormlogger.Info)
-	} else {
-		gormLogger = gormlogger.Default.LogMode(gormlogger.Warn)
+		gormLogger = gormLogger.LogMode(gormlogger.Info)
 	}
 
 	var db *gorm.DB
@@ -195,6 +953,10 @@ func connectDatabase(cfg *config.Config, logger *logrus.Logger) (*gorm.DB, error
 }
 
 func connectRedis(cfg *config.Config, logger *logrus.Logger) *redis.Client {
+	if !cfg.Redis.Enabled {
+		return nil
+	}
+
 	// Build Redis URL
 	redisURL := fmt.Sprintf("redis://%s:%s/%d", cfg.Redis.Host, cfg.Redis.Port, cfg.Redis.DB)
 	
@@ -225,22 +987,58 @@ func connectRedis(cfg *config.Config, logger *logrus.Logger) *redis.Client {
 	return client
 }
 
-func setupRouter(middleware *middleware.SecurityMiddleware, handlers *api.Handlers) *gin.Engine {
-	router := gin.New()
+// apiVersions are the API versions routed, named here as setupRouter's
+// middleware parameter hides the package
+var apiVersions = middleware.APIVersions
+
+// Route classes, which decide how long a route has to answer, named here
+// for the same reason
+const (
+	posRoutes    = middleware.RoutePOS
+	reportRoutes = middleware.RouteReport
+	streamRoutes = middleware.RouteStream
+)
+
+// newEngine creates a router for one of the server's listeners. Every
+// listener believes the same proxies, so a client IP seen by one is the
+// one seen by the others.
+func newEngine(network config.NetworkAccessConfig, logger *logrus.Logger) *gin.Engine {
+	engine := gin.New()
+
+	// Once client IPs gate access, only believe X-Forwarded-For from known
+	// proxies, otherwise any client could claim an allowed address
+	if len(network.TrustedProxies) > 0 || len(network.RoleIPAllowlist) > 0 {
+		if err := engine.SetTrustedProxies(network.TrustedProxies); err != nil {
+			logger.WithError(err).Fatal("Invalid trusted proxies")
+		}
+	}
+	return engine
+}
 
+func setupRouter(router *gin.Engine, middleware *middleware.SecurityMiddleware, handlers *api.Handlers) *gin.Engine {
 	// Apply global middleware
 	router.Use(middleware.RequestID())
+	handlers.RegisterMetrics(router) // request timing and /metrics, when METRICS_ENABLED
 	router.Use(middleware.Logger())
+	router.Use(middleware.Compress())
+	router.Use(middleware.ErrorEnvelope())
+	router.Use(middleware.APIVersioning())
 	router.Use(middleware.Recovery())
+	router.Use(middleware.Timeouts())
 	router.Use(middleware.SecurityHeaders())
 	router.Use(middleware.CORS())
 	router.Use(middleware.RateLimit())
+	router.Use(middleware.ReadRouting())
 	router.Use(middleware.ValidateJSON())
 	router.Use(middleware.HIPAACompliance())
+	router.Use(middleware.RedactPHI())
 	router.Use(middleware.AuditLog())
 
-	// Health check endpoint (no auth required)
+	// Health check endpoints (no auth required). /healthz and /readyz are
+	// the liveness and readiness probes.
 	router.GET("/health", handlers.HealthCheck)
+	router.GET("/healthz", handlers.Liveness)
+	router.GET("/readyz", handlers.Readiness)
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Pharmacy Management System API",
@@ -249,158 +1047,676 @@ func setupRouter(middleware *middleware.SecurityMiddleware, handlers *api.Handle
 		})
 	})
 
-	// API routes
-	v1 := router.Group("/api/v1")
+	// API routes. Every version serves the same routes; APIVersioning
+	// shapes the responses for each.
+	for _, version := range apiVersions {
+		registerAPIRoutes(router.Group("/api/"+version), middleware, handlers)
+	}
+
+	return router
+}
+
+// registerDebugRoutes adds the admin-only profiling endpoints under /debug
+func registerDebugRoutes(router *gin.Engine, middleware *middleware.SecurityMiddleware, handlers *api.Handlers) {
+	debug := router.Group("/debug")
+	debug.Use(middleware.Auth(), middleware.AdminOnly())
+	handlers.RegisterDebugRoutes(debug)
+}
+
+// registerAPIRoutes adds the API's routes to a version's group
+func registerAPIRoutes(group *gin.RouterGroup, middleware *middleware.SecurityMiddleware, handlers *api.Handlers) {
+	// Authentication routes (no auth required)
+	auth := group.Group("/auth")
+	{
+		auth.POST("/login", handlers.Login)
+		auth.POST("/refresh", handlers.RefreshToken)
+		auth.POST("/logout", middleware.Auth(), handlers.Logout)
+		auth.POST("/change-password", middleware.Auth(), handlers.ChangePassword)
+		auth.POST("/bootstrap", handlers.BootstrapAdmin)
+		auth.POST("/password/forgot", handlers.ForgotPassword)
+		auth.POST("/password/reset", handlers.ResetPassword)
+		handlers.RegisterDevRoutes(auth) // create-test-user, dev builds only
+	}
+
+	// POS terminal pairing; the device has no user session yet
+	terminalDevices := group.Group("/terminals")
+	terminalDevices.Use(middleware.Timeout(posRoutes))
+	{
+		terminalDevices.POST("/pair", handlers.PairTerminal)
+		terminalDevices.POST("/heartbeat", handlers.TerminalHeartbeat)
+		// The station agent's print and cash drawer jobs
+		terminalDevices.POST("/jobs/claim", handlers.ClaimStationJobs)
+		terminalDevices.POST("/jobs/:jobId/result", handlers.ReportStationJob)
+		// Employees clock in and out with their badge at the register
+		terminalDevices.POST("/clock", handlers.BadgeClock)
+	}
+
+	// Uploads kept on local disk, through signed URLs (no auth required)
+	group.GET("/files/*key", handlers.ServeSignedFile)
+
+	// QR Code routes (some public for scanning)
+	qr := group.Group("/qr")
+	{
+		// Public QR scanning (no auth required for mobile apps, staff
+		// tokens unlock customer flags)
+		qr.POST("/scan", middleware.RequireFeature(config.FeatureQRScanning), middleware.OptionalAuth(), handlers.ScanQR)
+		qr.GET("/track/:code", handlers.TrackOrder) // Public order tracking
+		
+		// Protected QR operations
+		qr.POST("/products/:id/generate", middleware.Auth(), middleware.RequirePermission("products", "update"), handlers.GenerateProductQR)
+		qr.POST("/customers/:id/generate", middleware.Auth(), middleware.RequirePermission("customers", "update"), handlers.GenerateCustomerQR)
+		qr.GET("/scan-history", middleware.Auth(), middleware.AdminOnly(), handlers.GetQRScanHistory)
+	}
+
+	// Shopping Cart routes (supports both auth and guest users)
+	cart := group.Group("/cart")
+	{
+		cart.POST("/add", middleware.RequireFeature(config.FeatureOnlineOrdering), handlers.AddToCart) // Auth optional
+		cart.GET("", handlers.GetCart)                  // Auth optional
+		cart.PUT("/:id", handlers.UpdateCartItem)       // Auth optional
+		cart.DELETE("/:id", handlers.RemoveFromCart)    // Auth optional
+		cart.DELETE("", handlers.ClearCart)             // Auth optional
+	}
+
+	// One-tap refill reorder from reminder links
+	group.POST("/refills/reorder/:token", middleware.RequireFeature(config.FeatureRefillReorder), handlers.ReorderRefill)
+
+	// Unsubscribe links in customer notifications
+	group.POST("/unsubscribe/:token", handlers.Unsubscribe)
+
+	// Feedback links and QR codes handed over with orders, and the
+	// comments published from them
+	group.GET("/feedback/form/:token", handlers.GetFeedbackForm)
+	group.POST("/feedback/form/:token", handlers.SubmitFeedback)
+	group.GET("/feedback/published", handlers.GetPublishedFeedback)
+
+	// Browser CSP violation reports (point CSP_REPORT_URI here)
+	group.POST("/csp-report", handlers.ReceiveCSPReport)
+
+	// SMS delivery receipts from Twilio (point SMS_STATUS_CALLBACK_URL here)
+	group.POST("/sms/status/twilio", handlers.ReceiveTwilioStatus)
+	
+	// Bounces, spam reports and unsubscribes from SendGrid's signed event
+	// webhook
+	group.POST("/email/events/sendgrid", handlers.ReceiveSendGridEvents)
+
+	// Events from payment providers, couriers and marketplaces, signed
+	// with the integration's secret from INBOUND_WEBHOOK_SECRETS
+	group.POST("/webhooks/:integration", handlers.ReceiveWebhook)
+
+	// Push notification devices. A staff token registers the device for
+	// staff alerts; the ordering app registers its guest session
+	// (X-Session-ID) for updates on the orders it places.
+	push := group.Group("/push")
+	{
+		push.POST("/devices", middleware.OptionalAuth(), handlers.RegisterPushDevice)
+		push.DELETE("/devices", handlers.UnregisterPushDevice) // by token
+		push.GET("/devices", middleware.Auth(), handlers.GetPushDevices)
+		push.DELETE("/devices/:id", middleware.Auth(), handlers.DeletePushDevice)
+		push.GET("/preferences", middleware.Auth(), handlers.GetStaffAlertPreferences)
+		push.PUT("/preferences", middleware.Auth(), handlers.UpdateStaffAlertPreferences)
+	}
+
+	// Public Products browsing (for ordering system)
+	group.GET("/products/browse", middleware.CacheResponse(cache.Products), handlers.BrowseProducts) // Public product browsing, never the deleted ones
+
+	// Online Orders routes
+	orders := group.Group("/orders")
+	{
+		// Public order creation and tracking
+		orders.POST("", middleware.RequireFeature(config.FeatureOnlineOrdering), middleware.Idempotency(), handlers.CreateOnlineOrder) // Auth optional (guest orders)
+		orders.GET("/track/:code", handlers.TrackOrder)                // Public tracking, by the order's tracking code
+		orders.POST("/:id/prescriptions", middleware.OptionalAuth(), handlers.UploadOrderPrescription) // Customer or guest session prescription upload
+		orders.POST("/delivery-quote", middleware.RequireFeature(config.FeatureOnlineOrdering), handlers.GetDeliveryQuote) // Check a delivery address before checkout
+		
+		// Protected order management
+		protected := orders.Group("")
+		protected.Use(middleware.Auth())
+		{
+			protected.GET("", handlers.GetOnlineOrders)                              // List orders
+			protected.GET("/:id", handlers.GetOnlineOrder)                          // Get specific order
+			protected.GET("/number/:number", middleware.RequirePermission("sales", "read"), handlers.GetOnlineOrderByNumber) // Receipt lookup
+			protected.PUT("/:id/status", middleware.RequirePermission("sales", "update"), handlers.UpdateOrderStatus) // Update status
+			protected.GET("/:id/labels", middleware.RequirePermission("sales", "read"), handlers.PrintOrderLabels)       // Dispensing labels
+			protected.GET("/pick-list", middleware.RequirePermission("sales", "read"), handlers.GetPickList)             // What to pick for a batch of orders
+			protected.POST("/pick-list/print", middleware.RequirePermission("sales", "create"), handlers.PrintPickList)  // ... on a station's printer
+			protected.POST("/:id/items/:itemId/pick", middleware.RequirePermission("sales", "update"), handlers.PickOrderItem) // Scan an item off the shelf; the last makes the order ready
+			protected.GET("/:id/feedback", middleware.RequirePermission("sales", "read"), handlers.GetOrderFeedback)        // Feedback link and QR code
+			protected.POST("/:id/feedback", middleware.RequirePermission("sales", "update"), handlers.RequestOrderFeedback) // ... for an order fulfilled before it was asked
+			protected.GET("/customer/:customer_id", middleware.RequirePermission("customers", "read"), handlers.GetCustomerOnlineOrders) // Customer orders
+		}
+	}
+
+	// Protected routes
+	protected := group.Group("")
+	protected.Use(middleware.Auth())
 	{
-		// Authentication routes (no auth required)
-		auth := v1.Group("/auth")
+		// Test endpoint for debugging auth issues
+		protected.GET("/test", handlers.TestEndpoint)
+
+		// Order and stock changes as server-sent events, for the
+		// fulfillment screen and stock displays
+		protected.GET("/stream", middleware.Timeout(streamRoutes), handlers.Stream)
+		// User management (admin only)
+		users := protected.Group("/users")
+		users.Use(middleware.AdminOnly())
 		{
-			auth.POST("/login", handlers.Login)
-			auth.POST("/refresh", handlers.RefreshToken)
-			auth.POST("/logout", middleware.Auth(), handlers.Logout)
-			auth.POST("/change-password", middleware.Auth(), handlers.ChangePassword)
-			auth.POST("/create-test-user", handlers.CreateTestUser) // Development only
+			users.GET("", handlers.GetUsers)
+			users.POST("", handlers.CreateUser)
+			users.GET("/:id", handlers.GetUser)
+			users.PUT("/:id", handlers.UpdateUser)
+			users.DELETE("/:id", handlers.DeleteUser)
+			users.GET("/:id/devices", handlers.GetUserLoginDevices)
+			users.PUT("/:id/branch", handlers.AssignUserBranch)
 		}
 
-		// QR Code routes (some public for scanning)
-		qr := v1.Group("/qr")
+		// Branches. Staff work in their own branch; admins pick one with
+		// the X-Branch-ID header or work across all of them.
+		branches := protected.Group("/branches")
 		{
-			// Public QR scanning (no auth required for mobile apps)
-			qr.POST("/scan", handlers.ScanQR)
-			qr.GET("/track/:number", handlers.TrackOrder) // Public order tracking
-			
-			// Protected QR operations
-			qr.POST("/products/:id/generate", middleware.Auth(), middleware.RequirePermission("products", "update"), handlers.GenerateProductQR)
-			qr.POST("/customers/:id/generate", middleware.Auth(), middleware.RequirePermission("customers", "update"), handlers.GenerateCustomerQR)
-			qr.GET("/scan-history", middleware.Auth(), middleware.AdminOnly(), handlers.GetQRScanHistory)
+			branches.GET("", handlers.GetBranches)
+			branches.POST("", middleware.AdminOnly(), handlers.CreateBranch)
+			branches.PUT("/:id", middleware.AdminOnly(), handlers.UpdateBranch)
+			branches.GET("/:id/stock", middleware.RequirePermission("products", "read"), handlers.GetBranchStock)
+			branches.GET("/:id/prices", middleware.RequirePermission("products", "read"), handlers.GetBranchPrices)
+			branches.PUT("/:id/prices/:product_id", middleware.AdminOnly(), handlers.SetBranchPrice)
+			branches.DELETE("/:id/prices/:product_id", middleware.AdminOnly(), handlers.ClearBranchPrice)
+			branches.GET("/transfers", middleware.RequirePermission("products", "read"), handlers.GetTransfers)
+			branches.POST("/transfers", middleware.RequirePermission("products", "update"), handlers.ShipTransfer)
+			branches.POST("/transfers/:id/receive", middleware.RequirePermission("products", "update"), handlers.ReceiveTransfer)
 		}
 
-		// Shopping Cart routes (supports both auth and guest users)
-		cart := v1.Group("/cart")
+		// Areas the branches deliver to, and their delivery fees
+		deliveryZones := protected.Group("/delivery-zones")
 		{
-			cart.POST("/add", handlers.AddToCart)           // Auth optional
-			cart.GET("", handlers.GetCart)                  // Auth optional
-			cart.PUT("/:id", handlers.UpdateCartItem)       // Auth optional
-			cart.DELETE("/:id", handlers.RemoveFromCart)    // Auth optional
-			cart.DELETE("", handlers.ClearCart)             // Auth optional
+			deliveryZones.GET("", handlers.GetDeliveryZones)
+			deliveryZones.POST("", middleware.AdminOnly(), handlers.CreateDeliveryZone)
+			deliveryZones.PUT("/:id", middleware.AdminOnly(), handlers.UpdateDeliveryZone)
+			deliveryZones.DELETE("/:id", middleware.AdminOnly(), handlers.DeleteDeliveryZone)
 		}
 
-		// Public Products browsing (for ordering system)
-		v1.GET("/products/browse", handlers.GetProducts) // Public product browsing
+		// POS terminals. Sales rung up with a paired terminal's
+		// X-Terminal-Token take its next invoice number.
+		terminals := protected.Group("/terminals")
+		{
+			terminals.GET("", middleware.AdminOnly(), handlers.GetTerminals)
+			terminals.POST("", middleware.AdminOnly(), handlers.CreateTerminal)
+			terminals.PUT("/:id", middleware.AdminOnly(), handlers.UpdateTerminal)
+			terminals.POST("/:id/pairing-code", middleware.AdminOnly(), handlers.StartTerminalPairing)
+			terminals.DELETE("/:id/pairing", middleware.AdminOnly(), handlers.UnpairTerminal)
+			terminals.GET("/:id/z-report", middleware.RequirePermission("sales", "read"), middleware.Timeout(reportRoutes), handlers.GetTerminalZReport)
+
+			// Receipts, labels and drawer openings sent to the station
+			// agent beside the terminal
+			terminals.GET("/:id/jobs", middleware.RequirePermission("sales", "read"), handlers.GetStationJobs)
+			terminals.POST("/:id/jobs/receipt", middleware.RequirePermission("sales", "create"), handlers.PrintReceipt)
+			terminals.POST("/:id/jobs/labels", middleware.RequirePermission("sales", "create"), handlers.PrintStationLabels)
+			terminals.POST("/:id/jobs/drawer", middleware.RequirePermission("sales", "create"), handlers.OpenCashDrawer)
+			terminals.GET("/jobs/:jobId", middleware.RequirePermission("sales", "read"), handlers.GetStationJob)
+			terminals.POST("/jobs/:jobId/cancel", middleware.RequirePermission("sales", "create"), handlers.CancelStationJob)
+			terminals.POST("/jobs/:jobId/retry", middleware.RequirePermission("sales", "create"), handlers.RetryStationJob)
+		}
 
-		// Online Orders routes
-		orders := v1.Group("/orders")
+		// Exchange rates for customers paying in a foreign currency.
+		// Amounts are always kept in the pharmacy's own currency.
+		currencies := protected.Group("/currencies")
 		{
-			// Public order creation and tracking
-			orders.POST("", handlers.CreateOnlineOrder)                    // Auth optional (guest orders)
-			orders.GET("/track/:number", handlers.TrackOrder)              // Public tracking
-			orders.GET("/number/:number", handlers.GetOnlineOrderByNumber) // Public lookup
-			
-			// Protected order management
-			protected := orders.Group("")
-			protected.Use(middleware.Auth())
-			{
-				protected.GET("", handlers.GetOnlineOrders)                              // List orders
-				protected.GET("/:id", handlers.GetOnlineOrder)                          // Get specific order
-				protected.PUT("/:id/status", middleware.RequirePermission("sales", "update"), handlers.UpdateOrderStatus) // Update status
-				protected.GET("/customer/:customer_id", middleware.RequirePermission("customers", "read"), handlers.GetCustomerOnlineOrders) // Customer orders
-			}
+			currencies.GET("/rates", handlers.GetExchangeRates)
+			currencies.PUT("/rates/:currency", middleware.AdminOnly(), handlers.SetExchangeRate)
+			currencies.DELETE("/rates/:currency", middleware.AdminOnly(), handlers.DeleteExchangeRate)
+			currencies.GET("/convert", handlers.ConvertAmount)
 		}
 
-		// Protected routes
-		protected := v1.Group("")
-		protected.Use(middleware.Auth())
+		// Head office reports across all branches, with a drill-down
+		// into each (head office managers and admins only)
+		headOffice := protected.Group("/head-office")
+		headOffice.Use(middleware.HeadOfficeOnly(), middleware.Timeout(reportRoutes))
 		{
-			// Test endpoint for debugging auth issues
-			protected.GET("/test", handlers.TestEndpoint)
-			// User management (admin only)
-			users := protected.Group("/users")
-			users.Use(middleware.AdminOnly())
-			{
-				users.GET("", handlers.GetUsers)
-				users.POST("", handlers.CreateUser)
-				users.GET("/:id", handlers.GetUser)
-				users.PUT("/:id", handlers.UpdateUser)
-				users.DELETE("/:id", handlers.DeleteUser)
-			}
-
-			// Customer management
-			customers := protected.Group("/customers")
-			{
-				customers.GET("", middleware.RequirePermission("customers", "read"), handlers.GetCustomers)
-				customers.POST("", middleware.RequirePermission("customers", "create"), handlers.CreateCustomer)
-				customers.GET("/:id", middleware.RequirePermission("customers", "read"), handlers.GetCustomer)
-				customers.PUT("/:id", middleware.RequirePermission("customers", "update"), handlers.UpdateCustomer)
-				customers.DELETE("/:id", middleware.RequirePermission("customers", "delete"), handlers.DeleteCustomer)
-				customers.GET("/:id/history", middleware.RequirePermission("customers", "read"), handlers.GetCustomerPurchaseHistory)
-				customers.GET("/:id/interactions/:medication", middleware.RequirePermission("customers", "read"), handlers.CheckMedicationInteractions)
-				customers.POST("/:id/upload-id", middleware.RequirePermission("customers", "update"), handlers.UploadCustomerID)
-			}
-
-			// Product/Inventory management
-			products := protected.Group("/products")
-			{
-				products.GET("", middleware.RequirePermission("products", "read"), handlers.GetProducts)
-				products.POST("", middleware.RequirePermission("products", "create"), handlers.CreateProduct)
-				products.GET("/:id", middleware.RequirePermission("products", "read"), handlers.GetProduct)
-				products.PUT("/:id", middleware.RequirePermission("products", "update"), handlers.UpdateProduct)
-				products.DELETE("/:id", middleware.RequirePermission("products", "delete"), handlers.DeleteProduct)
-				products.POST("/:id/stock", middleware.RequirePermission("products", "update"), handlers.UpdateStock)
-				products.GET("/low-stock", middleware.RequirePermission("products", "read"), handlers.GetLowStockProducts)
-				products.GET("/expiring", middleware.RequirePermission("products", "read"), handlers.GetExpiringProducts)
-			}
-
-			// Supplier management
-			suppliers := protected.Group("/suppliers")
-			{
-				suppliers.GET("", middleware.RequirePermission("products", "read"), handlers.GetSuppliers)
-				suppliers.POST("", middleware.RequirePermission("products", "create"), handlers.CreateSupplier)
-				suppliers.GET("/:id", middleware.RequirePermission("products", "read"), handlers.GetSupplier)
-				suppliers.PUT("/:id", middleware.RequirePermission("products", "update"), handlers.UpdateSupplier)
-				suppliers.DELETE("/:id", middleware.RequirePermission("products", "delete"), handlers.DeleteSupplier)
-			}
-
-			// Service management (medical services)
-			services := protected.Group("/services")
-			{
-				services.GET("", middleware.RequirePermission("products", "read"), handlers.GetServices)
-				services.POST("", middleware.RequirePermission("products", "create"), handlers.CreateService)
-				services.GET("/:id", middleware.RequirePermission("products", "read"), handlers.GetService)
-				services.PUT("/:id", middleware.RequirePermission("products", "update"), handlers.UpdateService)
-				services.DELETE("/:id", middleware.RequirePermission("products", "delete"), handlers.DeleteService)
-				services.GET("/categories", middleware.RequirePermission("products", "read"), handlers.GetServiceCategories)
-			}
-
-			// Sales management (POS sales)
-			sales := protected.Group("/sales")
-			{
-				sales.GET("", middleware.RequirePermission("sales", "read"), handlers.GetSales)
-				sales.POST("", middleware.RequirePermission("sales", "create"), handlers.CreateSale)
-				sales.GET("/:id", middleware.RequirePermission("sales", "read"), handlers.GetSale)
-				sales.POST("/:id/refund", middleware.RequirePermission("sales", "refund"), handlers.RefundSale)
-				sales.GET("/reports/daily", middleware.RequirePermission("sales", "read"), handlers.GetDailySalesReport)
-				sales.GET("/reports/summary", middleware.RequirePermission("sales", "read"), handlers.GetSalesSummary)
-			}
-
-			// Analytics
-			analytics := protected.Group("/analytics")
-			analytics.Use(middleware.RequirePermission("analytics", "read"))
-			{
-				analytics.GET("/dashboard", handlers.GetDashboardAnalytics)
-				analytics.GET("/inventory-movement", handlers.GetInventoryMovementAnalysis)
-				analytics.GET("/sales", handlers.GetSalesAnalytics)
-				analytics.GET("/customers", handlers.GetCustomerAnalytics)
-				analytics.GET("/discounts", handlers.GetDiscountAnalytics)
-			}
-
-			// Audit logs (admin only)
-			audit := protected.Group("/audit")
-			audit.Use(middleware.AdminOnly())
-			{
-				audit.GET("/logs", handlers.GetAuditLogs)
-			}
+			headOffice.GET("/sales", handlers.GetBranchSalesRollup)
+			headOffice.GET("/sales/:id", handlers.GetBranchSalesDetail)
+			headOffice.POST("/sales/email", handlers.EmailBranchSalesRollup)
+			headOffice.GET("/stock", handlers.GetBranchStockRollup)
+			headOffice.GET("/stock/:id", handlers.GetBranchStock)
+			headOffice.GET("/transfers", handlers.GetBranchTransitRollup)
+			headOffice.GET("/transfers/:id", handlers.GetBranchTransitDetail)
 		}
-	}
 
-	return router
+		// Customer management
+		customers := protected.Group("/customers")
+		{
+			customers.GET("", middleware.RequirePermission("customers", "read"), middleware.RequirePermissionForDeleted("customers"), handlers.GetCustomers)
+			customers.POST("", middleware.RequirePermission("customers", "create"), handlers.CreateCustomer)
+			customers.POST("/import", middleware.RequirePermission("customers", "import"), middleware.Timeout(reportRoutes), handlers.ImportCustomers)
+			customers.POST("/bulk", middleware.RequirePermission("customers", "import"), middleware.Timeout(reportRoutes), handlers.BulkImportCustomers)
+			customers.GET("/:id", middleware.RequirePermission("customers", "read"), handlers.GetCustomer)
+			customers.PUT("/:id", middleware.RequirePermission("customers", "update"), handlers.UpdateCustomer)
+			customers.DELETE("/:id", middleware.RequirePermission("customers", "delete"), handlers.DeleteCustomer)
+			customers.POST("/:id/restore", middleware.RequirePermission("customers", "delete"), handlers.RestoreCustomer)
+			customers.GET("/:id/history", middleware.RequirePermission("customers", "read"), handlers.GetCustomerPurchaseHistory)
+			customers.GET("/:id/interactions/:medication", middleware.RequirePermission("customers", "read"), handlers.CheckMedicationInteractions)
+			customers.POST("/:id/interactions/check", middleware.RequirePermission("customers", "read"), handlers.CheckCustomerInteractions)
+			customers.POST("/:id/screening", middleware.RequirePermission("customers", "read"), handlers.ScreenCustomerProducts)
+			customers.GET("/:id/refills", middleware.RequirePermission("customers", "read"), handlers.GetCustomerRefills)
+			customers.GET("/:id/medication-profile", middleware.RequirePermission("customers", "read"), handlers.GetMedicationProfile)
+			customers.POST("/:id/break-glass", middleware.RequirePermission("medical_data", "break_glass"), handlers.BreakGlassCustomerPHI)
+			customers.GET("/:id/clinical-notes", middleware.RequirePermission("clinical_notes", "read"), handlers.GetCustomerClinicalNotes)
+			customers.POST("/:id/clinical-notes", middleware.RequirePermission("clinical_notes", "create"), handlers.CreateClinicalNote)
+			customers.GET("/:id/vaccinations", middleware.RequirePermission("vaccinations", "read"), handlers.GetCustomerVaccinations)
+			customers.POST("/:id/upload-id", middleware.RequirePermission("customers", "update"), handlers.UploadCustomerID)
+			customers.GET("/:id/id-document", middleware.RequirePermission("customers", "read"), handlers.DownloadCustomerIDDocument)
+			customers.GET("/:id/consents", middleware.RequirePermission("customers", "read"), handlers.GetCustomerConsents)
+			customers.POST("/:id/consents", middleware.RequirePermission("customers", "update"), handlers.RecordCustomerConsent)
+			customers.DELETE("/:id/consents/:purpose", middleware.RequirePermission("customers", "update"), handlers.WithdrawCustomerConsent)
+			customers.GET("/:id/dependents", middleware.RequirePermission("customers", "read"), handlers.GetCustomerDependents)
+			customers.POST("/:id/dependents", middleware.RequirePermission("customers", "create"), handlers.CreateCustomerDependent)
+			customers.POST("/:id/dependents/link", middleware.RequirePermission("customers", "update"), handlers.LinkCustomerDependent)
+			customers.DELETE("/:id/dependents/:dependent_id", middleware.RequirePermission("customers", "update"), handlers.UnlinkCustomerDependent)
+			customers.GET("/:id/tags", middleware.RequirePermission("customers", "read"), handlers.GetCustomerTags)
+			customers.POST("/:id/tags", middleware.RequirePermission("customers", "update"), handlers.AddCustomerTags)
+			customers.DELETE("/:id/tags/:tag", middleware.RequirePermission("customers", "update"), handlers.RemoveCustomerTag)
+			customers.GET("/:id/flags", middleware.RequirePermission("customers", "read"), handlers.GetCustomerFlags)
+			customers.POST("/:id/flags", middleware.RequirePermission("customers", "update"), handlers.AddCustomerFlag)
+			customers.PUT("/:id/flags/:flag_id", middleware.RequirePermission("customers", "update"), handlers.UpdateCustomerFlag)
+			customers.POST("/:id/flags/:flag_id/resolve", middleware.RequirePermission("customers", "update"), handlers.ResolveCustomerFlag)
+			customers.POST("/:id/phone-verification", middleware.RequirePermission("customers", "update"), handlers.SendPhoneVerification)
+			customers.POST("/:id/phone-verification/confirm", middleware.RequirePermission("customers", "update"), handlers.ConfirmPhoneVerification)
+			customers.GET("/:id/communication-preferences", middleware.RequirePermission("customers", "read"), handlers.GetCommunicationPreferences)
+			customers.PUT("/:id/communication-preferences", middleware.RequirePermission("customers", "update"), handlers.UpdateCommunicationPreferences)
+			customers.GET("/:id/push-devices", middleware.RequirePermission("customers", "read"), handlers.GetCustomerPushDevices)
+			customers.POST("/:id/push-devices", middleware.RequirePermission("customers", "update"), handlers.RegisterCustomerPushDevice)
+			customers.DELETE("/:id/push-devices/:device_id", middleware.RequirePermission("customers", "update"), handlers.DeleteCustomerPushDevice)
+			customers.GET("/:id/data-export", middleware.RequirePermission("privacy", "export"), handlers.ExportCustomerData)
+			customers.POST("/:id/erase", middleware.RequirePermission("privacy", "erase"), handlers.EraseCustomerData)
+			customers.GET("/:id/loyalty", middleware.RequirePermission("customers", "read"), handlers.GetCustomerLoyalty)
+			customers.POST("/:id/loyalty/adjust", middleware.RequirePermission("loyalty", "adjust"), handlers.AdjustCustomerPoints)
+			customers.GET("/:id/credit", middleware.RequirePermission("customers", "read"), handlers.GetCustomerCredit)
+			customers.POST("/:id/credit/adjust", middleware.RequirePermission("loyalty", "adjust"), handlers.AdjustCustomerCredit)
+			customers.GET("/:id/referral", middleware.RequirePermission("customers", "read"), handlers.GetCustomerReferrals)
+			customers.POST("/:id/referred-by", middleware.RequirePermission("customers", "update"), handlers.RecordReferral)
+			customers.POST("/:id/eligibility/verify", middleware.RequirePermission("eligibility", "verify"), handlers.VerifyCustomerEligibility)
+		}
+
+		// Product/Inventory management
+		products := protected.Group("/products")
+		{
+			products.GET("", middleware.RequirePermission("products", "read"), middleware.RequirePermissionForDeleted("products"), middleware.CacheResponse(cache.Products), handlers.GetProducts)
+			products.POST("", middleware.RequirePermission("products", "create"), middleware.InvalidatesCache(cache.Products), handlers.CreateProduct)
+			products.GET("/:id", middleware.RequirePermission("products", "read"), middleware.CacheResponse(cache.Products), handlers.GetProduct)
+			products.PUT("/:id", middleware.RequirePermission("products", "update"), middleware.InvalidatesCache(cache.Products), handlers.UpdateProduct)
+			products.DELETE("/:id", middleware.RequirePermission("products", "delete"), middleware.InvalidatesCache(cache.Products), handlers.DeleteProduct)
+			products.POST("/:id/restore", middleware.RequirePermission("products", "delete"), middleware.InvalidatesCache(cache.Products), handlers.RestoreProduct)
+			products.POST("/:id/stock", middleware.RequirePermission("products", "update"), handlers.UpdateStock)
+			products.POST("/bulk", middleware.RequirePermission("products", "create"), middleware.RequirePermission("products", "update"), middleware.Timeout(reportRoutes), middleware.InvalidatesCache(cache.Products), handlers.BulkUpsertProducts)
+			products.POST("/stock/bulk", middleware.RequirePermission("products", "update"), middleware.Timeout(reportRoutes), handlers.BulkAdjustStock)
+			products.GET("/stock-movements/export", middleware.RequirePermission("products", "read"), middleware.Timeout(streamRoutes), handlers.ExportStockMovements)
+			products.GET("/low-stock", middleware.RequirePermission("products", "read"), handlers.GetLowStockProducts)
+			products.GET("/expiring", middleware.RequirePermission("products", "read"), handlers.GetExpiringProducts)
+			products.GET("/:id/regulatory-status", middleware.RequirePermission("products", "read"), handlers.GetProductRegulatoryStatus)
+		}
+
+		// FDA Philippines registry and recalls
+		regulatory := protected.Group("/regulatory")
+		{
+			regulatory.GET("/registry", middleware.RequirePermission("products", "read"), handlers.SearchFDARegistry)
+			regulatory.POST("/registry/refresh", middleware.AdminOnly(), middleware.InvalidatesCache(cache.Products), handlers.RefreshFDARegistry)
+			regulatory.POST("/registry/import", middleware.AdminOnly(), middleware.Timeout(reportRoutes), middleware.InvalidatesCache(cache.Products), handlers.ImportFDARegistry)
+			regulatory.GET("/flagged", middleware.RequirePermission("products", "read"), handlers.GetFlaggedProducts)
+			regulatory.GET("/recalls", middleware.RequirePermission("products", "read"), handlers.GetFDARecalls)
+			regulatory.POST("/recalls", middleware.AdminOnly(), middleware.InvalidatesCache(cache.Products), handlers.CreateFDARecall)
+			regulatory.DELETE("/recalls/:id", middleware.AdminOnly(), middleware.InvalidatesCache(cache.Products), handlers.DeleteFDARecall)
+		}
+
+		// Supplier management
+		suppliers := protected.Group("/suppliers")
+		{
+			suppliers.GET("", middleware.RequirePermission("products", "read"), middleware.RequirePermissionForDeleted("products"), handlers.GetSuppliers)
+			suppliers.POST("", middleware.RequirePermission("products", "create"), handlers.CreateSupplier)
+			suppliers.GET("/:id", middleware.RequirePermission("products", "read"), handlers.GetSupplier)
+			suppliers.PUT("/:id", middleware.RequirePermission("products", "update"), middleware.InvalidatesCache(cache.Products), handlers.UpdateSupplier)
+			suppliers.DELETE("/:id", middleware.RequirePermission("products", "delete"), middleware.InvalidatesCache(cache.Products), handlers.DeleteSupplier)
+			suppliers.POST("/:id/restore", middleware.RequirePermission("products", "delete"), middleware.InvalidatesCache(cache.Products), handlers.RestoreSupplier)
+		}
+
+		// Service management (medical services)
+		services := protected.Group("/services")
+		{
+			services.GET("", middleware.RequirePermission("products", "read"), middleware.RequirePermissionForDeleted("products"), middleware.CacheResponse(cache.Services), handlers.GetServices)
+			services.POST("", middleware.RequirePermission("products", "create"), middleware.InvalidatesCache(cache.Services), handlers.CreateService)
+			services.GET("/:id", middleware.RequirePermission("products", "read"), middleware.CacheResponse(cache.Services), handlers.GetService)
+			services.PUT("/:id", middleware.RequirePermission("products", "update"), middleware.InvalidatesCache(cache.Services), handlers.UpdateService)
+			services.DELETE("/:id", middleware.RequirePermission("products", "delete"), middleware.InvalidatesCache(cache.Services), handlers.DeleteService)
+			services.POST("/:id/restore", middleware.RequirePermission("products", "delete"), middleware.InvalidatesCache(cache.Services), handlers.RestoreService)
+			services.GET("/categories", middleware.RequirePermission("products", "read"), middleware.CacheResponse(cache.Services), handlers.GetServiceCategories)
+		}
+
+		// Cold chain: refrigerated storage units, their temperature logs
+		// and excursion reports
+		coldChain := protected.Group("/cold-chain")
+		{
+			coldChain.GET("/units", middleware.RequirePermission("products", "read"), handlers.GetStorageUnits)
+			coldChain.POST("/units", middleware.RequirePermission("products", "create"), handlers.CreateStorageUnit)
+			coldChain.GET("/units/:id", middleware.RequirePermission("products", "read"), handlers.GetStorageUnit)
+			coldChain.PUT("/units/:id", middleware.RequirePermission("products", "update"), handlers.UpdateStorageUnit)
+			coldChain.GET("/units/:id/readings", middleware.RequirePermission("products", "read"), handlers.GetTemperatureReadings)
+			coldChain.POST("/units/:id/readings", middleware.RequirePermission("products", "update"), handlers.RecordTemperature)
+			coldChain.GET("/excursions", middleware.RequirePermission("products", "read"), handlers.GetTemperatureExcursions)
+			coldChain.GET("/excursions/:id", middleware.RequirePermission("products", "read"), handlers.GetTemperatureExcursion)
+			// What becomes of stock after an excursion is a pharmacist's call
+			coldChain.POST("/excursions/:id/review", middleware.RequirePermission("prescriptions", "verify"), handlers.ReviewTemperatureExcursion)
+		}
+
+		// Prescription uploads and pharmacist verification queue
+		prescriptions := protected.Group("/prescriptions")
+		{
+			prescriptions.POST("", middleware.RequirePermission("prescriptions", "create"), handlers.UploadPrescription)
+			prescriptions.GET("/pending", middleware.RequirePermission("prescriptions", "read"), handlers.GetPendingPrescriptions)
+			prescriptions.GET("/:id", middleware.RequirePermission("prescriptions", "read"), handlers.GetPrescription)
+			prescriptions.GET("/:id/file", middleware.RequirePermission("prescriptions", "read"), handlers.DownloadPrescriptionFile)
+			prescriptions.POST("/:id/approve", middleware.RequirePermission("prescriptions", "verify"), handlers.ApprovePrescription)
+			prescriptions.POST("/:id/reject", middleware.RequirePermission("prescriptions", "verify"), handlers.RejectPrescription)
+			prescriptions.POST("/fhir", middleware.RequirePermission("prescriptions", "create"), handlers.ImportFHIRPrescriptions)
+			prescriptions.GET("/:id/ocr", middleware.RequirePermission("prescriptions", "read"), handlers.GetPrescriptionOCR)
+			prescriptions.POST("/:id/ocr", middleware.RequirePermission("prescriptions", "verify"), handlers.RunPrescriptionOCR)
+			prescriptions.POST("/:id/ocr/confirm", middleware.RequirePermission("prescriptions", "verify"), handlers.ConfirmPrescriptionOCR)
+		}
+
+		// Refill follow-up
+		refills := protected.Group("/refills")
+		{
+			refills.GET("/upcoming", middleware.RequirePermission("customers", "read"), handlers.GetUpcomingRefills)
+			refills.POST("/reminders/send", middleware.RequirePermission("customers", "update"), handlers.SendRefillReminders)
+			refills.POST("/:id/cancel", middleware.RequirePermission("customers", "update"), handlers.CancelRefill)
+		}
+
+		// Customer feedback on orders and its moderation
+		feedback := protected.Group("/feedback")
+		{
+			feedback.GET("", middleware.RequirePermission("feedback", "read"), handlers.GetFeedbackList)
+			feedback.GET("/:id", middleware.RequirePermission("feedback", "read"), handlers.GetFeedback)
+			feedback.POST("/:id/moderate", middleware.RequirePermission("feedback", "moderate"), handlers.ModerateFeedback)
+		}
+
+		// Pharmacist counseling and intervention log
+		clinicalNotes := protected.Group("/clinical-notes")
+		{
+			clinicalNotes.GET("", middleware.RequirePermission("clinical_notes", "read"), handlers.GetClinicalNotes)
+			clinicalNotes.GET("/export", middleware.RequirePermission("clinical_notes", "export"), middleware.Timeout(reportRoutes), handlers.ExportClinicalNotes)
+			clinicalNotes.PUT("/:id/outcome", middleware.RequirePermission("clinical_notes", "update"), handlers.RecordClinicalNoteOutcome)
+		}
+
+		// Vaccine administration records and certificates
+		vaccinations := protected.Group("/vaccinations")
+		{
+			vaccinations.POST("", middleware.RequirePermission("vaccinations", "create"), handlers.RecordVaccination)
+			vaccinations.GET("/due", middleware.RequirePermission("vaccinations", "read"), handlers.GetDueVaccinations)
+			vaccinations.POST("/reminders/send", middleware.RequirePermission("vaccinations", "create"), handlers.SendVaccinationReminders)
+			vaccinations.GET("/:id", middleware.RequirePermission("vaccinations", "read"), handlers.GetVaccination)
+			vaccinations.GET("/:id/certificate", middleware.RequirePermission("vaccinations", "read"), handlers.GetVaccinationCertificate)
+		}
+
+		// Customer tags, segments and targeted promotions
+		protected.GET("/tags", middleware.RequirePermission("customers", "read"), handlers.GetTags)
+		segments := protected.Group("/segments")
+		{
+			segments.GET("", middleware.RequirePermission("segments", "read"), handlers.GetSegments)
+			segments.POST("", middleware.RequirePermission("segments", "create"), handlers.CreateSegment)
+			segments.POST("/refresh", middleware.RequirePermission("segments", "update"), handlers.RefreshSegments)
+			segments.POST("/promotions", middleware.RequirePermission("segments", "send"), handlers.SendPromotion)
+			segments.GET("/:id", middleware.RequirePermission("segments", "read"), handlers.GetSegment)
+			segments.PUT("/:id", middleware.RequirePermission("segments", "update"), handlers.UpdateSegment)
+			segments.DELETE("/:id", middleware.RequirePermission("segments", "delete"), handlers.DeleteSegment)
+			segments.GET("/:id/members", middleware.RequirePermission("segments", "read"), handlers.GetSegmentMembers)
+		}
+
+		// Birthday, re-engagement and refill campaigns
+		campaigns := protected.Group("/campaigns")
+		{
+			campaigns.GET("", middleware.RequirePermission("campaigns", "read"), handlers.GetCampaigns)
+			campaigns.POST("", middleware.RequirePermission("campaigns", "create"), handlers.CreateCampaign)
+			campaigns.GET("/:id", middleware.RequirePermission("campaigns", "read"), handlers.GetCampaign)
+			campaigns.PUT("/:id", middleware.RequirePermission("campaigns", "update"), handlers.UpdateCampaign)
+			campaigns.DELETE("/:id", middleware.RequirePermission("campaigns", "delete"), handlers.DeleteCampaign)
+			campaigns.GET("/:id/preview", middleware.RequirePermission("campaigns", "read"), handlers.PreviewCampaign)
+			campaigns.POST("/:id/run", middleware.RequirePermission("campaigns", "send"), handlers.RunCampaign)
+			campaigns.GET("/:id/sends", middleware.RequirePermission("campaigns", "read"), handlers.GetCampaignSends)
+			campaigns.GET("/:id/stats", middleware.RequirePermission("campaigns", "read"), handlers.GetCampaignStats)
+		}
+
+		// Loyalty tiers and benefits
+		loyalty := protected.Group("/loyalty")
+		{
+			loyalty.GET("/tiers", middleware.RequirePermission("customers", "read"), handlers.GetLoyaltyTiers)
+			loyalty.PUT("/tiers/:code", middleware.RequirePermission("loyalty", "update"), handlers.UpdateLoyaltyTier)
+			loyalty.POST("/recalculate", middleware.RequirePermission("loyalty", "update"), handlers.RecalculateLoyaltyTiers)
+		}
+
+		// Compounding formulas and the preparations made from them
+		compounding := protected.Group("/compounding")
+		{
+			compounding.GET("/formulas", middleware.RequirePermission("products", "read"), handlers.GetCompoundFormulas)
+			compounding.POST("/formulas", middleware.RequirePermission("products", "create"), handlers.CreateCompoundFormula)
+			compounding.GET("/formulas/:id", middleware.RequirePermission("products", "read"), handlers.GetCompoundFormula)
+			compounding.PUT("/formulas/:id", middleware.RequirePermission("products", "update"), handlers.UpdateCompoundFormula)
+			compounding.GET("/preparations", middleware.RequirePermission("products", "read"), handlers.GetPreparations)
+			compounding.POST("/preparations", middleware.RequirePermission("products", "update"), handlers.RequestPreparation)
+			compounding.GET("/preparations/:id", middleware.RequirePermission("products", "read"), handlers.GetPreparation)
+			compounding.POST("/preparations/:id/start", middleware.RequirePermission("products", "update"), handlers.StartPreparation)
+			// Making a preparation is a pharmacist's job
+			compounding.POST("/preparations/:id/complete", middleware.RequirePermission("prescriptions", "verify"), handlers.CompletePreparation)
+			compounding.POST("/preparations/:id/cancel", middleware.RequirePermission("products", "update"), handlers.CancelPreparation)
+			compounding.GET("/preparations/:id/label", middleware.RequirePermission("products", "read"), handlers.PrintPreparationLabel)
+		}
+
+		// Licenses and accreditations on file, and their renewals
+		documents := protected.Group("/documents")
+		{
+			documents.GET("", middleware.RequirePermission("documents", "read"), handlers.GetDocuments)
+			documents.POST("", middleware.RequirePermission("documents", "create"), handlers.CreateDocument)
+			documents.GET("/dashboard", middleware.RequirePermission("documents", "read"), handlers.GetDocumentDashboard)
+			documents.GET("/:id", middleware.RequirePermission("documents", "read"), handlers.GetDocument)
+			documents.PUT("/:id", middleware.RequirePermission("documents", "update"), handlers.UpdateDocument)
+			documents.DELETE("/:id", middleware.RequirePermission("documents", "delete"), handlers.DeleteDocument)
+			documents.POST("/:id/renew", middleware.RequirePermission("documents", "create"), handlers.RenewDocument)
+			documents.POST("/:id/file", middleware.RequirePermission("documents", "update"), handlers.UploadDocumentFile)
+			documents.GET("/:id/file", middleware.RequirePermission("documents", "read"), handlers.DownloadDocumentFile)
+		}
+
+		// Employee time clock. Everyone clocks themselves in and out;
+		// managers see the shifts and close forgotten ones.
+		timeclock := protected.Group("/timeclock")
+		{
+			timeclock.GET("", handlers.GetMyShift)
+			timeclock.POST("/in", handlers.ClockIn)
+			timeclock.POST("/out", handlers.ClockOut)
+			timeclock.GET("/shifts", middleware.RequirePermission("timeclock", "read"), handlers.GetShifts)
+			timeclock.GET("/shifts/:id", middleware.RequirePermission("timeclock", "read"), handlers.GetShift)
+			timeclock.POST("/shifts/:id/close", middleware.RequirePermission("timeclock", "manage"), handlers.CloseShift)
+			timeclock.POST("/badges/:userId", middleware.RequirePermission("timeclock", "manage"), handlers.IssueEmployeeBadge)
+			timeclock.GET("/productivity", middleware.RequirePermission("timeclock", "read"), middleware.Timeout(reportRoutes), handlers.GetStaffProductivity)
+		}
+
+		// Customer referrals
+		referrals := protected.Group("/referrals")
+		{
+			referrals.GET("", middleware.RequirePermission("customers", "read"), handlers.GetReferrals)
+		}
+
+		// Senior citizen and PWD ID verification
+		eligibility := protected.Group("/eligibility")
+		{
+			eligibility.GET("/pending", middleware.RequirePermission("eligibility", "read"), handlers.GetPendingEligibility)
+			eligibility.GET("/expiring", middleware.RequirePermission("eligibility", "read"), handlers.GetExpiringEligibility)
+		}
+
+		// Data subject request log (Data Privacy Act)
+		protected.GET("/privacy/requests", middleware.RequirePermission("privacy", "read"), handlers.GetDataSubjectRequests)
+
+		// Drug interaction dataset
+		interactions := protected.Group("/interactions")
+		{
+			interactions.GET("", middleware.RequirePermission("products", "read"), handlers.GetDrugInteractions)
+			interactions.POST("", middleware.RequirePermission("products", "create"), handlers.CreateDrugInteraction)
+		}
+
+		// Sales management (POS sales)
+		sales := protected.Group("/sales")
+		{
+			sales.GET("", middleware.RequirePermission("sales", "read"), handlers.GetSales)
+			sales.GET("/export", middleware.RequirePermission("sales", "read"), middleware.Timeout(streamRoutes), handlers.ExportSales)
+			sales.POST("", middleware.RequirePermission("sales", "create"), middleware.Timeout(posRoutes), middleware.Idempotency(), handlers.CreateSale)
+			sales.GET("/:id", middleware.RequirePermission("sales", "read"), handlers.GetSale)
+			sales.GET("/:id/labels", middleware.RequirePermission("sales", "read"), handlers.PrintSaleLabels)
+			sales.POST("/:id/email-invoice", middleware.RequirePermission("sales", "read"), handlers.EmailSaleInvoice)
+			sales.GET("/:id/clinical-notes", middleware.RequirePermission("clinical_notes", "read"), handlers.GetSaleClinicalNotes)
+			sales.POST("/:id/refund", middleware.RequirePermission("sales", "refund"), middleware.Timeout(posRoutes), middleware.Idempotency(), handlers.RefundSale)
+			sales.POST("/:id/claim", middleware.RequirePermission("claims", "create"), handlers.CreateSaleClaim)
+			sales.POST("/:id/items/:itemId/complete", middleware.RequirePermission("sales", "create"), handlers.CompleteSaleService)
+			sales.GET("/reports/daily", middleware.RequirePermission("sales", "read"), middleware.Timeout(reportRoutes), handlers.GetDailySalesReport)
+			sales.GET("/reports/summary", middleware.RequirePermission("sales", "read"), middleware.Timeout(reportRoutes), handlers.GetSalesSummary)
+		}
+
+		// HMO claims
+		claims := protected.Group("/claims")
+		{
+			claims.GET("", middleware.RequirePermission("claims", "read"), handlers.GetClaims)
+			claims.GET("/receivables", middleware.RequirePermission("claims", "read"), handlers.GetClaimReceivables)
+			claims.GET("/:id", middleware.RequirePermission("claims", "read"), handlers.GetClaim)
+			claims.GET("/:id/document", middleware.RequirePermission("claims", "read"), handlers.PrintClaimDocument)
+			claims.PUT("/:id/status", middleware.RequirePermission("claims", "update"), handlers.UpdateClaimStatus)
+		}
+
+		// Analytics
+		analytics := protected.Group("/analytics")
+		analytics.Use(middleware.RequirePermission("analytics", "read"), middleware.Timeout(reportRoutes))
+		{
+			analytics.GET("/dashboard", middleware.CacheResponse(cache.Analytics), handlers.GetDashboardAnalytics)
+			analytics.GET("/inventory-movement", handlers.GetInventoryMovementAnalysis)
+			analytics.GET("/sales", handlers.GetSalesAnalytics)
+			analytics.GET("/customers", handlers.GetCustomerAnalytics)
+			analytics.GET("/discounts", handlers.GetDiscountAnalytics)
+			analytics.GET("/services", handlers.GetServiceAnalytics)
+			analytics.GET("/feedback", handlers.GetFeedbackAnalytics)
+			analytics.GET("/referrals", handlers.GetReferralAnalytics)
+		}
+
+		// Audit logs (admin only)
+		audit := protected.Group("/audit")
+		audit.Use(middleware.AdminOnly())
+		{
+			audit.GET("/logs", handlers.GetAuditLogs)
+			audit.GET("/logs/:id", handlers.GetAuditLog)
+			audit.GET("/export", middleware.Timeout(streamRoutes), handlers.ExportAuditLogs)
+			audit.POST("/archive", handlers.ArchiveAuditLogs)
+			audit.POST("/archive/scan-logs", handlers.ArchiveScanLogs)
+		}
+
+		// Login security alerts (admin only)
+		security := protected.Group("/security")
+		security.Use(middleware.AdminOnly())
+		{
+			security.GET("/alerts", handlers.GetSecurityAlerts)
+			security.POST("/alerts/:id/acknowledge", handlers.AcknowledgeSecurityAlert)
+			security.GET("/csp-reports", handlers.GetCSPViolations)
+		}
+
+		// Operational alerts to Slack and Teams (admin only)
+		alerts := protected.Group("/alerting")
+		alerts.Use(middleware.AdminOnly())
+		{
+			alerts.POST("/test", handlers.SendTestAlert)
+		}
+
+		// Encryption key rotation (admin only)
+		encryption := protected.Group("/encryption")
+		encryption.Use(middleware.AdminOnly())
+		{
+			encryption.GET("/keys", handlers.GetEncryptionKeys)
+			encryption.POST("/keys/rotate", handlers.RotateEncryptionKey)
+			encryption.POST("/keys/rewrap", handlers.RewrapEncryptionKeys)
+			encryption.POST("/reencrypt", handlers.ReencryptData)
+		}
+
+		// Database sync conflicts (admin only)
+		dbSync := protected.Group("/sync")
+		dbSync.Use(middleware.AdminOnly())
+		{
+			dbSync.GET("/conflicts", handlers.GetSyncConflicts)
+			dbSync.GET("/conflicts/:id", handlers.GetSyncConflict)
+			dbSync.POST("/conflicts/:id/resolve", handlers.ResolveSyncConflict)
+		}
+
+		// Database backups (admin only)
+		backups := protected.Group("/backups")
+		backups.Use(middleware.AdminOnly())
+		{
+			backups.GET("", handlers.GetBackups)
+		}
+
+		// SMS templates and send log (admin only)
+		sms := protected.Group("/sms")
+		sms.Use(middleware.AdminOnly())
+		{
+			sms.GET("/templates", handlers.GetSMSTemplates)
+			sms.POST("/templates", handlers.CreateSMSTemplate)
+			sms.PUT("/templates/:id", handlers.UpdateSMSTemplate)
+			sms.DELETE("/templates/:id", handlers.DeleteSMSTemplate)
+			sms.GET("/messages", handlers.GetSMSMessages)
+		}
+
+		// Email suppression list (admin only)
+		email := protected.Group("/email")
+		email.Use(middleware.AdminOnly())
+		{
+			email.GET("/suppressions", handlers.GetEmailSuppressions)
+			email.POST("/suppressions", handlers.CreateEmailSuppression)
+			email.DELETE("/suppressions/:id", handlers.DeleteEmailSuppression)
+		}
+
+		// Notification and webhook outbox (admin only)
+		outbox := protected.Group("/outbox")
+		outbox.Use(middleware.AdminOnly())
+		{
+			outbox.GET("", handlers.GetOutboxMessages)
+			outbox.POST("/:id/retry", handlers.RetryOutboxMessage)
+		}
+
+		// Events received from third parties (admin only)
+		webhookInbox := protected.Group("/webhook-inbox")
+		webhookInbox.Use(middleware.AdminOnly())
+		{
+			webhookInbox.GET("", handlers.GetInboundWebhooks)
+			webhookInbox.GET("/:id", handlers.GetInboundWebhook)
+			webhookInbox.POST("/:id/replay", handlers.ReplayInboundWebhook)
+		}
+
+		// Rate limits, CORS settings and feature flags, reloaded from
+		// the environment file as on SIGHUP (admin only)
+		settings := protected.Group("/config")
+		settings.Use(middleware.AdminOnly())
+		{
+			settings.GET("", handlers.GetLiveConfig)
+			settings.POST("/reload", handlers.ReloadConfig)
+		}
+
+		// Log level of this instance, e.g. debug while looking into a
+		// problem, until it restarts (admin only)
+		logs := protected.Group("/logging")
+		logs.Use(middleware.AdminOnly())
+		{
+			logs.GET("/level", handlers.GetLogLevel)
+			logs.PUT("/level", handlers.UpdateLogLevel)
+		}
+
+		// Background jobs (admin only)
+		jobs := protected.Group("/jobs")
+		jobs.Use(middleware.AdminOnly())
+		{
+			jobs.GET("", handlers.GetJobs)
+			jobs.POST("", handlers.EnqueueJob)
+			jobs.GET("/schedules", handlers.GetJobSchedules)
+			jobs.PUT("/schedules/:name", handlers.UpdateJobSchedule)
+			jobs.GET("/:id", handlers.GetJob)
+			jobs.POST("/:id/retry", handlers.RetryJob)
+		}
+	}
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// TestVerifyPrescription approves the two prescriptions of an order
+// waiting on them, checking the order moves on with the last and that a
+// prescription can't be verified twice
+func TestVerifyPrescription(t *testing.T) {
+	setDevelopmentEnv(t)
+	var pharmacist testutil.Seed
+	var order *models.OnlineOrder
+	var uploads []*models.PrescriptionUpload
+	server, _ := startTestServer(t, func(ctx context.Context, fixtures *testutil.Fixtures, seed *testutil.Seed) error {
+		user, password, err := fixtures.Staff(ctx, models.RolePharmacist)
+		if err != nil {
+			return err
+		}
+		pharmacist = testutil.Seed{Username: user.Username, Password: password}
+		order, err = fixtures.Order(ctx, seed.Customer.ID, func(o *models.OnlineOrder) {
+			o.Status = models.OrderStatusPrescriptionNeeded
+		})
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			upload, err := fixtures.PrescriptionUpload(ctx, order)
+			if err != nil {
+				return err
+			}
+			uploads = append(uploads, upload)
+		}
+		return nil
+	})
+	ctx := context.Background()
+
+	client := testutil.NewClient(server.BaseURL)
+	if err := client.Login(ctx, &pharmacist); err != nil {
+		t.Fatal(err)
+	}
+	approve := func(id uuid.UUID) error {
+		return client.Do(ctx, http.MethodPost, "/prescriptions/"+id.String()+"/approve", nil, map[string]string{"notes": "Checked"}, nil)
+	}
+	status := func() models.OrderStatus {
+		t.Helper()
+		var got struct {
+			Status models.OrderStatus `json:"status"`
+		}
+		if err := client.Do(ctx, http.MethodGet, "/orders/"+order.ID.String()+"?include=", nil, nil, &got); err != nil {
+			t.Fatal(err)
+		}
+		return got.Status
+	}
+
+	if err := approve(uploads[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != models.OrderStatusPrescriptionNeeded {
+		t.Errorf("with a prescription still pending the order is %s, want %s", got, models.OrderStatusPrescriptionNeeded)
+	}
+	var statusErr *testutil.StatusError
+	if err := approve(uploads[0].ID); !errors.As(err, &statusErr) || statusErr.Status != http.StatusConflict {
+		t.Errorf("approving the prescription again: got %v, want a 409", err)
+	}
+	if err := approve(uploads[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != models.OrderStatusProcessing {
+		t.Errorf("with every prescription approved the order is %s, want %s", got, models.OrderStatusProcessing)
+	}
+}
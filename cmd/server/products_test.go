@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"pharmacy-backend/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// TestDeletedProducts checks a deleted product is listed with
+// ?deleted=true for staff who may restore it, and never in the public shop
+func TestDeletedProducts(t *testing.T) {
+	setDevelopmentEnv(t)
+	server, seed := startTestServer(t, nil)
+	ctx := context.Background()
+
+	staff := testutil.NewClient(server.BaseURL)
+	if err := staff.Login(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	deleted := seed.Products[0].ID
+	if err := staff.Do(ctx, http.MethodDelete, "/products/"+deleted.String(), nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	listed := func(client func(ctx context.Context, method, path string, header http.Header, body, out interface{}) error, path string) bool {
+		t.Helper()
+		var list struct {
+			Products []struct {
+				ID uuid.UUID `json:"id"`
+			} `json:"products"`
+		}
+		if err := client(ctx, http.MethodGet, path, nil, nil, &list); err != nil {
+			t.Fatal(err)
+		}
+		for _, product := range list.Products {
+			if product.ID == deleted {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !listed(staff.Do, "/products?deleted=true&limit=100") {
+		t.Error("GET /products?deleted=true doesn't list the deleted product for a manager")
+	}
+	if listed(staff.Do, "/products?limit=100") {
+		t.Error("GET /products lists the deleted product")
+	}
+	if listed(staff.Anonymous, "/products/browse?deleted=true&limit=100") {
+		t.Error("GET /products/browse?deleted=true lists the deleted product to an anonymous caller")
+	}
+	if listed(staff.Do, "/products/browse?deleted=true&limit=100") {
+		t.Error("GET /products/browse?deleted=true lists the deleted product to staff")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"pharmacy-backend/internal/testutil"
+
+	"github.com/google/uuid"
+)
+
+// TestRefundSale refunds a sale and checks its stock comes back once, not
+// again when it is refunded a second time
+func TestRefundSale(t *testing.T) {
+	setDevelopmentEnv(t)
+	server, seed := startTestServer(t, nil)
+	ctx := context.Background()
+
+	staff := testutil.NewClient(server.BaseURL)
+	if err := staff.Login(ctx, seed); err != nil {
+		t.Fatal(err)
+	}
+	product := seed.Products[1]
+	before, err := staff.Stock(ctx, product.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sale struct {
+		ID uuid.UUID `json:"id"`
+	}
+	body := map[string]interface{}{
+		"payment_method": "cash",
+		"subtotal":       product.Price,
+		"total":          product.Price,
+		"sale_items": []map[string]interface{}{{
+			"item_type":   "product",
+			"product_id":  product.ID,
+			"quantity":    1,
+			"unit_price":  product.Price,
+			"total_price": product.Price,
+		}},
+	}
+	if err := staff.Do(ctx, http.MethodPost, "/sales", http.Header{"Idempotency-Key": {uuid.NewString()}}, body, &sale); err != nil {
+		t.Fatal(err)
+	}
+
+	refund := func() error {
+		header := http.Header{"Idempotency-Key": {uuid.NewString()}}
+		return staff.Do(ctx, http.MethodPost, "/sales/"+sale.ID.String()+"/refund", header, map[string]string{"reason": "Wrong strength"}, nil)
+	}
+	if err := refund(); err != nil {
+		t.Fatal(err)
+	}
+	var statusErr *testutil.StatusError
+	if err := refund(); !errors.As(err, &statusErr) || statusErr.Status != http.StatusConflict {
+		t.Errorf("refunding the sale again: got %v, want a 409", err)
+	}
+	if got, err := staff.Stock(ctx, product.ID); err != nil || got != before {
+		t.Errorf("after the refunds: %d in stock (%v), want %d", got, err, before)
+	}
+}
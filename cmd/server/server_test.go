@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/testutil"
+
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// The server binary built from this package, once for all the tests that
+// run it
+var (
+	buildOnce   sync.Once
+	binaryDir   string
+	binaryPath  string
+	errBuilding error
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if binaryDir != "" {
+		os.RemoveAll(binaryDir)
+	}
+	os.Exit(code)
+}
+
+// startTestServer migrates the configured database, seeds it, adds what
+// more creates when given, and starts this package's server on it for the
+// rest of the test. It runs in a scratch directory, where a development
+// configuration keeps its SQLite database. The server's output is logged
+// when the test fails.
+func startTestServer(t *testing.T, more func(ctx context.Context, fixtures *testutil.Fixtures, seed *testutil.Seed) error) (*testutil.Server, *testutil.Seed) {
+	t.Helper()
+	binary := buildServer(t)
+	dir := t.TempDir()
+	chdir(t, dir)
+
+	ctx := context.Background()
+	cfg, logger, db, err := setupDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every statement of the migration and the seeding would be logged
+	db.Logger = db.Logger.LogMode(gormlogger.Warn)
+	if cfg.IsProduction() {
+		t.Fatal("the tests place orders and sales, run them against a test database")
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	if err := loadEncryptionKeys(ctx, cfg, db, logger); err != nil {
+		t.Fatalf("failed to load encryption keys: %v", err)
+	}
+	fixtures := testutil.NewFixtures(db)
+	seed, err := fixtures.Seed(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if more != nil {
+		if err := more(ctx, fixtures, seed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	serverLog, err := os.Create(filepath.Join(dir, "server.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := testutil.StartServer(ctx, testutil.ServerOptions{
+		Binary: binary,
+		Args:   []string{"server"},
+		Dir:    dir,
+		Log:    serverLog,
+	})
+	if err != nil {
+		logServerOutput(t, serverLog)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stopCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout+10*time.Second)
+		defer cancel()
+		if err := server.Stop(stopCtx); err != nil {
+			t.Errorf("server didn't shut down cleanly: %v", err)
+		}
+		if t.Failed() {
+			logServerOutput(t, serverLog)
+		}
+		serverLog.Close()
+	})
+	return server, seed
+}
+
+// setDevelopmentEnv configures a development server on SQLite without
+// Redis, with fixed secrets, for the rest of the test
+func setDevelopmentEnv(t *testing.T) {
+	t.Helper()
+	for key, value := range map[string]string{
+		"ENV":                       "development",
+		"DB_HOST":                   "localhost",
+		"REDIS_ENABLED":             "false",
+		"FEATURE_FLAGS":             "",
+		"ENCRYPTION_KEY_MANAGEMENT": "false",
+		"JWT_SECRET":                "server-test-jwt-secret-not-for-production",
+		"ENCRYPTION_KEY":            "server-test-encryption-key-32byt",
+	} {
+		t.Setenv(key, value)
+	}
+}
+
+// buildServer builds this package's binary, the first time it is called
+func buildServer(t *testing.T) string {
+	t.Helper()
+	buildOnce.Do(func() {
+		binaryDir, errBuilding = os.MkdirTemp("", "pharmacy-test-*")
+		if errBuilding != nil {
+			return
+		}
+		binaryPath = filepath.Join(binaryDir, "pharmacy-backend")
+		output, err := exec.Command("go", "build", "-o", binaryPath, ".").CombinedOutput()
+		if err != nil {
+			errBuilding = fmt.Errorf("go build: %w\n%s", err, output)
+		}
+	})
+	if errBuilding != nil {
+		t.Fatal(errBuilding)
+	}
+	return binaryPath
+}
+
+// chdir changes the working directory for the rest of the test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+}
+
+func logServerOutput(t *testing.T, serverLog *os.File) {
+	output, err := os.ReadFile(serverLog.Name())
+	if err != nil {
+		t.Logf("failed to read the server's log: %v", err)
+		return
+	}
+	t.Logf("server log:\n%s", output)
+}
@@ -0,0 +1,195 @@
+// Package alerting tells whoever runs the pharmacy's servers about the
+// failures that need someone to act: a sync or backup that failed,
+// webhooks that could not be delivered, a controlled substance dispensed
+// over a screening alert, or someone trying passwords. Alerts are posted
+// to Slack and Microsoft Teams channels through incoming webhooks.
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/kvstore"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Severity string
+
+const (
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Alert event names
+const (
+	EventSyncFailed           = "sync.failed"
+	EventBackupFailed         = "backup.failed"
+	EventWebhookFailed        = "webhook.failed"
+	EventControlledOverride   = "screening.controlled_override"
+	EventRepeatedFailedLogins = "auth.repeated_failed_logins"
+	EventTemperatureExcursion = "cold_chain.excursion"
+	EventSensorSilent         = "cold_chain.sensor_silent"
+	EventTest                 = "alerting.test"
+)
+
+// Alert is one operational alert
+type Alert struct {
+	Event    string
+	Severity Severity
+	Title    string
+	Message  string
+	Fields   []Field
+
+	// Key tells apart alerts for the same event that are each worth
+	// posting, e.g. the database pair that failed to sync. Alerts with the
+	// same event and key are only posted once per cooldown.
+	Key string
+}
+
+// Field is a labelled detail shown with an alert
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Sink posts alerts to a channel
+type Sink interface {
+	Name() string
+	Post(ctx context.Context, source string, alert Alert) error
+}
+
+// Notifier posts alerts to every configured sink. A nil Notifier, or one
+// without sinks, drops them, so callers needn't check before notifying.
+type Notifier struct {
+	sinks    []Sink
+	source   string
+	timeout  time.Duration
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+
+	store kvstore.Store // cooldowns shared with other instances, when set
+}
+
+// New returns the notifier for the configured webhooks
+func New(cfg config.AlertingConfig) *Notifier {
+	client := &http.Client{Timeout: cfg.Timeout}
+	var sinks []Sink
+	if cfg.SlackWebhookURL != "" {
+		sinks = append(sinks, NewSlackSink(client, cfg.SlackWebhookURL))
+	}
+	if cfg.TeamsWebhookURL != "" {
+		sinks = append(sinks, NewTeamsSink(client, cfg.TeamsWebhookURL))
+	}
+	return NewNotifier(sinks, cfg.Source, cfg.Timeout, cfg.Cooldown)
+}
+
+// NewNotifier returns a notifier for sinks. source names this server in
+// alerts, defaulting to its host name.
+func NewNotifier(sinks []Sink, source string, timeout, cooldown time.Duration) *Notifier {
+	if source == "" {
+		source, _ = os.Hostname()
+	}
+	return &Notifier{
+		sinks:    sinks,
+		source:   source,
+		timeout:  timeout,
+		cooldown: cooldown,
+		sent:     make(map[string]time.Time),
+	}
+}
+
+// SetStore shares cooldowns through store, so an alert raised on several
+// instances at once, such as a failing webhook, is only posted once
+func (n *Notifier) SetStore(store kvstore.Store) {
+	if n != nil {
+		n.store = store
+	}
+}
+
+// Enabled reports whether any sink is configured
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.sinks) > 0
+}
+
+// Notify posts alert in the background, so a slow channel doesn't hold up
+// the work that raised it. An alert already posted within the cooldown is
+// dropped.
+func (n *Notifier) Notify(alert Alert) {
+	if !n.Enabled() || !n.due(alert) {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+		defer cancel()
+		if err := n.Send(ctx, alert); err != nil {
+			logrus.WithError(err).WithField("event", alert.Event).Warn("Failed to post operational alert")
+		}
+	}()
+}
+
+// Send posts alert to every sink now, whatever the cooldown
+func (n *Notifier) Send(ctx context.Context, alert Alert) error {
+	if !n.Enabled() {
+		return nil
+	}
+	var errs []error
+	for _, sink := range n.sinks {
+		if err := sink.Post(ctx, n.source, alert); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Sinks returns the names of the configured sinks
+func (n *Notifier) Sinks() []string {
+	if n == nil {
+		return nil
+	}
+	names := make([]string, 0, len(n.sinks))
+	for _, sink := range n.sinks {
+		names = append(names, sink.Name())
+	}
+	return names
+}
+
+// due reports whether alert is past its cooldown, and starts a new one
+// when it is
+func (n *Notifier) due(alert Alert) bool {
+	key := alert.Event + "|" + alert.Key
+	if n.store != nil && n.store.Shared() && n.cooldown > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+		defer cancel()
+		if first, err := n.store.SetNX(ctx, "alert:cooldown:"+key, []byte("1"), n.cooldown); err == nil {
+			return first
+		}
+	}
+	now := time.Now()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if last, ok := n.sent[key]; ok && now.Sub(last) < n.cooldown {
+		return false
+	}
+	n.sent[key] = now
+
+	// Forget cooldowns that are over so the map doesn't grow with every
+	// username or address that ever raised an alert
+	if len(n.sent) > 1000 {
+		for k, last := range n.sent {
+			if now.Sub(last) >= n.cooldown {
+				delete(n.sent, k)
+			}
+		}
+	}
+	return true
+}
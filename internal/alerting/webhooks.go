@@ -0,0 +1,122 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// SlackSink posts alerts to a Slack incoming webhook
+type SlackSink struct {
+	client *http.Client
+	url    string
+}
+
+func NewSlackSink(client *http.Client, url string) *SlackSink {
+	return &SlackSink{client: client, url: url}
+}
+
+func (s *SlackSink) Name() string { return "slack" }
+
+func (s *SlackSink) Post(ctx context.Context, source string, alert Alert) error {
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s *%s*\n%s", severityEmoji(alert.Severity), slackEscape(alert.Title), slackEscape(alert.Message))
+	for _, field := range alert.Fields {
+		if field.Value == "" {
+			continue
+		}
+		fmt.Fprintf(&text, "\n• *%s:* %s", slackEscape(field.Name), slackEscape(field.Value))
+	}
+	fmt.Fprintf(&text, "\n_%s · %s_", slackEscape(source), alert.Event)
+
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{"text": text.String()})
+}
+
+// TeamsSink posts alerts to a Microsoft Teams incoming webhook as an
+// Adaptive Card
+type TeamsSink struct {
+	client *http.Client
+	url    string
+}
+
+func NewTeamsSink(client *http.Client, url string) *TeamsSink {
+	return &TeamsSink{client: client, url: url}
+}
+
+func (s *TeamsSink) Name() string { return "teams" }
+
+func (s *TeamsSink) Post(ctx context.Context, source string, alert Alert) error {
+	color := "warning"
+	if alert.Severity == SeverityCritical {
+		color = "attention"
+	}
+
+	facts := make([]map[string]string, 0, len(alert.Fields)+2)
+	for _, field := range alert.Fields {
+		if field.Value == "" {
+			continue
+		}
+		facts = append(facts, map[string]string{"title": field.Name, "value": field.Value})
+	}
+	facts = append(facts,
+		map[string]string{"title": "Server", "value": source},
+		map[string]string{"title": "Event", "value": alert.Event},
+	)
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []interface{}{
+			map[string]interface{}{"type": "TextBlock", "text": alert.Title, "weight": "bolder", "size": "medium", "color": color, "wrap": true},
+			map[string]interface{}{"type": "TextBlock", "text": alert.Message, "wrap": true},
+			map[string]interface{}{"type": "FactSet", "facts": facts},
+		},
+	}
+	return postJSON(ctx, s.client, s.url, map[string]interface{}{
+		"type": "message",
+		"attachments": []interface{}{
+			map[string]interface{}{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	})
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post alert: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
+
+func severityEmoji(severity Severity) string {
+	if severity == SeverityCritical {
+		return ":rotating_light:"
+	}
+	return ":warning:"
+}
+
+// slackEscape escapes the characters Slack treats as markup
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
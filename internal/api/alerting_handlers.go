@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/alerting"
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Alerting Handlers
+
+// SendTestAlert posts a test alert to every configured channel, to check
+// the webhooks after setting them up
+func (h *Handlers) SendTestAlert(c *gin.Context) {
+	if !h.alerts.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "No alert webhook is configured",
+			"code":  middleware.CodeForStatus(http.StatusServiceUnavailable),
+		})
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	err := h.alerts.Send(c.Request.Context(), alerting.Alert{
+		Event:    alerting.EventTest,
+		Severity: alerting.SeverityWarning,
+		Title:    "Test alert",
+		Message:  "Operational alerts from the pharmacy server will be posted here.",
+		Fields:   []alerting.Field{{Name: "Sent by", Value: user.Username}},
+	})
+	if err != nil {
+		h.respondError(c, http.StatusBadGateway, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test alert posted", "sinks": h.alerts.Sinks()})
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Audit Handlers
+
+// GetAuditLogs lists audit logs newest first. Pass next_cursor from a response
+// as ?cursor= to fetch the following page.
+func (h *Handlers) GetAuditLogs(c *gin.Context) {
+	filter, err := auditLogFilter(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	filter.Cursor = c.Query("cursor")
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	page, err := h.auditService.QueryLogs(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// ExportAuditLogs streams audit logs for a date range as CSV or JSON lines
+// (?format=jsonl or ndjson) for compliance review
+func (h *Handlers) ExportAuditLogs(c *gin.Context) {
+	filter, err := auditLogFilter(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	format := c.DefaultQuery("format", services.AuditExportCSV)
+	switch format {
+	case services.AuditExportCSV, services.AuditExportJSONL, services.ExportNDJSON:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv, jsonl or ndjson"})
+		return
+	}
+
+	response := startExport(c, "audit-logs", format)
+	if err := h.auditService.ExportLogs(c.Request.Context(), response, filter, format); err != nil {
+		failExport(c, "audit logs", err)
+	}
+}
+
+// ArchiveAuditLogs archives and removes logs past the retention period now
+// instead of waiting for the scheduled run
+func (h *Handlers) ArchiveAuditLogs(c *gin.Context) {
+	result, err := h.auditService.ArchiveExpired(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ArchiveScanLogs archives and removes QR scan logs past their retention
+// period now
+func (h *Handlers) ArchiveScanLogs(c *gin.Context) {
+	result, err := h.auditService.ArchiveExpiredScanLogs(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetAuditLog returns an audit log with a field-by-field diff of its old and
+// new values
+func (h *Handlers) GetAuditLog(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid audit log ID"})
+		return
+	}
+
+	detail, err := h.auditService.GetLog(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// recordChange audits a write made by the current request. Pass nil before
+// for creates and nil after for deletes. A failure is logged rather than
+// failing the request, the write has already happened.
+func (h *Handlers) recordChange(c *gin.Context, action, resource string, id uuid.UUID, before, after interface{}) {
+	if err := h.auditService.RecordChange(c.Request.Context(), auditChange(c, action, resource, id, before, after)); err != nil {
+		logrus.WithError(err).WithField("resource", resource).Error("Failed to record audit change")
+	}
+}
+
+// auditChange describes a change made by the current request and user
+func auditChange(c *gin.Context, action, resource string, id uuid.UUID, before, after interface{}) services.AuditChange {
+	change := services.AuditChange{
+		Action:     action,
+		Resource:   resource,
+		ResourceID: id.String(),
+		Before:     before,
+		After:      after,
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		RequestID:  middleware.GetRequestID(c),
+	}
+	if user, exists := middleware.GetCurrentUser(c); exists {
+		change.UserID = &user.ID
+	}
+	return change
+}
+
+// RunAuditArchival archives expired audit and scan logs in the background until ctx is
+// done
+func (h *Handlers) RunAuditArchival(ctx context.Context) {
+	h.auditService.RunArchival(ctx)
+}
+
+// auditLogFilter reads the shared list and export query parameters
+func auditLogFilter(c *gin.Context) (services.AuditLogFilter, error) {
+	filter := services.AuditLogFilter{
+		Action:     c.Query("action"),
+		Resource:   c.Query("resource"),
+		ResourceID: c.Query("resource_id"),
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user ID")
+		}
+		filter.UserID = &id
+	}
+	if success := c.Query("success"); success != "" {
+		value, err := strconv.ParseBool(success)
+		if err != nil {
+			return filter, fmt.Errorf("success must be true or false")
+		}
+		filter.Success = &value
+	}
+	if start := c.Query("start_date"); start != "" {
+		startDate, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return filter, fmt.Errorf("invalid start_date, expected YYYY-MM-DD")
+		}
+		filter.From = &startDate
+	}
+	if end := c.Query("end_date"); end != "" {
+		endDate, err := time.Parse("2006-01-02", end)
+		if err != nil {
+			return filter, fmt.Errorf("invalid end_date, expected YYYY-MM-DD")
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+		filter.To = &endDate
+	}
+	return filter, nil
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Backup Handlers
+
+// GetBackups lists database backup runs, newest first. Restores are done
+// with the restore command, not over the API.
+func (h *Handlers) GetBackups(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	backups, total, err := h.backupService.ListBackups(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve backups"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"backups": backups,
+		"total":   total,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// RunBackups backs up the database in the background until ctx is done
+func (h *Handlers) RunBackups(ctx context.Context) {
+	h.backupService.RunBackups(ctx)
+}
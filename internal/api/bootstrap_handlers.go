@@ -0,0 +1,43 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"pharmacy-backend/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Bootstrap Handlers
+
+// BootstrapAdmin creates the first admin account with the one-time token
+// printed at startup (or set as BOOTSTRAP_TOKEN). It is refused once any
+// admin exists.
+func (h *Handlers) BootstrapAdmin(c *gin.Context) {
+	var req auth.BootstrapRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, err := h.authService.Bootstrap(c.Request.Context(), req, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrBootstrapUnavailable):
+			h.respondError(c, http.StatusConflict, err)
+		case errors.Is(err, auth.ErrBootstrapTokenInvalid):
+			h.respondError(c, http.StatusUnauthorized, err)
+		case errors.Is(err, auth.ErrTooManyAttempts):
+			h.respondError(c, http.StatusTooManyRequests, err)
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create admin account"})
+		}
+		return
+	}
+
+	h.recordChange(c, "bootstrap", "users", user.ID, nil, user)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Admin account created",
+		"user":    user,
+	})
+}
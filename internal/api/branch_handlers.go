@@ -0,0 +1,283 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Branch Handlers
+
+// GetBranches lists active branches, and inactive ones too for admins with
+// ?include_inactive=true
+func (h *Handlers) GetBranches(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+	includeInactive := c.Query("include_inactive") == "true" && user.Role == models.RoleAdmin
+
+	branches, err := h.branchService.ListBranches(c.Request.Context(), includeInactive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve branches"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"branches": branches})
+}
+
+func (h *Handlers) CreateBranch(c *gin.Context) {
+	var req services.BranchRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	branch, err := h.branchService.CreateBranch(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "create", "branches", branch.ID, nil, branch)
+	c.JSON(http.StatusCreated, branch)
+}
+
+func (h *Handlers) UpdateBranch(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+
+	var req services.BranchRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	branch, err := h.branchService.UpdateBranch(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "update", "branches", branch.ID, nil, branch)
+	c.JSON(http.StatusOK, branch)
+}
+
+// GetBranchStock lists a branch's stock of each product, only low stock
+// with ?low_stock=true. Staff can only see their own branch.
+func (h *Handlers) GetBranchStock(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	if scoped := middleware.GetBranchID(c); scoped != nil && *scoped != id && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	levels, total, err := h.branchService.GetStock(c.Request.Context(), id, c.Query("low_stock") == "true", limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve branch stock"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"stock":  levels,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// AssignUserBranch moves a user to a branch, or takes them off their branch
+// with a null branch_id
+func (h *Handlers) AssignUserBranch(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req services.AssignBranchRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, err := h.branchService.AssignUser(c.Request.Context(), id, req.BranchID)
+	if err != nil {
+		if errors.Is(err, services.ErrBranchInactive) {
+			h.respondError(c, http.StatusConflict, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "assign_branch", "users", user.ID, nil, gin.H{"branch_id": user.BranchID})
+	c.JSON(http.StatusOK, user)
+}
+
+// ShipTransfer sends stock from the caller's branch to another. Admins name
+// the sending branch with from_branch_id.
+func (h *Handlers) ShipTransfer(c *gin.Context) {
+	var req services.TransferRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	if branchID := middleware.GetBranchID(c); branchID != nil && (user.Role != models.RoleAdmin || req.FromBranchID == uuid.Nil) {
+		req.FromBranchID = *branchID
+	}
+	if req.FromBranchID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from_branch_id is required"})
+		return
+	}
+
+	transfer, err := h.branchService.ShipTransfer(c.Request.Context(), req, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTransferSameBranch):
+			h.respondError(c, http.StatusBadRequest, err)
+		case errors.Is(err, services.ErrBranchInactive), errors.Is(err, services.ErrInsufficientStock):
+			h.respondError(c, http.StatusConflict, err)
+		default:
+			h.respondError(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	h.recordChange(c, "ship", "stock_transfers", transfer.ID, nil, transfer)
+	c.JSON(http.StatusCreated, transfer)
+}
+
+// ReceiveTransfer takes a transfer in at the branch it was sent to
+func (h *Handlers) ReceiveTransfer(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid transfer ID"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	transfer, err := h.branchService.ReceiveTransfer(c.Request.Context(), id, middleware.GetBranchID(c), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTransferForOtherBranch):
+			h.respondError(c, http.StatusForbidden, err)
+		case errors.Is(err, services.ErrTransferNotInTransit):
+			h.respondError(c, http.StatusConflict, err)
+		default:
+			h.respondError(c, http.StatusInternalServerError, err)
+		}
+		return
+	}
+
+	h.recordChange(c, "receive", "stock_transfers", transfer.ID, nil, transfer)
+	c.JSON(http.StatusOK, transfer)
+}
+
+// GetTransfers lists the transfers the caller's branch sent or was sent,
+// filtered with ?status=in_transit or received
+func (h *Handlers) GetTransfers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	filter := services.TransferFilter{
+		BranchID: middleware.GetBranchID(c),
+		Status:   models.TransferStatus(c.Query("status")),
+		Limit:    limit,
+		Offset:   offset,
+	}
+
+	transfers, total, err := h.branchService.ListTransfers(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transfers"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"transfers": transfers,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// GetBranchPrices lists the branch's price overrides
+func (h *Handlers) GetBranchPrices(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+
+	prices, err := h.pricingService.ListPrices(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve branch prices"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prices": prices})
+}
+
+// SetBranchPrice overrides a product's price at the branch
+func (h *Handlers) SetBranchPrice(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+	productID, err := uuid.Parse(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req services.BranchPriceRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	price, err := h.pricingService.SetPrice(c.Request.Context(), id, productID, req.Price)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "set_price", "branches", id, nil, price)
+	c.JSON(http.StatusOK, price)
+}
+
+// ClearBranchPrice drops a branch's price override for a product
+func (h *Handlers) ClearBranchPrice(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+	productID, err := uuid.Parse(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	if err := h.pricingService.ClearPrice(c.Request.Context(), id, productID); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "clear_price", "branches", id, gin.H{"product_id": productID}, nil)
+	c.Status(http.StatusNoContent)
+}
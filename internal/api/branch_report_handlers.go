@@ -0,0 +1,213 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Head Office Report Handlers
+
+// emailReportRequest lists who a report is emailed to
+type emailReportRequest struct {
+	Recipients []string `json:"recipients" binding:"required,min=1,max=20,dive,required,email"`
+}
+
+// GetBranchSalesRollup totals completed sales for each branch between
+// ?start_date and ?end_date
+func (h *Handlers) GetBranchSalesRollup(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rollup, err := h.branchReportService.SalesRollup(c.Request.Context(), from, to)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, rollup)
+}
+
+// GetBranchSalesDetail drills into one branch's sales by day, product and service
+func (h *Handlers) GetBranchSalesDetail(c *gin.Context) {
+	branchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	detail, err := h.branchReportService.BranchSalesDetail(c.Request.Context(), branchID, from, to)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, detail)
+}
+
+// GetBranchStockRollup summarises stock on hand and low stock per branch.
+// GetBranchStock drills into a branch.
+func (h *Handlers) GetBranchStockRollup(c *gin.Context) {
+	summaries, err := h.branchReportService.StockRollup(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branches": summaries})
+}
+
+// GetBranchTransitRollup counts the transfers in transit from and to each
+// branch
+func (h *Handlers) GetBranchTransitRollup(c *gin.Context) {
+	summaries, err := h.branchReportService.TransitRollup(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"branches": summaries})
+}
+
+// GetBranchTransitDetail lists the transfers in transit from or to one
+// branch
+func (h *Handlers) GetBranchTransitDetail(c *gin.Context) {
+	branchID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	transfers, total, err := h.branchService.ListTransfers(c.Request.Context(), services.TransferFilter{
+		BranchID: &branchID,
+		Status:   models.TransferStatusInTransit,
+		Limit:    limit,
+		Offset:   offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve transfers"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"transfers": transfers,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// EmailBranchSalesRollup queues the branch sales rollup between
+// ?start_date and ?end_date as an email to each recipient
+func (h *Handlers) EmailBranchSalesRollup(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req emailReportRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	rollup, err := h.branchReportService.SalesRollup(c.Request.Context(), from, to)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	currency := h.config.Pharmacy.Currency
+	report := services.ReportEmail{
+		Title:   "Branch sales",
+		Period:  reportPeriod(from, to),
+		Columns: []string{"Branch", "Sales", "Revenue (" + currency + ")", "Discounts", "Average sale"},
+		Totals:  []string{"All branches", strconv.FormatInt(rollup.SaleCount, 10), rollup.Revenue.String(), "", ""},
+	}
+	for _, branch := range rollup.Branches {
+		name := branch.Name
+		if branch.BranchID == nil {
+			name = "No branch"
+		}
+		report.Rows = append(report.Rows, []string{
+			name,
+			strconv.FormatInt(branch.SaleCount, 10),
+			branch.Revenue.String(),
+			branch.Discounts.String(),
+			branch.AverageSale.String(),
+		})
+	}
+
+	// The figures are taken now, so every recipient gets the same report
+	err = h.db.WithContext(c.Request.Context()).Transaction(func(tx *gorm.DB) error {
+		for _, recipient := range req.Recipients {
+			if err := h.outboxService.QueueNotification(tx, services.OutboxNotification{
+				Event:     "report.branch_sales",
+				Channel:   services.ChannelEmail,
+				Recipient: recipient,
+				Purpose:   models.PurposeTransactional,
+				Subject:   report.Title,
+				Body:      fmt.Sprintf("%s: %d sales, %s %s revenue.", report.Title, rollup.SaleCount, currency, rollup.Revenue),
+				Email:     &services.EmailContent{Template: services.EmailTemplateReport, Data: report},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Report queued for email", "recipients": len(req.Recipients)})
+}
+
+// reportDateRange reads ?start_date and ?end_date as YYYY-MM-DD, the end
+// date included
+func reportDateRange(c *gin.Context) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+	if start := c.Query("start_date"); start != "" {
+		startDate, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid start_date, expected YYYY-MM-DD")
+		}
+		from = &startDate
+	}
+	if end := c.Query("end_date"); end != "" {
+		endDate, err := time.Parse("2006-01-02", end)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid end_date, expected YYYY-MM-DD")
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+		to = &endDate
+	}
+	return from, to, nil
+}
+
+// reportPeriod describes a report's [from, to) dates for people
+func reportPeriod(from, to *time.Time) string {
+	switch {
+	case from != nil && to != nil:
+		return from.Format("Jan 2, 2006") + " to " + to.AddDate(0, 0, -1).Format("Jan 2, 2006")
+	case from != nil:
+		return "Since " + from.Format("Jan 2, 2006")
+	case to != nil:
+		return "Up to " + to.AddDate(0, 0, -1).Format("Jan 2, 2006")
+	}
+	return "All time"
+}
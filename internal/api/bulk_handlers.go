@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+)
+
+// Bulk Handlers
+
+// BulkUpsertProducts creates or updates, by SKU, the products in
+// {"products": [...], "dry_run": false}. Each row takes the same fields as
+// creating a product; rows that fail are reported in the result and the
+// rest are still saved.
+func (h *Handlers) BulkUpsertProducts(c *gin.Context) {
+	var body struct {
+		Products []json.RawMessage `json:"products" binding:"required,min=1"`
+		DryRun   bool              `json:"dry_run"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	req := services.BulkProductRequest{
+		Products: make([]models.Product, len(body.Products)),
+		Invalid:  map[int][]string{},
+		DryRun:   body.DryRun,
+	}
+	for i, raw := range body.Products {
+		if errs := decodeBulkRow(raw, &req.Products[i]); len(errs) > 0 {
+			req.Invalid[i] = errs
+		}
+	}
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.UserID = &user.ID
+	}
+
+	result, err := h.bulkService.UpsertProducts(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, bulkErrorStatus(err), err)
+		return
+	}
+	if !result.DryRun {
+		h.recordChange(c, "bulk_upsert", "products", uuid.Nil, nil, result)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// BulkAdjustStock applies the stock adjustments in
+// {"adjustments": [...], "dry_run": false}. Each row names the product by
+// product_id or sku and takes the same quantity, operation and notes as a
+// single stock update, at the current branch when there is one.
+func (h *Handlers) BulkAdjustStock(c *gin.Context) {
+	var body struct {
+		Adjustments []json.RawMessage `json:"adjustments" binding:"required,min=1"`
+		DryRun      bool              `json:"dry_run"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	req := services.BulkStockRequest{
+		Adjustments: make([]services.BulkStockAdjustment, len(body.Adjustments)),
+		Invalid:     map[int][]string{},
+		BranchID:    middleware.GetBranchID(c),
+		DryRun:      body.DryRun,
+	}
+	for i, raw := range body.Adjustments {
+		if errs := decodeBulkRow(raw, &req.Adjustments[i]); len(errs) > 0 {
+			req.Invalid[i] = errs
+		}
+	}
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.UserID = &user.ID
+	}
+
+	result, err := h.bulkService.AdjustStock(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, bulkErrorStatus(err), err)
+		return
+	}
+	if !result.DryRun {
+		h.recordChange(c, "bulk_stock_update", "products", uuid.Nil, nil, result)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// BulkImportCustomers imports the customers in
+// {"customers": [...], "strategy": "skip", "dry_run": false}. Each row is an
+// object of the fields a CSV import maps columns to, and is matched against
+// existing customers the same way.
+func (h *Handlers) BulkImportCustomers(c *gin.Context) {
+	var body struct {
+		Customers []map[string]string        `json:"customers" binding:"required,min=1"`
+		Strategy  services.DuplicateStrategy `json:"strategy"`
+		DryRun    bool                       `json:"dry_run"`
+	}
+	if !bindJSON(c, &body) {
+		return
+	}
+
+	if body.Strategy != "" && !body.Strategy.IsValid() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid duplicate strategy, use skip, merge or create"})
+		return
+	}
+
+	req := services.CustomerImportRequest{Strategy: body.Strategy, DryRun: body.DryRun}
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.ImportedBy = &user.ID
+	}
+
+	report, err := h.customerImportService.ImportRecords(c.Request.Context(), body.Customers, req)
+	if err != nil {
+		h.respondError(c, bulkErrorStatus(err), err)
+		return
+	}
+	if !report.DryRun {
+		h.recordChange(c, "bulk_import", "customers", uuid.Nil, nil, gin.H{
+			"rows":     report.TotalRows,
+			"created":  report.Created,
+			"merged":   report.Merged,
+			"skipped":  report.Skipped,
+			"failed":   report.Failed,
+			"strategy": report.Strategy,
+		})
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// decodeBulkRow decodes and validates one row of a bulk request, returning
+// what is wrong with it rather than failing the whole request
+func decodeBulkRow(raw json.RawMessage, row interface{}) []string {
+	err := json.Unmarshal(raw, row)
+	if err == nil {
+		err = binding.Validator.ValidateStruct(row)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var fields fieldErrors
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &fields):
+		messages := make([]string, len(fields))
+		for i, field := range fields {
+			messages[i] = field.Field + " " + field.Message
+		}
+		return messages
+	case errors.As(err, &typeErr):
+		return []string{typeErr.Field + " must be " + jsonTypeName(typeErr.Type)}
+	}
+	return []string{err.Error()}
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Campaign Handlers
+
+// GetCampaigns lists all campaigns
+func (h *Handlers) GetCampaigns(c *gin.Context) {
+	campaigns, err := h.campaignService.ListCampaigns(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve campaigns"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"campaigns": campaigns})
+}
+
+// GetCampaign returns a campaign
+func (h *Handlers) GetCampaign(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	campaign, err := h.campaignService.GetCampaign(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Campaign not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// CreateCampaign defines a rule-based campaign
+func (h *Handlers) CreateCampaign(c *gin.Context) {
+	var campaign models.Campaign
+	if !bindJSON(c, &campaign) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	campaign.CreatedBy = &user.ID
+
+	if err := h.campaignService.CreateCampaign(c.Request.Context(), &campaign); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, campaign)
+}
+
+// UpdateCampaign changes a campaign's rule window, template or schedule
+// settings
+func (h *Handlers) UpdateCampaign(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	var req services.UpdateCampaignRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	campaign, err := h.campaignService.UpdateCampaign(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, campaign)
+}
+
+// DeleteCampaign removes a campaign
+func (h *Handlers) DeleteCampaign(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	if err := h.campaignService.DeleteCampaign(c.Request.Context(), id); err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Campaign deleted successfully"})
+}
+
+// PreviewCampaign lists who the campaign would message if it ran now
+func (h *Handlers) PreviewCampaign(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	preview, err := h.campaignService.Preview(c.Request.Context(), id, limit)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// RunCampaign queues and sends a campaign immediately
+func (h *Handlers) RunCampaign(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	result, err := h.campaignService.Run(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetCampaignSends lists a campaign's messages with their delivery and
+// attribution
+func (h *Handlers) GetCampaignSends(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	sends, total, err := h.campaignService.GetSends(c.Request.Context(), id, c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve campaign sends"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"sends":  sends,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// GetCampaignStats summarizes a campaign's sends and attributed purchases
+func (h *Handlers) GetCampaignStats(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid campaign ID"})
+		return
+	}
+
+	stats, err := h.campaignService.GetStats(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// RunCampaignScheduler queues and sends active campaigns in the background
+// until ctx is done
+func (h *Handlers) RunCampaignScheduler(ctx context.Context) {
+	h.campaignService.RunScheduler(ctx)
+}
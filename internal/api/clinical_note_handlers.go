@@ -0,0 +1,156 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Clinical Note Handlers
+
+// CreateClinicalNote records counseling or an intervention for a customer
+func (h *Handlers) CreateClinicalNote(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.CreateClinicalNoteRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	req.CustomerID = customerID
+
+	user, _ := middleware.GetCurrentUser(c)
+	note, err := h.clinicalNoteService.CreateNote(c.Request.Context(), req, user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
+
+// GetCustomerClinicalNotes lists a customer's counseling and intervention notes
+func (h *Handlers) GetCustomerClinicalNotes(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	filter := clinicalNoteFilter(c)
+	filter.CustomerID = &customerID
+	h.listClinicalNotes(c, filter)
+}
+
+// GetSaleClinicalNotes lists notes recorded against a sale
+func (h *Handlers) GetSaleClinicalNotes(c *gin.Context) {
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	filter := clinicalNoteFilter(c)
+	filter.SaleID = &saleID
+	h.listClinicalNotes(c, filter)
+}
+
+// GetClinicalNotes lists notes across customers, e.g. open interventions
+func (h *Handlers) GetClinicalNotes(c *gin.Context) {
+	h.listClinicalNotes(c, clinicalNoteFilter(c))
+}
+
+// RecordClinicalNoteOutcome updates an intervention's outcome
+func (h *Handlers) RecordClinicalNoteOutcome(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid note ID"})
+		return
+	}
+
+	var req struct {
+		Outcome      models.ClinicalNoteOutcome `json:"outcome" binding:"required"`
+		OutcomeNotes string                     `json:"outcome_notes"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	note, err := h.clinicalNoteService.RecordOutcome(c.Request.Context(), id, req.Outcome, req.OutcomeNotes)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// ExportClinicalNotes downloads notes as CSV for accreditation audits
+func (h *Handlers) ExportClinicalNotes(c *gin.Context) {
+	filter := clinicalNoteFilter(c)
+	if customerID, err := uuid.Parse(c.Query("customer_id")); err == nil {
+		filter.CustomerID = &customerID
+	}
+
+	filename := "clinical-notes-" + time.Now().Format("20060102") + ".csv"
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	c.Status(http.StatusOK)
+
+	if err := h.clinicalNoteService.ExportCSV(c.Request.Context(), c.Writer, filter); err != nil {
+		// Headers are already sent, so the client sees a truncated file
+		c.Error(err)
+	}
+}
+
+func (h *Handlers) listClinicalNotes(c *gin.Context, filter services.ClinicalNoteFilter) {
+	notes, total, err := h.clinicalNoteService.ListNotes(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve clinical notes"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"notes":  notes,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// clinicalNoteFilter reads the shared list and export query parameters
+func clinicalNoteFilter(c *gin.Context) services.ClinicalNoteFilter {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	filter := services.ClinicalNoteFilter{
+		NoteType:         models.ClinicalNoteType(c.Query("note_type")),
+		InterventionType: models.InterventionType(c.Query("intervention_type")),
+		Outcome:          models.ClinicalNoteOutcome(c.Query("outcome")),
+		Limit:            limit,
+		Offset:           offset,
+	}
+	if start := c.Query("start_date"); start != "" {
+		if startDate, err := time.Parse("2006-01-02", start); err == nil {
+			filter.From = &startDate
+		}
+	}
+	if end := c.Query("end_date"); end != "" {
+		if endDate, err := time.Parse("2006-01-02", end); err == nil {
+			endDate = endDate.AddDate(0, 0, 1)
+			filter.To = &endDate
+		}
+	}
+	return filter
+}
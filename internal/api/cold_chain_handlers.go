@@ -0,0 +1,227 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Cold Chain Handlers
+
+// GetStorageUnits lists the temperature-logged storage units, those of the
+// staff member's branch when they have one
+func (h *Handlers) GetStorageUnits(c *gin.Context) {
+	units, err := h.coldChainService.ListUnits(c.Request.Context(), middleware.GetBranchID(c))
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"storage_units": units})
+}
+
+// CreateStorageUnit registers a refrigerator, freezer or cold room at the
+// staff member's branch
+func (h *Handlers) CreateStorageUnit(c *gin.Context) {
+	var req services.StorageUnitRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	unit, err := h.coldChainService.CreateUnit(c.Request.Context(), req, middleware.GetBranchID(c))
+	if err != nil {
+		if h.isDBError(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A storage unit with this code or sensor ID already exists"})
+			return
+		}
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "storage_units", unit.ID, nil, unit)
+	c.JSON(http.StatusCreated, unit)
+}
+
+func (h *Handlers) GetStorageUnit(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid storage unit ID"})
+		return
+	}
+
+	unit, err := h.coldChainService.GetUnit(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, unit)
+}
+
+func (h *Handlers) UpdateStorageUnit(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid storage unit ID"})
+		return
+	}
+	var req services.StorageUnitRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	previous, err := h.coldChainService.GetUnit(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+	unit, err := h.coldChainService.UpdateUnit(c.Request.Context(), id, req)
+	if err != nil {
+		if h.isDBError(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A storage unit with this code or sensor ID already exists"})
+			return
+		}
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "update", "storage_units", unit.ID, previous, unit)
+	c.JSON(http.StatusOK, unit)
+}
+
+// RecordTemperature logs a temperature read off a unit's thermometer by
+// staff. Data loggers post theirs through the webhook inbox instead.
+func (h *Handlers) RecordTemperature(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid storage unit ID"})
+		return
+	}
+	var req services.ReadingRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	reading, excursion, err := h.coldChainService.RecordReading(c.Request.Context(), id, req, models.ReadingSourceManual, &user.ID)
+	if err != nil {
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"reading": reading, "excursion": excursion})
+}
+
+// GetTemperatureReadings lists a unit's readings between ?start_date and
+// ?end_date, newest first
+func (h *Handlers) GetTemperatureReadings(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid storage unit ID"})
+		return
+	}
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	readings, total, err := h.coldChainService.ListReadings(c.Request.Context(), id, from, to, limit, offset)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"readings": readings,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// GetTemperatureExcursions lists excursions, filtered by ?storage_unit_id,
+// ?status, or the batch they affected with ?product_id and ?batch_number
+func (h *Handlers) GetTemperatureExcursions(c *gin.Context) {
+	filter := services.ExcursionFilter{
+		BranchID:    middleware.GetBranchID(c),
+		Status:      models.ExcursionStatus(c.Query("status")),
+		BatchNumber: c.Query("batch_number"),
+	}
+	for param, dest := range map[string]**uuid.UUID{
+		"storage_unit_id": &filter.StorageUnitID,
+		"product_id":      &filter.ProductID,
+	} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*dest = &id
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	excursions, total, err := h.coldChainService.ListExcursions(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"excursions": excursions,
+		"total":      total,
+		"limit":      filter.Limit,
+		"offset":     filter.Offset,
+	})
+}
+
+// GetTemperatureExcursion returns an excursion report: the batches at risk
+// and the readings through it
+func (h *Handlers) GetTemperatureExcursion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid excursion ID"})
+		return
+	}
+
+	report, err := h.coldChainService.GetExcursionReport(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ReviewTemperatureExcursion records the cause of an excursion and what is
+// to be done with each batch it affected
+func (h *Handlers) ReviewTemperatureExcursion(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid excursion ID"})
+		return
+	}
+	var req services.ReviewExcursionRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	report, err := h.coldChainService.ReviewExcursion(c.Request.Context(), id, req, user.ID)
+	if err != nil {
+		h.respondError(c, coldChainErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "review", "temperature_excursions", report.ID, nil, report)
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Communication Preference Handlers
+
+// GetCommunicationPreferences returns the customer's opt-in for every channel
+// and purpose
+func (h *Handlers) GetCommunicationPreferences(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	prefs, err := h.communicationService.GetPreferences(c.Request.Context(), customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve communication preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// UpdateCommunicationPreferences records the customer's opt-in choices as
+// taken down by staff
+func (h *Handlers) UpdateCommunicationPreferences(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		Preferences []services.PreferenceUpdate `json:"preferences" binding:"required,dive"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.communicationService.UpdatePreferences(c.Request.Context(), customerID, req.Preferences, "staff"); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	prefs, err := h.communicationService.GetPreferences(c.Request.Context(), customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve communication preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// Unsubscribe opts the customer out using the token from a message's
+// unsubscribe link
+func (h *Handlers) Unsubscribe(c *gin.Context) {
+	pref, err := h.communicationService.Unsubscribe(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unsubscribe link is invalid"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"channel": pref.Channel,
+		"purpose": pref.Purpose,
+		"message": "You have been unsubscribed",
+	})
+}
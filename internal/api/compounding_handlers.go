@@ -0,0 +1,245 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Compounding Handlers
+
+// GetCompoundFormulas lists the compounding formulas, the retired ones too
+// with ?include_inactive=true
+func (h *Handlers) GetCompoundFormulas(c *gin.Context) {
+	formulas, err := h.compoundingService.ListFormulas(c.Request.Context(), c.Query("include_inactive") == "true")
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"formulas": formulas})
+}
+
+func (h *Handlers) CreateCompoundFormula(c *gin.Context) {
+	var req services.FormulaRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	formula, err := h.compoundingService.CreateFormula(c.Request.Context(), req)
+	if err != nil {
+		if h.isDBError(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A formula with this code already exists"})
+			return
+		}
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "compound_formulas", formula.ID, nil, formula)
+	c.JSON(http.StatusCreated, formula)
+}
+
+func (h *Handlers) GetCompoundFormula(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid formula ID"})
+		return
+	}
+
+	formula, err := h.compoundingService.GetFormula(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, formula)
+}
+
+func (h *Handlers) UpdateCompoundFormula(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid formula ID"})
+		return
+	}
+	var req services.FormulaRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	previous, err := h.compoundingService.GetFormula(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+	formula, err := h.compoundingService.UpdateFormula(c.Request.Context(), id, req)
+	if err != nil {
+		if h.isDBError(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A formula with this code already exists"})
+			return
+		}
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "update", "compound_formulas", formula.ID, previous, formula)
+	c.JSON(http.StatusOK, formula)
+}
+
+// GetPreparations lists preparations, filtered by ?status, ?formula_id and
+// ?customer_id. Staff limited to a branch see its preparations only.
+func (h *Handlers) GetPreparations(c *gin.Context) {
+	filter := services.PreparationFilter{
+		BranchID: middleware.GetBranchID(c),
+		Status:   models.PreparationStatus(c.Query("status")),
+	}
+	for param, target := range map[string]**uuid.UUID{"formula_id": &filter.FormulaID, "customer_id": &filter.CustomerID} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*target = &id
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	preparations, total, err := h.compoundingService.ListPreparations(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"preparations": preparations,
+		"total":        total,
+		"limit":        filter.Limit,
+		"offset":       filter.Offset,
+	})
+}
+
+// RequestPreparation orders a formula made at the staff member's branch
+func (h *Handlers) RequestPreparation(c *gin.Context) {
+	var req services.PreparationRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	preparation, err := h.compoundingService.RequestPreparation(c.Request.Context(), req, middleware.GetBranchID(c), user.ID)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "compound_preparations", preparation.ID, nil, preparation)
+	c.JSON(http.StatusCreated, preparation)
+}
+
+func (h *Handlers) GetPreparation(c *gin.Context) {
+	preparation, ok := h.loadPreparation(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, preparation)
+}
+
+// StartPreparation records that work on a preparation has begun
+func (h *Handlers) StartPreparation(c *gin.Context) {
+	previous, ok := h.loadPreparation(c)
+	if !ok {
+		return
+	}
+
+	preparation, err := h.compoundingService.StartPreparation(c.Request.Context(), previous.ID)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+	h.recordChange(c, "start", "compound_preparations", preparation.ID, previous, preparation)
+	c.JSON(http.StatusOK, preparation)
+}
+
+// CompletePreparation records a preparation as made by the pharmacist
+// calling, taking its ingredients out of stock. It is then labeled and
+// ready to sell.
+func (h *Handlers) CompletePreparation(c *gin.Context) {
+	previous, ok := h.loadPreparation(c)
+	if !ok {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	preparation, movements, err := h.compoundingService.CompletePreparation(c.Request.Context(), previous.ID, user.ID)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+	h.stockService.Announce(c.Request.Context(), movements...)
+
+	h.recordChange(c, "complete", "compound_preparations", preparation.ID, previous, preparation)
+	c.JSON(http.StatusOK, preparation)
+}
+
+// CancelPreparation drops a preparation that hasn't been made
+func (h *Handlers) CancelPreparation(c *gin.Context) {
+	previous, ok := h.loadPreparation(c)
+	if !ok {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	preparation, err := h.compoundingService.CancelPreparation(c.Request.Context(), previous.ID, user.ID)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+	h.recordChange(c, "cancel", "compound_preparations", preparation.ID, previous, preparation)
+	c.JSON(http.StatusOK, preparation)
+}
+
+// PrintPreparationLabel renders a completed preparation's label, as
+// format=pdf|escpos (default pdf)
+func (h *Handlers) PrintPreparationLabel(c *gin.Context) {
+	preparation, ok := h.loadPreparation(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.labelService.PreparationLabel(c.Request.Context(), preparation.ID)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+	writeLabels(c, "preparation-"+preparation.PreparationNumber, result)
+}
+
+// loadPreparation loads the preparation in the path, checking staff limited
+// to a branch only see its preparations. It reports false when it rejected
+// the request.
+func (h *Handlers) loadPreparation(c *gin.Context) (*models.CompoundPreparation, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid preparation ID"})
+		return nil, false
+	}
+
+	preparation, err := h.compoundingService.GetPreparation(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return nil, false
+	}
+	if preparation.BranchID != nil && !h.inStaffBranch(c, *preparation.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return nil, false
+	}
+	return preparation, true
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Config Handlers
+
+// GetLiveConfig returns the rate limits, CORS settings and feature flags in
+// effect on this instance
+func (h *Handlers) GetLiveConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, liveConfigResponse(h.config.Live()))
+}
+
+// ReloadConfig reads the environment file again, as on SIGHUP, and puts its
+// rate limits, CORS settings and feature flags in effect on this instance.
+// Other instances behind the load balancer are reloaded separately.
+func (h *Handlers) ReloadConfig(c *gin.Context) {
+	before := liveConfigResponse(h.config.Live())
+	live, err := h.config.Reload()
+	if err != nil {
+		logrus.WithError(err).Error("Failed to reload configuration, keeping the current settings")
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	after := liveConfigResponse(live)
+	logrus.Info("Configuration reloaded")
+	h.recordChange(c, "reload", "config", uuid.Nil, before, after)
+	c.JSON(http.StatusOK, after)
+}
+
+func liveConfigResponse(live *config.Reloadable) gin.H {
+	tier := func(t config.RateLimitTier) gin.H {
+		return gin.H{"requests": t.Requests, "window_seconds": int(t.Window.Seconds())}
+	}
+	features := gin.H{}
+	for _, name := range config.FeatureNames() {
+		features[name] = live.Features.Enabled(name)
+	}
+	return gin.H{
+		"rate_limits": gin.H{
+			"public": tier(live.RateLimit.Public),
+			"login":  tier(live.RateLimit.Login),
+			"user":   tier(live.RateLimit.User),
+		},
+		"cors": gin.H{
+			"allowed_origins": live.CORS.AllowedOrigins,
+			"allowed_methods": live.CORS.AllowedMethods,
+			"allowed_headers": live.CORS.AllowedHeaders,
+		},
+		"features": features,
+	}
+}
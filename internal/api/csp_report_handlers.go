@@ -0,0 +1,70 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// CSP Report Handlers
+
+// maxCSPReportBody caps report bodies, which browsers send unauthenticated
+const maxCSPReportBody = 64 << 10
+
+// ReceiveCSPReport collects violation reports sent by browsers to the
+// configured CSP_REPORT_URI. Bodies may be application/csp-report or
+// application/reports+json.
+func (h *Handlers) ReceiveCSPReport(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxCSPReportBody))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Report too large"})
+		return
+	}
+
+	reports, err := services.ParseCSPReports(body)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	for _, report := range reports {
+		logrus.WithFields(logrus.Fields{
+			"directive":    report.EffectiveDirective,
+			"blocked_uri":  report.BlockedURL,
+			"document_uri": report.DocumentURL,
+			"disposition":  report.Disposition,
+		}).Warn("CSP violation reported")
+	}
+
+	if err := h.cspReportService.Record(c.Request.Context(), reports); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record report"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetCSPViolations lists aggregated CSP violations, most recent first
+func (h *Handlers) GetCSPViolations(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	violations, total, err := h.cspReportService.ListViolations(c.Request.Context(), c.Query("directive"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve CSP violations"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"violations": violations,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Currency Handlers
+
+// GetExchangeRates lists the foreign currencies customers can pay in
+func (h *Handlers) GetExchangeRates(c *gin.Context) {
+	rates, err := h.currencyService.ListRates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve exchange rates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"currency":       h.currencyService.Base(),
+		"exchange_rates": rates,
+	})
+}
+
+// SetExchangeRate sets what one unit of a foreign currency is worth in the
+// pharmacy's currency
+func (h *Handlers) SetExchangeRate(c *gin.Context) {
+	currency, ok := currencyParam(c)
+	if !ok {
+		return
+	}
+
+	var req services.ExchangeRateRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	rate, err := h.currencyService.SetRate(c.Request.Context(), currency, req.Rate)
+	if err != nil {
+		if errors.Is(err, services.ErrBaseCurrency) {
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "set_rate", "exchange_rates", rate.ID, nil, rate)
+	c.JSON(http.StatusOK, rate)
+}
+
+// DeleteExchangeRate stops accepting payment in a foreign currency
+func (h *Handlers) DeleteExchangeRate(c *gin.Context) {
+	currency, ok := currencyParam(c)
+	if !ok {
+		return
+	}
+
+	rate, err := h.currencyService.DeleteRate(c.Request.Context(), currency)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "delete", "exchange_rates", rate.ID, rate, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// ConvertAmount quotes ?amount in the pharmacy's currency in ?currency, for
+// telling a customer what to pay
+func (h *Handlers) ConvertAmount(c *gin.Context) {
+	amount, err := models.ParseMoney(c.Query("amount"))
+	if err != nil || amount < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount"})
+		return
+	}
+	currency := strings.ToUpper(c.Query("currency"))
+	if !validCurrencyCode(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency, use an ISO 4217 code such as USD"})
+		return
+	}
+
+	quote, err := h.currencyService.Convert(c.Request.Context(), amount, currency)
+	if err != nil {
+		if errors.Is(err, services.ErrNoExchangeRate) {
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, quote)
+}
+
+// currencyParam reads the :currency path parameter. It reports false when
+// it rejected the request.
+func currencyParam(c *gin.Context) (string, bool) {
+	currency := strings.ToUpper(c.Param("currency"))
+	if !validCurrencyCode(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency, use an ISO 4217 code such as USD"})
+		return "", false
+	}
+	return currency, true
+}
+
+// validCurrencyCode reports whether code looks like an ISO 4217 code
+func validCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Customer Flag Handlers
+
+// GetCustomerFlags lists a customer's flags, including resolved ones when
+// include_resolved=true
+func (h *Handlers) GetCustomerFlags(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	flags, err := h.customerFlagService.GetFlags(c.Request.Context(), customerID, c.Query("include_resolved") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve flags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": flags})
+}
+
+// AddCustomerFlag attaches a note or flag to a customer
+func (h *Handlers) AddCustomerFlag(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.CustomerFlagRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	flag, err := h.customerFlagService.AddFlag(c.Request.Context(), customerID, req, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, flag)
+}
+
+// UpdateCustomerFlag changes a flag's note or severity
+func (h *Handlers) UpdateCustomerFlag(c *gin.Context) {
+	customerID, flagID, ok := parseCustomerFlagIDs(c)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateCustomerFlagRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	flag, err := h.customerFlagService.UpdateFlag(c.Request.Context(), customerID, flagID, req, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// ResolveCustomerFlag hides a flag from POS lookups and scans
+func (h *Handlers) ResolveCustomerFlag(c *gin.Context) {
+	customerID, flagID, ok := parseCustomerFlagIDs(c)
+	if !ok {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	flag, err := h.customerFlagService.ResolveFlag(c.Request.Context(), customerID, flagID, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+func parseCustomerFlagIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	flagID, err := uuid.Parse(c.Param("flag_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid flag ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return customerID, flagID, true
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCustomerImportSize caps the size of an uploaded customer CSV
+const maxCustomerImportSize = 10 << 20
+
+// Customer Import Handlers
+
+// ImportCustomers imports customers from a legacy system CSV export. The
+// multipart form takes the "file", an optional "mapping" JSON object of
+// customer field to CSV column, a duplicate "strategy" (skip, merge or
+// create) and "dry_run" to preview the result without saving.
+func (h *Handlers) ImportCustomers(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxCustomerImportSize+(1<<20))
+	if err := c.Request.ParseMultipartForm(maxCustomerImportSize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(header.Filename)) != ".csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only CSV files are allowed"})
+		return
+	}
+
+	req := services.CustomerImportRequest{
+		Strategy: services.DuplicateStrategy(c.PostForm("strategy")),
+	}
+	if mapping := c.PostForm("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &req.Mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping: expected a JSON object of field to column"})
+			return
+		}
+	}
+	req.DryRun, _ = strconv.ParseBool(c.PostForm("dry_run"))
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.ImportedBy = &user.ID
+	}
+
+	report, err := h.customerImportService.Import(c.Request.Context(), file, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Debug Handlers
+
+// processStart is when the server started, for uptime
+var processStart = time.Now()
+
+// debugProfiles are the runtime profiles served under /debug/pprof
+var debugProfiles = []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"}
+
+// RegisterDebugRoutes adds the pprof endpoints and runtime stats to a group
+// mounted at /debug, for diagnosing latency in production. The group must
+// be admin only: profiles expose memory contents and command lines.
+func (h *Handlers) RegisterDebugRoutes(debug *gin.RouterGroup) {
+	// Block and mutex profiles are empty unless contention is sampled,
+	// which costs a little on every lock
+	if h.config.Monitoring.DebugContention {
+		runtime.SetBlockProfileRate(int(10 * time.Microsecond))
+		runtime.SetMutexProfileFraction(100)
+	}
+
+	debug.GET("/runtime", h.RuntimeStats)
+	debug.GET("/pprof/", gin.WrapF(pprof.Index))
+	debug.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	debug.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	for _, name := range debugProfiles {
+		debug.GET("/pprof/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
+
+// RuntimeStats reports goroutines, memory, garbage collection and database
+// pool usage, a quick look before taking a profile
+func (h *Handlers) RuntimeStats(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	gc := gin.H{
+		"cycles":            mem.NumGC,
+		"forced_cycles":     mem.NumForcedGC,
+		"next_target_bytes": mem.NextGC,
+		"pause_total_ms":    float64(mem.PauseTotalNs) / 1e6,
+		"cpu_fraction":      mem.GCCPUFraction,
+	}
+	if mem.NumGC > 0 {
+		gc["last_pause_ms"] = float64(mem.PauseNs[(mem.NumGC+255)%256]) / 1e6
+		gc["last_run"] = time.Unix(0, int64(mem.LastGC)).UTC()
+	}
+
+	pools := make(map[string]gin.H)
+	if h.dbManager != nil {
+		if stats, err := h.dbManager.GetStats(); err == nil {
+			for name, pool := range stats.Pools {
+				pools[name] = poolStats(pool)
+			}
+		}
+	} else if sqlDB, err := h.db.DB(); err == nil {
+		pools["primary"] = poolStats(sqlDB.Stats())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"go_version":     runtime.Version(),
+		"uptime_seconds": int64(time.Since(processStart).Seconds()),
+		"goroutines":     runtime.NumGoroutine(),
+		"gomaxprocs":     runtime.GOMAXPROCS(0),
+		"num_cpu":        runtime.NumCPU(),
+		"memory": gin.H{
+			"heap_alloc_bytes":    mem.HeapAlloc,
+			"heap_in_use_bytes":   mem.HeapInuse,
+			"heap_idle_bytes":     mem.HeapIdle,
+			"heap_released_bytes": mem.HeapReleased,
+			"heap_objects":        mem.HeapObjects,
+			"stack_in_use_bytes":  mem.StackInuse,
+			"sys_bytes":           mem.Sys,
+			"total_alloc_bytes":   mem.TotalAlloc,
+			"mallocs":             mem.Mallocs,
+			"frees":               mem.Frees,
+		},
+		"gc":             gc,
+		"database_pools": pools,
+	})
+}
+
+func poolStats(pool sql.DBStats) gin.H {
+	return gin.H{
+		"max_open":            pool.MaxOpenConnections,
+		"open":                pool.OpenConnections,
+		"in_use":              pool.InUse,
+		"idle":                pool.Idle,
+		"wait_count":          pool.WaitCount,
+		"wait_ms":             pool.WaitDuration.Milliseconds(),
+		"max_idle_closed":     pool.MaxIdleClosed,
+		"max_lifetime_closed": pool.MaxLifetimeClosed,
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Delivery Handlers
+
+// GetDeliveryQuote places a delivery address on the map before checkout.
+// It returns the address as the geocoder knows it, to suggest to the
+// customer, whether it is in the service area and the delivery fee.
+func (h *Handlers) GetDeliveryQuote(c *gin.Context) {
+	if !h.deliveryService.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Address lookup is not configured",
+			"code":  middleware.CodeForStatus(http.StatusServiceUnavailable),
+		})
+		return
+	}
+
+	var req services.DeliveryQuoteRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if branchID := middleware.GetBranchID(c); branchID != nil {
+		req.BranchID = branchID
+	}
+
+	quote, err := h.deliveryService.Quote(c.Request.Context(), req)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, services.ErrAddressNotFound) {
+			status = http.StatusUnprocessableEntity
+		}
+		h.respondError(c, status, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
+// GetDeliveryZones lists active delivery zones, and inactive ones too for
+// admins with ?include_inactive=true
+func (h *Handlers) GetDeliveryZones(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+	includeInactive := c.Query("include_inactive") == "true" && user.Role == models.RoleAdmin
+
+	zones, err := h.deliveryService.ListZones(c.Request.Context(), includeInactive)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve delivery zones"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"zones": zones})
+}
+
+func (h *Handlers) CreateDeliveryZone(c *gin.Context) {
+	var req services.DeliveryZoneRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	zone, err := h.deliveryService.CreateZone(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, deliveryZoneErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "delivery_zones", zone.ID, nil, zone)
+	c.JSON(http.StatusCreated, zone)
+}
+
+func (h *Handlers) UpdateDeliveryZone(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery zone ID"})
+		return
+	}
+
+	var req services.DeliveryZoneRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	before, zone, err := h.deliveryService.UpdateZone(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondError(c, deliveryZoneErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "update", "delivery_zones", zone.ID, before, zone)
+	c.JSON(http.StatusOK, zone)
+}
+
+func (h *Handlers) DeleteDeliveryZone(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery zone ID"})
+		return
+	}
+
+	zone, err := h.deliveryService.DeleteZone(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "delete", "delivery_zones", zone.ID, zone, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Delivery zone deleted"})
+}
+
+func deliveryZoneErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInvalidZone) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
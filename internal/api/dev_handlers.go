@@ -0,0 +1,64 @@
+//go:build dev
+
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Development build only (go build -tags dev). Release builds compile the
+// no-op in dev_handlers_release.go instead, so these routes don't exist there.
+
+// RegisterDevRoutes adds the development helpers to the auth route group
+func (h *Handlers) RegisterDevRoutes(auth *gin.RouterGroup) {
+	auth.POST("/create-test-user", h.CreateTestUser)
+}
+
+// CreateTestUser creates admin / admin123 for local testing
+func (h *Handlers) CreateTestUser(c *gin.Context) {
+	// A dev build pointed at a production database still refuses
+	if h.config.Environment == "production" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not available in production"})
+		return
+	}
+
+	// Check if admin user already exists
+	var existingUser models.User
+	if err := h.db.Where("username = ?", "admin").First(&existingUser).Error; err == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Admin user already exists"})
+		return
+	}
+
+	// Create admin user with hashed password
+	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte("admin123"), 12)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		return
+	}
+
+	user := models.User{
+		Username:     "admin",
+		Email:        "admin@pharmacy.com",
+		PasswordHash: string(hashedPasswordBytes),
+		Role:         models.RoleAdmin,
+		FirstName:    "Admin",
+		LastName:     "User",
+		IsActive:     true,
+	}
+
+	if err := h.db.Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Admin user created successfully",
+		"username": "admin",
+		"password": "admin123",
+	})
+}
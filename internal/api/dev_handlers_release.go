@@ -0,0 +1,9 @@
+//go:build !dev
+
+package api
+
+import "github.com/gin-gonic/gin"
+
+// RegisterDevRoutes adds nothing outside development builds, see
+// dev_handlers.go
+func (h *Handlers) RegisterDevRoutes(auth *gin.RouterGroup) {}
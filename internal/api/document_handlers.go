@@ -0,0 +1,248 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Document Handlers
+
+// GetDocuments lists the licenses and accreditations on file, soonest to
+// expire first. Renewed ones are listed with ?include_renewed=true or
+// ?status=renewed.
+func (h *Handlers) GetDocuments(c *gin.Context) {
+	filter := services.DocumentFilter{
+		Type:           models.DocumentType(c.Query("type")),
+		Status:         models.DocumentStatus(c.Query("status")),
+		IncludeRenewed: c.Query("include_renewed") == "true",
+	}
+	for param, target := range map[string]**uuid.UUID{
+		"branch_id":   &filter.BranchID,
+		"user_id":     &filter.UserID,
+		"supplier_id": &filter.SupplierID,
+	} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*target = &id
+		}
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	documents, total, err := h.documentService.ListDocuments(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"documents": documents,
+		"total":     total,
+		"limit":     filter.Limit,
+		"offset":    filter.Offset,
+	})
+}
+
+// GetDocumentDashboard returns the documents that have expired or expire
+// soon and the licenses missing from file, for the staff member's branch
+func (h *Handlers) GetDocumentDashboard(c *gin.Context) {
+	dashboard, err := h.documentService.Dashboard(c.Request.Context(), middleware.GetBranchID(c))
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, dashboard)
+}
+
+func (h *Handlers) CreateDocument(c *gin.Context) {
+	var req services.DocumentRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	document, err := h.documentService.CreateDocument(c.Request.Context(), req, user.ID)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "compliance_documents", document.ID, nil, document)
+	c.JSON(http.StatusCreated, document)
+}
+
+func (h *Handlers) GetDocument(c *gin.Context) {
+	id, ok := documentID(c)
+	if !ok {
+		return
+	}
+
+	document, err := h.documentService.GetDocument(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, document)
+}
+
+func (h *Handlers) UpdateDocument(c *gin.Context) {
+	id, ok := documentID(c)
+	if !ok {
+		return
+	}
+	var req services.DocumentRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	previous, err := h.documentService.GetDocument(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+	document, err := h.documentService.UpdateDocument(c.Request.Context(), id, req, user.ID)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "update", "compliance_documents", id, previous, document)
+	c.JSON(http.StatusOK, document)
+}
+
+// RenewDocument files a document's renewal. The old document is kept as
+// history and no longer reminded about.
+func (h *Handlers) RenewDocument(c *gin.Context) {
+	id, ok := documentID(c)
+	if !ok {
+		return
+	}
+	var req services.DocumentRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	renewal, err := h.documentService.RenewDocument(c.Request.Context(), id, req, user.ID)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "renew", "compliance_documents", id, nil, renewal)
+	c.JSON(http.StatusCreated, renewal)
+}
+
+func (h *Handlers) DeleteDocument(c *gin.Context) {
+	id, ok := documentID(c)
+	if !ok {
+		return
+	}
+
+	previous, err := h.documentService.GetDocument(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+	if err := h.documentService.DeleteDocument(c.Request.Context(), id); err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "delete", "compliance_documents", id, previous, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Document deleted"})
+}
+
+// UploadDocumentFile attaches the scanned copy of a document from the
+// "file" multipart field, replacing the one it had
+func (h *Handlers) UploadDocumentFile(c *gin.Context) {
+	id, ok := documentID(c)
+	if !ok {
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPrescriptionUploadSize+(1<<20))
+	if err := c.Request.ParseMultipartForm(maxPrescriptionUploadSize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		return
+	}
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	// Licenses are scanned or photographed like prescriptions
+	contentType, allowed := allowedPrescriptionTypes[strings.ToLower(filepath.Ext(header.Filename))]
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPG, PNG, and PDF files are allowed"})
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, maxPrescriptionUploadSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	if len(data) > maxPrescriptionUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the 10 MB limit"})
+		return
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Uploaded file is empty"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	document, err := h.documentService.AttachFile(c.Request.Context(), id, header.Filename, contentType, data, user.ID)
+	if err != nil {
+		h.respondError(c, documentErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "upload", "compliance_documents", id, nil, gin.H{"file_name": document.FileName})
+	c.JSON(http.StatusOK, document)
+}
+
+// DownloadDocumentFile redirects to a short-lived signed URL for a
+// document's scanned copy. With redirect=false the URL is returned instead.
+func (h *Handlers) DownloadDocumentFile(c *gin.Context) {
+	id, ok := documentID(c)
+	if !ok {
+		return
+	}
+
+	download, err := h.fileService.DocumentFile(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, fileErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "download", "compliance_documents", id, nil, download)
+	h.sendDownload(c, download)
+}
+
+func documentID(c *gin.Context) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid document ID"})
+		return uuid.Nil, false
+	}
+	return id, true
+}
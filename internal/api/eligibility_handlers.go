@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Discount Eligibility Handlers
+
+// VerifyCustomerEligibility approves or rejects a customer's uploaded senior
+// citizen or PWD ID
+func (h *Handlers) VerifyCustomerEligibility(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.VerifyEligibilityRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	customer, err := h.eligibilityService.Verify(c.Request.Context(), customerID, req, user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// GetPendingEligibility lists uploaded IDs awaiting staff verification
+func (h *Handlers) GetPendingEligibility(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	customers, total, err := h.eligibilityService.GetPending(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending verifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customers": customers,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// GetExpiringEligibility lists verified IDs due for renewal
+func (h *Handlers) GetExpiringEligibility(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+	customers, err := h.eligibilityService.GetExpiring(c.Request.Context(), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve expiring IDs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"customers": customers,
+		"days":      days,
+	})
+}
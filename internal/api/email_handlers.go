@@ -0,0 +1,174 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Email Handlers
+
+// emailInvoiceRequest optionally names the address to send an invoice to
+type emailInvoiceRequest struct {
+	Email string `json:"email" binding:"omitempty,email"`
+}
+
+// GetEmailSuppressions lists addresses that are no longer emailed, newest
+// first, filtered by ?reason= and ?search=
+func (h *Handlers) GetEmailSuppressions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	suppressions, total, err := h.emailService.ListSuppressions(c.Request.Context(), c.Query("reason"), c.Query("search"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve email suppressions"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"suppressions": suppressions,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// CreateEmailSuppression stops email to an address, e.g. when a customer
+// asks by phone
+func (h *Handlers) CreateEmailSuppression(c *gin.Context) {
+	var req services.EmailSuppressionRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = models.SuppressionManual
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	suppression, err := h.emailService.Suppress(c.Request.Context(), req.Email, req.Reason, "staff", req.Detail, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	h.recordChange(c, "create", "email_suppressions", suppression.ID, nil, suppression)
+	c.JSON(http.StatusCreated, suppression)
+}
+
+// DeleteEmailSuppression lets mail through to an address again
+func (h *Handlers) DeleteEmailSuppression(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suppression ID"})
+		return
+	}
+
+	suppression, err := h.emailService.RemoveSuppression(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "delete", "email_suppressions", suppression.ID, suppression, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Email suppression removed"})
+}
+
+// ReceiveSendGridEvents applies bounces, spam reports and unsubscribes from
+// SendGrid's signed event webhook to the suppression list. Requests without
+// a valid signature are rejected.
+func (h *Handlers) ReceiveSendGridEvents(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	applied, err := h.emailService.HandleSendGridEvents(c.Request.Context(), body,
+		c.GetHeader("X-Twilio-Email-Event-Webhook-Timestamp"), c.GetHeader("X-Twilio-Email-Event-Webhook-Signature"))
+	switch {
+	case errors.Is(err, services.ErrInvalidEmailSignature):
+		logrus.WithField("ip", c.ClientIP()).Warn("Rejected email events with an invalid signature")
+		h.respondError(c, http.StatusForbidden, err)
+		return
+	case errors.Is(err, services.ErrEmailUnavailable):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email events are not enabled"})
+		return
+	case err != nil:
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if applied > 0 {
+		logrus.WithField("suppressions", applied).Info("Applied email events to the suppression list")
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// EmailSaleInvoice queues the sale's invoice to the customer's email, or to
+// the address given
+func (h *Handlers) EmailSaleInvoice(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var req emailInvoiceRequest
+	if c.Request.ContentLength != 0 && !bindStrictJSON(c, &req) {
+		return
+	}
+
+	var sale models.Sale
+	if err := h.db.WithContext(c.Request.Context()).Preload("Customer", services.WithDeleted).First(&sale, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sale"})
+		return
+	}
+
+	recipient := req.Email
+	if recipient == "" && sale.Customer != nil && sale.Customer.AnonymizedAt == nil {
+		recipient = sale.Customer.Email
+	}
+	if recipient == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The customer has no email address, give one to send the invoice to"})
+		return
+	}
+
+	number := sale.SaleNumber
+	if sale.InvoiceNumber != nil {
+		number = *sale.InvoiceNumber
+	}
+	notification := services.OutboxNotification{
+		Event:     "sale.invoice",
+		Channel:   services.ChannelEmail,
+		Recipient: recipient,
+		Purpose:   models.PurposeTransactional,
+		Subject:   "Your invoice " + number,
+		Body:      "Thank you for your purchase. Your invoice " + number + " totals " + sale.Currency + " " + sale.Total.String() + ".",
+		Email: &services.EmailContent{
+			Template: services.EmailTemplateInvoice,
+			Data:     services.EmailSaleRef{SaleID: sale.ID},
+		},
+	}
+	if err := h.outboxService.QueueNotification(h.db.WithContext(c.Request.Context()), notification); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "email_invoice", "sales", sale.ID, nil, gin.H{"recipient": recipient})
+	c.JSON(http.StatusAccepted, gin.H{"message": "Invoice queued for email"})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/fhir"
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// E-Prescription Handlers
+
+// ImportFHIRPrescriptions accepts a FHIR R4 Bundle of MedicationRequests from
+// a clinic system and creates pre-verified orders awaiting dispensing. The
+// source query parameter identifies the clinic; it defaults to the
+// integration account's username.
+func (h *Handlers) ImportFHIRPrescriptions(c *gin.Context) {
+	var bundle fhir.Bundle
+	if !bindJSON(c, &bundle) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	source := c.Query("source")
+	if source == "" {
+		source = user.Username
+	}
+
+	result, err := h.ePrescriptionService.ImportBundle(c.Request.Context(), &bundle, source, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	status := http.StatusCreated
+	switch {
+	case result.Imported == 0 && len(result.Rejected) > 0:
+		status = http.StatusUnprocessableEntity
+	case result.Imported == 0:
+		status = http.StatusOK
+	}
+
+	c.JSON(status, result)
+}
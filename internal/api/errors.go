@@ -0,0 +1,289 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/query"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Error Responses
+
+// respondError writes an error response for err. Well known errors get
+// their own status and code: missing records are 404s, constraint
+// violations 409s and validation failures list their fields. Database and
+// other internal errors are logged and replaced with a generic message so
+// SQL and driver details never reach the client. Any other error is sent
+// with status and its own message, which services write for users.
+//
+// ErrorEnvelope adds the localized message and request ID.
+func (h *Handlers) respondError(c *gin.Context, status int, err error) {
+	var fields fieldErrors
+	var pgErr *pgconn.PgError
+
+	switch {
+	case errors.As(err, &fields):
+		respondBindError(c, err)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		message := strings.TrimSuffix(err.Error(), ": "+gorm.ErrRecordNotFound.Error())
+		if message == gorm.ErrRecordNotFound.Error() {
+			message = "Record not found"
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": message, "code": middleware.CodeNotFound})
+	case h.isDBError(err, gorm.ErrDuplicatedKey):
+		c.JSON(http.StatusConflict, gin.H{"error": "A record with these details already exists", "code": middleware.CodeConflict})
+	case h.isDBError(err, gorm.ErrForeignKeyViolated):
+		c.JSON(http.StatusConflict, gin.H{"error": "The record is linked to records that are missing or still in use", "code": middleware.CodeConflict})
+	case errors.Is(err, context.DeadlineExceeded):
+		logError(c, err)
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "Request timed out", "code": middleware.CodeTimeout})
+	case errors.As(err, &pgErr), status >= http.StatusInternalServerError:
+		logError(c, err)
+		if status < http.StatusInternalServerError {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"error": "Internal server error", "code": middleware.CodeForStatus(status)})
+	default:
+		c.JSON(status, gin.H{"error": err.Error(), "code": middleware.CodeForStatus(status)})
+	}
+}
+
+// cursorErrorStatus is the status for an error from a keyset page: a bad
+// cursor is the client's fault, anything else the server's
+func cursorErrorStatus(err error) int {
+	if errors.Is(err, query.ErrInvalidCursor) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// stockErrorStatus is the status for an error changing stock. Running out
+// of stock, or it changing under a set, is a conflict the client can read
+// the stock again for and retry.
+func stockErrorStatus(err error) int {
+	if errors.Is(err, services.ErrInsufficientStock) || errors.Is(err, services.ErrStockChanged) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// bulkErrorStatus maps an error that stopped a whole bulk request to its
+// response status
+func bulkErrorStatus(err error) int {
+	if errors.Is(err, services.ErrBulkTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// claimErrorStatus maps an insurance claim error to its response status
+func claimErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrClaimExists), errors.Is(err, services.ErrClaimStatus):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrClaimNeedsCustomer), errors.Is(err, services.ErrNoInsuranceProvider),
+		errors.Is(err, services.ErrLOAExpired), errors.Is(err, services.ErrClaimAmount),
+		errors.Is(err, services.ErrClaimDenialReason):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// serviceSaleErrorStatus maps an error checking or completing a sale's
+// services to its response status
+func serviceSaleErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrServiceCompleted), errors.Is(err, services.ErrSaleNotCompleted):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrSaleItemType), errors.Is(err, services.ErrServiceInactive),
+		errors.Is(err, services.ErrServiceNeedsRx), errors.Is(err, services.ErrPerformerNotStaff),
+		errors.Is(err, services.ErrPerformerUnqualified), errors.Is(err, services.ErrNotServiceItem),
+		errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// coldChainErrorStatus maps a storage unit, reading or excursion error to
+// its response status
+func coldChainErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrStorageUnitBusy), errors.Is(err, services.ErrExcursionOpen),
+		errors.Is(err, services.ErrExcursionReviewed), errors.Is(err, services.ErrStorageUnitInactive):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrStorageUnitRange), errors.Is(err, services.ErrStorageUnitKind),
+		errors.Is(err, services.ErrReadingInFuture), errors.Is(err, services.ErrDispositionMissing):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// stationErrorStatus maps an error queueing or settling a station job to
+// its response status
+func stationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrTerminalNotPaired), errors.Is(err, services.ErrStationJobNotSent),
+		errors.Is(err, services.ErrStationJobNotQueued), errors.Is(err, services.ErrStationJobNotFailed):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrLabelFormat), errors.Is(err, services.ErrLabelSource),
+		errors.Is(err, services.ErrSaleOtherBranch), errors.Is(err, services.ErrNothingToLabel):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// prescriptionErrorStatus maps a prescription upload or verification error
+// to its response status
+func prescriptionErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOrderClosed), errors.Is(err, services.ErrPrescriptionVerified):
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// pickingErrorStatus maps a pick list or pick error to its response status
+func pickingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrOrderNotPickable), errors.Is(err, services.ErrPickItemClosed),
+		errors.Is(err, services.ErrPickConflict):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrPickWrongProduct), errors.Is(err, services.ErrPickWrongBatch),
+		errors.Is(err, services.ErrPickQuantity):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// feedbackErrorStatus maps a feedback error to its response status
+func feedbackErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrFeedbackNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrFeedbackExpired), errors.Is(err, services.ErrFeedbackSubmitted),
+		errors.Is(err, services.ErrFeedbackNotDue), errors.Is(err, services.ErrFeedbackNotAnswered):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrFeedbackModeration):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// compoundingErrorStatus maps a formula or preparation error to its
+// response status
+func compoundingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrPreparationStatus), errors.Is(err, services.ErrPreparationNotReady),
+		errors.Is(err, services.ErrPreparationUnlabeled), errors.Is(err, services.ErrInsufficientStock),
+		errors.Is(err, services.ErrStockChanged):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrFormulaInactive), errors.Is(err, services.ErrFormulaIngredientUnknown),
+		errors.Is(err, services.ErrFormulaIngredientRepeat), errors.Is(err, services.ErrPreparationNeedsRx),
+		errors.Is(err, services.ErrPreparationBeyondUse), errors.Is(err, services.ErrPreparationCustomer),
+		errors.Is(err, services.ErrIngredientExpired):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// referralErrorStatus maps a referral error to its response status
+func referralErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrReferralCodeUnknown):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrReferralExists), errors.Is(err, services.ErrReferralNotNew):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrReferralSelf), errors.Is(err, services.ErrReferralDependent):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// documentErrorStatus maps a license or accreditation error to its response
+// status
+func documentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrDocumentRenewed):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrDocumentType), errors.Is(err, services.ErrDocumentHolder),
+		errors.Is(err, services.ErrDocumentDates):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// timeClockErrorStatus maps a time clock error to its response status
+func timeClockErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrAlreadyClockedIn), errors.Is(err, services.ErrNotClockedIn),
+		errors.Is(err, services.ErrShiftClosed), errors.Is(err, services.ErrDrawerInUse):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrBadgeUnknown):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrShiftOpeningCash), errors.Is(err, services.ErrShiftClosingCash),
+		errors.Is(err, services.ErrShiftTerminal), errors.Is(err, services.ErrEmployeeInactive),
+		errors.Is(err, services.ErrShiftNegativeCount):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// refundErrorStatus maps an error refunding a sale to its response status
+func refundErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSaleRefunded), errors.Is(err, services.ErrSaleNotCompleted):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// isDBError reports whether any error in err's chain translates to target
+// in the database dialect, e.g. gorm.ErrDuplicatedKey
+func (h *Handlers) isDBError(err error, target error) bool {
+	translator, ok := h.db.Dialector.(gorm.ErrorTranslator)
+	if !ok {
+		return errors.Is(err, target)
+	}
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		if errors.Is(translator.Translate(e), target) {
+			return true
+		}
+	}
+	return false
+}
+
+// logError records an error whose detail is withheld from the client, with
+// the request ID the client is given to quote
+func logError(c *gin.Context, err error) {
+	requestID, _ := c.Get(middleware.RequestIDKey)
+	logrus.WithError(err).WithFields(logrus.Fields{
+		"request_id": requestID,
+		"method":     c.Request.Method,
+		"path":       c.FullPath(),
+	}).Error("Request failed")
+}
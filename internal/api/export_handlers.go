@@ -0,0 +1,141 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Export Handlers
+
+// exportWriteTimeout is how long each batch of an export has to reach the
+// client. The deadline moves on with every batch, so an export runs as long
+// as it keeps making progress instead of being cut off by the server's
+// write timeout.
+const exportWriteTimeout = 30 * time.Second
+
+// ExportSales streams sales between ?start_date= and ?end_date=, optionally
+// of one ?status=, as CSV or NDJSON (?format=ndjson) with their items
+func (h *Handlers) ExportSales(c *gin.Context) {
+	filter, format, err := exportFilter(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	filter.Status = c.Query("status")
+
+	response := startExport(c, "sales", format)
+	if err := h.exportService.ExportSales(c.Request.Context(), response, filter, format); err != nil {
+		failExport(c, "sales", err)
+	}
+}
+
+// ExportStockMovements streams stock movements between ?start_date= and
+// ?end_date=, optionally of one ?product_id= or ?type=, as CSV or NDJSON
+func (h *Handlers) ExportStockMovements(c *gin.Context) {
+	filter, format, err := exportFilter(c)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		id, err := uuid.Parse(productID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+		filter.ProductID = &id
+	}
+	filter.MovementType = models.MovementType(c.Query("type"))
+
+	response := startExport(c, "stock-movements", format)
+	if err := h.exportService.ExportStockMovements(c.Request.Context(), response, filter, format); err != nil {
+		failExport(c, "stock movements", err)
+	}
+}
+
+// exportFilter reads the date range and format shared by exports. Staff
+// working in a branch only export its rows.
+func exportFilter(c *gin.Context) (services.ExportFilter, string, error) {
+	filter := services.ExportFilter{BranchID: middleware.GetBranchID(c)}
+	format := c.DefaultQuery("format", services.ExportCSV)
+	if !services.ValidExportFormat(format) {
+		return filter, "", fmt.Errorf("format must be csv or ndjson")
+	}
+	if start := c.Query("start_date"); start != "" {
+		startDate, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			return filter, "", fmt.Errorf("invalid start_date, expected YYYY-MM-DD")
+		}
+		filter.From = &startDate
+	}
+	if end := c.Query("end_date"); end != "" {
+		endDate, err := time.Parse("2006-01-02", end)
+		if err != nil {
+			return filter, "", fmt.Errorf("invalid end_date, expected YYYY-MM-DD")
+		}
+		endDate = endDate.AddDate(0, 0, 1)
+		filter.To = &endDate
+	}
+	return filter, format, nil
+}
+
+// exportResponse is a response an export is streamed into. Every flush
+// sends what was written so far and gives the next batch a fresh write
+// deadline.
+type exportResponse struct {
+	io.Writer
+	controller *http.ResponseController
+}
+
+func (r *exportResponse) Flush() {
+	r.extend()
+	if err := r.controller.Flush(); err != nil {
+		logrus.WithError(err).Debug("Failed to flush an export")
+	}
+}
+
+func (r *exportResponse) extend() {
+	if err := r.controller.SetWriteDeadline(time.Now().Add(exportWriteTimeout)); err != nil {
+		logrus.WithError(err).Debug("Failed to extend the write deadline of an export")
+	}
+}
+
+// startExport sends the headers of a download named after name and today's
+// date, and returns the response to stream it into. The body is sent in
+// chunks as it is written.
+func startExport(c *gin.Context, name, format string) *exportResponse {
+	contentType := "text/csv"
+	if format != services.ExportCSV {
+		contentType = "application/x-ndjson"
+	}
+	filename := name + "-" + time.Now().Format("20060102") + "." + format
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	response := &exportResponse{Writer: c.Writer, controller: http.NewResponseController(c.Writer)}
+	response.extend()
+	return response
+}
+
+// failExport records an export that stopped part way. Its headers are
+// already sent, so the client sees a truncated file.
+func failExport(c *gin.Context, what string, err error) {
+	if c.Request.Context().Err() != nil {
+		logrus.WithField("export", what).Info("Export cancelled by the client")
+		return
+	}
+	c.Error(err)
+}
@@ -0,0 +1,244 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Feedback Handlers
+//
+// Delivered and picked-up orders get a feedback link, also printed as a QR
+// code, that takes one rating from the customer. Staff moderate the
+// comments before any is shown publicly.
+
+// GetFeedbackForm returns the feedback page for a link's token
+func (h *Handlers) GetFeedbackForm(c *gin.Context) {
+	form, err := h.feedbackService.Form(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, form)
+}
+
+// SubmitFeedback records the customer's rating, NPS score and comment
+func (h *Handlers) SubmitFeedback(c *gin.Context) {
+	var req services.SubmitFeedbackRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	form, err := h.feedbackService.Submit(c.Request.Context(), c.Param("token"), req)
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"feedback": form,
+		"message":  "Thank you for your feedback",
+	})
+}
+
+// GetPublishedFeedback lists the published comments, of the branch in
+// ?branch_id if given
+func (h *Handlers) GetPublishedFeedback(c *gin.Context) {
+	var branchID *uuid.UUID
+	if value := c.Query("branch_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+			return
+		}
+		branchID = &id
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	feedback, total, err := h.feedbackService.Published(c.Request.Context(), branchID, limit, offset)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{"feedback": feedback, "total": total})
+}
+
+// GetOrderFeedback returns the feedback asked for on an order, with the
+// link and QR code to hand the customer
+func (h *Handlers) GetOrderFeedback(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	feedback, err := h.feedbackService.GetOrderFeedback(c.Request.Context(), orderID)
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	if !h.inFeedbackBranch(c, feedback) {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feedback": feedback, "link": h.feedbackService.Link(feedback)})
+}
+
+// RequestOrderFeedback asks for feedback on a delivered or picked-up order
+// that wasn't asked yet, e.g. one fulfilled before feedback was collected
+func (h *Handlers) RequestOrderFeedback(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var order models.OnlineOrder
+	if err := h.db.Select("id, branch_id").First(&order, orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if order.BranchID != nil && !h.inStaffBranch(c, *order.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	feedback, err := h.feedbackService.RequestOrderFeedback(c.Request.Context(), orderID, &user.ID)
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"feedback": feedback, "link": h.feedbackService.Link(feedback)})
+}
+
+// GetFeedbackList lists customer responses, filtered by ?status,
+// ?staff_id, ?max_rating and ?with_comment. Staff limited to a branch see
+// its feedback only.
+func (h *Handlers) GetFeedbackList(c *gin.Context) {
+	filter := services.FeedbackFilter{
+		BranchID:    middleware.GetBranchID(c),
+		Status:      models.FeedbackStatus(c.Query("status")),
+		WithComment: c.Query("with_comment") == "true",
+	}
+	if value := c.Query("staff_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+			return
+		}
+		filter.StaffID = &id
+	}
+	filter.MaxRating, _ = strconv.Atoi(c.Query("max_rating"))
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	feedback, total, err := h.feedbackService.ListFeedback(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"feedback": feedback,
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
+	})
+}
+
+func (h *Handlers) GetFeedback(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedback ID"})
+		return
+	}
+
+	feedback, err := h.feedbackService.GetFeedback(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	if !h.inFeedbackBranch(c, feedback) {
+		return
+	}
+	c.JSON(http.StatusOK, feedback)
+}
+
+// ModerateFeedback publishes a response's comment, or hides the response
+func (h *Handlers) ModerateFeedback(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid feedback ID"})
+		return
+	}
+	var req services.ModerateFeedbackRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	previous, err := h.feedbackService.GetFeedback(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	if !h.inFeedbackBranch(c, previous) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	feedback, err := h.feedbackService.Moderate(c.Request.Context(), id, req, user.ID)
+	if err != nil {
+		h.respondError(c, feedbackErrorStatus(err), err)
+		return
+	}
+	h.recordChange(c, "moderate", "feedback", id, previous, feedback)
+	c.JSON(http.StatusOK, feedback)
+}
+
+// GetFeedbackAnalytics reports the average rating and NPS of the feedback
+// given between ?start_date and ?end_date, their trend by ?interval (week
+// or month) and each staff member's. Staff limited to a branch see its
+// feedback only.
+func (h *Handlers) GetFeedbackAnalytics(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	interval := c.DefaultQuery("interval", "week")
+	if interval != "week" && interval != "month" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "interval must be week or month"})
+		return
+	}
+
+	report, err := h.feedbackService.Report(c.Request.Context(), services.FeedbackReportFilter{
+		BranchID: middleware.GetBranchID(c),
+		From:     from,
+		To:       to,
+		Interval: interval,
+	})
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// inFeedbackBranch checks staff limited to a branch only see its feedback.
+// It reports false when it rejected the request.
+func (h *Handlers) inFeedbackBranch(c *gin.Context, feedback *models.Feedback) bool {
+	if feedback.BranchID != nil && !h.inStaffBranch(c, *feedback.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// File Handlers
+
+// ServeSignedFile serves an upload kept on the server's disk to whoever
+// holds a signed URL for it. Uploads kept in a bucket are downloaded from
+// the bucket with its own signed URLs.
+func (h *Handlers) ServeSignedFile(c *gin.Context) {
+	store, ok := h.fileService.Store().(*services.LocalFileStore)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if err := store.VerifySignedURL(key, c.Query("expires"), c.Query("signature")); err != nil {
+		h.respondError(c, http.StatusForbidden, err)
+		return
+	}
+
+	data, err := store.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrFileNotFound) || errors.Is(err, services.ErrInvalidFileKey) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	sendFile(c, path.Base(key), contentType, data)
+}
+
+// DownloadCustomerIDDocument redirects to a short-lived signed URL for a
+// customer's ID document. With redirect=false the URL is returned instead.
+func (h *Handlers) DownloadCustomerIDDocument(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	download, err := h.fileService.CustomerIDDocument(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, fileErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "download_id_document", "customers", id, nil, download)
+	h.sendDownload(c, download)
+}
+
+// DownloadPrescriptionFile redirects to a short-lived signed URL for an
+// uploaded prescription. With redirect=false the URL is returned instead.
+func (h *Handlers) DownloadPrescriptionFile(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	download, err := h.fileService.PrescriptionFile(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, fileErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "download", "prescription_uploads", id, nil, download)
+	h.sendDownload(c, download)
+}
+
+// sendDownload redirects to the download's signed URL, or returns it as
+// JSON when the client asks with redirect=false. Files still on local disk
+// from before storage backends have no signed URL and are sent directly.
+func (h *Handlers) sendDownload(c *gin.Context, download *services.FileDownload) {
+	if download.URL == "" {
+		sendFile(c, download.FileName, download.ContentType, download.Data)
+		return
+	}
+
+	c.Header("Cache-Control", "private, no-store")
+	if c.Query("redirect") == "false" {
+		c.JSON(http.StatusOK, download)
+		return
+	}
+	c.Redirect(http.StatusFound, download.URL)
+}
+
+func sendFile(c *gin.Context, fileName, contentType string, data []byte) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("Content-Disposition", "attachment; filename=\""+headerFileName(fileName)+"\"")
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// headerFileName strips the characters that would break out of a quoted
+// Content-Disposition file name. Uploaded file names come from clients.
+func headerFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "download"
+	}
+	return name
+}
+
+// fileErrorStatus is the status for an error finding an upload to download
+func fileErrorStatus(err error) int {
+	if errors.Is(err, services.ErrFileNotFound) || errors.Is(err, services.ErrNoIDDocument) ||
+		errors.Is(err, gorm.ErrRecordNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
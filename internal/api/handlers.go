@@ -2,35 +2,130 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
+	"pharmacy-backend/internal/alerting"
 	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/cache"
 	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/kvstore"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/metrics"
 	"pharmacy-backend/internal/middleware"
 	"pharmacy-backend/internal/models"
-
-	"golang.org/x/crypto/bcrypt"
+	"pharmacy-backend/internal/query"
+	"pharmacy-backend/internal/realtime"
+	"pharmacy-backend/internal/repository"
 	"pharmacy-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
+// OrderService is what the cart and online order handlers need of
+// services.OnlineOrderService, so they can run against a fake
+type OrderService interface {
+	AddToCart(ctx context.Context, req services.AddToCartRequest) (*models.ShoppingCart, error)
+	GetCart(ctx context.Context, customerID *uuid.UUID, sessionID *string) ([]models.ShoppingCart, error)
+	UpdateCartItem(ctx context.Context, cartItemID uuid.UUID, req services.UpdateCartItemRequest) error
+	RemoveFromCart(ctx context.Context, cartItemID uuid.UUID) error
+	ClearCart(ctx context.Context, customerID *uuid.UUID, sessionID *string) error
+	CleanupExpiredCarts(ctx context.Context) (int64, error)
+	CreateOrder(ctx context.Context, req services.CreateOrderRequest) (*models.OnlineOrder, error)
+	GetOrder(ctx context.Context, orderID uuid.UUID) (*models.OnlineOrder, error)
+	GetOrderWith(ctx context.Context, orderID uuid.UUID, include query.Selection) (*models.OnlineOrder, error)
+	GetOrderByNumber(ctx context.Context, orderNumber string) (*models.OnlineOrder, error)
+	TrackOrder(ctx context.Context, trackingCode string) (*services.OrderTracking, error)
+	GetCustomerOrders(ctx context.Context, customerID uuid.UUID, limit, offset int, include query.Selection) ([]models.OnlineOrder, error)
+	SearchOrders(ctx context.Context, filters services.OrderSearchFilters) ([]models.OnlineOrder, int64, error)
+	SearchOrdersAfter(ctx context.Context, filters services.OrderSearchFilters, cursor string) ([]models.OnlineOrder, string, error)
+	UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, newStatus models.OrderStatus, reason string, userID *uuid.UUID) error
+}
+
 type Handlers struct {
-	db                  *gorm.DB
-	redis               *redis.Client
-	config              *config.Config
-	authService         *auth.AuthService
-	qrService           *services.QRService
-	onlineOrderService  *services.OnlineOrderService
+	db                       *gorm.DB
+	redis                    *redis.Client
+	dbManager                *database.DatabaseManager
+	config                   *config.Config
+	authService              *auth.AuthService
+	qrService                *services.QRService
+	communicationService     *services.CommunicationService
+	smsService               *services.SMSService
+	emailService             *services.EmailService
+	pushService              *services.PushService
+	regulatoryService        *services.RegulatoryService
+	insuranceClaimService    *services.InsuranceClaimService
+	onlineOrderService       *services.OnlineOrderService
+	prescriptionService      *services.PrescriptionService
+	interactionService       *services.InteractionService
+	screeningService         *services.ScreeningService
+	refillService            *services.RefillService
+	ePrescriptionService     *services.EPrescriptionService
+	ocrService               *services.PrescriptionOCRService
+	labelService             *services.LabelService
+	medicationProfileService *services.MedicationProfileService
+	clinicalNoteService      *services.ClinicalNoteService
+	vaccinationService       *services.VaccinationService
+	purchaseHistoryService   *services.PurchaseHistoryService
+	privacyService           *services.PrivacyService
+	eligibilityService       *services.EligibilityService
+	householdService         *services.HouseholdService
+	segmentService           *services.SegmentService
+	loyaltyService           *services.LoyaltyService
+	customerImportService    *services.CustomerImportService
+	bulkService              *services.BulkService
+	exportService            *services.ExportService
+	campaignService          *services.CampaignService
+	customerFlagService      *services.CustomerFlagService
+	auditService             *services.AuditService
+	keyManagementService     *services.KeyManagementService
+	cspReportService         *services.CSPReportService
+	syncConflictService      *services.SyncConflictService
+	backupService            *services.BackupService
+	outboxService            *services.OutboxService
+	jobService               *services.JobService
+	webhookInboxService      *services.WebhookInboxService
+	coldChainService         *services.ColdChainService
+	branchService            *services.BranchService
+	stockService             *services.StockService
+	numberService            *services.NumberService
+	healthService            *services.HealthService
+	branchReportService      *services.BranchReportService
+	salesAnalyticsService    *services.SalesAnalyticsService
+	refundService            *services.RefundService
+	terminalService          *services.TerminalService
+	stationService           *services.StationService
+	pickingService           *services.PickingService
+	feedbackService          *services.FeedbackService
+	referralService          *services.ReferralService
+	compoundingService       *services.CompoundingService
+	documentService          *services.DocumentService
+	timeClockService         *services.TimeClockService
+	pricingService           *services.PricingService
+	serviceSaleService       *services.ServiceSaleService
+	taxService               *services.TaxService
+	currencyService          *services.CurrencyService
+	alerts                   *alerting.Notifier
+	fileService              *services.FileService
+	deliveryService          *services.DeliveryService
+	events                   *realtime.Hub
+	workers                  *lifecycle.Manager // background work started by requests
+	customers                repository.Customers
+	products                 repository.Products
+	sales                    repository.Sales
+	orders                   OrderService
 }
 
 func NewHandlers(db *gorm.DB, redis *redis.Client, config *config.Config, authService *auth.AuthService) *Handlers {
@@ -43,11 +138,142 @@ func NewHandlers(db *gorm.DB, redis *redis.Client, config *config.Config, authSe
 	
 	// Initialize additional services
 	h.qrService = services.NewQRService(db)
-	h.onlineOrderService = services.NewOnlineOrderService(db, h.qrService)
+	h.communicationService = services.NewCommunicationService(db, services.DefaultNotifiers(), config.Notification)
+	h.smsService = services.NewSMSService(db, services.NewSMSGateway(config.SMS), config.SMS)
+	if h.smsService.Enabled() {
+		h.communicationService.SetSMSService(h.smsService)
+	}
+	h.emailService = services.NewEmailService(db, services.NewEmailGateway(config.Email), config.Email, config.Pharmacy)
+	if h.emailService.Enabled() {
+		h.communicationService.SetEmailService(h.emailService)
+		authService.SetAlertNotifier(h.emailService)
+	}
+	h.pushService = services.NewPushService(db, services.NewPushGateways(config.Push))
+	h.outboxService = services.NewOutboxService(db, h.communicationService, config.Outbox)
+	if h.pushService.Enabled() {
+		h.communicationService.SetPushService(h.pushService)
+		h.outboxService.SetPushService(h.pushService)
+	}
+	h.currencyService = services.NewCurrencyService(db, config.Pharmacy.Currency)
+	h.taxService = services.NewTaxService(db, config.Pharmacy.TaxRate, h.currencyService)
+	h.pricingService = services.NewPricingService(db, h.taxService, h.currencyService)
+	h.serviceSaleService = services.NewServiceSaleService(db)
+	h.regulatoryService = services.NewRegulatoryService(db, config.FDA)
+	h.events = realtime.NewHub(redis)
+	h.workers = lifecycle.New(logrus.StandardLogger())
+	h.stockService = services.NewStockService(db)
+	h.stockService.SetOutbox(h.outboxService)
+	h.refundService = services.NewRefundService(db, h.stockService)
+	h.refundService.SetOutbox(h.outboxService)
+	h.stockService.SetEvents(h.events)
+	h.numberService = services.NewNumberService(db)
+	h.compoundingService = services.NewCompoundingService(db, h.stockService, h.numberService, h.pricingService)
+	h.insuranceClaimService = services.NewInsuranceClaimService(db, h.numberService, config.Pharmacy)
+	h.onlineOrderService = services.NewOnlineOrderService(db, h.qrService, h.outboxService, h.pricingService, h.taxService, h.currencyService, h.stockService, h.numberService)
+	h.deliveryService = services.NewDeliveryService(db, services.NewGeocoder(config.Geocoding), h.currencyService)
+	h.onlineOrderService.SetDelivery(h.deliveryService)
+	h.onlineOrderService.SetEvents(h.events)
+	h.orders = h.onlineOrderService
+	h.fileService = services.NewFileService(db, services.NewFileStore(config.Storage, config.Security.JWTSecret), config.Storage)
+	h.prescriptionService = services.NewPrescriptionService(db, h.onlineOrderService, h.outboxService, h.fileService)
+	h.documentService = services.NewDocumentService(db, h.fileService, config.Documents)
+	h.documentService.SetOutbox(h.outboxService)
+	h.timeClockService = services.NewTimeClockService(db, h.qrService)
+	h.interactionService = services.NewInteractionService(db)
+	h.screeningService = services.NewScreeningService(db)
+	h.refillService = services.NewRefillService(db, h.onlineOrderService, h.communicationService, config.Refill)
+	h.ePrescriptionService = services.NewEPrescriptionService(db, h.onlineOrderService)
+	h.ocrService = services.NewPrescriptionOCRService(db, services.NewOCRProvider(config.OCR), h.fileService)
+	h.labelService = services.NewLabelService(db, config.Pharmacy)
+	h.medicationProfileService = services.NewMedicationProfileService(db)
+	h.clinicalNoteService = services.NewClinicalNoteService(db)
+	h.purchaseHistoryService = services.NewPurchaseHistoryService(db)
+	h.onlineOrderService.SetPurchaseHistory(h.purchaseHistoryService)
+	h.vaccinationService = services.NewVaccinationService(db, h.qrService, h.communicationService, config.Vaccination, config.Pharmacy)
+	h.privacyService = services.NewPrivacyService(db, h.fileService)
+	h.eligibilityService = services.NewEligibilityService(db)
+	h.householdService = services.NewHouseholdService(db)
+	h.segmentService = services.NewSegmentService(db, h.communicationService, config.Segment)
+	h.loyaltyService = services.NewLoyaltyService(db, config.Loyalty)
+	h.referralService = services.NewReferralService(db, h.loyaltyService, config.Referral)
+	h.customerImportService = services.NewCustomerImportService(db)
+	h.campaignService = services.NewCampaignService(db, h.communicationService, config.Campaign)
+	h.customerFlagService = services.NewCustomerFlagService(db)
+	h.auditService = services.NewAuditService(db, config.HIPAA.DataRetentionDays, config.AuditArchive, services.NewArchiveUploader(config.Backup))
+	h.keyManagementService = services.NewKeyManagementService(db, services.NewMasterKeyProvider(config.Encryption, config.Security.EncryptionKey), config.Encryption)
+	h.cspReportService = services.NewCSPReportService(db)
+	h.syncConflictService = services.NewSyncConflictService(db)
+	h.backupService = services.NewBackupService(db, services.NewBackupStore(config.Backup), services.NewMasterKeyProvider(config.Encryption, config.Security.EncryptionKey), config.Database, config.Backup, config.Sync.BackupInterval)
+	h.jobService = services.NewJobService(db, config.Jobs)
+	h.webhookInboxService = services.NewWebhookInboxService(db, h.jobService, config.WebhookInbox)
+	h.coldChainService = services.NewColdChainService(db, config.ColdChain)
+	h.coldChainService.SetOutbox(h.outboxService)
+	if config.ColdChain.Integration != "" {
+		h.webhookInboxService.Handle(config.ColdChain.Integration, "*", h.coldChainService.ReceiveSensorReadings)
+	}
+	h.branchService = services.NewBranchService(db, h.stockService)
+	h.bulkService = services.NewBulkService(db, h.regulatoryService, h.stockService)
+	h.exportService = services.NewExportService(db)
+	h.branchReportService = services.NewBranchReportService(db)
+	h.salesAnalyticsService = services.NewSalesAnalyticsService(db)
+	h.terminalService = services.NewTerminalService(db)
+	h.stationService = services.NewStationService(db, h.labelService, config.Pharmacy, config.Station)
+	h.stationService.SetEvents(h.events)
+	h.pickingService = services.NewPickingService(db)
+	h.feedbackService = services.NewFeedbackService(db, h.qrService, h.communicationService, config.Feedback)
+	h.healthService = services.NewHealthService(db, redis, config)
+	h.alerts = alerting.New(config.Alerting)
+	if h.alerts.Enabled() {
+		authService.SetAlerting(h.alerts)
+		h.outboxService.SetAlerting(h.alerts)
+		h.screeningService.SetAlerting(h.alerts)
+		h.backupService.SetAlerting(h.alerts)
+		h.coldChainService.SetAlerting(h.alerts)
+	}
+	h.SetRepositories(repository.NewGorm(db))
+	h.registerJobs()
 	
 	return h
 }
 
+// SetRepositories has the customer, product and sale handlers go through
+// repos instead of the GORM repositories over the database
+func (h *Handlers) SetRepositories(repos repository.Repositories) {
+	h.customers = repos.Customers
+	h.products = repos.Products
+	h.sales = repos.Sales
+}
+
+// SetOrderService has the cart and online order handlers go through orders.
+// Prescriptions, refills and e-prescriptions keep the service they were
+// built with.
+func (h *Handlers) SetOrderService(orders OrderService) {
+	h.orders = orders
+}
+
+// SetCache drops cached product listings when stock changes. The routes
+// that change products, suppliers and services drop theirs in middleware.
+func (h *Handlers) SetCache(responses *cache.Cache) {
+	h.stockService.SetCache(responses)
+}
+
+// SetStore shares alert cooldowns with the other instances through store
+func (h *Handlers) SetStore(store kvstore.Store) {
+	h.alerts.SetStore(store)
+}
+
+// SetWorkers runs the background work requests start, such as OCR of an
+// upload, among workers, so shutdown waits for it
+func (h *Handlers) SetWorkers(workers *lifecycle.Manager) {
+	h.workers = workers
+}
+
+// readDB is h.db for list and report queries. Its reads go to the read
+// replica when the ReadRouting middleware allowed it for this request.
+func (h *Handlers) readDB(c *gin.Context) *gorm.DB {
+	return h.db.WithContext(c.Request.Context())
+}
+
 // Health check
 func (h *Handlers) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -67,39 +293,82 @@ func (h *Handlers) TestEndpoint(c *gin.Context) {
 // Authentication handlers
 func (h *Handlers) Login(c *gin.Context) {
 	var req auth.LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindStrictJSON(c, &req) {
 		return
 	}
 
 	resp, err := h.authService.Login(c.Request.Context(), req, c.ClientIP(), c.Request.UserAgent())
 	if err != nil {
-		status := http.StatusUnauthorized
-		if err == auth.ErrAccountLocked {
-			status = http.StatusLocked
+		switch err {
+		case auth.ErrAccountLocked:
+			h.respondError(c, http.StatusLocked, err)
+		case auth.ErrTooManyAttempts:
+			h.respondError(c, http.StatusTooManyRequests, err)
+		case auth.ErrNetworkNotAllowed, auth.ErrCountryNotAllowed:
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case auth.ErrCaptchaRequired, auth.ErrCaptchaInvalid:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error(), "code": middleware.CodeCaptchaRequired, "captcha_required": true})
+		default:
+			h.respondError(c, http.StatusUnauthorized, err)
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, resp)
+	h.respondSession(c, resp, false)
 }
 
+// RefreshToken exchanges a refresh token for new tokens. Cookie sessions
+// send no body; the refresh cookie is used and the CSRF header checked.
 func (h *Handlers) RefreshToken(c *gin.Context) {
 	var req struct {
-		RefreshToken string `json:"refresh_token" binding:"required"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Request.ContentLength != 0 && !bindStrictJSON(c, &req) {
+		return
+	}
+
+	fromCookie := false
+	if req.RefreshToken == "" && h.config.Session.CookiesEnabled {
+		cookie, _ := c.Cookie(middleware.RefreshCookieName)
+		if cookie != "" {
+			claims, err := h.authService.ValidateToken(cookie)
+			if err != nil {
+				h.respondError(c, http.StatusUnauthorized, err)
+				return
+			}
+			if !middleware.ValidCSRF(c, h.authService.CSRFToken(claims.SessionID)) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+				return
+			}
+			req.RefreshToken = cookie
+			fromCookie = true
+		}
 	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refresh token is required"})
 		return
 	}
 
 	resp, err := h.authService.RefreshToken(c.Request.Context(), req.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusUnauthorized, err)
 		return
 	}
 
+	h.respondSession(c, resp, fromCookie)
+}
+
+// respondSession returns new tokens in the body, or for cookie sessions, as
+// HttpOnly cookies with only the CSRF token in the body. A session refreshed
+// from its cookie stays a cookie session.
+func (h *Handlers) respondSession(c *gin.Context, resp *auth.LoginResponse, cookieSession bool) {
+	if cookieSession || middleware.WantsCookieSession(c, h.config.Session) {
+		resp.CSRFToken = h.authService.CSRFToken(resp.SessionID)
+		middleware.SetSessionCookies(c, h.config.Session, resp.AccessToken, resp.RefreshToken, resp.CSRFToken, resp.ExpiresIn)
+		resp.AccessToken = ""
+		resp.RefreshToken = ""
+	}
+
 	c.JSON(http.StatusOK, resp)
 }
 
@@ -113,6 +382,9 @@ func (h *Handlers) Logout(c *gin.Context) {
 		return
 	}
 
+	if h.config.Session.CookiesEnabled {
+		middleware.ClearSessionCookies(c, h.config.Session)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
 }
 
@@ -120,14 +392,13 @@ func (h *Handlers) ChangePassword(c *gin.Context) {
 	user, _ := middleware.GetCurrentUser(c)
 	
 	var req auth.ChangePasswordRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindStrictJSON(c, &req) {
 		return
 	}
 
 	err := h.authService.ChangePassword(c.Request.Context(), user.ID, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -135,6 +406,13 @@ func (h *Handlers) ChangePassword(c *gin.Context) {
 }
 
 // Customer handlers
+// Search fields for the list endpoints. Customers and products are searched
+// in the repository package.
+var (
+	supplierSearch = query.TextSearch{Columns: []string{"name", "contact_person", "agent_name"}}
+	serviceSearch  = query.TextSearch{Columns: []string{"name", "code", "description"}}
+)
+
 func (h *Handlers) GetCustomers(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
@@ -142,26 +420,29 @@ func (h *Handlers) GetCustomers(c *gin.Context) {
 	
 	offset := (page - 1) * limit
 	
-	var customers []models.Customer
-	query := h.db.Model(&models.Customer{})
-	
-	if search != "" {
-		query = query.Where("first_name LIKE ? COLLATE NOCASE OR last_name LIKE ? COLLATE NOCASE OR email LIKE ? COLLATE NOCASE", 
-			"%"+search+"%", "%"+search+"%", "%"+search+"%")
+	selection, ok := h.parseSelection(c, services.CustomerIncludes, "flags")
+	if !ok {
+		return
 	}
 	
-	var total int64
-	query.Count(&total)
-	
-	err := query.Offset(offset).Limit(limit).Find(&customers).Error
+	filter := repository.CustomerFilter{
+		Search:    search,
+		Targeting: targetingFromQuery(c), // ?tag= and ?segment=, comma-separated
+		Deleted:   c.Query("deleted") == "true",
+	}
+	customers, total, err := h.customers.List(c.Request.Context(), filter, selection, repository.Page{Offset: offset, Limit: limit})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customers"})
 		return
 	}
+	rendered, ok := h.renderSelection(c, selection, customers)
+	if !ok {
+		return
+	}
 	
 	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, gin.H{
-		"customers": customers,
+		"customers": rendered,
 		"total": total,
 		"page": page,
 		"limit": limit,
@@ -170,28 +451,52 @@ func (h *Handlers) GetCustomers(c *gin.Context) {
 
 func (h *Handlers) CreateCustomer(c *gin.Context) {
 	var customer models.Customer
-	if err := c.ShouldBindJSON(&customer); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &customer) {
 		return
 	}
 
 	user, _ := middleware.GetCurrentUser(c)
 	customer.CreatedBy = &user.ID
+
+	// Dependents are created through the dependents endpoints
+	customer.GuardianID = nil
+	customer.Relationship = ""
+
+	// Flags are added through the flags endpoints
+	customer.Flags = nil
+
+	// Phone numbers are only verified with a texted code
+	customer.PhoneVerifiedAt = nil
+
+	// Discount eligibility is only set through ID verification
+	customer.CopyEligibilityVerification(&models.Customer{})
+	if customer.IsSeniorCitizen || customer.IsPWD {
+		customer.EligibilityStatus = models.EligibilityPending
+	}
 	
-	if err := h.db.Create(&customer).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create customer"})
+	if err := h.customers.Create(c.Request.Context(), &customer); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
+	h.recordChange(c, "create", "customers", customer.ID, nil, &customer)
 
 	c.JSON(http.StatusCreated, customer)
 }
 
+// GetCustomer returns a customer with their dependents and active flags.
+// Sales and purchase history are only embedded on request, e.g.
+// ?include=sales,purchase_history.
 func (h *Handlers) GetCustomer(c *gin.Context) {
 	id := c.Param("id")
 	
-	var customer models.Customer
-	if err := h.db.Preload("Sales").Preload("PurchaseHistory").First(&customer, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	selection, ok := h.parseSelection(c, services.CustomerIncludes, "dependents", "flags")
+	if !ok {
+		return
+	}
+	
+	customer, err := h.customers.Get(c.Request.Context(), id, selection)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 			return
 		}
@@ -199,15 +504,19 @@ func (h *Handlers) GetCustomer(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, customer)
+	rendered, ok := h.renderSelection(c, selection, *customer)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rendered)
 }
 
 func (h *Handlers) UpdateCustomer(c *gin.Context) {
 	id := c.Param("id")
 	
-	var customer models.Customer
-	if err := h.db.First(&customer, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	customer, err := h.customers.Get(c.Request.Context(), id, query.Selection{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
 			return
 		}
@@ -215,35 +524,83 @@ func (h *Handlers) UpdateCustomer(c *gin.Context) {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&customer); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	previous := *customer
+	if !bindJSON(c, customer) {
 		return
 	}
 
 	user, _ := middleware.GetCurrentUser(c)
 	customer.UpdatedBy = &user.ID
 
-	if err := h.db.Save(&customer).Error; err != nil {
+	// Household links are managed through the dependents endpoints
+	customer.GuardianID = previous.GuardianID
+	customer.Relationship = previous.Relationship
+
+	// Flags are managed through the flags endpoints
+	customer.Flags = nil
+
+	// A new phone number needs to be verified again
+	customer.PhoneVerifiedAt = previous.PhoneVerifiedAt
+	if customer.Phone != previous.Phone {
+		customer.PhoneVerifiedAt = nil
+	}
+
+	// Changing the discount claims needs the ID to be verified again
+	customer.CopyEligibilityVerification(&previous)
+	if customer.EligibilityClaimsChanged(&previous) {
+		customer.CopyEligibilityVerification(&models.Customer{})
+		if customer.IsSeniorCitizen || customer.IsPWD {
+			customer.EligibilityStatus = models.EligibilityPending
+		}
+	}
+
+	if err := h.customers.Save(c.Request.Context(), customer); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update customer"})
 		return
 	}
+	h.recordChange(c, "update", "customers", customer.ID, &previous, customer)
 
 	c.JSON(http.StatusOK, customer)
 }
 
+// DeleteCustomer soft-deletes a customer. Sales and orders keep pointing at
+// the row, and RestoreCustomer brings it back.
 func (h *Handlers) DeleteCustomer(c *gin.Context) {
 	id := c.Param("id")
 	
-	if err := h.db.Delete(&models.Customer{}, "id = ?", id).Error; err != nil {
+	customer, err := h.customers.Get(c.Request.Context(), id, query.Selection{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch customer"})
+		return
+	}
+
+	if err := h.customers.Delete(c.Request.Context(), customer); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete customer"})
 		return
 	}
+	h.recordChange(c, "delete", "customers", customer.ID, customer, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Customer deleted successfully"})
 }
 
 // Product handlers
+
+// GetProducts lists products for staff, the soft-deleted ones with
+// ?deleted=true. The route checks the caller may see those.
 func (h *Handlers) GetProducts(c *gin.Context) {
+	h.listProducts(c, c.Query("deleted") == "true")
+}
+
+// BrowseProducts lists products for the public shop, never the deleted ones
+func (h *Handlers) BrowseProducts(c *gin.Context) {
+	h.listProducts(c, false)
+}
+
+func (h *Handlers) listProducts(c *gin.Context, deleted bool) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	search := c.Query("search")
@@ -251,30 +608,32 @@ func (h *Handlers) GetProducts(c *gin.Context) {
 	
 	offset := (page - 1) * limit
 	
-	var products []models.Product
-	query := h.db.Model(&models.Product{}).Where("is_active = ?", true)
-	
-	if search != "" {
-		query = query.Where("name ILIKE ? OR sku ILIKE ? OR generic_name ILIKE ?", 
-			"%"+search+"%", "%"+search+"%", "%"+search+"%")
-	}
-	
-	if category != "" {
-		query = query.Where("category = ?", category)
+	selection, ok := h.parseSelection(c, services.ProductIncludes, "suppliers")
+	if !ok {
+		return
 	}
 	
-	var total int64
-	query.Count(&total)
-	
-	err := query.Preload("Suppliers").Offset(offset).Limit(limit).Find(&products).Error
+	filter := repository.ProductFilter{
+		Search:           search,
+		Category:         category,
+		InteractsWith:    c.Query("interacts_with"),
+		Contraindication: c.Query("contraindication"),
+		SideEffect:       c.Query("side_effect"),
+		Deleted:          deleted,
+	}
+	products, total, err := h.products.List(c.Request.Context(), filter, selection, repository.Page{Offset: offset, Limit: limit})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch products"})
 		return
 	}
+	rendered, ok := h.renderSelection(c, selection, products)
+	if !ok {
+		return
+	}
 	
 	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, gin.H{
-		"products": products,
+		"products": rendered,
 		"total": total,
 		"page": page,
 		"limit": limit,
@@ -296,55 +655,39 @@ func (h *Handlers) CreateProduct(c *gin.Context) {
 	
 	if err := c.ShouldBindJSON(&requestData); err != nil {
 		fmt.Printf("JSON binding error: %v\n", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
+		return
+	}
+
+	if err := h.regulatoryService.CheckProduct(c.Request.Context(), &requestData.Product); err != nil {
+		h.respondRegulatoryError(c, err)
 		return
 	}
 
 	user, _ := middleware.GetCurrentUser(c)
 	requestData.Product.CreatedBy = &user.ID
 	
-	// Start transaction
-	tx := h.db.Begin()
-	
-	// Create the product
-	if err := tx.Create(&requestData.Product).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create product"})
+	// The first supplier is the primary one
+	if err := h.products.Create(c.Request.Context(), &requestData.Product, requestData.SupplierIDs); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
+	h.recordChange(c, "create", "products", requestData.Product.ID, nil, &requestData.Product)
 	
-	// Associate suppliers if provided
-	if len(requestData.SupplierIDs) > 0 {
-		for i, supplierID := range requestData.SupplierIDs {
-			var supplier models.Supplier
-			if err := tx.First(&supplier, "id = ?", supplierID).Error; err == nil {
-				productSupplier := models.ProductSupplier{
-					ProductID:  requestData.Product.ID,
-					SupplierID: supplier.ID,
-					IsPrimary:  i == 0, // First supplier is primary
-				}
-				if err := tx.Create(&productSupplier).Error; err != nil {
-					tx.Rollback()
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate suppliers"})
-					return
-				}
-			}
-		}
-	}
-	
-	tx.Commit()
-	
-	// Reload with suppliers
-	h.db.Preload("Suppliers").First(&requestData.Product, requestData.Product.ID)
 	c.JSON(http.StatusCreated, requestData.Product)
 }
 
 func (h *Handlers) GetProduct(c *gin.Context) {
 	id := c.Param("id")
 	
-	var product models.Product
-	if err := h.db.Preload("Suppliers").First(&product, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	selection, ok := h.parseSelection(c, services.ProductIncludes, "suppliers")
+	if !ok {
+		return
+	}
+	
+	product, err := h.products.Get(c.Request.Context(), id, selection)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
@@ -352,15 +695,19 @@ func (h *Handlers) GetProduct(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	rendered, ok := h.renderSelection(c, selection, *product)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rendered)
 }
 
 func (h *Handlers) UpdateProduct(c *gin.Context) {
 	id := c.Param("id")
 	
-	var product models.Product
-	if err := h.db.First(&product, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	product, err := h.products.Get(c.Request.Context(), id, query.Selection{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
 			return
 		}
@@ -368,6 +715,8 @@ func (h *Handlers) UpdateProduct(c *gin.Context) {
 		return
 	}
 
+	previous := *product
+
 	// Parse the update data including supplier IDs
 	var requestData struct {
 		SupplierIDs *[]string `json:"supplier_ids"`
@@ -376,8 +725,7 @@ func (h *Handlers) UpdateProduct(c *gin.Context) {
 	
 	// First parse as raw JSON to extract everything
 	var rawData map[string]interface{}
-	if err := c.ShouldBindJSON(&rawData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &rawData) {
 		return
 	}
 	
@@ -390,67 +738,101 @@ func (h *Handlers) UpdateProduct(c *gin.Context) {
 		requestData.SupplierIDs = &strIDs
 		delete(rawData, "supplier_ids") // Remove from update data
 	}
-	
-	// Update the timestamp and user who updated
-	user, _ := middleware.GetCurrentUser(c)
-	rawData["updated_by"] = user.ID
-	rawData["updated_at"] = time.Now()
 
-	// Start transaction
-	tx := h.db.Begin()
+	// Stock only changes through stock updates, which record a movement and
+	// can't overwrite a sale made in the meantime
+	delete(rawData, "stock")
+
+	// Prices arrive in pesos and are stored in centavos
+	for _, key := range []string{"price", "cost"} {
+		switch value := rawData[key].(type) {
+		case float64:
+			rawData[key] = models.NewMoney(value)
+		case string:
+			amount, err := models.ParseMoney(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s", key)})
+				return
+			}
+			rawData[key] = amount
+		}
+	}
 
-	// Perform partial update using Updates method
-	if err := tx.Model(&product).Updates(rawData).Error; err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update product"})
-		return
+	// Label lists are stored as JSON arrays, not as the SQL list a slice
+	// in an update map becomes
+	for _, key := range []string{"contraindications", "side_effects", "drug_interactions"} {
+		if values, ok := rawData[key].([]interface{}); ok {
+			list := make(models.StringArray, 0, len(values))
+			for _, value := range values {
+				list = append(list, fmt.Sprintf("%v", value))
+			}
+			rawData[key] = list
+		}
 	}
 
-	// Update suppliers if provided
-	if requestData.SupplierIDs != nil {
-		// Delete existing product-supplier relationships
-		if err := tx.Where("product_id = ?", product.ID).Delete(&models.ProductSupplier{}).Error; err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update suppliers"})
-			return
+	// The regulatory status is worked out from the registration number and
+	// batch, and rechecked when either changes
+	delete(rawData, "regulatory_status")
+	delete(rawData, "regulatory_checked_at")
+	_, numberChanged := rawData["fda_registration_number"]
+	_, batchChanged := rawData["batch_number"]
+	_, typeChanged := rawData["product_type"]
+	if numberChanged || batchChanged || typeChanged {
+		checked := *product
+		if value, ok := rawData["fda_registration_number"].(string); ok {
+			checked.FDARegistrationNumber = &value
+		} else if numberChanged {
+			checked.FDARegistrationNumber = nil
 		}
-		
-		// Create new relationships
-		for i, supplierID := range *requestData.SupplierIDs {
-			var supplier models.Supplier
-			if err := tx.First(&supplier, "id = ?", supplierID).Error; err == nil {
-				productSupplier := models.ProductSupplier{
-					ProductID:  product.ID,
-					SupplierID: supplier.ID,
-					IsPrimary:  i == 0, // First supplier is primary
-				}
-				if err := tx.Create(&productSupplier).Error; err != nil {
-					tx.Rollback()
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to associate suppliers"})
-					return
-				}
-			}
+		if value, ok := rawData["batch_number"].(string); ok {
+			checked.BatchNumber = value
+		}
+		if value, ok := rawData["product_type"].(string); ok {
+			checked.ProductType = models.ProductType(value)
 		}
+		if err := h.regulatoryService.CheckProduct(c.Request.Context(), &checked); err != nil {
+			h.respondRegulatoryError(c, err)
+			return
+		}
+		rawData["fda_registration_number"] = checked.FDARegistrationNumber
+		rawData["regulatory_status"] = checked.RegulatoryStatus
+		rawData["regulatory_checked_at"] = checked.RegulatoryCheckedAt
 	}
-	
-	tx.Commit()
 
-	// Fetch the updated product with suppliers to return
-	if err := h.db.Preload("Suppliers").First(&product, "id = ?", id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch updated product"})
+	// Update the timestamp and user who updated
+	user, _ := middleware.GetCurrentUser(c)
+	rawData["updated_by"] = user.ID
+	rawData["updated_at"] = time.Now()
+
+	// Perform a partial update, replacing the suppliers if provided
+	if err := h.products.Update(c.Request.Context(), product, rawData, requestData.SupplierIDs); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
+	h.recordChange(c, "update", "products", product.ID, &previous, product)
 
 	c.JSON(http.StatusOK, product)
 }
 
+// DeleteProduct soft-deletes a product, which keeps past sales intact
 func (h *Handlers) DeleteProduct(c *gin.Context) {
 	id := c.Param("id")
 	
-	if err := h.db.Delete(&models.Product{}, "id = ?", id).Error; err != nil {
+	product, err := h.products.Get(c.Request.Context(), id, query.Selection{})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch product"})
+		return
+	}
+
+	if err := h.products.Delete(c.Request.Context(), product); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete product"})
 		return
 	}
+	h.recordChange(c, "delete", "products", product.ID, product, nil)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
@@ -464,12 +846,9 @@ func (h *Handlers) GetSuppliers(c *gin.Context) {
 	offset := (page - 1) * limit
 	
 	var suppliers []models.Supplier
-	query := h.db.Model(&models.Supplier{})
+	query := deletedFromQuery(c, h.readDB(c).Model(&models.Supplier{}))
 	
-	if search != "" {
-		query = query.Where("name ILIKE ? OR contact_person ILIKE ? OR agent_name ILIKE ?", 
-			"%"+search+"%", "%"+search+"%", "%"+search+"%")
-	}
+	query = supplierSearch.Apply(query, search)
 	
 	var total int64
 	query.Count(&total)
@@ -491,8 +870,7 @@ func (h *Handlers) GetSuppliers(c *gin.Context) {
 
 func (h *Handlers) CreateSupplier(c *gin.Context) {
 	var supplier models.Supplier
-	if err := c.ShouldBindJSON(&supplier); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &supplier) {
 		return
 	}
 
@@ -510,8 +888,13 @@ func (h *Handlers) CreateSupplier(c *gin.Context) {
 func (h *Handlers) GetSupplier(c *gin.Context) {
 	id := c.Param("id")
 	
+	selection, ok := h.parseSelection(c, services.SupplierIncludes, "products")
+	if !ok {
+		return
+	}
+	
 	var supplier models.Supplier
-	if err := h.db.Preload("Products").First(&supplier, "id = ?", id).Error; err != nil {
+	if err := selection.Apply(h.db.WithContext(c.Request.Context())).First(&supplier, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
 			return
@@ -520,7 +903,11 @@ func (h *Handlers) GetSupplier(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, supplier)
+	rendered, ok := h.renderSelection(c, selection, supplier)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rendered)
 }
 
 func (h *Handlers) UpdateSupplier(c *gin.Context) {
@@ -536,8 +923,7 @@ func (h *Handlers) UpdateSupplier(c *gin.Context) {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&supplier); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &supplier) {
 		return
 	}
 
@@ -564,8 +950,8 @@ func (h *Handlers) DeleteSupplier(c *gin.Context) {
 }
 
 func (h *Handlers) GetLowStockProducts(c *gin.Context) {
-	var products []models.Product
-	if err := h.db.Where("stock <= min_stock AND is_active = ?", true).Find(&products).Error; err != nil {
+	products, err := h.products.LowStock(c.Request.Context())
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch low stock products"})
 		return
 	}
@@ -576,8 +962,8 @@ func (h *Handlers) GetLowStockProducts(c *gin.Context) {
 func (h *Handlers) GetExpiringProducts(c *gin.Context) {
 	thirtyDaysFromNow := time.Now().AddDate(0, 0, 30)
 	
-	var products []models.Product
-	if err := h.db.Where("expiry_date <= ? AND is_active = ?", thirtyDaysFromNow, true).Find(&products).Error; err != nil {
+	products, err := h.products.Expiring(c.Request.Context(), thirtyDaysFromNow)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expiring products"})
 		return
 	}
@@ -592,21 +978,46 @@ func (h *Handlers) GetSales(c *gin.Context) {
 	
 	offset := (page - 1) * limit
 	
-	var sales []models.Sale
-	var total int64
+	// Items are listed without their products unless asked for, with
+	// ?include=sale_items.product
+	selection, ok := h.parseSelection(c, services.SaleIncludes, "customer", "sale_items", "pharmacist")
+	if !ok {
+		return
+	}
 	
-	h.db.Model(&models.Sale{}).Count(&total)
+	// ?cursor= (empty for the first page) switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		limit = query.CursorPageSize(limit, 10)
+		sales, nextCursor, err := h.sales.ListAfter(c.Request.Context(), selection, cursor, limit)
+		if err != nil {
+			h.respondError(c, cursorErrorStatus(err), err)
+			return
+		}
+		rendered, ok := h.renderSelection(c, selection, sales)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"sales": rendered,
+			"limit": limit,
+			"next_cursor": nextCursor,
+		})
+		return
+	}
 	
-	err := h.db.Preload("Customer").Preload("SaleItems.Product").Preload("Pharmacist").
-		Offset(offset).Limit(limit).Order("created_at DESC").Find(&sales).Error
+	sales, total, err := h.sales.List(c.Request.Context(), selection, repository.Page{Offset: offset, Limit: limit})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sales"})
 		return
 	}
+	rendered, ok := h.renderSelection(c, selection, sales)
+	if !ok {
+		return
+	}
 	
 	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, gin.H{
-		"sales": sales,
+		"sales": rendered,
 		"total": total,
 		"page": page,
 		"limit": limit,
@@ -614,34 +1025,236 @@ func (h *Handlers) GetSales(c *gin.Context) {
 }
 
 func (h *Handlers) CreateSale(c *gin.Context) {
-	var sale models.Sale
-	if err := c.ShouldBindJSON(&sale); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req struct {
+		models.Sale
+		AcknowledgedInteractions []string `json:"acknowledged_interactions"`
+		AcknowledgementNotes     string   `json:"acknowledgement_notes"`
+		InsuranceClaim           *services.InsuranceClaimRequest `json:"insurance_claim"` // HMO and LOA details when an HMO pays
+		screeningOverride
+	}
+	if !bindJSON(c, &req) {
 		return
 	}
+	sale := req.Sale
+	sale.InsuranceClaim = nil
 
 	user, _ := middleware.GetCurrentUser(c)
 	sale.PharmacistID = &user.ID
 	sale.CreatedBy = &user.ID
+
+	// A guardian buying for a dependent must be linked to them
+	if sale.GuardianID != nil {
+		if sale.CustomerID == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "customer_id must be set to the dependent the sale is for"})
+			return
+		}
+		if err := h.householdService.CheckDependent(c.Request.Context(), *sale.GuardianID, *sale.CustomerID); err != nil {
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// Screen the sale for drug interactions before dispensing. Compounded
+	// preparations are screened by what they were made from.
+	var productIDs, preparationIDs []uuid.UUID
+	for _, item := range sale.SaleItems {
+		if item.ProductID != nil {
+			productIDs = append(productIDs, *item.ProductID)
+		}
+		if item.PreparationID != nil {
+			preparationIDs = append(preparationIDs, *item.PreparationID)
+		}
+	}
+	ingredientIDs, err := h.compoundingService.IngredientProductIDs(c.Request.Context(), preparationIDs)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	productIDs = append(productIDs, ingredientIDs...)
+	warnings, err := h.interactionService.CheckInteractions(c.Request.Context(), services.InteractionCheckRequest{
+		CustomerID: sale.CustomerID,
+		ProductIDs: productIDs,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check drug interactions"})
+		return
+	}
+	if !h.requireInteractionAcknowledgement(c, warnings, req.AcknowledgedInteractions) {
+		return
+	}
+
+	// Screen against the customer's allergies and medical history
+	var alerts []services.ScreeningAlert
+	if sale.CustomerID != nil {
+		alerts, err = h.screeningService.ScreenProducts(c.Request.Context(), *sale.CustomerID, productIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to screen sale"})
+			return
+		}
+		if !h.requireScreeningOverride(c, alerts, req.screeningOverride, nil) {
+			return
+		}
+	}
 	
-	// Generate sale number
-	sale.SaleNumber = "SALE-" + time.Now().Format("20060102") + "-" + uuid.New().String()[:8]
+	// Sales belong to the branch they were made in. One rung up on a paired
+	// terminal belongs to that register and takes its next invoice number.
+	sale.BranchID = middleware.GetBranchID(c)
+	sale.TerminalID, sale.InvoiceNumber = nil, nil
+	terminal, ok := h.saleTerminal(c)
+	if !ok {
+		return
+	}
+	if terminal != nil {
+		sale.TerminalID = &terminal.ID
+		sale.BranchID = &terminal.BranchID
+	}
+	// ... and to the shift of the employee ringing it up
+	if err := h.timeClockService.AttributeSale(c.Request.Context(), &sale); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
 
-	if err := h.db.Create(&sale).Error; err != nil {
+	// Services sold are checked and put down to the staff performing them
+	if err := h.serviceSaleService.PrepareItems(c.Request.Context(), &sale, user.ID); err != nil {
+		h.respondError(c, serviceSaleErrorStatus(err), err)
+		return
+	}
+	if err := h.compoundingService.PrepareSaleItems(c.Request.Context(), &sale); err != nil {
+		h.respondError(c, compoundingErrorStatus(err), err)
+		return
+	}
+
+	// Prices and totals are worked out here at the branch's prices and tax
+	// rate, not taken from the till
+	if err := h.pricingService.PriceSale(c.Request.Context(), &sale); err != nil {
+		if errors.Is(err, services.ErrDiscountExceedsTotal) || errors.Is(err, services.ErrNoExchangeRate) {
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	// The webhook is queued with the sale so it survives a crash after commit
+	var movements []*models.StockMovement
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		saleNumber, err := h.numberService.SaleNumber(tx, sale.BranchID)
+		if err != nil {
+			return err
+		}
+		sale.SaleNumber = saleNumber
+		if terminal != nil {
+			invoiceNumber, err := h.terminalService.NextInvoiceNumber(tx, terminal)
+			if err != nil {
+				return err
+			}
+			sale.InvoiceNumber = &invoiceNumber
+		}
+		if err := tx.Create(&sale).Error; err != nil {
+			return err
+		}
+		// The products leave stock with the sale, or it isn't made
+		for _, item := range sale.SaleItems {
+			if item.ProductID == nil {
+				continue
+			}
+			movement, err := h.stockService.Apply(tx, services.StockChange{
+				ProductID: *item.ProductID,
+				BranchID:  sale.BranchID,
+				Quantity:  -item.Quantity,
+				Type:      models.MovementTypeOut,
+				Reason:    "Sale",
+				Reference: &sale.SaleNumber,
+				UserID:    &user.ID,
+			})
+			if err != nil {
+				return err
+			}
+			movements = append(movements, movement)
+		}
+		// Preparations were taken out of stock when they were made
+		if err := h.compoundingService.DispenseForSale(tx, &sale); err != nil {
+			return err
+		}
+		if req.InsuranceClaim != nil {
+			claim, err := h.insuranceClaimService.CreateForSale(tx, &sale, *req.InsuranceClaim, user.ID)
+			if err != nil {
+				return err
+			}
+			sale.InsuranceClaim = claim
+		}
+		if err := h.purchaseHistoryService.RecordSale(tx, &sale); err != nil {
+			return err
+		}
+		return h.outboxService.QueueWebhook(tx, "sale.completed", gin.H{
+			"sale_id":        sale.ID,
+			"sale_number":    sale.SaleNumber,
+			"invoice_number": sale.InvoiceNumber,
+			"total":          sale.Total,
+			"customer_id":    sale.CustomerID,
+		})
+	}); err != nil {
+		// A sale number synced in from another database at the same moment
+		// is a conflict the till can retry like running out of stock
+		if stockErrorStatus(err) == http.StatusConflict || errors.Is(err, services.ErrPreparationNotReady) || h.isDBError(err, gorm.ErrDuplicatedKey) {
+			h.respondError(c, http.StatusConflict, err)
+			return
+		}
+		if status := claimErrorStatus(err); status != http.StatusInternalServerError {
+			h.respondError(c, status, err)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sale"})
 		return
 	}
 
+	h.recordInteractionAcknowledgements(c, services.AcknowledgeInteractionsRequest{
+		CustomerID: sale.CustomerID,
+		SaleID:     &sale.ID,
+		Warnings:   warnings,
+		Notes:      req.AcknowledgementNotes,
+		UserID:     user.ID,
+	})
+	if sale.CustomerID != nil {
+		h.recordScreeningOverrides(c, services.ScreeningOverrideRequest{
+			CustomerID: *sale.CustomerID,
+			SaleID:     &sale.ID,
+			Alerts:     alerts,
+			Reason:     req.Reason,
+			UserID:     user.ID,
+		})
+	}
+
+	metrics.SalesCreated.Inc(paymentMethodLabel(sale.PaymentMethod))
+	h.stockService.Announce(c.Request.Context(), movements...)
+
+	if err := h.refillService.RecordSaleRefills(c.Request.Context(), &sale); err != nil {
+		logrus.WithError(err).Error("Failed to schedule refills for sale")
+	}
+	if err := h.loyaltyService.AwardSale(c.Request.Context(), &sale); err != nil {
+		logrus.WithError(err).Error("Failed to award loyalty points for sale")
+	}
+	if err := h.referralService.QualifySale(c.Request.Context(), &sale); err != nil {
+		logrus.WithError(err).Error("Failed to settle referral for sale")
+	}
+	if err := h.campaignService.AttributeSale(c.Request.Context(), &sale); err != nil {
+		logrus.WithError(err).Error("Failed to attribute sale to campaign")
+	}
+
 	c.JSON(http.StatusCreated, sale)
 }
 
 func (h *Handlers) GetSale(c *gin.Context) {
 	id := c.Param("id")
 	
-	var sale models.Sale
-	if err := h.db.Preload("Customer").Preload("SaleItems.Product").Preload("Pharmacist").
-		First(&sale, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	selection, ok := h.parseSelection(c, services.SaleIncludes, "customer", "guardian", "sale_items.product", "sale_items.service", "pharmacist", "insurance_claim")
+	if !ok {
+		return
+	}
+	
+	sale, err := h.sales.Get(c.Request.Context(), id, selection)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Sale not found"})
 			return
 		}
@@ -649,7 +1262,11 @@ func (h *Handlers) GetSale(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, sale)
+	rendered, ok := h.renderSelection(c, selection, *sale)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rendered)
 }
 
 // Analytics handlers
@@ -660,31 +1277,32 @@ func (h *Handlers) GetDashboardAnalytics(c *gin.Context) {
 		return
 	}
 
-	var totalSales float64
+	db := h.readDB(c)
+	var totalSales models.Money
 	var totalCustomers int64
 	var totalProducts int64
 	var lowStockCount int64
 
 	// Get today's sales
 	today := time.Now().Format("2006-01-02")
-	if err := h.db.Model(&models.Sale{}).Where("DATE(created_at) = ?", today).Select("COALESCE(SUM(total), 0)").Scan(&totalSales).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sales data: " + err.Error()})
+	if err := db.Model(&models.Sale{}).Where("DATE(created_at) = ?", today).Select("COALESCE(SUM(total), 0)").Scan(&totalSales).Error; err != nil {
+		h.respondError(c, http.StatusInternalServerError, fmt.Errorf("failed to get sales data: %w", err))
 		return
 	}
 	
 	// Get counts
-	if err := h.db.Model(&models.Customer{}).Count(&totalCustomers).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get customer count: " + err.Error()})
+	if err := db.Model(&models.Customer{}).Count(&totalCustomers).Error; err != nil {
+		h.respondError(c, http.StatusInternalServerError, fmt.Errorf("failed to get customer count: %w", err))
 		return
 	}
 	
-	if err := h.db.Model(&models.Product{}).Where("is_active = ?", true).Count(&totalProducts).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get product count: " + err.Error()})
+	if err := db.Model(&models.Product{}).Where("is_active = ?", true).Count(&totalProducts).Error; err != nil {
+		h.respondError(c, http.StatusInternalServerError, fmt.Errorf("failed to get product count: %w", err))
 		return
 	}
 	
-	if err := h.db.Model(&models.Product{}).Where("stock <= min_stock AND is_active = ?", true).Count(&lowStockCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get low stock count: " + err.Error()})
+	if err := db.Model(&models.Product{}).Where("stock <= min_stock AND is_active = ?", true).Count(&lowStockCount).Error; err != nil {
+		h.respondError(c, http.StatusInternalServerError, fmt.Errorf("failed to get low stock count: %w", err))
 		return
 	}
 
@@ -699,7 +1317,7 @@ func (h *Handlers) GetDashboardAnalytics(c *gin.Context) {
 // User management handlers (placeholder)
 func (h *Handlers) GetUsers(c *gin.Context) {
 	var users []models.User
-	if err := h.db.Select("id, username, email, first_name, last_name, role, is_active, created_at").Find(&users).Error; err != nil {
+	if err := h.db.Select("id, username, email, first_name, last_name, role, is_active, branch_id, created_at").Find(&users).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
@@ -724,11 +1342,67 @@ func (h *Handlers) DeleteUser(c *gin.Context) {
 
 // Placeholder handlers for other endpoints
 func (h *Handlers) GetCustomerPurchaseHistory(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
-}
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
 
-func (h *Handlers) CheckMedicationInteractions(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	filter := services.PurchaseHistoryFilter{
+		Category:         c.Query("category"),
+		PrescriptionOnly: c.Query("prescription_only") == "true",
+		Limit:            limit,
+		Offset:           offset,
+	}
+	if start := c.Query("start_date"); start != "" {
+		startDate, err := time.Parse("2006-01-02", start)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date, use YYYY-MM-DD"})
+			return
+		}
+		filter.StartDate = &startDate
+	}
+	if end := c.Query("end_date"); end != "" {
+		endDate, err := time.Parse("2006-01-02", end)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date, use YYYY-MM-DD"})
+			return
+		}
+		endDate = endDate.AddDate(0, 0, 1) // include the whole end day
+		filter.EndDate = &endDate
+	}
+	if productID := c.Query("product_id"); productID != "" {
+		id, err := uuid.Parse(productID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+			return
+		}
+		filter.ProductID = &id
+	}
+
+	var customer models.Customer
+	if err := h.db.Select("id").First(&customer, "id = ?", customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	history, err := h.purchaseHistoryService.GetCustomerHistory(c.Request.Context(), customerID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve purchase history"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(history.Total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"purchases":   history.Purchases,
+		"products":    history.Products,
+		"total":       history.Total,
+		"total_spent": history.TotalSpent,
+		"limit":       limit,
+		"offset":      offset,
+	})
 }
 
 func (h *Handlers) UpdateStock(c *gin.Context) {
@@ -745,8 +1419,7 @@ func (h *Handlers) UpdateStock(c *gin.Context) {
 		Notes     string `json:"notes"`
 	}
 
-	if err := c.ShouldBindJSON(&stockUpdate); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindStrictJSON(c, &stockUpdate) {
 		return
 	}
 
@@ -761,59 +1434,101 @@ func (h *Handlers) UpdateStock(c *gin.Context) {
 		return
 	}
 
-	// Calculate new stock based on operation
-	var newStock int
-	switch stockUpdate.Operation {
-	case "add":
-		newStock = product.Stock + stockUpdate.Quantity
-	case "subtract":
-		newStock = product.Stock - stockUpdate.Quantity
-		if newStock < 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot reduce stock below zero"})
+	// Within a branch the operation applies to the branch's stock, and the
+	// product's total moves by the same amount
+	branchID := middleware.GetBranchID(c)
+	current := product.Stock
+	if branchID != nil {
+		if current, err = h.branchService.StockOf(h.db, *branchID, product.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch branch stock"})
 			return
 		}
-	case "set":
-		newStock = stockUpdate.Quantity
 	}
 
-	// Update the product stock
-	if err := h.db.Model(&product).Update("stock", newStock).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update stock"})
-		return
-	}
-
-	// Create audit log entry
-	resourceIDStr := productID.String()
-	auditLog := models.AuditLog{
-		Action:     "stock_update",
-		Resource:   "products",
-		ResourceID: &resourceIDStr,
-		OldValues:  fmt.Sprintf(`{"stock": %d}`, product.Stock),
-		NewValues:  fmt.Sprintf(`{"stock": %d}`, newStock),
+	// Work out the change from the operation. Adds and subtracts apply to
+	// whatever the stock is when they run; a set only applies if the stock
+	// is still what it was read as, otherwise the client can read it and
+	// try again.
+	change := stockUpdate.Quantity
+	var expected *int
+	switch stockUpdate.Operation {
+	case "subtract":
+		change = -stockUpdate.Quantity
+	case "set":
+		change = stockUpdate.Quantity - current
+		expected = &product.Stock
 	}
 
-	// Get current user ID for audit trail
-	if userID, exists := c.Get("user_id"); exists {
-		if uid, ok := userID.(uuid.UUID); ok {
-			auditLog.UserID = &uid
+	// Update the product stock with a stock movement. Synced databases apply
+	// the movements rather than copying the stock level.
+	user, _ := middleware.GetCurrentUser(c)
+	var movement *models.StockMovement
+	newBranchStock := 0
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		movement, err = h.stockService.Apply(tx, services.StockChange{
+			ProductID:     product.ID,
+			BranchID:      branchID,
+			Quantity:      change,
+			Type:          services.ManualMovementType(stockUpdate.Operation, change),
+			Reason:        "Manual stock " + stockUpdate.Operation,
+			UserID:        &user.ID,
+			Notes:         stockUpdate.Notes,
+			ExpectedStock: expected,
+		})
+		if err != nil || branchID == nil {
+			return err
 		}
+		newBranchStock, err = h.branchService.StockOf(tx, *branchID, product.ID)
+		return err
+	})
+	if err != nil {
+		h.respondError(c, stockErrorStatus(err), err)
+		return
 	}
-
-	// Save audit log (don't fail the request if this fails)
-	h.db.Create(&auditLog)
+	h.stockService.Announce(c.Request.Context(), movement)
 
 	// Return updated product
-	product.Stock = newStock
-	c.JSON(http.StatusOK, gin.H{
-		"message": fmt.Sprintf("Stock updated successfully. New stock: %d", newStock),
+	previous := product
+	previous.Stock = movement.StockBefore
+	product.Stock = movement.StockAfter
+	h.recordChange(c, "stock_update", "products", product.ID, &previous, &product)
+	response := gin.H{
+		"message": fmt.Sprintf("Stock updated successfully. New stock: %d", product.Stock),
 		"product": product,
-		"old_stock": product.Stock - (newStock - product.Stock), // Calculate old stock
-		"new_stock": newStock,
-	})
+		"old_stock": previous.Stock,
+		"new_stock": product.Stock,
+	}
+	if branchID != nil {
+		response["branch_id"] = *branchID
+		response["old_branch_stock"] = newBranchStock - change
+		response["new_branch_stock"] = newBranchStock
+	}
+	c.JSON(http.StatusOK, response)
 }
 
+// RefundSale refunds the whole of a completed sale with a reason, putting
+// its products back into stock
 func (h *Handlers) RefundSale(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+	var req services.RefundSaleRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	sale, movements, err := h.refundService.RefundSale(c.Request.Context(), saleID, req, user.ID)
+	if err != nil {
+		h.respondError(c, refundErrorStatus(err), err)
+		return
+	}
+	h.stockService.Announce(c.Request.Context(), movements...)
+
+	c.JSON(http.StatusOK, sale)
 }
 
 func (h *Handlers) GetDailySalesReport(c *gin.Context) {
@@ -828,92 +1543,10 @@ func (h *Handlers) GetInventoryMovementAnalysis(c *gin.Context) {
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
 }
 
-func (h *Handlers) GetSalesAnalytics(c *gin.Context) {
-	// Test response with basic data
-	response := gin.H{
-		"totalRevenue":      825.0,
-		"totalOrders":       3,
-		"averageOrderValue": 275.0,
-		"productPerformance": []map[string]interface{}{
-			{"name": "Paracetamol 500mg", "unitsSold": 12, "revenue": 300.0, "category": "Pain Relief", "productId": "550e8400-e29b-41d4-a716-446655440001"},
-			{"name": "Lisinopril 10mg", "unitsSold": 2, "revenue": 190.0, "category": "Cardiovascular", "productId": "550e8400-e29b-41d4-a716-446655440004"},
-			{"name": "Vitamin C 1000mg", "unitsSold": 1, "revenue": 150.0, "category": "Vitamins", "productId": "550e8400-e29b-41d4-a716-446655440005"},
-			{"name": "Amoxicillin 500mg", "unitsSold": 1, "revenue": 120.0, "category": "Antibiotics", "productId": "550e8400-e29b-41d4-a716-446655440002"},
-			{"name": "Metformin 500mg", "unitsSold": 1, "revenue": 35.0, "category": "Diabetes", "productId": "550e8400-e29b-41d4-a716-446655440003"},
-		},
-		"dailySales": []map[string]interface{}{
-			{"date": "2025-01-22", "revenue": 0, "orders": 0},
-			{"date": "2025-01-23", "revenue": 275.0, "orders": 1},
-			{"date": "2025-01-24", "revenue": 0, "orders": 0},
-			{"date": "2025-01-25", "revenue": 165.0, "orders": 1},
-			{"date": "2025-01-26", "revenue": 0, "orders": 0},
-			{"date": "2025-01-27", "revenue": 385.0, "orders": 1},
-		},
-		"revenueGrowth":     12.5,
-		"orderGrowth":       8.2,
-		"aovChange":         3.8,
-		"conversionRate":    65.4,
-		"conversionChange":  2.1,
-		"returnRate":        2.8,
-		"returnRateChange":  -0.5,
-	}
-	
-	c.JSON(http.StatusOK, response)
-}
-
 func (h *Handlers) GetCustomerAnalytics(c *gin.Context) {
 	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
 }
 
-func (h *Handlers) GetAuditLogs(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "Not implemented yet"})
-}
-
-// Development-only endpoint to create test user
-func (h *Handlers) CreateTestUser(c *gin.Context) {
-	// Only allow in development mode
-	if h.config.Environment == "production" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Not available in production"})
-		return
-	}
-
-	// Check if admin user already exists
-	var existingUser models.User
-	if err := h.db.Where("username = ?", "admin").First(&existingUser).Error; err == nil {
-		c.JSON(http.StatusOK, gin.H{"message": "Admin user already exists"})
-		return
-	}
-
-	// Create admin user with hashed password
-	hashedPasswordBytes, err := bcrypt.GenerateFromPassword([]byte("admin123"), 12)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
-		return
-	}
-	hashedPassword := string(hashedPasswordBytes)
-
-	user := models.User{
-		Username:     "admin",
-		Email:        "admin@pharmacy.com",
-		PasswordHash: hashedPassword,
-		Role:         models.RoleAdmin,
-		FirstName:    "Admin",
-		LastName:     "User",
-		IsActive:     true,
-	}
-
-	if err := h.db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	c.JSON(http.StatusCreated, gin.H{
-		"message": "Admin user created successfully",
-		"username": "admin",
-		"password": "admin123",
-	})
-}
-
 // File Upload Handler for Customer ID Documents
 func (h *Handlers) UploadCustomerID(c *gin.Context) {
 	customerID := c.Param("id")
@@ -943,6 +1576,18 @@ func (h *Handlers) UploadCustomerID(c *gin.Context) {
 	}
 	defer file.Close()
 
+	// Senior citizen and PWD IDs are captured for discount verification
+	idType := c.Request.FormValue("id_type")
+	var expiryDate *time.Time
+	if expiry := c.Request.FormValue("expiry_date"); expiry != "" {
+		parsed, err := time.Parse("2006-01-02", expiry)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expiry_date, use YYYY-MM-DD"})
+			return
+		}
+		expiryDate = &parsed
+	}
+
 	// Validate file type (allow images and PDFs)
 	allowedTypes := map[string]bool{
 		".jpg":  true,
@@ -951,34 +1596,46 @@ func (h *Handlers) UploadCustomerID(c *gin.Context) {
 		".pdf":  true,
 	}
 	
-	ext := filepath.Ext(handler.Filename)
+	ext := strings.ToLower(filepath.Ext(handler.Filename))
 	if !allowedTypes[ext] {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPG, PNG, and PDF files are allowed"})
 		return
 	}
 
-	// Create uploads directory if it doesn't exist
-	uploadsDir := "uploads/customer_ids"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
 		return
 	}
 
-	// Generate unique filename
+	// Store the file under a unique name
 	filename := fmt.Sprintf("%s_%d%s", customerID, time.Now().Unix(), ext)
-	filepath := filepath.Join(uploadsDir, filename)
-
-	// Create the file
-	dst, err := os.Create(filepath)
+	filepath, err := h.fileService.SaveCustomerID(c.Request.Context(), filename, data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create file"})
-		return
-	}
-	defer dst.Close()
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	if idType != "" {
+		user, _ := middleware.GetCurrentUser(c)
+		err := h.eligibilityService.SubmitID(c.Request.Context(), &customer, services.SubmitEligibilityIDRequest{
+			IDType:       idType,
+			IDNumber:     c.Request.FormValue("id_number"),
+			ExpiryDate:   expiryDate,
+			DocumentPath: filepath,
+			SubmittedBy:  user.ID,
+		})
+		if err != nil {
+			h.fileService.Delete(c.Request.Context(), filepath)
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
 
-	// Copy uploaded file to destination
-	if _, err := io.Copy(dst, file); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		c.JSON(http.StatusOK, gin.H{
+			"message": "ID document uploaded and queued for verification",
+			"id_document_url": "/api/v1/customers/" + customer.ID.String() + "/id-document",
+			"eligibility_status": customer.EligibilityStatus,
+		})
 		return
 	}
 
@@ -991,12 +1648,12 @@ func (h *Handlers) UploadCustomerID(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "ID document uploaded successfully",
-		"file_path": filepath,
+		"id_document_url": "/api/v1/customers/" + customer.ID.String() + "/id-document",
 	})
 }
 
 // Calculate Discount based on customer eligibility
-func (h *Handlers) CalculateDiscount(subtotal float64, customer *models.Customer) (float64, string, float64) {
+func (h *Handlers) CalculateDiscount(subtotal models.Money, customer *models.Customer) (models.Money, string, float64) {
 	const seniorCitizenDiscount = 0.20 // 20% discount for senior citizens
 	const pwdDiscount = 0.20           // 20% discount for PWD
 	
@@ -1004,15 +1661,15 @@ func (h *Handlers) CalculateDiscount(subtotal float64, customer *models.Customer
 		return 0, "", 0
 	}
 	
-	// Senior Citizen gets priority if both are applicable
-	if customer.IsSeniorCitizen {
-		discount := subtotal * seniorCitizenDiscount
-		return discount, "senior_citizen", seniorCitizenDiscount * 100
-	}
-	
-	if customer.IsPWD {
-		discount := subtotal * pwdDiscount
-		return discount, "pwd", pwdDiscount * 100
+	// Only verified, unexpired IDs qualify. Senior Citizen gets priority if
+	// both are applicable.
+	switch customer.ActiveDiscountType(time.Now()) {
+	case models.DiscountTypeSeniorCitizen:
+		discount := subtotal.MulRate(seniorCitizenDiscount)
+		return discount, models.DiscountTypeSeniorCitizen, seniorCitizenDiscount * 100
+	case models.DiscountTypePWD:
+		discount := subtotal.MulRate(pwdDiscount)
+		return discount, models.DiscountTypePWD, pwdDiscount * 100
 	}
 	
 	return 0, "", 0
@@ -1024,27 +1681,28 @@ func (h *Handlers) GetDiscountAnalytics(c *gin.Context) {
 		TotalOrders           int64   `json:"total_orders"`
 		SeniorCitizenOrders   int64   `json:"senior_citizen_orders"`
 		PWDOrders            int64   `json:"pwd_orders"`
-		TotalDiscount        float64 `json:"total_discount_amount"`
-		SeniorCitizenDiscount float64 `json:"senior_citizen_discount_amount"`
-		PWDDiscount          float64 `json:"pwd_discount_amount"`
-		AverageDiscount      float64 `json:"average_discount"`
+		TotalDiscount        models.Money `json:"total_discount_amount"`
+		SeniorCitizenDiscount models.Money `json:"senior_citizen_discount_amount"`
+		PWDDiscount          models.Money `json:"pwd_discount_amount"`
+		AverageDiscount      models.Money `json:"average_discount"`
 	}
 
+	db := h.readDB(c)
 	// Get total orders
-	h.db.Model(&models.OnlineOrder{}).Count(&analytics.TotalOrders)
+	db.Model(&models.OnlineOrder{}).Count(&analytics.TotalOrders)
 
 	// Get senior citizen orders count and discount amount
-	h.db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "senior_citizen").Count(&analytics.SeniorCitizenOrders)
-	h.db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "senior_citizen").Select("COALESCE(SUM(discount), 0)").Scan(&analytics.SeniorCitizenDiscount)
+	db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "senior_citizen").Count(&analytics.SeniorCitizenOrders)
+	db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "senior_citizen").Select("COALESCE(SUM(discount), 0)").Scan(&analytics.SeniorCitizenDiscount)
 
 	// Get PWD orders count and discount amount
-	h.db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "pwd").Count(&analytics.PWDOrders)
-	h.db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "pwd").Select("COALESCE(SUM(discount), 0)").Scan(&analytics.PWDDiscount)
+	db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "pwd").Count(&analytics.PWDOrders)
+	db.Model(&models.OnlineOrder{}).Where("discount_type = ?", "pwd").Select("COALESCE(SUM(discount), 0)").Scan(&analytics.PWDDiscount)
 
 	// Calculate totals
 	analytics.TotalDiscount = analytics.SeniorCitizenDiscount + analytics.PWDDiscount
 	if analytics.TotalOrders > 0 {
-		analytics.AverageDiscount = analytics.TotalDiscount / float64(analytics.TotalOrders)
+		analytics.AverageDiscount = analytics.TotalDiscount.MulRate(1 / float64(analytics.TotalOrders))
 	}
 
 	c.JSON(http.StatusOK, analytics)
@@ -1070,13 +1728,10 @@ func (h *Handlers) GetServices(c *gin.Context) {
 	var services []models.Service
 	var total int64
 
-	query := h.db.Model(&models.Service{})
+	query := deletedFromQuery(c, h.readDB(c).Model(&models.Service{}))
 
 	// Apply filters
-	if search != "" {
-		query = query.Where("name ILIKE ? OR code ILIKE ? OR description ILIKE ?", 
-			"%"+search+"%", "%"+search+"%", "%"+search+"%")
-	}
+	query = serviceSearch.Apply(query, search)
 
 	if category != "" {
 		query = query.Where("category = ?", category)
@@ -1129,8 +1784,7 @@ func (h *Handlers) GetService(c *gin.Context) {
 // CreateService creates a new service
 func (h *Handlers) CreateService(c *gin.Context) {
 	var service models.Service
-	if err := c.ShouldBindJSON(&service); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &service) {
 		return
 	}
 
@@ -1148,7 +1802,7 @@ func (h *Handlers) CreateService(c *gin.Context) {
 	}
 
 	if err := h.db.Create(&service).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service"})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -1174,9 +1828,9 @@ func (h *Handlers) UpdateService(c *gin.Context) {
 		return
 	}
 
-	var updateData models.Service
-	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// Bind over the current values so the result is validated as a whole
+	updateData := service
+	if !bindJSON(c, &updateData) {
 		return
 	}
 
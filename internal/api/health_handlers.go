@@ -0,0 +1,39 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Health Handlers
+
+// Liveness reports that the process is up and serving, for liveness
+// probes. It checks nothing else, so a dependency outage doesn't get the
+// server restarted.
+func (h *Handlers) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    services.HealthOK,
+		"timestamp": time.Now().UTC(),
+	})
+}
+
+// Readiness checks the server's dependencies, for readiness probes. It
+// answers 503 while a critical one is down so traffic goes elsewhere.
+func (h *Handlers) Readiness(c *gin.Context) {
+	readiness := h.healthService.Ready(c.Request.Context())
+	status := http.StatusOK
+	if readiness.Status == services.HealthDown {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, readiness)
+}
+
+// SetReadReplica adds the read replica's lag to the readiness checks
+func (h *Handlers) SetReadReplica(replica *database.ReadReplicaRouter) {
+	h.healthService.SetReadReplica(replica)
+}
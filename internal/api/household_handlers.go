@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Household Handlers
+
+// GetCustomerDependents lists the dependents managed by a customer
+func (h *Handlers) GetCustomerDependents(c *gin.Context) {
+	guardianID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	dependents, err := h.householdService.GetDependents(c.Request.Context(), guardianID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dependents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dependents": dependents})
+}
+
+// CreateCustomerDependent creates a dependent profile under a customer
+func (h *Handlers) CreateCustomerDependent(c *gin.Context) {
+	guardianID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.CreateDependentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	dependent, err := h.householdService.CreateDependent(c.Request.Context(), guardianID, req, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+	h.recordChange(c, "create", "customers", dependent.ID, nil, dependent)
+
+	c.JSON(http.StatusCreated, dependent)
+}
+
+// LinkCustomerDependent places an existing customer under a customer's
+// household
+func (h *Handlers) LinkCustomerDependent(c *gin.Context) {
+	guardianID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		DependentID  uuid.UUID                    `json:"dependent_id" binding:"required"`
+		Relationship models.DependentRelationship `json:"relationship" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	dependent, err := h.householdService.LinkDependent(c.Request.Context(), guardianID, req.DependentID, req.Relationship, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, dependent)
+}
+
+// UnlinkCustomerDependent removes a dependent from a customer's household.
+// The dependent's profile and history are kept.
+func (h *Handlers) UnlinkCustomerDependent(c *gin.Context) {
+	guardianID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+	dependentID, err := uuid.Parse(c.Param("dependent_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dependent ID"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	if err := h.householdService.UnlinkDependent(c.Request.Context(), guardianID, dependentID, &user.ID); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dependent unlinked successfully"})
+}
@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Insurance Claim Handlers
+
+// CreateSaleClaim records the HMO claim for a sale already made
+func (h *Handlers) CreateSaleClaim(c *gin.Context) {
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+
+	var req services.InsuranceClaimRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	claim, err := h.insuranceClaimService.CreateClaim(c.Request.Context(), saleID, req, user.ID)
+	if err != nil {
+		h.respondError(c, claimErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "insurance_claims", claim.ID, nil, claim)
+	c.JSON(http.StatusCreated, claim)
+}
+
+// GetClaims lists claims. Query parameters: status, provider, customer_id,
+// from and to (YYYY-MM-DD, on when the claim was made), limit and offset.
+func (h *Handlers) GetClaims(c *gin.Context) {
+	filter := services.ClaimFilter{
+		Status:   models.ClaimStatus(c.Query("status")),
+		Provider: c.Query("provider"),
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	if customerID := c.Query("customer_id"); customerID != "" {
+		id, err := uuid.Parse(customerID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+			return
+		}
+		filter.CustomerID = &id
+	}
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+		days   int
+	}{{"from", &filter.From, 0}, {"to", &filter.To, 1}} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param.name + " date, use YYYY-MM-DD"})
+			return
+		}
+		date = date.AddDate(0, 0, param.days)
+		*param.target = &date
+	}
+
+	claims, total, err := h.insuranceClaimService.ListClaims(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve claims"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{"claims": claims, "total": total})
+}
+
+// GetClaim returns a claim with its sale and customer
+func (h *Handlers) GetClaim(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid claim ID"})
+		return
+	}
+
+	claim, err := h.insuranceClaimService.GetClaim(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, claim)
+}
+
+// UpdateClaimStatus records that a claim was submitted, approved, denied
+// or paid
+func (h *Handlers) UpdateClaimStatus(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid claim ID"})
+		return
+	}
+
+	var req services.UpdateClaimStatusRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	before, after, err := h.insuranceClaimService.UpdateStatus(c.Request.Context(), id, req, user.ID)
+	if err != nil {
+		h.respondError(c, claimErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "update_status", "insurance_claims", after.ID, before, after)
+	c.JSON(http.StatusOK, after)
+}
+
+// PrintClaimDocument renders the statement of account to send the HMO
+// with the member's LOA
+func (h *Handlers) PrintClaimDocument(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid claim ID"})
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	form, err := h.insuranceClaimService.ClaimForm(c.Request.Context(), id, user.FirstName+" "+user.LastName)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("Content-Disposition", "inline; filename=\"claim-"+form.ClaimNumber+".pdf\"")
+	c.Data(http.StatusOK, "application/pdf", labels.RenderClaimPDF(form))
+}
+
+// GetClaimReceivables reports what each HMO still owes, by status and age.
+// as_of (YYYY-MM-DD) reports the claims made up to that day, aged to it.
+func (h *Handlers) GetClaimReceivables(c *gin.Context) {
+	asOf := time.Now()
+	if value := c.Query("as_of"); value != "" {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid as_of date, use YYYY-MM-DD"})
+			return
+		}
+		asOf = date.AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	report, err := h.insuranceClaimService.Receivables(c.Request.Context(), asOf)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build receivables report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Drug Interaction Handlers
+
+// CheckMedicationInteractions checks a single medication against a customer's
+// current medications. The medication may be a product ID or a drug name.
+func (h *Handlers) CheckMedicationInteractions(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	req := services.InteractionCheckRequest{CustomerID: &customerID}
+	medication := c.Param("medication")
+	if productID, err := uuid.Parse(medication); err == nil {
+		req.ProductIDs = []uuid.UUID{productID}
+	} else {
+		req.Medications = []string{medication}
+	}
+
+	h.respondWithInteractions(c, req)
+}
+
+// CheckCustomerInteractions checks a basket of products and medications
+// against each other and a customer's current medications
+func (h *Handlers) CheckCustomerInteractions(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.InteractionCheckRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	req.CustomerID = &customerID
+
+	h.respondWithInteractions(c, req)
+}
+
+// GetDrugInteractions lists the interaction dataset
+func (h *Handlers) GetDrugInteractions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	interactions, total, err := h.interactionService.ListInteractions(c.Request.Context(), c.Query("ingredient"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch drug interactions"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"interactions": interactions,
+		"total":        total,
+		"limit":        limit,
+		"offset":       offset,
+	})
+}
+
+// CreateDrugInteraction adds an interaction to the dataset
+func (h *Handlers) CreateDrugInteraction(c *gin.Context) {
+	var interaction models.DrugInteraction
+	if !bindJSON(c, &interaction) {
+		return
+	}
+
+	if err := h.interactionService.CreateInteraction(c.Request.Context(), &interaction); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, interaction)
+}
+
+func (h *Handlers) respondWithInteractions(c *gin.Context, req services.InteractionCheckRequest) {
+	warnings, err := h.interactionService.CheckInteractions(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"warnings":                 warnings,
+		"requires_acknowledgement": len(services.UnacknowledgedWarnings(warnings, nil)) > 0,
+	})
+}
+
+// requireInteractionAcknowledgement responds with 409 and returns false when
+// any warning that needs a pharmacist's acknowledgement has not been acknowledged
+func (h *Handlers) requireInteractionAcknowledgement(c *gin.Context, warnings []services.InteractionWarning, acknowledged []string) bool {
+	pending := services.UnacknowledgedWarnings(warnings, acknowledged)
+	if len(pending) == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    "Drug interactions must be acknowledged by a pharmacist before dispensing",
+		"warnings": pending,
+	})
+	return false
+}
+
+// recordInteractionAcknowledgements stores the acknowledged warnings. Failures
+// are logged rather than returned since the dispense has already happened.
+func (h *Handlers) recordInteractionAcknowledgements(c *gin.Context, req services.AcknowledgeInteractionsRequest) {
+	var acknowledged []services.InteractionWarning
+	for _, warning := range req.Warnings {
+		if warning.RequiresAcknowledgement {
+			acknowledged = append(acknowledged, warning)
+		}
+	}
+	if len(acknowledged) == 0 {
+		return
+	}
+	req.Warnings = acknowledged
+
+	if err := h.interactionService.Acknowledge(c.Request.Context(), req); err != nil {
+		logrus.WithError(err).Error("Failed to record interaction acknowledgements")
+	}
+}
+
+// screenOrderInteractions checks an online order's items before it is marked
+// ready for dispensing. Acknowledgements from earlier attempts are honoured.
+func (h *Handlers) screenOrderInteractions(c *gin.Context, orderID uuid.UUID, acknowledged []string, notes string, userID uuid.UUID) bool {
+	order, err := h.orders.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return false
+	}
+
+	productIDs := make([]uuid.UUID, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	warnings, err := h.interactionService.CheckInteractions(c.Request.Context(), services.InteractionCheckRequest{
+		CustomerID: order.CustomerID,
+		ProductIDs: productIDs,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check drug interactions"})
+		return false
+	}
+
+	previous, err := h.interactionService.GetOrderAcknowledgedKeys(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check drug interactions"})
+		return false
+	}
+	if !h.requireInteractionAcknowledgement(c, warnings, append(previous, acknowledged...)) {
+		return false
+	}
+
+	h.recordInteractionAcknowledgements(c, services.AcknowledgeInteractionsRequest{
+		CustomerID: order.CustomerID,
+		OrderID:    &orderID,
+		Warnings:   services.UnacknowledgedWarnings(warnings, previous),
+		Notes:      notes,
+		UserID:     userID,
+	})
+	return true
+}
@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Job Handlers
+
+// GetJobs lists background jobs, newest first, filtered by ?status= and
+// ?type=
+func (h *Handlers) GetJobs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	jobs, total, err := h.jobService.ListJobs(c.Request.Context(), c.Query("status"), c.Query("type"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve jobs"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":   jobs,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+		"types":  h.jobService.Types(),
+	})
+}
+
+func (h *Handlers) GetJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.GetJob(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// EnqueueJob queues a job of a registered type to run now
+func (h *Handlers) EnqueueJob(c *gin.Context) {
+	var req services.EnqueueJobRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	var payload interface{}
+	if len(req.Payload) > 0 {
+		payload = req.Payload
+	}
+	job, err := h.jobService.Enqueue(c.Request.Context(), req.Type, payload)
+	if err != nil {
+		if errors.Is(err, services.ErrUnknownJobType) {
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "create", "jobs", job.ID, nil, job)
+	c.JSON(http.StatusCreated, job)
+}
+
+// RetryJob queues a dead job to run again
+func (h *Handlers) RetryJob(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.jobService.RetryJob(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrJobNotDead) {
+			h.respondError(c, http.StatusConflict, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "retry", "jobs", job.ID, nil, job)
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *Handlers) GetJobSchedules(c *gin.Context) {
+	schedules, err := h.jobService.ListSchedules(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job schedules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schedules": schedules})
+}
+
+// UpdateJobSchedule pauses or resumes a schedule
+func (h *Handlers) UpdateJobSchedule(c *gin.Context) {
+	var req services.UpdateJobScheduleRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	schedule, err := h.jobService.SetScheduleEnabled(c.Request.Context(), c.Param("name"), *req.Enabled)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "update", "job_schedules", schedule.ID, nil, schedule)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// RunJobWorkers saves the job schedules from the configuration and runs the
+// job workers until ctx is done
+func (h *Handlers) RunJobWorkers(ctx context.Context) {
+	if err := h.jobService.Schedule(ctx, "cart-cleanup", "cart.cleanup", h.config.Jobs.CartCleanupCron); err != nil {
+		logrus.WithError(err).Error("Failed to schedule cart cleanup")
+	}
+	if h.smsService.Enabled() {
+		if err := h.jobService.Schedule(ctx, "sms-delivery-status", "sms.delivery_status", h.config.SMS.StatusPollCron); err != nil {
+			logrus.WithError(err).Error("Failed to schedule SMS delivery status checks")
+		}
+	}
+	if len(h.config.WebhookInbox.Secrets) > 0 {
+		if err := h.jobService.Schedule(ctx, "webhook-inbox-prune", "webhook.prune", h.config.WebhookInbox.PruneCron); err != nil {
+			logrus.WithError(err).Error("Failed to schedule inbound webhook pruning")
+		}
+	}
+	if h.config.WebhookInbox.Secrets[h.config.ColdChain.Integration] != "" {
+		if err := h.jobService.Schedule(ctx, "cold-chain-sensor-check", "cold_chain.check_sensors", h.config.ColdChain.CheckCron); err != nil {
+			logrus.WithError(err).Error("Failed to schedule cold chain sensor checks")
+		}
+	}
+	if err := h.jobService.Schedule(ctx, "station-job-sweep", "stations.sweep", h.config.Station.SweepCron); err != nil {
+		logrus.WithError(err).Error("Failed to schedule station job expiry")
+	}
+	if err := h.jobService.Schedule(ctx, "document-renewal-reminders", "documents.remind", h.config.Documents.ReminderCron); err != nil {
+		logrus.WithError(err).Error("Failed to schedule document renewal reminders")
+	}
+	if h.regulatoryService.Enabled() {
+		if err := h.jobService.Schedule(ctx, "fda-registry-refresh", "fda.registry_refresh", h.config.FDA.RefreshCron); err != nil {
+			logrus.WithError(err).Error("Failed to schedule FDA registry refresh")
+		}
+	}
+	h.jobService.RunWorkers(ctx)
+}
+
+// registerJobs sets the handlers for the job types the workers can run
+func (h *Handlers) registerJobs() {
+	h.jobService.Register("cart.cleanup", func(ctx context.Context, payload []byte) error {
+		removed, err := h.orders.CleanupExpiredCarts(ctx)
+		if err == nil && removed > 0 {
+			logrus.WithField("removed", removed).Info("Removed expired cart items")
+		}
+		return err
+	})
+	h.jobService.Register("audit.archive", func(ctx context.Context, payload []byte) error {
+		_, err := h.auditService.ArchiveExpired(ctx)
+		return err
+	})
+	h.jobService.Register("backup.run", func(ctx context.Context, payload []byte) error {
+		_, err := h.backupService.RunBackup(ctx)
+		return err
+	})
+	h.jobService.Register("sms.delivery_status", func(ctx context.Context, payload []byte) error {
+		_, err := h.smsService.PollDeliveryStatus(ctx)
+		return err
+	})
+	h.jobService.Register("fda.registry_refresh", func(ctx context.Context, payload []byte) error {
+		_, err := h.regulatoryService.RefreshRegistry(ctx)
+		return err
+	})
+	h.jobService.Register(services.WebhookProcessJob, h.webhookInboxService.Process)
+	h.jobService.Register("cold_chain.check_sensors", func(ctx context.Context, payload []byte) error {
+		silent, err := h.coldChainService.CheckSensors(ctx)
+		if err == nil && silent > 0 {
+			logrus.WithField("silent", silent).Warn("Temperature loggers have stopped reporting")
+		}
+		return err
+	})
+	h.jobService.Register("stations.sweep", func(ctx context.Context, payload []byte) error {
+		settled, err := h.stationService.Sweep(ctx)
+		if err == nil && settled > 0 {
+			logrus.WithField("settled", settled).Info("Expired station jobs no agent completed")
+		}
+		return err
+	})
+	h.jobService.Register("documents.remind", func(ctx context.Context, payload []byte) error {
+		sent, err := h.documentService.SendRenewalReminders(ctx)
+		if err == nil && sent > 0 {
+			logrus.WithField("sent", sent).Info("Sent license renewal reminders")
+		}
+		return err
+	})
+	h.jobService.Register("webhook.prune", func(ctx context.Context, payload []byte) error {
+		pruned, err := h.webhookInboxService.PruneProcessed(ctx)
+		if err == nil && pruned > 0 {
+			logrus.WithField("pruned", pruned).Info("Deleted old inbound webhooks")
+		}
+		return err
+	})
+}
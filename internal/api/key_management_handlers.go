@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Encryption Key Handlers
+
+// GetEncryptionKeys lists the data keys and how many values are still
+// encrypted under retired ones
+func (h *Handlers) GetEncryptionKeys(c *gin.Context) {
+	status, err := h.keyManagementService.KeyStatus(c.Request.Context())
+	if err != nil {
+		h.respondKeyManagementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// RotateEncryptionKey creates a new data key for new values. Existing values
+// are re-encrypted by the background job, or by ReencryptData.
+func (h *Handlers) RotateEncryptionKey(c *gin.Context) {
+	key, err := h.keyManagementService.RotateDataKey(c.Request.Context())
+	if err != nil {
+		h.respondKeyManagementError(c, err)
+		return
+	}
+
+	h.recordChange(c, "rotate", "encryption_keys", key.ID, nil, key)
+	c.JSON(http.StatusCreated, key)
+}
+
+// RewrapEncryptionKeys wraps the data keys again with the current master key
+func (h *Handlers) RewrapEncryptionKeys(c *gin.Context) {
+	rewrapped, err := h.keyManagementService.RewrapDataKeys(c.Request.Context())
+	if err != nil {
+		h.respondKeyManagementError(c, err)
+		return
+	}
+
+	h.recordChange(c, "rewrap", "encryption_keys", uuid.Nil, nil, gin.H{"rewrapped": rewrapped})
+	c.JSON(http.StatusOK, gin.H{"rewrapped": rewrapped})
+}
+
+// ReencryptData re-encrypts a batch of stale values now instead of waiting
+// for the scheduled run
+func (h *Handlers) ReencryptData(c *gin.Context) {
+	result, err := h.keyManagementService.ReencryptStale(c.Request.Context())
+	if err != nil {
+		h.respondKeyManagementError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RunReencryption re-encrypts data under retired keys in the background
+// until ctx is done
+func (h *Handlers) RunReencryption(ctx context.Context) {
+	h.keyManagementService.RunReencryption(ctx)
+}
+
+func (h *Handlers) respondKeyManagementError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrKeyManagementDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	h.respondError(c, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/labels"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Dispensing Label Handlers
+
+// PrintSaleLabels renders dispensing labels for a sale. Query parameters:
+// format=pdf|escpos (default pdf) and item_id to print a single line.
+func (h *Handlers) PrintSaleLabels(c *gin.Context) {
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+	itemID, ok := parseLabelItemID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.labelService.SaleLabels(c.Request.Context(), saleID, itemID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	writeLabels(c, "sale-"+saleID.String(), result)
+}
+
+// PrintOrderLabels renders dispensing labels for an online order
+func (h *Handlers) PrintOrderLabels(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	itemID, ok := parseLabelItemID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.labelService.OrderLabels(c.Request.Context(), orderID, itemID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	writeLabels(c, "order-"+orderID.String(), result)
+}
+
+func parseLabelItemID(c *gin.Context) (*uuid.UUID, bool) {
+	itemIDStr := c.Query("item_id")
+	if itemIDStr == "" {
+		return nil, true
+	}
+	itemID, err := uuid.Parse(itemIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return nil, false
+	}
+	return &itemID, true
+}
+
+func writeLabels(c *gin.Context, name string, result []labels.Label) {
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		c.Header("Content-Disposition", "inline; filename=\""+name+"-labels.pdf\"")
+		c.Data(http.StatusOK, "application/pdf", labels.RenderPDF(result))
+	case "escpos":
+		c.Header("Content-Disposition", "attachment; filename=\""+name+"-labels.bin\"")
+		c.Data(http.StatusOK, "application/octet-stream", labels.RenderESCPOS(result))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use pdf or escpos"})
+	}
+}
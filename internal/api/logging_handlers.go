@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/logging"
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Logging Handlers
+
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required,oneof=trace debug info warn warning error fatal panic"`
+}
+
+// GetLogLevel returns this instance's log level
+func (h *Handlers) GetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"level": logging.Level()})
+}
+
+// UpdateLogLevel changes this instance's log level until it restarts. Other
+// instances behind the load balancer keep theirs.
+func (h *Handlers) UpdateLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	before := logging.Level()
+	if err := logging.SetLevel(req.Level); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"from":       before,
+		"to":         logging.Level(),
+		"request_id": middleware.GetRequestID(c),
+	}).Warn("Log level changed")
+	h.recordChange(c, "update", "log_level", uuid.Nil, gin.H{"level": before}, gin.H{"level": logging.Level()})
+	c.JSON(http.StatusOK, gin.H{"level": logging.Level()})
+}
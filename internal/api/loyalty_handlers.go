@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Loyalty Handlers
+
+// GetLoyaltyTiers lists the loyalty tiers and their benefits
+func (h *Handlers) GetLoyaltyTiers(c *gin.Context) {
+	tiers, err := h.loyaltyService.GetTiers(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve loyalty tiers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tiers": tiers})
+}
+
+// UpdateLoyaltyTier changes a tier's spend threshold or benefits
+func (h *Handlers) UpdateLoyaltyTier(c *gin.Context) {
+	var req services.UpdateLoyaltyTierRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	tier, err := h.loyaltyService.UpdateTier(c.Request.Context(), c.Param("code"), req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tier)
+}
+
+// RecalculateLoyaltyTiers recalculates every customer's tier immediately
+func (h *Handlers) RecalculateLoyaltyTiers(c *gin.Context) {
+	changed, err := h.loyaltyService.RecalculateAll(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changed": changed})
+}
+
+// GetCustomerLoyalty returns a customer's points, tier and progress to the
+// next tier
+func (h *Handlers) GetCustomerLoyalty(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	loyalty, err := h.loyaltyService.GetCustomerLoyalty(c.Request.Context(), customerID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, loyalty)
+}
+
+// AdjustCustomerPoints adds or removes loyalty points by hand
+func (h *Handlers) AdjustCustomerPoints(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.AdjustPointsRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.CreatedBy = &user.ID
+	}
+
+	entry, err := h.loyaltyService.AdjustPoints(c.Request.Context(), customerID, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// GetCustomerCredit returns a customer's store credit balance and history
+func (h *Handlers) GetCustomerCredit(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	credit, err := h.loyaltyService.GetCustomerCredit(c.Request.Context(), customerID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, credit)
+}
+
+// AdjustCustomerCredit adds or removes store credit by hand
+func (h *Handlers) AdjustCustomerCredit(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.AdjustCreditRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.CreatedBy = &user.ID
+	}
+
+	entry, err := h.loyaltyService.AdjustCredit(c.Request.Context(), customerID, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// RunLoyaltyRecalculation recalculates tiers in the background until ctx is
+// done
+func (h *Handlers) RunLoyaltyRecalculation(ctx context.Context) {
+	h.loyaltyService.RunRecalculation(ctx)
+}
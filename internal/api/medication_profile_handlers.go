@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Medication Profile Handlers
+
+// GetMedicationProfile returns a customer's consolidated medication profile.
+// Allergies, medical history and dosing details are only included for roles
+// with medical_data read permission.
+func (h *Handlers) GetMedicationProfile(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("dispenses", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	includePHI := h.authService.CheckPermission(user.Role, "medical_data", "read")
+	profile, err := h.medicationProfileService.GetProfile(c.Request.Context(), customerID, includePHI, limit)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, profile)
+}
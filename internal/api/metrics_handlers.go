@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/metrics"
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Metrics Handlers
+
+// RegisterMetrics times every request and serves /metrics when
+// METRICS_ENABLED is set. It goes on the router before the routes it times.
+func (h *Handlers) RegisterMetrics(router *gin.Engine) {
+	if !h.config.Monitoring.MetricsEnabled {
+		return
+	}
+	router.Use(timeRequests())
+	router.GET("/metrics", h.Metrics)
+}
+
+// SetDatabaseManager reports the synced databases' pools and health in
+// /metrics rather than only the primary's, and adds sync to the readiness
+// checks
+func (h *Handlers) SetDatabaseManager(dm *database.DatabaseManager) {
+	h.dbManager = dm
+	h.healthService.SetDatabaseManager(dm)
+	if h.alerts.Enabled() {
+		dm.SetAlerting(h.alerts)
+	}
+}
+
+// Metrics writes the metrics in the Prometheus text format. Database,
+// Redis and queue readings are taken now.
+func (h *Handlers) Metrics(c *gin.Context) {
+	if token := h.config.Monitoring.MetricsToken; token != "" {
+		given := c.GetHeader("Authorization")
+		if subtle.ConstantTimeCompare([]byte(given), []byte("Bearer "+token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid metrics token"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	h.collectDatabaseMetrics(ctx)
+	h.collectRedisMetrics(ctx)
+	h.collectQueueMetrics(ctx)
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := metrics.WriteText(c.Writer); err != nil {
+		logrus.WithError(err).Warn("Failed to write metrics")
+	}
+}
+
+// Private helper methods
+
+// timeRequests records each request's latency by method, route and status.
+// Requests matching no route share one label so probes for random paths
+// don't add series.
+func timeRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(),
+			c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+func (h *Handlers) collectDatabaseMetrics(ctx context.Context) {
+	pools := make(map[string]sql.DBStats)
+	health := make(map[string]bool)
+	if h.dbManager != nil {
+		stats, err := h.dbManager.GetStats()
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to read database stats for metrics")
+			return
+		}
+		pools, health = stats.Pools, stats.HealthStatus
+		if !stats.LastSyncTime.IsZero() {
+			metrics.DBLastSync.Set(float64(stats.LastSyncTime.Unix()))
+		}
+	} else if sqlDB, err := h.db.DB(); err == nil {
+		pools["primary"] = sqlDB.Stats()
+		health["primary"] = sqlDB.PingContext(ctx) == nil
+	}
+
+	for name, pool := range pools {
+		metrics.DBOpenConnections.Set(float64(pool.OpenConnections), name)
+		metrics.DBInUseConnections.Set(float64(pool.InUse), name)
+		metrics.DBIdleConnections.Set(float64(pool.Idle), name)
+		metrics.DBWaitCount.Set(float64(pool.WaitCount), name)
+		metrics.DBWaitSeconds.Set(pool.WaitDuration.Seconds(), name)
+	}
+	for name, up := range health {
+		metrics.DBUp.Set(boolValue(up), name)
+	}
+}
+
+func (h *Handlers) collectRedisMetrics(ctx context.Context) {
+	metrics.RedisUp.Set(boolValue(h.redis != nil && h.redis.Ping(ctx).Err() == nil))
+}
+
+func (h *Handlers) collectQueueMetrics(ctx context.Context) {
+	if pending, failed, err := h.outboxService.Depth(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to read outbox depth for metrics")
+	} else {
+		metrics.QueueDepth.Set(float64(pending), "outbox")
+		metrics.QueueFailed.Set(float64(failed), "outbox")
+	}
+	if pending, dead, err := h.jobService.Depth(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to read job queue depth for metrics")
+	} else {
+		metrics.QueueDepth.Set(float64(pending), "jobs")
+		metrics.QueueFailed.Set(float64(dead), "jobs")
+	}
+}
+
+// paymentMethodLabel is the sales counter's label for a payment method.
+// Methods the till made up are counted together so they can't add series.
+func paymentMethodLabel(method models.PaymentMethod) string {
+	switch method {
+	case models.PaymentMethodCash, models.PaymentMethodCard, models.PaymentMethodGCash,
+		models.PaymentMethodMaya, models.PaymentMethodInsurance, models.PaymentMethodCOD:
+		return string(method)
+	}
+	return "other"
+}
+
+// orderTypeLabel is the orders counter's label for an order type
+func orderTypeLabel(orderType models.OrderType) string {
+	switch orderType {
+	case models.OrderTypeDelivery, models.OrderTypePickup:
+		return string(orderType)
+	}
+	return "other"
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
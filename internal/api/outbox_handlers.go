@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Outbox Handlers
+
+// GetOutboxMessages lists queued notifications and webhooks, newest first,
+// filtered by ?status=
+func (h *Handlers) GetOutboxMessages(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	messages, total, err := h.outboxService.ListMessages(c.Request.Context(), c.Query("status"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve outbox messages"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// RetryOutboxMessage queues a message that failed every attempt for
+// delivery again
+func (h *Handlers) RetryOutboxMessage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := h.outboxService.RetryMessage(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrOutboxMessageNotFailed) {
+			h.respondError(c, http.StatusConflict, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "retry", "outbox_messages", message.ID, nil, message)
+	c.JSON(http.StatusOK, message)
+}
+
+// RunOutboxDispatcher delivers queued notifications and webhooks until ctx
+// is done
+func (h *Handlers) RunOutboxDispatcher(ctx context.Context) {
+	h.outboxService.RunDispatcher(ctx)
+}
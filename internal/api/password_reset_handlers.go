@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Password Reset Handlers
+
+// ForgotPassword emails a password reset link to the staff account with the
+// given address. The answer is the same whether or not an account has it.
+func (h *Handlers) ForgotPassword(c *gin.Context) {
+	if !h.emailService.Enabled() || h.config.Email.PasswordResetURL == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "Password reset by email is not available",
+			"code":  middleware.CodeForStatus(http.StatusServiceUnavailable),
+		})
+		return
+	}
+
+	var req auth.ForgotPasswordRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	reset, err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email, c.ClientIP())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if reset != nil {
+		// Sent straight away rather than through the outbox so the link is
+		// never stored, and in the background so the response takes as long
+		// for unknown addresses
+		link := h.config.Email.PasswordResetURL
+		if strings.Contains(link, "?") {
+			link += "&token=" + url.QueryEscape(reset.Token)
+		} else {
+			link += "?token=" + url.QueryEscape(reset.Token)
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), h.config.Email.Timeout*2)
+			defer cancel()
+			err := h.emailService.SendEmail(ctx, services.EmailRequest{
+				To:       reset.User.Email,
+				Template: services.EmailTemplatePasswordReset,
+				Data: services.PasswordResetEmail{
+					Name:      reset.User.FirstName,
+					Link:      link,
+					ExpiresAt: reset.ExpiresAt,
+				},
+				Transactional: true,
+			})
+			if err != nil {
+				logrus.WithError(err).WithField("user_id", reset.User.ID).Error("Failed to send password reset email")
+			}
+		}()
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account uses this address, a password reset link has been emailed to it"})
+}
+
+// ResetPassword sets a new password with the token from a reset email
+func (h *Handlers) ResetPassword(c *gin.Context) {
+	var req auth.ResetPasswordRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req); err != nil {
+		if errors.Is(err, auth.ErrResetTokenInvalid) {
+			h.respondError(c, http.StatusBadRequest, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
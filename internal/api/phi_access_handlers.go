@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// PHI Access Handlers
+
+// BreakGlassCustomerPHI reveals chosen PHI fields of one customer to a role
+// that normally gets them redacted, e.g. an assistant checking allergies in
+// an emergency. The fields and the stated reason are audit-logged before
+// anything is returned; the values themselves are not logged.
+func (h *Handlers) BreakGlassCustomerPHI(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		Fields []string `json:"fields" binding:"required,min=1,dive,oneof=medical_history allergies current_medications blood_type insurance_provider insurance_number"`
+		Reason string   `json:"reason" binding:"required,min=10,max=500"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	var customer models.Customer
+	if err := h.db.First(&customer, "id = ?", customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	values, err := customer.PHIValues(req.Fields)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read customer data"})
+		return
+	}
+
+	access := gin.H{"fields": req.Fields, "reason": req.Reason}
+	if err := h.auditService.RecordChange(c.Request.Context(), auditChange(c, "break_glass", "customers", customerID, nil, access)); err != nil {
+		logrus.WithError(err).WithField("customer_id", customerID).Error("Failed to audit break-glass access")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Access could not be audited"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	logrus.WithFields(logrus.Fields{
+		"user_id":     user.ID,
+		"customer_id": customerID,
+		"fields":      req.Fields,
+	}).Warn("Break-glass access to customer PHI")
+
+	middleware.UnmaskPHI(c)
+	c.JSON(http.StatusOK, gin.H{
+		"customer_id": customerID,
+		"fields":      values,
+	})
+}
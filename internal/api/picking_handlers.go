@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Picking Handlers
+
+// GetPickList consolidates what is still to pick for the online orders in
+// ?order_ids (comma-separated), or for the oldest orders being processed,
+// grouped by storage location
+func (h *Handlers) GetPickList(c *gin.Context) {
+	orderIDs, ok := parsePickOrderIDs(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.pickingService.PickList(c.Request.Context(), orderIDs)
+	if err != nil {
+		h.respondError(c, pickingErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// PrintPickList sends a pick list to the receipt printer of a terminal's
+// station
+func (h *Handlers) PrintPickList(c *gin.Context) {
+	var req services.PickListPrintRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	terminal, err := h.terminalService.GetTerminal(c.Request.Context(), req.TerminalID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	if !h.inStaffBranch(c, terminal.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return
+	}
+
+	list, err := h.pickingService.PickList(c.Request.Context(), req.OrderIDs)
+	if err != nil {
+		h.respondError(c, pickingErrorStatus(err), err)
+		return
+	}
+	if list.Units == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Nothing is left to pick on these orders"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	job, err := h.stationService.QueuePickList(c.Request.Context(), terminal, list.Printable(), user.ID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"pick_list": list, "job": job})
+}
+
+// PickOrderItem records an order item scanned off the shelf. The scan must
+// be the ordered product, and the batch in stock when it carries one. The
+// order is marked ready once everything on it is picked, after the same
+// interaction and allergy checks as marking it ready by hand, which the
+// last scan acknowledges or overrides.
+func (h *Handlers) PickOrderItem(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	itemID, err := uuid.Parse(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order item ID"})
+		return
+	}
+	var req struct {
+		services.PickRequest
+		AcknowledgedInteractions []string `json:"acknowledged_interactions"`
+		AcknowledgementNotes     string   `json:"acknowledgement_notes"`
+		screeningOverride
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	completes, err := h.pickingService.CheckPick(c.Request.Context(), orderID, itemID, req.PickRequest)
+	if err != nil {
+		h.respondError(c, pickingErrorStatus(err), err)
+		return
+	}
+	if completes {
+		if !h.screenOrderInteractions(c, orderID, req.AcknowledgedInteractions, req.AcknowledgementNotes, user.ID) {
+			return
+		}
+		if !h.screenOrder(c, orderID, req.screeningOverride, user.ID) {
+			return
+		}
+	}
+
+	result, err := h.pickingService.Pick(c.Request.Context(), orderID, itemID, req.PickRequest, user.ID)
+	if err != nil {
+		h.respondError(c, pickingErrorStatus(err), err)
+		return
+	}
+	h.recordChange(c, "pick", "orders", orderID, nil, result.Item)
+
+	status := models.OrderStatusProcessing
+	// An order finished by another picker meanwhile wasn't screened here,
+	// and is left for marking ready by hand
+	if result.AllPicked && completes {
+		var previous models.OnlineOrder
+		if err := h.db.First(&previous, orderID).Error; err == nil {
+			err = h.orders.UpdateOrderStatus(c.Request.Context(), orderID, models.OrderStatusReady, "All items picked", &user.ID)
+			if err != nil {
+				logrus.WithError(err).WithField("order_id", orderID).Error("Failed to mark picked order ready")
+			} else {
+				status = models.OrderStatusReady
+				var updated models.OnlineOrder
+				if err := h.db.First(&updated, orderID).Error; err == nil {
+					h.recordChange(c, "update", "orders", orderID, &previous, &updated)
+				}
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"item":         result.Item,
+		"left_to_pick": result.LeftToPick,
+		"all_picked":   result.AllPicked,
+		"order_status": status,
+	})
+}
+
+func parsePickOrderIDs(c *gin.Context) ([]uuid.UUID, bool) {
+	value := c.Query("order_ids")
+	if value == "" {
+		return nil, true
+	}
+
+	var ids []uuid.UUID
+	for _, part := range strings.Split(value, ",") {
+		id, err := uuid.Parse(strings.TrimSpace(part))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID in order_ids"})
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) > 50 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A pick list covers at most 50 orders"})
+		return nil, false
+	}
+	return ids, true
+}
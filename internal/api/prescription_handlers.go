@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Prescription Handlers
+
+const maxPrescriptionUploadSize = 10 << 20 // 10 MB
+
+var allowedPrescriptionTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".pdf":  "application/pdf",
+}
+
+// UploadPrescription uploads a prescription for an order or customer (staff)
+func (h *Handlers) UploadPrescription(c *gin.Context) {
+	req, ok := h.readPrescriptionUpload(c)
+	if !ok {
+		return
+	}
+
+	if orderIDStr := c.PostForm("order_id"); orderIDStr != "" {
+		orderID, err := uuid.Parse(orderIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+		req.OrderID = &orderID
+	}
+	if customerIDStr := c.PostForm("customer_id"); customerIDStr != "" {
+		customerID, err := uuid.Parse(customerIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+			return
+		}
+		req.CustomerID = &customerID
+	}
+	if guardianIDStr := c.PostForm("guardian_id"); guardianIDStr != "" {
+		guardianID, err := uuid.Parse(guardianIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guardian ID"})
+			return
+		}
+		req.GuardianID = &guardianID
+	}
+
+	h.savePrescriptionUpload(c, req)
+}
+
+// UploadOrderPrescription lets customers attach a prescription to their
+// order. Guests send the X-Session-ID the order was placed with.
+func (h *Handlers) UploadOrderPrescription(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.orders.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if !h.mayUploadToOrder(c, order) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	req, ok := h.readPrescriptionUpload(c)
+	if !ok {
+		return
+	}
+	req.OrderID = &orderID
+
+	h.savePrescriptionUpload(c, req)
+}
+
+// GetPendingPrescriptions returns the pharmacist verification queue
+func (h *Handlers) GetPendingPrescriptions(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	uploads, total, err := h.prescriptionService.GetPendingPrescriptions(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pending prescriptions"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"prescriptions": uploads,
+		"total":         total,
+		"limit":         limit,
+		"offset":        offset,
+	})
+}
+
+// GetPrescription retrieves a prescription upload by ID
+func (h *Handlers) GetPrescription(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	upload, err := h.prescriptionService.GetPrescription(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prescription not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+// ApprovePrescription marks a prescription as valid
+func (h *Handlers) ApprovePrescription(c *gin.Context) {
+	h.verifyPrescription(c, true)
+}
+
+// RejectPrescription marks a prescription as invalid
+func (h *Handlers) RejectPrescription(c *gin.Context) {
+	h.verifyPrescription(c, false)
+}
+
+func (h *Handlers) verifyPrescription(c *gin.Context, approved bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	var req struct {
+		Notes string `json:"notes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		respondBindError(c, err)
+		return
+	}
+
+	// A rejection must tell the customer what was wrong
+	if !approved && strings.TrimSpace(req.Notes) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Notes are required when rejecting a prescription"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+
+	upload, err := h.prescriptionService.VerifyPrescription(c.Request.Context(), id, approved, req.Notes, user.ID)
+	if err != nil {
+		h.respondError(c, prescriptionErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, upload)
+}
+
+// GetPrescriptionOCR returns the OCR transcription suggestions for an upload
+func (h *Handlers) GetPrescriptionOCR(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	upload, suggestions, err := h.ocrService.GetSuggestions(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":       upload.OCRStatus,
+		"error":        upload.OCRError,
+		"processed_at": upload.OCRProcessedAt,
+		"confirmed_at": upload.OCRConfirmedAt,
+		"suggestions":  suggestions,
+	})
+}
+
+// RunPrescriptionOCR runs OCR on an upload again, e.g. after a provider outage
+func (h *Handlers) RunPrescriptionOCR(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	suggestions, err := h.ocrService.Process(c.Request.Context(), id)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrOCRUnavailable) {
+			status = http.StatusServiceUnavailable
+		}
+		h.respondError(c, status, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+// ConfirmPrescriptionOCR stores the pharmacist's corrected transcription
+func (h *Handlers) ConfirmPrescriptionOCR(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prescription ID"})
+		return
+	}
+
+	var req services.PrescriptionSuggestions
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+
+	confirmed, err := h.ocrService.ConfirmSuggestions(c.Request.Context(), id, req, user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": confirmed})
+}
+
+// readPrescriptionUpload reads and validates the "prescription" multipart file
+func (h *Handlers) readPrescriptionUpload(c *gin.Context) (services.UploadPrescriptionRequest, bool) {
+	var req services.UploadPrescriptionRequest
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPrescriptionUploadSize+(1<<20))
+	if err := c.Request.ParseMultipartForm(maxPrescriptionUploadSize); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+		return req, false
+	}
+
+	file, header, err := c.Request.FormFile("prescription")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return req, false
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	mimeType, allowed := allowedPrescriptionTypes[ext]
+	if !allowed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPG, PNG, and PDF files are allowed"})
+		return req, false
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPrescriptionUploadSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return req, false
+	}
+	if len(data) > maxPrescriptionUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "File exceeds the 10 MB limit"})
+		return req, false
+	}
+	if len(data) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Uploaded file is empty"})
+		return req, false
+	}
+
+	req.FileName = header.Filename
+	req.MimeType = mimeType
+	req.Data = data
+	return req, true
+}
+
+// mayUploadToOrder reports whether the caller may attach a prescription to
+// order: staff who take prescriptions, the customer it was placed by or
+// for, or the guest session that placed it
+func (h *Handlers) mayUploadToOrder(c *gin.Context, order *models.OnlineOrder) bool {
+	if user, exists := middleware.GetCurrentUser(c); exists {
+		return h.authService.CheckPermission(user.Role, "prescriptions", "create") || orderBelongsTo(order, user.ID)
+	}
+	sessionID := c.GetHeader("X-Session-ID")
+	return sessionID != "" && order.SessionID != nil &&
+		subtle.ConstantTimeCompare([]byte(sessionID), []byte(*order.SessionID)) == 1
+}
+
+func (h *Handlers) savePrescriptionUpload(c *gin.Context, req services.UploadPrescriptionRequest) {
+	upload, duplicate, err := h.prescriptionService.UploadPrescription(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, prescriptionErrorStatus(err), err)
+		return
+	}
+
+	status := http.StatusCreated
+	message := "Prescription uploaded successfully"
+	if duplicate {
+		status = http.StatusOK
+		message = "Prescription was already uploaded"
+	} else {
+		// Transcribe in the background so the upload returns immediately.
+		// Shutdown waits for it like the other workers.
+		id := upload.ID
+		h.workers.Go("prescription-ocr", func(ctx context.Context) {
+			if _, err := h.ocrService.Process(lifecycle.WorkContext(ctx), id); err != nil && !errors.Is(err, services.ErrOCRUnavailable) {
+				logrus.WithError(err).WithField("prescription_id", id).Warn("Prescription OCR failed")
+			}
+		})
+	}
+
+	c.JSON(status, gin.H{
+		"prescription": upload,
+		"duplicate":    duplicate,
+		"message":      message,
+	})
+}
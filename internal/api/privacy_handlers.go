@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Privacy Handlers
+
+// GetCustomerConsents lists a customer's consent history
+func (h *Handlers) GetCustomerConsents(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	consents, err := h.privacyService.GetConsents(c.Request.Context(), customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve consents"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"consents": consents})
+}
+
+// RecordCustomerConsent records the customer's consent for a purpose
+func (h *Handlers) RecordCustomerConsent(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.RecordConsentRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	req.CustomerID = customerID
+	req.IPAddress = c.ClientIP()
+	if user, ok := middleware.GetCurrentUser(c); ok {
+		req.RecordedBy = &user.ID
+	}
+
+	consent, err := h.privacyService.RecordConsent(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, privacyErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, consent)
+}
+
+// WithdrawCustomerConsent withdraws the customer's consent for a purpose
+func (h *Handlers) WithdrawCustomerConsent(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	purpose := models.ConsentPurpose(c.Param("purpose"))
+	if err := h.privacyService.WithdrawConsent(c.Request.Context(), customerID, purpose); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Consent withdrawn successfully"})
+}
+
+// ExportCustomerData returns everything held about a customer as a JSON
+// download for a data access request
+func (h *Handlers) ExportCustomerData(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	export, err := h.privacyService.ExportCustomerData(c.Request.Context(), customerID, user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	filename := "customer-data-" + customerID.String() + ".json"
+	c.Header("Content-Disposition", "attachment; filename=\""+filename+"\"")
+	c.JSON(http.StatusOK, export)
+}
+
+// EraseCustomerData executes a right-to-erasure request for a customer
+func (h *Handlers) EraseCustomerData(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, ok := middleware.GetCurrentUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	result, err := h.privacyService.EraseCustomer(c.Request.Context(), customerID, user.ID, req.Reason)
+	if err != nil {
+		h.respondError(c, privacyErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetDataSubjectRequests lists processed access and erasure requests
+func (h *Handlers) GetDataSubjectRequests(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	var customerID *uuid.UUID
+	if id, err := uuid.Parse(c.Query("customer_id")); err == nil {
+		customerID = &id
+	}
+
+	requests, total, err := h.privacyService.GetRequests(c.Request.Context(), customerID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve data subject requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"requests": requests,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// privacyErrorStatus maps privacy service errors to HTTP status codes
+func privacyErrorStatus(err error) int {
+	if errors.Is(err, services.ErrCustomerAnonymized) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Push Notification Handlers
+
+// RegisterPushDevice registers the app installation's token. Signed-in
+// staff get alerts on it; the ordering app registers its guest session
+// (X-Session-ID) to hear about the orders it places.
+func (h *Handlers) RegisterPushDevice(c *gin.Context) {
+	var req services.RegisterPushDeviceRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	var owner services.PushDeviceOwner
+	if user, exists := middleware.GetCurrentUser(c); exists {
+		owner.UserID = &user.ID
+	} else if sessionID := c.GetHeader("X-Session-ID"); sessionID != "" {
+		owner.SessionID = &sessionID
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Authentication or Session ID required"})
+		return
+	}
+
+	device, err := h.pushService.RegisterDevice(c.Request.Context(), owner, req)
+	if err != nil {
+		h.respondPushError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, device)
+}
+
+// UnregisterPushDevice removes the device with the token in the body, e.g.
+// when the app signs out
+func (h *Handlers) UnregisterPushDevice(c *gin.Context) {
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	if _, err := h.pushService.UnregisterToken(c.Request.Context(), req.Token); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetPushDevices lists the signed-in staff user's devices
+func (h *Handlers) GetPushDevices(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+
+	devices, err := h.pushService.ListDevices(c.Request.Context(), services.PushDeviceOwner{UserID: &user.ID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve push devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// DeletePushDevice removes one of the signed-in staff user's devices
+func (h *Handlers) DeletePushDevice(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	if _, err := h.pushService.DeleteDevice(c.Request.Context(), services.PushDeviceOwner{UserID: &user.ID}, id); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Push device removed"})
+}
+
+// GetStaffAlertPreferences returns which alerts the signed-in staff user
+// gets on their devices
+func (h *Handlers) GetStaffAlertPreferences(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+
+	prefs, err := h.pushService.GetStaffPreferences(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve alert preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// UpdateStaffAlertPreferences turns alerts on or off for the signed-in
+// staff user
+func (h *Handlers) UpdateStaffAlertPreferences(c *gin.Context) {
+	var req struct {
+		Preferences []services.StaffAlertPreferenceUpdate `json:"preferences" binding:"required,dive"`
+	}
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	if err := h.pushService.UpdateStaffPreferences(c.Request.Context(), user.ID, req.Preferences); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	prefs, err := h.pushService.GetStaffPreferences(c.Request.Context(), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve alert preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": prefs})
+}
+
+// GetCustomerPushDevices lists the devices registered for a customer
+func (h *Handlers) GetCustomerPushDevices(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	devices, err := h.pushService.ListDevices(c.Request.Context(), services.PushDeviceOwner{CustomerID: &customerID})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve push devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
+
+// RegisterCustomerPushDevice registers a device for a customer's order
+// updates, e.g. from the app of a customer signed in at the counter
+func (h *Handlers) RegisterCustomerPushDevice(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.RegisterPushDeviceRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	device, err := h.pushService.RegisterDevice(c.Request.Context(), services.PushDeviceOwner{CustomerID: &customerID}, req)
+	if err != nil {
+		h.respondPushError(c, err)
+		return
+	}
+
+	h.recordChange(c, "register_push_device", "customers", customerID, nil, device)
+	c.JSON(http.StatusCreated, device)
+}
+
+// DeleteCustomerPushDevice removes one of a customer's devices
+func (h *Handlers) DeleteCustomerPushDevice(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+	deviceID, err := uuid.Parse(c.Param("device_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid device ID"})
+		return
+	}
+
+	device, err := h.pushService.DeleteDevice(c.Request.Context(), services.PushDeviceOwner{CustomerID: &customerID}, deviceID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "remove_push_device", "customers", customerID, device, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Push device removed"})
+}
+
+// respondPushError writes the response for a failed device registration
+func (h *Handlers) respondPushError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrPushUnavailable) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "code": middleware.CodeForStatus(http.StatusServiceUnavailable)})
+		return
+	}
+	h.respondError(c, http.StatusBadRequest, err)
+}
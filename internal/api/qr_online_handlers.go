@@ -1,16 +1,20 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
+	"pharmacy-backend/internal/metrics"
 	"pharmacy-backend/internal/middleware"
 	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
 	"pharmacy-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 )
 
 // QR Code Handlers
@@ -28,7 +32,7 @@ func (h *Handlers) GenerateProductQR(c *gin.Context) {
 	
 	qrCode, err := h.qrService.GenerateProductQR(c.Request.Context(), productID, &user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -51,7 +55,7 @@ func (h *Handlers) GenerateCustomerQR(c *gin.Context) {
 	
 	qrCode, err := h.qrService.GenerateCustomerQR(c.Request.Context(), customerID, &user.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -69,8 +73,7 @@ func (h *Handlers) ScanQR(c *gin.Context) {
 		Location   string `json:"location"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -97,7 +100,7 @@ func (h *Handlers) ScanQR(c *gin.Context) {
 
 	result, err := h.qrService.ScanQR(c.Request.Context(), req.Code, scanContext)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -136,6 +139,21 @@ func (h *Handlers) GetQRScanHistory(c *gin.Context) {
 		}
 	}
 
+	// ?cursor= (empty for the first page) switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		scanLogs, nextCursor, err := h.qrService.GetScanHistoryAfter(c.Request.Context(), filters, cursor)
+		if err != nil {
+			h.respondError(c, cursorErrorStatus(err), err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"scan_logs":   scanLogs,
+			"limit":       query.CursorPageSize(limit, 50),
+			"next_cursor": nextCursor,
+		})
+		return
+	}
+
 	scanLogs, err := h.qrService.GetScanHistory(c.Request.Context(), filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve scan history"})
@@ -154,8 +172,7 @@ func (h *Handlers) GetQRScanHistory(c *gin.Context) {
 // AddToCart adds an item to the shopping cart
 func (h *Handlers) AddToCart(c *gin.Context) {
 	var req services.AddToCartRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -172,9 +189,9 @@ func (h *Handlers) AddToCart(c *gin.Context) {
 		req.SessionID = &sessionID
 	}
 
-	cartItem, err := h.onlineOrderService.AddToCart(c.Request.Context(), req)
+	cartItem, err := h.orders.AddToCart(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -199,18 +216,18 @@ func (h *Handlers) GetCart(c *gin.Context) {
 		}
 	}
 
-	cartItems, err := h.onlineOrderService.GetCart(c.Request.Context(), customerID, sessionID)
+	cartItems, err := h.orders.GetCart(c.Request.Context(), customerID, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
 
 	// Calculate cart summary
 	var totalItems int
-	var totalAmount float64
+	var totalAmount models.Money
 	for _, item := range cartItems {
 		totalItems += item.Quantity
-		totalAmount += float64(item.Quantity) * item.UnitPrice
+		totalAmount += item.UnitPrice.Mul(item.Quantity)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -233,14 +250,13 @@ func (h *Handlers) UpdateCartItem(c *gin.Context) {
 	}
 
 	var req services.UpdateCartItemRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	err = h.onlineOrderService.UpdateCartItem(c.Request.Context(), cartItemID, req)
+	err = h.orders.UpdateCartItem(c.Request.Context(), cartItemID, req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -256,9 +272,9 @@ func (h *Handlers) RemoveFromCart(c *gin.Context) {
 		return
 	}
 
-	err = h.onlineOrderService.RemoveFromCart(c.Request.Context(), cartItemID)
+	err = h.orders.RemoveFromCart(c.Request.Context(), cartItemID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -283,9 +299,9 @@ func (h *Handlers) ClearCart(c *gin.Context) {
 		}
 	}
 
-	err := h.onlineOrderService.ClearCart(c.Request.Context(), customerID, sessionID)
+	err := h.orders.ClearCart(c.Request.Context(), customerID, sessionID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
 
@@ -297,8 +313,7 @@ func (h *Handlers) ClearCart(c *gin.Context) {
 // CreateOnlineOrder creates an order from the cart
 func (h *Handlers) CreateOnlineOrder(c *gin.Context) {
 	var req services.CreateOrderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
@@ -322,11 +337,25 @@ func (h *Handlers) CreateOnlineOrder(c *gin.Context) {
 		}
 	}
 
-	order, err := h.onlineOrderService.CreateOrder(c.Request.Context(), req)
+	// Staff place orders for their own branch
+	if branchID := middleware.GetBranchID(c); branchID != nil {
+		req.BranchID = branchID
+	}
+
+	order, err := h.orders.CreateOrder(c.Request.Context(), req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrInsufficientStock) {
+			status = http.StatusConflict
+		}
+		h.respondError(c, status, err)
 		return
 	}
+	h.recordChange(c, "create", "orders", order.ID, nil, order)
+	metrics.OrdersCreated.Inc(orderTypeLabel(order.OrderType))
+	if err := h.campaignService.AttributeOrder(c.Request.Context(), order); err != nil {
+		logrus.WithError(err).Error("Failed to attribute order to campaign")
+	}
 
 	c.JSON(http.StatusCreated, gin.H{
 		"order": order,
@@ -344,7 +373,12 @@ func (h *Handlers) GetOnlineOrder(c *gin.Context) {
 		return
 	}
 
-	order, err := h.onlineOrderService.GetOrder(c.Request.Context(), orderID)
+	selection, ok := h.parseSelection(c, services.OnlineOrderIncludes, services.OrderDetailIncludes...)
+	if !ok {
+		return
+	}
+
+	order, err := h.orders.GetOrderWith(c.Request.Context(), orderID, selection)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
@@ -354,20 +388,25 @@ func (h *Handlers) GetOnlineOrder(c *gin.Context) {
 	if user, exists := middleware.GetCurrentUser(c); exists {
 		if user.Role == models.RoleAssistant || user.Role == models.RolePharmacist {
 			// Staff can see all orders
-		} else if order.CustomerID == nil || *order.CustomerID != user.ID {
+		} else if !orderBelongsTo(order, user.ID) {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 			return
 		}
 	}
 
-	c.JSON(http.StatusOK, order)
+	rendered, ok := h.renderSelection(c, selection, order)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, rendered)
 }
 
-// GetOnlineOrderByNumber retrieves an order by order number
+// GetOnlineOrderByNumber retrieves an order by order number, for staff
+// looking up a receipt
 func (h *Handlers) GetOnlineOrderByNumber(c *gin.Context) {
 	orderNumber := c.Param("number")
 	
-	order, err := h.onlineOrderService.GetOrderByNumber(c.Request.Context(), orderNumber)
+	order, err := h.orders.GetOrderByNumber(c.Request.Context(), orderNumber)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
@@ -376,39 +415,17 @@ func (h *Handlers) GetOnlineOrderByNumber(c *gin.Context) {
 	c.JSON(http.StatusOK, order)
 }
 
-// TrackOrder provides order tracking information
+// TrackOrder provides order tracking information to anyone holding the
+// order's tracking code. Order numbers run in sequence and can be guessed,
+// so they aren't accepted here.
 func (h *Handlers) TrackOrder(c *gin.Context) {
-	orderNumber := c.Param("number")
-	
-	order, err := h.onlineOrderService.GetOrderByNumber(c.Request.Context(), orderNumber)
+	tracking, err := h.orders.TrackOrder(c.Request.Context(), c.Param("code"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
 	}
 
-	// Create tracking response
-	tracking := gin.H{
-		"order_number": order.OrderNumber,
-		"status": order.Status,
-		"order_type": order.OrderType,
-		"created_at": order.CreatedAt,
-		"expected_delivery": order.ExpectedDeliveryDate,
-		"actual_delivery": order.ActualDeliveryDate,
-		"tracking_number": order.TrackingNumber,
-	}
-
-	// Load status history
-	var statusHistory []models.OrderStatusHistory
-	if err := h.db.Where("order_id = ?", order.ID).
-		Preload("User").Order("created_at ASC").
-		Find(&statusHistory).Error; err == nil {
-		tracking["status_history"] = statusHistory
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"tracking": tracking,
-		"order": order,
-	})
+	c.JSON(http.StatusOK, gin.H{"tracking": tracking})
 }
 
 // UpdateOrderStatus updates the status of an order
@@ -421,18 +438,42 @@ func (h *Handlers) UpdateOrderStatus(c *gin.Context) {
 	}
 
 	var req struct {
-		Status string `json:"status" binding:"required"`
-		Reason string `json:"reason"`
+		Status                   string   `json:"status" binding:"required"`
+		Reason                   string   `json:"reason"`
+		AcknowledgedInteractions []string `json:"acknowledged_interactions"`
+		AcknowledgementNotes     string   `json:"acknowledgement_notes"`
+		screeningOverride
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	user, _ := middleware.GetCurrentUser(c)
 
-	err = h.onlineOrderService.UpdateOrderStatus(
+	// Orders are dispensed when marked ready, so interactions must be cleared first
+	if models.OrderStatus(req.Status) == models.OrderStatusReady {
+		if !h.screenOrderInteractions(c, orderID, req.AcknowledgedInteractions, req.AcknowledgementNotes, user.ID) {
+			return
+		}
+	}
+
+	// Allergies and contraindications are checked when the pharmacist verifies
+	// the order and again before it is dispensed
+	switch models.OrderStatus(req.Status) {
+	case models.OrderStatusProcessing, models.OrderStatusReady:
+		if !h.screenOrder(c, orderID, req.screeningOverride, user.ID) {
+			return
+		}
+	}
+
+	var previous models.OnlineOrder
+	if err := h.db.First(&previous, orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	err = h.orders.UpdateOrderStatus(
 		c.Request.Context(),
 		orderID,
 		models.OrderStatus(req.Status),
@@ -440,9 +481,32 @@ func (h *Handlers) UpdateOrderStatus(c *gin.Context) {
 		&user.ID,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		h.respondError(c, http.StatusInternalServerError, err)
 		return
 	}
+	var updated models.OnlineOrder
+	if err := h.db.First(&updated, orderID).Error; err == nil {
+		h.recordChange(c, "update", "orders", orderID, &previous, &updated)
+	}
+
+	// Start the refill clock, award points and ask for feedback once the
+	// medication is in the customer's hands. The purchase was recorded with
+	// the status change.
+	switch models.OrderStatus(req.Status) {
+	case models.OrderStatusDelivered, models.OrderStatusPickedUp:
+		if err := h.refillService.RecordOrderRefills(c.Request.Context(), orderID); err != nil {
+			logrus.WithError(err).Error("Failed to schedule refills for order")
+		}
+		if err := h.loyaltyService.AwardOrder(c.Request.Context(), orderID); err != nil {
+			logrus.WithError(err).Error("Failed to award loyalty points for order")
+		}
+		if err := h.referralService.QualifyOrder(c.Request.Context(), orderID); err != nil {
+			logrus.WithError(err).Error("Failed to settle referral for order")
+		}
+		if _, err := h.feedbackService.RequestOrderFeedback(c.Request.Context(), orderID, &user.ID); err != nil {
+			logrus.WithError(err).Error("Failed to request feedback for order")
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Order status updated successfully"})
 }
@@ -452,11 +516,19 @@ func (h *Handlers) GetOnlineOrders(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
+	// Items are listed without their products unless asked for, with
+	// ?include=order_items.product
+	selection, ok := h.parseSelection(c, services.OnlineOrderIncludes, "customer", "order_items")
+	if !ok {
+		return
+	}
+
 	filters := services.OrderSearchFilters{
 		Status:    c.Query("status"),
 		OrderType: c.Query("order_type"),
 		Limit:     limit,
 		Offset:    offset,
+		Include:   selection,
 	}
 
 	// Parse dates
@@ -491,15 +563,38 @@ func (h *Handlers) GetOnlineOrders(c *gin.Context) {
 		}
 	}
 
-	orders, total, err := h.onlineOrderService.SearchOrders(c.Request.Context(), filters)
+	// ?cursor= (empty for the first page) switches to keyset pagination
+	if cursor, ok := c.GetQuery("cursor"); ok {
+		orders, nextCursor, err := h.orders.SearchOrdersAfter(c.Request.Context(), filters, cursor)
+		if err != nil {
+			h.respondError(c, cursorErrorStatus(err), err)
+			return
+		}
+		rendered, ok := h.renderSelection(c, selection, orders)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"orders":      rendered,
+			"limit":       query.CursorPageSize(limit, 20),
+			"next_cursor": nextCursor,
+		})
+		return
+	}
+
+	orders, total, err := h.orders.SearchOrders(c.Request.Context(), filters)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve orders"})
 		return
 	}
+	rendered, ok := h.renderSelection(c, selection, orders)
+	if !ok {
+		return
+	}
 
 	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, gin.H{
-		"orders": orders,
+		"orders": rendered,
 		"total": total,
 		"limit": limit,
 		"offset": offset,
@@ -518,14 +613,23 @@ func (h *Handlers) GetCustomerOnlineOrders(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
 	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
 
-	orders, err := h.onlineOrderService.GetCustomerOrders(c.Request.Context(), customerID, limit, offset)
+	selection, ok := h.parseSelection(c, services.OnlineOrderIncludes, "order_items")
+	if !ok {
+		return
+	}
+
+	orders, err := h.orders.GetCustomerOrders(c.Request.Context(), customerID, limit, offset, selection)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve customer orders"})
 		return
 	}
+	rendered, ok := h.renderSelection(c, selection, orders)
+	if !ok {
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"orders": orders,
+		"orders": rendered,
 		"customer_id": customerID,
 	})
 }
@@ -533,5 +637,13 @@ func (h *Handlers) GetCustomerOnlineOrders(c *gin.Context) {
 // Add services to handlers (update the existing NewHandlers function)
 func (h *Handlers) initializeAdditionalServices() {
 	h.qrService = services.NewQRService(h.db)
-	h.onlineOrderService = services.NewOnlineOrderService(h.db, h.qrService)
-}
\ No newline at end of file
+	h.onlineOrderService = services.NewOnlineOrderService(h.db, h.qrService, h.outboxService, h.pricingService, h.taxService, h.currencyService, h.stockService, h.numberService)
+}
+
+// orderBelongsTo reports whether the order was placed by or for the customer
+func orderBelongsTo(order *models.OnlineOrder, customerID uuid.UUID) bool {
+	if order.CustomerID != nil && *order.CustomerID == customerID {
+		return true
+	}
+	return order.GuardianID != nil && *order.GuardianID == customerID
+}
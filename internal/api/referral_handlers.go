@@ -0,0 +1,104 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Referral Handlers
+//
+// Every customer has a referral code to pass on. A new customer who signs
+// up with one is recorded as referred, and both are rewarded with points or
+// store credit once the new customer's first order qualifies.
+
+// GetCustomerReferrals returns a customer's referral code, who referred
+// them and how their own referrals went
+func (h *Handlers) GetCustomerReferrals(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	referrals, err := h.referralService.GetCustomerReferrals(c.Request.Context(), customerID)
+	if err != nil {
+		h.respondError(c, referralErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, referrals)
+}
+
+// RecordReferral records the referral code a new customer signed up with
+func (h *Handlers) RecordReferral(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+	var req services.RecordReferralRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	referral, err := h.referralService.Record(c.Request.Context(), customerID, req, user.ID)
+	if err != nil {
+		h.respondError(c, referralErrorStatus(err), err)
+		return
+	}
+	h.recordChange(c, "create", "referral", referral.ID, nil, referral)
+	c.JSON(http.StatusCreated, referral)
+}
+
+// GetReferrals lists referrals, filtered by ?status and ?referrer_id
+func (h *Handlers) GetReferrals(c *gin.Context) {
+	filter := services.ReferralFilter{Status: models.ReferralStatus(c.Query("status"))}
+	if value := c.Query("referrer_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid referrer ID"})
+			return
+		}
+		filter.ReferrerID = &id
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	referrals, total, err := h.referralService.ListReferrals(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"referrals": referrals,
+		"total":     total,
+		"limit":     filter.Limit,
+		"offset":    filter.Offset,
+	})
+}
+
+// GetReferralAnalytics reports how the referrals recorded between
+// ?start_date and ?end_date performed, and who referred the most
+func (h *Handlers) GetReferralAnalytics(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.referralService.Report(c.Request.Context(), services.ReferralReportFilter{From: from, To: to})
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
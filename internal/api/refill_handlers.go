@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Refill Handlers
+
+// GetUpcomingRefills lists refills due soon for pharmacist follow-up
+func (h *Handlers) GetUpcomingRefills(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	refills, total, err := h.refillService.GetUpcomingRefills(c.Request.Context(), days, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve upcoming refills"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"refills": refills,
+		"total":   total,
+		"days":    days,
+		"limit":   limit,
+		"offset":  offset,
+	})
+}
+
+// GetCustomerRefills lists a customer's refill schedule
+func (h *Handlers) GetCustomerRefills(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	refills, err := h.refillService.GetCustomerRefills(c.Request.Context(), customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve refills"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refills": refills})
+}
+
+// CancelRefill stops reminders for a refill
+func (h *Handlers) CancelRefill(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refill ID"})
+		return
+	}
+
+	if err := h.refillService.CancelRefill(c.Request.Context(), id); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Refill cancelled"})
+}
+
+// SendRefillReminders sends due refill reminders immediately. The tag and
+// segment query parameters limit it to targeted customers.
+func (h *Handlers) SendRefillReminders(c *gin.Context) {
+	sent, err := h.refillService.SendDueReminders(c.Request.Context(), targetingFromQuery(c))
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sent": sent})
+}
+
+// ReorderRefill prefills the customer's cart from a reminder link
+func (h *Handlers) ReorderRefill(c *gin.Context) {
+	cartItem, refill, err := h.refillService.Reorder(c.Request.Context(), c.Param("token"))
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"cart_item":   cartItem,
+		"customer_id": refill.CustomerID,
+		"message":     "Refill added to cart",
+	})
+}
+
+// RunRefillReminders sends refill reminders in the background until ctx is done
+func (h *Handlers) RunRefillReminders(ctx context.Context) {
+	h.refillService.RunReminders(ctx)
+}
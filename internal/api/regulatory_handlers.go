@@ -0,0 +1,181 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// maxFDARegistryImportSize caps the size of an uploaded registry CSV; the
+// full dataset runs to tens of megabytes
+const maxFDARegistryImportSize = 200 << 20
+
+// Regulatory Handlers
+
+// GetProductRegulatoryStatus returns a product's FDA registration, recalls
+// and whether it is flagged
+func (h *Handlers) GetProductRegulatoryStatus(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	status, err := h.regulatoryService.ProductStatus(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// SearchFDARegistry searches the local copy of the FDA registry, e.g. to
+// find the registration number of a product being added
+func (h *Handlers) SearchFDARegistry(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	registrations, total, err := h.regulatoryService.SearchRegistry(c.Request.Context(), c.Query("q"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search FDA registry"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{"registrations": registrations, "total": total})
+}
+
+// GetFlaggedProducts lists products that are unregistered, expired,
+// recalled or missing a registration
+func (h *Handlers) GetFlaggedProducts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	products, total, err := h.regulatoryService.FlaggedProducts(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve flagged products"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{"products": products, "total": total})
+}
+
+// RefreshFDARegistry queues a download of the registry dataset instead of
+// waiting for the scheduled one
+func (h *Handlers) RefreshFDARegistry(c *gin.Context) {
+	if !h.regulatoryService.Enabled() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": services.ErrRegistryUnavailable.Error(), "code": middleware.CodeForStatus(http.StatusServiceUnavailable)})
+		return
+	}
+
+	job, err := h.jobService.Enqueue(c.Request.Context(), "fda.registry_refresh", nil)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "create", "jobs", job.ID, nil, job)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// ImportFDARegistry replaces the registry cache with an uploaded CSV export
+// of the FDA dataset, for when the server can't download it itself
+func (h *Handlers) ImportFDARegistry(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxFDARegistryImportSize+(1<<20))
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if strings.ToLower(filepath.Ext(header.Filename)) != ".csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only CSV files are allowed"})
+		return
+	}
+
+	result, err := h.regulatoryService.ImportRegistry(c.Request.Context(), file)
+	if err != nil {
+		if errors.Is(err, services.ErrRegistryEmpty) {
+			h.respondError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetFDARecalls lists recalls, optionally for one registration number
+func (h *Handlers) GetFDARecalls(c *gin.Context) {
+	recalls, err := h.regulatoryService.ListRecalls(c.Request.Context(), c.Query("registration_number"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve recalls"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recalls": recalls})
+}
+
+// CreateFDARecall records a recall from an FDA advisory and flags the
+// products it covers
+func (h *Handlers) CreateFDARecall(c *gin.Context) {
+	var req services.CreateRecallRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	recall, err := h.regulatoryService.CreateRecall(c.Request.Context(), req, user.ID)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRegistration) {
+			h.respondError(c, http.StatusUnprocessableEntity, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "create", "fda_recalls", recall.ID, nil, recall)
+	c.JSON(http.StatusCreated, recall)
+}
+
+// DeleteFDARecall removes a recall entered by staff
+func (h *Handlers) DeleteFDARecall(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recall ID"})
+		return
+	}
+
+	recall, err := h.regulatoryService.DeleteRecall(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "delete", "fda_recalls", recall.ID, recall, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Recall removed"})
+}
+
+// respondRegulatoryError writes the response for a product whose
+// registration number could not be checked
+func (h *Handlers) respondRegulatoryError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidRegistration) {
+		h.respondError(c, http.StatusUnprocessableEntity, err)
+		return
+	}
+	h.respondError(c, http.StatusInternalServerError, err)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Restore Handlers
+
+// RestoreCustomer brings back a soft-deleted customer
+func (h *Handlers) RestoreCustomer(c *gin.Context) {
+	var customer models.Customer
+	h.restore(c, &customer, "customers", "customer")
+}
+
+// RestoreProduct brings back a soft-deleted product
+func (h *Handlers) RestoreProduct(c *gin.Context) {
+	var product models.Product
+	h.restore(c, &product, "products", "product")
+}
+
+// RestoreSupplier brings back a soft-deleted supplier
+func (h *Handlers) RestoreSupplier(c *gin.Context) {
+	var supplier models.Supplier
+	h.restore(c, &supplier, "suppliers", "supplier")
+}
+
+// RestoreService brings back a soft-deleted service
+func (h *Handlers) RestoreService(c *gin.Context) {
+	var service models.Service
+	h.restore(c, &service, "services", "service")
+}
+
+// restore clears deleted_at on the record named by the :id parameter and
+// responds with it. Records that aren't deleted are a 409.
+func (h *Handlers) restore(c *gin.Context, record interface{}, resource, name string) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s ID", name)})
+		return
+	}
+
+	result := h.db.Unscoped().Model(record).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		h.respondError(c, http.StatusInternalServerError, result.Error)
+		return
+	}
+
+	if err := h.db.First(record, "id = ?", id).Error; err != nil {
+		h.respondError(c, http.StatusNotFound, fmt.Errorf("%s not found: %w", name, err))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("The %s is not deleted", name)})
+		return
+	}
+
+	h.recordChange(c, "restore", resource, id, nil, record)
+	c.JSON(http.StatusOK, record)
+}
+
+// deletedFromQuery lists only soft-deleted records when the request asks
+// for ?deleted=true, so they can be found and restored
+func deletedFromQuery(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if c.Query("deleted") != "true" {
+		return query
+	}
+	return query.Unscoped().Where("deleted_at IS NOT NULL")
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSalesAnalytics totals completed sales, product and service lines
+// alike, over ?time_range, such as 7d for the last 7 days, or between
+// ?start_date and ?end_date. Staff limited to a branch see its sales only.
+func (h *Handlers) GetSalesAnalytics(c *gin.Context) {
+	from, to, err := salesAnalyticsPeriod(c, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.salesAnalyticsService.Report(c.Request.Context(), middleware.GetBranchID(c), from, to)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// salesAnalyticsPeriod is the [from, to) the sales analytics cover: the
+// dates given, or the days of ?time_range up to now, 7 by default
+func salesAnalyticsPeriod(c *gin.Context, now time.Time) (time.Time, time.Time, error) {
+	if c.Query("start_date") != "" || c.Query("end_date") != "" {
+		from, to, err := reportDateRange(c)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		if from == nil || to == nil {
+			return time.Time{}, time.Time{}, errors.New("start_date and end_date must be given together")
+		}
+		if !from.Before(*to) {
+			return time.Time{}, time.Time{}, errors.New("end_date is before start_date")
+		}
+		return *from, *to, nil
+	}
+
+	timeRange := c.DefaultQuery("time_range", "7d")
+	days, err := strconv.Atoi(strings.TrimSuffix(timeRange, "d"))
+	if err != nil || !strings.HasSuffix(timeRange, "d") || days < 1 || days > 366 {
+		return time.Time{}, time.Time{}, errors.New("invalid time_range, expected days such as 7d")
+	}
+	return now.AddDate(0, 0, -days), now, nil
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Allergy and Contraindication Screening Handlers
+
+// ScreenCustomerProducts checks products against a customer's allergies and
+// medical history without dispensing anything
+func (h *Handlers) ScreenCustomerProducts(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		ProductIDs []uuid.UUID `json:"product_ids" binding:"required"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	alerts, err := h.screeningService.ScreenProducts(c.Request.Context(), customerID, req.ProductIDs)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts":   alerts,
+		"blocking": len(services.UnresolvedAlerts(alerts, nil)) > 0,
+	})
+}
+
+// screeningOverride is the override-with-reason part of a dispense request
+type screeningOverride struct {
+	Keys   []string `json:"screening_overrides"`
+	Reason string   `json:"override_reason"`
+}
+
+// requireScreeningOverride responds and returns false when a blocking alert
+// has not been overridden, or was overridden without a reason
+func (h *Handlers) requireScreeningOverride(c *gin.Context, alerts []services.ScreeningAlert, override screeningOverride, previous []string) bool {
+	if len(override.Keys) > 0 && strings.TrimSpace(override.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required to override screening alerts"})
+		return false
+	}
+
+	pending := services.UnresolvedAlerts(alerts, append(previous, override.Keys...))
+	if len(pending) == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"error":  "Allergy or contraindication alerts must be overridden with a reason before dispensing",
+		"alerts": pending,
+	})
+	return false
+}
+
+// recordScreeningOverrides stores overrides for a completed dispense. Failures
+// are logged rather than returned since the dispense has already happened.
+func (h *Handlers) recordScreeningOverrides(c *gin.Context, req services.ScreeningOverrideRequest) {
+	if len(services.UnresolvedAlerts(req.Alerts, nil)) == 0 {
+		return
+	}
+	if err := h.screeningService.RecordOverrides(c.Request.Context(), req); err != nil {
+		logrus.WithError(err).Error("Failed to record screening overrides")
+	}
+}
+
+// screenOrder checks an online order's items against the customer's allergies
+// and medical history during pharmacist verification. Guest orders have no
+// medical profile and are not screened.
+func (h *Handlers) screenOrder(c *gin.Context, orderID uuid.UUID, override screeningOverride, userID uuid.UUID) bool {
+	order, err := h.orders.GetOrder(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return false
+	}
+	if order.CustomerID == nil {
+		return true
+	}
+
+	productIDs := make([]uuid.UUID, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	alerts, err := h.screeningService.ScreenProducts(c.Request.Context(), *order.CustomerID, productIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to screen order"})
+		return false
+	}
+
+	previous, err := h.screeningService.GetOrderOverriddenKeys(c.Request.Context(), orderID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to screen order"})
+		return false
+	}
+	if !h.requireScreeningOverride(c, alerts, override, previous) {
+		return false
+	}
+
+	h.recordScreeningOverrides(c, services.ScreeningOverrideRequest{
+		CustomerID: *order.CustomerID,
+		OrderID:    &orderID,
+		Alerts:     services.UnresolvedAlerts(alerts, previous),
+		Reason:     override.Reason,
+		UserID:     userID,
+	})
+	return true
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Security Alert Handlers
+
+// GetSecurityAlerts lists brute-force, lockout, new device and impossible
+// travel alerts, newest first
+func (h *Handlers) GetSecurityAlerts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	filter := auth.SecurityAlertFilter{
+		Type:     c.Query("type"),
+		Severity: c.Query("severity"),
+		Limit:    limit,
+		Offset:   offset,
+	}
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := uuid.Parse(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = &id
+	}
+	if acknowledged := c.Query("acknowledged"); acknowledged != "" {
+		value, err := strconv.ParseBool(acknowledged)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "acknowledged must be true or false"})
+			return
+		}
+		filter.Acknowledged = &value
+	}
+
+	alerts, total, err := h.authService.ListSecurityAlerts(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve security alerts"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// AcknowledgeSecurityAlert marks an alert as reviewed by the current admin
+func (h *Handlers) AcknowledgeSecurityAlert(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+
+	alert, err := h.authService.AcknowledgeSecurityAlert(c.Request.Context(), id, user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// GetUserLoginDevices lists the devices a user has signed in from
+func (h *Handlers) GetUserLoginDevices(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	devices, err := h.authService.LoginDevices(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve login devices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"devices": devices})
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Tag and Segment Handlers
+
+// GetCustomerTags lists a customer's tags
+func (h *Handlers) GetCustomerTags(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	tags, err := h.segmentService.GetCustomerTags(c.Request.Context(), customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// AddCustomerTags attaches tags to a customer
+func (h *Handlers) AddCustomerTags(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req struct {
+		Tags []string `json:"tags" binding:"required,min=1"`
+	}
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	tags, err := h.segmentService.AddTags(c.Request.Context(), customerID, req.Tags, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// RemoveCustomerTag detaches a tag from a customer
+func (h *Handlers) RemoveCustomerTag(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	if err := h.segmentService.RemoveTag(c.Request.Context(), customerID, c.Param("tag")); err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag removed successfully"})
+}
+
+// GetTags lists every tag in use with customer counts
+func (h *Handlers) GetTags(c *gin.Context) {
+	tags, err := h.segmentService.GetTagCounts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// GetSegments lists all customer segments
+func (h *Handlers) GetSegments(c *gin.Context) {
+	segments, err := h.segmentService.ListSegments(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve segments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"segments": segments})
+}
+
+// GetSegment returns a single segment
+func (h *Handlers) GetSegment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	segment, err := h.segmentService.GetSegment(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Segment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, segment)
+}
+
+// CreateSegment defines a new rule-based segment
+func (h *Handlers) CreateSegment(c *gin.Context) {
+	var segment models.Segment
+	if !bindJSON(c, &segment) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	segment.CreatedBy = &user.ID
+
+	if err := h.segmentService.CreateSegment(c.Request.Context(), &segment); err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, segment)
+}
+
+// UpdateSegment changes a segment's name, rule parameters or active flag
+func (h *Handlers) UpdateSegment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	var req services.UpdateSegmentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	segment, err := h.segmentService.UpdateSegment(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, segment)
+}
+
+// DeleteSegment removes a segment
+func (h *Handlers) DeleteSegment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	if err := h.segmentService.DeleteSegment(c.Request.Context(), id); err != nil {
+		h.respondError(c, http.StatusNotFound, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Segment deleted successfully"})
+}
+
+// GetSegmentMembers lists the customers in a segment as of its last refresh
+func (h *Handlers) GetSegmentMembers(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid segment ID"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	customers, total, err := h.segmentService.GetMembers(c.Request.Context(), id, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve segment members"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"customers": customers,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+// RefreshSegments recomputes every segment immediately
+func (h *Handlers) RefreshSegments(c *gin.Context) {
+	refreshed, err := h.segmentService.RefreshAll(c.Request.Context())
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refreshed": refreshed})
+}
+
+// SendPromotion sends a marketing message to the customers matching the
+// given tags and segments who have opted in to marketing
+func (h *Handlers) SendPromotion(c *gin.Context) {
+	var req services.PromotionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	result, err := h.segmentService.SendPromotion(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RunSegmentRefresh recomputes segments in the background until ctx is done
+func (h *Handlers) RunSegmentRefresh(ctx context.Context) {
+	h.segmentService.RunRefresh(ctx)
+}
+
+// targetingFromQuery reads comma-separated tag and segment query parameters
+func targetingFromQuery(c *gin.Context) query.Targeting {
+	return query.Targeting{
+		Tags:     splitQueryList(c.Query("tag")),
+		Segments: splitQueryList(c.Query("segment")),
+	}
+}
+
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/query"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Response Selection
+
+// parseSelection reads ?include= and ?fields= for a response built from
+// includes, embedding defaults when ?include= isn't given. It answers 400
+// itself when they name something the response doesn't have.
+func (h *Handlers) parseSelection(c *gin.Context, includes query.Includes, defaults ...string) (query.Selection, bool) {
+	selection, err := includes.Parse(c.Request.URL.Query(), defaults...)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return query.Selection{}, false
+	}
+	return selection, true
+}
+
+// renderSelection trims value to the fields the request selected. It
+// answers 500 itself when value can't be trimmed.
+func (h *Handlers) renderSelection(c *gin.Context, selection query.Selection, value interface{}) (interface{}, bool) {
+	rendered, err := selection.Render(value)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return rendered, true
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Service Sale Handlers
+
+// CompleteSaleService records a service scheduled on a sale as performed
+func (h *Handlers) CompleteSaleService(c *gin.Context) {
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale ID"})
+		return
+	}
+	itemID, err := uuid.Parse(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sale item ID"})
+		return
+	}
+	var req services.CompleteServiceRequest
+	if c.Request.ContentLength != 0 && !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	item, err := h.serviceSaleService.Complete(c.Request.Context(), saleID, itemID, req, user.ID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Sale item not found"})
+			return
+		}
+		h.respondError(c, serviceSaleErrorStatus(err), err)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// GetServiceAnalytics totals the services sold between ?start_date and
+// ?end_date, and who performed them. Staff limited to a branch see its
+// services only.
+func (h *Handlers) GetServiceAnalytics(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.serviceSaleService.Report(c.Request.Context(), services.ServiceReportFilter{
+		BranchID: middleware.GetBranchID(c),
+		From:     from,
+		To:       to,
+	})
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// SMS Handlers
+
+// GetSMSTemplates lists the SMS templates
+func (h *Handlers) GetSMSTemplates(c *gin.Context) {
+	templates, err := h.smsService.ListTemplates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve SMS templates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// CreateSMSTemplate adds a template, e.g. for an order status that is texted
+// with its built-in wording
+func (h *Handlers) CreateSMSTemplate(c *gin.Context) {
+	var req services.SMSTemplateRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	template, err := h.smsService.CreateTemplate(c.Request.Context(), req, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	h.recordChange(c, "create", "sms_templates", template.ID, nil, template)
+	c.JSON(http.StatusCreated, template)
+}
+
+// UpdateSMSTemplate rewords, activates or deactivates a template
+func (h *Handlers) UpdateSMSTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	var req services.UpdateSMSTemplateRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	template, err := h.smsService.UpdateTemplate(c.Request.Context(), id, req, &user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	h.recordChange(c, "update", "sms_templates", template.ID, nil, template)
+	c.JSON(http.StatusOK, template)
+}
+
+// DeleteSMSTemplate removes a template, so its messages use their built-in
+// wording
+func (h *Handlers) DeleteSMSTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	template, err := h.smsService.DeleteTemplate(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "delete", "sms_templates", template.ID, template, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "SMS template deleted"})
+}
+
+// GetSMSMessages lists sent text messages and their delivery status, newest
+// first, filtered by ?status= and ?customer_id=
+func (h *Handlers) GetSMSMessages(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	var customerID *uuid.UUID
+	if raw := c.Query("customer_id"); raw != "" {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+			return
+		}
+		customerID = &id
+	}
+
+	messages, total, err := h.smsService.ListMessages(c.Request.Context(), c.Query("status"), customerID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve SMS messages"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+// ReceiveTwilioStatus records a delivery receipt Twilio posts to
+// SMS_STATUS_CALLBACK_URL. Requests without a valid X-Twilio-Signature are
+// rejected.
+func (h *Handlers) ReceiveTwilioStatus(c *gin.Context) {
+	if h.config.SMS.StatusCallbackURL == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery receipts are not enabled"})
+		return
+	}
+	if err := c.Request.ParseForm(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid form"})
+		return
+	}
+
+	err := h.smsService.HandleTwilioStatus(c.Request.Context(), h.config.SMS.StatusCallbackURL,
+		c.Request.PostForm, c.GetHeader("X-Twilio-Signature"))
+	switch {
+	case errors.Is(err, services.ErrInvalidSMSSignature):
+		logrus.WithField("ip", c.ClientIP()).Warn("Rejected SMS delivery receipt with an invalid signature")
+		h.respondError(c, http.StatusForbidden, err)
+		return
+	case errors.Is(err, services.ErrSMSUnavailable):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Delivery receipts are not enabled"})
+		return
+	case err != nil:
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SendPhoneVerification texts the customer a one-time code to confirm
+// their phone number
+func (h *Handlers) SendPhoneVerification(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+	user, _ := middleware.GetCurrentUser(c)
+
+	verification, err := h.smsService.SendPhoneVerification(c.Request.Context(), customerID, &user.ID)
+	if err != nil {
+		h.respondSMSError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Verification code sent",
+		"expires_at": verification.ExpiresAt,
+	})
+}
+
+// ConfirmPhoneVerification checks the code the customer received and marks
+// their phone number verified
+func (h *Handlers) ConfirmPhoneVerification(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var req services.ConfirmPhoneVerificationRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	customer, err := h.smsService.ConfirmPhoneVerification(c.Request.Context(), customerID, req.Code)
+	if err != nil {
+		h.respondSMSError(c, err)
+		return
+	}
+
+	h.recordChange(c, "verify_phone", "customers", customer.ID, nil, gin.H{"phone_verified_at": customer.PhoneVerifiedAt})
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "Phone number verified",
+		"phone_verified_at": customer.PhoneVerifiedAt,
+	})
+}
+
+// respondSMSError writes the response for a failed phone verification
+func (h *Handlers) respondSMSError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrSMSUnavailable):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "code": middleware.CodeForStatus(http.StatusServiceUnavailable)})
+	case errors.Is(err, services.ErrVerificationTooSoon), errors.Is(err, services.ErrVerificationLocked):
+		h.respondError(c, http.StatusTooManyRequests, err)
+	case errors.Is(err, services.ErrInvalidPhone), errors.Is(err, services.ErrVerificationNotFound),
+		errors.Is(err, services.ErrVerificationExpired), errors.Is(err, services.ErrVerificationIncorrect):
+		h.respondError(c, http.StatusBadRequest, err)
+	default:
+		h.respondError(c, http.StatusBadGateway, err)
+	}
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Station Handlers
+//
+// The agent beside a paired terminal drives its receipt printer, label
+// printer and cash drawer. It polls for the terminal's jobs with the
+// terminal's device token and reports back how each went; staff queue jobs
+// for a terminal and follow them.
+
+// GetStationJobs lists a terminal's print and drawer jobs, filtered by
+// ?status and ?kind
+func (h *Handlers) GetStationJobs(c *gin.Context) {
+	terminal, ok := h.branchTerminal(c)
+	if !ok {
+		return
+	}
+
+	filter := services.StationJobFilter{
+		TerminalID: terminal.ID,
+		Status:     models.StationJobStatus(c.Query("status")),
+		Kind:       models.StationJobKind(c.Query("kind")),
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	jobs, total, err := h.stationService.ListJobs(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":   jobs,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+// PrintReceipt sends a sale's receipt to the terminal's receipt printer
+func (h *Handlers) PrintReceipt(c *gin.Context) {
+	terminal, ok := h.branchTerminal(c)
+	if !ok {
+		return
+	}
+	var req services.ReceiptJobRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	job, err := h.stationService.QueueReceipt(c.Request.Context(), terminal, req, user.ID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// PrintStationLabels sends the dispensing labels of a sale or online order
+// to the terminal's label printer
+func (h *Handlers) PrintStationLabels(c *gin.Context) {
+	terminal, ok := h.branchTerminal(c)
+	if !ok {
+		return
+	}
+	var req services.LabelJobRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	job, err := h.stationService.QueueLabels(c.Request.Context(), terminal, req, user.ID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+// OpenCashDrawer opens the terminal's cash drawer without a sale. Every
+// opening is kept in the audit log with its reason.
+func (h *Handlers) OpenCashDrawer(c *gin.Context) {
+	terminal, ok := h.branchTerminal(c)
+	if !ok {
+		return
+	}
+	var req services.OpenDrawerRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	job, err := h.stationService.OpenDrawer(c.Request.Context(), terminal, req, user.ID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "open_drawer", "terminals", terminal.ID, nil, job)
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *Handlers) GetStationJob(c *gin.Context) {
+	job, ok := h.branchStationJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelStationJob withdraws a job the station hasn't taken yet
+func (h *Handlers) CancelStationJob(c *gin.Context) {
+	job, ok := h.branchStationJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.stationService.Cancel(c.Request.Context(), job.ID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryStationJob sends a job that failed or expired to the station again
+func (h *Handlers) RetryStationJob(c *gin.Context) {
+	job, ok := h.branchStationJob(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.stationService.Retry(c.Request.Context(), job.ID)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ClaimStationJobs hands a station agent the jobs due on its terminal. The
+// agent polls again after poll_after seconds, sooner when it was handed a
+// full batch.
+func (h *Handlers) ClaimStationJobs(c *gin.Context) {
+	terminal, ok := h.stationTerminal(c)
+	if !ok {
+		return
+	}
+
+	work, err := h.stationService.Claim(c.Request.Context(), terminal)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":       work,
+		"poll_after": int(h.stationService.PollInterval().Seconds()),
+	})
+}
+
+// ReportStationJob records whether the station printed a job, or opened
+// the drawer
+func (h *Handlers) ReportStationJob(c *gin.Context) {
+	terminal, ok := h.stationTerminal(c)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(c.Param("jobId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+	var req services.StationJobResult
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	job, err := h.stationService.Report(c.Request.Context(), terminal, id, req)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// branchTerminal loads the terminal in the :id parameter, which staff
+// limited to a branch can only use if it is theirs. It reports false when
+// it rejected the request.
+func (h *Handlers) branchTerminal(c *gin.Context) (*models.Terminal, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return nil, false
+	}
+
+	terminal, err := h.terminalService.GetTerminal(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return nil, false
+	}
+	if !h.inStaffBranch(c, terminal.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return nil, false
+	}
+	return terminal, true
+}
+
+// branchStationJob loads the job in the :jobId parameter, checking it is
+// for a terminal of the staff member's branch
+func (h *Handlers) branchStationJob(c *gin.Context) (*models.StationJob, bool) {
+	id, err := uuid.Parse(c.Param("jobId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return nil, false
+	}
+
+	job, err := h.stationService.GetJob(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, stationErrorStatus(err), err)
+		return nil, false
+	}
+	if !h.inStaffBranch(c, job.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return nil, false
+	}
+	return job, true
+}
+
+// inStaffBranch reports whether the staff member may act in branchID:
+// admins anywhere, others only in the branch they work in if they have one
+func (h *Handlers) inStaffBranch(c *gin.Context, branchID uuid.UUID) bool {
+	user, _ := middleware.GetCurrentUser(c)
+	staffBranch := middleware.GetBranchID(c)
+	return staffBranch == nil || *staffBranch == branchID || user.Role == models.RoleAdmin
+}
+
+// stationTerminal authenticates a station agent by its terminal's device
+// token. It reports false when it rejected the request.
+func (h *Handlers) stationTerminal(c *gin.Context) (*models.Terminal, bool) {
+	terminal, err := h.terminalService.Authenticate(c.Request.Context(), c.GetHeader(terminalTokenHeader), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrTerminalUnknown) {
+			h.respondError(c, http.StatusUnauthorized, err)
+			return nil, false
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	return terminal, true
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Stream Handlers
+
+// streamHeartbeat is how often an idle stream sends a comment, so proxies
+// and load balancers don't close it
+const streamHeartbeat = 25 * time.Second
+
+// streamRetry is how long, in milliseconds, a browser waits before it
+// reconnects a dropped stream
+const streamRetry = 3000
+
+// topicPermissions is the permission a role needs to subscribe to a topic
+var topicPermissions = map[realtime.Topic]struct{ resource, action string }{
+	realtime.TopicOrderStatus: {"sales", "read"},
+	realtime.TopicNewOrders:   {"sales", "read"},
+	realtime.TopicStock:       {"products", "read"},
+	realtime.TopicStationJobs: {"sales", "read"},
+}
+
+// Stream sends order status changes, new online orders, stock levels and
+// print job updates as server-sent events while the connection stays open.
+// ?topics= is a comma-separated list; without it the stream carries every
+// topic the user's role may see. Staff working in a branch only get its events.
+func (h *Handlers) Stream(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+	topics, err := h.streamTopics(user.Role, c.Query("topics"))
+	if err != nil {
+		status := http.StatusForbidden
+		if errors.Is(err, realtime.ErrUnknownTopic) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"error": err.Error(),
+			"code":  middleware.CodeForStatus(status),
+		})
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		logrus.WithError(err).Debug("Failed to lift the write deadline of a stream")
+	}
+
+	sub := h.events.Subscribe(topics, middleware.GetBranchID(c))
+	defer h.events.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Topic, data)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// RunRealtimeEvents passes on events published by other instances to this
+// instance's streams until ctx is done
+func (h *Handlers) RunRealtimeEvents(ctx context.Context) {
+	h.events.Run(ctx)
+}
+
+// CloseStreams ends the open event streams, which would otherwise hold up
+// a graceful shutdown until it times out
+func (h *Handlers) CloseStreams() {
+	h.events.Close()
+}
+
+// streamTopics returns the topics asked for, or all the role may see when
+// none are. Asking for a topic the role may not see is an error.
+func (h *Handlers) streamTopics(role models.UserRole, requested string) ([]realtime.Topic, error) {
+	if strings.TrimSpace(requested) == "" {
+		var topics []realtime.Topic
+		for _, topic := range realtime.Topics {
+			permission := topicPermissions[topic]
+			if h.authService.CheckPermission(role, permission.resource, permission.action) {
+				topics = append(topics, topic)
+			}
+		}
+		if len(topics) == 0 {
+			return nil, errors.New("no topics are available to your role")
+		}
+		return topics, nil
+	}
+
+	var topics []realtime.Topic
+	for _, name := range strings.Split(requested, ",") {
+		topic, err := realtime.ParseTopic(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		permission := topicPermissions[topic]
+		if !h.authService.CheckPermission(role, permission.resource, permission.action) {
+			return nil, fmt.Errorf("not allowed to subscribe to %s", topic)
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Sync Conflict Handlers
+
+// GetSyncConflicts lists rows changed in two databases between syncs,
+// filtered by ?status= and ?table=
+func (h *Handlers) GetSyncConflicts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	conflicts, total, err := h.syncConflictService.ListConflicts(c.Request.Context(), c.Query("status"), c.Query("table"), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve sync conflicts"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"conflicts": conflicts,
+		"total":     total,
+		"limit":     limit,
+		"offset":    offset,
+	})
+}
+
+func (h *Handlers) GetSyncConflict(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conflict ID"})
+		return
+	}
+
+	conflict, err := h.syncConflictService.GetConflict(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, conflict)
+}
+
+// ResolveSyncConflict accepts the automatic resolution of a conflict or
+// reverts to the version it discarded
+func (h *Handlers) ResolveSyncConflict(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conflict ID"})
+		return
+	}
+
+	var req services.ResolveSyncConflictRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+
+	conflict, err := h.syncConflictService.ResolveConflict(c.Request.Context(), id, user.ID, req)
+	if err != nil {
+		if errors.Is(err, services.ErrSyncConflictReviewed) {
+			h.respondError(c, http.StatusConflict, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "resolve", "sync_conflicts", conflict.ID, nil, conflict)
+	c.JSON(http.StatusOK, conflict)
+}
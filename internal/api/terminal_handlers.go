@@ -0,0 +1,220 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// terminalTokenHeader carries the device token a paired POS terminal got
+// when it paired
+const terminalTokenHeader = "X-Terminal-Token"
+
+// POS Terminal Handlers
+
+// GetTerminals lists terminals, for one branch with ?branch_id
+func (h *Handlers) GetTerminals(c *gin.Context) {
+	var branchID *uuid.UUID
+	if value := c.Query("branch_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch ID"})
+			return
+		}
+		branchID = &id
+	}
+
+	terminals, err := h.terminalService.ListTerminals(c.Request.Context(), branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve terminals"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"terminals": terminals})
+}
+
+func (h *Handlers) CreateTerminal(c *gin.Context) {
+	var req services.TerminalRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	terminal, err := h.terminalService.CreateTerminal(c.Request.Context(), req)
+	if err != nil {
+		h.respondError(c, terminalErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "create", "terminals", terminal.ID, nil, terminal)
+	c.JSON(http.StatusCreated, terminal)
+}
+
+func (h *Handlers) UpdateTerminal(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	var req services.TerminalRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	terminal, err := h.terminalService.UpdateTerminal(c.Request.Context(), id, req)
+	if err != nil {
+		h.respondError(c, terminalErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "update", "terminals", terminal.ID, nil, terminal)
+	c.JSON(http.StatusOK, terminal)
+}
+
+// StartTerminalPairing issues the one-time code to enter on the device
+// being paired with the terminal
+func (h *Handlers) StartTerminalPairing(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	code, expiresAt, err := h.terminalService.StartPairing(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "start_pairing", "terminals", id, nil, gin.H{"expires_at": expiresAt})
+	c.JSON(http.StatusOK, gin.H{
+		"pairing_code": code,
+		"expires_at":   expiresAt,
+	})
+}
+
+// UnpairTerminal forgets the device paired with a terminal, such as a lost
+// or replaced one
+func (h *Handlers) UnpairTerminal(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	if err := h.terminalService.Unpair(c.Request.Context(), id); err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "unpair", "terminals", id, nil, nil)
+	c.Status(http.StatusNoContent)
+}
+
+// PairTerminal redeems a pairing code on the device. The device keeps the
+// returned token and sends it in X-Terminal-Token.
+func (h *Handlers) PairTerminal(c *gin.Context) {
+	var req services.PairTerminalRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	terminal, token, err := h.terminalService.Pair(c.Request.Context(), req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrPairingCodeInvalid) {
+			h.respondError(c, http.StatusUnauthorized, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"terminal":     terminal,
+		"device_token": token,
+	})
+}
+
+// TerminalHeartbeat lets a paired terminal report in between sales
+func (h *Handlers) TerminalHeartbeat(c *gin.Context) {
+	terminal, err := h.terminalService.Authenticate(c.Request.Context(), c.GetHeader(terminalTokenHeader), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrTerminalUnknown) {
+			h.respondError(c, http.StatusUnauthorized, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, terminal)
+}
+
+// GetTerminalZReport totals a terminal's sales for ?date (YYYY-MM-DD,
+// today by default). Staff can only read their own branch's terminals.
+func (h *Handlers) GetTerminalZReport(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	day := time.Now().UTC()
+	if value := c.Query("date"); value != "" {
+		if day, err = time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, use YYYY-MM-DD"})
+			return
+		}
+	}
+
+	report, err := h.terminalService.ZReport(c.Request.Context(), id, day)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	if branchID := middleware.GetBranchID(c); branchID != nil && *branchID != report.Terminal.BranchID && user.Role != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// saleTerminal returns the paired terminal a sale is being rung up on, or
+// nil for a sale made without one. It reports false when it rejected the
+// request.
+func (h *Handlers) saleTerminal(c *gin.Context) (*models.Terminal, bool) {
+	token := c.GetHeader(terminalTokenHeader)
+	if token == "" {
+		return nil, true
+	}
+
+	terminal, err := h.terminalService.Authenticate(c.Request.Context(), token, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrTerminalUnknown) {
+			h.respondError(c, http.StatusUnauthorized, err)
+			return nil, false
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	if branchID := middleware.GetBranchID(c); branchID != nil && *branchID != terminal.BranchID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Terminal belongs to another branch"})
+		return nil, false
+	}
+	return terminal, true
+}
+
+// terminalErrorStatus is the status for an error saving a terminal
+func terminalErrorStatus(err error) int {
+	if errors.Is(err, services.ErrBranchInactive) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,228 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Time Clock Handlers
+
+// GetMyShift returns the signed in employee's open shift, or null when they
+// are off the clock
+func (h *Handlers) GetMyShift(c *gin.Context) {
+	user, _ := middleware.GetCurrentUser(c)
+	shift, err := h.timeClockService.CurrentShift(c.Request.Context(), user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shift": shift})
+}
+
+// ClockIn starts the signed in employee's shift, at a register's drawer
+// when terminal_id is given
+func (h *Handlers) ClockIn(c *gin.Context) {
+	var req services.ClockInRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	shift, err := h.timeClockService.ClockIn(c.Request.Context(), user.ID, middleware.GetBranchID(c), req, models.ClockSession)
+	if err != nil {
+		h.respondError(c, timeClockErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "clock_in", "shifts", shift.ID, nil, shift)
+	c.JSON(http.StatusCreated, shift)
+}
+
+func (h *Handlers) ClockOut(c *gin.Context) {
+	var req services.ClockOutRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	shift, err := h.timeClockService.ClockOut(c.Request.Context(), user.ID, req, models.ClockSession)
+	if err != nil {
+		h.respondError(c, timeClockErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "clock_out", "shifts", shift.ID, nil, shift)
+	c.JSON(http.StatusOK, shift)
+}
+
+// BadgeClock clocks an employee in or out with the personal QR badge they
+// scanned at a paired register. The register authenticates with its
+// device token; the employee needs no session.
+func (h *Handlers) BadgeClock(c *gin.Context) {
+	terminal, ok := h.stationTerminal(c)
+	if !ok {
+		return
+	}
+	var req services.BadgeClockRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	shift, clockedIn, err := h.timeClockService.BadgeClock(c.Request.Context(), terminal, req, services.ScanContext{
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.GetHeader("User-Agent"),
+		ScanMethod: "pos",
+		Location:   terminal.Name,
+	})
+	if err != nil {
+		h.respondError(c, timeClockErrorStatus(err), err)
+		return
+	}
+
+	action, status := "clock_out", http.StatusOK
+	if clockedIn {
+		action, status = "clock_in", http.StatusCreated
+	}
+	h.recordChange(c, action, "shifts", shift.ID, nil, shift)
+	c.JSON(status, gin.H{"action": action, "shift": shift})
+}
+
+// IssueEmployeeBadge issues an employee a new personal QR badge for the
+// time clock. Their previous badge stops working.
+func (h *Handlers) IssueEmployeeBadge(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	badge, err := h.timeClockService.IssueBadge(c.Request.Context(), id, user.ID)
+	if err != nil {
+		h.respondError(c, timeClockErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "issue_badge", "users", id, nil, gin.H{"qr_code_id": badge.ID})
+	c.JSON(http.StatusCreated, badge)
+}
+
+// GetShifts lists shifts, at the staff member's branch for branch staff
+func (h *Handlers) GetShifts(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter := services.ShiftFilter{
+		BranchID: middleware.GetBranchID(c),
+		From:     from,
+		To:       to,
+	}
+	for param, target := range map[string]**uuid.UUID{"user_id": &filter.UserID, "terminal_id": &filter.TerminalID} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param})
+				return
+			}
+			*target = &id
+		}
+	}
+	if open := c.Query("open"); open != "" {
+		isOpen := open == "true"
+		filter.Open = &isOpen
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	shifts, total, err := h.timeClockService.ListShifts(c.Request.Context(), filter)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"shifts": shifts,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+func (h *Handlers) GetShift(c *gin.Context) {
+	shift, ok := h.loadShift(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// CloseShift ends a shift the employee forgot to clock out of, with the
+// manager's count of its drawer
+func (h *Handlers) CloseShift(c *gin.Context) {
+	previous, ok := h.loadShift(c)
+	if !ok {
+		return
+	}
+	var req services.ClockOutRequest
+	if !bindStrictJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	shift, err := h.timeClockService.CloseShift(c.Request.Context(), previous.ID, req, user.ID)
+	if err != nil {
+		h.respondError(c, timeClockErrorStatus(err), err)
+		return
+	}
+
+	h.recordChange(c, "close", "shifts", shift.ID, previous, shift)
+	c.JSON(http.StatusOK, shift)
+}
+
+// GetStaffProductivity reports each employee's hours and the sales,
+// verifications, compounding and picking they did in them
+func (h *Handlers) GetStaffProductivity(c *gin.Context) {
+	from, to, err := reportDateRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.timeClockService.Productivity(c.Request.Context(), middleware.GetBranchID(c), from, to)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// loadShift loads the shift in the path with its sales. Staff limited to a
+// branch only see its shifts.
+func (h *Handlers) loadShift(c *gin.Context) (*services.ShiftView, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shift ID"})
+		return nil, false
+	}
+
+	shift, err := h.timeClockService.GetShiftView(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, timeClockErrorStatus(err), err)
+		return nil, false
+	}
+	if shift.BranchID != nil && !h.inStaffBranch(c, *shift.BranchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shift not found"})
+		return nil, false
+	}
+	return shift, true
+}
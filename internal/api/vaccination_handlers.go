@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/middleware"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Vaccination Handlers
+
+// RecordVaccination records a vaccine dose administered to a customer
+func (h *Handlers) RecordVaccination(c *gin.Context) {
+	var req services.RecordVaccinationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, _ := middleware.GetCurrentUser(c)
+	record, err := h.vaccinationService.RecordAdministration(c.Request.Context(), req, user.ID)
+	if err != nil {
+		h.respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, record)
+}
+
+// GetVaccination returns a single vaccination record
+func (h *Handlers) GetVaccination(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vaccination ID"})
+		return
+	}
+
+	record, err := h.vaccinationService.GetRecord(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vaccination record not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, record)
+}
+
+// GetCustomerVaccinations lists a customer's vaccination history
+func (h *Handlers) GetCustomerVaccinations(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	records, err := h.vaccinationService.GetCustomerVaccinations(c.Request.Context(), customerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve vaccinations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vaccinations": records})
+}
+
+// GetVaccinationCertificate returns the certificate as PDF, or as JSON with
+// ?format=json for apps that render the QR code themselves
+func (h *Handlers) GetVaccinationCertificate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vaccination ID"})
+		return
+	}
+
+	cert, err := h.vaccinationService.Certificate(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vaccination record not found"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "pdf") {
+	case "pdf":
+		c.Header("Content-Disposition", "inline; filename=\"vaccination-certificate-"+cert.VerificationCode+".pdf\"")
+		c.Data(http.StatusOK, "application/pdf", labels.RenderCertificatePDF(*cert))
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"certificate": cert,
+			"qr_code":     cert.VerificationCode,
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported format, use pdf or json"})
+	}
+}
+
+// GetDueVaccinations lists next doses due soon for staff follow-up
+func (h *Handlers) GetDueVaccinations(c *gin.Context) {
+	days, _ := strconv.Atoi(c.DefaultQuery("days", "7"))
+
+	records, err := h.vaccinationService.GetDueDoses(c.Request.Context(), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve due vaccinations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"vaccinations": records,
+		"days":         days,
+	})
+}
+
+// SendVaccinationReminders sends due next-dose reminders immediately. The tag
+// and segment query parameters limit it to targeted customers.
+func (h *Handlers) SendVaccinationReminders(c *gin.Context) {
+	sent, err := h.vaccinationService.SendDueDoseReminders(c.Request.Context(), targetingFromQuery(c))
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sent": sent})
+}
+
+// RunVaccinationReminders sends next-dose reminders in the background until
+// ctx is done
+func (h *Handlers) RunVaccinationReminders(ctx context.Context) {
+	h.vaccinationService.RunReminders(ctx)
+}
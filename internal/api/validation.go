@@ -0,0 +1,286 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"pharmacy-backend/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Request Validation
+
+func init() {
+	binding.Validator = newRequestValidator()
+}
+
+// FieldError describes one invalid field of a request body. Field is the
+// JSON path, e.g. items[0].quantity.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// fieldErrors is returned by the request validator when fields fail their
+// tags
+type fieldErrors []FieldError
+
+func (e fieldErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// requestValidator replaces gin's default validator so that binding checks
+// the `validate` tags on models and service request types as well as the
+// usual `binding` tags
+type requestValidator struct {
+	binding  *validator.Validate
+	validate *validator.Validate
+}
+
+func newRequestValidator() *requestValidator {
+	v := &requestValidator{binding: validator.New(), validate: validator.New()}
+	v.binding.SetTagName("binding")
+	v.validate.SetTagName("validate")
+	for _, engine := range []*validator.Validate{v.binding, v.validate} {
+		engine.RegisterTagNameFunc(jsonFieldName)
+		engine.RegisterValidation("phone", validatePhone)
+	}
+	return v
+}
+
+func (v *requestValidator) ValidateStruct(obj interface{}) error {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		var failed fieldErrors
+		for _, engine := range []*validator.Validate{v.binding, v.validate} {
+			err := engine.Struct(obj)
+			var errs validator.ValidationErrors
+			if errors.As(err, &errs) {
+				for _, fe := range errs {
+					failed = append(failed, FieldError{
+						Field:   fieldPath(fe, value.Type().Name()),
+						Rule:    fe.Tag(),
+						Message: validationMessage(fe),
+					})
+				}
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(failed) > 0 {
+			return failed
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if err := v.ValidateStruct(value.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *requestValidator) Engine() interface{} {
+	return v.binding
+}
+
+// bindJSON binds the request body into obj and validates it, writing a 400
+// with the failing fields if either step fails
+func bindJSON(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		respondBindError(c, err)
+		return false
+	}
+	return true
+}
+
+// bindStrictJSON is bindJSON for security-sensitive endpoints: fields the
+// request type doesn't declare are rejected instead of silently ignored, so
+// a client can't slip in fields a later change starts trusting
+func bindStrictJSON(c *gin.Context, obj interface{}) bool {
+	decoder := json.NewDecoder(c.Request.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(obj)
+	if err == nil {
+		err = binding.Validator.ValidateStruct(obj)
+	}
+	if err != nil {
+		respondBindError(c, err)
+		return false
+	}
+	return true
+}
+
+// respondBindError reports a binding failure, listing each invalid field
+// when the error can be traced to one
+func respondBindError(c *gin.Context, err error) {
+	var fields fieldErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+
+	switch {
+	case errors.As(err, &fields):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "code": middleware.CodeValidationFailed, "fields": fields})
+	case errors.As(err, &typeErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Validation failed",
+			"code":  middleware.CodeValidationFailed,
+			"fields": []FieldError{{
+				Field:   typeErr.Field,
+				Rule:    "type",
+				Message: "must be " + jsonTypeName(typeErr.Type),
+			}},
+		})
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Validation failed",
+			"code":   middleware.CodeValidationFailed,
+			"fields": []FieldError{{Field: field, Rule: "unknown", Message: "is not a recognised field"}},
+		})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed JSON request body"})
+	case errors.Is(err, io.EOF):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body is required"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+// jsonFieldName names struct fields after their JSON keys in errors.
+// Embedded structs have their fields promoted in JSON, so they are marked to
+// be dropped from the path.
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "" && field.Anonymous {
+		return embeddedFieldName
+	}
+	return name
+}
+
+const embeddedFieldName = "_"
+
+// fieldPath turns a validator namespace such as CreateOrderRequest._.items[0].quantity
+// into the JSON path items[0].quantity. Anonymous request structs have no
+// type name in front.
+func fieldPath(fe validator.FieldError, rootType string) string {
+	parts := strings.Split(fe.Namespace(), ".")
+	if rootType != "" {
+		parts = parts[1:]
+	}
+	path := parts[:0]
+	for _, part := range parts {
+		if part != embeddedFieldName {
+			path = append(path, part)
+		}
+	}
+	return strings.Join(path, ".")
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "phone":
+		return "must be a valid phone number"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min":
+		if unit := lengthUnit(fe.Kind()); unit != "" {
+			return fmt.Sprintf("must have at least %s %s", fe.Param(), unit)
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if unit := lengthUnit(fe.Kind()); unit != "" {
+			return fmt.Sprintf("must have at most %s %s", fe.Param(), unit)
+		}
+		return "must be at most " + fe.Param()
+	case "len":
+		if unit := lengthUnit(fe.Kind()); unit != "" {
+			return fmt.Sprintf("must have exactly %s %s", fe.Param(), unit)
+		}
+		return "must be " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be at least " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	case "lte":
+		return "must be at most " + fe.Param()
+	default:
+		return "failed " + fe.Tag() + " validation"
+	}
+}
+
+// lengthUnit is what min, max and len count for kinds where they are lengths
+func lengthUnit(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return "items"
+	}
+	return ""
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// validatePhone accepts 7 to 15 digits with an optional leading + and the
+// usual separators, e.g. +63 917 123 4567 or (02) 8123-4567
+func validatePhone(fl validator.FieldLevel) bool {
+	value := strings.TrimSpace(fl.Field().String())
+	value = strings.TrimPrefix(value, "+")
+	digits := 0
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return false
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
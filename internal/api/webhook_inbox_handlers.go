@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+// Webhook Inbox Handlers
+
+// ReceiveWebhook takes an event posted by a third-party integration. It is
+// stored and acknowledged straight away, and processed in the background;
+// a repeat of an event already received is acknowledged again.
+func (h *Handlers) ReceiveWebhook(c *gin.Context) {
+	integration := c.Param("integration")
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	event, duplicate, err := h.webhookInboxService.Receive(c.Request.Context(), integration, c.Request.Header, body, c.ClientIP())
+	switch {
+	case errors.Is(err, services.ErrUnknownIntegration):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown integration"})
+		return
+	case errors.Is(err, services.ErrInvalidWebhookSignature), errors.Is(err, services.ErrStaleWebhook):
+		logrus.WithError(err).WithFields(logrus.Fields{"integration": integration, "ip": c.ClientIP()}).
+			Warn("Rejected inbound webhook")
+		h.respondError(c, http.StatusForbidden, err)
+		return
+	case err != nil:
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusAccepted
+	if duplicate {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"id": event.ID, "duplicate": duplicate})
+}
+
+// GetInboundWebhooks lists received events, newest first, filtered by
+// ?integration=, ?event_type= and ?status=
+func (h *Handlers) GetInboundWebhooks(c *gin.Context) {
+	filter := services.InboundWebhookFilter{
+		Integration: c.Query("integration"),
+		EventType:   c.Query("event_type"),
+		Status:      models.InboundWebhookStatus(c.Query("status")),
+	}
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "50"))
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	events, total, err := h.webhookInboxService.List(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve inbound webhooks"})
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	c.JSON(http.StatusOK, gin.H{
+		"events":       events,
+		"total":        total,
+		"integrations": h.webhookInboxService.Integrations(),
+	})
+}
+
+// GetInboundWebhook returns a received event with its payload
+func (h *Handlers) GetInboundWebhook(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := h.webhookInboxService.Get(c.Request.Context(), id)
+	if err != nil {
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, event)
+}
+
+// ReplayInboundWebhook processes a received event again
+func (h *Handlers) ReplayInboundWebhook(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	event, err := h.webhookInboxService.Replay(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, services.ErrWebhookQueued) {
+			h.respondError(c, http.StatusConflict, err)
+			return
+		}
+		h.respondError(c, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.recordChange(c, "replay", "inbound_webhooks", event.ID, nil, gin.H{
+		"integration": event.Integration,
+		"event_id":    event.EventID,
+		"event_type":  event.EventType,
+	})
+	c.JSON(http.StatusAccepted, gin.H{"id": event.ID, "status": event.Status})
+}
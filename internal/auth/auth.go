@@ -2,17 +2,21 @@ package auth
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"time"
 
+	"pharmacy-backend/internal/alerting"
 	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/kvstore"
 	"pharmacy-backend/internal/models"
 	"pharmacy-backend/internal/utils"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -30,9 +34,17 @@ var (
 
 type AuthService struct {
 	db     *gorm.DB
-	redis  *redis.Client
+	store  kvstore.Store // revoked sessions and login counters
 	config *config.Config
 	logger *logrus.Logger
+
+	captcha       CaptchaVerifier
+	geoLocator    GeoLocator
+	alertNotifier AlertNotifier
+	alerts        *alerting.Notifier
+	networkPolicy networkPolicy
+
+	bootstrap bootstrapState
 }
 
 type JWTClaims struct {
@@ -41,19 +53,24 @@ type JWTClaims struct {
 	Email     string          `json:"email"`
 	Role      models.UserRole `json:"role"`
 	SessionID string          `json:"session_id"`
+	BranchID  *uuid.UUID      `json:"branch_id,omitempty"` // the user's branch when the token was issued
 	jwt.RegisteredClaims
 }
 
 type LoginRequest struct {
-	Username string `json:"username" validate:"required,min=3,max=50"`
-	Password string `json:"password" validate:"required,min=6"`
+	Username     string `json:"username" validate:"required,min=3,max=50"`
+	Password     string `json:"password" validate:"required,min=6"`
+	CaptchaToken string `json:"captcha_token,omitempty" validate:"omitempty,max=4096"` // required after repeated failures
+	DeviceID     string `json:"device_id,omitempty" validate:"omitempty,max=100"`      // stable client-generated ID, for new device alerts
 }
 
 type LoginResponse struct {
-	AccessToken  string        `json:"access_token"`
-	RefreshToken string        `json:"refresh_token"`
+	AccessToken  string        `json:"access_token,omitempty"`  // left out for cookie sessions
+	RefreshToken string        `json:"refresh_token,omitempty"` // left out for cookie sessions
+	CSRFToken    string        `json:"csrf_token,omitempty"`    // cookie sessions only
 	ExpiresIn    int           `json:"expires_in"`
 	User         *models.User  `json:"user"`
+	SessionID    string        `json:"-"`
 }
 
 type ChangePasswordRequest struct {
@@ -61,29 +78,54 @@ type ChangePasswordRequest struct {
 	NewPassword     string `json:"new_password" validate:"required,min=8"`
 }
 
-func NewAuthService(db *gorm.DB, redis *redis.Client, config *config.Config) *AuthService {
+func NewAuthService(db *gorm.DB, store kvstore.Store, config *config.Config) *AuthService {
 	return &AuthService{
 		db:     db,
-		redis:  redis,
+		store:  store,
 		config: config,
-		logger: logrus.New(),
+		logger: logrus.StandardLogger(),
+
+		captcha:       NewCaptchaVerifier(config.LoginGuard),
+		geoLocator:    NewGeoLocator(config.LoginGuard),
+		networkPolicy: newNetworkPolicy(config.Network),
 	}
 }
 
 // Login authenticates a user and returns JWT tokens
 func (s *AuthService) Login(ctx context.Context, req LoginRequest, clientIP, userAgent string) (*LoginResponse, error) {
-	// Input sanitization
-	req.Username = utils.SanitizeInput(req.Username)
+	// Usernames are matched exactly, only stray whitespace and control
+	// characters are removed
+	req.Username = utils.NormalizeText(req.Username)
 	
+	// Addresses with too many recent failures are refused outright
+	if s.isIPBlocked(ctx, clientIP) {
+		s.logFailedLogin(req.Username, clientIP, "ip blocked")
+		return nil, ErrTooManyAttempts
+	}
+
 	// Find user by username or email
 	var user models.User
-	if err := s.db.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			s.logFailedLogin(req.Username, clientIP, "user not found")
-			return nil, ErrInvalidCredentials
-		}
+	err := s.db.Where("username = ? OR email = ?", req.Username, req.Username).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, fmt.Errorf("database error: %w", err)
 	}
+	found := err == nil
+
+	// Ask for a CAPTCHA before checking the password once the address or the
+	// account has failed repeatedly
+	if err := s.checkCaptcha(ctx, req.CaptchaToken, clientIP, user.FailedLoginAttempts); err != nil {
+		if err == ErrCaptchaInvalid {
+			s.recordIPFailure(ctx, clientIP, req.Username)
+		}
+		s.logFailedLogin(req.Username, clientIP, err.Error())
+		return nil, err
+	}
+
+	if !found {
+		s.recordIPFailure(ctx, clientIP, req.Username)
+		s.logFailedLogin(req.Username, clientIP, "user not found")
+		return nil, ErrInvalidCredentials
+	}
 
 	// Check if account is disabled
 	if !user.IsActive {
@@ -103,17 +145,23 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest, clientIP, use
 		if err := s.incrementFailedLoginAttempts(ctx, &user, clientIP); err != nil {
 			s.logger.WithError(err).Error("Failed to increment login attempts")
 		}
+		s.recordIPFailure(ctx, clientIP, user.Username)
 		s.logFailedLogin(req.Username, clientIP, "invalid password")
 		return nil, ErrInvalidCredentials
 	}
 
+	// Roles restricted to the pharmacy network or some countries
+	if err := s.checkLoginLocation(ctx, &user, clientIP, userAgent); err != nil {
+		return nil, err
+	}
+
 	// Reset failed login attempts on successful login
 	if err := s.resetFailedLoginAttempts(ctx, &user); err != nil {
 		s.logger.WithError(err).Error("Failed to reset login attempts")
 	}
 
 	// Generate tokens
-	accessToken, refreshToken, expiresIn, err := s.generateTokens(&user)
+	accessToken, refreshToken, sessionID, expiresIn, err := s.generateTokens(&user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tokens: %w", err)
 	}
@@ -128,6 +176,9 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest, clientIP, use
 	// Log successful login
 	s.logSuccessfulLogin(user.Username, clientIP, userAgent)
 
+	// Remember the device and flag unusual sign-ins to admins
+	s.checkLoginAnomalies(ctx, &user, clientIP, userAgent, req.DeviceID)
+
 	// Remove password hash from response
 	user.PasswordHash = ""
 
@@ -136,20 +187,14 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest, clientIP, use
 		RefreshToken: refreshToken,
 		ExpiresIn:    expiresIn,
 		User:         &user,
+		SessionID:    sessionID,
 	}, nil
 }
 
 // Logout invalidates the user's tokens
 func (s *AuthService) Logout(ctx context.Context, userID uuid.UUID, sessionID string) error {
 	// Add tokens to blacklist
-	key := fmt.Sprintf("blacklist:session:%s", sessionID)
-	expiration := time.Duration(s.config.Security.JWTExpirationHours) * time.Hour
-	
-	if s.redis != nil {
-		if err := s.redis.Set(ctx, key, "1", expiration).Err(); err != nil {
-			return fmt.Errorf("failed to blacklist session: %w", err)
-		}
-	}
+	s.blacklistSession(ctx, sessionID)
 
 	s.logger.WithFields(logrus.Fields{
 		"user_id":    userID,
@@ -167,9 +212,7 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*L
 	}
 
 	// Check if session is blacklisted
-	if blacklisted, err := s.isSessionBlacklisted(ctx, claims.SessionID); err != nil {
-		return nil, fmt.Errorf("failed to check blacklist: %w", err)
-	} else if blacklisted {
+	if s.IsSessionBlacklisted(ctx, claims.SessionID) {
 		return nil, ErrTokenInvalid
 	}
 
@@ -188,19 +231,13 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*L
 	}
 
 	// Generate new tokens
-	accessToken, newRefreshToken, expiresIn, err := s.generateTokens(&user)
+	accessToken, newRefreshToken, sessionID, expiresIn, err := s.generateTokens(&user)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate tokens: %w", err)
 	}
 
 	// Blacklist old refresh token
-	key := fmt.Sprintf("blacklist:session:%s", claims.SessionID)
-	expiration := time.Duration(s.config.Security.JWTExpirationHours) * time.Hour
-	if s.redis != nil {
-		if err := s.redis.Set(ctx, key, "1", expiration).Err(); err != nil {
-			s.logger.WithError(err).Error("Failed to blacklist old refresh token")
-		}
-	}
+	s.blacklistSession(ctx, claims.SessionID)
 
 	// Remove password hash from response
 	user.PasswordHash = ""
@@ -210,9 +247,18 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*L
 		RefreshToken: newRefreshToken,
 		ExpiresIn:    expiresIn,
 		User:         &user,
+		SessionID:    sessionID,
 	}, nil
 }
 
+// CSRFToken is the anti-CSRF token for a cookie session. It is derived from
+// the session ID, so a token planted by another site can't be reused.
+func (s *AuthService) CSRFToken(sessionID string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.Security.JWTSecret))
+	mac.Write([]byte("csrf:" + sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 // ValidateToken validates and parses a JWT token
 func (s *AuthService) ValidateToken(tokenString string) (*JWTClaims, error) {
 	return s.validateToken(tokenString)
@@ -255,29 +301,68 @@ func (s *AuthService) CheckPermission(userRole models.UserRole, resource string,
 	permissions := map[models.UserRole]map[string][]string{
 		models.RoleAdmin: {
 			"users":     {"create", "read", "update", "delete"},
-			"customers": {"create", "read", "update", "delete"},
+			"customers": {"create", "read", "update", "delete", "import"},
 			"products":  {"create", "read", "update", "delete"},
 			"sales":     {"create", "read", "update", "delete", "refund"},
+			"claims":    {"create", "read", "update"},
+			"prescriptions": {"create", "read", "verify"},
+			"medical_data": {"read", "break_glass"},
+			"clinical_notes": {"create", "read", "update", "export"},
+			"vaccinations": {"create", "read"},
+			"eligibility": {"read", "verify"},
+			"privacy": {"read", "export", "erase"},
+			"segments": {"create", "read", "update", "delete", "send"},
+			"campaigns": {"create", "read", "update", "delete", "send"},
+			"loyalty": {"update", "adjust"},
+			"feedback": {"read", "moderate"},
+			"documents": {"create", "read", "update", "delete"},
+			"timeclock": {"read", "manage"},
 			"analytics": {"read"},
 			"audit":     {"read"},
 		},
 		models.RoleManager: {
 			"users":     {"read", "update"},
-			"customers": {"create", "read", "update", "delete"},
+			"customers": {"create", "read", "update", "delete", "import"},
 			"products":  {"create", "read", "update", "delete"},
 			"sales":     {"create", "read", "update", "refund"},
+			"claims":    {"create", "read", "update"},
+			"prescriptions": {"create", "read", "verify"},
+			"medical_data": {"read"},
+			"clinical_notes": {"create", "read", "update", "export"},
+			"vaccinations": {"create", "read"},
+			"eligibility": {"read", "verify"},
+			"privacy": {"read", "export"},
+			"segments": {"create", "read", "update", "delete", "send"},
+			"campaigns": {"create", "read", "update", "delete", "send"},
+			"loyalty": {"adjust"},
+			"feedback": {"read", "moderate"},
+			"documents": {"create", "read", "update"},
+			"timeclock": {"read", "manage"},
 			"analytics": {"read"},
 		},
 		models.RolePharmacist: {
 			"customers": {"create", "read", "update"},
 			"products":  {"read", "update"},
 			"sales":     {"create", "read"},
+			"claims":    {"create", "read"},
+			"prescriptions": {"create", "read", "verify"},
+			"medical_data": {"read"},
+			"clinical_notes": {"create", "read", "update"},
+			"vaccinations": {"create", "read"},
+			"eligibility": {"read", "verify"},
+			"segments": {"read"},
+			"feedback": {"read"},
+			"documents": {"read"},
 			"analytics": {"read"},
 		},
 		models.RoleAssistant: {
 			"customers": {"read"},
 			"products":  {"read"},
 			"sales":     {"read"},
+			"prescriptions": {"create", "read"},
+			"medical_data": {"break_glass"}, // audited one-off access, see BreakGlassCustomerPHI
+			"vaccinations": {"read"},
+			"eligibility": {"read"},
 		},
 	}
 
@@ -296,8 +381,8 @@ func (s *AuthService) CheckPermission(userRole models.UserRole, resource string,
 
 // Private methods
 
-func (s *AuthService) generateTokens(user *models.User) (accessToken, refreshToken string, expiresIn int, err error) {
-	sessionID := uuid.New().String()
+func (s *AuthService) generateTokens(user *models.User) (accessToken, refreshToken, sessionID string, expiresIn int, err error) {
+	sessionID = uuid.New().String()
 	now := time.Now()
 	expiresIn = s.config.Security.JWTExpirationHours * 3600
 
@@ -308,6 +393,7 @@ func (s *AuthService) generateTokens(user *models.User) (accessToken, refreshTok
 		Email:     user.Email,
 		Role:      user.Role,
 		SessionID: sessionID,
+		BranchID:  user.BranchID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(s.config.Security.JWTExpirationHours) * time.Hour)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -321,7 +407,7 @@ func (s *AuthService) generateTokens(user *models.User) (accessToken, refreshTok
 	accessTokenObj := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
 	accessToken, err = accessTokenObj.SignedString([]byte(s.config.Security.JWTSecret))
 	if err != nil {
-		return "", "", 0, err
+		return "", "", "", 0, err
 	}
 
 	// Refresh token claims (longer expiration)
@@ -331,6 +417,7 @@ func (s *AuthService) generateTokens(user *models.User) (accessToken, refreshTok
 		Email:     user.Email,
 		Role:      user.Role,
 		SessionID: sessionID,
+		BranchID:  user.BranchID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(s.config.Security.JWTExpirationHours*7) * time.Hour)), // 7x longer
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -344,10 +431,10 @@ func (s *AuthService) generateTokens(user *models.User) (accessToken, refreshTok
 	refreshTokenObj := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
 	refreshToken, err = refreshTokenObj.SignedString([]byte(s.config.Security.JWTSecret))
 	if err != nil {
-		return "", "", 0, err
+		return "", "", "", 0, err
 	}
 
-	return accessToken, refreshToken, expiresIn, nil
+	return accessToken, refreshToken, sessionID, expiresIn, nil
 }
 
 func (s *AuthService) validateToken(tokenString string) (*JWTClaims, error) {
@@ -389,6 +476,15 @@ func (s *AuthService) incrementFailedLoginAttempts(ctx context.Context, user *mo
 			"lock_until":   lockUntil,
 			"failed_attempts": user.FailedLoginAttempts,
 		}).Warn("Account locked due to multiple failed login attempts")
+
+		s.raiseAlert(ctx, models.SecurityAlert{
+			Type:      models.AlertAccountLocked,
+			Severity:  models.SeverityMedium,
+			UserID:    &user.ID,
+			Username:  user.Username,
+			IPAddress: clientIP,
+			Message:   fmt.Sprintf("%s was locked out after %d failed logins", user.Username, user.FailedLoginAttempts),
+		}, map[string]interface{}{"locked_until": lockUntil})
 	}
 
 	return s.db.Save(user).Error
@@ -400,20 +496,26 @@ func (s *AuthService) resetFailedLoginAttempts(ctx context.Context, user *models
 	return s.db.Save(user).Error
 }
 
-func (s *AuthService) isSessionBlacklisted(ctx context.Context, sessionID string) (bool, error) {
-	if s.redis == nil {
-		return false, nil
-	}
-	
-	key := fmt.Sprintf("blacklist:session:%s", sessionID)
-	result, err := s.redis.Get(ctx, key).Result()
+// IsSessionBlacklisted reports whether a session was logged out or its
+// refresh token already used. Without Redis only sessions revoked on this
+// instance are known.
+func (s *AuthService) IsSessionBlacklisted(ctx context.Context, sessionID string) bool {
+	value, err := s.store.Get(ctx, "blacklist:session:"+sessionID)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return false, nil
+		if !errors.Is(err, kvstore.ErrNotFound) {
+			s.logger.WithError(err).Warn("Failed to check session blacklist")
 		}
-		return false, err
+		return false
+	}
+	return string(value) == "1"
+}
+
+// blacklistSession revokes a session for as long as its tokens can be valid
+func (s *AuthService) blacklistSession(ctx context.Context, sessionID string) {
+	expiration := time.Duration(s.config.Security.JWTExpirationHours) * time.Hour
+	if err := s.store.Set(ctx, "blacklist:session:"+sessionID, []byte("1"), expiration); err != nil {
+		s.logger.WithError(err).Warn("Failed to blacklist session")
 	}
-	return result == "1", nil
 }
 
 func (s *AuthService) logSuccessfulLogin(username, clientIP, userAgent string) {
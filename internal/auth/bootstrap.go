@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBootstrapUnavailable  = errors.New("bootstrap is not available, an admin account already exists")
+	ErrBootstrapTokenInvalid = errors.New("invalid bootstrap token")
+)
+
+// bootstrapTokenTTL is how long a generated bootstrap token is accepted by
+// instances other than the one that generated it
+const bootstrapTokenTTL = 24 * time.Hour
+
+// bootstrapState holds the hash of the one-time token that creates the first
+// admin. It is cleared once the admin exists.
+type bootstrapState struct {
+	mu        sync.Mutex
+	tokenHash []byte
+}
+
+// PrepareBootstrap arms the one-time bootstrap token when no admin account
+// exists. BOOTSTRAP_TOKEN is used when set; otherwise a random token is
+// generated and returned so it can be shown to the operator. It returns ""
+// when bootstrapping isn't needed or the token came from the environment.
+// A generated token is shared through the store, so behind a load balancer
+// it works on whichever instance the request reaches.
+func (s *AuthService) PrepareBootstrap(ctx context.Context) (string, error) {
+	var admins int64
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+		return "", err
+	}
+	if admins > 0 {
+		return "", nil
+	}
+
+	token := s.config.Security.BootstrapToken
+	generated := token == ""
+	if generated {
+		var err error
+		if token, err = utils.GenerateSecureToken(32); err != nil {
+			return "", err
+		}
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	s.bootstrap.mu.Lock()
+	s.bootstrap.tokenHash = hash[:]
+	s.bootstrap.mu.Unlock()
+
+	if !generated {
+		return "", nil
+	}
+	if err := s.store.Set(ctx, bootstrapTokenKey(hash[:]), []byte("1"), bootstrapTokenTTL); err != nil {
+		s.logger.WithError(err).Warn("Failed to share the bootstrap token, it only works on this instance")
+	}
+	return token, nil
+}
+
+// Bootstrap creates the first admin account with the one-time token from
+// PrepareBootstrap. It stops working as soon as any admin exists, on every
+// instance, since that is checked in the database.
+func (s *AuthService) Bootstrap(ctx context.Context, req BootstrapRequest, clientIP string) (*models.User, error) {
+	if s.isIPBlocked(ctx, clientIP) {
+		return nil, ErrTooManyAttempts
+	}
+
+	s.bootstrap.mu.Lock()
+	defer s.bootstrap.mu.Unlock()
+
+	if s.bootstrap.tokenHash == nil {
+		return nil, ErrBootstrapUnavailable
+	}
+	hash := sha256.Sum256([]byte(req.Token))
+	if subtle.ConstantTimeCompare(hash[:], s.bootstrap.tokenHash) != 1 && !s.sharedBootstrapToken(ctx, hash[:]) {
+		s.recordIPFailure(ctx, clientIP, "bootstrap")
+		s.logFailedLogin(req.Username, clientIP, "invalid bootstrap token")
+		return nil, ErrBootstrapTokenInvalid
+	}
+
+	user, err := s.newAdmin(req.Username, req.Email, req.Password, req.FirstName, req.LastName)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var admins int64
+		if err := tx.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&admins).Error; err != nil {
+			return err
+		}
+		if admins > 0 {
+			return ErrBootstrapUnavailable
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrBootstrapUnavailable) {
+			s.bootstrap.tokenHash = nil
+		}
+		return nil, err
+	}
+
+	// The token is single use
+	s.bootstrap.tokenHash = nil
+	s.store.Delete(ctx, bootstrapTokenKey(hash[:]))
+
+	s.logger.WithFields(logrus.Fields{
+		"username":  user.Username,
+		"client_ip": clientIP,
+		"event":     "bootstrap_admin",
+	}).Warn("Initial admin account created with the bootstrap token")
+
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+// CreateAdmin creates an admin account for an operator on the server's
+// command line. Unlike Bootstrap it needs no token and works when admins
+// already exist, e.g. to recover from a lost admin password.
+func (s *AuthService) CreateAdmin(ctx context.Context, req CreateAdminRequest) (*models.User, error) {
+	user, err := s.newAdmin(req.Username, req.Email, req.Password, req.FirstName, req.LastName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"username": user.Username,
+		"event":    "create_admin",
+	}).Warn("Admin account created from the command line")
+
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+// sharedBootstrapToken reports whether hash is of a token generated by
+// another instance
+func (s *AuthService) sharedBootstrapToken(ctx context.Context, hash []byte) bool {
+	_, err := s.store.Get(ctx, bootstrapTokenKey(hash))
+	return err == nil
+}
+
+func bootstrapTokenKey(hash []byte) string {
+	return "bootstrap:token:" + hex.EncodeToString(hash)
+}
+
+// newAdmin builds an active admin account with a hashed password
+func (s *AuthService) newAdmin(username, email, password, firstName, lastName string) (models.User, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), s.config.Security.BCryptCost)
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return models.User{
+		Username:     utils.NormalizeText(username),
+		Email:        utils.NormalizeText(email),
+		PasswordHash: string(passwordHash),
+		FirstName:    utils.NormalizeText(firstName),
+		LastName:     utils.NormalizeText(lastName),
+		Role:         models.RoleAdmin,
+		IsActive:     true,
+	}, nil
+}
+
+type BootstrapRequest struct {
+	Token     string `json:"token" validate:"required"`
+	Username  string `json:"username" validate:"required,min=3,max=50"`
+	Email     string `json:"email" validate:"required,email"`
+	Password  string `json:"password" validate:"required,min=12"`
+	FirstName string `json:"first_name" validate:"required,max=100"`
+	LastName  string `json:"last_name" validate:"required,max=100"`
+}
+
+type CreateAdminRequest struct {
+	Username  string `validate:"required,min=3,max=50"`
+	Email     string `validate:"required,email"`
+	Password  string `validate:"required,min=12"`
+	FirstName string `validate:"required,max=100"`
+	LastName  string `validate:"required,max=100"`
+}
@@ -0,0 +1,394 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/alerting"
+	"pharmacy-backend/internal/kvstore"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many failed login attempts from this address, try again later")
+	ErrCaptchaRequired = errors.New("captcha verification required")
+	ErrCaptchaInvalid  = errors.New("captcha verification failed")
+)
+
+// Logins closer together than this are never flagged as impossible travel,
+// GeoIP is too coarse to tell
+const minTravelDistanceKM = 100
+
+// AlertNotifier delivers security alerts to admins, e.g. by email
+type AlertNotifier interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SetAlertNotifier sets how admins are told about security alerts. Without
+// one, alerts are only stored and logged.
+func (s *AuthService) SetAlertNotifier(notifier AlertNotifier) {
+	s.alertNotifier = notifier
+}
+
+// SetAlerting posts lockouts and addresses blocked for repeated failed
+// logins to the operations channels
+func (s *AuthService) SetAlerting(alerts *alerting.Notifier) {
+	s.alerts = alerts
+}
+
+// isIPBlocked reports whether clientIP is blocked for repeated failures
+func (s *AuthService) isIPBlocked(ctx context.Context, clientIP string) bool {
+	return s.loginCount(ctx, "login_block:ip:"+clientIP) > 0
+}
+
+// recordIPFailure counts a failed login from clientIP and blocks the address
+// once it reaches LoginGuard.IPMaxFailures within the window
+func (s *AuthService) recordIPFailure(ctx context.Context, clientIP, username string) {
+	guard := s.config.LoginGuard
+	failures := s.incrLoginCount(ctx, "login_failures:ip:"+clientIP, guard.IPWindow)
+	if guard.IPMaxFailures <= 0 || failures != guard.IPMaxFailures {
+		return
+	}
+
+	s.setLoginCount(ctx, "login_block:ip:"+clientIP, guard.IPBlockDuration)
+	s.raiseAlert(ctx, models.SecurityAlert{
+		Type:      models.AlertIPVelocity,
+		Severity:  models.SeverityHigh,
+		Username:  username,
+		IPAddress: clientIP,
+		Message: fmt.Sprintf("%s was blocked for %s after %d failed logins within %s",
+			clientIP, guard.IPBlockDuration, failures, guard.IPWindow),
+	}, map[string]interface{}{
+		"failures":      failures,
+		"window":        guard.IPWindow.String(),
+		"blocked_until": time.Now().Add(guard.IPBlockDuration),
+	})
+}
+
+// checkCaptcha asks for a CAPTCHA once the address or the account has failed
+// repeatedly, and verifies the token when it is required
+func (s *AuthService) checkCaptcha(ctx context.Context, token, clientIP string, userFailures int) error {
+	if s.captcha == nil {
+		return nil
+	}
+
+	guard := s.config.LoginGuard
+	required := (guard.CaptchaAfterUser > 0 && userFailures >= guard.CaptchaAfterUser) ||
+		(guard.CaptchaAfterIP > 0 && s.loginCount(ctx, "login_failures:ip:"+clientIP) >= guard.CaptchaAfterIP)
+	if !required {
+		return nil
+	}
+	if token == "" {
+		return ErrCaptchaRequired
+	}
+
+	valid, err := s.captcha.Verify(ctx, token, clientIP)
+	if err != nil {
+		// Fail closed, the challenge is only asked for when under suspicion
+		s.logger.WithError(err).Error("Failed to verify CAPTCHA")
+		return ErrCaptchaInvalid
+	}
+	if !valid {
+		return ErrCaptchaInvalid
+	}
+	return nil
+}
+
+// checkLoginAnomalies records the device a user signed in from and raises
+// alerts for a new device, or for travel faster than
+// LoginGuard.ImpossibleTravelKMH since the previous login
+func (s *AuthService) checkLoginAnomalies(ctx context.Context, user *models.User, clientIP, userAgent, deviceID string) {
+	now := time.Now()
+	hash := deviceHash(userAgent, deviceID)
+	location := s.locate(ctx, clientIP)
+
+	var previous models.LoginFingerprint
+	hasPrevious := true
+	if err := s.db.WithContext(ctx).Where("user_id = ?", user.ID).Order("last_seen_at DESC").First(&previous).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.WithError(err).Error("Failed to load login fingerprints")
+			return
+		}
+		hasPrevious = false
+	}
+
+	var fingerprint models.LoginFingerprint
+	isNew := false
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND device_hash = ?", user.ID, hash).First(&fingerprint).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.WithError(err).Error("Failed to load login fingerprint")
+			return
+		}
+		isNew = true
+		fingerprint = models.LoginFingerprint{UserID: user.ID, DeviceHash: hash, FirstSeenAt: now}
+	}
+
+	if len(userAgent) > 500 {
+		userAgent = userAgent[:500]
+	}
+	fingerprint.UserAgent = userAgent
+	fingerprint.IPAddress = clientIP
+	fingerprint.LastSeenAt = now
+	fingerprint.LoginCount++
+	fingerprint.Country, fingerprint.Latitude, fingerprint.Longitude = "", nil, nil
+	if location != nil {
+		fingerprint.Country = location.Country
+		fingerprint.Latitude = &location.Latitude
+		fingerprint.Longitude = &location.Longitude
+	}
+	if err := s.db.WithContext(ctx).Save(&fingerprint).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to save login fingerprint")
+	}
+
+	// The first login ever has nothing to compare against
+	if !hasPrevious {
+		return
+	}
+
+	if isNew && s.config.LoginGuard.NewDeviceAlerts {
+		s.raiseAlert(ctx, models.SecurityAlert{
+			Type:      models.AlertNewDevice,
+			Severity:  models.SeverityLow,
+			UserID:    &user.ID,
+			Username:  user.Username,
+			IPAddress: clientIP,
+			Message:   fmt.Sprintf("%s signed in from a new device", user.Username),
+		}, map[string]interface{}{
+			"user_agent": userAgent,
+			"country":    fingerprint.Country,
+		})
+	}
+
+	maxSpeed := s.config.LoginGuard.ImpossibleTravelKMH
+	if maxSpeed <= 0 || location == nil || previous.Latitude == nil || previous.Longitude == nil {
+		return
+	}
+	distance := haversineKM(*previous.Latitude, *previous.Longitude, location.Latitude, location.Longitude)
+	hours := now.Sub(previous.LastSeenAt).Hours()
+	if distance < minTravelDistanceKM || (hours > 0 && distance/hours <= maxSpeed) {
+		return
+	}
+
+	s.raiseAlert(ctx, models.SecurityAlert{
+		Type:      models.AlertImpossibleTravel,
+		Severity:  models.SeverityHigh,
+		UserID:    &user.ID,
+		Username:  user.Username,
+		IPAddress: clientIP,
+		Message: fmt.Sprintf("%s signed in %.0f km from their previous login %s earlier",
+			user.Username, distance, now.Sub(previous.LastSeenAt).Round(time.Minute)),
+	}, map[string]interface{}{
+		"distance_km":       math.Round(distance),
+		"previous_ip":       previous.IPAddress,
+		"previous_country":  previous.Country,
+		"previous_login_at": previous.LastSeenAt,
+		"country":           location.Country,
+		"max_speed_kmh":     maxSpeed,
+	})
+}
+
+// raiseAlert stores a security alert, logs it and notifies the admins
+func (s *AuthService) raiseAlert(ctx context.Context, alert models.SecurityAlert, details map[string]interface{}) {
+	if details != nil {
+		encoded, err := json.Marshal(details)
+		if err == nil {
+			alert.Details = string(encoded)
+		}
+	}
+	if err := s.db.WithContext(ctx).Create(&alert).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store security alert")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"alert_type": alert.Type,
+		"severity":   alert.Severity,
+		"username":   alert.Username,
+		"client_ip":  alert.IPAddress,
+		"event":      "security_alert",
+	}).Warn(alert.Message)
+
+	if alert.Type == models.AlertIPVelocity || alert.Type == models.AlertAccountLocked {
+		s.alerts.Notify(alerting.Alert{
+			Event:    alerting.EventRepeatedFailedLogins,
+			Severity: alerting.SeverityWarning,
+			Title:    "Repeated failed logins",
+			Message:  alert.Message,
+			Fields: []alerting.Field{
+				{Name: "Username", Value: alert.Username},
+				{Name: "IP address", Value: alert.IPAddress},
+			},
+			Key: string(alert.Type) + ":" + alert.Username + ":" + alert.IPAddress,
+		})
+	}
+
+	if s.alertNotifier == nil {
+		return
+	}
+
+	var admins []models.User
+	if err := s.db.WithContext(ctx).Where("role = ? AND is_active = ?", models.RoleAdmin, true).Find(&admins).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to load admins for security alert")
+		return
+	}
+
+	// Delivered in the background so a slow provider doesn't hold up logins
+	subject := fmt.Sprintf("Security alert (%s): %s", alert.Severity, strings.ReplaceAll(string(alert.Type), "_", " "))
+	go func() {
+		for _, admin := range admins {
+			if err := s.alertNotifier.Send(context.Background(), admin.Email, subject, alert.Message); err != nil {
+				s.logger.WithError(err).WithField("admin", admin.Username).Warn("Failed to send security alert")
+			}
+		}
+	}()
+}
+
+// ListSecurityAlerts returns security alerts newest first
+func (s *AuthService) ListSecurityAlerts(ctx context.Context, filter SecurityAlertFilter) ([]models.SecurityAlert, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.SecurityAlert{})
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Severity != "" {
+		query = query.Where("severity = ?", filter.Severity)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Acknowledged != nil {
+		if *filter.Acknowledged {
+			query = query.Where("acknowledged_at IS NOT NULL")
+		} else {
+			query = query.Where("acknowledged_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	var alerts []models.SecurityAlert
+	if err := query.Order("created_at DESC").Limit(limit).Offset(filter.Offset).Find(&alerts).Error; err != nil {
+		return nil, 0, err
+	}
+	return alerts, total, nil
+}
+
+// AcknowledgeSecurityAlert marks an alert as reviewed
+func (s *AuthService) AcknowledgeSecurityAlert(ctx context.Context, id, acknowledgedBy uuid.UUID) (*models.SecurityAlert, error) {
+	var alert models.SecurityAlert
+	if err := s.db.WithContext(ctx).First(&alert, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("security alert not found")
+	}
+	if alert.AcknowledgedAt != nil {
+		return &alert, nil
+	}
+
+	now := time.Now()
+	alert.AcknowledgedAt = &now
+	alert.AcknowledgedBy = &acknowledgedBy
+	if err := s.db.WithContext(ctx).Save(&alert).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// LoginDevices lists the devices a user has signed in from, most recent first
+func (s *AuthService) LoginDevices(ctx context.Context, userID uuid.UUID) ([]models.LoginFingerprint, error) {
+	var devices []models.LoginFingerprint
+	err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("last_seen_at DESC").Find(&devices).Error
+	return devices, err
+}
+
+// Private helper methods
+
+// locate looks up clientIP, skipping private and loopback addresses
+func (s *AuthService) locate(ctx context.Context, clientIP string) *GeoLocation {
+	if s.geoLocator == nil {
+		return nil
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil || ip.IsPrivate() || ip.IsLoopback() || ip.IsUnspecified() {
+		return nil
+	}
+
+	location, err := s.geoLocator.Locate(ctx, clientIP)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to locate login IP")
+		return nil
+	}
+	return location
+}
+
+// loginCount reads a failed login counter or block
+func (s *AuthService) loginCount(ctx context.Context, key string) int {
+	value, err := s.store.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, kvstore.ErrNotFound) {
+			s.logger.WithError(err).Warn("Failed to read login counter")
+		}
+		return 0
+	}
+	count, _ := strconv.Atoi(string(value))
+	return count
+}
+
+func (s *AuthService) incrLoginCount(ctx context.Context, key string, window time.Duration) int {
+	count, _, err := s.store.Incr(ctx, key, window)
+	if err != nil {
+		s.logger.WithError(err).Warn("Failed to update login counter")
+	}
+	return int(count)
+}
+
+func (s *AuthService) setLoginCount(ctx context.Context, key string, ttl time.Duration) {
+	if err := s.store.Set(ctx, key, []byte("1"), ttl); err != nil {
+		s.logger.WithError(err).Warn("Failed to store login block")
+	}
+}
+
+// deviceHash identifies a device by its user agent and, when the client
+// sends one, its own device ID
+func deviceHash(userAgent, deviceID string) string {
+	sum := sha256.Sum256([]byte(userAgent + "\x00" + deviceID))
+	return hex.EncodeToString(sum[:])
+}
+
+// haversineKM is the great-circle distance between two points
+func haversineKM(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKM = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKM * math.Asin(math.Sqrt(a))
+}
+
+// Request/Response types
+
+type SecurityAlertFilter struct {
+	Type         string
+	Severity     string
+	UserID       *uuid.UUID
+	Acknowledged *bool
+	Limit        int
+	Offset       int
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+)
+
+var captchaVerifyURLs = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// CaptchaVerifier checks a CAPTCHA response token with the provider
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, clientIP string) (bool, error)
+}
+
+// NewCaptchaVerifier builds the verifier named in the configuration, or
+// returns nil when CAPTCHA challenges are off
+func NewCaptchaVerifier(cfg config.LoginGuardConfig) CaptchaVerifier {
+	verifyURL, known := captchaVerifyURLs[cfg.CaptchaProvider]
+	if !known || cfg.CaptchaSecret == "" {
+		return nil
+	}
+	if cfg.CaptchaVerifyURL != "" {
+		verifyURL = cfg.CaptchaVerifyURL
+	}
+	return &SiteVerifyCaptcha{
+		VerifyURL: verifyURL,
+		Secret:    cfg.CaptchaSecret,
+		Client:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SiteVerifyCaptcha verifies tokens with the siteverify API shared by
+// reCAPTCHA, hCaptcha and Turnstile
+type SiteVerifyCaptcha struct {
+	VerifyURL string
+	Secret    string
+	Client    *http.Client
+}
+
+func (v *SiteVerifyCaptcha) Verify(ctx context.Context, token, clientIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {v.Secret},
+		"response": {token},
+		"remoteip": {clientIP},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.VerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to build CAPTCHA request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("CAPTCHA verification failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return false, fmt.Errorf("CAPTCHA provider returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("invalid CAPTCHA response: %w", err)
+	}
+	return result.Success, nil
+}
+
+// GeoLocation is where an IP address is, roughly
+type GeoLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Country   string  `json:"country"`
+}
+
+// GeoLocator looks up where a login came from
+type GeoLocator interface {
+	Locate(ctx context.Context, ip string) (*GeoLocation, error)
+}
+
+// NewGeoLocator builds the locator named in the configuration, or returns
+// nil when lookups are off
+func NewGeoLocator(cfg config.LoginGuardConfig) GeoLocator {
+	if cfg.GeoIPProvider != "http" || cfg.GeoIPEndpoint == "" {
+		return nil
+	}
+	return &HTTPGeoLocator{
+		Endpoint: cfg.GeoIPEndpoint,
+		Client:   &http.Client{Timeout: 3 * time.Second},
+	}
+}
+
+// HTTPGeoLocator queries a GeoIP service, such as a self-hosted MaxMind
+// sidecar. Endpoint contains {ip}, replaced by the address to look up.
+type HTTPGeoLocator struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+func (g *HTTPGeoLocator) Locate(ctx context.Context, ip string) (*GeoLocation, error) {
+	endpoint := strings.ReplaceAll(g.Endpoint, "{ip}", url.PathEscape(ip))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GeoIP request: %w", err)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GeoIP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GeoIP service returned %d", resp.StatusCode)
+	}
+
+	var location GeoLocation
+	if err := json.NewDecoder(resp.Body).Decode(&location); err != nil {
+		return nil, fmt.Errorf("invalid GeoIP response: %w", err)
+	}
+	return &location, nil
+}
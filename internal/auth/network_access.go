@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+)
+
+var (
+	ErrNetworkNotAllowed = errors.New("access from this network is not allowed for your role")
+	ErrCountryNotAllowed = errors.New("sign-in from this location is not allowed for your role")
+)
+
+// networkPolicy is the parsed NetworkAccessConfig
+type networkPolicy struct {
+	networks  map[models.UserRole][]*net.IPNet
+	countries map[models.UserRole][]string
+}
+
+func newNetworkPolicy(cfg config.NetworkAccessConfig) networkPolicy {
+	policy := networkPolicy{
+		networks:  map[models.UserRole][]*net.IPNet{},
+		countries: map[models.UserRole][]string{},
+	}
+	for role, entries := range cfg.RoleIPAllowlist {
+		for _, entry := range entries {
+			// Entries were checked by config.Validate
+			if network, err := config.ParseNetwork(entry); err == nil {
+				policy.networks[models.UserRole(role)] = append(policy.networks[models.UserRole(role)], network)
+			}
+		}
+	}
+	for role, countries := range cfg.RoleCountries {
+		policy.countries[models.UserRole(role)] = countries
+	}
+	return policy
+}
+
+// CheckNetworkAccess reports whether a user with role may use the API from
+// clientIP. It is checked on every authenticated request.
+func (s *AuthService) CheckNetworkAccess(role models.UserRole, clientIP string) error {
+	networks, restricted := s.networkPolicy.networks[role]
+	if !restricted {
+		return nil
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return ErrNetworkNotAllowed
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return nil
+		}
+	}
+	return ErrNetworkNotAllowed
+}
+
+// checkLoginLocation applies the network allowlist and the country
+// geo-fence for a login. A geo-fenced role is refused when the location
+// can't be determined, except from private addresses, which are inside
+// the pharmacy network.
+func (s *AuthService) checkLoginLocation(ctx context.Context, user *models.User, clientIP, userAgent string) error {
+	if err := s.CheckNetworkAccess(user.Role, clientIP); err != nil {
+		s.denyLogin(ctx, user, clientIP, userAgent, err, "not in the allowed networks for the role")
+		return err
+	}
+
+	countries, fenced := s.networkPolicy.countries[user.Role]
+	if !fenced {
+		return nil
+	}
+	ip := net.ParseIP(clientIP)
+	if ip != nil && (ip.IsPrivate() || ip.IsLoopback()) {
+		return nil
+	}
+
+	location := s.locate(ctx, clientIP)
+	if location == nil {
+		s.denyLogin(ctx, user, clientIP, userAgent, ErrCountryNotAllowed, "location could not be determined")
+		return ErrCountryNotAllowed
+	}
+	country := strings.ToUpper(location.Country)
+	for _, allowed := range countries {
+		if country == allowed {
+			return nil
+		}
+	}
+	s.denyLogin(ctx, user, clientIP, userAgent, ErrCountryNotAllowed, fmt.Sprintf("country %s is not allowed for the role", country))
+	return ErrCountryNotAllowed
+}
+
+// denyLogin audit-logs a login refused by the network policy and alerts
+// admins, since the password was correct
+func (s *AuthService) denyLogin(ctx context.Context, user *models.User, clientIP, userAgent string, err error, reason string) {
+	s.logFailedLogin(user.Username, clientIP, reason)
+
+	message := fmt.Sprintf("Login for %s (%s) from %s refused: %s", user.Username, user.Role, clientIP, reason)
+	entry := &models.AuditLog{
+		UserID:       &user.ID,
+		Action:       "network_access_denied",
+		Resource:     "auth",
+		IPAddress:    clientIP,
+		UserAgent:    userAgent,
+		Success:      false,
+		OldValues:    "{}",
+		NewValues:    "{}",
+		ErrorMessage: &message,
+	}
+	if dbErr := s.db.WithContext(ctx).Create(entry).Error; dbErr != nil {
+		s.logger.WithError(dbErr).Error("Failed to audit refused login")
+	}
+
+	s.raiseAlert(ctx, models.SecurityAlert{
+		Type:      models.AlertNetworkDenied,
+		Severity:  models.SeverityHigh,
+		UserID:    &user.ID,
+		Username:  user.Username,
+		IPAddress: clientIP,
+		Message:   message,
+	}, map[string]interface{}{"role": user.Role, "reason": err.Error()})
+}
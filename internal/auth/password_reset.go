@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ErrResetTokenInvalid is returned for a password reset token that is
+// unknown, already used or expired
+var ErrResetTokenInvalid = errors.New("password reset link is invalid or has expired")
+
+const (
+	// Reset requests allowed per address and per client IP each hour;
+	// more are dropped silently so the endpoint can't be used to flood a
+	// mailbox
+	resetRequestsPerEmail = 3
+	resetRequestsPerIP    = 20
+)
+
+// RequestPasswordReset creates a one-time token for the active user with
+// this email, to be emailed to them. It returns nil, without an error, when
+// there is no such user or too many resets were asked for, so callers
+// answer the same either way and don't reveal which addresses have accounts.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email, clientIP string) (*PasswordReset, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.incrLoginCount(ctx, "password_reset:ip:"+clientIP, time.Hour) > resetRequestsPerIP ||
+		s.incrLoginCount(ctx, "password_reset:email:"+email, time.Hour) > resetRequestsPerEmail {
+		s.logger.WithFields(logrus.Fields{
+			"client_ip": clientIP,
+			"event":     "password_reset_throttled",
+		}).Warn("Too many password reset requests")
+		return nil, nil
+	}
+
+	var user models.User
+	err := s.db.WithContext(ctx).Where("LOWER(email) = ? AND is_active = ?", email, true).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate reset token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+	reset := &models.PasswordResetToken{
+		UserID:      user.ID,
+		TokenHash:   hashResetToken(token),
+		ExpiresAt:   time.Now().UTC().Add(s.config.Email.PasswordResetTTL),
+		RequestedIP: clientIP,
+	}
+
+	// Only the newest link works
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(reset).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save reset token: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":   user.ID,
+		"client_ip": clientIP,
+		"event":     "password_reset_requested",
+	}).Info("Password reset requested")
+
+	user.PasswordHash = ""
+	return &PasswordReset{User: &user, Token: token, ExpiresAt: reset.ExpiresAt}, nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset.
+// The token is used up, and the account is unlocked if failed logins had
+// locked it.
+func (s *AuthService) ResetPassword(ctx context.Context, req ResetPasswordRequest) error {
+	var reset models.PasswordResetToken
+	err := s.db.WithContext(ctx).Where("token_hash = ? AND used_at IS NULL", hashResetToken(req.Token)).First(&reset).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrResetTokenInvalid
+	}
+	if err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		return ErrResetTokenInvalid
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), s.config.Security.BCryptCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Claimed first so a token can't be used twice at once
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", reset.ID).
+			Update("used_at", time.Now().UTC())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+
+		result = tx.Model(&models.User{}).Where("id = ? AND is_active = ?", reset.UserID, true).Updates(map[string]interface{}{
+			"password_hash":         string(hashedPassword),
+			"failed_login_attempts": 0,
+			"locked_until":          nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrResetTokenInvalid
+		}
+		return nil
+	})
+	if errors.Is(err, ErrResetTokenInvalid) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset password: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": reset.UserID,
+		"event":   "password_reset",
+	}).Info("Password reset with an emailed link")
+	return nil
+}
+
+func hashResetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PasswordReset is a newly issued reset token and who it is for
+type PasswordReset struct {
+	User      *models.User
+	Token     string
+	ExpiresAt time.Time
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,min=8"`
+}
@@ -0,0 +1,120 @@
+// Package cache keeps responses of the busiest read endpoints, product
+// browsing, medical services and the dashboard, so storefront traffic
+// spikes don't all reach the database. Entries are kept in the shared
+// store, Redis when it is configured, so every instance serves and drops
+// the same ones.
+//
+// Each namespace has a version that is part of its keys. Invalidating a
+// namespace moves its version on, which drops every entry in it at once
+// without looking them up; the old entries expire on their own.
+package cache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/kvstore"
+	"pharmacy-backend/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Namespace string
+
+const (
+	Products  Namespace = "products"  // product lists and details
+	Services  Namespace = "services"  // medical services by category
+	Analytics Namespace = "analytics" // dashboard figures
+)
+
+// Cache is a read-through cache of encoded responses
+type Cache struct {
+	store   kvstore.Store
+	enabled bool
+}
+
+func New(store kvstore.Store, cfg config.CacheConfig) *Cache {
+	return &Cache{store: store, enabled: cfg.Enabled}
+}
+
+// Enabled reports whether responses are cached
+func (c *Cache) Enabled() bool {
+	return c != nil && c.enabled
+}
+
+// Entry is a key at its namespace's version when it was looked up. An
+// entry filled after the namespace was invalidated is stored under the old
+// version, so a response read before a change is never served after it.
+type Entry struct {
+	namespace Namespace
+	key       string
+}
+
+// Entry returns the entry for key in namespace at its current version
+func (c *Cache) Entry(ctx context.Context, namespace Namespace, key string) Entry {
+	return Entry{namespace: namespace, key: "cache:" + string(namespace) + ":" + c.version(ctx, namespace) + ":" + key}
+}
+
+// Get returns the value stored for entry
+func (c *Cache) Get(ctx context.Context, entry Entry) ([]byte, bool) {
+	if !c.Enabled() {
+		return nil, false
+	}
+	value, err := c.store.Get(ctx, entry.key)
+	if err != nil {
+		if !errors.Is(err, kvstore.ErrNotFound) {
+			logrus.WithError(err).WithField("namespace", entry.namespace).Warn("Failed to read cache")
+		}
+		metrics.CacheRequests.Inc(string(entry.namespace), "miss")
+		return nil, false
+	}
+	metrics.CacheRequests.Inc(string(entry.namespace), "hit")
+	return value, true
+}
+
+// Set stores value for entry until ttl passes
+func (c *Cache) Set(ctx context.Context, entry Entry, value []byte, ttl time.Duration) {
+	if !c.Enabled() || ttl <= 0 {
+		return
+	}
+	if err := c.store.Set(ctx, entry.key, value, ttl); err != nil {
+		logrus.WithError(err).WithField("namespace", entry.namespace).Warn("Failed to write cache")
+	}
+}
+
+// Invalidate drops every entry in namespaces
+func (c *Cache) Invalidate(ctx context.Context, namespaces ...Namespace) {
+	if !c.Enabled() {
+		return
+	}
+	for _, namespace := range namespaces {
+		if _, _, err := c.store.Incr(ctx, versionKey(namespace), 0); err != nil {
+			logrus.WithError(err).WithField("namespace", namespace).Error("Failed to invalidate cache")
+			continue
+		}
+		metrics.CacheInvalidations.Inc(string(namespace))
+	}
+}
+
+// Private helper methods
+
+func (c *Cache) version(ctx context.Context, namespace Namespace) string {
+	if !c.Enabled() {
+		return "0"
+	}
+	value, err := c.store.Get(ctx, versionKey(namespace))
+	if err != nil {
+		return "0"
+	}
+	if _, err := strconv.ParseInt(string(value), 10, 64); err != nil {
+		return "0"
+	}
+	return string(value)
+}
+
+func versionKey(namespace Namespace) string {
+	return "cache:" + string(namespace) + ":version"
+}
@@ -2,35 +2,107 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/sirupsen/logrus"
 )
 
 type Config struct {
-	Environment string
-	Server      ServerConfig
-	Database    DatabaseConfig
-	CloudDB     DatabaseConfig  // Secondary database (cloud)
-	LocalDB     DatabaseConfig  // Local database (for sync/backup)
-	ReadReplica DatabaseConfig  // Read replica configuration
-	Redis       RedisConfig
-	Security    SecurityConfig
-	CORS        CORSConfig
-	Logging     LoggingConfig
-	HIPAA       HIPAAConfig
-	Sync        SyncConfig
-	Monitoring  MonitoringConfig
-	Backup      BackupConfig
+	Environment  string
+	Server       ServerConfig
+	Database     DatabaseConfig
+	CloudDB      DatabaseConfig // Secondary database (cloud)
+	LocalDB      DatabaseConfig // Local database (for sync/backup)
+	ReadReplica  DatabaseConfig // Read replica configuration
+	Redis        RedisConfig
+	Cluster      ClusterConfig
+	Cache        CacheConfig
+	Security     SecurityConfig
+	Session      SessionConfig
+	Encryption   EncryptionConfig
+	Secrets      SecretsConfig
+	Headers      HeadersConfig
+	Logging      LoggingConfig
+	HIPAA        HIPAAConfig
+	Sync         SyncConfig
+	Monitoring   MonitoringConfig
+	Backup       BackupConfig
+	Storage      StorageConfig
+	Refill       RefillConfig
+	OCR          OCRConfig
+	Pharmacy     PharmacyConfig
+	Vaccination  VaccinationConfig
+	Notification NotificationConfig
+	SMS          SMSConfig
+	Email        EmailConfig
+	Push         PushConfig
+	FDA          FDAConfig
+	Alerting     AlertingConfig
+	Geocoding    GeocodingConfig
+	Segment      SegmentConfig
+	Loyalty      LoyaltyConfig
+	Referral     ReferralConfig
+	Campaign     CampaignConfig
+	AuditArchive AuditArchiveConfig
+	Outbox       OutboxConfig
+	WebhookInbox WebhookInboxConfig
+	ColdChain    ColdChainConfig
+	Station      StationConfig
+	Feedback     FeedbackConfig
+	Documents    DocumentConfig
+	Jobs         JobConfig
+	LoginGuard   LoginGuardConfig
+	Network      NetworkAccessConfig
+
+	// Rate limits, CORS and feature flags, which can change while the
+	// server runs; see Live and Reload
+	live atomic.Value // *Reloadable
 }
 
 type ServerConfig struct {
 	Host string
 	Port string
 	Mode string // gin mode: debug, release, test
+
+	// V1Sunset is the date, as YYYY-MM-DD, after which /api/v1 may be
+	// removed. It is sent in the Sunset header of v1 responses when set.
+	V1Sunset string
+
+	// Native TLS, for deployments without a reverse proxy: a certificate
+	// and key, or certificates from Let's Encrypt for AutocertDomains
+	TLSCertFile      string
+	TLSKeyFile       string
+	AutocertDomains  []string
+	AutocertEmail    string
+	AutocertCacheDir string
+	ACMEDirectoryURL string // Optional, e.g. Let's Encrypt staging; defaults to production
+	TLSMinVersion    string // 1.2 or 1.3
+	HTTPPort         string // plain HTTP listener for ACME challenges and redirects to HTTPS; empty for none
+	HTTP2            bool
+
+	// How long a client has to send a request, and how long each class of
+	// route has to answer one. Exports and the event stream have no overall
+	// limit; they only need to keep sending.
+	ReadTimeout    time.Duration
+	POSTimeout     time.Duration // checkout and till endpoints, kept short so a stuck till fails fast
+	RequestTimeout time.Duration // everything else
+	ReportTimeout  time.Duration // analytics and reports
+
+	// ShutdownTimeout is how long in-flight requests and background work
+	// get to finish once the server is told to stop
+	ShutdownTimeout time.Duration
+
+	// gzip for responses of at least CompressionMinSize bytes, to clients
+	// that accept it
+	CompressionEnabled bool
+	CompressionLevel   int
+	CompressionMinSize int
 }
 
 type DatabaseConfig struct {
@@ -44,9 +116,15 @@ type DatabaseConfig struct {
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
 	Enabled         bool
+	MaxLag          time.Duration // read replica only: reads go to the primary while it is further behind
+
+	// Statements slower than this are logged and counted in
+	// pharmacy_db_slow_queries_total; zero turns that off
+	SlowQueryThreshold time.Duration
 }
 
 type RedisConfig struct {
+	Enabled  bool // without Redis, shared state is kept in memory per instance
 	Host     string
 	Port     string
 	Password string
@@ -54,6 +132,25 @@ type RedisConfig struct {
 	SSL      bool
 }
 
+// ClusterConfig is how instances running side by side behind a load
+// balancer tell each other apart. Background jobs that must run once, such
+// as reminders and backups, run on whichever instance holds the job's lock
+// in Redis; another takes over within LeaderLeaseTTL of it stopping.
+type ClusterConfig struct {
+	InstanceID     string // names this instance in logs, the host name by default
+	LeaderLeaseTTL time.Duration
+}
+
+// CacheConfig controls caching of the busiest read endpoints in Redis, or
+// in memory without it. Entries are dropped when what they show changes,
+// and expire after their TTL in any case.
+type CacheConfig struct {
+	Enabled      bool
+	ProductTTL   time.Duration // product lists and details
+	ServiceTTL   time.Duration // medical services
+	AnalyticsTTL time.Duration // the dashboard, which every sale changes
+}
+
 type SecurityConfig struct {
 	EncryptionKey        string
 	JWTSecret           string
@@ -64,6 +161,90 @@ type SecurityConfig struct {
 	LoginLockoutMinutes int
 	RateLimitRPS        int
 	RateLimitBurst      int
+	IdempotencyTTL      time.Duration // how long responses are kept for Idempotency-Key replays
+	BootstrapToken      string        // one-time token for creating the first admin; generated and logged when empty
+}
+
+// SessionConfig controls cookie sessions for browser clients, an alternative
+// to keeping bearer tokens in localStorage. Clients opt in per login with
+// the X-Client-Type: browser header.
+type SessionConfig struct {
+	CookiesEnabled bool
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string // strict, lax or none
+}
+
+// EncryptionConfig controls managed data keys for encrypted columns. Data
+// keys are stored in the database wrapped by a master key held locally, in
+// Vault's transit engine or in AWS KMS. With key management off,
+// ENCRYPTION_KEY encrypts everything directly.
+type EncryptionConfig struct {
+	KeyManagement      bool
+	MasterKeyProvider  string // local, vault or kms
+	MasterKey          string // local provider only, 32 characters; defaults to ENCRYPTION_KEY
+	VaultAddr          string
+	VaultToken         string
+	VaultTransitKey    string
+	KMSKeyID           string
+	KMSRegion          string
+	KMSEndpoint        string // Optional, defaults to AWS
+	AWSAccessKey       string
+	AWSSecretKey       string
+	ReencryptEnabled   bool
+	ReencryptInterval  time.Duration // How often values under retired keys are re-encrypted
+	ReencryptBatchSize int           // Rows per column per run
+}
+
+// SecretsConfig sets where JWT_SECRET and ENCRYPTION_KEY are read from:
+// env, file, aws (Secrets Manager) or vault (a KV version 2 secret). A
+// secret the provider doesn't have is read from the environment.
+type SecretsConfig struct {
+	Provider    string
+	Dir         string // file provider: one file per secret, e.g. /run/secrets/jwt_secret
+	AWSSecretID string // a secret holding a JSON object, e.g. {"JWT_SECRET": "..."}
+	AWSRegion   string
+	AWSEndpoint string // Optional, defaults to AWS
+	VaultPath   string // mount and path, e.g. secret/pharmacy; uses VAULT_ADDR and VAULT_TOKEN
+}
+
+// LoginGuardConfig sets the brute-force and anomaly checks on login, on top
+// of the per-account lockout in SecurityConfig
+type LoginGuardConfig struct {
+	IPMaxFailures       int           // Failed logins from one IP before it is blocked
+	IPWindow            time.Duration // Window the IP failures are counted over
+	IPBlockDuration     time.Duration
+	CaptchaProvider     string // none, recaptcha, hcaptcha or turnstile
+	CaptchaSecret       string
+	CaptchaVerifyURL    string // Optional, overrides the provider's siteverify URL
+	CaptchaAfterIP      int    // Require a CAPTCHA after this many failures from the IP
+	CaptchaAfterUser    int    // Require a CAPTCHA after this many failures on the account
+	GeoIPProvider       string // none or http
+	GeoIPEndpoint       string // URL with {ip}, responding with {"latitude", "longitude", "country"}
+	ImpossibleTravelKMH float64
+	NewDeviceAlerts     bool
+}
+
+// NetworkAccessConfig restricts where users of a role can sign in and call
+// the API from. Roles that aren't listed are unrestricted.
+type NetworkAccessConfig struct {
+	RoleIPAllowlist map[string][]string // role to CIDRs or IPs, e.g. admin=10.20.0.0/16,203.0.113.7
+	RoleCountries   map[string][]string // role to ISO country codes checked at login, needs GeoIP
+	TrustedProxies  []string            // proxies whose X-Forwarded-For is believed
+}
+
+// RateLimitConfig sets request quotas. Requests with a valid access token are
+// counted per user, anonymous ones per client IP, and each route group
+// (orders, qr, customers...) has its own counter.
+type RateLimitConfig struct {
+	Public RateLimitTier // anonymous requests such as QR scans and order tracking
+	Login  RateLimitTier // the /auth endpoints, always per client IP
+	User   RateLimitTier // authenticated requests
+}
+
+type RateLimitTier struct {
+	Requests int
+	Window   time.Duration
 }
 
 type CORSConfig struct {
@@ -72,9 +253,32 @@ type CORSConfig struct {
 	AllowedHeaders []string
 }
 
+// FeatureFlags switch parts of the API off, e.g. online ordering during a
+// stock take, by name. Features that aren't listed are on.
+type FeatureFlags map[string]bool
+
+// HeadersConfig sets the security headers sent with every response. Set
+// them per environment in the .env.<environment> file, e.g. to allow a CDN
+// in the CSP.
+type HeadersConfig struct {
+	ContentSecurityPolicy string
+	CSPReportOnly         bool   // send the CSP as Content-Security-Policy-Report-Only to trial a change
+	CSPReportURI          string // where browsers send violation reports, e.g. /api/v1/csp-report
+	FrameOptions          string // X-Frame-Options; empty to omit
+	ReferrerPolicy        string
+	PermissionsPolicy     string // empty to omit
+	HSTSMaxAge            int    // seconds; only sent when HTTPS is enforced
+	HSTSIncludeSubdomains bool
+}
+
 type LoggingConfig struct {
-	Level  string
-	Format string
+	Level  string // empty for debug in development and info otherwise
+	Format string // json or text
+	// Copies of every entry, in addition to stderr
+	File         string            // appended to; empty for none
+	Syslog       string            // "local", or e.g. udp://host:514; empty for none
+	OTLPEndpoint string            // OTLP/HTTP logs URL, e.g. http://collector:4318/v1/logs
+	OTLPHeaders  map[string]string // sent with each export, e.g. an API key
 }
 
 type HIPAAConfig struct {
@@ -86,6 +290,8 @@ type HIPAAConfig struct {
 type SyncConfig struct {
 	Enabled        bool
 	Interval       time.Duration
+	BatchSize      int  // rows per table read and applied in one transaction
+	Bidirectional  bool // also pull changes made in the cloud into the primary
 	BackupEnabled  bool
 	BackupInterval time.Duration
 }
@@ -93,13 +299,302 @@ type SyncConfig struct {
 type MonitoringConfig struct {
 	HealthCheckEnabled bool
 	MetricsEnabled     bool
+	MetricsToken       string // bearer token /metrics requires, if set
 	TracingEnabled     bool
+	MinFreeDiskMB      int // free upload disk space below which /readyz fails, 0 to skip
+
+	// /debug/pprof and /debug/runtime for admins, on the API's port or on
+	// DebugAddr, e.g. 127.0.0.1:6060, to keep them off the public listener
+	DebugEnabled    bool
+	DebugAddr       string
+	DebugContention bool // sample blocking and mutex contention for their profiles
 }
 
 type BackupConfig struct {
 	S3Bucket          string
 	S3Region          string
+	S3Endpoint        string // Optional, for S3-compatible storage; defaults to AWS
+	S3AccessKey       string
+	S3SecretKey       string
 	EncryptionEnabled bool
+	Prefix            string // object key prefix for database backups
+	RetentionDays     int    // database backups older than this are deleted from the bucket
+	PgDumpPath        string
+	PgRestorePath     string
+}
+
+// StorageConfig says where uploaded files, such as ID documents and
+// prescription images, are kept: on local disk, or in an S3 or Google
+// Cloud Storage bucket that outlives the server's containers
+type StorageConfig struct {
+	Backend    string // local, s3 or gcs
+	LocalDir   string
+	Bucket     string
+	Prefix     string // object key prefix in the bucket
+	Region     string // us-east-1 for s3 and auto for gcs when empty
+	Endpoint   string // S3-compatible endpoint, e.g. MinIO; path-style addressing is used when set
+	AccessKey  string // for gcs, an HMAC key of a service account
+	SecretKey  string
+	Encryption string        // s3 server-side encryption: AES256, aws:kms or none
+	KMSKeyID   string        // the KMS key for aws:kms, or the Cloud KMS key name for gcs
+	URLExpiry  time.Duration // how long signed download URLs work
+}
+
+type RefillConfig struct {
+	RemindersEnabled  bool
+	ReminderDaysAhead int           // Remind customers this many days before a refill is due
+	ReminderInterval  time.Duration // How often due reminders are sent
+	ReorderBaseURL    string        // Storefront page that accepts a reorder token
+}
+
+// PharmacyConfig identifies the dispensing pharmacy on labels and receipts
+type PharmacyConfig struct {
+	Name          string
+	Address       string
+	Phone         string
+	LicenseNumber string // FDA License to Operate
+
+	// TaxRate is the VAT added to sales and orders at branches without a
+	// rate of their own
+	TaxRate float64
+
+	// Currency is the ISO 4217 code prices, totals and reports are kept in
+	Currency string
+}
+
+type VaccinationConfig struct {
+	RemindersEnabled  bool
+	ReminderDaysAhead int           // Remind customers this many days before the next dose
+	ReminderInterval  time.Duration // How often due reminders are sent
+	VerifyBaseURL     string        // Public page that verifies a certificate code
+}
+
+// NotificationConfig controls customer notifications
+type NotificationConfig struct {
+	UnsubscribeBaseURL string // Public page that accepts an unsubscribe token
+}
+
+// SMSConfig selects the SMS provider. Semaphore is a Philippine gateway
+// that reaches local numbers on every network; Twilio also reaches abroad.
+type SMSConfig struct {
+	Provider   string // none, semaphore or twilio
+	APIURL     string // overrides the provider's API base URL, e.g. for a proxy
+	SenderName string // registered sender name (Semaphore) shown to recipients
+	Timeout    time.Duration
+
+	SemaphoreAPIKey string
+
+	TwilioAccountSID          string
+	TwilioAuthToken           string
+	TwilioFrom                string // sending number, or
+	TwilioMessagingServiceSID string // a messaging service to send from
+
+	// StatusCallbackURL is the public address of the delivery receipt
+	// endpoint (/api/v1/sms/status/twilio) given to Twilio. Semaphore
+	// receipts are polled on StatusPollCron instead.
+	StatusCallbackURL string
+	StatusPollCron    string
+
+	OTPTTL         time.Duration // how long a phone verification code is valid
+	OTPMaxAttempts int           // wrong codes allowed before a new one is needed
+}
+
+// EmailConfig selects how email is sent: through an SMTP server or the
+// SendGrid API
+type EmailConfig struct {
+	Provider string // none, smtp or sendgrid
+	From     string // sending address, e.g. no-reply@example.com
+	FromName string
+	ReplyTo  string
+	Timeout  time.Duration
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPTLS      string // starttls, tls (implicit, usually port 465) or none
+
+	SendGridAPIKey string
+	SendGridAPIURL string // overrides the API base URL, e.g. for a proxy
+
+	// SendGridWebhookPublicKey verifies the signed event webhook
+	// (/api/v1/email/events/sendgrid) that reports bounces, spam reports
+	// and unsubscribes. The endpoint is off while it is empty.
+	SendGridWebhookPublicKey string
+
+	// PasswordResetURL is the page staff open from a password reset email;
+	// the token is appended as ?token=
+	PasswordResetURL string
+	PasswordResetTTL time.Duration
+}
+
+// PushConfig sets up push notifications to the mobile apps: through
+// Firebase Cloud Messaging for Android and web, and APNs for iOS. Each is
+// on when its key file is set.
+type PushConfig struct {
+	Timeout time.Duration
+
+	// FCMCredentialsFile is a Firebase service account key (JSON). The
+	// project defaults to the key's own.
+	FCMCredentialsFile string
+	FCMProjectID       string
+	FCMAPIURL          string // overrides the API base URL, e.g. for a proxy
+
+	// APNsKeyFile is an APNs auth key (.p8) from the Apple developer
+	// account, with its key ID and the team that owns it. Topic is the
+	// app's bundle ID.
+	APNsKeyFile    string
+	APNsKeyID      string
+	APNsTeamID     string
+	APNsTopic      string
+	APNsProduction bool   // the sandbox is used for development builds otherwise
+	APNsAPIURL     string // overrides the API base URL
+}
+
+// FDAConfig points at the FDA Philippines registered-products dataset.
+// It is downloaded as CSV into a local cache that product registration
+// numbers are checked against, together with an optional list of recalls.
+type FDAConfig struct {
+	RegistryURL string // CSV export of registered products; imports fill the cache without it
+	RecallsURL  string // CSV of recalled registrations and batches
+	RefreshCron string
+	Timeout     time.Duration
+}
+
+// AlertingConfig points operational alerts, such as failed syncs and
+// backups, at Slack and Microsoft Teams channels
+type AlertingConfig struct {
+	SlackWebhookURL string
+	TeamsWebhookURL string
+	Source          string        // names this server in alerts; the host name when empty
+	Timeout         time.Duration
+	Cooldown        time.Duration // the same alert isn't posted again within it
+}
+
+// GeocodingConfig sets up geocoding of delivery addresses through the
+// Google Maps Geocoding API. Geocoded addresses are checked against the
+// delivery zones and priced by their distance.
+type GeocodingConfig struct {
+	Provider     string // none or google
+	GoogleAPIKey string
+	APIURL       string // overrides the API base URL, e.g. for a proxy
+	Region       string // country code results are biased towards, e.g. ph
+	Timeout      time.Duration
+}
+
+// SegmentConfig controls the background customer segment refresh
+type SegmentConfig struct {
+	RefreshEnabled  bool
+	RefreshInterval time.Duration // How often segment members are recomputed
+}
+
+// LoyaltyConfig controls points earning and tier recalculation
+type LoyaltyConfig struct {
+	PesosPerPoint  int           // Spend needed to earn one base point
+	RecalcEnabled  bool
+	RecalcInterval time.Duration // How often every customer's tier is recalculated
+}
+
+// ReferralConfig sets what customers earn for bringing in new ones. Both
+// are rewarded when the new customer's first order qualifies.
+type ReferralConfig struct {
+	RewardType     string  // points or credit
+	ReferrerReward float64 // points, or store credit in currency units
+	RefereeReward  float64 // the same for the new customer
+	MinFirstOrder  float64 // the first order must come to at least this
+	WindowDays     int     // ... and be placed within this many days of the referral
+}
+
+// CampaignConfig controls the background campaign scheduler
+type CampaignConfig struct {
+	SchedulerEnabled  bool
+	SchedulerInterval time.Duration // How often active campaigns are queued and sent
+}
+
+// OutboxConfig controls delivery of the notifications and webhooks queued
+// with order and sale changes
+type OutboxConfig struct {
+	DispatchEnabled  bool
+	DispatchInterval time.Duration
+	MaxAttempts      int      // deliveries tried before a message is marked failed
+	WebhookURLs      []string // endpoints that receive order and sale events
+	WebhookSecret    string   // signs webhook bodies (X-Webhook-Signature)
+}
+
+// WebhookInboxConfig sets up the endpoints third parties post events to,
+// /api/v1/webhooks/<integration>. Each integration signs its requests
+// with its own secret.
+type WebhookInboxConfig struct {
+	Secrets       map[string]string // integration name to signing secret
+	Tolerance     time.Duration     // how far a request's timestamp may be from now
+	RetentionDays int               // processed and ignored events are deleted after this
+	PruneCron     string
+}
+
+// ColdChainConfig controls temperature logging of refrigerated stock.
+// Data loggers post their readings as events of the inbound webhook
+// integration named Integration, signed with its INBOUND_WEBHOOK_SECRETS
+// secret.
+type ColdChainConfig struct {
+	Integration   string
+	SensorTimeout time.Duration // a logger silent this long is alerted on
+	CheckCron     string        // when silent loggers are looked for
+}
+
+// StationConfig controls the print and cash drawer jobs handed to the
+// agents running beside paired terminals
+type StationConfig struct {
+	PollInterval time.Duration // how often agents are told to poll
+	JobLease     time.Duration // a job not reported back in this long is sent again
+	MaxAttempts  int
+	PrintJobTTL  time.Duration // receipts, labels and pick lists
+	DrawerJobTTL time.Duration // a drawer opening long after it was asked for is a risk
+	SweepCron    string        // when jobs no agent took are expired
+}
+
+// FeedbackConfig controls the feedback asked of customers once an online
+// order is delivered or picked up
+type FeedbackConfig struct {
+	InvitesEnabled bool   // message the customer the feedback link
+	FormBaseURL    string // Public page that accepts a feedback token
+	LinkValidDays  int    // how long the link and its QR code take a response
+}
+
+// DocumentConfig controls the renewal reminders for licenses and
+// accreditations on file
+type DocumentConfig struct {
+	ReminderDays []int  // staff are alerted this many days before a document expires, e.g. 90, 30 and 7
+	ExpiringDays int    // the dashboard lists documents expiring within this many days
+	ReminderCron string // when expiring documents are looked for
+}
+
+// JobConfig controls the background job workers
+type JobConfig struct {
+	WorkerEnabled bool
+	PollInterval  time.Duration
+	Concurrency   int           // jobs run at once on each server
+	MaxAttempts   int           // attempts before a job is dead
+	Timeout       time.Duration // longest one attempt may run
+	RetentionDays int           // completed jobs are deleted after this
+
+	CartCleanupCron string // when expired cart items are removed
+}
+
+type AuditArchiveConfig struct {
+	Enabled   bool
+	Interval  time.Duration // How often logs past HIPAA.DataRetentionDays are archived
+	Dir       string        // Local directory for the compressed archives
+	BatchSize int           // Logs per archive file
+
+	// QR scan logs older than this are archived the same way; 0 keeps them
+	ScanLogRetentionDays int
+}
+
+type OCRConfig struct {
+	Provider string // none or http
+	Endpoint string
+	APIKey   string
+	Timeout  time.Duration
 }
 
 func LoadConfig() (*Config, error) {
@@ -109,20 +604,8 @@ func LoadConfig() (*Config, error) {
 		env = "development"
 	}
 
-	// Try to load environment-specific file
-	envFile := fmt.Sprintf(".env.%s", env)
-	if _, err := os.Stat(envFile); err == nil {
-		err = godotenv.Load(envFile)
-		if err != nil {
-			return nil, fmt.Errorf("error loading %s file: %v", envFile, err)
-		}
-	} else {
-		// Fallback to .env file
-		err = godotenv.Load()
-		if err != nil {
-			// Don't fail if .env doesn't exist - use environment variables
-			fmt.Printf("Warning: .env file not found in %s mode, using environment variables only\n", env)
-		}
+	if err := loadEnvFile(env); err != nil {
+		return nil, err
 	}
 
 	config := &Config{
@@ -131,6 +614,29 @@ func LoadConfig() (*Config, error) {
 			Host: getEnv("SERVER_HOST", "localhost"),
 			Port: getEnv("SERVER_PORT", "8080"),
 			Mode: getEnv("GIN_MODE", "debug"),
+
+			V1Sunset: getEnv("API_V1_SUNSET", ""),
+
+			TLSCertFile:      getEnv("TLS_CERT_FILE", ""),
+			TLSKeyFile:       getEnv("TLS_KEY_FILE", ""),
+			AutocertDomains:  parseCommaSeparated(getEnv("TLS_AUTOCERT_DOMAINS", "")),
+			AutocertEmail:    getEnv("TLS_AUTOCERT_EMAIL", ""),
+			AutocertCacheDir: getEnv("TLS_AUTOCERT_CACHE_DIR", "./certs"),
+			ACMEDirectoryURL: getEnv("TLS_ACME_DIRECTORY_URL", ""),
+			TLSMinVersion:    getEnv("TLS_MIN_VERSION", "1.2"),
+			HTTPPort:         getEnv("TLS_HTTP_PORT", ""),
+			HTTP2:            getEnvAsBool("HTTP2_ENABLED", true),
+
+			ReadTimeout:    time.Duration(getEnvAsInt("READ_TIMEOUT", 30)) * time.Second,
+			POSTimeout:     time.Duration(getEnvAsInt("POS_TIMEOUT", 10)) * time.Second,
+			RequestTimeout: time.Duration(getEnvAsInt("REQUEST_TIMEOUT", 30)) * time.Second,
+			ReportTimeout:  time.Duration(getEnvAsInt("REPORT_TIMEOUT", 120)) * time.Second,
+
+			ShutdownTimeout: time.Duration(getEnvAsInt("SHUTDOWN_TIMEOUT", 30)) * time.Second,
+
+			CompressionEnabled: getEnvAsBool("COMPRESSION_ENABLED", true),
+			CompressionLevel:   getEnvAsInt("COMPRESSION_LEVEL", 5),
+			CompressionMinSize: getEnvAsInt("COMPRESSION_MIN_SIZE", 1024),
 		},
 		Database: DatabaseConfig{
 			Host:            getEnv("DB_HOST", "localhost"),
@@ -143,6 +649,8 @@ func LoadConfig() (*Config, error) {
 			MaxIdleConns:    getEnvAsInt("DB_MAX_IDLE_CONNS", 10),
 			ConnMaxLifetime: time.Duration(getEnvAsInt("DB_CONN_MAX_LIFETIME", 3600)) * time.Second,
 			Enabled:         true,
+
+			SlowQueryThreshold: time.Duration(getEnvAsInt("DB_SLOW_QUERY_MS", 200)) * time.Millisecond,
 		},
 		CloudDB: DatabaseConfig{
 			Host:            getEnv("CLOUD_DB_HOST", ""),
@@ -179,14 +687,26 @@ func LoadConfig() (*Config, error) {
 			MaxIdleConns:    getEnvAsInt("DB_MAX_IDLE_CONNS", 5),
 			ConnMaxLifetime: time.Duration(getEnvAsInt("DB_CONN_MAX_LIFETIME", 3600)) * time.Second,
 			Enabled:         getEnvAsBool("READ_REPLICA_ENABLED", false),
+			MaxLag:          time.Duration(getEnvAsInt("READ_REPLICA_MAX_LAG", 5)) * time.Second,
 		},
 		Redis: RedisConfig{
+			Enabled:  getEnvAsBool("REDIS_ENABLED", true),
 			Host:     getEnv("REDIS_HOST", "localhost"),
 			Port:     getEnv("REDIS_PORT", "6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
 			SSL:      getEnvAsBool("REDIS_SSL", false),
 		},
+		Cluster: ClusterConfig{
+			InstanceID:     getEnv("INSTANCE_ID", hostname()),
+			LeaderLeaseTTL: time.Duration(getEnvAsInt("LEADER_LEASE_TTL", 30)) * time.Second,
+		},
+		Cache: CacheConfig{
+			Enabled:      getEnvAsBool("CACHE_ENABLED", true),
+			ProductTTL:   time.Duration(getEnvAsInt("CACHE_PRODUCT_TTL", 300)) * time.Second,
+			ServiceTTL:   time.Duration(getEnvAsInt("CACHE_SERVICE_TTL", 3600)) * time.Second,
+			AnalyticsTTL: time.Duration(getEnvAsInt("CACHE_ANALYTICS_TTL", 60)) * time.Second,
+		},
 		Security: SecurityConfig{
 			EncryptionKey:        getEnv("ENCRYPTION_KEY", ""),
 			JWTSecret:           getEnv("JWT_SECRET", ""),
@@ -197,15 +717,56 @@ func LoadConfig() (*Config, error) {
 			LoginLockoutMinutes: getEnvAsInt("LOGIN_LOCKOUT_MINUTES", 15),
 			RateLimitRPS:        getEnvAsInt("RATE_LIMIT_RPS", 100),
 			RateLimitBurst:      getEnvAsInt("RATE_LIMIT_BURST", 200),
+			IdempotencyTTL:      time.Duration(getEnvAsInt("IDEMPOTENCY_KEY_TTL", 86400)) * time.Second,
+			BootstrapToken:      getEnv("BOOTSTRAP_TOKEN", ""),
 		},
-		CORS: CORSConfig{
-			AllowedOrigins: parseCommaSeparated(getEnv("CORS_ALLOWED_ORIGINS", "*")),
-			AllowedMethods: parseCommaSeparated(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS")),
-			AllowedHeaders: parseCommaSeparated(getEnv("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-Requested-With")),
+		Session: SessionConfig{
+			CookiesEnabled: getEnvAsBool("SESSION_COOKIES_ENABLED", false),
+			CookieDomain:   getEnv("SESSION_COOKIE_DOMAIN", ""),
+			CookieSecure:   getEnvAsBool("SESSION_COOKIE_SECURE", true),
+			CookieSameSite: getEnv("SESSION_COOKIE_SAMESITE", "strict"),
+		},
+		Encryption: EncryptionConfig{
+			KeyManagement:      getEnvAsBool("ENCRYPTION_KEY_MANAGEMENT", false),
+			MasterKeyProvider:  getEnv("ENCRYPTION_MASTER_KEY_PROVIDER", "local"),
+			MasterKey:          getEnv("ENCRYPTION_MASTER_KEY", ""),
+			VaultAddr:          getEnv("VAULT_ADDR", ""),
+			VaultToken:         getEnv("VAULT_TOKEN", ""),
+			VaultTransitKey:    getEnv("VAULT_TRANSIT_KEY", "pharmacy-data"),
+			KMSKeyID:           getEnv("KMS_KEY_ID", ""),
+			KMSRegion:          getEnv("KMS_REGION", "us-east-1"),
+			KMSEndpoint:        getEnv("KMS_ENDPOINT", ""),
+			AWSAccessKey:       getEnv("AWS_ACCESS_KEY_ID", ""),
+			AWSSecretKey:       getEnv("AWS_SECRET_ACCESS_KEY", ""),
+			ReencryptEnabled:   getEnvAsBool("REENCRYPT_ENABLED", true),
+			ReencryptInterval:  time.Duration(getEnvAsInt("REENCRYPT_INTERVAL", 3600)) * time.Second,
+			ReencryptBatchSize: getEnvAsInt("REENCRYPT_BATCH_SIZE", 500),
+		},
+		Secrets: SecretsConfig{
+			Provider:    getEnv("SECRETS_PROVIDER", "env"),
+			Dir:         getEnv("SECRETS_DIR", "/run/secrets"),
+			AWSSecretID: getEnv("SECRETS_AWS_SECRET_ID", ""),
+			AWSRegion:   getEnv("SECRETS_AWS_REGION", getEnv("AWS_REGION", "us-east-1")),
+			AWSEndpoint: getEnv("SECRETS_AWS_ENDPOINT", ""),
+			VaultPath:   getEnv("SECRETS_VAULT_PATH", ""),
+		},
+		Headers: HeadersConfig{
+			ContentSecurityPolicy: getEnv("CONTENT_SECURITY_POLICY", "default-src 'self'"),
+			CSPReportOnly:         getEnvAsBool("CSP_REPORT_ONLY", false),
+			CSPReportURI:          getEnv("CSP_REPORT_URI", ""),
+			FrameOptions:          getEnv("X_FRAME_OPTIONS", "DENY"),
+			ReferrerPolicy:        getEnv("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+			PermissionsPolicy:     getEnv("PERMISSIONS_POLICY", ""),
+			HSTSMaxAge:            getEnvAsInt("HSTS_MAX_AGE", 31536000),
+			HSTSIncludeSubdomains: getEnvAsBool("HSTS_INCLUDE_SUBDOMAINS", true),
 		},
 		Logging: LoggingConfig{
-			Level:  getEnv("LOG_LEVEL", "info"),
-			Format: getEnv("LOG_FORMAT", "json"),
+			Level:        getEnv("LOG_LEVEL", ""),
+			Format:       getEnv("LOG_FORMAT", "json"),
+			File:         getEnv("LOG_FILE", ""),
+			Syslog:       getEnv("LOG_SYSLOG", ""),
+			OTLPEndpoint: getEnv("LOG_OTLP_ENDPOINT", ""),
+			OTLPHeaders:  parseKeyValues(getEnv("LOG_OTLP_HEADERS", "")),
 		},
 		HIPAA: HIPAAConfig{
 			Mode:              getEnvAsBool("HIPAA_MODE", false),
@@ -215,20 +776,253 @@ func LoadConfig() (*Config, error) {
 		Sync: SyncConfig{
 			Enabled:        getEnvAsBool("DB_SYNC_ENABLED", false),
 			Interval:       time.Duration(getEnvAsInt("DB_SYNC_INTERVAL", 300)) * time.Second,
+			BatchSize:      getEnvAsInt("DB_SYNC_BATCH_SIZE", 500),
+			Bidirectional:  getEnvAsBool("DB_SYNC_BIDIRECTIONAL", false),
 			BackupEnabled:  getEnvAsBool("DB_BACKUP_ENABLED", false),
 			BackupInterval: time.Duration(getEnvAsInt("DB_BACKUP_INTERVAL", 3600)) * time.Second,
 		},
 		Monitoring: MonitoringConfig{
 			HealthCheckEnabled: getEnvAsBool("HEALTH_CHECK_ENABLED", true),
 			MetricsEnabled:     getEnvAsBool("METRICS_ENABLED", false),
+			MetricsToken:       getEnv("METRICS_TOKEN", ""),
+			MinFreeDiskMB:      getEnvAsInt("HEALTH_MIN_FREE_DISK_MB", 500),
 			TracingEnabled:     getEnvAsBool("TRACING_ENABLED", false),
+
+			DebugEnabled:    getEnvAsBool("DEBUG_ENDPOINTS_ENABLED", false),
+			DebugAddr:       getEnv("DEBUG_ADDR", ""),
+			DebugContention: getEnvAsBool("DEBUG_PROFILE_CONTENTION", false),
 		},
 		Backup: BackupConfig{
 			S3Bucket:          getEnv("S3_BACKUP_BUCKET", ""),
 			S3Region:          getEnv("S3_REGION", "us-east-1"),
+			S3Endpoint:        getEnv("S3_ENDPOINT", ""),
+			S3AccessKey:       getEnv("AWS_ACCESS_KEY_ID", ""),
+			S3SecretKey:       getEnv("AWS_SECRET_ACCESS_KEY", ""),
 			EncryptionEnabled: getEnvAsBool("BACKUP_ENCRYPTION", true),
+			Prefix:            getEnv("S3_BACKUP_PREFIX", "backups/"),
+			RetentionDays:     getEnvAsInt("BACKUP_RETENTION_DAYS", 30),
+			PgDumpPath:        getEnv("PG_DUMP_PATH", "pg_dump"),
+			PgRestorePath:     getEnv("PG_RESTORE_PATH", "pg_restore"),
+		},
+		Storage: StorageConfig{
+			Backend:    getEnv("STORAGE_BACKEND", "local"),
+			LocalDir:   getEnv("STORAGE_LOCAL_DIR", "uploads"),
+			Bucket:     getEnv("STORAGE_BUCKET", ""),
+			Prefix:     getEnv("STORAGE_PREFIX", ""),
+			Region:     getEnv("STORAGE_REGION", ""),
+			Endpoint:   getEnv("STORAGE_ENDPOINT", ""),
+			AccessKey:  getEnv("STORAGE_ACCESS_KEY", getEnv("AWS_ACCESS_KEY_ID", "")),
+			SecretKey:  getEnv("STORAGE_SECRET_KEY", getEnv("AWS_SECRET_ACCESS_KEY", "")),
+			Encryption: getEnv("STORAGE_ENCRYPTION", "AES256"),
+			KMSKeyID:   getEnv("STORAGE_KMS_KEY_ID", ""),
+			URLExpiry:  time.Duration(getEnvAsInt("STORAGE_URL_EXPIRY", 300)) * time.Second,
+		},
+		Refill: RefillConfig{
+			RemindersEnabled:  getEnvAsBool("REFILL_REMINDERS_ENABLED", true),
+			ReminderDaysAhead: getEnvAsInt("REFILL_REMINDER_DAYS_AHEAD", 3),
+			ReminderInterval:  time.Duration(getEnvAsInt("REFILL_REMINDER_INTERVAL", 3600)) * time.Second,
+			ReorderBaseURL:    getEnv("REFILL_REORDER_BASE_URL", "http://localhost:3000/refill"),
+		},
+		OCR: OCRConfig{
+			Provider: getEnv("OCR_PROVIDER", "none"),
+			Endpoint: getEnv("OCR_ENDPOINT", ""),
+			APIKey:   getEnv("OCR_API_KEY", ""),
+			Timeout:  time.Duration(getEnvAsInt("OCR_TIMEOUT", 30)) * time.Second,
+		},
+		Pharmacy: PharmacyConfig{
+			Name:          getEnv("PHARMACY_NAME", "AetherPharma"),
+			Address:       getEnv("PHARMACY_ADDRESS", ""),
+			Phone:         getEnv("PHARMACY_PHONE", ""),
+			LicenseNumber: getEnv("PHARMACY_LICENSE_NUMBER", ""),
+			TaxRate:       getEnvAsFloat("PHARMACY_TAX_RATE", 0.12),
+			Currency:      strings.ToUpper(getEnv("PHARMACY_CURRENCY", "PHP")),
+		},
+		Vaccination: VaccinationConfig{
+			RemindersEnabled:  getEnvAsBool("VACCINE_REMINDERS_ENABLED", true),
+			ReminderDaysAhead: getEnvAsInt("VACCINE_REMINDER_DAYS_AHEAD", 3),
+			ReminderInterval:  time.Duration(getEnvAsInt("VACCINE_REMINDER_INTERVAL", 3600)) * time.Second,
+			VerifyBaseURL:     getEnv("VACCINE_VERIFY_BASE_URL", "http://localhost:3000/verify"),
+		},
+		Notification: NotificationConfig{
+			UnsubscribeBaseURL: getEnv("UNSUBSCRIBE_BASE_URL", "http://localhost:3000/unsubscribe"),
+		},
+		SMS: SMSConfig{
+			Provider:   getEnv("SMS_PROVIDER", "none"),
+			APIURL:     getEnv("SMS_API_URL", ""),
+			SenderName: getEnv("SMS_SENDER_NAME", ""),
+			Timeout:    time.Duration(getEnvAsInt("SMS_TIMEOUT", 15)) * time.Second,
+
+			SemaphoreAPIKey: getEnv("SEMAPHORE_API_KEY", ""),
+
+			TwilioAccountSID:          getEnv("TWILIO_ACCOUNT_SID", ""),
+			TwilioAuthToken:           getEnv("TWILIO_AUTH_TOKEN", ""),
+			TwilioFrom:                getEnv("TWILIO_FROM", ""),
+			TwilioMessagingServiceSID: getEnv("TWILIO_MESSAGING_SERVICE_SID", ""),
+
+			StatusCallbackURL: getEnv("SMS_STATUS_CALLBACK_URL", ""),
+			StatusPollCron:    getEnv("SMS_STATUS_POLL_CRON", "*/5 * * * *"),
+
+			OTPTTL:         time.Duration(getEnvAsInt("SMS_OTP_TTL", 300)) * time.Second,
+			OTPMaxAttempts: getEnvAsInt("SMS_OTP_MAX_ATTEMPTS", 5),
+		},
+		Email: EmailConfig{
+			Provider: getEnv("EMAIL_PROVIDER", "none"),
+			From:     getEnv("EMAIL_FROM", ""),
+			FromName: getEnv("EMAIL_FROM_NAME", "AetherPharma"),
+			ReplyTo:  getEnv("EMAIL_REPLY_TO", ""),
+			Timeout:  time.Duration(getEnvAsInt("EMAIL_TIMEOUT", 15)) * time.Second,
+
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			SMTPTLS:      getEnv("SMTP_TLS", "starttls"),
+
+			SendGridAPIKey:           getEnv("SENDGRID_API_KEY", ""),
+			SendGridAPIURL:           getEnv("SENDGRID_API_URL", ""),
+			SendGridWebhookPublicKey: getEnv("SENDGRID_WEBHOOK_PUBLIC_KEY", ""),
+
+			PasswordResetURL: getEnv("PASSWORD_RESET_URL", ""),
+			PasswordResetTTL: time.Duration(getEnvAsInt("PASSWORD_RESET_TTL", 3600)) * time.Second,
+		},
+		Push: PushConfig{
+			Timeout: time.Duration(getEnvAsInt("PUSH_TIMEOUT", 10)) * time.Second,
+
+			FCMCredentialsFile: getEnv("FCM_CREDENTIALS_FILE", ""),
+			FCMProjectID:       getEnv("FCM_PROJECT_ID", ""),
+			FCMAPIURL:          getEnv("FCM_API_URL", ""),
+
+			APNsKeyFile:    getEnv("APNS_KEY_FILE", ""),
+			APNsKeyID:      getEnv("APNS_KEY_ID", ""),
+			APNsTeamID:     getEnv("APNS_TEAM_ID", ""),
+			APNsTopic:      getEnv("APNS_TOPIC", ""),
+			APNsProduction: getEnvAsBool("APNS_PRODUCTION", false),
+			APNsAPIURL:     getEnv("APNS_API_URL", ""),
 		},
+		FDA: FDAConfig{
+			RegistryURL: getEnv("FDA_REGISTRY_URL", ""),
+			RecallsURL:  getEnv("FDA_RECALLS_URL", ""),
+			RefreshCron: getEnv("FDA_REGISTRY_REFRESH_CRON", "0 4 * * *"),
+			Timeout:     time.Duration(getEnvAsInt("FDA_REGISTRY_TIMEOUT", 300)) * time.Second,
+		},
+		Alerting: AlertingConfig{
+			SlackWebhookURL: getEnv("ALERT_SLACK_WEBHOOK_URL", ""),
+			TeamsWebhookURL: getEnv("ALERT_TEAMS_WEBHOOK_URL", ""),
+			Source:          getEnv("ALERT_SOURCE", ""),
+			Timeout:         time.Duration(getEnvAsInt("ALERT_TIMEOUT", 10)) * time.Second,
+			Cooldown:        time.Duration(getEnvAsInt("ALERT_COOLDOWN", 900)) * time.Second,
+		},
+		Geocoding: GeocodingConfig{
+			Provider:     getEnv("GEOCODING_PROVIDER", "none"),
+			GoogleAPIKey: getEnv("GOOGLE_MAPS_API_KEY", ""),
+			APIURL:       getEnv("GEOCODING_API_URL", ""),
+			Region:       getEnv("GEOCODING_REGION", "ph"),
+			Timeout:      time.Duration(getEnvAsInt("GEOCODING_TIMEOUT", 10)) * time.Second,
+		},
+		Segment: SegmentConfig{
+			RefreshEnabled:  getEnvAsBool("SEGMENT_REFRESH_ENABLED", true),
+			RefreshInterval: time.Duration(getEnvAsInt("SEGMENT_REFRESH_INTERVAL", 21600)) * time.Second,
+		},
+		Loyalty: LoyaltyConfig{
+			PesosPerPoint:  getEnvAsInt("LOYALTY_PESOS_PER_POINT", 100),
+			RecalcEnabled:  getEnvAsBool("LOYALTY_TIER_RECALC_ENABLED", true),
+			RecalcInterval: time.Duration(getEnvAsInt("LOYALTY_TIER_RECALC_INTERVAL", 86400)) * time.Second,
+		},
+		Referral: ReferralConfig{
+			RewardType:     getEnv("REFERRAL_REWARD_TYPE", "points"),
+			ReferrerReward: getEnvAsFloat("REFERRAL_REFERRER_REWARD", 200),
+			RefereeReward:  getEnvAsFloat("REFERRAL_NEW_CUSTOMER_REWARD", 100),
+			MinFirstOrder:  getEnvAsFloat("REFERRAL_MIN_FIRST_ORDER", 0),
+			WindowDays:     getEnvAsInt("REFERRAL_WINDOW_DAYS", 60),
+		},
+		Campaign: CampaignConfig{
+			SchedulerEnabled:  getEnvAsBool("CAMPAIGN_SCHEDULER_ENABLED", true),
+			SchedulerInterval: time.Duration(getEnvAsInt("CAMPAIGN_SCHEDULER_INTERVAL", 3600)) * time.Second,
+		},
+		Network: NetworkAccessConfig{
+			RoleIPAllowlist: parseRoleLists(getEnv("ROLE_IP_ALLOWLIST", "")),
+			RoleCountries:   parseRoleLists(strings.ToUpper(getEnv("ROLE_ALLOWED_COUNTRIES", ""))),
+			TrustedProxies:  parseCommaSeparated(getEnv("TRUSTED_PROXIES", "")),
+		},
+		LoginGuard: LoginGuardConfig{
+			IPMaxFailures:       getEnvAsInt("LOGIN_IP_MAX_FAILURES", 20),
+			IPWindow:            time.Duration(getEnvAsInt("LOGIN_IP_WINDOW", 900)) * time.Second,
+			IPBlockDuration:     time.Duration(getEnvAsInt("LOGIN_IP_BLOCK_MINUTES", 30)) * time.Minute,
+			CaptchaProvider:     getEnv("CAPTCHA_PROVIDER", "none"),
+			CaptchaSecret:       getEnv("CAPTCHA_SECRET", ""),
+			CaptchaVerifyURL:    getEnv("CAPTCHA_VERIFY_URL", ""),
+			CaptchaAfterIP:      getEnvAsInt("CAPTCHA_AFTER_IP_FAILURES", 5),
+			CaptchaAfterUser:    getEnvAsInt("CAPTCHA_AFTER_USER_FAILURES", 3),
+			GeoIPProvider:       getEnv("GEOIP_PROVIDER", "none"),
+			GeoIPEndpoint:       getEnv("GEOIP_ENDPOINT", ""),
+			ImpossibleTravelKMH: float64(getEnvAsInt("IMPOSSIBLE_TRAVEL_KMH", 900)),
+			NewDeviceAlerts:     getEnvAsBool("NEW_DEVICE_ALERTS", true),
+		},
+		AuditArchive: AuditArchiveConfig{
+			Enabled:   getEnvAsBool("AUDIT_ARCHIVE_ENABLED", true),
+			Interval:  time.Duration(getEnvAsInt("AUDIT_ARCHIVE_INTERVAL", 86400)) * time.Second,
+			Dir:       getEnv("AUDIT_ARCHIVE_DIR", "./archives/audit"),
+			BatchSize: getEnvAsInt("AUDIT_ARCHIVE_BATCH_SIZE", 10000),
+
+			ScanLogRetentionDays: getEnvAsInt("QR_SCAN_LOG_RETENTION_DAYS", 365),
+		},
+		Outbox: OutboxConfig{
+			DispatchEnabled:  getEnvAsBool("OUTBOX_DISPATCH_ENABLED", true),
+			DispatchInterval: time.Duration(getEnvAsInt("OUTBOX_DISPATCH_INTERVAL", 10)) * time.Second,
+			MaxAttempts:      getEnvAsInt("OUTBOX_MAX_ATTEMPTS", 8),
+			WebhookURLs:      parseCommaSeparated(getEnv("WEBHOOK_URLS", "")),
+			WebhookSecret:    getEnv("WEBHOOK_SECRET", ""),
+		},
+		WebhookInbox: WebhookInboxConfig{
+			Secrets:       parseKeyValues(getEnv("INBOUND_WEBHOOK_SECRETS", "")),
+			Tolerance:     time.Duration(getEnvAsInt("INBOUND_WEBHOOK_TOLERANCE", 300)) * time.Second,
+			RetentionDays: getEnvAsInt("INBOUND_WEBHOOK_RETENTION_DAYS", 90),
+			PruneCron:     getEnv("INBOUND_WEBHOOK_PRUNE_CRON", "30 3 * * *"),
+		},
+		ColdChain: ColdChainConfig{
+			Integration:   getEnv("COLD_CHAIN_INTEGRATION", "sensors"),
+			SensorTimeout: time.Duration(getEnvAsInt("COLD_CHAIN_SENSOR_TIMEOUT", 1800)) * time.Second,
+			CheckCron:     getEnv("COLD_CHAIN_CHECK_CRON", "*/15 * * * *"),
+		},
+		Station: StationConfig{
+			PollInterval: time.Duration(getEnvAsInt("STATION_POLL_INTERVAL", 2)) * time.Second,
+			JobLease:     time.Duration(getEnvAsInt("STATION_JOB_LEASE", 60)) * time.Second,
+			MaxAttempts:  getEnvAsInt("STATION_JOB_ATTEMPTS", 3),
+			PrintJobTTL:  time.Duration(getEnvAsInt("STATION_PRINT_JOB_TTL", 3600)) * time.Second,
+			DrawerJobTTL: time.Duration(getEnvAsInt("STATION_DRAWER_JOB_TTL", 30)) * time.Second,
+			SweepCron:    getEnv("STATION_SWEEP_CRON", "* * * * *"),
+		},
+		Feedback: FeedbackConfig{
+			InvitesEnabled: getEnvAsBool("FEEDBACK_INVITES_ENABLED", true),
+			FormBaseURL:    getEnv("FEEDBACK_BASE_URL", "http://localhost:3000/feedback"),
+			LinkValidDays:  getEnvAsInt("FEEDBACK_LINK_DAYS", 14),
+		},
+		Documents: DocumentConfig{
+			ReminderDays: parseDayList(getEnv("DOCUMENT_REMINDER_DAYS", "90,60,30,7")),
+			ExpiringDays: getEnvAsInt("DOCUMENT_EXPIRING_DAYS", 60),
+			ReminderCron: getEnv("DOCUMENT_REMINDER_CRON", "0 1 * * *"),
+		},
+		Jobs: JobConfig{
+			WorkerEnabled: getEnvAsBool("JOB_WORKER_ENABLED", true),
+			PollInterval:  time.Duration(getEnvAsInt("JOB_POLL_INTERVAL", 5)) * time.Second,
+			Concurrency:   getEnvAsInt("JOB_CONCURRENCY", 4),
+			MaxAttempts:   getEnvAsInt("JOB_MAX_ATTEMPTS", 5),
+			Timeout:       time.Duration(getEnvAsInt("JOB_TIMEOUT", 1800)) * time.Second,
+			RetentionDays: getEnvAsInt("JOB_RETENTION_DAYS", 14),
+
+			CartCleanupCron: getEnv("JOB_CART_CLEANUP_CRON", "@hourly"),
+		},
+	}
+
+	// Read secrets kept outside the environment
+	if err := config.loadSecrets(); err != nil {
+		return nil, err
+	}
+	live, err := readReloadable()
+	if err != nil {
+		return nil, fmt.Errorf("config validation failed: %v", err)
 	}
+	config.live.Store(live)
 
 	// Validate configuration
 	if err := config.Validate(); err != nil {
@@ -244,18 +1038,215 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database password is required in production")
 	}
 
-	if c.Security.EncryptionKey == "" {
+	// With a Vault or KMS master key, ENCRYPTION_KEY is only needed to read
+	// data written before key management was enabled
+	remoteMasterKey := c.Encryption.KeyManagement && c.Encryption.MasterKeyProvider != "local"
+	if c.Security.EncryptionKey == "" && !remoteMasterKey {
 		return fmt.Errorf("encryption key is required")
 	}
 
-	if len(c.Security.EncryptionKey) != 32 {
+	if c.Security.EncryptionKey != "" && len(c.Security.EncryptionKey) != 32 {
 		return fmt.Errorf("encryption key must be 32 characters long")
 	}
 
+	if c.Encryption.KeyManagement {
+		switch c.Encryption.MasterKeyProvider {
+		case "local":
+			if c.Encryption.MasterKey != "" && len(c.Encryption.MasterKey) != 32 {
+				return fmt.Errorf("encryption master key must be 32 characters long")
+			}
+		case "vault":
+			if c.Encryption.VaultAddr == "" || c.Encryption.VaultToken == "" {
+				return fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required for the vault master key provider")
+			}
+		case "kms":
+			if c.Encryption.KMSKeyID == "" {
+				return fmt.Errorf("KMS_KEY_ID is required for the kms master key provider")
+			}
+		default:
+			return fmt.Errorf("unknown encryption master key provider %q", c.Encryption.MasterKeyProvider)
+		}
+	}
+
+	if c.Security.BootstrapToken != "" && len(c.Security.BootstrapToken) < 32 {
+		return fmt.Errorf("bootstrap token must be at least 32 characters long")
+	}
+
+	if c.Cluster.LeaderLeaseTTL < 3*time.Second {
+		return fmt.Errorf("leader lease TTL must be at least 3 seconds")
+	}
+
+	if c.Session.CookiesEnabled {
+		switch c.Session.CookieSameSite {
+		case "strict", "lax":
+		case "none":
+			if !c.Session.CookieSecure {
+				return fmt.Errorf("SameSite=None session cookies must be secure")
+			}
+		default:
+			return fmt.Errorf("session cookie SameSite must be strict, lax or none")
+		}
+	}
+
+	for role, networks := range c.Network.RoleIPAllowlist {
+		for _, network := range networks {
+			if _, err := ParseNetwork(network); err != nil {
+				return fmt.Errorf("invalid IP allowlist entry %q for role %s", network, role)
+			}
+		}
+	}
+	for _, proxy := range c.Network.TrustedProxies {
+		if _, err := ParseNetwork(proxy); err != nil {
+			return fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+	}
+	if len(c.Network.RoleCountries) > 0 && c.LoginGuard.GeoIPProvider == "none" {
+		return fmt.Errorf("ROLE_ALLOWED_COUNTRIES needs a GEOIP_PROVIDER")
+	}
+
+	switch c.Storage.Backend {
+	case "local":
+	case "s3", "gcs":
+		if c.Storage.Bucket == "" {
+			return fmt.Errorf("STORAGE_BUCKET is required for the %s storage backend", c.Storage.Backend)
+		}
+		if c.Storage.Backend == "gcs" && (c.Storage.AccessKey == "" || c.Storage.SecretKey == "") {
+			return fmt.Errorf("STORAGE_ACCESS_KEY and STORAGE_SECRET_KEY (an HMAC key) are required for the gcs storage backend")
+		}
+	default:
+		return fmt.Errorf("unknown storage backend %q", c.Storage.Backend)
+	}
+	switch c.Storage.Encryption {
+	case "AES256", "aws:kms", "none":
+	default:
+		return fmt.Errorf("STORAGE_ENCRYPTION must be AES256, aws:kms or none")
+	}
+
+	if len(c.Outbox.WebhookURLs) > 0 && c.Outbox.WebhookSecret == "" {
+		return fmt.Errorf("WEBHOOK_SECRET is required when WEBHOOK_URLS is set")
+	}
+
+	if c.ColdChain.SensorTimeout < time.Minute {
+		return fmt.Errorf("cold chain sensor timeout must be at least 60 seconds")
+	}
+
+	if c.Station.PollInterval < time.Second || c.Station.JobLease <= c.Station.PollInterval {
+		return fmt.Errorf("STATION_JOB_LEASE must be longer than STATION_POLL_INTERVAL, which must be at least 1 second")
+	}
+	if c.Station.MaxAttempts < 1 {
+		return fmt.Errorf("STATION_JOB_ATTEMPTS must be at least 1")
+	}
+	if c.Station.PrintJobTTL <= 0 || c.Station.DrawerJobTTL <= 0 {
+		return fmt.Errorf("STATION_PRINT_JOB_TTL and STATION_DRAWER_JOB_TTL must be positive")
+	}
+
+	if c.Referral.RewardType != "points" && c.Referral.RewardType != "credit" {
+		return fmt.Errorf("REFERRAL_REWARD_TYPE must be points or credit")
+	}
+	if c.Referral.ReferrerReward < 0 || c.Referral.RefereeReward < 0 || c.Referral.MinFirstOrder < 0 {
+		return fmt.Errorf("referral rewards and REFERRAL_MIN_FIRST_ORDER cannot be negative")
+	}
+	if c.Referral.WindowDays < 1 {
+		return fmt.Errorf("REFERRAL_WINDOW_DAYS must be at least 1")
+	}
+
+	if c.Feedback.LinkValidDays < 1 {
+		return fmt.Errorf("FEEDBACK_LINK_DAYS must be at least 1")
+	}
+
+	if len(c.Documents.ReminderDays) == 0 {
+		return fmt.Errorf("DOCUMENT_REMINDER_DAYS must list at least one number of days, e.g. 90,30,7")
+	}
+	if c.Documents.ExpiringDays < 1 {
+		return fmt.Errorf("DOCUMENT_EXPIRING_DAYS must be at least 1")
+	}
+
+	switch c.Geocoding.Provider {
+	case "none":
+	case "google":
+		if c.Geocoding.GoogleAPIKey == "" {
+			return fmt.Errorf("GOOGLE_MAPS_API_KEY is required for the google geocoding provider")
+		}
+	default:
+		return fmt.Errorf("unknown geocoding provider %q", c.Geocoding.Provider)
+	}
+
+	switch c.SMS.Provider {
+	case "none":
+	case "semaphore":
+		if c.SMS.SemaphoreAPIKey == "" {
+			return fmt.Errorf("SEMAPHORE_API_KEY is required for the semaphore SMS provider")
+		}
+	case "twilio":
+		if c.SMS.TwilioAccountSID == "" || c.SMS.TwilioAuthToken == "" {
+			return fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required for the twilio SMS provider")
+		}
+		if c.SMS.TwilioFrom == "" && c.SMS.TwilioMessagingServiceSID == "" {
+			return fmt.Errorf("TWILIO_FROM or TWILIO_MESSAGING_SERVICE_SID is required for the twilio SMS provider")
+		}
+	default:
+		return fmt.Errorf("unknown SMS provider %q", c.SMS.Provider)
+	}
+
+	switch c.Email.Provider {
+	case "none":
+	case "smtp":
+		if c.Email.SMTPHost == "" {
+			return fmt.Errorf("SMTP_HOST is required for the smtp email provider")
+		}
+		if c.Email.SMTPTLS != "starttls" && c.Email.SMTPTLS != "tls" && c.Email.SMTPTLS != "none" {
+			return fmt.Errorf("SMTP_TLS must be starttls, tls or none")
+		}
+	case "sendgrid":
+		if c.Email.SendGridAPIKey == "" {
+			return fmt.Errorf("SENDGRID_API_KEY is required for the sendgrid email provider")
+		}
+	default:
+		return fmt.Errorf("unknown email provider %q", c.Email.Provider)
+	}
+
+	if c.Push.APNsKeyFile != "" && (c.Push.APNsKeyID == "" || c.Push.APNsTeamID == "" || c.Push.APNsTopic == "") {
+		return fmt.Errorf("APNS_KEY_ID, APNS_TEAM_ID and APNS_TOPIC are required with APNS_KEY_FILE")
+	}
+	if c.Email.Provider != "none" && c.Email.From == "" {
+		return fmt.Errorf("EMAIL_FROM is required to send email")
+	}
+
 	if c.Security.JWTSecret == "" {
 		return fmt.Errorf("JWT secret is required")
 	}
 
+	if (c.Server.TLSCertFile == "") != (c.Server.TLSKeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if c.Server.TLSCertFile != "" && len(c.Server.AutocertDomains) > 0 {
+		return fmt.Errorf("set TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS, not both")
+	}
+	if c.Server.TLSMinVersion != "1.2" && c.Server.TLSMinVersion != "1.3" {
+		return fmt.Errorf("TLS_MIN_VERSION must be 1.2 or 1.3")
+	}
+	if c.Server.POSTimeout <= 0 || c.Server.RequestTimeout <= 0 || c.Server.ReportTimeout <= 0 {
+		return fmt.Errorf("POS_TIMEOUT, REQUEST_TIMEOUT and REPORT_TIMEOUT must be positive")
+	}
+	if c.Server.CompressionEnabled && (c.Server.CompressionLevel < 1 || c.Server.CompressionLevel > 9) {
+		return fmt.Errorf("COMPRESSION_LEVEL must be between 1 and 9")
+	}
+
+	if c.Logging.Level != "" {
+		if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+			return fmt.Errorf("invalid LOG_LEVEL %q", c.Logging.Level)
+		}
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		return fmt.Errorf("LOG_FORMAT must be json or text")
+	}
+
+	if c.Server.V1Sunset != "" {
+		if _, err := time.Parse("2006-01-02", c.Server.V1Sunset); err != nil {
+			return fmt.Errorf("API_V1_SUNSET must be a date as YYYY-MM-DD: %w", err)
+		}
+	}
+
 	// Validate dual database setup
 	if c.CloudDB.Enabled && c.LocalDB.Enabled {
 		fmt.Println("✅ Dual database configuration detected:")
@@ -279,6 +1270,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("sync is enabled but no secondary database is configured")
 	}
 
+	if c.Sync.Bidirectional && (!c.Sync.Enabled || !c.CloudDB.Enabled) {
+		return fmt.Errorf("DB_SYNC_BIDIRECTIONAL requires sync to be enabled with a cloud database")
+	}
+
 	return nil
 }
 
@@ -317,6 +1312,17 @@ func (c *Config) buildDSN(db DatabaseConfig) string {
 }
 
 // Helper functions
+
+// hostname names this instance when INSTANCE_ID isn't set; container
+// platforms give every replica a host name of its own
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "pharmacy-backend"
+	}
+	return name
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -333,6 +1339,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
@@ -356,6 +1371,70 @@ func parseCommaSeparated(value string) []string {
 	return result
 }
 
+// parseDayList reads "90,30,7" into day counts, largest first. Entries that
+// aren't a positive number are dropped.
+func parseDayList(value string) []int {
+	var days []int
+	for _, v := range parseCommaSeparated(value) {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = append(days, n)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(days)))
+	return days
+}
+
+// parseRoleLists reads "role=a,b;role=c" into lists per lowercased role
+func parseRoleLists(value string) map[string][]string {
+	lists := map[string][]string{}
+	for _, entry := range strings.Split(value, ";") {
+		role, values, found := strings.Cut(entry, "=")
+		role = strings.ToLower(strings.TrimSpace(role))
+		if !found || role == "" {
+			continue
+		}
+		if parsed := parseCommaSeparated(values); len(parsed) > 0 {
+			lists[role] = append(lists[role], parsed...)
+		}
+	}
+	return lists
+}
+
+// parseKeyValues reads "key=value,key=value", as OTLP exporters take headers
+func parseKeyValues(value string) map[string]string {
+	values := map[string]string{}
+	for _, entry := range parseCommaSeparated(value) {
+		key, v, found := strings.Cut(entry, "=")
+		if key = strings.TrimSpace(key); found && key != "" {
+			values[key] = strings.TrimSpace(v)
+		}
+	}
+	return values
+}
+
+// ParseNetwork reads a CIDR, or a single IP as a one-address network
+func ParseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", value)
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// TLSEnabled reports whether the server terminates TLS itself
+func (s ServerConfig) TLSEnabled() bool {
+	return s.TLSCertFile != "" || len(s.AutocertDomains) > 0
+}
+
 // IsProduction returns true if running in production environment
 func (c *Config) IsProduction() bool {
 	return c.Environment == "production"
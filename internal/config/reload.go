@@ -0,0 +1,184 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Reloadable holds the settings that can change while the server runs, on
+// SIGHUP or when an admin asks for a reload. Everything else is read once
+// at startup.
+type Reloadable struct {
+	RateLimit RateLimitConfig
+	CORS      CORSConfig
+	Features  FeatureFlags
+}
+
+// Feature flag names
+const (
+	FeatureOnlineOrdering = "online_ordering" // new cart items and online orders; tracking stays up
+	FeatureQRScanning     = "qr_scanning"     // public QR scans
+	FeatureRefillReorder  = "refill_reorder"  // one-tap reorders from refill reminders
+)
+
+var featureNames = []string{FeatureOnlineOrdering, FeatureQRScanning, FeatureRefillReorder}
+
+// FeatureNames lists the features FEATURE_FLAGS can switch off
+func FeatureNames() []string {
+	return append([]string(nil), featureNames...)
+}
+
+// Enabled reports whether the named feature is on
+func (f FeatureFlags) Enabled(name string) bool {
+	enabled, ok := f[name]
+	return !ok || enabled
+}
+
+// Live returns the reloadable settings in effect. Read them per request
+// rather than keeping them, so a reload takes effect.
+func (c *Config) Live() *Reloadable {
+	live, _ := c.live.Load().(*Reloadable)
+	if live == nil {
+		return &Reloadable{}
+	}
+	return live
+}
+
+var reloadMu sync.Mutex
+
+// Reload reads the environment file again and puts its rate limits, CORS
+// settings and feature flags in effect. Variables set in the process
+// environment, rather than the file, keep their values. When the new
+// settings are invalid the current ones stay.
+func (c *Config) Reload() (*Reloadable, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if err := loadEnvFile(c.Environment); err != nil {
+		return nil, err
+	}
+	live, err := readReloadable()
+	if err != nil {
+		return nil, err
+	}
+	c.live.Store(live)
+	return live, nil
+}
+
+// readReloadable reads the reloadable settings from the environment
+func readReloadable() (*Reloadable, error) {
+	features, err := parseFeatureFlags(getEnv("FEATURE_FLAGS", ""))
+	if err != nil {
+		return nil, err
+	}
+	live := &Reloadable{
+		CORS: CORSConfig{
+			AllowedOrigins: parseCommaSeparated(getEnv("CORS_ALLOWED_ORIGINS", "*")),
+			AllowedMethods: parseCommaSeparated(getEnv("CORS_ALLOWED_METHODS", "GET,POST,PUT,DELETE,OPTIONS")),
+			AllowedHeaders: parseCommaSeparated(getEnv("CORS_ALLOWED_HEADERS", "Content-Type,Authorization,X-Requested-With,Idempotency-Key,X-CSRF-Token,X-Client-Type,X-Read-Consistency,X-Branch-ID,X-Terminal-Token")),
+		},
+		RateLimit: RateLimitConfig{
+			Public: RateLimitTier{
+				Requests: getEnvAsInt("RATE_LIMIT_PUBLIC_REQUESTS", 60),
+				Window:   time.Duration(getEnvAsInt("RATE_LIMIT_PUBLIC_WINDOW", 60)) * time.Second,
+			},
+			Login: RateLimitTier{
+				Requests: getEnvAsInt("RATE_LIMIT_LOGIN_REQUESTS", 10),
+				Window:   time.Duration(getEnvAsInt("RATE_LIMIT_LOGIN_WINDOW", 60)) * time.Second,
+			},
+			User: RateLimitTier{
+				Requests: getEnvAsInt("RATE_LIMIT_USER_REQUESTS", 300),
+				Window:   time.Duration(getEnvAsInt("RATE_LIMIT_USER_WINDOW", 60)) * time.Second,
+			},
+		},
+		Features: features,
+	}
+
+	origins := live.CORS.AllowedOrigins
+	for _, origin := range origins {
+		if origin == "*" && len(origins) == 1 {
+			continue
+		}
+		if !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			return nil, fmt.Errorf("CORS origin %q must be a URL such as https://shop.example.com, or * alone", origin)
+		}
+	}
+	return live, nil
+}
+
+// parseFeatureFlags reads "name=off,name=on"
+func parseFeatureFlags(value string) (FeatureFlags, error) {
+	flags := FeatureFlags{}
+	for name, setting := range parseKeyValues(value) {
+		if !isFeature(name) {
+			return nil, fmt.Errorf("unknown feature %q in FEATURE_FLAGS", name)
+		}
+		switch strings.ToLower(setting) {
+		case "on":
+			flags[name] = true
+		case "off":
+			flags[name] = false
+		default:
+			enabled, err := strconv.ParseBool(setting)
+			if err != nil {
+				return nil, fmt.Errorf("feature %s in FEATURE_FLAGS must be on or off", name)
+			}
+			flags[name] = enabled
+		}
+	}
+	return flags, nil
+}
+
+func isFeature(name string) bool {
+	for _, feature := range featureNames {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
+
+// envFromFile are the variables the environment file set. Variables already
+// set in the process environment take precedence over the file.
+var envFromFile = map[string]bool{}
+
+// loadEnvFile sets variables from .env.<environment>, or else .env. Loaded
+// again, it also updates the variables it set earlier and clears those
+// removed from the file.
+func loadEnvFile(env string) error {
+	envFile := fmt.Sprintf(".env.%s", env)
+	values, err := godotenv.Read(envFile)
+	if _, statErr := os.Stat(envFile); statErr == nil && err != nil {
+		return fmt.Errorf("error loading %s file: %v", envFile, err)
+	}
+	if err != nil {
+		// Fallback to .env file
+		values, err = godotenv.Read()
+		if err != nil {
+			// Don't fail if .env doesn't exist - use environment variables
+			fmt.Printf("Warning: .env file not found in %s mode, using environment variables only\n", env)
+			values = map[string]string{}
+		}
+	}
+
+	for key := range envFromFile {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(envFromFile, key)
+		}
+	}
+	for key, value := range values {
+		if _, set := os.LookupEnv(key); set && !envFromFile[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		envFromFile[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/secrets"
+)
+
+// loadSecrets reads JWT_SECRET, ENCRYPTION_KEY and the SMS provider's keys
+// from the secrets provider. A secret the provider doesn't have keeps its
+// value from the environment.
+func (c *Config) loadSecrets() error {
+	provider, err := c.secretsProvider()
+	if err != nil {
+		return err
+	}
+	if _, ok := provider.(secrets.EnvProvider); ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for name, value := range map[string]*string{
+		"JWT_SECRET":     &c.Security.JWTSecret,
+		"ENCRYPTION_KEY": &c.Security.EncryptionKey,
+
+		"SEMAPHORE_API_KEY": &c.SMS.SemaphoreAPIKey,
+		"TWILIO_AUTH_TOKEN": &c.SMS.TwilioAuthToken,
+
+		"SMTP_PASSWORD":    &c.Email.SMTPPassword,
+		"SENDGRID_API_KEY": &c.Email.SendGridAPIKey,
+
+		"STORAGE_SECRET_KEY": &c.Storage.SecretKey,
+
+		"GOOGLE_MAPS_API_KEY": &c.Geocoding.GoogleAPIKey,
+	} {
+		secret, err := provider.Get(ctx, name)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s from the %s secrets provider: %w", name, provider.Name(), err)
+		}
+		*value = secret
+	}
+
+	// Each inbound webhook integration's secret can be kept as
+	// INBOUND_WEBHOOK_SECRET_<NAME>
+	for integration := range c.WebhookInbox.Secrets {
+		name := "INBOUND_WEBHOOK_SECRET_" + strings.ToUpper(integration)
+		secret, err := provider.Get(ctx, name)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s from the %s secrets provider: %w", name, provider.Name(), err)
+		}
+		c.WebhookInbox.Secrets[integration] = secret
+	}
+	return nil
+}
+
+// secretsProvider builds the provider named in SECRETS_PROVIDER
+func (c *Config) secretsProvider() (secrets.Provider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch c.Secrets.Provider {
+	case "env":
+		return secrets.EnvProvider{}, nil
+	case "file":
+		return secrets.FileProvider{Dir: c.Secrets.Dir}, nil
+	case "aws":
+		if c.Secrets.AWSSecretID == "" {
+			return nil, fmt.Errorf("SECRETS_AWS_SECRET_ID is required for the aws secrets provider")
+		}
+		return &secrets.AWSSecretsManagerProvider{
+			SecretID:  c.Secrets.AWSSecretID,
+			Region:    c.Secrets.AWSRegion,
+			Endpoint:  c.Secrets.AWSEndpoint,
+			AccessKey: c.Encryption.AWSAccessKey,
+			SecretKey: c.Encryption.AWSSecretKey,
+			Client:    client,
+		}, nil
+	case "vault":
+		if c.Encryption.VaultAddr == "" || c.Encryption.VaultToken == "" || c.Secrets.VaultPath == "" {
+			return nil, fmt.Errorf("VAULT_ADDR, VAULT_TOKEN and SECRETS_VAULT_PATH are required for the vault secrets provider")
+		}
+		return &secrets.VaultProvider{
+			Addr:   c.Encryption.VaultAddr,
+			Token:  c.Encryption.VaultToken,
+			Path:   c.Secrets.VaultPath,
+			Client: client,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown secrets provider %q", c.Secrets.Provider)
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const backfillBatchSize = 500
+
+// purchaseHistoryBackfill is the DataBackfill recording that purchase
+// history has been backfilled
+const purchaseHistoryBackfill = "purchase_history"
+
+// BackfillPurchaseHistory writes purchase history rows for customer sales and
+// fulfilled online orders recorded before history was populated
+// automatically. Sales and orders record their history in the transaction
+// that completes them, so once the backfill has finished it is marked done
+// and later starts skip it. It only touches lines without a history row, so
+// an interrupted run picks up where it stopped. It returns the number of
+// rows created.
+func BackfillPurchaseHistory(db *gorm.DB) (int, error) {
+	var done int64
+	if err := db.Model(&models.DataBackfill{}).Where("name = ?", purchaseHistoryBackfill).Count(&done).Error; err != nil {
+		return 0, err
+	}
+	if done > 0 {
+		return 0, nil
+	}
+	created := 0
+
+	var sales []models.Sale
+	err := db.Preload("SaleItems").
+		Where("customer_id IS NOT NULL AND refunded_at IS NULL").
+		Where("EXISTS (SELECT 1 FROM sale_items si WHERE si.sale_id = sales.id AND si.product_id IS NOT NULL "+
+			"AND NOT EXISTS (SELECT 1 FROM purchase_histories ph WHERE ph.sale_item_id = si.id))").
+		FindInBatches(&sales, backfillBatchSize, func(tx *gorm.DB, batch int) error {
+			var rows []*models.PurchaseHistory
+			for i := range sales {
+				for _, item := range sales[i].SaleItems {
+					if history := models.NewSaleHistory(&sales[i], item); history != nil {
+						rows = append(rows, history)
+					}
+				}
+			}
+			n, err := insertHistory(db, rows)
+			created += n
+			return err
+		}).Error
+	if err != nil {
+		return created, err
+	}
+
+	var orders []models.OnlineOrder
+	err = db.Preload("OrderItems").
+		Where("customer_id IS NOT NULL AND status IN ?", []models.OrderStatus{models.OrderStatusDelivered, models.OrderStatusPickedUp}).
+		Where("EXISTS (SELECT 1 FROM online_order_items oi WHERE oi.order_id = online_orders.id "+
+			"AND NOT EXISTS (SELECT 1 FROM purchase_histories ph WHERE ph.order_item_id = oi.id))").
+		FindInBatches(&orders, backfillBatchSize, func(tx *gorm.DB, batch int) error {
+			var rows []*models.PurchaseHistory
+			for i := range orders {
+				for _, item := range orders[i].OrderItems {
+					if history := models.NewOrderHistory(&orders[i], item); history != nil {
+						rows = append(rows, history)
+					}
+				}
+			}
+			n, err := insertHistory(db, rows)
+			created += n
+			return err
+		}).Error
+	if err != nil {
+		return created, err
+	}
+
+	marker := models.DataBackfill{Name: purchaseHistoryBackfill, Rows: created, CompletedAt: time.Now().UTC()}
+	return created, db.Clauses(clause.OnConflict{DoNothing: true}).Create(&marker).Error
+}
+
+func insertHistory(db *gorm.DB, rows []*models.PurchaseHistory) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(rows)
+	return int(result.RowsAffected), result.Error
+}
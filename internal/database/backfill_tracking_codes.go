@@ -0,0 +1,28 @@
+package database
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// backfillTrackingCodes gives orders placed before tracking codes existed
+// one, so their customers can still track them. Orders that have a code
+// are skipped, so it does nothing once every order has one.
+func backfillTrackingCodes(db *gorm.DB) error {
+	var orders []models.OnlineOrder
+	return db.Select("id").Where("tracking_code IS NULL").
+		FindInBatches(&orders, backfillBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, order := range orders {
+				code, err := models.NewTrackingCode()
+				if err != nil {
+					return err
+				}
+				if err := db.Model(&models.OnlineOrder{}).Where("id = ? AND tracking_code IS NULL", order.ID).
+					UpdateColumn("tracking_code", code).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+}
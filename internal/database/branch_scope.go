@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type branchScopeKey struct{}
+
+// branchScopedTables hold one branch's records. Other tables, such as the
+// product catalogue and customers, are shared by every branch.
+var branchScopedTables = map[string]bool{
+	"sales":            true,
+	"online_orders":    true,
+	"qr_codes":         true,
+	"stock_movements":  true,
+	"insurance_claims": true,
+}
+
+// WithBranch limits the queries run with ctx to one branch's records, and
+// gives new records created with ctx that branch
+func WithBranch(ctx context.Context, branchID uuid.UUID) context.Context {
+	return context.WithValue(ctx, branchScopeKey{}, branchID)
+}
+
+// AcrossBranches lifts the branch limit WithBranch put on ctx, for reports
+// that compare branches
+func AcrossBranches(ctx context.Context) context.Context {
+	return context.WithValue(ctx, branchScopeKey{}, uuid.Nil)
+}
+
+// BranchFromContext returns the branch ctx is limited to, if any
+func BranchFromContext(ctx context.Context) (uuid.UUID, bool) {
+	if ctx == nil {
+		return uuid.Nil, false
+	}
+	branchID, ok := ctx.Value(branchScopeKey{}).(uuid.UUID)
+	return branchID, ok && branchID != uuid.Nil
+}
+
+// RegisterBranchScope adds the callbacks that apply WithBranch to db's
+// queries, updates, deletes and creates on the branch scoped tables
+func RegisterBranchScope(db *gorm.DB) error {
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Query().Before("gorm:query").Register("branch:scope_query", scopeToBranch),
+		callbacks.Row().Before("gorm:row").Register("branch:scope_row", scopeToBranch),
+		callbacks.Update().Before("gorm:update").Register("branch:scope_update", scopeToBranch),
+		callbacks.Delete().Before("gorm:delete").Register("branch:scope_delete", scopeToBranch),
+		callbacks.Create().Before("gorm:create").Register("branch:assign_create", assignBranch),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Private functions
+
+func scopeToBranch(db *gorm.DB) {
+	branchID, ok := statementBranch(db)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: "branch_id"}, Value: branchID},
+	}})
+}
+
+// assignBranch sets the branch of new records that don't name one
+func assignBranch(db *gorm.DB) {
+	branchID, ok := statementBranch(db)
+	if !ok {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("BranchID")
+	if field == nil {
+		return
+	}
+
+	value := db.Statement.ReflectValue
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			setBranch(db, field, value.Index(i), branchID)
+		}
+	case reflect.Struct:
+		setBranch(db, field, value, branchID)
+	}
+}
+
+func setBranch(db *gorm.DB, field *schema.Field, value reflect.Value, branchID uuid.UUID) {
+	if _, isZero := field.ValueOf(db.Statement.Context, value); isZero {
+		db.AddError(field.Set(db.Statement.Context, value, &branchID))
+	}
+}
+
+// statementBranch returns the branch a statement on a branch scoped table
+// is limited to
+func statementBranch(db *gorm.DB) (uuid.UUID, bool) {
+	if db.Statement.Schema == nil || !branchScopedTables[db.Statement.Table] {
+		return uuid.Nil, false
+	}
+	return BranchFromContext(db.Statement.Context)
+}
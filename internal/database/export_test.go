@@ -0,0 +1,15 @@
+package database
+
+import (
+	"pharmacy-backend/internal/config"
+
+	"gorm.io/gorm"
+)
+
+// SyncDatabasePair brings target up to date with source, for the tests of
+// other packages' rows, which this package's tests can't import
+func SyncDatabasePair(source, target *gorm.DB, sourceName string) error {
+	dm := &DatabaseManager{config: &config.Config{}}
+	_, err := dm.syncDatabasePair(source, target, sourceName, sourceName+"->target")
+	return err
+}
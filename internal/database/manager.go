@@ -2,11 +2,13 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"pharmacy-backend/internal/alerting"
 	"pharmacy-backend/internal/config"
 	"pharmacy-backend/internal/models"
 
@@ -22,6 +24,8 @@ type DatabaseManager struct {
 	localDB     *gorm.DB
 	readReplica *gorm.DB
 	syncEnabled bool
+	lastSync    time.Time
+	alerts      *alerting.Notifier
 	mu          sync.RWMutex
 }
 
@@ -33,6 +37,7 @@ type DatabaseStats struct {
 	LastSyncTime          time.Time
 	SyncStatus            string
 	HealthStatus          map[string]bool
+	Pools                 map[string]sql.DBStats // connection pool stats by database
 }
 
 func NewDatabaseManager(cfg *config.Config) (*DatabaseManager, error) {
@@ -91,10 +96,25 @@ func NewDatabaseManager(cfg *config.Config) (*DatabaseManager, error) {
 		return nil, fmt.Errorf("failed to run migrations: %w", err)
 	}
 
-	// Start sync service if enabled
+	// Prepare for sync, which RunSync runs. Databases that sync number their
+	// sales and orders in series of their own.
 	if dm.syncEnabled {
-		go dm.startSyncService()
-		log.Println("✅ Database synchronization service started")
+		for _, other := range []*gorm.DB{dm.cloudDB, dm.localDB} {
+			if other == nil {
+				continue
+			}
+			if err := separateNodes(dm.primary, other); err != nil {
+				return nil, err
+			}
+		}
+		if err := installDeletionLog(dm.primary); err != nil {
+			return nil, fmt.Errorf("failed to install sync deletion log: %w", err)
+		}
+		if dm.config.Sync.Bidirectional && dm.cloudDB != nil {
+			if err := installDeletionLog(dm.cloudDB); err != nil {
+				return nil, fmt.Errorf("failed to install sync deletion log on cloud database: %w", err)
+			}
+		}
 	}
 
 	return dm, nil
@@ -108,7 +128,15 @@ func (dm *DatabaseManager) connectToDatabase(name, dsn string, dbConfig config.D
 	} else {
 		logLevel = logger.Warn
 	}
+	return openDatabase(name, dsn, dbConfig, logLevel)
+}
+
+// ConnectReadReplica opens the read replica configured in cfg
+func ConnectReadReplica(cfg *config.Config) (*gorm.DB, error) {
+	return openDatabase("replica", cfg.GetReadReplicaDSN(), cfg.ReadReplica, logger.Warn)
+}
 
+func openDatabase(name, dsn string, dbConfig config.DatabaseConfig, logLevel logger.LogLevel) (*gorm.DB, error) {
 	// Open database connection
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
 		Logger: logger.Default.LogMode(logLevel),
@@ -229,114 +257,146 @@ func (dm *DatabaseManager) SyncData() error {
 
 	log.Println("🔄 Starting database synchronization...")
 
-	// Sync from primary to cloud
-	if dm.cloudDB != nil {
-		if err := dm.syncDatabasePair(dm.primary, dm.cloudDB, "primary->cloud"); err != nil {
-			log.Printf("❌ Failed to sync primary to cloud: %v", err)
+	// Position in the primary's deletion log reached by each target
+	var positions []uint64
+
+	// Sync from primary to cloud. While the cloud can't be reached the store
+	// keeps working on its own database; the cursors pick up from where the
+	// last sync stopped once it is back.
+	dm.reconnectCloud()
+	if dm.config.HasCloudDB() {
+		var deletionID uint64
+		if dm.cloudDB == nil || !dm.isHealthy(dm.cloudDB) {
+			log.Println("⚠️  Cloud database unreachable, changes will be synced when it is back")
 		} else {
-			log.Println("✅ Synced primary to cloud")
+			var err error
+			deletionID, err = dm.syncDatabasePair(dm.primary, dm.cloudDB, "primary", "primary->cloud")
+			if err != nil {
+				log.Printf("❌ Failed to sync primary to cloud: %v", err)
+				dm.alertSyncFailure("primary->cloud", err)
+			} else {
+				log.Println("✅ Synced primary to cloud")
+			}
+
+			// Pull the changes made in the cloud, e.g. online orders received
+			// while the store was offline
+			if dm.config.Sync.Bidirectional {
+				cloudDeletionID, err := dm.syncDatabasePair(dm.cloudDB, dm.primary, "cloud", "cloud->primary")
+				if err != nil {
+					log.Printf("❌ Failed to sync cloud to primary: %v", err)
+					dm.alertSyncFailure("cloud->primary", err)
+				} else {
+					log.Println("✅ Synced cloud to primary")
+				}
+				if cloudDeletionID > 0 {
+					pruneDeletionLog(dm.cloudDB, cloudDeletionID)
+				}
+			}
 		}
+		positions = append(positions, deletionID)
 	}
 
 	// Sync from primary to local
 	if dm.localDB != nil {
-		if err := dm.syncDatabasePair(dm.primary, dm.localDB, "primary->local"); err != nil {
+		deletionID, err := dm.syncDatabasePair(dm.primary, dm.localDB, "primary", "primary->local")
+		if err != nil {
 			log.Printf("❌ Failed to sync primary to local: %v", err)
+			dm.alertSyncFailure("primary->local", err)
 		} else {
 			log.Println("✅ Synced primary to local")
 		}
+		positions = append(positions, deletionID)
+	}
+
+	// The deletion log is only needed up to the oldest position reached
+	if len(positions) > 0 {
+		pruneTo := positions[0]
+		for _, position := range positions[1:] {
+			if position < pruneTo {
+				pruneTo = position
+			}
+		}
+		if pruneTo > 0 {
+			pruneDeletionLog(dm.primary, pruneTo)
+		}
 	}
 
+	dm.lastSync = time.Now()
 	log.Println("✅ Database synchronization completed")
 	return nil
 }
 
-func (dm *DatabaseManager) syncDatabasePair(source, target *gorm.DB, direction string) error {
-	// Start transaction on target
-	tx := target.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// Sync each table
-	tables := []interface{}{
-		&models.User{},
-		&models.Customer{},
-		&models.Product{},
-		&models.Sale{},
-		&models.SaleItem{},
-		&models.StockMovement{},
-		&models.PurchaseHistory{},
-		&models.Supplier{},
-		&models.OnlineOrder{},
-		&models.OnlineOrderItem{},
-		&models.ShoppingCart{},
-		&models.OrderStatusHistory{},
-		&models.QRCode{},
-		&models.QRScanLog{},
-		&models.PrescriptionUpload{},
-		&models.AuditLog{},
-	}
-
-	for _, model := range tables {
-		if err := dm.syncTable(source, tx, model); err != nil {
-			tx.Rollback()
-			return fmt.Errorf("failed to sync table %T: %w", model, err)
-		}
+// syncDatabasePair brings target up to date with the changes in source
+// since its last sync, table by table. A table that fails is retried from
+// its cursor on the next run and doesn't stop the others. It returns the
+// position in the source's deletion log that target has reached.
+func (dm *DatabaseManager) syncDatabasePair(source, target *gorm.DB, sourceName, direction string) (uint64, error) {
+	if err := separateNodes(source, target); err != nil {
+		return 0, err
 	}
 
-	// Commit transaction
-	if err := tx.Commit().Error; err != nil {
-		return fmt.Errorf("failed to commit sync transaction: %w", err)
+	var failed []error
+	for _, table := range syncTables {
+		if err := dm.syncTable(source, target, sourceName, table); err != nil {
+			log.Printf("❌ %s: %v", direction, err)
+			failed = append(failed, err)
+		}
 	}
 
-	return nil
-}
-
-func (dm *DatabaseManager) syncTable(source, target *gorm.DB, model interface{}) error {
-	// This is a simplified sync - in production, you'd want more sophisticated logic
-	// like incremental sync, conflict resolution, etc.
-	
-	// Get the table name
-	stmt := &gorm.Statement{DB: target}
-	err := stmt.Parse(model)
+	deletionID, err := dm.syncDeletions(source, target, sourceName)
 	if err != nil {
-		return fmt.Errorf("failed to parse model: %w", err)
+		failed = append(failed, err)
 	}
-	tableName := stmt.Schema.Table
 
-	// Clear target table (be careful with this in production!)
-	if err := target.Exec(fmt.Sprintf("TRUNCATE TABLE %s CASCADE", tableName)).Error; err != nil {
-		return fmt.Errorf("failed to truncate table %s: %w", tableName, err)
+	if len(failed) > 0 {
+		return deletionID, fmt.Errorf("%d table(s) failed to sync: %v", len(failed), failed)
 	}
+	return deletionID, nil
+}
 
-	// Copy data from source to target
-	var records []map[string]interface{}
-	if err := source.Table(tableName).Find(&records).Error; err != nil {
-		return fmt.Errorf("failed to read from source table %s: %w", tableName, err)
+// reconnectCloud connects to the cloud database if it was unreachable when
+// the manager started
+func (dm *DatabaseManager) reconnectCloud() {
+	if dm.cloudDB != nil || !dm.config.HasCloudDB() {
+		return
 	}
-
-	if len(records) > 0 {
-		if err := target.Table(tableName).Create(records).Error; err != nil {
-			return fmt.Errorf("failed to insert into target table %s: %w", tableName, err)
+	cloudDB, err := dm.connectToDatabase("cloud", dm.config.GetCloudDSN(), dm.config.CloudDB)
+	if err != nil {
+		return
+	}
+	if err := Migrate(cloudDB); err != nil {
+		log.Printf("❌ Failed to migrate cloud database: %v", err)
+		return
+	}
+	if dm.config.Sync.Bidirectional {
+		if err := installDeletionLog(cloudDB); err != nil {
+			log.Printf("❌ Failed to install sync deletion log on cloud database: %v", err)
+			return
 		}
 	}
+	dm.cloudDB = cloudDB
+	log.Println("✅ Reconnected to cloud database")
+}
 
-	return nil
+// pruneDeletionLog removes deletion log entries every target has applied
+func pruneDeletionLog(db *gorm.DB, upTo uint64) {
+	if err := db.Where("id <= ?", upTo).Delete(&models.SyncDeletion{}).Error; err != nil {
+		log.Printf("⚠️  Failed to prune sync deletion log: %v", err)
+	}
 }
 
 // GetStats returns database statistics
 func (dm *DatabaseManager) GetStats() (*DatabaseStats, error) {
 	stats := &DatabaseStats{
 		HealthStatus: make(map[string]bool),
+		Pools:        make(map[string]sql.DBStats),
 	}
 
 	// Get connection stats
 	if sqlDB, err := dm.primary.DB(); err == nil {
 		dbStats := sqlDB.Stats()
 		stats.PrimaryConnections = dbStats.OpenConnections
+		stats.Pools["primary"] = dbStats
 		stats.HealthStatus["primary"] = dm.isHealthy(dm.primary)
 	}
 
@@ -344,6 +404,7 @@ func (dm *DatabaseManager) GetStats() (*DatabaseStats, error) {
 		if sqlDB, err := dm.cloudDB.DB(); err == nil {
 			dbStats := sqlDB.Stats()
 			stats.CloudConnections = dbStats.OpenConnections
+			stats.Pools["cloud"] = dbStats
 			stats.HealthStatus["cloud"] = dm.isHealthy(dm.cloudDB)
 		}
 	}
@@ -352,6 +413,7 @@ func (dm *DatabaseManager) GetStats() (*DatabaseStats, error) {
 		if sqlDB, err := dm.localDB.DB(); err == nil {
 			dbStats := sqlDB.Stats()
 			stats.LocalConnections = dbStats.OpenConnections
+			stats.Pools["local"] = dbStats
 			stats.HealthStatus["local"] = dm.isHealthy(dm.localDB)
 		}
 	}
@@ -360,11 +422,15 @@ func (dm *DatabaseManager) GetStats() (*DatabaseStats, error) {
 		if sqlDB, err := dm.readReplica.DB(); err == nil {
 			dbStats := sqlDB.Stats()
 			stats.ReplicaConnections = dbStats.OpenConnections
+			stats.Pools["replica"] = dbStats
 			stats.HealthStatus["replica"] = dm.isHealthy(dm.readReplica)
 		}
 	}
 
 	// Sync status
+	dm.mu.RLock()
+	stats.LastSyncTime = dm.lastSync
+	dm.mu.RUnlock()
 	if dm.syncEnabled {
 		stats.SyncStatus = "enabled"
 	} else {
@@ -454,14 +520,52 @@ func (dm *DatabaseManager) Close() error {
 	return nil
 }
 
+// SetAlerting posts sync failures to the operations channels
+func (dm *DatabaseManager) SetAlerting(alerts *alerting.Notifier) {
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	dm.alerts = alerts
+}
+
 // Private methods
 
-func (dm *DatabaseManager) startSyncService() {
+// alertSyncFailure posts a failed sync of pair, e.g. primary->cloud. The
+// caller holds dm.mu.
+func (dm *DatabaseManager) alertSyncFailure(pair string, err error) {
+	dm.alerts.Notify(alerting.Alert{
+		Event:    alerting.EventSyncFailed,
+		Severity: alerting.SeverityCritical,
+		Title:    "Database sync failed",
+		Message:  fmt.Sprintf("Syncing %s failed: %v", pair, err),
+		Fields: []alerting.Field{
+			{Name: "Direction", Value: pair},
+			{Name: "Last successful sync", Value: formatLastSync(dm.lastSync)},
+		},
+		Key: pair,
+	})
+}
+
+func formatLastSync(t time.Time) string {
+	if t.IsZero() {
+		return "none since startup"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// RunSync syncs the databases every sync interval until ctx is done. Only
+// one instance should run it at a time.
+func (dm *DatabaseManager) RunSync(ctx context.Context) {
+	if !dm.syncEnabled {
+		return
+	}
+	log.Println("✅ Database synchronization service started")
 	ticker := time.NewTicker(dm.config.Sync.Interval)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-ctx.Done():
+			return
 		case <-ticker.C:
 			if err := dm.SyncData(); err != nil {
 				log.Printf("❌ Sync failed: %v", err)
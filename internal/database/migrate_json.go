@@ -0,0 +1,59 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// jsonArrayColumns are the models.StringArray columns, which hold a JSON
+// array of strings
+var jsonArrayColumns = []struct{ table, column string }{
+	{"products", "contraindications"},
+	{"products", "side_effects"},
+	{"products", "drug_interactions"},
+	{"online_orders", "prescription_images"},
+}
+
+// migrateJSONArrayColumns moves the string list columns to native JSON. On
+// PostgreSQL, columns created as text are converted to jsonb, reading a
+// value that isn't a JSON array as a comma separated list. On SQLite, values
+// stored as blobs are rewritten as text, which the JSON functions read. It
+// runs before AutoMigrate, whose own cast to jsonb would fail on those
+// lists, and does nothing once the columns are converted.
+func migrateJSONArrayColumns(db *gorm.DB) error {
+	isPostgres := strings.Contains(db.Dialector.Name(), "postgres")
+
+	for _, c := range jsonArrayColumns {
+		if !db.Migrator().HasColumn(c.table, c.column) {
+			continue
+		}
+		table, column := clause.Table{Name: c.table}, clause.Column{Name: c.column}
+
+		var err error
+		if isPostgres {
+			var dataType string
+			err = db.Raw("SELECT data_type FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?",
+				c.table, c.column).Scan(&dataType).Error
+			switch {
+			case err != nil || dataType == "jsonb":
+			case dataType == "ARRAY":
+				err = db.Exec("ALTER TABLE ? ALTER COLUMN ? TYPE jsonb USING to_jsonb(?)", table, column, column).Error
+			default:
+				err = db.Exec("ALTER TABLE ? ALTER COLUMN ? TYPE jsonb USING CASE "+
+					"WHEN ?::text IS NULL OR btrim(?::text) = '' THEN NULL "+
+					"WHEN left(btrim(?::text), 1) = '[' THEN ?::text::jsonb "+
+					"ELSE to_jsonb(string_to_array(?::text, ',')) END",
+					table, column, column, column, column, column, column).Error
+			}
+		} else {
+			err = db.Exec("UPDATE ? SET ? = CAST(? AS TEXT) WHERE typeof(?) = 'blob'", table, column, column, column).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to convert %s.%s to JSON: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// moneyModels are the models with models.Money columns
+var moneyModels = []interface{}{
+	&models.Customer{},
+	&models.Product{},
+	&models.Sale{},
+	&models.SaleItem{},
+	&models.StockMovement{},
+	&models.PurchaseHistory{},
+	&models.Service{},
+	&models.ProductSupplier{},
+	&models.OnlineOrder{},
+	&models.OnlineOrderItem{},
+	&models.ShoppingCart{},
+	&models.BranchPrice{},
+	&models.LoyaltyTier{},
+	&models.LoyaltyTransaction{},
+	&models.Segment{},
+	&models.CampaignSend{},
+}
+
+var moneyType = reflect.TypeOf(models.Money(0))
+
+// migrateMoneyColumns converts amount columns from decimal pesos to whole
+// centavos. It runs before AutoMigrate, whose own change of column type
+// would drop the centavos, and skips columns already converted, so it is
+// safe to run on every start.
+func migrateMoneyColumns(db *gorm.DB) error {
+	isPostgres := strings.Contains(db.Dialector.Name(), "postgres")
+
+	for _, model := range moneyModels {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		columnTypes, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+		decimal := make(map[string]bool, len(columnTypes))
+		for _, columnType := range columnTypes {
+			switch strings.ToLower(columnType.DatabaseTypeName()) {
+			case "numeric", "decimal":
+				decimal[columnType.Name()] = true
+			}
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.IndirectFieldType != moneyType || !decimal[field.DBName] {
+				continue
+			}
+			err := db.Transaction(func(tx *gorm.DB) error {
+				table, column := clause.Table{Name: stmt.Schema.Table}, clause.Column{Name: field.DBName}
+				if isPostgres {
+					return tx.Exec("ALTER TABLE ? ALTER COLUMN ? TYPE bigint USING round(? * 100)", table, column, column).Error
+				}
+				if err := tx.Exec("UPDATE ? SET ? = CAST(ROUND(? * 100) AS INTEGER)", table, column, column).Error; err != nil {
+					return err
+				}
+				return tx.Migrator().AlterColumn(model, field.Name)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to convert %s.%s to centavos: %w", stmt.Schema.Table, field.DBName, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// TestMigrateMoneyColumns migrates a services table from before amounts
+// were centavos, with prices in decimal pesos, and checks the prices come
+// through to the centavo and stay put when the migration runs again
+func TestMigrateMoneyColumns(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "money.db")), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	// The services table as it was, its price a decimal
+	if err := db.Migrator().CreateTable(&models.Service{}); err != nil {
+		t.Fatal(err)
+	}
+	var ddl string
+	if err := db.Raw("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'services'").Scan(&ddl).Error; err != nil {
+		t.Fatal(err)
+	}
+	legacy := strings.Replace(ddl, "`price` bigint", "`price` decimal(10,2)", 1)
+	if legacy == ddl {
+		t.Fatalf("no bigint price column in %s", ddl)
+	}
+	if err := db.Exec("DROP TABLE services").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec(legacy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	prices := map[string]struct {
+		pesos float64
+		want  models.Money
+	}{
+		"WHOLE":    {pesos: 150, want: 15000},
+		"CENTAVOS": {pesos: 12.34, want: 1234},
+		"TENTHS":   {pesos: 0.5, want: 50},
+		"NINES":    {pesos: 99.99, want: 9999},
+		"LARGE":    {pesos: 1234567.89, want: 123456789},
+		"ZERO":     {pesos: 0, want: 0},
+		"CREDIT":   {pesos: -5.25, want: -525},
+	}
+	now := time.Now().UTC()
+	for code, price := range prices {
+		err := db.Exec("INSERT INTO services (id, created_at, updated_at, name, code, category, price) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			uuid.New(), now, now, "Service "+code, code, "consultation", price.pesos).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for run := 1; run <= 2; run++ {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("migration %d: %v", run, err)
+		}
+
+		columnTypes, err := db.Migrator().ColumnTypes(&models.Service{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, columnType := range columnTypes {
+			if columnType.Name() == "price" && !strings.Contains(strings.ToLower(columnType.DatabaseTypeName()), "int") {
+				t.Errorf("migration %d: price is %s, want a whole number", run, columnType.DatabaseTypeName())
+			}
+		}
+
+		var services []models.Service
+		if err := db.Find(&services).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(services) != len(prices) {
+			t.Fatalf("migration %d: %d services, want %d", run, len(services), len(prices))
+		}
+		for _, service := range services {
+			if want := prices[service.Code].want; service.Price != want {
+				t.Errorf("migration %d: %s costs %d centavos, want %d", run, service.Code, service.Price, want)
+			}
+		}
+	}
+}
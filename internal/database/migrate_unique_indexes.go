@@ -0,0 +1,28 @@
+package database
+
+import "gorm.io/gorm"
+
+// uniqueIndexesWithDeleted are the unique indexes made before records were soft
+// deleted. They also counted deleted rows, so a deleted user's username or
+// a deleted product's SKU couldn't be used again. The models now declare
+// unique indexes over the rows that aren't deleted in their place.
+var uniqueIndexesWithDeleted = []string{
+	"idx_users_username",
+	"idx_users_email",
+	"idx_customers_email",
+	"idx_products_sku",
+	"idx_products_barcode",
+	"idx_services_code",
+}
+
+// dropDeletedUniqueIndexes drops the unique indexes that counted deleted
+// rows. It runs before AutoMigrate, which creates their replacements, and
+// does nothing once they are gone.
+func dropDeletedUniqueIndexes(db *gorm.DB) error {
+	for _, index := range uniqueIndexesWithDeleted {
+		if err := db.Exec("DROP INDEX IF EXISTS " + index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
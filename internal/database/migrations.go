@@ -26,9 +26,28 @@ func Migrate(db *gorm.DB) error {
 		}
 	}
 
+	// Amounts moved from decimal pesos to whole centavos
+	if err := migrateMoneyColumns(db); err != nil {
+		return err
+	}
+
+	// String lists moved from JSON in text to native JSON
+	if err := migrateJSONArrayColumns(db); err != nil {
+		return err
+	}
+
+	// Usernames, emails, SKUs, barcodes and service codes are unique
+	// among records that aren't deleted
+	if err := dropDeletedUniqueIndexes(db); err != nil {
+		return err
+	}
+
 	// Auto-migrate all models
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		// Core models
+		&models.Branch{},
+		&models.Terminal{},
+		&models.NumberSequence{},
 		&models.User{},
 		&models.Customer{},
 		&models.Product{},
@@ -36,8 +55,16 @@ func Migrate(db *gorm.DB) error {
 		&models.Sale{},
 		&models.SaleItem{},
 		&models.StockMovement{},
+		&models.StockTransfer{},
+		&models.BranchPrice{},
+		&models.ExchangeRate{},
 		&models.PurchaseHistory{},
 		&models.AuditLog{},
+		&models.EncryptionKey{},
+		&models.LoginFingerprint{},
+		&models.SecurityAlert{},
+		&models.PasswordResetToken{},
+		&models.CSPViolation{},
 		&models.Supplier{},
 		&models.ProductSupplier{},
 		
@@ -51,10 +78,178 @@ func Migrate(db *gorm.DB) error {
 		// QR Code models
 		&models.QRCode{},
 		&models.QRScanLog{},
+		
+		// Clinical models
+		&models.DrugInteraction{},
+		&models.InteractionAcknowledgement{},
+		&models.ScreeningOverride{},
+		&models.Refill{},
+		&models.EPrescription{},
+		&models.ClinicalNote{},
+		&models.VaccinationRecord{},
+		
+		// Privacy models
+		&models.ConsentRecord{},
+		&models.DataSubjectRequest{},
+		&models.CommunicationPreference{},
+		
+		// Segmentation models
+		&models.CustomerTag{},
+		&models.Segment{},
+		&models.SegmentMember{},
+		&models.CustomerFlag{},
+		
+		// Loyalty models
+		&models.LoyaltyTier{},
+		&models.LoyaltyTransaction{},
+		
+		// Campaign models
+		&models.Campaign{},
+		&models.CampaignSend{},
+		
+		// Notification and webhook outbox
+		&models.OutboxMessage{},
+		
+		// Events posted to us by third parties
+		&models.InboundWebhook{},
+		
+		// SMS templates, send log and phone verification
+		&models.SMSTemplate{},
+		&models.SMSMessage{},
+		&models.PhoneVerification{},
+		
+		// Email suppression list
+		&models.EmailSuppression{},
+		
+		// Push notification devices and staff alert preferences
+		&models.PushDevice{},
+		&models.StaffNotificationPreference{},
+		
+		// FDA Philippines registry cache and recalls
+		&models.FDARegistration{},
+		&models.FDARecall{},
+		
+		// Cold chain temperature logs
+		&models.StorageUnit{},
+		&models.TemperatureReading{},
+		&models.TemperatureExcursion{},
+		&models.ExcursionBatch{},
+		
+		// Print and cash drawer jobs for station agents
+		&models.StationJob{},
+		
+		// Customer feedback on online orders
+		&models.Feedback{},
+		
+		// Referral codes, referrals and store credit
+		&models.ReferralCode{},
+		&models.Referral{},
+		&models.CreditTransaction{},
+		
+		// Compounding formulas and preparations
+		&models.CompoundFormula{},
+		&models.CompoundIngredient{},
+		&models.CompoundPreparation{},
+		&models.PreparationIngredient{},
+		
+		// Licenses and accreditations on file
+		&models.ComplianceDocument{},
+		
+		// Employee time clock
+		&models.Shift{},
+		
+		// HMO claims
+		&models.InsuranceClaim{},
+		
+		// Delivery zones
+		&models.DeliveryZone{},
+		
+		// Background jobs
+		&models.Job{},
+		&models.JobSchedule{},
+		
+		// Database sync bookkeeping
+		&models.SyncCursor{},
+		&models.SyncDeletion{},
+		&models.SyncConflict{},
+		
+		// Database backups
+		&models.BackupRun{},
+		
+		// One-off backfills that have finished
+		&models.DataBackfill{},
+		
+		// Sale and order numbering
+		&models.DatabaseNode{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// Each database numbers sales and orders in a series of its own
+	if err := ensureDatabaseNode(db); err != nil {
+		return err
+	}
+
+	// Orders placed before tracking codes get one
+	if err := backfillTrackingCodes(db); err != nil {
+		return err
+	}
+
+	// Keyset pagination walks these tables by (created_at, id)
+	for _, table := range []string{"sales", "online_orders", "audit_logs", "qr_scan_logs"} {
+		if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_" + table + "_created_at_id ON " + table + " (created_at, id)").Error; err != nil {
+			return err
+		}
+	}
+
+	// The audit and scan history APIs filter by one of these columns within
+	// a time range
+	for name, columns := range map[string]string{
+		"idx_audit_logs_user_id_created_at":      "audit_logs (user_id, created_at)",
+		"idx_audit_logs_resource_created_at":     "audit_logs (resource, created_at)",
+		"idx_qr_scan_logs_qr_code_id_created_at": "qr_scan_logs (qr_code_id, created_at)",
+		"idx_qr_scan_logs_scanned_by_created_at": "qr_scan_logs (scanned_by, created_at)",
+		// Branch stock is summed from the branch's movements
+		"idx_stock_movements_branch_id_product_id": "stock_movements (branch_id, product_id)",
+		// A product's movements are listed and exported by date
+		"idx_stock_movements_product_id_created_at": "stock_movements (product_id, created_at)",
+		// Branch reports and branch staff's lists read a branch's sales by date
+		"idx_sales_branch_id_created_at": "sales (branch_id, created_at)",
+		// The fulfillment queue lists orders in a status, newest first
+		"idx_online_orders_status_created_at": "online_orders (status, created_at)",
+		// The catalogue is browsed by category, active products only
+		"idx_products_category_is_active": "products (category, is_active)",
+		"idx_products_expiry_date":        "products (expiry_date)",
+	} {
+		if err := db.Exec("CREATE INDEX IF NOT EXISTS " + name + " ON " + columns).Error; err != nil {
+			return err
+		}
+	}
+
+	// Low stock alerts and the dashboard look for products at or below
+	// their minimum. Only those rows are indexed, so the index stays small
+	// and the comparison between columns isn't made for every product.
+	if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_products_low_stock ON products (is_active) WHERE stock <= min_stock AND deleted_at IS NULL").Error; err != nil {
+		return err
+	}
+
+	// Products are looked up by what their labels list, e.g. the products
+	// interacting with an ingredient. jsonb_path_ops indexes the values for
+	// @> containment only, which is all those lookups use.
+	if isPostgres {
+		for _, column := range []string{"contraindications", "side_effects", "drug_interactions"} {
+			if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_products_" + column + " ON products USING GIN (" + column + " jsonb_path_ops)").Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
-// CreateDefaultAdmin creates a default admin user if none exists
+// CreateDefaultAdmin creates admin / admin123 if no admin exists. Only used
+// in development; other environments bootstrap the first admin with a
+// one-time token.
 func CreateDefaultAdmin(db *gorm.DB) error {
 	var count int64
 	if err := db.Model(&models.User{}).Where("role = ?", models.RoleAdmin).Count(&count).Error; err != nil {
@@ -166,8 +361,8 @@ func SeedSampleData(db *gorm.DB) error {
 			Form:                 stringPtr("Tablet"),
 			ActiveIngredient:     stringPtr("Paracetamol"),
 			SKU:                  "PAR-500-BIO",
-			Price:                5.50,
-			Cost:                 3.00,
+			Price:                models.NewMoney(5.50),
+			Cost:                 models.NewMoney(3.00),
 			Stock:                100,
 			MinStock:             20,
 			BatchNumber:          "BAT001",
@@ -189,8 +384,8 @@ func SeedSampleData(db *gorm.DB) error {
 			Form:                 stringPtr("Capsule"),
 			ActiveIngredient:     stringPtr("Amoxicillin"),
 			SKU:                  "AMX-500-GSK",
-			Price:                25.00,
-			Cost:                 18.00,
+			Price:                models.NewMoney(25.00),
+			Cost:                 models.NewMoney(18.00),
 			Stock:                75,
 			MinStock:             15,
 			BatchNumber:          "BAT002",
@@ -207,8 +402,8 @@ func SeedSampleData(db *gorm.DB) error {
 			Manufacturer: "Healthmax",
 			ProductType:  models.ProductTypeGrocery,
 			SKU:          "VIT-C-1000",
-			Price:        15.00,
-			Cost:         10.00,
+			Price:        models.NewMoney(15.00),
+			Cost:         models.NewMoney(10.00),
 			Stock:        50,
 			MinStock:     10,
 			BatchNumber:  "BAT003",
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ensureDatabaseNode gives a database its node code the first time it is
+// migrated
+func ensureDatabaseNode(db *gorm.DB) error {
+	code, err := models.NewNodeCode()
+	if err != nil {
+		return err
+	}
+	node := models.DatabaseNode{ID: models.DatabaseNodeID, Code: code}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&node).Error; err != nil {
+		return fmt.Errorf("failed to set the database's node code: %w", err)
+	}
+	return nil
+}
+
+// separateNodes gives target a new node code when it has the same one as
+// source, e.g. after it was restored from source's backup, so the numbers
+// the two hand out from then on don't collide when they sync
+func separateNodes(source, target *gorm.DB) error {
+	var codes []string
+	for _, db := range []*gorm.DB{source, target} {
+		var code string
+		if err := db.Model(&models.DatabaseNode{}).Where("id = ?", models.DatabaseNodeID).
+			Select("code").Scan(&code).Error; err != nil {
+			return fmt.Errorf("failed to read node code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+	if codes[0] != codes[1] {
+		return nil
+	}
+
+	for {
+		code, err := models.NewNodeCode()
+		if err != nil {
+			return err
+		}
+		if code == codes[0] {
+			continue
+		}
+		err = target.Model(&models.DatabaseNode{}).Where("id = ?", models.DatabaseNodeID).
+			Update("code", code).Error
+		if err != nil {
+			return fmt.Errorf("failed to change node code: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,140 @@
+package database
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type readRoutingKey struct{}
+
+type readRouting int
+
+const (
+	readFromReplica readRouting = iota + 1
+	readFromPrimary
+)
+
+// WithReplicaReads lets the queries run with ctx read from the read replica.
+// Only contexts marked this way are routed; everything else, including all
+// writes and transactions, uses the primary.
+func WithReplicaReads(ctx context.Context) context.Context {
+	if routing, _ := ctx.Value(readRoutingKey{}).(readRouting); routing == readFromPrimary {
+		return ctx
+	}
+	return context.WithValue(ctx, readRoutingKey{}, readFromReplica)
+}
+
+// WithPrimaryReads makes the queries run with ctx read from the primary,
+// e.g. to read back a row that was just written. It overrides
+// WithReplicaReads.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readRoutingKey{}, readFromPrimary)
+}
+
+// ReadReplicaRouter sends the reads of a primary *gorm.DB to a read replica
+// when their context allows it and the replica is within maxLag of the
+// primary. Handlers and services keep using the one *gorm.DB.
+type ReadReplicaRouter struct {
+	primary gorm.ConnPool
+	replica *gorm.DB
+	maxLag  time.Duration
+	healthy atomic.Bool
+	lag     atomic.Int64 // replication lag at the last check
+}
+
+// NewReadReplicaRouter registers the routing callbacks on primary
+func NewReadReplicaRouter(primary, replica *gorm.DB, maxLag time.Duration) (*ReadReplicaRouter, error) {
+	r := &ReadReplicaRouter{
+		primary: primary.Config.ConnPool,
+		replica: replica,
+		maxLag:  maxLag,
+	}
+	r.checkReplica(context.Background())
+
+	// Statements chained after a routed read must still write to the primary
+	callbacks := primary.Callback()
+	for _, err := range []error{
+		callbacks.Query().Before("gorm:query").Register("replica:route_query", r.routeRead),
+		callbacks.Row().Before("gorm:row").Register("replica:route_row", r.routeRead),
+		callbacks.Create().Before("gorm:create").Register("replica:route_create", r.routeWrite),
+		callbacks.Update().Before("gorm:update").Register("replica:route_update", r.routeWrite),
+		callbacks.Delete().Before("gorm:delete").Register("replica:route_delete", r.routeWrite),
+		callbacks.Raw().Before("gorm:raw").Register("replica:route_raw", r.routeWrite),
+	} {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Run re-checks the replica's health and lag until ctx is done
+func (r *ReadReplicaRouter) Run(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkReplica(ctx)
+		}
+	}
+}
+
+// Status reports whether reads go to the replica and how far it was
+// behind the primary when last checked
+func (r *ReadReplicaRouter) Status() (healthy bool, lag time.Duration) {
+	return r.healthy.Load(), time.Duration(r.lag.Load())
+}
+
+// Private methods
+
+func (r *ReadReplicaRouter) routeRead(db *gorm.DB) {
+	if _, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+		return
+	}
+	if !r.healthy.Load() || db.Statement.Context == nil {
+		return
+	}
+	if routing, _ := db.Statement.Context.Value(readRoutingKey{}).(readRouting); routing == readFromReplica {
+		db.Statement.ConnPool = r.replica.Config.ConnPool
+	}
+}
+
+func (r *ReadReplicaRouter) routeWrite(db *gorm.DB) {
+	if db.Statement.ConnPool == r.replica.Config.ConnPool {
+		db.Statement.ConnPool = r.primary
+	}
+}
+
+// checkReplica marks the replica usable when it answers and has replayed
+// the primary's changes to within maxLag. A replica that has replayed
+// everything it received is caught up however old its last change is.
+func (r *ReadReplicaRouter) checkReplica(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var lagSeconds float64
+	err := r.replica.WithContext(ctx).Raw(`SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+END`).Scan(&lagSeconds).Error
+
+	lag := time.Duration(lagSeconds * float64(time.Second))
+	healthy := err == nil && (r.maxLag <= 0 || lag <= r.maxLag)
+	if healthy != r.healthy.Load() {
+		if healthy {
+			log.Println("✅ Read replica in use")
+		} else {
+			log.Printf("⚠️  Read replica unavailable or lagging (lag %s, error %v), reading from primary", lag, err)
+		}
+	}
+	r.healthy.Store(healthy)
+	r.lag.Store(int64(lag))
+}
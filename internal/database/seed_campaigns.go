@@ -0,0 +1,36 @@
+package database
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// campaignSeed is the starter set of campaigns. They are created inactive so
+// nothing is sent until staff review the wording and switch them on.
+var campaignSeed = []models.Campaign{
+	{Slug: "birthday", Name: "Birthday greeting", Rule: models.CampaignRuleBirthday, Days: 7,
+		Purpose: models.PurposeMarketing, CooldownDays: 300, AttributionDays: 14,
+		Subject: "Happy birthday, {{first_name}}!",
+		Body:    "Happy birthday, {{first_name}}! Drop by this week and enjoy a little treat from all of us at the pharmacy."},
+	{Slug: "we-miss-you-60d", Name: "We miss you (60 days)", Rule: models.CampaignRuleNoRecentPurchase, Days: 60,
+		Purpose: models.PurposeMarketing, CooldownDays: 60, AttributionDays: 14,
+		Subject: "We miss you, {{first_name}}",
+		Body:    "Hi {{first_name}}, it's been a while since your last visit. We're here whenever you need us, in store or online."},
+	{Slug: "refill-due", Name: "Refill due", Rule: models.CampaignRuleRefillDue, Days: 3,
+		Purpose: models.PurposeReminders, CooldownDays: 7, AttributionDays: 7,
+		Subject: "Your refill is due on {{due_date}}",
+		Body:    "Hi {{first_name}}, your {{products}} is due for a refill on {{due_date}}. Order online or drop by the pharmacy."},
+}
+
+// SeedCampaigns creates the starter campaigns. Existing campaigns, deleted
+// ones included, are left untouched so staff edits are preserved.
+func SeedCampaigns(db *gorm.DB) error {
+	for _, seed := range campaignSeed {
+		campaign := seed
+		if err := db.Unscoped().Where("slug = ?", campaign.Slug).FirstOrCreate(&campaign).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
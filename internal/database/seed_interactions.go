@@ -0,0 +1,116 @@
+package database
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// interactionSource labels the seeded interactions. They were written up
+// in house from the interactions pharmacists see at the counter, not taken
+// from a licensed database such as DrugBank or RxNorm.
+const interactionSource = "Internal curated list"
+
+// legacyInteractionSource is how earlier versions mislabeled the seeded
+// interactions
+const legacyInteractionSource = "DrugBank/RxNorm curated subset"
+
+// drugInteractionSeed is the starter interaction dataset. It covers common,
+// well-documented interactions seen in community pharmacy practice and is
+// meant to be extended by pharmacists through the API.
+var drugInteractionSeed = []models.DrugInteraction{
+	{IngredientA: "warfarin", IngredientB: "aspirin", Severity: models.InteractionSeverityMajor,
+		Description: "Concurrent use increases the risk of serious bleeding.",
+		Management:  "Avoid unless specifically prescribed together; monitor INR and for signs of bleeding."},
+	{IngredientA: "warfarin", IngredientB: "ibuprofen", Severity: models.InteractionSeverityMajor,
+		Description: "NSAIDs increase bleeding risk and may cause GI haemorrhage in anticoagulated patients.",
+		Management:  "Recommend paracetamol for pain instead; refer to prescriber if an NSAID is required."},
+	{IngredientA: "warfarin", IngredientB: "naproxen", Severity: models.InteractionSeverityMajor,
+		Description: "NSAIDs increase bleeding risk and may cause GI haemorrhage in anticoagulated patients.",
+		Management:  "Recommend paracetamol for pain instead; refer to prescriber if an NSAID is required."},
+	{IngredientA: "warfarin", IngredientB: "fluconazole", Severity: models.InteractionSeverityMajor,
+		Description: "Fluconazole inhibits CYP2C9 and can markedly raise INR.",
+		Management:  "Contact prescriber; INR monitoring and warfarin dose reduction may be needed."},
+	{IngredientA: "warfarin", IngredientB: "metronidazole", Severity: models.InteractionSeverityMajor,
+		Description: "Metronidazole inhibits warfarin metabolism and can markedly raise INR.",
+		Management:  "Contact prescriber; INR monitoring and warfarin dose reduction may be needed."},
+	{IngredientA: "warfarin", IngredientB: "paracetamol", Severity: models.InteractionSeverityModerate,
+		Description: "Regular paracetamol use above 2 g/day may raise INR.",
+		Management:  "Occasional use is acceptable; advise patient to report bruising or bleeding."},
+	{IngredientA: "simvastatin", IngredientB: "clarithromycin", Severity: models.InteractionSeverityContraindicated,
+		Description: "Strong CYP3A4 inhibition raises simvastatin levels, risking myopathy and rhabdomyolysis.",
+		Management:  "Do not dispense together; prescriber should suspend simvastatin or choose another antibiotic."},
+	{IngredientA: "simvastatin", IngredientB: "itraconazole", Severity: models.InteractionSeverityContraindicated,
+		Description: "Strong CYP3A4 inhibition raises simvastatin levels, risking myopathy and rhabdomyolysis.",
+		Management:  "Do not dispense together; prescriber should suspend simvastatin during therapy."},
+	{IngredientA: "simvastatin", IngredientB: "amlodipine", Severity: models.InteractionSeverityModerate,
+		Description: "Amlodipine raises simvastatin exposure and the risk of myopathy.",
+		Management:  "Simvastatin dose should not exceed 20 mg daily with amlodipine."},
+	{IngredientA: "sildenafil", IngredientB: "nitroglycerin", Severity: models.InteractionSeverityContraindicated,
+		Description: "Combined vasodilation can cause severe, potentially fatal hypotension.",
+		Management:  "Do not dispense together."},
+	{IngredientA: "sildenafil", IngredientB: "isosorbide mononitrate", Severity: models.InteractionSeverityContraindicated,
+		Description: "Combined vasodilation can cause severe, potentially fatal hypotension.",
+		Management:  "Do not dispense together."},
+	{IngredientA: "lisinopril", IngredientB: "spironolactone", Severity: models.InteractionSeverityMajor,
+		Description: "ACE inhibitors with potassium-sparing diuretics can cause hyperkalaemia.",
+		Management:  "Confirm the combination is intended and potassium is being monitored."},
+	{IngredientA: "lisinopril", IngredientB: "potassium chloride", Severity: models.InteractionSeverityModerate,
+		Description: "Potassium supplements with ACE inhibitors increase the risk of hyperkalaemia.",
+		Management:  "Confirm the supplement is prescribed and potassium is being monitored."},
+	{IngredientA: "spironolactone", IngredientB: "potassium chloride", Severity: models.InteractionSeverityMajor,
+		Description: "Potassium supplements with potassium-sparing diuretics can cause severe hyperkalaemia.",
+		Management:  "Avoid unless prescribed together with potassium monitoring."},
+	{IngredientA: "methotrexate", IngredientB: "trimethoprim", Severity: models.InteractionSeverityMajor,
+		Description: "Additive antifolate effects can cause bone marrow suppression.",
+		Management:  "Contact prescriber before dispensing."},
+	{IngredientA: "methotrexate", IngredientB: "amoxicillin", Severity: models.InteractionSeverityModerate,
+		Description: "Penicillins may reduce methotrexate clearance and increase toxicity.",
+		Management:  "Advise patient to report mouth ulcers, fever, or unusual bruising."},
+	{IngredientA: "clopidogrel", IngredientB: "omeprazole", Severity: models.InteractionSeverityModerate,
+		Description: "Omeprazole inhibits CYP2C19 and reduces clopidogrel's antiplatelet effect.",
+		Management:  "Suggest pantoprazole as an alternative proton pump inhibitor."},
+	{IngredientA: "ciprofloxacin", IngredientB: "theophylline", Severity: models.InteractionSeverityMajor,
+		Description: "Ciprofloxacin raises theophylline levels, risking seizures and arrhythmias.",
+		Management:  "Contact prescriber; theophylline levels should be monitored."},
+	{IngredientA: "ciprofloxacin", IngredientB: "calcium carbonate", Severity: models.InteractionSeverityModerate,
+		Description: "Calcium binds ciprofloxacin and reduces its absorption.",
+		Management:  "Take ciprofloxacin 2 hours before or 6 hours after calcium products."},
+	{IngredientA: "levothyroxine", IngredientB: "calcium carbonate", Severity: models.InteractionSeverityModerate,
+		Description: "Calcium reduces levothyroxine absorption.",
+		Management:  "Separate doses by at least 4 hours."},
+	{IngredientA: "tramadol", IngredientB: "sertraline", Severity: models.InteractionSeverityMajor,
+		Description: "Combined serotonergic effects risk serotonin syndrome and lower the seizure threshold.",
+		Management:  "Contact prescriber; counsel patient on symptoms of serotonin syndrome."},
+	{IngredientA: "tramadol", IngredientB: "fluoxetine", Severity: models.InteractionSeverityMajor,
+		Description: "Combined serotonergic effects risk serotonin syndrome and lower the seizure threshold.",
+		Management:  "Contact prescriber; counsel patient on symptoms of serotonin syndrome."},
+	{IngredientA: "digoxin", IngredientB: "amiodarone", Severity: models.InteractionSeverityMajor,
+		Description: "Amiodarone raises digoxin levels and the risk of toxicity.",
+		Management:  "Contact prescriber; digoxin dose is usually halved."},
+	{IngredientA: "lithium", IngredientB: "ibuprofen", Severity: models.InteractionSeverityMajor,
+		Description: "NSAIDs reduce lithium clearance and can cause lithium toxicity.",
+		Management:  "Recommend paracetamol instead; refer to prescriber if an NSAID is required."},
+}
+
+// SeedDrugInteractions loads the starter interaction dataset. Existing pairs
+// are left untouched so pharmacist edits are preserved, but for relabeling
+// those seeded under the old source.
+func SeedDrugInteractions(db *gorm.DB) error {
+	if err := db.Model(&models.DrugInteraction{}).Where("source = ?", legacyInteractionSource).
+		Update("source", interactionSource).Error; err != nil {
+		return err
+	}
+
+	for _, seed := range drugInteractionSeed {
+		interaction := seed
+		interaction.IngredientA, interaction.IngredientB = models.NormalizeIngredientPair(seed.IngredientA, seed.IngredientB)
+		interaction.Source = interactionSource
+
+		if err := db.Where("ingredient_a = ? AND ingredient_b = ?", interaction.IngredientA, interaction.IngredientB).
+			FirstOrCreate(&interaction).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// loyaltyTierSeed is the starter tier ladder in pesos of rolling 12-month
+// spend. Thresholds and benefits can be changed through the API.
+var loyaltyTierSeed = []models.LoyaltyTier{
+	{Code: "silver", Name: "Silver", MinSpend: models.NewMoney(5000), PointsMultiplier: 1},
+	{Code: "gold", Name: "Gold", MinSpend: models.NewMoney(20000), PointsMultiplier: 1.5, FreeDelivery: true, FreeDeliveryMinOrder: models.NewMoney(1000)},
+	{Code: "platinum", Name: "Platinum", MinSpend: models.NewMoney(50000), PointsMultiplier: 2, FreeDelivery: true},
+}
+
+// SeedLoyaltyTiers creates the starter tiers. Existing tiers, deleted ones
+// included, are left untouched so configured benefits are preserved.
+func SeedLoyaltyTiers(db *gorm.DB) error {
+	for _, seed := range loyaltyTierSeed {
+		tier := seed
+		if err := db.Unscoped().Where("code = ?", tier.Code).FirstOrCreate(&tier).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
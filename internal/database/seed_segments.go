@@ -0,0 +1,31 @@
+package database
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// segmentSeed is the starter set of segments. Staff can change the rule
+// parameters or deactivate them through the API.
+var segmentSeed = []models.Segment{
+	{Slug: "hypertension-maintenance", Name: "Hypertension maintenance", Rule: models.SegmentRuleCondition,
+		Keyword: "hypertension", Description: "Customers with hypertension in their medical history or current medications."},
+	{Slug: "high-value", Name: "High value", Rule: models.SegmentRuleHighValue, Days: 365, MinSpend: models.NewMoney(20000),
+		Description: "Customers who spent at least PHP 20,000 in the last year."},
+	{Slug: "lapsed-90d", Name: "Lapsed 90 days", Rule: models.SegmentRuleLapsed, Days: 90,
+		Description: "Returning customers with no purchase in the last 90 days."},
+}
+
+// SeedSegments creates the starter segments. Existing segments, deleted ones
+// included, are left untouched so staff edits are preserved.
+func SeedSegments(db *gorm.DB) error {
+	for _, seed := range segmentSeed {
+		segment := seed
+		segment.IsActive = true
+		if err := db.Unscoped().Where("slug = ?", segment.Slug).FirstOrCreate(&segment).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package database
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// smsTemplateSeed is the starter wording of text messages, kept short to fit
+// one SMS. Staff can reword or deactivate them through the API.
+var smsTemplateSeed = []models.SMSTemplate{
+	{Name: "order.pending", Description: "Order received. Placeholders: {{order_number}}",
+		Body: "We received your order {{order_number}}. We'll text you when it's ready."},
+	{Name: "order.prescription_needed", Description: "Order waiting for prescription verification. Placeholders: {{order_number}}",
+		Body: "We received your order {{order_number}}. We'll prepare it once your prescription is verified."},
+	{Name: "order.ready", Description: "Order ready for pickup. Placeholders: {{order_number}}",
+		Body: "Your order {{order_number}} is ready for pickup."},
+	{Name: "order.out_for_delivery", Description: "Order out for delivery. Placeholders: {{order_number}}",
+		Body: "Your order {{order_number}} is out for delivery."},
+	{Name: "order.delivered", Description: "Order delivered. Placeholders: {{order_number}}",
+		Body: "Your order {{order_number}} has been delivered. Salamat!"},
+	{Name: "order.picked_up", Description: "Order picked up. Placeholders: {{order_number}}",
+		Body: "Your order {{order_number}} has been picked up. Salamat!"},
+	{Name: "order.cancelled", Description: "Order cancelled. Placeholders: {{order_number}}",
+		Body: "Your order {{order_number}} has been cancelled."},
+	{Name: "order.refunded", Description: "Order refunded. Placeholders: {{order_number}}",
+		Body: "Your order {{order_number}} has been refunded."},
+	{Name: "refill.reminder", Description: "Refill due. Placeholders: {{first_name}}, {{product}}, {{due_date}}, {{reorder_link}}",
+		Body: "Hi {{first_name}}, your {{product}} is due for a refill on {{due_date}}. Reorder: {{reorder_link}}"},
+	{Name: "phone.verification", Description: "Phone number verification code. Placeholders: {{code}}, {{minutes}}",
+		Body: "Your verification code is {{code}}. It expires in {{minutes}} minutes. Never share it with anyone."},
+}
+
+// SeedSMSTemplates creates the starter SMS templates. Existing templates are
+// left untouched so staff edits are preserved.
+func SeedSMSTemplates(db *gorm.DB) error {
+	for _, seed := range smsTemplateSeed {
+		template := seed
+		template.IsActive = true
+		if err := db.Unscoped().Where("name = ?", template.Name).FirstOrCreate(&template).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
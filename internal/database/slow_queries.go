@@ -0,0 +1,75 @@
+package database
+
+import (
+	"time"
+
+	"pharmacy-backend/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const queryStartKey = "slow_queries:start"
+
+// TrackQueries times every statement run through db for
+// pharmacy_db_query_duration_seconds, and logs and counts those slower
+// than threshold. The logged SQL keeps its placeholders, so no patient
+// data reaches the logs. A threshold of zero only times them.
+func TrackQueries(db *gorm.DB, threshold time.Duration) error {
+	t := &queryTimer{threshold: threshold}
+	callbacks := db.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("gorm:create").Register("slow_queries:start_create", t.start),
+		callbacks.Create().After("gorm:create").Register("slow_queries:end_create", t.end("create")),
+		callbacks.Query().Before("gorm:query").Register("slow_queries:start_query", t.start),
+		callbacks.Query().After("gorm:query").Register("slow_queries:end_query", t.end("query")),
+		callbacks.Update().Before("gorm:update").Register("slow_queries:start_update", t.start),
+		callbacks.Update().After("gorm:update").Register("slow_queries:end_update", t.end("update")),
+		callbacks.Delete().Before("gorm:delete").Register("slow_queries:start_delete", t.start),
+		callbacks.Delete().After("gorm:delete").Register("slow_queries:end_delete", t.end("delete")),
+		callbacks.Row().Before("gorm:row").Register("slow_queries:start_row", t.start),
+		callbacks.Row().After("gorm:row").Register("slow_queries:end_row", t.end("row")),
+		callbacks.Raw().Before("gorm:raw").Register("slow_queries:start_raw", t.start),
+		callbacks.Raw().After("gorm:raw").Register("slow_queries:end_raw", t.end("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type queryTimer struct {
+	threshold time.Duration
+}
+
+func (t *queryTimer) start(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+func (t *queryTimer) end(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		elapsed := time.Since(value.(time.Time))
+		metrics.DBQueryDuration.Observe(elapsed.Seconds(), operation)
+		if t.threshold <= 0 || elapsed < t.threshold {
+			return
+		}
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "unknown"
+		}
+		metrics.DBSlowQueries.Inc(operation, table)
+		logrus.WithFields(logrus.Fields{
+			"operation":   operation,
+			"table":       table,
+			"duration_ms": elapsed.Milliseconds(),
+			"rows":        db.RowsAffected,
+			"sql":         db.Statement.SQL.String(),
+		}).Warn("Slow database query")
+	}
+}
@@ -0,0 +1,534 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// syncPolicy is how the rows of a table are merged into the target
+type syncPolicy int
+
+const (
+	// lastWriterWins updates rows in place. A row changed in both databases
+	// since the last sync keeps the later change and records a SyncConflict.
+	lastWriterWins syncPolicy = iota
+	// appendOnly rows are never changed once written, so only rows the
+	// target doesn't have yet are copied
+	appendOnly
+)
+
+type syncedTable struct {
+	model  interface{}
+	policy syncPolicy
+}
+
+// syncTables are copied between the databases, parents before children so
+// foreign keys are satisfied
+var syncTables = []syncedTable{
+	{&models.Branch{}, lastWriterWins},
+	{&models.User{}, lastWriterWins},
+	{&models.Customer{}, lastWriterWins},
+	{&models.Product{}, lastWriterWins},
+	{&models.Service{}, lastWriterWins},
+	{&models.Sale{}, lastWriterWins},
+	{&models.SaleItem{}, lastWriterWins},
+	{&models.StockMovement{}, appendOnly},
+	{&models.StockTransfer{}, lastWriterWins},
+	{&models.BranchPrice{}, lastWriterWins},
+	{&models.ExchangeRate{}, lastWriterWins},
+	{&models.PurchaseHistory{}, lastWriterWins},
+	{&models.Supplier{}, lastWriterWins},
+	{&models.ProductSupplier{}, lastWriterWins},
+	{&models.OnlineOrder{}, lastWriterWins},
+	{&models.OnlineOrderItem{}, lastWriterWins},
+	{&models.ShoppingCart{}, lastWriterWins},
+	{&models.OrderStatusHistory{}, appendOnly},
+	{&models.QRCode{}, lastWriterWins},
+	{&models.QRScanLog{}, appendOnly},
+	{&models.PrescriptionUpload{}, lastWriterWins},
+	{&models.AuditLog{}, appendOnly},
+}
+
+// Product stock isn't merged like the other columns. Each database applies
+// the stock movements it receives to its own stock level, so sales made on
+// both sides while they were apart add up instead of one overwriting the
+// other. The stock column is only copied with a new product.
+const (
+	productsTable       = "products"
+	stockMovementsTable = "stock_movements"
+)
+
+// deletionLogCursor is the SyncCursor table name used for the position in
+// the source's sync_deletions log
+const deletionLogCursor = "sync_deletions"
+
+// installDeletionLog adds a trigger to every synced table in db that writes
+// hard-deleted rows to sync_deletions. Soft deletes are found through
+// deleted_at, but a hard delete leaves nothing behind to sync.
+func installDeletionLog(db *gorm.DB) error {
+	err := db.Exec(`CREATE OR REPLACE FUNCTION sync_record_deletion() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO sync_deletions (table_name, row_id, removed_at) VALUES (TG_TABLE_NAME, OLD.id, now());
+	RETURN OLD;
+END;
+$$ LANGUAGE plpgsql`).Error
+	if err != nil {
+		return fmt.Errorf("failed to create deletion log function: %w", err)
+	}
+
+	for _, synced := range syncTables {
+		table, err := tableName(db, synced.model)
+		if err != nil {
+			return err
+		}
+		if err := db.Exec("DROP TRIGGER IF EXISTS sync_record_deletion ON ?", clause.Table{Name: table}).Error; err != nil {
+			return fmt.Errorf("failed to drop deletion trigger on %s: %w", table, err)
+		}
+		err = db.Exec("CREATE TRIGGER sync_record_deletion AFTER DELETE ON ? FOR EACH ROW EXECUTE FUNCTION sync_record_deletion()",
+			clause.Table{Name: table}).Error
+		if err != nil {
+			return fmt.Errorf("failed to create deletion trigger on %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// syncTable copies the rows of one table that changed in source since the
+// target's cursor. Each batch is applied together with the advanced cursor
+// in one transaction, so a sync interrupted by an outage resumes where it
+// stopped.
+func (dm *DatabaseManager) syncTable(source, target *gorm.DB, sourceName string, synced syncedTable) error {
+	table, err := tableName(target, synced.model)
+	if err != nil {
+		return err
+	}
+	cursor, err := loadSyncCursor(target, sourceName, table)
+	if err != nil {
+		return err
+	}
+	// Target rows changed after the previous run were changed on both sides
+	previousRun := cursor.LastRunAt
+
+	// Inserts and updates, which include restores
+	for {
+		rows, pendingStock, err := dm.readChanges(source, target, sourceName, table, cursor)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		last := rows[len(rows)-1]
+		updatedAt, ok := last["updated_at"].(time.Time)
+		if !ok {
+			return fmt.Errorf("unexpected updated_at %T in %s", last["updated_at"], table)
+		}
+
+		err = target.Transaction(func(tx *gorm.DB) error {
+			existing, err := existingRows(tx, table, rows)
+			if err != nil {
+				return err
+			}
+
+			var applied int64
+			switch synced.policy {
+			case appendOnly:
+				applied, err = insertNewRows(tx, table, rows, existing)
+			default:
+				var conflicts int64
+				applied, conflicts, err = mergeRows(tx, sourceName, table, rows, existing, previousRun, pendingStock)
+				cursor.Conflicts += conflicts
+			}
+			if err != nil {
+				return err
+			}
+
+			cursor.LastUpdatedAt = updatedAt
+			cursor.LastUpdatedID = columnString(last["id"])
+			cursor.RowsApplied += applied
+			cursor.LastRunAt = time.Now()
+			return tx.Save(cursor).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply changes to %s: %w", table, err)
+		}
+		if len(rows) < dm.syncBatchSize() {
+			break
+		}
+	}
+
+	// Soft deletes don't touch updated_at, so they have their own cursor
+	for {
+		var rows []map[string]interface{}
+		err := source.Table(table).
+			Where("deleted_at > ? OR (deleted_at = ? AND id > ?)", cursor.LastDeletedAt, cursor.LastDeletedAt, cursor.LastDeletedID).
+			Order("deleted_at, id").
+			Limit(dm.syncBatchSize()).
+			Find(&rows).Error
+		if err != nil {
+			return fmt.Errorf("failed to read deletions from %s: %w", table, err)
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		last := rows[len(rows)-1]
+		deletedAt, ok := last["deleted_at"].(time.Time)
+		if !ok {
+			return fmt.Errorf("unexpected deleted_at %T in %s", last["deleted_at"], table)
+		}
+
+		err = target.Transaction(func(tx *gorm.DB) error {
+			live := clause.Expr{SQL: "?.deleted_at IS NULL", Vars: []interface{}{clause.Table{Name: table}}}
+			applied, err := upsertRows(tx, table, rows, []string{"deleted_at"}, live)
+			if err != nil {
+				return err
+			}
+			cursor.LastDeletedAt = deletedAt
+			cursor.LastDeletedID = columnString(last["id"])
+			cursor.RowsApplied += applied
+			cursor.LastRunAt = time.Now()
+			return tx.Save(cursor).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply deletions to %s: %w", table, err)
+		}
+		if len(rows) < dm.syncBatchSize() {
+			break
+		}
+	}
+
+	return nil
+}
+
+// readChanges reads the next batch of rows changed after cursor. For
+// products it also returns, per product, the stock change of movements
+// the target hasn't received yet: a new product's stock already includes
+// them, and they would be counted twice when they arrive. Both are read
+// from one snapshot.
+func (dm *DatabaseManager) readChanges(source, target *gorm.DB, sourceName, table string, cursor *models.SyncCursor) ([]map[string]interface{}, map[string]int64, error) {
+	var movements *models.SyncCursor
+	if table == productsTable {
+		var err error
+		if movements, err = loadSyncCursor(target, sourceName, stockMovementsTable); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var rows []map[string]interface{}
+	pendingStock := map[string]int64{}
+	err := source.Transaction(func(tx *gorm.DB) error {
+		err := tx.Table(table).
+			Where("updated_at > ? OR (updated_at = ? AND id > ?)", cursor.LastUpdatedAt, cursor.LastUpdatedAt, cursor.LastUpdatedID).
+			Order("updated_at, id").
+			Limit(dm.syncBatchSize()).
+			Find(&rows).Error
+		if err != nil || movements == nil || len(rows) == 0 {
+			return err
+		}
+
+		var pending []struct {
+			ProductID string
+			Delta     int64
+		}
+		err = tx.Table(stockMovementsTable).
+			Select("product_id, SUM(stock_after - stock_before) AS delta").
+			Where("product_id IN ?", rowIDs(rows)).
+			Where("updated_at > ? OR (updated_at = ? AND id > ?)", movements.LastUpdatedAt, movements.LastUpdatedAt, movements.LastUpdatedID).
+			Group("product_id").
+			Scan(&pending).Error
+		for _, p := range pending {
+			pendingStock[p.ProductID] = p.Delta
+		}
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read changes from %s: %w", table, err)
+	}
+	return rows, pendingStock, nil
+}
+
+// mergeRows applies rows to a last-writer-wins table. It returns the number
+// of rows written and of conflicts recorded.
+func mergeRows(tx *gorm.DB, sourceName, table string, rows []map[string]interface{}, existing map[string]map[string]interface{}, previousRun time.Time, pendingStock map[string]int64) (int64, int64, error) {
+	var conflicts int64
+	for _, row := range rows {
+		current, found := existing[columnString(row["id"])]
+		if !found || previousRun.IsZero() {
+			continue
+		}
+		sourceUpdated, _ := row["updated_at"].(time.Time)
+		targetUpdated, _ := current["updated_at"].(time.Time)
+		if sourceUpdated.Equal(targetUpdated) || !targetUpdated.After(previousRun) || !rowsDiffer(table, row, current) {
+			continue
+		}
+		if err := recordConflict(tx, sourceName, table, row, current); err != nil {
+			return 0, 0, err
+		}
+		conflicts++
+	}
+
+	newer := clause.Expr{SQL: "?.updated_at < excluded.updated_at", Vars: []interface{}{clause.Table{Name: table}}}
+	applied, err := upsertRows(tx, table, rows, updateColumns(table, rows[0]), newer)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if table == productsTable {
+		for _, row := range rows {
+			id := columnString(row["id"])
+			if _, found := existing[id]; found || pendingStock[id] == 0 {
+				continue
+			}
+			err := tx.Exec("UPDATE products SET stock = stock - ? WHERE id = ?", pendingStock[id], id).Error
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to adjust stock of new product %s: %w", id, err)
+			}
+		}
+	}
+	return applied, conflicts, nil
+}
+
+// insertNewRows copies the rows of an append-only table that the target
+// doesn't have. New stock movements are applied to the product's stock.
+func insertNewRows(tx *gorm.DB, table string, rows []map[string]interface{}, existing map[string]map[string]interface{}) (int64, error) {
+	var inserted []map[string]interface{}
+	for _, row := range rows {
+		if _, found := existing[columnString(row["id"])]; !found {
+			inserted = append(inserted, row)
+		}
+	}
+	if len(inserted) == 0 {
+		return 0, nil
+	}
+
+	if err := tx.Table(table).Clauses(clause.OnConflict{DoNothing: true}).Create(&inserted).Error; err != nil {
+		return 0, err
+	}
+
+	if table == stockMovementsTable {
+		err := tx.Exec(`UPDATE products SET stock = stock + movements.delta
+FROM (SELECT product_id, SUM(stock_after - stock_before) AS delta FROM stock_movements WHERE id IN ? GROUP BY product_id) AS movements
+WHERE products.id = movements.product_id`, rowIDs(inserted)).Error
+		if err != nil {
+			return 0, fmt.Errorf("failed to apply stock movements: %w", err)
+		}
+	}
+	return int64(len(inserted)), nil
+}
+
+// recordConflict stores both versions of a row changed on both sides. The
+// later change is the one applied.
+func recordConflict(tx *gorm.DB, sourceName, table string, sourceRow, targetRow map[string]interface{}) error {
+	sourceUpdated, _ := sourceRow["updated_at"].(time.Time)
+	targetUpdated, _ := targetRow["updated_at"].(time.Time)
+
+	conflict := models.SyncConflict{
+		Source:     sourceName,
+		TableName:  table,
+		Resolution: "target_won",
+		Status:     models.SyncConflictOpen,
+	}
+	applied, discarded := targetRow, sourceRow
+	conflict.AppliedUpdatedAt, conflict.DiscardedUpdatedAt = targetUpdated, sourceUpdated
+	if sourceUpdated.After(targetUpdated) {
+		conflict.Resolution = "source_won"
+		applied, discarded = sourceRow, targetRow
+		conflict.AppliedUpdatedAt, conflict.DiscardedUpdatedAt = sourceUpdated, targetUpdated
+	}
+
+	id, err := uuid.Parse(columnString(sourceRow["id"]))
+	if err != nil {
+		return fmt.Errorf("invalid id in %s: %w", table, err)
+	}
+	conflict.RowID = id
+
+	appliedJSON, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	discardedJSON, err := json.Marshal(discarded)
+	if err != nil {
+		return err
+	}
+	conflict.AppliedData = string(appliedJSON)
+	conflict.DiscardedData = string(discardedJSON)
+
+	if err := tx.Create(&conflict).Error; err != nil {
+		return fmt.Errorf("failed to record sync conflict: %w", err)
+	}
+	return nil
+}
+
+// rowsDiffer reports whether two versions of a row differ in anything but
+// updated_at and the columns that aren't merged
+func rowsDiffer(table string, a, b map[string]interface{}) bool {
+	for _, column := range updateColumns(table, a) {
+		if column == "updated_at" {
+			continue
+		}
+		if columnString(a[column]) != columnString(b[column]) {
+			return true
+		}
+	}
+	return false
+}
+
+// existingRows loads the target's copies of rows, keyed by ID
+func existingRows(tx *gorm.DB, table string, rows []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	var found []map[string]interface{}
+	if err := tx.Table(table).Where("id IN ?", rowIDs(rows)).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("failed to read target rows from %s: %w", table, err)
+	}
+	existing := make(map[string]map[string]interface{}, len(found))
+	for _, row := range found {
+		existing[columnString(row["id"])] = row
+	}
+	return existing, nil
+}
+
+func rowIDs(rows []map[string]interface{}) []string {
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = columnString(row["id"])
+	}
+	return ids
+}
+
+// syncDeletions replays the source's hard deletes on the target and returns
+// the last sync_deletions entry the target has applied. A row changed at
+// the target after it was deleted at the source is kept.
+func (dm *DatabaseManager) syncDeletions(source, target *gorm.DB, sourceName string) (uint64, error) {
+	cursor, err := loadSyncCursor(target, sourceName, deletionLogCursor)
+	if err != nil {
+		return 0, err
+	}
+
+	synced := make(map[string]bool, len(syncTables))
+	for _, table := range syncTables {
+		name, err := tableName(target, table.model)
+		if err != nil {
+			return 0, err
+		}
+		synced[name] = true
+	}
+
+	for {
+		var deletions []models.SyncDeletion
+		err := source.Where("id > ?", cursor.LastDeletionID).
+			Order("id").
+			Limit(dm.syncBatchSize()).
+			Find(&deletions).Error
+		if err != nil {
+			return cursor.LastDeletionID, fmt.Errorf("failed to read deletion log: %w", err)
+		}
+		if len(deletions) == 0 {
+			break
+		}
+
+		position := cursor.LastDeletionID
+		err = target.Transaction(func(tx *gorm.DB) error {
+			for _, deletion := range deletions {
+				if !synced[deletion.TableName] {
+					continue
+				}
+				result := tx.Exec("DELETE FROM ? WHERE id = ? AND updated_at <= ?",
+					clause.Table{Name: deletion.TableName}, deletion.RowID, deletion.RemovedAt)
+				if result.Error != nil {
+					return fmt.Errorf("failed to delete %s %s: %w", deletion.TableName, deletion.RowID, result.Error)
+				}
+				cursor.RowsApplied += result.RowsAffected
+			}
+			cursor.LastDeletionID = deletions[len(deletions)-1].ID
+			cursor.LastRunAt = time.Now()
+			return tx.Save(cursor).Error
+		})
+		if err != nil {
+			return position, err
+		}
+		if len(deletions) < dm.syncBatchSize() {
+			break
+		}
+	}
+
+	return cursor.LastDeletionID, nil
+}
+
+func (dm *DatabaseManager) syncBatchSize() int {
+	if dm.config.Sync.BatchSize > 0 {
+		return dm.config.Sync.BatchSize
+	}
+	return 500
+}
+
+// loadSyncCursor returns the target's cursor for a source table, starting
+// from the beginning if the table hasn't been synced before
+func loadSyncCursor(target *gorm.DB, sourceName, table string) (*models.SyncCursor, error) {
+	cursor := &models.SyncCursor{Source: sourceName, TableName: table}
+	err := target.Where("source = ? AND table_name = ?", sourceName, table).FirstOrInit(cursor).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sync cursor for %s: %w", table, err)
+	}
+	if cursor.LastUpdatedID == "" {
+		cursor.LastUpdatedID = uuid.Nil.String()
+	}
+	if cursor.LastDeletedID == "" {
+		cursor.LastDeletedID = uuid.Nil.String()
+	}
+	return cursor, nil
+}
+
+// upsertRows inserts rows into table, updating the given columns of rows
+// that already exist when condition holds. It returns the number of rows
+// inserted or updated.
+func upsertRows(tx *gorm.DB, table string, rows []map[string]interface{}, columns []string, condition clause.Expression) (int64, error) {
+	result := tx.Table(table).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns(columns),
+		Where:     clause.Where{Exprs: []clause.Expression{condition}},
+	}).Create(&rows)
+	return result.RowsAffected, result.Error
+}
+
+// updateColumns is every column of row except the primary key, and product
+// stock, which follows the stock movements
+func updateColumns(table string, row map[string]interface{}) []string {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		if column != "id" && !(table == productsTable && column == "stock") {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// columnString formats a value read into a row map. Drivers return UUIDs
+// as strings, bytes or, for types they don't know, a pointer to the value.
+func columnString(value interface{}) string {
+	switch v := value.(type) {
+	case *interface{}:
+		if v != nil {
+			return columnString(*v)
+		}
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(value)
+}
+
+func tableName(db *gorm.DB, model interface{}) (string, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return "", fmt.Errorf("failed to parse model %T: %w", model, err)
+	}
+	return stmt.Schema.Table, nil
+}
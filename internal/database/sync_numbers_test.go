@@ -0,0 +1,109 @@
+package database_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// TestSyncNumbers numbers sales for the same branch on the same day in a
+// store's database and in the cloud's, as happens while the store is
+// offline, and checks both sales sync both ways. The cloud's database
+// starts as a copy of the store's node, as if restored from its backup.
+func TestSyncNumbers(t *testing.T) {
+	store, cloud := openSyncDatabase(t, "store"), openSyncDatabase(t, "cloud")
+	var node models.DatabaseNode
+	if err := store.First(&node, models.DatabaseNodeID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := cloud.Save(&node).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	branch := models.Branch{Code: "MKT", Name: "Makati"}
+	pharmacist := models.User{
+		Username:     "pharmacist",
+		Email:        "pharmacist@example.com",
+		PasswordHash: "not-a-hash",
+		FirstName:    "Maria",
+		LastName:     "Santos",
+		Role:         models.RolePharmacist,
+	}
+	if err := store.Create(&branch).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(&pharmacist).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SyncDatabasePair(store, cloud, "primary"); err != nil {
+		t.Fatalf("store->cloud: %v", err)
+	}
+
+	sales := map[string]string{}
+	for name, db := range map[string]*gorm.DB{"store": store, "cloud": cloud} {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			number, err := services.NewNumberService(db).SaleNumber(tx, &branch.ID)
+			if err != nil {
+				return err
+			}
+			sale := models.Sale{
+				BranchID:      &branch.ID,
+				SaleNumber:    number,
+				Total:         models.NewMoney(100),
+				Subtotal:      models.NewMoney(100),
+				PaymentMethod: models.PaymentMethodCash,
+				PharmacistID:  &pharmacist.ID,
+			}
+			sales[name] = number
+			return tx.Create(&sale).Error
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+	if sales["store"] == sales["cloud"] {
+		t.Fatalf("both databases numbered their sale %s", sales["store"])
+	}
+
+	if err := database.SyncDatabasePair(store, cloud, "primary"); err != nil {
+		t.Fatalf("store->cloud: %v", err)
+	}
+	if err := database.SyncDatabasePair(cloud, store, "cloud"); err != nil {
+		t.Fatalf("cloud->store: %v", err)
+	}
+	for name, db := range map[string]*gorm.DB{"store": store, "cloud": cloud} {
+		var numbers []string
+		if err := db.Model(&models.Sale{}).Order("sale_number").Pluck("sale_number", &numbers).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(numbers) != 2 {
+			t.Errorf("%s has sales %v, want %s and %s", name, numbers, sales["store"], sales["cloud"])
+		}
+	}
+}
+
+func openSyncDatabase(t *testing.T, name string) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), name+".db")), &gorm.Config{
+		Logger: gormlogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
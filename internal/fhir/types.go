@@ -0,0 +1,156 @@
+// Package fhir holds the subset of HL7 FHIR R4 resources the pharmacy
+// accepts from clinic systems.
+package fhir
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Bundle is a FHIR R4 Bundle resource
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	ID           string        `json:"id,omitempty"`
+	Type         string        `json:"type"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+// BundleEntry is one entry in a Bundle. Resource is kept raw and decoded
+// once its resourceType is known.
+type BundleEntry struct {
+	FullURL  string          `json:"fullUrl,omitempty"`
+	Resource json.RawMessage `json:"resource"`
+}
+
+// ResourceType reads the resourceType of an entry without decoding the rest
+func (e BundleEntry) ResourceType() string {
+	var header struct {
+		ResourceType string `json:"resourceType"`
+	}
+	_ = json.Unmarshal(e.Resource, &header)
+	return header.ResourceType
+}
+
+// Patient is a FHIR R4 Patient resource
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	BirthDate    string         `json:"birthDate,omitempty"`
+}
+
+// ContactValue returns the first contact value for a system such as "email" or "phone"
+func (p Patient) ContactValue(system string) string {
+	for _, contact := range p.Telecom {
+		if contact.System == system && contact.Value != "" {
+			return contact.Value
+		}
+	}
+	return ""
+}
+
+// Medication is a FHIR R4 Medication resource
+type Medication struct {
+	ResourceType string          `json:"resourceType"`
+	ID           string          `json:"id,omitempty"`
+	Code         CodeableConcept `json:"code"`
+}
+
+// MedicationRequest is a FHIR R4 MedicationRequest resource
+type MedicationRequest struct {
+	ResourceType              string           `json:"resourceType"`
+	ID                        string           `json:"id,omitempty"`
+	Identifier                []Identifier     `json:"identifier,omitempty"`
+	Status                    string           `json:"status"`
+	Intent                    string           `json:"intent"`
+	MedicationCodeableConcept *CodeableConcept `json:"medicationCodeableConcept,omitempty"`
+	MedicationReference       *Reference       `json:"medicationReference,omitempty"`
+	Subject                   Reference        `json:"subject"`
+	AuthoredOn                string           `json:"authoredOn,omitempty"`
+	Requester                 *Reference       `json:"requester,omitempty"`
+	DosageInstruction         []Dosage         `json:"dosageInstruction,omitempty"`
+	DispenseRequest           *DispenseRequest `json:"dispenseRequest,omitempty"`
+	Note                      []Annotation     `json:"note,omitempty"`
+}
+
+type Identifier struct {
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+type HumanName struct {
+	Family string   `json:"family,omitempty"`
+	Given  []string `json:"given,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+type ContactPoint struct {
+	System string `json:"system,omitempty"` // phone, email, ...
+	Value  string `json:"value"`
+}
+
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Display returns the human readable name of the concept
+func (c CodeableConcept) Display() string {
+	if strings.TrimSpace(c.Text) != "" {
+		return c.Text
+	}
+	for _, coding := range c.Coding {
+		if coding.Display != "" {
+			return coding.Display
+		}
+	}
+	return ""
+}
+
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+type Dosage struct {
+	Text string `json:"text,omitempty"`
+}
+
+type Quantity struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit,omitempty"`
+	Code  string  `json:"code,omitempty"`
+}
+
+// Days converts a duration quantity to whole days
+func (q Quantity) Days() int {
+	unit := strings.ToLower(q.Code)
+	if unit == "" {
+		unit = strings.ToLower(q.Unit)
+	}
+	switch strings.TrimSuffix(unit, "s") {
+	case "wk", "week":
+		return int(q.Value * 7)
+	case "mo", "month":
+		return int(q.Value * 30)
+	}
+	return int(q.Value)
+}
+
+type DispenseRequest struct {
+	Quantity               *Quantity `json:"quantity,omitempty"`
+	ExpectedSupplyDuration *Quantity `json:"expectedSupplyDuration,omitempty"`
+	NumberOfRepeatsAllowed int       `json:"numberOfRepeatsAllowed,omitempty"`
+}
+
+type Annotation struct {
+	Text string `json:"text"`
+}
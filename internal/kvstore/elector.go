@@ -0,0 +1,101 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Elector runs background jobs that must run on one instance at a time,
+// such as reminders and backups. Every instance runs every job through it;
+// the one holding the job's lock runs it and the others wait to take over
+// should that instance stop or lose touch with the store.
+type Elector struct {
+	store    Store
+	instance string
+	ttl      time.Duration
+	logger   *logrus.Logger
+}
+
+// NewElector returns an elector for this instance, named instance in logs.
+// A leader that stops renewing its lock is replaced within ttl.
+func NewElector(store Store, instance string, ttl time.Duration, logger *logrus.Logger) *Elector {
+	return &Elector{store: store, instance: instance, ttl: ttl, logger: logger}
+}
+
+// Run runs job while this instance leads name, until ctx is done. The job's
+// context is cancelled when the lead is lost, and Run waits for it to
+// return before trying to take the lead again.
+func (e *Elector) Run(ctx context.Context, name string, job func(ctx context.Context)) {
+	// Leaders renew well before the lock expires, followers try about as often
+	interval := e.ttl / 3
+	log := e.logger.WithFields(logrus.Fields{"job": name, "instance": e.instance})
+
+	for {
+		lock, err := TryLock(ctx, e.store, "leader:"+name, e.ttl)
+		switch {
+		case err == nil:
+			log.Info("Leading background job")
+			e.lead(ctx, lock, interval, job, log)
+		case !errors.Is(err, ErrLockHeld) && ctx.Err() == nil:
+			log.WithError(err).Warn("Failed to contend for background job")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Private helper methods
+
+// lead runs job and renews lock until ctx is done or the lock is lost, then
+// stops the job and releases the lock
+func (e *Elector) lead(ctx context.Context, lock *Lock, interval time.Duration, job func(ctx context.Context), log *logrus.Entry) {
+	jobCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		job(jobCtx)
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			stop()
+			e.release(lock, log)
+			return
+		case <-ctx.Done():
+			stop()
+			<-done
+			e.release(lock, log)
+			return
+		case <-ticker.C:
+			if err := lock.Refresh(ctx); err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				log.WithError(err).Warn("Lost the lead of background job, stopping it")
+				stop()
+				<-done
+				return
+			}
+		}
+	}
+}
+
+// release hands the lead over at once rather than when the lock expires.
+// It runs after ctx is done, so it has a deadline of its own.
+func (e *Elector) release(lock *Lock, log *logrus.Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := lock.Unlock(ctx); err != nil {
+		log.WithError(err).Warn("Failed to release background job lock")
+	}
+}
@@ -0,0 +1,130 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fallback uses a primary store, normally Redis, and a fallback while the
+// primary fails, rather than letting limits lapse or forgetting revoked
+// sessions. The switch to degraded mode and back is logged once each way.
+type Fallback struct {
+	primary  Store
+	fallback Store
+	logger   *logrus.Logger
+	degraded atomic.Bool
+}
+
+func NewFallback(primary, fallback Store, logger *logrus.Logger) *Fallback {
+	return &Fallback{primary: primary, fallback: fallback, logger: logger}
+}
+
+// Get also checks the fallback for a key the primary doesn't have, as it may
+// have been written while the primary was failing
+func (f *Fallback) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := f.primary.Get(ctx, key)
+	if err == nil {
+		f.recovered()
+		return value, nil
+	}
+	if errors.Is(err, ErrNotFound) {
+		f.recovered()
+	} else {
+		f.failed(ctx, err)
+	}
+	return f.fallback.Get(ctx, key)
+}
+
+func (f *Fallback) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := f.primary.Set(ctx, key, value, ttl); err != nil {
+		f.failed(ctx, err)
+		return f.fallback.Set(ctx, key, value, ttl)
+	}
+	f.recovered()
+	return nil
+}
+
+func (f *Fallback) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	set, err := f.primary.SetNX(ctx, key, value, ttl)
+	if err != nil {
+		f.failed(ctx, err)
+		return f.fallback.SetNX(ctx, key, value, ttl)
+	}
+	f.recovered()
+	return set, nil
+}
+
+func (f *Fallback) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	count, ttl, err := f.primary.Incr(ctx, key, window)
+	if err != nil {
+		f.failed(ctx, err)
+		return f.fallback.Incr(ctx, key, window)
+	}
+	f.recovered()
+	return count, ttl, nil
+}
+
+// Delete deletes key from both stores, so a key written while the primary
+// was failing doesn't come back
+func (f *Fallback) Delete(ctx context.Context, key string) error {
+	fallbackErr := f.fallback.Delete(ctx, key)
+	if err := f.primary.Delete(ctx, key); err != nil {
+		f.failed(ctx, err)
+		return fallbackErr
+	}
+	f.recovered()
+	return fallbackErr
+}
+
+func (f *Fallback) DeleteIf(ctx context.Context, key string, value []byte) (bool, error) {
+	deleted, err := f.primary.DeleteIf(ctx, key, value)
+	if err != nil {
+		f.failed(ctx, err)
+		return f.fallback.DeleteIf(ctx, key, value)
+	}
+	f.recovered()
+	// A lock taken while the primary was failing is only in the fallback
+	if !deleted {
+		return f.fallback.DeleteIf(ctx, key, value)
+	}
+	return true, nil
+}
+
+func (f *Fallback) ExpireIf(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	renewed, err := f.primary.ExpireIf(ctx, key, value, ttl)
+	if err != nil {
+		f.failed(ctx, err)
+		return f.fallback.ExpireIf(ctx, key, value, ttl)
+	}
+	f.recovered()
+	return renewed, nil
+}
+
+// Shared is false while the primary is failing
+func (f *Fallback) Shared() bool {
+	return !f.degraded.Load() && f.primary.Shared()
+}
+
+// Private helper methods
+
+func (f *Fallback) failed(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		// The caller gave up, the primary may be fine
+		return
+	}
+	if f.degraded.CompareAndSwap(false, true) {
+		f.logger.WithError(err).Warn("Redis is failing, keeping rate limits, login throttling, " +
+			"session revocations, idempotency keys and background job locks in memory on this instance " +
+			"until it recovers")
+	}
+}
+
+func (f *Fallback) recovered() {
+	if f.degraded.CompareAndSwap(true, false) {
+		f.logger.Info("Redis has recovered, shared storage is back in use")
+	}
+}
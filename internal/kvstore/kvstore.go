@@ -0,0 +1,53 @@
+// Package kvstore keeps the server's short-lived shared state: rate limit
+// windows, login counters, revoked sessions, idempotency records and the
+// locks that keep background jobs to one instance. It is kept in Redis so
+// every instance sees it, and in memory on a server running without Redis,
+// such as a laptop in development.
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrNotFound = errors.New("key not found")
+
+// Store is a key-value store whose keys expire. A ttl of zero keeps a key
+// until it is deleted.
+type Store interface {
+	// Get returns the value of key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetNX sets key only if it isn't set, and reports whether it did
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Incr adds one to the count in key and returns it with the time left
+	// until key expires. The first increment starts a window of window.
+	Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+	Delete(ctx context.Context, key string) error
+	// DeleteIf deletes key only if it holds value, and reports whether it
+	// did
+	DeleteIf(ctx context.Context, key string, value []byte) (bool, error)
+	// ExpireIf gives key a new ttl only if it holds value, and reports
+	// whether it did
+	ExpireIf(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+
+	// Shared reports whether other instances see the same keys. While it
+	// doesn't, limits and revocations only apply to this instance.
+	Shared() bool
+}
+
+// Open returns the store for the server: Redis with memory to fall back on
+// while it is unreachable, or memory alone when client is nil
+func Open(client *redis.Client, logger *logrus.Logger) Store {
+	if client == nil {
+		logger.Warn("Running without Redis: rate limits, login throttling, session revocations, " +
+			"idempotency keys and background job locks are kept in memory, only apply to this instance " +
+			"and are lost on restart")
+		return NewMemory()
+	}
+	return NewFallback(NewRedis(client), NewMemory(), logger)
+}
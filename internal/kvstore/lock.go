@@ -0,0 +1,58 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrLockHeld = errors.New("lock is held by another instance")
+	ErrLockLost = errors.New("lock has expired or been taken by another instance")
+)
+
+// Lock is a lease on a name that one holder has at a time, across every
+// instance sharing the store. It expires after its ttl unless refreshed, so
+// an instance that dies doesn't hold it for good.
+type Lock struct {
+	store Store
+	key   string
+	token []byte
+	ttl   time.Duration
+}
+
+// TryLock takes the lock on name for ttl, or returns ErrLockHeld when
+// someone else has it
+func TryLock(ctx context.Context, store Store, name string, ttl time.Duration) (*Lock, error) {
+	lock := &Lock{store: store, key: "lock:" + name, token: []byte(uuid.NewString()), ttl: ttl}
+	taken, err := store.SetNX(ctx, lock.key, lock.token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !taken {
+		return nil, ErrLockHeld
+	}
+	return lock, nil
+}
+
+// Refresh extends the lock by its ttl, or returns ErrLockLost when it has
+// expired in the meantime
+func (l *Lock) Refresh(ctx context.Context) error {
+	renewed, err := l.store.ExpireIf(ctx, l.key, l.token, l.ttl)
+	if err != nil {
+		return err
+	}
+	if !renewed {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Unlock releases the lock. Releasing a lock that has been lost does
+// nothing, so it can't release someone else's.
+func (l *Lock) Unlock(ctx context.Context) error {
+	_, err := l.store.DeleteIf(ctx, l.key, l.token)
+	return err
+}
@@ -0,0 +1,156 @@
+package kvstore
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Memory keeps keys in this process. Expired keys are dropped when read and
+// swept out at most once a minute.
+type Memory struct {
+	mu        sync.Mutex
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time // zero for keys that don't expire
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: make(map[string]memoryEntry)}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key, time.Now())
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.entries[key] = newMemoryEntry(value, ttl, now)
+	m.sweep(now)
+	return nil
+}
+
+func (m *Memory) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if _, ok := m.lookup(key, now); ok {
+		return false, nil
+	}
+	m.entries[key] = newMemoryEntry(value, ttl, now)
+	m.sweep(now)
+	return true, nil
+}
+
+func (m *Memory) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := m.lookup(key, now)
+	if !ok {
+		entry = newMemoryEntry(nil, window, now)
+	}
+	count, _ := strconv.ParseInt(string(entry.value), 10, 64)
+	count++
+	entry.value = []byte(strconv.FormatInt(count, 10))
+	m.entries[key] = entry
+	m.sweep(now)
+
+	var left time.Duration
+	if !entry.expires.IsZero() {
+		left = entry.expires.Sub(now)
+	}
+	return count, left, nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *Memory) DeleteIf(ctx context.Context, key string, value []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.lookup(key, time.Now())
+	if !ok || !bytes.Equal(entry.value, value) {
+		return false, nil
+	}
+	delete(m.entries, key)
+	return true, nil
+}
+
+func (m *Memory) ExpireIf(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := m.lookup(key, now)
+	if !ok || !bytes.Equal(entry.value, value) {
+		return false, nil
+	}
+	m.entries[key] = newMemoryEntry(entry.value, ttl, now)
+	return true, nil
+}
+
+func (m *Memory) Shared() bool { return false }
+
+// Private helper methods
+
+func newMemoryEntry(value []byte, ttl time.Duration, now time.Time) memoryEntry {
+	entry := memoryEntry{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		entry.expires = now.Add(ttl)
+	}
+	return entry
+}
+
+// lookup returns key's entry unless it has expired. Callers hold mu.
+func (m *Memory) lookup(key string, now time.Time) (memoryEntry, bool) {
+	entry, ok := m.entries[key]
+	if !ok {
+		return memoryEntry{}, false
+	}
+	if entry.expired(now) {
+		delete(m.entries, key)
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+// sweep drops expired entries at most once a minute. Callers hold mu.
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, entry := range m.entries {
+		if entry.expired(now) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package kvstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// deleteIfScript and expireIfScript compare and change a key in one step,
+// so a lock that expired and was taken by another instance isn't released
+// or renewed by its old holder
+var (
+	deleteIfScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	expireIfScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Redis keeps keys in Redis, shared by every instance
+type Redis struct {
+	client *redis.Client
+}
+
+func NewRedis(client *redis.Client) *Redis {
+	return &Redis{client: client}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := r.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (r *Redis) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, ttl).Result()
+}
+
+func (r *Redis) Incr(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	count, err := r.client.Incr(ctx, key).Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	if count == 1 && window > 0 {
+		r.client.Expire(ctx, key, window)
+	}
+	ttl, err := r.client.TTL(ctx, key).Result()
+	if window > 0 && (err != nil || ttl < 0) {
+		// A missing expiry would keep the count for good
+		r.client.Expire(ctx, key, window)
+		ttl = window
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return count, ttl, nil
+}
+
+func (r *Redis) Delete(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+func (r *Redis) DeleteIf(ctx context.Context, key string, value []byte) (bool, error) {
+	deleted, err := deleteIfScript.Run(ctx, r.client, []string{key}, value).Int64()
+	return deleted == 1, err
+}
+
+func (r *Redis) ExpireIf(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	renewed, err := expireIfScript.Run(ctx, r.client, []string{key}, value, ttl.Milliseconds()).Int64()
+	return renewed == 1, err
+}
+
+func (r *Redis) Shared() bool { return true }
@@ -0,0 +1,104 @@
+package labels
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Certificates are printed on A6 landscape
+const (
+	certificateWidth  = 420
+	certificateHeight = 298
+	certificateMargin = 24
+)
+
+// VaccinationCertificate is the proof of vaccination given to the customer
+// after each dose
+type VaccinationCertificate struct {
+	Pharmacy Pharmacy
+
+	PatientName  string
+	DateOfBirth  time.Time
+	Vaccine      string
+	Manufacturer string
+	BatchNumber  string
+	DoseNumber   int
+	TotalDoses   int // 0 when the series length is not fixed, e.g. boosters
+	Site         string
+
+	AdministeredAt time.Time
+	AdministeredBy string
+	NextDoseDue    *time.Time
+
+	VerificationCode string // value encoded in the certificate QR code
+	VerificationURL  string
+}
+
+// Lines returns the certificate body as plain text lines
+func (v VaccinationCertificate) Lines() []string {
+	dose := fmt.Sprintf("Dose %d", v.DoseNumber)
+	if v.TotalDoses > 0 {
+		dose += fmt.Sprintf(" of %d", v.TotalDoses)
+	}
+
+	lines := []string{
+		"Name: " + v.PatientName,
+		"Date of birth: " + v.DateOfBirth.Format("2006-01-02"),
+		"Vaccine: " + v.Vaccine,
+	}
+	if v.Manufacturer != "" {
+		lines = append(lines, "Manufacturer: "+v.Manufacturer)
+	}
+	lines = append(lines,
+		"Batch/Lot: "+v.BatchNumber,
+		dose,
+		"Date given: "+v.AdministeredAt.Format("2006-01-02"),
+	)
+	if v.Site != "" {
+		lines = append(lines, "Site: "+strings.ReplaceAll(v.Site, "_", " "))
+	}
+	if v.AdministeredBy != "" {
+		lines = append(lines, "Administered by: "+v.AdministeredBy)
+	}
+	if v.NextDoseDue != nil {
+		lines = append(lines, "Next dose due: "+v.NextDoseDue.Format("2006-01-02"))
+	}
+	return lines
+}
+
+// RenderCertificatePDF renders a single-page vaccination certificate
+func RenderCertificatePDF(cert VaccinationCertificate) []byte {
+	var b strings.Builder
+	y := certificateHeight - certificateMargin - 12
+
+	text := func(font string, size, x int, s string) {
+		fmt.Fprintf(&b, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+	}
+
+	text("F2", 14, certificateMargin, "Certificate of Vaccination")
+	y -= 16
+	for _, line := range cert.Pharmacy.Lines() {
+		text("F1", 8, certificateMargin, line)
+		y -= 10
+	}
+
+	fmt.Fprintf(&b, "%d %d m %d %d l S\n", certificateMargin, y+4, certificateWidth-certificateMargin, y+4)
+	y -= 12
+
+	for _, line := range cert.Lines() {
+		text("F1", 10, certificateMargin, line)
+		y -= 14
+	}
+
+	y = certificateMargin + 12
+	if cert.VerificationCode != "" {
+		text("F2", 9, certificateMargin, "Verification code: "+cert.VerificationCode)
+		y -= 11
+		if cert.VerificationURL != "" {
+			text("F1", 8, certificateMargin, cert.VerificationURL)
+		}
+	}
+
+	return writePDF(certificateWidth, certificateHeight, []string{b.String()})
+}
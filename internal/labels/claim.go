@@ -0,0 +1,146 @@
+package labels
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Claim forms are printed on A4 portrait
+const (
+	claimWidth     = 595
+	claimHeight    = 842
+	claimMargin    = 48
+	claimLineWidth = 95 // characters per line at the body font size
+)
+
+// InsuranceClaimForm is the statement of account sent to an HMO with the
+// member's letter of authorization to claim for a sale
+type InsuranceClaimForm struct {
+	Pharmacy Pharmacy
+
+	ClaimNumber   string
+	SaleNumber    string
+	InvoiceNumber string
+	DispensedAt   time.Time
+
+	Provider     string
+	MemberName   string
+	MemberNumber string
+	Company      string
+	LOANumber    string
+	LOAIssuedAt  *time.Time
+	LOAExpiresAt *time.Time
+	Physician    string
+	Diagnosis    string
+
+	Items []ClaimFormItem
+
+	SaleTotal     string // amounts are formatted by the caller
+	PatientShare  string
+	ClaimedAmount string
+
+	PreparedBy string
+}
+
+// ClaimFormItem is one dispensed line of the claimed sale
+type ClaimFormItem struct {
+	Description string
+	Quantity    int
+	UnitPrice   string
+	Total       string
+}
+
+// Lines returns the form body as plain text lines
+func (f InsuranceClaimForm) Lines() []string {
+	lines := []string{
+		"Claim No.: " + f.ClaimNumber,
+		"Sale No.: " + f.SaleNumber,
+	}
+	if f.InvoiceNumber != "" {
+		lines = append(lines, "Invoice No.: "+f.InvoiceNumber)
+	}
+	lines = append(lines,
+		"Date dispensed: "+f.DispensedAt.Format("2006-01-02"),
+		"",
+		"HMO: "+f.Provider,
+		"Member: "+f.MemberName,
+		"Member ID: "+f.MemberNumber,
+	)
+	if f.Company != "" {
+		lines = append(lines, "Company: "+f.Company)
+	}
+
+	loa := "LOA No.: " + f.LOANumber
+	if f.LOAIssuedAt != nil {
+		loa += "   Issued: " + f.LOAIssuedAt.Format("2006-01-02")
+	}
+	if f.LOAExpiresAt != nil {
+		loa += "   Valid until: " + f.LOAExpiresAt.Format("2006-01-02")
+	}
+	lines = append(lines, loa)
+	if f.Physician != "" {
+		lines = append(lines, "Attending physician: "+f.Physician)
+	}
+	if f.Diagnosis != "" {
+		lines = append(lines, wrap("Diagnosis: "+f.Diagnosis, claimLineWidth)...)
+	}
+
+	lines = append(lines, "", fmt.Sprintf("%-56s %5s %14s %14s", "Item", "Qty", "Unit price", "Amount"))
+	for _, item := range f.Items {
+		description := wrap(item.Description, 56)
+		lines = append(lines, fmt.Sprintf("%-56s %5d %14s %14s", description[0], item.Quantity, item.UnitPrice, item.Total))
+		lines = append(lines, description[1:]...)
+	}
+
+	lines = append(lines,
+		"",
+		fmt.Sprintf("%77s %14s", "Total:", f.SaleTotal),
+		fmt.Sprintf("%77s %14s", "Paid by member:", f.PatientShare),
+		fmt.Sprintf("%77s %14s", "Amount claimed:", f.ClaimedAmount),
+	)
+	if f.PreparedBy != "" {
+		lines = append(lines, "", "Prepared by: "+f.PreparedBy)
+	}
+	return lines
+}
+
+// RenderClaimPDF renders the claim form, continuing onto further pages
+// when the sale has many lines
+func RenderClaimPDF(form InsuranceClaimForm) []byte {
+	var pages []string
+	var b strings.Builder
+	y := 0
+
+	text := func(font string, size int, s string) {
+		fmt.Fprintf(&b, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, claimMargin, y, pdfEscape(s))
+	}
+	newPage := func() {
+		if b.Len() > 0 {
+			pages = append(pages, b.String())
+			b.Reset()
+		}
+		y = claimHeight - claimMargin - 14
+		text("F2", 16, "HMO Claim Statement of Account")
+		y -= 18
+		for _, line := range form.Pharmacy.Lines() {
+			text("F1", 9, line)
+			y -= 11
+		}
+		fmt.Fprintf(&b, "%d %d m %d %d l S\n", claimMargin, y+4, claimWidth-claimMargin, y+4)
+		y -= 14
+	}
+
+	newPage()
+	for _, line := range form.Lines() {
+		if y < claimMargin {
+			newPage()
+		}
+		// Courier keeps the item columns lined up
+		fmt.Fprintf(&b, "BT /F3 8 Tf %d %d Td (%s) Tj ET\n", claimMargin, y, pdfEscape(line))
+		y -= 11
+	}
+	pages = append(pages, b.String())
+
+	return writePDF(claimWidth, claimHeight, pages)
+}
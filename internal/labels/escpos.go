@@ -0,0 +1,66 @@
+package labels
+
+import (
+	"bytes"
+)
+
+const escposWidth = 42 // characters per line on 80mm paper
+
+var (
+	escInit        = []byte{0x1b, 0x40}
+	escBoldOn      = []byte{0x1b, 0x45, 0x01}
+	escBoldOff     = []byte{0x1b, 0x45, 0x00}
+	escAlignLeft   = []byte{0x1b, 0x61, 0x00}
+	escAlignCenter = []byte{0x1b, 0x61, 0x01}
+	escFeedCut     = []byte{0x1d, 0x56, 0x42, 0x03} // feed 3 lines and partial cut
+)
+
+// RenderESCPOS renders labels as an ESC/POS command stream for thermal
+// printers, cutting the paper after each label
+func RenderESCPOS(labels []Label) []byte {
+	var buf bytes.Buffer
+	buf.Write(escInit)
+
+	for _, label := range labels {
+		header := label.Header()
+
+		buf.Write(escAlignCenter)
+		buf.Write(escBoldOn)
+		writeLine(&buf, header[0])
+		buf.Write(escBoldOff)
+		for _, line := range header[1 : len(header)-1] {
+			writeLine(&buf, line)
+		}
+
+		buf.Write(escAlignLeft)
+		writeLine(&buf, header[len(header)-1])
+		writeLine(&buf, string(bytes.Repeat([]byte("-"), escposWidth)))
+
+		for i, line := range label.Lines() {
+			if i == 0 {
+				buf.Write(escBoldOn)
+			}
+			for _, wrapped := range wrap(line, escposWidth) {
+				writeLine(&buf, wrapped)
+			}
+			if i == 0 {
+				buf.Write(escBoldOff)
+			}
+		}
+
+		buf.Write(escFeedCut)
+	}
+
+	return buf.Bytes()
+}
+
+func writeLine(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		if r < 128 {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('?')
+		}
+	}
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,150 @@
+// Package labels renders dispensing labels for printing on label printers
+// (PDF) or thermal receipt printers (ESC/POS), and patient-facing
+// certificates such as vaccination records.
+package labels
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Pharmacy holds the dispensing pharmacy details printed on every label
+type Pharmacy struct {
+	Name          string
+	Address       string
+	Phone         string
+	LicenseNumber string // FDA License to Operate
+}
+
+// Label is one dispensing label for a single line item
+type Label struct {
+	Pharmacy Pharmacy
+
+	Reference   string // sale or order number
+	PatientName string
+	DrugName    string
+	GenericName string
+	Strength    string
+	Form        string
+	Quantity    int
+	Unit        string
+
+	Dosage       string
+	Instructions string
+	Duration     string
+
+	BatchNumber string
+	ExpiryDate  *time.Time
+	DispensedAt time.Time
+	Pharmacist  string
+
+	Prescription bool // prints the Rx-only notice
+
+	// A compounded preparation lists what it was made from, and its batch
+	// is a lot number kept until its beyond-use date rather than expiry
+	Compounded  bool
+	Ingredients []string
+}
+
+// Lines returns the label body as plain text lines, shared by every renderer
+func (l Label) Lines() []string {
+	var lines []string
+
+	drug := l.DrugName
+	if l.Strength != "" {
+		drug += " " + l.Strength
+	}
+	if l.Form != "" {
+		drug += " " + l.Form
+	}
+	lines = append(lines, drug)
+	if l.GenericName != "" && !strings.EqualFold(l.GenericName, l.DrugName) {
+		lines = append(lines, "("+l.GenericName+")")
+	}
+
+	if len(l.Ingredients) > 0 {
+		lines = append(lines, "Contains: "+strings.Join(l.Ingredients, ", "))
+	}
+
+	qty := fmt.Sprintf("Qty: %d", l.Quantity)
+	if l.Unit != "" {
+		qty += " " + l.Unit
+	}
+	lines = append(lines, qty)
+
+	if l.Dosage != "" {
+		lines = append(lines, "Dose: "+l.Dosage)
+	}
+	if l.Instructions != "" {
+		lines = append(lines, "Directions: "+l.Instructions)
+	}
+	if l.Duration != "" {
+		lines = append(lines, "Duration: "+l.Duration)
+	}
+
+	batch, expiry := "Batch: ", "   Exp: "
+	if l.Compounded {
+		batch, expiry = "Lot: ", "   Use by: "
+	}
+	batch += l.BatchNumber
+	if l.ExpiryDate != nil {
+		batch += expiry + l.ExpiryDate.Format("2006-01-02")
+	}
+	lines = append(lines, batch)
+
+	dispensed := "Dispensed: " + l.DispensedAt.Format("2006-01-02")
+	if l.Pharmacist != "" {
+		dispensed += " by " + l.Pharmacist
+	}
+	lines = append(lines, dispensed)
+
+	if l.Prescription {
+		lines = append(lines, "Rx only - dispense as prescribed")
+	}
+	return lines
+}
+
+// Header returns the pharmacy and patient lines printed above the body
+func (l Label) Header() []string {
+	return append(l.Pharmacy.Lines(), fmt.Sprintf("Patient: %s   Ref: %s", l.PatientName, l.Reference))
+}
+
+// Lines returns the pharmacy name, address and contact details
+func (p Pharmacy) Lines() []string {
+	lines := []string{p.Name}
+	if p.Address != "" {
+		lines = append(lines, p.Address)
+	}
+	contact := p.Phone
+	if p.LicenseNumber != "" {
+		if contact != "" {
+			contact += "  "
+		}
+		contact += "LTO: " + p.LicenseNumber
+	}
+	if contact != "" {
+		lines = append(lines, contact)
+	}
+	return lines
+}
+
+// wrap splits text into lines of at most width characters on word boundaries
+func wrap(text string, width int) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+
+	var lines []string
+	line := words[0]
+	for _, word := range words[1:] {
+		if len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = word
+			continue
+		}
+		line += " " + word
+	}
+	return append(lines, line)
+}
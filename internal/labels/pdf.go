@@ -0,0 +1,124 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Label stock is 4 x 3 inches
+const (
+	pageWidth  = 288
+	pageHeight = 216
+	margin     = 12
+	lineWidth  = 56 // characters per line at the body font size
+)
+
+// RenderPDF renders one label per page. It writes a minimal PDF using the
+// standard Helvetica fonts so no font files need to be embedded.
+func RenderPDF(labels []Label) []byte {
+	pages := make([]string, len(labels))
+	for i, label := range labels {
+		pages[i] = labelContent(label)
+	}
+	return writePDF(pageWidth, pageHeight, pages)
+}
+
+// writePDF assembles page content streams into a PDF document. Content
+// streams may use /F1 (Helvetica), /F2 (Helvetica-Bold) and /F3 (Courier).
+func writePDF(width, height int, pages []string) []byte {
+	var objects []string
+
+	// 1: catalog, 2: page tree, 3-5: fonts; pages and contents follow
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"", // page tree is filled in once the page objects are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+
+	var pageRefs []string
+	for _, content := range pages {
+		contentID := len(objects) + 2
+		pageID := len(objects) + 1
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+				width, height, contentID),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		)
+		pageRefs = append(pageRefs, fmt.Sprintf("%d 0 R", pageID))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageRefs, " "), len(pageRefs))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+func labelContent(label Label) string {
+	var b strings.Builder
+	y := pageHeight - margin - 8
+
+	text := func(font string, size, x int, s string) {
+		fmt.Fprintf(&b, "BT /%s %d Tf %d %d Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+	}
+
+	header := label.Header()
+	text("F2", 9, margin, header[0])
+	y -= 10
+	for _, line := range header[1:] {
+		text("F1", 7, margin, line)
+		y -= 9
+	}
+
+	y -= 2
+	fmt.Fprintf(&b, "%d %d m %d %d l S\n", margin, y+6, pageWidth-margin, y+6)
+	y -= 6
+
+	for i, line := range label.Lines() {
+		if i == 0 {
+			text("F2", 10, margin, line)
+			y -= 12
+			continue
+		}
+		for _, wrapped := range wrap(line, lineWidth) {
+			text("F1", 8, margin, wrapped)
+			y -= 10
+		}
+	}
+
+	return b.String()
+}
+
+// pdfEscape escapes a string for a PDF literal and maps it to WinAnsi
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 256:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PickList is what to take off the shelves for a batch of orders, walked
+// location by location
+type PickList struct {
+	GeneratedAt time.Time
+	Orders      []string // the order numbers it covers
+	Locations   []PickLocation
+}
+
+type PickLocation struct {
+	Name  string
+	Lines []PickLine
+}
+
+// PickLine is one product to pick at a location, the quantity still to
+// pick summed over the orders wanting it
+type PickLine struct {
+	Description string
+	SKU         string
+	BatchNumber string
+	ExpiryDate  *time.Time
+	Quantity    int
+	Orders      []string // e.g. "ORD-20240101-0001 x2"
+}
+
+// RenderPickListESCPOS renders a pick list as an ESC/POS command stream for
+// the receipt printer, with a box to tick beside each product
+func RenderPickListESCPOS(p PickList) []byte {
+	var buf bytes.Buffer
+	buf.Write(escInit)
+
+	buf.Write(escAlignCenter)
+	buf.Write(escBoldOn)
+	writeLine(&buf, "PICK LIST")
+	buf.Write(escBoldOff)
+	writeLine(&buf, p.GeneratedAt.Format("2006-01-02 15:04"))
+
+	buf.Write(escAlignLeft)
+	for _, line := range wrap("Orders: "+strings.Join(p.Orders, ", "), escposWidth) {
+		writeLine(&buf, line)
+	}
+
+	for _, location := range p.Locations {
+		writeLine(&buf, strings.Repeat("=", escposWidth))
+		buf.Write(escBoldOn)
+		writeLine(&buf, location.Name)
+		buf.Write(escBoldOff)
+
+		for _, line := range location.Lines {
+			writeLine(&buf, strings.Repeat("-", escposWidth))
+			for i, wrapped := range wrap(fmt.Sprintf("[ ] %d x %s", line.Quantity, line.Description), escposWidth) {
+				if i > 0 {
+					wrapped = "    " + wrapped
+				}
+				writeLine(&buf, wrapped)
+			}
+			detail := "    SKU: " + line.SKU
+			if line.BatchNumber != "" {
+				detail += "  Batch: " + line.BatchNumber
+			}
+			writeLine(&buf, detail)
+			if line.ExpiryDate != nil {
+				writeLine(&buf, "    Exp: "+line.ExpiryDate.Format("2006-01-02"))
+			}
+			for _, order := range line.Orders {
+				writeLine(&buf, "      "+order)
+			}
+		}
+	}
+
+	buf.Write(escFeedCut)
+	return buf.Bytes()
+}
@@ -0,0 +1,122 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// escDrawerKick pulses pin 2 of the printer's drawer port, which is where
+// cash drawers are wired
+var escDrawerKick = []byte{0x1b, 0x70, 0x00, 0x19, 0xfa}
+
+// Receipt is a sales receipt as printed on the till's receipt printer.
+// Amounts are already formatted, in the sale's currency.
+type Receipt struct {
+	Pharmacy Pharmacy
+
+	Reference     string // the invoice number, or the sale number without one
+	MachineID     string // the terminal's BIR machine identification number
+	SoldAt        time.Time
+	Cashier       string
+	Customer      string
+	PaymentMethod string
+
+	Lines    []ReceiptLine
+	Subtotal string
+	Discount string // empty when there was none
+	Tax      string
+	Total    string
+	Currency string
+
+	Footer string
+}
+
+// ReceiptLine is one item on a receipt
+type ReceiptLine struct {
+	Description string
+	Quantity    int
+	UnitPrice   string
+	Total       string
+}
+
+// RenderReceiptESCPOS renders a receipt as an ESC/POS command stream,
+// opening the cash drawer before the paper is cut when openDrawer is set
+func RenderReceiptESCPOS(r Receipt, openDrawer bool) []byte {
+	var buf bytes.Buffer
+	buf.Write(escInit)
+
+	buf.Write(escAlignCenter)
+	header := r.Pharmacy.Lines()
+	buf.Write(escBoldOn)
+	writeLine(&buf, header[0])
+	buf.Write(escBoldOff)
+	for _, line := range header[1:] {
+		writeLine(&buf, line)
+	}
+	if r.MachineID != "" {
+		writeLine(&buf, "MIN: "+r.MachineID)
+	}
+
+	buf.Write(escAlignLeft)
+	writeLine(&buf, strings.Repeat("-", escposWidth))
+	writeLine(&buf, "Invoice: "+r.Reference)
+	writeLine(&buf, "Date: "+r.SoldAt.Format("2006-01-02 15:04"))
+	if r.Cashier != "" {
+		writeLine(&buf, "Cashier: "+r.Cashier)
+	}
+	if r.Customer != "" {
+		writeLine(&buf, "Customer: "+r.Customer)
+	}
+	writeLine(&buf, strings.Repeat("-", escposWidth))
+
+	for _, line := range r.Lines {
+		for _, wrapped := range wrap(line.Description, escposWidth) {
+			writeLine(&buf, wrapped)
+		}
+		writeLine(&buf, columns(fmt.Sprintf("  %d x %s", line.Quantity, line.UnitPrice), line.Total))
+	}
+
+	writeLine(&buf, strings.Repeat("-", escposWidth))
+	writeLine(&buf, columns("Subtotal", r.Subtotal))
+	if r.Discount != "" {
+		writeLine(&buf, columns("Discount", "-"+r.Discount))
+	}
+	writeLine(&buf, columns("VAT", r.Tax))
+	buf.Write(escBoldOn)
+	writeLine(&buf, columns("TOTAL "+r.Currency, r.Total))
+	buf.Write(escBoldOff)
+	if r.PaymentMethod != "" {
+		writeLine(&buf, columns("Paid by", r.PaymentMethod))
+	}
+
+	if r.Footer != "" {
+		buf.Write(escAlignCenter)
+		writeLine(&buf, "")
+		for _, wrapped := range wrap(r.Footer, escposWidth) {
+			writeLine(&buf, wrapped)
+		}
+	}
+
+	if openDrawer {
+		buf.Write(escDrawerKick)
+	}
+	buf.Write(escFeedCut)
+	return buf.Bytes()
+}
+
+// RenderDrawerKick is the ESC/POS command stream that only opens the cash
+// drawer wired to a receipt printer
+func RenderDrawerKick() []byte {
+	return append(append([]byte{}, escInit...), escDrawerKick...)
+}
+
+// columns puts left and right at either end of a receipt line
+func columns(left, right string) string {
+	gap := escposWidth - len(left) - len(right)
+	if gap < 1 {
+		gap = 1
+	}
+	return left + strings.Repeat(" ", gap) + right
+}
@@ -0,0 +1,170 @@
+// Package lifecycle runs the server's background workers and shuts them
+// down in order: the workers are told to stop, given until a deadline to
+// finish the work they have started, and only then are the connections
+// they write through closed.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// abortGrace is how long workers get to return once their work has been
+// cancelled at the shutdown deadline
+const abortGrace = 5 * time.Second
+
+// Manager tracks the background workers and what to close after them
+type Manager struct {
+	logger *logrus.Logger
+
+	// stopping is cancelled when shutdown begins, the work context behind
+	// WorkContext by abort when the time to finish has run out
+	stopping context.Context
+	stop     context.CancelFunc
+	abort    context.CancelFunc
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]int
+	closers []closer
+}
+
+type closer struct {
+	name  string
+	close func() error
+}
+
+func New(logger *logrus.Logger) *Manager {
+	work, abort := context.WithCancel(context.Background())
+	stopping, stop := context.WithCancel(context.WithValue(context.Background(), workKey{}, work))
+	return &Manager{
+		logger:   logger,
+		stopping: stopping,
+		stop:     stop,
+		abort:    abort,
+		running:  make(map[string]int),
+	}
+}
+
+// Context is done once shutdown begins
+func (m *Manager) Context() context.Context {
+	return m.stopping
+}
+
+// Go runs worker in the background. Its ctx is done once shutdown begins;
+// work it has already started should run on WorkContext(ctx) so it gets
+// to finish.
+func (m *Manager) Go(name string, worker func(ctx context.Context)) {
+	m.mu.Lock()
+	m.running[name]++
+	m.mu.Unlock()
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer func() {
+			m.mu.Lock()
+			if m.running[name]--; m.running[name] == 0 {
+				delete(m.running, name)
+			}
+			m.mu.Unlock()
+		}()
+		worker(m.stopping)
+	}()
+}
+
+// OnStop has close run once the workers have stopped. Closers run in the
+// reverse order they were added, as deferred calls do.
+func (m *Manager) OnStop(name string, close func() error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Stop tells the workers to stop without waiting for them
+func (m *Manager) Stop() {
+	m.stop()
+}
+
+// Shutdown stops the workers and waits until they return or ctx is done.
+// Work still running then is cancelled, and its workers get a few more
+// seconds to return before the closers run regardless. It returns what the
+// closers failed with.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.stop()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		m.logger.WithField("workers", m.Running()).Warn("Background workers didn't finish in time, cancelling their work")
+		m.abort()
+		select {
+		case <-done:
+		case <-time.After(abortGrace):
+			m.logger.WithField("workers", m.Running()).Error("Background workers still running, closing connections under them")
+		}
+	}
+	m.abort()
+
+	m.mu.Lock()
+	closers := m.closers
+	m.closers = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", closers[i].name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Running returns the names of the workers that haven't returned, sorted
+func (m *Manager) Running() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.running))
+	for name := range m.running {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type workKey struct{}
+
+// WorkContext is the context for work a worker has started: it has ctx's
+// values, but isn't done when shutdown begins or the worker is otherwise
+// told to stop, only once the time to finish has run out. Outside a
+// Manager's workers it is ctx.
+func WorkContext(ctx context.Context) context.Context {
+	work, ok := ctx.Value(workKey{}).(context.Context)
+	if !ok {
+		return ctx
+	}
+	return workContext{Context: ctx, work: work}
+}
+
+// workContext takes its values from the worker's context and its
+// cancellation from the manager's work context
+type workContext struct {
+	context.Context
+	work context.Context
+}
+
+func (c workContext) Deadline() (time.Time, bool) { return c.work.Deadline() }
+func (c workContext) Done() <-chan struct{}       { return c.work.Done() }
+func (c workContext) Err() error                  { return c.work.Err() }
@@ -0,0 +1,249 @@
+package loadtest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// benchmarkProducts is how many products the scratch database is stocked
+// with. Each is stocked well past what a run can sell.
+const benchmarkProducts = 50
+
+var checkBudgets = flag.Bool("budget", false, "hold the benchmarks to their budgets in TestBenchmarkBudgets")
+
+// The scratch database and the services the benchmarks run, set up once
+// for all of them
+var (
+	envOnce sync.Once
+	env     *benchmarkEnv
+	errEnv  error
+)
+
+func TestMain(m *testing.M) {
+	// The services are set up from a development configuration, as the
+	// server's are
+	os.Setenv("ENV", "development")
+	for key, value := range map[string]string{
+		"JWT_SECRET":     "benchmark-jwt-secret-not-for-production",
+		"ENCRYPTION_KEY": "0123456789abcdef0123456789abcdef",
+	} {
+		if os.Getenv(key) == "" {
+			os.Setenv(key, value)
+		}
+	}
+	code := m.Run()
+	if env != nil {
+		env.close()
+	}
+	os.Exit(code)
+}
+
+// benchmarkBudgets are the most one operation of a benchmark may take and
+// allocate before it counts as a regression. They are set for a scratch
+// SQLite database on a developer machine, with room for slower CI runners;
+// a change that blows through them has made the path several times slower.
+var benchmarkBudgets = []struct {
+	name        string
+	benchmark   func(b *testing.B)
+	perOp       time.Duration
+	allocsPerOp int64
+}{
+	{"StockDeduction", BenchmarkStockDeduction, 5 * time.Millisecond, 700},
+	{"OrderCreation", BenchmarkOrderCreation, 25 * time.Millisecond, 6000},
+}
+
+// TestBenchmarkBudgets runs the benchmarks and fails when any is over its
+// budget. It only runs with -budget, as -race or a busy machine would blow
+// through the budgets.
+func TestBenchmarkBudgets(t *testing.T) {
+	if !*checkBudgets {
+		t.Skip("run with -budget to check the benchmarks against their budgets")
+	}
+	if _, err := loadBenchmarkEnv(); err != nil {
+		t.Fatal(err)
+	}
+	for _, budget := range benchmarkBudgets {
+		budget := budget
+		t.Run(budget.name, func(t *testing.T) {
+			result := testing.Benchmark(budget.benchmark)
+			if result.N == 0 {
+				t.Fatalf("the benchmark failed, run go test -bench %s for why", budget.name)
+			}
+			t.Logf("%s\t%s", result.String(), result.MemString())
+			if perOp := time.Duration(result.NsPerOp()); perOp > budget.perOp {
+				t.Errorf("%s per op over %s", perOp, budget.perOp)
+			}
+			if allocs := result.AllocsPerOp(); allocs > budget.allocsPerOp {
+				t.Errorf("%d allocs per op over %d", allocs, budget.allocsPerOp)
+			}
+		})
+	}
+}
+
+// BenchmarkStockDeduction takes one unit of a product out of stock in its
+// own transaction, as a sale line does
+func BenchmarkStockDeduction(b *testing.B) {
+	env := setupBenchmark(b)
+	for i := 0; i < b.N; i++ {
+		err := env.db.WithContext(env.ctx).Transaction(func(tx *gorm.DB) error {
+			_, err := env.stock.Apply(tx, services.StockChange{
+				ProductID: env.product(i),
+				Quantity:  -1,
+				Type:      models.MovementTypeOut,
+				Reason:    "Benchmark",
+			})
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkOrderCreation checks out a guest's cart of one product as a
+// pickup order
+func BenchmarkOrderCreation(b *testing.B) {
+	env := setupBenchmark(b)
+	name, email, phone := "Benchmark Guest", "bench@example.com", "09170000000"
+	for i := 0; i < b.N; i++ {
+		// Filling the cart isn't part of checking out
+		b.StopTimer()
+		session := uuid.NewString()
+		_, err := env.orders.AddToCart(env.ctx, services.AddToCartRequest{
+			SessionID: &session,
+			ProductID: env.product(i),
+			Quantity:  1,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		_, err = env.orders.CreateOrder(env.ctx, services.CreateOrderRequest{
+			SessionID:  &session,
+			GuestName:  &name,
+			GuestEmail: &email,
+			GuestPhone: &phone,
+			OrderType:  models.OrderTypePickup,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkEnv is a scratch SQLite database in a temporary directory,
+// migrated and stocked for the run, and the services the benchmarks run
+type benchmarkEnv struct {
+	ctx      context.Context
+	dir      string
+	db       *gorm.DB
+	stock    *services.StockService
+	orders   *services.OnlineOrderService
+	products []uuid.UUID
+}
+
+// setupBenchmark returns the benchmark environment, setting it up the
+// first time, and starts the benchmark's timer afresh
+func setupBenchmark(b *testing.B) *benchmarkEnv {
+	b.Helper()
+	env, err := loadBenchmarkEnv()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	return env
+}
+
+func loadBenchmarkEnv() (*benchmarkEnv, error) {
+	envOnce.Do(func() { env, errEnv = newBenchmarkEnv() })
+	return env, errEnv
+}
+
+func newBenchmarkEnv() (*benchmarkEnv, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	dir, err := os.MkdirTemp("", "pharmacy-bench-")
+	if err != nil {
+		return nil, err
+	}
+	db, err := gorm.Open(sqlite.Open(filepath.Join(dir, "bench.db")), &gorm.Config{
+		Logger:  gormlogger.Discard,
+		NowFunc: func() time.Time { return time.Now().UTC() },
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open the scratch database: %w", err)
+	}
+
+	communications := services.NewCommunicationService(db, services.DefaultNotifiers(), cfg.Notification)
+	outbox := services.NewOutboxService(db, communications, cfg.Outbox)
+	currencies := services.NewCurrencyService(db, cfg.Pharmacy.Currency)
+	taxes := services.NewTaxService(db, cfg.Pharmacy.TaxRate, currencies)
+	pricing := services.NewPricingService(db, taxes, currencies)
+	stock := services.NewStockService(db)
+	env := &benchmarkEnv{
+		ctx:   context.Background(),
+		dir:   dir,
+		db:    db,
+		stock: stock,
+		orders: services.NewOnlineOrderService(db, services.NewQRService(db), outbox, pricing, taxes,
+			currencies, stock, services.NewNumberService(db)),
+	}
+	if err := database.Migrate(db); err != nil {
+		env.close()
+		return nil, fmt.Errorf("failed to migrate the scratch database: %w", err)
+	}
+
+	for i := 0; i < benchmarkProducts; i++ {
+		product := models.Product{
+			Name:            fmt.Sprintf("Benchmark Product %d", i),
+			Category:        "Benchmark",
+			Manufacturer:    "Benchmark",
+			SKU:             fmt.Sprintf("BENCH-%04d", i),
+			Price:           models.NewMoney(100),
+			Cost:            models.NewMoney(60),
+			Stock:           1_000_000_000,
+			BatchNumber:     "BENCH",
+			ExpiryDate:      models.CustomDate{Time: time.Now().AddDate(2, 0, 0)},
+			ManufactureDate: models.CustomDate{Time: time.Now().AddDate(-1, 0, 0)},
+			IsActive:        true,
+		}
+		if err := db.Create(&product).Error; err != nil {
+			env.close()
+			return nil, fmt.Errorf("failed to stock the scratch database: %w", err)
+		}
+		env.products = append(env.products, product.ID)
+	}
+	return env, nil
+}
+
+func (e *benchmarkEnv) product(i int) uuid.UUID {
+	return e.products[i%len(e.products)]
+}
+
+func (e *benchmarkEnv) close() {
+	if sqlDB, err := e.db.DB(); err == nil {
+		sqlDB.Close()
+	}
+	os.RemoveAll(e.dir)
+}
@@ -0,0 +1,132 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client makes a scenario's requests and records what each one took
+type Client struct {
+	baseURL  string
+	token    string
+	http     *http.Client
+	recorder *recorder
+}
+
+// newClient is a client for the API at baseURL, e.g.
+// http://localhost:8080/api/v1. Requests are made with token when it is
+// set, and recorded with recorder.
+func newClient(baseURL, token string, recorder *recorder) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// Every worker keeps its connection rather than opening a new one per
+	// request, as the tills and browsers do
+	transport.MaxIdleConnsPerHost = 1024
+	return &Client{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		token:    token,
+		http:     &http.Client{Transport: transport, Timeout: 2 * time.Minute},
+		recorder: recorder,
+	}
+}
+
+// Request is one request of a scenario. Name is what it is recorded as,
+// e.g. "POST /sales", so requests to different IDs are counted together.
+type Request struct {
+	Name   string
+	Method string
+	Path   string
+	Header http.Header
+	Body   interface{}
+	// Anonymous leaves the client's token out, e.g. for a guest checkout
+	Anonymous bool
+}
+
+// StatusError is a response outside 2xx
+type StatusError struct {
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.Status, e.Body)
+}
+
+// Do makes req and decodes a JSON response into out, when given
+func (c *Client) Do(ctx context.Context, req Request, out interface{}) error {
+	var body io.Reader
+	if req.Body != nil {
+		data, err := json.Marshal(req.Body)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, c.baseURL+req.Path, body)
+	if err != nil {
+		return err
+	}
+	for key, values := range req.Header {
+		httpReq.Header[key] = values
+	}
+	if req.Body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" && !req.Anonymous {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	started := time.Now()
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		// A request cut off by stopping the run says nothing about the
+		// server
+		if ctx.Err() == nil {
+			c.recorder.record(req.Name, time.Since(started), outcomeError, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	elapsed := time.Since(started)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.recorder.record(req.Name, elapsed, outcomeError, err)
+		}
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr := &StatusError{Status: resp.StatusCode, Body: truncate(string(data), 200)}
+		switch resp.StatusCode {
+		case http.StatusConflict:
+			c.recorder.record(req.Name, elapsed, outcomeConflict, statusErr)
+		case http.StatusTooManyRequests:
+			c.recorder.record(req.Name, elapsed, outcomeThrottled, statusErr)
+		default:
+			c.recorder.record(req.Name, elapsed, outcomeError, statusErr)
+		}
+		return statusErr
+	}
+	c.recorder.record(req.Name, elapsed, outcomeOK, nil)
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", req.Name, err)
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,239 @@
+// Package loadtest drives the API with the traffic of a busy day, e.g. a
+// checkout storm or a rush at the tills, and checks the latencies it sees
+// against a performance budget. Scenarios run against a server and the
+// seeded database behind it, driven by cmd/loadtest; the package's
+// benchmarks run the hot paths in process against a scratch database of
+// their own.
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownScenario = errors.New("unknown scenario")
+	ErrOverBudget      = errors.New("over the performance budget")
+)
+
+// Scenario is one kind of traffic. Setup runs once before the workers
+// start, e.g. to pick the products to sell; Step is one iteration of a
+// worker, usually a few requests in a row.
+type Scenario struct {
+	Name        string
+	Description string
+	Budget      Budget
+	Setup       func(ctx context.Context, client *Client) error
+	Step        func(ctx context.Context, client *Client, worker int) error
+}
+
+// Budget is how slow and how unreliable a scenario's requests may be. Each
+// request the scenario makes is held to it on its own.
+type Budget struct {
+	P95       Duration `json:"p95"`
+	P99       Duration `json:"p99"`
+	ErrorRate float64  `json:"error_rate"`
+}
+
+// Duration is a time.Duration written out as text, e.g. "12.5ms"
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Options say where and how hard to run a scenario
+type Options struct {
+	BaseURL     string
+	Token       string
+	Concurrency int
+	Duration    time.Duration
+}
+
+// Run runs scenario with opts.Concurrency workers for opts.Duration and
+// reports what each request it made took. A worker whose step fails goes on
+// with the next one, the failure is counted against the request that failed.
+func Run(ctx context.Context, scenario Scenario, opts Options) (*Result, error) {
+	if opts.Concurrency <= 0 {
+		return nil, fmt.Errorf("concurrency must be positive")
+	}
+	recorder := newRecorder()
+	client := newClient(opts.BaseURL, opts.Token, recorder)
+
+	if scenario.Setup != nil {
+		if err := scenario.Setup(ctx, client); err != nil {
+			return nil, fmt.Errorf("failed to set up %s: %w", scenario.Name, err)
+		}
+		recorder.reset()
+	}
+
+	// Workers stop starting steps at the deadline but finish the one they
+	// are in, so the slowest requests are still counted
+	started := time.Now()
+	deadline := started.Add(opts.Duration)
+	var wg sync.WaitGroup
+	for worker := 0; worker < opts.Concurrency; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for ctx.Err() == nil && time.Now().Before(deadline) {
+				scenario.Step(ctx, client, worker)
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	return recorder.result(scenario, opts, time.Since(started)), nil
+}
+
+// Result is what a run saw, per request
+type Result struct {
+	Scenario    string           `json:"scenario"`
+	Concurrency int              `json:"concurrency"`
+	Elapsed     Duration         `json:"elapsed"`
+	Budget      Budget           `json:"budget"`
+	Requests    []RequestSummary `json:"requests"`
+	Violations  []string         `json:"violations,omitempty"`
+}
+
+// RequestSummary is the latencies and outcomes of one request of a
+// scenario. Conflicts, e.g. a product selling out mid-storm, and requests
+// turned away by the rate limiter are expected under load and aren't
+// errors.
+type RequestSummary struct {
+	Name      string   `json:"name"`
+	Count     int      `json:"count"`
+	Errors    int      `json:"errors"`
+	Conflicts int      `json:"conflicts"`
+	Throttled int      `json:"throttled"`
+	PerSecond float64  `json:"per_second"`
+	P50       Duration `json:"p50"`
+	P95       Duration `json:"p95"`
+	P99       Duration `json:"p99"`
+	Max       Duration `json:"max"`
+	ErrorRate float64  `json:"error_rate"`
+	LastError string   `json:"last_error,omitempty"`
+	latencies []time.Duration
+	lastErr   error
+}
+
+// Check holds every request of the result to its budget. It returns
+// ErrOverBudget, with the violations recorded on the result, when any is
+// over.
+func (r *Result) Check() error {
+	r.Violations = nil
+	for _, request := range r.Requests {
+		if r.Budget.P95 > 0 && request.P95 > r.Budget.P95 {
+			r.Violations = append(r.Violations, fmt.Sprintf("%s p95 %s over %s", request.Name, request.P95, r.Budget.P95))
+		}
+		if r.Budget.P99 > 0 && request.P99 > r.Budget.P99 {
+			r.Violations = append(r.Violations, fmt.Sprintf("%s p99 %s over %s", request.Name, request.P99, r.Budget.P99))
+		}
+		if request.ErrorRate > r.Budget.ErrorRate {
+			r.Violations = append(r.Violations, fmt.Sprintf("%s error rate %.2f%% over %.2f%%", request.Name, request.ErrorRate*100, r.Budget.ErrorRate*100))
+		}
+	}
+	if len(r.Violations) > 0 {
+		return fmt.Errorf("%w: %d violations", ErrOverBudget, len(r.Violations))
+	}
+	return nil
+}
+
+// Private helper methods
+
+// outcome is how a request ended, apart from how long it took
+type outcome int
+
+const (
+	outcomeOK outcome = iota
+	outcomeError
+	outcomeConflict
+	outcomeThrottled
+)
+
+// recorder collects the requests made by every worker of a run
+type recorder struct {
+	mu       sync.Mutex
+	requests map[string]*RequestSummary
+}
+
+func newRecorder() *recorder {
+	return &recorder{requests: make(map[string]*RequestSummary)}
+}
+
+func (r *recorder) record(name string, elapsed time.Duration, result outcome, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	request, ok := r.requests[name]
+	if !ok {
+		request = &RequestSummary{Name: name}
+		r.requests[name] = request
+	}
+	request.Count++
+	request.latencies = append(request.latencies, elapsed)
+	switch result {
+	case outcomeError:
+		request.Errors++
+		request.lastErr = err
+	case outcomeConflict:
+		request.Conflicts++
+	case outcomeThrottled:
+		request.Throttled++
+	}
+}
+
+func (r *recorder) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = make(map[string]*RequestSummary)
+}
+
+func (r *recorder) result(scenario Scenario, opts Options, elapsed time.Duration) *Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := &Result{
+		Scenario:    scenario.Name,
+		Concurrency: opts.Concurrency,
+		Elapsed:     Duration(elapsed),
+		Budget:      scenario.Budget,
+	}
+	for _, request := range r.requests {
+		sort.Slice(request.latencies, func(i, j int) bool { return request.latencies[i] < request.latencies[j] })
+		request.P50 = Duration(percentile(request.latencies, 0.50))
+		request.P95 = Duration(percentile(request.latencies, 0.95))
+		request.P99 = Duration(percentile(request.latencies, 0.99))
+		request.Max = Duration(request.latencies[len(request.latencies)-1])
+		request.PerSecond = float64(request.Count) / elapsed.Seconds()
+		request.ErrorRate = float64(request.Errors) / float64(request.Count)
+		if request.lastErr != nil {
+			request.LastError = request.lastErr.Error()
+		}
+		result.Requests = append(result.Requests, *request)
+	}
+	sort.Slice(result.Requests, func(i, j int) bool { return result.Requests[i].Name < result.Requests[j].Name })
+	return result
+}
+
+// percentile is the latency below which p of the sorted latencies fall
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
@@ -0,0 +1,192 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scenarios are the kinds of traffic the load test can drive, by name
+var Scenarios = map[string]Scenario{
+	"checkout-storm":    checkoutStorm(),
+	"pos-rush":          posRush(),
+	"analytics-refresh": analyticsRefresh(),
+}
+
+// ScenarioNames are the names of Scenarios, sorted
+func ScenarioNames() []string {
+	names := make([]string, 0, len(Scenarios))
+	for name := range Scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkoutStorm is a sale day on the online shop: guests each put a product
+// in a cart and check out for pickup at once. The products are the ones
+// the shop lists that don't need a prescription.
+func checkoutStorm() Scenario {
+	catalogue := &catalogue{}
+	return Scenario{
+		Name:        "checkout-storm",
+		Description: "Guests add a product to their cart and place a pickup order",
+		Budget:      Budget{P95: Duration(time.Second), P99: Duration(2 * time.Second), ErrorRate: 0.01},
+		Setup:       catalogue.load,
+		Step: func(ctx context.Context, client *Client, worker int) error {
+			product := catalogue.pick()
+			session := http.Header{"X-Session-ID": {"loadtest-" + uuid.NewString()}}
+
+			err := client.Do(ctx, Request{
+				Name:      "POST /cart/add",
+				Method:    http.MethodPost,
+				Path:      "/cart/add",
+				Header:    session,
+				Body:      map[string]interface{}{"product_id": product.ID, "quantity": 1},
+				Anonymous: true,
+			}, nil)
+			if err != nil {
+				return err
+			}
+
+			header := session.Clone()
+			header.Set("Idempotency-Key", uuid.NewString())
+			return client.Do(ctx, Request{
+				Name:   "POST /orders",
+				Method: http.MethodPost,
+				Path:   "/orders",
+				Header: header,
+				Body: map[string]interface{}{
+					"order_type":  "pickup",
+					"guest_name":  fmt.Sprintf("Load Test %d", worker),
+					"guest_email": fmt.Sprintf("loadtest+%d@example.com", worker),
+					"guest_phone": "09170000000",
+				},
+				Anonymous: true,
+			}, nil)
+		},
+	}
+}
+
+// posRush is the queue at the tills: cash sales of one to three over the
+// counter products, rung up as fast as the tills can take them. It needs a
+// token with sales:create.
+func posRush() Scenario {
+	catalogue := &catalogue{}
+	return Scenario{
+		Name:        "pos-rush",
+		Description: "Staff ring up cash sales of over the counter products",
+		Budget:      Budget{P95: Duration(500 * time.Millisecond), P99: Duration(time.Second), ErrorRate: 0.01},
+		Setup:       catalogue.load,
+		Step: func(ctx context.Context, client *Client, worker int) error {
+			var items []map[string]interface{}
+			var total float64
+			for _, product := range catalogue.pickDistinct(1 + rand.Intn(3)) {
+				items = append(items, map[string]interface{}{
+					"item_type":   "product",
+					"product_id":  product.ID,
+					"quantity":    1,
+					"unit_price":  product.Price,
+					"total_price": product.Price,
+				})
+				total += product.Price
+			}
+
+			return client.Do(ctx, Request{
+				Name:   "POST /sales",
+				Method: http.MethodPost,
+				Path:   "/sales",
+				Header: http.Header{"Idempotency-Key": {uuid.NewString()}},
+				Body: map[string]interface{}{
+					"payment_method": "cash",
+					"subtotal":       total,
+					"total":          total,
+					"sale_items":     items,
+				},
+			}, nil)
+		},
+	}
+}
+
+// analyticsRefresh is managers keeping the dashboards open at the end of
+// the month: every step loads the dashboard and the reports behind it. It
+// needs a token with analytics and head office access.
+func analyticsRefresh() Scenario {
+	reports := []string{"/analytics/dashboard", "/analytics/sales", "/analytics/discounts", "/head-office/sales", "/head-office/stock"}
+	return Scenario{
+		Name:        "analytics-refresh",
+		Description: "Managers reload the dashboard, the sales and discount analytics and the branch rollups",
+		Budget:      Budget{P95: Duration(3 * time.Second), P99: Duration(5 * time.Second), ErrorRate: 0.01},
+		Step: func(ctx context.Context, client *Client, worker int) error {
+			for _, path := range reports {
+				err := client.Do(ctx, Request{Name: "GET " + path, Method: http.MethodGet, Path: path}, nil)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Private helper methods
+
+// catalogueProduct is a product as the scenarios need it
+type catalogueProduct struct {
+	ID                   uuid.UUID `json:"id"`
+	Price                float64   `json:"price"`
+	Stock                int       `json:"stock"`
+	PrescriptionRequired bool      `json:"prescription_required"`
+}
+
+// catalogue is the products a scenario sells, read once in its setup
+type catalogue struct {
+	products []catalogueProduct
+}
+
+// load reads the products in stock that can be sold without a prescription
+func (c *catalogue) load(ctx context.Context, client *Client) error {
+	c.products = nil
+	var page struct {
+		Products []catalogueProduct `json:"products"`
+	}
+	err := client.Do(ctx, Request{
+		Name:      "GET /products/browse",
+		Method:    http.MethodGet,
+		Path:      "/products/browse?limit=200",
+		Anonymous: true,
+	}, &page)
+	if err != nil {
+		return err
+	}
+	for _, product := range page.Products {
+		if product.Stock > 0 && !product.PrescriptionRequired {
+			c.products = append(c.products, product)
+		}
+	}
+	if len(c.products) == 0 {
+		return fmt.Errorf("no products in stock without a prescription, seed the database first")
+	}
+	return nil
+}
+
+func (c *catalogue) pick() catalogueProduct {
+	return c.products[rand.Intn(len(c.products))]
+}
+
+// pickDistinct picks up to n different products
+func (c *catalogue) pickDistinct(n int) []catalogueProduct {
+	if n > len(c.products) {
+		n = len(c.products)
+	}
+	picked := make([]catalogueProduct, 0, n)
+	for _, i := range rand.Perm(len(c.products))[:n] {
+		picked = append(picked, c.products[i])
+	}
+	return picked
+}
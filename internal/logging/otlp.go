@@ -0,0 +1,235 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	otlpBatchSize     = 256
+	otlpFlushInterval = 2 * time.Second
+	otlpQueueSize     = 4096
+	otlpServiceName   = "pharmacy-backend"
+)
+
+// otlpHook exports entries to an OpenTelemetry collector over OTLP/HTTP with
+// JSON encoding, in batches sent from the background. Entries logged while
+// the queue is full are dropped, so a slow collector never holds up requests.
+type otlpHook struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+
+	mu      sync.RWMutex
+	closed  bool
+	records chan otlpLogRecord
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+func newOTLPHook(endpoint string, headers map[string]string) *otlpHook {
+	h := &otlpHook{
+		endpoint: endpoint,
+		headers:  headers,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		records:  make(chan otlpLogRecord, otlpQueueSize),
+		done:     make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *otlpHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *otlpHook) Fire(entry *logrus.Entry) error {
+	record := newOTLPLogRecord(entry)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.closed {
+		return nil
+	}
+	select {
+	case h.records <- record:
+	default:
+		h.dropped.Add(1)
+	}
+	return nil
+}
+
+// Close sends the entries still queued and stops the exporter
+func (h *otlpHook) Close() error {
+	h.mu.Lock()
+	if !h.closed {
+		h.closed = true
+		close(h.records)
+	}
+	h.mu.Unlock()
+	<-h.done
+	return nil
+}
+
+// Private helper methods
+
+func (h *otlpHook) run() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]otlpLogRecord, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			h.export(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case record, ok := <-h.records:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// export sends a batch, reporting failures on stderr as logging them would
+// queue more entries for the same collector
+func (h *otlpHook) export(records []otlpLogRecord) {
+	if dropped := h.dropped.Swap(0); dropped > 0 {
+		fmt.Fprintf(os.Stderr, "OTLP log export queue was full, dropped %d entries\n", dropped)
+	}
+
+	body, err := json.Marshal(otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource: otlpResource{Attributes: []otlpAttribute{stringAttribute("service.name", otlpServiceName)}},
+		ScopeLogs: []otlpScopeLogs{{
+			Scope:      otlpScope{Name: otlpServiceName},
+			LogRecords: records,
+		}},
+	}}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to encode OTLP logs: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.client.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.endpoint, bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export OTLP logs: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range h.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to export %d log entries over OTLP: %v\n", len(records), err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		fmt.Fprintf(os.Stderr, "failed to export %d log entries over OTLP: collector returned %s\n",
+			len(records), resp.Status)
+	}
+}
+
+// OTLP/HTTP JSON types, as in opentelemetry-proto's logs.proto
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string          `json:"timeUnixNano"`
+	SeverityNumber int             `json:"severityNumber"`
+	SeverityText   string          `json:"severityText"`
+	Body           otlpValue       `json:"body"`
+	Attributes     []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func stringAttribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+// otlpSeverities maps levels to OTLP severity numbers
+var otlpSeverities = map[logrus.Level]int{
+	logrus.TraceLevel: 1,
+	logrus.DebugLevel: 5,
+	logrus.InfoLevel:  9,
+	logrus.WarnLevel:  13,
+	logrus.ErrorLevel: 17,
+	logrus.FatalLevel: 21,
+	logrus.PanicLevel: 21,
+}
+
+func newOTLPLogRecord(entry *logrus.Entry) otlpLogRecord {
+	record := otlpLogRecord{
+		TimeUnixNano:   strconv.FormatInt(entry.Time.UnixNano(), 10),
+		SeverityNumber: otlpSeverities[entry.Level],
+		SeverityText:   entry.Level.String(),
+		Body:           otlpValue{StringValue: entry.Message},
+	}
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		record.Attributes = append(record.Attributes, stringAttribute(key, fmt.Sprint(value)))
+	}
+	sort.Slice(record.Attributes, func(i, j int) bool {
+		return record.Attributes[i].Key < record.Attributes[j].Key
+	})
+	return record
+}
@@ -0,0 +1,60 @@
+//go:build !windows
+
+package logging
+
+import (
+	"log/syslog"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogHook sends entries to syslog at the matching severity
+type syslogHook struct {
+	writer *syslog.Writer
+}
+
+// newSyslogHook connects to the local syslog for "local", otherwise to an
+// address such as udp://logs.example.com:514
+func newSyslogHook(address string) (*syslogHook, error) {
+	var network, raddr string
+	if address != "local" {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, err
+		}
+		network, raddr = u.Scheme, u.Host
+	}
+	writer, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, "pharmacy-backend")
+	if err != nil {
+		return nil, err
+	}
+	return &syslogHook{writer: writer}, nil
+}
+
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	switch entry.Level {
+	case logrus.PanicLevel, logrus.FatalLevel:
+		return h.writer.Crit(line)
+	case logrus.ErrorLevel:
+		return h.writer.Err(line)
+	case logrus.WarnLevel:
+		return h.writer.Warning(line)
+	case logrus.InfoLevel:
+		return h.writer.Info(line)
+	default:
+		return h.writer.Debug(line)
+	}
+}
+
+func (h *syslogHook) Close() error {
+	return h.writer.Close()
+}
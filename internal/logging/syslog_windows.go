@@ -0,0 +1,20 @@
+//go:build windows
+
+package logging
+
+import (
+	"errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syslogHook isn't available on Windows, where LOG_SYSLOG fails at startup
+type syslogHook struct{}
+
+func newSyslogHook(address string) (*syslogHook, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (h *syslogHook) Levels() []logrus.Level         { return nil }
+func (h *syslogHook) Fire(entry *logrus.Entry) error { return nil }
+func (h *syslogHook) Close() error                   { return nil }
@@ -0,0 +1,51 @@
+package metrics
+
+// The server's metrics. Gauges read from the database, Redis and queues are
+// set when /metrics is scraped.
+var (
+	HTTPRequestDuration = NewHistogram("pharmacy_http_request_duration_seconds",
+		"HTTP request latency by method, route and status", nil, "method", "route", "status")
+
+	RequestTimeouts = NewCounter("pharmacy_http_request_timeouts_total",
+		"Requests that ran out of time before answering, by route class", "class")
+
+	RateLimitRejections = NewCounter("pharmacy_rate_limit_rejections_total",
+		"Requests turned away by rate limiting, by limit tier", "tier")
+
+	SalesCreated = NewCounter("pharmacy_sales_total",
+		"POS sales made, by payment method", "payment_method")
+	OrdersCreated = NewCounter("pharmacy_orders_total",
+		"Online orders placed, by order type", "order_type")
+
+	DBUp = NewGauge("pharmacy_db_up",
+		"Whether the database answers, by database", "database")
+	DBOpenConnections = NewGauge("pharmacy_db_open_connections",
+		"Connections open to the database, in use or idle", "database")
+	DBInUseConnections = NewGauge("pharmacy_db_in_use_connections",
+		"Connections in use", "database")
+	DBIdleConnections = NewGauge("pharmacy_db_idle_connections",
+		"Idle connections", "database")
+	DBWaitCount = NewGauge("pharmacy_db_wait_count",
+		"Connections waited for since the server started", "database")
+	DBWaitSeconds = NewGauge("pharmacy_db_wait_seconds",
+		"Time spent waiting for connections since the server started", "database")
+	DBQueryDuration = NewHistogram("pharmacy_db_query_duration_seconds",
+		"Database statement latency by operation", nil, "operation")
+	DBSlowQueries = NewCounter("pharmacy_db_slow_queries_total",
+		"Statements slower than DB_SLOW_QUERY_MS, by operation and table", "operation", "table")
+	DBLastSync = NewGauge("pharmacy_db_last_sync_timestamp_seconds",
+		"When the databases last synced, as a Unix time")
+
+	RedisUp = NewGauge("pharmacy_redis_up",
+		"Whether Redis answers")
+
+	CacheRequests = NewCounter("pharmacy_cache_requests_total",
+		"Cached responses looked up, by cache namespace and hit or miss", "namespace", "result")
+	CacheInvalidations = NewCounter("pharmacy_cache_invalidations_total",
+		"Times a cache namespace was dropped after a change", "namespace")
+
+	QueueDepth = NewGauge("pharmacy_queue_depth",
+		"Messages or jobs waiting, by queue", "queue")
+	QueueFailed = NewGauge("pharmacy_queue_failed",
+		"Messages or jobs given up on after the maximum attempts, by queue", "queue")
+)
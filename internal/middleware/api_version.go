@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// API versions are served side by side under /api/<version>. Breaking
+// changes to response shapes ship in the newest version only, so existing
+// POS clients keep working on the one they were built against.
+const (
+	APIVersionKey = "api_version"
+
+	APIVersion1       = "v1"
+	APIVersion2       = "v2"
+	CurrentAPIVersion = APIVersion2
+)
+
+// APIVersions are the versions served, oldest first
+var APIVersions = []string{APIVersion1, APIVersion2}
+
+// APIVersionOf returns the API version the request was made to, v1 for
+// requests outside /api
+func APIVersionOf(c *gin.Context) string {
+	if version := c.GetString(APIVersionKey); version != "" {
+		return version
+	}
+	return APIVersion1
+}
+
+// APIVersioning reads the version from the request path and shapes the
+// response for it. Every version gets an API-Version header. v1 responses
+// are marked deprecated with the successor version and, when
+// API_V1_SUNSET is set, the date v1 goes away. v2 responses are wrapped:
+//
+//	{"data": <the handler's body>}
+//	{"error": {"code": "not_found", "message": "<localized text>",
+//	           "detail": "Customer not found", "request_id": "..."}}
+//
+// It goes after ErrorEnvelope so that v2 errors, from middleware as well as
+// handlers, are wrapped here rather than flattened there.
+func (m *SecurityMiddleware) APIVersioning() gin.HandlerFunc {
+	var sunset string
+	if date, err := time.Parse("2006-01-02", m.config.Server.V1Sunset); err == nil {
+		sunset = date.UTC().Format(http.TimeFormat)
+	}
+
+	return func(c *gin.Context) {
+		version := versionFromPath(c.Request.URL.Path)
+		switch version {
+		case APIVersion1:
+			c.Header("Deprecation", "true")
+			c.Header("Link", "</api/"+CurrentAPIVersion+">; rel=\"successor-version\"")
+			if sunset != "" {
+				c.Header("Sunset", sunset)
+			}
+		case APIVersion2:
+			writer := &versionEnvelopeWriter{ResponseWriter: c.Writer, context: c}
+			c.Writer = writer
+			defer writer.flush()
+		default:
+			c.Next()
+			return
+		}
+
+		c.Set(APIVersionKey, version)
+		c.Header("API-Version", version)
+		c.Next()
+	}
+}
+
+// versionFromPath returns the version segment of an /api/<version>/ path,
+// or "" for other paths
+func versionFromPath(path string) string {
+	rest, found := strings.CutPrefix(path, "/api/")
+	if !found {
+		return ""
+	}
+	version, _, _ := strings.Cut(rest, "/")
+	return version
+}
+
+// versionEnvelopeWriter holds back JSON bodies until the handler is done,
+// to wrap them in the v2 envelope, and passes everything else straight
+// through
+type versionEnvelopeWriter struct {
+	gin.ResponseWriter
+	context  *gin.Context
+	decided  bool
+	envelope bool
+	body     bytes.Buffer
+}
+
+func (w *versionEnvelopeWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.envelope = strings.Contains(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *versionEnvelopeWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.envelope {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *versionEnvelopeWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.envelope {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *versionEnvelopeWriter) WriteHeaderNow() {
+	w.decide()
+	if !w.envelope {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *versionEnvelopeWriter) Flush() {
+	if !w.envelope {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (w *versionEnvelopeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush writes the held back body in the envelope. Bodies that aren't
+// valid JSON are sent as they were.
+func (w *versionEnvelopeWriter) flush() {
+	if !w.envelope {
+		return
+	}
+
+	var body interface{}
+	decoder := json.NewDecoder(bytes.NewReader(w.body.Bytes()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+
+	var envelope gin.H
+	if w.Status() < http.StatusBadRequest {
+		envelope = gin.H{"data": body}
+	} else {
+		envelope = gin.H{"error": errorObject(w.context, w.Status(), body)}
+	}
+	encoded, err := json.Marshal(envelope)
+	if err != nil {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	w.ResponseWriter.Write(encoded)
+}
+
+// errorObject is the v2 error for a handler's error body. The handler's
+// error text becomes detail and its other fields are kept.
+func errorObject(c *gin.Context, status int, body interface{}) map[string]interface{} {
+	fields, ok := body.(map[string]interface{})
+	if !ok {
+		fields = make(map[string]interface{})
+		if body != nil {
+			fields["detail"] = body
+		}
+	} else if detail, ok := fields["error"]; ok {
+		delete(fields, "error")
+		fields["detail"] = detail
+	}
+	addErrorFields(c, status, fields)
+	return fields
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+
+	"pharmacy-backend/internal/database"
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// BranchHeader picks the branch an admin, or a user without a branch,
+	// works in. Without it they work across all branches.
+	BranchHeader = "X-Branch-ID"
+
+	BranchContextKey = "branch_id"
+)
+
+// scopeToBranch limits the request to the user's branch, or to the branch
+// an admin picked with X-Branch-ID. Staff can't pick another branch than
+// their own. It reports false when the request was rejected.
+func (m *SecurityMiddleware) scopeToBranch(c *gin.Context, user *models.User) bool {
+	branchID := user.BranchID
+
+	if header := c.GetHeader(BranchHeader); header != "" {
+		requested, err := uuid.Parse(header)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid " + BranchHeader})
+			return false
+		}
+
+		switch {
+		case branchID != nil && *branchID != requested && user.Role != models.RoleAdmin:
+			m.auditLog(c, "branch_access_denied", "branches", user.ID.String(), false,
+				"User "+user.Username+" attempted to access branch "+requested.String())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You can only access your own branch"})
+			return false
+		case branchID == nil || *branchID != requested:
+			var branch models.Branch
+			if err := m.db.Select("id").First(&branch, "id = ?", requested).Error; err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Unknown branch in " + BranchHeader})
+				return false
+			}
+		}
+		branchID = &requested
+	} else if user.Role == models.RoleAdmin {
+		// Admins work across branches unless they pick one
+		branchID = nil
+	}
+
+	if branchID != nil {
+		c.Set(BranchContextKey, *branchID)
+		c.Request = c.Request.WithContext(database.WithBranch(c.Request.Context(), *branchID))
+	}
+	return true
+}
+
+// HeadOfficeOnly lets admins, and managers who work at the head office or
+// across branches, through to reports that span every branch. The request
+// is no longer limited to the caller's branch.
+func (m *SecurityMiddleware) HeadOfficeOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := GetCurrentUser(c)
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		allowed := user.Role == models.RoleAdmin
+		if user.Role == models.RoleManager {
+			allowed = user.BranchID == nil
+			if !allowed {
+				var branch models.Branch
+				err := m.db.Select("is_head_office").First(&branch, "id = ?", *user.BranchID).Error
+				allowed = err == nil && branch.IsHeadOffice
+			}
+		}
+		if !allowed {
+			m.auditLog(c, "head_office_access_denied", "branches", user.ID.String(), false,
+				"User "+user.Username+" attempted head office access")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Head office manager or admin access required"})
+			return
+		}
+
+		c.Set(BranchContextKey, nil)
+		c.Request = c.Request.WithContext(database.AcrossBranches(c.Request.Context()))
+		c.Next()
+	}
+}
+
+// GetBranchID returns the branch the request is limited to, or nil when it
+// works across branches
+func GetBranchID(c *gin.Context) *uuid.UUID {
+	value, _ := c.Get(BranchContextKey)
+	branchID, ok := value.(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	return &branchID
+}
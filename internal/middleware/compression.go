@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Compress gzips responses for clients that accept it. A body is held back
+// until it reaches the configured minimum size, and smaller ones are sent
+// as they are, since compressing them costs more than it saves. Only text
+// types are compressed, never event streams, and a response that is
+// flushed before reaching the minimum, like an export, is compressed from
+// then on and still streamed.
+func (m *SecurityMiddleware) Compress() gin.HandlerFunc {
+	if !m.config.Server.CompressionEnabled {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	level := m.config.Server.CompressionLevel
+	minSize := m.config.Server.CompressionMinSize
+	writers := &sync.Pool{New: func() interface{} {
+		writer, err := gzip.NewWriterLevel(io.Discard, level)
+		if err != nil {
+			writer = gzip.NewWriter(io.Discard)
+		}
+		return writer
+	}}
+
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodHead || !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+		writer := &gzipResponseWriter{ResponseWriter: c.Writer, writers: writers, minSize: minSize}
+		c.Writer = writer
+		c.Next()
+		writer.close()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// compressible reports whether a response with these headers and status is
+// worth compressing
+func compressible(header http.Header, status int) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := strings.ToLower(header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		return false
+	case strings.HasPrefix(contentType, "text/"),
+		strings.Contains(contentType, "json"),
+		strings.Contains(contentType, "xml"),
+		strings.Contains(contentType, "javascript"):
+		return true
+	}
+	return false
+}
+
+// gzipResponseWriter decides on the first write whether the response is
+// compressible, then buffers it until it is big enough to be worth it
+type gzipResponseWriter struct {
+	gin.ResponseWriter
+	writers *sync.Pool
+	minSize int
+
+	decided     bool
+	passthrough bool
+	buffer      bytes.Buffer
+	gzip        *gzip.Writer
+}
+
+func (w *gzipResponseWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.passthrough = !compressible(w.Header(), w.Status())
+}
+
+func (w *gzipResponseWriter) Write(data []byte) (int, error) {
+	w.decide()
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(data)
+	case w.gzip != nil:
+		return w.gzip.Write(data)
+	}
+
+	w.buffer.Write(data)
+	if w.buffer.Len() >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+func (w *gzipResponseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// WriteHeaderNow sends the headers of a response without a body as they
+// are. Once a body has been written the headers go out with it.
+func (w *gzipResponseWriter) WriteHeaderNow() {
+	if w.gzip != nil || w.buffer.Len() > 0 {
+		return
+	}
+	w.decided, w.passthrough = true, true
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+// Written counts a held back body as written, so nothing writes a second
+// response after it
+func (w *gzipResponseWriter) Written() bool {
+	return w.buffer.Len() > 0 || w.gzip != nil || w.ResponseWriter.Written()
+}
+
+func (w *gzipResponseWriter) Size() int {
+	if w.buffer.Len() > 0 && w.gzip == nil {
+		return w.buffer.Len()
+	}
+	return w.ResponseWriter.Size()
+}
+
+// Flush commits a compressible response to gzip, however small it is so
+// far, and sends what has been written
+func (w *gzipResponseWriter) Flush() {
+	w.decide()
+	if !w.passthrough {
+		if w.gzip == nil {
+			if err := w.start(); err != nil {
+				return
+			}
+		}
+		w.gzip.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to set the
+// write deadline of an export
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// start sends the headers of a compressed response and what was buffered
+func (w *gzipResponseWriter) start() error {
+	header := w.Header()
+	header.Set("Content-Encoding", "gzip")
+	header.Del("Content-Length")
+
+	w.gzip = w.writers.Get().(*gzip.Writer)
+	w.gzip.Reset(w.ResponseWriter)
+	_, err := w.gzip.Write(w.buffer.Bytes())
+	w.buffer.Reset()
+	return err
+}
+
+// close finishes the response: the rest of a compressed body, or a body too
+// small to compress as it was written
+func (w *gzipResponseWriter) close() {
+	if w.gzip != nil {
+		w.gzip.Close()
+		w.gzip.Reset(io.Discard)
+		w.writers.Put(w.gzip)
+		w.gzip = nil
+		return
+	}
+	if w.buffer.Len() > 0 {
+		w.ResponseWriter.Write(w.buffer.Bytes())
+		w.buffer.Reset()
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequirePermissionForDeleted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	m := NewSecurityMiddleware(auth.NewAuthService(nil, nil, cfg), nil, nil, cfg)
+
+	tests := []struct {
+		name   string
+		role   models.UserRole
+		query  string
+		status int
+	}{
+		{name: "live records", role: models.RoleAssistant, query: "", status: http.StatusOK},
+		{name: "deleted=false", role: models.RoleAssistant, query: "?deleted=false", status: http.StatusOK},
+		{name: "deleted without delete permission", role: models.RoleAssistant, query: "?deleted=true", status: http.StatusForbidden},
+		{name: "deleted with update but not delete", role: models.RolePharmacist, query: "?deleted=true", status: http.StatusForbidden},
+		{name: "deleted with delete permission", role: models.RoleManager, query: "?deleted=true", status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(func(c *gin.Context) {
+				c.Set(UserContextKey, &models.User{Role: tt.role})
+			})
+			router.GET("/products", m.RequirePermissionForDeleted("products"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/products"+tt.query, nil))
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode is a stable, machine-readable identifier for an error response.
+// Clients should branch on it rather than on the message text.
+type ErrorCode string
+
+const (
+	CodeBadRequest           ErrorCode = "bad_request"
+	CodeValidationFailed     ErrorCode = "validation_failed"
+	CodeUnauthorized         ErrorCode = "unauthorized"
+	CodeCaptchaRequired      ErrorCode = "captcha_required"
+	CodeForbidden            ErrorCode = "forbidden"
+	CodeNotFound             ErrorCode = "not_found"
+	CodeConflict             ErrorCode = "conflict"
+	CodePayloadTooLarge      ErrorCode = "payload_too_large"
+	CodeUnsupportedMediaType ErrorCode = "unsupported_media_type"
+	CodeUnprocessable        ErrorCode = "unprocessable"
+	CodeLocked               ErrorCode = "locked"
+	CodeRateLimited          ErrorCode = "rate_limited"
+	CodeInternal             ErrorCode = "internal_error"
+	CodeBadGateway           ErrorCode = "bad_gateway"
+	CodeUnavailable          ErrorCode = "service_unavailable"
+	CodeTimeout              ErrorCode = "timeout"
+)
+
+// CodeForStatus is the code used when a handler doesn't give one
+func CodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMediaType
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessable
+	case http.StatusLocked:
+		return CodeLocked
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeBadGateway
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeBadRequest
+}
+
+// errorMessages are the localized messages for each code, by language.
+// English is the fallback.
+var errorMessages = map[string]map[ErrorCode]string{
+	"en": {
+		CodeBadRequest:           "The request could not be processed.",
+		CodeValidationFailed:     "Some fields are missing or invalid.",
+		CodeUnauthorized:         "Please sign in to continue.",
+		CodeCaptchaRequired:      "Please complete the CAPTCHA to sign in.",
+		CodeForbidden:            "You do not have permission to do this.",
+		CodeNotFound:             "The requested record was not found.",
+		CodeConflict:             "This conflicts with an existing record.",
+		CodePayloadTooLarge:      "The request is too large.",
+		CodeUnsupportedMediaType: "The request format is not supported.",
+		CodeUnprocessable:        "The request could not be completed.",
+		CodeLocked:               "This account is temporarily locked.",
+		CodeRateLimited:          "Too many requests. Please try again later.",
+		CodeInternal:             "Something went wrong. Please try again.",
+		CodeBadGateway:           "An external service failed. Please try again.",
+		CodeUnavailable:          "The service is temporarily unavailable.",
+		CodeTimeout:              "The request took too long. Please try again.",
+	},
+	"fil": {
+		CodeBadRequest:           "Hindi maproseso ang kahilingan.",
+		CodeValidationFailed:     "May kulang o maling impormasyon sa ilang field.",
+		CodeUnauthorized:         "Mag-sign in muna upang magpatuloy.",
+		CodeCaptchaRequired:      "Kumpletuhin muna ang CAPTCHA upang makapag-sign in.",
+		CodeForbidden:            "Wala kang pahintulot na gawin ito.",
+		CodeNotFound:             "Hindi nahanap ang hinihinging record.",
+		CodeConflict:             "Sumasalungat ito sa isang umiiral na record.",
+		CodePayloadTooLarge:      "Masyadong malaki ang kahilingan.",
+		CodeUnsupportedMediaType: "Hindi suportado ang format ng kahilingan.",
+		CodeUnprocessable:        "Hindi makumpleto ang kahilingan.",
+		CodeLocked:               "Pansamantalang naka-lock ang account na ito.",
+		CodeRateLimited:          "Masyadong maraming kahilingan. Subukang muli mamaya.",
+		CodeInternal:             "Nagkaroon ng problema. Pakisubukang muli.",
+		CodeBadGateway:           "Pumalya ang isang panlabas na serbisyo. Pakisubukang muli.",
+		CodeUnavailable:          "Pansamantalang hindi magagamit ang serbisyo.",
+		CodeTimeout:              "Masyadong natagalan ang kahilingan. Pakisubukang muli.",
+	},
+}
+
+// languageAliases maps other tags for a supported language onto it
+var languageAliases = map[string]string{"tl": "fil"}
+
+// LocalizedMessage returns the message for code in the best language from
+// an Accept-Language header, or "" for a code without one
+func LocalizedMessage(code ErrorCode, acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		tag = strings.SplitN(tag, "-", 2)[0]
+		if alias, ok := languageAliases[tag]; ok {
+			tag = alias
+		}
+		if message, ok := errorMessages[tag][code]; ok {
+			return message
+		}
+	}
+	return errorMessages["en"][code]
+}
+
+// ErrorEnvelope gives every JSON error response the same shape:
+//
+//	{"error": "Customer not found", "code": "not_found",
+//	 "message": "<localized text for the code>", "request_id": "..."}
+//
+// error keeps the handler's detail for existing clients, code defaults from
+// the status when the handler didn't set one, and message follows the
+// Accept-Language header. Other fields the handler sent are kept.
+// Successful responses stream through untouched.
+func (m *SecurityMiddleware) ErrorEnvelope() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &errorEnvelopeWriter{ResponseWriter: c.Writer, context: c}
+		c.Writer = writer
+		c.Next()
+		writer.flush()
+	}
+}
+
+// errorEnvelopeWriter holds back JSON error bodies until the handler is
+// done, and passes everything else straight through
+type errorEnvelopeWriter struct {
+	gin.ResponseWriter
+	context  *gin.Context
+	decided  bool
+	envelope bool
+	body     bytes.Buffer
+}
+
+func (w *errorEnvelopeWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.envelope = w.Status() >= http.StatusBadRequest &&
+		strings.Contains(w.Header().Get("Content-Type"), "application/json")
+}
+
+func (w *errorEnvelopeWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.envelope {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *errorEnvelopeWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.envelope {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *errorEnvelopeWriter) WriteHeaderNow() {
+	w.decide()
+	if !w.envelope {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *errorEnvelopeWriter) Flush() {
+	if !w.envelope {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the connection, e.g. to lift
+// the write deadline of a stream
+func (w *errorEnvelopeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush writes the held back body with the envelope fields added. Bodies
+// that aren't an object with a string error are sent as they were.
+func (w *errorEnvelopeWriter) flush() {
+	if !w.envelope {
+		return
+	}
+
+	var payload map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(w.body.Bytes()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil || payload == nil {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	if _, ok := payload["error"].(string); !ok {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+
+	addErrorFields(w.context, w.Status(), payload)
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		w.ResponseWriter.Write(w.body.Bytes())
+		return
+	}
+	w.ResponseWriter.Write(encoded)
+}
+
+// addErrorFields fills in an error payload's code, from the status when
+// the handler didn't set one, its localized message and the request ID
+func addErrorFields(c *gin.Context, status int, payload map[string]interface{}) {
+	code, _ := payload["code"].(string)
+	if code == "" {
+		code = string(CodeForStatus(status))
+		payload["code"] = code
+	}
+	if _, ok := payload["message"]; !ok {
+		language := c.GetHeader("Accept-Language")
+		message := LocalizedMessage(ErrorCode(code), language)
+		if message == "" {
+			message = LocalizedMessage(CodeForStatus(status), language)
+		}
+		payload["message"] = message
+	}
+	if _, ok := payload["request_id"]; !ok {
+		if requestID, exists := c.Get(RequestIDKey); exists {
+			payload["request_id"] = requestID
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireFeature turns requests away while the named feature is switched
+// off in FEATURE_FLAGS. The flag is read per request, so a config reload
+// takes effect at once.
+func (m *SecurityMiddleware) RequireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !m.config.Live().Features.Enabled(name) {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "This feature is currently unavailable",
+				"feature": name,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"pharmacy-backend/internal/kvstore"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencyProcessingTTL = time.Minute // how long a crashed request blocks its key
+)
+
+// idempotencyRecord is what is stored per key: a marker while the first
+// request runs, then its response
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        []byte `json:"body,omitempty"`
+}
+
+// Idempotency makes retries of a create safe. When a request carries an
+// Idempotency-Key header, the first response is stored and replayed for
+// later requests with the same key from the same caller, so a client that
+// lost the response can retry without creating a second order or sale.
+// Reusing a key with a different body is rejected, and a retry that arrives
+// while the first request is still running gets 409. Server errors are not
+// stored, so those can be retried for real.
+func (m *SecurityMiddleware) Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"error": "Idempotency-Key is too long",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		sum := sha256.Sum256(body)
+		fingerprint := hex.EncodeToString(sum[:])
+		storeKey := "idempotency:" + m.idempotencyCaller(c) + ":" + c.Request.Method + ":" + routePath(c) + ":" + key
+		ctx := c.Request.Context()
+
+		existing, claimed, err := m.idempotency.claim(ctx, storeKey, idempotencyRecord{Fingerprint: fingerprint}, idempotencyProcessingTTL)
+		if err != nil {
+			// Without the store the request still goes through, just unprotected
+			m.logger.WithError(err).Error("Failed to check idempotency key")
+			c.Next()
+			return
+		}
+		if !claimed {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+					"error": "Idempotency-Key was already used with a different request",
+				})
+			case !existing.Completed:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+					"error": "A request with this Idempotency-Key is still being processed",
+				})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.Status, existing.ContentType, existing.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			if err := m.idempotency.release(ctx, storeKey); err != nil {
+				m.logger.WithError(err).Error("Failed to release idempotency key")
+			}
+			return
+		}
+
+		record := idempotencyRecord{
+			Fingerprint: fingerprint,
+			Completed:   true,
+			Status:      status,
+			ContentType: recorder.Header().Get("Content-Type"),
+			Body:        recorder.body.Bytes(),
+		}
+		if err := m.idempotency.save(ctx, storeKey, record, m.config.Security.IdempotencyTTL); err != nil {
+			m.logger.WithError(err).Error("Failed to store idempotent response")
+		}
+	}
+}
+
+// idempotencyCaller scopes keys to the caller so one client can't replay
+// another's response by guessing its key
+func (m *SecurityMiddleware) idempotencyCaller(c *gin.Context) string {
+	if userID := m.requestSubject(c); userID != "" {
+		return "user:" + userID
+	}
+	if sessionID := c.GetHeader("X-Session-ID"); sessionID != "" {
+		return "session:" + sessionID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyStore keeps records in the shared store so retries hitting
+// another instance are caught
+type idempotencyStore struct {
+	store kvstore.Store
+}
+
+func newIdempotencyStore(store kvstore.Store) *idempotencyStore {
+	return &idempotencyStore{store: store}
+}
+
+// claim stores record under key unless the key is already taken, in which
+// case the existing record is returned
+func (s *idempotencyStore) claim(ctx context.Context, key string, record idempotencyRecord, ttl time.Duration) (idempotencyRecord, bool, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return idempotencyRecord{}, false, err
+	}
+	claimed, err := s.store.SetNX(ctx, key, data, ttl)
+	if err != nil || claimed {
+		return idempotencyRecord{}, claimed, err
+	}
+	raw, err := s.store.Get(ctx, key)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		// Expired in between, try once more
+		claimed, err = s.store.SetNX(ctx, key, data, ttl)
+		return idempotencyRecord{}, claimed, err
+	}
+	if err != nil {
+		return idempotencyRecord{}, false, err
+	}
+	var existing idempotencyRecord
+	err = json.Unmarshal(raw, &existing)
+	return existing, false, err
+}
+
+func (s *idempotencyStore) save(ctx context.Context, key string, record idempotencyRecord, ttl time.Duration) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.store.Set(ctx, key, data, ttl)
+}
+
+func (s *idempotencyStore) release(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, key)
+}
@@ -1,23 +1,25 @@
 package middleware
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/cache"
 	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/kvstore"
+	"pharmacy-backend/internal/metrics"
 	"pharmacy-backend/internal/models"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/secure"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 	"gorm.io/gorm"
@@ -31,30 +33,39 @@ const (
 type SecurityMiddleware struct {
 	authService *auth.AuthService
 	db          *gorm.DB
-	redis       *redis.Client
+	store       kvstore.Store // rate limit windows
 	config      *config.Config
 	logger      *logrus.Logger
-	limiter     *rate.Limiter
+	limiter     *rate.Limiter // instance-wide cap, only used while the store isn't shared
+	idempotency *idempotencyStore
+	cache       *cache.Cache // responses of hot read endpoints
 }
 
-func NewSecurityMiddleware(authService *auth.AuthService, db *gorm.DB, redis *redis.Client, config *config.Config) *SecurityMiddleware {
+func NewSecurityMiddleware(authService *auth.AuthService, db *gorm.DB, store kvstore.Store, config *config.Config) *SecurityMiddleware {
 	// Create rate limiter
 	limiter := rate.NewLimiter(rate.Limit(config.Security.RateLimitRPS), config.Security.RateLimitBurst)
 
 	return &SecurityMiddleware{
 		authService: authService,
 		db:          db,
-		redis:       redis,
+		store:       store,
 		config:      config,
-		logger:      logrus.New(),
+		logger:      logrus.StandardLogger(),
 		limiter:     limiter,
+		idempotency: newIdempotencyStore(store),
+		cache:       cache.New(store, config.Cache),
 	}
 }
 
-// RequestID middleware adds a unique request ID to each request
+// RequestID middleware adds a unique request ID to each request. An
+// X-Request-ID sent by a proxy or client is kept so logs can be correlated
+// across services.
 func (m *SecurityMiddleware) RequestID() gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		requestID := uuid.New().String()
+		requestID := c.GetHeader("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
 		c.Set(RequestIDKey, requestID)
 		c.Header("X-Request-ID", requestID)
 		c.Next()
@@ -102,117 +113,206 @@ func (m *SecurityMiddleware) Recovery() gin.HandlerFunc {
 	})
 }
 
-// CORS middleware with secure configuration
+// CORS middleware with secure configuration. The policy is rebuilt after a
+// config reload changes the CORS settings.
 func (m *SecurityMiddleware) CORS() gin.HandlerFunc {
+	var (
+		mu      sync.Mutex
+		current *config.CORSConfig
+		handler gin.HandlerFunc
+	)
+	return func(c *gin.Context) {
+		live := &m.config.Live().CORS
+		mu.Lock()
+		if live != current {
+			current, handler = live, newCORSHandler(*live)
+		}
+		corsHandler := handler
+		mu.Unlock()
+
+		corsHandler(c)
+	}
+}
+
+func newCORSHandler(settings config.CORSConfig) gin.HandlerFunc {
 	config := cors.DefaultConfig()
 	
 	// Check if allowing all origins
-	if len(m.config.CORS.AllowedOrigins) == 1 && m.config.CORS.AllowedOrigins[0] == "*" {
+	if len(settings.AllowedOrigins) == 1 && settings.AllowedOrigins[0] == "*" {
 		config.AllowAllOrigins = true
 		config.AllowCredentials = false // Cannot use credentials with AllowAllOrigins
 	} else {
-		config.AllowOrigins = m.config.CORS.AllowedOrigins
+		config.AllowOrigins = settings.AllowedOrigins
 		config.AllowCredentials = true
 	}
 	
-	config.AllowMethods = m.config.CORS.AllowedMethods
-	config.AllowHeaders = m.config.CORS.AllowedHeaders
+	config.AllowMethods = settings.AllowedMethods
+	config.AllowHeaders = settings.AllowedHeaders
 	config.ExposeHeaders = []string{"X-Request-ID", "X-Total-Count"}
 	config.MaxAge = 12 * time.Hour
 
 	return cors.New(config)
 }
 
-// Security headers middleware
+// SecurityHeaders sets HSTS, frame, referrer and content security policy
+// headers from the Headers config. With a CSP report URI configured the
+// policy also tells browsers where to send violation reports.
 func (m *SecurityMiddleware) SecurityHeaders() gin.HandlerFunc {
+	headers := m.config.Headers
 	secureConfig := secure.DefaultConfig()
 	
 	// Disable SSL redirect in development or when explicitly disabled
 	disableSSL := !m.config.IsProduction() || os.Getenv("DISABLE_SSL_REDIRECT") == "true"
 	secureConfig.SSLRedirect = !disableSSL
+
+	// With native TLS every request reaching the router is HTTPS, plain
+	// HTTP being redirected by its own listener, so HSTS is always sent
+	if m.config.Server.TLSEnabled() {
+		disableSSL = false
+		secureConfig.SSLRedirect = false
+	}
 	
 	if disableSSL {
 		// Don't enforce HTTPS in development
 		secureConfig.STSSeconds = 0
 		secureConfig.STSIncludeSubdomains = false
 	} else {
-		secureConfig.STSSeconds = 31536000
-		secureConfig.STSIncludeSubdomains = true
+		secureConfig.STSSeconds = int64(headers.HSTSMaxAge)
+		secureConfig.STSIncludeSubdomains = headers.HSTSIncludeSubdomains
 	}
 	
-	secureConfig.FrameDeny = true
+	secureConfig.FrameDeny = false
+	secureConfig.CustomFrameOptionsValue = headers.FrameOptions
 	secureConfig.ContentTypeNosniff = true
 	secureConfig.BrowserXssFilter = true
-	secureConfig.ContentSecurityPolicy = "default-src 'self'"
-	secureConfig.ReferrerPolicy = "strict-origin-when-cross-origin"
+	secureConfig.ReferrerPolicy = headers.ReferrerPolicy
+
+	policy := contentSecurityPolicy(headers)
+	secureConfig.ContentSecurityPolicy = policy
+	if headers.CSPReportOnly {
+		secureConfig.ContentSecurityPolicy = ""
+	}
+	applySecure := secure.New(secureConfig)
+
+	return func(c *gin.Context) {
+		if headers.CSPReportOnly && policy != "" {
+			c.Header("Content-Security-Policy-Report-Only", policy)
+		}
+		if headers.CSPReportURI != "" {
+			c.Header("Reporting-Endpoints", fmt.Sprintf("%s=\"%s\"", cspReportGroup, headers.CSPReportURI))
+		}
+		if headers.PermissionsPolicy != "" {
+			c.Header("Permissions-Policy", headers.PermissionsPolicy)
+		}
+		applySecure(c)
+	}
+}
 
-	return secure.New(secureConfig)
+// cspReportGroup names the Reporting-Endpoints entry used by report-to
+const cspReportGroup = "csp-endpoint"
+
+// contentSecurityPolicy adds the report directives to the configured policy
+// unless it already has its own
+func contentSecurityPolicy(headers config.HeadersConfig) string {
+	policy := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(headers.ContentSecurityPolicy), ";"))
+	if policy == "" || headers.CSPReportURI == "" || strings.Contains(policy, "report-uri") || strings.Contains(policy, "report-to") {
+		return policy
+	}
+	return fmt.Sprintf("%s; report-uri %s; report-to %s", policy, headers.CSPReportURI, cspReportGroup)
 }
 
-// Rate limiting middleware
+// Rate limiting middleware. Each request is counted against a fixed window
+// for its tier, caller and route group: the /auth endpoints per client IP,
+// requests with a valid access token per user, and anything else per client
+// IP. Keying on the user means staff behind one NAT don't share a quota.
+// Without Redis the same quotas are kept in memory per instance, under the
+// instance-wide cap as well.
 func (m *SecurityMiddleware) RateLimit() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Skip rate limiting if Redis is not available
-		if m.redis == nil {
+		tierName, tier, identity := m.rateLimitTier(c)
+		if tier.Requests <= 0 || tier.Window <= 0 {
 			c.Next()
 			return
 		}
-		
-		// Create per-IP rate limiter
-		clientIP := c.ClientIP()
-		key := fmt.Sprintf("rate_limit:%s", clientIP)
-		
-		// Check Redis for rate limit data
-		ctx := context.Background()
-		
-		// Get current count
-		current, err := m.redis.Get(ctx, key).Int()
-		if err != nil && err != redis.Nil {
-			m.logger.WithError(err).Error("Failed to get rate limit data")
+		group := m.extractResource(routePath(c))
+		key := fmt.Sprintf("rate_limit:%s:%s:%s", tierName, group, identity)
+
+		count, reset, err := m.store.Incr(c.Request.Context(), key, tier.Window)
+		if err != nil {
+			m.logger.WithError(err).Error("Rate limiting failed")
 			c.Next()
 			return
 		}
+		allowed := count <= int64(tier.Requests)
+		remaining := tier.Requests - int(count)
+		if remaining < 0 {
+			remaining = 0
+		}
+		if allowed && !m.store.Shared() && !m.limiter.Allow() {
+			allowed, remaining = false, 0
+		}
 
-		// Check if limit exceeded
-		if current >= m.config.Security.RateLimitRPS {
-			remaining := m.config.Security.RateLimitRPS - current
-			if remaining < 0 {
-				remaining = 0
-			}
+		c.Header("X-RateLimit-Limit", strconv.Itoa(tier.Requests))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(reset).Unix(), 10))
 
-			c.Header("X-RateLimit-Limit", strconv.Itoa(m.config.Security.RateLimitRPS))
-			c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-			c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+		if !allowed {
+			retryAfter := int(reset.Seconds() + 0.5)
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
 
-			m.auditLog(c, "rate_limit_exceeded", "rate_limit", "", false, "Rate limit exceeded")
+			metrics.RateLimitRejections.Inc(tierName)
+			m.auditLog(c, "rate_limit_exceeded", "rate_limit", rateLimitUserID(identity), false,
+				fmt.Sprintf("Rate limit exceeded for %s tier on %s", tierName, group))
 
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 				"error": "Rate limit exceeded",
-				"retry_after": 60,
+				"retry_after": retryAfter,
 			})
 			return
 		}
 
-		// Increment counter
-		pipe := m.redis.Pipeline()
-		pipe.Incr(ctx, key)
-		pipe.Expire(ctx, key, time.Minute)
-		if _, err := pipe.Exec(ctx); err != nil {
-			m.logger.WithError(err).Error("Failed to update rate limit data")
-		}
-
-		// Set rate limit headers
-		remaining := m.config.Security.RateLimitRPS - current - 1
-		if remaining < 0 {
-			remaining = 0
-		}
+		c.Next()
+	}
+}
 
-		c.Header("X-RateLimit-Limit", strconv.Itoa(m.config.Security.RateLimitRPS))
-		c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
-		c.Header("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10))
+// rateLimitTier picks the quota for a request and who it is counted against
+func (m *SecurityMiddleware) rateLimitTier(c *gin.Context) (string, config.RateLimitTier, string) {
+	limits := m.config.Live().RateLimit
+	if m.extractResource(routePath(c)) == "auth" {
+		return "login", limits.Login, "ip:" + c.ClientIP()
+	}
+	if userID := m.requestSubject(c); userID != "" {
+		return "user", limits.User, "user:" + userID
+	}
+	return "public", limits.Public, "ip:" + c.ClientIP()
+}
 
-		c.Next()
+// requestSubject is the user the request's access token was issued to. The
+// limiter runs before Auth, so the token is checked here; an invalid token
+// is treated as anonymous and rejected later by Auth.
+func (m *SecurityMiddleware) requestSubject(c *gin.Context) string {
+	if user, exists := GetCurrentUser(c); exists {
+		return user.ID.String()
 	}
+	if m.authService == nil {
+		return ""
+	}
+	token, _, _ := m.requestToken(c)
+	if token == "" {
+		return ""
+	}
+	claims, err := m.authService.ValidateToken(token)
+	if err != nil {
+		return ""
+	}
+	return claims.UserID.String()
+}
+
+func rateLimitUserID(identity string) string {
+	return strings.TrimPrefix(identity, "user:")
 }
 
 // Authentication middleware
@@ -226,24 +326,21 @@ func (m *SecurityMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		// Extract token from Bearer header, or the session cookie
+		token, fromCookie, malformed := m.requestToken(c)
+		if malformed {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header required",
+				"error": "Invalid authorization header format",
 			})
 			return
 		}
-
-		// Extract token from Bearer header
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if token == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization header format",
+				"error": "Authorization header required",
 			})
 			return
 		}
 
-		token := parts[1]
 		claims, err := m.authService.ValidateToken(token)
 		if err != nil {
 			m.auditLog(c, "authentication_failed", "auth", "", false, err.Error())
@@ -261,18 +358,25 @@ func (m *SecurityMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
-		// Check if session is blacklisted (skip if Redis not available)
-		if m.redis != nil {
-			ctx := context.Background()
-			key := fmt.Sprintf("blacklist:session:%s", claims.SessionID)
-			if blacklisted, err := m.redis.Get(ctx, key).Result(); err == nil && blacklisted == "1" {
-				m.auditLog(c, "blacklisted_token", "auth", claims.UserID.String(), false, "Blacklisted token used")
-				
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Token has been revoked",
-				})
-				return
-			}
+		// Check if session is blacklisted
+		if m.authService.IsSessionBlacklisted(c.Request.Context(), claims.SessionID) {
+			m.auditLog(c, "blacklisted_token", "auth", claims.UserID.String(), false, "Blacklisted token used")
+
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "Token has been revoked",
+			})
+			return
+		}
+
+		// Browsers attach cookies to cross-site requests, so a cookie session
+		// must also prove the request came from our frontend
+		if fromCookie && !ValidCSRF(c, m.authService.CSRFToken(claims.SessionID)) {
+			m.auditLog(c, "csrf_rejected", "auth", claims.UserID.String(), false, "Missing or invalid CSRF token")
+
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "Missing or invalid CSRF token",
+			})
+			return
 		}
 
 		// Check if db is nil
@@ -304,14 +408,44 @@ func (m *SecurityMiddleware) Auth() gin.HandlerFunc {
 			return
 		}
 
+		// Roles can be limited to the pharmacy network or VPN
+		if err := m.authService.CheckNetworkAccess(user.Role, c.ClientIP()); err != nil {
+			m.auditLog(c, "network_access_denied", "auth", user.ID.String(), false,
+				fmt.Sprintf("User %s (%s) called the API from outside the allowed networks", user.Username, user.Role))
+
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
 		// Set user in context
 		c.Set(UserContextKey, &user)
 		c.Set("claims", claims)
 
+		if !m.scopeToBranch(c, &user) {
+			return
+		}
+
 		c.Next()
 	}
 }
 
+// OptionalAuth authenticates the request when it carries an Authorization
+// header or session cookie and lets it through anonymously otherwise. A bad
+// token is still rejected so callers notice instead of silently losing staff
+// access.
+func (m *SecurityMiddleware) OptionalAuth() gin.HandlerFunc {
+	authenticate := m.Auth()
+	return func(c *gin.Context) {
+		if token, _, malformed := m.requestToken(c); token == "" && !malformed {
+			c.Next()
+			return
+		}
+		authenticate(c)
+	}
+}
+
 // Authorization middleware
 func (m *SecurityMiddleware) RequirePermission(resource, action string) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -347,6 +481,21 @@ func (m *SecurityMiddleware) RequirePermission(resource, action string) gin.Hand
 	}
 }
 
+// RequirePermissionForDeleted lets only staff who may delete, and so
+// restore, a resource list its soft-deleted records with ?deleted=true. It
+// goes before CacheResponse, which would otherwise serve a cached list of
+// them to any caller of the route.
+func (m *SecurityMiddleware) RequirePermissionForDeleted(resource string) gin.HandlerFunc {
+	requireDelete := m.RequirePermission(resource, "delete")
+	return func(c *gin.Context) {
+		if c.Query("deleted") != "true" {
+			c.Next()
+			return
+		}
+		requireDelete(c)
+	}
+}
+
 // Admin only middleware
 func (m *SecurityMiddleware) AdminOnly() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -387,7 +536,7 @@ func (m *SecurityMiddleware) HIPAACompliance() gin.HandlerFunc {
 		c.Header("X-Data-Classification", "PHI")
 
 		// Log access to medical data
-		if m.containsMedicalData(c.Request.URL.Path) {
+		if m.containsMedicalData(routePath(c)) {
 			user, exists := c.Get(UserContextKey)
 			userID := ""
 			if exists {
@@ -395,7 +544,7 @@ func (m *SecurityMiddleware) HIPAACompliance() gin.HandlerFunc {
 			}
 
 			m.auditLog(c, "medical_data_access", "medical_data", userID, true, 
-				fmt.Sprintf("Access to medical data endpoint: %s", c.Request.URL.Path))
+				fmt.Sprintf("Access to medical data endpoint: %s", routePath(c)))
 		}
 
 		c.Next()
@@ -414,26 +563,31 @@ func (m *SecurityMiddleware) AuditLog() gin.HandlerFunc {
 		
 		c.Next()
 		
-		duration := time.Since(start)
-		
-		// Log significant operations
-		_ = duration // Use the duration variable
-		if m.isSignificantOperation(c.Request.Method, c.Request.URL.Path) {
-			user, exists := c.Get(UserContextKey)
-			userID := ""
-			if exists {
-				userID = user.(*models.User).ID.String()
-			}
+		if !m.isSignificantOperation(c.Request.Method, routePath(c)) {
+			return
+		}
 
-			action := fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path)
-			resource := m.extractResource(c.Request.URL.Path)
-			
-			m.auditLog(c, action, resource, userID, c.Writer.Status() < 400, "")
+		userID := ""
+		if user, exists := GetCurrentUser(c); exists {
+			userID = user.ID.String()
 		}
+
+		// Actions use the route template, e.g. "PUT /api/v1/customers/:id",
+		// so they can be filtered on regardless of the IDs involved
+		action := fmt.Sprintf("%s %s", c.Request.Method, routePath(c))
+		status := c.Writer.Status()
+		errorMessage := c.Errors.ByType(gin.ErrorTypeAny).String()
+
+		entry := m.newAuditEntry(c, action, m.extractResource(routePath(c)), userID, status < 400, errorMessage)
+		entry.StatusCode = &status
+		duration := int(time.Since(start).Milliseconds())
+		entry.Duration = &duration
+		m.writeAuditLog(entry)
 	}
 }
 
-// Input validation middleware
+// ValidateJSON caps JSON request bodies. Field validation happens when
+// handlers bind the body, see bindJSON in the api package.
 func (m *SecurityMiddleware) ValidateJSON() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH" {
@@ -450,7 +604,34 @@ func (m *SecurityMiddleware) ValidateJSON() gin.HandlerFunc {
 // Helper methods
 
 func (m *SecurityMiddleware) auditLog(c *gin.Context, action, resource, userID string, success bool, errorMessage string) {
-	// Check if db is nil
+	m.writeAuditLog(m.newAuditEntry(c, action, resource, userID, success, errorMessage))
+}
+
+// newAuditEntry fills in the request details shared by every audit entry
+func (m *SecurityMiddleware) newAuditEntry(c *gin.Context, action, resource, userID string, success bool, errorMessage string) *models.AuditLog {
+	entry := &models.AuditLog{
+		UserID:     parseUUID(userID),
+		Action:     action,
+		Resource:   resource,
+		ResourceID: routeResourceID(c),
+		IPAddress:  c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Success:    success,
+		OldValues:  "{}", // Valid empty JSON
+		NewValues:  "{}", // Valid empty JSON
+	}
+	if requestID := GetRequestID(c); requestID != "" {
+		entry.RequestID = &requestID
+	}
+	if errorMessage != "" {
+		entry.ErrorMessage = &errorMessage
+	}
+	return entry
+}
+
+// writeAuditLog stores an audit entry. Failures are logged and never fail the
+// request.
+func (m *SecurityMiddleware) writeAuditLog(entry *models.AuditLog) {
 	if m.db == nil {
 		if m.logger != nil {
 			m.logger.Error("Database connection is nil, cannot create audit log")
@@ -458,44 +639,17 @@ func (m *SecurityMiddleware) auditLog(c *gin.Context, action, resource, userID s
 		return
 	}
 
-	requestIDValue, _ := c.Get(RequestIDKey)
-	requestIDStr := ""
-	if requestID, ok := requestIDValue.(string); ok {
-		requestIDStr = requestID
-	}
-	
-	auditLog := models.AuditLog{
-		UserID:      parseUUID(userID),
-		Action:      action,
-		Resource:    resource,
-		ResourceID:  nil, // Could be extracted from URL
-		IPAddress:   c.ClientIP(),
-		UserAgent:   c.Request.UserAgent(),
-		RequestID:   &requestIDStr,
-		Success:     success,
-		ErrorMessage: &errorMessage,
-		OldValues:   "{}", // Valid empty JSON
-		NewValues:   "{}", // Valid empty JSON
-	}
-
-	if err := m.db.Create(&auditLog).Error; err != nil {
+	if err := m.db.Create(entry).Error; err != nil {
 		if m.logger != nil {
-			m.logger.WithError(err).Error("Failed to create audit log")
+			m.logger.WithError(err).WithField("action", entry.Action).Error("Failed to create audit log")
 		}
 	}
 }
 
 func (m *SecurityMiddleware) containsMedicalData(path string) bool {
-	medicalPaths := []string{
-		"/api/customers",
-		"/api/prescriptions",
-		"/api/medical-records",
-	}
-	
-	for _, medicalPath := range medicalPaths {
-		if strings.Contains(path, medicalPath) {
-			return true
-		}
+	switch m.extractResource(path) {
+	case "customers", "prescriptions", "medical-records":
+		return true
 	}
 	return false
 }
@@ -506,29 +660,71 @@ func (m *SecurityMiddleware) isSignificantOperation(method, path string) bool {
 		return true
 	}
 	
-	sensitiveEndpoints := []string{
-		"/api/customers",
-		"/api/sales",
-		"/api/products",
-		"/api/users",
-		"/api/analytics",
-	}
-	
-	for _, endpoint := range sensitiveEndpoints {
-		if strings.Contains(path, endpoint) {
-			return true
-		}
+	switch m.extractResource(path) {
+	case "customers", "sales", "products", "users", "analytics", "audit":
+		return true
 	}
-	
 	return false
 }
 
+// extractResource returns the first segment after the API prefix and
+// version, e.g. "customers" for /api/v1/customers/:id/flags
 func (m *SecurityMiddleware) extractResource(path string) string {
-	parts := strings.Split(path, "/")
-	if len(parts) >= 3 && parts[1] == "api" {
-		return parts[2]
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "api" {
+		return "unknown"
+	}
+	parts = parts[1:]
+	if len(parts) > 1 && isAPIVersion(parts[0]) {
+		parts = parts[1:]
+	}
+	return parts[0]
+}
+
+func isAPIVersion(segment string) bool {
+	if len(segment) < 2 || segment[0] != 'v' {
+		return false
 	}
-	return "unknown"
+	_, err := strconv.Atoi(segment[1:])
+	return err == nil
+}
+
+// routePath is the matched route template, or the raw path when no route
+// matched
+func routePath(c *gin.Context) string {
+	if path := c.FullPath(); path != "" {
+		return path
+	}
+	return c.Request.URL.Path
+}
+
+// routeResourceID is the ID of the resource the route acts on, taken from
+// its :id parameter
+func routeResourceID(c *gin.Context) *string {
+	id := c.Param("id")
+	if id == "" {
+		return nil
+	}
+	if len(id) > 100 {
+		id = id[:100]
+	}
+	return &id
+}
+
+// validRequestID accepts caller-supplied request IDs that are short and
+// safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 100 {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 func parseUUID(s string) *uuid.UUID {
@@ -553,9 +749,7 @@ func GetCurrentUser(c *gin.Context) (*models.User, bool) {
 
 // GetRequestID extracts the request ID from context
 func GetRequestID(c *gin.Context) string {
-	requestID, exists := c.Get(RequestIDKey)
-	if !exists {
-		return ""
-	}
-	return requestID.(string)
+	requestID, _ := c.Get(RequestIDKey)
+	id, _ := requestID.(string)
+	return id
 }
\ No newline at end of file
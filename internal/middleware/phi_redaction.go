@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// phiUnmaskedKey marks a response that may carry PHI to any role, set by
+// break-glass handlers after the access has been audited
+const phiUnmaskedKey = "phi_unmasked"
+
+// UnmaskPHI lets the current response through RedactPHI unchanged. Only
+// call it once the access has been authorized and audit-logged.
+func UnmaskPHI(c *gin.Context) {
+	c.Set(phiUnmaskedKey, true)
+}
+
+// RedactPHI strips customer medical history, allergies, current medications,
+// blood type and insurance details from JSON responses, unless they go to a
+// signed in user with medical_data read permission. Anonymous responses are
+// always redacted. It works on the encoded response, so every endpoint that
+// embeds a customer is covered. Objects that lost fields get a
+// redacted_fields list naming them.
+//
+// Whether to redact is decided when the response is first written, after
+// Auth has identified the user, so other responses stream through untouched.
+func (m *SecurityMiddleware) RedactPHI() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		writer := &phiRedactingWriter{ResponseWriter: c.Writer, middleware: m, context: c}
+		c.Writer = writer
+		c.Next()
+		writer.flush()
+	}
+}
+
+// mustRedact reports whether the current response has to be redacted. Only
+// a user that Auth identified and that may read medical data gets PHI.
+func (m *SecurityMiddleware) mustRedact(c *gin.Context) bool {
+	if c.GetBool(phiUnmaskedKey) {
+		return false
+	}
+	user, exists := GetCurrentUser(c)
+	if !exists {
+		return true
+	}
+	return !m.authService.CheckPermission(user.Role, "medical_data", "read")
+}
+
+// phiRedactingWriter holds back JSON bodies that need redacting until the
+// handler is done, and passes everything else straight through
+type phiRedactingWriter struct {
+	gin.ResponseWriter
+	middleware *SecurityMiddleware
+	context    *gin.Context
+	decided    bool
+	redact     bool
+	body       bytes.Buffer
+}
+
+func (w *phiRedactingWriter) decide() {
+	if w.decided {
+		return
+	}
+	w.decided = true
+	w.redact = strings.Contains(w.Header().Get("Content-Type"), "application/json") &&
+		w.middleware.mustRedact(w.context)
+}
+
+func (w *phiRedactingWriter) Write(data []byte) (int, error) {
+	w.decide()
+	if w.redact {
+		return w.body.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *phiRedactingWriter) WriteString(s string) (int, error) {
+	w.decide()
+	if w.redact {
+		return w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *phiRedactingWriter) WriteHeaderNow() {
+	w.decide()
+	if !w.redact {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *phiRedactingWriter) Flush() {
+	if !w.redact {
+		w.ResponseWriter.Flush()
+	}
+}
+
+// Unwrap returns the writer underneath
+func (w *phiRedactingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flush writes the held back body once redacted. A body that can't be parsed
+// is dropped rather than risk sending PHI.
+func (w *phiRedactingWriter) flush() {
+	if !w.redact {
+		return
+	}
+
+	decoder := json.NewDecoder(&w.body)
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		w.middleware.logger.WithError(err).Error("Failed to parse response for PHI redaction")
+		w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		w.ResponseWriter.WriteString(`{"error":"Internal server error"}`)
+		return
+	}
+
+	redacted, err := json.Marshal(redactPHIValue(payload))
+	if err != nil {
+		w.middleware.logger.WithError(err).Error("Failed to encode redacted response")
+		w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+		w.ResponseWriter.WriteString(`{"error":"Internal server error"}`)
+		return
+	}
+	w.ResponseWriter.Write(redacted)
+}
+
+// redactPHIValue removes customer PHI fields from every object in value
+func redactPHIValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var removed []string
+		for key, child := range v {
+			if models.IsCustomerPHIField(key) {
+				delete(v, key)
+				removed = append(removed, key)
+				continue
+			}
+			v[key] = redactPHIValue(child)
+		}
+		if len(removed) > 0 {
+			if existing, ok := v["redacted_fields"].([]interface{}); ok {
+				for _, field := range existing {
+					if name, ok := field.(string); ok {
+						removed = append(removed, name)
+					}
+				}
+			}
+			sort.Strings(removed)
+			v["redacted_fields"] = removed
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = redactPHIValue(child)
+		}
+	}
+	return value
+}
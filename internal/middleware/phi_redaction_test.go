@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"pharmacy-backend/internal/auth"
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRedactPHI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	m := NewSecurityMiddleware(auth.NewAuthService(nil, nil, cfg), nil, nil, cfg)
+
+	customer := gin.H{
+		"first_name":      "Juan",
+		"allergies":       "penicillin",
+		"medical_history": "asthma",
+	}
+
+	tests := []struct {
+		name     string
+		user     *models.User
+		unmasked bool
+		redacted bool
+	}{
+		{name: "anonymous", redacted: true},
+		{name: "assistant", user: &models.User{Role: models.RoleAssistant}, redacted: true},
+		{name: "pharmacist", user: &models.User{Role: models.RolePharmacist}},
+		{name: "admin", user: &models.User{Role: models.RoleAdmin}},
+		{name: "break glass", user: &models.User{Role: models.RoleAssistant}, unmasked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(m.RedactPHI())
+			router.GET("/customer", func(c *gin.Context) {
+				if tt.user != nil {
+					c.Set(UserContextKey, tt.user)
+				}
+				if tt.unmasked {
+					UnmaskPHI(c)
+				}
+				c.JSON(http.StatusOK, gin.H{"customer": customer})
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/customer", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			var body struct {
+				Customer map[string]interface{} `json:"customer"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+			}
+			if body.Customer["first_name"] != "Juan" {
+				t.Errorf("first_name = %v, want Juan", body.Customer["first_name"])
+			}
+			_, hasAllergies := body.Customer["allergies"]
+			_, hasHistory := body.Customer["medical_history"]
+			if tt.redacted {
+				if hasAllergies || hasHistory {
+					t.Errorf("PHI sent: %s", w.Body.String())
+				}
+				if _, ok := body.Customer["redacted_fields"]; !ok {
+					t.Errorf("redacted_fields missing: %s", w.Body.String())
+				}
+			} else if !hasAllergies || !hasHistory {
+				t.Errorf("PHI withheld: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRedactPHIPassesOtherContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	m := NewSecurityMiddleware(auth.NewAuthService(nil, nil, cfg), nil, nil, cfg)
+
+	router := gin.New()
+	router.Use(m.RedactPHI())
+	router.GET("/label", func(c *gin.Context) {
+		c.String(http.StatusOK, "allergies: penicillin")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/label", nil))
+	if got := w.Body.String(); got != "allergies: penicillin" {
+		t.Errorf("body = %q, want it unchanged", got)
+	}
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReadConsistencyHeader set to "strong" makes a GET read from the primary
+// database instead of the read replica
+const ReadConsistencyHeader = "X-Read-Consistency"
+
+// ReadRouting lets the reads of GET requests use the read replica. A caller
+// that has just written reads from the primary for the replica's maximum
+// lag afterwards, so it sees its own changes; any request can ask for the
+// primary with X-Read-Consistency: strong. Without a replica it does
+// nothing.
+func (m *SecurityMiddleware) ReadRouting() gin.HandlerFunc {
+	if !m.config.HasReadReplica() {
+		return func(c *gin.Context) { c.Next() }
+	}
+
+	writers := newRecentWriters(m.config.ReadReplica.MaxLag)
+	return func(c *gin.Context) {
+		caller := m.requestSubject(c)
+		if caller == "" {
+			caller = "ip:" + c.ClientIP()
+		}
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead:
+			if !strings.EqualFold(c.GetHeader(ReadConsistencyHeader), "strong") && !writers.wroteRecently(caller) {
+				c.Request = c.Request.WithContext(database.WithReplicaReads(c.Request.Context()))
+			}
+		default:
+			writers.record(caller)
+		}
+		c.Next()
+	}
+}
+
+// recentWriters remembers who made a write request in the last window.
+// Like the local rate limiter it is per instance.
+type recentWriters struct {
+	mu        sync.Mutex
+	window    time.Duration
+	writes    map[string]time.Time
+	lastSweep time.Time
+}
+
+func newRecentWriters(window time.Duration) *recentWriters {
+	if window <= 0 {
+		window = 5 * time.Second
+	}
+	return &recentWriters{window: window, writes: make(map[string]time.Time)}
+}
+
+func (w *recentWriters) record(caller string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	w.writes[caller] = now
+	if now.Sub(w.lastSweep) > time.Minute {
+		w.lastSweep = now
+		for key, at := range w.writes {
+			if now.Sub(at) > w.window {
+				delete(w.writes, key)
+			}
+		}
+	}
+}
+
+func (w *recentWriters) wroteRecently(caller string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	at, ok := w.writes[caller]
+	return ok && time.Since(at) <= w.window
+}
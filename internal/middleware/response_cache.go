@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CacheStatusHeader tells whether a response came from the cache
+const CacheStatusHeader = "X-Cache"
+
+// cachedHeaders are the response headers stored with a cached body
+var cachedHeaders = []string{"Content-Type", "X-Total-Count"}
+
+// cachedResponse is what is stored per request
+type cachedResponse struct {
+	Headers map[string]string `json:"headers"`
+	Body    []byte            `json:"body"`
+}
+
+// CacheResponse serves GET requests from the cache, keyed by path and
+// query parameters, and stores successful responses for the namespace's
+// TTL. The handler's
+// own response is stored, before any envelope or redaction is applied on
+// the way out, so the same entry serves every API version and caller.
+// A request with Cache-Control: no-cache skips the lookup.
+func (m *SecurityMiddleware) CacheResponse(namespace cache.Namespace) gin.HandlerFunc {
+	ttl := m.cacheTTL(namespace)
+	return func(c *gin.Context) {
+		if !m.cache.Enabled() || c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		entry := m.cache.Entry(ctx, namespace, c.Request.URL.Path+"?"+c.Request.URL.Query().Encode())
+		if !strings.Contains(c.GetHeader("Cache-Control"), "no-cache") {
+			if raw, hit := m.cache.Get(ctx, entry); hit {
+				var response cachedResponse
+				if err := json.Unmarshal(raw, &response); err == nil {
+					for name, value := range response.Headers {
+						c.Header(name, value)
+					}
+					c.Header(CacheStatusHeader, "HIT")
+					c.Data(http.StatusOK, response.Headers["Content-Type"], response.Body)
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		c.Header(CacheStatusHeader, "MISS")
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() != http.StatusOK || recorder.body.Len() == 0 || len(c.Errors) > 0 {
+			return
+		}
+		response := cachedResponse{Headers: make(map[string]string), Body: recorder.body.Bytes()}
+		for _, name := range cachedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				response.Headers[name] = value
+			}
+		}
+		raw, err := json.Marshal(response)
+		if err != nil {
+			return
+		}
+		m.cache.Set(ctx, entry, raw, ttl)
+	}
+}
+
+// InvalidatesCache drops the cached responses of namespaces once a request
+// that changes them succeeds
+func (m *SecurityMiddleware) InvalidatesCache(namespaces ...cache.Namespace) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Writer.Status() < http.StatusBadRequest {
+			m.cache.Invalidate(c.Request.Context(), namespaces...)
+		}
+	}
+}
+
+// cacheTTL is how long responses in namespace are kept
+func (m *SecurityMiddleware) cacheTTL(namespace cache.Namespace) time.Duration {
+	switch namespace {
+	case cache.Products:
+		return m.config.Cache.ProductTTL
+	case cache.Services:
+		return m.config.Cache.ServiceTTL
+	case cache.Analytics:
+		return m.config.Cache.AnalyticsTTL
+	}
+	return 0
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cookie sessions keep the access and refresh tokens in HttpOnly cookies so
+// page scripts can't read them. Cookies are sent by the browser on
+// cross-site requests too, so every unsafe request authenticated by cookie
+// must carry the session's CSRF token in the X-CSRF-Token header; another
+// site can't read it from the CSRF cookie.
+const (
+	AccessCookieName  = "pharmacy_access"
+	RefreshCookieName = "pharmacy_refresh"
+	CSRFCookieName    = "pharmacy_csrf"
+	CSRFHeader        = "X-CSRF-Token"
+	ClientTypeHeader  = "X-Client-Type"
+
+	accessCookiePath = "/api"
+)
+
+// refreshCookiePath is the path of the auth endpoints for an API version
+func refreshCookiePath(version string) string {
+	return "/api/" + version + "/auth"
+}
+
+// WantsCookieSession reports whether the client asked for a cookie session
+// and they are enabled
+func WantsCookieSession(c *gin.Context, cfg config.SessionConfig) bool {
+	return cfg.CookiesEnabled && strings.EqualFold(c.GetHeader(ClientTypeHeader), "browser")
+}
+
+// SetSessionCookies stores the session's tokens in cookies. The refresh
+// cookie is only sent to the auth endpoints of the API version the session
+// was started on.
+func SetSessionCookies(c *gin.Context, cfg config.SessionConfig, accessToken, refreshToken, csrfToken string, expiresIn int) {
+	accessTTL := time.Duration(expiresIn) * time.Second
+	setSessionCookie(c, cfg, AccessCookieName, accessToken, accessCookiePath, accessTTL, true)
+	setSessionCookie(c, cfg, RefreshCookieName, refreshToken, refreshCookiePath(APIVersionOf(c)), 7*accessTTL, true)
+	setSessionCookie(c, cfg, CSRFCookieName, csrfToken, "/", 7*accessTTL, false)
+}
+
+// ClearSessionCookies removes the session cookies, e.g. on logout. The
+// refresh cookie is removed for every API version, as the session may have
+// been started on another.
+func ClearSessionCookies(c *gin.Context, cfg config.SessionConfig) {
+	setSessionCookie(c, cfg, AccessCookieName, "", accessCookiePath, -1, true)
+	for _, version := range APIVersions {
+		setSessionCookie(c, cfg, RefreshCookieName, "", refreshCookiePath(version), -1, true)
+	}
+	setSessionCookie(c, cfg, CSRFCookieName, "", "/", -1, false)
+}
+
+// ValidCSRF reports whether a request authenticated by cookie may go ahead.
+// Safe methods don't change anything and need no token.
+func ValidCSRF(c *gin.Context, expected string) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := c.GetHeader(CSRFHeader)
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// requestToken returns the request's access token from the Authorization
+// header or, for cookie sessions, the access cookie. A malformed header is
+// reported as malformed rather than falling back to the cookie.
+func (m *SecurityMiddleware) requestToken(c *gin.Context) (token string, fromCookie, malformed bool) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return "", false, true
+		}
+		return parts[1], false, false
+	}
+	if !m.config.Session.CookiesEnabled {
+		return "", false, false
+	}
+	cookie, err := c.Cookie(AccessCookieName)
+	if err != nil || cookie == "" {
+		return "", false, false
+	}
+	return cookie, true, false
+}
+
+func setSessionCookie(c *gin.Context, cfg config.SessionConfig, name, value, path string, ttl time.Duration, httpOnly bool) {
+	sameSite := http.SameSiteStrictMode
+	switch cfg.CookieSameSite {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.CookieDomain,
+		Secure:   cfg.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite,
+	}
+	if ttl < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(ttl.Seconds())
+		cookie.Expires = time.Now().Add(ttl)
+	}
+	http.SetCookie(c.Writer, cookie)
+}
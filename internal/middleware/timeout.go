@@ -0,0 +1,199 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RouteClass decides how long a route has to answer
+type RouteClass string
+
+const (
+	// RoutePOS is checkout and the till, which should fail fast rather
+	// than leave a queue waiting
+	RoutePOS RouteClass = "pos"
+	// RouteDefault is every route without a class of its own
+	RouteDefault RouteClass = "default"
+	// RouteReport is analytics and reports, which may scan a lot of rows
+	RouteReport RouteClass = "report"
+	// RouteStream is exports and event streams. They have no overall
+	// deadline and are only cancelled when the client goes away.
+	RouteStream RouteClass = "stream"
+)
+
+// timeoutWriteGrace is how long past its deadline a request may still take
+// to write its response, e.g. the error saying it timed out
+const timeoutWriteGrace = 5 * time.Second
+
+const (
+	requestDeadlineKey = "request_deadline"
+	routeClassKey      = "route_class"
+)
+
+// Timeouts gives every request the default route class's deadline. The
+// request context is cancelled when the deadline passes or the client
+// disconnects, so database queries made with it stop too. A route can
+// change its class with Timeout. A request that runs out of time without
+// writing anything gets a 504.
+func (m *SecurityMiddleware) Timeouts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deadline := newRequestDeadline(c.Request.Context())
+		defer deadline.release()
+		c.Set(requestDeadlineKey, deadline)
+		c.Request = c.Request.WithContext(deadline)
+		m.applyTimeout(c, deadline, RouteDefault)
+
+		c.Next()
+
+		if deadline.Err() != context.DeadlineExceeded {
+			return
+		}
+		class := c.GetString(routeClassKey)
+		metrics.RequestTimeouts.Inc(class)
+		logrus.WithFields(logrus.Fields{
+			"path":  c.FullPath(),
+			"class": class,
+		}).Warn("Request timed out")
+		// The envelope writers hold error bodies back until the request is
+		// done, so a status set by the handler means it has answered too
+		if !c.Writer.Written() && c.Writer.Status() == http.StatusOK {
+			c.AbortWithStatusJSON(http.StatusGatewayTimeout, gin.H{
+				"error": "Request timed out",
+				"code":  CodeTimeout,
+			})
+		}
+	}
+}
+
+// Timeout moves the request's deadline to that of class, counted from now
+func (m *SecurityMiddleware) Timeout(class RouteClass) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get(requestDeadlineKey); ok {
+			m.applyTimeout(c, value.(*requestDeadline), class)
+		}
+		c.Next()
+	}
+}
+
+// applyTimeout sets the context and write deadlines of a request in class
+func (m *SecurityMiddleware) applyTimeout(c *gin.Context, deadline *requestDeadline, class RouteClass) {
+	timeout := m.timeoutFor(class)
+	deadline.reset(timeout)
+	c.Set(routeClassKey, string(class))
+
+	var writeDeadline time.Time
+	if timeout > 0 {
+		writeDeadline = time.Now().Add(timeout + timeoutWriteGrace)
+	}
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(writeDeadline); err != nil {
+		logrus.WithError(err).Debug("Failed to set the write deadline of a request")
+	}
+}
+
+// timeoutFor is how long requests in class have to answer; zero for none
+func (m *SecurityMiddleware) timeoutFor(class RouteClass) time.Duration {
+	switch class {
+	case RoutePOS:
+		return m.config.Server.POSTimeout
+	case RouteReport:
+		return m.config.Server.ReportTimeout
+	case RouteStream:
+		return 0
+	}
+	return m.config.Server.RequestTimeout
+}
+
+// requestDeadline is a request context whose deadline can be moved after
+// it was created. Contexts derived from it along the chain, such as the
+// branch scope's, keep following it, which a context.WithTimeout per route
+// couldn't do: a child's deadline can't be later than its parent's.
+type requestDeadline struct {
+	context.Context
+	done chan struct{}
+	stop func() bool
+
+	mu         sync.Mutex
+	deadline   time.Time
+	timer      *time.Timer
+	generation int
+	err        error
+}
+
+func newRequestDeadline(parent context.Context) *requestDeadline {
+	d := &requestDeadline{Context: parent, done: make(chan struct{})}
+	d.stop = context.AfterFunc(parent, func() { d.cancel(parent.Err(), -1) })
+	return d
+}
+
+// reset makes the deadline timeout from now, or removes it when timeout is
+// zero. A deadline that has already passed stays passed.
+func (d *requestDeadline) reset(timeout time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return
+	}
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.generation++
+	d.deadline = time.Time{}
+	if timeout <= 0 {
+		return
+	}
+
+	generation := d.generation
+	d.deadline = time.Now().Add(timeout)
+	d.timer = time.AfterFunc(timeout, func() { d.cancel(context.DeadlineExceeded, generation) })
+}
+
+// cancel ends the context with err. A timer from before the last reset
+// passes its generation so it can't end the context once replaced.
+func (d *requestDeadline) cancel(err error, generation int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil || (generation >= 0 && generation != d.generation) {
+		return
+	}
+	d.err = err
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	close(d.done)
+}
+
+// release frees the context's timer once the request is done
+func (d *requestDeadline) release() {
+	d.stop()
+	d.cancel(context.Canceled, -1)
+}
+
+func (d *requestDeadline) Deadline() (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.deadline.IsZero() {
+		return d.Context.Deadline()
+	}
+	return d.deadline, true
+}
+
+func (d *requestDeadline) Done() <-chan struct{} {
+	return d.done
+}
+
+func (d *requestDeadline) Err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
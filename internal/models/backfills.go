@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// DataBackfill marks a one-off backfill of existing rows as done, so it
+// isn't repeated on every start once the code keeping the data up to date
+// covers everything new
+type DataBackfill struct {
+	Name        string    `gorm:"primaryKey;size:100" json:"name"`
+	Rows        int       `gorm:"not null;default:0" json:"rows"`
+	CompletedAt time.Time `gorm:"not null" json:"completed_at"`
+}
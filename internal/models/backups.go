@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type BackupStatus string
+
+const (
+	BackupRunning   BackupStatus = "running"
+	BackupCompleted BackupStatus = "completed"
+	BackupFailed    BackupStatus = "failed"
+	BackupPruned    BackupStatus = "pruned" // deleted from storage after the retention period
+)
+
+// BackupRun records one database backup uploaded to the backup bucket.
+// Restores verify the downloaded object against its checksum.
+type BackupRun struct {
+	BaseModel
+	ObjectKey   string       `gorm:"size:255;not null;uniqueIndex" json:"object_key"`
+	Status      BackupStatus `gorm:"size:20;not null;index" json:"status"`
+	Encrypted   bool         `gorm:"not null" json:"encrypted"`
+	KeyProvider string       `gorm:"size:20" json:"key_provider,omitempty"` // master key provider that wrapped the backup key
+	SizeBytes   int64        `gorm:"not null;default:0" json:"size_bytes"`
+	Checksum    string       `gorm:"size:64" json:"checksum,omitempty"` // SHA-256 of the stored object
+	StartedAt   time.Time    `gorm:"not null" json:"started_at"`
+	CompletedAt *time.Time   `gorm:"index" json:"completed_at,omitempty"`
+	Error       string       `gorm:"type:text" json:"error,omitempty"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Branch is a pharmacy location. Users, sales, online orders, QR codes and
+// stock movements carry the branch they belong to; a branch's stock of a
+// product is the sum of its stock movements. Rows without a branch come
+// from before branches were set up and are only seen across branches.
+type Branch struct {
+	BaseModel
+	Code     string `gorm:"size:20;not null;uniqueIndex" json:"code" validate:"required,max=20"`
+	Name     string `gorm:"size:200;not null" json:"name" validate:"required,max=200"`
+	Address  string `gorm:"size:500" json:"address"`
+	Phone    string `gorm:"size:20" json:"phone"`
+	IsActive bool   `gorm:"not null;default:true" json:"is_active"`
+
+	// Managers at the head office see reports across all branches
+	IsHeadOffice bool `gorm:"not null;default:false" json:"is_head_office"`
+
+	// TaxRate is the VAT the branch adds, such as 0 at a store in an
+	// economic zone. Nil uses the pharmacy's rate.
+	TaxRate *float64 `gorm:"type:decimal(5,4)" json:"tax_rate"`
+}
+
+// BranchPrice overrides a product's price at one branch
+type BranchPrice struct {
+	BaseModel
+	BranchID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_branch_prices_branch_product" json:"branch_id"`
+	ProductID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_branch_prices_branch_product" json:"product_id"`
+	Product   *Product  `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Price     Money     `gorm:"not null;type:bigint" json:"price"`
+}
+
+// StockTransfer moves stock of a product from one branch to another. The
+// stock leaves the sending branch when it is shipped and reaches the
+// receiving branch when it is received; in between it is in transit and
+// on hand at neither.
+type StockTransfer struct {
+	BaseModel
+	FromBranchID uuid.UUID `gorm:"type:uuid;not null;index" json:"from_branch_id"`
+	FromBranch   *Branch   `gorm:"foreignKey:FromBranchID" json:"from_branch,omitempty"`
+	ToBranchID   uuid.UUID `gorm:"type:uuid;not null;index" json:"to_branch_id"`
+	ToBranch     *Branch   `gorm:"foreignKey:ToBranchID" json:"to_branch,omitempty"`
+
+	ProductID uuid.UUID `gorm:"type:uuid;not null;index" json:"product_id"`
+	Product   *Product  `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity  int       `gorm:"not null" json:"quantity"`
+
+	Status     TransferStatus `gorm:"size:20;not null;default:'in_transit';index" json:"status"`
+	ShippedBy  uuid.UUID      `gorm:"type:uuid;not null" json:"shipped_by"`
+	ShippedAt  time.Time      `gorm:"not null" json:"shipped_at"`
+	ReceivedBy *uuid.UUID     `gorm:"type:uuid" json:"received_by"`
+	ReceivedAt *time.Time     `json:"received_at"`
+	Notes      string         `gorm:"type:text" json:"notes"`
+}
+
+type TransferStatus string
+
+const (
+	TransferStatusInTransit TransferStatus = "in_transit"
+	TransferStatusReceived  TransferStatus = "received"
+)
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CampaignRule is how a campaign finds the customers to message
+type CampaignRule string
+
+const (
+	// Customers whose birthday falls within the next Days (a week by default)
+	CampaignRuleBirthday CampaignRule = "birthday"
+	// Returning customers with no purchase within the last Days (60 by default)
+	CampaignRuleNoRecentPurchase CampaignRule = "no_recent_purchase"
+	// Customers with a scheduled refill due within the next Days
+	CampaignRuleRefillDue CampaignRule = "refill_due"
+)
+
+func (r CampaignRule) IsValid() bool {
+	switch r {
+	case CampaignRuleBirthday, CampaignRuleNoRecentPurchase, CampaignRuleRefillDue:
+		return true
+	}
+	return false
+}
+
+// DefaultDays is the rule window used when a campaign does not set one
+func (r CampaignRule) DefaultDays() int {
+	switch r {
+	case CampaignRuleBirthday:
+		return 7
+	case CampaignRuleNoRecentPurchase:
+		return 60
+	case CampaignRuleRefillDue:
+		return 3
+	}
+	return 0
+}
+
+// Campaign is a templated message sent automatically to the customers its
+// rule matches. Subject and Body may use {{first_name}}, {{last_name}},
+// {{products}} and {{due_date}}; the last two are filled for refill campaigns.
+type Campaign struct {
+	BaseModel
+	Slug    string              `gorm:"uniqueIndex;not null;size:100" json:"slug"`
+	Name    string              `gorm:"not null;size:100" json:"name"`
+	Rule    CampaignRule        `gorm:"not null;size:30" json:"rule"`
+	Days    int                 `gorm:"default:0" json:"days"`
+	Purpose NotificationPurpose `gorm:"not null;size:20" json:"purpose"` // marketing or reminders
+	Subject string              `gorm:"not null;size:255" json:"subject"`
+	Body    string              `gorm:"type:text;not null" json:"body"`
+
+	// Optional segment the campaign is limited to
+	SegmentSlug string `gorm:"size:100" json:"segment_slug,omitempty"`
+
+	// A customer is not messaged by the same campaign again within
+	// CooldownDays. Orders within AttributionDays of a send count towards it.
+	CooldownDays    int `gorm:"not null;default:30" json:"cooldown_days"`
+	AttributionDays int `gorm:"not null;default:7" json:"attribution_days"`
+
+	IsActive  bool       `gorm:"not null;default:false" json:"is_active"`
+	LastRunAt *time.Time `json:"last_run_at"`
+	CreatedBy *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+}
+
+type CampaignSendStatus string
+
+const (
+	CampaignSendQueued     CampaignSendStatus = "queued"
+	CampaignSendSent       CampaignSendStatus = "sent"
+	CampaignSendSuppressed CampaignSendStatus = "suppressed" // customer has not opted in
+	CampaignSendFailed     CampaignSendStatus = "failed"
+)
+
+// CampaignSend is one campaign message to one customer, from queueing through
+// delivery to the first purchase it is credited with
+type CampaignSend struct {
+	BaseModel
+	CampaignID uuid.UUID          `gorm:"type:uuid;not null;index" json:"campaign_id"`
+	CustomerID uuid.UUID          `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Status     CampaignSendStatus `gorm:"not null;size:20;index" json:"status"`
+	Subject    string             `gorm:"size:255" json:"subject"`
+	Body       string             `gorm:"type:text" json:"body"`
+	Channel    string             `gorm:"size:20" json:"channel"`
+	Error      string             `gorm:"type:text" json:"error,omitempty"`
+	QueuedAt   time.Time          `gorm:"not null" json:"queued_at"`
+	SentAt     *time.Time         `gorm:"index" json:"sent_at"`
+
+	// Attribution
+	OrderID      *uuid.UUID `gorm:"type:uuid" json:"order_id,omitempty"`
+	SaleID       *uuid.UUID `gorm:"type:uuid" json:"sale_id,omitempty"`
+	Revenue      Money      `gorm:"type:bigint;default:0" json:"revenue"`
+	AttributedAt *time.Time `json:"attributed_at,omitempty"`
+}
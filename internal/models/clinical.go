@@ -0,0 +1,216 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DrugInteraction is a known interaction between two active ingredients.
+// Ingredient names are stored lowercase with IngredientA < IngredientB so each
+// pair has exactly one row.
+type DrugInteraction struct {
+	BaseModel
+	IngredientA string              `gorm:"not null;size:255;uniqueIndex:idx_drug_interaction_pair" json:"ingredient_a" validate:"required"`
+	IngredientB string              `gorm:"not null;size:255;uniqueIndex:idx_drug_interaction_pair" json:"ingredient_b" validate:"required"`
+	Severity    InteractionSeverity `gorm:"not null;size:20;index" json:"severity" validate:"required"`
+	Description string              `gorm:"type:text;not null" json:"description"`
+	Management  string              `gorm:"type:text" json:"management"`
+	Source      string              `gorm:"size:100" json:"source"` // e.g. DrugBank, RxNorm
+}
+
+// NormalizeIngredientPair lowercases and orders two ingredient names the way
+// DrugInteraction stores them
+func NormalizeIngredientPair(a, b string) (string, string) {
+	a = strings.ToLower(strings.TrimSpace(a))
+	b = strings.ToLower(strings.TrimSpace(b))
+	if b < a {
+		a, b = b, a
+	}
+	return a, b
+}
+
+type InteractionSeverity string
+
+const (
+	InteractionSeverityContraindicated InteractionSeverity = "contraindicated"
+	InteractionSeverityMajor           InteractionSeverity = "major"
+	InteractionSeverityModerate        InteractionSeverity = "moderate"
+	InteractionSeverityMinor           InteractionSeverity = "minor"
+)
+
+// Rank orders severities from most (4) to least (1) severe
+func (s InteractionSeverity) Rank() int {
+	switch s {
+	case InteractionSeverityContraindicated:
+		return 4
+	case InteractionSeverityMajor:
+		return 3
+	case InteractionSeverityModerate:
+		return 2
+	case InteractionSeverityMinor:
+		return 1
+	}
+	return 0
+}
+
+// RequiresAcknowledgement reports whether a pharmacist must acknowledge the
+// interaction before the medication can be dispensed
+func (s InteractionSeverity) RequiresAcknowledgement() bool {
+	return s.Rank() >= InteractionSeverityMajor.Rank()
+}
+
+func (s InteractionSeverity) IsValid() bool {
+	return s.Rank() > 0
+}
+
+// InteractionAcknowledgement records a pharmacist's decision to dispense
+// despite a flagged interaction
+type InteractionAcknowledgement struct {
+	BaseModel
+	CustomerID *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
+	SaleID     *uuid.UUID `gorm:"type:uuid;index" json:"sale_id"`
+	OrderID    *uuid.UUID `gorm:"type:uuid;index" json:"order_id"`
+
+	InteractionKey string              `gorm:"not null;size:255" json:"interaction_key"`
+	Severity       InteractionSeverity `gorm:"not null;size:20" json:"severity"`
+	Notes          string              `gorm:"type:text" json:"notes"`
+
+	AcknowledgedBy uuid.UUID `gorm:"type:uuid;not null" json:"acknowledged_by"`
+	User           *User     `gorm:"foreignKey:AcknowledgedBy" json:"user,omitempty"`
+	AcknowledgedAt time.Time `gorm:"not null" json:"acknowledged_at"`
+}
+
+type ScreeningAlertLevel string
+
+const (
+	// ScreeningAlertBlocking alerts stop dispensing unless overridden with a reason
+	ScreeningAlertBlocking ScreeningAlertLevel = "blocking"
+	// ScreeningAlertAdvisory alerts are shown to the pharmacist but do not block
+	ScreeningAlertAdvisory ScreeningAlertLevel = "advisory"
+)
+
+// ScreeningOverride records a pharmacist dispensing despite a blocking
+// allergy or contraindication alert
+type ScreeningOverride struct {
+	BaseModel
+	CustomerID uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Customer   *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	ProductID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"product_id"`
+	Product    *Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	SaleID     *uuid.UUID `gorm:"type:uuid;index" json:"sale_id"`
+	OrderID    *uuid.UUID `gorm:"type:uuid;index" json:"order_id"`
+
+	AlertKey  string              `gorm:"not null;size:255" json:"alert_key"`
+	AlertType string              `gorm:"not null;size:50" json:"alert_type"` // allergy, contraindication
+	Level     ScreeningAlertLevel `gorm:"not null;size:20" json:"level"`
+	Reason    string              `gorm:"type:text;not null" json:"reason"`
+
+	OverriddenBy uuid.UUID `gorm:"type:uuid;not null" json:"overridden_by"`
+	User         *User     `gorm:"foreignKey:OverriddenBy" json:"user,omitempty"`
+	OverriddenAt time.Time `gorm:"not null" json:"overridden_at"`
+}
+
+// EPrescription records a structured prescription received from a clinic
+// system. Source and ExternalID identify the originating request so a
+// resubmitted bundle is not imported twice.
+type EPrescription struct {
+	BaseModel
+	Source     string `gorm:"not null;size:100;uniqueIndex:idx_eprescription_external" json:"source"`
+	ExternalID string `gorm:"not null;size:255;uniqueIndex:idx_eprescription_external" json:"external_id"`
+
+	CustomerID uuid.UUID    `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Customer   *Customer    `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	ProductID  uuid.UUID    `gorm:"type:uuid;not null" json:"product_id"`
+	Product    *Product     `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	OrderID    uuid.UUID    `gorm:"type:uuid;not null;index" json:"order_id"`
+	Order      *OnlineOrder `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+
+	Medication   string     `gorm:"not null;size:255" json:"medication"` // as written by the prescriber
+	Prescriber   string     `gorm:"size:255" json:"prescriber"`
+	Quantity     int        `gorm:"not null" json:"quantity"`
+	DaysSupply   *int       `json:"days_supply"`
+	Repeats      int        `gorm:"default:0" json:"repeats"`
+	Instructions string     `gorm:"type:text" json:"instructions"`
+	AuthoredOn   *time.Time `json:"authored_on"`
+}
+
+type ClinicalNoteType string
+
+const (
+	ClinicalNoteCounseling   ClinicalNoteType = "counseling"
+	ClinicalNoteIntervention ClinicalNoteType = "intervention"
+)
+
+func (t ClinicalNoteType) IsValid() bool {
+	return t == ClinicalNoteCounseling || t == ClinicalNoteIntervention
+}
+
+type InterventionType string
+
+const (
+	InterventionDoseCorrection     InterventionType = "dose_correction"
+	InterventionPrescriberCallback InterventionType = "prescriber_callback"
+	InterventionDrugInteraction    InterventionType = "drug_interaction"
+	InterventionAllergy            InterventionType = "allergy"
+	InterventionTherapyDuplication InterventionType = "therapy_duplication"
+	InterventionGenericSubstitute  InterventionType = "generic_substitution"
+	InterventionAdherence          InterventionType = "adherence"
+	InterventionOther              InterventionType = "other"
+)
+
+func (t InterventionType) IsValid() bool {
+	switch t {
+	case InterventionDoseCorrection, InterventionPrescriberCallback, InterventionDrugInteraction,
+		InterventionAllergy, InterventionTherapyDuplication, InterventionGenericSubstitute,
+		InterventionAdherence, InterventionOther:
+		return true
+	}
+	return false
+}
+
+type ClinicalNoteOutcome string
+
+const (
+	ClinicalOutcomePending  ClinicalNoteOutcome = "pending"
+	ClinicalOutcomeAccepted ClinicalNoteOutcome = "accepted" // prescriber or patient accepted the recommendation
+	ClinicalOutcomeModified ClinicalNoteOutcome = "modified"
+	ClinicalOutcomeDeclined ClinicalNoteOutcome = "declined"
+	ClinicalOutcomeResolved ClinicalNoteOutcome = "resolved"
+)
+
+func (o ClinicalNoteOutcome) IsValid() bool {
+	switch o {
+	case ClinicalOutcomePending, ClinicalOutcomeAccepted, ClinicalOutcomeModified,
+		ClinicalOutcomeDeclined, ClinicalOutcomeResolved:
+		return true
+	}
+	return false
+}
+
+// ClinicalNote records counseling a pharmacist provided or an intervention
+// they made, such as a dose correction or prescriber callback, and its outcome.
+// The note text is PHI and stored encrypted.
+type ClinicalNote struct {
+	BaseModel
+	CustomerID uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Customer   *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	SaleID     *uuid.UUID `gorm:"type:uuid;index" json:"sale_id"`
+	OrderID    *uuid.UUID `gorm:"type:uuid;index" json:"order_id"`
+	ProductID  *uuid.UUID `gorm:"type:uuid" json:"product_id"`
+	Product    *Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+
+	NoteType         ClinicalNoteType `gorm:"not null;size:20;index" json:"note_type"`
+	InterventionType InterventionType `gorm:"size:50;index" json:"intervention_type,omitempty"`
+	Note             EncryptedString  `gorm:"type:text;not null" json:"note"`
+	Prescriber       string           `gorm:"size:255" json:"prescriber,omitempty"` // contacted prescriber, for callbacks
+
+	Outcome           ClinicalNoteOutcome `gorm:"not null;size:20;default:'pending';index" json:"outcome"`
+	OutcomeNotes      EncryptedString     `gorm:"type:text" json:"outcome_notes"`
+	OutcomeRecordedAt *time.Time          `json:"outcome_recorded_at"`
+
+	RecordedBy uuid.UUID `gorm:"type:uuid;not null;index" json:"recorded_by"`
+	User       *User     `gorm:"foreignKey:RecordedBy" json:"user,omitempty"`
+	RecordedAt time.Time `gorm:"not null;index" json:"recorded_at"`
+}
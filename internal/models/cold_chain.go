@@ -0,0 +1,138 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type StorageUnitKind string
+
+const (
+	StorageUnitRefrigerator StorageUnitKind = "refrigerator"
+	StorageUnitFreezer      StorageUnitKind = "freezer"
+	StorageUnitColdRoom     StorageUnitKind = "cold_room"
+	StorageUnitCoolerBox    StorageUnitKind = "cooler_box" // for deliveries and outreach
+)
+
+func (k StorageUnitKind) IsValid() bool {
+	switch k {
+	case StorageUnitRefrigerator, StorageUnitFreezer, StorageUnitColdRoom, StorageUnitCoolerBox:
+		return true
+	}
+	return false
+}
+
+// StorageUnit is a refrigerator, freezer or cold room whose temperature is
+// logged. Products stored in it name it; their batches are the ones an
+// excursion puts at risk.
+type StorageUnit struct {
+	BaseModel
+	Name     string          `gorm:"size:100;not null" json:"name"`
+	Code     string          `gorm:"size:50;not null;uniqueIndex" json:"code"`
+	Kind     StorageUnitKind `gorm:"size:20;not null" json:"kind"`
+	BranchID *uuid.UUID      `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	Location string          `gorm:"size:100" json:"location"`
+
+	// The range its contents must be kept in, in °C, e.g. 2 to 8 for
+	// vaccines and insulin
+	MinTemperature float64 `gorm:"not null" json:"min_temperature"`
+	MaxTemperature float64 `gorm:"not null" json:"max_temperature"`
+
+	// SensorID is what the unit's data logger calls itself in the readings
+	// it posts
+	SensorID *string `gorm:"size:100;uniqueIndex" json:"sensor_id,omitempty"`
+	IsActive bool    `gorm:"not null;default:true" json:"is_active"`
+
+	LastTemperature *float64   `json:"last_temperature,omitempty"`
+	LastReadingAt   *time.Time `json:"last_reading_at,omitempty"`
+	// Set while the unit is out of range
+	OpenExcursionID *uuid.UUID `gorm:"type:uuid" json:"open_excursion_id,omitempty"`
+}
+
+// Temperature reading sources
+const (
+	ReadingSourceManual = "manual" // written down from the unit's thermometer
+	ReadingSourceSensor = "sensor" // posted by its data logger
+)
+
+// TemperatureReading is one temperature taken in a storage unit. A unit has
+// one reading a moment, so a logger posting a reading again adds nothing.
+type TemperatureReading struct {
+	BaseModel
+	StorageUnitID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_temperature_readings_unit_time" json:"storage_unit_id"`
+	Temperature   float64    `gorm:"not null" json:"temperature"`
+	RecordedAt    time.Time  `gorm:"not null;uniqueIndex:idx_temperature_readings_unit_time" json:"recorded_at"`
+	Source        string     `gorm:"size:20;not null" json:"source"`
+	RecordedBy    *uuid.UUID `gorm:"type:uuid" json:"recorded_by,omitempty"`
+	Notes         string     `gorm:"type:text" json:"notes,omitempty"`
+	OutOfRange    bool       `gorm:"not null;default:false" json:"out_of_range"`
+	ExcursionID   *uuid.UUID `gorm:"type:uuid;index" json:"excursion_id,omitempty"`
+}
+
+type ExcursionStatus string
+
+const (
+	ExcursionOpen     ExcursionStatus = "open"     // the unit is still out of range
+	ExcursionClosed   ExcursionStatus = "closed"   // back in range, waiting for review
+	ExcursionReviewed ExcursionStatus = "reviewed" // a pharmacist decided what happens to the stock
+)
+
+// Batch dispositions after an excursion
+type BatchDisposition string
+
+const (
+	DispositionPending    BatchDisposition = "pending"
+	DispositionUsable     BatchDisposition = "usable"     // within the manufacturer's stability data
+	DispositionQuarantine BatchDisposition = "quarantine" // held until the manufacturer advises
+	DispositionDiscard    BatchDisposition = "discard"
+)
+
+func (d BatchDisposition) IsValid() bool {
+	switch d {
+	case DispositionUsable, DispositionQuarantine, DispositionDiscard:
+		return true
+	}
+	return false
+}
+
+// TemperatureExcursion is a stretch of time a storage unit spent outside
+// its range, from the first reading out of range to the first back in it,
+// and the report of what it meant for the batches stored there
+type TemperatureExcursion struct {
+	BaseModel
+	StorageUnitID uuid.UUID    `gorm:"type:uuid;not null;index" json:"storage_unit_id"`
+	StorageUnit   *StorageUnit `gorm:"foreignKey:StorageUnitID" json:"storage_unit,omitempty"`
+
+	Status    ExcursionStatus `gorm:"size:20;not null;index" json:"status"`
+	StartedAt time.Time       `gorm:"not null" json:"started_at"`
+	EndedAt   *time.Time      `json:"ended_at,omitempty"`
+
+	// The range at the time and the extremes reached
+	MinTemperature float64 `gorm:"not null" json:"min_temperature"`
+	MaxTemperature float64 `gorm:"not null" json:"max_temperature"`
+	LowestReading  float64 `gorm:"not null" json:"lowest_reading"`
+	HighestReading float64 `gorm:"not null" json:"highest_reading"`
+	ReadingCount   int     `gorm:"not null;default:0" json:"reading_count"`
+
+	Cause      string     `gorm:"type:text" json:"cause,omitempty"`
+	Action     string     `gorm:"type:text" json:"action,omitempty"` // what was done about it
+	ReviewedBy *uuid.UUID `gorm:"type:uuid" json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+
+	Batches []ExcursionBatch `gorm:"foreignKey:ExcursionID" json:"batches,omitempty"`
+}
+
+// ExcursionBatch is a batch that was in the storage unit when an excursion
+// began, as it stood then, and what is to be done with it
+type ExcursionBatch struct {
+	BaseModel
+	ExcursionID uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex:idx_excursion_batches_product" json:"excursion_id"`
+	ProductID   uuid.UUID        `gorm:"type:uuid;not null;uniqueIndex:idx_excursion_batches_product;index" json:"product_id"`
+	Product     *Product         `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	BatchNumber string           `gorm:"size:100;index" json:"batch_number"`
+	ExpiryDate  *time.Time       `json:"expiry_date,omitempty"`
+	Quantity    int              `gorm:"not null" json:"quantity"` // in stock when the excursion began
+	Disposition BatchDisposition `gorm:"size:20;not null;default:'pending'" json:"disposition"`
+	Notes       string           `gorm:"type:text" json:"notes,omitempty"`
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// NotificationPurpose classifies why a customer is being contacted
+type NotificationPurpose string
+
+const (
+	PurposeTransactional NotificationPurpose = "transactional" // order and prescription updates
+	PurposeReminders     NotificationPurpose = "reminders"     // refill and next-dose reminders
+	PurposeMarketing     NotificationPurpose = "marketing"
+)
+
+func (p NotificationPurpose) IsValid() bool {
+	switch p {
+	case PurposeTransactional, PurposeReminders, PurposeMarketing:
+		return true
+	}
+	return false
+}
+
+// DefaultOptIn is the preference assumed when the customer has not chosen.
+// Marketing always requires an explicit opt-in.
+func (p NotificationPurpose) DefaultOptIn() bool {
+	return p != PurposeMarketing
+}
+
+// CommunicationPreference records whether a customer accepts messages for a
+// purpose over a channel. Each row carries its own unsubscribe token so a
+// link in a message only affects that channel and purpose.
+type CommunicationPreference struct {
+	BaseModel
+	CustomerID uuid.UUID           `gorm:"type:uuid;not null;uniqueIndex:idx_comm_pref" json:"customer_id"`
+	Channel    string              `gorm:"not null;size:20;uniqueIndex:idx_comm_pref" json:"channel"`
+	Purpose    NotificationPurpose `gorm:"not null;size:20;uniqueIndex:idx_comm_pref" json:"purpose"`
+	OptedIn    bool                `gorm:"not null" json:"opted_in"`
+	Source     string              `gorm:"size:20" json:"source"` // staff, customer, unsubscribe_link
+
+	UnsubscribeToken string `gorm:"uniqueIndex;not null;size:64" json:"-"`
+}
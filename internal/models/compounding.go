@@ -0,0 +1,108 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CompoundFormula is the master formula of a preparation the pharmacy
+// makes itself, such as an oral suspension or a cream: the stocked
+// products that go into one batch, what a batch yields and how long it
+// keeps once made
+type CompoundFormula struct {
+	BaseModel
+	Code         string  `gorm:"size:50;not null;uniqueIndex" json:"code"`
+	Name         string  `gorm:"size:255;not null" json:"name"`
+	DosageForm   string  `gorm:"size:100;not null" json:"dosage_form"` // e.g. suspension, cream, capsule
+	Strength     *string `gorm:"size:100" json:"strength,omitempty"`
+	Method       string  `gorm:"type:text" json:"method"`                 // compounding instructions
+	Instructions *string `gorm:"type:text" json:"instructions,omitempty"` // directions for the patient, printed on the label
+
+	// One batch makes YieldQuantity of YieldUnit, e.g. 100 ml
+	YieldQuantity int    `gorm:"not null" json:"yield_quantity"`
+	YieldUnit     string `gorm:"size:50;not null" json:"yield_unit"`
+
+	// Days a preparation keeps once made. Its beyond-use date is never past
+	// the expiry of an ingredient it was made from.
+	BeyondUseDays     int    `gorm:"not null" json:"beyond_use_days"`
+	StorageConditions string `gorm:"size:255" json:"storage_conditions"`
+
+	LaborFee             Money `gorm:"type:bigint;not null;default:0" json:"labor_fee"` // per batch, on top of the ingredients
+	PrescriptionRequired bool  `gorm:"not null;default:true" json:"prescription_required"`
+	IsActive             bool  `gorm:"not null;default:true" json:"is_active"`
+
+	Ingredients []CompoundIngredient `gorm:"foreignKey:FormulaID" json:"ingredients,omitempty"`
+}
+
+// CompoundIngredient is a stocked product a formula takes, in the product's
+// stock units per batch
+type CompoundIngredient struct {
+	BaseModel
+	FormulaID uuid.UUID `gorm:"type:uuid;not null;index" json:"formula_id"`
+	ProductID uuid.UUID `gorm:"type:uuid;not null;index" json:"product_id"`
+	Product   *Product  `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity  int       `gorm:"not null" json:"quantity"`
+}
+
+type PreparationStatus string
+
+const (
+	PreparationStatusRequested  PreparationStatus = "requested"
+	PreparationStatusInProgress PreparationStatus = "in_progress"
+	PreparationStatusCompleted  PreparationStatus = "completed" // made and labeled, ready to sell
+	PreparationStatusDispensed  PreparationStatus = "dispensed" // sold
+	PreparationStatusCancelled  PreparationStatus = "cancelled"
+)
+
+// CompoundPreparation is an order to make a formula, usually for one
+// patient's prescription. Completing it takes its ingredients out of stock
+// and gives it a lot number and beyond-use date; it is then sold as a line
+// of a sale.
+type CompoundPreparation struct {
+	BaseModel
+	PreparationNumber string           `gorm:"size:50;not null;uniqueIndex" json:"preparation_number"` // also its lot number
+	FormulaID         uuid.UUID        `gorm:"type:uuid;not null;index" json:"formula_id"`
+	Formula           *CompoundFormula `gorm:"foreignKey:FormulaID" json:"formula,omitempty"`
+	BranchID          *uuid.UUID       `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+
+	CustomerID         *uuid.UUID `gorm:"type:uuid;index" json:"customer_id,omitempty"`
+	Customer           *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	PrescriptionNumber *string    `gorm:"size:100" json:"prescription_number,omitempty"`
+	Batches            int        `gorm:"not null;default:1" json:"batches"` // how many batches of the formula to make
+	Instructions       *string    `gorm:"type:text" json:"instructions,omitempty"`
+	Notes              string     `gorm:"type:text" json:"notes"`
+
+	Status PreparationStatus `gorm:"size:20;not null;default:'requested';index" json:"status"`
+
+	// Set when it is completed
+	PreparedBy     *uuid.UUID              `gorm:"type:uuid" json:"prepared_by,omitempty"`
+	PreparedAt     *time.Time              `json:"prepared_at,omitempty"`
+	BeyondUseDate  *time.Time              `json:"beyond_use_date,omitempty"`
+	IngredientCost Money                   `gorm:"type:bigint;not null;default:0" json:"ingredient_cost"`
+	LaborFee       Money                   `gorm:"type:bigint;not null;default:0" json:"labor_fee"`
+	Price          Money                   `gorm:"type:bigint;not null;default:0" json:"price"` // the ingredients at selling price, plus the labor fee
+	Ingredients    []PreparationIngredient `gorm:"foreignKey:PreparationID" json:"ingredients,omitempty"`
+
+	// Set when it is sold
+	SaleID      *uuid.UUID `gorm:"type:uuid;index" json:"sale_id,omitempty"`
+	DispensedAt *time.Time `json:"dispensed_at,omitempty"`
+
+	CancelledBy *uuid.UUID `gorm:"type:uuid" json:"cancelled_by,omitempty"`
+	CancelledAt *time.Time `json:"cancelled_at,omitempty"`
+	RequestedBy *uuid.UUID `gorm:"type:uuid" json:"requested_by,omitempty"`
+}
+
+// PreparationIngredient is the stock a completed preparation took, with the
+// batch and expiry it came from for traceability
+type PreparationIngredient struct {
+	BaseModel
+	PreparationID uuid.UUID  `gorm:"type:uuid;not null;index" json:"preparation_id"`
+	ProductID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"product_id"`
+	Product       *Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	Quantity      int        `gorm:"not null" json:"quantity"`
+	UnitCost      Money      `gorm:"type:bigint;not null" json:"unit_cost"`
+	UnitPrice     Money      `gorm:"type:bigint;not null" json:"unit_price"`
+	BatchNumber   string     `gorm:"size:100" json:"batch_number"`
+	ExpiryDate    *time.Time `json:"expiry_date,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// CSPViolation aggregates Content-Security-Policy violation reports sent by
+// browsers. Reports with the same directive, blocked resource and page are
+// counted on one row.
+type CSPViolation struct {
+	BaseModel
+	Directive   string    `gorm:"size:100;not null;uniqueIndex:idx_csp_violations_report" json:"directive"`
+	BlockedURI  string    `gorm:"size:500;not null;uniqueIndex:idx_csp_violations_report" json:"blocked_uri"`
+	DocumentURI string    `gorm:"size:500;not null;uniqueIndex:idx_csp_violations_report" json:"document_uri"`
+	SourceFile  string    `gorm:"size:500" json:"source_file,omitempty"`
+	Disposition string    `gorm:"size:20" json:"disposition,omitempty"` // enforce or report
+	Count       int       `gorm:"not null;default:0" json:"count"`
+	FirstSeenAt time.Time `gorm:"not null" json:"first_seen_at"`
+	LastSeenAt  time.Time `gorm:"not null;index" json:"last_seen_at"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import "strings"
+
+// ExchangeRate is what one unit of a foreign currency is worth in the
+// pharmacy's own currency, for customers paying in it. Prices, totals and
+// reports are always in the pharmacy's currency.
+type ExchangeRate struct {
+	BaseModel
+	Currency string  `gorm:"size:3;not null;uniqueIndex" json:"currency"`
+	Rate     float64 `gorm:"not null;type:decimal(18,6)" json:"rate"`
+}
+
+// minorUnits are the decimal places of currencies that don't use two
+var minorUnits = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"IDR": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+// MinorUnits returns the number of decimal places amounts in the currency
+// are kept to
+func MinorUnits(currency string) int {
+	if places, ok := minorUnits[currency]; ok {
+		return places
+	}
+	return 2
+}
+
+// RoundAmount rounds an amount to the currency's smallest unit, halves
+// away from zero. Amounts are kept to the centavo, so currencies with three
+// decimal places keep two.
+func RoundAmount(amount Money, currency string) Money {
+	return amount.Round(MinorUnits(currency))
+}
+
+// FormatAmount writes an amount the way receipts and messages show it,
+// such as "PHP 1,234.50" or "JPY 1,235"
+func FormatAmount(amount Money, currency string) string {
+	rounded := RoundAmount(amount, currency)
+	digits := rounded.String()
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if places := MinorUnits(currency); places < 2 {
+		fraction = fraction[:places]
+	}
+
+	var b strings.Builder
+	b.WriteString(currency)
+	b.WriteByte(' ')
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteByte('.')
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
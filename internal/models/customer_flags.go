@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FlagSeverity is how prominently a customer flag is shown at the counter
+type FlagSeverity string
+
+const (
+	FlagSeverityInfo     FlagSeverity = "info"     // e.g. "prefers generics"
+	FlagSeverityWarning  FlagSeverity = "warning"  // e.g. "verify ID every time"
+	FlagSeverityCritical FlagSeverity = "critical" // must be acted on before dispensing
+)
+
+func (s FlagSeverity) IsValid() bool {
+	switch s {
+	case FlagSeverityInfo, FlagSeverityWarning, FlagSeverityCritical:
+		return true
+	}
+	return false
+}
+
+// CustomerFlag is a staff note shown whenever the customer is looked up at
+// the POS or their QR code is scanned by staff. Resolved flags are kept for
+// history but no longer shown.
+type CustomerFlag struct {
+	BaseModel
+	CustomerID uuid.UUID    `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Note       string       `gorm:"type:text;not null" json:"note"`
+	Severity   FlagSeverity `gorm:"not null;size:20;default:'info'" json:"severity"`
+
+	AuthorID   *uuid.UUID `gorm:"type:uuid" json:"author_id"`
+	Author     *User      `gorm:"foreignKey:AuthorID" json:"author,omitempty"`
+	UpdatedBy  *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"`
+	ResolvedAt *time.Time `gorm:"index" json:"resolved_at,omitempty"`
+	ResolvedBy *uuid.UUID `gorm:"type:uuid" json:"resolved_by,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "fmt"
+
+// CustomerPHIFields are the JSON names of the customer fields withheld from
+// roles without medical_data read permission. Staff with break-glass
+// permission can reveal them one customer at a time.
+var CustomerPHIFields = []string{
+	"medical_history",
+	"allergies",
+	"current_medications",
+	"blood_type",
+	"insurance_provider",
+	"insurance_number",
+}
+
+// IsCustomerPHIField reports whether name is one of CustomerPHIFields
+func IsCustomerPHIField(name string) bool {
+	for _, field := range CustomerPHIFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PHIValues decrypts the named PHI fields, keyed by JSON name
+func (c *Customer) PHIValues(fields []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		var value interface{}
+		var err error
+		switch field {
+		case "medical_history":
+			value, err = c.MedicalHistory.Get()
+		case "allergies":
+			value, err = c.Allergies.Get()
+		case "current_medications":
+			value, err = c.CurrentMedications.Get()
+		case "blood_type":
+			value, err = c.BloodType.Get()
+		case "insurance_provider":
+			value, err = c.InsuranceProvider.Get()
+		case "insurance_number":
+			value, err = c.InsuranceNumber.Get()
+		default:
+			return nil, fmt.Errorf("%s is not a PHI field", field)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", field, err)
+		}
+		values[field] = value
+	}
+	return values, nil
+}
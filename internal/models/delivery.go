@@ -0,0 +1,29 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// DeliveryZone is an area a branch delivers to: everywhere within RadiusKM
+// of a center point, usually the branch itself. Delivery costs BaseFee plus
+// FeePerKM for every kilometre, or part of one, past IncludedKM, measured
+// in a straight line from the center.
+type DeliveryZone struct {
+	BaseModel
+	Name string `gorm:"size:100;not null" json:"name" validate:"required,max=100"`
+
+	// Branch that fills orders delivered in the zone. Zones without one
+	// take orders for any branch.
+	BranchID *uuid.UUID `gorm:"type:uuid;index" json:"branch_id"`
+	Branch   *Branch    `gorm:"foreignKey:BranchID" json:"branch,omitempty"`
+
+	Latitude  float64 `gorm:"not null" json:"latitude"`
+	Longitude float64 `gorm:"not null" json:"longitude"`
+	RadiusKM  float64 `gorm:"not null" json:"radius_km"`
+
+	BaseFee    Money   `gorm:"not null;type:bigint;default:0" json:"base_fee"`
+	FeePerKM   Money   `gorm:"not null;type:bigint;default:0" json:"fee_per_km"`
+	IncludedKM float64 `gorm:"not null;default:0" json:"included_km"`
+
+	IsActive bool `gorm:"not null;default:true" json:"is_active"`
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type DocumentType string
+
+const (
+	DocumentPharmacyLicense       DocumentType = "pharmacy_license"       // FDA License to Operate of a branch
+	DocumentPRCLicense            DocumentType = "prc_license"            // a pharmacist's PRC professional license
+	DocumentS2License             DocumentType = "s2_license"             // PDEA license to handle dangerous drugs
+	DocumentSupplierAccreditation DocumentType = "supplier_accreditation" // a supplier's FDA license or accreditation
+	DocumentOther                 DocumentType = "other"
+)
+
+func (t DocumentType) IsValid() bool {
+	switch t {
+	case DocumentPharmacyLicense, DocumentPRCLicense, DocumentS2License, DocumentSupplierAccreditation, DocumentOther:
+		return true
+	}
+	return false
+}
+
+// DocumentStatus is where a document stands against its expiry date
+type DocumentStatus string
+
+const (
+	DocumentValid    DocumentStatus = "valid"
+	DocumentExpiring DocumentStatus = "expiring" // expires within the dashboard's window
+	DocumentExpired  DocumentStatus = "expired"
+	DocumentRenewed  DocumentStatus = "renewed" // replaced by its renewal
+)
+
+// ComplianceDocument is a license, permit or accreditation the pharmacy
+// keeps on file, with the scanned copy. A pharmacy license or S2 license
+// belongs to a branch, a PRC or S2 license to the pharmacist holding it, an
+// accreditation to a supplier. Renewing one files the new document and
+// keeps the old one as history.
+type ComplianceDocument struct {
+	BaseModel
+	Type      DocumentType `gorm:"size:30;not null;index" json:"type"`
+	Title     string       `gorm:"size:255;not null" json:"title"`
+	Number    string       `gorm:"size:100" json:"number"`    // license or certificate number
+	IssuedBy  string       `gorm:"size:255" json:"issued_by"` // e.g. FDA, PRC, PDEA
+	IssuedAt  *time.Time   `json:"issued_at,omitempty"`
+	ExpiresAt *time.Time   `gorm:"index" json:"expires_at,omitempty"` // empty when it doesn't expire
+	Notes     string       `gorm:"type:text" json:"notes"`
+
+	BranchID   *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"` // the pharmacist a license is issued to
+	User       *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	SupplierID *uuid.UUID `gorm:"type:uuid;index" json:"supplier_id,omitempty"`
+	Supplier   *Supplier  `gorm:"foreignKey:SupplierID" json:"supplier,omitempty"`
+
+	// The scanned copy, in the file store
+	FileKey     string `gorm:"size:255" json:"-"`
+	FileName    string `gorm:"size:255" json:"file_name,omitempty"`
+	ContentType string `gorm:"size:100" json:"content_type,omitempty"`
+
+	// Set on the old document when it is renewed
+	RenewedByID *uuid.UUID `gorm:"type:uuid;index" json:"renewed_by_id,omitempty"`
+
+	// The fewest days before expiry a renewal reminder was sent for, so each
+	// reminder goes out once
+	RemindedDays *int       `json:"reminded_days,omitempty"`
+	RemindedAt   *time.Time `json:"reminded_at,omitempty"`
+
+	CreatedBy *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"`
+}
+
+// Status reports where the document stands at now, counting it expiring
+// when it expires within expiringDays
+func (d *ComplianceDocument) Status(now time.Time, expiringDays int) DocumentStatus {
+	switch {
+	case d.RenewedByID != nil:
+		return DocumentRenewed
+	case d.ExpiresAt == nil:
+		return DocumentValid
+	case !d.ExpiresAt.After(now):
+		return DocumentExpired
+	case d.ExpiresAt.Before(now.AddDate(0, 0, expiringDays)):
+		return DocumentExpiring
+	}
+	return DocumentValid
+}
+
+// DaysLeft is the whole days from now until the document expires, negative
+// once it has
+func (d *ComplianceDocument) DaysLeft(now time.Time) *int {
+	if d.ExpiresAt == nil {
+		return nil
+	}
+	days := int(math.Floor(d.ExpiresAt.Sub(now).Hours() / 24))
+	return &days
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// EligibilityStatus tracks staff verification of a customer's senior citizen
+// or PWD ID
+type EligibilityStatus string
+
+const (
+	EligibilityNone     EligibilityStatus = ""
+	EligibilityPending  EligibilityStatus = "pending"
+	EligibilityVerified EligibilityStatus = "verified"
+	EligibilityRejected EligibilityStatus = "rejected"
+)
+
+// Discount types recorded on orders
+const (
+	DiscountTypeSeniorCitizen = "senior_citizen"
+	DiscountTypePWD           = "pwd"
+)
+
+// ActiveDiscountType returns the statutory discount the customer is entitled
+// to at the given time, or "" if none. The ID must have been verified by
+// staff.
+func (c *Customer) ActiveDiscountType(at time.Time) string {
+	if c.EligibilityStatus != EligibilityVerified {
+		return ""
+	}
+	return c.ClaimedDiscountType(at)
+}
+
+// ClaimedDiscountType returns the discount the customer's unexpired IDs
+// would entitle them to, regardless of verification. Senior citizen takes
+// priority over PWD since the two cannot be combined.
+func (c *Customer) ClaimedDiscountType(at time.Time) string {
+	if c.IsSeniorCitizen && !expired(c.SeniorCitizenIDExpiry, at) {
+		return DiscountTypeSeniorCitizen
+	}
+	if c.IsPWD && !expired(c.PWDIdExpiry, at) {
+		return DiscountTypePWD
+	}
+	return ""
+}
+
+// EligibilityClaimsChanged reports whether the discount flags, ID numbers or
+// expiry dates differ from prev, which means the ID must be verified again
+func (c *Customer) EligibilityClaimsChanged(prev *Customer) bool {
+	return c.IsSeniorCitizen != prev.IsSeniorCitizen ||
+		c.IsPWD != prev.IsPWD ||
+		c.SeniorCitizenID.String() != prev.SeniorCitizenID.String() ||
+		c.PWDId.String() != prev.PWDId.String() ||
+		!sameDate(c.SeniorCitizenIDExpiry, prev.SeniorCitizenIDExpiry) ||
+		!sameDate(c.PWDIdExpiry, prev.PWDIdExpiry)
+}
+
+// CopyEligibilityVerification copies the staff verification fields from src,
+// so they cannot be set through the general customer endpoints
+func (c *Customer) CopyEligibilityVerification(src *Customer) {
+	c.EligibilityStatus = src.EligibilityStatus
+	c.EligibilityVerifiedBy = src.EligibilityVerifiedBy
+	c.EligibilityVerifiedAt = src.EligibilityVerifiedAt
+	c.EligibilityNotes = src.EligibilityNotes
+}
+
+// expired reports whether an optional expiry date has passed. The ID is still
+// valid on its expiry date. Senior citizen IDs are often issued without one.
+func expired(expiry *time.Time, at time.Time) bool {
+	return expiry != nil && !at.Before(expiry.AddDate(0, 0, 1))
+}
+
+func sameDate(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
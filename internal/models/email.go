@@ -0,0 +1,42 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+type EmailSuppressionReason string
+
+const (
+	SuppressionBounce      EmailSuppressionReason = "bounce"      // the address does not exist or rejects our mail
+	SuppressionComplaint   EmailSuppressionReason = "complaint"   // the recipient marked our mail as spam
+	SuppressionUnsubscribe EmailSuppressionReason = "unsubscribe" // unsubscribed through the provider's link
+	SuppressionManual      EmailSuppressionReason = "manual"
+)
+
+// IsValid reports whether the reason is a known one
+func (r EmailSuppressionReason) IsValid() bool {
+	switch r {
+	case SuppressionBounce, SuppressionComplaint, SuppressionUnsubscribe, SuppressionManual:
+		return true
+	}
+	return false
+}
+
+// BlocksTransactional reports whether mail the recipient can't opt out of,
+// such as order confirmations and password resets, is held back too.
+// Unsubscribing only stops reminders and marketing.
+func (r EmailSuppressionReason) BlocksTransactional() bool {
+	return r != SuppressionUnsubscribe
+}
+
+// EmailSuppression is an address that is no longer emailed, because it
+// bounced, complained or unsubscribed with the provider, or was added by
+// staff. Deleting the row lets mail through again.
+type EmailSuppression struct {
+	BaseModel
+	Email     string                 `gorm:"uniqueIndex;not null;size:255" json:"email"` // lower case
+	Reason    EmailSuppressionReason `gorm:"size:20;not null;index" json:"reason"`
+	Source    string                 `gorm:"size:20;not null" json:"source"` // sendgrid, smtp or staff
+	Detail    string                 `gorm:"type:text" json:"detail,omitempty"`
+	CreatedBy *uuid.UUID             `gorm:"type:uuid" json:"created_by,omitempty"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// EncryptionKey is a data key used for EncryptedString columns, stored
+// wrapped (encrypted) by the master key so the database alone can't decrypt
+// anything. The active key encrypts new values; older keys are kept so data
+// they wrote stays readable until it has been re-encrypted.
+type EncryptionKey struct {
+	BaseModel
+	KeyID      string     `gorm:"uniqueIndex;not null;size:20" json:"key_id"` // prefix on ciphertexts, e.g. v2
+	Version    int        `gorm:"uniqueIndex;not null" json:"version"`
+	WrappedKey string     `gorm:"type:text;not null" json:"-"`
+	Provider   string     `gorm:"size:20;not null" json:"provider"` // master key provider that wrapped it: local, vault or kms
+	Active     bool       `gorm:"not null;default:false" json:"active"`
+	RetiredAt  *time.Time `json:"retired_at"` // when a newer key replaced it
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RegulatoryStatus is where a product stands with the FDA Philippines
+// registry
+type RegulatoryStatus string
+
+const (
+	RegulatoryRegistered   RegulatoryStatus = "registered"
+	RegulatoryUnregistered RegulatoryStatus = "unregistered" // the number is not in the registry
+	RegulatoryExpired      RegulatoryStatus = "expired"      // the registration has lapsed
+	RegulatoryRecalled     RegulatoryStatus = "recalled"     // a recall covers the product or its batch
+	RegulatoryMissing      RegulatoryStatus = "missing"      // a drug without a registration number
+	RegulatoryUnchecked    RegulatoryStatus = "unchecked"    // no registry loaded yet, or none needed
+)
+
+// Flagged reports whether the product should not be sold until someone
+// looks at it
+func (s RegulatoryStatus) Flagged() bool {
+	switch s {
+	case RegulatoryUnregistered, RegulatoryExpired, RegulatoryRecalled, RegulatoryMissing:
+		return true
+	}
+	return false
+}
+
+// FDARegistration is a product registration from the FDA Philippines
+// registered-products dataset, cached locally. The cache is replaced by
+// each refresh.
+type FDARegistration struct {
+	BaseModel
+	RegistrationNumber string     `gorm:"size:50;not null;uniqueIndex" json:"registration_number"`
+	GenericName        string     `gorm:"size:500;index" json:"generic_name"`
+	BrandName          string     `gorm:"size:255;index" json:"brand_name"`
+	DosageStrength     string     `gorm:"size:255" json:"dosage_strength"`
+	DosageForm         string     `gorm:"size:255" json:"dosage_form"`
+	Classification     string     `gorm:"size:100" json:"classification"` // e.g. prescription drug, OTC
+	Manufacturer       string     `gorm:"size:500" json:"manufacturer"`
+	Country            string     `gorm:"size:100" json:"country"`
+	Distributor        string     `gorm:"size:500" json:"distributor"` // trader, importer or distributor
+	IssuedAt           *time.Time `json:"issued_at,omitempty"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty"`
+	RefreshedAt        time.Time  `gorm:"not null;index" json:"refreshed_at"` // when the dataset last listed it
+}
+
+// Recall sources
+const (
+	RecallSourceFeed   = "feed"   // from FDA_RECALLS_URL, replaced by each refresh
+	RecallSourceManual = "manual" // entered by staff from an FDA advisory
+)
+
+// FDARecall is a recall or ban of a registered product from an FDA
+// advisory, for every batch or only one
+type FDARecall struct {
+	BaseModel
+	RegistrationNumber string     `gorm:"size:50;not null;index" json:"registration_number"`
+	BatchNumber        string     `gorm:"size:100" json:"batch_number,omitempty"` // every batch when empty
+	Advisory           string     `gorm:"size:255" json:"advisory"`               // e.g. FDA Advisory No. 2024-1234
+	Reason             string     `gorm:"type:text" json:"reason"`
+	IssuedAt           *time.Time `json:"issued_at,omitempty"`
+	Source             string     `gorm:"size:20;not null" json:"source"`
+	CreatedBy          *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Feedback is a customer's rating of an online order, asked for once the
+// order reached them. It is created when the order is delivered or picked
+// up, with a token for the feedback link, and filled in by the response.
+type Feedback struct {
+	BaseModel
+	OrderID    uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex" json:"order_id"`
+	Order      *OnlineOrder `gorm:"foreignKey:OrderID" json:"order,omitempty"`
+	CustomerID *uuid.UUID   `gorm:"type:uuid;index" json:"customer_id"`
+	Customer   *Customer    `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	BranchID   *uuid.UUID   `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+
+	// StaffID is the pharmacist on the order, or whoever handed it over
+	StaffID *uuid.UUID `gorm:"type:uuid;index" json:"staff_id"`
+	Staff   *User      `gorm:"foreignKey:StaffID" json:"staff,omitempty"`
+
+	// Token is the customer's feedback link, also behind its QR code
+	Token         string     `gorm:"uniqueIndex;not null;size:64" json:"-"`
+	QRCodeID      *uuid.UUID `gorm:"type:uuid" json:"qr_code_id,omitempty"`
+	QRCode        *QRCode    `gorm:"foreignKey:QRCodeID" json:"qr_code,omitempty"`
+	ExpiresAt     time.Time  `gorm:"not null" json:"expires_at"`
+	InvitedAt     *time.Time `json:"invited_at,omitempty"`
+	InviteChannel string     `gorm:"size:20" json:"invite_channel,omitempty"`
+
+	Status      FeedbackStatus `gorm:"not null;size:20;default:'requested';index" json:"status"`
+	Rating      *int           `json:"rating"`    // 1 to 5 stars
+	NPSScore    *int           `json:"nps_score"` // 0 to 10, how likely they are to recommend us
+	Comment     string         `gorm:"type:text" json:"comment"`
+	SubmittedAt *time.Time     `gorm:"index" json:"submitted_at"`
+
+	// Moderation decides whether the comment may be shown publicly
+	ModeratedBy    *uuid.UUID `gorm:"type:uuid" json:"moderated_by,omitempty"`
+	ModeratedAt    *time.Time `json:"moderated_at,omitempty"`
+	ModerationNote string     `gorm:"size:500" json:"moderation_note,omitempty"`
+}
+
+type FeedbackStatus string
+
+const (
+	FeedbackStatusRequested FeedbackStatus = "requested" // waiting on the customer
+	FeedbackStatusReceived  FeedbackStatus = "received"  // waiting on moderation
+	FeedbackStatusPublished FeedbackStatus = "published"
+	FeedbackStatusHidden    FeedbackStatus = "hidden" // spam or abuse, left out of reports too
+)
+
+// Answered reports whether the customer has responded
+func (s FeedbackStatus) Answered() bool {
+	return s != FeedbackStatusRequested && s != ""
+}
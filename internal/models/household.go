@@ -0,0 +1,24 @@
+package models
+
+// DependentRelationship is how a dependent is related to their guardian
+type DependentRelationship string
+
+const (
+	RelationshipChild  DependentRelationship = "child"
+	RelationshipParent DependentRelationship = "parent"
+	RelationshipSpouse DependentRelationship = "spouse"
+	RelationshipOther  DependentRelationship = "other"
+)
+
+func (r DependentRelationship) IsValid() bool {
+	switch r {
+	case RelationshipChild, RelationshipParent, RelationshipSpouse, RelationshipOther:
+		return true
+	}
+	return false
+}
+
+// IsDependent reports whether the customer is managed by a guardian
+func (c *Customer) IsDependent() bool {
+	return c.GuardianID != nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InsuranceClaim is a claim to an HMO for the part of a sale it covers,
+// made under the letter of authorization (LOA) the HMO issued the member.
+// The pharmacy is owed the claim until the HMO pays it.
+type InsuranceClaim struct {
+	BaseModel
+	SaleID      uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex" json:"sale_id"`
+	Sale        *Sale      `gorm:"foreignKey:SaleID" json:"sale,omitempty"`
+	CustomerID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Customer    *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	BranchID    *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	ClaimNumber string     `gorm:"size:50;not null;uniqueIndex" json:"claim_number"`
+
+	// HMO membership, defaulting to the customer's insurance details
+	Provider     string          `gorm:"size:100;not null;index" json:"provider"` // e.g. Maxicare, Intellicare
+	MemberNumber EncryptedString `gorm:"size:255" json:"member_number"`
+	Company      string          `gorm:"size:255" json:"company,omitempty"` // employer whose plan covers the member
+
+	// Letter of authorization
+	LOANumber    string          `gorm:"size:100;not null" json:"loa_number"`
+	LOAIssuedAt  *time.Time      `json:"loa_issued_at,omitempty"`
+	LOAExpiresAt *time.Time      `json:"loa_expires_at,omitempty"`
+	Physician    string          `gorm:"size:255" json:"physician,omitempty"`
+	Diagnosis    EncryptedString `gorm:"type:text" json:"diagnosis"` // ICD-10 code or description
+
+	// Amounts. The member pays their share at the counter; the HMO is
+	// claimed for the rest.
+	SaleTotal      Money  `gorm:"not null;type:bigint" json:"sale_total"`
+	PatientShare   Money  `gorm:"not null;type:bigint;default:0" json:"patient_share"`
+	ClaimedAmount  Money  `gorm:"not null;type:bigint" json:"claimed_amount"`
+	ApprovedAmount *Money `gorm:"type:bigint" json:"approved_amount,omitempty"`
+	PaidAmount     Money  `gorm:"not null;type:bigint;default:0" json:"paid_amount"`
+
+	Status           ClaimStatus `gorm:"not null;size:20;default:'pending';index" json:"status"`
+	SubmittedAt      *time.Time  `json:"submitted_at,omitempty"`
+	DecidedAt        *time.Time  `json:"decided_at,omitempty"` // approved or denied
+	PaidAt           *time.Time  `json:"paid_at,omitempty"`
+	DenialReason     string      `gorm:"type:text" json:"denial_reason,omitempty"`
+	PaymentReference string      `gorm:"size:100" json:"payment_reference,omitempty"`
+	Notes            string      `gorm:"type:text" json:"notes,omitempty"`
+
+	CreatedBy *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"`
+}
+
+type ClaimStatus string
+
+const (
+	ClaimStatusPending   ClaimStatus = "pending"   // captured with the sale, not yet sent
+	ClaimStatusSubmitted ClaimStatus = "submitted" // sent to the HMO
+	ClaimStatusApproved  ClaimStatus = "approved"
+	ClaimStatusDenied    ClaimStatus = "denied" // can be corrected and submitted again
+	ClaimStatusPaid      ClaimStatus = "paid"
+)
+
+// CanMoveTo reports whether a claim can go from s to next
+func (s ClaimStatus) CanMoveTo(next ClaimStatus) bool {
+	switch s {
+	case ClaimStatusPending:
+		return next == ClaimStatusSubmitted
+	case ClaimStatusSubmitted:
+		return next == ClaimStatusApproved || next == ClaimStatusDenied
+	case ClaimStatusApproved:
+		return next == ClaimStatusPaid
+	case ClaimStatusDenied:
+		return next == ClaimStatusSubmitted
+	}
+	return false
+}
+
+// IsOutstanding reports whether the HMO may still pay the claim
+func (s ClaimStatus) IsOutstanding() bool {
+	return s == ClaimStatusPending || s == ClaimStatusSubmitted || s == ClaimStatusApproved
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"
+	JobRunning   JobStatus = "running"
+	JobCompleted JobStatus = "completed"
+	JobDead      JobStatus = "dead" // gave up after the maximum attempts
+)
+
+// Job is a unit of background work run by the job workers. A job is run at
+// least once: a worker that stops mid-job leaves it to be picked up again
+// when its lease runs out, so handlers must be safe to repeat.
+type Job struct {
+	BaseModel
+	Type     string    `gorm:"size:100;not null;index" json:"type"` // e.g. cart.cleanup
+	Payload  string    `gorm:"type:text" json:"payload,omitempty"`  // JSON handed to the handler
+	Status   JobStatus `gorm:"size:20;not null;index:idx_jobs_due" json:"status"`
+	Schedule string    `gorm:"size:100;index" json:"schedule,omitempty"` // schedule that queued it
+
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	MaxAttempts int        `gorm:"not null" json:"max_attempts"`
+	RunAt       time.Time  `gorm:"not null;index:idx_jobs_due" json:"run_at"` // next attempt, or lease end while running
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	LastError   string     `gorm:"type:text" json:"last_error,omitempty"`
+}
+
+// JobSchedule queues a job of Type whenever its cron expression comes due.
+// Schedules are kept in the database so that only one server queues each
+// run.
+type JobSchedule struct {
+	BaseModel
+	Name      string     `gorm:"size:100;not null;uniqueIndex" json:"name"`
+	Type      string     `gorm:"size:100;not null" json:"type"`
+	Cron      string     `gorm:"size:100;not null" json:"cron"`
+	Enabled   bool       `gorm:"not null;default:false" json:"enabled"`
+	NextRunAt time.Time  `gorm:"not null;index" json:"next_run_at"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoginFingerprint is a device a user has signed in from, with where it was
+// last used. New devices and impossible travel between logins raise
+// security alerts.
+type LoginFingerprint struct {
+	BaseModel
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_login_fingerprints_device" json:"user_id"`
+	DeviceHash  string    `gorm:"size:64;not null;uniqueIndex:idx_login_fingerprints_device" json:"device_hash"`
+	UserAgent   string    `gorm:"size:500" json:"user_agent"`
+	IPAddress   string    `gorm:"size:45" json:"ip_address"`
+	Country     string    `gorm:"size:100" json:"country,omitempty"`
+	Latitude    *float64  `json:"latitude,omitempty"`
+	Longitude   *float64  `json:"longitude,omitempty"`
+	LoginCount  int       `gorm:"not null;default:0" json:"login_count"`
+	FirstSeenAt time.Time `gorm:"not null" json:"first_seen_at"`
+	LastSeenAt  time.Time `gorm:"not null;index" json:"last_seen_at"`
+}
+
+type SecurityAlertType string
+
+const (
+	AlertIPVelocity       SecurityAlertType = "ip_velocity"    // an IP was blocked for repeated failures
+	AlertAccountLocked    SecurityAlertType = "account_locked" // per-user lockout
+	AlertNewDevice        SecurityAlertType = "new_device"
+	AlertImpossibleTravel SecurityAlertType = "impossible_travel"
+	AlertNetworkDenied    SecurityAlertType = "network_denied" // correct password from outside the role's allowed networks
+)
+
+type SecurityAlertSeverity string
+
+const (
+	SeverityLow    SecurityAlertSeverity = "low"
+	SeverityMedium SecurityAlertSeverity = "medium"
+	SeverityHigh   SecurityAlertSeverity = "high"
+)
+
+// SecurityAlert is a suspicious authentication event for admins to review
+type SecurityAlert struct {
+	BaseModel
+	Type      SecurityAlertType     `gorm:"not null;size:30;index" json:"type"`
+	Severity  SecurityAlertSeverity `gorm:"not null;size:10;index" json:"severity"`
+	UserID    *uuid.UUID            `gorm:"type:uuid;index" json:"user_id"`
+	Username  string                `gorm:"size:255" json:"username,omitempty"`
+	IPAddress string                `gorm:"size:45;index" json:"ip_address"`
+	Message   string                `gorm:"type:text;not null" json:"message"`
+	Details   string                `gorm:"type:text" json:"details,omitempty"` // JSON encoded
+
+	AcknowledgedAt *time.Time `gorm:"index" json:"acknowledged_at"`
+	AcknowledgedBy *uuid.UUID `gorm:"type:uuid" json:"acknowledged_by"`
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one.
+// Only a hash of the emailed token is kept, and it works once.
+type PasswordResetToken struct {
+	BaseModel
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	TokenHash   string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt      *time.Time `json:"used_at,omitempty"`
+	RequestedIP string     `gorm:"size:45" json:"requested_ip"`
+}
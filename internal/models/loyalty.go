@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LoyaltyTier is a spend band with its benefits. Customers move between
+// tiers automatically based on their rolling 12-month spend.
+type LoyaltyTier struct {
+	BaseModel
+	Code     string `gorm:"uniqueIndex;not null;size:20" json:"code"` // silver, gold, platinum
+	Name     string `gorm:"not null;size:50" json:"name"`
+	MinSpend Money  `gorm:"not null;type:bigint" json:"min_spend"` // rolling 12-month spend to qualify
+
+	// Benefits
+	PointsMultiplier     float64 `gorm:"not null;type:decimal(4,2);default:1" json:"points_multiplier"`
+	FreeDelivery         bool    `gorm:"not null;default:false" json:"free_delivery"`
+	FreeDeliveryMinOrder Money   `gorm:"type:bigint;default:0" json:"free_delivery_min_order"` // 0 = any order
+}
+
+// QualifiesForFreeDelivery reports whether an order subtotal gets free
+// delivery under this tier
+func (t *LoyaltyTier) QualifiesForFreeDelivery(subtotal Money) bool {
+	return t != nil && t.FreeDelivery && subtotal >= t.FreeDeliveryMinOrder
+}
+
+type LoyaltyTransactionType string
+
+const (
+	LoyaltyEarnedSale  LoyaltyTransactionType = "earned_sale"
+	LoyaltyEarnedOrder LoyaltyTransactionType = "earned_order"
+	LoyaltyAdjustment  LoyaltyTransactionType = "adjustment"
+
+	// Referral rewards, for the referrer and the new customer
+	LoyaltyReferralBonus   LoyaltyTransactionType = "referral_bonus"
+	LoyaltyReferralWelcome LoyaltyTransactionType = "referral_welcome"
+)
+
+// LoyaltyTransaction is one change to a customer's points balance. Earned
+// points are unique per source so re-running a hook never awards twice.
+type LoyaltyTransaction struct {
+	BaseModel
+	CustomerID  uuid.UUID              `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Type        LoyaltyTransactionType `gorm:"not null;size:20;uniqueIndex:idx_loyalty_source" json:"type"`
+	ReferenceID *uuid.UUID             `gorm:"type:uuid;uniqueIndex:idx_loyalty_source" json:"reference_id"` // sale, order or referral
+	Points      int                    `gorm:"not null" json:"points"`
+	Amount      Money                  `gorm:"type:bigint;default:0" json:"amount"` // spend the points were earned on
+	Multiplier  float64                `gorm:"type:decimal(4,2);default:1" json:"multiplier"`
+	Tier        string                 `gorm:"size:20" json:"tier"` // tier at the time
+	Notes       string                 `gorm:"type:text" json:"notes"`
+	CreatedBy   *uuid.UUID             `gorm:"type:uuid" json:"created_by,omitempty"`
+	OccurredAt  time.Time              `gorm:"not null" json:"occurred_at"`
+}
+
+// CreditTransaction is one change to a customer's store credit, which is
+// the sum of their transactions. Rewards are unique per source like earned
+// points.
+type CreditTransaction struct {
+	BaseModel
+	CustomerID  uuid.UUID              `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Type        LoyaltyTransactionType `gorm:"not null;size:20;uniqueIndex:idx_credit_source" json:"type"`
+	ReferenceID *uuid.UUID             `gorm:"type:uuid;uniqueIndex:idx_credit_source" json:"reference_id"`
+	Amount      Money                  `gorm:"not null;type:bigint" json:"amount"`
+	Notes       string                 `gorm:"type:text" json:"notes"`
+	CreatedBy   *uuid.UUID             `gorm:"type:uuid" json:"created_by,omitempty"`
+	OccurredAt  time.Time              `gorm:"not null" json:"occurred_at"`
+}
@@ -20,7 +20,8 @@ type EncryptedStringArray = utils.EncryptedStringArray
 // Import payment types from online_orders.go
 // PaymentMethod and PaymentStatus are defined in online_orders.go
 
-// StringArray for handling PostgreSQL arrays
+// StringArray is a list of strings stored as a JSON array, in a jsonb
+// column on PostgreSQL
 type StringArray []string
 
 func (s *StringArray) Scan(value interface{}) error {
@@ -43,7 +44,12 @@ func (s StringArray) Value() (driver.Value, error) {
 	if len(s) == 0 {
 		return nil, nil
 	}
-	return json.Marshal(s)
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	// As text, so SQLite's JSON functions can read it
+	return string(data), nil
 }
 
 // CustomDate handles both "2006-01-02" and RFC3339 datetime formats
@@ -130,10 +136,10 @@ func (cd *CustomDate) Scan(value interface{}) error {
 
 // Base model with audit fields  
 type BaseModel struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primarykey" json:"id"`
-	CreatedAt time.Time  `gorm:"not null" json:"created_at"`
-	UpdatedAt time.Time  `gorm:"not null" json:"updated_at"`
-	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	ID        uuid.UUID      `gorm:"type:uuid;primarykey" json:"id"`
+	CreatedAt time.Time      `gorm:"not null" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"not null" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"` // soft delete, queries skip deleted rows unless Unscoped
 }
 
 // BeforeCreate hook to generate UUID for new records
@@ -147,8 +153,8 @@ func (base *BaseModel) BeforeCreate(tx *gorm.DB) error {
 // User model for authentication and authorization
 type User struct {
 	BaseModel
-	Username      string    `gorm:"uniqueIndex;not null;size:50" json:"username" validate:"required,min=3,max=50"`
-	Email         string    `gorm:"uniqueIndex;not null;size:255" json:"email" validate:"required,email"`
+	Username      string    `gorm:"uniqueIndex:idx_users_username_live,where:deleted_at IS NULL;not null;size:50" json:"username" validate:"required,min=3,max=50"`
+	Email         string    `gorm:"uniqueIndex:idx_users_email_live,where:deleted_at IS NULL;not null;size:255" json:"email" validate:"required,email"`
 	PasswordHash  string    `gorm:"not null;size:255" json:"-"` // Never expose in JSON
 	FirstName     string    `gorm:"not null;size:100" json:"first_name" validate:"required,max=100"`
 	LastName      string    `gorm:"not null;size:100" json:"last_name" validate:"required,max=100"`
@@ -156,6 +162,9 @@ type User struct {
 	IsActive      bool      `gorm:"not null;default:true" json:"is_active"`
 	LastLoginAt   *time.Time `json:"last_login_at,omitempty"`
 	
+	// Staff with a branch only see and write their branch's records
+	BranchID *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	
 	// Security fields
 	FailedLoginAttempts int       `gorm:"default:0" json:"-"`
 	LockedUntil        *time.Time `json:"-"`
@@ -188,8 +197,9 @@ type Customer struct {
 	// Basic Information
 	FirstName   string `gorm:"not null;size:100" json:"first_name" validate:"required,max=100"`
 	LastName    string `gorm:"not null;size:100" json:"last_name" validate:"required,max=100"`
-	Email       string `gorm:"uniqueIndex;size:255" json:"email" validate:"email"`
+	Email       string `gorm:"uniqueIndex:idx_customers_email_live,where:deleted_at IS NULL;size:255" json:"email" validate:"omitempty,email"`
 	Phone       string `gorm:"not null;size:20" json:"phone" validate:"required,phone"`
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"` // set when the customer confirms a texted code, cleared when the number changes
 	DateOfBirth time.Time `gorm:"not null" json:"date_of_birth" validate:"required"`
 	
 	// Address
@@ -212,6 +222,9 @@ type Customer struct {
 	// Customer metadata
 	QRCode           string    `gorm:"uniqueIndex;size:50" json:"qr_code"`
 	LoyaltyPoints    int       `gorm:"default:0" json:"loyalty_points"`
+	LoyaltyTier      string    `gorm:"size:20;index" json:"loyalty_tier"` // code of the current tier, empty below the lowest
+	TierSpend        Money     `gorm:"type:bigint;default:0" json:"tier_spend"` // rolling 12-month spend at last recalculation
+	TierUpdatedAt    *time.Time `json:"tier_updated_at"`
 	PreferredContact string    `gorm:"size:20;default:'email'" json:"preferred_contact"`
 	
 	// Discount Eligibility
@@ -219,11 +232,30 @@ type Customer struct {
 	IsPWD           bool   `gorm:"default:false" json:"is_pwd"`
 	SeniorCitizenID EncryptedString `gorm:"size:100" json:"senior_citizen_id"`
 	PWDId           EncryptedString `gorm:"size:100" json:"pwd_id"`
-	IDDocumentPath  string `gorm:"size:500" json:"id_document_path"` // File path for uploaded ID
+	IDDocumentPath  string `gorm:"size:500" json:"-"` // storage key of the uploaded ID, downloaded through the API
+	SeniorCitizenIDExpiry *time.Time `json:"senior_citizen_id_expiry"`
+	PWDIdExpiry           *time.Time `json:"pwd_id_expiry"`
+	
+	// Staff verification of the uploaded ID. The discount flags above only
+	// take effect once the ID is verified and unexpired.
+	EligibilityStatus     EligibilityStatus `gorm:"size:20;index" json:"eligibility_status"`
+	EligibilityVerifiedBy *uuid.UUID        `gorm:"type:uuid" json:"eligibility_verified_by"`
+	EligibilityVerifiedAt *time.Time        `json:"eligibility_verified_at"`
+	EligibilityNotes      string            `gorm:"type:text" json:"eligibility_notes"`
 	
 	// Privacy and compliance
 	ConsentDate      *time.Time `json:"consent_date"`
 	DataRetentionDate *time.Time `json:"data_retention_date"`
+	AnonymizedAt     *time.Time `json:"anonymized_at,omitempty"` // set when erased on request
+	
+	// Household. A dependent has its own profile and medical data and is
+	// managed by the guardian's account.
+	GuardianID       *uuid.UUID            `gorm:"type:uuid;index" json:"guardian_id"`
+	Relationship     DependentRelationship `gorm:"size:20" json:"relationship,omitempty"` // dependent's relation to the guardian
+	Dependents       []Customer            `gorm:"foreignKey:GuardianID" json:"dependents,omitempty"`
+	
+	// Active staff flags, loaded for POS lookups and staff QR scans
+	Flags            []CustomerFlag        `gorm:"foreignKey:CustomerID" json:"flags,omitempty"`
 	
 	// Relationships
 	Sales            []Sale            `gorm:"foreignKey:CustomerID" json:"sales,omitempty"`
@@ -254,10 +286,10 @@ type Product struct {
 	DrugInteractions StringArray `gorm:"type:jsonb" json:"drug_interactions"`
 	
 	// Inventory Information
-	SKU              string  `gorm:"uniqueIndex;not null;size:100" json:"sku" validate:"required"`
-	Barcode          *string `gorm:"uniqueIndex;size:100" json:"barcode"`
-	Price            float64 `gorm:"not null;type:decimal(10,2)" json:"price" validate:"required,gt=0"`
-	Cost             float64 `gorm:"not null;type:decimal(10,2)" json:"cost" validate:"required,gt=0"`
+	SKU              string  `gorm:"uniqueIndex:idx_products_sku_live,where:deleted_at IS NULL;not null;size:100" json:"sku" validate:"required"`
+	Barcode          *string `gorm:"uniqueIndex:idx_products_barcode_live,where:deleted_at IS NULL;size:100" json:"barcode"`
+	Price            Money   `gorm:"not null;type:bigint" json:"price" validate:"required,gt=0"`
+	Cost             Money   `gorm:"not null;type:bigint" json:"cost" validate:"required,gt=0"`
 	Stock            int     `gorm:"not null;default:0" json:"stock"`
 	MinStock         int     `gorm:"not null;default:10" json:"min_stock"`
 	MaxStock         int     `gorm:"not null;default:1000" json:"max_stock"`
@@ -270,11 +302,19 @@ type Product struct {
 	PrescriptionRequired bool       `gorm:"not null;default:false" json:"prescription_required"`
 	ControlledSubstance  bool       `gorm:"not null;default:false" json:"controlled_substance"`
 	FDAApproved         bool       `gorm:"not null;default:true" json:"fda_approved"`
+	VATExempt           bool       `gorm:"not null;default:false" json:"vat_exempt"` // e.g. maintenance medicines exempt under the TRAIN law
+	
+	// FDA Philippines certificate of product registration, e.g. DR-XY12345,
+	// checked against the registry cache. RegulatoryStatus is set from it.
+	FDARegistrationNumber *string          `gorm:"size:50;index" json:"fda_registration_number"`
+	RegulatoryStatus      RegulatoryStatus `gorm:"size:20;index;default:'unchecked'" json:"regulatory_status"`
+	RegulatoryCheckedAt   *time.Time       `json:"regulatory_checked_at,omitempty"`
 	
 	// Storage Information
 	StorageConditions   string  `gorm:"size:255" json:"storage_conditions"`
 	StorageTemperature  *string `gorm:"size:50" json:"storage_temperature"`
 	StorageLocation     string  `gorm:"size:100" json:"storage_location"`
+	StorageUnitID       *uuid.UUID `gorm:"type:uuid;index" json:"storage_unit_id,omitempty"` // the temperature-logged unit it is kept in
 	
 	// Business Information
 	SupplierID     *uuid.UUID `gorm:"type:uuid" json:"supplier_id"` // Primary supplier (kept for backward compatibility)
@@ -314,28 +354,48 @@ type Sale struct {
 	CustomerID      *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
 	Customer        *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
 	
+	// Set when a guardian buys for a dependent. CustomerID is always the
+	// person the medication is for.
+	GuardianID      *uuid.UUID `gorm:"type:uuid;index" json:"guardian_id"`
+	Guardian        *Customer  `gorm:"foreignKey:GuardianID" json:"guardian,omitempty"`
+	
+	BranchID        *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	
+	// Set when rung up on a POS terminal, which numbers its invoices
+	TerminalID      *uuid.UUID `gorm:"type:uuid;index" json:"terminal_id,omitempty"`
+	InvoiceNumber   *string    `gorm:"size:50;uniqueIndex" json:"invoice_number,omitempty"`
+	
 	// Transaction Information
-	SaleNumber       string    `gorm:"uniqueIndex;not null;size:50" json:"sale_number" validate:"required"`
-	Total            float64   `gorm:"not null;type:decimal(10,2)" json:"total" validate:"required,gt=0"`
-	Subtotal         float64   `gorm:"not null;type:decimal(10,2)" json:"subtotal"`
-	Tax              float64   `gorm:"not null;type:decimal(10,2);default:0" json:"tax"`
-	Discount         float64   `gorm:"not null;type:decimal(10,2);default:0" json:"discount"`
+	SaleNumber       string    `gorm:"uniqueIndex;not null;size:50" json:"sale_number"`
+	Total            Money     `gorm:"not null;type:bigint" json:"total" validate:"required,gt=0"`
+	Subtotal         Money     `gorm:"not null;type:bigint" json:"subtotal"`
+	Tax              Money     `gorm:"not null;type:bigint;default:0" json:"tax"`
+	Discount         Money     `gorm:"not null;type:bigint;default:0" json:"discount"`
+	TaxBreakdown     TaxBreakdown `gorm:"embedded;embeddedPrefix:tax_" json:"tax_breakdown"`
+	Currency         string    `gorm:"not null;size:3;default:'PHP'" json:"currency"` // Currency of the amounts above
 	
 	// Payment Information
 	PaymentMethod    PaymentMethod `gorm:"not null;size:50" json:"payment_method" validate:"required"`
 	PaymentStatus    PaymentStatus `gorm:"not null;size:50;default:'paid'" json:"payment_status"`
 	PaymentReference *string       `gorm:"size:100" json:"payment_reference"`
 	
+	// Set when the customer paid in a foreign currency: the total in that
+	// currency at the exchange rate of the day
+	PaymentCurrency  *string  `gorm:"size:3" json:"payment_currency,omitempty"`
+	PaymentAmount    *Money   `gorm:"type:bigint" json:"payment_amount,omitempty"`
+	ExchangeRate     *float64 `gorm:"type:decimal(18,6)" json:"exchange_rate,omitempty"`
+	
 	// Prescription Information
 	PrescriptionNumber *string    `gorm:"size:100" json:"prescription_number"`
 	PrescribedBy      *string    `gorm:"size:255" json:"prescribed_by"`
 	PrescriptionDate  *time.Time `json:"prescription_date"`
 	
 	// Staff Information
-	PharmacistID *uuid.UUID `gorm:"type:uuid;not null" json:"pharmacist_id" validate:"required"`
+	PharmacistID *uuid.UUID `gorm:"type:uuid;not null" json:"pharmacist_id"`
 	Pharmacist   *User      `gorm:"foreignKey:PharmacistID" json:"pharmacist,omitempty"`
 	CashierID    *uuid.UUID `gorm:"type:uuid" json:"cashier_id"`
 	Cashier      *User      `gorm:"foreignKey:CashierID" json:"cashier,omitempty"`
+	ShiftID      *uuid.UUID `gorm:"type:uuid;index" json:"shift_id,omitempty"` // the shift it was rung up in, when clocked in
 	
 	// Additional Information
 	Notes         string `gorm:"type:text" json:"notes"`
@@ -348,6 +408,7 @@ type Sale struct {
 	
 	// Relationships
 	SaleItems []SaleItem `gorm:"foreignKey:SaleID" json:"sale_items,omitempty"`
+	InsuranceClaim *InsuranceClaim `gorm:"foreignKey:SaleID" json:"insurance_claim,omitempty"` // set when an HMO pays for the sale
 	
 	// Audit
 	CreatedBy *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
@@ -360,17 +421,19 @@ type SaleItem struct {
 	SaleID    uuid.UUID `gorm:"type:uuid;not null;index" json:"sale_id" validate:"required"`
 	Sale      Sale      `gorm:"foreignKey:SaleID" json:"sale,omitempty"`
 	
-	// Item can be either a product or a service
-	ItemType    string     `gorm:"not null;default:'product'" json:"item_type" validate:"required,oneof=product service"`
+	// Item can be a product, a service or a compounded preparation
+	ItemType    string     `gorm:"not null;default:'product'" json:"item_type" validate:"required,oneof=product service compound"`
 	ProductID   *uuid.UUID `gorm:"type:uuid;index" json:"product_id"`
 	Product     *Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	ServiceID   *uuid.UUID `gorm:"type:uuid;index" json:"service_id"`
 	Service     *Service   `gorm:"foreignKey:ServiceID" json:"service,omitempty"`
+	PreparationID *uuid.UUID           `gorm:"type:uuid;index" json:"preparation_id,omitempty"`
+	Preparation   *CompoundPreparation `gorm:"foreignKey:PreparationID" json:"preparation,omitempty"`
 	
 	Quantity    int     `gorm:"not null" json:"quantity" validate:"required,gt=0"`
-	UnitPrice   float64 `gorm:"not null;type:decimal(10,2)" json:"unit_price" validate:"required,gt=0"`
-	TotalPrice  float64 `gorm:"not null;type:decimal(10,2)" json:"total_price" validate:"required,gt=0"`
-	Discount    float64 `gorm:"not null;type:decimal(10,2);default:0" json:"discount"`
+	UnitPrice   Money   `gorm:"not null;type:bigint" json:"unit_price" validate:"required,gt=0"`
+	TotalPrice  Money   `gorm:"not null;type:bigint" json:"total_price" validate:"required,gt=0"`
+	Discount    Money   `gorm:"not null;type:bigint;default:0" json:"discount"`
 	
 	// Batch Information for traceability (only for products)
 	BatchNumber string `gorm:"size:100" json:"batch_number"`
@@ -380,12 +443,14 @@ type SaleItem struct {
 	Dosage      *string `gorm:"size:100" json:"dosage"`
 	Instructions *string `gorm:"type:text" json:"instructions"`
 	Duration    *string `gorm:"size:100" json:"duration"`
+	DaysSupply  *int    `json:"days_supply"` // Days the dispensed quantity lasts, drives refill reminders
 	
 	// Service-specific fields
 	ScheduledDate    *time.Time `json:"scheduled_date,omitempty"`
 	ServiceNotes     *string    `gorm:"type:text" json:"service_notes,omitempty"`
 	PerformedBy      *uuid.UUID `gorm:"type:uuid" json:"performed_by,omitempty"`
 	ServiceCompleted bool       `gorm:"default:false" json:"service_completed"`
+	ServiceCompletedAt *time.Time `json:"service_completed_at,omitempty"`
 }
 
 // StockMovement model for inventory tracking
@@ -394,6 +459,10 @@ type StockMovement struct {
 	ProductID   uuid.UUID `gorm:"type:uuid;not null;index" json:"product_id" validate:"required"`
 	Product     Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	
+	// The branch whose stock moved. Stock levels are the product's total
+	// across branches.
+	BranchID    *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	
 	Type        MovementType `gorm:"not null" json:"type" validate:"required"`
 	Quantity    int          `gorm:"not null" json:"quantity" validate:"required"`
 	Reason      string       `gorm:"not null;size:255" json:"reason" validate:"required"`
@@ -406,12 +475,12 @@ type StockMovement struct {
 	// Batch Information
 	BatchNumber string `gorm:"size:100" json:"batch_number"`
 	
-	// Staff Information
-	UserID uuid.UUID `gorm:"type:uuid;not null" json:"user_id" validate:"required"`
-	User   User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	// Staff Information. Empty for stock a customer's online order took.
+	UserID *uuid.UUID `gorm:"type:uuid" json:"user_id"`
+	User   *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	
 	// Additional Details
-	Cost        *float64 `gorm:"type:decimal(10,2)" json:"cost"`
+	Cost        *Money   `gorm:"type:bigint" json:"cost"`
 	SupplierID  *uuid.UUID `gorm:"type:uuid" json:"supplier_id"`
 	Notes       string   `gorm:"type:text" json:"notes"`
 }
@@ -439,10 +508,15 @@ type PurchaseHistory struct {
 	
 	SaleID          *uuid.UUID `gorm:"type:uuid;index" json:"sale_id"`
 	Sale            *Sale     `gorm:"foreignKey:SaleID" json:"sale,omitempty"`
+	OrderID         *uuid.UUID `gorm:"type:uuid;index" json:"order_id"`
+	
+	// Source line item, one history row per dispensed line
+	SaleItemID      *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"sale_item_id"`
+	OrderItemID     *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"order_item_id"`
 	
 	Quantity        int       `gorm:"not null" json:"quantity" validate:"required,gt=0"`
-	UnitPrice       float64   `gorm:"not null;type:decimal(10,2)" json:"unit_price" validate:"required,gt=0"`
-	TotalPrice      float64   `gorm:"not null;type:decimal(10,2)" json:"total_price" validate:"required,gt=0"`
+	UnitPrice       Money     `gorm:"not null;type:bigint" json:"unit_price" validate:"required,gt=0"`
+	TotalPrice      Money     `gorm:"not null;type:bigint" json:"total_price" validate:"required,gt=0"`
 	
 	PurchaseDate    time.Time `gorm:"not null;index" json:"purchase_date"`
 	
@@ -454,6 +528,55 @@ type PurchaseHistory struct {
 	Notes           string `gorm:"type:text" json:"notes"`
 }
 
+// NewSaleHistory builds the purchase history row for a product line of a
+// sale. It returns nil for walk-in sales and service lines.
+func NewSaleHistory(sale *Sale, item SaleItem) *PurchaseHistory {
+	if sale.CustomerID == nil || item.ProductID == nil {
+		return nil
+	}
+	saleID, itemID := sale.ID, item.ID
+	history := &PurchaseHistory{
+		CustomerID:         *sale.CustomerID,
+		ProductID:          *item.ProductID,
+		SaleID:             &saleID,
+		SaleItemID:         &itemID,
+		Quantity:           item.Quantity,
+		UnitPrice:          item.UnitPrice,
+		TotalPrice:         item.TotalPrice,
+		PurchaseDate:       sale.CreatedAt,
+		PrescriptionNumber: sale.PrescriptionNumber,
+		PrescribedBy:       sale.PrescribedBy,
+	}
+	if history.PurchaseDate.IsZero() {
+		history.PurchaseDate = time.Now().UTC()
+	}
+	return history
+}
+
+// NewOrderHistory builds the purchase history row for a fulfilled online
+// order line. It returns nil for guest orders and lines that were not
+// dispensed.
+func NewOrderHistory(order *OnlineOrder, item OnlineOrderItem) *PurchaseHistory {
+	if order.CustomerID == nil || item.Status == ItemStatusCancelled || item.Status == ItemStatusOutOfStock {
+		return nil
+	}
+	orderID, itemID := order.ID, item.ID
+	purchaseDate := time.Now().UTC()
+	if order.ActualDeliveryDate != nil {
+		purchaseDate = *order.ActualDeliveryDate
+	}
+	return &PurchaseHistory{
+		CustomerID:   *order.CustomerID,
+		ProductID:    item.ProductID,
+		OrderID:      &orderID,
+		OrderItemID:  &itemID,
+		Quantity:     item.Quantity,
+		UnitPrice:    item.UnitPrice,
+		TotalPrice:   item.TotalPrice,
+		PurchaseDate: purchaseDate,
+	}
+}
+
 // AuditLog model for compliance and security
 type AuditLog struct {
 	BaseModel
@@ -474,8 +597,10 @@ type AuditLog struct {
 	RequestID   *string `gorm:"size:100" json:"request_id"`
 	
 	// Additional Context
-	Success     bool   `gorm:"not null;default:true" json:"success"`
+	// No default:true here, gorm would store failures as successes
+	Success     bool   `gorm:"not null;default:false" json:"success"`
 	ErrorMessage *string `gorm:"type:text" json:"error_message"`
+	StatusCode  *int   `json:"status_code,omitempty"` // HTTP status returned, for request-level entries
 	Duration    *int   `json:"duration_ms"`
 }
 
@@ -518,10 +643,10 @@ type Supplier struct {
 type Service struct {
 	BaseModel
 	Name            string          `gorm:"not null;size:255" json:"name" validate:"required,max=255"`
-	Code            string          `gorm:"uniqueIndex;not null;size=50" json:"code" validate:"required,max=50"`
+	Code            string          `gorm:"uniqueIndex:idx_services_code_live,where:deleted_at IS NULL;not null;size:50" json:"code" validate:"required,max=50"`
 	Description     string          `gorm:"type:text" json:"description"`
 	Category        ServiceCategory `gorm:"not null" json:"category"`
-	Price           float64         `gorm:"type:decimal(10,2);not null" json:"price" validate:"required,min=0"`
+	Price           Money           `gorm:"type:bigint;not null" json:"price" validate:"min=0"`
 	Duration        int             `gorm:"not null;default:30" json:"duration"` // Duration in minutes
 	
 	// Requirements
@@ -577,7 +702,7 @@ type ProductSupplier struct {
 	SupplierCode  string    `gorm:"size:100" json:"supplier_code"` // Product code at this supplier
 	LeadTimeDays  int       `gorm:"default:0" json:"lead_time_days"`
 	MinOrderQty   int       `gorm:"default:1" json:"min_order_qty"`
-	Price         float64   `gorm:"type:decimal(10,2)" json:"price"`
+	Price         Money     `gorm:"type:bigint" json:"price"`
 	LastOrderDate *time.Time `json:"last_order_date"`
 	Notes         string    `gorm:"type:text" json:"notes"`
 }
\ No newline at end of file
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in centavos, the hundredths of a currency unit. It is
+// stored as a whole number so totals, tax and discounts add up exactly,
+// and written to JSON as a decimal such as 1234.50.
+type Money int64
+
+// NewMoney converts an amount in currency units, rounding to the nearest
+// centavo with halves away from zero
+func NewMoney(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// ParseMoney reads an amount such as "1234.5" or "-0.25" exactly. More than
+// two decimal places round to the nearest centavo, halves away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	text := s
+	negative := strings.HasPrefix(text, "-")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(text, ".")
+	if whole == "" && fraction == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	for _, digits := range []string{whole, fraction} {
+		for _, r := range digits {
+			if r < '0' || r > '9' {
+				return 0, fmt.Errorf("invalid amount %q", s)
+			}
+		}
+	}
+
+	var roundUp bool
+	if len(fraction) > 2 {
+		roundUp = fraction[2] >= '5'
+		fraction = fraction[:2]
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	units, err := strconv.ParseInt("0"+whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	centavos, _ := strconv.ParseInt(fraction, 10, 64)
+
+	m := Money(units*100 + centavos)
+	if roundUp {
+		m++
+	}
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// Float64 returns the amount in currency units, for ratios and display
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Mul returns the amount times a quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// MulRate returns the amount times a rate, such as a tax rate or discount
+// percentage as a fraction, rounded to the nearest centavo
+func (m Money) MulRate(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// Round rounds the amount to a number of decimal places, for currencies
+// with fewer than two. Halves round away from zero.
+func (m Money) Round(places int) Money {
+	if places >= 2 {
+		return m
+	}
+	scale := Money(math.Pow10(2 - places))
+	half := scale / 2
+	if m < 0 {
+		return -((-m + half) / scale * scale)
+	}
+	return (m + half) / scale * scale
+}
+
+// String writes the amount with two decimal places, such as "-1234.50"
+func (m Money) String() string {
+	sign := ""
+	abs := int64(m)
+	if abs < 0 {
+		sign, abs = "-", -abs
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/100, abs%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts an amount as a JSON number or string
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	text = strings.Trim(text, `"`)
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		// Numbers in exponent form, such as 1e3
+		amount, floatErr := strconv.ParseFloat(text, 64)
+		if floatErr != nil || math.IsInf(amount, 0) {
+			return err
+		}
+		parsed = NewMoney(amount)
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a column of centavos. Sums come back from some drivers as
+// text or floats.
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		return m.scanFloat(v)
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", value)
+	}
+	return nil
+}
+
+func (m *Money) scanText(text string) error {
+	centavos, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", text, err)
+	}
+	return m.scanFloat(centavos)
+}
+
+// scanFloat rounds to whole centavos, refusing amounts an int64 can't hold
+// rather than wrapping them
+func (m *Money) scanFloat(centavos float64) error {
+	centavos = math.Round(centavos)
+	if math.IsNaN(centavos) || centavos < math.MinInt64 || centavos >= math.MaxInt64 {
+		return fmt.Errorf("cannot scan %v into Money: out of range", centavos)
+	}
+	*m = Money(centavos)
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{in: "1234.5", want: 123450},
+		{in: "1234.50", want: 123450},
+		{in: "0", want: 0},
+		{in: "7", want: 700},
+		{in: "+3", want: 300},
+		{in: ".5", want: 50},
+		{in: "5.", want: 500},
+		{in: " 12.34 ", want: 1234},
+		{in: "-0.25", want: -25},
+		{in: "-1234.56", want: -123456},
+
+		// Past two places, halves round away from zero
+		{in: "0.005", want: 1},
+		{in: "0.0049", want: 0},
+		{in: "1.239", want: 124},
+		{in: "1.994", want: 199},
+		{in: "9.995", want: 1000},
+		{in: "-0.005", want: -1},
+		{in: "-1.994", want: -199},
+		{in: "-0.004", want: 0},
+
+		{in: "92233720368547757.99", want: math.MaxInt64 - 8},
+		{in: "92233720368547758", wantErr: true},
+		{in: "-92233720368547758", wantErr: true},
+		{in: "99999999999999999999", wantErr: true},
+
+		{in: "", wantErr: true},
+		{in: "-", wantErr: true},
+		{in: ".", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "1.2.3", wantErr: true},
+		{in: "1,234.50", wantErr: true},
+		{in: "--1", wantErr: true},
+		{in: "1e3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyMulRate(t *testing.T) {
+	tests := []struct {
+		m    Money
+		rate float64
+		want Money
+	}{
+		{m: 10000, rate: 0.12, want: 1200},
+		{m: 333, rate: 0.1, want: 33},
+		{m: 125, rate: 0.5, want: 63},
+		{m: 1005, rate: 0.5, want: 503},
+		{m: 124, rate: 0.5, want: 62},
+		{m: -125, rate: 0.5, want: -63},
+		{m: 125, rate: -0.5, want: -63},
+		{m: 10000, rate: 0, want: 0},
+		{m: 10000, rate: 1, want: 10000},
+		{m: 0, rate: 0.12, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.MulRate(tt.rate); got != tt.want {
+			t.Errorf("Money(%d).MulRate(%v) = %d, want %d", tt.m, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		m      Money
+		places int
+		want   Money
+	}{
+		{m: 12345, places: 2, want: 12345},
+		{m: 12345, places: 3, want: 12345},
+		{m: 12345, places: 1, want: 12350},
+		{m: 12344, places: 1, want: 12340},
+		{m: 12350, places: 0, want: 12400},
+		{m: 12349, places: 0, want: 12300},
+		{m: 50, places: 0, want: 100},
+		{m: 49, places: 0, want: 0},
+		{m: -12345, places: 1, want: -12350},
+		{m: -12344, places: 1, want: -12340},
+		{m: -12350, places: 0, want: -12400},
+		{m: -49, places: 0, want: 0},
+		{m: 0, places: 0, want: 0},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Round(tt.places); got != tt.want {
+			t.Errorf("Money(%d).Round(%d) = %d, want %d", tt.m, tt.places, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    Money
+		wantErr bool
+	}{
+		{name: "nil", value: nil, want: 0},
+		{name: "int64", value: int64(123450), want: 123450},
+		{name: "negative int64", value: int64(-25), want: -25},
+		{name: "max int64", value: int64(math.MaxInt64), want: math.MaxInt64},
+		{name: "float64", value: float64(1234), want: 1234},
+		{name: "float64 half", value: 1234.5, want: 1235},
+		{name: "float64 under half", value: 1234.49, want: 1234},
+		{name: "negative float64 half", value: -0.5, want: -1},
+		{name: "float64 overflow", value: 1e19, wantErr: true},
+		{name: "negative float64 overflow", value: -1e19, wantErr: true},
+		{name: "float64 NaN", value: math.NaN(), wantErr: true},
+		{name: "string", value: "123450", want: 123450},
+		{name: "string from a numeric sum", value: "123450.000000", want: 123450},
+		{name: "string half", value: "12.5", want: 13},
+		{name: "negative string", value: "-12.5", want: -13},
+		{name: "string overflow", value: "1e19", wantErr: true},
+		{name: "bytes", value: []byte("-25"), want: -25},
+		{name: "invalid string", value: "12 pesos", wantErr: true},
+		{name: "empty bytes", value: []byte(""), wantErr: true},
+		{name: "bool", value: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Money(99)
+			err := m.Scan(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Scan(%v) = %d, want an error", tt.value, m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Scan(%v): %v", tt.value, err)
+			}
+			if m != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.value, m, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyValue(t *testing.T) {
+	for _, m := range []Money{0, 123450, -25, math.MaxInt64, math.MinInt64} {
+		value, err := m.Value()
+		if err != nil {
+			t.Fatalf("Money(%d).Value(): %v", m, err)
+		}
+		if got, ok := value.(int64); !ok || got != int64(m) {
+			t.Errorf("Money(%d).Value() = %#v, want int64(%d)", m, value, m)
+		}
+
+		var scanned Money
+		if err := scanned.Scan(value); err != nil || scanned != m {
+			t.Errorf("Money(%d) scanned back as %d, %v", m, scanned, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fmt"
 	"time"
 	"pharmacy-backend/internal/utils"
 	"github.com/google/uuid"
@@ -14,24 +15,42 @@ type OnlineOrder struct {
 	CustomerID   *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
 	Customer     *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
 	
+	// Set when a guardian orders for a dependent. CustomerID is always the
+	// person the medication is for.
+	GuardianID   *uuid.UUID `gorm:"type:uuid;index" json:"guardian_id"`
+	Guardian     *Customer  `gorm:"foreignKey:GuardianID" json:"guardian,omitempty"`
+	
 	// Guest Order Information (for non-registered customers)
 	GuestEmail   *string `gorm:"size:255" json:"guest_email"`
 	GuestPhone   *string `gorm:"size:20" json:"guest_phone"`
 	GuestName    *string `gorm:"size:200" json:"guest_name"`
 	
+	// Guest orders remember the app session that placed them, so devices
+	// registered for push notifications on it hear about the order
+	SessionID    *string `gorm:"size:100;index" json:"-"`
+	
+	// Branch that fills the order
+	BranchID     *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+	
 	// Order Details
 	OrderNumber     string      `gorm:"uniqueIndex;not null;size:50" json:"order_number" validate:"required"`
-	Status          OrderStatus `gorm:"not null;default:'pending'" json:"status"`
+	
+	// Order numbers run in sequence, so they are for staff and receipts.
+	// The customer tracks their order with this random code instead.
+	TrackingCode    *string     `gorm:"uniqueIndex;size:64" json:"tracking_code,omitempty"`
+	Status          OrderStatus `gorm:"not null;default:'pending';index" json:"status"`
 	OrderType       OrderType   `gorm:"not null;default:'delivery'" json:"order_type"`
 	
 	// Financial Information
-	Subtotal        float64 `gorm:"not null;type:decimal(10,2)" json:"subtotal" validate:"required,gt=0"`
-	Tax             float64 `gorm:"not null;type:decimal(10,2);default:0" json:"tax"`
-	DeliveryFee     float64 `gorm:"not null;type:decimal(10,2);default:0" json:"delivery_fee"`
-	Discount        float64 `gorm:"not null;type:decimal(10,2);default:0" json:"discount"`
+	Subtotal        Money   `gorm:"not null;type:bigint" json:"subtotal" validate:"required,gt=0"`
+	Tax             Money   `gorm:"not null;type:bigint;default:0" json:"tax"`
+	DeliveryFee     Money   `gorm:"not null;type:bigint;default:0" json:"delivery_fee"`
+	Discount        Money   `gorm:"not null;type:bigint;default:0" json:"discount"`
 	DiscountType    string  `gorm:"size:50" json:"discount_type"` // "senior_citizen", "pwd", "regular", etc.
 	DiscountPercent float64 `gorm:"type:decimal(5,2);default:0" json:"discount_percent"` // Store the discount percentage applied
-	Total           float64 `gorm:"not null;type:decimal(10,2)" json:"total" validate:"required,gt=0"`
+	TaxBreakdown    TaxBreakdown `gorm:"embedded;embeddedPrefix:tax_" json:"tax_breakdown"`
+	Total           Money   `gorm:"not null;type:bigint" json:"total" validate:"required,gt=0"`
+	Currency        string  `gorm:"not null;size:3;default:'PHP'" json:"currency"` // Currency of the amounts above
 	
 	// Payment Information
 	PaymentMethod   PaymentMethod `gorm:"size:50" json:"payment_method"`
@@ -46,6 +65,13 @@ type OnlineOrder struct {
 	DeliveryZipCode    string                `gorm:"size:20" json:"delivery_zip_code"`
 	DeliveryNotes      string                `gorm:"type:text" json:"delivery_notes"`
 	
+	// Where the delivery address was geocoded to, and the zone and distance
+	// the delivery fee was worked out from
+	DeliveryLatitude   *float64   `json:"delivery_latitude,omitempty"`
+	DeliveryLongitude  *float64   `json:"delivery_longitude,omitempty"`
+	DeliveryZoneID     *uuid.UUID `gorm:"type:uuid" json:"delivery_zone_id,omitempty"`
+	DeliveryDistanceKM *float64   `gorm:"type:decimal(8,2)" json:"delivery_distance_km,omitempty"`
+	
 	// Prescription Information
 	PrescriptionRequired bool      `gorm:"default:false" json:"prescription_required"`
 	PrescriptionUploaded bool      `gorm:"default:false" json:"prescription_uploaded"`
@@ -79,6 +105,16 @@ type OnlineOrder struct {
 	UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"`
 }
 
+// NewTrackingCode returns a random code for customers to track an order
+// with. It is as hard to guess as a session token.
+func NewTrackingCode() (*string, error) {
+	code, err := utils.GenerateSecureToken(18)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tracking code: %w", err)
+	}
+	return &code, nil
+}
+
 type OrderStatus string
 
 const (
@@ -133,18 +169,25 @@ type OnlineOrderItem struct {
 	Product   Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	
 	Quantity    int     `gorm:"not null" json:"quantity" validate:"required,gt=0"`
-	UnitPrice   float64 `gorm:"not null;type:decimal(10,2)" json:"unit_price" validate:"required,gt=0"`
-	TotalPrice  float64 `gorm:"not null;type:decimal(10,2)" json:"total_price" validate:"required,gt=0"`
-	Discount    float64 `gorm:"not null;type:decimal(10,2);default:0" json:"discount"`
+	UnitPrice   Money   `gorm:"not null;type:bigint" json:"unit_price" validate:"required,gt=0"`
+	TotalPrice  Money   `gorm:"not null;type:bigint" json:"total_price" validate:"required,gt=0"`
+	Discount    Money   `gorm:"not null;type:bigint;default:0" json:"discount"`
 	
 	// Prescription specifics for this item
 	Dosage       *string `gorm:"size:100" json:"dosage"`
 	Instructions *string `gorm:"type:text" json:"instructions"`
 	Duration     *string `gorm:"size:100" json:"duration"`
+	DaysSupply   *int    `json:"days_supply"` // Days the dispensed quantity lasts, drives refill reminders
 	
 	// Fulfillment status per item
 	Status       ItemStatus `gorm:"not null;default:'pending'" json:"status"`
 	Notes        string     `gorm:"type:text" json:"notes"`
+	
+	// Picking: how much has been scanned off the shelf, and from which batch
+	PickedQuantity    int        `gorm:"not null;default:0" json:"picked_quantity,omitempty"`
+	PickedBatchNumber string     `gorm:"size:100" json:"picked_batch_number,omitempty"`
+	PickedBy          *uuid.UUID `gorm:"type:uuid" json:"picked_by,omitempty"`
+	PickedAt          *time.Time `json:"picked_at,omitempty"`
 }
 
 type ItemStatus string
@@ -171,7 +214,7 @@ type ShoppingCart struct {
 	Product     Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
 	
 	Quantity    int     `gorm:"not null" json:"quantity" validate:"required,gt=0"`
-	UnitPrice   float64 `gorm:"not null;type:decimal(10,2)" json:"unit_price" validate:"required,gt=0"`
+	UnitPrice   Money   `gorm:"not null;type:bigint" json:"unit_price" validate:"required,gt=0"`
 	
 	// Prescription specifics
 	Dosage       *string `gorm:"size:100" json:"dosage"`
@@ -210,12 +253,13 @@ type QRCode struct {
 	Type        QRType    `gorm:"not null" json:"type" validate:"required"`
 	
 	// Reference to the entity
-	EntityID    uuid.UUID `gorm:"type:uuid;not null" json:"entity_id" validate:"required"`
-	EntityType  string    `gorm:"not null;size:50" json:"entity_type" validate:"required"`
+	EntityID    uuid.UUID `gorm:"type:uuid;not null;index:idx_qr_codes_entity" json:"entity_id" validate:"required"`
+	EntityType  string    `gorm:"not null;size:50;index:idx_qr_codes_entity" json:"entity_type" validate:"required"`
 	
 	// QR Code metadata
 	GeneratedBy *uuid.UUID `gorm:"type:uuid" json:"generated_by"`
 	User        *User      `gorm:"foreignKey:GeneratedBy" json:"user,omitempty"`
+	BranchID    *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
 	
 	IsActive    bool      `gorm:"not null;default:true" json:"is_active"`
 	ExpiresAt   *time.Time `json:"expires_at"`
@@ -231,11 +275,14 @@ type QRCode struct {
 type QRType string
 
 const (
-	QRTypeProduct  QRType = "product"
-	QRTypeCustomer QRType = "customer"
-	QRTypeOrder    QRType = "order"
-	QRTypePayment  QRType = "payment"
-	QRTypeAuth     QRType = "auth"
+	QRTypeProduct     QRType = "product"
+	QRTypeCustomer    QRType = "customer"
+	QRTypeOrder       QRType = "order"
+	QRTypePayment     QRType = "payment"
+	QRTypeAuth        QRType = "auth"
+	QRTypeVaccination QRType = "vaccination"
+	QRTypeFeedback    QRType = "feedback"
+	QRTypeEmployee    QRType = "employee" // an employee's badge for the time clock
 )
 
 // QRScanLog tracks QR code scans for security and analytics
@@ -269,6 +316,7 @@ type PrescriptionUpload struct {
 	
 	CustomerID  *uuid.UUID `gorm:"type:uuid;index" json:"customer_id"`
 	Customer    *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	GuardianID  *uuid.UUID `gorm:"type:uuid;index" json:"guardian_id"` // set when uploaded for a dependent
 	
 	// File information
 	FileName    string `gorm:"not null;size:255" json:"file_name" validate:"required"`
@@ -277,8 +325,8 @@ type PrescriptionUpload struct {
 	FileHash    string `gorm:"not null;size:64" json:"file_hash" validate:"required"` // SHA256
 	
 	// Storage information
-	StoragePath   utils.EncryptedString `gorm:"type:text" json:"storage_path"`
-	CloudURL      utils.EncryptedString `gorm:"type:text" json:"cloud_url"`
+	StoragePath   utils.EncryptedString `gorm:"type:text" json:"-"` // storage key, downloaded through the API
+	CloudURL      utils.EncryptedString `gorm:"type:text" json:"-"`
 	
 	// Verification
 	VerifiedBy    *uuid.UUID `gorm:"type:uuid" json:"verified_by"`
@@ -289,7 +337,26 @@ type PrescriptionUpload struct {
 	// Notes
 	VerificationNotes string `gorm:"type:text" json:"verification_notes"`
 	
+	// OCR assist. Text and suggestions hold PHI and are encrypted; they are
+	// served through the OCR endpoints rather than with the upload.
+	OCRStatus      OCRStatus             `gorm:"size:20" json:"ocr_status"`
+	OCRText        utils.EncryptedString `gorm:"type:text" json:"-"`
+	OCRSuggestions utils.EncryptedString `gorm:"type:text" json:"-"` // JSON encoded suggestions
+	OCRError       string                `gorm:"type:text" json:"ocr_error,omitempty"`
+	OCRProcessedAt *time.Time            `json:"ocr_processed_at"`
+	OCRConfirmedBy *uuid.UUID            `gorm:"type:uuid" json:"ocr_confirmed_by"`
+	OCRConfirmedAt *time.Time            `json:"ocr_confirmed_at"`
+	
 	// Compliance
 	RetentionDate     *time.Time `json:"retention_date"`
-	DeletedAt         *time.Time `json:"deleted_at"`
-}
\ No newline at end of file
+}
+
+type OCRStatus string
+
+const (
+	OCRStatusPending     OCRStatus = "pending"
+	OCRStatusCompleted   OCRStatus = "completed"
+	OCRStatusFailed      OCRStatus = "failed"
+	OCRStatusUnavailable OCRStatus = "unavailable" // no OCR provider configured
+	OCRStatusConfirmed   OCRStatus = "confirmed"   // pharmacist accepted the suggestions
+)
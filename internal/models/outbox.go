@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type OutboxKind string
+
+const (
+	OutboxNotification OutboxKind = "notification"
+	OutboxWebhook      OutboxKind = "webhook"
+	OutboxStaffAlert   OutboxKind = "staff_alert"
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending    OutboxStatus = "pending"
+	OutboxSent       OutboxStatus = "sent"
+	OutboxSuppressed OutboxStatus = "suppressed" // opted out of every channel, the email address is suppressed, or no device wants a staff alert
+	OutboxFailed     OutboxStatus = "failed"     // gave up after the maximum attempts
+)
+
+// OutboxMessage is a customer notification, staff alert or webhook delivery
+// written in the same transaction as the change it reports, so it is sent
+// even if the server stops right after the commit. The dispatcher delivers
+// it at least once; webhook receivers can use the message ID to drop
+// repeats.
+type OutboxMessage struct {
+	BaseModel
+	Kind   OutboxKind   `gorm:"size:20;not null" json:"kind"`
+	Event  string       `gorm:"size:50;not null;index" json:"event"` // e.g. order.created
+	Status OutboxStatus `gorm:"size:20;not null;index:idx_outbox_messages_due" json:"status"`
+
+	// Notifications go to the customer, or to Recipient over Channel for
+	// guests without a customer record
+	CustomerID *uuid.UUID          `gorm:"type:uuid;index" json:"customer_id,omitempty"`
+	Channel    string              `gorm:"size:20" json:"channel,omitempty"`
+	Recipient  string              `gorm:"size:255" json:"recipient,omitempty"`
+	Purpose    NotificationPurpose `gorm:"size:20" json:"purpose,omitempty"`
+	Subject    string              `gorm:"size:255" json:"subject,omitempty"`
+	Body       string              `gorm:"type:text" json:"body,omitempty"`
+
+	// Texts are written from this SMS template, filled with SMSData (a JSON
+	// object), when it is stored
+	SMSTemplate string `gorm:"size:100" json:"sms_template,omitempty"`
+	SMSData     string `gorm:"type:text" json:"sms_data,omitempty"`
+
+	// Emails are written from this email template, filled with EmailData (a
+	// JSON object). Data that can change, such as an order's items, is
+	// referenced by ID and loaded when the email is sent.
+	EmailTemplate string `gorm:"size:100" json:"email_template,omitempty"`
+	EmailData     string `gorm:"type:text" json:"email_data,omitempty"`
+
+	// Push notifications carry PushData (a JSON object) to the app, e.g.
+	// the order to open
+	PushData string `gorm:"type:text" json:"push_data,omitempty"`
+
+	// Webhooks POST Payload to URL. Staff alerts keep theirs in Payload too.
+	URL     string `gorm:"size:500" json:"url,omitempty"`
+	Payload string `gorm:"type:text" json:"payload,omitempty"`
+
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index:idx_outbox_messages_due" json:"next_attempt_at"`
+	LastError     string     `gorm:"type:text" json:"last_error,omitempty"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
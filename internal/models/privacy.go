@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConsentPurpose is a processing purpose a customer can consent to under the
+// Data Privacy Act
+type ConsentPurpose string
+
+const (
+	ConsentDataProcessing ConsentPurpose = "data_processing" // required to keep a customer profile
+	ConsentMarketing      ConsentPurpose = "marketing"
+	ConsentReminders      ConsentPurpose = "reminders"    // refill and vaccination reminders
+	ConsentDataSharing    ConsentPurpose = "data_sharing" // e.g. HMOs and prescribers
+)
+
+func (p ConsentPurpose) IsValid() bool {
+	switch p {
+	case ConsentDataProcessing, ConsentMarketing, ConsentReminders, ConsentDataSharing:
+		return true
+	}
+	return false
+}
+
+// ConsentRecord is one grant of consent for a purpose. Withdrawing sets
+// WithdrawnAt rather than deleting the row so the history can be shown to
+// the National Privacy Commission.
+type ConsentRecord struct {
+	BaseModel
+	CustomerID    uuid.UUID      `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Purpose       ConsentPurpose `gorm:"not null;size:50;index" json:"purpose"`
+	NoticeVersion string         `gorm:"size:50" json:"notice_version"` // privacy notice the customer agreed to
+	Channel       string         `gorm:"size:50" json:"channel"`        // in_store, online, phone
+	IPAddress     string         `gorm:"size:45" json:"ip_address,omitempty"`
+
+	GrantedAt   time.Time  `gorm:"not null" json:"granted_at"`
+	WithdrawnAt *time.Time `json:"withdrawn_at"`
+	RecordedBy  *uuid.UUID `gorm:"type:uuid" json:"recorded_by"`
+}
+
+// IsActive reports whether the consent has not been withdrawn
+func (c ConsentRecord) IsActive() bool {
+	return c.WithdrawnAt == nil
+}
+
+type DataSubjectRequestType string
+
+const (
+	DataSubjectAccess  DataSubjectRequestType = "access"
+	DataSubjectErasure DataSubjectRequestType = "erasure"
+)
+
+// DataSubjectRequest logs each data export or erasure carried out for a
+// customer
+type DataSubjectRequest struct {
+	BaseModel
+	CustomerID  uuid.UUID              `gorm:"type:uuid;not null;index" json:"customer_id"`
+	RequestType DataSubjectRequestType `gorm:"not null;size:20;index" json:"request_type"`
+	Reason      string                 `gorm:"type:text" json:"reason"`
+	Summary     string                 `gorm:"type:text" json:"summary"` // JSON summary of what was exported or erased
+
+	ProcessedBy uuid.UUID `gorm:"type:uuid;not null" json:"processed_by"`
+	User        *User     `gorm:"foreignKey:ProcessedBy" json:"user,omitempty"`
+	ProcessedAt time.Time `gorm:"not null" json:"processed_at"`
+}
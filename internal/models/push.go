@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Push providers
+const (
+	PushProviderFCM  = "fcm"  // Firebase Cloud Messaging, for Android and web
+	PushProviderAPNs = "apns" // Apple Push Notification service, for iOS
+)
+
+// PushDevice is an app installation that receives push notifications. It
+// belongs to one of a customer, a staff user, or the guest session of the
+// ordering app, whose orders it is told about.
+type PushDevice struct {
+	BaseModel
+	CustomerID *uuid.UUID `gorm:"type:uuid;index" json:"customer_id,omitempty"`
+	UserID     *uuid.UUID `gorm:"type:uuid;index" json:"user_id,omitempty"`
+	SessionID  *string    `gorm:"size:100;index" json:"-"`
+
+	Provider   string    `gorm:"size:10;not null" json:"provider"`
+	Platform   string    `gorm:"size:20" json:"platform"` // android, ios or web
+	Token      string    `gorm:"size:512;not null;uniqueIndex" json:"-"`
+	DeviceName string    `gorm:"size:100" json:"device_name,omitempty"`
+	AppVersion string    `gorm:"size:50" json:"app_version,omitempty"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// StaffAlert is a kind of push alert sent to staff
+type StaffAlert string
+
+const (
+	StaffAlertLowStock          StaffAlert = "low_stock"          // a product fell to its minimum stock
+	StaffAlertPrescriptionQueue StaffAlert = "prescription_queue" // a prescription is waiting to be verified
+	StaffAlertDocumentExpiry    StaffAlert = "document_expiry"    // a license or accreditation is due for renewal
+)
+
+// StaffAlerts lists every staff alert
+var StaffAlerts = []StaffAlert{StaffAlertLowStock, StaffAlertPrescriptionQueue, StaffAlertDocumentExpiry}
+
+// IsValid reports whether the alert is a known one
+func (a StaffAlert) IsValid() bool {
+	switch a {
+	case StaffAlertLowStock, StaffAlertPrescriptionQueue, StaffAlertDocumentExpiry:
+		return true
+	}
+	return false
+}
+
+// DefaultFor reports whether staff in a role get the alert until they
+// choose otherwise: managers and admins hear about low stock and documents
+// to renew, pharmacists and managers about prescriptions to verify
+func (a StaffAlert) DefaultFor(role UserRole) bool {
+	switch a {
+	case StaffAlertLowStock, StaffAlertDocumentExpiry:
+		return role == RoleAdmin || role == RoleManager
+	case StaffAlertPrescriptionQueue:
+		return role == RolePharmacist || role == RoleManager
+	}
+	return false
+}
+
+// StaffNotificationPreference is a staff user's choice to get or not get
+// one kind of alert on their devices
+type StaffNotificationPreference struct {
+	BaseModel
+	UserID  uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_staff_notification_pref" json:"user_id"`
+	Alert   StaffAlert `gorm:"size:30;not null;uniqueIndex:idx_staff_notification_pref" json:"alert"`
+	Enabled bool       `gorm:"not null" json:"enabled"`
+}
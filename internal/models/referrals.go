@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReferralCode is the code a customer gives friends to sign up with
+type ReferralCode struct {
+	BaseModel
+	CustomerID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"customer_id"`
+	Code       string    `gorm:"not null;size:20;uniqueIndex" json:"code"`
+}
+
+// Referral is a new customer brought in by an existing one. The new
+// customer's first order settles it: it qualifies, and both are rewarded,
+// when the order is large enough and placed in time.
+type Referral struct {
+	BaseModel
+	ReferrerID uuid.UUID `gorm:"type:uuid;not null;index" json:"referrer_id"`
+	Referrer   *Customer `gorm:"foreignKey:ReferrerID" json:"referrer,omitempty"`
+	ReferredID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"referred_id"` // each customer is referred once
+	Referred   *Customer `gorm:"foreignKey:ReferredID" json:"referred,omitempty"`
+	Code       string    `gorm:"not null;size:20" json:"code"`
+
+	Status    ReferralStatus `gorm:"not null;size:20;default:'pending';index" json:"status"`
+	ExpiresAt time.Time      `gorm:"not null" json:"expires_at"` // the first order must be placed by then
+
+	// The first order, a sale or an online order
+	SaleID      *uuid.UUID `gorm:"type:uuid" json:"sale_id,omitempty"`
+	OrderID     *uuid.UUID `gorm:"type:uuid" json:"order_id,omitempty"`
+	OrderTotal  Money      `gorm:"type:bigint;default:0" json:"order_total"`
+	SettledAt   *time.Time `json:"settled_at"`
+	LapseReason string     `gorm:"size:200" json:"lapse_reason,omitempty"`
+
+	// Rewards granted when it qualified
+	RewardType     string `gorm:"size:10" json:"reward_type,omitempty"` // points or credit
+	ReferrerPoints int    `gorm:"default:0" json:"referrer_points"`
+	ReferrerCredit Money  `gorm:"type:bigint;default:0" json:"referrer_credit"`
+	RefereePoints  int    `gorm:"default:0" json:"referee_points"`
+	RefereeCredit  Money  `gorm:"type:bigint;default:0" json:"referee_credit"`
+
+	RecordedBy *uuid.UUID `gorm:"type:uuid" json:"recorded_by,omitempty"`
+}
+
+type ReferralStatus string
+
+const (
+	ReferralStatusPending   ReferralStatus = "pending"   // no order yet
+	ReferralStatusQualified ReferralStatus = "qualified" // rewarded
+	ReferralStatusLapsed    ReferralStatus = "lapsed"    // the first order was too small or too late
+)
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refill tracks when a dispensed medication will run out so the customer can
+// be reminded to reorder it
+type Refill struct {
+	BaseModel
+	CustomerID uuid.UUID `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Customer   *Customer `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	ProductID  uuid.UUID `gorm:"type:uuid;not null;index" json:"product_id"`
+	Product    *Product  `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+
+	// Source of the dispense
+	SaleItemID  *uuid.UUID `gorm:"type:uuid;index" json:"sale_item_id"`
+	OrderItemID *uuid.UUID `gorm:"type:uuid;index" json:"order_item_id"`
+
+	Quantity    int       `gorm:"not null" json:"quantity"`
+	DaysSupply  int       `gorm:"not null" json:"days_supply"`
+	DispensedAt time.Time `gorm:"not null" json:"dispensed_at"`
+	DueDate     time.Time `gorm:"not null;index" json:"due_date"`
+
+	Status          RefillStatus `gorm:"not null;size:20;default:'scheduled';index" json:"status"`
+	RemindedAt      *time.Time   `json:"reminded_at"`
+	ReminderChannel string       `gorm:"size:20" json:"reminder_channel"`
+	ReorderedAt     *time.Time   `json:"reordered_at"`
+
+	// ReorderToken lets the customer prefill their cart from a reminder link
+	ReorderToken string `gorm:"uniqueIndex;not null;size:64" json:"-"`
+}
+
+type RefillStatus string
+
+const (
+	RefillStatusScheduled RefillStatus = "scheduled"
+	RefillStatusReminded  RefillStatus = "reminded"
+	RefillStatusReordered RefillStatus = "reordered"
+	RefillStatusFilled    RefillStatus = "filled" // superseded by a later dispense
+	RefillStatusCancelled RefillStatus = "cancelled"
+)
+
+// IsOpen reports whether the refill is still waiting on the customer
+func (s RefillStatus) IsOpen() bool {
+	return s == RefillStatusScheduled || s == RefillStatusReminded
+}
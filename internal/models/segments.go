@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CustomerTag is a free-form label staff attach to a customer
+type CustomerTag struct {
+	BaseModel
+	CustomerID uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_customer_tag" json:"customer_id"`
+	Tag        string     `gorm:"not null;size:50;uniqueIndex:idx_customer_tag;index" json:"tag"`
+	CreatedBy  *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+}
+
+// NormalizeTag lowercases a tag and joins words with hyphens so "High Value"
+// and "high-value" are the same tag
+func NormalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// SegmentRule is how a segment's members are computed
+type SegmentRule string
+
+const (
+	// Customers whose medical history or current medications mention Keyword
+	SegmentRuleCondition SegmentRule = "condition"
+	// Customers who bought from Category within the last Days
+	SegmentRuleCategory SegmentRule = "category"
+	// Customers who spent at least MinSpend within the last Days (0 = ever)
+	SegmentRuleHighValue SegmentRule = "high_value"
+	// Customers with purchases but none within the last Days
+	SegmentRuleLapsed SegmentRule = "lapsed"
+)
+
+func (r SegmentRule) IsValid() bool {
+	switch r {
+	case SegmentRuleCondition, SegmentRuleCategory, SegmentRuleHighValue, SegmentRuleLapsed:
+		return true
+	}
+	return false
+}
+
+// Segment is a rule-based customer group, recomputed by a background job
+type Segment struct {
+	BaseModel
+	Slug        string      `gorm:"uniqueIndex;not null;size:100" json:"slug"`
+	Name        string      `gorm:"not null;size:100" json:"name"`
+	Description string      `gorm:"type:text" json:"description"`
+	Rule        SegmentRule `gorm:"not null;size:20" json:"rule"`
+
+	// Rule parameters; which apply depends on Rule
+	Keyword  string `gorm:"size:100" json:"keyword,omitempty"`
+	Category string `gorm:"size:100" json:"category,omitempty"`
+	Days     int    `gorm:"default:0" json:"days,omitempty"`
+	MinSpend Money  `gorm:"type:bigint;default:0" json:"min_spend,omitempty"`
+
+	IsActive       bool       `gorm:"not null;default:true" json:"is_active"`
+	MemberCount    int        `gorm:"default:0" json:"member_count"`
+	LastComputedAt *time.Time `json:"last_computed_at"`
+	CreatedBy      *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+}
+
+// SegmentMember is a customer's membership in a segment as of the last run
+type SegmentMember struct {
+	SegmentID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"segment_id"`
+	CustomerID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"customer_id"`
+	ComputedAt time.Time `gorm:"not null" json:"computed_at"`
+}
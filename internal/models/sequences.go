@@ -0,0 +1,46 @@
+package models
+
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// NumberSequence is the counter behind one day's sale or order numbers at
+// a branch in one database, such as SALE-20261016-MKT-K7Q. A branch rings
+// up sales in the store's database and, while the store is offline, takes
+// orders in the cloud's, and the two sync. The database's node code in the
+// prefix keeps their numbers apart.
+type NumberSequence struct {
+	BaseModel
+	Prefix     string `gorm:"size:40;not null;uniqueIndex" json:"prefix"`
+	NextNumber int64  `gorm:"not null;default:1" json:"next_number"`
+}
+
+// DatabaseNode holds the node code of the database it is stored in, the
+// one row with DatabaseNodeID. It isn't synced: each database that syncs
+// has a code of its own.
+type DatabaseNode struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Code      string    `gorm:"size:8;not null" json:"code"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DatabaseNodeID is the ID of a database's DatabaseNode row
+const DatabaseNodeID = 1
+
+// nodeCodeAlphabet leaves out I, O, 0 and 1, which are misread on receipts.
+// Its 32 letters divide 256, so each is as likely as the others.
+const nodeCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// NewNodeCode returns a random three letter node code for a database
+func NewNodeCode() (string, error) {
+	code := make([]byte, 3)
+	if _, err := rand.Read(code); err != nil {
+		return "", fmt.Errorf("failed to generate node code: %w", err)
+	}
+	for i := range code {
+		code[i] = nodeCodeAlphabet[int(code[i])%len(nodeCodeAlphabet)]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMSTemplate is the wording of one kind of text message. Body may use
+// {{placeholders}}; which ones are filled depends on the message, e.g.
+// {{order_number}} for order updates. Messages whose template is missing or
+// inactive are sent with their built-in wording.
+type SMSTemplate struct {
+	BaseModel
+	Name        string     `gorm:"uniqueIndex;not null;size:100" json:"name"` // e.g. order.ready
+	Description string     `gorm:"size:255" json:"description"`
+	Body        string     `gorm:"type:text;not null" json:"body"`
+	IsActive    bool       `gorm:"not null;default:true" json:"is_active"`
+	UpdatedBy   *uuid.UUID `gorm:"type:uuid" json:"updated_by,omitempty"`
+}
+
+type SMSStatus string
+
+const (
+	SMSQueued    SMSStatus = "queued"    // handed to the provider
+	SMSSent      SMSStatus = "sent"      // passed on to the carrier
+	SMSDelivered SMSStatus = "delivered" // the carrier confirmed delivery
+	SMSFailed    SMSStatus = "failed"
+)
+
+// IsFinal reports whether the status will not change again
+func (s SMSStatus) IsFinal() bool {
+	return s == SMSDelivered || s == SMSFailed
+}
+
+// SMSMessage logs one text message sent through the provider and what its
+// delivery receipts reported. The text itself is not kept, as it may carry a
+// one-time code or medication names, and the number is masked.
+type SMSMessage struct {
+	BaseModel
+	Provider          string     `gorm:"size:20;not null" json:"provider"`
+	ProviderMessageID string     `gorm:"size:100;index" json:"provider_message_id,omitempty"`
+	Recipient         string     `gorm:"size:20;not null" json:"recipient"` // e.g. +63917***4567
+	CustomerID        *uuid.UUID `gorm:"type:uuid;index" json:"customer_id,omitempty"`
+	Template          string     `gorm:"size:100;index" json:"template,omitempty"`
+	Segments          int        `gorm:"not null;default:1" json:"segments"`
+	Status            SMSStatus  `gorm:"size:20;not null;index" json:"status"`
+	ProviderStatus    string     `gorm:"size:50" json:"provider_status,omitempty"` // status as the provider words it
+	Error             string     `gorm:"type:text" json:"error,omitempty"`
+	SentAt            *time.Time `json:"sent_at,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+}
+
+// PhoneVerification is a one-time code texted to a customer to confirm their
+// phone number. Only a hash of the code is kept.
+type PhoneVerification struct {
+	BaseModel
+	CustomerID uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Phone      string     `gorm:"size:20;not null" json:"-"` // the number the code was sent to
+	CodeHash   string     `gorm:"size:64;not null" json:"-"`
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	Attempts   int        `gorm:"not null;default:0" json:"attempts"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	CreatedBy  *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+}
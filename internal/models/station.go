@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type StationJobKind string
+
+const (
+	StationJobReceipt    StationJobKind = "receipt"
+	StationJobLabel      StationJobKind = "label"
+	StationJobPickList   StationJobKind = "picklist"
+	StationJobOpenDrawer StationJobKind = "open_drawer"
+)
+
+// Station devices, as the station agent knows them
+type StationDevice string
+
+const (
+	DeviceReceiptPrinter StationDevice = "receipt_printer"
+	DeviceLabelPrinter   StationDevice = "label_printer"
+	DeviceCashDrawer     StationDevice = "cash_drawer" // kicked through the receipt printer
+)
+
+type StationJobStatus string
+
+const (
+	StationJobQueued    StationJobStatus = "queued"
+	StationJobSent      StationJobStatus = "sent" // claimed by the agent, not yet reported back
+	StationJobDone      StationJobStatus = "done"
+	StationJobFailed    StationJobStatus = "failed"
+	StationJobCancelled StationJobStatus = "cancelled"
+	StationJobExpired   StationJobStatus = "expired" // never printed in time to matter
+)
+
+// StationJob is something for the agent running beside a paired terminal
+// to do with the hardware attached to it: print a receipt, labels or a pick
+// list, or open the cash drawer. The agent polls for the terminal's jobs
+// and reports back how each went.
+type StationJob struct {
+	BaseModel
+	TerminalID uuid.UUID `gorm:"type:uuid;not null;index:idx_station_jobs_terminal_status" json:"terminal_id"`
+	BranchID   uuid.UUID `gorm:"type:uuid;not null;index" json:"branch_id"`
+
+	Kind   StationJobKind   `gorm:"size:20;not null" json:"kind"`
+	Device StationDevice    `gorm:"size:20;not null" json:"device"`
+	Status StationJobStatus `gorm:"size:20;not null;index:idx_station_jobs_terminal_status" json:"status"`
+
+	// What the device is sent: Format is escpos, pdf or none for a bare
+	// drawer kick. Payload is only handed to the agent.
+	Format      string `gorm:"size:20;not null" json:"format"`
+	ContentType string `gorm:"size:100;not null" json:"content_type"`
+	Payload     []byte `json:"-"`
+
+	// What was printed, e.g. the sale or order it is for
+	Reference string     `gorm:"size:100" json:"reference,omitempty"`
+	SaleID    *uuid.UUID `gorm:"type:uuid;index" json:"sale_id,omitempty"`
+	OrderID   *uuid.UUID `gorm:"type:uuid;index" json:"order_id,omitempty"`
+	Reason    string     `gorm:"size:255" json:"reason,omitempty"` // why the drawer was opened
+
+	RequestedBy *uuid.UUID `gorm:"type:uuid" json:"requested_by,omitempty"`
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SyncCursor records how far a target database has been synchronized from
+// a source for one table. It is stored in the target, and is advanced in
+// the same transaction as the rows it covers.
+type SyncCursor struct {
+	BaseModel
+	Source    string `gorm:"size:50;not null;uniqueIndex:idx_sync_cursors_table" json:"source"`
+	TableName string `gorm:"size:100;not null;uniqueIndex:idx_sync_cursors_table" json:"table_name"`
+
+	// Rows are read in (updated_at, id) order, soft deletes in (deleted_at, id)
+	LastUpdatedAt time.Time `gorm:"not null" json:"last_updated_at"`
+	LastUpdatedID string    `gorm:"size:36" json:"last_updated_id"`
+	LastDeletedAt time.Time `gorm:"not null" json:"last_deleted_at"`
+	LastDeletedID string    `gorm:"size:36" json:"last_deleted_id"`
+	// Position in the source's sync_deletions log (only on its own cursor row)
+	LastDeletionID uint64 `gorm:"not null;default:0" json:"last_deletion_id"`
+
+	LastRunAt   time.Time `json:"last_run_at"`
+	RowsApplied int64     `gorm:"not null;default:0" json:"rows_applied"`
+	Conflicts   int64     `gorm:"not null;default:0" json:"conflicts"` // rows changed on both sides, see SyncConflict
+}
+
+// SyncDeletion is the change log of hard-deleted rows in a sync source,
+// written by a trigger so that the delete can be replayed on the targets
+type SyncDeletion struct {
+	ID        uint64    `gorm:"primaryKey;autoIncrement" json:"id"`
+	TableName string    `gorm:"size:100;not null" json:"table_name"`
+	RowID     uuid.UUID `gorm:"type:uuid;not null" json:"row_id"`
+	RemovedAt time.Time `gorm:"not null" json:"removed_at"`
+}
+
+type SyncConflictStatus string
+
+const (
+	SyncConflictOpen     SyncConflictStatus = "open"
+	SyncConflictAccepted SyncConflictStatus = "accepted" // the automatic resolution was kept
+	SyncConflictReverted SyncConflictStatus = "reverted" // the discarded version was restored
+)
+
+// SyncConflict is a row that was changed in both databases between two
+// syncs. The later change was applied automatically; the other version is
+// kept here for review. It is stored in the database the sync wrote to.
+type SyncConflict struct {
+	BaseModel
+	Source    string    `gorm:"size:50;not null" json:"source"`
+	TableName string    `gorm:"size:100;not null;index" json:"table_name"`
+	RowID     uuid.UUID `gorm:"type:uuid;not null;index" json:"row_id"`
+
+	// Resolution is source_won or target_won
+	Resolution         string    `gorm:"size:20;not null" json:"resolution"`
+	AppliedData        string    `gorm:"type:text;not null" json:"applied_data"`   // JSON of the version kept
+	DiscardedData      string    `gorm:"type:text;not null" json:"discarded_data"` // JSON of the version that lost
+	AppliedUpdatedAt   time.Time `gorm:"not null" json:"applied_updated_at"`
+	DiscardedUpdatedAt time.Time `gorm:"not null" json:"discarded_updated_at"`
+
+	Status      SyncConflictStatus `gorm:"size:20;not null;default:'open';index" json:"status"`
+	ReviewedBy  *uuid.UUID         `gorm:"type:uuid" json:"reviewed_by"`
+	ReviewedAt  *time.Time         `json:"reviewed_at"`
+	ReviewNotes string             `gorm:"type:text" json:"review_notes,omitempty"`
+}
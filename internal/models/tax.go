@@ -0,0 +1,15 @@
+package models
+
+// TaxBreakdown is the VAT summary printed on a receipt: what part of the
+// sale was VATable, VAT-exempt or zero-rated, and the VAT charged
+type TaxBreakdown struct {
+	VATableSales   Money   `gorm:"column:vatable_sales;type:bigint;not null;default:0" json:"vatable_sales"`
+	VATExemptSales Money   `gorm:"column:vat_exempt_sales;type:bigint;not null;default:0" json:"vat_exempt_sales"`
+	ZeroRatedSales Money   `gorm:"column:zero_rated_sales;type:bigint;not null;default:0" json:"zero_rated_sales"`
+	VATAmount      Money   `gorm:"column:vat_amount;type:bigint;not null;default:0" json:"vat_amount"`
+	Rate           float64 `gorm:"type:decimal(5,4);not null;default:0" json:"rate"`
+
+	// ExemptionType is set when the buyer's senior citizen or PWD ID made
+	// the sale VAT-exempt
+	ExemptionType string `gorm:"size:50" json:"exemption_type,omitempty"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Terminal is a POS register at a branch. Sales rung up on a paired
+// terminal carry it and take the next number of its invoice series, so
+// invoices run without gaps per register as BIR requires.
+type Terminal struct {
+	BaseModel
+	Name     string    `gorm:"size:100;not null" json:"name"`
+	BranchID uuid.UUID `gorm:"type:uuid;not null;index" json:"branch_id"`
+	Branch   *Branch   `gorm:"foreignKey:BranchID" json:"branch,omitempty"`
+
+	// Invoices are numbered InvoicePrefix-NNNNNNNNNN
+	InvoicePrefix     string `gorm:"size:20;not null;uniqueIndex" json:"invoice_prefix"`
+	NextInvoiceNumber int64  `gorm:"not null;default:1" json:"next_invoice_number"`
+	MachineID         string `gorm:"size:50" json:"machine_id"` // BIR machine identification number
+
+	IsActive bool `gorm:"not null;default:true" json:"is_active"`
+
+	// A device pairs with a one-time code and is then known by its token.
+	// Only hashes are stored.
+	PairingCodeHash  string     `gorm:"size:64;index" json:"-"`
+	PairingExpiresAt *time.Time `json:"pairing_expires_at,omitempty"`
+	DeviceTokenHash  string     `gorm:"size:64;index" json:"-"`
+	PairedAt         *time.Time `json:"paired_at"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	LastSeenIP       string     `gorm:"size:45" json:"last_seen_ip"`
+}
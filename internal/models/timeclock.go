@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ClockMethod is how an employee clocked in or out
+type ClockMethod string
+
+const (
+	ClockSession ClockMethod = "session" // signed in to the app
+	ClockBadge   ClockMethod = "badge"   // scanned their personal QR badge at a register
+	ClockManager ClockMethod = "manager" // closed by a manager, e.g. a forgotten clock-out
+)
+
+// Shift is an employee's time on the clock, from clock-in to clock-out.
+// A shift taken at a register keeps its cash drawer: it is counted in and
+// out, and the sales rung up during it are put down to it.
+type Shift struct {
+	BaseModel
+	UserID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	User     *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	BranchID *uuid.UUID `gorm:"type:uuid;index" json:"branch_id,omitempty"`
+
+	// The register whose cash drawer the shift keeps, if any
+	TerminalID *uuid.UUID `gorm:"type:uuid;index" json:"terminal_id,omitempty"`
+	Terminal   *Terminal  `gorm:"foreignKey:TerminalID" json:"terminal,omitempty"`
+
+	// Set only while the shift is open, so an employee is on one shift and a
+	// drawer kept by one shift at a time
+	OpenUserID     *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"-"`
+	OpenTerminalID *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"-"`
+
+	ClockInAt      time.Time   `gorm:"not null;index" json:"clock_in_at"`
+	ClockInMethod  ClockMethod `gorm:"size:20;not null" json:"clock_in_method"`
+	ClockOutAt     *time.Time  `gorm:"index" json:"clock_out_at,omitempty"`
+	ClockOutMethod ClockMethod `gorm:"size:20" json:"clock_out_method,omitempty"`
+	ClosedBy       *uuid.UUID  `gorm:"type:uuid" json:"closed_by,omitempty"` // the manager who closed it
+
+	// The drawer count. Expected cash is the opening float plus the cash
+	// sales of the shift; the variance is what was counted less that.
+	OpeningCash    *Money `gorm:"type:bigint" json:"opening_cash,omitempty"`
+	ClosingCash    *Money `gorm:"type:bigint" json:"closing_cash,omitempty"`
+	ExpectedCash   *Money `gorm:"type:bigint" json:"expected_cash,omitempty"`
+	CashVariance   *Money `gorm:"type:bigint" json:"cash_variance,omitempty"`
+	CashSales      int    `gorm:"not null;default:0" json:"cash_sales"`
+	NoSaleOpenings int    `gorm:"not null;default:0" json:"no_sale_openings"` // drawer opened without a sale
+
+	Notes string `gorm:"type:text" json:"notes"`
+}
+
+// IsOpen reports whether the employee is still on the clock
+func (s *Shift) IsOpen() bool {
+	return s.ClockOutAt == nil
+}
+
+// Worked is the time on the clock, up to now for an open shift
+func (s *Shift) Worked(now time.Time) time.Duration {
+	end := now
+	if s.ClockOutAt != nil {
+		end = *s.ClockOutAt
+	}
+	return end.Sub(s.ClockInAt)
+}
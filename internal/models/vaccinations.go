@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VaccinationRecord is one vaccine dose administered under a vaccination
+// service
+type VaccinationRecord struct {
+	BaseModel
+	CustomerID uuid.UUID  `gorm:"type:uuid;not null;index" json:"customer_id"`
+	Customer   *Customer  `gorm:"foreignKey:CustomerID" json:"customer,omitempty"`
+	ServiceID  uuid.UUID  `gorm:"type:uuid;not null;index" json:"service_id"`
+	Service    *Service   `gorm:"foreignKey:ServiceID" json:"service,omitempty"`
+	SaleItemID *uuid.UUID `gorm:"type:uuid;index" json:"sale_item_id"`
+
+	// Vaccine given
+	ProductID    *uuid.UUID `gorm:"type:uuid;index" json:"product_id"`
+	Product      *Product   `gorm:"foreignKey:ProductID" json:"product,omitempty"`
+	VaccineName  string     `gorm:"not null;size:255" json:"vaccine_name"`
+	Manufacturer string     `gorm:"size:255" json:"manufacturer"`
+	BatchNumber  string     `gorm:"not null;size:100;index" json:"batch_number"`
+	ExpiryDate   *time.Time `json:"expiry_date"`
+
+	DoseNumber int             `gorm:"not null" json:"dose_number"`
+	TotalDoses int             `gorm:"default:0" json:"total_doses"` // 0 when the series is open-ended, e.g. boosters
+	Site       VaccinationSite `gorm:"size:30" json:"site"`
+	Route      string          `gorm:"size:30" json:"route"` // IM, SC, ID, oral, intranasal
+	Notes      string          `gorm:"type:text" json:"notes"`
+
+	AdministeredBy uuid.UUID `gorm:"type:uuid;not null" json:"administered_by"`
+	Administrator  *User     `gorm:"foreignKey:AdministeredBy" json:"administrator,omitempty"`
+	AdministeredAt time.Time `gorm:"not null;index" json:"administered_at"`
+
+	// Next dose in the series
+	NextDoseDue        *time.Time `gorm:"index" json:"next_dose_due"`
+	NextDoseRemindedAt *time.Time `json:"next_dose_reminded_at"`
+	NextDoseGivenAt    *time.Time `json:"next_dose_given_at"`
+
+	// Code printed on the certificate and encoded in its QR code
+	CertificateCode string `gorm:"uniqueIndex;size:100" json:"certificate_code"`
+}
+
+type VaccinationSite string
+
+const (
+	VaccinationSiteLeftDeltoid  VaccinationSite = "left_deltoid"
+	VaccinationSiteRightDeltoid VaccinationSite = "right_deltoid"
+	VaccinationSiteLeftThigh    VaccinationSite = "left_thigh"
+	VaccinationSiteRightThigh   VaccinationSite = "right_thigh"
+	VaccinationSiteOral         VaccinationSite = "oral"
+	VaccinationSiteIntranasal   VaccinationSite = "intranasal"
+	VaccinationSiteOther        VaccinationSite = "other"
+)
+
+func (s VaccinationSite) IsValid() bool {
+	switch s {
+	case VaccinationSiteLeftDeltoid, VaccinationSiteRightDeltoid, VaccinationSiteLeftThigh,
+		VaccinationSiteRightThigh, VaccinationSiteOral, VaccinationSiteIntranasal, VaccinationSiteOther:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"pharmacy-backend/internal/utils"
+)
+
+type InboundWebhookStatus string
+
+const (
+	InboundWebhookReceived  InboundWebhookStatus = "received" // waiting for a worker
+	InboundWebhookProcessed InboundWebhookStatus = "processed"
+	InboundWebhookIgnored   InboundWebhookStatus = "ignored" // nothing handles its event type
+	InboundWebhookFailed    InboundWebhookStatus = "failed"  // the last attempt failed; retried by its job
+)
+
+// InboundWebhook is an event a third party, such as a payment provider or
+// courier, posted to us. It is stored once its signature is checked and
+// processed later by a background job. An integration's event IDs are
+// unique, so an event it sends again is not processed twice.
+type InboundWebhook struct {
+	BaseModel
+	Integration string                `gorm:"size:50;not null;uniqueIndex:idx_inbound_webhooks_event" json:"integration"`
+	EventID     string                `gorm:"size:200;not null;uniqueIndex:idx_inbound_webhooks_event" json:"event_id"`
+	EventType   string                `gorm:"size:100;index" json:"event_type"`
+	Payload     utils.EncryptedString `gorm:"type:text" json:"payload"`
+	SourceIP    string                `gorm:"size:45" json:"source_ip"`
+
+	Status      InboundWebhookStatus `gorm:"size:20;not null;index" json:"status"`
+	Attempts    int                  `gorm:"not null;default:0" json:"attempts"`
+	LastError   string               `gorm:"type:text" json:"last_error,omitempty"`
+	ProcessedAt *time.Time           `json:"processed_at,omitempty"`
+}
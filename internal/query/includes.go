@@ -0,0 +1,231 @@
+package query
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidSelection = errors.New("invalid selection")
+
+// MaxIncludeDepth is how many relations deep ?include= can reach, e.g.
+// sale_items.product is two
+const MaxIncludeDepth = 2
+
+// Responses embed their related records only when asked. ?include= lists
+// the relations to embed by their JSON path, e.g.
+// ?include=customer,sale_items.product, and replaces the endpoint's
+// defaults; an empty ?include= embeds none, and relations left out are
+// left out of the response too. ?fields= lists the top-level fields to
+// keep, e.g. ?fields=id,total. The id and any included relation are always
+// kept.
+
+// Relation is a relation a response can embed, as preloaded
+type Relation struct {
+	Preload    string
+	Conditions []interface{}
+}
+
+// Includes are the relations of a model that responses can embed, by JSON
+// path, and the fields ?fields= can pick from
+type Includes struct {
+	relations map[string]Relation
+	fields    map[string]bool
+}
+
+// NewIncludes lists the relations of model that can be embedded. Its
+// fields are read from the model's JSON tags.
+func NewIncludes(model interface{}, relations map[string]Relation) Includes {
+	fields := make(map[string]bool)
+	collectJSONFields(reflect.TypeOf(model), fields)
+	return Includes{relations: relations, fields: fields}
+}
+
+// Parse reads ?include= and ?fields= from query. Without ?include= the
+// defaults are embedded.
+func (i Includes) Parse(query url.Values, defaults ...string) (Selection, error) {
+	names := defaults
+	if _, ok := query["include"]; ok {
+		names = splitList(query.Get("include"))
+	}
+
+	var selection Selection
+	for _, name := range names {
+		if depth := strings.Count(name, ".") + 1; depth > MaxIncludeDepth {
+			return Selection{}, fmt.Errorf("%w: include %s nests more than %d deep", ErrInvalidSelection, name, MaxIncludeDepth)
+		}
+		relation, ok := i.relations[name]
+		if !ok {
+			return Selection{}, fmt.Errorf("%w: unknown include %s, use %s", ErrInvalidSelection, name, strings.Join(i.names(), ", "))
+		}
+		selection.names = append(selection.names, name)
+		selection.relations = append(selection.relations, relation)
+	}
+	for _, name := range i.names() {
+		if !selection.embeds(name) {
+			selection.omitted = append(selection.omitted, name)
+		}
+	}
+
+	for _, field := range splitList(query.Get("fields")) {
+		if !i.fields[field] {
+			return Selection{}, fmt.Errorf("%w: unknown field %s", ErrInvalidSelection, field)
+		}
+		selection.fields = append(selection.fields, field)
+	}
+	return selection, nil
+}
+
+// Select is the selection embedding names, for callers that don't take
+// them from a request
+func (i Includes) Select(names ...string) Selection {
+	selection, err := i.Parse(url.Values{}, names...)
+	if err != nil {
+		panic(err)
+	}
+	return selection
+}
+
+func (i Includes) names() []string {
+	names := make([]string, 0, len(i.relations))
+	for name := range i.relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Selection is what a request asked a response to embed and keep
+type Selection struct {
+	names     []string
+	relations []Relation
+	omitted   []string
+	fields    []string
+}
+
+// Apply preloads the selected relations on query
+func (s Selection) Apply(query *gorm.DB) *gorm.DB {
+	for _, relation := range s.relations {
+		query = query.Preload(relation.Preload, relation.Conditions...)
+	}
+	return query
+}
+
+// Render trims value, a record or a slice of them, to the selected fields
+// and relations. Relations held by value rather than pointer are encoded
+// even when they weren't loaded, so they have to be taken out here.
+func (s Selection) Render(value interface{}) (interface{}, error) {
+	if len(s.fields) == 0 && len(s.omitted) == 0 {
+		return value, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var rendered interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&rendered); err != nil {
+		return nil, err
+	}
+
+	for _, name := range s.omitted {
+		omitPath(rendered, strings.Split(name, "."))
+	}
+	if len(s.fields) > 0 {
+		keep := map[string]bool{"id": true}
+		for _, field := range s.fields {
+			keep[field] = true
+		}
+		for _, name := range s.names {
+			keep[strings.SplitN(name, ".", 2)[0]] = true
+		}
+		eachRecord(rendered, func(record map[string]interface{}) {
+			for field := range record {
+				if !keep[field] {
+					delete(record, field)
+				}
+			}
+		})
+	}
+	return rendered, nil
+}
+
+// embeds reports whether the selection embeds the relation name, by
+// itself or on the way to one nested in it
+func (s Selection) embeds(name string) bool {
+	for _, selected := range s.names {
+		if selected == name || strings.HasPrefix(selected, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Private helper methods
+
+// omitPath deletes the field at path from the records in value, looking
+// through lists along the way
+func omitPath(value interface{}, path []string) {
+	eachRecord(value, func(record map[string]interface{}) {
+		if len(path) == 1 {
+			delete(record, path[0])
+		} else if nested, ok := record[path[0]]; ok {
+			omitPath(nested, path[1:])
+		}
+	})
+}
+
+// eachRecord calls fn with value when it is a record, or with each record
+// in it when it is a list
+func eachRecord(value interface{}, fn func(map[string]interface{})) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			if record, ok := item.(map[string]interface{}); ok {
+				fn(record)
+			}
+		}
+	}
+}
+
+// collectJSONFields adds the JSON names of the fields of t, including those
+// of embedded structs like BaseModel
+func collectJSONFields(t reflect.Type, fields map[string]bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for n := 0; n < t.NumField(); n++ {
+		field := t.Field(n)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !field.IsExported():
+		case field.Anonymous && name == "":
+			collectJSONFields(field.Type, fields)
+		case name != "":
+			fields[name] = true
+		default:
+			fields[field.Name] = true
+		}
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
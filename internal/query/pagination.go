@@ -0,0 +1,75 @@
+package query
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// MaxCursorPageSize caps the rows on one keyset page
+const MaxCursorPageSize = 200
+
+// Keyset pagination lists rows newest first by (created_at, id). A cursor is
+// the position of the last row on a page, so a deep page costs the same as
+// the first and rows added meanwhile don't shift the pages after it.
+
+// EncodeCursor returns the cursor of the page after the row with createdAt
+// and id
+func EncodeCursor(createdAt time.Time, id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + id.String()))
+}
+
+func DecodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return time.Time{}, uuid.Nil, ErrInvalidCursor
+	}
+	return createdAt, id, nil
+}
+
+// AfterCursor orders query newest first by the created_at and id of table
+// and, unless cursor is empty, limits it to the rows after the cursor
+func AfterCursor(query *gorm.DB, table, cursor string) (*gorm.DB, error) {
+	query = query.Order(fmt.Sprintf("%s.created_at DESC, %s.id DESC", table, table))
+	if cursor == "" {
+		return query, nil
+	}
+
+	createdAt, id, err := DecodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	return query.Where(fmt.Sprintf("%s.created_at < ? OR (%s.created_at = ? AND %s.id < ?)", table, table, table),
+		createdAt, createdAt, id), nil
+}
+
+// CursorPageSize returns limit within 1 and MaxCursorPageSize, or
+// defaultSize when it isn't set
+func CursorPageSize(limit, defaultSize int) int {
+	if limit <= 0 {
+		return defaultSize
+	}
+	if limit > MaxCursorPageSize {
+		return MaxCursorPageSize
+	}
+	return limit
+}
@@ -0,0 +1,171 @@
+// Package query holds the list query building blocks the repositories and
+// services share: text and list searches, ?include= and ?fields= selections,
+// keyset cursors and customer targeting.
+package query
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"pharmacy-backend/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// minPhoneDigits is how many digits a search word needs before it is also
+// matched against phone numbers
+const minPhoneDigits = 3
+
+// TextSearch is a case-insensitive contains search that behaves the same on
+// PostgreSQL and SQLite. LIKE is case-sensitive on PostgreSQL and ILIKE does
+// not exist on SQLite, so both sides are lowercased instead.
+//
+// The term is split into words and every word must match at least one column,
+// so "maria sant" finds Maria Santos. Words with enough digits are also
+// matched against the phone columns ignoring spaces, dashes, brackets and the
+// +63 or 0 prefix, so "0917 123 4567" finds +63-917-123-4567.
+type TextSearch struct {
+	Columns      []string
+	PhoneColumns []string
+}
+
+// Apply restricts query to rows matching every word of term. An empty term
+// leaves the query unchanged.
+func (s TextSearch) Apply(query *gorm.DB, term string) *gorm.DB {
+	term = utils.NormalizeSearchTerm(term)
+	for _, word := range searchWords(term) {
+		var conditions []string
+		var args []interface{}
+
+		pattern := "%" + escapeLike(strings.ToLower(word)) + "%"
+		for _, column := range s.Columns {
+			conditions = append(conditions, "LOWER("+column+") LIKE ? ESCAPE '\\'")
+			args = append(args, pattern)
+		}
+
+		if digits := normalizePhone(word); len(digits) >= minPhoneDigits {
+			for _, column := range s.PhoneColumns {
+				conditions = append(conditions, phoneDigitsSQL(column)+" LIKE ?")
+				args = append(args, "%"+digits+"%")
+			}
+		}
+
+		if len(conditions) == 0 {
+			continue
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return query
+}
+
+// ListSearch matches rows whose JSON array column lists a value, e.g. the
+// products whose label lists warfarin among their interactions. On
+// PostgreSQL it is a jsonb @> containment, which the column's GIN index
+// answers. Labels are entered as written, so the value is tried as given,
+// in lowercase, capitalized, in title case and in uppercase; SQLite
+// compares the elements ignoring case instead.
+type ListSearch struct {
+	Column string
+}
+
+// Apply restricts query to rows whose list contains value. An empty value
+// leaves the query unchanged.
+func (s ListSearch) Apply(query *gorm.DB, value string) *gorm.DB {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return query
+	}
+
+	if !strings.Contains(query.Dialector.Name(), "postgres") {
+		return query.Where("EXISTS (SELECT 1 FROM json_each("+s.Column+") WHERE LOWER(json_each.value) = ?)", strings.ToLower(value))
+	}
+
+	var conditions []string
+	var args []interface{}
+	seen := make(map[string]bool)
+	for _, spelling := range []string{value, strings.ToLower(value), capitalize(value, false), capitalize(value, true), strings.ToUpper(value)} {
+		if seen[spelling] {
+			continue
+		}
+		seen[spelling] = true
+		element, _ := json.Marshal([]string{spelling})
+		conditions = append(conditions, s.Column+" @> ?::jsonb")
+		args = append(args, string(element))
+	}
+	return query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// capitalize upper-cases the first letter of a lowercased value, or of
+// each of its words
+func capitalize(value string, eachWord bool) string {
+	runes := []rune(strings.ToLower(value))
+	for i, r := range runes {
+		if i == 0 || (eachWord && unicode.IsSpace(runes[i-1])) {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
+
+// searchWords splits a search term on whitespace and commas. A word that is
+// only phone punctuation and digits, like "0917-123-4567", stays whole.
+func searchWords(term string) []string {
+	if isPhoneLike(term) {
+		return []string{strings.TrimSpace(term)}
+	}
+	return strings.FieldsFunc(term, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+}
+
+// normalizePhone reduces a phone number to its digits without the
+// Philippine country code or trunk prefix
+func normalizePhone(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	switch {
+	case strings.HasPrefix(digits, "63") && len(digits) >= 12:
+		digits = digits[2:]
+	case strings.HasPrefix(digits, "0") && len(digits) >= 2:
+		digits = digits[1:]
+	}
+	return digits
+}
+
+// phoneDigitsSQL strips the separators phone numbers are usually stored with
+func phoneDigitsSQL(column string) string {
+	expr := column
+	for _, sep := range []string{"-", " ", "(", ")", "+", "."} {
+		expr = "REPLACE(" + expr + ", '" + sep + "', '')"
+	}
+	return expr
+}
+
+func isPhoneLike(term string) bool {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return false
+	}
+	digits := 0
+	for _, r := range term {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune("+-() .", r):
+		default:
+			return false
+		}
+	}
+	return digits >= minPhoneDigits
+}
+
+// escapeLike escapes LIKE wildcards so they match literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
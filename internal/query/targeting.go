@@ -0,0 +1,33 @@
+package query
+
+import (
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Targeting selects customers by tag and segment. A customer must carry
+// every tag and belong to every segment listed. The zero value matches
+// everyone.
+type Targeting struct {
+	Tags     []string `json:"tags"`
+	Segments []string `json:"segments"` // segment slugs
+}
+
+func (t Targeting) IsEmpty() bool {
+	return len(t.Tags) == 0 && len(t.Segments) == 0
+}
+
+// Apply restricts a query to targeted customers. column names the customer ID
+// column being filtered, e.g. "customers.id" or "refills.customer_id".
+func (t Targeting) Apply(query *gorm.DB, column string) *gorm.DB {
+	for _, tag := range t.Tags {
+		query = query.Where(column+" IN (SELECT customer_id FROM customer_tags WHERE tag = ? AND deleted_at IS NULL)",
+			models.NormalizeTag(tag))
+	}
+	for _, slug := range t.Segments {
+		query = query.Where(column+" IN (SELECT sm.customer_id FROM segment_members sm JOIN segments s ON s.id = sm.segment_id WHERE s.slug = ? AND s.deleted_at IS NULL)",
+			slug)
+	}
+	return query
+}
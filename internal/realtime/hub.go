@@ -0,0 +1,218 @@
+// Package realtime pushes changes to the screens watching them as they
+// happen: order status changes, new online orders for the fulfillment
+// screen, stock levels and how the tills' print jobs went. Events are
+// published through Redis when it is configured, so every instance behind
+// the load balancer passes them on to its own subscribers; without Redis
+// they only reach this instance's.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+type Topic string
+
+const (
+	TopicOrderStatus Topic = "orders.status" // an order moved to a new status
+	TopicNewOrders   Topic = "orders.new"    // an online order was placed
+	TopicStock       Topic = "stock"         // a product's stock level changed
+	TopicStationJobs Topic = "stations.jobs" // a print or drawer job moved to a new status
+)
+
+// Topics lists every topic, in the order they are documented
+var Topics = []Topic{TopicOrderStatus, TopicNewOrders, TopicStock, TopicStationJobs}
+
+var ErrUnknownTopic = errors.New("unknown topic")
+
+// Channel is the Redis pub/sub channel events are fanned out on
+const Channel = "pharmacy:realtime"
+
+// subscriberBuffer is how many events a subscriber can fall behind by
+// before it is dropped
+const subscriberBuffer = 64
+
+// Event is one change pushed to subscribers. Events of a branch only reach
+// subscribers working in it or across branches.
+type Event struct {
+	ID       uuid.UUID       `json:"id"`
+	Topic    Topic           `json:"topic"`
+	BranchID *uuid.UUID      `json:"branch_id,omitempty"`
+	Data     json.RawMessage `json:"data"`
+	At       time.Time       `json:"at"`
+}
+
+// Hub hands published events to the subscribers of their topic
+type Hub struct {
+	redis *redis.Client
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+}
+
+// NewHub returns a hub that fans events out through client, or only within
+// this instance when client is nil
+func NewHub(client *redis.Client) *Hub {
+	return &Hub{redis: client, subscribers: make(map[*Subscription]struct{})}
+}
+
+// Publish sends an event with data to the topic's subscribers. It never
+// fails the change it announces: when Redis can't be reached the event is
+// still passed to this instance's subscribers.
+func (h *Hub) Publish(ctx context.Context, topic Topic, branchID *uuid.UUID, data interface{}) {
+	if h == nil {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		logrus.WithError(err).WithField("topic", topic).Error("Failed to encode realtime event")
+		return
+	}
+	event := Event{ID: uuid.New(), Topic: topic, BranchID: branchID, Data: raw, At: time.Now().UTC()}
+
+	if h.redis != nil {
+		message, err := json.Marshal(event)
+		if err == nil {
+			err = h.redis.Publish(ctx, Channel, message).Err()
+		}
+		if err == nil {
+			return
+		}
+		logrus.WithError(err).WithField("topic", topic).
+			Warn("Failed to publish realtime event through Redis, only this instance's subscribers get it")
+	}
+	h.deliver(event)
+}
+
+// Run passes on events published through Redis by any instance, until ctx
+// is done. It returns straight away without Redis.
+func (h *Hub) Run(ctx context.Context) {
+	if h == nil || h.redis == nil {
+		return
+	}
+
+	pubsub := h.redis.Subscribe(ctx, Channel)
+	defer pubsub.Close()
+
+	// The channel reconnects by itself when Redis goes away and comes back
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event Event
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				logrus.WithError(err).Warn("Ignoring malformed realtime event")
+				continue
+			}
+			h.deliver(event)
+		}
+	}
+}
+
+// Subscribe starts passing events of topics to a new subscription. With a
+// branch, events of other branches are left out.
+func (h *Hub) Subscribe(topics []Topic, branchID *uuid.UUID) *Subscription {
+	sub := &Subscription{
+		topics:   make(map[Topic]bool, len(topics)),
+		branchID: branchID,
+		events:   make(chan Event, subscriberBuffer),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	h.mu.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mu.Unlock()
+	return sub
+}
+
+// Unsubscribe stops passing events to sub
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscribers[sub]; ok {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Close ends every subscription, e.g. so streams let the server shut down.
+// Subscribers reconnect, to another instance behind a load balancer.
+func (h *Hub) Close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers {
+		delete(h.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Subscription is one subscriber's feed of events
+type Subscription struct {
+	topics   map[Topic]bool
+	branchID *uuid.UUID
+	events   chan Event
+}
+
+// Events returns the subscription's events. It is closed on Unsubscribe,
+// or when the subscriber fell too far behind and was dropped; it should
+// reconnect and reload what it shows.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// ParseTopic checks name is a known topic
+func ParseTopic(name string) (Topic, error) {
+	for _, topic := range Topics {
+		if string(topic) == name {
+			return topic, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownTopic, name)
+}
+
+// Private helper methods
+
+func (h *Hub) deliver(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for sub := range h.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// Rather than hold up everyone else or silently skip events,
+			// drop the subscriber so it reconnects and starts afresh
+			delete(h.subscribers, sub)
+			close(sub.events)
+			logrus.WithField("topic", event.Topic).Warn("Dropped a realtime subscriber that fell behind")
+		}
+	}
+}
+
+func (s *Subscription) wants(event Event) bool {
+	if !s.topics[event.Topic] {
+		return false
+	}
+	return s.branchID == nil || event.BranchID == nil || *event.BranchID == *s.branchID
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"gorm.io/gorm"
+)
+
+// customerSearch is what ?search= matches customers on
+var customerSearch = query.TextSearch{
+	Columns:      []string{"first_name", "last_name", "email"},
+	PhoneColumns: []string{"phone"},
+}
+
+// CustomerFilter narrows a customer list
+type CustomerFilter struct {
+	Search    string
+	Targeting query.Targeting // customers with every tag and in every segment
+	Deleted   bool            // soft-deleted customers instead of live ones
+}
+
+// Customers stores customer records. Get and List load the relations in
+// selection; Get returns ErrNotFound for a missing customer.
+type Customers interface {
+	List(ctx context.Context, filter CustomerFilter, selection query.Selection, page Page) ([]models.Customer, int64, error)
+	Get(ctx context.Context, id string, selection query.Selection) (*models.Customer, error)
+	Create(ctx context.Context, customer *models.Customer) error
+	// Save writes every field of customer
+	Save(ctx context.Context, customer *models.Customer) error
+	// Delete soft-deletes customer
+	Delete(ctx context.Context, customer *models.Customer) error
+}
+
+// GormCustomers keeps customers in the database
+type GormCustomers struct {
+	db *gorm.DB
+}
+
+func NewGormCustomers(db *gorm.DB) *GormCustomers {
+	return &GormCustomers{db: db}
+}
+
+func (r *GormCustomers) List(ctx context.Context, filter CustomerFilter, selection query.Selection, page Page) ([]models.Customer, int64, error) {
+	query := withDeleted(r.db.WithContext(ctx).Model(&models.Customer{}), filter.Deleted)
+	query = customerSearch.Apply(query, filter.Search)
+	query = filter.Targeting.Apply(query, "customers.id")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var customers []models.Customer
+	if err := selection.Apply(query).Offset(page.Offset).Limit(page.Limit).Find(&customers).Error; err != nil {
+		return nil, 0, err
+	}
+	return customers, total, nil
+}
+
+func (r *GormCustomers) Get(ctx context.Context, id string, selection query.Selection) (*models.Customer, error) {
+	var customer models.Customer
+	if err := selection.Apply(r.db.WithContext(ctx)).First(&customer, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &customer, nil
+}
+
+func (r *GormCustomers) Create(ctx context.Context, customer *models.Customer) error {
+	return r.db.WithContext(ctx).Create(customer).Error
+}
+
+func (r *GormCustomers) Save(ctx context.Context, customer *models.Customer) error {
+	return r.db.WithContext(ctx).Save(customer).Error
+}
+
+func (r *GormCustomers) Delete(ctx context.Context, customer *models.Customer) error {
+	return r.db.WithContext(ctx).Delete(customer).Error
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// What ?search= matches products on, and what their label lists are
+// searched for
+var (
+	productSearch            = query.TextSearch{Columns: []string{"name", "sku", "generic_name"}}
+	productInteractions      = query.ListSearch{Column: "drug_interactions"}
+	productContraindications = query.ListSearch{Column: "contraindications"}
+	productSideEffects       = query.ListSearch{Column: "side_effects"}
+)
+
+// ProductFilter narrows a product list to active products matching every
+// field set
+type ProductFilter struct {
+	Search           string
+	Category         string
+	InteractsWith    string
+	Contraindication string
+	SideEffect       string
+	Deleted          bool // soft-deleted products instead of live ones
+}
+
+// Products stores the product catalogue. Get and List load the relations
+// in selection; Get returns ErrNotFound for a missing product.
+type Products interface {
+	List(ctx context.Context, filter ProductFilter, selection query.Selection, page Page) ([]models.Product, int64, error)
+	Get(ctx context.Context, id string, selection query.Selection) (*models.Product, error)
+	// Create adds product supplied by supplierIDs, the first of them its
+	// primary supplier, and reloads it with its suppliers. IDs of
+	// suppliers that don't exist are skipped.
+	Create(ctx context.Context, product *models.Product, supplierIDs []string) error
+	// Update applies changes, by column, to product and replaces its
+	// suppliers when supplierIDs isn't nil, then reloads it with its
+	// suppliers
+	Update(ctx context.Context, product *models.Product, changes map[string]interface{}, supplierIDs *[]string) error
+	// Delete soft-deletes product
+	Delete(ctx context.Context, product *models.Product) error
+	// LowStock lists active products at or below their minimum stock
+	LowStock(ctx context.Context) ([]models.Product, error)
+	// Expiring lists active products expiring by before
+	Expiring(ctx context.Context, before time.Time) ([]models.Product, error)
+}
+
+// GormProducts keeps products in the database
+type GormProducts struct {
+	db *gorm.DB
+}
+
+func NewGormProducts(db *gorm.DB) *GormProducts {
+	return &GormProducts{db: db}
+}
+
+func (r *GormProducts) List(ctx context.Context, filter ProductFilter, selection query.Selection, page Page) ([]models.Product, int64, error) {
+	query := withDeleted(r.db.WithContext(ctx).Model(&models.Product{}), filter.Deleted).Where("is_active = ?", true)
+	query = productSearch.Apply(query, filter.Search)
+	query = productInteractions.Apply(query, filter.InteractsWith)
+	query = productContraindications.Apply(query, filter.Contraindication)
+	query = productSideEffects.Apply(query, filter.SideEffect)
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var products []models.Product
+	if err := selection.Apply(query).Offset(page.Offset).Limit(page.Limit).Find(&products).Error; err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+func (r *GormProducts) Get(ctx context.Context, id string, selection query.Selection) (*models.Product, error) {
+	var product models.Product
+	if err := selection.Apply(r.db.WithContext(ctx)).First(&product, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &product, nil
+}
+
+func (r *GormProducts) Create(ctx context.Context, product *models.Product, supplierIDs []string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		return linkSuppliers(tx, product.ID, supplierIDs)
+	})
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Preload("Suppliers").First(product, "id = ?", product.ID).Error
+}
+
+func (r *GormProducts) Update(ctx context.Context, product *models.Product, changes map[string]interface{}, supplierIDs *[]string) error {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(product).Updates(changes).Error; err != nil {
+			return err
+		}
+		if supplierIDs == nil {
+			return nil
+		}
+		if err := tx.Unscoped().Where("product_id = ?", product.ID).Delete(&models.ProductSupplier{}).Error; err != nil {
+			return err
+		}
+		return linkSuppliers(tx, product.ID, *supplierIDs)
+	})
+	if err != nil {
+		return err
+	}
+	return r.db.WithContext(ctx).Preload("Suppliers").First(product, "id = ?", product.ID).Error
+}
+
+func (r *GormProducts) Delete(ctx context.Context, product *models.Product) error {
+	return r.db.WithContext(ctx).Delete(product).Error
+}
+
+func (r *GormProducts) LowStock(ctx context.Context) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.WithContext(ctx).Where("stock <= min_stock AND is_active = ?", true).Find(&products).Error
+	return products, err
+}
+
+func (r *GormProducts) Expiring(ctx context.Context, before time.Time) ([]models.Product, error) {
+	var products []models.Product
+	err := r.db.WithContext(ctx).Where("expiry_date <= ? AND is_active = ?", before, true).Find(&products).Error
+	return products, err
+}
+
+// Private helper methods
+
+// linkSuppliers links a product to the suppliers of supplierIDs that exist,
+// the first of them as its primary supplier
+func linkSuppliers(tx *gorm.DB, productID uuid.UUID, supplierIDs []string) error {
+	for i, supplierID := range supplierIDs {
+		var supplier models.Supplier
+		if err := tx.First(&supplier, "id = ?", supplierID).Error; err != nil {
+			continue
+		}
+		link := models.ProductSupplier{
+			ProductID:  productID,
+			SupplierID: supplier.ID,
+			IsPrimary:  i == 0,
+		}
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Package repository reads and writes customers, products and sales for the
+// API handlers. Handlers depend on the interfaces here rather than on GORM,
+// so they can be tested against fakes and the records kept in another
+// store; the GORM implementations are what the server runs.
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Page is one page of a list, by offset
+type Page struct {
+	Offset int
+	Limit  int
+}
+
+// Repositories are the repositories the handlers use
+type Repositories struct {
+	Customers Customers
+	Products  Products
+	Sales     Sales
+}
+
+// NewGorm returns the GORM repositories over db
+func NewGorm(db *gorm.DB) Repositories {
+	return Repositories{
+		Customers: NewGormCustomers(db),
+		Products:  NewGormProducts(db),
+		Sales:     NewGormSales(db),
+	}
+}
+
+// Private helper methods
+
+// notFound turns GORM's missing record error into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// withDeleted lists soft-deleted records instead of live ones when deleted
+// is set
+func withDeleted(query *gorm.DB, deleted bool) *gorm.DB {
+	if !deleted {
+		return query
+	}
+	return query.Unscoped().Where("deleted_at IS NOT NULL")
+}
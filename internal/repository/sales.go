@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"gorm.io/gorm"
+)
+
+// Sales reads recorded sales, newest first. A sale is made in the same
+// transaction as its stock movements, invoice number and webhook, so sales
+// are created there rather than through here. Get returns ErrNotFound for a
+// missing sale.
+type Sales interface {
+	List(ctx context.Context, selection query.Selection, page Page) ([]models.Sale, int64, error)
+	// ListAfter lists up to limit sales after cursor, the empty cursor
+	// starting from the newest, with the cursor of the next page or "" on
+	// the last. It returns query.ErrInvalidCursor for a cursor it didn't
+	// hand out.
+	ListAfter(ctx context.Context, selection query.Selection, cursor string, limit int) ([]models.Sale, string, error)
+	Get(ctx context.Context, id string, selection query.Selection) (*models.Sale, error)
+}
+
+// GormSales reads sales from the database
+type GormSales struct {
+	db *gorm.DB
+}
+
+func NewGormSales(db *gorm.DB) *GormSales {
+	return &GormSales{db: db}
+}
+
+func (r *GormSales) List(ctx context.Context, selection query.Selection, page Page) ([]models.Sale, int64, error) {
+	db := r.db.WithContext(ctx)
+	var total int64
+	if err := db.Model(&models.Sale{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var sales []models.Sale
+	err := selection.Apply(db).Offset(page.Offset).Limit(page.Limit).Order("created_at DESC").Find(&sales).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return sales, total, nil
+}
+
+func (r *GormSales) ListAfter(ctx context.Context, selection query.Selection, cursor string, limit int) ([]models.Sale, string, error) {
+	after, err := query.AfterCursor(selection.Apply(r.db.WithContext(ctx)), "sales", cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	var sales []models.Sale
+	if err := after.Limit(limit + 1).Find(&sales).Error; err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(sales) > limit {
+		sales = sales[:limit]
+		next = query.EncodeCursor(sales[limit-1].CreatedAt, sales[limit-1].ID)
+	}
+	return sales, next, nil
+}
+
+func (r *GormSales) Get(ctx context.Context, id string, selection query.Selection) (*models.Sale, error) {
+	var sale models.Sale
+	if err := selection.Apply(r.db.WithContext(ctx)).First(&sale, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &sale, nil
+}
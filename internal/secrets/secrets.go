@@ -0,0 +1,186 @@
+// Package secrets reads the server's secrets, such as JWT_SECRET and
+// ENCRYPTION_KEY, from where they are kept: the environment, files mounted
+// by Docker or Kubernetes, AWS Secrets Manager or HashiCorp Vault.
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/awsauth"
+)
+
+var ErrNotFound = errors.New("secret not found")
+
+// Provider looks up secrets by their environment variable name
+type Provider interface {
+	Name() string
+	// Get returns the secret called name, or ErrNotFound
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// EnvProvider reads secrets from the environment, as the server always has
+type EnvProvider struct{}
+
+func (p EnvProvider) Name() string { return "env" }
+
+func (p EnvProvider) Get(ctx context.Context, name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+// FileProvider reads each secret from a file in Dir named after it in lower
+// case, e.g. /run/secrets/jwt_secret, as Docker and Kubernetes mount them
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) Name() string { return "file" }
+
+func (p FileProvider) Get(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, strings.ToLower(name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// AWSSecretsManagerProvider reads secrets from one Secrets Manager secret
+// holding a JSON object keyed by name, e.g. {"JWT_SECRET": "..."}
+type AWSSecretsManagerProvider struct {
+	SecretID  string
+	Region    string
+	Endpoint  string // e.g. a VPC endpoint; defaults to the regional AWS endpoint
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+
+	cache secretCache
+}
+
+func (p *AWSSecretsManagerProvider) Name() string { return "aws" }
+
+func (p *AWSSecretsManagerProvider) Get(ctx context.Context, name string) (string, error) {
+	return p.cache.get(name, func() (map[string]string, error) {
+		payload, err := json.Marshal(map[string]string{"SecretId": p.SecretID})
+		if err != nil {
+			return nil, err
+		}
+		endpoint := p.Endpoint
+		if endpoint == "" {
+			endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", p.Region)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return nil, fmt.Errorf("failed to build Secrets Manager request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+		creds := awsauth.Credentials{Region: p.Region, AccessKey: p.AccessKey, SecretKey: p.SecretKey}
+		awsauth.SignV4(req, payload, creds, "secretsmanager", []string{"content-type", "x-amz-target"}, time.Now().UTC())
+
+		var result struct {
+			SecretString string `json:"SecretString"`
+		}
+		if err := doRequest(p.Client, req, "Secrets Manager", &result); err != nil {
+			return nil, err
+		}
+		var values map[string]string
+		if err := json.Unmarshal([]byte(result.SecretString), &values); err != nil {
+			return nil, fmt.Errorf("secret %s isn't a JSON object of strings: %w", p.SecretID, err)
+		}
+		return values, nil
+	})
+}
+
+// VaultProvider reads secrets from a KV version 2 secret in HashiCorp Vault,
+// keyed by name. Path includes the mount, e.g. secret/pharmacy.
+type VaultProvider struct {
+	Addr   string
+	Token  string
+	Path   string
+	Client *http.Client
+
+	cache secretCache
+}
+
+func (p *VaultProvider) Name() string { return "vault" }
+
+func (p *VaultProvider) Get(ctx context.Context, name string) (string, error) {
+	return p.cache.get(name, func() (map[string]string, error) {
+		mount, path, _ := strings.Cut(strings.Trim(p.Path, "/"), "/")
+		endpoint := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(p.Addr, "/"), mount, path)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build Vault request: %w", err)
+		}
+		req.Header.Set("X-Vault-Token", p.Token)
+
+		var result struct {
+			Data struct {
+				Data map[string]string `json:"data"`
+			} `json:"data"`
+		}
+		if err := doRequest(p.Client, req, "Vault", &result); err != nil {
+			return nil, err
+		}
+		return result.Data.Data, nil
+	})
+}
+
+// secretCache keeps the values of a remote secret after the first lookup,
+// so reading several names costs one request
+type secretCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *secretCache) get(name string, fetch func() (map[string]string, error)) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.values == nil {
+		values, err := fetch()
+		if err != nil {
+			return "", err
+		}
+		c.values = values
+	}
+	value, ok := c.values[name]
+	if !ok || value == "" {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func doRequest(client *http.Client, req *http.Request, service string, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", service, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid %s response: %w", service, err)
+	}
+	return nil
+}
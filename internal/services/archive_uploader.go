@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/awsauth"
+	"pharmacy-backend/internal/config"
+)
+
+// ArchiveUploader copies archive files off the server
+type ArchiveUploader interface {
+	Upload(ctx context.Context, key string, data []byte) error
+}
+
+// NewArchiveUploader returns an S3 uploader when a backup bucket is
+// configured. Without one, archives are only kept on local disk.
+func NewArchiveUploader(cfg config.BackupConfig) ArchiveUploader {
+	if cfg.S3Bucket == "" {
+		return noArchiveUploader{}
+	}
+	return newS3ArchiveUploader(cfg)
+}
+
+func newS3ArchiveUploader(cfg config.BackupConfig) *S3ArchiveUploader {
+	return &S3ArchiveUploader{
+		Bucket:     cfg.S3Bucket,
+		Region:     cfg.S3Region,
+		Endpoint:   cfg.S3Endpoint,
+		AccessKey:  cfg.S3AccessKey,
+		SecretKey:  cfg.S3SecretKey,
+		Encryption: cfg.EncryptionEnabled,
+		Client:     &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+type noArchiveUploader struct{}
+
+func (noArchiveUploader) Upload(ctx context.Context, key string, data []byte) error {
+	return nil
+}
+
+// S3ArchiveUploader puts objects into an S3 or S3-compatible bucket using
+// Signature Version 4
+type S3ArchiveUploader struct {
+	Bucket     string
+	Region     string
+	Endpoint   string // e.g. https://minio.internal:9000; path-style addressing is used when set
+	AccessKey  string
+	SecretKey  string
+	Encryption bool // request AES256 server-side encryption
+	Client     *http.Client
+}
+
+func (u *S3ArchiveUploader) Upload(ctx context.Context, key string, data []byte) error {
+	resp, err := u.send(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return fmt.Errorf("S3 upload failed: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Download returns the object stored under key
+func (u *S3ArchiveUploader) Download(ctx context.Context, key string) ([]byte, error) {
+	resp, err := u.send(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("S3 download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("S3 download failed: %w", err)
+	}
+	return data, nil
+}
+
+// Delete removes the object stored under key
+func (u *S3ArchiveUploader) Delete(ctx context.Context, key string) error {
+	resp, err := u.send(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return fmt.Errorf("S3 delete failed: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// send makes a signed request for the object under key. Error responses
+// are returned as errors with their body closed.
+func (u *S3ArchiveUploader) send(ctx context.Context, method, key string, data []byte) (*http.Response, error) {
+	objectURL, err := u.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build S3 request: %w", err)
+	}
+	if method == http.MethodPut {
+		req.ContentLength = int64(len(data))
+		req.Header.Set("Content-Type", "application/octet-stream")
+		if strings.HasSuffix(key, ".gz") {
+			req.Header.Set("Content-Type", "application/gzip")
+		}
+		if u.Encryption {
+			req.Header.Set("X-Amz-Server-Side-Encryption", "AES256")
+		}
+	}
+	u.sign(req, data, time.Now().UTC())
+
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("S3 returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+func (u *S3ArchiveUploader) objectURL(key string) (*url.URL, error) {
+	if u.Endpoint == "" {
+		return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", u.Bucket, u.Region, key))
+	}
+	base, err := url.Parse(strings.TrimRight(u.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	base.Path += "/" + u.Bucket + "/" + key
+	return base, nil
+}
+
+// sign adds the SigV4 Authorization header for the request
+func (u *S3ArchiveUploader) sign(req *http.Request, payload []byte, now time.Time) {
+	var headers []string
+	if req.Header.Get("Content-Type") != "" {
+		headers = append(headers, "content-type")
+	}
+	if req.Header.Get("X-Amz-Server-Side-Encryption") != "" {
+		headers = append(headers, "x-amz-server-side-encryption")
+	}
+	creds := awsauth.Credentials{Region: u.Region, AccessKey: u.AccessKey, SecretKey: u.SecretKey}
+	awsauth.SignV4(req, payload, creds, "s3", headers, now)
+}
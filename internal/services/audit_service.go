@@ -0,0 +1,646 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+)
+
+// Audit export formats
+const (
+	AuditExportCSV   = "csv"
+	AuditExportJSONL = "jsonl"
+)
+
+// RedactedAuditValue replaces the value of a PHI field in the audit trail.
+// The log still shows that the field was set or changed, not what to.
+const RedactedAuditValue = "[REDACTED]"
+
+// phiAuditFields are the JSON fields of customers and orders that hold
+// protected health or identity information
+var phiAuditFields = map[string]bool{
+	"medical_history":     true,
+	"allergies":           true,
+	"current_medications": true,
+	"blood_type":          true,
+	"insurance_provider":  true,
+	"insurance_number":    true,
+	"senior_citizen_id":   true,
+	"pwd_id":              true,
+	"id_document_path":    true,
+	"eligibility_notes":   true,
+	"delivery_address":    true,
+	"prescription_images": true,
+	"prescription_notes":  true,
+}
+
+// auditIgnoredFields change on every write and would only add noise
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditService reads, exports and archives the audit trail written by the
+// middleware and handlers
+type AuditService struct {
+	db            *gorm.DB
+	retentionDays int
+	config        config.AuditArchiveConfig
+	uploader      ArchiveUploader
+}
+
+func NewAuditService(db *gorm.DB, retentionDays int, cfg config.AuditArchiveConfig, uploader ArchiveUploader) *AuditService {
+	return &AuditService{db: db, retentionDays: retentionDays, config: cfg, uploader: uploader}
+}
+
+// QueryLogs lists audit logs newest first. Pages are keyed on the last row's
+// timestamp and ID rather than an offset, so new entries written while an
+// auditor pages through don't shift or repeat rows.
+func (s *AuditService) QueryLogs(ctx context.Context, filter AuditLogFilter) (*AuditLogPage, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAuditPageSize
+	}
+	if limit > maxAuditPageSize {
+		limit = maxAuditPageSize
+	}
+
+	after, err := query.AfterCursor(s.filtered(filter).Preload("User"), "audit_logs", filter.Cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	var logs []models.AuditLog
+	if err := after.Limit(limit + 1).Find(&logs).Error; err != nil {
+		return nil, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+
+	page := &AuditLogPage{Logs: logs, Limit: limit}
+	if len(logs) > limit {
+		page.Logs = logs[:limit]
+		last := page.Logs[limit-1]
+		page.NextCursor = query.EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// GetLog returns an audit log with the field-level changes between its old
+// and new values
+func (s *AuditService) GetLog(ctx context.Context, id uuid.UUID) (*AuditLogDetail, error) {
+	var log models.AuditLog
+	if err := s.db.Preload("User").First(&log, id).Error; err != nil {
+		return nil, fmt.Errorf("audit log not found: %w", err)
+	}
+
+	// Older entries may hold values that aren't JSON objects; they are still
+	// returned, just without a diff
+	changes, err := DiffAuditValues(log.OldValues, log.NewValues)
+	if err != nil {
+		changes = []AuditFieldChange{}
+	}
+	return &AuditLogDetail{AuditLog: log, Changes: changes}, nil
+}
+
+// RecordChange writes an audit log holding the fields of an entity that a
+// write changed. Before is nil for creates and after is nil for deletes; both
+// should be pointers so encrypted fields marshal correctly. Associations are
+// left out and PHI values are redacted.
+func (s *AuditService) RecordChange(ctx context.Context, change AuditChange) error {
+	before, err := auditSnapshot(change.Before)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot old values: %w", err)
+	}
+	after, err := auditSnapshot(change.After)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot new values: %w", err)
+	}
+
+	// Updates only keep the fields that changed
+	if change.Before != nil && change.After != nil {
+		for field, oldValue := range before {
+			if newValue, ok := after[field]; ok && reflect.DeepEqual(oldValue, newValue) {
+				delete(before, field)
+				delete(after, field)
+			}
+		}
+	}
+	redactAuditSnapshot(before)
+	redactAuditSnapshot(after)
+
+	oldValues, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	newValues, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	log := models.AuditLog{
+		UserID:    change.UserID,
+		Action:    change.Action,
+		Resource:  change.Resource,
+		OldValues: string(oldValues),
+		NewValues: string(newValues),
+		IPAddress: change.IPAddress,
+		UserAgent: change.UserAgent,
+		Success:   true,
+	}
+	if change.ResourceID != "" {
+		log.ResourceID = &change.ResourceID
+	}
+	if change.RequestID != "" {
+		log.RequestID = &change.RequestID
+	}
+	if err := s.db.Create(&log).Error; err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// ExportLogs writes the logs matching filter, oldest first, as CSV or JSON
+// lines. Logs are read in batches so large date ranges aren't held in memory.
+func (s *AuditService) ExportLogs(ctx context.Context, w io.Writer, filter AuditLogFilter, format string) error {
+	if format == AuditExportJSONL {
+		format = ExportNDJSON
+	}
+	encoder, err := newExportEncoder(w, format, auditCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	return eachExportBatch(ctx, s.filtered(filter).WithContext(ctx), "audit_logs", encoder, func(batch *gorm.DB) ([]exportRow, error) {
+		var logs []models.AuditLog
+		if err := batch.Find(&logs).Error; err != nil {
+			return nil, fmt.Errorf("failed to read audit logs: %w", err)
+		}
+		rows := make([]exportRow, len(logs))
+		for i := range logs {
+			rows[i] = auditExportRow{logs[i]}
+		}
+		return rows, nil
+	})
+}
+
+// ArchiveExpired moves logs older than the retention period into gzipped
+// JSON-lines files, uploads them when a backup bucket is configured, and only
+// then deletes them from the database
+func (s *AuditService) ArchiveExpired(ctx context.Context) (*AuditArchiveResult, error) {
+	if s.retentionDays <= 0 {
+		return nil, fmt.Errorf("audit log retention is not configured")
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.retentionDays)
+	return s.archiveExpired(ctx, "audit", &models.AuditLog{}, cutoff, func(query *gorm.DB) ([]archiveRow, error) {
+		var logs []models.AuditLog
+		if err := query.Find(&logs).Error; err != nil {
+			return nil, fmt.Errorf("failed to load expired audit logs: %w", err)
+		}
+		rows := make([]archiveRow, len(logs))
+		for i := range logs {
+			rows[i] = archiveRow{ID: logs[i].ID, CreatedAt: logs[i].CreatedAt, Value: logs[i]}
+		}
+		return rows, nil
+	})
+}
+
+// ArchiveExpiredScanLogs archives and deletes QR scan logs older than the
+// scan log retention period the same way
+func (s *AuditService) ArchiveExpiredScanLogs(ctx context.Context) (*AuditArchiveResult, error) {
+	if s.config.ScanLogRetentionDays <= 0 {
+		return nil, fmt.Errorf("scan log retention is not configured")
+	}
+
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.config.ScanLogRetentionDays)
+	return s.archiveExpired(ctx, "qr-scan", &models.QRScanLog{}, cutoff, func(query *gorm.DB) ([]archiveRow, error) {
+		var scans []models.QRScanLog
+		if err := query.Find(&scans).Error; err != nil {
+			return nil, fmt.Errorf("failed to load expired scan logs: %w", err)
+		}
+		rows := make([]archiveRow, len(scans))
+		for i := range scans {
+			rows[i] = archiveRow{ID: scans[i].ID, CreatedAt: scans[i].CreatedAt, Value: scans[i]}
+		}
+		return rows, nil
+	})
+}
+
+// RunArchival archives expired audit and scan logs in the background until
+// ctx is done
+func (s *AuditService) RunArchival(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			work := lifecycle.WorkContext(ctx)
+			result, err := s.ArchiveExpired(work)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to archive audit logs")
+			} else if result.Archived > 0 {
+				logrus.WithField("archived", result.Archived).Info("Archived expired audit logs")
+			}
+
+			if s.config.ScanLogRetentionDays <= 0 {
+				continue
+			}
+			result, err = s.ArchiveExpiredScanLogs(work)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to archive scan logs")
+			} else if result.Archived > 0 {
+				logrus.WithField("archived", result.Archived).Info("Archived expired scan logs")
+			}
+		}
+	}
+}
+
+// DiffAuditValues compares two JSON objects field by field. Nested objects are
+// flattened into dotted paths; arrays are compared as a whole.
+func DiffAuditValues(oldValues, newValues string) ([]AuditFieldChange, error) {
+	before, err := flattenAuditJSON(oldValues)
+	if err != nil {
+		return nil, fmt.Errorf("invalid old values: %w", err)
+	}
+	after, err := flattenAuditJSON(newValues)
+	if err != nil {
+		return nil, fmt.Errorf("invalid new values: %w", err)
+	}
+
+	fields := make(map[string]struct{}, len(before)+len(after))
+	for field := range before {
+		fields[field] = struct{}{}
+	}
+	for field := range after {
+		fields[field] = struct{}{}
+	}
+
+	changes := []AuditFieldChange{}
+	for field := range fields {
+		oldValue, hadOld := before[field]
+		newValue, hasNew := after[field]
+
+		change := AuditFieldChange{Field: field, OldValue: oldValue, NewValue: newValue}
+		switch {
+		case !hadOld:
+			change.Change = AuditFieldAdded
+		case !hasNew:
+			change.Change = AuditFieldRemoved
+		case !reflect.DeepEqual(oldValue, newValue), oldValue == RedactedAuditValue:
+			// A redacted field is only stored when it changed
+			change.Change = AuditFieldChanged
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+// Private helper methods
+
+func (s *AuditService) filtered(filter AuditLogFilter) *gorm.DB {
+	query := s.db.Model(&models.AuditLog{})
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.Resource != "" {
+		query = query.Where("resource = ?", filter.Resource)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.Success != nil {
+		query = query.Where("success = ?", *filter.Success)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// archiveRow is a row being archived, whatever its table
+type archiveRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Value     interface{}
+}
+
+// archiveExpired archives the rows of model created before cutoff, oldest
+// first, in files of the configured batch size. load runs the batch query.
+func (s *AuditService) archiveExpired(ctx context.Context, kind string, model interface{}, cutoff time.Time, load func(*gorm.DB) ([]archiveRow, error)) (*AuditArchiveResult, error) {
+	result := &AuditArchiveResult{
+		Cutoff: cutoff,
+		Files:  []string{},
+	}
+	if err := os.MkdirAll(s.config.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	batchSize := s.config.BatchSize
+	if batchSize <= 0 {
+		batchSize = 10000
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		// Archived rows are deleted, so each pass starts from the oldest
+		rows, err := load(s.db.WithContext(ctx).Model(model).Where("created_at < ?", cutoff).
+			Order("created_at ASC, id ASC").Limit(batchSize))
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			return result, nil
+		}
+
+		file, err := s.archiveBatch(ctx, kind, model, rows)
+		if err != nil {
+			return result, err
+		}
+		result.Files = append(result.Files, file)
+		result.Archived += len(rows)
+
+		if len(rows) < batchSize {
+			return result, nil
+		}
+	}
+}
+
+// archiveBatch writes one archive file and deletes its rows. Nothing is
+// deleted unless the file, and the upload when configured, succeeded.
+func (s *AuditService) archiveBatch(ctx context.Context, kind string, model interface{}, rows []archiveRow) (string, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz)
+	ids := make([]uuid.UUID, len(rows))
+	for i, row := range rows {
+		if err := encoder.Encode(row.Value); err != nil {
+			return "", fmt.Errorf("failed to encode %s log: %w", kind, err)
+		}
+		ids[i] = row.ID
+	}
+	if err := gz.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress %s logs: %w", kind, err)
+	}
+
+	first, last := rows[0], rows[len(rows)-1]
+	name := fmt.Sprintf("%s-%s-%s-%s.jsonl.gz", kind,
+		first.CreatedAt.UTC().Format("20060102T150405Z"),
+		last.CreatedAt.UTC().Format("20060102T150405Z"),
+		last.ID.String()[:8])
+	path := filepath.Join(s.config.Dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		return "", fmt.Errorf("failed to write %s archive: %w", kind, err)
+	}
+
+	if err := s.uploader.Upload(ctx, kind+"-logs/"+name, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to upload %s archive %s: %w", kind, name, err)
+	}
+
+	// Archived entries live on in the archive, so they are removed for good
+	if err := s.db.WithContext(ctx).Unscoped().Where("id IN ?", ids).Delete(model).Error; err != nil {
+		return "", fmt.Errorf("failed to delete archived %s logs: %w", kind, err)
+	}
+	return path, nil
+}
+
+var auditCSVHeader = []string{
+	"created_at", "id", "user_id", "action", "resource", "resource_id", "success",
+	"status_code", "duration_ms", "ip_address", "user_agent", "request_id",
+	"error_message", "old_values", "new_values",
+}
+
+// auditExportRow is an audit log as exported
+type auditExportRow struct {
+	models.AuditLog
+}
+
+func (r auditExportRow) position() (time.Time, uuid.UUID) {
+	return r.CreatedAt, r.ID
+}
+
+func (r auditExportRow) record() []string {
+	return auditCSVRow(r.AuditLog)
+}
+
+func auditCSVRow(log models.AuditLog) []string {
+	return []string{
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		log.ID.String(),
+		optionalUUID(log.UserID),
+		log.Action,
+		log.Resource,
+		optionalString(log.ResourceID),
+		strconv.FormatBool(log.Success),
+		optionalInt(log.StatusCode),
+		optionalInt(log.Duration),
+		log.IPAddress,
+		log.UserAgent,
+		optionalString(log.RequestID),
+		optionalString(log.ErrorMessage),
+		log.OldValues,
+		log.NewValues,
+	}
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optionalInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+// auditSnapshot turns an entity into its top-level JSON fields, without
+// associations
+func auditSnapshot(entity interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if entity == nil {
+		return fields, nil
+	}
+
+	raw, err := json.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return nil, err
+	}
+
+	for field, value := range decoded {
+		if auditIgnoredFields[field] || isAuditAssociation(value) {
+			continue
+		}
+		fields[field] = value
+	}
+	return fields, nil
+}
+
+// isAuditAssociation reports whether a JSON value is a nested record or a
+// list of them
+func isAuditAssociation(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return true
+	case []interface{}:
+		for _, item := range v {
+			if _, ok := item.(map[string]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func redactAuditSnapshot(fields map[string]interface{}) {
+	for field, value := range fields {
+		if phiAuditFields[field] && !isEmptyAuditValue(value) {
+			fields[field] = RedactedAuditValue
+		}
+	}
+}
+
+func isEmptyAuditValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func flattenAuditJSON(raw string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return values, nil
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return nil, err
+	}
+	flattenAuditValue("", decoded, values)
+	return values, nil
+}
+
+func flattenAuditValue(prefix string, value interface{}, into map[string]interface{}) {
+	object, ok := value.(map[string]interface{})
+	if !ok || (prefix != "" && len(object) == 0) {
+		into[prefix] = value
+		return
+	}
+	for key, nested := range object {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		flattenAuditValue(path, nested, into)
+	}
+}
+
+// Request/Response types
+
+type AuditLogFilter struct {
+	UserID     *uuid.UUID
+	Action     string
+	Resource   string
+	ResourceID string
+	Success    *bool
+	From       *time.Time
+	To         *time.Time
+	Cursor     string
+	Limit      int
+}
+
+// AuditChange describes a write to be recorded by RecordChange
+type AuditChange struct {
+	UserID     *uuid.UUID
+	Action     string // e.g. "create", "update", "delete", "stock_update"
+	Resource   string
+	ResourceID string
+	Before     interface{}
+	After      interface{}
+	IPAddress  string
+	UserAgent  string
+	RequestID  string
+}
+
+type AuditArchiveResult struct {
+	Cutoff   time.Time `json:"cutoff"`
+	Archived int       `json:"archived"`
+	Files    []string  `json:"files"`
+}
+
+type AuditLogPage struct {
+	Logs       []models.AuditLog `json:"logs"`
+	Limit      int               `json:"limit"`
+	NextCursor string            `json:"next_cursor,omitempty"` // empty on the last page
+}
+
+type AuditFieldChangeType string
+
+const (
+	AuditFieldAdded   AuditFieldChangeType = "added"
+	AuditFieldRemoved AuditFieldChangeType = "removed"
+	AuditFieldChanged AuditFieldChangeType = "changed"
+)
+
+type AuditFieldChange struct {
+	Field    string               `json:"field"`
+	Change   AuditFieldChangeType `json:"change"`
+	OldValue interface{}          `json:"old_value,omitempty"`
+	NewValue interface{}          `json:"new_value,omitempty"`
+}
+
+type AuditLogDetail struct {
+	models.AuditLog
+	Changes []AuditFieldChange `json:"changes"`
+}
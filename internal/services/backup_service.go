@@ -0,0 +1,408 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/alerting"
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBackupStorageNotConfigured = errors.New("no backup bucket is configured")
+	ErrBackupChecksumMismatch     = errors.New("backup does not match its recorded checksum")
+)
+
+// Encrypted backups start with this line, followed by the name of the
+// master key provider and the wrapped backup key on a line each. Every
+// backup has its own key, so a backup can be restored with access to the
+// master key alone, even when the database holding the data keys is lost.
+const backupHeader = "PHARMACY-BACKUP-1\n"
+
+// BackupStore keeps database backups off the server
+type BackupStore interface {
+	Upload(ctx context.Context, key string, data []byte) error
+	Download(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewBackupStore returns the S3 store for the configured backup bucket, or
+// nil when there is none
+func NewBackupStore(cfg config.BackupConfig) BackupStore {
+	if cfg.S3Bucket == "" {
+		return nil
+	}
+	return newS3ArchiveUploader(cfg)
+}
+
+// BackupService dumps the primary database with pg_dump, encrypts the dump
+// and uploads it to the backup bucket, and restores such backups
+type BackupService struct {
+	db        *gorm.DB
+	store     BackupStore
+	masterKey MasterKeyProvider
+	database  config.DatabaseConfig
+	config    config.BackupConfig
+	interval  time.Duration
+	alerts    *alerting.Notifier
+}
+
+func NewBackupService(db *gorm.DB, store BackupStore, masterKey MasterKeyProvider, database config.DatabaseConfig, cfg config.BackupConfig, interval time.Duration) *BackupService {
+	return &BackupService{
+		db:        db,
+		store:     store,
+		masterKey: masterKey,
+		database:  database,
+		config:    cfg,
+		interval:  interval,
+	}
+}
+
+// SetAlerting posts failed backups to the operations channels
+func (s *BackupService) SetAlerting(alerts *alerting.Notifier) {
+	s.alerts = alerts
+}
+
+// RunBackup takes a backup now. The run is recorded whether it succeeds or
+// not.
+func (s *BackupService) RunBackup(ctx context.Context) (*models.BackupRun, error) {
+	if s.store == nil {
+		return nil, ErrBackupStorageNotConfigured
+	}
+
+	started := time.Now().UTC()
+	run := &models.BackupRun{
+		ObjectKey: fmt.Sprintf("%s%s/%s.dump", s.config.Prefix, s.database.Name, started.Format("20060102T150405Z")),
+		Status:    models.BackupRunning,
+		Encrypted: s.config.EncryptionEnabled,
+		StartedAt: started,
+	}
+	if run.Encrypted {
+		run.ObjectKey += ".enc"
+		run.KeyProvider = s.masterKey.Name()
+	}
+	if err := s.db.WithContext(ctx).Create(run).Error; err != nil {
+		return nil, fmt.Errorf("failed to record backup: %w", err)
+	}
+
+	data, err := s.dump(ctx)
+	if err == nil && run.Encrypted {
+		data, err = s.encrypt(ctx, data)
+	}
+	if err == nil {
+		err = s.store.Upload(ctx, run.ObjectKey, data)
+	}
+	if err != nil {
+		run.Status = models.BackupFailed
+		run.Error = err.Error()
+		s.db.WithContext(ctx).Save(run)
+		s.alerts.Notify(alerting.Alert{
+			Event:    alerting.EventBackupFailed,
+			Severity: alerting.SeverityCritical,
+			Title:    "Database backup failed",
+			Message:  fmt.Sprintf("The backup of %s failed: %v", s.database.Name, err),
+			Fields: []alerting.Field{
+				{Name: "Object", Value: run.ObjectKey},
+				{Name: "Started", Value: started.Format(time.RFC3339)},
+			},
+		})
+		return run, err
+	}
+
+	completed := time.Now().UTC()
+	run.Status = models.BackupCompleted
+	run.SizeBytes = int64(len(data))
+	run.Checksum = backupChecksum(data)
+	run.CompletedAt = &completed
+	if err := s.db.WithContext(ctx).Save(run).Error; err != nil {
+		return run, fmt.Errorf("backup uploaded but not recorded: %w", err)
+	}
+	return run, nil
+}
+
+// PruneBackups deletes backups older than the retention period from the
+// bucket. The latest completed backup is always kept.
+func (s *BackupService) PruneBackups(ctx context.Context) (int, error) {
+	if s.store == nil || s.config.RetentionDays <= 0 {
+		return 0, nil
+	}
+
+	latest, err := s.LatestBackup(ctx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var expired []models.BackupRun
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.config.RetentionDays)
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND completed_at < ? AND id <> ?", models.BackupCompleted, cutoff, latest.ID).
+		Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to find expired backups: %w", err)
+	}
+
+	pruned := 0
+	for i := range expired {
+		if err := s.store.Delete(ctx, expired[i].ObjectKey); err != nil {
+			return pruned, fmt.Errorf("failed to delete backup %s: %w", expired[i].ObjectKey, err)
+		}
+		if err := s.db.WithContext(ctx).Model(&expired[i]).Update("status", models.BackupPruned).Error; err != nil {
+			return pruned, fmt.Errorf("failed to record pruned backup: %w", err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// RunBackups takes a backup and prunes expired ones every interval until
+// ctx is done
+func (s *BackupService) RunBackups(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// A backup under way is finished and uploaded on shutdown
+			work := lifecycle.WorkContext(ctx)
+			run, err := s.RunBackup(work)
+			if err != nil {
+				logrus.WithError(err).Error("Database backup failed")
+				continue
+			}
+			logrus.WithFields(logrus.Fields{"key": run.ObjectKey, "bytes": run.SizeBytes}).Info("Database backup uploaded")
+
+			if pruned, err := s.PruneBackups(work); err != nil {
+				logrus.WithError(err).Error("Failed to prune database backups")
+			} else if pruned > 0 {
+				logrus.WithField("pruned", pruned).Info("Pruned expired database backups")
+			}
+		}
+	}
+}
+
+// ListBackups returns backup runs, newest first
+func (s *BackupService) ListBackups(ctx context.Context, limit, offset int) ([]models.BackupRun, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int64
+	if err := s.db.WithContext(ctx).Model(&models.BackupRun{}).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count backups: %w", err)
+	}
+
+	var runs []models.BackupRun
+	if err := s.db.WithContext(ctx).Order("started_at DESC").Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load backups: %w", err)
+	}
+	return runs, total, nil
+}
+
+// LatestBackup returns the newest completed backup
+func (s *BackupService) LatestBackup(ctx context.Context) (*models.BackupRun, error) {
+	var run models.BackupRun
+	if err := s.db.WithContext(ctx).Where("status = ?", models.BackupCompleted).
+		Order("completed_at DESC").First(&run).Error; err != nil {
+		return nil, fmt.Errorf("backup: %w", err)
+	}
+	return &run, nil
+}
+
+// RestoreBackup downloads a backup, checks it against its recorded
+// checksum, decrypts it and has pg_restore read its table of contents. A
+// dry run stops there; otherwise the primary database is replaced with the
+// backup's contents in one transaction.
+func (s *BackupService) RestoreBackup(ctx context.Context, key string, dryRun bool) (*RestoreResult, error) {
+	if s.store == nil {
+		return nil, ErrBackupStorageNotConfigured
+	}
+
+	data, err := s.store.Download(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	result := &RestoreResult{
+		ObjectKey: key,
+		SizeBytes: int64(len(data)),
+		Checksum:  backupChecksum(data),
+		DryRun:    dryRun,
+	}
+
+	// A database being rebuilt from scratch has no record to check against
+	if s.db.Migrator().HasTable(&models.BackupRun{}) {
+		var run models.BackupRun
+		err := s.db.WithContext(ctx).Where("object_key = ?", key).First(&run).Error
+		switch {
+		case err == nil && run.Checksum != "":
+			if run.Checksum != result.Checksum {
+				return nil, ErrBackupChecksumMismatch
+			}
+			result.ChecksumVerified = true
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return nil, fmt.Errorf("failed to look up backup: %w", err)
+		}
+	}
+
+	if bytes.HasPrefix(data, []byte(backupHeader)) {
+		result.Encrypted = true
+		if data, err = s.decrypt(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.CreateTemp("", "pharmacy-restore-*.dump")
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage backup: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stage backup: %w", err)
+	}
+
+	toc, err := s.pgRestore(ctx, "--list", file.Name())
+	if err != nil {
+		return nil, fmt.Errorf("backup is not a readable pg_dump archive: %w", err)
+	}
+	for _, line := range strings.Split(string(toc), "\n") {
+		if line != "" && !strings.HasPrefix(line, ";") {
+			result.Entries++
+		}
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	if _, err := s.pgRestore(ctx, "--clean", "--if-exists", "--no-owner", "--single-transaction", "--exit-on-error",
+		"--dbname", s.database.Name, file.Name()); err != nil {
+		return nil, fmt.Errorf("restore failed: %w", err)
+	}
+	result.Restored = true
+	return result, nil
+}
+
+// Private helper methods
+
+func (s *BackupService) dump(ctx context.Context) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, s.config.PgDumpPath, "--format=custom", "--no-owner")
+	cmd.Env = s.pgEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (s *BackupService) pgRestore(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, s.config.PgRestorePath, args...)
+	cmd.Env = s.pgEnv()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// pgEnv passes the connection settings to pg_dump and pg_restore in the
+// environment, which keeps the password off their command line
+func (s *BackupService) pgEnv() []string {
+	return append(os.Environ(),
+		"PGHOST="+s.database.Host,
+		"PGPORT="+s.database.Port,
+		"PGUSER="+s.database.User,
+		"PGPASSWORD="+s.database.Password,
+		"PGDATABASE="+s.database.Name,
+		"PGSSLMODE="+s.database.SSLMode,
+	)
+}
+
+func (s *BackupService) encrypt(ctx context.Context, dump []byte) ([]byte, error) {
+	backupKey := make([]byte, utils.DataKeySize)
+	if _, err := io.ReadFull(rand.Reader, backupKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := s.masterKey.Wrap(ctx, backupKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap backup key: %w", err)
+	}
+	sealed, err := utils.SealBytes(backupKey, dump)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(backupHeader)
+	out.WriteString(s.masterKey.Name() + "\n")
+	out.WriteString(wrapped + "\n")
+	out.Write(sealed)
+	return out.Bytes(), nil
+}
+
+func (s *BackupService) decrypt(ctx context.Context, data []byte) ([]byte, error) {
+	parts := bytes.SplitN(bytes.TrimPrefix(data, []byte(backupHeader)), []byte("\n"), 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("backup header is incomplete")
+	}
+	if provider := string(parts[0]); provider != s.masterKey.Name() {
+		return nil, fmt.Errorf("backup key was wrapped by the %s master key provider, but %s is configured", provider, s.masterKey.Name())
+	}
+
+	backupKey, err := s.masterKey.Unwrap(ctx, string(parts[1]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap backup key: %w", err)
+	}
+	dump, err := utils.OpenBytes(backupKey, parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup, it is damaged or the wrong master key is configured")
+	}
+	return dump, nil
+}
+
+func backupChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Request/Response types
+
+type RestoreResult struct {
+	ObjectKey        string `json:"object_key"`
+	SizeBytes        int64  `json:"size_bytes"`
+	Checksum         string `json:"checksum"`
+	ChecksumVerified bool   `json:"checksum_verified"` // false when the backup isn't recorded in this database
+	Encrypted        bool   `json:"encrypted"`
+	Entries          int    `json:"entries"` // objects in the archive's table of contents
+	DryRun           bool   `json:"dry_run"`
+	Restored         bool   `json:"restored"`
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BranchReportService rolls sales, stock and transfers up across branches
+// for the head office. Sales, stock and transfers recorded before branches
+// were set up have no branch and are reported as unassigned.
+type BranchReportService struct {
+	db *gorm.DB
+}
+
+func NewBranchReportService(db *gorm.DB) *BranchReportService {
+	return &BranchReportService{db: db}
+}
+
+// SalesRollup totals completed sales in [from, to) for each branch
+func (s *BranchReportService) SalesRollup(ctx context.Context, from, to *time.Time) (*SalesRollup, error) {
+	var totals []struct {
+		BranchID  *uuid.UUID
+		SaleCount int64
+		Revenue   models.Money
+		Discounts models.Money
+	}
+	query := s.completedSales(ctx, from, to).
+		Select("branch_id, COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS revenue, COALESCE(SUM(discount), 0) AS discounts").
+		Group("branch_id")
+	if err := query.Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to total sales: %w", err)
+	}
+
+	rows, err := s.branchRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rollup := &SalesRollup{From: from, To: to}
+	for _, row := range rows {
+		sales := BranchSales{BranchRef: row}
+		for _, total := range totals {
+			if sameBranch(total.BranchID, row.BranchID) {
+				sales.SaleCount = total.SaleCount
+				sales.Revenue = total.Revenue
+				sales.Discounts = total.Discounts
+			}
+		}
+		if sales.BranchID == nil && sales.SaleCount == 0 {
+			continue
+		}
+		if sales.SaleCount > 0 {
+			sales.AverageSale = sales.Revenue.MulRate(1 / float64(sales.SaleCount))
+		}
+		rollup.SaleCount += sales.SaleCount
+		rollup.Revenue += sales.Revenue
+		rollup.Branches = append(rollup.Branches, sales)
+	}
+	return rollup, nil
+}
+
+// BranchSalesDetail drills into one branch's completed sales in [from, to):
+// takings by day and its best selling products and services
+func (s *BranchReportService) BranchSalesDetail(ctx context.Context, branchID uuid.UUID, from, to *time.Time) (*BranchSalesDetail, error) {
+	var branch models.Branch
+	if err := s.db.WithContext(ctx).First(&branch, "id = ?", branchID).Error; err != nil {
+		return nil, fmt.Errorf("branch: %w", err)
+	}
+
+	detail := &BranchSalesDetail{
+		BranchRef: BranchRef{BranchID: &branch.ID, Code: branch.Code, Name: branch.Name},
+		From:      from,
+		To:        to,
+	}
+	if err := s.completedSales(ctx, from, to).
+		Select("DATE(created_at) AS day, COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS revenue").
+		Where("branch_id = ?", branchID).
+		Group("DATE(created_at)").Order("day ASC").
+		Scan(&detail.Daily).Error; err != nil {
+		return nil, fmt.Errorf("failed to total daily sales: %w", err)
+	}
+
+	sales := s.completedSales(ctx, from, to).Select("id").Where("branch_id = ?", branchID)
+	if err := s.db.WithContext(ctx).Table("sale_items").
+		Select("products.id AS product_id, products.name, SUM(sale_items.quantity) AS units_sold, SUM(sale_items.total_price) AS revenue").
+		Joins("JOIN products ON products.id = sale_items.product_id").
+		Where("sale_items.sale_id IN (?) AND sale_items.deleted_at IS NULL", sales).
+		Group("products.id, products.name").
+		Order("revenue DESC").Limit(10).
+		Scan(&detail.TopProducts).Error; err != nil {
+		return nil, fmt.Errorf("failed to total product sales: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Table("sale_items").
+		Select("services.id AS service_id, services.name, SUM(sale_items.quantity) AS quantity, SUM(sale_items.total_price) AS revenue").
+		Joins("JOIN services ON services.id = sale_items.service_id").
+		Where("sale_items.sale_id IN (?) AND sale_items.deleted_at IS NULL", sales).
+		Group("services.id, services.name").
+		Order("revenue DESC").Limit(10).
+		Scan(&detail.TopServices).Error; err != nil {
+		return nil, fmt.Errorf("failed to total service sales: %w", err)
+	}
+	return detail, nil
+}
+
+// StockRollup summarises each branch's stock on hand: units, their value at
+// cost and how many active products are at or below their minimum there.
+// Stock in transit between branches is on hand at neither.
+func (s *BranchReportService) StockRollup(ctx context.Context) ([]BranchStockSummary, error) {
+	var activeProducts int64
+	if err := s.db.WithContext(ctx).Model(&models.Product{}).
+		Where("is_active = ?", true).Count(&activeProducts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count products: %w", err)
+	}
+
+	movements := s.db.WithContext(ctx).Model(&models.StockMovement{}).
+		Select("branch_id, product_id, SUM(stock_after - stock_before) AS stock").
+		Group("branch_id, product_id")
+	var totals []struct {
+		BranchID     *uuid.UUID
+		Units        int64
+		StockValue   models.Money
+		AboveMinimum int64
+	}
+	if err := s.db.WithContext(ctx).Table("(?) AS branch_stock", movements).
+		Select("branch_stock.branch_id, COALESCE(SUM(branch_stock.stock), 0) AS units, "+
+			"COALESCE(SUM(branch_stock.stock * products.cost), 0) AS stock_value, "+
+			"COUNT(CASE WHEN branch_stock.stock > products.min_stock THEN 1 END) AS above_minimum").
+		Joins("JOIN products ON products.id = branch_stock.product_id").
+		Where("products.is_active = ? AND products.deleted_at IS NULL", true).
+		Group("branch_stock.branch_id").
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to total branch stock: %w", err)
+	}
+
+	rows, err := s.branchRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]BranchStockSummary, 0, len(rows))
+	for _, row := range rows {
+		summary := BranchStockSummary{BranchRef: row, LowStockCount: activeProducts}
+		found := false
+		for _, total := range totals {
+			if sameBranch(total.BranchID, row.BranchID) {
+				found = true
+				summary.Units = total.Units
+				summary.StockValue = total.StockValue
+				summary.LowStockCount = activeProducts - total.AboveMinimum
+			}
+		}
+		if row.BranchID == nil {
+			// Unassigned stock has no minimum to fall below
+			if !found {
+				continue
+			}
+			summary.LowStockCount = 0
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// TransitRollup counts the transfers each branch has in transit, both
+// those it sent and those on their way to it
+func (s *BranchReportService) TransitRollup(ctx context.Context) ([]BranchTransitSummary, error) {
+	var outgoing, incoming []struct {
+		BranchID  uuid.UUID
+		Transfers int64
+		Units     int64
+	}
+	for _, side := range []struct {
+		column string
+		dest   interface{}
+	}{
+		{"from_branch_id", &outgoing},
+		{"to_branch_id", &incoming},
+	} {
+		if err := s.db.WithContext(ctx).Model(&models.StockTransfer{}).
+			Select(side.column+" AS branch_id, COUNT(*) AS transfers, COALESCE(SUM(quantity), 0) AS units").
+			Where("status = ?", models.TransferStatusInTransit).
+			Group(side.column).
+			Scan(side.dest).Error; err != nil {
+			return nil, fmt.Errorf("failed to total transfers in transit: %w", err)
+		}
+	}
+
+	rows, err := s.branchRows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]BranchTransitSummary, 0, len(rows))
+	for _, row := range rows {
+		if row.BranchID == nil {
+			continue
+		}
+		summary := BranchTransitSummary{BranchRef: row}
+		for _, total := range outgoing {
+			if total.BranchID == *row.BranchID {
+				summary.OutgoingTransfers, summary.OutgoingUnits = total.Transfers, total.Units
+			}
+		}
+		for _, total := range incoming {
+			if total.BranchID == *row.BranchID {
+				summary.IncomingTransfers, summary.IncomingUnits = total.Transfers, total.Units
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// Private helper methods
+
+func (s *BranchReportService) completedSales(ctx context.Context, from, to *time.Time) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.Sale{}).Where("status = ?", "completed")
+	if from != nil {
+		query = query.Where("created_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("created_at < ?", *to)
+	}
+	return query
+}
+
+// branchRows lists every branch by code, then a row for records without a
+// branch
+func (s *BranchReportService) branchRows(ctx context.Context) ([]BranchRef, error) {
+	var branches []models.Branch
+	if err := s.db.WithContext(ctx).Order("code ASC").Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+
+	rows := make([]BranchRef, 0, len(branches)+1)
+	for i := range branches {
+		rows = append(rows, BranchRef{BranchID: &branches[i].ID, Code: branches[i].Code, Name: branches[i].Name})
+	}
+	return append(rows, BranchRef{Name: "Unassigned"}), nil
+}
+
+func sameBranch(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// Request/Response types
+
+// BranchRef names the branch a report row is for. BranchID is nil on the
+// row for records without a branch.
+type BranchRef struct {
+	BranchID *uuid.UUID `json:"branch_id"`
+	Code     string     `json:"code"`
+	Name     string     `json:"name"`
+}
+
+type SalesRollup struct {
+	From      *time.Time    `json:"from,omitempty"`
+	To        *time.Time    `json:"to,omitempty"`
+	SaleCount int64         `json:"sale_count"`
+	Revenue   models.Money  `json:"revenue"`
+	Branches  []BranchSales `json:"branches"`
+}
+
+type BranchSales struct {
+	BranchRef
+	SaleCount   int64        `json:"sale_count"`
+	Revenue     models.Money `json:"revenue"`
+	Discounts   models.Money `json:"discounts"`
+	AverageSale models.Money `json:"average_sale"`
+}
+
+type BranchSalesDetail struct {
+	BranchRef
+	From        *time.Time          `json:"from,omitempty"`
+	To          *time.Time          `json:"to,omitempty"`
+	Daily       []DailySales        `json:"daily"`
+	TopProducts []ProductSalesTotal `json:"top_products"`
+	TopServices []ServiceTotal      `json:"top_services"`
+}
+
+type DailySales struct {
+	Day       string       `json:"day"`
+	SaleCount int64        `json:"sale_count"`
+	Revenue   models.Money `json:"revenue"`
+}
+
+type ProductSalesTotal struct {
+	ProductID uuid.UUID    `json:"product_id"`
+	Name      string       `json:"name"`
+	UnitsSold int64        `json:"units_sold"`
+	Revenue   models.Money `json:"revenue"`
+}
+
+type ServiceTotal struct {
+	ServiceID uuid.UUID    `json:"service_id"`
+	Name      string       `json:"name"`
+	Quantity  int64        `json:"quantity"`
+	Revenue   models.Money `json:"revenue"`
+}
+
+type BranchStockSummary struct {
+	BranchRef
+	Units         int64        `json:"units"`
+	StockValue    models.Money `json:"stock_value"`
+	LowStockCount int64        `json:"low_stock_count"`
+}
+
+type BranchTransitSummary struct {
+	BranchRef
+	OutgoingTransfers int64 `json:"outgoing_transfers"`
+	OutgoingUnits     int64 `json:"outgoing_units"`
+	IncomingTransfers int64 `json:"incoming_transfers"`
+	IncomingUnits     int64 `json:"incoming_units"`
+}
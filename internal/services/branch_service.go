@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBranchInactive         = errors.New("branch is inactive")
+	ErrTransferSameBranch     = errors.New("cannot transfer stock to the branch it comes from")
+	ErrTransferNotInTransit   = errors.New("transfer is not in transit")
+	ErrTransferForOtherBranch = errors.New("transfer is for another branch")
+)
+
+// BranchService manages pharmacy branches, which staff belong to, and the
+// stock each branch holds
+type BranchService struct {
+	db    *gorm.DB
+	stock *StockService
+}
+
+func NewBranchService(db *gorm.DB, stock *StockService) *BranchService {
+	return &BranchService{db: db, stock: stock}
+}
+
+// ListBranches returns branches by code. Inactive ones are left out unless
+// asked for.
+func (s *BranchService) ListBranches(ctx context.Context, includeInactive bool) ([]models.Branch, error) {
+	query := s.db.WithContext(ctx).Order("code ASC")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var branches []models.Branch
+	if err := query.Find(&branches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+	return branches, nil
+}
+
+func (s *BranchService) CreateBranch(ctx context.Context, req BranchRequest) (*models.Branch, error) {
+	branch := &models.Branch{
+		Code:     req.Code,
+		Name:     req.Name,
+		Address:  req.Address,
+		Phone:    req.Phone,
+		IsActive: true,
+
+		IsHeadOffice: req.IsHeadOffice,
+		TaxRate:      req.TaxRate,
+	}
+	if req.IsActive != nil {
+		branch.IsActive = *req.IsActive
+	}
+	if err := s.db.WithContext(ctx).Create(branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to create branch: %w", err)
+	}
+	return branch, nil
+}
+
+func (s *BranchService) UpdateBranch(ctx context.Context, id uuid.UUID, req BranchRequest) (*models.Branch, error) {
+	var branch models.Branch
+	if err := s.db.WithContext(ctx).First(&branch, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("branch: %w", err)
+	}
+
+	branch.Code = req.Code
+	branch.Name = req.Name
+	branch.Address = req.Address
+	branch.Phone = req.Phone
+	branch.IsHeadOffice = req.IsHeadOffice
+	branch.TaxRate = req.TaxRate
+	if req.IsActive != nil {
+		branch.IsActive = *req.IsActive
+	}
+	if err := s.db.WithContext(ctx).Save(&branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to update branch: %w", err)
+	}
+	return &branch, nil
+}
+
+// AssignUser moves a user to a branch, or with nil takes them off their
+// branch so they work across branches. It applies from their next request.
+func (s *BranchService) AssignUser(ctx context.Context, userID uuid.UUID, branchID *uuid.UUID) (*models.User, error) {
+	if branchID != nil {
+		var branch models.Branch
+		if err := s.db.WithContext(ctx).First(&branch, "id = ?", *branchID).Error; err != nil {
+			return nil, fmt.Errorf("branch: %w", err)
+		}
+		if !branch.IsActive {
+			return nil, ErrBranchInactive
+		}
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("user: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Model(&user).Update("branch_id", branchID).Error; err != nil {
+		return nil, fmt.Errorf("failed to assign user to branch: %w", err)
+	}
+	user.BranchID = branchID
+	return &user, nil
+}
+
+// GetStock lists the branch's stock of every active product, by name. A
+// branch's stock is what its stock movements add up to.
+func (s *BranchService) GetStock(ctx context.Context, branchID uuid.UUID, lowStockOnly bool, limit, offset int) ([]BranchStockLevel, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	movements := s.db.WithContext(ctx).Model(&models.StockMovement{}).
+		Select("product_id, SUM(stock_after - stock_before) AS stock").
+		Where("branch_id = ?", branchID).
+		Group("product_id")
+
+	query := s.db.WithContext(ctx).Table("products").
+		Joins("LEFT JOIN (?) AS branch_stock ON branch_stock.product_id = products.id", movements).
+		Where("products.is_active = ? AND products.deleted_at IS NULL", true)
+	if lowStockOnly {
+		query = query.Where("COALESCE(branch_stock.stock, 0) <= products.min_stock")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count branch stock: %w", err)
+	}
+
+	var levels []BranchStockLevel
+	if err := query.
+		Select("products.id AS product_id, products.name, products.sku, COALESCE(branch_stock.stock, 0) AS stock, products.min_stock").
+		Order("products.name ASC").Limit(limit).Offset(offset).
+		Scan(&levels).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load branch stock: %w", err)
+	}
+	return levels, total, nil
+}
+
+// StockOf returns the branch's stock of a product, read in tx
+func (s *BranchService) StockOf(tx *gorm.DB, branchID, productID uuid.UUID) (int, error) {
+	return stockOf(tx, branchID, productID)
+}
+
+// ShipTransfer sends stock from one branch to another. The stock leaves the
+// sending branch now and is in transit until the receiving branch takes it
+// in with ReceiveTransfer.
+func (s *BranchService) ShipTransfer(ctx context.Context, req TransferRequest, userID uuid.UUID) (*models.StockTransfer, error) {
+	if req.FromBranchID == req.ToBranchID {
+		return nil, ErrTransferSameBranch
+	}
+	for _, branchID := range []uuid.UUID{req.FromBranchID, req.ToBranchID} {
+		var branch models.Branch
+		if err := s.db.WithContext(ctx).First(&branch, "id = ?", branchID).Error; err != nil {
+			return nil, fmt.Errorf("branch: %w", err)
+		}
+		if !branch.IsActive {
+			return nil, ErrBranchInactive
+		}
+	}
+
+	transfer := &models.StockTransfer{
+		FromBranchID: req.FromBranchID,
+		ToBranchID:   req.ToBranchID,
+		ProductID:    req.ProductID,
+		Quantity:     req.Quantity,
+		Status:       models.TransferStatusInTransit,
+		ShippedBy:    userID,
+		ShippedAt:    time.Now().UTC(),
+		Notes:        req.Notes,
+	}
+	var movement *models.StockMovement
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(transfer).Error; err != nil {
+			return fmt.Errorf("failed to create transfer: %w", err)
+		}
+		var err error
+		movement, err = s.moveStock(tx, req.FromBranchID, req.ProductID, -req.Quantity, "Transfer shipped", transfer.ID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.stock.Announce(ctx, movement)
+	return transfer, nil
+}
+
+// ReceiveTransfer takes a transfer in at the branch it was sent to. A
+// caller limited to a branch can only receive transfers sent there.
+func (s *BranchService) ReceiveTransfer(ctx context.Context, id uuid.UUID, branchID *uuid.UUID, userID uuid.UUID) (*models.StockTransfer, error) {
+	var transfer models.StockTransfer
+	var movement *models.StockMovement
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&transfer, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("transfer: %w", err)
+		}
+		if branchID != nil && *branchID != transfer.ToBranchID {
+			return ErrTransferForOtherBranch
+		}
+
+		// Only one receipt can take the transfer out of transit
+		now := time.Now().UTC()
+		result := tx.Model(&transfer).
+			Where("status = ?", models.TransferStatusInTransit).
+			Updates(map[string]interface{}{
+				"status":      models.TransferStatusReceived,
+				"received_by": userID,
+				"received_at": now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to receive transfer: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrTransferNotInTransit
+		}
+		transfer.Status = models.TransferStatusReceived
+		transfer.ReceivedBy = &userID
+		transfer.ReceivedAt = &now
+
+		var err error
+		movement, err = s.moveStock(tx, transfer.ToBranchID, transfer.ProductID, transfer.Quantity, "Transfer received", transfer.ID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.stock.Announce(ctx, movement)
+	return &transfer, nil
+}
+
+// ListTransfers returns transfers newest first. With a branch it lists the
+// transfers the branch sent or was sent.
+func (s *BranchService) ListTransfers(ctx context.Context, filter TransferFilter) ([]models.StockTransfer, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.StockTransfer{})
+	if filter.BranchID != nil {
+		query = query.Where("from_branch_id = ? OR to_branch_id = ?", *filter.BranchID, *filter.BranchID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count transfers: %w", err)
+	}
+
+	var transfers []models.StockTransfer
+	if err := query.Preload("FromBranch").Preload("ToBranch").Preload("Product").
+		Order("shipped_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&transfers).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load transfers: %w", err)
+	}
+	return transfers, total, nil
+}
+
+// Private helper methods
+
+// moveStock records a transfer's stock leaving or reaching a branch and
+// moves the product's total stock with it. Stock only leaves a branch that
+// has it.
+func (s *BranchService) moveStock(tx *gorm.DB, branchID, productID uuid.UUID, change int, reason string, transferID, userID uuid.UUID) (*models.StockMovement, error) {
+	reference := transferID.String()
+	return s.stock.Apply(tx, StockChange{
+		ProductID: productID,
+		BranchID:  &branchID,
+		Quantity:  change,
+		Type:      models.MovementTypeTransfer,
+		Reason:    reason,
+		Reference: &reference,
+		UserID:    &userID,
+	})
+}
+
+// Request/Response types
+
+type BranchRequest struct {
+	Code     string `json:"code" binding:"required,max=20"`
+	Name     string `json:"name" binding:"required,max=200"`
+	Address  string `json:"address" binding:"max=500"`
+	Phone    string `json:"phone" binding:"max=20"`
+	IsActive *bool  `json:"is_active"`
+
+	IsHeadOffice bool     `json:"is_head_office"`
+	TaxRate      *float64 `json:"tax_rate" binding:"omitempty,min=0,max=1"` // null for the pharmacy's rate
+}
+
+type AssignBranchRequest struct {
+	BranchID *uuid.UUID `json:"branch_id"` // null to work across branches
+}
+
+// TransferRequest ships stock. FromBranchID defaults to the caller's branch
+// and only admins can name another.
+type TransferRequest struct {
+	FromBranchID uuid.UUID `json:"from_branch_id"`
+	ToBranchID   uuid.UUID `json:"to_branch_id" binding:"required"`
+	ProductID    uuid.UUID `json:"product_id" binding:"required"`
+	Quantity     int       `json:"quantity" binding:"required,min=1"`
+	Notes        string    `json:"notes" binding:"max=1000"`
+}
+
+type TransferFilter struct {
+	BranchID *uuid.UUID
+	Status   models.TransferStatus
+	Limit    int
+	Offset   int
+}
+
+type BranchStockLevel struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Name      string    `json:"name"`
+	SKU       string    `json:"sku"`
+	Stock     int       `json:"stock"`
+	MinStock  int       `json:"min_stock"`
+}
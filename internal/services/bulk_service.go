@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxBulkRows caps the number of rows in one bulk request
+const MaxBulkRows = 5000
+
+// bulkChunkSize is how many rows of a bulk request are written in one
+// transaction. Larger chunks hold their locks longer; smaller ones commit
+// more often.
+const bulkChunkSize = 200
+
+var ErrBulkTooLarge = errors.New("too many rows")
+
+// Bulk row actions
+const (
+	BulkActionCreate = "create"
+	BulkActionUpdate = "update"
+	BulkActionAdjust = "adjust"
+	BulkActionError  = "error"
+)
+
+// BulkService applies batches of product and stock rows, as sent by nightly
+// ERP feeds, in a few transactions instead of thousands of single calls.
+// Every row is validated before anything is written, and a row that fails
+// doesn't stop the rest.
+type BulkService struct {
+	db         *gorm.DB
+	regulatory *RegulatoryService
+	stock      *StockService
+}
+
+func NewBulkService(db *gorm.DB, regulatory *RegulatoryService, stock *StockService) *BulkService {
+	return &BulkService{db: db, regulatory: regulatory, stock: stock}
+}
+
+// UpsertProducts creates products whose SKU is new and updates the ones
+// that exist. A deleted product's SKU counts as new, as it is free to use
+// again; the deleted product is left as it is. An update replaces the product's details but never its stock,
+// which only changes through stock adjustments. Registration numbers are
+// checked against the FDA registry like a single product's.
+func (s *BulkService) UpsertProducts(ctx context.Context, req BulkProductRequest) (*BulkResult, error) {
+	if len(req.Products) > MaxBulkRows {
+		return nil, fmt.Errorf("%w: at most %d rows", ErrBulkTooLarge, MaxBulkRows)
+	}
+
+	result := newBulkResult(len(req.Products), req.DryRun)
+	seen := map[string]int{}
+	var valid []int
+	for i := range req.Products {
+		product := &req.Products[i]
+		row := &result.Rows[i]
+		row.Key = product.SKU
+		if errs := req.Invalid[i]; len(errs) > 0 {
+			row.fail(errs...)
+			continue
+		}
+		if first, ok := seen[product.SKU]; ok {
+			row.fail(fmt.Sprintf("duplicate of row %d in this request", first))
+			continue
+		}
+		seen[product.SKU] = i
+
+		if err := s.regulatory.CheckProduct(ctx, product); err != nil {
+			if errors.Is(err, ErrInvalidRegistration) {
+				row.fail(err.Error())
+				continue
+			}
+			return nil, err
+		}
+		valid = append(valid, i)
+	}
+
+	existing, err := s.productsBySKU(ctx, req.Products, valid)
+	if err != nil {
+		return nil, err
+	}
+	var pending []int
+	for _, i := range valid {
+		row := &result.Rows[i]
+		current, ok := existing[req.Products[i].SKU]
+		if ok {
+			row.Action = BulkActionUpdate
+			row.ID = &current.ID
+		} else {
+			row.Action = BulkActionCreate
+		}
+		pending = append(pending, i)
+	}
+
+	if !req.DryRun {
+		failed := writeInChunks(ctx, s.db, pending, func(tx *gorm.DB, i int) error {
+			product := &req.Products[i]
+			if current, ok := existing[product.SKU]; ok {
+				product.BaseModel = current.BaseModel
+				product.Stock = current.Stock
+				product.CreatedBy = current.CreatedBy
+				product.UpdatedBy = req.UserID
+				if err := tx.Omit(clause.Associations).Save(product).Error; err != nil {
+					return fmt.Errorf("failed to update product: %w", err)
+				}
+				return nil
+			}
+			product.BaseModel = models.BaseModel{}
+			product.CreatedBy = req.UserID
+			product.UpdatedBy = nil
+			if err := tx.Omit(clause.Associations).Create(product).Error; err != nil {
+				return fmt.Errorf("failed to create product: %w", err)
+			}
+			result.Rows[i].ID = &product.ID
+			return nil
+		})
+		for i, err := range failed {
+			if result.Rows[i].Action == BulkActionCreate {
+				result.Rows[i].ID = nil
+			}
+			result.Rows[i].fail(err.Error())
+		}
+	}
+
+	result.count()
+	if !req.DryRun {
+		logrus.WithFields(logrus.Fields{
+			"rows":      result.Total,
+			"succeeded": result.Succeeded,
+			"failed":    result.Failed,
+		}).Info("Bulk product upsert completed")
+	}
+	return result, nil
+}
+
+// AdjustStock applies stock adjustments, each an add, subtract or set of a
+// product's stock found by ID or SKU. Within a branch they apply to the
+// branch's stock, as a single stock update does. A set only applies if the
+// stock hasn't moved since its row was read.
+func (s *BulkService) AdjustStock(ctx context.Context, req BulkStockRequest) (*BulkResult, error) {
+	if len(req.Adjustments) > MaxBulkRows {
+		return nil, fmt.Errorf("%w: at most %d rows", ErrBulkTooLarge, MaxBulkRows)
+	}
+
+	result := newBulkResult(len(req.Adjustments), req.DryRun)
+	productIDs := make([]uuid.UUID, len(req.Adjustments))
+	var pending []int
+	for i, adjustment := range req.Adjustments {
+		row := &result.Rows[i]
+		row.Key = adjustment.SKU
+		if adjustment.ProductID != nil {
+			row.Key = adjustment.ProductID.String()
+		}
+		if errs := req.Invalid[i]; len(errs) > 0 {
+			row.fail(errs...)
+			continue
+		}
+
+		var product models.Product
+		query := s.db.WithContext(ctx).Select("id")
+		switch {
+		case adjustment.ProductID != nil:
+			query = query.Where("id = ?", *adjustment.ProductID)
+		case adjustment.SKU != "":
+			query = query.Where("sku = ?", adjustment.SKU)
+		default:
+			row.fail("product_id or sku is required")
+			continue
+		}
+		if err := query.First(&product).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				row.fail("product not found")
+				continue
+			}
+			return nil, fmt.Errorf("failed to find product: %w", err)
+		}
+		productIDs[i] = product.ID
+		row.Action = BulkActionAdjust
+		row.ID = &product.ID
+		pending = append(pending, i)
+	}
+
+	if !req.DryRun {
+		movements := make(map[int]*models.StockMovement, len(pending))
+		failed := writeInChunks(ctx, s.db, pending, func(tx *gorm.DB, i int) error {
+			adjustment := req.Adjustments[i]
+			var product models.Product
+			if err := tx.Select("id", "stock").First(&product, "id = ?", productIDs[i]).Error; err != nil {
+				return fmt.Errorf("product: %w", err)
+			}
+			current := product.Stock
+			if req.BranchID != nil {
+				var err error
+				if current, err = stockOf(tx, *req.BranchID, product.ID); err != nil {
+					return err
+				}
+			}
+
+			change := adjustment.Quantity
+			var expected *int
+			switch adjustment.Operation {
+			case "subtract":
+				change = -adjustment.Quantity
+			case "set":
+				change = adjustment.Quantity - current
+				expected = &product.Stock
+			}
+
+			movement, err := s.stock.Apply(tx, StockChange{
+				ProductID:     product.ID,
+				BranchID:      req.BranchID,
+				Quantity:      change,
+				Type:          ManualMovementType(adjustment.Operation, change),
+				Reason:        "Bulk stock " + adjustment.Operation,
+				UserID:        req.UserID,
+				Notes:         adjustment.Notes,
+				ExpectedStock: expected,
+			})
+			if err != nil {
+				return err
+			}
+			movements[i] = movement
+			return nil
+		})
+
+		var applied []*models.StockMovement
+		for _, i := range pending {
+			if err, ok := failed[i]; ok {
+				result.Rows[i].fail(err.Error())
+				continue
+			}
+			movement := movements[i]
+			result.Rows[i].StockBefore = &movement.StockBefore
+			result.Rows[i].StockAfter = &movement.StockAfter
+			applied = append(applied, movement)
+		}
+		s.stock.Announce(ctx, applied...)
+	}
+
+	result.count()
+	if !req.DryRun {
+		logrus.WithFields(logrus.Fields{
+			"rows":      result.Total,
+			"succeeded": result.Succeeded,
+			"failed":    result.Failed,
+		}).Info("Bulk stock adjustment completed")
+	}
+	return result, nil
+}
+
+// ManualMovementType is the movement recorded for a stock adjustment made by
+// hand or by a feed
+func ManualMovementType(operation string, change int) models.MovementType {
+	switch {
+	case operation == "set":
+		return models.MovementTypeAdjustment
+	case change < 0:
+		return models.MovementTypeOut
+	default:
+		return models.MovementTypeIn
+	}
+}
+
+// Private helper methods
+
+// productsBySKU loads the products whose SKUs are used by the rows.
+// Deleted products are left out, as their SKUs are free.
+func (s *BulkService) productsBySKU(ctx context.Context, products []models.Product, rows []int) (map[string]models.Product, error) {
+	existing := make(map[string]models.Product, len(rows))
+	for start := 0; start < len(rows); start += bulkChunkSize {
+		end := start + bulkChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		skus := make([]string, 0, end-start)
+		for _, i := range rows[start:end] {
+			skus = append(skus, products[i].SKU)
+		}
+		var found []models.Product
+		if err := s.db.WithContext(ctx).Where("sku IN ?", skus).Find(&found).Error; err != nil {
+			return nil, fmt.Errorf("failed to look up products: %w", err)
+		}
+		for _, product := range found {
+			existing[product.SKU] = product
+		}
+	}
+	return existing, nil
+}
+
+// writeInChunks calls write for each row, bulkChunkSize rows to a
+// transaction, and returns the rows that failed. Each row runs in its own
+// savepoint, so a failed row is rolled back alone and the rest of its chunk
+// still commits; PostgreSQL would otherwise abort the whole transaction at
+// the first failed statement. A chunk that fails to commit fails all of its
+// rows.
+func writeInChunks(ctx context.Context, db *gorm.DB, rows []int, write func(tx *gorm.DB, row int) error) map[int]error {
+	failed := map[int]error{}
+	for start := 0; start < len(rows); start += bulkChunkSize {
+		end := start + bulkChunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunk := rows[start:end]
+
+		err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			for _, row := range chunk {
+				if err := tx.Transaction(func(tx *gorm.DB) error { return write(tx, row) }); err != nil {
+					failed[row] = err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			for _, row := range chunk {
+				if _, ok := failed[row]; !ok {
+					failed[row] = fmt.Errorf("failed to save: %w", err)
+				}
+			}
+		}
+	}
+	return failed
+}
+
+// Request/Response types
+
+type BulkProductRequest struct {
+	Products []models.Product
+	Invalid  map[int][]string // row -> validation errors found while binding
+	DryRun   bool
+	UserID   *uuid.UUID
+}
+
+type BulkStockRequest struct {
+	Adjustments []BulkStockAdjustment
+	Invalid     map[int][]string // row -> validation errors found while binding
+	BranchID    *uuid.UUID
+	DryRun      bool
+	UserID      *uuid.UUID
+}
+
+// BulkStockAdjustment is one row of a bulk stock request. The product is
+// found by ProductID, or by SKU when there is none.
+type BulkStockAdjustment struct {
+	ProductID *uuid.UUID `json:"product_id"`
+	SKU       string     `json:"sku"`
+	Quantity  int        `json:"quantity" binding:"required,min=1"`
+	Operation string     `json:"operation" binding:"required,oneof=add subtract set"`
+	Notes     string     `json:"notes"`
+}
+
+// BulkResult reports what happened to each row of a bulk request. In a dry
+// run the actions are what would be done.
+type BulkResult struct {
+	DryRun    bool            `json:"dry_run"`
+	Total     int             `json:"total"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Rows      []BulkRowResult `json:"rows"`
+}
+
+type BulkRowResult struct {
+	Row         int        `json:"row"`           // position in the request, from 0
+	Key         string     `json:"key,omitempty"` // SKU or product ID the row was sent with
+	Action      string     `json:"action"`
+	ID          *uuid.UUID `json:"id,omitempty"`
+	StockBefore *int       `json:"stock_before,omitempty"` // product's total stock around an adjustment
+	StockAfter  *int       `json:"stock_after,omitempty"`
+	Errors      []string   `json:"errors,omitempty"`
+}
+
+func newBulkResult(rows int, dryRun bool) *BulkResult {
+	result := &BulkResult{DryRun: dryRun, Total: rows, Rows: make([]BulkRowResult, rows)}
+	for i := range result.Rows {
+		result.Rows[i].Row = i
+	}
+	return result
+}
+
+func (r *BulkRowResult) fail(errs ...string) {
+	r.Action = BulkActionError
+	r.Errors = append(r.Errors, errs...)
+}
+
+func (r *BulkResult) count() {
+	for _, row := range r.Rows {
+		if row.Action == BulkActionError {
+			r.Failed++
+		} else {
+			r.Succeeded++
+		}
+	}
+}
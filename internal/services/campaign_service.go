@@ -0,0 +1,673 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// maxAttributionDays bounds how far back a purchase looks for a campaign
+// message to credit
+const maxAttributionDays = 90
+
+// dispatchBatchSize is how many queued messages one dispatch run sends
+const dispatchBatchSize = 500
+
+// CampaignService runs rule-based campaigns: it finds matching customers,
+// queues a templated message for each, sends the queue and credits the
+// purchases that follow to the message that prompted them
+type CampaignService struct {
+	db             *gorm.DB
+	communications *CommunicationService
+	config         config.CampaignConfig
+}
+
+func NewCampaignService(db *gorm.DB, communications *CommunicationService, cfg config.CampaignConfig) *CampaignService {
+	return &CampaignService{
+		db:             db,
+		communications: communications,
+		config:         cfg,
+	}
+}
+
+// CreateCampaign defines a campaign. New campaigns start inactive unless
+// IsActive is set.
+func (s *CampaignService) CreateCampaign(ctx context.Context, campaign *models.Campaign) error {
+	campaign.Slug = models.NormalizeTag(campaign.Slug)
+	if campaign.Slug == "" {
+		campaign.Slug = models.NormalizeTag(campaign.Name)
+	}
+	applyCampaignDefaults(campaign)
+	if err := validateCampaign(campaign); err != nil {
+		return err
+	}
+
+	if err := s.db.Create(campaign).Error; err != nil {
+		return fmt.Errorf("failed to create campaign: %w", err)
+	}
+	return nil
+}
+
+// UpdateCampaign changes a campaign's rule, template or schedule settings
+func (s *CampaignService) UpdateCampaign(ctx context.Context, id uuid.UUID, req UpdateCampaignRequest) (*models.Campaign, error) {
+	campaign, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		campaign.Name = *req.Name
+	}
+	if req.Days != nil {
+		campaign.Days = *req.Days
+	}
+	if req.Purpose != nil {
+		campaign.Purpose = *req.Purpose
+	}
+	if req.Subject != nil {
+		campaign.Subject = *req.Subject
+	}
+	if req.Body != nil {
+		campaign.Body = *req.Body
+	}
+	if req.SegmentSlug != nil {
+		campaign.SegmentSlug = *req.SegmentSlug
+	}
+	if req.CooldownDays != nil {
+		campaign.CooldownDays = *req.CooldownDays
+	}
+	if req.AttributionDays != nil {
+		campaign.AttributionDays = *req.AttributionDays
+	}
+	if req.IsActive != nil {
+		campaign.IsActive = *req.IsActive
+	}
+	if err := validateCampaign(campaign); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(campaign).Error; err != nil {
+		return nil, fmt.Errorf("failed to update campaign: %w", err)
+	}
+	return campaign, nil
+}
+
+// GetCampaign returns a campaign by ID
+func (s *CampaignService) GetCampaign(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	var campaign models.Campaign
+	if err := s.db.First(&campaign, id).Error; err != nil {
+		return nil, fmt.Errorf("campaign not found: %w", err)
+	}
+	return &campaign, nil
+}
+
+// ListCampaigns lists all campaigns by name
+func (s *CampaignService) ListCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	err := s.db.WithContext(ctx).Order("name ASC").Find(&campaigns).Error
+	return campaigns, err
+}
+
+// DeleteCampaign removes a campaign and its send history
+func (s *CampaignService) DeleteCampaign(ctx context.Context, id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("campaign_id = ?", id).Delete(&models.CampaignSend{}).Error; err != nil {
+			return fmt.Errorf("failed to delete campaign sends: %w", err)
+		}
+		result := tx.Delete(&models.Campaign{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete campaign: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("campaign not found")
+		}
+		return nil
+	})
+}
+
+// Preview returns the customers the campaign would message if it ran now,
+// with the rendered message for each
+func (s *CampaignService) Preview(ctx context.Context, id uuid.UUID, limit int) (*CampaignPreview, error) {
+	campaign, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := s.findRecipients(campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &CampaignPreview{Total: len(recipients), Recipients: []CampaignRecipient{}}
+	for i := range recipients {
+		if i >= limit {
+			break
+		}
+		preview.Recipients = append(preview.Recipients, recipients[i])
+	}
+	return preview, nil
+}
+
+// Enqueue queues a message for every customer the campaign currently matches
+// who has not been messaged by it within the cooldown. It returns the number
+// queued.
+func (s *CampaignService) Enqueue(ctx context.Context, campaign *models.Campaign) (int, error) {
+	recipients, err := s.findRecipients(campaign)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	sends := make([]models.CampaignSend, len(recipients))
+	for i, recipient := range recipients {
+		sends[i] = models.CampaignSend{
+			CampaignID: campaign.ID,
+			CustomerID: recipient.CustomerID,
+			Status:     models.CampaignSendQueued,
+			Subject:    recipient.Subject,
+			Body:       recipient.Body,
+			QueuedAt:   now,
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if len(sends) > 0 {
+			if err := tx.CreateInBatches(sends, 500).Error; err != nil {
+				return err
+			}
+		}
+		campaign.LastRunAt = &now
+		return tx.Model(campaign).Update("last_run_at", now).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue campaign %s: %w", campaign.Slug, err)
+	}
+	return len(sends), nil
+}
+
+// Dispatch sends queued campaign messages, oldest first. Customers who have
+// not opted in to the campaign's purpose are marked suppressed.
+func (s *CampaignService) Dispatch(ctx context.Context) (*CampaignDispatchResult, error) {
+	var sends []models.CampaignSend
+	if err := s.db.Where("status = ?", models.CampaignSendQueued).
+		Order("queued_at ASC").Limit(dispatchBatchSize).
+		Find(&sends).Error; err != nil {
+		return nil, fmt.Errorf("failed to load queued messages: %w", err)
+	}
+
+	result := &CampaignDispatchResult{}
+	if len(sends) == 0 {
+		return result, nil
+	}
+
+	campaignIDs, customerIDs := []uuid.UUID{}, []uuid.UUID{}
+	for _, send := range sends {
+		campaignIDs = append(campaignIDs, send.CampaignID)
+		customerIDs = append(customerIDs, send.CustomerID)
+	}
+	var campaigns []models.Campaign
+	if err := s.db.Where("id IN ?", campaignIDs).Find(&campaigns).Error; err != nil {
+		return nil, fmt.Errorf("failed to load campaigns: %w", err)
+	}
+	purposes := map[uuid.UUID]models.NotificationPurpose{}
+	for _, campaign := range campaigns {
+		purposes[campaign.ID] = campaign.Purpose
+	}
+	var customers []models.Customer
+	if err := s.db.Where("id IN ?", customerIDs).Find(&customers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load customers: %w", err)
+	}
+	byID := map[uuid.UUID]*models.Customer{}
+	for i := range customers {
+		byID[customers[i].ID] = &customers[i]
+	}
+
+	for _, send := range sends {
+		updates := map[string]interface{}{}
+		customer, ok := byID[send.CustomerID]
+		purpose, found := purposes[send.CampaignID]
+
+		switch {
+		case !ok || customer.AnonymizedAt != nil || !found:
+			updates["status"] = models.CampaignSendFailed
+			updates["error"] = "customer or campaign no longer exists"
+			result.Failed++
+		default:
+			channel, err := s.communications.NotifyCustomer(ctx, customer, purpose, send.Subject, send.Body)
+			switch {
+			case errors.Is(err, ErrNotificationSuppressed):
+				updates["status"] = models.CampaignSendSuppressed
+				result.Suppressed++
+			case err != nil:
+				updates["status"] = models.CampaignSendFailed
+				updates["error"] = err.Error()
+				result.Failed++
+			default:
+				updates["status"] = models.CampaignSendSent
+				updates["channel"] = channel
+				updates["sent_at"] = time.Now().UTC()
+				result.Sent++
+			}
+		}
+
+		if err := s.db.Model(&models.CampaignSend{}).Where("id = ?", send.ID).Updates(updates).Error; err != nil {
+			return result, fmt.Errorf("failed to update campaign send: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Run queues and sends one campaign immediately, even if it is inactive
+func (s *CampaignService) Run(ctx context.Context, id uuid.UUID) (*CampaignDispatchResult, error) {
+	campaign, err := s.GetCampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	queued, err := s.Enqueue(ctx, campaign)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.Dispatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.Queued = queued
+	return result, nil
+}
+
+// RunScheduler queues every active campaign and sends the queue on the
+// configured interval until ctx is done
+func (s *CampaignService) RunScheduler(ctx context.Context) {
+	ticker := time.NewTicker(s.config.SchedulerInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.runActive(lifecycle.WorkContext(ctx))
+		}
+	}
+}
+
+// GetSends lists a campaign's messages, newest first
+func (s *CampaignService) GetSends(ctx context.Context, campaignID uuid.UUID, status string, limit, offset int) ([]models.CampaignSend, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.CampaignSend{}).Where("campaign_id = ?", campaignID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var sends []models.CampaignSend
+	err := query.Order("queued_at DESC").Limit(limit).Offset(offset).Find(&sends).Error
+	return sends, total, err
+}
+
+// GetStats summarizes a campaign's sends and the purchases credited to it
+func (s *CampaignService) GetStats(ctx context.Context, campaignID uuid.UUID) (*CampaignStats, error) {
+	var counts []struct {
+		Status models.CampaignSendStatus
+		Count  int64
+	}
+	if err := s.db.WithContext(ctx).Model(&models.CampaignSend{}).
+		Select("status, COUNT(*) AS count").
+		Where("campaign_id = ?", campaignID).
+		Group("status").
+		Scan(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to count campaign sends: %w", err)
+	}
+
+	stats := &CampaignStats{CampaignID: campaignID}
+	for _, c := range counts {
+		switch c.Status {
+		case models.CampaignSendQueued:
+			stats.Queued = c.Count
+		case models.CampaignSendSent:
+			stats.Sent = c.Count
+		case models.CampaignSendSuppressed:
+			stats.Suppressed = c.Count
+		case models.CampaignSendFailed:
+			stats.Failed = c.Count
+		}
+	}
+
+	var attributed struct {
+		Purchases int64
+		Revenue   models.Money
+	}
+	if err := s.db.WithContext(ctx).Model(&models.CampaignSend{}).
+		Select("COUNT(*) AS purchases, COALESCE(SUM(revenue), 0) AS revenue").
+		Where("campaign_id = ? AND attributed_at IS NOT NULL", campaignID).
+		Scan(&attributed).Error; err != nil {
+		return nil, fmt.Errorf("failed to total attributed purchases: %w", err)
+	}
+	stats.Purchases = attributed.Purchases
+	stats.Revenue = attributed.Revenue
+	if stats.Sent > 0 {
+		stats.ConversionRate = float64(stats.Purchases) / float64(stats.Sent)
+	}
+	return stats, nil
+}
+
+// AttributeSale credits an in-store sale to the campaign message that
+// prompted it, if any
+func (s *CampaignService) AttributeSale(ctx context.Context, sale *models.Sale) error {
+	return s.attribute(purchaseRecipients(sale.CustomerID, sale.GuardianID), sale.CreatedAt, sale.Total, &sale.ID, nil)
+}
+
+// AttributeOrder credits an online order to the campaign message that
+// prompted it, if any
+func (s *CampaignService) AttributeOrder(ctx context.Context, order *models.OnlineOrder) error {
+	return s.attribute(purchaseRecipients(order.CustomerID, order.GuardianID), order.CreatedAt, order.Total, nil, &order.ID)
+}
+
+// Private helper methods
+
+func (s *CampaignService) runActive(ctx context.Context) {
+	var campaigns []models.Campaign
+	if err := s.db.Where("is_active = ?", true).Find(&campaigns).Error; err != nil {
+		logrus.WithError(err).Error("Failed to load active campaigns")
+		return
+	}
+
+	for i := range campaigns {
+		queued, err := s.Enqueue(ctx, &campaigns[i])
+		if err != nil {
+			logrus.WithError(err).WithField("campaign", campaigns[i].Slug).Warn("Failed to queue campaign")
+			continue
+		}
+		if queued > 0 {
+			logrus.WithFields(logrus.Fields{"campaign": campaigns[i].Slug, "queued": queued}).Info("Campaign messages queued")
+		}
+	}
+
+	if result, err := s.Dispatch(ctx); err != nil {
+		logrus.WithError(err).Error("Campaign dispatch failed")
+	} else if result.Sent > 0 {
+		logrus.WithField("sent", result.Sent).Info("Campaign messages sent")
+	}
+}
+
+// findRecipients returns the customers the campaign's rule currently matches,
+// less anyone it messaged within the cooldown, with their rendered message
+func (s *CampaignService) findRecipients(campaign *models.Campaign) ([]CampaignRecipient, error) {
+	days := campaign.Days
+	if days <= 0 {
+		days = campaign.Rule.DefaultDays()
+	}
+
+	// Rule-specific details keyed by customer
+	details := map[uuid.UUID]*CampaignRecipient{}
+	customers := s.db.Model(&models.Customer{}).
+		Select("id", "first_name", "last_name", "date_of_birth").
+		Where("anonymized_at IS NULL")
+	if campaign.SegmentSlug != "" {
+		customers = query.Targeting{Segments: []string{campaign.SegmentSlug}}.Apply(customers, "customers.id")
+	}
+
+	switch campaign.Rule {
+	case models.CampaignRuleBirthday:
+		// Filtered in Go since month and day arithmetic differs between
+		// PostgreSQL and SQLite
+	case models.CampaignRuleNoRecentPurchase:
+		customers = customers.Where("id IN (?)", s.db.Model(&models.PurchaseHistory{}).
+			Select("customer_id").
+			Group("customer_id").
+			Having("MAX(purchase_date) < ?", since(days)))
+	case models.CampaignRuleRefillDue:
+		var refills []models.Refill
+		if err := s.db.Preload("Product").
+			Where("status IN ? AND due_date <= ?",
+				[]models.RefillStatus{models.RefillStatusScheduled, models.RefillStatusReminded},
+				time.Now().UTC().AddDate(0, 0, days)).
+			Order("due_date ASC").
+			Find(&refills).Error; err != nil {
+			return nil, fmt.Errorf("failed to load due refills: %w", err)
+		}
+		for _, refill := range refills {
+			detail, ok := details[refill.CustomerID]
+			if !ok {
+				due := refill.DueDate
+				detail = &CampaignRecipient{CustomerID: refill.CustomerID, DueDate: &due}
+				details[refill.CustomerID] = detail
+			}
+			if refill.Product != nil {
+				detail.Products = append(detail.Products, refill.Product.Name)
+			}
+		}
+		ids := make([]uuid.UUID, 0, len(details))
+		for id := range details {
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return []CampaignRecipient{}, nil
+		}
+		customers = customers.Where("id IN ?", ids)
+	default:
+		return nil, fmt.Errorf("unknown campaign rule: %s", campaign.Rule)
+	}
+
+	if campaign.CooldownDays > 0 {
+		customers = customers.Where("id NOT IN (?)", s.db.Model(&models.CampaignSend{}).
+			Select("customer_id").
+			Where("campaign_id = ? AND queued_at >= ?", campaign.ID, since(campaign.CooldownDays)))
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	recipients := []CampaignRecipient{}
+	var batch []models.Customer
+	err := customers.FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, customer := range batch {
+			recipient := CampaignRecipient{CustomerID: customer.ID}
+			if detail, ok := details[customer.ID]; ok {
+				recipient = *detail
+			}
+			if campaign.Rule == models.CampaignRuleBirthday {
+				birthday := nextBirthday(customer.DateOfBirth, today)
+				if birthday.Sub(today) >= time.Duration(days)*24*time.Hour {
+					continue
+				}
+				recipient.Birthday = &birthday
+			}
+			recipient.Name = customer.FirstName + " " + customer.LastName
+			recipient.Subject = renderCampaign(campaign.Subject, customer, recipient)
+			recipient.Body = renderCampaign(campaign.Body, customer, recipient)
+			recipients = append(recipients, recipient)
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find campaign recipients: %w", err)
+	}
+
+	sort.Slice(recipients, func(i, j int) bool { return recipients[i].Name < recipients[j].Name })
+	return recipients, nil
+}
+
+// attribute credits a purchase to the latest message sent to any of the
+// recipients within its campaign's attribution window. Each message is
+// credited with at most one purchase.
+func (s *CampaignService) attribute(recipients []uuid.UUID, at time.Time, amount models.Money, saleID, orderID *uuid.UUID) error {
+	if len(recipients) == 0 {
+		return nil
+	}
+
+	var sends []models.CampaignSend
+	if err := s.db.Where("customer_id IN ? AND status = ? AND attributed_at IS NULL AND sent_at >= ? AND sent_at <= ?",
+		recipients, models.CampaignSendSent, at.AddDate(0, 0, -maxAttributionDays), at).
+		Order("sent_at DESC").
+		Find(&sends).Error; err != nil {
+		return fmt.Errorf("failed to load campaign sends: %w", err)
+	}
+
+	windows := map[uuid.UUID]int{}
+	for _, send := range sends {
+		window, ok := windows[send.CampaignID]
+		if !ok {
+			var campaign models.Campaign
+			if err := s.db.Select("id", "attribution_days").First(&campaign, send.CampaignID).Error; err != nil {
+				continue
+			}
+			window = campaign.AttributionDays
+			windows[send.CampaignID] = window
+		}
+		if send.SentAt.AddDate(0, 0, window).Before(at) {
+			continue
+		}
+
+		now := time.Now().UTC()
+		result := s.db.Model(&models.CampaignSend{}).
+			Where("id = ? AND attributed_at IS NULL", send.ID).
+			Updates(map[string]interface{}{
+				"sale_id":       saleID,
+				"order_id":      orderID,
+				"revenue":       amount,
+				"attributed_at": now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to attribute purchase: %w", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// purchaseRecipients returns who may have received the message behind a
+// purchase: the customer and, for a dependent, the guardian who bought
+func purchaseRecipients(customerID, guardianID *uuid.UUID) []uuid.UUID {
+	var ids []uuid.UUID
+	if customerID != nil {
+		ids = append(ids, *customerID)
+	}
+	if guardianID != nil {
+		ids = append(ids, *guardianID)
+	}
+	return ids
+}
+
+// nextBirthday returns the customer's next birthday on or after today. A
+// 29 February birthday falls on 1 March in other years.
+func nextBirthday(dob, today time.Time) time.Time {
+	birthday := time.Date(today.Year(), dob.Month(), dob.Day(), 0, 0, 0, 0, time.UTC)
+	if birthday.Before(today) {
+		birthday = time.Date(today.Year()+1, dob.Month(), dob.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	return birthday
+}
+
+func renderCampaign(template string, customer models.Customer, recipient CampaignRecipient) string {
+	dueDate := ""
+	if recipient.DueDate != nil {
+		dueDate = recipient.DueDate.Format("Jan 2")
+	}
+	return strings.NewReplacer(
+		"{{first_name}}", customer.FirstName,
+		"{{last_name}}", customer.LastName,
+		"{{products}}", strings.Join(recipient.Products, ", "),
+		"{{due_date}}", dueDate,
+	).Replace(template)
+}
+
+func applyCampaignDefaults(campaign *models.Campaign) {
+	if campaign.Purpose == "" {
+		campaign.Purpose = models.PurposeMarketing
+		if campaign.Rule == models.CampaignRuleRefillDue {
+			campaign.Purpose = models.PurposeReminders
+		}
+	}
+	if campaign.CooldownDays == 0 {
+		campaign.CooldownDays = 30
+	}
+	if campaign.AttributionDays == 0 {
+		campaign.AttributionDays = 7
+	}
+}
+
+func validateCampaign(campaign *models.Campaign) error {
+	if campaign.Name == "" {
+		return fmt.Errorf("campaign name is required")
+	}
+	if !campaign.Rule.IsValid() {
+		return fmt.Errorf("invalid campaign rule: %s", campaign.Rule)
+	}
+	if campaign.Purpose != models.PurposeMarketing && campaign.Purpose != models.PurposeReminders {
+		return fmt.Errorf("campaign purpose must be marketing or reminders")
+	}
+	if campaign.Subject == "" || campaign.Body == "" {
+		return fmt.Errorf("campaign subject and body are required")
+	}
+	if campaign.Days < 0 || campaign.CooldownDays < 0 {
+		return fmt.Errorf("days and cooldown cannot be negative")
+	}
+	if campaign.AttributionDays < 1 || campaign.AttributionDays > maxAttributionDays {
+		return fmt.Errorf("attribution window must be between 1 and %d days", maxAttributionDays)
+	}
+	return nil
+}
+
+// Request/Response types
+
+type UpdateCampaignRequest struct {
+	Name            *string                     `json:"name"`
+	Days            *int                        `json:"days"`
+	Purpose         *models.NotificationPurpose `json:"purpose"`
+	Subject         *string                     `json:"subject"`
+	Body            *string                     `json:"body"`
+	SegmentSlug     *string                     `json:"segment_slug"`
+	CooldownDays    *int                        `json:"cooldown_days"`
+	AttributionDays *int                        `json:"attribution_days"`
+	IsActive        *bool                       `json:"is_active"`
+}
+
+type CampaignRecipient struct {
+	CustomerID uuid.UUID  `json:"customer_id"`
+	Name       string     `json:"name"`
+	Birthday   *time.Time `json:"birthday,omitempty"`
+	Products   []string   `json:"products,omitempty"` // refills due
+	DueDate    *time.Time `json:"due_date,omitempty"`
+	Subject    string     `json:"subject"`
+	Body       string     `json:"body"`
+}
+
+type CampaignPreview struct {
+	Total      int                 `json:"total"`
+	Recipients []CampaignRecipient `json:"recipients"`
+}
+
+type CampaignDispatchResult struct {
+	Queued     int `json:"queued"`
+	Sent       int `json:"sent"`
+	Suppressed int `json:"suppressed"` // not opted in to the campaign's purpose
+	Failed     int `json:"failed"`
+}
+
+type CampaignStats struct {
+	CampaignID     uuid.UUID    `json:"campaign_id"`
+	Queued         int64        `json:"queued"`
+	Sent           int64        `json:"sent"`
+	Suppressed     int64        `json:"suppressed"`
+	Failed         int64        `json:"failed"`
+	Purchases      int64        `json:"purchases"` // sends credited with a purchase
+	Revenue        models.Money `json:"revenue"`
+	ConversionRate float64      `json:"conversion_rate"` // purchases per message sent
+}
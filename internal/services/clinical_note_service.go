@@ -0,0 +1,264 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type ClinicalNoteService struct {
+	db *gorm.DB
+}
+
+func NewClinicalNoteService(db *gorm.DB) *ClinicalNoteService {
+	return &ClinicalNoteService{db: db}
+}
+
+// CreateNote records counseling or an intervention against a customer,
+// optionally tied to the sale or order it was made for
+func (s *ClinicalNoteService) CreateNote(ctx context.Context, req CreateClinicalNoteRequest, pharmacistID uuid.UUID) (*models.ClinicalNote, error) {
+	if !req.NoteType.IsValid() {
+		return nil, fmt.Errorf("invalid note type: %s", req.NoteType)
+	}
+	if req.NoteType == models.ClinicalNoteIntervention && !req.InterventionType.IsValid() {
+		return nil, fmt.Errorf("invalid intervention type: %s", req.InterventionType)
+	}
+	if req.Outcome == "" {
+		req.Outcome = models.ClinicalOutcomePending
+	}
+	if !req.Outcome.IsValid() {
+		return nil, fmt.Errorf("invalid outcome: %s", req.Outcome)
+	}
+
+	var customer models.Customer
+	if err := s.db.Select("id").First(&customer, req.CustomerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if req.SaleID != nil {
+		var count int64
+		s.db.Model(&models.Sale{}).Where("id = ? AND customer_id = ?", *req.SaleID, req.CustomerID).Count(&count)
+		if count == 0 {
+			return nil, fmt.Errorf("sale does not belong to this customer")
+		}
+	}
+	if req.OrderID != nil {
+		var count int64
+		s.db.Model(&models.OnlineOrder{}).Where("id = ? AND customer_id = ?", *req.OrderID, req.CustomerID).Count(&count)
+		if count == 0 {
+			return nil, fmt.Errorf("order does not belong to this customer")
+		}
+	}
+
+	now := time.Now().UTC()
+	note := &models.ClinicalNote{
+		CustomerID: req.CustomerID,
+		SaleID:     req.SaleID,
+		OrderID:    req.OrderID,
+		ProductID:  req.ProductID,
+		NoteType:   req.NoteType,
+		Prescriber: req.Prescriber,
+		Outcome:    req.Outcome,
+		RecordedBy: pharmacistID,
+		RecordedAt: now,
+	}
+	if req.NoteType == models.ClinicalNoteIntervention {
+		note.InterventionType = req.InterventionType
+	}
+	if err := note.Note.Set(req.Note); err != nil {
+		return nil, fmt.Errorf("failed to encrypt note: %w", err)
+	}
+	if req.OutcomeNotes != "" {
+		if err := note.OutcomeNotes.Set(req.OutcomeNotes); err != nil {
+			return nil, fmt.Errorf("failed to encrypt outcome notes: %w", err)
+		}
+	}
+	if req.Outcome != models.ClinicalOutcomePending {
+		note.OutcomeRecordedAt = &now
+	}
+
+	if err := s.db.Create(note).Error; err != nil {
+		return nil, fmt.Errorf("failed to save clinical note: %w", err)
+	}
+	return note, nil
+}
+
+// RecordOutcome updates the outcome of an intervention, e.g. once the
+// prescriber has called back
+func (s *ClinicalNoteService) RecordOutcome(ctx context.Context, id uuid.UUID, outcome models.ClinicalNoteOutcome, notes string) (*models.ClinicalNote, error) {
+	if !outcome.IsValid() {
+		return nil, fmt.Errorf("invalid outcome: %s", outcome)
+	}
+
+	var note models.ClinicalNote
+	if err := s.db.First(&note, id).Error; err != nil {
+		return nil, fmt.Errorf("clinical note not found: %w", err)
+	}
+
+	now := time.Now().UTC()
+	note.Outcome = outcome
+	note.OutcomeRecordedAt = &now
+	if err := note.OutcomeNotes.Set(notes); err != nil {
+		return nil, fmt.Errorf("failed to encrypt outcome notes: %w", err)
+	}
+
+	if err := s.db.Save(&note).Error; err != nil {
+		return nil, fmt.Errorf("failed to update clinical note: %w", err)
+	}
+	return &note, nil
+}
+
+// ListNotes returns notes matching the filter, newest first
+func (s *ClinicalNoteService) ListNotes(ctx context.Context, filter ClinicalNoteFilter) ([]models.ClinicalNote, int64, error) {
+	query := s.filtered(ctx, filter)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notes []models.ClinicalNote
+	err := query.Preload("Product", WithDeleted).Preload("User").
+		Order("recorded_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&notes).Error
+	return notes, total, err
+}
+
+// ExportCSV writes every note matching the filter as CSV for accreditation
+// audits. Note text is decrypted into the export.
+func (s *ClinicalNoteService) ExportCSV(ctx context.Context, w io.Writer, filter ClinicalNoteFilter) error {
+	var notes []models.ClinicalNote
+	if err := s.filtered(ctx, filter).Preload("Customer", WithDeleted).Preload("Product", WithDeleted).Preload("User").
+		Order("recorded_at ASC").Find(&notes).Error; err != nil {
+		return fmt.Errorf("failed to load clinical notes: %w", err)
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"recorded_at", "note_id", "customer_id", "customer_name", "sale_id", "order_id", "product",
+		"note_type", "intervention_type", "note", "prescriber", "outcome", "outcome_notes",
+		"outcome_recorded_at", "pharmacist",
+	})
+
+	for _, note := range notes {
+		text, err := note.Note.Get()
+		if err != nil {
+			return fmt.Errorf("failed to decrypt note %s: %w", note.ID, err)
+		}
+		outcomeNotes, err := note.OutcomeNotes.Get()
+		if err != nil {
+			return fmt.Errorf("failed to decrypt outcome notes %s: %w", note.ID, err)
+		}
+
+		customerName, product, pharmacist := "", "", ""
+		if note.Customer != nil {
+			customerName = note.Customer.FirstName + " " + note.Customer.LastName
+		}
+		if note.Product != nil {
+			product = note.Product.Name
+		}
+		if note.User != nil {
+			pharmacist = note.User.FirstName + " " + note.User.LastName
+		}
+
+		writer.Write([]string{
+			note.RecordedAt.Format(time.RFC3339),
+			note.ID.String(),
+			note.CustomerID.String(),
+			customerName,
+			optionalUUID(note.SaleID),
+			optionalUUID(note.OrderID),
+			product,
+			string(note.NoteType),
+			string(note.InterventionType),
+			text,
+			note.Prescriber,
+			string(note.Outcome),
+			outcomeNotes,
+			optionalTime(note.OutcomeRecordedAt),
+			pharmacist,
+		})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Private helper methods
+
+func (s *ClinicalNoteService) filtered(ctx context.Context, filter ClinicalNoteFilter) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.ClinicalNote{})
+	if filter.CustomerID != nil {
+		query = query.Where("customer_id = ?", *filter.CustomerID)
+	}
+	if filter.SaleID != nil {
+		query = query.Where("sale_id = ?", *filter.SaleID)
+	}
+	if filter.OrderID != nil {
+		query = query.Where("order_id = ?", *filter.OrderID)
+	}
+	if filter.NoteType != "" {
+		query = query.Where("note_type = ?", filter.NoteType)
+	}
+	if filter.InterventionType != "" {
+		query = query.Where("intervention_type = ?", filter.InterventionType)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.From != nil {
+		query = query.Where("recorded_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("recorded_at < ?", *filter.To)
+	}
+	return query
+}
+
+func optionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func optionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// Request/Response types
+
+type CreateClinicalNoteRequest struct {
+	CustomerID       uuid.UUID                  `json:"-"`
+	SaleID           *uuid.UUID                 `json:"sale_id"`
+	OrderID          *uuid.UUID                 `json:"order_id"`
+	ProductID        *uuid.UUID                 `json:"product_id"`
+	NoteType         models.ClinicalNoteType    `json:"note_type" binding:"required"`
+	InterventionType models.InterventionType    `json:"intervention_type"`
+	Note             string                     `json:"note" binding:"required"`
+	Prescriber       string                     `json:"prescriber"`
+	Outcome          models.ClinicalNoteOutcome `json:"outcome"`
+	OutcomeNotes     string                     `json:"outcome_notes"`
+}
+
+type ClinicalNoteFilter struct {
+	CustomerID       *uuid.UUID
+	SaleID           *uuid.UUID
+	OrderID          *uuid.UUID
+	NoteType         models.ClinicalNoteType
+	InterventionType models.InterventionType
+	Outcome          models.ClinicalNoteOutcome
+	From             *time.Time
+	To               *time.Time
+	Limit            int
+	Offset           int
+}
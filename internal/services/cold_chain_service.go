@@ -0,0 +1,643 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/alerting"
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrStorageUnitRange    = errors.New("the minimum temperature must be below the maximum")
+	ErrStorageUnitKind     = errors.New("kind must be refrigerator, freezer, cold_room or cooler_box")
+	ErrStorageUnitInactive = errors.New("the storage unit is not in use")
+	ErrReadingInFuture     = errors.New("the reading is in the future")
+	ErrStorageUnitBusy     = errors.New("the storage unit was updated by another reading, try again")
+	ErrExcursionOpen       = errors.New("the excursion is still open, the unit is out of range")
+	ErrExcursionReviewed   = errors.New("the excursion has already been reviewed")
+	ErrDispositionMissing  = errors.New("every batch needs a disposition of usable, quarantine or discard")
+)
+
+// ColdChainService logs the temperatures of the units refrigerated stock is
+// kept in. A reading out of a unit's range opens an excursion, which lists
+// the batches stored there and raises an alert; the first reading back in
+// range closes it, and a pharmacist then reviews it and decides what
+// happens to each batch.
+type ColdChainService struct {
+	db     *gorm.DB
+	config config.ColdChainConfig
+	outbox *OutboxService
+	alerts *alerting.Notifier
+}
+
+func NewColdChainService(db *gorm.DB, cfg config.ColdChainConfig) *ColdChainService {
+	return &ColdChainService{db: db, config: cfg}
+}
+
+// SetOutbox sends excursions to the webhook subscribers
+func (s *ColdChainService) SetOutbox(outbox *OutboxService) {
+	s.outbox = outbox
+}
+
+// SetAlerting posts excursions and silent data loggers to the operations
+// channels
+func (s *ColdChainService) SetAlerting(alerts *alerting.Notifier) {
+	s.alerts = alerts
+}
+
+// ListUnits lists the storage units by code, those of branchID only when
+// given
+func (s *ColdChainService) ListUnits(ctx context.Context, branchID *uuid.UUID) ([]models.StorageUnit, error) {
+	query := s.db.WithContext(ctx).Order("code ASC")
+	if branchID != nil {
+		query = query.Where("branch_id = ?", *branchID)
+	}
+	var units []models.StorageUnit
+	if err := query.Find(&units).Error; err != nil {
+		return nil, fmt.Errorf("failed to load storage units: %w", err)
+	}
+	return units, nil
+}
+
+func (s *ColdChainService) GetUnit(ctx context.Context, id uuid.UUID) (*models.StorageUnit, error) {
+	var unit models.StorageUnit
+	if err := s.db.WithContext(ctx).First(&unit, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("storage unit: %w", err)
+	}
+	return &unit, nil
+}
+
+// CreateUnit registers a storage unit
+func (s *ColdChainService) CreateUnit(ctx context.Context, req StorageUnitRequest, branchID *uuid.UUID) (*models.StorageUnit, error) {
+	unit := &models.StorageUnit{BranchID: branchID, IsActive: true}
+	if err := req.apply(unit); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(unit).Error; err != nil {
+		return nil, fmt.Errorf("failed to create storage unit: %w", err)
+	}
+	return unit, nil
+}
+
+// UpdateUnit changes a storage unit. A new range applies from the next
+// reading; an open excursion keeps the range it started under.
+func (s *ColdChainService) UpdateUnit(ctx context.Context, id uuid.UUID, req StorageUnitRequest) (*models.StorageUnit, error) {
+	unit, err := s.GetUnit(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.apply(unit); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(unit).Select("name", "code", "kind", "location",
+		"min_temperature", "max_temperature", "sensor_id", "is_active").Updates(unit).Error; err != nil {
+		return nil, fmt.Errorf("failed to update storage unit: %w", err)
+	}
+	return unit, nil
+}
+
+// RecordReading logs a temperature taken in the unit and opens, extends or
+// closes its excursion. A reading older than the unit's latest is logged
+// but leaves the excursions as they are. The excursion returned is the one
+// the reading belongs to, if any.
+func (s *ColdChainService) RecordReading(ctx context.Context, unitID uuid.UUID, req ReadingRequest, source string, userID *uuid.UUID) (*models.TemperatureReading, *models.TemperatureExcursion, error) {
+	recordedAt := time.Now().UTC()
+	if req.RecordedAt != nil {
+		recordedAt = req.RecordedAt.UTC()
+	}
+	// Logger clocks drift, so a little ahead of ours is allowed
+	if recordedAt.After(time.Now().Add(5 * time.Minute)) {
+		return nil, nil, ErrReadingInFuture
+	}
+
+	reading := &models.TemperatureReading{
+		StorageUnitID: unitID,
+		Temperature:   *req.Temperature,
+		RecordedAt:    recordedAt,
+		Source:        source,
+		RecordedBy:    userID,
+		Notes:         req.Notes,
+	}
+	var excursion *models.TemperatureExcursion
+	opened, closed := false, false
+	var unit models.StorageUnit
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&unit, "id = ?", unitID).Error; err != nil {
+			return fmt.Errorf("storage unit: %w", err)
+		}
+		if !unit.IsActive {
+			return ErrStorageUnitInactive
+		}
+		reading.OutOfRange = reading.Temperature < unit.MinTemperature || reading.Temperature > unit.MaxTemperature
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reading)
+		if result.Error != nil {
+			return fmt.Errorf("failed to record reading: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			// Already logged, so already applied
+			return tx.Where("storage_unit_id = ? AND recorded_at = ?", unitID, recordedAt).First(reading).Error
+		}
+		if unit.LastReadingAt != nil && recordedAt.Before(*unit.LastReadingAt) {
+			return nil
+		}
+
+		// Two readings racing to open or close the unit's excursion can't
+		// both apply; the one that loses is retried
+		updates := map[string]interface{}{"last_temperature": reading.Temperature, "last_reading_at": recordedAt}
+		var err error
+		switch {
+		case reading.OutOfRange && unit.OpenExcursionID == nil:
+			excursion, err = s.openExcursion(tx, &unit, reading)
+			opened = true
+		case reading.OutOfRange:
+			excursion, err = s.extendExcursion(tx, *unit.OpenExcursionID, reading)
+		case unit.OpenExcursionID != nil:
+			excursion, err = s.closeExcursion(tx, *unit.OpenExcursionID, reading)
+			updates["open_excursion_id"] = nil
+			closed = true
+		}
+		if err != nil {
+			return err
+		}
+		if opened {
+			updates["open_excursion_id"] = excursion.ID
+		}
+		if excursion != nil {
+			reading.ExcursionID = &excursion.ID
+			if err := tx.Model(reading).Update("excursion_id", excursion.ID).Error; err != nil {
+				return fmt.Errorf("failed to link reading to excursion: %w", err)
+			}
+		}
+
+		query := tx.Model(&models.StorageUnit{}).Where("id = ?", unit.ID)
+		if unit.OpenExcursionID == nil {
+			query = query.Where("open_excursion_id IS NULL")
+		} else {
+			query = query.Where("open_excursion_id = ?", *unit.OpenExcursionID)
+		}
+		result = query.Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update storage unit: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrStorageUnitBusy
+		}
+		if opened && s.outbox != nil {
+			return s.outbox.QueueWebhook(tx, "cold_chain.excursion_started", excursionEvent(&unit, excursion))
+		}
+		if closed && s.outbox != nil {
+			return s.outbox.QueueWebhook(tx, "cold_chain.excursion_ended", excursionEvent(&unit, excursion))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opened {
+		s.alertExcursion(&unit, excursion, reading)
+	}
+	if closed {
+		logrus.WithFields(logrus.Fields{
+			"storage_unit": unit.Code,
+			"excursion_id": excursion.ID,
+			"duration":     excursion.EndedAt.Sub(excursion.StartedAt).String(),
+		}).Info("Storage unit back in range")
+	}
+	return reading, excursion, nil
+}
+
+// ReceiveSensorReadings processes an event posted by a data logger through
+// the webhook inbox. Its readings name the logger by sensor ID; those of
+// loggers no unit has are dropped with a warning, as retrying won't help.
+func (s *ColdChainService) ReceiveSensorReadings(ctx context.Context, event *models.InboundWebhook, payload []byte) error {
+	var body struct {
+		sensorReading
+		Readings []sensorReading `json:"readings"`
+	}
+	if err := json.Unmarshal(payload, &body); err != nil {
+		logrus.WithError(err).WithField("event_id", event.EventID).Warn("Ignoring unreadable sensor event")
+		return nil
+	}
+	readings := body.Readings
+	if body.SensorID != "" {
+		readings = append(readings, body.sensorReading)
+	}
+
+	for _, posted := range readings {
+		if posted.SensorID == "" || posted.Temperature == nil {
+			continue
+		}
+		var unit models.StorageUnit
+		err := s.db.WithContext(ctx).Select("id").Where("sensor_id = ?", posted.SensorID).First(&unit).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.WithField("sensor_id", posted.SensorID).Warn("Ignoring reading from a sensor no storage unit has")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find storage unit: %w", err)
+		}
+		_, _, err = s.RecordReading(ctx, unit.ID, ReadingRequest{
+			Temperature: posted.Temperature,
+			RecordedAt:  posted.RecordedAt,
+		}, models.ReadingSourceSensor, nil)
+		switch {
+		case errors.Is(err, ErrStorageUnitInactive), errors.Is(err, ErrReadingInFuture):
+			logrus.WithError(err).WithField("sensor_id", posted.SensorID).Warn("Ignoring sensor reading")
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// ListReadings lists the unit's readings in [from, to), newest first
+func (s *ColdChainService) ListReadings(ctx context.Context, unitID uuid.UUID, from, to *time.Time, limit, offset int) ([]models.TemperatureReading, int64, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	query := s.db.WithContext(ctx).Model(&models.TemperatureReading{}).Where("storage_unit_id = ?", unitID)
+	if from != nil {
+		query = query.Where("recorded_at >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("recorded_at < ?", *to)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count readings: %w", err)
+	}
+	var readings []models.TemperatureReading
+	if err := query.Order("recorded_at DESC").Limit(limit).Offset(offset).Find(&readings).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load readings: %w", err)
+	}
+	return readings, total, nil
+}
+
+// ListExcursions lists excursions, newest first. Filtering by product or
+// batch finds the excursions those batches went through.
+func (s *ColdChainService) ListExcursions(ctx context.Context, filter ExcursionFilter) ([]models.TemperatureExcursion, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	query := s.db.WithContext(ctx).Model(&models.TemperatureExcursion{})
+	if filter.StorageUnitID != nil {
+		query = query.Where("storage_unit_id = ?", *filter.StorageUnitID)
+	}
+	if filter.BranchID != nil {
+		query = query.Where("storage_unit_id IN (?)",
+			s.db.Model(&models.StorageUnit{}).Select("id").Where("branch_id = ?", *filter.BranchID))
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ProductID != nil || filter.BatchNumber != "" {
+		batches := s.db.Model(&models.ExcursionBatch{}).Select("excursion_id")
+		if filter.ProductID != nil {
+			batches = batches.Where("product_id = ?", *filter.ProductID)
+		}
+		if filter.BatchNumber != "" {
+			batches = batches.Where("batch_number = ?", filter.BatchNumber)
+		}
+		query = query.Where("id IN (?)", batches)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count excursions: %w", err)
+	}
+	var excursions []models.TemperatureExcursion
+	if err := query.Preload("StorageUnit").Order("started_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).
+		Find(&excursions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load excursions: %w", err)
+	}
+	return excursions, total, nil
+}
+
+// GetExcursionReport returns the excursion with its unit, batches and the
+// readings taken during it
+func (s *ColdChainService) GetExcursionReport(ctx context.Context, id uuid.UUID) (*ExcursionReport, error) {
+	var excursion models.TemperatureExcursion
+	if err := s.db.WithContext(ctx).Preload("StorageUnit").Preload("Batches.Product").
+		First(&excursion, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("excursion: %w", err)
+	}
+	report := &ExcursionReport{TemperatureExcursion: excursion}
+	if err := s.db.WithContext(ctx).Where("excursion_id = ?", id).
+		Order("recorded_at ASC").Find(&report.Readings).Error; err != nil {
+		return nil, fmt.Errorf("failed to load excursion readings: %w", err)
+	}
+	end := time.Now().UTC()
+	if excursion.EndedAt != nil {
+		end = *excursion.EndedAt
+	}
+	report.Duration = end.Sub(excursion.StartedAt).Round(time.Second).String()
+	return report, nil
+}
+
+// ReviewExcursion records the cause of a closed excursion, what was done
+// and the disposition of each batch. A batch not given keeps the one it
+// has, and every batch must have one once reviewed.
+func (s *ColdChainService) ReviewExcursion(ctx context.Context, id uuid.UUID, req ReviewExcursionRequest, userID uuid.UUID) (*ExcursionReport, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var excursion models.TemperatureExcursion
+		if err := tx.Preload("Batches").First(&excursion, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("excursion: %w", err)
+		}
+		switch excursion.Status {
+		case models.ExcursionOpen:
+			return ErrExcursionOpen
+		case models.ExcursionReviewed:
+			return ErrExcursionReviewed
+		}
+
+		given := make(map[uuid.UUID]BatchDispositionRequest, len(req.Batches))
+		for _, batch := range req.Batches {
+			if !batch.Disposition.IsValid() {
+				return ErrDispositionMissing
+			}
+			given[batch.ProductID] = batch
+		}
+		for _, batch := range excursion.Batches {
+			disposition, ok := given[batch.ProductID]
+			if !ok {
+				if batch.Disposition == models.DispositionPending {
+					return fmt.Errorf("%w: batch %s", ErrDispositionMissing, batch.BatchNumber)
+				}
+				continue
+			}
+			if err := tx.Model(&models.ExcursionBatch{}).Where("id = ?", batch.ID).Updates(map[string]interface{}{
+				"disposition": disposition.Disposition,
+				"notes":       disposition.Notes,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to record batch disposition: %w", err)
+			}
+		}
+
+		now := time.Now().UTC()
+		result := tx.Model(&models.TemperatureExcursion{}).
+			Where("id = ? AND status = ?", id, models.ExcursionClosed).
+			Updates(map[string]interface{}{
+				"status":      models.ExcursionReviewed,
+				"cause":       req.Cause,
+				"action":      req.Action,
+				"reviewed_by": userID,
+				"reviewed_at": now,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to review excursion: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrExcursionReviewed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetExcursionReport(ctx, id)
+}
+
+// CheckSensors alerts on the active units with a data logger that hasn't
+// posted a reading within the sensor timeout, and returns how many there
+// are. A unit that has never reported counts from when it was registered.
+func (s *ColdChainService) CheckSensors(ctx context.Context) (int, error) {
+	cutoff := time.Now().UTC().Add(-s.config.SensorTimeout)
+	var units []models.StorageUnit
+	if err := s.db.WithContext(ctx).
+		Where("is_active = ? AND sensor_id IS NOT NULL", true).
+		Where("(last_reading_at IS NULL AND created_at < ?) OR last_reading_at < ?", cutoff, cutoff).
+		Find(&units).Error; err != nil {
+		return 0, fmt.Errorf("failed to find silent sensors: %w", err)
+	}
+
+	for _, unit := range units {
+		last := "never"
+		if unit.LastReadingAt != nil {
+			last = unit.LastReadingAt.Format(time.RFC3339)
+		}
+		s.alerts.Notify(alerting.Alert{
+			Event:    alerting.EventSensorSilent,
+			Severity: alerting.SeverityWarning,
+			Title:    "Temperature logger has stopped reporting",
+			Message:  fmt.Sprintf("No reading from %s (%s) in over %s", unit.Name, unit.Code, s.config.SensorTimeout),
+			Fields: []alerting.Field{
+				{Name: "Sensor", Value: *unit.SensorID},
+				{Name: "Location", Value: unit.Location},
+				{Name: "Last reading", Value: last},
+			},
+			Key: unit.ID.String(),
+		})
+	}
+	return len(units), nil
+}
+
+// Private helper methods
+
+// openExcursion starts an excursion at the reading and lists the batches
+// in stock in the unit
+func (s *ColdChainService) openExcursion(tx *gorm.DB, unit *models.StorageUnit, reading *models.TemperatureReading) (*models.TemperatureExcursion, error) {
+	excursion := &models.TemperatureExcursion{
+		StorageUnitID:  unit.ID,
+		Status:         models.ExcursionOpen,
+		StartedAt:      reading.RecordedAt,
+		MinTemperature: unit.MinTemperature,
+		MaxTemperature: unit.MaxTemperature,
+		LowestReading:  reading.Temperature,
+		HighestReading: reading.Temperature,
+		ReadingCount:   1,
+	}
+	if err := tx.Create(excursion).Error; err != nil {
+		return nil, fmt.Errorf("failed to open excursion: %w", err)
+	}
+
+	var products []models.Product
+	if err := tx.Select("id", "batch_number", "expiry_date", "stock").
+		Where("storage_unit_id = ? AND stock > 0", unit.ID).
+		Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to find batches in storage unit: %w", err)
+	}
+	for _, product := range products {
+		batch := models.ExcursionBatch{
+			ExcursionID: excursion.ID,
+			ProductID:   product.ID,
+			BatchNumber: product.BatchNumber,
+			Quantity:    product.Stock,
+			Disposition: models.DispositionPending,
+		}
+		if !product.ExpiryDate.IsZero() {
+			expiry := product.ExpiryDate.Time
+			batch.ExpiryDate = &expiry
+		}
+		excursion.Batches = append(excursion.Batches, batch)
+	}
+	if len(excursion.Batches) > 0 {
+		if err := tx.Create(&excursion.Batches).Error; err != nil {
+			return nil, fmt.Errorf("failed to record batches at risk: %w", err)
+		}
+	}
+	return excursion, nil
+}
+
+func (s *ColdChainService) extendExcursion(tx *gorm.DB, id uuid.UUID, reading *models.TemperatureReading) (*models.TemperatureExcursion, error) {
+	var excursion models.TemperatureExcursion
+	if err := tx.First(&excursion, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("excursion: %w", err)
+	}
+	if reading.Temperature < excursion.LowestReading {
+		excursion.LowestReading = reading.Temperature
+	}
+	if reading.Temperature > excursion.HighestReading {
+		excursion.HighestReading = reading.Temperature
+	}
+	excursion.ReadingCount++
+	if err := tx.Model(&excursion).Select("lowest_reading", "highest_reading", "reading_count").
+		Updates(&excursion).Error; err != nil {
+		return nil, fmt.Errorf("failed to update excursion: %w", err)
+	}
+	return &excursion, nil
+}
+
+// closeExcursion ends the excursion at the first reading back in range,
+// which belongs to it so its report shows the recovery
+func (s *ColdChainService) closeExcursion(tx *gorm.DB, id uuid.UUID, reading *models.TemperatureReading) (*models.TemperatureExcursion, error) {
+	var excursion models.TemperatureExcursion
+	if err := tx.First(&excursion, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("excursion: %w", err)
+	}
+	ended := reading.RecordedAt
+	excursion.EndedAt = &ended
+	excursion.Status = models.ExcursionClosed
+	if err := tx.Model(&excursion).Select("ended_at", "status").Updates(&excursion).Error; err != nil {
+		return nil, fmt.Errorf("failed to close excursion: %w", err)
+	}
+	return &excursion, nil
+}
+
+func (s *ColdChainService) alertExcursion(unit *models.StorageUnit, excursion *models.TemperatureExcursion, reading *models.TemperatureReading) {
+	direction := "above"
+	if reading.Temperature < unit.MinTemperature {
+		direction = "below"
+	}
+	batches := make([]string, 0, len(excursion.Batches))
+	for _, batch := range excursion.Batches {
+		batches = append(batches, batch.BatchNumber)
+	}
+	s.alerts.Notify(alerting.Alert{
+		Event:    alerting.EventTemperatureExcursion,
+		Severity: alerting.SeverityCritical,
+		Title:    "Cold chain excursion",
+		Message: fmt.Sprintf("%s (%s) read %.1f°C, %s its %.1f to %.1f°C range",
+			unit.Name, unit.Code, reading.Temperature, direction, unit.MinTemperature, unit.MaxTemperature),
+		Fields: []alerting.Field{
+			{Name: "Location", Value: unit.Location},
+			{Name: "Recorded at", Value: reading.RecordedAt.Format(time.RFC3339)},
+			{Name: "Batches at risk", Value: strings.Join(batches, ", ")},
+			{Name: "Excursion", Value: excursion.ID.String()},
+		},
+		Key: excursion.ID.String(),
+	})
+}
+
+func excursionEvent(unit *models.StorageUnit, excursion *models.TemperatureExcursion) map[string]interface{} {
+	return map[string]interface{}{
+		"excursion_id":    excursion.ID,
+		"storage_unit_id": unit.ID,
+		"storage_unit":    unit.Code,
+		"started_at":      excursion.StartedAt,
+		"ended_at":        excursion.EndedAt,
+		"lowest_reading":  excursion.LowestReading,
+		"highest_reading": excursion.HighestReading,
+	}
+}
+
+// Request/Response types
+
+type StorageUnitRequest struct {
+	Name           string                 `json:"name" binding:"required,max=100"`
+	Code           string                 `json:"code" binding:"required,max=50"`
+	Kind           models.StorageUnitKind `json:"kind" binding:"required"`
+	Location       string                 `json:"location" binding:"max=100"`
+	MinTemperature *float64               `json:"min_temperature" binding:"required"`
+	MaxTemperature *float64               `json:"max_temperature" binding:"required"`
+	SensorID       *string                `json:"sensor_id" binding:"omitempty,max=100"`
+	IsActive       *bool                  `json:"is_active"`
+}
+
+func (r StorageUnitRequest) apply(unit *models.StorageUnit) error {
+	if !r.Kind.IsValid() {
+		return ErrStorageUnitKind
+	}
+	if *r.MinTemperature >= *r.MaxTemperature {
+		return ErrStorageUnitRange
+	}
+	unit.Name = strings.TrimSpace(r.Name)
+	unit.Code = strings.TrimSpace(r.Code)
+	unit.Kind = r.Kind
+	unit.Location = r.Location
+	unit.MinTemperature = *r.MinTemperature
+	unit.MaxTemperature = *r.MaxTemperature
+	unit.SensorID = nil
+	if r.SensorID != nil && strings.TrimSpace(*r.SensorID) != "" {
+		sensorID := strings.TrimSpace(*r.SensorID)
+		unit.SensorID = &sensorID
+	}
+	if r.IsActive != nil {
+		unit.IsActive = *r.IsActive
+	}
+	return nil
+}
+
+type ReadingRequest struct {
+	Temperature *float64   `json:"temperature" binding:"required"` // °C
+	RecordedAt  *time.Time `json:"recorded_at"`                    // defaults to now
+	Notes       string     `json:"notes" binding:"max=1000"`
+}
+
+// sensorReading is a reading as a data logger posts it
+type sensorReading struct {
+	SensorID    string     `json:"sensor_id"`
+	Temperature *float64   `json:"temperature"`
+	RecordedAt  *time.Time `json:"recorded_at"`
+}
+
+type ExcursionFilter struct {
+	StorageUnitID *uuid.UUID
+	BranchID      *uuid.UUID
+	Status        models.ExcursionStatus
+	ProductID     *uuid.UUID
+	BatchNumber   string
+	Limit         int
+	Offset        int
+}
+
+type ExcursionReport struct {
+	models.TemperatureExcursion
+	Duration string                      `json:"duration"`
+	Readings []models.TemperatureReading `json:"readings"`
+}
+
+type ReviewExcursionRequest struct {
+	Cause   string                    `json:"cause" binding:"required,max=2000"`
+	Action  string                    `json:"action" binding:"required,max=2000"`
+	Batches []BatchDispositionRequest `json:"batches" binding:"dive"`
+}
+
+type BatchDispositionRequest struct {
+	ProductID   uuid.UUID               `json:"product_id" binding:"required"`
+	Disposition models.BatchDisposition `json:"disposition" binding:"required"`
+	Notes       string                  `json:"notes" binding:"max=1000"`
+}
@@ -0,0 +1,414 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNotificationSuppressed is returned when a customer has opted out of, or
+// has no address for, every channel for a purpose
+var ErrNotificationSuppressed = errors.New("customer has opted out of this notification")
+
+// CommunicationService stores customer communication preferences and sends
+// customer notifications through the channels they allow
+type CommunicationService struct {
+	db        *gorm.DB
+	notifiers map[string]Notifier
+	sms       *SMSService
+	email     *EmailService
+	push      *PushService
+	config    config.NotificationConfig
+}
+
+func NewCommunicationService(db *gorm.DB, notifiers map[string]Notifier, cfg config.NotificationConfig) *CommunicationService {
+	return &CommunicationService{
+		db:        db,
+		notifiers: notifiers,
+		config:    cfg,
+	}
+}
+
+// SetSMSService sends texts through the SMS provider, written from stored
+// templates where a notification asks for one, instead of the SMS notifier
+func (s *CommunicationService) SetSMSService(sms *SMSService) {
+	s.sms = sms
+	s.notifiers[ChannelSMS] = sms
+}
+
+// SetEmailService sends email through the email provider, written from the
+// email templates, instead of the email notifier. Addresses on its
+// suppression list are skipped for the next channel.
+func (s *CommunicationService) SetEmailService(email *EmailService) {
+	s.email = email
+	s.notifiers[ChannelEmail] = email
+}
+
+// SetPushService sends push notifications to the apps the customer or guest
+// registered, instead of the push notifier. Customers without a device are
+// skipped for the next channel, and transactional messages also go to the
+// devices of customers who get them another way.
+func (s *CommunicationService) SetPushService(push *PushService) {
+	s.push = push
+	s.notifiers[ChannelPush] = push
+}
+
+// NotifyCustomer sends a message for a purpose over the first channel the
+// customer allows, starting with their preferred contact method. Messages
+// other than transactional ones carry an unsubscribe link. It returns the
+// channel used, or ErrNotificationSuppressed if no channel is allowed.
+func (s *CommunicationService) NotifyCustomer(ctx context.Context, customer *models.Customer, purpose models.NotificationPurpose, subject, body string) (string, error) {
+	return s.NotifyCustomerWithTemplate(ctx, customer, purpose, subject, body, MessageTemplates{})
+}
+
+// NotifyCustomerWithTemplate is NotifyCustomer, with the message written
+// from the SMS or email template for the channel it goes by
+func (s *CommunicationService) NotifyCustomerWithTemplate(ctx context.Context, customer *models.Customer, purpose models.NotificationPurpose, subject, body string, templates MessageTemplates) (string, error) {
+	prefs, err := s.loadPreferences(customer.ID)
+	if err != nil {
+		return "", err
+	}
+
+	for _, channel := range channelOrder(customer) {
+		to := customerAddress(customer, channel)
+		notifier, ok := s.notifiers[channel]
+		if !ok || to == "" {
+			continue
+		}
+		pref, chosen := prefs[prefKey(channel, purpose)]
+		if (chosen && !pref.OptedIn) || (!chosen && !purpose.DefaultOptIn()) {
+			continue
+		}
+		if channel == ChannelEmail && s.email != nil {
+			suppressed, err := s.email.Suppressed(ctx, to, purpose == models.PurposeTransactional)
+			if err != nil {
+				return "", err
+			}
+			if suppressed {
+				continue
+			}
+		}
+		if channel == ChannelPush && s.push != nil {
+			reachable, err := s.push.HasDevices(ctx, to)
+			if err != nil {
+				return "", err
+			}
+			if !reachable {
+				continue
+			}
+		}
+
+		unsubscribe := ""
+		if purpose != models.PurposeTransactional {
+			if !chosen {
+				if pref, err = s.setPreference(customer.ID, channel, purpose, true, ""); err != nil {
+					return "", err
+				}
+			}
+			unsubscribe = s.UnsubscribeLink(pref)
+		}
+
+		if err := s.send(ctx, notifier, channel, to, &customer.ID, subject, body, unsubscribe, templates); err != nil {
+			return "", err
+		}
+		if channel != ChannelPush && purpose == models.PurposeTransactional {
+			s.pushAlongside(ctx, customer, prefs, subject, body, templates)
+		}
+		return channel, nil
+	}
+	return "", ErrNotificationSuppressed
+}
+
+// NotifyAddress sends a transactional message to an address with no
+// customer record behind it, such as a guest order's email. It is written
+// from the template for the channel when one is given.
+func (s *CommunicationService) NotifyAddress(ctx context.Context, channel, to, subject, body string, templates MessageTemplates) error {
+	notifier, ok := s.notifiers[channel]
+	if !ok || to == "" {
+		return ErrNotificationSuppressed
+	}
+	return s.send(ctx, notifier, channel, to, nil, subject, body, "", templates)
+}
+
+// GetPreferences returns the customer's effective preference for every
+// channel and purpose, filling in defaults where none has been chosen
+func (s *CommunicationService) GetPreferences(ctx context.Context, customerID uuid.UUID) ([]PreferenceView, error) {
+	prefs, err := s.loadPreferences(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	purposes := []models.NotificationPurpose{models.PurposeTransactional, models.PurposeReminders, models.PurposeMarketing}
+	var views []PreferenceView
+	for _, channel := range Channels {
+		for _, purpose := range purposes {
+			view := PreferenceView{Channel: channel, Purpose: purpose, OptedIn: purpose.DefaultOptIn(), IsDefault: true}
+			if pref, ok := prefs[prefKey(channel, purpose)]; ok && pref.Source != "" {
+				view.OptedIn = pref.OptedIn
+				view.IsDefault = false
+				view.UpdatedAt = &pref.UpdatedAt
+			}
+			views = append(views, view)
+		}
+	}
+	return views, nil
+}
+
+// UpdatePreferences saves the given channel and purpose choices. Source
+// records who made the change.
+func (s *CommunicationService) UpdatePreferences(ctx context.Context, customerID uuid.UUID, updates []PreferenceUpdate, source string) error {
+	for _, u := range updates {
+		if !isChannel(u.Channel) {
+			return fmt.Errorf("invalid channel: %s", u.Channel)
+		}
+		if !u.Purpose.IsValid() {
+			return fmt.Errorf("invalid purpose: %s", u.Purpose)
+		}
+	}
+
+	var customer models.Customer
+	if err := s.db.Select("id").First(&customer, customerID).Error; err != nil {
+		return fmt.Errorf("customer not found: %w", err)
+	}
+
+	for _, u := range updates {
+		if _, err := s.setPreference(customerID, u.Channel, u.Purpose, u.OptedIn, source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unsubscribe opts the customer out of the channel and purpose identified by
+// an unsubscribe token
+func (s *CommunicationService) Unsubscribe(ctx context.Context, token string) (*models.CommunicationPreference, error) {
+	var pref models.CommunicationPreference
+	if err := s.db.Where("unsubscribe_token = ?", token).First(&pref).Error; err != nil {
+		return nil, fmt.Errorf("unsubscribe link not found: %w", err)
+	}
+
+	if err := s.db.Model(&pref).Updates(map[string]interface{}{
+		"opted_in": false,
+		"source":   "unsubscribe_link",
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"customer_id": pref.CustomerID,
+		"channel":     pref.Channel,
+		"purpose":     pref.Purpose,
+	}).Info("Customer unsubscribed")
+	return &pref, nil
+}
+
+// UnsubscribeLink returns the public unsubscribe URL for a preference
+func (s *CommunicationService) UnsubscribeLink(pref *models.CommunicationPreference) string {
+	return strings.TrimRight(s.config.UnsubscribeBaseURL, "/") + "/" + pref.UnsubscribeToken
+}
+
+// Private helper methods
+
+// send delivers a message over one channel, with the unsubscribe link for
+// messages other than transactional ones. Texts through the SMS service are
+// logged against the customer and written from the SMS template when it is
+// stored, falling back to body; emails through the email service use the
+// email template, or lay out subject and body; push notifications carry the
+// push data.
+func (s *CommunicationService) send(ctx context.Context, notifier Notifier, channel, to string, customerID *uuid.UUID, subject, body, unsubscribe string, templates MessageTemplates) error {
+	footer := ""
+	if unsubscribe != "" {
+		footer = "\n\nUnsubscribe: " + unsubscribe
+	}
+
+	switch {
+	case channel == ChannelSMS && s.sms != nil:
+		req := SMSRequest{To: to, Text: body, CustomerID: customerID}
+		if templates.SMS != nil {
+			req.Template = templates.SMS.Template
+			req.Text = s.sms.Render(ctx, templates.SMS.Template, templates.SMS.Data, body)
+		}
+		req.Text += footer
+		_, err := s.sms.SendSMS(ctx, req)
+		return err
+	case channel == ChannelEmail && s.email != nil:
+		req := EmailRequest{
+			To:            to,
+			Subject:       subject,
+			Body:          body,
+			Transactional: unsubscribe == "",
+			Unsubscribe:   unsubscribe,
+		}
+		if templates.Email != nil {
+			req.Template, req.Data = templates.Email.Template, templates.Email.Data
+		}
+		return s.email.SendEmail(ctx, req)
+	case channel == ChannelPush && s.push != nil:
+		// The app's settings stand in for the unsubscribe link
+		message := &PushMessage{Title: subject, Body: body}
+		if templates.Push != nil {
+			message.Data = templates.Push.Data
+		}
+		return s.push.Push(ctx, to, message)
+	}
+	return notifier.Send(ctx, to, subject, body+footer)
+}
+
+// pushAlongside also pushes a transactional message that went by another
+// channel to the customer's devices, unless they turned push off. It is
+// best effort: the message has been delivered.
+func (s *CommunicationService) pushAlongside(ctx context.Context, customer *models.Customer, prefs map[string]*models.CommunicationPreference, subject, body string, templates MessageTemplates) {
+	if s.push == nil {
+		return
+	}
+	if pref, chosen := prefs[prefKey(ChannelPush, models.PurposeTransactional)]; chosen && !pref.OptedIn {
+		return
+	}
+	err := s.send(ctx, s.push, ChannelPush, customerAddress(customer, ChannelPush), &customer.ID, subject, body, "", templates)
+	if err != nil && !errors.Is(err, ErrNotificationSuppressed) {
+		logrus.WithError(err).WithField("customer_id", customer.ID).Warn("Failed to push notification")
+	}
+}
+
+func (s *CommunicationService) loadPreferences(customerID uuid.UUID) (map[string]*models.CommunicationPreference, error) {
+	var prefs []models.CommunicationPreference
+	if err := s.db.Where("customer_id = ?", customerID).Find(&prefs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load communication preferences: %w", err)
+	}
+
+	byKey := make(map[string]*models.CommunicationPreference, len(prefs))
+	for i := range prefs {
+		byKey[prefKey(prefs[i].Channel, prefs[i].Purpose)] = &prefs[i]
+	}
+	return byKey, nil
+}
+
+// setPreference upserts a preference. An empty source creates the row with
+// the default value only to hold an unsubscribe token, and never overwrites
+// a choice the customer has made.
+func (s *CommunicationService) setPreference(customerID uuid.UUID, channel string, purpose models.NotificationPurpose, optedIn bool, source string) (*models.CommunicationPreference, error) {
+	token, err := generateUnsubscribeToken()
+	if err != nil {
+		return nil, err
+	}
+
+	pref := &models.CommunicationPreference{
+		CustomerID:       customerID,
+		Channel:          channel,
+		Purpose:          purpose,
+		OptedIn:          optedIn,
+		Source:           source,
+		UnsubscribeToken: token,
+	}
+	onConflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "customer_id"}, {Name: "channel"}, {Name: "purpose"}},
+		DoUpdates: clause.AssignmentColumns([]string{"opted_in", "source", "updated_at"}),
+	}
+	if source == "" {
+		onConflict = clause.OnConflict{
+			Columns:   onConflict.Columns,
+			DoNothing: true,
+		}
+	}
+	if err := s.db.Clauses(onConflict).Create(pref).Error; err != nil {
+		return nil, fmt.Errorf("failed to save communication preference: %w", err)
+	}
+
+	// Reload so the caller gets the stored token when the row already existed
+	if err := s.db.Where("customer_id = ? AND channel = ? AND purpose = ?", customerID, channel, purpose).
+		First(pref).Error; err != nil {
+		return nil, fmt.Errorf("failed to load communication preference: %w", err)
+	}
+	return pref, nil
+}
+
+func prefKey(channel string, purpose models.NotificationPurpose) string {
+	return channel + ":" + string(purpose)
+}
+
+func isChannel(channel string) bool {
+	for _, c := range Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// channelOrder lists channels with the customer's preferred contact method
+// first
+func channelOrder(customer *models.Customer) []string {
+	preferred := customer.PreferredContact
+	if preferred == "phone" {
+		preferred = ChannelSMS
+	}
+
+	order := []string{}
+	if isChannel(preferred) {
+		order = append(order, preferred)
+	}
+	for _, channel := range Channels {
+		if channel != preferred {
+			order = append(order, channel)
+		}
+	}
+	return order
+}
+
+// customerAddress returns where a channel delivers to. Push notifications are
+// addressed by customer ID and go to the devices registered for them.
+func customerAddress(customer *models.Customer, channel string) string {
+	switch channel {
+	case ChannelEmail:
+		return customer.Email
+	case ChannelSMS:
+		return customer.Phone
+	case ChannelPush:
+		return customer.ID.String()
+	}
+	return ""
+}
+
+func generateUnsubscribeToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate unsubscribe token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Request/Response types
+
+// MessageTemplates asks for a notification to be written from a template
+// on the channels that have one, instead of its subject and body
+type MessageTemplates struct {
+	SMS   *SMSText
+	Email *EmailContent
+	Push  *PushContent // data for the app, with the subject and body
+}
+
+type PreferenceUpdate struct {
+	Channel string                     `json:"channel" binding:"required"`
+	Purpose models.NotificationPurpose `json:"purpose" binding:"required"`
+	OptedIn bool                       `json:"opted_in"`
+}
+
+type PreferenceView struct {
+	Channel   string                     `json:"channel"`
+	Purpose   models.NotificationPurpose `json:"purpose"`
+	OptedIn   bool                       `json:"opted_in"`
+	IsDefault bool                       `json:"is_default"`
+	UpdatedAt *time.Time                 `json:"updated_at,omitempty"`
+}
@@ -0,0 +1,539 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFormulaInactive          = errors.New("the formula is no longer made")
+	ErrFormulaIngredientUnknown = errors.New("an ingredient is not a product in stock")
+	ErrFormulaIngredientRepeat  = errors.New("each product is listed once in a formula")
+	ErrPreparationNeedsRx       = errors.New("the formula needs a prescription number")
+	ErrPreparationStatus        = errors.New("the preparation is not at a stage this can be done in")
+	ErrPreparationNotReady      = errors.New("the preparation is not completed, or has already been sold")
+	ErrPreparationBeyondUse     = errors.New("the preparation is past its beyond-use date")
+	ErrPreparationCustomer      = errors.New("the preparation was made for another customer")
+	ErrIngredientExpired        = errors.New("an ingredient has expired")
+)
+
+// CompoundingService keeps the pharmacy's compounding formulas and the
+// preparations made from them. A preparation is requested, made, and
+// completed by a pharmacist, which takes its ingredients out of stock and
+// works out its beyond-use date and price. It is then sold as a line of a
+// sale like any product.
+type CompoundingService struct {
+	db      *gorm.DB
+	stock   *StockService
+	numbers *NumberService
+	pricing *PricingService
+}
+
+func NewCompoundingService(db *gorm.DB, stock *StockService, numbers *NumberService, pricing *PricingService) *CompoundingService {
+	return &CompoundingService{
+		db:      db,
+		stock:   stock,
+		numbers: numbers,
+		pricing: pricing,
+	}
+}
+
+// ListFormulas lists the formulas by name, the inactive ones too when
+// includeInactive is set
+func (s *CompoundingService) ListFormulas(ctx context.Context, includeInactive bool) ([]models.CompoundFormula, error) {
+	query := s.db.WithContext(ctx).Preload("Ingredients.Product", WithDeleted).Order("name ASC")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+	var formulas []models.CompoundFormula
+	if err := query.Find(&formulas).Error; err != nil {
+		return nil, fmt.Errorf("failed to load formulas: %w", err)
+	}
+	return formulas, nil
+}
+
+func (s *CompoundingService) GetFormula(ctx context.Context, id uuid.UUID) (*models.CompoundFormula, error) {
+	var formula models.CompoundFormula
+	if err := s.db.WithContext(ctx).Preload("Ingredients.Product", WithDeleted).First(&formula, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("formula: %w", err)
+	}
+	return &formula, nil
+}
+
+// CreateFormula adds a master formula
+func (s *CompoundingService) CreateFormula(ctx context.Context, req FormulaRequest) (*models.CompoundFormula, error) {
+	formula := &models.CompoundFormula{PrescriptionRequired: true, IsActive: true}
+	req.apply(formula)
+	ingredients, err := s.formulaIngredients(ctx, req.Ingredients)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(formula).Error; err != nil {
+			return fmt.Errorf("failed to create formula: %w", err)
+		}
+		for i := range ingredients {
+			ingredients[i].FormulaID = formula.ID
+		}
+		if err := tx.Create(&ingredients).Error; err != nil {
+			return fmt.Errorf("failed to save ingredients: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFormula(ctx, formula.ID)
+}
+
+// UpdateFormula changes a formula and replaces its ingredients. Completed
+// preparations keep the ingredients they were made from.
+func (s *CompoundingService) UpdateFormula(ctx context.Context, id uuid.UUID, req FormulaRequest) (*models.CompoundFormula, error) {
+	formula, err := s.GetFormula(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	req.apply(formula)
+	ingredients, err := s.formulaIngredients(ctx, req.Ingredients)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(formula).Select("code", "name", "dosage_form", "strength", "method", "instructions",
+			"yield_quantity", "yield_unit", "beyond_use_days", "storage_conditions", "labor_fee",
+			"prescription_required", "is_active").Updates(formula).Error; err != nil {
+			return fmt.Errorf("failed to update formula: %w", err)
+		}
+		if err := tx.Where("formula_id = ?", id).Delete(&models.CompoundIngredient{}).Error; err != nil {
+			return fmt.Errorf("failed to replace ingredients: %w", err)
+		}
+		for i := range ingredients {
+			ingredients[i].FormulaID = id
+		}
+		if err := tx.Create(&ingredients).Error; err != nil {
+			return fmt.Errorf("failed to save ingredients: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetFormula(ctx, id)
+}
+
+// RequestPreparation orders a formula made at the branch
+func (s *CompoundingService) RequestPreparation(ctx context.Context, req PreparationRequest, branchID *uuid.UUID, userID uuid.UUID) (*models.CompoundPreparation, error) {
+	formula, err := s.GetFormula(ctx, req.FormulaID)
+	if err != nil {
+		return nil, err
+	}
+	if !formula.IsActive {
+		return nil, ErrFormulaInactive
+	}
+	if req.PrescriptionNumber != nil {
+		trimmed := strings.TrimSpace(*req.PrescriptionNumber)
+		req.PrescriptionNumber = &trimmed
+	}
+	if formula.PrescriptionRequired && (req.PrescriptionNumber == nil || *req.PrescriptionNumber == "") {
+		return nil, ErrPreparationNeedsRx
+	}
+	if req.CustomerID != nil {
+		var customer models.Customer
+		if err := s.db.WithContext(ctx).Select("id").First(&customer, "id = ?", *req.CustomerID).Error; err != nil {
+			return nil, fmt.Errorf("customer: %w", err)
+		}
+	}
+	if req.Batches == 0 {
+		req.Batches = 1
+	}
+
+	preparation := &models.CompoundPreparation{
+		FormulaID:          formula.ID,
+		BranchID:           branchID,
+		CustomerID:         req.CustomerID,
+		PrescriptionNumber: req.PrescriptionNumber,
+		Batches:            req.Batches,
+		Instructions:       req.Instructions,
+		Notes:              req.Notes,
+		Status:             models.PreparationStatusRequested,
+		RequestedBy:        &userID,
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		number, err := s.numbers.PreparationNumber(tx, branchID)
+		if err != nil {
+			return err
+		}
+		preparation.PreparationNumber = number
+		return tx.Create(preparation).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request preparation: %w", err)
+	}
+	return s.GetPreparation(ctx, preparation.ID)
+}
+
+// ListPreparations lists preparations, newest first
+func (s *CompoundingService) ListPreparations(ctx context.Context, filter PreparationFilter) ([]models.CompoundPreparation, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.CompoundPreparation{})
+	if filter.BranchID != nil {
+		query = query.Where("branch_id = ?", *filter.BranchID)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.FormulaID != nil {
+		query = query.Where("formula_id = ?", *filter.FormulaID)
+	}
+	if filter.CustomerID != nil {
+		query = query.Where("customer_id = ?", *filter.CustomerID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	var preparations []models.CompoundPreparation
+	err := query.Preload("Formula").Preload("Customer", WithDeleted).
+		Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&preparations).Error
+	return preparations, total, err
+}
+
+func (s *CompoundingService) GetPreparation(ctx context.Context, id uuid.UUID) (*models.CompoundPreparation, error) {
+	var preparation models.CompoundPreparation
+	if err := s.db.WithContext(ctx).Preload("Formula.Ingredients.Product", WithDeleted).
+		Preload("Customer", WithDeleted).Preload("Ingredients.Product", WithDeleted).
+		First(&preparation, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("preparation: %w", err)
+	}
+	return &preparation, nil
+}
+
+// StartPreparation records that work on a requested preparation has begun
+func (s *CompoundingService) StartPreparation(ctx context.Context, id uuid.UUID) (*models.CompoundPreparation, error) {
+	if err := s.move(ctx, id, []models.PreparationStatus{models.PreparationStatusRequested}, map[string]interface{}{
+		"status": models.PreparationStatusInProgress,
+	}); err != nil {
+		return nil, err
+	}
+	return s.GetPreparation(ctx, id)
+}
+
+// CancelPreparation drops a preparation that hasn't been completed, so
+// hasn't taken any stock
+func (s *CompoundingService) CancelPreparation(ctx context.Context, id, userID uuid.UUID) (*models.CompoundPreparation, error) {
+	now := time.Now().UTC()
+	if err := s.move(ctx, id, []models.PreparationStatus{models.PreparationStatusRequested, models.PreparationStatusInProgress}, map[string]interface{}{
+		"status":       models.PreparationStatusCancelled,
+		"cancelled_by": userID,
+		"cancelled_at": now,
+	}); err != nil {
+		return nil, err
+	}
+	return s.GetPreparation(ctx, id)
+}
+
+// CompletePreparation records a preparation as made by userID. Its
+// ingredients leave the branch's stock, and it gets a beyond-use date, the
+// formula's days from now but no later than the earliest ingredient expiry,
+// and a price. The stock movements are returned to be announced once
+// committed.
+func (s *CompoundingService) CompletePreparation(ctx context.Context, id, userID uuid.UUID) (*models.CompoundPreparation, []*models.StockMovement, error) {
+	preparation, err := s.GetPreparation(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if preparation.Status != models.PreparationStatusRequested && preparation.Status != models.PreparationStatusInProgress {
+		return nil, nil, ErrPreparationStatus
+	}
+	formula := preparation.Formula
+
+	now := time.Now().UTC()
+	beyondUse := now.AddDate(0, 0, formula.BeyondUseDays)
+	var movements []*models.StockMovement
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var ingredientCost, ingredientPrice models.Money
+		for _, ingredient := range formula.Ingredients {
+			var product models.Product
+			if err := tx.First(&product, "id = ?", ingredient.ProductID).Error; err != nil {
+				return fmt.Errorf("ingredient: %w", err)
+			}
+			used := &models.PreparationIngredient{
+				PreparationID: preparation.ID,
+				ProductID:     product.ID,
+				Quantity:      ingredient.Quantity * preparation.Batches,
+				UnitCost:      product.Cost,
+				BatchNumber:   product.BatchNumber,
+			}
+			if !product.ExpiryDate.IsZero() {
+				expiry := product.ExpiryDate.Time
+				if !expiry.After(now) {
+					return fmt.Errorf("%w: %s", ErrIngredientExpired, product.Name)
+				}
+				if expiry.Before(beyondUse) {
+					beyondUse = expiry
+				}
+				used.ExpiryDate = &expiry
+			}
+			price, err := s.pricing.UnitPrice(tx, preparation.BranchID, &product)
+			if err != nil {
+				return err
+			}
+			used.UnitPrice = price
+
+			movement, err := s.stock.Apply(tx, StockChange{
+				ProductID: product.ID,
+				BranchID:  preparation.BranchID,
+				Quantity:  -used.Quantity,
+				Type:      models.MovementTypeOut,
+				Reason:    "Compounding",
+				Reference: &preparation.PreparationNumber,
+				UserID:    &userID,
+			})
+			if err != nil {
+				return fmt.Errorf("%s: %w", product.Name, err)
+			}
+			movements = append(movements, movement)
+			if err := tx.Create(used).Error; err != nil {
+				return fmt.Errorf("failed to record ingredient: %w", err)
+			}
+			ingredientCost += used.UnitCost.Mul(used.Quantity)
+			ingredientPrice += price.Mul(used.Quantity)
+		}
+
+		laborFee := formula.LaborFee.Mul(preparation.Batches)
+		result := tx.Model(&models.CompoundPreparation{}).
+			Where("id = ? AND status IN ?", preparation.ID, []models.PreparationStatus{models.PreparationStatusRequested, models.PreparationStatusInProgress}).
+			Updates(map[string]interface{}{
+				"status":          models.PreparationStatusCompleted,
+				"prepared_by":     userID,
+				"prepared_at":     now,
+				"beyond_use_date": beyondUse,
+				"ingredient_cost": ingredientCost,
+				"labor_fee":       laborFee,
+				"price":           ingredientPrice + laborFee,
+				"updated_at":      now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPreparationStatus
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	preparation, err = s.GetPreparation(ctx, id)
+	return preparation, movements, err
+}
+
+// PrepareSaleItems checks the preparations a sale's lines sell are
+// completed, in date and for the sale's customer, before the sale is
+// priced. Each line sells a whole preparation, labeled with its lot number
+// and beyond-use date.
+func (s *CompoundingService) PrepareSaleItems(ctx context.Context, sale *models.Sale) error {
+	tx := s.db.WithContext(ctx)
+	for i := range sale.SaleItems {
+		item := &sale.SaleItems[i]
+		if item.PreparationID == nil {
+			continue
+		}
+
+		var preparation models.CompoundPreparation
+		if err := tx.Preload("Formula").First(&preparation, "id = ?", *item.PreparationID).Error; err != nil {
+			return fmt.Errorf("preparation: %w", err)
+		}
+		if preparation.Status != models.PreparationStatusCompleted {
+			return fmt.Errorf("%w: %s", ErrPreparationNotReady, preparation.PreparationNumber)
+		}
+		if preparation.BeyondUseDate != nil && !preparation.BeyondUseDate.After(time.Now()) {
+			return fmt.Errorf("%w: %s", ErrPreparationBeyondUse, preparation.PreparationNumber)
+		}
+		if preparation.CustomerID != nil && (sale.CustomerID == nil || *sale.CustomerID != *preparation.CustomerID) {
+			return fmt.Errorf("%w: %s", ErrPreparationCustomer, preparation.PreparationNumber)
+		}
+		if preparation.Formula.PrescriptionRequired && (sale.PrescriptionNumber == nil || *sale.PrescriptionNumber == "") {
+			sale.PrescriptionNumber = preparation.PrescriptionNumber
+		}
+
+		item.Quantity = 1
+		item.BatchNumber = preparation.PreparationNumber
+		item.ExpiryDate = preparation.BeyondUseDate
+		if item.Instructions == nil {
+			item.Instructions = preparation.Instructions
+		}
+		if item.Instructions == nil {
+			item.Instructions = preparation.Formula.Instructions
+		}
+	}
+	return nil
+}
+
+// DispenseForSale marks the preparations a sale's lines sell as sold, in
+// the sale's transaction. A preparation sold meanwhile fails the sale with
+// ErrPreparationNotReady.
+func (s *CompoundingService) DispenseForSale(tx *gorm.DB, sale *models.Sale) error {
+	now := time.Now().UTC()
+	for _, item := range sale.SaleItems {
+		if item.PreparationID == nil {
+			continue
+		}
+		result := tx.Model(&models.CompoundPreparation{}).
+			Where("id = ? AND status = ?", *item.PreparationID, models.PreparationStatusCompleted).
+			Updates(map[string]interface{}{
+				"status":       models.PreparationStatusDispensed,
+				"sale_id":      sale.ID,
+				"dispensed_at": now,
+				"updated_at":   now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPreparationNotReady
+		}
+	}
+	return nil
+}
+
+// IngredientProductIDs returns the products the given preparations were
+// made from, for screening a sale of them
+func (s *CompoundingService) IngredientProductIDs(ctx context.Context, preparationIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(preparationIDs) == 0 {
+		return nil, nil
+	}
+	var productIDs []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&models.PreparationIngredient{}).
+		Where("preparation_id IN ?", preparationIDs).Distinct().
+		Pluck("product_id", &productIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load preparation ingredients: %w", err)
+	}
+	return productIDs, nil
+}
+
+// Private helper methods
+
+// move changes a preparation's status when it is in one of from
+func (s *CompoundingService) move(ctx context.Context, id uuid.UUID, from []models.PreparationStatus, updates map[string]interface{}) error {
+	var preparation models.CompoundPreparation
+	if err := s.db.WithContext(ctx).Select("id").First(&preparation, "id = ?", id).Error; err != nil {
+		return fmt.Errorf("preparation: %w", err)
+	}
+	updates["updated_at"] = time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&models.CompoundPreparation{}).
+		Where("id = ? AND status IN ?", id, from).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrPreparationStatus
+	}
+	return nil
+}
+
+// formulaIngredients checks a formula's ingredients are each a different
+// product
+func (s *CompoundingService) formulaIngredients(ctx context.Context, requested []FormulaIngredientRequest) ([]models.CompoundIngredient, error) {
+	seen := make(map[uuid.UUID]bool, len(requested))
+	ids := make([]uuid.UUID, 0, len(requested))
+	for _, ingredient := range requested {
+		if seen[ingredient.ProductID] {
+			return nil, ErrFormulaIngredientRepeat
+		}
+		seen[ingredient.ProductID] = true
+		ids = append(ids, ingredient.ProductID)
+	}
+
+	var found int64
+	if err := s.db.WithContext(ctx).Model(&models.Product{}).Where("id IN ?", ids).Count(&found).Error; err != nil {
+		return nil, err
+	}
+	if int(found) != len(ids) {
+		return nil, ErrFormulaIngredientUnknown
+	}
+
+	ingredients := make([]models.CompoundIngredient, len(requested))
+	for i, ingredient := range requested {
+		ingredients[i] = models.CompoundIngredient{ProductID: ingredient.ProductID, Quantity: ingredient.Quantity}
+	}
+	return ingredients, nil
+}
+
+// Request/Response types
+
+type FormulaRequest struct {
+	Code                 string                     `json:"code" binding:"required,max=50"`
+	Name                 string                     `json:"name" binding:"required,max=255"`
+	DosageForm           string                     `json:"dosage_form" binding:"required,max=100"`
+	Strength             *string                    `json:"strength" binding:"omitempty,max=100"`
+	Method               string                     `json:"method"`
+	Instructions         *string                    `json:"instructions"`
+	YieldQuantity        int                        `json:"yield_quantity" binding:"required,gt=0"`
+	YieldUnit            string                     `json:"yield_unit" binding:"required,max=50"`
+	BeyondUseDays        int                        `json:"beyond_use_days" binding:"required,gt=0"`
+	StorageConditions    string                     `json:"storage_conditions" binding:"max=255"`
+	LaborFee             models.Money               `json:"labor_fee" binding:"gte=0"`
+	PrescriptionRequired *bool                      `json:"prescription_required"` // defaults to true
+	IsActive             *bool                      `json:"is_active"`
+	Ingredients          []FormulaIngredientRequest `json:"ingredients" binding:"required,min=1,dive"`
+}
+
+type FormulaIngredientRequest struct {
+	ProductID uuid.UUID `json:"product_id" binding:"required"`
+	Quantity  int       `json:"quantity" binding:"required,gt=0"` // stock units per batch
+}
+
+func (r FormulaRequest) apply(formula *models.CompoundFormula) {
+	formula.Code = strings.TrimSpace(r.Code)
+	formula.Name = strings.TrimSpace(r.Name)
+	formula.DosageForm = strings.TrimSpace(r.DosageForm)
+	formula.Strength = r.Strength
+	formula.Method = r.Method
+	formula.Instructions = r.Instructions
+	formula.YieldQuantity = r.YieldQuantity
+	formula.YieldUnit = strings.TrimSpace(r.YieldUnit)
+	formula.BeyondUseDays = r.BeyondUseDays
+	formula.StorageConditions = r.StorageConditions
+	formula.LaborFee = r.LaborFee
+	if r.PrescriptionRequired != nil {
+		formula.PrescriptionRequired = *r.PrescriptionRequired
+	}
+	if r.IsActive != nil {
+		formula.IsActive = *r.IsActive
+	}
+}
+
+type PreparationRequest struct {
+	FormulaID          uuid.UUID  `json:"formula_id" binding:"required"`
+	CustomerID         *uuid.UUID `json:"customer_id"`
+	PrescriptionNumber *string    `json:"prescription_number" binding:"omitempty,max=100"`
+	Batches            int        `json:"batches" binding:"omitempty,min=1,max=100"` // defaults to 1
+	Instructions       *string    `json:"instructions"`                              // defaults to the formula's
+	Notes              string     `json:"notes" binding:"max=1000"`
+}
+
+type PreparationFilter struct {
+	BranchID   *uuid.UUID
+	Status     models.PreparationStatus
+	FormulaID  *uuid.UUID
+	CustomerID *uuid.UUID
+	Limit      int
+	Offset     int
+}
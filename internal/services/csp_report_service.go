@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CSPReportService stores Content-Security-Policy violation reports so a
+// policy can be tightened, or trialled in report-only mode, without guessing
+// what the frontend loads
+type CSPReportService struct {
+	db *gorm.DB
+}
+
+func NewCSPReportService(db *gorm.DB) *CSPReportService {
+	return &CSPReportService{db: db}
+}
+
+// MaxCSPReportsPerRequest caps how many reports one request can record
+const MaxCSPReportsPerRequest = 20
+
+// ParseCSPReports reads a report body in either the legacy report-uri format
+// ({"csp-report": {...}}) or the Reporting API format (an array of reports,
+// of which only csp-violation entries are kept)
+func ParseCSPReports(body []byte) ([]CSPReport, error) {
+	trimmed := strings.TrimSpace(string(body))
+	if strings.HasPrefix(trimmed, "[") {
+		var entries []struct {
+			Type string    `json:"type"`
+			Body CSPReport `json:"body"`
+		}
+		if err := json.Unmarshal(body, &entries); err != nil {
+			return nil, fmt.Errorf("invalid report body: %w", err)
+		}
+		var reports []CSPReport
+		for _, entry := range entries {
+			if entry.Type == "csp-violation" {
+				reports = append(reports, entry.Body)
+			}
+		}
+		return reports, nil
+	}
+
+	var legacy struct {
+		Report *legacyCSPReport `json:"csp-report"`
+	}
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, fmt.Errorf("invalid report body: %w", err)
+	}
+	if legacy.Report == nil {
+		return nil, fmt.Errorf("missing csp-report")
+	}
+	return []CSPReport{legacy.Report.normalize()}, nil
+}
+
+// Record counts each report against its directive, blocked resource and
+// page. Query strings are dropped from URLs so tokens in them aren't stored.
+func (s *CSPReportService) Record(ctx context.Context, reports []CSPReport) error {
+	if len(reports) > MaxCSPReportsPerRequest {
+		reports = reports[:MaxCSPReportsPerRequest]
+	}
+
+	now := time.Now()
+	for _, report := range reports {
+		violation := &models.CSPViolation{
+			Directive:   truncate(cspDirective(report.EffectiveDirective), 100),
+			BlockedURI:  truncate(stripQuery(report.BlockedURL), 500),
+			DocumentURI: truncate(stripQuery(report.DocumentURL), 500),
+			SourceFile:  truncate(stripQuery(report.SourceFile), 500),
+			Disposition: truncate(report.Disposition, 20),
+			Count:       1,
+			FirstSeenAt: now,
+			LastSeenAt:  now,
+		}
+		if violation.Directive == "" {
+			continue
+		}
+
+		onConflict := clause.OnConflict{
+			Columns: []clause.Column{{Name: "directive"}, {Name: "blocked_uri"}, {Name: "document_uri"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"count":        gorm.Expr("csp_violations.count + 1"),
+				"last_seen_at": now,
+				"source_file":  violation.SourceFile,
+				"disposition":  violation.Disposition,
+				"updated_at":   now,
+			}),
+		}
+		if err := s.db.WithContext(ctx).Clauses(onConflict).Create(violation).Error; err != nil {
+			return fmt.Errorf("failed to record CSP report: %w", err)
+		}
+	}
+	return nil
+}
+
+// ListViolations returns aggregated violations, most recently seen first
+func (s *CSPReportService) ListViolations(ctx context.Context, directive string, limit, offset int) ([]models.CSPViolation, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.CSPViolation{})
+	if directive != "" {
+		query = query.Where("directive = ?", directive)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count CSP violations: %w", err)
+	}
+
+	var violations []models.CSPViolation
+	if err := query.Order("last_seen_at DESC").Limit(limit).Offset(offset).Find(&violations).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load CSP violations: %w", err)
+	}
+	return violations, total, nil
+}
+
+// Private helper methods
+
+// cspDirective keeps just the directive name; older browsers send the
+// violated directive with its source list
+func cspDirective(directive string) string {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToLower(fields[0])
+}
+
+// stripQuery drops the query string and fragment from a URL. Keywords such
+// as "inline" or "eval" are returned as is.
+func stripQuery(raw string) string {
+	raw = strings.TrimSpace(raw)
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme == "" {
+		if i := strings.IndexAny(raw, "?#"); i >= 0 {
+			return raw[:i]
+		}
+		return raw
+	}
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	parsed.User = nil
+	return parsed.String()
+}
+
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	return value[:max]
+}
+
+// Request/Response types
+
+// CSPReport is one violation, in the Reporting API's field names
+type CSPReport struct {
+	DocumentURL        string `json:"documentURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	BlockedURL         string `json:"blockedURL"`
+	SourceFile         string `json:"sourceFile"`
+	Disposition        string `json:"disposition"`
+}
+
+// legacyCSPReport is the body browsers POST to a report-uri
+type legacyCSPReport struct {
+	DocumentURI        string `json:"document-uri"`
+	ViolatedDirective  string `json:"violated-directive"`
+	EffectiveDirective string `json:"effective-directive"`
+	BlockedURI         string `json:"blocked-uri"`
+	SourceFile         string `json:"source-file"`
+	Disposition        string `json:"disposition"`
+}
+
+func (r legacyCSPReport) normalize() CSPReport {
+	directive := r.EffectiveDirective
+	if directive == "" {
+		directive = r.ViolatedDirective
+	}
+	return CSPReport{
+		DocumentURL:        r.DocumentURI,
+		EffectiveDirective: directive,
+		BlockedURL:         r.BlockedURI,
+		SourceFile:         r.SourceFile,
+		Disposition:        r.Disposition,
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoExchangeRate = errors.New("no exchange rate is set for the currency")
+	ErrBaseCurrency   = errors.New("the pharmacy's own currency has no exchange rate")
+)
+
+// CurrencyService keeps amounts in the pharmacy's currency and converts
+// them for customers paying in another one at the rates admins set
+type CurrencyService struct {
+	db   *gorm.DB
+	base string
+}
+
+func NewCurrencyService(db *gorm.DB, base string) *CurrencyService {
+	return &CurrencyService{db: db, base: base}
+}
+
+// Base returns the currency prices, totals and reports are kept in
+func (s *CurrencyService) Base() string {
+	return s.base
+}
+
+// Round rounds an amount in the pharmacy's currency to its smallest unit
+func (s *CurrencyService) Round(amount models.Money) models.Money {
+	return models.RoundAmount(amount, s.base)
+}
+
+// Rate returns what one unit of the currency is worth in the pharmacy's
+// currency, read in tx
+func (s *CurrencyService) Rate(tx *gorm.DB, currency string) (float64, error) {
+	if currency == s.base {
+		return 1, nil
+	}
+
+	var rates []float64
+	if err := tx.Model(&models.ExchangeRate{}).
+		Where("currency = ?", currency).
+		Limit(1).Pluck("rate", &rates).Error; err != nil {
+		return 0, fmt.Errorf("failed to load exchange rate: %w", err)
+	}
+	if len(rates) == 0 {
+		return 0, fmt.Errorf("%s: %w", currency, ErrNoExchangeRate)
+	}
+	return rates[0], nil
+}
+
+// ApplyPayment records the sale in the pharmacy's currency and, when the
+// customer is paying in another one, what they owe in it
+func (s *CurrencyService) ApplyPayment(tx *gorm.DB, sale *models.Sale) error {
+	sale.Currency = s.base
+	if sale.PaymentCurrency != nil {
+		currency := strings.ToUpper(*sale.PaymentCurrency)
+		sale.PaymentCurrency = &currency
+	}
+	if sale.PaymentCurrency == nil || *sale.PaymentCurrency == s.base {
+		sale.PaymentCurrency, sale.PaymentAmount, sale.ExchangeRate = nil, nil, nil
+		return nil
+	}
+
+	rate, err := s.Rate(tx, *sale.PaymentCurrency)
+	if err != nil {
+		return err
+	}
+	amount := models.RoundAmount(sale.Total.MulRate(1/rate), *sale.PaymentCurrency)
+	sale.PaymentAmount = &amount
+	sale.ExchangeRate = &rate
+	return nil
+}
+
+// Convert quotes an amount in the pharmacy's currency in another one
+func (s *CurrencyService) Convert(ctx context.Context, amount models.Money, currency string) (*CurrencyQuote, error) {
+	rate, err := s.Rate(s.db.WithContext(ctx), currency)
+	if err != nil {
+		return nil, err
+	}
+	converted := models.RoundAmount(amount.MulRate(1/rate), currency)
+	return &CurrencyQuote{
+		Amount:             s.Round(amount),
+		Currency:           s.base,
+		Formatted:          models.FormatAmount(amount, s.base),
+		ConvertedAmount:    converted,
+		ConvertedCurrency:  currency,
+		ConvertedFormatted: models.FormatAmount(converted, currency),
+		Rate:               rate,
+	}, nil
+}
+
+// ListRates returns the exchange rates by currency
+func (s *CurrencyService) ListRates(ctx context.Context) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	if err := s.db.WithContext(ctx).Order("currency ASC").Find(&rates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	return rates, nil
+}
+
+// SetRate sets what one unit of the currency is worth in the pharmacy's
+// currency
+func (s *CurrencyService) SetRate(ctx context.Context, currency string, rate float64) (*models.ExchangeRate, error) {
+	if currency == s.base {
+		return nil, ErrBaseCurrency
+	}
+
+	onConflict := clause.OnConflict{
+		Columns: []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"rate":       rate,
+			"updated_at": time.Now().UTC(),
+		}),
+	}
+	if err := s.db.WithContext(ctx).Clauses(onConflict).Create(&models.ExchangeRate{Currency: currency, Rate: rate}).Error; err != nil {
+		return nil, fmt.Errorf("failed to set exchange rate: %w", err)
+	}
+
+	// An updated rate keeps the ID it was first set with
+	var exchangeRate models.ExchangeRate
+	if err := s.db.WithContext(ctx).First(&exchangeRate, "currency = ?", currency).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload exchange rate: %w", err)
+	}
+	return &exchangeRate, nil
+}
+
+// DeleteRate stops the currency being accepted and returns the rate it
+// had. Rates are deleted outright so one can be set again.
+func (s *CurrencyService) DeleteRate(ctx context.Context, currency string) (*models.ExchangeRate, error) {
+	var exchangeRate models.ExchangeRate
+	if err := s.db.WithContext(ctx).First(&exchangeRate, "currency = ?", currency).Error; err != nil {
+		return nil, fmt.Errorf("exchange rate: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&exchangeRate).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete exchange rate: %w", err)
+	}
+	return &exchangeRate, nil
+}
+
+// Request/Response types
+
+type ExchangeRateRequest struct {
+	Rate float64 `json:"rate" binding:"required,gt=0"`
+}
+
+// CurrencyQuote is an amount in the pharmacy's currency and what it comes
+// to in another one
+type CurrencyQuote struct {
+	Amount             models.Money `json:"amount"`
+	Currency           string       `json:"currency"`
+	Formatted          string       `json:"formatted"`
+	ConvertedAmount    models.Money `json:"converted_amount"`
+	ConvertedCurrency  string       `json:"converted_currency"`
+	ConvertedFormatted string       `json:"converted_formatted"`
+	Rate               float64      `json:"rate"`
+}
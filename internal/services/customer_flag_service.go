@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CustomerFlagService manages staff notes and flags shown at the counter
+type CustomerFlagService struct {
+	db *gorm.DB
+}
+
+func NewCustomerFlagService(db *gorm.DB) *CustomerFlagService {
+	return &CustomerFlagService{db: db}
+}
+
+// ActiveFlags is a Preload condition that loads a customer's unresolved
+// flags, most severe first, with their author:
+//
+//	db.Preload("Flags", services.ActiveFlags).First(&customer, id)
+func ActiveFlags(db *gorm.DB) *gorm.DB {
+	return db.Preload("Author").
+		Where("resolved_at IS NULL").
+		Order("CASE severity WHEN 'critical' THEN 0 WHEN 'warning' THEN 1 ELSE 2 END, created_at DESC")
+}
+
+// AddFlag attaches a flag to a customer
+func (s *CustomerFlagService) AddFlag(ctx context.Context, customerID uuid.UUID, req CustomerFlagRequest, authorID *uuid.UUID) (*models.CustomerFlag, error) {
+	var customer models.Customer
+	if err := s.db.Select("id").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	flag := &models.CustomerFlag{
+		CustomerID: customerID,
+		Note:       strings.TrimSpace(req.Note),
+		Severity:   req.Severity,
+		AuthorID:   authorID,
+	}
+	if flag.Severity == "" {
+		flag.Severity = models.FlagSeverityInfo
+	}
+	if err := validateFlag(flag); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(flag).Error; err != nil {
+		return nil, fmt.Errorf("failed to add flag: %w", err)
+	}
+	return s.getFlag(customerID, flag.ID)
+}
+
+// GetFlags lists a customer's flags. Resolved flags are included only when
+// asked for.
+func (s *CustomerFlagService) GetFlags(ctx context.Context, customerID uuid.UUID, includeResolved bool) ([]models.CustomerFlag, error) {
+	query := s.db.Preload("Author").Where("customer_id = ?", customerID)
+	if includeResolved {
+		query = query.Order("resolved_at IS NOT NULL, created_at DESC")
+	} else {
+		query = ActiveFlags(query)
+	}
+
+	var flags []models.CustomerFlag
+	if err := query.Find(&flags).Error; err != nil {
+		return nil, fmt.Errorf("failed to load flags: %w", err)
+	}
+	return flags, nil
+}
+
+// UpdateFlag changes a flag's note or severity
+func (s *CustomerFlagService) UpdateFlag(ctx context.Context, customerID, flagID uuid.UUID, req UpdateCustomerFlagRequest, updatedBy *uuid.UUID) (*models.CustomerFlag, error) {
+	flag, err := s.getFlag(customerID, flagID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Note != nil {
+		flag.Note = strings.TrimSpace(*req.Note)
+	}
+	if req.Severity != nil {
+		flag.Severity = *req.Severity
+	}
+	if err := validateFlag(flag); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(flag).Updates(map[string]interface{}{
+		"note":       flag.Note,
+		"severity":   flag.Severity,
+		"updated_by": updatedBy,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update flag: %w", err)
+	}
+	flag.UpdatedBy = updatedBy
+	return flag, nil
+}
+
+// ResolveFlag stops a flag being shown. The flag is kept for history.
+func (s *CustomerFlagService) ResolveFlag(ctx context.Context, customerID, flagID uuid.UUID, resolvedBy *uuid.UUID) (*models.CustomerFlag, error) {
+	flag, err := s.getFlag(customerID, flagID)
+	if err != nil {
+		return nil, err
+	}
+	if flag.ResolvedAt != nil {
+		return nil, fmt.Errorf("flag is already resolved")
+	}
+
+	now := time.Now().UTC()
+	if err := s.db.Model(flag).Updates(map[string]interface{}{
+		"resolved_at": now,
+		"resolved_by": resolvedBy,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve flag: %w", err)
+	}
+	flag.ResolvedAt = &now
+	flag.ResolvedBy = resolvedBy
+	return flag, nil
+}
+
+// Private helper methods
+
+func (s *CustomerFlagService) getFlag(customerID, flagID uuid.UUID) (*models.CustomerFlag, error) {
+	var flag models.CustomerFlag
+	if err := s.db.Preload("Author").
+		Where("id = ? AND customer_id = ?", flagID, customerID).
+		First(&flag).Error; err != nil {
+		return nil, fmt.Errorf("flag not found: %w", err)
+	}
+	return &flag, nil
+}
+
+func validateFlag(flag *models.CustomerFlag) error {
+	if flag.Note == "" {
+		return fmt.Errorf("flag note is required")
+	}
+	if len(flag.Note) > 500 {
+		return fmt.Errorf("flag note is longer than 500 characters")
+	}
+	if !flag.Severity.IsValid() {
+		return fmt.Errorf("invalid severity: %s", flag.Severity)
+	}
+	return nil
+}
+
+// Request types
+
+type CustomerFlagRequest struct {
+	Note     string              `json:"note" binding:"required"`
+	Severity models.FlagSeverity `json:"severity"` // defaults to info
+}
+
+type UpdateCustomerFlagRequest struct {
+	Note     *string              `json:"note"`
+	Severity *models.FlagSeverity `json:"severity"`
+}
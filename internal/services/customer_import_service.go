@@ -0,0 +1,717 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MaxCustomerImportRows caps the number of data rows in one import file
+const MaxCustomerImportRows = 5000
+
+// DuplicateStrategy decides what happens to an imported row that matches an
+// existing customer
+type DuplicateStrategy string
+
+const (
+	DuplicateSkip   DuplicateStrategy = "skip"   // leave the existing customer untouched
+	DuplicateMerge  DuplicateStrategy = "merge"  // fill blanks and add list entries on the existing customer
+	DuplicateCreate DuplicateStrategy = "create" // create a new customer anyway
+)
+
+func (s DuplicateStrategy) IsValid() bool {
+	switch s {
+	case DuplicateSkip, DuplicateMerge, DuplicateCreate:
+		return true
+	}
+	return false
+}
+
+// Import row actions
+const (
+	ImportActionCreate = "create"
+	ImportActionMerge  = "merge"
+	ImportActionSkip   = "skip"
+	ImportActionError  = "error"
+)
+
+// customerImportFields are the customer fields a CSV column can be mapped to
+var customerImportFields = []string{
+	"first_name", "last_name", "email", "phone", "date_of_birth",
+	"address", "city", "state", "zip_code", "country", "preferred_contact",
+	"allergies", "medical_history", "current_medications", "blood_type",
+	"insurance_provider", "insurance_number",
+	"senior_citizen_id", "senior_citizen_id_expiry", "pwd_id", "pwd_id_expiry",
+}
+
+var requiredImportFields = []string{"first_name", "last_name", "phone", "date_of_birth"}
+
+// importDateLayouts are the date formats accepted from legacy exports
+var importDateLayouts = []string{"2006-01-02", "01/02/2006", "1/2/2006", "2006/01/02", "Jan 2, 2006", "January 2, 2006"}
+
+// CustomerImportService imports customers from legacy system CSV exports
+type CustomerImportService struct {
+	db *gorm.DB
+}
+
+func NewCustomerImportService(db *gorm.DB) *CustomerImportService {
+	return &CustomerImportService{db: db}
+}
+
+// Import reads customers from a CSV file. Each row is validated and matched
+// against existing customers by email, then by phone and date of birth. In a
+// dry run nothing is written and the report shows what would happen. Rows are
+// saved independently so one bad row does not stop the rest.
+func (s *CustomerImportService) Import(ctx context.Context, r io.Reader, req CustomerImportRequest) (*CustomerImportReport, error) {
+	if req.Strategy == "" {
+		req.Strategy = DuplicateSkip
+	}
+	if !req.Strategy.IsValid() {
+		return nil, fmt.Errorf("invalid duplicate strategy: %s", req.Strategy)
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+
+	columns, unmapped, err := resolveImportColumns(header, req.Mapping)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CustomerImportReport{
+		DryRun:          req.DryRun,
+		Strategy:        req.Strategy,
+		Columns:         map[string]string{},
+		UnmappedColumns: unmapped,
+		Rows:            []CustomerImportRow{},
+	}
+	for field, index := range columns {
+		report.Columns[field] = header[index]
+	}
+
+	seen := map[string]int{} // email or phone+birth date -> first row in this file
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			report.add(CustomerImportRow{Row: line, Action: ImportActionError, Errors: []string{err.Error()}})
+			continue
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+		if report.TotalRows >= MaxCustomerImportRows {
+			return nil, fmt.Errorf("file has more than %d rows", MaxCustomerImportRows)
+		}
+		report.TotalRows++
+
+		report.add(s.importRow(line, record, columns, seen, req))
+	}
+
+	if !req.DryRun {
+		logrus.WithFields(logrus.Fields{
+			"rows":     report.TotalRows,
+			"created":  report.Created,
+			"merged":   report.Merged,
+			"skipped":  report.Skipped,
+			"failed":   report.Failed,
+			"strategy": req.Strategy,
+		}).Info("Customer import completed")
+	}
+
+	return report, nil
+}
+
+// ImportRecords imports customers given as field -> value records, as sent
+// by integrations, rather than read from a file. Rows are validated and
+// matched like an import file's; they are then written bulkChunkSize to a
+// transaction instead of one at a time. Row numbers in the report are
+// positions in records, from 0.
+func (s *CustomerImportService) ImportRecords(ctx context.Context, records []map[string]string, req CustomerImportRequest) (*CustomerImportReport, error) {
+	if req.Strategy == "" {
+		req.Strategy = DuplicateSkip
+	}
+	if !req.Strategy.IsValid() {
+		return nil, fmt.Errorf("invalid duplicate strategy: %s", req.Strategy)
+	}
+	if len(records) > MaxBulkRows {
+		return nil, fmt.Errorf("%w: at most %d rows", ErrBulkTooLarge, MaxBulkRows)
+	}
+
+	known := map[string]bool{}
+	for _, field := range customerImportFields {
+		known[field] = true
+	}
+
+	report := &CustomerImportReport{
+		DryRun:          req.DryRun,
+		Strategy:        req.Strategy,
+		Columns:         map[string]string{},
+		UnmappedColumns: []string{},
+		TotalRows:       len(records),
+		Rows:            make([]CustomerImportRow, len(records)),
+	}
+	customers := make([]*models.Customer, len(records))
+	seen := map[string]int{}
+	var pending []int
+	for i, record := range records {
+		values := map[string]string{}
+		var unknown []string
+		for field, value := range record {
+			if !known[field] {
+				unknown = append(unknown, field+" is not a customer field")
+				continue
+			}
+			values[field] = strings.TrimSpace(value)
+		}
+		if len(unknown) > 0 {
+			sort.Strings(unknown)
+			report.Rows[i] = CustomerImportRow{Row: i, Action: ImportActionError, Errors: unknown}
+			continue
+		}
+		report.Rows[i], customers[i] = s.prepareRow(i, values, seen, req)
+		if customers[i] != nil {
+			pending = append(pending, i)
+		}
+	}
+
+	if req.DryRun {
+		for _, i := range pending {
+			report.Rows[i] = s.applyRow(s.db.WithContext(ctx), report.Rows[i], customers[i], req)
+		}
+	} else {
+		failed := writeInChunks(ctx, s.db, pending, func(tx *gorm.DB, i int) error {
+			report.Rows[i] = s.applyRow(tx, report.Rows[i], customers[i], req)
+			if report.Rows[i].Action == ImportActionError {
+				return errors.New(strings.Join(report.Rows[i].Errors, "; "))
+			}
+			return nil
+		})
+		for i, err := range failed {
+			if report.Rows[i].Action != ImportActionError {
+				report.Rows[i].Action = ImportActionError
+				report.Rows[i].CustomerID = nil
+				report.Rows[i].Errors = []string{err.Error()}
+			}
+		}
+	}
+
+	rows := report.Rows
+	report.Rows = make([]CustomerImportRow, 0, len(rows))
+	for _, row := range rows {
+		report.add(row)
+	}
+
+	if !req.DryRun {
+		logrus.WithFields(logrus.Fields{
+			"rows":     report.TotalRows,
+			"created":  report.Created,
+			"merged":   report.Merged,
+			"skipped":  report.Skipped,
+			"failed":   report.Failed,
+			"strategy": req.Strategy,
+		}).Info("Customer bulk import completed")
+	}
+
+	return report, nil
+}
+
+// importRow validates, matches and (outside a dry run) saves one row
+func (s *CustomerImportService) importRow(line int, record []string, columns map[string]int, seen map[string]int, req CustomerImportRequest) CustomerImportRow {
+	values := map[string]string{}
+	for field, index := range columns {
+		if index < len(record) {
+			values[field] = strings.TrimSpace(record[index])
+		}
+	}
+
+	result, customer := s.prepareRow(line, values, seen, req)
+	if customer == nil {
+		return result
+	}
+	return s.applyRow(s.db, result, customer, req)
+}
+
+// prepareRow validates a row's values and builds its customer, which is nil
+// when the row has errors. seen catches rows repeated earlier in the same
+// import.
+func (s *CustomerImportService) prepareRow(line int, values map[string]string, seen map[string]int, req CustomerImportRequest) (CustomerImportRow, *models.Customer) {
+	result := CustomerImportRow{Row: line, Name: strings.TrimSpace(values["first_name"] + " " + values["last_name"])}
+
+	customer, errs := buildImportedCustomer(values)
+	if len(errs) > 0 {
+		result.Action = ImportActionError
+		result.Errors = errs
+		return result, nil
+	}
+	customer.CreatedBy = req.ImportedBy
+
+	// Repeated rows in the same file would all look new in a dry run
+	keys := []string{"phone:" + customer.Phone + "|" + customer.DateOfBirth.Format("2006-01-02")}
+	if customer.Email != "" {
+		keys = append(keys, "email:"+strings.ToLower(customer.Email))
+	}
+	for _, key := range keys {
+		if first, ok := seen[key]; ok {
+			result.Action = ImportActionError
+			result.Errors = []string{fmt.Sprintf("duplicate of row %d in this import", first)}
+			return result, nil
+		}
+	}
+	for _, key := range keys {
+		seen[key] = line
+	}
+	return result, customer
+}
+
+// applyRow matches a prepared row against existing customers in db and,
+// outside a dry run, creates or merges it
+func (s *CustomerImportService) applyRow(db *gorm.DB, result CustomerImportRow, customer *models.Customer, req CustomerImportRequest) CustomerImportRow {
+	existing, matchedBy, err := s.findExisting(db, customer)
+	if err != nil {
+		result.Action = ImportActionError
+		result.Errors = []string{err.Error()}
+		return result
+	}
+
+	switch {
+	case existing == nil:
+		result.Action = ImportActionCreate
+	case req.Strategy == DuplicateSkip:
+		result.Action = ImportActionSkip
+	case req.Strategy == DuplicateMerge:
+		result.Action = ImportActionMerge
+	case matchedBy == "email":
+		// Email is unique so a second customer cannot share it
+		result.Action = ImportActionError
+		result.Errors = []string{"email already belongs to an existing customer"}
+	default:
+		result.Action = ImportActionCreate
+	}
+	if existing != nil {
+		result.MatchedBy = matchedBy
+		if result.Action == ImportActionSkip || result.Action == ImportActionMerge {
+			result.CustomerID = &existing.ID
+		}
+	}
+
+	if req.DryRun || result.Action == ImportActionSkip || result.Action == ImportActionError {
+		return result
+	}
+
+	if result.Action == ImportActionMerge {
+		if err := s.merge(db, existing, customer, req.ImportedBy); err != nil {
+			result.Action = ImportActionError
+			result.Errors = []string{err.Error()}
+		}
+		return result
+	}
+
+	// The customer code is unique so each imported customer needs its own
+	customer.ID = uuid.New()
+	customer.QRCode = "CUS-" + customer.ID.String()
+	if err := db.Create(customer).Error; err != nil {
+		result.Action = ImportActionError
+		result.Errors = []string{fmt.Sprintf("failed to create customer: %v", err)}
+		return result
+	}
+	result.CustomerID = &customer.ID
+	return result
+}
+
+// findExisting matches an imported customer by email, then by phone and date
+// of birth. Erased customers are never matched.
+func (s *CustomerImportService) findExisting(db *gorm.DB, customer *models.Customer) (*models.Customer, string, error) {
+	var existing models.Customer
+	if customer.Email != "" {
+		err := db.Where("LOWER(email) = ? AND anonymized_at IS NULL", strings.ToLower(customer.Email)).First(&existing).Error
+		if err == nil {
+			return &existing, "email", nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", fmt.Errorf("failed to match customer: %w", err)
+		}
+	}
+
+	dob := customer.DateOfBirth
+	err := db.Where("phone = ? AND date_of_birth >= ? AND date_of_birth < ? AND anonymized_at IS NULL",
+		customer.Phone, dob, dob.AddDate(0, 0, 1)).First(&existing).Error
+	if err == nil {
+		return &existing, "phone_and_date_of_birth", nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", fmt.Errorf("failed to match customer: %w", err)
+	}
+	return nil, "", nil
+}
+
+// merge fills the existing customer's blank fields from the import and adds
+// new medical list entries. Populated fields are never overwritten. New
+// discount IDs go back to pending verification.
+func (s *CustomerImportService) merge(db *gorm.DB, existing, imported *models.Customer, updatedBy *uuid.UUID) error {
+	previous := *existing
+
+	fill := func(target *string, value string) {
+		if *target == "" {
+			*target = value
+		}
+	}
+	fill(&existing.Email, imported.Email)
+	fill(&existing.Address, imported.Address)
+	fill(&existing.City, imported.City)
+	fill(&existing.State, imported.State)
+	fill(&existing.ZipCode, imported.ZipCode)
+	fill(&existing.Country, imported.Country)
+	fill(&existing.PreferredContact, imported.PreferredContact)
+
+	encrypted := []struct {
+		target *models.EncryptedString
+		value  string
+	}{
+		{&existing.BloodType, imported.BloodType.String()},
+		{&existing.InsuranceProvider, imported.InsuranceProvider.String()},
+		{&existing.InsuranceNumber, imported.InsuranceNumber.String()},
+		{&existing.SeniorCitizenID, imported.SeniorCitizenID.String()},
+		{&existing.PWDId, imported.PWDId.String()},
+	}
+	for _, f := range encrypted {
+		if f.value == "" || f.target.String() != "" {
+			continue
+		}
+		if err := f.target.Set(f.value); err != nil {
+			return fmt.Errorf("failed to encrypt customer data: %w", err)
+		}
+	}
+
+	lists := []struct {
+		target   *models.EncryptedStringArray
+		imported *models.EncryptedStringArray
+	}{
+		{&existing.Allergies, &imported.Allergies},
+		{&existing.MedicalHistory, &imported.MedicalHistory},
+		{&existing.CurrentMedications, &imported.CurrentMedications},
+	}
+	for _, f := range lists {
+		current, err := f.target.Get()
+		if err != nil {
+			return fmt.Errorf("failed to decrypt medical data: %w", err)
+		}
+		additions, _ := f.imported.Get()
+		merged := mergeLists(current, additions)
+		if len(merged) == len(current) {
+			continue
+		}
+		if err := f.target.Set(merged); err != nil {
+			return fmt.Errorf("failed to encrypt medical data: %w", err)
+		}
+	}
+
+	if existing.SeniorCitizenIDExpiry == nil {
+		existing.SeniorCitizenIDExpiry = imported.SeniorCitizenIDExpiry
+	}
+	if existing.PWDIdExpiry == nil {
+		existing.PWDIdExpiry = imported.PWDIdExpiry
+	}
+	existing.IsSeniorCitizen = existing.IsSeniorCitizen || imported.IsSeniorCitizen
+	existing.IsPWD = existing.IsPWD || imported.IsPWD
+	if existing.EligibilityClaimsChanged(&previous) {
+		existing.CopyEligibilityVerification(&models.Customer{})
+		existing.EligibilityStatus = models.EligibilityPending
+	}
+
+	existing.UpdatedBy = updatedBy
+	if err := db.Save(existing).Error; err != nil {
+		return fmt.Errorf("failed to update customer: %w", err)
+	}
+	return nil
+}
+
+// Private helper methods
+
+// resolveImportColumns maps customer fields to CSV column indexes. Explicit
+// mappings (field -> header) win; other headers matching a field name are
+// used as-is.
+func resolveImportColumns(header []string, mapping map[string]string) (map[string]int, []string, error) {
+	byHeader := map[string]int{}
+	for i, h := range header {
+		byHeader[normalizeImportHeader(h)] = i
+	}
+
+	known := map[string]bool{}
+	for _, field := range customerImportFields {
+		known[field] = true
+	}
+
+	columns := map[string]int{}
+	for field, column := range mapping {
+		if !known[field] {
+			return nil, nil, fmt.Errorf("unknown customer field in mapping: %s", field)
+		}
+		index, ok := byHeader[normalizeImportHeader(column)]
+		if !ok {
+			return nil, nil, fmt.Errorf("mapped column %q for %s is not in the file", column, field)
+		}
+		columns[field] = index
+	}
+	for _, field := range customerImportFields {
+		if _, mapped := columns[field]; mapped {
+			continue
+		}
+		if index, ok := byHeader[field]; ok {
+			columns[field] = index
+		}
+	}
+
+	var missing []string
+	for _, field := range requiredImportFields {
+		if _, ok := columns[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("no column mapped for required fields: %s", strings.Join(missing, ", "))
+	}
+
+	used := map[int]bool{}
+	for _, index := range columns {
+		used[index] = true
+	}
+	unmapped := []string{}
+	for i, h := range header {
+		if !used[i] {
+			unmapped = append(unmapped, h)
+		}
+	}
+
+	return columns, unmapped, nil
+}
+
+// buildImportedCustomer validates a row's values and builds the customer,
+// encrypting medical and ID fields
+func buildImportedCustomer(values map[string]string) (*models.Customer, []string) {
+	var errs []string
+	for _, field := range requiredImportFields {
+		if values[field] == "" {
+			errs = append(errs, field+" is required")
+		}
+	}
+
+	customer := &models.Customer{
+		FirstName:        values["first_name"],
+		LastName:         values["last_name"],
+		Email:            strings.ToLower(values["email"]),
+		Phone:            values["phone"],
+		Address:          values["address"],
+		City:             values["city"],
+		State:            values["state"],
+		ZipCode:          values["zip_code"],
+		Country:          values["country"],
+		PreferredContact: strings.ToLower(values["preferred_contact"]),
+	}
+
+	if customer.Email != "" {
+		if _, err := mail.ParseAddress(customer.Email); err != nil {
+			errs = append(errs, "email is not a valid address")
+		}
+	}
+	if len(customer.FirstName) > 100 || len(customer.LastName) > 100 {
+		errs = append(errs, "name is longer than 100 characters")
+	}
+	if len(customer.Phone) > 20 {
+		errs = append(errs, "phone is longer than 20 characters")
+	}
+
+	if values["date_of_birth"] != "" {
+		dob, err := parseImportDate(values["date_of_birth"])
+		if err != nil {
+			errs = append(errs, "date_of_birth: "+err.Error())
+		} else if dob.After(time.Now()) {
+			errs = append(errs, "date_of_birth is in the future")
+		} else {
+			customer.DateOfBirth = dob
+		}
+	}
+
+	for _, expiry := range []struct {
+		field  string
+		target **time.Time
+	}{
+		{"senior_citizen_id_expiry", &customer.SeniorCitizenIDExpiry},
+		{"pwd_id_expiry", &customer.PWDIdExpiry},
+	} {
+		if values[expiry.field] == "" {
+			continue
+		}
+		date, err := parseImportDate(values[expiry.field])
+		if err != nil {
+			errs = append(errs, expiry.field+": "+err.Error())
+			continue
+		}
+		*expiry.target = &date
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	encrypted := []struct {
+		target *models.EncryptedString
+		value  string
+	}{
+		{&customer.BloodType, values["blood_type"]},
+		{&customer.InsuranceProvider, values["insurance_provider"]},
+		{&customer.InsuranceNumber, values["insurance_number"]},
+		{&customer.SeniorCitizenID, values["senior_citizen_id"]},
+		{&customer.PWDId, values["pwd_id"]},
+	}
+	for _, f := range encrypted {
+		if f.value == "" {
+			continue
+		}
+		if err := f.target.Set(f.value); err != nil {
+			return nil, []string{"failed to encrypt customer data"}
+		}
+	}
+	if err := setMedicalData(customer,
+		splitImportList(values["allergies"]),
+		splitImportList(values["medical_history"]),
+		splitImportList(values["current_medications"])); err != nil {
+		return nil, []string{err.Error()}
+	}
+
+	// Imported IDs still need to be checked by staff before discounts apply
+	customer.IsSeniorCitizen = values["senior_citizen_id"] != ""
+	customer.IsPWD = values["pwd_id"] != ""
+	if customer.IsSeniorCitizen || customer.IsPWD {
+		customer.EligibilityStatus = models.EligibilityPending
+	}
+
+	return customer, nil
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognised date %q, use YYYY-MM-DD", value)
+}
+
+// splitImportList splits a list cell on semicolons or pipes. Commas are left
+// alone since they appear inside medication names and conditions.
+func splitImportList(value string) []string {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ';' || r == '|' })
+	items := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			items = append(items, part)
+		}
+	}
+	return items
+}
+
+// mergeLists appends additions not already present, ignoring case
+func mergeLists(current, additions []string) []string {
+	present := map[string]bool{}
+	for _, item := range current {
+		present[strings.ToLower(item)] = true
+	}
+	merged := append([]string{}, current...)
+	for _, item := range additions {
+		if !present[strings.ToLower(item)] {
+			present[strings.ToLower(item)] = true
+			merged = append(merged, item)
+		}
+	}
+	return merged
+}
+
+func normalizeImportHeader(header string) string {
+	header = strings.ToLower(strings.TrimSpace(header))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(header)
+}
+
+func isBlankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Request/Response types
+
+type CustomerImportRequest struct {
+	Mapping    map[string]string // customer field -> CSV column header
+	Strategy   DuplicateStrategy
+	DryRun     bool
+	ImportedBy *uuid.UUID
+}
+
+// CustomerImportReport summarizes an import. In a dry run the counts are
+// what the import would do.
+type CustomerImportReport struct {
+	DryRun          bool                `json:"dry_run"`
+	Strategy        DuplicateStrategy   `json:"strategy"`
+	Columns         map[string]string   `json:"columns"` // customer field -> CSV column used
+	UnmappedColumns []string            `json:"unmapped_columns"`
+	TotalRows       int                 `json:"total_rows"`
+	Created         int                 `json:"created"`
+	Merged          int                 `json:"merged"`
+	Skipped         int                 `json:"skipped"`
+	Failed          int                 `json:"failed"`
+	Rows            []CustomerImportRow `json:"rows"`
+}
+
+func (r *CustomerImportReport) add(row CustomerImportRow) {
+	switch row.Action {
+	case ImportActionCreate:
+		r.Created++
+	case ImportActionMerge:
+		r.Merged++
+	case ImportActionSkip:
+		r.Skipped++
+	case ImportActionError:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, row)
+}
+
+type CustomerImportRow struct {
+	Row        int        `json:"row"` // line number in the file, header is line 1, or position of a bulk record
+	Name       string     `json:"name"`
+	Action     string     `json:"action"`
+	CustomerID *uuid.UUID `json:"customer_id,omitempty"`
+	MatchedBy  string     `json:"matched_by,omitempty"`
+	Errors     []string   `json:"errors,omitempty"`
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrGeocodingDisabled  = errors.New("address lookup is not configured")
+	ErrOutsideServiceArea = errors.New("we don't deliver to this address yet")
+	ErrInvalidZone        = errors.New("a delivery zone needs a center within range and a radius above zero")
+)
+
+// DeliveryService checks delivery addresses against the zones the
+// branches deliver to, and prices delivery by distance. Addresses are
+// placed on the map by the geocoder; without one addresses are taken as
+// given and the fee is left to the order.
+type DeliveryService struct {
+	db         *gorm.DB
+	geocoder   Geocoder
+	currencies *CurrencyService
+}
+
+func NewDeliveryService(db *gorm.DB, geocoder Geocoder, currencies *CurrencyService) *DeliveryService {
+	return &DeliveryService{db: db, geocoder: geocoder, currencies: currencies}
+}
+
+// Enabled reports whether delivery addresses are geocoded
+func (s *DeliveryService) Enabled() bool {
+	return s != nil && s.geocoder != nil
+}
+
+// Quote geocodes a delivery address and prices delivery to it from the
+// nearest zone covering it. Zones of other branches are left out when a
+// branch is given. While no zones are set up every address is in the
+// service area and the quote has no fee.
+func (s *DeliveryService) Quote(ctx context.Context, req DeliveryQuoteRequest) (*DeliveryQuote, error) {
+	if !s.Enabled() {
+		return nil, ErrGeocodingDisabled
+	}
+
+	address := joinAddress(req.Address, req.City, req.Province, req.ZipCode)
+	if address == "" {
+		return nil, ErrAddressNotFound
+	}
+	geocoded, err := s.geocoder.Geocode(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	query := s.db.WithContext(ctx).Where("is_active = ?", true)
+	if req.BranchID != nil {
+		query = query.Where("branch_id = ? OR branch_id IS NULL", *req.BranchID)
+	}
+	var zones []models.DeliveryZone
+	if err := query.Find(&zones).Error; err != nil {
+		return nil, fmt.Errorf("failed to load delivery zones: %w", err)
+	}
+
+	quote := &DeliveryQuote{
+		Suggestion:    *geocoded,
+		InServiceArea: len(zones) == 0,
+		Currency:      s.currencies.Base(),
+	}
+	var nearest *models.DeliveryZone
+	for i, zone := range zones {
+		distance := distanceKM(zone.Latitude, zone.Longitude, geocoded.Latitude, geocoded.Longitude)
+		if distance > zone.RadiusKM || (nearest != nil && distance >= quote.DistanceKM) {
+			continue
+		}
+		nearest = &zones[i]
+		quote.DistanceKM = distance
+	}
+	if nearest != nil {
+		quote.InServiceArea = true
+		quote.ZoneID = &nearest.ID
+		quote.ZoneName = nearest.Name
+		quote.BranchID = nearest.BranchID
+		quote.DeliveryFee = s.currencies.Round(zoneFee(nearest, quote.DistanceKM))
+		quote.DistanceKM = math.Round(quote.DistanceKM*100) / 100
+	}
+	return quote, nil
+}
+
+// ListZones returns delivery zones by name. Inactive ones are left out
+// unless asked for.
+func (s *DeliveryService) ListZones(ctx context.Context, includeInactive bool) ([]models.DeliveryZone, error) {
+	query := s.db.WithContext(ctx).Preload("Branch").Order("name ASC")
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var zones []models.DeliveryZone
+	if err := query.Find(&zones).Error; err != nil {
+		return nil, fmt.Errorf("failed to load delivery zones: %w", err)
+	}
+	return zones, nil
+}
+
+func (s *DeliveryService) CreateZone(ctx context.Context, req DeliveryZoneRequest) (*models.DeliveryZone, error) {
+	zone := &models.DeliveryZone{IsActive: true}
+	if err := s.applyZone(ctx, zone, req); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(zone).Error; err != nil {
+		return nil, fmt.Errorf("failed to create delivery zone: %w", err)
+	}
+	return zone, nil
+}
+
+func (s *DeliveryService) UpdateZone(ctx context.Context, id uuid.UUID, req DeliveryZoneRequest) (*models.DeliveryZone, *models.DeliveryZone, error) {
+	var zone models.DeliveryZone
+	if err := s.db.WithContext(ctx).First(&zone, "id = ?", id).Error; err != nil {
+		return nil, nil, fmt.Errorf("delivery zone: %w", err)
+	}
+	before := zone
+
+	if err := s.applyZone(ctx, &zone, req); err != nil {
+		return nil, nil, err
+	}
+	if err := s.db.WithContext(ctx).Save(&zone).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to update delivery zone: %w", err)
+	}
+	return &before, &zone, nil
+}
+
+func (s *DeliveryService) DeleteZone(ctx context.Context, id uuid.UUID) (*models.DeliveryZone, error) {
+	var zone models.DeliveryZone
+	if err := s.db.WithContext(ctx).First(&zone, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("delivery zone: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Delete(&zone).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete delivery zone: %w", err)
+	}
+	return &zone, nil
+}
+
+// Private helper methods
+
+func (s *DeliveryService) applyZone(ctx context.Context, zone *models.DeliveryZone, req DeliveryZoneRequest) error {
+	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 || req.RadiusKM <= 0 || req.IncludedKM < 0 {
+		return ErrInvalidZone
+	}
+	if req.BranchID != nil {
+		var branch models.Branch
+		if err := s.db.WithContext(ctx).First(&branch, "id = ?", *req.BranchID).Error; err != nil {
+			return fmt.Errorf("branch: %w", err)
+		}
+	}
+
+	zone.Name = req.Name
+	zone.BranchID = req.BranchID
+	zone.Latitude = req.Latitude
+	zone.Longitude = req.Longitude
+	zone.RadiusKM = req.RadiusKM
+	zone.BaseFee = req.BaseFee
+	zone.FeePerKM = req.FeePerKM
+	zone.IncludedKM = req.IncludedKM
+	if req.IsActive != nil {
+		zone.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+// zoneFee is the zone's base fee plus its rate for every kilometre, or part
+// of one, past what the base fee covers
+func zoneFee(zone *models.DeliveryZone, distance float64) models.Money {
+	extra := math.Ceil(distance - zone.IncludedKM)
+	if extra <= 0 {
+		return zone.BaseFee
+	}
+	return zone.BaseFee + zone.FeePerKM.Mul(int(extra))
+}
+
+// distanceKM is the great-circle distance between two points
+func distanceKM(lat1, lon1, lat2, lon2 float64) float64 {
+	const earthRadiusKM = 6371.0
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLon := toRad(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return earthRadiusKM * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func joinAddress(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
+
+// Request/Response types
+
+type DeliveryQuoteRequest struct {
+	Address  string     `json:"delivery_address" validate:"required,max=500"`
+	City     string     `json:"delivery_city" validate:"max=100"`
+	Province string     `json:"delivery_state" validate:"max=100"`
+	ZipCode  string     `json:"delivery_zip_code" validate:"max=20"`
+	BranchID *uuid.UUID `json:"branch_id"`
+}
+
+// DeliveryQuote is where an address was placed and what delivery to it
+// costs. Suggestion is the address as the geocoder knows it, to offer the
+// customer before they check out.
+type DeliveryQuote struct {
+	Suggestion    GeocodedAddress `json:"suggestion"`
+	InServiceArea bool            `json:"in_service_area"`
+	ZoneID        *uuid.UUID      `json:"zone_id,omitempty"`
+	ZoneName      string          `json:"zone_name,omitempty"`
+	BranchID      *uuid.UUID      `json:"branch_id,omitempty"`
+	DistanceKM    float64         `json:"distance_km"`
+	DeliveryFee   models.Money    `json:"delivery_fee"`
+	Currency      string          `json:"currency"`
+}
+
+type DeliveryZoneRequest struct {
+	Name       string       `json:"name" validate:"required,max=100"`
+	BranchID   *uuid.UUID   `json:"branch_id"`
+	Latitude   float64      `json:"latitude"`
+	Longitude  float64      `json:"longitude"`
+	RadiusKM   float64      `json:"radius_km" validate:"gt=0"`
+	BaseFee    models.Money `json:"base_fee" validate:"gte=0"`
+	FeePerKM   models.Money `json:"fee_per_km" validate:"gte=0"`
+	IncludedKM float64      `json:"included_km" validate:"gte=0"`
+	IsActive   *bool        `json:"is_active"`
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package services
+
+import "syscall"
+
+// freeDiskSpace returns the bytes free to unprivileged users on the file
+// system holding path
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package services
+
+import "errors"
+
+// freeDiskSpace isn't available on Windows, where the disk check is skipped
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,554 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrDocumentType    = errors.New("type must be pharmacy_license, prc_license, s2_license, supplier_accreditation or other")
+	ErrDocumentHolder  = errors.New("a pharmacy license needs branch_id, a PRC license user_id, an S2 license branch_id or user_id, and a supplier accreditation supplier_id")
+	ErrDocumentDates   = errors.New("the document cannot expire before it was issued")
+	ErrDocumentRenewed = errors.New("the document has already been renewed")
+)
+
+// DocumentService keeps the pharmacy's licenses and accreditations, with
+// their scanned copies, and reminds staff to renew them before they expire
+type DocumentService struct {
+	db     *gorm.DB
+	files  *FileService
+	outbox *OutboxService
+	config config.DocumentConfig
+}
+
+func NewDocumentService(db *gorm.DB, files *FileService, cfg config.DocumentConfig) *DocumentService {
+	return &DocumentService{db: db, files: files, config: cfg}
+}
+
+// SetOutbox sends renewal reminders to staff as push alerts
+func (s *DocumentService) SetOutbox(outbox *OutboxService) {
+	s.outbox = outbox
+}
+
+// ListDocuments lists documents by expiry, soonest first. Renewed ones are
+// left out unless the filter asks for them.
+func (s *DocumentService) ListDocuments(ctx context.Context, filter DocumentFilter) ([]DocumentView, int64, error) {
+	now := time.Now().UTC()
+	query := s.db.WithContext(ctx).Model(&models.ComplianceDocument{})
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.BranchID != nil {
+		query = query.Where("branch_id = ?", *filter.BranchID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.SupplierID != nil {
+		query = query.Where("supplier_id = ?", *filter.SupplierID)
+	}
+	if !filter.IncludeRenewed && filter.Status != models.DocumentRenewed {
+		query = query.Where("renewed_by_id IS NULL")
+	}
+	soon := now.AddDate(0, 0, s.config.ExpiringDays)
+	switch filter.Status {
+	case models.DocumentExpired:
+		query = query.Where("expires_at <= ?", now)
+	case models.DocumentExpiring:
+		query = query.Where("expires_at > ? AND expires_at < ?", now, soon)
+	case models.DocumentValid:
+		query = query.Where("expires_at IS NULL OR expires_at >= ?", soon)
+	case models.DocumentRenewed:
+		query = query.Where("renewed_by_id IS NOT NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	var documents []models.ComplianceDocument
+	if err := query.Preload("User").Preload("Supplier", WithDeleted).
+		Order("expires_at IS NULL, expires_at ASC, title ASC").
+		Limit(filter.Limit).Offset(filter.Offset).
+		Find(&documents).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load documents: %w", err)
+	}
+	return s.views(documents, now), total, nil
+}
+
+func (s *DocumentService) GetDocument(ctx context.Context, id uuid.UUID) (*DocumentView, error) {
+	var document models.ComplianceDocument
+	if err := s.db.WithContext(ctx).Preload("User").Preload("Supplier", WithDeleted).
+		First(&document, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("document: %w", err)
+	}
+	view := s.view(document, time.Now().UTC())
+	return &view, nil
+}
+
+// CreateDocument files a license or accreditation. Its scanned copy is
+// attached separately.
+func (s *DocumentService) CreateDocument(ctx context.Context, req DocumentRequest, userID uuid.UUID) (*DocumentView, error) {
+	document := &models.ComplianceDocument{CreatedBy: &userID, UpdatedBy: &userID}
+	if err := s.apply(ctx, req, document); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(document).Error; err != nil {
+		return nil, fmt.Errorf("failed to create document: %w", err)
+	}
+	return s.GetDocument(ctx, document.ID)
+}
+
+// UpdateDocument corrects a document's details. A new expiry date starts
+// its renewal reminders over.
+func (s *DocumentService) UpdateDocument(ctx context.Context, id uuid.UUID, req DocumentRequest, userID uuid.UUID) (*DocumentView, error) {
+	var document models.ComplianceDocument
+	if err := s.db.WithContext(ctx).First(&document, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("document: %w", err)
+	}
+	previousExpiry := document.ExpiresAt
+	if err := s.apply(ctx, req, &document); err != nil {
+		return nil, err
+	}
+	document.UpdatedBy = &userID
+	if !sameTime(previousExpiry, document.ExpiresAt) {
+		document.RemindedDays, document.RemindedAt = nil, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&document).Select("type", "title", "number", "issued_by", "issued_at",
+		"expires_at", "notes", "branch_id", "user_id", "supplier_id", "reminded_days", "reminded_at",
+		"updated_by").Updates(&document).Error; err != nil {
+		return nil, fmt.Errorf("failed to update document: %w", err)
+	}
+	return s.GetDocument(ctx, id)
+}
+
+// RenewDocument files the renewal of a document, which is kept as history.
+// The renewal is for the same branch, pharmacist or supplier unless req
+// says otherwise.
+func (s *DocumentService) RenewDocument(ctx context.Context, id uuid.UUID, req DocumentRequest, userID uuid.UUID) (*DocumentView, error) {
+	var previous models.ComplianceDocument
+	if err := s.db.WithContext(ctx).First(&previous, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("document: %w", err)
+	}
+	if previous.RenewedByID != nil {
+		return nil, ErrDocumentRenewed
+	}
+	if req.Type == "" {
+		req.Type = previous.Type
+	}
+	if req.BranchID == nil && req.UserID == nil && req.SupplierID == nil {
+		req.BranchID, req.UserID, req.SupplierID = previous.BranchID, previous.UserID, previous.SupplierID
+	}
+
+	renewal := &models.ComplianceDocument{CreatedBy: &userID, UpdatedBy: &userID}
+	if err := s.apply(ctx, req, renewal); err != nil {
+		return nil, err
+	}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(renewal).Error; err != nil {
+			return fmt.Errorf("failed to create renewal: %w", err)
+		}
+		result := tx.Model(&models.ComplianceDocument{}).
+			Where("id = ? AND renewed_by_id IS NULL", id).
+			Updates(map[string]interface{}{
+				"renewed_by_id": renewal.ID,
+				"updated_by":    userID,
+				"updated_at":    time.Now().UTC(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrDocumentRenewed
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetDocument(ctx, renewal.ID)
+}
+
+// AttachFile stores a document's scanned copy, replacing any it had
+func (s *DocumentService) AttachFile(ctx context.Context, id uuid.UUID, fileName, contentType string, data []byte, userID uuid.UUID) (*DocumentView, error) {
+	var document models.ComplianceDocument
+	if err := s.db.WithContext(ctx).First(&document, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("document: %w", err)
+	}
+
+	key, err := s.files.SaveDocument(ctx, document.ID, fileName, contentType, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store document file: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Model(&document).Updates(map[string]interface{}{
+		"file_key":     key,
+		"file_name":    fileName,
+		"content_type": contentType,
+		"updated_by":   userID,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save document file: %w", err)
+	}
+	// A copy of another type was stored under another key
+	if document.FileKey != "" && document.FileKey != key {
+		if err := s.files.Delete(ctx, document.FileKey); err != nil && !errors.Is(err, ErrFileNotFound) {
+			return nil, fmt.Errorf("failed to remove the previous copy: %w", err)
+		}
+	}
+	return s.GetDocument(ctx, id)
+}
+
+// DeleteDocument removes a document filed by mistake. Its scanned copy is
+// kept in the store with the deleted record.
+func (s *DocumentService) DeleteDocument(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Delete(&models.ComplianceDocument{}, "id = ?", id)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete document: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("document: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// Dashboard sums up the documents on file: the expired and soon expiring
+// ones to act on, counts by type, and the active branches without a
+// pharmacy license and pharmacists without a PRC license on file. With
+// branchID it covers that branch's documents and staff, and every
+// supplier's.
+func (s *DocumentService) Dashboard(ctx context.Context, branchID *uuid.UUID) (*DocumentDashboard, error) {
+	now := time.Now().UTC()
+	query := s.db.WithContext(ctx).Preload("User").Preload("Supplier", WithDeleted).
+		Where("renewed_by_id IS NULL")
+	if branchID != nil {
+		query = query.Where("branch_id = ? OR supplier_id IS NOT NULL OR user_id IN (?)", *branchID,
+			s.db.Model(&models.User{}).Select("id").Where("branch_id = ?", *branchID))
+	}
+	var documents []models.ComplianceDocument
+	if err := query.Order("expires_at IS NULL, expires_at ASC").Find(&documents).Error; err != nil {
+		return nil, fmt.Errorf("failed to load documents: %w", err)
+	}
+
+	dashboard := &DocumentDashboard{
+		ExpiringDays: s.config.ExpiringDays,
+		Expired:      []DocumentView{},
+		Expiring:     []DocumentView{},
+		ByType:       []DocumentTypeCount{},
+		Missing:      []MissingDocument{},
+	}
+	byType := map[models.DocumentType]*DocumentTypeCount{}
+	var types []models.DocumentType
+	licensedBranches := map[uuid.UUID]bool{}
+	licensedPharmacists := map[uuid.UUID]bool{}
+	for _, view := range s.views(documents, now) {
+		count := byType[view.Type]
+		if count == nil {
+			count = &DocumentTypeCount{Type: view.Type}
+			byType[view.Type] = count
+			types = append(types, view.Type)
+		}
+		count.Total++
+		dashboard.Total++
+		switch view.Status {
+		case models.DocumentExpired:
+			count.Expired++
+			dashboard.Expired = append(dashboard.Expired, view)
+		case models.DocumentExpiring:
+			count.Expiring++
+			dashboard.Expiring = append(dashboard.Expiring, view)
+		default:
+			count.Valid++
+		}
+		if view.Status == models.DocumentExpired {
+			continue
+		}
+		if view.Type == models.DocumentPharmacyLicense && view.BranchID != nil {
+			licensedBranches[*view.BranchID] = true
+		}
+		if view.Type == models.DocumentPRCLicense && view.UserID != nil {
+			licensedPharmacists[*view.UserID] = true
+		}
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	for _, docType := range types {
+		dashboard.ByType = append(dashboard.ByType, *byType[docType])
+	}
+
+	branches := s.db.WithContext(ctx).Where("is_active = ?", true).Order("name ASC")
+	if branchID != nil {
+		branches = branches.Where("id = ?", *branchID)
+	}
+	var activeBranches []models.Branch
+	if err := branches.Find(&activeBranches).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branches: %w", err)
+	}
+	for _, branch := range activeBranches {
+		if !licensedBranches[branch.ID] {
+			id := branch.ID
+			dashboard.Missing = append(dashboard.Missing, MissingDocument{
+				Type:     models.DocumentPharmacyLicense,
+				BranchID: &id,
+				Name:     branch.Name,
+			})
+		}
+	}
+
+	pharmacists := s.db.WithContext(ctx).Where("role = ? AND is_active = ?", models.RolePharmacist, true).
+		Order("last_name ASC, first_name ASC")
+	if branchID != nil {
+		pharmacists = pharmacists.Where("branch_id = ?", *branchID)
+	}
+	var activePharmacists []models.User
+	if err := pharmacists.Find(&activePharmacists).Error; err != nil {
+		return nil, fmt.Errorf("failed to load pharmacists: %w", err)
+	}
+	for _, pharmacist := range activePharmacists {
+		if !licensedPharmacists[pharmacist.ID] {
+			id := pharmacist.ID
+			dashboard.Missing = append(dashboard.Missing, MissingDocument{
+				Type:   models.DocumentPRCLicense,
+				UserID: &id,
+				Name:   pharmacist.FirstName + " " + pharmacist.LastName,
+			})
+		}
+	}
+	return dashboard, nil
+}
+
+// SendRenewalReminders alerts staff to the documents coming up on one of
+// the configured days before expiry, and once more when one expires. Each
+// reminder is sent once; it returns how many were.
+func (s *DocumentService) SendRenewalReminders(ctx context.Context) (int, error) {
+	if len(s.config.ReminderDays) == 0 {
+		return 0, nil
+	}
+	now := time.Now().UTC()
+	horizon := now.AddDate(0, 0, s.config.ReminderDays[0])
+
+	var documents []models.ComplianceDocument
+	if err := s.db.WithContext(ctx).Preload("User").Preload("Supplier", WithDeleted).
+		Where("renewed_by_id IS NULL AND expires_at IS NOT NULL AND expires_at <= ?", horizon).
+		Order("expires_at ASC").Find(&documents).Error; err != nil {
+		return 0, fmt.Errorf("failed to load expiring documents: %w", err)
+	}
+
+	sent := 0
+	for _, document := range documents {
+		daysLeft := *document.DaysLeft(now)
+		due := 0 // expired
+		if daysLeft >= 0 {
+			due = -1
+			for _, days := range s.config.ReminderDays {
+				if daysLeft <= days {
+					due = days
+				}
+			}
+		}
+		if due < 0 || (document.RemindedDays != nil && *document.RemindedDays <= due) {
+			continue
+		}
+
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.ComplianceDocument{}).
+				Where("id = ? AND (reminded_days IS NULL OR reminded_days > ?)", document.ID, due).
+				Updates(map[string]interface{}{"reminded_days": due, "reminded_at": now})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			if s.outbox == nil {
+				return nil
+			}
+			return s.outbox.QueueStaffAlert(tx, renewalAlert(document, daysLeft))
+		})
+		if err != nil {
+			return sent, fmt.Errorf("failed to remind about %s: %w", document.Title, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Private helper methods
+
+// apply checks req and copies it onto document
+func (s *DocumentService) apply(ctx context.Context, req DocumentRequest, document *models.ComplianceDocument) error {
+	if !req.Type.IsValid() {
+		return ErrDocumentType
+	}
+	switch req.Type {
+	case models.DocumentPharmacyLicense:
+		if req.BranchID == nil {
+			return ErrDocumentHolder
+		}
+	case models.DocumentPRCLicense:
+		if req.UserID == nil {
+			return ErrDocumentHolder
+		}
+	case models.DocumentS2License:
+		if req.BranchID == nil && req.UserID == nil {
+			return ErrDocumentHolder
+		}
+	case models.DocumentSupplierAccreditation:
+		if req.SupplierID == nil {
+			return ErrDocumentHolder
+		}
+	}
+	if req.IssuedAt != nil && req.ExpiresAt != nil && req.ExpiresAt.Before(*req.IssuedAt) {
+		return ErrDocumentDates
+	}
+
+	tx := s.db.WithContext(ctx)
+	if req.BranchID != nil {
+		if err := tx.Select("id").First(&models.Branch{}, "id = ?", *req.BranchID).Error; err != nil {
+			return fmt.Errorf("branch: %w", err)
+		}
+	}
+	if req.UserID != nil {
+		if err := tx.Select("id").First(&models.User{}, "id = ?", *req.UserID).Error; err != nil {
+			return fmt.Errorf("user: %w", err)
+		}
+	}
+	if req.SupplierID != nil {
+		if err := tx.Select("id").First(&models.Supplier{}, "id = ?", *req.SupplierID).Error; err != nil {
+			return fmt.Errorf("supplier: %w", err)
+		}
+	}
+
+	document.Type = req.Type
+	document.Title = strings.TrimSpace(req.Title)
+	document.Number = strings.TrimSpace(req.Number)
+	document.IssuedBy = strings.TrimSpace(req.IssuedBy)
+	document.IssuedAt = req.IssuedAt
+	document.ExpiresAt = req.ExpiresAt
+	document.Notes = req.Notes
+	document.BranchID = req.BranchID
+	document.UserID = req.UserID
+	document.SupplierID = req.SupplierID
+	return nil
+}
+
+func (s *DocumentService) view(document models.ComplianceDocument, now time.Time) DocumentView {
+	return DocumentView{
+		ComplianceDocument: document,
+		Status:             document.Status(now, s.config.ExpiringDays),
+		DaysLeft:           document.DaysLeft(now),
+		HasFile:            document.FileKey != "",
+	}
+}
+
+func (s *DocumentService) views(documents []models.ComplianceDocument, now time.Time) []DocumentView {
+	views := make([]DocumentView, len(documents))
+	for i, document := range documents {
+		views[i] = s.view(document, now)
+	}
+	return views
+}
+
+// renewalAlert is the staff alert for a document daysLeft days from expiry
+func renewalAlert(document models.ComplianceDocument, daysLeft int) StaffAlertMessage {
+	holder := ""
+	switch {
+	case document.User != nil:
+		holder = " (" + document.User.FirstName + " " + document.User.LastName + ")"
+	case document.Supplier != nil:
+		holder = " (" + document.Supplier.Name + ")"
+	}
+	expiry := document.ExpiresAt.Format("2006-01-02")
+
+	alert := StaffAlertMessage{
+		Alert:    models.StaffAlertDocumentExpiry,
+		BranchID: document.BranchID,
+		Title:    "Renew " + document.Title,
+		Data:     map[string]string{"document_id": document.ID.String()},
+	}
+	switch {
+	case daysLeft < 0:
+		alert.Title = "Expired: " + document.Title
+		alert.Body = fmt.Sprintf("%s%s expired on %s.", document.Title, holder, expiry)
+	case daysLeft == 1:
+		alert.Body = fmt.Sprintf("%s%s expires tomorrow, %s.", document.Title, holder, expiry)
+	default:
+		alert.Body = fmt.Sprintf("%s%s expires in %d days, on %s.", document.Title, holder, daysLeft, expiry)
+	}
+	return alert
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// Request/Response types
+
+type DocumentRequest struct {
+	Type       models.DocumentType `json:"type"` // a renewal defaults to the renewed document's
+	Title      string              `json:"title" binding:"required,max=255"`
+	Number     string              `json:"number" binding:"max=100"`
+	IssuedBy   string              `json:"issued_by" binding:"max=255"`
+	IssuedAt   *time.Time          `json:"issued_at"`
+	ExpiresAt  *time.Time          `json:"expires_at"`
+	Notes      string              `json:"notes" binding:"max=2000"`
+	BranchID   *uuid.UUID          `json:"branch_id"`
+	UserID     *uuid.UUID          `json:"user_id"`
+	SupplierID *uuid.UUID          `json:"supplier_id"`
+}
+
+type DocumentFilter struct {
+	Type           models.DocumentType
+	Status         models.DocumentStatus
+	BranchID       *uuid.UUID
+	UserID         *uuid.UUID
+	SupplierID     *uuid.UUID
+	IncludeRenewed bool
+	Limit          int
+	Offset         int
+}
+
+// DocumentView is a document with where it stands against its expiry
+type DocumentView struct {
+	models.ComplianceDocument
+	Status   models.DocumentStatus `json:"status"`
+	DaysLeft *int                  `json:"days_left,omitempty"` // negative once expired
+	HasFile  bool                  `json:"has_file"`
+}
+
+type DocumentDashboard struct {
+	ExpiringDays int                 `json:"expiring_days"`
+	Total        int                 `json:"total"`
+	Expired      []DocumentView      `json:"expired"`
+	Expiring     []DocumentView      `json:"expiring"`
+	ByType       []DocumentTypeCount `json:"by_type"`
+	Missing      []MissingDocument   `json:"missing"`
+}
+
+type DocumentTypeCount struct {
+	Type     models.DocumentType `json:"type"`
+	Total    int                 `json:"total"`
+	Valid    int                 `json:"valid"`
+	Expiring int                 `json:"expiring"`
+	Expired  int                 `json:"expired"`
+}
+
+// MissingDocument is a branch or pharmacist with no current license on file
+type MissingDocument struct {
+	Type     models.DocumentType `json:"type"`
+	BranchID *uuid.UUID          `json:"branch_id,omitempty"`
+	UserID   *uuid.UUID          `json:"user_id,omitempty"`
+	Name     string              `json:"name"`
+}
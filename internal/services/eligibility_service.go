@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type EligibilityService struct {
+	db *gorm.DB
+}
+
+func NewEligibilityService(db *gorm.DB) *EligibilityService {
+	return &EligibilityService{db: db}
+}
+
+// SubmitID captures the ID number and expiry from an uploaded senior citizen
+// or PWD ID and queues the customer for staff verification. Any previous
+// verification is cleared, so the discount stops applying until the new ID
+// is checked.
+func (s *EligibilityService) SubmitID(ctx context.Context, customer *models.Customer, req SubmitEligibilityIDRequest) error {
+	if req.IDNumber == "" {
+		return fmt.Errorf("ID number is required")
+	}
+	switch req.IDType {
+	case models.DiscountTypeSeniorCitizen:
+		if err := customer.SeniorCitizenID.Set(req.IDNumber); err != nil {
+			return fmt.Errorf("failed to encrypt ID number: %w", err)
+		}
+		customer.IsSeniorCitizen = true
+		customer.SeniorCitizenIDExpiry = req.ExpiryDate
+	case models.DiscountTypePWD:
+		if err := customer.PWDId.Set(req.IDNumber); err != nil {
+			return fmt.Errorf("failed to encrypt ID number: %w", err)
+		}
+		customer.IsPWD = true
+		customer.PWDIdExpiry = req.ExpiryDate
+	default:
+		return fmt.Errorf("invalid ID type: %s", req.IDType)
+	}
+	customer.IDDocumentPath = req.DocumentPath
+	customer.EligibilityStatus = models.EligibilityPending
+	customer.EligibilityVerifiedBy = nil
+	customer.EligibilityVerifiedAt = nil
+	customer.EligibilityNotes = ""
+	customer.UpdatedBy = &req.SubmittedBy
+
+	if err := s.db.Save(customer).Error; err != nil {
+		return fmt.Errorf("failed to update customer: %w", err)
+	}
+	return nil
+}
+
+// Verify records the staff decision on a pending ID. Approving activates the
+// customer's discount; rejecting clears the claimed discount flags.
+func (s *EligibilityService) Verify(ctx context.Context, customerID uuid.UUID, req VerifyEligibilityRequest, userID uuid.UUID) (*models.Customer, error) {
+	var customer models.Customer
+	if err := s.db.First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.EligibilityStatus != models.EligibilityPending {
+		return nil, fmt.Errorf("customer has no ID pending verification")
+	}
+	if customer.IDDocumentPath == "" {
+		return nil, fmt.Errorf("an ID document must be uploaded before verification")
+	}
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"eligibility_verified_by": userID,
+		"eligibility_verified_at": now,
+		"eligibility_notes":       req.Notes,
+		"updated_by":              userID,
+	}
+	if req.Approved {
+		if customer.ClaimedDiscountType(now) == "" {
+			return nil, fmt.Errorf("the submitted ID has expired")
+		}
+		updates["eligibility_status"] = models.EligibilityVerified
+	} else {
+		if req.Notes == "" {
+			return nil, fmt.Errorf("a reason is required when rejecting an ID")
+		}
+		updates["eligibility_status"] = models.EligibilityRejected
+		updates["is_senior_citizen"] = false
+		updates["is_pwd"] = false
+	}
+
+	if err := s.db.Model(&customer).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to record verification: %w", err)
+	}
+	return &customer, nil
+}
+
+// GetPending lists customers whose uploaded ID is awaiting verification,
+// oldest submission first
+func (s *EligibilityService) GetPending(ctx context.Context, limit, offset int) ([]models.Customer, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Customer{}).Where("eligibility_status = ?", models.EligibilityPending)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var customers []models.Customer
+	err := query.Order("updated_at ASC").Limit(limit).Offset(offset).Find(&customers).Error
+	return customers, total, err
+}
+
+// GetExpiring lists verified customers whose senior citizen or PWD ID
+// expires within the given number of days, so staff can ask for a renewed ID
+func (s *EligibilityService) GetExpiring(ctx context.Context, days int) ([]models.Customer, error) {
+	if days <= 0 {
+		days = 30
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, days)
+
+	var customers []models.Customer
+	err := s.db.WithContext(ctx).Where("eligibility_status = ?", models.EligibilityVerified).
+		Where("(is_senior_citizen AND senior_citizen_id_expiry <= ?) OR (is_pwd AND pwd_id_expiry <= ?)", cutoff, cutoff).
+		Order("LEAST(COALESCE(senior_citizen_id_expiry, pwd_id_expiry), COALESCE(pwd_id_expiry, senior_citizen_id_expiry)) ASC").
+		Find(&customers).Error
+	return customers, err
+}
+
+// Request types
+
+type SubmitEligibilityIDRequest struct {
+	IDType       string
+	IDNumber     string
+	ExpiryDate   *time.Time
+	DocumentPath string
+	SubmittedBy  uuid.UUID
+}
+
+type VerifyEligibilityRequest struct {
+	Approved bool   `json:"approved"`
+	Notes    string `json:"notes"`
+}
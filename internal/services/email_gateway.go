@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+)
+
+// ErrEmailRejected is wrapped by send errors for an address that will never
+// accept mail, such as an SMTP 550 for a mailbox that doesn't exist
+var ErrEmailRejected = errors.New("recipient address rejected")
+
+// EmailGateway sends email through a provider
+type EmailGateway interface {
+	Name() string
+	Send(ctx context.Context, email *Email) error
+}
+
+// Email is a message ready to send, with HTML and plain text versions
+type Email struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+
+	// ListUnsubscribe is the unsubscribe URL of mail the recipient can opt
+	// out of, offered by mail clients next to the sender
+	ListUnsubscribe string
+}
+
+// NewEmailGateway builds the gateway named in the configuration, or returns
+// nil when email is not configured
+func NewEmailGateway(cfg config.EmailConfig) EmailGateway {
+	from := mail.Address{Name: cfg.FromName, Address: cfg.From}
+	switch cfg.Provider {
+	case "smtp":
+		return &SMTPGateway{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			TLS:      cfg.SMTPTLS,
+			From:     from,
+			ReplyTo:  cfg.ReplyTo,
+			Timeout:  cfg.Timeout,
+		}
+	case "sendgrid":
+		baseURL := cfg.SendGridAPIURL
+		if baseURL == "" {
+			baseURL = "https://api.sendgrid.com"
+		}
+		return &SendGridGateway{
+			BaseURL: baseURL,
+			APIKey:  cfg.SendGridAPIKey,
+			From:    from,
+			ReplyTo: cfg.ReplyTo,
+			Client:  &http.Client{Timeout: cfg.Timeout},
+		}
+	}
+	return nil
+}
+
+// SMTPGateway sends through an SMTP server, such as the one a mail host or
+// Amazon SES provides
+type SMTPGateway struct {
+	Host     string
+	Port     int
+	Username string // no AUTH when empty
+	Password string
+	TLS      string // starttls, tls or none
+	From     mail.Address
+	ReplyTo  string
+	Timeout  time.Duration
+}
+
+func (g *SMTPGateway) Name() string { return "smtp" }
+
+func (g *SMTPGateway) Send(ctx context.Context, email *Email) error {
+	message, err := buildMIMEMessage(g.From, g.ReplyTo, email)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(g.Host, strconv.Itoa(g.Port))
+	tlsConfig := &tls.Config{ServerName: g.Host, MinVersion: tls.VersionTLS12}
+	dialer := &net.Dialer{Timeout: g.Timeout}
+	var conn net.Conn
+	if g.TLS == "tls" {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(g.Timeout)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, g.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer client.Close()
+
+	if g.TLS == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+		}
+	}
+	if g.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", g.Username, g.Password, g.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(g.From.Address); err != nil {
+		return fmt.Errorf("SMTP server refused the sender: %w", err)
+	}
+	if err := client.Rcpt(email.To); err != nil {
+		var reply *textproto.Error
+		if errors.As(err, &reply) && (reply.Code == 550 || reply.Code == 551 || reply.Code == 553) {
+			return fmt.Errorf("%w: %s", ErrEmailRejected, reply.Msg)
+		}
+		return fmt.Errorf("SMTP server refused the recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server did not accept the email: %w", err)
+	}
+	return client.Quit()
+}
+
+// SendGridGateway sends through SendGrid's v3 Mail Send API. Bounces, spam
+// reports and unsubscribes come back through its signed event webhook.
+type SendGridGateway struct {
+	BaseURL string
+	APIKey  string
+	From    mail.Address
+	ReplyTo string
+	Client  *http.Client
+}
+
+func (g *SendGridGateway) Name() string { return "sendgrid" }
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func (g *SendGridGateway) Send(ctx context.Context, email *Email) error {
+	payload := struct {
+		Personalizations []struct {
+			To []sendGridAddress `json:"to"`
+		} `json:"personalizations"`
+		From    sendGridAddress   `json:"from"`
+		ReplyTo *sendGridAddress  `json:"reply_to,omitempty"`
+		Subject string            `json:"subject"`
+		Content []sendGridContent `json:"content"`
+		Headers map[string]string `json:"headers,omitempty"`
+	}{
+		From:    sendGridAddress{Email: g.From.Address, Name: g.From.Name},
+		Subject: email.Subject,
+		// SendGrid wants the plain text first
+		Content: []sendGridContent{
+			{Type: "text/plain", Value: email.Text},
+			{Type: "text/html", Value: email.HTML},
+		},
+	}
+	payload.Personalizations = make([]struct {
+		To []sendGridAddress `json:"to"`
+	}, 1)
+	payload.Personalizations[0].To = []sendGridAddress{{Email: email.To}}
+	if g.ReplyTo != "" {
+		payload.ReplyTo = &sendGridAddress{Email: g.ReplyTo}
+	}
+	if email.ListUnsubscribe != "" {
+		payload.Headers = map[string]string{"List-Unsubscribe": "<" + email.ListUnsubscribe + ">"}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode SendGrid request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(g.BaseURL, "/")+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build SendGrid request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+g.APIKey)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("SendGrid request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var result struct {
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		if json.Unmarshal(raw, &result) == nil && len(result.Errors) > 0 {
+			return fmt.Errorf("SendGrid returned %d: %s", resp.StatusCode, result.Errors[0].Message)
+		}
+		return fmt.Errorf("SendGrid returned %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(raw)), 512))
+	}
+	return nil
+}
+
+// ValidSendGridSignature checks a signed event webhook request: the
+// X-Twilio-Email-Event-Webhook-Signature header is a base64 ECDSA signature
+// of the X-Twilio-Email-Event-Webhook-Timestamp header followed by the body,
+// made with the key whose base64 public half SendGrid shows in its settings
+func ValidSendGridSignature(publicKey, timestamp string, body []byte, signature string) bool {
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(publicKey))
+	if err != nil {
+		return false
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return false
+	}
+	key, ok := parsed.(*ecdsa.PublicKey)
+	if !ok {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	digest := sha256.Sum256(append([]byte(timestamp), body...))
+	return ecdsa.VerifyASN1(key, digest[:], sig)
+}
+
+// buildMIMEMessage writes an email as a multipart/alternative message with
+// quoted-printable text and HTML parts
+func buildMIMEMessage(from mail.Address, replyTo string, email *Email) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to build email: %w", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build email: %w", err)
+	}
+
+	messageID := make([]byte, 16)
+	if _, err := rand.Read(messageID); err != nil {
+		return nil, fmt.Errorf("failed to generate message ID: %w", err)
+	}
+	domain := from.Address[strings.LastIndex(from.Address, "@")+1:]
+
+	var message bytes.Buffer
+	header := func(name, value string) {
+		message.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", (&mail.Address{Address: email.To}).String())
+	if replyTo != "" {
+		header("Reply-To", (&mail.Address{Address: replyTo}).String())
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+hex.EncodeToString(messageID)+"@"+domain+">")
+	if email.ListUnsubscribe != "" {
+		header("List-Unsubscribe", "<"+email.ListUnsubscribe+">")
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
@@ -0,0 +1,571 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/mail"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailUnavailable      = errors.New("no email provider configured")
+	ErrInvalidEmail          = errors.New("invalid email address")
+	ErrInvalidEmailSignature = errors.New("invalid email event signature")
+	ErrUnknownEmailTemplate  = errors.New("unknown email template")
+)
+
+// Email template names
+const (
+	EmailTemplateNotification      = "notification" // a notification's subject and body
+	EmailTemplateOrderConfirmation = "order_confirmation"
+	EmailTemplateInvoice           = "invoice"
+	EmailTemplatePasswordReset     = "password_reset"
+	EmailTemplateReport            = "report"
+)
+
+//go:embed email_templates
+var emailTemplateFiles embed.FS
+
+// emailTemplate is one email's HTML and plain text versions. The text
+// version also defines the subject.
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var emailTemplates = parseEmailTemplates(
+	EmailTemplateNotification,
+	EmailTemplateOrderConfirmation,
+	EmailTemplateInvoice,
+	EmailTemplatePasswordReset,
+	EmailTemplateReport,
+)
+
+var emailTemplateFuncs = map[string]interface{}{
+	"date":     func(t time.Time) string { return t.Format("January 2, 2006") },
+	"datetime": func(t time.Time) string { return t.Format("January 2, 2006 at 3:04 PM MST") },
+	"join":     strings.Join,
+}
+
+// parseEmailTemplates parses each named template with the shared layout.
+// The files are embedded, so a broken one stops the server at startup.
+func parseEmailTemplates(names ...string) map[string]*emailTemplate {
+	templates := make(map[string]*emailTemplate, len(names))
+	for _, name := range names {
+		templates[name] = &emailTemplate{
+			html: htmltemplate.Must(htmltemplate.New("layout.html").Funcs(emailTemplateFuncs).
+				ParseFS(emailTemplateFiles, "email_templates/layout.html", "email_templates/"+name+".html")),
+			text: texttemplate.Must(texttemplate.New("layout.txt").Funcs(emailTemplateFuncs).
+				ParseFS(emailTemplateFiles, "email_templates/layout.txt", "email_templates/"+name+".txt")),
+		}
+	}
+	return templates
+}
+
+// EmailService writes emails from the built-in templates and sends them
+// through the configured gateway. It keeps the suppression list of
+// addresses that bounced, complained or unsubscribed, and no longer mails
+// them.
+type EmailService struct {
+	db       *gorm.DB
+	gateway  EmailGateway
+	config   config.EmailConfig
+	pharmacy config.PharmacyConfig
+}
+
+func NewEmailService(db *gorm.DB, gateway EmailGateway, cfg config.EmailConfig, pharmacy config.PharmacyConfig) *EmailService {
+	return &EmailService{
+		db:       db,
+		gateway:  gateway,
+		config:   cfg,
+		pharmacy: pharmacy,
+	}
+}
+
+// Enabled reports whether an email provider is configured
+func (s *EmailService) Enabled() bool {
+	return s.gateway != nil
+}
+
+// Send emails a notification, so the service can stand in as the email
+// Notifier, e.g. for security alerts to admins
+func (s *EmailService) Send(ctx context.Context, to, subject, body string) error {
+	return s.SendEmail(ctx, EmailRequest{To: to, Subject: subject, Body: body, Transactional: true})
+}
+
+// SendEmail writes an email from its template and sends it. Suppressed
+// addresses get ErrNotificationSuppressed, and so does an address the mail
+// server rejects outright, which is suppressed from then on.
+func (s *EmailService) SendEmail(ctx context.Context, req EmailRequest) error {
+	if s.gateway == nil {
+		return ErrEmailUnavailable
+	}
+	to, err := normalizeEmail(req.To)
+	if err != nil {
+		return err
+	}
+	suppressed, err := s.Suppressed(ctx, to, req.Transactional)
+	if err != nil {
+		return err
+	}
+	if suppressed {
+		return ErrNotificationSuppressed
+	}
+
+	email, err := s.Compose(ctx, req)
+	if err != nil {
+		return err
+	}
+	email.To = to
+
+	err = s.gateway.Send(ctx, &email.Email)
+	if errors.Is(err, ErrEmailRejected) {
+		if _, suppressErr := s.Suppress(ctx, to, models.SuppressionBounce, s.gateway.Name(), err.Error(), nil); suppressErr != nil {
+			return suppressErr
+		}
+		logrus.WithField("template", email.Template).Warn("Email address rejected by the mail server and suppressed")
+		return fmt.Errorf("%w: %v", ErrNotificationSuppressed, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"provider": s.gateway.Name(),
+		"template": email.Template,
+	}).Info("Email sent")
+	return nil
+}
+
+// Compose writes the email for a request without sending it. Order
+// confirmations and invoices are written from the order or sale as it is
+// now.
+func (s *EmailService) Compose(ctx context.Context, req EmailRequest) (*ComposedEmail, error) {
+	name := req.Template
+	if name == "" {
+		name = EmailTemplateNotification
+	}
+	tmpl, ok := emailTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEmailTemplate, name)
+	}
+	data, err := s.templateData(ctx, name, req)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &emailView{Pharmacy: s.pharmacy, Unsubscribe: req.Unsubscribe, Data: data}
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", view); err != nil {
+		return nil, fmt.Errorf("failed to render %s email subject: %w", name, err)
+	}
+	view.Subject = strings.TrimSpace(subject.String())
+	if err := tmpl.text.Execute(&text, view); err != nil {
+		return nil, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	if err := tmpl.html.Execute(&html, view); err != nil {
+		return nil, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+
+	return &ComposedEmail{
+		Template: name,
+		Email: Email{
+			To:              req.To,
+			Subject:         view.Subject,
+			HTML:            html.String(),
+			Text:            strings.TrimSpace(text.String()) + "\n",
+			ListUnsubscribe: req.Unsubscribe,
+		},
+	}, nil
+}
+
+// Suppressed reports whether an address is on the suppression list for
+// this kind of mail. Transactional mail still goes to addresses that only
+// unsubscribed.
+func (s *EmailService) Suppressed(ctx context.Context, email string, transactional bool) (bool, error) {
+	var suppression models.EmailSuppression
+	err := s.db.WithContext(ctx).Where("email = ?", strings.ToLower(strings.TrimSpace(email))).First(&suppression).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check email suppression list: %w", err)
+	}
+	return !transactional || suppression.Reason.BlocksTransactional(), nil
+}
+
+// Suppress adds an address to the suppression list. An address that is
+// already listed keeps the stronger of its reasons: a bounce is not turned
+// back into an unsubscribe.
+func (s *EmailService) Suppress(ctx context.Context, email string, reason models.EmailSuppressionReason, source, detail string, createdBy *uuid.UUID) (*models.EmailSuppression, error) {
+	email, err := normalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if !reason.IsValid() {
+		return nil, fmt.Errorf("invalid suppression reason: %s", reason)
+	}
+
+	var suppression models.EmailSuppression
+	err = s.db.WithContext(ctx).Where("email = ?", email).First(&suppression).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		suppression = models.EmailSuppression{
+			Email:     email,
+			Reason:    reason,
+			Source:    source,
+			Detail:    truncate(detail, 1000),
+			CreatedBy: createdBy,
+		}
+		err = s.db.WithContext(ctx).Create(&suppression).Error
+	case err != nil:
+	case suppression.Reason.BlocksTransactional() && !reason.BlocksTransactional():
+		return &suppression, nil
+	default:
+		suppression.Reason, suppression.Source, suppression.Detail = reason, source, truncate(detail, 1000)
+		err = s.db.WithContext(ctx).Save(&suppression).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to suppress email address: %w", err)
+	}
+	return &suppression, nil
+}
+
+// ListSuppressions returns suppressed addresses newest first, filtered by
+// reason and an address search
+func (s *EmailService) ListSuppressions(ctx context.Context, reason, search string, limit, offset int) ([]models.EmailSuppression, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.EmailSuppression{})
+	if reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if search != "" {
+		query = query.Where("email LIKE ?", "%"+strings.ToLower(search)+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count email suppressions: %w", err)
+	}
+	var suppressions []models.EmailSuppression
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&suppressions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load email suppressions: %w", err)
+	}
+	return suppressions, total, nil
+}
+
+// RemoveSuppression takes an address off the list, e.g. once a customer
+// has fixed their mailbox, so it is emailed again
+func (s *EmailService) RemoveSuppression(ctx context.Context, id uuid.UUID) (*models.EmailSuppression, error) {
+	var suppression models.EmailSuppression
+	if err := s.db.WithContext(ctx).First(&suppression, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	// Hard deleted so the address can be suppressed again later
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&suppression).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove email suppression: %w", err)
+	}
+	return &suppression, nil
+}
+
+// HandleSendGridEvents applies a batch from SendGrid's signed event
+// webhook: bounces, drops of known bad addresses, spam reports and
+// unsubscribes add the address to the suppression list. It returns how
+// many events changed the list.
+func (s *EmailService) HandleSendGridEvents(ctx context.Context, body []byte, timestamp, signature string) (int, error) {
+	if s.config.SendGridWebhookPublicKey == "" {
+		return 0, ErrEmailUnavailable
+	}
+	if !ValidSendGridSignature(s.config.SendGridWebhookPublicKey, timestamp, body, signature) {
+		return 0, ErrInvalidEmailSignature
+	}
+
+	var events []struct {
+		Email  string `json:"email"`
+		Event  string `json:"event"`
+		Type   string `json:"type"`   // bounce or blocked, for bounces
+		Reason string `json:"reason"` // why it bounced or was dropped
+	}
+	if err := json.Unmarshal(body, &events); err != nil {
+		return 0, fmt.Errorf("invalid SendGrid events: %w", err)
+	}
+
+	applied := 0
+	for _, event := range events {
+		var reason models.EmailSuppressionReason
+		switch event.Event {
+		case "bounce":
+			// Blocks are temporary refusals, e.g. for a full mailbox
+			if event.Type != "blocked" {
+				reason = models.SuppressionBounce
+			}
+		case "dropped":
+			switch {
+			case strings.Contains(event.Reason, "Spam Reporting"):
+				reason = models.SuppressionComplaint
+			case strings.Contains(event.Reason, "Unsubscribed"):
+				reason = models.SuppressionUnsubscribe
+			case strings.Contains(event.Reason, "Bounced"), strings.Contains(event.Reason, "Invalid"):
+				reason = models.SuppressionBounce
+			}
+		case "spamreport":
+			reason = models.SuppressionComplaint
+		case "unsubscribe", "group_unsubscribe":
+			reason = models.SuppressionUnsubscribe
+		case "group_resubscribe":
+			result := s.db.WithContext(ctx).Unscoped().
+				Where("email = ? AND reason = ?", strings.ToLower(strings.TrimSpace(event.Email)), models.SuppressionUnsubscribe).
+				Delete(&models.EmailSuppression{})
+			if result.Error != nil {
+				return applied, fmt.Errorf("failed to remove email suppression: %w", result.Error)
+			}
+			applied += int(result.RowsAffected)
+		}
+		if reason == "" {
+			continue
+		}
+
+		if _, err := s.Suppress(ctx, event.Email, reason, "sendgrid", event.Reason, nil); err != nil {
+			if errors.Is(err, ErrInvalidEmail) {
+				continue
+			}
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Private helper methods
+
+// templateData decodes a request's data for its template, loading the
+// order or sale that order confirmations and invoices refer to
+func (s *EmailService) templateData(ctx context.Context, name string, req EmailRequest) (interface{}, error) {
+	if name == EmailTemplateNotification {
+		return &NotificationEmail{
+			Subject:    req.Subject,
+			Body:       req.Body,
+			Paragraphs: strings.Split(strings.TrimSpace(req.Body), "\n\n"),
+		}, nil
+	}
+
+	raw, err := json.Marshal(req.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s email data: %w", name, err)
+	}
+	switch name {
+	case EmailTemplateOrderConfirmation:
+		var ref EmailOrderRef
+		if err := json.Unmarshal(raw, &ref); err != nil {
+			return nil, fmt.Errorf("invalid %s email data: %w", name, err)
+		}
+		return s.orderConfirmation(ctx, ref.OrderID)
+	case EmailTemplateInvoice:
+		var ref EmailSaleRef
+		if err := json.Unmarshal(raw, &ref); err != nil {
+			return nil, fmt.Errorf("invalid %s email data: %w", name, err)
+		}
+		return s.invoice(ctx, ref.SaleID)
+	case EmailTemplatePasswordReset:
+		var data PasswordResetEmail
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("invalid %s email data: %w", name, err)
+		}
+		return &data, nil
+	case EmailTemplateReport:
+		var data ReportEmail
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, fmt.Errorf("invalid %s email data: %w", name, err)
+		}
+		return &data, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownEmailTemplate, name)
+}
+
+func (s *EmailService) orderConfirmation(ctx context.Context, orderID uuid.UUID) (*OrderConfirmationEmail, error) {
+	var order models.OnlineOrder
+	if err := s.db.WithContext(ctx).Preload("OrderItems.Product", WithDeleted).Preload("Customer", WithDeleted).Preload("Guardian", WithDeleted).
+		First(&order, "id = ?", orderID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load order for email: %w", err)
+	}
+
+	data := &OrderConfirmationEmail{
+		Order:              &order,
+		PrescriptionNeeded: order.Status == models.OrderStatusPrescriptionNeeded,
+	}
+	// Orders for a dependent are confirmed to the guardian who placed them
+	switch {
+	case order.Guardian != nil:
+		data.Name = order.Guardian.FirstName
+	case order.Customer != nil:
+		data.Name = order.Customer.FirstName
+	case order.GuestName != nil:
+		data.Name = *order.GuestName
+	}
+	if data.Name == "" {
+		data.Name = "there"
+	}
+	for _, item := range order.OrderItems {
+		data.Items = append(data.Items, EmailLineItem{
+			Name:      item.Product.Name,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			Total:     item.TotalPrice,
+		})
+	}
+	return data, nil
+}
+
+func (s *EmailService) invoice(ctx context.Context, saleID uuid.UUID) (*InvoiceEmail, error) {
+	var sale models.Sale
+	if err := s.db.WithContext(ctx).Preload("SaleItems.Product", WithDeleted).Preload("SaleItems.Service", WithDeleted).Preload("Customer", WithDeleted).
+		First(&sale, "id = ?", saleID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load sale for email: %w", err)
+	}
+
+	data := &InvoiceEmail{Sale: &sale, Number: sale.SaleNumber, Name: "there"}
+	if sale.InvoiceNumber != nil {
+		data.Number = *sale.InvoiceNumber
+	}
+	if sale.Customer != nil && sale.Customer.FirstName != "" {
+		data.Name = sale.Customer.FirstName
+	}
+	for _, item := range sale.SaleItems {
+		line := EmailLineItem{Quantity: item.Quantity, UnitPrice: item.UnitPrice, Total: item.TotalPrice}
+		switch {
+		case item.Product != nil:
+			line.Name = item.Product.Name
+		case item.Service != nil:
+			line.Name = item.Service.Name
+		}
+		data.Items = append(data.Items, line)
+	}
+	return data, nil
+}
+
+// normalizeEmail checks an address and returns it in lower case
+func normalizeEmail(email string) (string, error) {
+	address, err := mail.ParseAddress(strings.TrimSpace(email))
+	if err != nil || address.Name != "" {
+		return "", ErrInvalidEmail
+	}
+	return strings.ToLower(address.Address), nil
+}
+
+// Request/Response types
+
+// EmailContent asks for a notification's email to be written from one of
+// the email templates instead of its subject and body
+type EmailContent struct {
+	Template string
+	// Data is the template's data, such as a ReportEmail. Order
+	// confirmations and invoices take an EmailOrderRef or EmailSaleRef and
+	// are written from the record when sent.
+	Data interface{}
+}
+
+type EmailRequest struct {
+	To       string
+	Template string      // defaults to the notification template
+	Data     interface{} // see EmailContent
+
+	// Subject and Body are the notification template's content
+	Subject string
+	Body    string
+
+	// Transactional mail, such as order updates, still goes to addresses
+	// that only unsubscribed. Other mail carries its Unsubscribe link.
+	Transactional bool
+	Unsubscribe   string
+}
+
+// ComposedEmail is an email written from a template
+type ComposedEmail struct {
+	Email
+	Template string
+}
+
+type EmailOrderRef struct {
+	OrderID uuid.UUID `json:"order_id"`
+}
+
+type EmailSaleRef struct {
+	SaleID uuid.UUID `json:"sale_id"`
+}
+
+// emailView is what the templates are executed with
+type emailView struct {
+	Pharmacy    config.PharmacyConfig
+	Subject     string
+	Unsubscribe string
+	Data        interface{}
+}
+
+type EmailLineItem struct {
+	Name      string
+	Quantity  int
+	UnitPrice models.Money
+	Total     models.Money
+}
+
+type NotificationEmail struct {
+	Subject    string
+	Body       string
+	Paragraphs []string
+}
+
+type OrderConfirmationEmail struct {
+	Name               string
+	Order              *models.OnlineOrder
+	Items              []EmailLineItem
+	PrescriptionNeeded bool
+}
+
+type InvoiceEmail struct {
+	Name   string
+	Number string // the invoice number, or the sale number without one
+	Sale   *models.Sale
+	Items  []EmailLineItem
+}
+
+type PasswordResetEmail struct {
+	Name      string    `json:"name"`
+	Link      string    `json:"link"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ReportEmail is a report laid out as a table
+type ReportEmail struct {
+	Title   string     `json:"title"`
+	Period  string     `json:"period,omitempty"`
+	Columns []string   `json:"columns"`
+	Rows    [][]string `json:"rows"`
+	Totals  []string   `json:"totals,omitempty"`
+	Note    string     `json:"note,omitempty"`
+}
+
+type EmailSuppressionRequest struct {
+	Email  string                        `json:"email" binding:"required,email"`
+	Reason models.EmailSuppressionReason `json:"reason"` // defaults to manual
+	Detail string                        `json:"detail"`
+}
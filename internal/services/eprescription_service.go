@@ -0,0 +1,455 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/fhir"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var strengthPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(mg|mcg|g|ml|iu|%)`)
+
+type EPrescriptionService struct {
+	db                 *gorm.DB
+	onlineOrderService *OnlineOrderService
+}
+
+func NewEPrescriptionService(db *gorm.DB, onlineOrderService *OnlineOrderService) *EPrescriptionService {
+	return &EPrescriptionService{
+		db:                 db,
+		onlineOrderService: onlineOrderService,
+	}
+}
+
+// ImportBundle maps the MedicationRequests in a FHIR bundle to customers and
+// products and creates one pre-verified order per patient, awaiting
+// dispensing. Requests that cannot be mapped are reported, not imported.
+func (s *EPrescriptionService) ImportBundle(ctx context.Context, bundle *fhir.Bundle, source string, userID *uuid.UUID) (*EPrescriptionImportResult, error) {
+	if bundle.ResourceType != "Bundle" {
+		return nil, fmt.Errorf("expected a Bundle resource, got %q", bundle.ResourceType)
+	}
+
+	patients := make(map[string]fhir.Patient)
+	medications := make(map[string]fhir.Medication)
+	var requests []fhir.MedicationRequest
+
+	for _, entry := range bundle.Entry {
+		switch entry.ResourceType() {
+		case "Patient":
+			var patient fhir.Patient
+			if err := json.Unmarshal(entry.Resource, &patient); err != nil {
+				return nil, fmt.Errorf("invalid Patient resource: %w", err)
+			}
+			for _, key := range resourceKeys(entry.FullURL, "Patient", patient.ID) {
+				patients[key] = patient
+			}
+		case "Medication":
+			var medication fhir.Medication
+			if err := json.Unmarshal(entry.Resource, &medication); err != nil {
+				return nil, fmt.Errorf("invalid Medication resource: %w", err)
+			}
+			for _, key := range resourceKeys(entry.FullURL, "Medication", medication.ID) {
+				medications[key] = medication
+			}
+		case "MedicationRequest":
+			var request fhir.MedicationRequest
+			if err := json.Unmarshal(entry.Resource, &request); err != nil {
+				return nil, fmt.Errorf("invalid MedicationRequest resource: %w", err)
+			}
+			requests = append(requests, request)
+		}
+	}
+
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("bundle contains no MedicationRequest resources")
+	}
+
+	result := &EPrescriptionImportResult{Orders: []models.OnlineOrder{}, Rejected: []EPrescriptionIssue{}}
+
+	// Map each request, grouping the ones that succeed by customer
+	var customerOrder []uuid.UUID
+	byCustomer := make(map[uuid.UUID][]mappedPrescription)
+	for _, request := range requests {
+		mapped, err := s.mapRequest(request, patients, medications, source)
+		if err != nil {
+			result.Rejected = append(result.Rejected, EPrescriptionIssue{RequestID: request.ID, Reason: err.Error()})
+			continue
+		}
+		if mapped == nil {
+			result.Duplicates++
+			continue
+		}
+		if _, ok := byCustomer[mapped.customer.ID]; !ok {
+			customerOrder = append(customerOrder, mapped.customer.ID)
+		}
+		byCustomer[mapped.customer.ID] = append(byCustomer[mapped.customer.ID], *mapped)
+	}
+
+	for _, customerID := range customerOrder {
+		order, err := s.createOrder(ctx, customerID, byCustomer[customerID], source, userID)
+		if err != nil {
+			return nil, err
+		}
+		result.Orders = append(result.Orders, *order)
+		result.Imported += len(byCustomer[customerID])
+	}
+
+	return result, nil
+}
+
+// Private helper methods
+
+type mappedPrescription struct {
+	request    fhir.MedicationRequest
+	externalID string
+	customer   models.Customer
+	product    models.Product
+	medication string
+	quantity   int
+	daysSupply *int
+}
+
+// mapRequest resolves a MedicationRequest to a customer and product. It
+// returns nil without error when the request was already imported.
+func (s *EPrescriptionService) mapRequest(request fhir.MedicationRequest, patients map[string]fhir.Patient, medications map[string]fhir.Medication, source string) (*mappedPrescription, error) {
+	if request.Status != "" && request.Status != "active" {
+		return nil, fmt.Errorf("request status is %q, only active requests are dispensed", request.Status)
+	}
+
+	externalID := request.ID
+	if len(request.Identifier) > 0 && request.Identifier[0].Value != "" {
+		externalID = request.Identifier[0].Value
+	}
+	if externalID == "" {
+		return nil, fmt.Errorf("request has no id or identifier")
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.EPrescription{}).
+		Where("source = ? AND external_id = ?", source, externalID).
+		Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check for duplicates: %w", err)
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	patient, ok := patients[request.Subject.Reference]
+	if !ok {
+		return nil, fmt.Errorf("patient %q is not included in the bundle", request.Subject.Reference)
+	}
+	customer, err := s.matchCustomer(patient)
+	if err != nil {
+		return nil, err
+	}
+
+	var medication string
+	if request.MedicationCodeableConcept != nil {
+		medication = request.MedicationCodeableConcept.Display()
+	} else if request.MedicationReference != nil {
+		if med, ok := medications[request.MedicationReference.Reference]; ok {
+			medication = med.Code.Display()
+		} else {
+			medication = request.MedicationReference.Display
+		}
+	}
+	if medication == "" {
+		return nil, fmt.Errorf("request does not name a medication")
+	}
+
+	product, err := s.matchProduct(medication)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := &mappedPrescription{
+		request:    request,
+		externalID: externalID,
+		customer:   *customer,
+		product:    *product,
+		medication: medication,
+		quantity:   1,
+	}
+	if dispense := request.DispenseRequest; dispense != nil {
+		if dispense.Quantity != nil && dispense.Quantity.Value > 0 {
+			mapped.quantity = int(dispense.Quantity.Value)
+		}
+		if dispense.ExpectedSupplyDuration != nil {
+			if days := dispense.ExpectedSupplyDuration.Days(); days > 0 {
+				mapped.daysSupply = &days
+			}
+		}
+	}
+
+	return mapped, nil
+}
+
+// matchCustomer finds the customer for a patient by email, then phone, then
+// name and date of birth
+func (s *EPrescriptionService) matchCustomer(patient fhir.Patient) (*models.Customer, error) {
+	var customer models.Customer
+
+	if email := patient.ContactValue("email"); email != "" {
+		if err := s.db.Where("LOWER(email) = ?", strings.ToLower(email)).First(&customer).Error; err == nil {
+			return &customer, nil
+		}
+	}
+	if phone := patient.ContactValue("phone"); phone != "" {
+		if err := s.db.Where("phone = ?", phone).First(&customer).Error; err == nil {
+			return &customer, nil
+		}
+	}
+	if len(patient.Name) > 0 && patient.BirthDate != "" {
+		name := patient.Name[0]
+		birthDate, err := time.Parse("2006-01-02", patient.BirthDate)
+		if err == nil && name.Family != "" && len(name.Given) > 0 {
+			if err := s.db.Where("LOWER(first_name) = ? AND LOWER(last_name) = ? AND DATE(date_of_birth) = ?",
+				strings.ToLower(name.Given[0]), strings.ToLower(name.Family), birthDate.Format("2006-01-02")).
+				First(&customer).Error; err == nil {
+				return &customer, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no customer matches patient %q", patient.ID)
+}
+
+// matchProduct finds the product for a medication as written by the prescriber
+func (s *EPrescriptionService) matchProduct(medication string) (*models.Product, error) {
+	name, strength := parseMedication(medication)
+	if name == "" {
+		return nil, fmt.Errorf("cannot read a drug name from %q", medication)
+	}
+	return findProductByMedication(s.db, name, strength)
+}
+
+func (s *EPrescriptionService) createOrder(ctx context.Context, customerID uuid.UUID, prescriptions []mappedPrescription, source string, userID *uuid.UUID) (*models.OnlineOrder, error) {
+	var subtotal models.Money
+	lines := make([]TaxLine, 0, len(prescriptions))
+	for _, p := range prescriptions {
+		subtotal += p.product.Price.Mul(p.quantity)
+		productID := p.product.ID
+		lines = append(lines, TaxLine{ProductID: &productID, Amount: p.product.Price.Mul(p.quantity)})
+	}
+	taxes, err := s.onlineOrderService.taxes.Compute(s.db.WithContext(ctx), nil, &customerID, lines)
+	if err != nil {
+		return nil, err
+	}
+
+	prescriber := ""
+	if requester := prescriptions[0].request.Requester; requester != nil {
+		prescriber = requester.Display
+	}
+
+	order := &models.OnlineOrder{
+		CustomerID:           &customerID,
+		Status:               models.OrderStatusProcessing,
+		OrderType:            models.OrderTypePickup,
+		Subtotal:             subtotal,
+		Tax:                  taxes.VATAmount,
+		TaxBreakdown:         taxes,
+		Currency:             s.onlineOrderService.currencies.Base(),
+		PrescriptionRequired: true,
+		PrescriptionUploaded: true,
+		PrescriptionNotes:    fmt.Sprintf("E-prescription from %s", source),
+		CreatedBy:            userID,
+	}
+	if prescriber != "" {
+		order.PrescriptionNotes += fmt.Sprintf(", prescribed by %s", prescriber)
+	}
+	order.Total = order.Subtotal + order.Tax
+
+	tx := s.db.Begin()
+	if order.OrderNumber, err = s.onlineOrderService.numbers.OrderNumber(tx, nil); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if order.TrackingCode, err = models.NewTrackingCode(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// Made with the order, like a checkout's, as orders can't share a code
+	order.ID = uuid.New()
+	qrCode, err := s.onlineOrderService.qrService.CreateOrderQR(ctx, tx, order, userID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	order.QRCode = qrCode.Code
+	if err := tx.Create(order).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create order: %w", err)
+	}
+
+	for _, p := range prescriptions {
+		var instructions *string
+		var texts []string
+		for _, dosage := range p.request.DosageInstruction {
+			if dosage.Text != "" {
+				texts = append(texts, dosage.Text)
+			}
+		}
+		if len(texts) > 0 {
+			joined := strings.Join(texts, "; ")
+			instructions = &joined
+		}
+
+		var duration *string
+		if p.daysSupply != nil {
+			d := fmt.Sprintf("%d days", *p.daysSupply)
+			duration = &d
+		}
+
+		item := &models.OnlineOrderItem{
+			OrderID:      order.ID,
+			ProductID:    p.product.ID,
+			Quantity:     p.quantity,
+			UnitPrice:    p.product.Price,
+			TotalPrice:   p.product.Price.Mul(p.quantity),
+			Dosage:       p.product.Dosage,
+			Instructions: instructions,
+			Duration:     duration,
+			DaysSupply:   p.daysSupply,
+			Status:       models.ItemStatusPending,
+		}
+		if err := tx.Create(item).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to create order item: %w", err)
+		}
+
+		record := &models.EPrescription{
+			Source:       source,
+			ExternalID:   p.externalID,
+			CustomerID:   customerID,
+			ProductID:    p.product.ID,
+			OrderID:      order.ID,
+			Medication:   p.medication,
+			Quantity:     p.quantity,
+			DaysSupply:   p.daysSupply,
+			Instructions: derefString(instructions),
+		}
+		if p.request.Requester != nil {
+			record.Prescriber = p.request.Requester.Display
+		}
+		if p.request.DispenseRequest != nil {
+			record.Repeats = p.request.DispenseRequest.NumberOfRepeatsAllowed
+		}
+		if authored, err := time.Parse(time.RFC3339, p.request.AuthoredOn); err == nil {
+			record.AuthoredOn = &authored
+		} else if authored, err := time.Parse("2006-01-02", p.request.AuthoredOn); err == nil {
+			record.AuthoredOn = &authored
+		}
+		if err := tx.Create(record).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("failed to record e-prescription: %w", err)
+		}
+	}
+
+	statusHistory := &models.OrderStatusHistory{
+		OrderID:        order.ID,
+		NewStatus:      models.OrderStatusProcessing,
+		Reason:         "E-prescription received from " + source,
+		UpdatedByUser:  userID,
+		IsSystemUpdate: true,
+	}
+	if err := tx.Create(statusHistory).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to create status history: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit e-prescription order: %w", err)
+	}
+
+	if err := s.db.Preload("OrderItems.Product", WithDeleted).Preload("Customer", WithDeleted).
+		First(order, order.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load complete order: %w", err)
+	}
+	return order, nil
+}
+
+// findProductByMedication finds an active product by generic name and, when
+// given, strength. "Amoxicillin 500 mg capsule" matches a product with generic
+// name amoxicillin and dosage 500mg. Products in stock are preferred.
+func findProductByMedication(db *gorm.DB, name, strength string) (*models.Product, error) {
+	var candidates []models.Product
+	if err := db.Where("is_active = ?", true).
+		Where("LOWER(generic_name) = ? OR LOWER(active_ingredient) = ? OR LOWER(name) = ?", name, name, name).
+		Order("stock DESC").
+		Find(&candidates).Error; err != nil {
+		return nil, fmt.Errorf("failed to search products: %w", err)
+	}
+
+	for _, product := range candidates {
+		if strength == "" || (product.Dosage != nil && normalizeStrength(*product.Dosage) == strength) {
+			return &product, nil
+		}
+	}
+
+	if strength != "" {
+		return nil, fmt.Errorf("no product matches %s %s", name, strength)
+	}
+	return nil, fmt.Errorf("no product matches %s", name)
+}
+
+// resourceKeys returns the references a bundle entry can be addressed by
+func resourceKeys(fullURL, resourceType, id string) []string {
+	var keys []string
+	if fullURL != "" {
+		keys = append(keys, fullURL)
+	}
+	if id != "" {
+		keys = append(keys, resourceType+"/"+id)
+	}
+	return keys
+}
+
+// parseMedication splits a medication description into a lowercase drug name
+// and a normalized strength
+func parseMedication(medication string) (string, string) {
+	medication = strings.ToLower(strings.TrimSpace(medication))
+	loc := strengthPattern.FindStringSubmatchIndex(medication)
+	if loc == nil {
+		return medication, ""
+	}
+	name := strings.TrimSpace(medication[:loc[0]])
+	return name, normalizeStrength(medication[loc[0]:loc[1]])
+}
+
+// normalizeStrength turns "500 mg" and "500MG" into "500mg"
+func normalizeStrength(strength string) string {
+	match := strengthPattern.FindStringSubmatch(strength)
+	if match == nil {
+		return strings.ToLower(strings.ReplaceAll(strength, " ", ""))
+	}
+	return match[1] + strings.ToLower(match[2])
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// Request/Response types
+
+type EPrescriptionIssue struct {
+	RequestID string `json:"request_id"`
+	Reason    string `json:"reason"`
+}
+
+type EPrescriptionImportResult struct {
+	Orders     []models.OnlineOrder `json:"orders"`
+	Imported   int                  `json:"imported"`
+	Duplicates int                  `json:"duplicates"`
+	Rejected   []EPrescriptionIssue `json:"rejected"`
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Export formats
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+// exportBatchSize is how many rows an export reads, writes and flushes at a
+// time
+const exportBatchSize = 500
+
+// ExportService streams sales and stock movements over any date range.
+// Rows are read in keyset batches, oldest first, and each batch is written
+// and flushed to the client before the next is read, so memory stays flat
+// however large the range is.
+type ExportService struct {
+	db *gorm.DB
+}
+
+func NewExportService(db *gorm.DB) *ExportService {
+	return &ExportService{db: db}
+}
+
+// ValidExportFormat reports whether format is one exports can be written in
+func ValidExportFormat(format string) bool {
+	return format == ExportCSV || format == ExportNDJSON
+}
+
+// ExportSales writes the sales matching filter to w, one row per sale. NDJSON
+// rows carry the sale's items as well.
+func (s *ExportService) ExportSales(ctx context.Context, w io.Writer, filter ExportFilter, format string) error {
+	encoder, err := newExportEncoder(w, format, saleExportHeader)
+	if err != nil {
+		return err
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.Sale{}).
+		Preload("SaleItems").
+		Preload("SaleItems.Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped().Select("id", "name", "sku") }).
+		Preload("SaleItems.Service", func(db *gorm.DB) *gorm.DB { return db.Unscoped().Select("id", "name") })
+	query = filter.apply(query, "sales")
+	if filter.Status != "" {
+		query = query.Where("sales.status = ?", filter.Status)
+	}
+
+	return eachExportBatch(ctx, query, "sales", encoder, func(batch *gorm.DB) ([]exportRow, error) {
+		var sales []models.Sale
+		if err := batch.Find(&sales).Error; err != nil {
+			return nil, fmt.Errorf("failed to read sales: %w", err)
+		}
+		rows := make([]exportRow, len(sales))
+		for i := range sales {
+			rows[i] = newSaleExportRow(&sales[i])
+		}
+		return rows, nil
+	})
+}
+
+// ExportStockMovements writes the stock movements matching filter to w
+func (s *ExportService) ExportStockMovements(ctx context.Context, w io.Writer, filter ExportFilter, format string) error {
+	encoder, err := newExportEncoder(w, format, stockMovementExportHeader)
+	if err != nil {
+		return err
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.StockMovement{}).
+		Preload("Product", func(db *gorm.DB) *gorm.DB { return db.Unscoped().Select("id", "name", "sku") })
+	query = filter.apply(query, "stock_movements")
+	if filter.ProductID != nil {
+		query = query.Where("stock_movements.product_id = ?", *filter.ProductID)
+	}
+	if filter.MovementType != "" {
+		query = query.Where("stock_movements.type = ?", filter.MovementType)
+	}
+
+	return eachExportBatch(ctx, query, "stock_movements", encoder, func(batch *gorm.DB) ([]exportRow, error) {
+		var movements []models.StockMovement
+		if err := batch.Find(&movements).Error; err != nil {
+			return nil, fmt.Errorf("failed to read stock movements: %w", err)
+		}
+		rows := make([]exportRow, len(movements))
+		for i := range movements {
+			rows[i] = newStockMovementExportRow(&movements[i])
+		}
+		return rows, nil
+	})
+}
+
+// Private helper methods
+
+// exportRow is one row of an export, encoded as a JSON line or a CSV record
+type exportRow interface {
+	position() (time.Time, uuid.UUID)
+	record() []string
+}
+
+// exportEncoder writes rows in an export format and pushes them out to the
+// client on flush
+type exportEncoder struct {
+	w    io.Writer
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newExportEncoder(w io.Writer, format string, header []string) (*exportEncoder, error) {
+	encoder := &exportEncoder{w: w}
+	switch format {
+	case ExportCSV:
+		encoder.csv = csv.NewWriter(w)
+		if err := encoder.csv.Write(header); err != nil {
+			return nil, err
+		}
+	case ExportNDJSON:
+		encoder.json = json.NewEncoder(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+	return encoder, nil
+}
+
+func (e *exportEncoder) encode(row exportRow) error {
+	if e.csv != nil {
+		return e.csv.Write(row.record())
+	}
+	return e.json.Encode(row)
+}
+
+// flush writes out buffered rows and, when w is a response, sends them
+func (e *exportEncoder) flush() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+	if flusher, ok := e.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// eachExportBatch encodes the rows of query, oldest first by the created_at
+// and id of table, reading exportBatchSize at a time with load. Each batch
+// starts after the last row of the one before, so it costs the same however
+// deep into the range it is.
+func eachExportBatch(ctx context.Context, query *gorm.DB, table string, encoder *exportEncoder, load func(*gorm.DB) ([]exportRow, error)) error {
+	var lastCreatedAt time.Time
+	var lastID uuid.UUID
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch := query.Session(&gorm.Session{})
+		if lastID != uuid.Nil {
+			batch = batch.Where(fmt.Sprintf("%s.created_at > ? OR (%s.created_at = ? AND %s.id > ?)", table, table, table),
+				lastCreatedAt, lastCreatedAt, lastID)
+		}
+		rows, err := load(batch.Order(fmt.Sprintf("%s.created_at ASC, %s.id ASC", table, table)).Limit(exportBatchSize))
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := encoder.encode(row); err != nil {
+				return err
+			}
+		}
+		if err := encoder.flush(); err != nil {
+			return err
+		}
+		if len(rows) < exportBatchSize {
+			return nil
+		}
+		lastCreatedAt, lastID = rows[len(rows)-1].position()
+	}
+}
+
+func (f ExportFilter) apply(query *gorm.DB, table string) *gorm.DB {
+	if f.From != nil {
+		query = query.Where(table+".created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where(table+".created_at < ?", *f.To)
+	}
+	if f.BranchID != nil {
+		query = query.Where(table+".branch_id = ?", *f.BranchID)
+	}
+	return query
+}
+
+var saleExportHeader = []string{
+	"created_at", "id", "sale_number", "invoice_number", "branch_id", "terminal_id",
+	"customer_id", "pharmacist_id", "cashier_id", "status", "payment_method", "payment_status",
+	"currency", "subtotal", "discount", "tax", "total", "items", "refunded_at",
+}
+
+func newSaleExportRow(sale *models.Sale) *SaleExportRow {
+	row := &SaleExportRow{
+		ID:            sale.ID,
+		CreatedAt:     sale.CreatedAt,
+		SaleNumber:    sale.SaleNumber,
+		InvoiceNumber: sale.InvoiceNumber,
+		BranchID:      sale.BranchID,
+		TerminalID:    sale.TerminalID,
+		CustomerID:    sale.CustomerID,
+		PharmacistID:  sale.PharmacistID,
+		CashierID:     sale.CashierID,
+		Status:        sale.Status,
+		PaymentMethod: sale.PaymentMethod,
+		PaymentStatus: sale.PaymentStatus,
+		Currency:      sale.Currency,
+		Subtotal:      sale.Subtotal,
+		Discount:      sale.Discount,
+		Tax:           sale.Tax,
+		Total:         sale.Total,
+		RefundedAt:    sale.RefundedAt,
+		Items:         make([]SaleExportItem, len(sale.SaleItems)),
+	}
+	for i, item := range sale.SaleItems {
+		exported := SaleExportItem{
+			ItemType:    item.ItemType,
+			ProductID:   item.ProductID,
+			ServiceID:   item.ServiceID,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			Discount:    item.Discount,
+			TotalPrice:  item.TotalPrice,
+			BatchNumber: item.BatchNumber,
+		}
+		switch {
+		case item.Product != nil:
+			exported.Name, exported.SKU = item.Product.Name, item.Product.SKU
+		case item.Service != nil:
+			exported.Name = item.Service.Name
+		}
+		row.Items[i] = exported
+	}
+	return row
+}
+
+func (r *SaleExportRow) position() (time.Time, uuid.UUID) {
+	return r.CreatedAt, r.ID
+}
+
+func (r *SaleExportRow) record() []string {
+	return []string{
+		r.CreatedAt.UTC().Format(time.RFC3339Nano),
+		r.ID.String(),
+		r.SaleNumber,
+		optionalString(r.InvoiceNumber),
+		optionalUUID(r.BranchID),
+		optionalUUID(r.TerminalID),
+		optionalUUID(r.CustomerID),
+		optionalUUID(r.PharmacistID),
+		optionalUUID(r.CashierID),
+		r.Status,
+		string(r.PaymentMethod),
+		string(r.PaymentStatus),
+		r.Currency,
+		r.Subtotal.String(),
+		r.Discount.String(),
+		r.Tax.String(),
+		r.Total.String(),
+		strconv.Itoa(len(r.Items)),
+		optionalTime(r.RefundedAt),
+	}
+}
+
+var stockMovementExportHeader = []string{
+	"created_at", "id", "product_id", "sku", "product", "branch_id", "type", "quantity",
+	"stock_before", "stock_after", "reason", "reference", "batch_number", "user_id", "notes",
+}
+
+func newStockMovementExportRow(movement *models.StockMovement) *StockMovementExportRow {
+	return &StockMovementExportRow{
+		ID:          movement.ID,
+		CreatedAt:   movement.CreatedAt,
+		ProductID:   movement.ProductID,
+		SKU:         movement.Product.SKU,
+		Product:     movement.Product.Name,
+		BranchID:    movement.BranchID,
+		Type:        movement.Type,
+		Quantity:    movement.Quantity,
+		StockBefore: movement.StockBefore,
+		StockAfter:  movement.StockAfter,
+		Reason:      movement.Reason,
+		Reference:   movement.Reference,
+		BatchNumber: movement.BatchNumber,
+		UserID:      movement.UserID,
+		Notes:       movement.Notes,
+	}
+}
+
+func (r *StockMovementExportRow) position() (time.Time, uuid.UUID) {
+	return r.CreatedAt, r.ID
+}
+
+func (r *StockMovementExportRow) record() []string {
+	return []string{
+		r.CreatedAt.UTC().Format(time.RFC3339Nano),
+		r.ID.String(),
+		r.ProductID.String(),
+		r.SKU,
+		r.Product,
+		optionalUUID(r.BranchID),
+		string(r.Type),
+		strconv.Itoa(r.Quantity),
+		strconv.Itoa(r.StockBefore),
+		strconv.Itoa(r.StockAfter),
+		r.Reason,
+		optionalString(r.Reference),
+		r.BatchNumber,
+		optionalUUID(r.UserID),
+		r.Notes,
+	}
+}
+
+// Request/Response types
+
+// ExportFilter narrows an export. To is exclusive. Status applies to sales,
+// ProductID and MovementType to stock movements.
+type ExportFilter struct {
+	From         *time.Time
+	To           *time.Time
+	BranchID     *uuid.UUID
+	Status       string
+	ProductID    *uuid.UUID
+	MovementType models.MovementType
+}
+
+// SaleExportRow is a sale as exported
+type SaleExportRow struct {
+	ID            uuid.UUID            `json:"id"`
+	CreatedAt     time.Time            `json:"created_at"`
+	SaleNumber    string               `json:"sale_number"`
+	InvoiceNumber *string              `json:"invoice_number,omitempty"`
+	BranchID      *uuid.UUID           `json:"branch_id,omitempty"`
+	TerminalID    *uuid.UUID           `json:"terminal_id,omitempty"`
+	CustomerID    *uuid.UUID           `json:"customer_id,omitempty"`
+	PharmacistID  *uuid.UUID           `json:"pharmacist_id,omitempty"`
+	CashierID     *uuid.UUID           `json:"cashier_id,omitempty"`
+	Status        string               `json:"status"`
+	PaymentMethod models.PaymentMethod `json:"payment_method"`
+	PaymentStatus models.PaymentStatus `json:"payment_status"`
+	Currency      string               `json:"currency"`
+	Subtotal      models.Money         `json:"subtotal"`
+	Discount      models.Money         `json:"discount"`
+	Tax           models.Money         `json:"tax"`
+	Total         models.Money         `json:"total"`
+	RefundedAt    *time.Time           `json:"refunded_at,omitempty"`
+	Items         []SaleExportItem     `json:"items"`
+}
+
+type SaleExportItem struct {
+	ItemType    string       `json:"item_type"`
+	ProductID   *uuid.UUID   `json:"product_id,omitempty"`
+	ServiceID   *uuid.UUID   `json:"service_id,omitempty"`
+	SKU         string       `json:"sku,omitempty"`
+	Name        string       `json:"name"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   models.Money `json:"unit_price"`
+	Discount    models.Money `json:"discount"`
+	TotalPrice  models.Money `json:"total_price"`
+	BatchNumber string       `json:"batch_number,omitempty"`
+}
+
+// StockMovementExportRow is a stock movement as exported
+type StockMovementExportRow struct {
+	ID          uuid.UUID           `json:"id"`
+	CreatedAt   time.Time           `json:"created_at"`
+	ProductID   uuid.UUID           `json:"product_id"`
+	SKU         string              `json:"sku"`
+	Product     string              `json:"product"`
+	BranchID    *uuid.UUID          `json:"branch_id,omitempty"`
+	Type        models.MovementType `json:"type"`
+	Quantity    int                 `json:"quantity"`
+	StockBefore int                 `json:"stock_before"`
+	StockAfter  int                 `json:"stock_after"`
+	Reason      string              `json:"reason"`
+	Reference   *string             `json:"reference,omitempty"`
+	BatchNumber string              `json:"batch_number,omitempty"`
+	UserID      *uuid.UUID          `json:"user_id,omitempty"`
+	Notes       string              `json:"notes,omitempty"`
+}
@@ -0,0 +1,588 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFeedbackNotFound    = errors.New("feedback link not found")
+	ErrFeedbackExpired     = errors.New("feedback link has expired")
+	ErrFeedbackSubmitted   = errors.New("feedback has already been given for this order")
+	ErrFeedbackNotDue      = errors.New("feedback is asked for once the order is delivered or picked up")
+	ErrFeedbackNotAnswered = errors.New("the customer has not given feedback yet")
+	ErrFeedbackModeration  = errors.New("feedback can only be published or hidden")
+)
+
+// FeedbackService asks customers to rate their online orders, takes their
+// responses through the feedback link and reports ratings and NPS
+type FeedbackService struct {
+	db             *gorm.DB
+	qrService      *QRService
+	communications *CommunicationService
+	config         config.FeedbackConfig
+}
+
+func NewFeedbackService(db *gorm.DB, qrService *QRService, communications *CommunicationService, cfg config.FeedbackConfig) *FeedbackService {
+	return &FeedbackService{
+		db:             db,
+		qrService:      qrService,
+		communications: communications,
+		config:         cfg,
+	}
+}
+
+// RequestOrderFeedback creates the feedback link and QR code for an order
+// the customer now has, and messages them the link. handedOverBy is who
+// delivered it or handed it over, credited when no pharmacist is on the
+// order. An order asked once keeps its request.
+func (s *FeedbackService) RequestOrderFeedback(ctx context.Context, orderID uuid.UUID, handedOverBy *uuid.UUID) (*models.Feedback, error) {
+	var order models.OnlineOrder
+	if err := s.db.Preload("Customer").First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+	if order.Status != models.OrderStatusDelivered && order.Status != models.OrderStatusPickedUp {
+		return nil, ErrFeedbackNotDue
+	}
+	if existing, err := s.GetOrderFeedback(ctx, orderID); err == nil {
+		return existing, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	token, err := generateFeedbackToken()
+	if err != nil {
+		return nil, err
+	}
+	staffID := order.PharmacistID
+	if staffID == nil {
+		staffID = handedOverBy
+	}
+	feedback := &models.Feedback{
+		OrderID:    order.ID,
+		CustomerID: order.CustomerID,
+		BranchID:   order.BranchID,
+		StaffID:    staffID,
+		Token:      token,
+		ExpiresAt:  time.Now().UTC().AddDate(0, 0, s.config.LinkValidDays),
+		Status:     models.FeedbackStatusRequested,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(feedback).Error; err != nil {
+			return err
+		}
+		qrCode, err := s.qrService.CreateFeedbackQR(ctx, tx, feedback, order.OrderNumber, s.Link(feedback))
+		if err != nil {
+			return err
+		}
+		feedback.QRCodeID = &qrCode.ID
+		feedback.QRCode = qrCode
+		return tx.Model(feedback).Update("qr_code_id", qrCode.ID).Error
+	})
+	if err != nil {
+		// Asked for at the same moment by another request
+		if existing, findErr := s.GetOrderFeedback(ctx, orderID); findErr == nil {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("failed to create feedback request: %w", err)
+	}
+
+	if s.config.InvitesEnabled && order.Customer != nil {
+		s.invite(ctx, feedback, &order)
+	}
+	return feedback, nil
+}
+
+// GetOrderFeedback returns the feedback asked for on an order, with its QR
+// code
+func (s *FeedbackService) GetOrderFeedback(ctx context.Context, orderID uuid.UUID) (*models.Feedback, error) {
+	var feedback models.Feedback
+	if err := s.db.WithContext(ctx).Preload("QRCode").Where("order_id = ?", orderID).First(&feedback).Error; err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// Link returns the customer's feedback URL
+func (s *FeedbackService) Link(feedback *models.Feedback) string {
+	return strings.TrimRight(s.config.FormBaseURL, "/") + "/" + feedback.Token
+}
+
+// Form returns what the feedback page shows for a token
+func (s *FeedbackService) Form(ctx context.Context, token string) (*FeedbackForm, error) {
+	feedback, err := s.byToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return newFeedbackForm(*feedback), nil
+}
+
+// Submit records the customer's response through their feedback link.
+// Each link takes one response.
+func (s *FeedbackService) Submit(ctx context.Context, token string, req SubmitFeedbackRequest) (*FeedbackForm, error) {
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&models.Feedback{}).
+		Where("token = ? AND status = ? AND expires_at > ?", token, models.FeedbackStatusRequested, now).
+		Updates(map[string]interface{}{
+			"status":       models.FeedbackStatusReceived,
+			"rating":       req.Rating,
+			"nps_score":    req.NPSScore,
+			"comment":      strings.TrimSpace(req.Comment),
+			"submitted_at": now,
+			"updated_at":   now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to record feedback: %w", result.Error)
+	}
+
+	feedback, err := s.byToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		if feedback.Status.Answered() {
+			return nil, ErrFeedbackSubmitted
+		}
+		return nil, ErrFeedbackExpired
+	}
+	return newFeedbackForm(*feedback), nil
+}
+
+// ListFeedback lists responses, newest first. Requests still waiting on the
+// customer are only listed when asked for by status.
+func (s *FeedbackService) ListFeedback(ctx context.Context, filter FeedbackFilter) ([]models.Feedback, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Feedback{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	} else {
+		query = query.Where("status <> ?", models.FeedbackStatusRequested)
+	}
+	if filter.BranchID != nil {
+		query = query.Where("branch_id = ?", *filter.BranchID)
+	}
+	if filter.StaffID != nil {
+		query = query.Where("staff_id = ?", *filter.StaffID)
+	}
+	if filter.MaxRating > 0 {
+		query = query.Where("rating <= ?", filter.MaxRating)
+	}
+	if filter.WithComment {
+		query = query.Where("comment <> ''")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	var feedback []models.Feedback
+	err := query.Preload("Order").Preload("Customer", WithDeleted).Preload("Staff").
+		Order("submitted_at DESC, created_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&feedback).Error
+	return feedback, total, err
+}
+
+func (s *FeedbackService) GetFeedback(ctx context.Context, id uuid.UUID) (*models.Feedback, error) {
+	var feedback models.Feedback
+	if err := s.db.WithContext(ctx).Preload("Order").Preload("Customer", WithDeleted).Preload("Staff").
+		First(&feedback, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+// Moderate publishes a response's comment or hides the response, which
+// also leaves it out of the ratings reports
+func (s *FeedbackService) Moderate(ctx context.Context, id uuid.UUID, req ModerateFeedbackRequest, userID uuid.UUID) (*models.Feedback, error) {
+	if req.Status != models.FeedbackStatusPublished && req.Status != models.FeedbackStatusHidden {
+		return nil, ErrFeedbackModeration
+	}
+
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&models.Feedback{}).
+		Where("id = ? AND status <> ?", id, models.FeedbackStatusRequested).
+		Updates(map[string]interface{}{
+			"status":          req.Status,
+			"moderated_by":    userID,
+			"moderated_at":    now,
+			"moderation_note": req.Note,
+			"updated_at":      now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to moderate feedback: %w", result.Error)
+	}
+
+	feedback, err := s.GetFeedback(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrFeedbackNotAnswered
+	}
+	return feedback, nil
+}
+
+// Published lists the published comments for showing publicly, newest
+// first, without who wrote them
+func (s *FeedbackService) Published(ctx context.Context, branchID *uuid.UUID, limit, offset int) ([]PublishedFeedback, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Feedback{}).
+		Where("status = ? AND comment <> ''", models.FeedbackStatusPublished)
+	if branchID != nil {
+		query = query.Where("branch_id = ?", *branchID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	var published []PublishedFeedback
+	err := query.Select("rating, comment, submitted_at").
+		Order("submitted_at DESC").Limit(limit).Offset(offset).
+		Scan(&published).Error
+	return published, total, err
+}
+
+// Report totals the responses given in the filter's period: the average
+// rating, the NPS, how they moved by week or month and how each staff
+// member was rated. Hidden responses are left out.
+func (s *FeedbackService) Report(ctx context.Context, filter FeedbackReportFilter) (*FeedbackReport, error) {
+	report := &FeedbackReport{
+		From:     filter.From,
+		To:       filter.To,
+		Interval: filter.Interval,
+		Ratings:  map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0},
+		Trend:    []FeedbackTrendPoint{},
+		Staff:    []StaffFeedback{},
+	}
+	if report.Interval != "month" {
+		report.Interval = "week"
+	}
+
+	requests := s.inBranch(ctx, filter.BranchID)
+	if filter.From != nil {
+		requests = requests.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		requests = requests.Where("created_at < ?", *filter.To)
+	}
+	requests = requests.Session(&gorm.Session{})
+	if err := requests.Count(&report.Requested).Error; err != nil {
+		return nil, fmt.Errorf("failed to count feedback requests: %w", err)
+	}
+	if err := requests.Where("status <> ?", models.FeedbackStatusRequested).Count(&report.Answered).Error; err != nil {
+		return nil, fmt.Errorf("failed to count feedback responses: %w", err)
+	}
+	if report.Requested > 0 {
+		report.ResponseRate = math.Round(float64(report.Answered)*1000/float64(report.Requested)) / 10
+	}
+
+	var responses []feedbackResponse
+	query := s.inBranch(ctx, filter.BranchID).
+		Where("status IN ?", []models.FeedbackStatus{models.FeedbackStatusReceived, models.FeedbackStatusPublished})
+	if filter.From != nil {
+		query = query.Where("submitted_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("submitted_at < ?", *filter.To)
+	}
+	if err := query.Select("staff_id, rating, nps_score, submitted_at").
+		Order("submitted_at ASC").Scan(&responses).Error; err != nil {
+		return nil, fmt.Errorf("failed to load feedback responses: %w", err)
+	}
+
+	var total feedbackTally
+	periods := map[string]*feedbackTally{}
+	var periodOrder []string
+	staff := map[uuid.UUID]*feedbackTally{}
+	for _, response := range responses {
+		total.add(response)
+		if response.Rating != nil {
+			report.Ratings[*response.Rating]++
+		}
+
+		period := feedbackPeriod(response.SubmittedAt, report.Interval)
+		if periods[period] == nil {
+			periods[period] = &feedbackTally{}
+			periodOrder = append(periodOrder, period)
+		}
+		periods[period].add(response)
+
+		if response.StaffID != nil {
+			if staff[*response.StaffID] == nil {
+				staff[*response.StaffID] = &feedbackTally{}
+			}
+			staff[*response.StaffID].add(response)
+		}
+	}
+
+	report.FeedbackScores = total.scores()
+	for _, period := range periodOrder {
+		report.Trend = append(report.Trend, FeedbackTrendPoint{Period: period, FeedbackScores: periods[period].scores()})
+	}
+
+	if len(staff) > 0 {
+		ids := make([]uuid.UUID, 0, len(staff))
+		for id := range staff {
+			ids = append(ids, id)
+		}
+		var users []models.User
+		if err := s.db.WithContext(ctx).Select("id, first_name, last_name").Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, fmt.Errorf("failed to load rated staff: %w", err)
+		}
+		for _, user := range users {
+			report.Staff = append(report.Staff, StaffFeedback{
+				UserID:         user.ID,
+				FirstName:      user.FirstName,
+				LastName:       user.LastName,
+				FeedbackScores: staff[user.ID].scores(),
+			})
+		}
+		sort.Slice(report.Staff, func(i, j int) bool {
+			return report.Staff[i].Responses > report.Staff[j].Responses
+		})
+	}
+	return report, nil
+}
+
+// Private helper methods
+
+func (s *FeedbackService) byToken(ctx context.Context, token string) (*models.Feedback, error) {
+	var feedback models.Feedback
+	err := s.db.WithContext(ctx).Preload("Order").Preload("Staff").Where("token = ?", token).First(&feedback).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrFeedbackNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &feedback, nil
+}
+
+func (s *FeedbackService) inBranch(ctx context.Context, branchID *uuid.UUID) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.Feedback{})
+	if branchID != nil {
+		query = query.Where("branch_id = ?", *branchID)
+	}
+	return query
+}
+
+// invite messages the customer their feedback link. A customer who can't
+// be reached still has the QR code handed over with the order.
+func (s *FeedbackService) invite(ctx context.Context, feedback *models.Feedback, order *models.OnlineOrder) {
+	subject := "How did we do?"
+	body := fmt.Sprintf("Hi %s, thank you for your order %s. Tell us how we did: %s",
+		order.Customer.FirstName, order.OrderNumber, s.Link(feedback))
+	channel, err := s.communications.NotifyCustomer(ctx, order.Customer, models.PurposeReminders, subject, body)
+	if errors.Is(err, ErrNotificationSuppressed) {
+		return
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("order_id", order.ID).Warn("Failed to send feedback invitation")
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := s.db.Model(feedback).Updates(map[string]interface{}{
+		"invited_at":     now,
+		"invite_channel": channel,
+	}).Error; err != nil {
+		logrus.WithError(err).WithField("order_id", order.ID).Warn("Failed to record feedback invitation")
+		return
+	}
+	feedback.InvitedAt = &now
+	feedback.InviteChannel = channel
+}
+
+func newFeedbackForm(feedback models.Feedback) *FeedbackForm {
+	form := &FeedbackForm{
+		ExpiresAt: feedback.ExpiresAt,
+		Submitted: feedback.Status.Answered(),
+		Rating:    feedback.Rating,
+		NPSScore:  feedback.NPSScore,
+		Comment:   feedback.Comment,
+	}
+	form.Open = !form.Submitted && time.Now().Before(feedback.ExpiresAt)
+	if feedback.Order != nil {
+		form.OrderNumber = feedback.Order.OrderNumber
+	}
+	if feedback.Staff != nil {
+		form.StaffName = feedback.Staff.FirstName
+	}
+	return form
+}
+
+// feedbackPeriod is the start of the week (Monday) or month t falls in
+func feedbackPeriod(t time.Time, interval string) string {
+	t = t.UTC()
+	if interval == "month" {
+		return t.Format("2006-01")
+	}
+	monday := t.AddDate(0, 0, -((int(t.Weekday()) + 6) % 7))
+	return monday.Format("2006-01-02")
+}
+
+// feedbackTally adds up responses. The NPS counts scores of 9 and 10 as
+// promoters and 0 to 6 as detractors.
+type feedbackTally struct {
+	responses  int
+	rated      int
+	ratingSum  int
+	promoters  int
+	passives   int
+	detractors int
+}
+
+func (t *feedbackTally) add(response feedbackResponse) {
+	t.responses++
+	if response.Rating != nil {
+		t.rated++
+		t.ratingSum += *response.Rating
+	}
+	if response.NPSScore != nil {
+		switch score := *response.NPSScore; {
+		case score >= 9:
+			t.promoters++
+		case score >= 7:
+			t.passives++
+		default:
+			t.detractors++
+		}
+	}
+}
+
+func (t *feedbackTally) scores() FeedbackScores {
+	scores := FeedbackScores{
+		Responses:  t.responses,
+		Promoters:  t.promoters,
+		Passives:   t.passives,
+		Detractors: t.detractors,
+	}
+	if t.rated > 0 {
+		scores.AverageRating = math.Round(float64(t.ratingSum)*100/float64(t.rated)) / 100
+	}
+	if scored := t.promoters + t.passives + t.detractors; scored > 0 {
+		scores.NPS = math.Round(float64(t.promoters-t.detractors)*1000/float64(scored)) / 10
+	}
+	return scores
+}
+
+type feedbackResponse struct {
+	StaffID     *uuid.UUID
+	Rating      *int
+	NPSScore    *int
+	SubmittedAt time.Time
+}
+
+func generateFeedbackToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate feedback token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Request/Response types
+
+type SubmitFeedbackRequest struct {
+	Rating   int    `json:"rating" binding:"required,min=1,max=5"`
+	NPSScore *int   `json:"nps_score" binding:"omitempty,min=0,max=10"`
+	Comment  string `json:"comment" binding:"max=2000"`
+}
+
+type ModerateFeedbackRequest struct {
+	Status models.FeedbackStatus `json:"status" binding:"required"`
+	Note   string                `json:"note" binding:"max=500"`
+}
+
+// FeedbackForm is what the customer's feedback page shows
+type FeedbackForm struct {
+	OrderNumber string    `json:"order_number"`
+	StaffName   string    `json:"staff_name,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Open        bool      `json:"open"` // still takes a response
+	Submitted   bool      `json:"submitted"`
+	Rating      *int      `json:"rating,omitempty"`
+	NPSScore    *int      `json:"nps_score,omitempty"`
+	Comment     string    `json:"comment,omitempty"`
+}
+
+type PublishedFeedback struct {
+	Rating      *int      `json:"rating"`
+	Comment     string    `json:"comment"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+type FeedbackFilter struct {
+	BranchID    *uuid.UUID
+	StaffID     *uuid.UUID
+	Status      models.FeedbackStatus
+	MaxRating   int  // e.g. 2 for the unhappy customers to follow up
+	WithComment bool // only responses with a comment
+	Limit       int
+	Offset      int
+}
+
+type FeedbackReportFilter struct {
+	BranchID *uuid.UUID
+	From     *time.Time
+	To       *time.Time
+	Interval string // week or month
+}
+
+// FeedbackScores sums up a set of responses. The NPS is the percentage of
+// promoters less the percentage of detractors, from -100 to 100.
+type FeedbackScores struct {
+	Responses     int     `json:"responses"`
+	AverageRating float64 `json:"average_rating"`
+	NPS           float64 `json:"nps"`
+	Promoters     int     `json:"promoters"`
+	Passives      int     `json:"passives"`
+	Detractors    int     `json:"detractors"`
+}
+
+type FeedbackReport struct {
+	From         *time.Time `json:"from,omitempty"`
+	To           *time.Time `json:"to,omitempty"`
+	Interval     string     `json:"interval"`
+	Requested    int64      `json:"requested"`     // orders asked in the period
+	Answered     int64      `json:"answered"`      // ... that the customer answered
+	ResponseRate float64    `json:"response_rate"` // percent
+	FeedbackScores
+	Ratings map[int]int          `json:"ratings"` // responses by stars
+	Trend   []FeedbackTrendPoint `json:"trend"`
+	Staff   []StaffFeedback      `json:"staff"`
+}
+
+type FeedbackTrendPoint struct {
+	Period string `json:"period"` // the week's Monday, or the month
+	FeedbackScores
+}
+
+type StaffFeedback struct {
+	UserID    uuid.UUID `json:"user_id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	FeedbackScores
+}
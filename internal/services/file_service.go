@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFileNotMigrated = errors.New("file is still on the server's local disk, move it with migrate-files")
+	ErrNoIDDocument    = errors.New("customer has no ID document on file")
+)
+
+// legacyUploadDir is where uploads were written before they went through a
+// FileStore. Records made then hold the file's path on disk rather than a
+// key, e.g. uploads/prescriptions/<hash>.jpg.
+const legacyUploadDir = "uploads/"
+
+// Upload key prefixes
+const (
+	customerIDFilePrefix   = "customer_ids/"
+	prescriptionFilePrefix = "prescriptions/"
+	documentFilePrefix     = "documents/"
+)
+
+// FileService stores uploaded files in the configured FileStore. Records
+// refer to the files by their key in the store.
+type FileService struct {
+	db     *gorm.DB
+	store  FileStore
+	config config.StorageConfig
+}
+
+func NewFileService(db *gorm.DB, store FileStore, cfg config.StorageConfig) *FileService {
+	return &FileService{db: db, store: store, config: cfg}
+}
+
+// Store returns the store files are kept in
+func (s *FileService) Store() FileStore {
+	return s.store
+}
+
+// SaveCustomerID stores a customer's ID document and returns its key
+func (s *FileService) SaveCustomerID(ctx context.Context, name string, data []byte) (string, error) {
+	key := customerIDFilePrefix + name
+	if err := s.store.Put(ctx, key, data, contentTypeFor(key)); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SavePrescription stores a prescription image, named by its content hash,
+// and returns its key
+func (s *FileService) SavePrescription(ctx context.Context, fileHash, fileName, contentType string, data []byte) (string, error) {
+	key := prescriptionFilePrefix + fileHash + strings.ToLower(filepath.Ext(filepath.Base(fileName)))
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// SaveDocument stores the scanned copy of a license or accreditation under
+// the document's ID and returns its key
+func (s *FileService) SaveDocument(ctx context.Context, documentID uuid.UUID, fileName, contentType string, data []byte) (string, error) {
+	key := documentFilePrefix + documentID.String() + strings.ToLower(filepath.Ext(filepath.Base(fileName)))
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Read returns the file ref refers to. Files uploaded before storage
+// backends are read from local disk until they are migrated.
+func (s *FileService) Read(ctx context.Context, ref string) ([]byte, error) {
+	if isLegacyUploadPath(ref) {
+		data, err := os.ReadFile(ref)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrFileNotFound
+		}
+		return data, err
+	}
+	return s.store.Get(ctx, ref)
+}
+
+// Delete removes the file ref refers to
+func (s *FileService) Delete(ctx context.Context, ref string) error {
+	if isLegacyUploadPath(ref) {
+		if err := os.Remove(ref); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	return s.store.Delete(ctx, ref)
+}
+
+// SignedURL returns a short-lived URL the file ref refers to can be
+// downloaded from, and when it stops working
+func (s *FileService) SignedURL(ref string) (string, time.Time, error) {
+	if isLegacyUploadPath(ref) {
+		return "", time.Time{}, ErrFileNotMigrated
+	}
+	expiresAt := time.Now().Add(s.config.URLExpiry)
+	url, err := s.store.SignedURL(ref, s.config.URLExpiry)
+	return url, expiresAt, err
+}
+
+// CustomerIDDocument returns how to download a customer's ID document
+func (s *FileService) CustomerIDDocument(ctx context.Context, customerID uuid.UUID) (*FileDownload, error) {
+	var customer models.Customer
+	if err := s.db.WithContext(ctx).Select("id", "id_document_path").First(&customer, "id = ?", customerID).Error; err != nil {
+		return nil, err
+	}
+	if customer.IDDocumentPath == "" {
+		return nil, ErrNoIDDocument
+	}
+	name := filepath.Base(filepath.FromSlash(customer.IDDocumentPath))
+	return s.download(ctx, customer.IDDocumentPath, name, contentTypeFor(name))
+}
+
+// PrescriptionFile returns how to download an uploaded prescription
+func (s *FileService) PrescriptionFile(ctx context.Context, uploadID uuid.UUID) (*FileDownload, error) {
+	var upload models.PrescriptionUpload
+	if err := s.db.WithContext(ctx).First(&upload, "id = ?", uploadID).Error; err != nil {
+		return nil, err
+	}
+	ref, err := upload.StoragePath.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt storage path: %w", err)
+	}
+	if ref == "" {
+		return nil, ErrFileNotFound
+	}
+	return s.download(ctx, ref, upload.FileName, upload.MimeType)
+}
+
+// DocumentFile returns how to download the scanned copy of a license or
+// accreditation
+func (s *FileService) DocumentFile(ctx context.Context, documentID uuid.UUID) (*FileDownload, error) {
+	var document models.ComplianceDocument
+	if err := s.db.WithContext(ctx).First(&document, "id = ?", documentID).Error; err != nil {
+		return nil, err
+	}
+	if document.FileKey == "" {
+		return nil, ErrFileNotFound
+	}
+	return s.download(ctx, document.FileKey, document.FileName, document.ContentType)
+}
+
+// MigrateLocalFiles copies the files that records still refer to by their
+// path on local disk into the store, and points the records at their keys.
+// With deleteLocal the copies on disk are removed afterwards. Files that
+// are missing from disk are counted and left alone.
+func (s *FileService) MigrateLocalFiles(ctx context.Context, deleteLocal bool) (*FileMigrationResult, error) {
+	result := &FileMigrationResult{Store: s.store.Name()}
+
+	var customers []models.Customer
+	if err := s.db.WithContext(ctx).Unscoped().Select("id", "id_document_path").
+		Where("id_document_path LIKE ?", legacyUploadDir+"%").
+		Find(&customers).Error; err != nil {
+		return nil, fmt.Errorf("failed to find customer ID documents: %w", err)
+	}
+	for _, customer := range customers {
+		key, ok := s.migrateFile(ctx, customer.IDDocumentPath, "", result)
+		if !ok {
+			continue
+		}
+		if err := s.db.WithContext(ctx).Unscoped().Model(&models.Customer{}).Where("id = ?", customer.ID).
+			Update("id_document_path", key).Error; err != nil {
+			return result, fmt.Errorf("failed to update customer ID document: %w", err)
+		}
+		s.finishMigration(customer.IDDocumentPath, key, deleteLocal, result)
+	}
+
+	// Storage paths are encrypted, so every upload is looked at
+	var uploads []models.PrescriptionUpload
+	err := s.db.WithContext(ctx).Unscoped().Select("id", "storage_path", "mime_type").
+		FindInBatches(&uploads, 200, func(tx *gorm.DB, batch int) error {
+			for _, upload := range uploads {
+				path, err := upload.StoragePath.Get()
+				if err != nil || !isLegacyUploadPath(path) {
+					continue
+				}
+				key, ok := s.migrateFile(ctx, path, upload.MimeType, result)
+				if !ok {
+					continue
+				}
+				if err := upload.StoragePath.Set(key); err != nil {
+					return fmt.Errorf("failed to encrypt storage path: %w", err)
+				}
+				if err := s.db.WithContext(ctx).Unscoped().Model(&models.PrescriptionUpload{}).Where("id = ?", upload.ID).
+					Update("storage_path", upload.StoragePath).Error; err != nil {
+					return fmt.Errorf("failed to update prescription upload: %w", err)
+				}
+				s.finishMigration(path, key, deleteLocal, result)
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// Private helper methods
+
+// download signs a URL for ref. Files not yet migrated off local disk
+// can't be signed for and are read for the server to send instead.
+func (s *FileService) download(ctx context.Context, ref, fileName, contentType string) (*FileDownload, error) {
+	download := &FileDownload{FileName: fileName, ContentType: contentType}
+
+	url, expiresAt, err := s.SignedURL(ref)
+	if errors.Is(err, ErrFileNotMigrated) {
+		download.Data, err = s.Read(ctx, ref)
+		return download, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	download.URL = url
+	download.ExpiresAt = &expiresAt
+	return download, nil
+}
+
+// migrateFile copies the file at path into the store under its key
+func (s *FileService) migrateFile(ctx context.Context, path, contentType string, result *FileMigrationResult) (string, bool) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		result.Missing++
+		return "", false
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("Failed to read file to migrate")
+		result.Failed++
+		return "", false
+	}
+
+	key := strings.TrimPrefix(filepath.ToSlash(path), legacyUploadDir)
+	if contentType == "" {
+		contentType = contentTypeFor(key)
+	}
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		logrus.WithError(err).WithField("path", path).Warn("Failed to migrate file")
+		result.Failed++
+		return "", false
+	}
+	return key, true
+}
+
+// finishMigration counts a migrated file and removes the copy on disk,
+// unless the store kept it in the same place
+func (s *FileService) finishMigration(path, key string, deleteLocal bool, result *FileMigrationResult) {
+	result.Migrated++
+	if !deleteLocal {
+		return
+	}
+	if local, ok := s.store.(*LocalFileStore); ok {
+		if stored, err := local.path(key); err == nil && filepath.Clean(stored) == filepath.Clean(path) {
+			return
+		}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logrus.WithError(err).WithField("path", path).Warn("Failed to delete migrated file")
+	}
+}
+
+func isLegacyUploadPath(ref string) bool {
+	return strings.HasPrefix(filepath.ToSlash(ref), legacyUploadDir)
+}
+
+func contentTypeFor(name string) string {
+	if contentType := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// Request/Response types
+
+// FileDownload is a short-lived way to fetch an upload: a signed URL, or
+// the file itself when it can't be signed for
+type FileDownload struct {
+	URL         string     `json:"url"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	FileName    string     `json:"file_name"`
+	ContentType string     `json:"content_type"`
+	Data        []byte     `json:"-"`
+}
+
+type FileMigrationResult struct {
+	Store    string `json:"store"`
+	Migrated int    `json:"migrated"`
+	Missing  int    `json:"missing"` // no longer on disk
+	Failed   int    `json:"failed"`
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/awsauth"
+	"pharmacy-backend/internal/config"
+)
+
+var (
+	ErrFileNotFound     = errors.New("file not found")
+	ErrInvalidFileKey   = errors.New("invalid file key")
+	ErrInvalidSignedURL = errors.New("invalid or expired file link")
+)
+
+const (
+	// localFileURLPath is where the server hands out files kept on local
+	// disk
+	localFileURLPath = "/api/v1/files/"
+
+	googleStorageEndpoint = "https://storage.googleapis.com"
+)
+
+// FileStore keeps uploaded files under keys such as
+// prescriptions/<hash>.jpg
+type FileStore interface {
+	Name() string
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the file stored under key, or ErrFileNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL the file can be downloaded from without
+	// logging in, until expiry has passed
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
+
+// NewFileStore returns the store for the configured backend. signingKey
+// signs the download URLs of files kept on local disk.
+func NewFileStore(cfg config.StorageConfig, signingKey string) FileStore {
+	switch cfg.Backend {
+	case "s3":
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &BucketFileStore{
+			Provider:   "s3",
+			Bucket:     cfg.Bucket,
+			Prefix:     cfg.Prefix,
+			Region:     region,
+			Endpoint:   cfg.Endpoint,
+			AccessKey:  cfg.AccessKey,
+			SecretKey:  cfg.SecretKey,
+			Encryption: cfg.Encryption,
+			KMSKeyID:   cfg.KMSKeyID,
+			Client:     &http.Client{Timeout: time.Minute},
+		}
+	case "gcs":
+		// Cloud Storage's XML API takes S3-style requests signed with
+		// an HMAC key
+		region := cfg.Region
+		if region == "" {
+			region = "auto"
+		}
+		endpoint := cfg.Endpoint
+		if endpoint == "" {
+			endpoint = googleStorageEndpoint
+		}
+		return &BucketFileStore{
+			Provider:  "gcs",
+			Bucket:    cfg.Bucket,
+			Prefix:    cfg.Prefix,
+			Region:    region,
+			Endpoint:  endpoint,
+			AccessKey: cfg.AccessKey,
+			SecretKey: cfg.SecretKey,
+			KMSKeyID:  cfg.KMSKeyID,
+			Client:    &http.Client{Timeout: time.Minute},
+		}
+	}
+	return &LocalFileStore{Dir: cfg.LocalDir, SigningKey: []byte(signingKey)}
+}
+
+// LocalFileStore keeps files on the server's disk. Its signed URLs point
+// back at the server, which checks them before serving the file.
+type LocalFileStore struct {
+	Dir        string
+	SigningKey []byte
+}
+
+func (s *LocalFileStore) Name() string { return "local" }
+
+func (s *LocalFileStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalFileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrFileNotFound
+	}
+	return data, err
+}
+
+func (s *LocalFileStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalFileStore) SignedURL(key string, expiry time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {s.signature(key, expires)}}
+	return localFileURLPath + key + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature parameters of a URL
+// from SignedURL for key
+func (s *LocalFileStore) VerifySignedURL(key, expires, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignedURL
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, expires))) {
+		return ErrInvalidSignedURL
+	}
+	return nil
+}
+
+func (s *LocalFileStore) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.SigningKey)
+	mac.Write([]byte("file:" + key + ":" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// path returns where key is kept, refusing keys that would escape Dir
+func (s *LocalFileStore) path(key string) (string, error) {
+	if err := checkFileKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// BucketFileStore keeps files in an S3 bucket, or a Google Cloud Storage
+// bucket through its S3-compatible XML API, signing requests with
+// Signature Version 4
+type BucketFileStore struct {
+	Provider   string // s3 or gcs
+	Bucket     string
+	Prefix     string
+	Region     string
+	Endpoint   string // path-style addressing is used when set
+	AccessKey  string
+	SecretKey  string
+	Encryption string // s3 server-side encryption: AES256, aws:kms or none
+	KMSKeyID   string
+	Client     *http.Client
+}
+
+func (s *BucketFileStore) Name() string { return s.Provider }
+
+func (s *BucketFileStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.send(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return fmt.Errorf("%s upload failed: %w", s.Provider, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *BucketFileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.send(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s download failed: %w", s.Provider, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s download failed: %w", s.Provider, err)
+	}
+	return data, nil
+}
+
+func (s *BucketFileStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.send(ctx, http.MethodDelete, key, nil, "")
+	if err != nil && !errors.Is(err, ErrFileNotFound) {
+		return fmt.Errorf("%s delete failed: %w", s.Provider, err)
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (s *BucketFileStore) SignedURL(key string, expiry time.Duration) (string, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, objectURL.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build signed URL: %w", err)
+	}
+	return awsauth.PresignV4(req, s.credentials(), "s3", expiry, time.Now().UTC()), nil
+}
+
+// send makes a signed request for the object under key. Error responses
+// are returned as errors with their body closed; a missing object as
+// ErrFileNotFound.
+func (s *BucketFileStore) send(ctx context.Context, method, key string, data []byte, contentType string) (*http.Response, error) {
+	objectURL, err := s.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, objectURL.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	var signed []string
+	if method == http.MethodPut {
+		req.ContentLength = int64(len(data))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		req.Header.Set("Content-Type", contentType)
+		signed = append(signed, "content-type")
+		signed = append(signed, s.setEncryptionHeaders(req)...)
+	}
+	awsauth.SignV4(req, data, s.credentials(), "s3", signed, time.Now().UTC())
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrFileNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%s returned %d: %s", s.Provider, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// setEncryptionHeaders asks for the configured server-side encryption and
+// returns the headers it set, which are signed
+func (s *BucketFileStore) setEncryptionHeaders(req *http.Request) []string {
+	if s.Provider == "gcs" {
+		if s.KMSKeyID == "" {
+			return nil
+		}
+		req.Header.Set("X-Goog-Encryption-Kms-Key-Name", s.KMSKeyID)
+		return []string{"x-goog-encryption-kms-key-name"}
+	}
+
+	switch s.Encryption {
+	case "AES256":
+		req.Header.Set("X-Amz-Server-Side-Encryption", "AES256")
+		return []string{"x-amz-server-side-encryption"}
+	case "aws:kms":
+		req.Header.Set("X-Amz-Server-Side-Encryption", "aws:kms")
+		if s.KMSKeyID == "" {
+			return []string{"x-amz-server-side-encryption"}
+		}
+		req.Header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", s.KMSKeyID)
+		return []string{"x-amz-server-side-encryption", "x-amz-server-side-encryption-aws-kms-key-id"}
+	}
+	return nil
+}
+
+func (s *BucketFileStore) objectURL(key string) (*url.URL, error) {
+	if err := checkFileKey(key); err != nil {
+		return nil, err
+	}
+	key = s.Prefix + key
+	if s.Endpoint == "" {
+		return url.Parse(fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", s.Bucket, s.Region, key))
+	}
+	base, err := url.Parse(strings.TrimRight(s.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage endpoint: %w", err)
+	}
+	base.Path += "/" + s.Bucket + "/" + key
+	return base, nil
+}
+
+func (s *BucketFileStore) credentials() awsauth.Credentials {
+	return awsauth.Credentials{Region: s.Region, AccessKey: s.AccessKey, SecretKey: s.SecretKey}
+}
+
+// checkFileKey refuses keys that are empty, absolute or climb out of the
+// store with ..
+func checkFileKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidFileKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return ErrInvalidFileKey
+		}
+	}
+	return nil
+}
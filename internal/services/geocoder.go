@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"pharmacy-backend/internal/config"
+)
+
+// ErrAddressNotFound is returned for an address the geocoder can't place
+var ErrAddressNotFound = errors.New("address could not be found, check the street, barangay and city")
+
+// Geocoder turns a postal address into a place on the map
+type Geocoder interface {
+	Name() string
+	// Geocode returns the best match for address, or ErrAddressNotFound
+	Geocode(ctx context.Context, address string) (*GeocodedAddress, error)
+}
+
+// GeocodedAddress is the geocoder's reading of an address, cleaned up into
+// the form it knows the place by
+type GeocodedAddress struct {
+	FormattedAddress string  `json:"formatted_address"`
+	City             string  `json:"city"`
+	Province         string  `json:"province"`
+	ZipCode          string  `json:"zip_code"`
+	Country          string  `json:"country"` // ISO code, e.g. PH
+	Latitude         float64 `json:"latitude"`
+	Longitude        float64 `json:"longitude"`
+
+	// Approximate is set when the geocoder only matched part of the
+	// address, or placed it no closer than its street or area
+	Approximate bool `json:"approximate"`
+}
+
+// NewGeocoder builds the geocoder named in the configuration, or returns
+// nil when geocoding is not configured
+func NewGeocoder(cfg config.GeocodingConfig) Geocoder {
+	switch cfg.Provider {
+	case "google":
+		baseURL := cfg.APIURL
+		if baseURL == "" {
+			baseURL = "https://maps.googleapis.com/maps/api"
+		}
+		return &GoogleGeocoder{
+			BaseURL: baseURL,
+			APIKey:  cfg.GoogleAPIKey,
+			Region:  cfg.Region,
+			Client:  &http.Client{Timeout: cfg.Timeout},
+		}
+	}
+	return nil
+}
+
+// GoogleGeocoder uses the Google Maps Geocoding API
+type GoogleGeocoder struct {
+	BaseURL string
+	APIKey  string
+	Region  string
+	Client  *http.Client
+}
+
+func (g *GoogleGeocoder) Name() string { return "google" }
+
+func (g *GoogleGeocoder) Geocode(ctx context.Context, address string) (*GeocodedAddress, error) {
+	query := url.Values{"address": {address}, "key": {g.APIKey}}
+	if g.Region != "" {
+		query.Set("region", g.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(g.BaseURL, "/")+"/geocode/json?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build geocoding request: %w", err)
+	}
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("geocoding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read geocoding response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("geocoding API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"error_message"`
+		Results      []struct {
+			FormattedAddress  string `json:"formatted_address"`
+			PartialMatch      bool   `json:"partial_match"`
+			AddressComponents []struct {
+				LongName  string   `json:"long_name"`
+				ShortName string   `json:"short_name"`
+				Types     []string `json:"types"`
+			} `json:"address_components"`
+			Geometry struct {
+				Location struct {
+					Lat float64 `json:"lat"`
+					Lng float64 `json:"lng"`
+				} `json:"location"`
+				LocationType string `json:"location_type"`
+			} `json:"geometry"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode geocoding response: %w", err)
+	}
+	switch result.Status {
+	case "OK":
+	case "ZERO_RESULTS":
+		return nil, ErrAddressNotFound
+	default:
+		return nil, fmt.Errorf("geocoding API returned %s: %s", result.Status, result.ErrorMessage)
+	}
+	if len(result.Results) == 0 {
+		return nil, ErrAddressNotFound
+	}
+
+	match := result.Results[0]
+	geocoded := &GeocodedAddress{
+		FormattedAddress: match.FormattedAddress,
+		Latitude:         match.Geometry.Location.Lat,
+		Longitude:        match.Geometry.Location.Lng,
+		Approximate:      match.PartialMatch || match.Geometry.LocationType == "APPROXIMATE" || match.Geometry.LocationType == "GEOMETRIC_CENTER",
+	}
+	// In the Philippines the first-level area is the region and the
+	// second the province, which is what addresses give
+	var region string
+	for _, component := range match.AddressComponents {
+		for _, kind := range component.Types {
+			switch kind {
+			case "locality":
+				geocoded.City = component.LongName
+			case "administrative_area_level_2":
+				geocoded.Province = component.LongName
+			case "administrative_area_level_1":
+				region = component.LongName
+			case "postal_code":
+				geocoded.ZipCode = component.LongName
+			case "country":
+				geocoded.Country = component.ShortName
+			}
+		}
+	}
+	if geocoded.Province == "" {
+		geocoded.Province = region
+	}
+	return geocoded, nil
+}
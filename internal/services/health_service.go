@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/database"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type HealthStatus string
+
+const (
+	HealthOK       HealthStatus = "ok"
+	HealthDegraded HealthStatus = "degraded" // working, with reduced capacity or stale data
+	HealthDown     HealthStatus = "down"
+	HealthDisabled HealthStatus = "disabled" // not configured
+)
+
+// healthCheckTimeout bounds each dependency check so a hung dependency
+// can't hold up the probe
+const healthCheckTimeout = 3 * time.Second
+
+// HealthService checks the dependencies the server needs to take traffic,
+// for the readiness probe. Only the primary database and upload disk space
+// are critical: reads fall back to the primary without the replica, rate
+// limits to per-instance counting without Redis, and the store keeps
+// working on its own database while sync is behind.
+type HealthService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	config *config.Config
+
+	mu        sync.RWMutex
+	replica   *database.ReadReplicaRouter
+	dbManager *database.DatabaseManager
+}
+
+func NewHealthService(db *gorm.DB, redis *redis.Client, config *config.Config) *HealthService {
+	return &HealthService{db: db, redis: redis, config: config}
+}
+
+// SetReadReplica adds the read replica's lag to the checks
+func (s *HealthService) SetReadReplica(replica *database.ReadReplicaRouter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.replica = replica
+}
+
+// SetDatabaseManager adds the synced databases to the checks
+func (s *HealthService) SetDatabaseManager(dm *database.DatabaseManager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dbManager = dm
+}
+
+// Ready checks every dependency at once. The server is ready unless a
+// critical one is down.
+func (s *HealthService) Ready(ctx context.Context) *Readiness {
+	s.mu.RLock()
+	replica, dbManager := s.replica, s.dbManager
+	s.mu.RUnlock()
+
+	checks := map[string]func(context.Context) DependencyHealth{
+		"primary_db": s.checkPrimary,
+		"replica_db": func(ctx context.Context) DependencyHealth { return s.checkReplica(replica) },
+		"redis":      s.checkRedis,
+		"disk":       func(ctx context.Context) DependencyHealth { return s.checkDisk() },
+		"sync":       func(ctx context.Context) DependencyHealth { return s.checkSync(dbManager) },
+	}
+
+	readiness := &Readiness{
+		Status:    HealthOK,
+		Checks:    make(map[string]DependencyHealth, len(checks)),
+		CheckedAt: time.Now().UTC(),
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) DependencyHealth) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			result := check(checkCtx)
+			result.LatencyMS = time.Since(start).Milliseconds()
+
+			mu.Lock()
+			defer mu.Unlock()
+			readiness.Checks[name] = result
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, result := range readiness.Checks {
+		switch {
+		case result.Status == HealthDown && result.Critical:
+			readiness.Status = HealthDown
+		case result.Status == HealthDown || result.Status == HealthDegraded:
+			if readiness.Status == HealthOK {
+				readiness.Status = HealthDegraded
+			}
+		}
+	}
+	return readiness
+}
+
+// Private helper methods
+
+func (s *HealthService) checkPrimary(ctx context.Context) DependencyHealth {
+	result := DependencyHealth{Critical: true}
+	sqlDB, err := s.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		result.Status, result.Detail = HealthDown, err.Error()
+		return result
+	}
+	result.Status = HealthOK
+	return result
+}
+
+func (s *HealthService) checkReplica(replica *database.ReadReplicaRouter) DependencyHealth {
+	if replica == nil {
+		return DependencyHealth{Status: HealthDisabled}
+	}
+	healthy, lag := replica.Status()
+	result := DependencyHealth{Status: HealthOK, Detail: fmt.Sprintf("lag %s", lag.Round(time.Millisecond))}
+	if !healthy {
+		result.Status = HealthDegraded
+		result.Detail = fmt.Sprintf("unavailable or lagging (%s), reading from primary", result.Detail)
+	}
+	return result
+}
+
+func (s *HealthService) checkRedis(ctx context.Context) DependencyHealth {
+	if s.redis == nil {
+		return DependencyHealth{Status: HealthDisabled, Detail: "not configured, limits and revocations are per instance"}
+	}
+	if err := s.redis.Ping(ctx).Err(); err != nil {
+		return DependencyHealth{Status: HealthDown, Detail: err.Error() + ", falling back to memory"}
+	}
+	return DependencyHealth{Status: HealthOK}
+}
+
+// checkDisk checks the free space where uploads are kept on local disk.
+// Before the first upload the directory doesn't exist yet, so the nearest
+// existing parent is checked.
+func (s *HealthService) checkDisk() DependencyHealth {
+	result := DependencyHealth{Critical: true}
+	minFree := uint64(s.config.Monitoring.MinFreeDiskMB) << 20
+	if minFree == 0 {
+		result.Status = HealthDisabled
+		return result
+	}
+
+	path, err := filepath.Abs(s.config.Storage.LocalDir)
+	if err != nil {
+		result.Status, result.Detail = HealthDown, err.Error()
+		return result
+	}
+	for {
+		if _, err := os.Stat(path); err == nil || filepath.Dir(path) == path {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+
+	free, err := freeDiskSpace(path)
+	if errors.Is(err, errors.ErrUnsupported) {
+		result.Status = HealthDisabled
+		return result
+	}
+	if err != nil {
+		result.Status, result.Detail = HealthDown, err.Error()
+		return result
+	}
+	result.Detail = fmt.Sprintf("%d MB free", free>>20)
+	if free < minFree {
+		result.Status = HealthDown
+		result.Detail += fmt.Sprintf(", below the %d MB minimum", s.config.Monitoring.MinFreeDiskMB)
+		return result
+	}
+	result.Status = HealthOK
+	return result
+}
+
+// checkSync reports sync as behind once three intervals pass without one
+// completing
+func (s *HealthService) checkSync(dbManager *database.DatabaseManager) DependencyHealth {
+	if dbManager == nil {
+		return DependencyHealth{Status: HealthDisabled}
+	}
+	stats, err := dbManager.GetStats()
+	if err != nil {
+		return DependencyHealth{Status: HealthDegraded, Detail: err.Error()}
+	}
+	if stats.LastSyncTime.IsZero() {
+		return DependencyHealth{Status: HealthDegraded, Detail: "no sync has completed yet"}
+	}
+
+	lag := time.Since(stats.LastSyncTime)
+	result := DependencyHealth{Status: HealthOK, Detail: fmt.Sprintf("last sync %s ago", lag.Round(time.Second))}
+	if interval := s.config.Sync.Interval; interval > 0 && lag > 3*interval {
+		result.Status = HealthDegraded
+	}
+	names := make([]string, 0, len(stats.HealthStatus))
+	for name := range stats.HealthStatus {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !stats.HealthStatus[name] {
+			result.Status = HealthDegraded
+			result.Detail += fmt.Sprintf(", %s database unreachable", name)
+		}
+	}
+	return result
+}
+
+// Request/Response types
+
+// DependencyHealth is the result of checking one dependency. The server
+// isn't ready while a critical one is down.
+type DependencyHealth struct {
+	Status    HealthStatus `json:"status"`
+	Critical  bool         `json:"critical"`
+	Detail    string       `json:"detail,omitempty"`
+	LatencyMS int64        `json:"latency_ms"`
+}
+
+type Readiness struct {
+	Status    HealthStatus                `json:"status"`
+	Checks    map[string]DependencyHealth `json:"checks"`
+	CheckedAt time.Time                   `json:"checked_at"`
+}
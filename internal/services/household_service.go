@@ -0,0 +1,192 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// HouseholdService manages dependents linked to a guardian's customer account
+type HouseholdService struct {
+	db *gorm.DB
+}
+
+func NewHouseholdService(db *gorm.DB) *HouseholdService {
+	return &HouseholdService{db: db}
+}
+
+// CreateDependent creates a dependent profile under a guardian. Contact
+// details not given are copied from the guardian so reminders reach them.
+func (s *HouseholdService) CreateDependent(ctx context.Context, guardianID uuid.UUID, req CreateDependentRequest, createdBy *uuid.UUID) (*models.Customer, error) {
+	if !req.Relationship.IsValid() {
+		return nil, fmt.Errorf("invalid relationship: %s", req.Relationship)
+	}
+	guardian, err := s.guardian(guardianID)
+	if err != nil {
+		return nil, err
+	}
+
+	dependent := &models.Customer{
+		FirstName:        req.FirstName,
+		LastName:         req.LastName,
+		Phone:            req.Phone,
+		DateOfBirth:      req.DateOfBirth,
+		Address:          guardian.Address,
+		City:             guardian.City,
+		State:            guardian.State,
+		ZipCode:          guardian.ZipCode,
+		Country:          guardian.Country,
+		PreferredContact: guardian.PreferredContact,
+		GuardianID:       &guardian.ID,
+		Relationship:     req.Relationship,
+		CreatedBy:        createdBy,
+	}
+	if dependent.Phone == "" {
+		dependent.Phone = guardian.Phone
+	}
+	if err := setMedicalData(dependent, req.Allergies, req.MedicalHistory, req.CurrentMedications); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(dependent).Error; err != nil {
+		return nil, fmt.Errorf("failed to create dependent: %w", err)
+	}
+	return dependent, nil
+}
+
+// GetDependents lists a guardian's dependents
+func (s *HouseholdService) GetDependents(ctx context.Context, guardianID uuid.UUID) ([]models.Customer, error) {
+	var dependents []models.Customer
+	err := s.db.Where("guardian_id = ?", guardianID).
+		Order("date_of_birth ASC").
+		Find(&dependents).Error
+	return dependents, err
+}
+
+// LinkDependent places an existing customer under a guardian
+func (s *HouseholdService) LinkDependent(ctx context.Context, guardianID, dependentID uuid.UUID, relationship models.DependentRelationship, updatedBy *uuid.UUID) (*models.Customer, error) {
+	if !relationship.IsValid() {
+		return nil, fmt.Errorf("invalid relationship: %s", relationship)
+	}
+	if guardianID == dependentID {
+		return nil, fmt.Errorf("a customer cannot be their own dependent")
+	}
+	if _, err := s.guardian(guardianID); err != nil {
+		return nil, err
+	}
+
+	var dependent models.Customer
+	if err := s.db.First(&dependent, dependentID).Error; err != nil {
+		return nil, fmt.Errorf("dependent not found: %w", err)
+	}
+	if dependent.IsDependent() {
+		return nil, fmt.Errorf("customer is already a dependent of another account")
+	}
+	var count int64
+	if err := s.db.Model(&models.Customer{}).Where("guardian_id = ?", dependentID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("customer has dependents of their own and cannot be linked")
+	}
+
+	if err := s.db.Model(&dependent).Updates(map[string]interface{}{
+		"guardian_id":  guardianID,
+		"relationship": relationship,
+		"updated_by":   updatedBy,
+		"updated_at":   time.Now().UTC(),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to link dependent: %w", err)
+	}
+	return &dependent, nil
+}
+
+// UnlinkDependent removes a dependent from a guardian, e.g. when a child
+// comes of age and manages their own account
+func (s *HouseholdService) UnlinkDependent(ctx context.Context, guardianID, dependentID uuid.UUID, updatedBy *uuid.UUID) error {
+	result := s.db.Model(&models.Customer{}).
+		Where("id = ? AND guardian_id = ?", dependentID, guardianID).
+		Updates(map[string]interface{}{
+			"guardian_id":  nil,
+			"relationship": "",
+			"updated_by":   updatedBy,
+			"updated_at":   time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unlink dependent: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("customer is not a dependent of this account")
+	}
+	return nil
+}
+
+// CheckDependent returns an error unless dependentID is one of the
+// guardian's dependents
+func (s *HouseholdService) CheckDependent(ctx context.Context, guardianID, dependentID uuid.UUID) error {
+	return checkDependent(s.db, guardianID, dependentID)
+}
+
+// Private helper methods
+
+func (s *HouseholdService) guardian(guardianID uuid.UUID) (*models.Customer, error) {
+	var guardian models.Customer
+	if err := s.db.First(&guardian, guardianID).Error; err != nil {
+		return nil, fmt.Errorf("guardian not found: %w", err)
+	}
+	if guardian.IsDependent() {
+		return nil, fmt.Errorf("a dependent cannot have dependents of their own")
+	}
+	return &guardian, nil
+}
+
+func checkDependent(db *gorm.DB, guardianID, dependentID uuid.UUID) error {
+	var count int64
+	if err := db.Model(&models.Customer{}).
+		Where("id = ? AND guardian_id = ?", dependentID, guardianID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check dependent: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("customer is not a dependent of this account")
+	}
+	return nil
+}
+
+func setMedicalData(customer *models.Customer, allergies, history, medications []string) error {
+	fields := []struct {
+		target *models.EncryptedStringArray
+		values []string
+	}{
+		{&customer.Allergies, allergies},
+		{&customer.MedicalHistory, history},
+		{&customer.CurrentMedications, medications},
+	}
+	for _, f := range fields {
+		if len(f.values) == 0 {
+			continue
+		}
+		if err := f.target.Set(f.values); err != nil {
+			return fmt.Errorf("failed to encrypt medical data: %w", err)
+		}
+	}
+	return nil
+}
+
+// Request types
+
+type CreateDependentRequest struct {
+	FirstName          string                       `json:"first_name" binding:"required"`
+	LastName           string                       `json:"last_name" binding:"required"`
+	DateOfBirth        time.Time                    `json:"date_of_birth" binding:"required"`
+	Relationship       models.DependentRelationship `json:"relationship" binding:"required"`
+	Phone              string                       `json:"phone"`
+	Allergies          []string                     `json:"allergies"`
+	MedicalHistory     []string                     `json:"medical_history"`
+	CurrentMedications []string                     `json:"current_medications"`
+}
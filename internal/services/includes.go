@@ -0,0 +1,48 @@
+package services
+
+import (
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+)
+
+// Relations responses can embed
+
+var CustomerIncludes = query.NewIncludes(models.Customer{}, map[string]query.Relation{
+	"dependents":       {Preload: "Dependents"},
+	"flags":            {Preload: "Flags", Conditions: []interface{}{ActiveFlags}},
+	"sales":            {Preload: "Sales"},
+	"sales.sale_items": {Preload: "Sales.SaleItems"},
+	"purchase_history": {Preload: "PurchaseHistory"},
+})
+
+var SaleIncludes = query.NewIncludes(models.Sale{}, map[string]query.Relation{
+	"customer":               {Preload: "Customer", Conditions: []interface{}{WithDeleted}},
+	"guardian":               {Preload: "Guardian", Conditions: []interface{}{WithDeleted}},
+	"pharmacist":             {Preload: "Pharmacist"},
+	"sale_items":             {Preload: "SaleItems"},
+	"sale_items.product":     {Preload: "SaleItems.Product", Conditions: []interface{}{WithDeleted}},
+	"sale_items.service":     {Preload: "SaleItems.Service", Conditions: []interface{}{WithDeleted}},
+	"sale_items.preparation": {Preload: "SaleItems.Preparation"},
+	"insurance_claim":        {Preload: "InsuranceClaim"},
+})
+
+var OnlineOrderIncludes = query.NewIncludes(models.OnlineOrder{}, map[string]query.Relation{
+	"customer":            {Preload: "Customer", Conditions: []interface{}{WithDeleted}},
+	"guardian":            {Preload: "Guardian", Conditions: []interface{}{WithDeleted}},
+	"pharmacist":          {Preload: "Pharmacist"},
+	"order_items":         {Preload: "OrderItems"},
+	"order_items.product": {Preload: "OrderItems.Product", Conditions: []interface{}{WithDeleted}},
+	"order_history":       {Preload: "OrderHistory"},
+	"order_history.user":  {Preload: "OrderHistory.User"},
+})
+
+// OrderDetailIncludes are what a single online order embeds by default
+var OrderDetailIncludes = []string{"order_items.product", "customer", "guardian", "order_history.user", "pharmacist"}
+
+var ProductIncludes = query.NewIncludes(models.Product{}, map[string]query.Relation{
+	"suppliers": {Preload: "Suppliers"},
+})
+
+var SupplierIncludes = query.NewIncludes(models.Supplier{}, map[string]query.Relation{
+	"products": {Preload: "Products"},
+})
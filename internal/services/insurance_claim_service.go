@@ -0,0 +1,476 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrClaimNeedsCustomer  = errors.New("an insurance claim needs the customer the sale is for")
+	ErrClaimExists         = errors.New("the sale already has an insurance claim")
+	ErrNoInsuranceProvider = errors.New("no HMO given and the customer has no insurance provider on file")
+	ErrLOAExpired          = errors.New("the letter of authorization has expired")
+	ErrClaimAmount         = errors.New("the claimed amount must be more than zero and no more than the sale total")
+	ErrClaimStatus         = errors.New("the claim can't move to that status")
+	ErrClaimDenialReason   = errors.New("a denied claim needs a reason")
+)
+
+// InsuranceClaimService tracks HMO claims for sales from capture at the
+// counter until the HMO pays
+type InsuranceClaimService struct {
+	db       *gorm.DB
+	numbers  *NumberService
+	pharmacy labels.Pharmacy
+}
+
+func NewInsuranceClaimService(db *gorm.DB, numbers *NumberService, cfg config.PharmacyConfig) *InsuranceClaimService {
+	return &InsuranceClaimService{
+		db:      db,
+		numbers: numbers,
+		pharmacy: labels.Pharmacy{
+			Name:          cfg.Name,
+			Address:       cfg.Address,
+			Phone:         cfg.Phone,
+			LicenseNumber: cfg.LicenseNumber,
+		},
+	}
+}
+
+// CreateForSale records the claim for a sale in tx, normally the one the
+// sale is made in. The HMO and member number default to the customer's
+// insurance details, and the claim to the whole sale. A sale paid by
+// insurance stays unpaid until the HMO pays the claim.
+func (s *InsuranceClaimService) CreateForSale(tx *gorm.DB, sale *models.Sale, req InsuranceClaimRequest, userID uuid.UUID) (*models.InsuranceClaim, error) {
+	if sale.CustomerID == nil {
+		return nil, ErrClaimNeedsCustomer
+	}
+	if req.LOAExpiresAt != nil && req.LOAExpiresAt.Before(sale.CreatedAt.Truncate(24*time.Hour)) {
+		return nil, ErrLOAExpired
+	}
+
+	var existing int64
+	if err := tx.Model(&models.InsuranceClaim{}).Where("sale_id = ?", sale.ID).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check for a claim: %w", err)
+	}
+	if existing > 0 {
+		return nil, ErrClaimExists
+	}
+
+	var customer models.Customer
+	if err := tx.Select("id", "insurance_provider", "insurance_number").First(&customer, "id = ?", *sale.CustomerID).Error; err != nil {
+		return nil, fmt.Errorf("customer: %w", err)
+	}
+	provider := strings.TrimSpace(req.Provider)
+	if provider == "" {
+		provider = strings.TrimSpace(customer.InsuranceProvider.String())
+	}
+	if provider == "" {
+		return nil, ErrNoInsuranceProvider
+	}
+	memberNumber := strings.TrimSpace(req.MemberNumber)
+	if memberNumber == "" {
+		memberNumber = customer.InsuranceNumber.String()
+	}
+
+	claimed := sale.Total
+	if req.ClaimedAmount != nil {
+		claimed = *req.ClaimedAmount
+	}
+	if claimed <= 0 || claimed > sale.Total {
+		return nil, ErrClaimAmount
+	}
+
+	number, err := s.numbers.ClaimNumber(tx, sale.BranchID)
+	if err != nil {
+		return nil, err
+	}
+
+	claim := models.InsuranceClaim{
+		SaleID:        sale.ID,
+		CustomerID:    *sale.CustomerID,
+		BranchID:      sale.BranchID,
+		ClaimNumber:   number,
+		Provider:      truncate(provider, 100),
+		Company:       strings.TrimSpace(req.Company),
+		LOANumber:     strings.TrimSpace(req.LOANumber),
+		Physician:     strings.TrimSpace(req.Physician),
+		SaleTotal:     sale.Total,
+		PatientShare:  sale.Total - claimed,
+		ClaimedAmount: claimed,
+		Status:        models.ClaimStatusPending,
+		Notes:         req.Notes,
+		CreatedBy:     &userID,
+		UpdatedBy:     &userID,
+	}
+	if req.LOAIssuedAt != nil {
+		issued := req.LOAIssuedAt.Time
+		claim.LOAIssuedAt = &issued
+	}
+	if req.LOAExpiresAt != nil {
+		expires := req.LOAExpiresAt.Time
+		claim.LOAExpiresAt = &expires
+	}
+	if err := claim.MemberNumber.Set(memberNumber); err != nil {
+		return nil, fmt.Errorf("failed to encrypt member number: %w", err)
+	}
+	if err := claim.Diagnosis.Set(strings.TrimSpace(req.Diagnosis)); err != nil {
+		return nil, fmt.Errorf("failed to encrypt diagnosis: %w", err)
+	}
+
+	if err := tx.Create(&claim).Error; err != nil {
+		return nil, fmt.Errorf("failed to create claim: %w", err)
+	}
+
+	if sale.PaymentMethod == models.PaymentMethodInsurance && sale.PaymentStatus != models.PaymentStatusPending {
+		if err := tx.Model(&models.Sale{}).Where("id = ?", sale.ID).
+			Update("payment_status", models.PaymentStatusPending).Error; err != nil {
+			return nil, fmt.Errorf("failed to update sale payment status: %w", err)
+		}
+		sale.PaymentStatus = models.PaymentStatusPending
+	}
+	return &claim, nil
+}
+
+// CreateClaim records the claim for a sale already made, e.g. when the LOA
+// arrived after the member left
+func (s *InsuranceClaimService) CreateClaim(ctx context.Context, saleID uuid.UUID, req InsuranceClaimRequest, userID uuid.UUID) (*models.InsuranceClaim, error) {
+	var claim *models.InsuranceClaim
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sale models.Sale
+		if err := tx.First(&sale, "id = ?", saleID).Error; err != nil {
+			return fmt.Errorf("sale: %w", err)
+		}
+		var err error
+		claim, err = s.CreateForSale(tx, &sale, req, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claim, nil
+}
+
+// GetClaim returns a claim with its sale and customer
+func (s *InsuranceClaimService) GetClaim(ctx context.Context, id uuid.UUID) (*models.InsuranceClaim, error) {
+	var claim models.InsuranceClaim
+	if err := s.db.WithContext(ctx).
+		Preload("Customer", WithDeleted).
+		Preload("Sale.SaleItems.Product", WithDeleted).
+		Preload("Sale.SaleItems.Service", WithDeleted).
+		First(&claim, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("claim: %w", err)
+	}
+	return &claim, nil
+}
+
+// ListClaims returns claims, newest first
+func (s *InsuranceClaimService) ListClaims(ctx context.Context, filter ClaimFilter) ([]models.InsuranceClaim, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+
+	db := s.db.WithContext(ctx).Model(&models.InsuranceClaim{})
+	if filter.Status != "" {
+		db = db.Where("status = ?", filter.Status)
+	}
+	if filter.Provider != "" {
+		db = db.Where("LOWER(provider) = ?", strings.ToLower(filter.Provider))
+	}
+	if filter.CustomerID != nil {
+		db = db.Where("customer_id = ?", *filter.CustomerID)
+	}
+	if filter.From != nil {
+		db = db.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		db = db.Where("created_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count claims: %w", err)
+	}
+
+	var claims []models.InsuranceClaim
+	if err := db.Preload("Customer", WithDeleted).Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&claims).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load claims: %w", err)
+	}
+	return claims, total, nil
+}
+
+// UpdateStatus moves a claim along: submitted to the HMO, approved for an
+// amount or denied, then paid. Paying the claim marks the sale paid.
+// Returns the claim before and after.
+func (s *InsuranceClaimService) UpdateStatus(ctx context.Context, id uuid.UUID, req UpdateClaimStatusRequest, userID uuid.UUID) (*models.InsuranceClaim, *models.InsuranceClaim, error) {
+	var before, after models.InsuranceClaim
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&before, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("claim: %w", err)
+		}
+		if !before.Status.CanMoveTo(req.Status) {
+			return fmt.Errorf("%w: %s to %s", ErrClaimStatus, before.Status, req.Status)
+		}
+
+		now := time.Now().UTC()
+		updates := map[string]interface{}{
+			"status":     req.Status,
+			"updated_by": userID,
+			"updated_at": now,
+		}
+		if req.Notes != "" {
+			updates["notes"] = req.Notes
+		}
+
+		switch req.Status {
+		case models.ClaimStatusSubmitted:
+			updates["submitted_at"] = now
+			// A resubmitted claim is decided afresh
+			updates["decided_at"] = nil
+			updates["denial_reason"] = ""
+			updates["approved_amount"] = nil
+		case models.ClaimStatusApproved:
+			approved := before.ClaimedAmount
+			if req.ApprovedAmount != nil {
+				approved = *req.ApprovedAmount
+			}
+			if approved <= 0 || approved > before.ClaimedAmount {
+				return ErrClaimAmount
+			}
+			updates["approved_amount"] = approved
+			updates["decided_at"] = now
+		case models.ClaimStatusDenied:
+			if strings.TrimSpace(req.DenialReason) == "" {
+				return ErrClaimDenialReason
+			}
+			updates["denial_reason"] = strings.TrimSpace(req.DenialReason)
+			updates["decided_at"] = now
+		case models.ClaimStatusPaid:
+			paid := *before.ApprovedAmount
+			if req.PaidAmount != nil {
+				paid = *req.PaidAmount
+			}
+			if paid <= 0 || paid > *before.ApprovedAmount {
+				return ErrClaimAmount
+			}
+			updates["paid_amount"] = paid
+			updates["paid_at"] = now
+			updates["payment_reference"] = strings.TrimSpace(req.PaymentReference)
+
+			if err := tx.Model(&models.Sale{}).
+				Where("id = ? AND payment_method = ?", before.SaleID, models.PaymentMethodInsurance).
+				Update("payment_status", models.PaymentStatusPaid).Error; err != nil {
+				return fmt.Errorf("failed to mark sale paid: %w", err)
+			}
+		}
+
+		// Only the request that finds the claim in the status it read moves it
+		result := tx.Model(&models.InsuranceClaim{}).Where("id = ? AND status = ?", id, before.Status).Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update claim: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: the claim changed in the meantime", ErrClaimStatus)
+		}
+		return tx.First(&after, "id = ?", id).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &before, &after, nil
+}
+
+// ClaimForm builds the statement of account sent to the HMO with the LOA
+func (s *InsuranceClaimService) ClaimForm(ctx context.Context, id uuid.UUID, preparedBy string) (labels.InsuranceClaimForm, error) {
+	claim, err := s.GetClaim(ctx, id)
+	if err != nil {
+		return labels.InsuranceClaimForm{}, err
+	}
+
+	form := labels.InsuranceClaimForm{
+		Pharmacy:      s.pharmacy,
+		ClaimNumber:   claim.ClaimNumber,
+		Provider:      claim.Provider,
+		MemberNumber:  claim.MemberNumber.String(),
+		Company:       claim.Company,
+		LOANumber:     claim.LOANumber,
+		LOAIssuedAt:   claim.LOAIssuedAt,
+		LOAExpiresAt:  claim.LOAExpiresAt,
+		Physician:     claim.Physician,
+		Diagnosis:     claim.Diagnosis.String(),
+		SaleTotal:     claim.SaleTotal.String(),
+		PatientShare:  claim.PatientShare.String(),
+		ClaimedAmount: claim.ClaimedAmount.String(),
+		PreparedBy:    preparedBy,
+	}
+	if claim.Customer != nil {
+		form.MemberName = claim.Customer.FirstName + " " + claim.Customer.LastName
+	}
+	if claim.Sale != nil {
+		form.SaleNumber = claim.Sale.SaleNumber
+		form.InvoiceNumber = derefString(claim.Sale.InvoiceNumber)
+		form.DispensedAt = claim.Sale.CreatedAt
+		for _, item := range claim.Sale.SaleItems {
+			form.Items = append(form.Items, labels.ClaimFormItem{
+				Description: claimItemDescription(item),
+				Quantity:    item.Quantity,
+				UnitPrice:   item.UnitPrice.String(),
+				Total:       item.TotalPrice.String(),
+			})
+		}
+	}
+	return form, nil
+}
+
+// Receivables totals what each HMO still owes, aged from when each claim
+// was submitted, or captured for claims not yet sent
+func (s *InsuranceClaimService) Receivables(ctx context.Context, asOf time.Time) (*ReceivablesReport, error) {
+	var claims []models.InsuranceClaim
+	if err := s.db.WithContext(ctx).
+		Select("id", "provider", "status", "claimed_amount", "approved_amount", "paid_amount", "submitted_at", "created_at").
+		Where("status IN ?", []models.ClaimStatus{models.ClaimStatusPending, models.ClaimStatusSubmitted, models.ClaimStatusApproved}).
+		Where("created_at <= ?", asOf).
+		Find(&claims).Error; err != nil {
+		return nil, fmt.Errorf("failed to load outstanding claims: %w", err)
+	}
+
+	report := &ReceivablesReport{AsOf: asOf, Providers: []ProviderReceivable{}}
+	byProvider := make(map[string]int)
+	for _, claim := range claims {
+		key := strings.ToLower(claim.Provider)
+		i, ok := byProvider[key]
+		if !ok {
+			i = len(report.Providers)
+			byProvider[key] = i
+			report.Providers = append(report.Providers, ProviderReceivable{Provider: claim.Provider})
+		}
+		row := &report.Providers[i]
+
+		owed := claim.ClaimedAmount - claim.PaidAmount
+		switch claim.Status {
+		case models.ClaimStatusPending:
+			row.Pending += owed
+		case models.ClaimStatusSubmitted:
+			row.Submitted += owed
+		case models.ClaimStatusApproved:
+			owed = *claim.ApprovedAmount - claim.PaidAmount
+			row.Approved += owed
+		}
+
+		since := claim.CreatedAt
+		if claim.SubmittedAt != nil {
+			since = *claim.SubmittedAt
+		}
+		switch days := int(asOf.Sub(since).Hours() / 24); {
+		case days <= 30:
+			row.Current += owed
+		case days <= 60:
+			row.Days31To60 += owed
+		case days <= 90:
+			row.Days61To90 += owed
+		default:
+			row.Over90 += owed
+		}
+		if row.OldestAt == nil || since.Before(*row.OldestAt) {
+			oldest := since
+			row.OldestAt = &oldest
+		}
+
+		row.Claims++
+		row.Outstanding += owed
+		report.Claims++
+		report.Outstanding += owed
+	}
+
+	sort.Slice(report.Providers, func(i, j int) bool {
+		return report.Providers[i].Outstanding > report.Providers[j].Outstanding
+	})
+	return report, nil
+}
+
+// Private helper methods
+
+func claimItemDescription(item models.SaleItem) string {
+	if item.Product != nil {
+		description := item.Product.Name
+		if item.Product.GenericName != nil && !strings.EqualFold(*item.Product.GenericName, item.Product.Name) {
+			description += " (" + *item.Product.GenericName + ")"
+		}
+		return description
+	}
+	if item.Service != nil {
+		return item.Service.Name
+	}
+	return item.ItemType
+}
+
+// Request/Response types
+
+type InsuranceClaimRequest struct {
+	Provider      string             `json:"provider" binding:"max=100"`
+	MemberNumber  string             `json:"member_number" binding:"max=100"`
+	Company       string             `json:"company" binding:"max=255"`
+	LOANumber     string             `json:"loa_number" binding:"required,max=100"`
+	LOAIssuedAt   *models.CustomDate `json:"loa_issued_at"`
+	LOAExpiresAt  *models.CustomDate `json:"loa_expires_at"`
+	Physician     string             `json:"physician" binding:"max=255"`
+	Diagnosis     string             `json:"diagnosis"`
+	ClaimedAmount *models.Money      `json:"claimed_amount"` // the whole sale when empty
+	Notes         string             `json:"notes"`
+}
+
+type UpdateClaimStatusRequest struct {
+	Status           models.ClaimStatus `json:"status" binding:"required,oneof=submitted approved denied paid"`
+	ApprovedAmount   *models.Money      `json:"approved_amount"` // the claimed amount when empty
+	PaidAmount       *models.Money      `json:"paid_amount"`     // the approved amount when empty
+	DenialReason     string             `json:"denial_reason"`
+	PaymentReference string             `json:"payment_reference" binding:"max=100"`
+	Notes            string             `json:"notes"`
+}
+
+type ClaimFilter struct {
+	Status     models.ClaimStatus
+	Provider   string
+	CustomerID *uuid.UUID
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// ProviderReceivable is what one HMO owes. Outstanding is split both by
+// claim status and by age.
+type ProviderReceivable struct {
+	Provider    string       `json:"provider"`
+	Claims      int          `json:"claims"`
+	Outstanding models.Money `json:"outstanding"`
+
+	Pending   models.Money `json:"pending"` // not yet sent
+	Submitted models.Money `json:"submitted"`
+	Approved  models.Money `json:"approved"`
+
+	Current    models.Money `json:"current"` // 30 days or less
+	Days31To60 models.Money `json:"days_31_60"`
+	Days61To90 models.Money `json:"days_61_90"`
+	Over90     models.Money `json:"over_90"`
+
+	OldestAt *time.Time `json:"oldest_at,omitempty"`
+}
+
+type ReceivablesReport struct {
+	AsOf        time.Time            `json:"as_of"`
+	Claims      int                  `json:"claims"`
+	Outstanding models.Money         `json:"outstanding"`
+	Providers   []ProviderReceivable `json:"providers"`
+}
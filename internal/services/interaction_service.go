@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type InteractionService struct {
+	db *gorm.DB
+}
+
+func NewInteractionService(db *gorm.DB) *InteractionService {
+	return &InteractionService{db: db}
+}
+
+// InteractionWarning describes one interaction found during a check
+type InteractionWarning struct {
+	Key                     string                     `json:"key"`
+	Severity                models.InteractionSeverity `json:"severity"`
+	DrugA                   string                     `json:"drug_a"`
+	DrugB                   string                     `json:"drug_b"`
+	IngredientA             string                     `json:"ingredient_a"`
+	IngredientB             string                     `json:"ingredient_b"`
+	Description             string                     `json:"description"`
+	Management              string                     `json:"management,omitempty"`
+	Source                  string                     `json:"source"`
+	RequiresAcknowledgement bool                       `json:"requires_acknowledgement"`
+}
+
+// drugEntry is one medication taking part in a check
+type drugEntry struct {
+	label       string
+	text        string   // lowercase text searched for ingredient names
+	listed      []string // interacting drugs listed on the product label
+	isCurrent   bool     // already being taken by the customer
+	productName string
+}
+
+// CheckInteractions checks the given products and medication names against
+// each other and against the customer's current medications. Warnings are
+// returned most severe first.
+func (s *InteractionService) CheckInteractions(ctx context.Context, req InteractionCheckRequest) ([]InteractionWarning, error) {
+	var entries []drugEntry
+
+	if req.CustomerID != nil {
+		var customer models.Customer
+		if err := s.db.First(&customer, *req.CustomerID).Error; err != nil {
+			return nil, fmt.Errorf("customer not found: %w", err)
+		}
+		medications, err := customer.CurrentMedications.Get()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt current medications: %w", err)
+		}
+		for _, medication := range medications {
+			entries = append(entries, drugEntry{
+				label:     medication,
+				text:      strings.ToLower(medication),
+				isCurrent: true,
+			})
+		}
+	}
+
+	if len(req.ProductIDs) > 0 {
+		var products []models.Product
+		if err := s.db.Where("id IN ?", req.ProductIDs).Find(&products).Error; err != nil {
+			return nil, fmt.Errorf("failed to load products: %w", err)
+		}
+		for _, product := range products {
+			entries = append(entries, productDrugEntry(product))
+		}
+	}
+
+	for _, medication := range req.Medications {
+		if strings.TrimSpace(medication) == "" {
+			continue
+		}
+		entries = append(entries, drugEntry{
+			label: medication,
+			text:  strings.ToLower(medication),
+		})
+	}
+
+	return s.checkEntries(entries)
+}
+
+// Acknowledge records that a pharmacist reviewed the given warnings
+func (s *InteractionService) Acknowledge(ctx context.Context, req AcknowledgeInteractionsRequest) error {
+	now := time.Now().UTC()
+	for _, warning := range req.Warnings {
+		ack := &models.InteractionAcknowledgement{
+			CustomerID:     req.CustomerID,
+			SaleID:         req.SaleID,
+			OrderID:        req.OrderID,
+			InteractionKey: warning.Key,
+			Severity:       warning.Severity,
+			Notes:          req.Notes,
+			AcknowledgedBy: req.UserID,
+			AcknowledgedAt: now,
+		}
+		if err := s.db.Create(ack).Error; err != nil {
+			return fmt.Errorf("failed to record acknowledgement: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetOrderAcknowledgedKeys returns the interaction keys already acknowledged for an order
+func (s *InteractionService) GetOrderAcknowledgedKeys(ctx context.Context, orderID uuid.UUID) ([]string, error) {
+	var keys []string
+	err := s.db.Model(&models.InteractionAcknowledgement{}).
+		Where("order_id = ?", orderID).
+		Pluck("interaction_key", &keys).Error
+	return keys, err
+}
+
+// ListInteractions lists the interaction dataset, optionally filtered by ingredient
+func (s *InteractionService) ListInteractions(ctx context.Context, ingredient string, limit, offset int) ([]models.DrugInteraction, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.DrugInteraction{})
+	if ingredient != "" {
+		ingredient = strings.ToLower(strings.TrimSpace(ingredient))
+		query = query.Where("ingredient_a = ? OR ingredient_b = ?", ingredient, ingredient)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var interactions []models.DrugInteraction
+	err := query.Order("ingredient_a ASC, ingredient_b ASC").
+		Limit(limit).Offset(offset).Find(&interactions).Error
+	return interactions, total, err
+}
+
+// CreateInteraction adds an interaction to the dataset
+func (s *InteractionService) CreateInteraction(ctx context.Context, interaction *models.DrugInteraction) error {
+	if !interaction.Severity.IsValid() {
+		return fmt.Errorf("invalid severity: %s", interaction.Severity)
+	}
+	interaction.IngredientA, interaction.IngredientB = models.NormalizeIngredientPair(interaction.IngredientA, interaction.IngredientB)
+	if interaction.IngredientA == "" || interaction.IngredientB == "" || interaction.IngredientA == interaction.IngredientB {
+		return fmt.Errorf("two different ingredients are required")
+	}
+	return s.db.Create(interaction).Error
+}
+
+// UnacknowledgedWarnings returns the warnings that need acknowledgement and
+// whose keys are not in acknowledged
+func UnacknowledgedWarnings(warnings []InteractionWarning, acknowledged []string) []InteractionWarning {
+	ackSet := make(map[string]bool, len(acknowledged))
+	for _, key := range acknowledged {
+		ackSet[key] = true
+	}
+
+	var pending []InteractionWarning
+	for _, warning := range warnings {
+		if warning.RequiresAcknowledgement && !ackSet[warning.Key] {
+			pending = append(pending, warning)
+		}
+	}
+	return pending
+}
+
+// Private helper methods
+
+func (s *InteractionService) checkEntries(entries []drugEntry) ([]InteractionWarning, error) {
+	if len(entries) < 2 {
+		return []InteractionWarning{}, nil
+	}
+
+	// The curated dataset is small enough to hold in memory for each check
+	var interactions []models.DrugInteraction
+	if err := s.db.Find(&interactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load interaction data: %w", err)
+	}
+
+	byPair := make(map[string]models.DrugInteraction, len(interactions))
+	known := make(map[string]bool)
+	for _, interaction := range interactions {
+		byPair[interaction.IngredientA+"|"+interaction.IngredientB] = interaction
+		known[interaction.IngredientA] = true
+		known[interaction.IngredientB] = true
+	}
+
+	// Resolve each entry to the known ingredients it mentions
+	ingredients := make([][]string, len(entries))
+	for i, entry := range entries {
+		for name := range known {
+			if containsWord(entry.text, name) {
+				ingredients[i] = append(ingredients[i], name)
+			}
+		}
+	}
+
+	found := make(map[string]InteractionWarning)
+	for i := range entries {
+		for j := i + 1; j < len(entries); j++ {
+			// Interactions between existing medications are already managed
+			if entries[i].isCurrent && entries[j].isCurrent {
+				continue
+			}
+
+			for _, a := range ingredients[i] {
+				for _, b := range ingredients[j] {
+					ingredientA, ingredientB := models.NormalizeIngredientPair(a, b)
+					key := ingredientA + "|" + ingredientB
+					interaction, ok := byPair[key]
+					if !ok {
+						continue
+					}
+					if _, seen := found[key]; seen {
+						continue
+					}
+					found[key] = InteractionWarning{
+						Key:                     key,
+						Severity:                interaction.Severity,
+						DrugA:                   entries[i].label,
+						DrugB:                   entries[j].label,
+						IngredientA:             interaction.IngredientA,
+						IngredientB:             interaction.IngredientB,
+						Description:             interaction.Description,
+						Management:              interaction.Management,
+						Source:                  interaction.Source,
+						RequiresAcknowledgement: interaction.Severity.RequiresAcknowledgement(),
+					}
+				}
+			}
+
+			// Fall back to interactions listed on the product itself
+			s.addLabelWarnings(found, entries[i], entries[j])
+			s.addLabelWarnings(found, entries[j], entries[i])
+		}
+	}
+
+	warnings := make([]InteractionWarning, 0, len(found))
+	for _, warning := range found {
+		warnings = append(warnings, warning)
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Severity.Rank() != warnings[j].Severity.Rank() {
+			return warnings[i].Severity.Rank() > warnings[j].Severity.Rank()
+		}
+		return warnings[i].Key < warnings[j].Key
+	})
+
+	return warnings, nil
+}
+
+func (s *InteractionService) addLabelWarnings(found map[string]InteractionWarning, product, other drugEntry) {
+	for _, listed := range product.listed {
+		listed = strings.ToLower(strings.TrimSpace(listed))
+		if listed == "" || !containsWord(other.text, listed) {
+			continue
+		}
+		key := "label:" + strings.ToLower(product.productName) + "|" + listed
+		if _, seen := found[key]; seen {
+			continue
+		}
+		found[key] = InteractionWarning{
+			Key:         key,
+			Severity:    models.InteractionSeverityModerate,
+			DrugA:       product.label,
+			DrugB:       other.label,
+			IngredientA: product.productName,
+			IngredientB: listed,
+			Description: fmt.Sprintf("%s lists %s as an interacting drug", product.productName, listed),
+			Source:      "product_label",
+		}
+	}
+}
+
+func productDrugEntry(product models.Product) drugEntry {
+	parts := []string{product.Name}
+	if product.GenericName != nil {
+		parts = append(parts, *product.GenericName)
+	}
+	if product.ActiveIngredient != nil {
+		parts = append(parts, *product.ActiveIngredient)
+	}
+	return drugEntry{
+		label:       product.Name,
+		text:        strings.ToLower(strings.Join(parts, " ")),
+		listed:      product.DrugInteractions,
+		productName: product.Name,
+	}
+}
+
+// containsWord reports whether name appears in text on word boundaries
+func containsWord(text, name string) bool {
+	for start := 0; start < len(text); {
+		idx := strings.Index(text[start:], name)
+		if idx < 0 {
+			return false
+		}
+		idx += start
+		end := idx + len(name)
+		beforeOK := idx == 0 || !isWordChar(rune(text[idx-1]))
+		afterOK := end == len(text) || !isWordChar(rune(text[end]))
+		if beforeOK && afterOK {
+			return true
+		}
+		start = idx + 1
+	}
+	return false
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Request/Response types
+
+type InteractionCheckRequest struct {
+	CustomerID  *uuid.UUID  `json:"customer_id"`
+	ProductIDs  []uuid.UUID `json:"product_ids"`
+	Medications []string    `json:"medications"`
+}
+
+type AcknowledgeInteractionsRequest struct {
+	CustomerID *uuid.UUID
+	SaleID     *uuid.UUID
+	OrderID    *uuid.UUID
+	Warnings   []InteractionWarning
+	Notes      string
+	UserID     uuid.UUID
+}
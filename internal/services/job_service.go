@@ -0,0 +1,459 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnknownJobType = errors.New("unknown job type")
+	ErrJobNotDead     = errors.New("only dead jobs can be retried")
+)
+
+// jobLeaseSlack is added to the job timeout to give a worker time to record
+// the result before another worker may take the job over
+const jobLeaseSlack = time.Minute
+
+// JobHandler runs one job. The payload is the JSON the job was queued with.
+type JobHandler func(ctx context.Context, payload []byte) error
+
+// JobService queues background jobs, queues scheduled ones when their cron
+// expression comes due, and runs them on the workers with retries. Jobs that
+// fail every attempt are kept as dead for an admin to inspect and retry.
+type JobService struct {
+	db       *gorm.DB
+	config   config.JobConfig
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+func NewJobService(db *gorm.DB, cfg config.JobConfig) *JobService {
+	return &JobService{
+		db:       db,
+		config:   cfg,
+		handlers: map[string]JobHandler{},
+	}
+}
+
+// Register sets the handler for a job type
+func (s *JobService) Register(jobType string, handler JobHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[jobType] = handler
+}
+
+// Types lists the registered job types
+func (s *JobService) Types() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	types := make([]string, 0, len(s.handlers))
+	for jobType := range s.handlers {
+		types = append(types, jobType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Schedule creates or updates a named schedule that queues jobType on cron.
+// A changed expression takes effect from now.
+func (s *JobService) Schedule(ctx context.Context, name, jobType, cron string) error {
+	cronSchedule, err := ParseCron(cron)
+	if err != nil {
+		return fmt.Errorf("schedule %s: %w", name, err)
+	}
+	if _, ok := s.handler(jobType); !ok {
+		return fmt.Errorf("schedule %s: %w: %s", name, ErrUnknownJobType, jobType)
+	}
+
+	var schedule models.JobSchedule
+	err = s.db.WithContext(ctx).Where("name = ?", name).First(&schedule).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		schedule = models.JobSchedule{
+			Name:      name,
+			Type:      jobType,
+			Cron:      cron,
+			Enabled:   true,
+			NextRunAt: cronSchedule.Next(time.Now()),
+		}
+		err = s.db.WithContext(ctx).Create(&schedule).Error
+	case err == nil && (schedule.Cron != cron || schedule.Type != jobType):
+		err = s.db.WithContext(ctx).Model(&schedule).Updates(map[string]interface{}{
+			"type":        jobType,
+			"cron":        cron,
+			"next_run_at": cronSchedule.Next(time.Now()),
+		}).Error
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save schedule %s: %w", name, err)
+	}
+	return nil
+}
+
+// Enqueue queues a job to run as soon as a worker is free
+func (s *JobService) Enqueue(ctx context.Context, jobType string, payload interface{}) (*models.Job, error) {
+	return s.EnqueueTx(s.db.WithContext(ctx), jobType, payload)
+}
+
+// EnqueueTx queues a job in tx, so it only runs if tx commits
+func (s *JobService) EnqueueTx(tx *gorm.DB, jobType string, payload interface{}) (*models.Job, error) {
+	if _, ok := s.handler(jobType); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJobType, jobType)
+	}
+	return s.create(tx, jobType, "", payload)
+}
+
+// RunWorkers queues due schedules and runs due jobs, up to the configured
+// concurrency at a time, until ctx is done
+func (s *JobService) RunWorkers(ctx context.Context) {
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	var lastPrune time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Jobs already claimed run to the end on shutdown rather than
+			// waiting out their lease to be retried
+			work := lifecycle.WorkContext(ctx)
+			if err := s.queueSchedules(work); err != nil {
+				logrus.WithError(err).Error("Failed to queue scheduled jobs")
+			}
+			if err := s.RunDue(work); err != nil {
+				logrus.WithError(err).Error("Failed to run jobs")
+			}
+			if time.Since(lastPrune) > time.Hour {
+				lastPrune = time.Now()
+				if pruned, err := s.PruneCompleted(work); err != nil {
+					logrus.WithError(err).Error("Failed to prune completed jobs")
+				} else if pruned > 0 {
+					logrus.WithField("pruned", pruned).Info("Pruned completed jobs")
+				}
+			}
+		}
+	}
+}
+
+// RunDue claims up to the configured concurrency of due jobs and runs them,
+// returning when they have all finished. Jobs whose worker stopped
+// mid-run are due again once their lease has passed.
+func (s *JobService) RunDue(ctx context.Context) error {
+	concurrency := s.config.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	var due []models.Job
+	if err := s.db.WithContext(ctx).
+		Where("status IN ? AND run_at <= ?", []models.JobStatus{models.JobPending, models.JobRunning}, time.Now().UTC()).
+		Order("run_at ASC").Limit(concurrency).
+		Find(&due).Error; err != nil {
+		return fmt.Errorf("failed to load due jobs: %w", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range due {
+		job := &due[i]
+		claimed, err := s.claim(ctx, job)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.run(ctx, job)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// PruneCompleted deletes completed jobs older than the retention period.
+// Dead jobs are kept until they are retried.
+func (s *JobService) PruneCompleted(ctx context.Context) (int64, error) {
+	if s.config.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -s.config.RetentionDays)
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("status = ? AND completed_at < ?", models.JobCompleted, cutoff).
+		Delete(&models.Job{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// ListJobs returns jobs, newest first, optionally filtered by status and
+// type
+func (s *JobService) ListJobs(ctx context.Context, status, jobType string, limit, offset int) ([]models.Job, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.Job{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	var jobs []models.Job
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&jobs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load jobs: %w", err)
+	}
+	return jobs, total, nil
+}
+
+// Depth counts jobs waiting to run and jobs that failed every attempt
+func (s *JobService) Depth(ctx context.Context) (pending, dead int64, err error) {
+	counts, err := countByStatus(s.db.WithContext(ctx).Model(&models.Job{}))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	return counts[string(models.JobPending)], counts[string(models.JobDead)], nil
+}
+
+func (s *JobService) GetJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	var job models.Job
+	if err := s.db.WithContext(ctx).First(&job, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("job: %w", err)
+	}
+	return &job, nil
+}
+
+// RetryJob queues a dead job to run again with a fresh set of attempts
+func (s *JobService) RetryJob(ctx context.Context, id uuid.UUID) (*models.Job, error) {
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != models.JobDead {
+		return nil, ErrJobNotDead
+	}
+
+	job.Status = models.JobPending
+	job.Attempts = 0
+	job.RunAt = time.Now().UTC()
+	if err := s.db.WithContext(ctx).Save(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to retry job: %w", err)
+	}
+	return job, nil
+}
+
+func (s *JobService) ListSchedules(ctx context.Context) ([]models.JobSchedule, error) {
+	var schedules []models.JobSchedule
+	if err := s.db.WithContext(ctx).Order("name ASC").Find(&schedules).Error; err != nil {
+		return nil, fmt.Errorf("failed to load job schedules: %w", err)
+	}
+	return schedules, nil
+}
+
+// SetScheduleEnabled pauses or resumes a schedule. A resumed schedule next
+// runs when its expression next comes due, not for the runs it missed.
+func (s *JobService) SetScheduleEnabled(ctx context.Context, name string, enabled bool) (*models.JobSchedule, error) {
+	var schedule models.JobSchedule
+	if err := s.db.WithContext(ctx).Where("name = ?", name).First(&schedule).Error; err != nil {
+		return nil, fmt.Errorf("job schedule: %w", err)
+	}
+
+	updates := map[string]interface{}{"enabled": enabled}
+	if enabled && !schedule.Enabled {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, err
+		}
+		updates["next_run_at"] = cron.Next(time.Now())
+	}
+	if err := s.db.WithContext(ctx).Model(&schedule).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update job schedule: %w", err)
+	}
+	return &schedule, nil
+}
+
+// Private helper methods
+
+func (s *JobService) handler(jobType string) (JobHandler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	handler, ok := s.handlers[jobType]
+	return handler, ok
+}
+
+func (s *JobService) create(tx *gorm.DB, jobType, schedule string, payload interface{}) (*models.Job, error) {
+	job := &models.Job{
+		Type:        jobType,
+		Status:      models.JobPending,
+		Schedule:    schedule,
+		MaxAttempts: s.config.MaxAttempts,
+		RunAt:       time.Now().UTC(),
+	}
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode job payload: %w", err)
+		}
+		job.Payload = string(data)
+	}
+	if err := tx.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue job: %w", err)
+	}
+	return job, nil
+}
+
+// queueSchedules queues a job for each enabled schedule that has come due.
+// Moving a schedule's next run is conditional on the run it saw, so each
+// run is queued by only one server.
+func (s *JobService) queueSchedules(ctx context.Context) error {
+	var schedules []models.JobSchedule
+	now := time.Now().UTC()
+	if err := s.db.WithContext(ctx).Where("enabled = ? AND next_run_at <= ?", true, now).
+		Find(&schedules).Error; err != nil {
+		return fmt.Errorf("failed to load job schedules: %w", err)
+	}
+
+	for _, schedule := range schedules {
+		cron, err := ParseCron(schedule.Cron)
+		if err != nil {
+			logrus.WithError(err).WithField("schedule", schedule.Name).Error("Skipping job schedule")
+			continue
+		}
+
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.JobSchedule{}).
+				Where("id = ? AND next_run_at = ?", schedule.ID, schedule.NextRunAt).
+				Updates(map[string]interface{}{"next_run_at": cron.Next(now), "last_run_at": now})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			_, err := s.create(tx, schedule.Type, schedule.Name, nil)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to queue schedule %s: %w", schedule.Name, err)
+		}
+	}
+	return nil
+}
+
+// claim takes a due job and leases it for the job timeout. It reports false
+// when another worker took it first.
+func (s *JobService) claim(ctx context.Context, job *models.Job) (bool, error) {
+	now := time.Now().UTC()
+	result := s.db.WithContext(ctx).Model(&models.Job{}).
+		Where("id = ? AND status = ? AND run_at = ?", job.ID, job.Status, job.RunAt).
+		Updates(map[string]interface{}{
+			"status":     models.JobRunning,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"run_at":     now.Add(s.config.Timeout + jobLeaseSlack),
+			"started_at": now,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim job: %w", result.Error)
+	}
+	job.Attempts++
+	return result.RowsAffected == 1, nil
+}
+
+// run runs a claimed job and records the outcome: completed, retried with
+// backoff, or dead after the last attempt
+func (s *JobService) run(ctx context.Context, job *models.Job) {
+	err := s.call(ctx, job)
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{}
+	log := logrus.WithFields(logrus.Fields{"job_id": job.ID, "type": job.Type, "attempt": job.Attempts})
+	switch {
+	case err == nil:
+		updates["status"] = models.JobCompleted
+		updates["completed_at"] = now
+		updates["last_error"] = ""
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = models.JobDead
+		updates["last_error"] = err.Error()
+		log.WithError(err).Error("Job failed after the maximum attempts")
+	default:
+		updates["status"] = models.JobPending
+		updates["run_at"] = now.Add(retryBackoff(job.Attempts))
+		updates["last_error"] = err.Error()
+		log.WithError(err).Warn("Job failed, retrying")
+	}
+
+	// The result is recorded even when ctx was cancelled mid-job
+	if err := s.db.Model(&models.Job{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+		log.WithError(err).Error("Failed to record job result")
+	}
+}
+
+// call runs the job's handler under the job timeout, turning a panic into
+// an error
+func (s *JobService) call(ctx context.Context, job *models.Job) (err error) {
+	handler, ok := s.handler(job.Type)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJobType, job.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, []byte(job.Payload))
+}
+
+// countByStatus counts a queue table's rows by status
+func countByStatus(query *gorm.DB) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := query.Select("status, COUNT(*) AS count").Group("status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// Request/Response types
+
+type EnqueueJobRequest struct {
+	Type    string          `json:"type" binding:"required"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type UpdateJobScheduleRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
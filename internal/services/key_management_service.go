@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrKeyManagementDisabled is returned when ENCRYPTION_KEY_MANAGEMENT is off
+var ErrKeyManagementDisabled = errors.New("encryption key management is not enabled")
+
+// encryptedColumn is a column holding EncryptedString or
+// EncryptedStringArray values
+type encryptedColumn struct {
+	model  interface{}
+	table  string
+	column string
+}
+
+// encryptedColumns lists every encrypted column the re-encryption job rotates
+var encryptedColumns = []encryptedColumn{
+	{&models.Customer{}, "customers", "medical_history"},
+	{&models.Customer{}, "customers", "allergies"},
+	{&models.Customer{}, "customers", "current_medications"},
+	{&models.Customer{}, "customers", "blood_type"},
+	{&models.Customer{}, "customers", "insurance_provider"},
+	{&models.Customer{}, "customers", "insurance_number"},
+	{&models.Customer{}, "customers", "senior_citizen_id"},
+	{&models.Customer{}, "customers", "pwd_id"},
+	{&models.OnlineOrder{}, "online_orders", "delivery_address"},
+	{&models.PrescriptionUpload{}, "prescription_uploads", "storage_path"},
+	{&models.PrescriptionUpload{}, "prescription_uploads", "cloud_url"},
+	{&models.PrescriptionUpload{}, "prescription_uploads", "ocr_text"},
+	{&models.PrescriptionUpload{}, "prescription_uploads", "ocr_suggestions"},
+	{&models.ClinicalNote{}, "clinical_notes", "note"},
+	{&models.ClinicalNote{}, "clinical_notes", "outcome_notes"},
+}
+
+// KeyManagementService creates, rotates and loads the data keys behind
+// encrypted columns, and re-encrypts values written under retired keys
+type KeyManagementService struct {
+	db       *gorm.DB
+	provider MasterKeyProvider
+	config   config.EncryptionConfig
+}
+
+func NewKeyManagementService(db *gorm.DB, provider MasterKeyProvider, cfg config.EncryptionConfig) *KeyManagementService {
+	return &KeyManagementService{db: db, provider: provider, config: cfg}
+}
+
+// LoadKeys unwraps every data key into the keyring and encrypts new values
+// with the active one. The first call creates key v1.
+func (s *KeyManagementService) LoadKeys(ctx context.Context) error {
+	if !s.config.KeyManagement {
+		return ErrKeyManagementDisabled
+	}
+
+	utils.SetDataKeyLoader(s.loadKey)
+
+	var keys []models.EncryptionKey
+	if err := s.db.WithContext(ctx).Order("version").Find(&keys).Error; err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	if len(keys) == 0 {
+		_, err := s.RotateDataKey(ctx)
+		return err
+	}
+
+	dataKeys := make(map[string][]byte, len(keys))
+	currentID := ""
+	for _, key := range keys {
+		dataKey, err := s.provider.Unwrap(ctx, key.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("failed to unwrap encryption key %s: %w", key.KeyID, err)
+		}
+		dataKeys[key.KeyID] = dataKey
+		if key.Active {
+			currentID = key.KeyID
+		}
+	}
+	if currentID == "" {
+		return fmt.Errorf("no active encryption key")
+	}
+	return utils.SetDataKeys(dataKeys, currentID)
+}
+
+// RotateDataKey creates a new data key and makes it the one new values are
+// encrypted with. Existing values stay readable and are moved to the new key
+// by ReencryptStale.
+func (s *KeyManagementService) RotateDataKey(ctx context.Context) (*models.EncryptionKey, error) {
+	if !s.config.KeyManagement {
+		return nil, ErrKeyManagementDisabled
+	}
+
+	dataKey := make([]byte, utils.DataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := s.provider.Wrap(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	var key models.EncryptionKey
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.EncryptionKey{}).Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.EncryptionKey{}).Where("active = ?", true).
+			Updates(map[string]interface{}{"active": false, "retired_at": now}).Error; err != nil {
+			return err
+		}
+
+		key = models.EncryptionKey{
+			KeyID:      fmt.Sprintf("v%d", latest+1),
+			Version:    latest + 1,
+			WrappedKey: wrapped,
+			Provider:   s.provider.Name(),
+			Active:     true,
+		}
+		return tx.Create(&key).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store encryption key: %w", err)
+	}
+
+	if err := utils.SetDataKeys(map[string][]byte{key.KeyID: dataKey}, key.KeyID); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// RewrapDataKeys wraps every data key again with the configured master key,
+// e.g. after rotating the Vault transit key or moving to a new KMS key. The
+// data keys themselves, and so the encrypted data, are unchanged.
+func (s *KeyManagementService) RewrapDataKeys(ctx context.Context) (int, error) {
+	if !s.config.KeyManagement {
+		return 0, ErrKeyManagementDisabled
+	}
+
+	var keys []models.EncryptionKey
+	if err := s.db.WithContext(ctx).Order("version").Find(&keys).Error; err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		dataKey, err := s.provider.Unwrap(ctx, key.WrappedKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to unwrap encryption key %s: %w", key.KeyID, err)
+		}
+		wrapped, err := s.provider.Wrap(ctx, dataKey)
+		if err != nil {
+			return 0, fmt.Errorf("failed to wrap encryption key %s: %w", key.KeyID, err)
+		}
+		if err := s.db.WithContext(ctx).Model(&models.EncryptionKey{}).Where("id = ?", key.ID).
+			Updates(map[string]interface{}{"wrapped_key": wrapped, "provider": s.provider.Name()}).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// ReencryptStale moves up to the configured batch size of values per column
+// from retired keys (or the pre-key-management ENCRYPTION_KEY) to the
+// active key. A row changed by someone else meanwhile is left for the next
+// run.
+func (s *KeyManagementService) ReencryptStale(ctx context.Context) (*ReencryptResult, error) {
+	if !s.config.KeyManagement {
+		return nil, ErrKeyManagementDisabled
+	}
+
+	currentID := utils.CurrentKeyID()
+	result := &ReencryptResult{KeyID: currentID}
+	batchSize := s.config.ReencryptBatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	for _, col := range encryptedColumns {
+		var rows []struct {
+			ID    uuid.UUID
+			Value string
+		}
+		if err := s.staleValues(ctx, col, currentID).
+			Select("id, " + col.column + " AS value").
+			Limit(batchSize).
+			Scan(&rows).Error; err != nil {
+			return result, fmt.Errorf("failed to read %s.%s: %w", col.table, col.column, err)
+		}
+
+		for _, row := range rows {
+			reencrypted, changed, err := utils.Reencrypt(row.Value)
+			if err != nil {
+				result.Failed++
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"table":  col.table,
+					"column": col.column,
+					"id":     row.ID,
+				}).Warn("Failed to re-encrypt value")
+				continue
+			}
+			if !changed {
+				continue
+			}
+
+			// Only replace the value that was read, so a concurrent edit wins
+			update := s.db.WithContext(ctx).Model(col.model).
+				Where("id = ? AND "+col.column+" = ?", row.ID, row.Value).
+				UpdateColumn(col.column, reencrypted)
+			if update.Error != nil {
+				return result, fmt.Errorf("failed to update %s.%s: %w", col.table, col.column, update.Error)
+			}
+			result.Reencrypted += int(update.RowsAffected)
+		}
+	}
+
+	remaining, err := s.countStale(ctx, currentID)
+	if err != nil {
+		return result, err
+	}
+	result.Remaining = remaining
+	return result, nil
+}
+
+// RunReencryption picks up keys rotated on other servers and re-encrypts
+// stale values in the background until ctx is done
+func (s *KeyManagementService) RunReencryption(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReencryptInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			work := lifecycle.WorkContext(ctx)
+			if err := s.LoadKeys(work); err != nil {
+				logrus.WithError(err).Error("Failed to reload encryption keys")
+				continue
+			}
+			result, err := s.ReencryptStale(work)
+			if err != nil {
+				logrus.WithError(err).Error("Failed to re-encrypt data")
+				continue
+			}
+			if result.Reencrypted > 0 || result.Failed > 0 {
+				logrus.WithFields(logrus.Fields{
+					"key_id":      result.KeyID,
+					"reencrypted": result.Reencrypted,
+					"failed":      result.Failed,
+					"remaining":   result.Remaining,
+				}).Info("Re-encrypted data under the active key")
+			}
+		}
+	}
+}
+
+// KeyStatus lists the data keys and how many values still need re-encrypting
+func (s *KeyManagementService) KeyStatus(ctx context.Context) (*KeyStatus, error) {
+	if !s.config.KeyManagement {
+		return nil, ErrKeyManagementDisabled
+	}
+
+	status := &KeyStatus{
+		Provider:  s.provider.Name(),
+		CurrentID: utils.CurrentKeyID(),
+	}
+	if err := s.db.WithContext(ctx).Order("version DESC").Find(&status.Keys).Error; err != nil {
+		return nil, err
+	}
+	stale, err := s.countStale(ctx, status.CurrentID)
+	if err != nil {
+		return nil, err
+	}
+	status.StaleValues = stale
+	return status, nil
+}
+
+// Private helper methods
+
+// loadKey fetches a data key created by another server since LoadKeys ran
+func (s *KeyManagementService) loadKey(keyID string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var key models.EncryptionKey
+	if err := s.db.WithContext(ctx).Where("key_id = ?", keyID).First(&key).Error; err != nil {
+		return nil, err
+	}
+	return s.provider.Unwrap(ctx, key.WrappedKey)
+}
+
+// staleValues selects the non-empty values of col not written with currentID
+func (s *KeyManagementService) staleValues(ctx context.Context, col encryptedColumn, currentID string) *gorm.DB {
+	return s.db.WithContext(ctx).Model(col.model).
+		Where(col.column+" IS NOT NULL AND "+col.column+" <> '' AND "+col.column+" NOT LIKE ?", currentID+":%")
+}
+
+func (s *KeyManagementService) countStale(ctx context.Context, currentID string) (int64, error) {
+	var total int64
+	for _, col := range encryptedColumns {
+		var count int64
+		if err := s.staleValues(ctx, col, currentID).Count(&count).Error; err != nil {
+			return 0, fmt.Errorf("failed to count %s.%s: %w", col.table, col.column, err)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// Request/Response types
+
+type ReencryptResult struct {
+	KeyID       string `json:"key_id"`
+	Reencrypted int    `json:"reencrypted"`
+	Failed      int    `json:"failed"`
+	Remaining   int64  `json:"remaining"` // values still under retired keys
+}
+
+type KeyStatus struct {
+	Provider    string                 `json:"provider"`
+	CurrentID   string                 `json:"current_key_id"`
+	Keys        []models.EncryptionKey `json:"keys"`
+	StaleValues int64                  `json:"stale_values"`
+}
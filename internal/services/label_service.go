@@ -0,0 +1,222 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNothingToLabel       = errors.New("no dispensed products to label")
+	ErrPreparationUnlabeled = errors.New("the preparation is labeled once it is completed")
+)
+
+type LabelService struct {
+	db       *gorm.DB
+	pharmacy labels.Pharmacy
+}
+
+func NewLabelService(db *gorm.DB, cfg config.PharmacyConfig) *LabelService {
+	return &LabelService{
+		db: db,
+		pharmacy: labels.Pharmacy{
+			Name:          cfg.Name,
+			Address:       cfg.Address,
+			Phone:         cfg.Phone,
+			LicenseNumber: cfg.LicenseNumber,
+		},
+	}
+}
+
+// SaleLabels builds a dispensing label for each product line of a sale.
+// Pass itemID to print a single line.
+func (s *LabelService) SaleLabels(ctx context.Context, saleID uuid.UUID, itemID *uuid.UUID) ([]labels.Label, error) {
+	var sale models.Sale
+	if err := s.db.Preload("Customer", WithDeleted).Preload("Pharmacist").Preload("SaleItems.Product", WithDeleted).
+		Preload("SaleItems.Preparation.Formula").Preload("SaleItems.Preparation.Ingredients.Product", WithDeleted).
+		First(&sale, saleID).Error; err != nil {
+		return nil, fmt.Errorf("sale not found: %w", err)
+	}
+
+	patient := "Walk-in customer"
+	if sale.Customer != nil {
+		patient = sale.Customer.FirstName + " " + sale.Customer.LastName
+	}
+	pharmacist := ""
+	if sale.Pharmacist != nil {
+		pharmacist = sale.Pharmacist.FirstName + " " + sale.Pharmacist.LastName
+	}
+
+	var result []labels.Label
+	for _, item := range sale.SaleItems {
+		if itemID != nil && item.ID != *itemID {
+			continue
+		}
+		if item.Preparation != nil {
+			label := s.preparationLabel(*item.Preparation, sale.SaleNumber, patient, pharmacist, sale.CreatedAt)
+			if item.Instructions != nil {
+				label.Instructions = *item.Instructions
+			}
+			result = append(result, label)
+			continue
+		}
+		if item.Product == nil {
+			continue
+		}
+		label := s.baseLabel(*item.Product, sale.SaleNumber, patient, pharmacist, sale.CreatedAt)
+		label.Quantity = item.Quantity
+		label.Dosage = derefString(item.Dosage)
+		label.Instructions = derefString(item.Instructions)
+		label.Duration = derefString(item.Duration)
+		if item.BatchNumber != "" {
+			label.BatchNumber = item.BatchNumber
+		}
+		if item.ExpiryDate != nil {
+			label.ExpiryDate = item.ExpiryDate
+		}
+		result = append(result, label)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNothingToLabel
+	}
+	return result, nil
+}
+
+// OrderLabels builds a dispensing label for each item of an online order.
+// Pass itemID to print a single line.
+func (s *LabelService) OrderLabels(ctx context.Context, orderID uuid.UUID, itemID *uuid.UUID) ([]labels.Label, error) {
+	var order models.OnlineOrder
+	if err := s.db.Preload("Customer", WithDeleted).Preload("Pharmacist").Preload("OrderItems.Product", WithDeleted).
+		First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+
+	patient := ""
+	if order.Customer != nil {
+		patient = order.Customer.FirstName + " " + order.Customer.LastName
+	} else if order.GuestName != nil {
+		patient = *order.GuestName
+	}
+	pharmacist := ""
+	if order.Pharmacist != nil {
+		pharmacist = order.Pharmacist.FirstName + " " + order.Pharmacist.LastName
+	}
+
+	var result []labels.Label
+	for _, item := range order.OrderItems {
+		if itemID != nil && item.ID != *itemID {
+			continue
+		}
+		if item.Status == models.ItemStatusCancelled || item.Status == models.ItemStatusOutOfStock {
+			continue
+		}
+		label := s.baseLabel(item.Product, order.OrderNumber, patient, pharmacist, time.Now())
+		label.Quantity = item.Quantity
+		label.Dosage = derefString(item.Dosage)
+		label.Instructions = derefString(item.Instructions)
+		label.Duration = derefString(item.Duration)
+		result = append(result, label)
+	}
+
+	if len(result) == 0 {
+		return nil, ErrNothingToLabel
+	}
+	return result, nil
+}
+
+// PreparationLabel builds the label a compounded preparation is put up
+// with once it is made
+func (s *LabelService) PreparationLabel(ctx context.Context, preparationID uuid.UUID) ([]labels.Label, error) {
+	var preparation models.CompoundPreparation
+	if err := s.db.Preload("Customer", WithDeleted).Preload("Formula").Preload("Ingredients.Product", WithDeleted).
+		First(&preparation, preparationID).Error; err != nil {
+		return nil, fmt.Errorf("preparation not found: %w", err)
+	}
+	if preparation.PreparedAt == nil {
+		return nil, ErrPreparationUnlabeled
+	}
+
+	patient := ""
+	if preparation.Customer != nil {
+		patient = preparation.Customer.FirstName + " " + preparation.Customer.LastName
+	}
+	pharmacist := ""
+	if preparation.PreparedBy != nil {
+		var user models.User
+		if err := s.db.Select("first_name", "last_name").First(&user, *preparation.PreparedBy).Error; err == nil {
+			pharmacist = user.FirstName + " " + user.LastName
+		}
+	}
+
+	reference := preparation.PreparationNumber
+	if preparation.PrescriptionNumber != nil && *preparation.PrescriptionNumber != "" {
+		reference = "Rx " + *preparation.PrescriptionNumber
+	}
+	return []labels.Label{s.preparationLabel(preparation, reference, patient, pharmacist, *preparation.PreparedAt)}, nil
+}
+
+// Private helper methods
+
+// preparationLabel labels a compounded preparation with its formula, the
+// ingredients it was made from, its lot number and beyond-use date
+func (s *LabelService) preparationLabel(preparation models.CompoundPreparation, reference, patient, pharmacist string, dispensedAt time.Time) labels.Label {
+	label := labels.Label{
+		Pharmacy:    s.pharmacy,
+		Reference:   reference,
+		PatientName: patient,
+		Quantity:    1,
+		BatchNumber: preparation.PreparationNumber,
+		ExpiryDate:  preparation.BeyondUseDate,
+		DispensedAt: dispensedAt,
+		Pharmacist:  pharmacist,
+		Compounded:  true,
+	}
+	if formula := preparation.Formula; formula != nil {
+		label.DrugName = formula.Name
+		label.Strength = derefString(formula.Strength)
+		label.Form = formula.DosageForm
+		label.Unit = fmt.Sprintf("x %d %s", formula.YieldQuantity*preparation.Batches, formula.YieldUnit)
+		label.Instructions = derefString(formula.Instructions)
+		label.Prescription = formula.PrescriptionRequired
+	}
+	if preparation.Instructions != nil {
+		label.Instructions = *preparation.Instructions
+	}
+	for _, ingredient := range preparation.Ingredients {
+		if ingredient.Product != nil {
+			label.Ingredients = append(label.Ingredients, ingredient.Product.Name)
+		}
+	}
+	return label
+}
+
+func (s *LabelService) baseLabel(product models.Product, reference, patient, pharmacist string, dispensedAt time.Time) labels.Label {
+	label := labels.Label{
+		Pharmacy:     s.pharmacy,
+		Reference:    reference,
+		PatientName:  patient,
+		DrugName:     product.Name,
+		GenericName:  derefString(product.GenericName),
+		Strength:     derefString(product.Dosage),
+		Form:         derefString(product.Form),
+		Unit:         product.Unit,
+		BatchNumber:  product.BatchNumber,
+		DispensedAt:  dispensedAt,
+		Pharmacist:   pharmacist,
+		Prescription: product.PrescriptionRequired,
+	}
+	if !product.ExpiryDate.IsZero() {
+		expiry := product.ExpiryDate.Time
+		label.ExpiryDate = &expiry
+	}
+	return label
+}
@@ -0,0 +1,591 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tierWindowDays is the rolling window tier spend is measured over
+const tierWindowDays = 365
+
+// LoyaltyService awards points and keeps customers in the tier their rolling
+// 12-month spend qualifies them for. Spend and points from a dependent's
+// purchases count towards their guardian's account.
+type LoyaltyService struct {
+	db     *gorm.DB
+	config config.LoyaltyConfig
+}
+
+func NewLoyaltyService(db *gorm.DB, cfg config.LoyaltyConfig) *LoyaltyService {
+	return &LoyaltyService{
+		db:     db,
+		config: cfg,
+	}
+}
+
+// Tiers
+
+// GetTiers returns all tiers from lowest to highest
+func (s *LoyaltyService) GetTiers(ctx context.Context) ([]models.LoyaltyTier, error) {
+	var tiers []models.LoyaltyTier
+	if err := s.db.Order("min_spend ASC").Find(&tiers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load loyalty tiers: %w", err)
+	}
+	return tiers, nil
+}
+
+// UpdateTier changes a tier's threshold or benefits. Customers are moved to
+// their new tier on the next recalculation.
+func (s *LoyaltyService) UpdateTier(ctx context.Context, code string, req UpdateLoyaltyTierRequest) (*models.LoyaltyTier, error) {
+	var tier models.LoyaltyTier
+	if err := s.db.Where("code = ?", code).First(&tier).Error; err != nil {
+		return nil, fmt.Errorf("loyalty tier not found: %w", err)
+	}
+
+	if req.Name != nil {
+		tier.Name = *req.Name
+	}
+	if req.MinSpend != nil {
+		if *req.MinSpend < 0 {
+			return nil, fmt.Errorf("minimum spend cannot be negative")
+		}
+		tier.MinSpend = *req.MinSpend
+	}
+	if req.PointsMultiplier != nil {
+		if *req.PointsMultiplier <= 0 {
+			return nil, fmt.Errorf("points multiplier must be greater than zero")
+		}
+		tier.PointsMultiplier = *req.PointsMultiplier
+	}
+	if req.FreeDelivery != nil {
+		tier.FreeDelivery = *req.FreeDelivery
+	}
+	if req.FreeDeliveryMinOrder != nil {
+		if *req.FreeDeliveryMinOrder < 0 {
+			return nil, fmt.Errorf("free delivery minimum order cannot be negative")
+		}
+		tier.FreeDeliveryMinOrder = *req.FreeDeliveryMinOrder
+	}
+
+	if err := s.db.Save(&tier).Error; err != nil {
+		return nil, fmt.Errorf("failed to update loyalty tier: %w", err)
+	}
+	return &tier, nil
+}
+
+// Points
+
+// AwardSale earns points for a completed in-store sale. Awarding the same
+// sale twice is a no-op.
+func (s *LoyaltyService) AwardSale(ctx context.Context, sale *models.Sale) error {
+	holderID := loyaltyHolder(sale.CustomerID, sale.GuardianID)
+	if holderID == nil {
+		return nil
+	}
+	return s.award(*holderID, models.LoyaltyEarnedSale, sale.ID, sale.Total, sale.SaleNumber)
+}
+
+// AwardOrder earns points for a fulfilled online order. Delivery fees do not
+// earn points. Awarding the same order twice is a no-op.
+func (s *LoyaltyService) AwardOrder(ctx context.Context, orderID uuid.UUID) error {
+	var order models.OnlineOrder
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		return fmt.Errorf("order not found: %w", err)
+	}
+
+	holderID := loyaltyHolder(order.CustomerID, order.GuardianID)
+	if holderID == nil {
+		return nil
+	}
+	return s.award(*holderID, models.LoyaltyEarnedOrder, order.ID, order.Total-order.DeliveryFee, order.OrderNumber)
+}
+
+// AdjustPoints adds or removes points by hand, e.g. for a goodwill credit
+func (s *LoyaltyService) AdjustPoints(ctx context.Context, customerID uuid.UUID, req AdjustPointsRequest) (*models.LoyaltyTransaction, error) {
+	if req.Points == 0 {
+		return nil, fmt.Errorf("points must not be zero")
+	}
+
+	var customer models.Customer
+	if err := s.db.Select("id", "guardian_id", "loyalty_points", "loyalty_tier").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.GuardianID != nil {
+		return nil, fmt.Errorf("dependents do not hold points; adjust the guardian's account instead")
+	}
+	if customer.LoyaltyPoints+req.Points < 0 {
+		return nil, fmt.Errorf("adjustment would leave a negative balance")
+	}
+
+	entry := &models.LoyaltyTransaction{
+		CustomerID: customerID,
+		Type:       models.LoyaltyAdjustment,
+		Points:     req.Points,
+		Multiplier: 1,
+		Tier:       customer.LoyaltyTier,
+		Notes:      req.Notes,
+		CreatedBy:  req.CreatedBy,
+		OccurredAt: time.Now(),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Customer{}).Where("id = ?", customerID).
+			Update("loyalty_points", gorm.Expr("loyalty_points + ?", req.Points)).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to adjust points: %w", err)
+	}
+	return entry, nil
+}
+
+// GetCustomerLoyalty returns a customer's points, tier, progress towards the
+// next tier and recent points activity
+func (s *LoyaltyService) GetCustomerLoyalty(ctx context.Context, customerID uuid.UUID) (*CustomerLoyalty, error) {
+	var customer models.Customer
+	if err := s.db.Select("id", "guardian_id", "loyalty_points", "loyalty_tier", "tier_spend", "tier_updated_at").
+		First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	tiers, err := s.GetTiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CustomerLoyalty{
+		CustomerID:    customer.ID,
+		Points:        customer.LoyaltyPoints,
+		TierSpend:     customer.TierSpend,
+		TierUpdatedAt: customer.TierUpdatedAt,
+		AccountHolder: customer.ID,
+		Transactions:  []models.LoyaltyTransaction{},
+	}
+	if customer.GuardianID != nil {
+		result.AccountHolder = *customer.GuardianID
+	}
+
+	for i := range tiers {
+		if tiers[i].Code == customer.LoyaltyTier {
+			result.Tier = &tiers[i]
+		}
+		if result.NextTier == nil && tiers[i].MinSpend > customer.TierSpend {
+			result.NextTier = &tiers[i]
+			result.SpendToNextTier = tiers[i].MinSpend - customer.TierSpend
+		}
+	}
+
+	if err := s.db.Where("customer_id = ?", customerID).
+		Order("occurred_at DESC").Limit(20).
+		Find(&result.Transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load points activity: %w", err)
+	}
+
+	return result, nil
+}
+
+// GrantPoints adds a fixed number of points as a reward with tx, once per
+// type and reference. It reports whether they were granted.
+func (s *LoyaltyService) GrantPoints(tx *gorm.DB, customerID uuid.UUID, txType models.LoyaltyTransactionType, referenceID uuid.UUID, points int, notes string) (bool, error) {
+	if points <= 0 {
+		return false, nil
+	}
+
+	var holder models.Customer
+	if err := tx.Select("id", "loyalty_tier").First(&holder, customerID).Error; err != nil {
+		return false, fmt.Errorf("customer not found: %w", err)
+	}
+	entry := &models.LoyaltyTransaction{
+		CustomerID:  customerID,
+		Type:        txType,
+		ReferenceID: &referenceID,
+		Points:      points,
+		Multiplier:  1,
+		Tier:        holder.LoyaltyTier,
+		Notes:       notes,
+		OccurredAt:  time.Now(),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	if err := tx.Model(&models.Customer{}).Where("id = ?", customerID).
+		Update("loyalty_points", gorm.Expr("loyalty_points + ?", points)).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Store credit
+
+// GrantCredit adds store credit as a reward with tx, once per type and
+// reference. It reports whether it was granted.
+func (s *LoyaltyService) GrantCredit(tx *gorm.DB, customerID uuid.UUID, txType models.LoyaltyTransactionType, referenceID uuid.UUID, amount models.Money, notes string) (bool, error) {
+	if amount <= 0 {
+		return false, nil
+	}
+
+	entry := &models.CreditTransaction{
+		CustomerID:  customerID,
+		Type:        txType,
+		ReferenceID: &referenceID,
+		Amount:      amount,
+		Notes:       notes,
+		OccurredAt:  time.Now(),
+	}
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// AdjustCredit adds or removes store credit by hand, e.g. when it is spent
+// or refunded
+func (s *LoyaltyService) AdjustCredit(ctx context.Context, customerID uuid.UUID, req AdjustCreditRequest) (*models.CreditTransaction, error) {
+	if req.Amount == 0 {
+		return nil, fmt.Errorf("amount must not be zero")
+	}
+
+	var customer models.Customer
+	if err := s.db.Select("id", "guardian_id").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.GuardianID != nil {
+		return nil, fmt.Errorf("dependents do not hold store credit; adjust the guardian's account instead")
+	}
+
+	entry := &models.CreditTransaction{
+		CustomerID: customerID,
+		Type:       models.LoyaltyAdjustment,
+		Amount:     req.Amount,
+		Notes:      req.Notes,
+		CreatedBy:  req.CreatedBy,
+		OccurredAt: time.Now(),
+	}
+	balance, err := creditBalance(s.db, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if balance+req.Amount < 0 {
+		return nil, fmt.Errorf("adjustment would leave a negative balance")
+	}
+	if err := s.db.Create(entry).Error; err != nil {
+		return nil, fmt.Errorf("failed to adjust store credit: %w", err)
+	}
+	return entry, nil
+}
+
+// GetCustomerCredit returns a customer's store credit and recent activity
+func (s *LoyaltyService) GetCustomerCredit(ctx context.Context, customerID uuid.UUID) (*CustomerCredit, error) {
+	var customer models.Customer
+	if err := s.db.Select("id", "guardian_id").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	result := &CustomerCredit{
+		CustomerID:    customer.ID,
+		AccountHolder: customer.ID,
+		Transactions:  []models.CreditTransaction{},
+	}
+	if customer.GuardianID != nil {
+		result.AccountHolder = *customer.GuardianID
+	}
+
+	balance, err := creditBalance(s.db, result.AccountHolder)
+	if err != nil {
+		return nil, err
+	}
+	result.Balance = balance
+
+	if err := s.db.Where("customer_id = ?", result.AccountHolder).
+		Order("occurred_at DESC").Limit(20).
+		Find(&result.Transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load store credit activity: %w", err)
+	}
+	return result, nil
+}
+
+// Tier recalculation
+
+// RecalculateCustomer moves a customer to the tier their current rolling
+// spend qualifies for. A dependent's guardian is recalculated instead.
+func (s *LoyaltyService) RecalculateCustomer(ctx context.Context, customerID uuid.UUID) (*models.Customer, error) {
+	var customer models.Customer
+	if err := s.db.Select("id", "guardian_id", "loyalty_tier", "tier_spend").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.GuardianID != nil {
+		return s.RecalculateCustomer(ctx, *customer.GuardianID)
+	}
+
+	var spend models.Money
+	if err := s.db.Model(&models.PurchaseHistory{}).
+		Where("customer_id IN (SELECT id FROM customers WHERE id = ? OR guardian_id = ?)", customerID, customerID).
+		Where("purchase_date >= ?", since(tierWindowDays)).
+		Select("COALESCE(SUM(total_price), 0)").
+		Scan(&spend).Error; err != nil {
+		return nil, fmt.Errorf("failed to total tier spend: %w", err)
+	}
+
+	tiers, err := s.GetTiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyTier(&customer, tierForSpend(tiers, spend), spend); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// RecalculateAll recalculates every account holder's tier and returns how
+// many changed tier
+func (s *LoyaltyService) RecalculateAll(ctx context.Context) (int, error) {
+	tiers, err := s.GetTiers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var totals []struct {
+		HolderID uuid.UUID
+		Spend    models.Money
+	}
+	if err := s.db.Table("purchase_histories ph").
+		Joins("JOIN customers c ON c.id = ph.customer_id AND c.deleted_at IS NULL").
+		Where("ph.purchase_date >= ?", since(tierWindowDays)).
+		Select("COALESCE(c.guardian_id, c.id) AS holder_id, SUM(ph.total_price) AS spend").
+		Group("COALESCE(c.guardian_id, c.id)").
+		Scan(&totals).Error; err != nil {
+		return 0, fmt.Errorf("failed to total tier spend: %w", err)
+	}
+	spendByHolder := make(map[uuid.UUID]models.Money, len(totals))
+	for _, t := range totals {
+		spendByHolder[t.HolderID] = t.Spend
+	}
+
+	changed := 0
+	var customers []models.Customer
+	err = s.db.Select("id", "loyalty_tier", "tier_spend").
+		Where("guardian_id IS NULL AND anonymized_at IS NULL").
+		FindInBatches(&customers, 500, func(tx *gorm.DB, batch int) error {
+			for i := range customers {
+				previous := customers[i].LoyaltyTier
+				spend := spendByHolder[customers[i].ID]
+				if err := s.applyTier(&customers[i], tierForSpend(tiers, spend), spend); err != nil {
+					return err
+				}
+				if customers[i].LoyaltyTier != previous {
+					changed++
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return changed, err
+	}
+	return changed, nil
+}
+
+// RunRecalculation recalculates tiers on the configured interval until ctx is
+// done
+func (s *LoyaltyService) RunRecalculation(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RecalcInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if changed, err := s.RecalculateAll(lifecycle.WorkContext(ctx)); err != nil {
+				logrus.WithError(err).Error("Loyalty tier recalculation failed")
+			} else {
+				logrus.WithField("changed", changed).Debug("Loyalty tiers recalculated")
+			}
+		}
+	}
+}
+
+// Private helper methods
+
+// award records earned points and adds them to the holder's balance, then
+// recalculates the holder's tier
+func (s *LoyaltyService) award(holderID uuid.UUID, txType models.LoyaltyTransactionType, referenceID uuid.UUID, amount models.Money, reference string) error {
+	var holder models.Customer
+	if err := s.db.Select("id", "loyalty_tier").First(&holder, holderID).Error; err != nil {
+		return fmt.Errorf("customer not found: %w", err)
+	}
+
+	// Points are earned at the tier held when the purchase was made
+	multiplier := 1.0
+	tier, err := customerTier(s.db, holderID)
+	if err != nil {
+		return err
+	}
+	if tier != nil {
+		multiplier = tier.PointsMultiplier
+	}
+
+	points := 0
+	if s.config.PesosPerPoint > 0 && amount > 0 {
+		points = int(math.Floor(amount.Float64() / float64(s.config.PesosPerPoint) * multiplier))
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		entry := &models.LoyaltyTransaction{
+			CustomerID:  holderID,
+			Type:        txType,
+			ReferenceID: &referenceID,
+			Points:      points,
+			Amount:      amount,
+			Multiplier:  multiplier,
+			Tier:        holder.LoyaltyTier,
+			Notes:       reference,
+			OccurredAt:  time.Now(),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(entry)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || points == 0 {
+			return nil
+		}
+		return tx.Model(&models.Customer{}).Where("id = ?", holderID).
+			Update("loyalty_points", gorm.Expr("loyalty_points + ?", points)).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to award points: %w", err)
+	}
+
+	if _, err := s.RecalculateCustomer(context.Background(), holderID); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyTier stores a customer's tier and spend when either has changed
+func (s *LoyaltyService) applyTier(customer *models.Customer, tier *models.LoyaltyTier, spend models.Money) error {
+	code := ""
+	if tier != nil {
+		code = tier.Code
+	}
+	if customer.LoyaltyTier == code && customer.TierSpend == spend {
+		return nil
+	}
+
+	updates := map[string]interface{}{"tier_spend": spend}
+	if customer.LoyaltyTier != code {
+		now := time.Now()
+		updates["loyalty_tier"] = code
+		updates["tier_updated_at"] = &now
+		customer.TierUpdatedAt = &now
+	}
+	if err := s.db.Model(&models.Customer{}).Where("id = ?", customer.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update loyalty tier: %w", err)
+	}
+	customer.LoyaltyTier = code
+	customer.TierSpend = spend
+	return nil
+}
+
+// creditBalance totals a customer's store credit
+func creditBalance(db *gorm.DB, customerID uuid.UUID) (models.Money, error) {
+	var balance models.Money
+	if err := db.Model(&models.CreditTransaction{}).Where("customer_id = ?", customerID).
+		Select("COALESCE(SUM(amount), 0)").Scan(&balance).Error; err != nil {
+		return 0, fmt.Errorf("failed to total store credit: %w", err)
+	}
+	return balance, nil
+}
+
+// loyaltyHolder returns the account that earns points for a purchase: the
+// guardian when bought on a dependent's behalf, otherwise the customer
+func loyaltyHolder(customerID, guardianID *uuid.UUID) *uuid.UUID {
+	if guardianID != nil {
+		return guardianID
+	}
+	return customerID
+}
+
+// tierForSpend returns the highest tier the spend qualifies for, or nil when
+// it is below every tier. tiers must be ordered by ascending MinSpend.
+func tierForSpend(tiers []models.LoyaltyTier, spend models.Money) *models.LoyaltyTier {
+	var match *models.LoyaltyTier
+	for i := range tiers {
+		if spend >= tiers[i].MinSpend {
+			match = &tiers[i]
+		}
+	}
+	return match
+}
+
+// customerTier loads a customer's current tier, or nil when they have none
+func customerTier(db *gorm.DB, customerID uuid.UUID) (*models.LoyaltyTier, error) {
+	var tier models.LoyaltyTier
+	err := db.Joins("JOIN customers ON customers.loyalty_tier = loyalty_tiers.code").
+		Where("customers.id = ?", customerID).
+		First(&tier).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load loyalty tier: %w", err)
+	}
+	return &tier, nil
+}
+
+// Request/Response types
+
+type UpdateLoyaltyTierRequest struct {
+	Name                 *string       `json:"name"`
+	MinSpend             *models.Money `json:"min_spend"`
+	PointsMultiplier     *float64      `json:"points_multiplier"`
+	FreeDelivery         *bool         `json:"free_delivery"`
+	FreeDeliveryMinOrder *models.Money `json:"free_delivery_min_order"`
+}
+
+type AdjustPointsRequest struct {
+	Points    int        `json:"points" binding:"required"`
+	Notes     string     `json:"notes" binding:"required"`
+	CreatedBy *uuid.UUID `json:"-"`
+}
+
+type CustomerLoyalty struct {
+	CustomerID      uuid.UUID                   `json:"customer_id"`
+	AccountHolder   uuid.UUID                   `json:"account_holder_id"` // guardian for a dependent
+	Points          int                         `json:"points"`
+	Tier            *models.LoyaltyTier         `json:"tier"`
+	TierSpend       models.Money                `json:"tier_spend"`
+	TierUpdatedAt   *time.Time                  `json:"tier_updated_at"`
+	NextTier        *models.LoyaltyTier         `json:"next_tier"`
+	SpendToNextTier models.Money                `json:"spend_to_next_tier"`
+	Transactions    []models.LoyaltyTransaction `json:"transactions"`
+}
+
+type AdjustCreditRequest struct {
+	Amount    models.Money `json:"amount" binding:"required"`
+	Notes     string       `json:"notes" binding:"required"`
+	CreatedBy *uuid.UUID   `json:"-"`
+}
+
+type CustomerCredit struct {
+	CustomerID    uuid.UUID                  `json:"customer_id"`
+	AccountHolder uuid.UUID                  `json:"account_holder_id"` // guardian for a dependent
+	Balance       models.Money               `json:"balance"`
+	Transactions  []models.CreditTransaction `json:"transactions"`
+}
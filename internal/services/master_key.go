@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/awsauth"
+	"pharmacy-backend/internal/config"
+)
+
+// MasterKeyProvider wraps and unwraps the data keys stored in the database.
+// With Vault or KMS the master key never leaves the provider.
+type MasterKeyProvider interface {
+	Name() string
+	Wrap(ctx context.Context, dataKey []byte) (string, error)
+	Unwrap(ctx context.Context, wrapped string) ([]byte, error)
+}
+
+// NewMasterKeyProvider builds the provider named in the configuration.
+// The local provider falls back to encryptionKey when no master key is set.
+func NewMasterKeyProvider(cfg config.EncryptionConfig, encryptionKey string) MasterKeyProvider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	switch cfg.MasterKeyProvider {
+	case "vault":
+		return &VaultMasterKeyProvider{
+			Addr:    strings.TrimRight(cfg.VaultAddr, "/"),
+			Token:   cfg.VaultToken,
+			KeyName: cfg.VaultTransitKey,
+			Client:  client,
+		}
+	case "kms":
+		return &KMSMasterKeyProvider{
+			KeyID:     cfg.KMSKeyID,
+			Region:    cfg.KMSRegion,
+			Endpoint:  cfg.KMSEndpoint,
+			AccessKey: cfg.AWSAccessKey,
+			SecretKey: cfg.AWSSecretKey,
+			Client:    client,
+		}
+	}
+	masterKey := cfg.MasterKey
+	if masterKey == "" {
+		masterKey = encryptionKey
+	}
+	sum := sha256.Sum256([]byte("master:" + masterKey))
+	return &LocalMasterKeyProvider{key: sum[:]}
+}
+
+// LocalMasterKeyProvider wraps data keys with AES-256-GCM under a key from
+// the environment. It gives rotation without an external service, but the
+// master key is only as safe as the server's environment.
+type LocalMasterKeyProvider struct {
+	key []byte
+}
+
+func (p *LocalMasterKeyProvider) Name() string { return "local" }
+
+func (p *LocalMasterKeyProvider) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	gcm, err := p.gcm()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, dataKey, nil)), nil
+}
+
+func (p *LocalMasterKeyProvider) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	gcm, err := p.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	dataKey, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key, wrong master key?")
+	}
+	return dataKey, nil
+}
+
+func (p *LocalMasterKeyProvider) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(p.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// VaultMasterKeyProvider wraps data keys with a HashiCorp Vault transit key
+type VaultMasterKeyProvider struct {
+	Addr    string
+	Token   string
+	KeyName string
+	Client  *http.Client
+}
+
+func (p *VaultMasterKeyProvider) Name() string { return "vault" }
+
+func (p *VaultMasterKeyProvider) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	var result struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	body := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := p.call(ctx, "encrypt", body, &result); err != nil {
+		return "", err
+	}
+	return result.Data.Ciphertext, nil
+}
+
+func (p *VaultMasterKeyProvider) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var result struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := p.call(ctx, "decrypt", map[string]string{"ciphertext": wrapped}, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Data.Plaintext)
+}
+
+func (p *VaultMasterKeyProvider) call(ctx context.Context, operation string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := fmt.Sprintf("%s/v1/transit/%s/%s", p.Addr, operation, p.KeyName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build Vault request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", p.Token)
+	return doMasterKeyRequest(p.Client, req, "Vault", result)
+}
+
+// KMSMasterKeyProvider wraps data keys with an AWS KMS key
+type KMSMasterKeyProvider struct {
+	KeyID     string
+	Region    string
+	Endpoint  string // e.g. a VPC endpoint; defaults to the regional AWS endpoint
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func (p *KMSMasterKeyProvider) Name() string { return "kms" }
+
+func (p *KMSMasterKeyProvider) Wrap(ctx context.Context, dataKey []byte) (string, error) {
+	var result struct {
+		CiphertextBlob string `json:"CiphertextBlob"`
+	}
+	body := map[string]string{"KeyId": p.KeyID, "Plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	if err := p.call(ctx, "Encrypt", body, &result); err != nil {
+		return "", err
+	}
+	return result.CiphertextBlob, nil
+}
+
+func (p *KMSMasterKeyProvider) Unwrap(ctx context.Context, wrapped string) ([]byte, error) {
+	var result struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	body := map[string]string{"KeyId": p.KeyID, "CiphertextBlob": wrapped}
+	if err := p.call(ctx, "Decrypt", body, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Plaintext)
+}
+
+func (p *KMSMasterKeyProvider) call(ctx context.Context, action string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", p.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to build KMS request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	creds := awsauth.Credentials{Region: p.Region, AccessKey: p.AccessKey, SecretKey: p.SecretKey}
+	awsauth.SignV4(req, payload, creds, "kms", []string{"content-type", "x-amz-target"}, time.Now().UTC())
+	return doMasterKeyRequest(p.Client, req, "KMS", result)
+}
+
+func doMasterKeyRequest(client *http.Client, req *http.Request, service string, result interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %d: %s", service, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid %s response: %w", service, err)
+	}
+	return nil
+}
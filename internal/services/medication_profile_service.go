@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Fields withheld from a medication profile when the caller lacks
+// medical_data read permission
+var medicationProfilePHIFields = []string{
+	"allergies",
+	"medical_history",
+	"current_medications",
+	"recent_dispenses.dosage",
+	"recent_dispenses.instructions",
+	"recent_dispenses.duration",
+}
+
+type MedicationProfileService struct {
+	db *gorm.DB
+}
+
+func NewMedicationProfileService(db *gorm.DB) *MedicationProfileService {
+	return &MedicationProfileService{db: db}
+}
+
+// GetProfile consolidates a customer's current medications, recent dispenses,
+// allergies and active refills. Clinical fields are only decrypted when
+// includePHI is set; otherwise they are omitted and listed in RedactedFields.
+func (s *MedicationProfileService) GetProfile(ctx context.Context, customerID uuid.UUID, includePHI bool, dispenseLimit int) (*MedicationProfile, error) {
+	var customer models.Customer
+	if err := s.db.First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	profile := &MedicationProfile{
+		CustomerID:      customer.ID,
+		CustomerName:    customer.FirstName + " " + customer.LastName,
+		DateOfBirth:     customer.DateOfBirth,
+		RecentDispenses: []DispenseRecord{},
+		ActiveRefills:   []models.Refill{},
+		RedactedFields:  []string{},
+		GeneratedAt:     time.Now().UTC(),
+	}
+
+	if includePHI {
+		var err error
+		if profile.Allergies, err = customer.Allergies.Get(); err != nil {
+			return nil, fmt.Errorf("failed to decrypt allergies: %w", err)
+		}
+		if profile.MedicalHistory, err = customer.MedicalHistory.Get(); err != nil {
+			return nil, fmt.Errorf("failed to decrypt medical history: %w", err)
+		}
+		if profile.CurrentMedications, err = customer.CurrentMedications.Get(); err != nil {
+			return nil, fmt.Errorf("failed to decrypt current medications: %w", err)
+		}
+	} else {
+		profile.RedactedFields = append(profile.RedactedFields, medicationProfilePHIFields...)
+	}
+
+	if err := s.db.Preload("Product", WithDeleted).
+		Where("customer_id = ? AND status IN ?", customerID,
+			[]models.RefillStatus{models.RefillStatusScheduled, models.RefillStatusReminded, models.RefillStatusReordered}).
+		Order("due_date ASC").
+		Find(&profile.ActiveRefills).Error; err != nil {
+		return nil, fmt.Errorf("failed to load refills: %w", err)
+	}
+
+	dispenses, err := s.recentDispenses(customerID, dispenseLimit)
+	if err != nil {
+		return nil, err
+	}
+	if !includePHI {
+		for i := range dispenses {
+			dispenses[i].Dosage = nil
+			dispenses[i].Instructions = nil
+			dispenses[i].Duration = nil
+		}
+	}
+	profile.RecentDispenses = dispenses
+
+	return profile, nil
+}
+
+// Private helper methods
+
+// recentDispenses merges in-store sale items and fulfilled online order items,
+// newest first
+func (s *MedicationProfileService) recentDispenses(customerID uuid.UUID, limit int) ([]DispenseRecord, error) {
+	var saleItems []models.SaleItem
+	if err := s.db.Preload("Product", WithDeleted).
+		Joins("JOIN sales ON sales.id = sale_items.sale_id").
+		Where("sales.customer_id = ? AND sale_items.product_id IS NOT NULL", customerID).
+		Where("sales.refunded_at IS NULL").
+		Order("sale_items.created_at DESC").
+		Limit(limit).
+		Find(&saleItems).Error; err != nil {
+		return nil, fmt.Errorf("failed to load sale dispenses: %w", err)
+	}
+
+	var orderItems []models.OnlineOrderItem
+	if err := s.db.Preload("Product", WithDeleted).
+		Joins("JOIN online_orders ON online_orders.id = online_order_items.order_id").
+		Where("online_orders.customer_id = ?", customerID).
+		Where("online_orders.status IN ?", []models.OrderStatus{models.OrderStatusDelivered, models.OrderStatusPickedUp}).
+		Where("online_order_items.status NOT IN ?", []models.ItemStatus{models.ItemStatusCancelled, models.ItemStatusOutOfStock}).
+		Order("online_order_items.created_at DESC").
+		Limit(limit).
+		Find(&orderItems).Error; err != nil {
+		return nil, fmt.Errorf("failed to load order dispenses: %w", err)
+	}
+
+	records := make([]DispenseRecord, 0, len(saleItems)+len(orderItems))
+	for _, item := range saleItems {
+		record := DispenseRecord{
+			Source:       "sale",
+			SourceID:     item.SaleID,
+			ItemID:       item.ID,
+			Quantity:     item.Quantity,
+			Dosage:       item.Dosage,
+			Instructions: item.Instructions,
+			Duration:     item.Duration,
+			DispensedAt:  item.CreatedAt,
+		}
+		if item.ProductID != nil {
+			record.ProductID = *item.ProductID
+		}
+		if item.Product != nil {
+			record.ProductName = item.Product.Name
+			record.GenericName = item.Product.GenericName
+			record.Strength = item.Product.Dosage
+		}
+		records = append(records, record)
+	}
+	for _, item := range orderItems {
+		records = append(records, DispenseRecord{
+			Source:       "online_order",
+			SourceID:     item.OrderID,
+			ItemID:       item.ID,
+			ProductID:    item.ProductID,
+			ProductName:  item.Product.Name,
+			GenericName:  item.Product.GenericName,
+			Strength:     item.Product.Dosage,
+			Quantity:     item.Quantity,
+			Dosage:       item.Dosage,
+			Instructions: item.Instructions,
+			Duration:     item.Duration,
+			DispensedAt:  item.CreatedAt,
+		})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].DispensedAt.After(records[j].DispensedAt)
+	})
+	if len(records) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+// Request/Response types
+
+type DispenseRecord struct {
+	Source       string    `json:"source"` // sale, online_order
+	SourceID     uuid.UUID `json:"source_id"`
+	ItemID       uuid.UUID `json:"item_id"`
+	ProductID    uuid.UUID `json:"product_id"`
+	ProductName  string    `json:"product_name"`
+	GenericName  *string   `json:"generic_name,omitempty"`
+	Strength     *string   `json:"strength,omitempty"`
+	Quantity     int       `json:"quantity"`
+	Dosage       *string   `json:"dosage,omitempty"`
+	Instructions *string   `json:"instructions,omitempty"`
+	Duration     *string   `json:"duration,omitempty"`
+	DispensedAt  time.Time `json:"dispensed_at"`
+}
+
+type MedicationProfile struct {
+	CustomerID         uuid.UUID        `json:"customer_id"`
+	CustomerName       string           `json:"customer_name"`
+	DateOfBirth        time.Time        `json:"date_of_birth"`
+	Allergies          []string         `json:"allergies,omitempty"`
+	MedicalHistory     []string         `json:"medical_history,omitempty"`
+	CurrentMedications []string         `json:"current_medications,omitempty"`
+	RecentDispenses    []DispenseRecord `json:"recent_dispenses"`
+	ActiveRefills      []models.Refill  `json:"active_refills"`
+	RedactedFields     []string         `json:"redacted_fields"`
+	GeneratedAt        time.Time        `json:"generated_at"`
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Notification channels
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+	ChannelPush  = "push"
+)
+
+// Channels lists every notification channel
+var Channels = []string{ChannelEmail, ChannelSMS, ChannelPush}
+
+// Notifier delivers a message to a customer over a single channel
+type Notifier interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// LogNotifier logs messages instead of delivering them. It stands in for
+// channels that have no provider configured.
+type LogNotifier struct {
+	Channel string
+}
+
+func NewLogNotifier(channel string) *LogNotifier {
+	return &LogNotifier{Channel: channel}
+}
+
+func (n *LogNotifier) Send(ctx context.Context, to, subject, body string) error {
+	logrus.WithFields(logrus.Fields{
+		"channel": n.Channel,
+		"subject": subject,
+	}).Info("Notification not delivered: no provider configured")
+	return nil
+}
+
+// DefaultNotifiers returns a notifier for every channel
+func DefaultNotifiers() map[string]Notifier {
+	return map[string]Notifier{
+		ChannelEmail: NewLogNotifier(ChannelEmail),
+		ChannelSMS:   NewLogNotifier(ChannelSMS),
+		ChannelPush:  NewLogNotifier(ChannelPush),
+	}
+}
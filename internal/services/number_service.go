@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxNumberAttempts is how many numbers are tried before giving up on
+// finding one no other record has
+const maxNumberAttempts = 100
+
+// NumberService hands out sale, order, claim and preparation numbers. They
+// run in sequence per day, branch and database, such as
+// SALE-20261016-MKT-K7Q-000042, rather than being random and able to
+// collide. The last part of the prefix is the database's node code, so the
+// store's and the cloud's databases, which sync, never hand out the same
+// number.
+type NumberService struct {
+	db *gorm.DB
+}
+
+func NewNumberService(db *gorm.DB) *NumberService {
+	return &NumberService{db: db}
+}
+
+// SaleNumber takes the next sale number for the branch in tx
+func (s *NumberService) SaleNumber(tx *gorm.DB, branchID *uuid.UUID) (string, error) {
+	return s.next(tx, "SALE", branchID, &models.Sale{}, "sale_number")
+}
+
+// OrderNumber takes the next online order number for the branch in tx
+func (s *NumberService) OrderNumber(tx *gorm.DB, branchID *uuid.UUID) (string, error) {
+	return s.next(tx, "ORD", branchID, &models.OnlineOrder{}, "order_number")
+}
+
+// ClaimNumber takes the next insurance claim number for the branch in tx
+func (s *NumberService) ClaimNumber(tx *gorm.DB, branchID *uuid.UUID) (string, error) {
+	return s.next(tx, "CLM", branchID, &models.InsuranceClaim{}, "claim_number")
+}
+
+// PreparationNumber takes the next compounded preparation number for the
+// branch in tx. It doubles as the preparation's lot number.
+func (s *NumberService) PreparationNumber(tx *gorm.DB, branchID *uuid.UUID) (string, error) {
+	return s.next(tx, "CMP", branchID, &models.CompoundPreparation{}, "preparation_number")
+}
+
+// Private helper methods
+
+// next takes the next number in the series in tx. The counter row stays
+// locked until tx ends, so concurrent requests get consecutive numbers and
+// a rolled back one gives its number back. Numbers another record already
+// has, such as one from before node codes, are skipped.
+func (s *NumberService) next(tx *gorm.DB, kind string, branchID *uuid.UUID, model interface{}, column string) (string, error) {
+	prefix := kind + "-" + time.Now().Format("20060102")
+	if branchID != nil {
+		var codes []string
+		if err := tx.Model(&models.Branch{}).Where("id = ?", *branchID).Pluck("code", &codes).Error; err != nil {
+			return "", fmt.Errorf("failed to load branch code: %w", err)
+		}
+		if len(codes) == 0 {
+			return "", fmt.Errorf("branch: %w", gorm.ErrRecordNotFound)
+		}
+		prefix += "-" + codes[0]
+	}
+	var node string
+	if err := tx.Model(&models.DatabaseNode{}).Where("id = ?", models.DatabaseNodeID).
+		Select("code").Scan(&node).Error; err != nil {
+		return "", fmt.Errorf("failed to load node code: %w", err)
+	}
+	if node == "" {
+		return "", fmt.Errorf("database node code: %w", gorm.ErrRecordNotFound)
+	}
+	prefix += "-" + node
+
+	sequence := models.NumberSequence{Prefix: prefix, NextNumber: 1}
+	if err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "prefix"}}, DoNothing: true}).
+		Create(&sequence).Error; err != nil {
+		return "", fmt.Errorf("failed to start %s numbers: %w", kind, err)
+	}
+
+	for attempt := 0; attempt < maxNumberAttempts; attempt++ {
+		if err := tx.Model(&models.NumberSequence{}).Where("prefix = ?", prefix).
+			Update("next_number", gorm.Expr("next_number + 1")).Error; err != nil {
+			return "", fmt.Errorf("failed to take %s number: %w", kind, err)
+		}
+		var next int64
+		if err := tx.Model(&models.NumberSequence{}).Select("next_number").
+			Where("prefix = ?", prefix).Scan(&next).Error; err != nil {
+			return "", fmt.Errorf("failed to take %s number: %w", kind, err)
+		}
+		number := fmt.Sprintf("%s-%06d", prefix, next-1)
+
+		var taken int64
+		if err := tx.Model(model).Unscoped().Where(column+" = ?", number).Count(&taken).Error; err != nil {
+			return "", fmt.Errorf("failed to check %s number: %w", kind, err)
+		}
+		if taken == 0 {
+			return number, nil
+		}
+	}
+	return "", fmt.Errorf("no free %s number in %s after %d tries", kind, prefix, maxNumberAttempts)
+}
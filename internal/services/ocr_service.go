@@ -0,0 +1,322 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrOCRUnavailable is returned when no OCR provider is configured
+var ErrOCRUnavailable = errors.New("no OCR provider configured")
+
+var (
+	prescriberPattern = regexp.MustCompile(`(?i)^\s*(?:dr\.?|doctor)\s+([a-z][a-z .,'-]+?)(?:,?\s*m\.?d\.?)?\s*$`)
+	licensePattern    = regexp.MustCompile(`(?i)\b(?:lic(?:ense)?|prc)\.?\s*(?:no\.?|#)?\s*[:#]?\s*([a-z0-9-]{4,})`)
+	ptrPattern        = regexp.MustCompile(`(?i)\bptr\.?\s*(?:no\.?|#)?\s*[:#]?\s*([0-9-]{4,})`)
+	s2Pattern         = regexp.MustCompile(`(?i)\bs2\.?\s*(?:no\.?|#)?\s*[:#]?\s*([a-z0-9-]{4,})`)
+	quantityPattern   = regexp.MustCompile(`#\s*(\d+)`)
+	sigPattern        = regexp.MustCompile(`(?i)\bsig\.?\s*:?\s*(.+)$`)
+	rxPrefixPattern   = regexp.MustCompile(`(?i)^\s*(?:rx\.?|\d+[.)])\s*`)
+)
+
+// OCRProvider extracts raw text from a prescription image or PDF
+type OCRProvider interface {
+	ExtractText(ctx context.Context, data []byte, mimeType string) (string, error)
+}
+
+// NewOCRProvider builds the provider named in the configuration
+func NewOCRProvider(cfg config.OCRConfig) OCRProvider {
+	switch cfg.Provider {
+	case "http":
+		return &HTTPOCRProvider{
+			Endpoint: cfg.Endpoint,
+			APIKey:   cfg.APIKey,
+			Client:   &http.Client{Timeout: cfg.Timeout},
+		}
+	}
+	return noOCRProvider{}
+}
+
+type noOCRProvider struct{}
+
+func (noOCRProvider) ExtractText(ctx context.Context, data []byte, mimeType string) (string, error) {
+	return "", ErrOCRUnavailable
+}
+
+// HTTPOCRProvider posts the file to an OCR service, such as a Tesseract or
+// cloud vision sidecar, which responds with {"text": "..."}
+type HTTPOCRProvider struct {
+	Endpoint string
+	APIKey   string
+	Client   *http.Client
+}
+
+func (p *HTTPOCRProvider) ExtractText(ctx context.Context, data []byte, mimeType string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to build OCR request: %w", err)
+	}
+	req.Header.Set("Content-Type", mimeType)
+	if p.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("OCR request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("OCR service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Text string `json:"text"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid OCR response: %w", err)
+	}
+	return result.Text, nil
+}
+
+type PrescriptionOCRService struct {
+	db       *gorm.DB
+	provider OCRProvider
+	files    *FileService
+}
+
+func NewPrescriptionOCRService(db *gorm.DB, provider OCRProvider, files *FileService) *PrescriptionOCRService {
+	return &PrescriptionOCRService{
+		db:       db,
+		provider: provider,
+		files:    files,
+	}
+}
+
+// Process runs OCR on an upload and stores structured suggestions for the
+// verifying pharmacist
+func (s *PrescriptionOCRService) Process(ctx context.Context, uploadID uuid.UUID) (*PrescriptionSuggestions, error) {
+	var upload models.PrescriptionUpload
+	if err := s.db.First(&upload, uploadID).Error; err != nil {
+		return nil, fmt.Errorf("prescription not found: %w", err)
+	}
+	if upload.OCRStatus == models.OCRStatusConfirmed {
+		return nil, fmt.Errorf("OCR suggestions have already been confirmed")
+	}
+
+	path, err := upload.StoragePath.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt storage path: %w", err)
+	}
+	data, err := s.files.Read(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prescription file: %w", err)
+	}
+
+	now := time.Now().UTC()
+	text, err := s.provider.ExtractText(ctx, data, upload.MimeType)
+	if err != nil {
+		status := models.OCRStatusFailed
+		if errors.Is(err, ErrOCRUnavailable) {
+			status = models.OCRStatusUnavailable
+		}
+		s.db.Model(&upload).Updates(map[string]interface{}{
+			"ocr_status":       status,
+			"ocr_error":        err.Error(),
+			"ocr_processed_at": now,
+		})
+		return nil, err
+	}
+
+	suggestions := ParsePrescriptionText(text)
+	s.matchProducts(suggestions)
+
+	if err := upload.OCRText.Set(text); err != nil {
+		return nil, fmt.Errorf("failed to encrypt OCR text: %w", err)
+	}
+	if err := s.setSuggestions(&upload, suggestions); err != nil {
+		return nil, err
+	}
+	upload.OCRStatus = models.OCRStatusCompleted
+	upload.OCRError = ""
+	upload.OCRProcessedAt = &now
+
+	if err := s.db.Save(&upload).Error; err != nil {
+		return nil, fmt.Errorf("failed to save OCR results: %w", err)
+	}
+	return suggestions, nil
+}
+
+// GetSuggestions returns the stored OCR suggestions for an upload
+func (s *PrescriptionOCRService) GetSuggestions(ctx context.Context, uploadID uuid.UUID) (*models.PrescriptionUpload, *PrescriptionSuggestions, error) {
+	var upload models.PrescriptionUpload
+	if err := s.db.First(&upload, uploadID).Error; err != nil {
+		return nil, nil, fmt.Errorf("prescription not found: %w", err)
+	}
+
+	suggestions, err := s.getSuggestions(&upload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &upload, suggestions, nil
+}
+
+// ConfirmSuggestions stores the pharmacist-corrected transcription
+func (s *PrescriptionOCRService) ConfirmSuggestions(ctx context.Context, uploadID uuid.UUID, confirmed PrescriptionSuggestions, pharmacistID uuid.UUID) (*PrescriptionSuggestions, error) {
+	var upload models.PrescriptionUpload
+	if err := s.db.First(&upload, uploadID).Error; err != nil {
+		return nil, fmt.Errorf("prescription not found: %w", err)
+	}
+
+	s.matchProducts(&confirmed)
+	if err := s.setSuggestions(&upload, &confirmed); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	upload.OCRStatus = models.OCRStatusConfirmed
+	upload.OCRConfirmedBy = &pharmacistID
+	upload.OCRConfirmedAt = &now
+
+	if err := s.db.Save(&upload).Error; err != nil {
+		return nil, fmt.Errorf("failed to save confirmed transcription: %w", err)
+	}
+	return &confirmed, nil
+}
+
+// ParsePrescriptionText extracts medications and prescriber details from OCR
+// text. Handwriting recognition is imperfect, so results are suggestions for
+// the pharmacist to correct rather than authoritative data.
+func ParsePrescriptionText(text string) *PrescriptionSuggestions {
+	suggestions := &PrescriptionSuggestions{Medications: []MedicationSuggestion{}}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if match := prescriberPattern.FindStringSubmatch(line); match != nil && suggestions.PrescriberName == "" {
+			suggestions.PrescriberName = strings.TrimSpace(match[1])
+			continue
+		}
+		if match := ptrPattern.FindStringSubmatch(line); match != nil {
+			suggestions.PTRNumber = match[1]
+			continue
+		}
+		if match := s2Pattern.FindStringSubmatch(line); match != nil {
+			suggestions.S2Number = match[1]
+			continue
+		}
+		if match := licensePattern.FindStringSubmatch(line); match != nil {
+			suggestions.PrescriberLicense = match[1]
+			continue
+		}
+
+		loc := strengthPattern.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+		medLine := rxPrefixPattern.ReplaceAllString(line, "")
+		name, strength := parseMedication(medLine)
+		if name == "" {
+			continue
+		}
+		medication := MedicationSuggestion{
+			Name:     name,
+			Strength: strength,
+		}
+		if match := quantityPattern.FindStringSubmatch(medLine); match != nil {
+			medication.Quantity, _ = strconv.Atoi(match[1])
+		}
+		if match := sigPattern.FindStringSubmatch(medLine); match != nil {
+			medication.Instructions = strings.TrimSpace(match[1])
+		} else if i+1 < len(lines) {
+			// Directions are usually written on the line below the drug
+			if match := sigPattern.FindStringSubmatch(strings.TrimSpace(lines[i+1])); match != nil {
+				medication.Instructions = strings.TrimSpace(match[1])
+			}
+		}
+		suggestions.Medications = append(suggestions.Medications, medication)
+	}
+
+	return suggestions
+}
+
+// Private helper methods
+
+func (s *PrescriptionOCRService) matchProducts(suggestions *PrescriptionSuggestions) {
+	for i, medication := range suggestions.Medications {
+		product, err := findProductByMedication(s.db, strings.ToLower(medication.Name), normalizeStrength(medication.Strength))
+		if err != nil {
+			suggestions.Medications[i].ProductID = nil
+			suggestions.Medications[i].ProductName = ""
+			continue
+		}
+		suggestions.Medications[i].ProductID = &product.ID
+		suggestions.Medications[i].ProductName = product.Name
+	}
+}
+
+func (s *PrescriptionOCRService) setSuggestions(upload *models.PrescriptionUpload, suggestions *PrescriptionSuggestions) error {
+	encoded, err := json.Marshal(suggestions)
+	if err != nil {
+		return fmt.Errorf("failed to encode suggestions: %w", err)
+	}
+	if err := upload.OCRSuggestions.Set(string(encoded)); err != nil {
+		return fmt.Errorf("failed to encrypt suggestions: %w", err)
+	}
+	return nil
+}
+
+func (s *PrescriptionOCRService) getSuggestions(upload *models.PrescriptionUpload) (*PrescriptionSuggestions, error) {
+	encoded, err := upload.OCRSuggestions.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt suggestions: %w", err)
+	}
+	if encoded == "" {
+		return nil, nil
+	}
+
+	var suggestions PrescriptionSuggestions
+	if err := json.Unmarshal([]byte(encoded), &suggestions); err != nil {
+		return nil, fmt.Errorf("failed to decode suggestions: %w", err)
+	}
+	return &suggestions, nil
+}
+
+// Request/Response types
+
+type MedicationSuggestion struct {
+	Name         string     `json:"name"`
+	Strength     string     `json:"strength"`
+	Quantity     int        `json:"quantity,omitempty"`
+	Instructions string     `json:"instructions,omitempty"`
+	ProductID    *uuid.UUID `json:"product_id,omitempty"`
+	ProductName  string     `json:"product_name,omitempty"`
+}
+
+type PrescriptionSuggestions struct {
+	Medications       []MedicationSuggestion `json:"medications"`
+	PrescriberName    string                 `json:"prescriber_name,omitempty"`
+	PrescriberLicense string                 `json:"prescriber_license,omitempty"`
+	PTRNumber         string                 `json:"ptr_number,omitempty"`
+	S2Number          string                 `json:"s2_number,omitempty"` // required for dangerous drugs
+}
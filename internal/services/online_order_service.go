@@ -2,27 +2,64 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+	"pharmacy-backend/internal/realtime"
 
 	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 type OnlineOrderService struct {
-	db        *gorm.DB
-	qrService *QRService
+	db         *gorm.DB
+	qrService  *QRService
+	outbox     *OutboxService
+	pricing    *PricingService
+	taxes      *TaxService
+	currencies *CurrencyService
+	stock      *StockService
+	numbers    *NumberService
+	delivery   *DeliveryService
+	events     *realtime.Hub
+	history    *PurchaseHistoryService
 }
 
-func NewOnlineOrderService(db *gorm.DB, qrService *QRService) *OnlineOrderService {
+func NewOnlineOrderService(db *gorm.DB, qrService *QRService, outbox *OutboxService, pricing *PricingService, taxes *TaxService, currencies *CurrencyService, stock *StockService, numbers *NumberService) *OnlineOrderService {
 	return &OnlineOrderService{
-		db:        db,
-		qrService: qrService,
+		db:         db,
+		qrService:  qrService,
+		outbox:     outbox,
+		pricing:    pricing,
+		taxes:      taxes,
+		currencies: currencies,
+		stock:      stock,
+		numbers:    numbers,
 	}
 }
 
+// SetDelivery checks delivery addresses against the delivery zones and
+// prices delivery by distance
+func (s *OnlineOrderService) SetDelivery(delivery *DeliveryService) {
+	s.delivery = delivery
+}
+
+// SetEvents pushes new orders and status changes to the screens watching
+// them
+func (s *OnlineOrderService) SetEvents(events *realtime.Hub) {
+	s.events = events
+}
+
+// SetPurchaseHistory records an order on the customer's purchase history
+// when it is delivered or picked up
+func (s *OnlineOrderService) SetPurchaseHistory(history *PurchaseHistoryService) {
+	s.history = history
+}
+
 // Shopping Cart Management
 
 // AddToCart adds an item to the shopping cart
@@ -37,6 +74,13 @@ func (s *OnlineOrderService) AddToCart(ctx context.Context, req AddToCartRequest
 		return nil, fmt.Errorf("insufficient stock: available %d, requested %d", product.Stock, req.Quantity)
 	}
 
+	// The cart shows the price at the branch the customer shops at. The
+	// order is priced again at its own branch when it is placed.
+	unitPrice, err := s.pricing.UnitPrice(s.db, req.BranchID, &product)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if item already exists in cart
 	var existingItem models.ShoppingCart
 	query := s.db.Where("product_id = ?", req.ProductID)
@@ -57,7 +101,7 @@ func (s *OnlineOrderService) AddToCart(ctx context.Context, req AddToCartRequest
 	// Update existing item or create new one
 	if existingItem.ID != uuid.Nil {
 		existingItem.Quantity += req.Quantity
-		existingItem.UnitPrice = product.Price
+		existingItem.UnitPrice = unitPrice
 		existingItem.ExpiresAt = expiresAt
 		existingItem.UpdatedAt = now
 
@@ -83,7 +127,7 @@ func (s *OnlineOrderService) AddToCart(ctx context.Context, req AddToCartRequest
 		SessionID:    req.SessionID,
 		ProductID:    req.ProductID,
 		Quantity:     req.Quantity,
-		UnitPrice:    product.Price,
+		UnitPrice:    unitPrice,
 		Dosage:       req.Dosage,
 		Instructions: req.Instructions,
 		Duration:     req.Duration,
@@ -154,12 +198,13 @@ func (s *OnlineOrderService) UpdateCartItem(ctx context.Context, cartItemID uuid
 
 // RemoveFromCart removes an item from the shopping cart
 func (s *OnlineOrderService) RemoveFromCart(ctx context.Context, cartItemID uuid.UUID) error {
-	return s.db.Delete(&models.ShoppingCart{}, cartItemID).Error
+	return s.db.Unscoped().Delete(&models.ShoppingCart{}, cartItemID).Error
 }
 
-// ClearCart removes all items from the cart
+// ClearCart removes all items from the cart. Cart rows are transient and
+// are deleted outright rather than soft-deleted.
 func (s *OnlineOrderService) ClearCart(ctx context.Context, customerID *uuid.UUID, sessionID *string) error {
-	query := s.db.Model(&models.ShoppingCart{})
+	query := s.db.Unscoped().Model(&models.ShoppingCart{})
 	
 	if customerID != nil {
 		query = query.Where("customer_id = ?", *customerID)
@@ -172,10 +217,48 @@ func (s *OnlineOrderService) ClearCart(ctx context.Context, customerID *uuid.UUI
 	return query.Delete(&models.ShoppingCart{}).Error
 }
 
+// CleanupExpiredCarts deletes cart items past their expiry and returns how
+// many were removed
+func (s *OnlineOrderService) CleanupExpiredCarts(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("expires_at < ?", time.Now().UTC()).
+		Delete(&models.ShoppingCart{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to clean up carts: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
 // Order Management
 
 // CreateOrder creates an order from the shopping cart
 func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderRequest) (*models.OnlineOrder, error) {
+	// Place the delivery address before anything is locked. An order
+	// without a branch goes to the branch delivering to the address.
+	var quote *DeliveryQuote
+	if req.OrderType == models.OrderTypeDelivery && s.delivery.Enabled() {
+		var err error
+		quote, err = s.delivery.Quote(ctx, DeliveryQuoteRequest{
+			Address:  req.DeliveryAddress,
+			City:     req.DeliveryCity,
+			Province: req.DeliveryState,
+			ZipCode:  req.DeliveryZipCode,
+			BranchID: req.BranchID,
+		})
+		switch {
+		case errors.Is(err, ErrAddressNotFound):
+			return nil, err
+		case err != nil:
+			// Orders are still taken while the geocoder is down, with
+			// the fee they were placed with
+			logrus.WithError(err).Warn("Failed to geocode delivery address")
+		case !quote.InServiceArea:
+			return nil, ErrOutsideServiceArea
+		case req.BranchID == nil:
+			req.BranchID = quote.BranchID
+		}
+	}
+
 	// Start transaction
 	tx := s.db.Begin()
 	defer func() {
@@ -196,6 +279,16 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 		return nil, fmt.Errorf("cart is empty")
 	}
 
+	// Price the items at the branch filling the order rather than trusting
+	// the prices the cart was shown with
+	for i := range cartItems {
+		price, err := s.pricing.UnitPrice(tx, req.BranchID, &cartItems[i].Product)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		cartItems[i].UnitPrice = price
+	}
 	// Calculate totals
 	subtotal, prescriptionRequired, err := s.calculateOrderTotals(cartItems)
 	if err != nil {
@@ -203,21 +296,94 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 		return nil, err
 	}
 
+	// An order placed for a dependent is for the dependent and attributed to
+	// the guardian who placed it
+	customerID, guardianID := req.CustomerID, (*uuid.UUID)(nil)
+	if req.DependentID != nil {
+		if req.CustomerID == nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("guest orders cannot be placed for a dependent")
+		}
+		if err := checkDependent(tx, *req.CustomerID, *req.DependentID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		customerID, guardianID = req.DependentID, req.CustomerID
+	}
+
+	// VAT follows the branch's rate and the buyer's senior citizen or PWD
+	// exemption. The buyer is the dependent when ordering for one.
+	lines := make([]TaxLine, 0, len(cartItems))
+	for _, item := range cartItems {
+		productID := item.ProductID
+		lines = append(lines, TaxLine{ProductID: &productID, Amount: item.UnitPrice.Mul(item.Quantity)})
+	}
+	taxes, err := s.taxes.Compute(tx, req.BranchID, customerID, lines)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Tier members get free delivery on qualifying orders. The benefit
+	// belongs to whoever placed the order, including for a dependent.
+	deliveryFee := req.DeliveryFee
+	if quote != nil && quote.ZoneID != nil {
+		deliveryFee = quote.DeliveryFee
+	}
+	if req.CustomerID != nil && req.OrderType == models.OrderTypeDelivery {
+		tier, err := customerTier(tx, *req.CustomerID)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if tier.QualifiesForFreeDelivery(subtotal) {
+			deliveryFee = 0
+		}
+	}
+
+	if req.BranchID != nil {
+		var branch models.Branch
+		if err := tx.Where("id = ? AND is_active = ?", *req.BranchID, true).First(&branch).Error; err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("branch not found: %w", err)
+		}
+	}
+
 	// Generate order number
-	orderNumber := s.generateOrderNumber()
+	orderNumber, err := s.numbers.OrderNumber(tx, req.BranchID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	trackingCode, err := models.NewTrackingCode()
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// Orders with prescription items wait for a verified prescription
+	initialStatus := models.OrderStatusPending
+	if prescriptionRequired {
+		initialStatus = models.OrderStatusPrescriptionNeeded
+	}
 
 	// Create order
 	order := &models.OnlineOrder{
-		CustomerID:           req.CustomerID,
+		CustomerID:           customerID,
+		GuardianID:           guardianID,
 		GuestEmail:           req.GuestEmail,
 		GuestPhone:           req.GuestPhone,
 		GuestName:            req.GuestName,
+		SessionID:            req.SessionID,
+		BranchID:             req.BranchID,
 		OrderNumber:          orderNumber,
-		Status:               models.OrderStatusPending,
+		TrackingCode:         trackingCode,
+		Status:               initialStatus,
 		OrderType:            req.OrderType,
 		Subtotal:             subtotal,
-		Tax:                  subtotal * 0.12, // 12% VAT in Philippines
-		DeliveryFee:          req.DeliveryFee,
+		Tax:                  taxes.VATAmount,
+		TaxBreakdown:         taxes,
+		DeliveryFee:          deliveryFee,
 		Discount:             req.Discount,
 		PrescriptionRequired: prescriptionRequired,
 		CustomerNotes:        req.CustomerNotes,
@@ -235,9 +401,19 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 	order.DeliveryState = req.DeliveryState
 	order.DeliveryZipCode = req.DeliveryZipCode
 	order.DeliveryNotes = req.DeliveryNotes
+	if quote != nil {
+		order.DeliveryLatitude = &quote.Suggestion.Latitude
+		order.DeliveryLongitude = &quote.Suggestion.Longitude
+		if quote.ZoneID != nil {
+			order.DeliveryZoneID = quote.ZoneID
+			order.DeliveryDistanceKM = &quote.DistanceKM
+		}
+	}
 
 	// Calculate total
-	order.Total = order.Subtotal + order.Tax + order.DeliveryFee - order.Discount
+	order.Subtotal = s.currencies.Round(order.Subtotal)
+	order.Total = s.currencies.Round(order.Subtotal + order.Tax + order.DeliveryFee - order.Discount)
+	order.Currency = s.currencies.Base()
 
 	// Set expected delivery date
 	if req.OrderType == models.OrderTypeDelivery {
@@ -245,6 +421,17 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 		order.ExpectedDeliveryDate = &expectedDate
 	}
 
+	// The tracking QR code is made with the order. The order is only
+	// visible to tx until it commits, and orders can't share a code, even
+	// an empty one.
+	order.ID = uuid.New()
+	qrCode, err := s.qrService.CreateOrderQR(ctx, tx, order, req.CreatedBy)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	order.QRCode = qrCode.Code
+
 	// Save order
 	if err := tx.Create(order).Error; err != nil {
 		tx.Rollback()
@@ -252,13 +439,14 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 	}
 
 	// Create order items
+	var movements []*models.StockMovement
 	for _, cartItem := range cartItems {
 		orderItem := &models.OnlineOrderItem{
 			OrderID:      order.ID,
 			ProductID:    cartItem.ProductID,
 			Quantity:     cartItem.Quantity,
 			UnitPrice:    cartItem.UnitPrice,
-			TotalPrice:   float64(cartItem.Quantity) * cartItem.UnitPrice,
+			TotalPrice:   cartItem.UnitPrice.Mul(cartItem.Quantity),
 			Dosage:       cartItem.Dosage,
 			Instructions: cartItem.Instructions,
 			Duration:     cartItem.Duration,
@@ -269,25 +457,33 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 			tx.Rollback()
 			return nil, fmt.Errorf("failed to create order item: %w", err)
 		}
-	}
 
-	// Generate QR code for order tracking
-	qrCode, err := s.qrService.GenerateOrderQR(ctx, order.ID, req.CreatedBy)
-	if err != nil {
-		// Don't fail the order if QR generation fails
-		fmt.Printf("Failed to generate QR code for order %s: %v", order.ID, err)
-	} else {
-		order.QRCode = qrCode.Code
-		if err := tx.Save(order).Error; err != nil {
+		// The stock is taken at checkout, so two customers can't both buy
+		// the last one
+		reference := orderNumber
+		movement, err := s.stock.Apply(tx, StockChange{
+			ProductID: cartItem.ProductID,
+			BranchID:  req.BranchID,
+			Quantity:  -cartItem.Quantity,
+			Type:      models.MovementTypeOut,
+			Reason:    "Online order",
+			Reference: &reference,
+			UserID:    req.CreatedBy,
+		})
+		if err != nil {
 			tx.Rollback()
-			return nil, fmt.Errorf("failed to update order with QR code: %w", err)
+			if errors.Is(err, ErrInsufficientStock) {
+				return nil, fmt.Errorf("%w for product %s", err, cartItem.Product.Name)
+			}
+			return nil, err
 		}
+		movements = append(movements, movement)
 	}
 
 	// Create initial status history
 	statusHistory := &models.OrderStatusHistory{
 		OrderID:        order.ID,
-		NewStatus:      models.OrderStatusPending,
+		NewStatus:      initialStatus,
 		Reason:         "Order created",
 		UpdatedByUser:  req.CreatedBy,
 		IsSystemUpdate: true,
@@ -297,6 +493,13 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 		return nil, fmt.Errorf("failed to create status history: %w", err)
 	}
 
+	// Queue the confirmation with the order so it is sent even if we crash
+	// right after committing
+	if err := s.queueOrderEvent(tx, order, "order.created"); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
 	// Clear cart after successful order creation
 	if err := s.clearCartInTx(tx, req.CustomerID, req.SessionID); err != nil {
 		tx.Rollback()
@@ -309,20 +512,25 @@ func (s *OnlineOrderService) CreateOrder(ctx context.Context, req CreateOrderReq
 	}
 
 	// Load complete order with relationships
-	if err := s.db.Preload("OrderItems.Product").Preload("Customer").
+	if err := s.db.Preload("OrderItems.Product", WithDeleted).Preload("Customer", WithDeleted).
 		First(order, order.ID).Error; err != nil {
 		return nil, fmt.Errorf("failed to load complete order: %w", err)
 	}
 
+	s.events.Publish(ctx, realtime.TopicNewOrders, order.BranchID, newOrderEvent(order))
+	s.stock.Announce(ctx, movements...)
 	return order, nil
 }
 
 // GetOrder retrieves an order by ID
 func (s *OnlineOrderService) GetOrder(ctx context.Context, orderID uuid.UUID) (*models.OnlineOrder, error) {
+	return s.GetOrderWith(ctx, orderID, OnlineOrderIncludes.Select(OrderDetailIncludes...))
+}
+
+// GetOrderWith retrieves an order by ID with the relations of include
+func (s *OnlineOrderService) GetOrderWith(ctx context.Context, orderID uuid.UUID, include query.Selection) (*models.OnlineOrder, error) {
 	var order models.OnlineOrder
-	if err := s.db.Preload("OrderItems.Product").Preload("Customer").
-		Preload("OrderHistory.User").Preload("Pharmacist").
-		First(&order, orderID).Error; err != nil {
+	if err := include.Apply(s.db.WithContext(ctx)).First(&order, orderID).Error; err != nil {
 		return nil, fmt.Errorf("order not found: %w", err)
 	}
 	return &order, nil
@@ -331,22 +539,53 @@ func (s *OnlineOrderService) GetOrder(ctx context.Context, orderID uuid.UUID) (*
 // GetOrderByNumber retrieves an order by order number
 func (s *OnlineOrderService) GetOrderByNumber(ctx context.Context, orderNumber string) (*models.OnlineOrder, error) {
 	var order models.OnlineOrder
-	if err := s.db.Preload("OrderItems.Product").Preload("Customer").
+	if err := s.db.Preload("OrderItems.Product", WithDeleted).Preload("Customer", WithDeleted).
 		Where("order_number = ?", orderNumber).First(&order).Error; err != nil {
 		return nil, fmt.Errorf("order not found: %w", err)
 	}
 	return &order, nil
 }
 
+// TrackOrder returns what the public tracking page shows of the order
+// with the tracking code: its progress and what was ordered, but not who
+// ordered it or where it goes
+func (s *OnlineOrderService) TrackOrder(ctx context.Context, trackingCode string) (*OrderTracking, error) {
+	var order models.OnlineOrder
+	if err := s.db.WithContext(ctx).Preload("OrderItems.Product", WithDeleted).
+		Where("tracking_code = ?", trackingCode).First(&order).Error; err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+
+	return newOrderTracking(s.db.WithContext(ctx), &order)
+}
+
 // UpdateOrderStatus updates the status of an order
 func (s *OnlineOrderService) UpdateOrderStatus(ctx context.Context, orderID uuid.UUID, newStatus models.OrderStatus, reason string, userID *uuid.UUID) error {
+	var change *OrderStatusChange
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		change, err = s.ApplyStatus(tx, orderID, newStatus, reason, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	s.AnnounceStatus(ctx, change)
+	return nil
+}
+
+// ApplyStatus moves an order to newStatus in tx, recording its history and
+// queueing its webhook. Once tx commits, the change is passed to
+// AnnounceStatus; tx must be rolled back on an error.
+func (s *OnlineOrderService) ApplyStatus(tx *gorm.DB, orderID uuid.UUID, newStatus models.OrderStatus, reason string, userID *uuid.UUID) (*OrderStatusChange, error) {
 	// Get current order
 	var order models.OnlineOrder
-	if err := s.db.First(&order, orderID).Error; err != nil {
-		return fmt.Errorf("order not found: %w", err)
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
 	}
 
-	previousStatus := order.Status
+	change := &OrderStatusChange{previous: order.Status}
 
 	// Update order status
 	order.Status = newStatus
@@ -362,31 +601,70 @@ func (s *OnlineOrderService) UpdateOrderStatus(ctx context.Context, orderID uuid
 		order.ActualDeliveryDate = &now
 	}
 
-	if err := s.db.Save(&order).Error; err != nil {
-		return fmt.Errorf("failed to update order status: %w", err)
+	// Only the request that cancels the order puts its stock back
+	if newStatus == models.OrderStatusCancelled {
+		result := tx.Model(&models.OnlineOrder{}).
+			Where("id = ? AND status <> ?", orderID, models.OrderStatusCancelled).
+			Update("status", models.OrderStatusCancelled)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to cancel order: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			var err error
+			if change.returned, err = s.returnStock(tx, &order, userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := tx.Save(&order).Error; err != nil {
+		return nil, fmt.Errorf("failed to update order status: %w", err)
 	}
 
 	// Create status history entry
 	statusHistory := &models.OrderStatusHistory{
 		OrderID:        orderID,
-		PreviousStatus: &previousStatus,
+		PreviousStatus: &change.previous,
 		NewStatus:      newStatus,
 		Reason:         reason,
 		UpdatedByUser:  userID,
 		IsSystemUpdate: userID == nil,
 	}
 
-	if err := s.db.Create(statusHistory).Error; err != nil {
-		return fmt.Errorf("failed to create status history: %w", err)
+	if err := tx.Create(statusHistory).Error; err != nil {
+		return nil, fmt.Errorf("failed to create status history: %w", err)
 	}
 
-	return nil
+	// The purchase goes on the customer's history with the handover
+	if s.history != nil && (newStatus == models.OrderStatusDelivered || newStatus == models.OrderStatusPickedUp) {
+		if err := s.history.RecordOrder(tx, orderID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.queueOrderEvent(tx, &order, "order.status_changed"); err != nil {
+		return nil, err
+	}
+	change.order = order
+	return change, nil
+}
+
+// AnnounceStatus pushes a committed status change to the screens watching
+// orders, and the stock a cancellation put back to those watching stock
+func (s *OnlineOrderService) AnnounceStatus(ctx context.Context, change *OrderStatusChange) {
+	s.events.Publish(ctx, realtime.TopicOrderStatus, change.order.BranchID, OrderStatusEvent{
+		OrderID:        change.order.ID,
+		OrderNumber:    change.order.OrderNumber,
+		Status:         change.order.Status,
+		PreviousStatus: change.previous,
+		UpdatedAt:      change.order.UpdatedAt,
+	})
+	s.stock.Announce(ctx, change.returned...)
 }
 
 // GetCustomerOrders retrieves orders for a specific customer
-func (s *OnlineOrderService) GetCustomerOrders(ctx context.Context, customerID uuid.UUID, limit, offset int) ([]models.OnlineOrder, error) {
+func (s *OnlineOrderService) GetCustomerOrders(ctx context.Context, customerID uuid.UUID, limit, offset int, include query.Selection) ([]models.OnlineOrder, error) {
 	var orders []models.OnlineOrder
-	err := s.db.Preload("OrderItems.Product").
+	err := include.Apply(s.db.WithContext(ctx)).
 		Where("customer_id = ?", customerID).
 		Order("created_at DESC").
 		Limit(limit).Offset(offset).
@@ -396,7 +674,47 @@ func (s *OnlineOrderService) GetCustomerOrders(ctx context.Context, customerID u
 
 // SearchOrders searches orders with various filters
 func (s *OnlineOrderService) SearchOrders(ctx context.Context, filters OrderSearchFilters) ([]models.OnlineOrder, int64, error) {
-	query := s.db.Model(&models.OnlineOrder{}).Preload("Customer").Preload("OrderItems.Product")
+	query := s.searchQuery(ctx, filters)
+
+	// Get total count
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get paginated results
+	var orders []models.OnlineOrder
+	err := query.Offset(filters.Offset).Limit(filters.Limit).
+		Order("created_at DESC").Find(&orders).Error
+
+	return orders, total, err
+}
+
+// SearchOrdersAfter is SearchOrders with keyset pagination. It returns the
+// orders after cursor and the cursor of the next page, empty on the last.
+func (s *OnlineOrderService) SearchOrdersAfter(ctx context.Context, filters OrderSearchFilters, cursor string) ([]models.OnlineOrder, string, error) {
+	filters.Limit = query.CursorPageSize(filters.Limit, 20)
+	after, err := query.AfterCursor(s.searchQuery(ctx, filters), "online_orders", cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var orders []models.OnlineOrder
+	if err := after.Limit(filters.Limit + 1).Find(&orders).Error; err != nil {
+		return nil, "", err
+	}
+	if len(orders) <= filters.Limit {
+		return orders, "", nil
+	}
+	orders = orders[:filters.Limit]
+	last := orders[len(orders)-1]
+	return orders, query.EncodeCursor(last.CreatedAt, last.ID), nil
+}
+
+// Helper methods
+
+func (s *OnlineOrderService) searchQuery(ctx context.Context, filters OrderSearchFilters) *gorm.DB {
+	query := filters.Include.Apply(s.db.WithContext(ctx).Model(&models.OnlineOrder{}))
 
 	// Apply filters
 	if filters.Status != "" {
@@ -412,7 +730,8 @@ func (s *OnlineOrderService) SearchOrders(ctx context.Context, filters OrderSear
 		query = query.Where("created_at <= ?", filters.EndDate)
 	}
 	if filters.CustomerID != nil {
-		query = query.Where("customer_id = ?", *filters.CustomerID)
+		// Include orders the customer placed for their dependents
+		query = query.Where("customer_id = ? OR guardian_id = ?", *filters.CustomerID, *filters.CustomerID)
 	}
 	if filters.PharmacistID != nil {
 		query = query.Where("pharmacist_id = ?", *filters.PharmacistID)
@@ -420,23 +739,9 @@ func (s *OnlineOrderService) SearchOrders(ctx context.Context, filters OrderSear
 	if filters.PrescriptionRequired != nil {
 		query = query.Where("prescription_required = ?", *filters.PrescriptionRequired)
 	}
-
-	// Get total count
-	var total int64
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
-	}
-
-	// Get paginated results
-	var orders []models.OnlineOrder
-	err := query.Offset(filters.Offset).Limit(filters.Limit).
-		Order("created_at DESC").Find(&orders).Error
-
-	return orders, total, err
+	return query
 }
 
-// Helper methods
-
 func (s *OnlineOrderService) getCartForOrder(tx *gorm.DB, customerID *uuid.UUID, sessionID *string) ([]models.ShoppingCart, error) {
 	query := tx.Preload("Product").Where("expires_at > ?", time.Now().UTC())
 	
@@ -452,8 +757,8 @@ func (s *OnlineOrderService) getCartForOrder(tx *gorm.DB, customerID *uuid.UUID,
 	return cartItems, query.Find(&cartItems).Error
 }
 
-func (s *OnlineOrderService) calculateOrderTotals(cartItems []models.ShoppingCart) (float64, bool, error) {
-	var subtotal float64
+func (s *OnlineOrderService) calculateOrderTotals(cartItems []models.ShoppingCart) (models.Money, bool, error) {
+	var subtotal models.Money
 	var prescriptionRequired bool
 
 	for _, item := range cartItems {
@@ -464,11 +769,11 @@ func (s *OnlineOrderService) calculateOrderTotals(cartItems []models.ShoppingCar
 		}
 
 		if product.Stock < item.Quantity {
-			return 0, false, fmt.Errorf("insufficient stock for product %s: available %d, requested %d", 
-				product.Name, product.Stock, item.Quantity)
+			return 0, false, fmt.Errorf("%w for product %s: available %d, requested %d", 
+				ErrInsufficientStock, product.Name, product.Stock, item.Quantity)
 		}
 
-		subtotal += float64(item.Quantity) * item.UnitPrice
+		subtotal += item.UnitPrice.Mul(item.Quantity)
 
 		if product.PrescriptionRequired {
 			prescriptionRequired = true
@@ -478,14 +783,35 @@ func (s *OnlineOrderService) calculateOrderTotals(cartItems []models.ShoppingCar
 	return subtotal, prescriptionRequired, nil
 }
 
-func (s *OnlineOrderService) generateOrderNumber() string {
-	timestamp := time.Now().Format("20060102")
-	randomID := uuid.New().String()[:8]
-	return fmt.Sprintf("ORD-%s-%s", timestamp, randomID)
+// returnStock puts back the stock a cancelled order took at checkout, and
+// returns the movements that did
+func (s *OnlineOrderService) returnStock(tx *gorm.DB, order *models.OnlineOrder, userID *uuid.UUID) ([]*models.StockMovement, error) {
+	var taken []models.StockMovement
+	if err := tx.Where("reference = ? AND type = ?", order.OrderNumber, models.MovementTypeOut).
+		Find(&taken).Error; err != nil {
+		return nil, fmt.Errorf("failed to load order stock movements: %w", err)
+	}
+	var returned []*models.StockMovement
+	for _, movement := range taken {
+		back, err := s.stock.Apply(tx, StockChange{
+			ProductID: movement.ProductID,
+			BranchID:  movement.BranchID,
+			Quantity:  movement.Quantity,
+			Type:      models.MovementTypeReturn,
+			Reason:    "Online order cancelled",
+			Reference: movement.Reference,
+			UserID:    userID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		returned = append(returned, back)
+	}
+	return returned, nil
 }
 
 func (s *OnlineOrderService) clearCartInTx(tx *gorm.DB, customerID *uuid.UUID, sessionID *string) error {
-	query := tx.Model(&models.ShoppingCart{})
+	query := tx.Unscoped().Model(&models.ShoppingCart{})
 	
 	if customerID != nil {
 		query = query.Where("customer_id = ?", *customerID)
@@ -498,6 +824,148 @@ func (s *OnlineOrderService) clearCartInTx(tx *gorm.DB, customerID *uuid.UUID, s
 	return query.Delete(&models.ShoppingCart{}).Error
 }
 
+// orderStatusMessages are the statuses the customer is told about. Texts
+// use the order.<status> SMS template instead where one is stored.
+var orderStatusMessages = map[models.OrderStatus]string{
+	models.OrderStatusPending:            "We have received your order %s.",
+	models.OrderStatusPrescriptionNeeded: "We have received your order %s. It will be prepared once your prescription is verified.",
+	models.OrderStatusReady:              "Your order %s is ready for pickup.",
+	models.OrderStatusOutForDelivery:     "Your order %s is out for delivery.",
+	models.OrderStatusDelivered:          "Your order %s has been delivered.",
+	models.OrderStatusPickedUp:           "Your order %s has been picked up. Thank you!",
+	models.OrderStatusCancelled:          "Your order %s has been cancelled.",
+	models.OrderStatusRefunded:           "Your order %s has been refunded.",
+}
+
+// queueOrderEvent adds the webhook for an order change, and the customer's
+// notification when the new status is one they are told about, to tx.
+// Neither carries the order's items; the confirmation email of a new order
+// loads them when it is sent.
+func (s *OnlineOrderService) queueOrderEvent(tx *gorm.DB, order *models.OnlineOrder, event string) error {
+	if s.outbox == nil {
+		return nil
+	}
+
+	if err := s.outbox.QueueWebhook(tx, event, map[string]interface{}{
+		"order_id":     order.ID,
+		"order_number": order.OrderNumber,
+		"status":       order.Status,
+		"total":        order.Total,
+		"customer_id":  order.CustomerID,
+	}); err != nil {
+		return err
+	}
+
+	text, ok := orderStatusMessages[order.Status]
+	if !ok {
+		return nil
+	}
+	notification := OutboxNotification{
+		Event:   event,
+		Purpose: models.PurposeTransactional,
+		Subject: "Order " + order.OrderNumber,
+		Body:    fmt.Sprintf(text, order.OrderNumber),
+		SMS: &SMSText{
+			Template: "order." + string(order.Status),
+			Data:     map[string]string{"order_number": order.OrderNumber},
+		},
+		Push: &PushContent{Data: map[string]string{
+			"order_id":     order.ID.String(),
+			"order_number": order.OrderNumber,
+			"status":       string(order.Status),
+		}},
+	}
+	if event == "order.created" {
+		notification.Email = &EmailContent{
+			Template: EmailTemplateOrderConfirmation,
+			Data:     EmailOrderRef{OrderID: order.ID},
+		}
+	}
+	// Guests also hear on the devices registered for the app session that
+	// placed the order
+	if order.CustomerID == nil && order.SessionID != nil && s.outbox.pushEnabled() {
+		push := notification
+		push.Channel, push.Recipient = ChannelPush, PushSessionPrefix+*order.SessionID
+		if err := s.outbox.QueueNotification(tx, push); err != nil {
+			return err
+		}
+	}
+
+	// Orders for a dependent are reported to the guardian who placed them
+	switch {
+	case order.GuardianID != nil:
+		notification.CustomerID = order.GuardianID
+	case order.CustomerID != nil:
+		notification.CustomerID = order.CustomerID
+	case order.GuestEmail != nil && *order.GuestEmail != "":
+		notification.Channel, notification.Recipient = ChannelEmail, *order.GuestEmail
+	case order.GuestPhone != nil && *order.GuestPhone != "":
+		notification.Channel, notification.Recipient = ChannelSMS, *order.GuestPhone
+	default:
+		return nil
+	}
+	return s.outbox.QueueNotification(tx, notification)
+}
+
+// newOrderEvent is what the fulfillment screen is told of a new order
+func newOrderEvent(order *models.OnlineOrder) NewOrderEvent {
+	return NewOrderEvent{
+		OrderID:              order.ID,
+		OrderNumber:          order.OrderNumber,
+		Status:               order.Status,
+		OrderType:            order.OrderType,
+		Total:                order.Total,
+		ItemCount:            len(order.OrderItems),
+		PrescriptionRequired: order.PrescriptionRequired,
+		CreatedAt:            order.CreatedAt,
+	}
+}
+
+// newOrderTracking builds the public view of an order loaded with its
+// items' products, adding its status history
+func newOrderTracking(db *gorm.DB, order *models.OnlineOrder) (*OrderTracking, error) {
+	var history []models.OrderStatusHistory
+	if err := db.Where("order_id = ?", order.ID).
+		Order("created_at ASC").Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to load status history: %w", err)
+	}
+
+	tracking := &OrderTracking{
+		OrderNumber:      order.OrderNumber,
+		Status:           order.Status,
+		OrderType:        order.OrderType,
+		PaymentStatus:    order.PaymentStatus,
+		Subtotal:         order.Subtotal,
+		Tax:              order.Tax,
+		DeliveryFee:      order.DeliveryFee,
+		Discount:         order.Discount,
+		Total:            order.Total,
+		Currency:         order.Currency,
+		CreatedAt:        order.CreatedAt,
+		ExpectedDelivery: order.ExpectedDeliveryDate,
+		ActualDelivery:   order.ActualDeliveryDate,
+		TrackingNumber:   order.TrackingNumber,
+		Items:            make([]OrderTrackingItem, 0, len(order.OrderItems)),
+		StatusHistory:    make([]OrderTrackingStatus, 0, len(history)),
+	}
+	for _, item := range order.OrderItems {
+		tracking.Items = append(tracking.Items, OrderTrackingItem{
+			ProductName: item.Product.Name,
+			Quantity:    item.Quantity,
+			UnitPrice:   item.UnitPrice,
+			TotalPrice:  item.TotalPrice,
+			Status:      item.Status,
+		})
+	}
+	for _, change := range history {
+		tracking.StatusHistory = append(tracking.StatusHistory, OrderTrackingStatus{
+			Status:    change.NewStatus,
+			ChangedAt: change.CreatedAt,
+		})
+	}
+	return tracking, nil
+}
+
 // Request/Response types
 
 type AddToCartRequest struct {
@@ -508,6 +976,7 @@ type AddToCartRequest struct {
 	Dosage       *string    `json:"dosage"`
 	Instructions *string    `json:"instructions"`
 	Duration     *string    `json:"duration"`
+	BranchID     *uuid.UUID `json:"branch_id"` // prices the item at this branch
 }
 
 type UpdateCartItemRequest struct {
@@ -519,6 +988,7 @@ type UpdateCartItemRequest struct {
 
 type CreateOrderRequest struct {
 	CustomerID       *uuid.UUID         `json:"customer_id"`
+	DependentID      *uuid.UUID         `json:"dependent_id"` // order on behalf of one of the customer's dependents
 	SessionID        *string            `json:"session_id"`
 	GuestEmail       *string            `json:"guest_email"`
 	GuestPhone       *string            `json:"guest_phone"`
@@ -529,20 +999,87 @@ type CreateOrderRequest struct {
 	DeliveryState    string             `json:"delivery_state"`
 	DeliveryZipCode  string             `json:"delivery_zip_code"`
 	DeliveryNotes    string             `json:"delivery_notes"`
-	DeliveryFee      float64            `json:"delivery_fee"`
-	Discount         float64            `json:"discount"`
+	DeliveryFee      models.Money       `json:"delivery_fee"`
+	Discount         models.Money       `json:"discount"`
 	CustomerNotes    string             `json:"customer_notes"`
+	BranchID         *uuid.UUID         `json:"branch_id"` // branch that fills the order
 	CreatedBy        *uuid.UUID         `json:"created_by"`
 }
 
+// NewOrderEvent is an online order as pushed to the fulfillment screen. It
+// leaves out the customer; the screen loads the order to see who it is for.
+type NewOrderEvent struct {
+	OrderID              uuid.UUID          `json:"order_id"`
+	OrderNumber          string             `json:"order_number"`
+	Status               models.OrderStatus `json:"status"`
+	OrderType            models.OrderType   `json:"order_type"`
+	Total                models.Money       `json:"total"`
+	ItemCount            int                `json:"item_count"`
+	PrescriptionRequired bool               `json:"prescription_required"`
+	CreatedAt            time.Time          `json:"created_at"`
+}
+
+// OrderStatusChange is a status change ApplyStatus made, for AnnounceStatus
+// once its transaction has committed
+type OrderStatusChange struct {
+	order    models.OnlineOrder
+	previous models.OrderStatus
+	returned []*models.StockMovement
+}
+
+// OrderStatusEvent is an order's move to a new status, as pushed to the
+// screens watching orders
+type OrderStatusEvent struct {
+	OrderID        uuid.UUID          `json:"order_id"`
+	OrderNumber    string             `json:"order_number"`
+	Status         models.OrderStatus `json:"status"`
+	PreviousStatus models.OrderStatus `json:"previous_status"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
 type OrderSearchFilters struct {
-	Status               string      `json:"status"`
-	OrderType            string      `json:"order_type"`
-	StartDate            time.Time   `json:"start_date"`
-	EndDate              time.Time   `json:"end_date"`
-	CustomerID           *uuid.UUID  `json:"customer_id"`
-	PharmacistID         *uuid.UUID  `json:"pharmacist_id"`
-	PrescriptionRequired *bool       `json:"prescription_required"`
-	Limit                int         `json:"limit"`
-	Offset               int         `json:"offset"`
-}
\ No newline at end of file
+	Status               string          `json:"status"`
+	OrderType            string          `json:"order_type"`
+	StartDate            time.Time       `json:"start_date"`
+	EndDate              time.Time       `json:"end_date"`
+	CustomerID           *uuid.UUID      `json:"customer_id"`
+	PharmacistID         *uuid.UUID      `json:"pharmacist_id"`
+	PrescriptionRequired *bool           `json:"prescription_required"`
+	Limit                int             `json:"limit"`
+	Offset               int             `json:"offset"`
+	Include              query.Selection `json:"-"` // relations to embed
+}
+// OrderTracking is the public view of an order, for anyone holding its
+// tracking code. It leaves out the customer, their contact details and the
+// delivery address.
+type OrderTracking struct {
+	OrderNumber      string                `json:"order_number"`
+	Status           models.OrderStatus    `json:"status"`
+	OrderType        models.OrderType      `json:"order_type"`
+	PaymentStatus    models.PaymentStatus  `json:"payment_status"`
+	Subtotal         models.Money          `json:"subtotal"`
+	Tax              models.Money          `json:"tax"`
+	DeliveryFee      models.Money          `json:"delivery_fee"`
+	Discount         models.Money          `json:"discount"`
+	Total            models.Money          `json:"total"`
+	Currency         string                `json:"currency"`
+	CreatedAt        time.Time             `json:"created_at"`
+	ExpectedDelivery *time.Time            `json:"expected_delivery"`
+	ActualDelivery   *time.Time            `json:"actual_delivery"`
+	TrackingNumber   *string               `json:"tracking_number"`
+	Items            []OrderTrackingItem   `json:"items"`
+	StatusHistory    []OrderTrackingStatus `json:"status_history"`
+}
+
+type OrderTrackingItem struct {
+	ProductName string            `json:"product_name"`
+	Quantity    int               `json:"quantity"`
+	UnitPrice   models.Money      `json:"unit_price"`
+	TotalPrice  models.Money      `json:"total_price"`
+	Status      models.ItemStatus `json:"status"`
+}
+
+type OrderTrackingStatus struct {
+	Status    models.OrderStatus `json:"status"`
+	ChangedAt time.Time          `json:"changed_at"`
+}
@@ -0,0 +1,489 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/alerting"
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var ErrOutboxMessageNotFailed = errors.New("only failed messages can be retried")
+
+const (
+	outboxBatchSize = 100
+	// outboxLease is how long a claimed message is left alone before another
+	// dispatcher assumes its delivery was interrupted and tries again
+	outboxLease = 5 * time.Minute
+
+	// Failed deliveries and jobs wait retryBaseBackoff, doubling after each
+	// attempt up to retryMaxBackoff
+	retryBaseBackoff = 30 * time.Second
+	retryMaxBackoff  = time.Hour
+)
+
+// OutboxService queues customer notifications, staff alerts and webhooks
+// in the same transaction as the order, sale or stock change they report,
+// and delivers them afterwards with retries
+type OutboxService struct {
+	db             *gorm.DB
+	communications *CommunicationService
+	push           *PushService
+	client         *http.Client
+	alerts         *alerting.Notifier
+	config         config.OutboxConfig
+}
+
+func NewOutboxService(db *gorm.DB, communications *CommunicationService, cfg config.OutboxConfig) *OutboxService {
+	return &OutboxService{
+		db:             db,
+		communications: communications,
+		client:         &http.Client{Timeout: 10 * time.Second},
+		config:         cfg,
+	}
+}
+
+// SetPushService turns on staff alerts, pushed to the devices of the staff
+// who get them. QueueStaffAlert does nothing until it is set.
+func (s *OutboxService) SetPushService(push *PushService) {
+	s.push = push
+}
+
+// SetAlerting posts webhooks given up on to the operations channels
+func (s *OutboxService) SetAlerting(alerts *alerting.Notifier) {
+	s.alerts = alerts
+}
+
+// QueueNotification adds a customer notification to tx
+func (s *OutboxService) QueueNotification(tx *gorm.DB, notification OutboxNotification) error {
+	message := &models.OutboxMessage{
+		Kind:          models.OutboxNotification,
+		Event:         notification.Event,
+		Status:        models.OutboxPending,
+		CustomerID:    notification.CustomerID,
+		Channel:       notification.Channel,
+		Recipient:     notification.Recipient,
+		Purpose:       notification.Purpose,
+		Subject:       notification.Subject,
+		Body:          notification.Body,
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if notification.SMS != nil {
+		data, err := json.Marshal(notification.SMS.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode SMS template data: %w", err)
+		}
+		message.SMSTemplate = notification.SMS.Template
+		message.SMSData = string(data)
+	}
+	if notification.Email != nil {
+		data, err := json.Marshal(notification.Email.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode email template data: %w", err)
+		}
+		message.EmailTemplate = notification.Email.Template
+		message.EmailData = string(data)
+	}
+	if notification.Push != nil {
+		data, err := json.Marshal(notification.Push.Data)
+		if err != nil {
+			return fmt.Errorf("failed to encode push data: %w", err)
+		}
+		message.PushData = string(data)
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return fmt.Errorf("failed to queue notification: %w", err)
+	}
+	return nil
+}
+
+// QueueStaffAlert adds an alert for the staff who get it to tx, when push
+// notifications are on
+func (s *OutboxService) QueueStaffAlert(tx *gorm.DB, alert StaffAlertMessage) error {
+	if s.push == nil {
+		return nil
+	}
+	payload, err := json.Marshal(staffAlertPayload{Alert: alert.Alert, BranchID: alert.BranchID, Data: alert.Data})
+	if err != nil {
+		return fmt.Errorf("failed to encode staff alert: %w", err)
+	}
+	message := &models.OutboxMessage{
+		Kind:          models.OutboxStaffAlert,
+		Event:         "staff." + string(alert.Alert),
+		Status:        models.OutboxPending,
+		Channel:       ChannelPush,
+		Subject:       alert.Title,
+		Body:          alert.Body,
+		Payload:       string(payload),
+		NextAttemptAt: time.Now().UTC(),
+	}
+	if err := tx.Create(message).Error; err != nil {
+		return fmt.Errorf("failed to queue staff alert: %w", err)
+	}
+	return nil
+}
+
+// QueueWebhook adds a delivery of event to every configured webhook
+// endpoint to tx. The body carries the message ID, event, time and data.
+func (s *OutboxService) QueueWebhook(tx *gorm.DB, event string, data interface{}) error {
+	now := time.Now().UTC()
+	for _, url := range s.config.WebhookURLs {
+		message := &models.OutboxMessage{
+			Kind:          models.OutboxWebhook,
+			Event:         event,
+			Status:        models.OutboxPending,
+			URL:           url,
+			NextAttemptAt: now,
+		}
+		message.ID = uuid.New()
+
+		payload, err := json.Marshal(WebhookPayload{ID: message.ID, Event: event, CreatedAt: now, Data: data})
+		if err != nil {
+			return fmt.Errorf("failed to encode webhook: %w", err)
+		}
+		message.Payload = string(payload)
+
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to queue webhook: %w", err)
+		}
+	}
+	return nil
+}
+
+// Dispatch delivers due messages. Each is claimed before delivery so that
+// several servers can dispatch at once; failures are retried with backoff
+// until the maximum attempts.
+func (s *OutboxService) Dispatch(ctx context.Context) (*OutboxDispatchResult, error) {
+	var due []models.OutboxMessage
+	if err := s.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, time.Now().UTC()).
+		Order("next_attempt_at ASC").Limit(outboxBatchSize).
+		Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to load outbox: %w", err)
+	}
+
+	result := &OutboxDispatchResult{}
+	for i := range due {
+		message := &due[i]
+		claimed, err := s.claim(ctx, message)
+		if err != nil {
+			return result, err
+		}
+		if !claimed {
+			continue
+		}
+
+		updates := map[string]interface{}{}
+		err = s.deliver(ctx, message)
+		switch {
+		case err == nil:
+			updates["status"] = models.OutboxSent
+			updates["sent_at"] = time.Now().UTC()
+			updates["last_error"] = ""
+			result.Sent++
+		case errors.Is(err, ErrNotificationSuppressed):
+			updates["status"] = models.OutboxSuppressed
+			result.Suppressed++
+		case message.Attempts >= s.config.MaxAttempts:
+			updates["status"] = models.OutboxFailed
+			updates["last_error"] = err.Error()
+			result.Failed++
+			if message.Kind == models.OutboxWebhook {
+				s.alertWebhookFailed(message, err)
+			}
+		default:
+			updates["next_attempt_at"] = time.Now().UTC().Add(retryBackoff(message.Attempts))
+			updates["last_error"] = err.Error()
+			result.Retrying++
+		}
+
+		if err := s.db.WithContext(ctx).Model(&models.OutboxMessage{}).Where("id = ?", message.ID).Updates(updates).Error; err != nil {
+			return result, fmt.Errorf("failed to update outbox message: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// RunDispatcher delivers the outbox on the configured interval until ctx is
+// done
+func (s *OutboxService) RunDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(s.config.DispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// A batch being delivered is finished on shutdown, so messages
+			// that went out are marked sent
+			result, err := s.Dispatch(lifecycle.WorkContext(ctx))
+			if err != nil {
+				logrus.WithError(err).Error("Failed to dispatch outbox")
+				continue
+			}
+			if result.Failed > 0 {
+				logrus.WithField("failed", result.Failed).Error("Outbox messages failed after the maximum attempts")
+			}
+		}
+	}
+}
+
+// ListMessages returns outbox messages, newest first, optionally filtered
+// by status
+func (s *OutboxService) ListMessages(ctx context.Context, status string, limit, offset int) ([]models.OutboxMessage, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.OutboxMessage{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count outbox messages: %w", err)
+	}
+
+	var messages []models.OutboxMessage
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load outbox messages: %w", err)
+	}
+	return messages, total, nil
+}
+
+// Depth counts messages waiting to be delivered and messages that failed
+// every attempt
+func (s *OutboxService) Depth(ctx context.Context) (pending, failed int64, err error) {
+	counts, err := countByStatus(s.db.WithContext(ctx).Model(&models.OutboxMessage{}))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count outbox messages: %w", err)
+	}
+	return counts[string(models.OutboxPending)], counts[string(models.OutboxFailed)], nil
+}
+
+// RetryMessage queues a failed message for delivery again
+func (s *OutboxService) RetryMessage(ctx context.Context, id uuid.UUID) (*models.OutboxMessage, error) {
+	var message models.OutboxMessage
+	if err := s.db.WithContext(ctx).First(&message, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("outbox message: %w", err)
+	}
+	if message.Status != models.OutboxFailed {
+		return nil, ErrOutboxMessageNotFailed
+	}
+
+	message.Status = models.OutboxPending
+	message.Attempts = 0
+	message.NextAttemptAt = time.Now().UTC()
+	if err := s.db.WithContext(ctx).Save(&message).Error; err != nil {
+		return nil, fmt.Errorf("failed to retry outbox message: %w", err)
+	}
+	return &message, nil
+}
+
+// Private helper methods
+
+// pushEnabled reports whether push notifications are on
+func (s *OutboxService) pushEnabled() bool {
+	return s.push != nil
+}
+
+// claim takes a due message by pushing its next attempt past the lease. It
+// reports false when another dispatcher took it first.
+func (s *OutboxService) claim(ctx context.Context, message *models.OutboxMessage) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", message.ID, models.OutboxPending, message.NextAttemptAt).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": time.Now().UTC().Add(outboxLease),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim outbox message: %w", result.Error)
+	}
+	message.Attempts++
+	return result.RowsAffected == 1, nil
+}
+
+func (s *OutboxService) deliver(ctx context.Context, message *models.OutboxMessage) error {
+	switch message.Kind {
+	case models.OutboxWebhook:
+		return s.postWebhook(ctx, message)
+	case models.OutboxStaffAlert:
+		return s.pushStaffAlert(ctx, message)
+	}
+
+	var templates MessageTemplates
+	if message.SMSTemplate != "" {
+		templates.SMS = &SMSText{Template: message.SMSTemplate}
+		if err := json.Unmarshal([]byte(message.SMSData), &templates.SMS.Data); err != nil {
+			return fmt.Errorf("invalid SMS template data: %w", err)
+		}
+	}
+	if message.EmailTemplate != "" {
+		templates.Email = &EmailContent{Template: message.EmailTemplate, Data: json.RawMessage(message.EmailData)}
+	}
+	if message.PushData != "" {
+		templates.Push = &PushContent{}
+		if err := json.Unmarshal([]byte(message.PushData), &templates.Push.Data); err != nil {
+			return fmt.Errorf("invalid push data: %w", err)
+		}
+	}
+
+	if message.CustomerID == nil {
+		return s.communications.NotifyAddress(ctx, message.Channel, message.Recipient, message.Subject, message.Body, templates)
+	}
+	var customer models.Customer
+	if err := s.db.WithContext(ctx).First(&customer, "id = ?", *message.CustomerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotificationSuppressed
+		}
+		return err
+	}
+	if customer.AnonymizedAt != nil {
+		return ErrNotificationSuppressed
+	}
+	_, err := s.communications.NotifyCustomerWithTemplate(ctx, &customer, message.Purpose, message.Subject, message.Body, templates)
+	return err
+}
+
+// pushStaffAlert sends a staff alert. One nobody gets, or that finds no
+// device, counts as suppressed.
+func (s *OutboxService) pushStaffAlert(ctx context.Context, message *models.OutboxMessage) error {
+	if s.push == nil {
+		return ErrNotificationSuppressed
+	}
+	var payload staffAlertPayload
+	if err := json.Unmarshal([]byte(message.Payload), &payload); err != nil {
+		return fmt.Errorf("invalid staff alert: %w", err)
+	}
+	sent, err := s.push.NotifyStaff(ctx, payload.Alert, payload.BranchID, &PushMessage{
+		Title: message.Subject,
+		Body:  message.Body,
+		Data:  payload.Data,
+	})
+	if err != nil {
+		return err
+	}
+	if sent == 0 {
+		return ErrNotificationSuppressed
+	}
+	return nil
+}
+
+// alertWebhookFailed posts a webhook given up on, such as a sale's payment
+// not reaching the accounting system. Endpoints are alerted on once per
+// cooldown, however many messages fail.
+func (s *OutboxService) alertWebhookFailed(message *models.OutboxMessage, err error) {
+	s.alerts.Notify(alerting.Alert{
+		Event:    alerting.EventWebhookFailed,
+		Severity: alerting.SeverityCritical,
+		Title:    "Webhook delivery failed",
+		Message:  fmt.Sprintf("The %s webhook was given up on after %d attempts: %v", message.Event, message.Attempts, err),
+		Fields: []alerting.Field{
+			{Name: "Endpoint", Value: message.URL},
+			{Name: "Message", Value: message.ID.String()},
+			{Name: "Retry", Value: "POST /api/v1/outbox/" + message.ID.String() + "/retry"},
+		},
+		Key: message.URL,
+	})
+}
+
+// postWebhook sends the payload signed with HMAC-SHA256 of the webhook
+// secret, so receivers can check it came from us
+func (s *OutboxService) postWebhook(ctx context.Context, message *models.OutboxMessage) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, message.URL, strings.NewReader(message.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	mac := hmac.New(sha256.New, []byte(s.config.WebhookSecret))
+	mac.Write([]byte(message.Payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-ID", message.ID.String())
+	req.Header.Set("X-Webhook-Event", message.Event)
+	req.Header.Set("X-Webhook-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		if body = bytes.TrimSpace(body); len(body) > 0 {
+			return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, body)
+		}
+		return fmt.Errorf("webhook returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// retryBackoff doubles the wait after each failed attempt, up to an hour
+func retryBackoff(attempts int) time.Duration {
+	backoff := retryBaseBackoff
+	for i := 1; i < attempts && backoff < retryMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > retryMaxBackoff {
+		backoff = retryMaxBackoff
+	}
+	return backoff
+}
+
+// Request/Response types
+
+// OutboxNotification is a message for a customer, or for a guest address
+// over Channel when CustomerID is nil
+type OutboxNotification struct {
+	Event      string
+	CustomerID *uuid.UUID
+	Channel    string
+	Recipient  string
+	Purpose    models.NotificationPurpose
+	Subject    string
+	Body       string
+	SMS        *SMSText      // template for the text, when sent by SMS
+	Email      *EmailContent // template for the email, when sent by email
+	Push       *PushContent  // data for the app, when pushed
+}
+
+// staffAlertPayload is what a queued staff alert keeps in its payload
+type staffAlertPayload struct {
+	Alert    models.StaffAlert `json:"alert"`
+	BranchID *uuid.UUID        `json:"branch_id,omitempty"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+type WebhookPayload struct {
+	ID        uuid.UUID   `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+type OutboxDispatchResult struct {
+	Sent       int `json:"sent"`
+	Suppressed int `json:"suppressed"`
+	Retrying   int `json:"retrying"`
+	Failed     int `json:"failed"`
+}
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrderNotPickable = errors.New("only orders being processed can be picked")
+	ErrPickItemClosed   = errors.New("the item was cancelled or is out of stock")
+	ErrPickWrongProduct = errors.New("the scanned barcode is not the ordered product")
+	ErrPickWrongBatch   = errors.New("the scanned batch is not the batch in stock for the ordered product")
+	ErrPickQuantity     = errors.New("more would be picked than was ordered")
+	ErrPickConflict     = errors.New("the item was picked by someone else meanwhile, scan it again")
+)
+
+const (
+	// pickListMaxOrders is the most orders one pick list covers
+	pickListMaxOrders = 50
+
+	// unassignedLocation is where products with no storage location are
+	// listed
+	unassignedLocation = "Unassigned"
+)
+
+// PickingService puts together the pick list for a batch of online orders
+// being processed and records items as they are scanned off the shelves.
+// The scan has to be the ordered product, and the batch in stock when the
+// scan carries one.
+type PickingService struct {
+	db *gorm.DB
+}
+
+func NewPickingService(db *gorm.DB) *PickingService {
+	return &PickingService{db: db}
+}
+
+// PickList consolidates what is still to pick for the orders, or for the
+// oldest orders being processed when orderIDs is empty, by storage location
+// and product
+func (s *PickingService) PickList(ctx context.Context, orderIDs []uuid.UUID) (*PickList, error) {
+	seen := map[uuid.UUID]bool{}
+	unique := orderIDs[:0:0]
+	for _, id := range orderIDs {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	orderIDs = unique
+
+	query := s.db.WithContext(ctx).Preload("OrderItems.Product", WithDeleted)
+	if len(orderIDs) > 0 {
+		query = query.Where("id IN ?", orderIDs)
+	} else {
+		query = query.Where("status = ?", models.OrderStatusProcessing).Limit(pickListMaxOrders)
+	}
+
+	var orders []models.OnlineOrder
+	if err := query.Order("created_at ASC").Find(&orders).Error; err != nil {
+		return nil, fmt.Errorf("failed to load orders: %w", err)
+	}
+	if len(orderIDs) > 0 && len(orders) != len(orderIDs) {
+		return nil, fmt.Errorf("order: %w", gorm.ErrRecordNotFound)
+	}
+	for _, order := range orders {
+		if order.Status != models.OrderStatusProcessing {
+			return nil, fmt.Errorf("%w: %s is %s", ErrOrderNotPickable, order.OrderNumber, order.Status)
+		}
+	}
+
+	units, err := s.storageUnits(ctx, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	list := &PickList{GeneratedAt: time.Now().UTC(), Orders: []PickListOrder{}, Locations: []PickListLocation{}}
+	locations := map[string]map[uuid.UUID]*PickListLine{}
+	for _, order := range orders {
+		summary := PickListOrder{ID: order.ID, OrderNumber: order.OrderNumber, OrderType: order.OrderType}
+		for _, item := range order.OrderItems {
+			if !pickable(&item) {
+				continue
+			}
+			summary.Items++
+			remaining := item.Quantity - item.PickedQuantity
+			if remaining <= 0 {
+				continue
+			}
+			summary.Remaining += remaining
+
+			location := pickLocation(&item.Product, units)
+			if locations[location] == nil {
+				locations[location] = map[uuid.UUID]*PickListLine{}
+			}
+			line := locations[location][item.ProductID]
+			if line == nil {
+				line = &PickListLine{
+					ProductID:   item.ProductID,
+					Name:        item.Product.Name,
+					SKU:         item.Product.SKU,
+					Barcode:     item.Product.Barcode,
+					BatchNumber: item.Product.BatchNumber,
+				}
+				if !item.Product.ExpiryDate.IsZero() {
+					expiry := item.Product.ExpiryDate.Time
+					line.ExpiryDate = &expiry
+				}
+				locations[location][item.ProductID] = line
+			}
+			line.Quantity += remaining
+			line.Items = append(line.Items, PickListItem{
+				OrderID:     order.ID,
+				OrderNumber: order.OrderNumber,
+				ItemID:      item.ID,
+				Quantity:    remaining,
+			})
+			list.Units += remaining
+		}
+		list.Orders = append(list.Orders, summary)
+	}
+
+	for name, lines := range locations {
+		location := PickListLocation{Location: name}
+		for _, line := range lines {
+			location.Lines = append(location.Lines, *line)
+		}
+		sort.Slice(location.Lines, func(i, j int) bool { return location.Lines[i].Name < location.Lines[j].Name })
+		list.Locations = append(list.Locations, location)
+	}
+	// Shelves in order, with what has nowhere to be found last
+	sort.Slice(list.Locations, func(i, j int) bool {
+		a, b := list.Locations[i].Location, list.Locations[j].Location
+		if (a == unassignedLocation) != (b == unassignedLocation) {
+			return b == unassignedLocation
+		}
+		return a < b
+	})
+	return list, nil
+}
+
+// CheckPick verifies a scan against an order item without recording it,
+// reporting whether picking it would leave nothing on the order to pick
+func (s *PickingService) CheckPick(ctx context.Context, orderID, itemID uuid.UUID, req PickRequest) (bool, error) {
+	tx := s.db.WithContext(ctx)
+	pick, err := s.verify(tx, orderID, itemID, req)
+	if err != nil {
+		return false, err
+	}
+	left, err := s.leftToPick(tx, orderID, itemID)
+	if err != nil {
+		return false, err
+	}
+	return left == 0 && pick.item.PickedQuantity+pick.quantity == pick.item.Quantity, nil
+}
+
+// Pick records a scan of an order item: its quantity, by default the rest
+// of the item, as picked from the batch in stock. The item is ready once
+// all of it is picked.
+func (s *PickingService) Pick(ctx context.Context, orderID, itemID uuid.UUID, req PickRequest, userID uuid.UUID) (*PickResult, error) {
+	var result PickResult
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		pick, err := s.verify(tx, orderID, itemID, req)
+		if err != nil {
+			return err
+		}
+
+		item := pick.item
+		now := time.Now().UTC()
+		updates := map[string]interface{}{
+			"picked_quantity":     item.PickedQuantity + pick.quantity,
+			"picked_batch_number": item.Product.BatchNumber,
+			"picked_by":           userID,
+			"picked_at":           now,
+		}
+		if item.PickedQuantity+pick.quantity == item.Quantity {
+			updates["status"] = models.ItemStatusReady
+		}
+		// Two scans of the same item at once only count once
+		update := tx.Model(&models.OnlineOrderItem{}).
+			Where("id = ? AND picked_quantity = ?", item.ID, item.PickedQuantity).
+			Updates(updates)
+		if update.Error != nil {
+			return fmt.Errorf("failed to record pick: %w", update.Error)
+		}
+		if update.RowsAffected == 0 {
+			return ErrPickConflict
+		}
+
+		result.Item = PickedItem{
+			ID:                item.ID,
+			ProductID:         item.ProductID,
+			Quantity:          item.Quantity,
+			PickedQuantity:    item.PickedQuantity + pick.quantity,
+			PickedBatchNumber: item.Product.BatchNumber,
+			PickedBy:          userID,
+			PickedAt:          now,
+			Status:            item.Status,
+		}
+		if status, ok := updates["status"].(models.ItemStatus); ok {
+			result.Item.Status = status
+		}
+
+		left, err := s.leftToPick(tx, orderID, uuid.Nil)
+		if err != nil {
+			return err
+		}
+		result.LeftToPick = left
+		result.AllPicked = left == 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Private helper methods
+
+type verifiedPick struct {
+	item     *models.OnlineOrderItem
+	quantity int
+}
+
+// verify checks the order can be picked and the scan is the item's product
+// and batch, returning the quantity it picks
+func (s *PickingService) verify(tx *gorm.DB, orderID, itemID uuid.UUID, req PickRequest) (*verifiedPick, error) {
+	var order models.OnlineOrder
+	if err := tx.Select("id, order_number, status, branch_id").First(&order, "id = ?", orderID).Error; err != nil {
+		return nil, fmt.Errorf("order: %w", err)
+	}
+	if order.Status != models.OrderStatusProcessing {
+		return nil, ErrOrderNotPickable
+	}
+
+	var item models.OnlineOrderItem
+	if err := tx.Preload("Product", WithDeleted).
+		First(&item, "id = ? AND order_id = ?", itemID, orderID).Error; err != nil {
+		return nil, fmt.Errorf("order item: %w", err)
+	}
+	if !pickable(&item) {
+		return nil, ErrPickItemClosed
+	}
+
+	gtin, batch := parseGS1(req.Barcode)
+	if !scanMatches(&item.Product, req.Barcode, gtin) {
+		return nil, ErrPickWrongProduct
+	}
+	if req.BatchNumber != "" {
+		batch = req.BatchNumber
+	}
+	if batch != "" && !strings.EqualFold(strings.TrimSpace(batch), item.Product.BatchNumber) {
+		return nil, fmt.Errorf("%w: expected %s", ErrPickWrongBatch, item.Product.BatchNumber)
+	}
+
+	remaining := item.Quantity - item.PickedQuantity
+	quantity := remaining
+	if req.Quantity > 0 {
+		quantity = req.Quantity
+	}
+	if quantity <= 0 || quantity > remaining {
+		return nil, fmt.Errorf("%w: %d of %d left to pick", ErrPickQuantity, remaining, item.Quantity)
+	}
+	return &verifiedPick{item: &item, quantity: quantity}, nil
+}
+
+// leftToPick counts the order's items, other than except, not yet fully
+// picked
+func (s *PickingService) leftToPick(tx *gorm.DB, orderID, except uuid.UUID) (int64, error) {
+	var left int64
+	err := tx.Model(&models.OnlineOrderItem{}).
+		Where("order_id = ? AND id <> ? AND picked_quantity < quantity", orderID, except).
+		Where("status NOT IN ?", []models.ItemStatus{models.ItemStatusCancelled, models.ItemStatusOutOfStock}).
+		Count(&left).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to count items left to pick: %w", err)
+	}
+	return left, nil
+}
+
+// storageUnits loads the storage units the orders' products are kept in,
+// for those with no shelf location of their own
+func (s *PickingService) storageUnits(ctx context.Context, orders []models.OnlineOrder) (map[uuid.UUID]models.StorageUnit, error) {
+	var ids []uuid.UUID
+	for _, order := range orders {
+		for _, item := range order.OrderItems {
+			if item.Product.StorageUnitID != nil {
+				ids = append(ids, *item.Product.StorageUnitID)
+			}
+		}
+	}
+	units := map[uuid.UUID]models.StorageUnit{}
+	if len(ids) == 0 {
+		return units, nil
+	}
+
+	var found []models.StorageUnit
+	if err := s.db.WithContext(ctx).Where("id IN ?", ids).Find(&found).Error; err != nil {
+		return nil, fmt.Errorf("failed to load storage units: %w", err)
+	}
+	for _, unit := range found {
+		units[unit.ID] = unit
+	}
+	return units, nil
+}
+
+func pickable(item *models.OnlineOrderItem) bool {
+	return item.Status != models.ItemStatusCancelled && item.Status != models.ItemStatusOutOfStock
+}
+
+// pickLocation is where a product is picked from: its shelf, else the
+// refrigerator or freezer it is kept in
+func pickLocation(product *models.Product, units map[uuid.UUID]models.StorageUnit) string {
+	if location := strings.TrimSpace(product.StorageLocation); location != "" {
+		return location
+	}
+	if product.StorageUnitID != nil {
+		if unit, ok := units[*product.StorageUnitID]; ok {
+			if unit.Location != "" {
+				return unit.Name + " (" + unit.Location + ")"
+			}
+			return unit.Name
+		}
+	}
+	return unassignedLocation
+}
+
+// scanMatches reports whether a scan is the product: its barcode or SKU, or
+// a GS1 code carrying its barcode as the GTIN
+func scanMatches(product *models.Product, scan, gtin string) bool {
+	scan = strings.TrimSpace(scan)
+	if strings.EqualFold(scan, product.SKU) {
+		return true
+	}
+	if product.Barcode == nil || *product.Barcode == "" {
+		return false
+	}
+	if scan == *product.Barcode {
+		return true
+	}
+	// An EAN-13 or UPC-A is the GTIN-14 without its leading zeros
+	return gtin != "" && strings.TrimLeft(gtin, "0") == strings.TrimLeft(*product.Barcode, "0")
+}
+
+// gs1Fixed is the length of the data after the GS1 application identifiers
+// with fixed-length data that medicine packs carry
+var gs1Fixed = map[string]int{
+	"01": 14, // GTIN
+	"11": 6,  // production date
+	"13": 6,  // packaging date
+	"15": 6,  // best before
+	"17": 6,  // expiry
+}
+
+var gs1Bracketed = regexp.MustCompile(`\((\d{2,4})\)([^(]*)`)
+
+// parseGS1 reads the GTIN and batch (AI 10) out of a GS1 DataMatrix or
+// GS1-128 scan, written with the identifiers in brackets, or as scanners
+// send it with FNC1 separating variable-length fields. Scans that aren't
+// GS1 give nothing.
+func parseGS1(scan string) (gtin, batch string) {
+	scan = strings.TrimSpace(scan)
+	if strings.HasPrefix(scan, "(") {
+		for _, field := range gs1Bracketed.FindAllStringSubmatch(scan, -1) {
+			switch field[1] {
+			case "01":
+				gtin = field[2]
+			case "10":
+				batch = field[2]
+			}
+		}
+		return gtin, batch
+	}
+
+	// Symbology identifiers for GS1 DataMatrix and GS1-128
+	for _, prefix := range []string{"]d2", "]C1", "\x1d"} {
+		scan = strings.TrimPrefix(scan, prefix)
+	}
+	if !strings.HasPrefix(scan, "01") || len(scan) < 16 {
+		return "", ""
+	}
+	for len(scan) >= 2 {
+		ai := scan[:2]
+		if length, ok := gs1Fixed[ai]; ok {
+			if len(scan) < 2+length {
+				break
+			}
+			if ai == "01" {
+				gtin = scan[2 : 2+length]
+			}
+			scan = scan[2+length:]
+			continue
+		}
+		// Variable length up to the next separator: batch, serial number
+		if ai != "10" && ai != "21" {
+			break
+		}
+		value := scan[2:]
+		rest := ""
+		if i := strings.IndexByte(value, '\x1d'); i >= 0 {
+			value, rest = value[:i], value[i+1:]
+		}
+		if ai == "10" {
+			batch = value
+		}
+		scan = rest
+	}
+	return gtin, batch
+}
+
+// Printable is the pick list as printed
+func (p *PickList) Printable() labels.PickList {
+	printed := labels.PickList{GeneratedAt: p.GeneratedAt}
+	for _, order := range p.Orders {
+		printed.Orders = append(printed.Orders, order.OrderNumber)
+	}
+	for _, location := range p.Locations {
+		printedLocation := labels.PickLocation{Name: location.Location}
+		for _, line := range location.Lines {
+			printedLine := labels.PickLine{
+				Description: line.Name,
+				SKU:         line.SKU,
+				BatchNumber: line.BatchNumber,
+				ExpiryDate:  line.ExpiryDate,
+				Quantity:    line.Quantity,
+			}
+			for _, item := range line.Items {
+				printedLine.Orders = append(printedLine.Orders, fmt.Sprintf("%s x%d", item.OrderNumber, item.Quantity))
+			}
+			printedLocation.Lines = append(printedLocation.Lines, printedLine)
+		}
+		printed.Locations = append(printed.Locations, printedLocation)
+	}
+	return printed
+}
+
+// Request/Response types
+
+type PickListPrintRequest struct {
+	OrderIDs   []uuid.UUID `json:"order_ids" binding:"max=50"` // the oldest orders being processed when empty
+	TerminalID uuid.UUID   `json:"terminal_id" binding:"required"`
+}
+
+// PickRequest is a scan of an ordered item. Barcode is the product's
+// barcode or SKU, or a GS1 code, whose batch is checked too.
+type PickRequest struct {
+	Barcode     string `json:"barcode" binding:"required,max=200"`
+	BatchNumber string `json:"batch_number" binding:"max=100"` // when scanned separately from the barcode
+	Quantity    int    `json:"quantity" binding:"min=0"`       // the rest of the item by default
+}
+
+type PickResult struct {
+	Item       PickedItem `json:"item"`
+	LeftToPick int64      `json:"left_to_pick"` // items on the order not yet fully picked
+	AllPicked  bool       `json:"all_picked"`
+}
+
+// PickedItem is an order item as it stands after a pick
+type PickedItem struct {
+	ID                uuid.UUID         `json:"id"`
+	ProductID         uuid.UUID         `json:"product_id"`
+	Quantity          int               `json:"quantity"`
+	PickedQuantity    int               `json:"picked_quantity"`
+	PickedBatchNumber string            `json:"picked_batch_number"`
+	PickedBy          uuid.UUID         `json:"picked_by"`
+	PickedAt          time.Time         `json:"picked_at"`
+	Status            models.ItemStatus `json:"status"`
+}
+
+// PickList is what is still to pick for a batch of orders, by storage
+// location. Units counts them all.
+type PickList struct {
+	GeneratedAt time.Time          `json:"generated_at"`
+	Orders      []PickListOrder    `json:"orders"`
+	Locations   []PickListLocation `json:"locations"`
+	Units       int                `json:"units"`
+}
+
+// PickListOrder is an order on a pick list. Items counts its lines still
+// to be filled, Remaining the units still to pick on them.
+type PickListOrder struct {
+	ID          uuid.UUID        `json:"id"`
+	OrderNumber string           `json:"order_number"`
+	OrderType   models.OrderType `json:"order_type"`
+	Items       int              `json:"items"`
+	Remaining   int              `json:"remaining"`
+}
+
+type PickListLocation struct {
+	Location string         `json:"location"`
+	Lines    []PickListLine `json:"lines"`
+}
+
+// PickListLine is one product to pick at a location for every order
+// wanting it
+type PickListLine struct {
+	ProductID   uuid.UUID      `json:"product_id"`
+	Name        string         `json:"name"`
+	SKU         string         `json:"sku"`
+	Barcode     *string        `json:"barcode,omitempty"`
+	BatchNumber string         `json:"batch_number"`
+	ExpiryDate  *time.Time     `json:"expiry_date,omitempty"`
+	Quantity    int            `json:"quantity"`
+	Items       []PickListItem `json:"items"`
+}
+
+type PickListItem struct {
+	OrderID     uuid.UUID `json:"order_id"`
+	OrderNumber string    `json:"order_number"`
+	ItemID      uuid.UUID `json:"item_id"`
+	Quantity    int       `json:"quantity"`
+}
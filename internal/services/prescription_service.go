@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrOrderClosed is returned for a prescription uploaded to an order that
+// has been handed over, cancelled or refunded
+var ErrOrderClosed = errors.New("prescriptions can't be added to an order that is completed, cancelled or refunded")
+
+// ErrPrescriptionVerified is returned for verifying a prescription upload
+// that has been verified already
+var ErrPrescriptionVerified = errors.New("prescription has already been verified")
+
+// closedOrderStatuses are the statuses an order doesn't leave, so nothing
+// is left to verify a prescription for
+var closedOrderStatuses = map[models.OrderStatus]bool{
+	models.OrderStatusDelivered: true,
+	models.OrderStatusPickedUp:  true,
+	models.OrderStatusCancelled: true,
+	models.OrderStatusRefunded:  true,
+}
+
+type PrescriptionService struct {
+	db                 *gorm.DB
+	onlineOrderService *OnlineOrderService
+	outbox             *OutboxService
+	files              *FileService
+}
+
+func NewPrescriptionService(db *gorm.DB, onlineOrderService *OnlineOrderService, outbox *OutboxService, files *FileService) *PrescriptionService {
+	return &PrescriptionService{
+		db:                 db,
+		onlineOrderService: onlineOrderService,
+		outbox:             outbox,
+		files:              files,
+	}
+}
+
+// UploadPrescription stores a prescription file and records it. Files are
+// deduplicated by SHA256 hash: re-uploading the same file returns the existing
+// record with duplicate set to true. New uploads alert the pharmacists who
+// verify them.
+func (s *PrescriptionService) UploadPrescription(ctx context.Context, req UploadPrescriptionRequest) (upload *models.PrescriptionUpload, duplicate bool, err error) {
+	if req.OrderID == nil && req.CustomerID == nil {
+		return nil, false, fmt.Errorf("either order_id or customer_id must be provided")
+	}
+
+	var order models.OnlineOrder
+	if req.OrderID != nil {
+		if err := s.db.First(&order, *req.OrderID).Error; err != nil {
+			return nil, false, fmt.Errorf("order not found: %w", err)
+		}
+		if closedOrderStatuses[order.Status] {
+			return nil, false, ErrOrderClosed
+		}
+		// Attribute the upload to the order's customer when not given explicitly
+		if req.CustomerID == nil {
+			req.CustomerID = order.CustomerID
+			req.GuardianID = order.GuardianID
+		}
+	}
+	if req.GuardianID != nil {
+		if req.CustomerID == nil {
+			return nil, false, fmt.Errorf("customer_id must be set to the dependent the prescription is for")
+		}
+		if err := checkDependent(s.db, *req.GuardianID, *req.CustomerID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	sum := sha256.Sum256(req.Data)
+	fileHash := hex.EncodeToString(sum[:])
+
+	// Check for an existing upload of the same file
+	var existing models.PrescriptionUpload
+	query := s.db.Where("file_hash = ?", fileHash)
+	if req.OrderID != nil {
+		query = query.Where("order_id = ?", *req.OrderID)
+	} else {
+		query = query.Where("customer_id = ?", *req.CustomerID)
+	}
+	if err := query.First(&existing).Error; err == nil {
+		return &existing, true, nil
+	} else if err != gorm.ErrRecordNotFound {
+		return nil, false, fmt.Errorf("failed to check existing uploads: %w", err)
+	}
+
+	// Store the file, named by content hash
+	storagePath, err := s.files.SavePrescription(ctx, fileHash, req.FileName, req.MimeType, req.Data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	upload = &models.PrescriptionUpload{
+		OrderID:    req.OrderID,
+		CustomerID: req.CustomerID,
+		GuardianID: req.GuardianID,
+		FileName:   filepath.Base(req.FileName),
+		FileSize:   int64(len(req.Data)),
+		MimeType:   req.MimeType,
+		FileHash:   fileHash,
+		OCRStatus:  models.OCRStatusPending,
+	}
+	if err := upload.StoragePath.Set(storagePath); err != nil {
+		return nil, false, fmt.Errorf("failed to encrypt storage path: %w", err)
+	}
+
+	tx := s.db.Begin()
+	if err := tx.Create(upload).Error; err != nil {
+		tx.Rollback()
+		return nil, false, fmt.Errorf("failed to save prescription upload: %w", err)
+	}
+
+	// Flag the order as having a prescription attached
+	if req.OrderID != nil {
+		images := append(order.PrescriptionImages, upload.ID.String())
+		if err := tx.Model(&order).Updates(map[string]interface{}{
+			"prescription_uploaded": true,
+			"prescription_images":   models.StringArray(images),
+			"updated_at":            time.Now().UTC(),
+		}).Error; err != nil {
+			tx.Rollback()
+			return nil, false, fmt.Errorf("failed to update order: %w", err)
+		}
+	}
+
+	if s.outbox != nil {
+		alert := StaffAlertMessage{
+			Alert: models.StaffAlertPrescriptionQueue,
+			Title: "Prescription to verify",
+			Body:  "A prescription was uploaded and is waiting to be verified.",
+			Data:  map[string]string{"prescription_id": upload.ID.String()},
+		}
+		if req.OrderID != nil {
+			alert.BranchID = order.BranchID
+			alert.Body = fmt.Sprintf("A prescription for order %s is waiting to be verified.", order.OrderNumber)
+			alert.Data["order_id"] = order.ID.String()
+		}
+		if err := s.outbox.QueueStaffAlert(tx, alert); err != nil {
+			tx.Rollback()
+			return nil, false, err
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, false, fmt.Errorf("failed to commit prescription upload: %w", err)
+	}
+
+	return upload, false, nil
+}
+
+// GetPrescription retrieves a prescription upload by ID
+func (s *PrescriptionService) GetPrescription(ctx context.Context, id uuid.UUID) (*models.PrescriptionUpload, error) {
+	var upload models.PrescriptionUpload
+	if err := s.db.Preload("Order").Preload("Customer", WithDeleted).Preload("Pharmacist").
+		First(&upload, id).Error; err != nil {
+		return nil, fmt.Errorf("prescription not found: %w", err)
+	}
+	return &upload, nil
+}
+
+// GetPendingPrescriptions returns the pharmacist work queue: uploads that have
+// not yet been verified, oldest first.
+func (s *PrescriptionService) GetPendingPrescriptions(ctx context.Context, limit, offset int) ([]models.PrescriptionUpload, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.PrescriptionUpload{}).Where("verified_at IS NULL")
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var uploads []models.PrescriptionUpload
+	err := query.Preload("Order").Preload("Customer", WithDeleted).
+		Order("created_at ASC").Limit(limit).Offset(offset).
+		Find(&uploads).Error
+	return uploads, total, err
+}
+
+// VerifyPrescription approves or rejects a prescription upload. Approving the
+// last outstanding prescription on an order waiting in prescription_needed
+// moves the order on to processing, in the same transaction. It fails with
+// ErrPrescriptionVerified when the upload was verified already, however
+// many pharmacists try at once.
+func (s *PrescriptionService) VerifyPrescription(ctx context.Context, id uuid.UUID, approved bool, notes string, pharmacistID uuid.UUID) (*models.PrescriptionUpload, error) {
+	var upload models.PrescriptionUpload
+	if err := s.db.WithContext(ctx).Select("id", "order_id").First(&upload, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("prescription not found: %w", err)
+	}
+
+	var change *OrderStatusChange
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		// Touching the order first holds its row until tx ends, so the
+		// verifications of its other prescriptions wait for this one
+		// rather than each counting the other as still pending
+		if upload.OrderID != nil {
+			if err := tx.Model(&models.OnlineOrder{}).Where("id = ?", *upload.OrderID).
+				Update("updated_at", now).Error; err != nil {
+				return fmt.Errorf("failed to update order: %w", err)
+			}
+		}
+
+		// Only the first verification gets past the update
+		result := tx.Model(&models.PrescriptionUpload{}).
+			Where("id = ? AND verified_at IS NULL", id).
+			Updates(map[string]interface{}{
+				"verified_by":        pharmacistID,
+				"verified_at":        now,
+				"is_valid":           approved,
+				"verification_notes": notes,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to update prescription: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrPrescriptionVerified
+		}
+		if err := tx.First(&upload, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("prescription not found: %w", err)
+		}
+
+		if upload.OrderID == nil {
+			return nil
+		}
+		var err error
+		change, err = s.advanceOrder(tx, *upload.OrderID, approved, notes, pharmacistID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if change != nil {
+		s.onlineOrderService.AnnounceStatus(ctx, change)
+	}
+	return &upload, nil
+}
+
+// advanceOrder applies the order status transition that follows a
+// verification in tx. It returns the status change to announce, if any.
+func (s *PrescriptionService) advanceOrder(tx *gorm.DB, orderID uuid.UUID, approved bool, notes string, pharmacistID uuid.UUID) (*OrderStatusChange, error) {
+	var order models.OnlineOrder
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return nil, fmt.Errorf("order not found: %w", err)
+	}
+
+	if order.Status != models.OrderStatusPrescriptionNeeded {
+		return nil, nil
+	}
+
+	if !approved {
+		// Keep the order waiting for a valid prescription, but record why
+		pharmacyNotes := order.PharmacyNotes
+		if pharmacyNotes != "" {
+			pharmacyNotes += "\n"
+		}
+		pharmacyNotes += "Prescription rejected: " + notes
+		return nil, tx.Model(&order).Updates(map[string]interface{}{
+			"prescription_notes": notes,
+			"pharmacy_notes":     pharmacyNotes,
+			"updated_at":         time.Now().UTC(),
+		}).Error
+	}
+
+	// Only move on once nothing else on the order is still awaiting review
+	var pending int64
+	if err := tx.Model(&models.PrescriptionUpload{}).
+		Where("order_id = ? AND verified_at IS NULL", orderID).
+		Count(&pending).Error; err != nil {
+		return nil, fmt.Errorf("failed to check pending prescriptions: %w", err)
+	}
+	if pending > 0 {
+		return nil, nil
+	}
+
+	if err := tx.Model(&order).Update("pharmacist_id", pharmacistID).Error; err != nil {
+		return nil, fmt.Errorf("failed to assign pharmacist: %w", err)
+	}
+
+	return s.onlineOrderService.ApplyStatus(tx, orderID, models.OrderStatusProcessing,
+		"Prescription verified", &pharmacistID)
+}
+
+// Request/Response types
+
+type UploadPrescriptionRequest struct {
+	OrderID    *uuid.UUID
+	CustomerID *uuid.UUID
+	GuardianID *uuid.UUID // set when uploaded for a dependent
+	FileName   string
+	MimeType   string
+	Data       []byte
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrDiscountExceedsTotal = errors.New("discount is more than the sale total")
+
+// PricingService resolves what products cost at a branch. A branch can
+// override a product's price; otherwise the catalogue price applies, as it
+// does for sales and orders made without a branch.
+type PricingService struct {
+	db         *gorm.DB
+	taxes      *TaxService
+	currencies *CurrencyService
+}
+
+func NewPricingService(db *gorm.DB, taxes *TaxService, currencies *CurrencyService) *PricingService {
+	return &PricingService{db: db, taxes: taxes, currencies: currencies}
+}
+
+// UnitPrice returns what the product costs at the branch, read in tx
+func (s *PricingService) UnitPrice(tx *gorm.DB, branchID *uuid.UUID, product *models.Product) (models.Money, error) {
+	if branchID == nil {
+		return product.Price, nil
+	}
+
+	var prices []models.Money
+	if err := tx.Model(&models.BranchPrice{}).
+		Where("branch_id = ? AND product_id = ?", *branchID, product.ID).
+		Limit(1).Pluck("price", &prices).Error; err != nil {
+		return 0, fmt.Errorf("failed to load branch price: %w", err)
+	}
+	if len(prices) == 0 {
+		return product.Price, nil
+	}
+	return prices[0], nil
+}
+
+// PriceSale prices and taxes a POS sale at its branch, replacing whatever
+// prices and totals the till sent. Item and sale discounts are kept. A
+// sale paid in a foreign currency gets what is owed in it.
+func (s *PricingService) PriceSale(ctx context.Context, sale *models.Sale) error {
+	tx := s.db.WithContext(ctx)
+
+	var subtotal models.Money
+	lines := make([]TaxLine, 0, len(sale.SaleItems))
+	for i := range sale.SaleItems {
+		item := &sale.SaleItems[i]
+		switch {
+		case item.ProductID != nil:
+			var product models.Product
+			if err := tx.First(&product, "id = ?", *item.ProductID).Error; err != nil {
+				return fmt.Errorf("product: %w", err)
+			}
+			price, err := s.UnitPrice(tx, sale.BranchID, &product)
+			if err != nil {
+				return err
+			}
+			item.UnitPrice = price
+		case item.ServiceID != nil:
+			var service models.Service
+			if err := tx.First(&service, "id = ?", *item.ServiceID).Error; err != nil {
+				return fmt.Errorf("service: %w", err)
+			}
+			item.UnitPrice = service.Price
+		case item.PreparationID != nil:
+			var preparation models.CompoundPreparation
+			if err := tx.Select("id", "price").First(&preparation, "id = ?", *item.PreparationID).Error; err != nil {
+				return fmt.Errorf("preparation: %w", err)
+			}
+			item.UnitPrice = preparation.Price
+		}
+		item.TotalPrice = s.currencies.Round(item.UnitPrice.Mul(item.Quantity) - item.Discount)
+		subtotal += item.TotalPrice
+		lines = append(lines, TaxLine{ProductID: item.ProductID, Amount: item.TotalPrice})
+	}
+
+	breakdown, err := s.taxes.Compute(tx, sale.BranchID, sale.CustomerID, lines)
+	if err != nil {
+		return err
+	}
+	sale.Subtotal = s.currencies.Round(subtotal)
+	sale.Tax = breakdown.VATAmount
+	sale.TaxBreakdown = breakdown
+	sale.Total = s.currencies.Round(sale.Subtotal + sale.Tax - sale.Discount)
+	if sale.Total < 0 {
+		return ErrDiscountExceedsTotal
+	}
+	return s.currencies.ApplyPayment(tx, sale)
+}
+
+// ListPrices returns the branch's price overrides by product name
+func (s *PricingService) ListPrices(ctx context.Context, branchID uuid.UUID) ([]models.BranchPrice, error) {
+	var prices []models.BranchPrice
+	if err := s.db.WithContext(ctx).Preload("Product").
+		Joins("JOIN products ON products.id = branch_prices.product_id").
+		Where("branch_prices.branch_id = ?", branchID).
+		Order("products.name ASC").
+		Find(&prices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load branch prices: %w", err)
+	}
+	return prices, nil
+}
+
+// SetPrice overrides the product's price at the branch
+func (s *PricingService) SetPrice(ctx context.Context, branchID, productID uuid.UUID, price models.Money) (*models.BranchPrice, error) {
+	var branch models.Branch
+	if err := s.db.WithContext(ctx).Select("id").First(&branch, "id = ?", branchID).Error; err != nil {
+		return nil, fmt.Errorf("branch: %w", err)
+	}
+	var product models.Product
+	if err := s.db.WithContext(ctx).Select("id").First(&product, "id = ?", productID).Error; err != nil {
+		return nil, fmt.Errorf("product: %w", err)
+	}
+
+	override := &models.BranchPrice{BranchID: branchID, ProductID: productID, Price: price}
+	onConflict := clause.OnConflict{
+		Columns: []clause.Column{{Name: "branch_id"}, {Name: "product_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"price":      price,
+			"updated_at": time.Now().UTC(),
+		}),
+	}
+	if err := s.db.WithContext(ctx).Clauses(onConflict).Create(override).Error; err != nil {
+		return nil, fmt.Errorf("failed to set branch price: %w", err)
+	}
+	return override, nil
+}
+
+// ClearPrice removes the branch's override, so the catalogue price applies
+// there again. Overrides are deleted outright so one can be set again.
+func (s *PricingService) ClearPrice(ctx context.Context, branchID, productID uuid.UUID) error {
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("branch_id = ? AND product_id = ?", branchID, productID).
+		Delete(&models.BranchPrice{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to clear branch price: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("branch price: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// Request/Response types
+
+type BranchPriceRequest struct {
+	Price models.Money `json:"price" binding:"required,gt=0"`
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// ErrCustomerAnonymized is returned for privacy operations on a customer that
+// has already been erased
+var ErrCustomerAnonymized = fmt.Errorf("customer has already been anonymized")
+
+type PrivacyService struct {
+	db    *gorm.DB
+	files *FileService
+}
+
+func NewPrivacyService(db *gorm.DB, files *FileService) *PrivacyService {
+	return &PrivacyService{db: db, files: files}
+}
+
+// RecordConsent grants consent for a purpose. Granting data processing
+// consent also sets the customer's ConsentDate.
+func (s *PrivacyService) RecordConsent(ctx context.Context, req RecordConsentRequest) (*models.ConsentRecord, error) {
+	if !req.Purpose.IsValid() {
+		return nil, fmt.Errorf("invalid consent purpose: %s", req.Purpose)
+	}
+	customer, err := s.activeCustomer(req.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	consent := &models.ConsentRecord{
+		CustomerID:    customer.ID,
+		Purpose:       req.Purpose,
+		NoticeVersion: req.NoticeVersion,
+		Channel:       req.Channel,
+		IPAddress:     req.IPAddress,
+		GrantedAt:     now,
+		RecordedBy:    req.RecordedBy,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// A new grant replaces any active grant for the same purpose
+		if err := tx.Model(&models.ConsentRecord{}).
+			Where("customer_id = ? AND purpose = ? AND withdrawn_at IS NULL", customer.ID, req.Purpose).
+			Update("withdrawn_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(consent).Error; err != nil {
+			return err
+		}
+		if req.Purpose == models.ConsentDataProcessing {
+			return tx.Model(customer).Update("consent_date", now).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record consent: %w", err)
+	}
+	return consent, nil
+}
+
+// WithdrawConsent withdraws the active consent for a purpose
+func (s *PrivacyService) WithdrawConsent(ctx context.Context, customerID uuid.UUID, purpose models.ConsentPurpose) error {
+	if !purpose.IsValid() {
+		return fmt.Errorf("invalid consent purpose: %s", purpose)
+	}
+
+	now := time.Now().UTC()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ConsentRecord{}).
+			Where("customer_id = ? AND purpose = ? AND withdrawn_at IS NULL", customerID, purpose).
+			Update("withdrawn_at", now)
+		if result.Error != nil {
+			return fmt.Errorf("failed to withdraw consent: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("no active %s consent to withdraw", purpose)
+		}
+		if purpose == models.ConsentDataProcessing {
+			return tx.Model(&models.Customer{}).Where("id = ?", customerID).Update("consent_date", nil).Error
+		}
+		return nil
+	})
+}
+
+// GetConsents lists a customer's consent history, newest first
+func (s *PrivacyService) GetConsents(ctx context.Context, customerID uuid.UUID) ([]models.ConsentRecord, error) {
+	var consents []models.ConsentRecord
+	err := s.db.Where("customer_id = ?", customerID).
+		Order("granted_at DESC").
+		Find(&consents).Error
+	return consents, err
+}
+
+// HasConsent reports whether a customer has an active consent for a purpose
+func (s *PrivacyService) HasConsent(ctx context.Context, customerID uuid.UUID, purpose models.ConsentPurpose) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.ConsentRecord{}).
+		Where("customer_id = ? AND purpose = ? AND withdrawn_at IS NULL", customerID, purpose).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ExportCustomerData gathers everything held about a customer into one
+// machine-readable bundle for a data access request
+func (s *PrivacyService) ExportCustomerData(ctx context.Context, customerID, processedBy uuid.UUID) (*CustomerDataExport, error) {
+	var customer models.Customer
+	if err := s.db.First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	export := &CustomerDataExport{
+		ExportedAt: time.Now().UTC(),
+		Customer:   &customer,
+	}
+
+	loads := []struct {
+		name  string
+		query *gorm.DB
+		dest  interface{}
+	}{
+		{"consents", s.db.Where("customer_id = ?", customerID), &export.Consents},
+		{"communication preferences", s.db.Where("customer_id = ?", customerID), &export.CommunicationPreferences},
+		{"tags", s.db.Where("customer_id = ?", customerID), &export.Tags},
+		{"loyalty transactions", s.db.Where("customer_id = ?", customerID), &export.LoyaltyTransactions},
+		{"campaign messages", s.db.Where("customer_id = ?", customerID), &export.CampaignSends},
+		{"flags", s.db.Where("customer_id = ?", customerID), &export.Flags},
+		{"sales", s.db.Preload("SaleItems.Product", WithDeleted).Where("customer_id = ?", customerID), &export.Sales},
+		{"orders", s.db.Preload("OrderItems.Product", WithDeleted).Where("customer_id = ?", customerID), &export.Orders},
+		{"insurance claims", s.db.Where("customer_id = ?", customerID), &export.InsuranceClaims},
+		{"prescriptions", s.db.Where("customer_id = ?", customerID), &export.Prescriptions},
+		{"purchase history", s.db.Where("customer_id = ?", customerID), &export.PurchaseHistory},
+		{"refills", s.db.Where("customer_id = ?", customerID), &export.Refills},
+		{"clinical notes", s.db.Where("customer_id = ?", customerID), &export.ClinicalNotes},
+		{"vaccinations", s.db.Where("customer_id = ?", customerID), &export.Vaccinations},
+		{"screening overrides", s.db.Where("customer_id = ?", customerID), &export.ScreeningOverrides},
+		{"interaction acknowledgements", s.db.Where("customer_id = ?", customerID), &export.InteractionAcknowledgements},
+	}
+	for _, load := range loads {
+		if err := load.query.Find(load.dest).Error; err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", load.name, err)
+		}
+	}
+
+	s.logRequest(customerID, models.DataSubjectAccess, "", processedBy, map[string]int{
+		"sales":          len(export.Sales),
+		"orders":         len(export.Orders),
+		"prescriptions":  len(export.Prescriptions),
+		"clinical_notes": len(export.ClinicalNotes),
+		"vaccinations":   len(export.Vaccinations),
+	})
+	return export, nil
+}
+
+// EraseCustomer carries out a right-to-erasure request. Personal data with no
+// retention requirement is deleted; sales, orders, prescriptions and clinical
+// records that must be kept for tax and FDA inspection are retained but
+// detached from the person by anonymizing the customer profile and clearing
+// free-text contact details on them.
+func (s *PrivacyService) EraseCustomer(ctx context.Context, customerID, processedBy uuid.UUID, reason string) (*ErasureResult, error) {
+	customer, err := s.activeCustomer(customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ErasureResult{
+		CustomerID: customerID,
+		Deleted:    map[string]int64{},
+		Anonymized: map[string]int64{},
+		Retained:   map[string]string{},
+	}
+	idDocument := customer.IDDocumentPath
+	now := time.Now().UTC()
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		deletions := []struct {
+			name  string
+			model interface{}
+		}{
+			{"shopping_cart", &models.ShoppingCart{}},
+			{"refills", &models.Refill{}},
+			{"communication_preferences", &models.CommunicationPreference{}},
+			{"tags", &models.CustomerTag{}},
+			{"segment_memberships", &models.SegmentMember{}},
+			{"campaign_messages", &models.CampaignSend{}},
+			{"flags", &models.CustomerFlag{}},
+		}
+		for _, d := range deletions {
+			// Erasure must not leave soft-deleted copies behind
+			res := tx.Unscoped().Where("customer_id = ?", customerID).Delete(d.model)
+			if res.Error != nil {
+				return fmt.Errorf("failed to delete %s: %w", d.name, res.Error)
+			}
+			result.Deleted[d.name] = res.RowsAffected
+		}
+
+		res := tx.Model(&models.ConsentRecord{}).
+			Where("customer_id = ? AND withdrawn_at IS NULL", customerID).
+			Update("withdrawn_at", now)
+		if res.Error != nil {
+			return fmt.Errorf("failed to withdraw consents: %w", res.Error)
+		}
+		result.Anonymized["consents_withdrawn"] = res.RowsAffected
+
+		res = tx.Model(&models.Sale{}).Where("customer_id = ?", customerID).
+			Update("customer_notes", "")
+		if res.Error != nil {
+			return fmt.Errorf("failed to anonymize sales: %w", res.Error)
+		}
+		result.Anonymized["sales"] = res.RowsAffected
+
+		res = tx.Model(&models.OnlineOrder{}).Where("customer_id = ?", customerID).
+			Updates(map[string]interface{}{
+				"guest_email":       nil,
+				"guest_phone":       nil,
+				"guest_name":        nil,
+				"delivery_address":  "",
+				"delivery_zip_code": "",
+				"delivery_notes":    "",
+				"customer_notes":    "",
+			})
+		if res.Error != nil {
+			return fmt.Errorf("failed to anonymize orders: %w", res.Error)
+		}
+		result.Anonymized["orders"] = res.RowsAffected
+
+		if err := tx.Model(customer).Select("*").Omit("id", "created_at", "created_by").
+			Updates(anonymizedCustomer(customer, now)).Error; err != nil {
+			return fmt.Errorf("failed to anonymize customer: %w", err)
+		}
+		result.Anonymized["customer"] = 1
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if idDocument != "" {
+		if err := s.files.Delete(ctx, idDocument); err != nil {
+			logrus.WithError(err).WithField("customer_id", customerID).Warn("Failed to delete customer ID document")
+		} else {
+			result.Deleted["id_document"] = 1
+		}
+	}
+
+	result.Retained["sales"] = "tax and BIR receipt retention"
+	result.Retained["orders"] = "tax and BIR receipt retention"
+	result.Retained["insurance_claims"] = "HMO claim audit and receivables"
+	result.Retained["prescriptions"] = "FDA dispensing record retention until each upload's retention date"
+	result.Retained["clinical_notes"] = "pharmacist professional record retention"
+	result.Retained["vaccinations"] = "immunization registry reporting"
+	result.Retained["consents"] = "proof of lawful processing"
+
+	s.logRequest(customerID, models.DataSubjectErasure, reason, processedBy, result)
+	return result, nil
+}
+
+// GetRequests lists processed data subject requests, newest first
+func (s *PrivacyService) GetRequests(ctx context.Context, customerID *uuid.UUID, limit, offset int) ([]models.DataSubjectRequest, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.DataSubjectRequest{})
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var requests []models.DataSubjectRequest
+	err := query.Preload("User").Order("processed_at DESC").
+		Limit(limit).Offset(offset).Find(&requests).Error
+	return requests, total, err
+}
+
+// Private helper methods
+
+func (s *PrivacyService) activeCustomer(customerID uuid.UUID) (*models.Customer, error) {
+	var customer models.Customer
+	if err := s.db.First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.AnonymizedAt != nil {
+		return nil, ErrCustomerAnonymized
+	}
+	return &customer, nil
+}
+
+func (s *PrivacyService) logRequest(customerID uuid.UUID, requestType models.DataSubjectRequestType, reason string, processedBy uuid.UUID, summary interface{}) {
+	encoded, _ := json.Marshal(summary)
+	request := &models.DataSubjectRequest{
+		CustomerID:  customerID,
+		RequestType: requestType,
+		Reason:      reason,
+		Summary:     string(encoded),
+		ProcessedBy: processedBy,
+		ProcessedAt: time.Now().UTC(),
+	}
+	if err := s.db.Create(request).Error; err != nil {
+		logrus.WithError(err).WithField("customer_id", customerID).Error("Failed to log data subject request")
+	}
+}
+
+// anonymizedCustomer returns the customer with every personal field cleared.
+// Unique columns get a per-customer placeholder. Only the birth year is kept
+// so age-band reporting still works.
+func anonymizedCustomer(customer *models.Customer, now time.Time) *models.Customer {
+	placeholder := "erased-" + customer.ID.String()
+	anonymized := &models.Customer{
+		FirstName:        "Erased",
+		LastName:         "Customer",
+		Email:            placeholder + "@anonymized.invalid",
+		Phone:            "",
+		DateOfBirth:      time.Date(customer.DateOfBirth.Year(), 1, 1, 0, 0, 0, 0, time.UTC),
+		Country:          customer.Country,
+		QRCode:           placeholder,
+		PreferredContact: "none",
+		AnonymizedAt:     &now,
+		UpdatedBy:        customer.UpdatedBy,
+	}
+	anonymized.UpdatedAt = now
+	return anonymized
+}
+
+// Request/Response types
+
+type RecordConsentRequest struct {
+	CustomerID    uuid.UUID             `json:"-"`
+	Purpose       models.ConsentPurpose `json:"purpose" binding:"required"`
+	NoticeVersion string                `json:"notice_version"`
+	Channel       string                `json:"channel"`
+	IPAddress     string                `json:"-"`
+	RecordedBy    *uuid.UUID            `json:"-"`
+}
+
+// CustomerDataExport is the machine-readable bundle returned for a data
+// access request
+type CustomerDataExport struct {
+	ExportedAt                  time.Time                           `json:"exported_at"`
+	Customer                    *models.Customer                    `json:"customer"`
+	Consents                    []models.ConsentRecord              `json:"consents"`
+	CommunicationPreferences    []models.CommunicationPreference    `json:"communication_preferences"`
+	Tags                        []models.CustomerTag                `json:"tags"`
+	LoyaltyTransactions         []models.LoyaltyTransaction         `json:"loyalty_transactions"`
+	CampaignSends               []models.CampaignSend               `json:"campaign_messages"`
+	Flags                       []models.CustomerFlag               `json:"flags"`
+	Sales                       []models.Sale                       `json:"sales"`
+	Orders                      []models.OnlineOrder                `json:"orders"`
+	InsuranceClaims             []models.InsuranceClaim             `json:"insurance_claims"`
+	Prescriptions               []models.PrescriptionUpload         `json:"prescriptions"`
+	PurchaseHistory             []models.PurchaseHistory            `json:"purchase_history"`
+	Refills                     []models.Refill                     `json:"refills"`
+	ClinicalNotes               []models.ClinicalNote               `json:"clinical_notes"`
+	Vaccinations                []models.VaccinationRecord          `json:"vaccinations"`
+	ScreeningOverrides          []models.ScreeningOverride          `json:"screening_overrides"`
+	InteractionAcknowledgements []models.InteractionAcknowledgement `json:"interaction_acknowledgements"`
+}
+
+type ErasureResult struct {
+	CustomerID uuid.UUID         `json:"customer_id"`
+	Deleted    map[string]int64  `json:"deleted"`
+	Anonymized map[string]int64  `json:"anonymized"`
+	Retained   map[string]string `json:"retained"` // record type to retention reason
+}
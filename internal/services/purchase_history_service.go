@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// purchaseHistoryUnion combines in-store sale lines, fulfilled online order
+// lines and standalone PurchaseHistory entries (e.g. imported from a previous
+// system) into one row shape. History rows recorded from a sale or order are
+// skipped since the source line already covers them.
+const purchaseHistoryUnion = `
+SELECT 'sale' AS source, s.id AS reference_id, s.sale_number AS reference,
+	si.product_id AS product_id, si.quantity AS quantity, si.unit_price AS unit_price,
+	si.total_price AS total_price, s.created_at AS purchase_date, s.prescription_number AS prescription_number
+FROM sale_items si
+JOIN sales s ON s.id = si.sale_id
+WHERE s.customer_id = ? AND si.product_id IS NOT NULL AND s.refunded_at IS NULL
+UNION ALL
+SELECT 'online_order', o.id, o.order_number,
+	oi.product_id, oi.quantity, oi.unit_price,
+	oi.total_price, COALESCE(o.actual_delivery_date, o.created_at), NULL
+FROM online_order_items oi
+JOIN online_orders o ON o.id = oi.order_id
+WHERE o.customer_id = ? AND o.status IN ('delivered', 'picked_up') AND oi.status NOT IN ('cancelled', 'out_of_stock')
+UNION ALL
+SELECT 'history', ph.id, '',
+	ph.product_id, ph.quantity, ph.unit_price,
+	ph.total_price, ph.purchase_date, ph.prescription_number
+FROM purchase_histories ph
+WHERE ph.customer_id = ? AND ph.sale_id IS NULL AND ph.order_id IS NULL`
+
+type PurchaseHistoryService struct {
+	db *gorm.DB
+}
+
+func NewPurchaseHistoryService(db *gorm.DB) *PurchaseHistoryService {
+	return &PurchaseHistoryService{db: db}
+}
+
+// GetCustomerHistory returns a page of a customer's purchases, newest first,
+// with the total row count and per-product totals across the whole filtered
+// history
+func (s *PurchaseHistoryService) GetCustomerHistory(ctx context.Context, customerID uuid.UUID, filter PurchaseHistoryFilter) (*PurchaseHistoryResult, error) {
+	result := &PurchaseHistoryResult{
+		Purchases: []PurchaseRecord{},
+		Products:  []ProductPurchaseSummary{},
+	}
+
+	if err := s.filtered(ctx, customerID, filter).Count(&result.Total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count purchase history: %w", err)
+	}
+
+	if err := s.filtered(ctx, customerID, filter).
+		Select("h.*, p.name AS product_name, p.category AS category, p.prescription_required AS prescription_required").
+		Order("h.purchase_date DESC").
+		Limit(filter.Limit).Offset(filter.Offset).
+		Scan(&result.Purchases).Error; err != nil {
+		return nil, fmt.Errorf("failed to load purchase history: %w", err)
+	}
+
+	// Summed in Go rather than SQL since MAX over a timestamp comes back as
+	// text from SQLite
+	var rows []PurchaseRecord
+	if err := s.filtered(ctx, customerID, filter).
+		Select("h.product_id, p.name AS product_name, h.quantity, h.total_price, h.purchase_date").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to summarize purchase history: %w", err)
+	}
+
+	summaries := map[uuid.UUID]*ProductPurchaseSummary{}
+	for _, row := range rows {
+		summary, ok := summaries[row.ProductID]
+		if !ok {
+			summary = &ProductPurchaseSummary{ProductID: row.ProductID, ProductName: row.ProductName}
+			summaries[row.ProductID] = summary
+		}
+		summary.PurchaseCount++
+		summary.TotalQuantity += row.Quantity
+		summary.TotalSpent += row.TotalPrice
+		if row.PurchaseDate.After(summary.LastPurchased) {
+			summary.LastPurchased = row.PurchaseDate
+		}
+		result.TotalSpent += row.TotalPrice
+	}
+	for _, summary := range summaries {
+		result.Products = append(result.Products, *summary)
+	}
+	sort.Slice(result.Products, func(i, j int) bool {
+		return result.Products[i].LastPurchased.After(result.Products[j].LastPurchased)
+	})
+
+	return result, nil
+}
+
+// RecordSale writes purchase history rows for a sale in the transaction
+// that makes it. Lines that already have a history row are skipped.
+func (s *PurchaseHistoryService) RecordSale(tx *gorm.DB, sale *models.Sale) error {
+	var rows []*models.PurchaseHistory
+	for _, item := range sale.SaleItems {
+		if history := models.NewSaleHistory(sale, item); history != nil {
+			rows = append(rows, history)
+		}
+	}
+	return s.create(tx, rows)
+}
+
+// RecordOrder writes purchase history rows for an online order in the
+// transaction that hands it to the customer
+func (s *PurchaseHistoryService) RecordOrder(tx *gorm.DB, orderID uuid.UUID) error {
+	var order models.OnlineOrder
+	if err := tx.Preload("OrderItems").First(&order, orderID).Error; err != nil {
+		return fmt.Errorf("order not found: %w", err)
+	}
+
+	var rows []*models.PurchaseHistory
+	for _, item := range order.OrderItems {
+		if history := models.NewOrderHistory(&order, item); history != nil {
+			rows = append(rows, history)
+		}
+	}
+	return s.create(tx, rows)
+}
+
+// Private helper methods
+
+func (s *PurchaseHistoryService) create(tx *gorm.DB, rows []*models.PurchaseHistory) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(rows).Error; err != nil {
+		return fmt.Errorf("failed to record purchase history: %w", err)
+	}
+	return nil
+}
+
+func (s *PurchaseHistoryService) filtered(ctx context.Context, customerID uuid.UUID, filter PurchaseHistoryFilter) *gorm.DB {
+	union := s.db.Raw(purchaseHistoryUnion, customerID, customerID, customerID)
+	query := s.db.WithContext(ctx).Table("(?) AS h", union).
+		Joins("JOIN products p ON p.id = h.product_id")
+
+	if filter.StartDate != nil {
+		query = query.Where("h.purchase_date >= ?", *filter.StartDate)
+	}
+	if filter.EndDate != nil {
+		query = query.Where("h.purchase_date < ?", *filter.EndDate)
+	}
+	if filter.Category != "" {
+		query = query.Where("p.category = ?", filter.Category)
+	}
+	if filter.PrescriptionOnly {
+		query = query.Where("p.prescription_required = ?", true)
+	}
+	if filter.ProductID != nil {
+		query = query.Where("h.product_id = ?", *filter.ProductID)
+	}
+	return query
+}
+
+// Request/Response types
+
+type PurchaseHistoryFilter struct {
+	StartDate        *time.Time
+	EndDate          *time.Time // exclusive
+	Category         string
+	PrescriptionOnly bool
+	ProductID        *uuid.UUID
+	Limit            int
+	Offset           int
+}
+
+type PurchaseRecord struct {
+	Source               string       `json:"source"` // sale, online_order, history
+	ReferenceID          uuid.UUID    `json:"reference_id"`
+	Reference            string       `json:"reference"`
+	ProductID            uuid.UUID    `json:"product_id"`
+	ProductName          string       `json:"product_name"`
+	Category             string       `json:"category"`
+	PrescriptionRequired bool         `json:"prescription_required"`
+	PrescriptionNumber   *string      `json:"prescription_number,omitempty"`
+	Quantity             int          `json:"quantity"`
+	UnitPrice            models.Money `json:"unit_price"`
+	TotalPrice           models.Money `json:"total_price"`
+	PurchaseDate         time.Time    `json:"purchase_date"`
+}
+
+// ProductPurchaseSummary totals a customer's purchases of one product, used
+// for "last purchased" hints
+type ProductPurchaseSummary struct {
+	ProductID     uuid.UUID    `json:"product_id"`
+	ProductName   string       `json:"product_name"`
+	PurchaseCount int          `json:"purchase_count"`
+	TotalQuantity int          `json:"total_quantity"`
+	TotalSpent    models.Money `json:"total_spent"`
+	LastPurchased time.Time    `json:"last_purchased"`
+}
+
+type PurchaseHistoryResult struct {
+	Purchases  []PurchaseRecord         `json:"purchases"`
+	Products   []ProductPurchaseSummary `json:"products"`
+	Total      int64                    `json:"total"`
+	TotalSpent models.Money             `json:"total_spent"`
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrPushTokenInvalid is wrapped by send errors for a device token the
+// provider no longer accepts, e.g. because the app was uninstalled
+var ErrPushTokenInvalid = errors.New("push device token is no longer valid")
+
+// PushGateway sends push notifications through one provider
+type PushGateway interface {
+	Name() string
+	Send(ctx context.Context, token string, message *PushMessage) error
+}
+
+// PushMessage is a notification for one device
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string // handed to the app, e.g. the order to open
+}
+
+// NewPushGateways builds a gateway for each provider set up in the
+// configuration, keyed by provider. One whose key can't be loaded is left
+// out and logged, so the rest of the server still starts.
+func NewPushGateways(cfg config.PushConfig) map[string]PushGateway {
+	gateways := map[string]PushGateway{}
+	if cfg.FCMCredentialsFile != "" {
+		gateway, err := NewFCMGateway(cfg)
+		if err != nil {
+			logrus.WithError(err).Error("FCM push notifications are off")
+		} else {
+			gateways[models.PushProviderFCM] = gateway
+		}
+	}
+	if cfg.APNsKeyFile != "" {
+		gateway, err := NewAPNsGateway(cfg)
+		if err != nil {
+			logrus.WithError(err).Error("APNs push notifications are off")
+		} else {
+			gateways[models.PushProviderAPNs] = gateway
+		}
+	}
+	return gateways
+}
+
+// FCMGateway sends through the Firebase Cloud Messaging HTTP v1 API,
+// authorized by an access token for the service account
+type FCMGateway struct {
+	BaseURL   string
+	ProjectID string
+	Client    *http.Client
+
+	clientEmail string
+	tokenURL    string
+	key         *rsa.PrivateKey
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func NewFCMGateway(cfg config.PushConfig) (*FCMGateway, error) {
+	raw, err := os.ReadFile(cfg.FCMCredentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FCM credentials: %w", err)
+	}
+	var account struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(raw, &account); err != nil {
+		return nil, fmt.Errorf("invalid FCM credentials: %w", err)
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FCM private key: %w", err)
+	}
+
+	gateway := &FCMGateway{
+		BaseURL:     cfg.FCMAPIURL,
+		ProjectID:   cfg.FCMProjectID,
+		Client:      &http.Client{Timeout: cfg.Timeout},
+		clientEmail: account.ClientEmail,
+		tokenURL:    account.TokenURI,
+		key:         key,
+	}
+	if gateway.BaseURL == "" {
+		gateway.BaseURL = "https://fcm.googleapis.com"
+	}
+	if gateway.ProjectID == "" {
+		gateway.ProjectID = account.ProjectID
+	}
+	if gateway.tokenURL == "" {
+		gateway.tokenURL = "https://oauth2.googleapis.com/token"
+	}
+	if gateway.ProjectID == "" || gateway.clientEmail == "" {
+		return nil, fmt.Errorf("FCM credentials have no project_id or client_email")
+	}
+	return gateway, nil
+}
+
+func (g *FCMGateway) Name() string { return models.PushProviderFCM }
+
+func (g *FCMGateway) Send(ctx context.Context, token string, message *PushMessage) error {
+	accessToken, err := g.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": token,
+			"notification": map[string]string{
+				"title": message.Title,
+				"body":  message.Body,
+			},
+			"data": message.Data,
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode FCM request: %w", err)
+	}
+	endpoint := strings.TrimRight(g.BaseURL, "/") + "/v1/projects/" + url.PathEscape(g.ProjectID) + "/messages:send"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build FCM request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("FCM request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	var result struct {
+		Error struct {
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	json.Unmarshal(raw, &result)
+	for _, detail := range result.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return fmt.Errorf("%w: %s", ErrPushTokenInvalid, result.Error.Message)
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrPushTokenInvalid, result.Error.Message)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		g.mu.Lock()
+		g.accessToken = ""
+		g.mu.Unlock()
+	}
+	if result.Error.Message != "" {
+		return fmt.Errorf("FCM returned %d: %s", resp.StatusCode, result.Error.Message)
+	}
+	return fmt.Errorf("FCM returned %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(raw)), 512))
+}
+
+// token returns an access token for the service account, exchanging a
+// signed assertion for a new one shortly before the last expires
+func (g *FCMGateway) token(ctx context.Context) (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.accessToken != "" && time.Now().Before(g.expiresAt) {
+		return g.accessToken, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   g.clientEmail,
+		"scope": "https://www.googleapis.com/auth/firebase.messaging",
+		"aud":   g.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(g.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign FCM token request: %w", err)
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to build FCM token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("FCM token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error_description"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(raw, &result); err != nil || resp.StatusCode >= 300 || result.AccessToken == "" {
+		return "", fmt.Errorf("FCM token request returned %d: %s", resp.StatusCode, truncate(result.Error, 512))
+	}
+
+	g.accessToken = result.AccessToken
+	g.expiresAt = now.Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return g.accessToken, nil
+}
+
+// APNsGateway sends to iOS devices through Apple's HTTP/2 provider API,
+// authorized by a provider token signed with the team's auth key
+type APNsGateway struct {
+	BaseURL string
+	KeyID   string
+	TeamID  string
+	Topic   string
+	Client  *http.Client
+
+	key *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	jwt      string
+	issuedAt time.Time
+}
+
+// apnsTokenLifetime is how long a provider token is reused. Apple refuses
+// tokens older than an hour and ones renewed more often than every 20
+// minutes.
+const apnsTokenLifetime = 50 * time.Minute
+
+func NewAPNsGateway(cfg config.PushConfig) (*APNsGateway, error) {
+	raw, err := os.ReadFile(cfg.APNsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read APNs key: %w", err)
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid APNs key: %w", err)
+	}
+
+	gateway := &APNsGateway{
+		BaseURL: cfg.APNsAPIURL,
+		KeyID:   cfg.APNsKeyID,
+		TeamID:  cfg.APNsTeamID,
+		Topic:   cfg.APNsTopic,
+		Client:  &http.Client{Timeout: cfg.Timeout},
+		key:     key,
+	}
+	if gateway.BaseURL == "" {
+		gateway.BaseURL = "https://api.sandbox.push.apple.com"
+		if cfg.APNsProduction {
+			gateway.BaseURL = "https://api.push.apple.com"
+		}
+	}
+	return gateway, nil
+}
+
+func (g *APNsGateway) Name() string { return models.PushProviderAPNs }
+
+func (g *APNsGateway) Send(ctx context.Context, token string, message *PushMessage) error {
+	providerToken, err := g.providerToken()
+	if err != nil {
+		return err
+	}
+
+	// The app's data goes beside aps, where iOS hands it to the app
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{
+				"title": message.Title,
+				"body":  message.Body,
+			},
+			"sound": "default",
+		},
+	}
+	for key, value := range message.Data {
+		if key != "aps" {
+			payload[key] = value
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode APNs request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(g.BaseURL, "/")+"/3/device/"+url.PathEscape(token), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build APNs request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "bearer "+providerToken)
+	req.Header.Set("apns-topic", g.Topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("APNs request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return nil
+	}
+
+	var result struct {
+		Reason string `json:"reason"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	json.Unmarshal(raw, &result)
+	switch {
+	case resp.StatusCode == http.StatusGone, result.Reason == "BadDeviceToken", result.Reason == "DeviceTokenNotForTopic":
+		return fmt.Errorf("%w: %s", ErrPushTokenInvalid, result.Reason)
+	case result.Reason == "ExpiredProviderToken":
+		g.mu.Lock()
+		g.jwt = ""
+		g.mu.Unlock()
+	}
+	return fmt.Errorf("APNs returned %d: %s", resp.StatusCode, result.Reason)
+}
+
+// providerToken returns the signed token APNs requests are authorized with,
+// signing a new one when the last is due for renewal
+func (g *APNsGateway) providerToken() (string, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.jwt != "" && time.Since(g.issuedAt) < apnsTokenLifetime {
+		return g.jwt, nil
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"iss": g.TeamID,
+		"iat": now.Unix(),
+	})
+	token.Header["kid"] = g.KeyID
+	signed, err := token.SignedString(g.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign APNs provider token: %w", err)
+	}
+	g.jwt, g.issuedAt = signed, now
+	return signed, nil
+}
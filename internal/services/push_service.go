@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPushUnavailable = errors.New("push notifications are not configured for this provider")
+	ErrUnknownAlert    = errors.New("unknown staff alert")
+)
+
+// PushSessionPrefix marks a push address as a guest session of the ordering
+// app rather than a customer ID, e.g. "session:" followed by the session ID
+const PushSessionPrefix = "session:"
+
+// PushService keeps the app installations registered for push
+// notifications and sends to them: order updates to customers and guest
+// sessions, and low-stock and prescription-queue alerts to the staff who
+// want them. Tokens the provider no longer accepts are dropped as they are
+// found.
+type PushService struct {
+	db       *gorm.DB
+	gateways map[string]PushGateway
+}
+
+func NewPushService(db *gorm.DB, gateways map[string]PushGateway) *PushService {
+	return &PushService{
+		db:       db,
+		gateways: gateways,
+	}
+}
+
+// Enabled reports whether any push provider is configured
+func (s *PushService) Enabled() bool {
+	return len(s.gateways) > 0
+}
+
+// Send pushes a notification, so the service can stand in as the push
+// Notifier. to is a customer ID or a guest session address.
+func (s *PushService) Send(ctx context.Context, to, subject, body string) error {
+	return s.Push(ctx, to, &PushMessage{Title: subject, Body: body})
+}
+
+// Push sends a message to every device of a customer ID or guest session
+// address. It returns ErrNotificationSuppressed when there is no device to
+// send to, and an error only when no device got the message.
+func (s *PushService) Push(ctx context.Context, to string, message *PushMessage) error {
+	devices, err := s.devicesFor(ctx, to)
+	if err != nil {
+		return err
+	}
+	sent, err := s.sendTo(ctx, devices, message)
+	if sent == 0 && err == nil {
+		return ErrNotificationSuppressed
+	}
+	if sent == 0 {
+		return err
+	}
+	return nil
+}
+
+// HasDevices reports whether a customer ID or guest session address has a
+// device to push to
+func (s *PushService) HasDevices(ctx context.Context, to string) (bool, error) {
+	devices, err := s.devicesFor(ctx, to)
+	if err != nil {
+		return false, err
+	}
+	for _, device := range devices {
+		if _, ok := s.gateways[device.Provider]; ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// NotifyStaff pushes an alert to the devices of active staff who get it:
+// those who turned it on, and those whose role gets it by default and who
+// haven't turned it off. An alert for a branch goes to its staff and to
+// staff without a branch. It returns how many devices got the alert.
+func (s *PushService) NotifyStaff(ctx context.Context, alert models.StaffAlert, branchID *uuid.UUID, message *PushMessage) (int, error) {
+	query := s.db.WithContext(ctx).Where("is_active = ?", true)
+	if branchID != nil {
+		query = query.Where("branch_id = ? OR branch_id IS NULL", *branchID)
+	}
+	var users []models.User
+	if err := query.Select("id", "role").Find(&users).Error; err != nil {
+		return 0, fmt.Errorf("failed to load staff: %w", err)
+	}
+	var prefs []models.StaffNotificationPreference
+	if err := s.db.WithContext(ctx).Where("alert = ?", alert).Find(&prefs).Error; err != nil {
+		return 0, fmt.Errorf("failed to load staff alert preferences: %w", err)
+	}
+	chosen := make(map[uuid.UUID]bool, len(prefs))
+	for _, pref := range prefs {
+		chosen[pref.UserID] = pref.Enabled
+	}
+
+	var recipients []uuid.UUID
+	for _, user := range users {
+		enabled, ok := chosen[user.ID]
+		if !ok {
+			enabled = alert.DefaultFor(user.Role)
+		}
+		if enabled {
+			recipients = append(recipients, user.ID)
+		}
+	}
+	if len(recipients) == 0 {
+		return 0, nil
+	}
+
+	var devices []models.PushDevice
+	if err := s.db.WithContext(ctx).Where("user_id IN ?", recipients).Find(&devices).Error; err != nil {
+		return 0, fmt.Errorf("failed to load push devices: %w", err)
+	}
+	return s.sendTo(ctx, devices, message)
+}
+
+// RegisterDevice records an app installation's token for its owner. A token
+// that is already registered moves to the new owner, e.g. when someone
+// else signs in on the device.
+func (s *PushService) RegisterDevice(ctx context.Context, owner PushDeviceOwner, req RegisterPushDeviceRequest) (*models.PushDevice, error) {
+	if _, ok := s.gateways[req.Provider]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPushUnavailable, req.Provider)
+	}
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+	if owner.CustomerID != nil {
+		var customer models.Customer
+		if err := s.db.WithContext(ctx).Select("id").First(&customer, "id = ?", *owner.CustomerID).Error; err != nil {
+			return nil, fmt.Errorf("customer: %w", err)
+		}
+	}
+
+	device := &models.PushDevice{
+		CustomerID: owner.CustomerID,
+		UserID:     owner.UserID,
+		SessionID:  owner.SessionID,
+		Provider:   req.Provider,
+		Platform:   req.Platform,
+		Token:      token,
+		DeviceName: truncate(req.DeviceName, 100),
+		AppVersion: truncate(req.AppVersion, 50),
+		LastSeenAt: time.Now().UTC(),
+	}
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"customer_id", "user_id", "session_id", "provider", "platform",
+			"device_name", "app_version", "last_seen_at", "updated_at",
+		}),
+	}).Create(device).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to register push device: %w", err)
+	}
+
+	// Reload for the stored row's ID when the token was already registered
+	var stored models.PushDevice
+	if err := s.db.WithContext(ctx).Where("token = ?", token).First(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to load push device: %w", err)
+	}
+	return &stored, nil
+}
+
+// ListDevices returns an owner's devices, most recently seen first
+func (s *PushService) ListDevices(ctx context.Context, owner PushDeviceOwner) ([]models.PushDevice, error) {
+	var devices []models.PushDevice
+	if err := owner.scope(s.db.WithContext(ctx)).Order("last_seen_at DESC").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to load push devices: %w", err)
+	}
+	return devices, nil
+}
+
+// DeleteDevice removes one of an owner's devices
+func (s *PushService) DeleteDevice(ctx context.Context, owner PushDeviceOwner, id uuid.UUID) (*models.PushDevice, error) {
+	var device models.PushDevice
+	if err := owner.scope(s.db.WithContext(ctx)).First(&device, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	// Hard deleted so the token can be registered again
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&device).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove push device: %w", err)
+	}
+	return &device, nil
+}
+
+// UnregisterToken removes the device with a token, for an app signing out
+// or turning notifications off. Holding the token is proof enough.
+func (s *PushService) UnregisterToken(ctx context.Context, token string) (*models.PushDevice, error) {
+	var device models.PushDevice
+	if err := s.db.WithContext(ctx).Where("token = ?", strings.TrimSpace(token)).First(&device).Error; err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&device).Error; err != nil {
+		return nil, fmt.Errorf("failed to remove push device: %w", err)
+	}
+	return &device, nil
+}
+
+// GetStaffPreferences returns whether a staff user gets each alert, filling
+// in their role's default where they haven't chosen
+func (s *PushService) GetStaffPreferences(ctx context.Context, user *models.User) ([]StaffAlertPreference, error) {
+	var prefs []models.StaffNotificationPreference
+	if err := s.db.WithContext(ctx).Where("user_id = ?", user.ID).Find(&prefs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load staff alert preferences: %w", err)
+	}
+	chosen := make(map[models.StaffAlert]bool, len(prefs))
+	for _, pref := range prefs {
+		chosen[pref.Alert] = pref.Enabled
+	}
+
+	views := make([]StaffAlertPreference, 0, len(models.StaffAlerts))
+	for _, alert := range models.StaffAlerts {
+		enabled, ok := chosen[alert]
+		if !ok {
+			enabled = alert.DefaultFor(user.Role)
+		}
+		views = append(views, StaffAlertPreference{Alert: alert, Enabled: enabled, Default: !ok})
+	}
+	return views, nil
+}
+
+// UpdateStaffPreferences records a staff user's choices of alerts
+func (s *PushService) UpdateStaffPreferences(ctx context.Context, userID uuid.UUID, updates []StaffAlertPreferenceUpdate) error {
+	for _, update := range updates {
+		if !update.Alert.IsValid() {
+			return fmt.Errorf("%w: %s", ErrUnknownAlert, update.Alert)
+		}
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, update := range updates {
+			pref := &models.StaffNotificationPreference{
+				UserID:  userID,
+				Alert:   update.Alert,
+				Enabled: update.Enabled,
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "alert"}},
+				DoUpdates: clause.AssignmentColumns([]string{"enabled", "updated_at"}),
+			}).Create(pref).Error; err != nil {
+				return fmt.Errorf("failed to save staff alert preference: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Private helper methods
+
+// devicesFor loads the devices of a customer ID or guest session address
+func (s *PushService) devicesFor(ctx context.Context, to string) ([]models.PushDevice, error) {
+	var owner PushDeviceOwner
+	if session, ok := strings.CutPrefix(to, PushSessionPrefix); ok {
+		owner.SessionID = &session
+	} else {
+		customerID, err := uuid.Parse(to)
+		if err != nil {
+			return nil, nil
+		}
+		owner.CustomerID = &customerID
+	}
+	return s.ListDevices(ctx, owner)
+}
+
+// sendTo sends a message to each device, dropping those whose token is no
+// longer valid. It returns how many got it, and the last error when none
+// did.
+func (s *PushService) sendTo(ctx context.Context, devices []models.PushDevice, message *PushMessage) (int, error) {
+	sent := 0
+	var lastErr error
+	for i := range devices {
+		device := &devices[i]
+		gateway, ok := s.gateways[device.Provider]
+		if !ok {
+			continue
+		}
+		err := gateway.Send(ctx, device.Token, message)
+		switch {
+		case err == nil:
+			sent++
+		case errors.Is(err, ErrPushTokenInvalid):
+			logrus.WithFields(logrus.Fields{
+				"device_id": device.ID,
+				"provider":  device.Provider,
+			}).Info("Dropped push device the provider no longer accepts")
+			if err := s.db.WithContext(ctx).Unscoped().Delete(device).Error; err != nil {
+				return sent, fmt.Errorf("failed to remove push device: %w", err)
+			}
+		default:
+			lastErr = err
+			logrus.WithError(err).WithField("device_id", device.ID).Warn("Push notification failed")
+		}
+	}
+	if sent > 0 {
+		return sent, nil
+	}
+	return 0, lastErr
+}
+
+// Request/Response types
+
+// PushDeviceOwner is who a device is registered to: one of a customer, a
+// staff user or a guest session
+type PushDeviceOwner struct {
+	CustomerID *uuid.UUID
+	UserID     *uuid.UUID
+	SessionID  *string
+}
+
+func (o PushDeviceOwner) scope(db *gorm.DB) *gorm.DB {
+	switch {
+	case o.CustomerID != nil:
+		return db.Where("customer_id = ?", *o.CustomerID)
+	case o.UserID != nil:
+		return db.Where("user_id = ?", *o.UserID)
+	case o.SessionID != nil:
+		return db.Where("session_id = ?", *o.SessionID)
+	}
+	return db.Where("1 = 0")
+}
+
+type RegisterPushDeviceRequest struct {
+	Provider   string `json:"provider" binding:"required,oneof=fcm apns"`
+	Platform   string `json:"platform" binding:"omitempty,oneof=android ios web"`
+	Token      string `json:"token" binding:"required,max=512"`
+	DeviceName string `json:"device_name"`
+	AppVersion string `json:"app_version"`
+}
+
+// PushContent is the data an app gets with a push notification
+type PushContent struct {
+	Data map[string]string
+}
+
+// StaffAlertMessage is an alert queued for the staff who get it
+type StaffAlertMessage struct {
+	Alert    models.StaffAlert
+	BranchID *uuid.UUID // nil for every branch
+	Title    string
+	Body     string
+	Data     map[string]string
+}
+
+type StaffAlertPreference struct {
+	Alert   models.StaffAlert `json:"alert"`
+	Enabled bool              `json:"enabled"`
+	Default bool              `json:"default"` // not chosen, so the role's default applies
+}
+
+type StaffAlertPreferenceUpdate struct {
+	Alert   models.StaffAlert `json:"alert" binding:"required"`
+	Enabled bool              `json:"enabled"`
+}
@@ -8,7 +8,9 @@ import (
 	"fmt"
 	"time"
 
+	"pharmacy-backend/internal/database"
 	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -37,7 +39,7 @@ type ProductQRData struct {
 	ProductID    uuid.UUID `json:"product_id"`
 	SKU          string    `json:"sku"`
 	Name         string    `json:"name"`
-	Price        float64   `json:"price"`
+	Price        models.Money `json:"price"`
 	BatchNumber  string    `json:"batch_number"`
 	ExpiryDate   models.CustomDate `json:"expiry_date"`
 	PrescriptionRequired bool `json:"prescription_required"`
@@ -49,6 +51,7 @@ type CustomerQRData struct {
 	Name         string    `json:"name"`
 	Phone        string    `json:"phone"`
 	LoyaltyPoints int      `json:"loyalty_points"`
+	LoyaltyTier  string    `json:"loyalty_tier"`
 	MemberSince  time.Time `json:"member_since"`
 }
 
@@ -57,11 +60,34 @@ type OrderQRData struct {
 	OrderID      uuid.UUID              `json:"order_id"`
 	OrderNumber  string                 `json:"order_number"`
 	Status       models.OrderStatus     `json:"status"`
-	Total        float64                `json:"total"`
+	Total        models.Money           `json:"total"`
 	OrderType    models.OrderType       `json:"order_type"`
 	TrackingURL  string                 `json:"tracking_url,omitempty"`
 }
 
+// VaccinationQRData for vaccination certificate QR codes. It carries only
+// what a verifier needs to match the certificate to its holder.
+type VaccinationQRData struct {
+	RecordID       uuid.UUID `json:"record_id"`
+	Name           string    `json:"name"`
+	Vaccine        string    `json:"vaccine"`
+	DoseNumber     int       `json:"dose_number"`
+	AdministeredAt time.Time `json:"administered_at"`
+}
+
+// FeedbackQRData for the feedback QR code handed over with an order. The
+// URL is what the printed code opens.
+type FeedbackQRData struct {
+	OrderNumber string `json:"order_number"`
+	URL         string `json:"url"`
+}
+
+// EmployeeQRData for an employee's time clock badge. Anyone can scan it, so
+// it only carries the first name printed on the badge.
+type EmployeeQRData struct {
+	Name string `json:"name"`
+}
+
 // GenerateProductQR generates QR code for a product
 func (s *QRService) GenerateProductQR(ctx context.Context, productID uuid.UUID, userID *uuid.UUID) (*models.QRCode, error) {
 	// Get product details
@@ -111,6 +137,7 @@ func (s *QRService) GenerateCustomerQR(ctx context.Context, customerID uuid.UUID
 			Name:         customer.FirstName + " " + customer.LastName,
 			Phone:        customer.Phone,
 			LoyaltyPoints: customer.LoyaltyPoints,
+			LoyaltyTier:  customer.LoyaltyTier,
 			MemberSince:  customer.CreatedAt,
 		},
 	}
@@ -125,11 +152,23 @@ func (s *QRService) GenerateOrderQR(ctx context.Context, orderID uuid.UUID, user
 	if err := s.db.First(&order, orderID).Error; err != nil {
 		return nil, fmt.Errorf("order not found: %w", err)
 	}
+	return s.CreateOrderQR(ctx, s.db, &order, userID)
+}
+
+// CreateOrderQR generates the QR code of an order that is being created in
+// tx, so the code is saved, or not, with the order. The order's ID, number
+// and total must already be set.
+func (s *QRService) CreateOrderQR(ctx context.Context, tx *gorm.DB, order *models.OnlineOrder, userID *uuid.UUID) (*models.QRCode, error) {
+	// The tracking page takes the order's tracking code, not its number
+	var trackingURL string
+	if order.TrackingCode != nil {
+		trackingURL = "/orders/track/" + *order.TrackingCode
+	}
 
 	// Create QR data
 	qrData := QRData{
 		Type:       models.QRTypeOrder,
-		EntityID:   orderID,
+		EntityID:   order.ID,
 		EntityType: "order",
 		Timestamp:  time.Now().UTC(),
 		Version:    "1.0",
@@ -139,13 +178,109 @@ func (s *QRService) GenerateOrderQR(ctx context.Context, orderID uuid.UUID, user
 			Status:      order.Status,
 			Total:       order.Total,
 			OrderType:   order.OrderType,
-			TrackingURL: fmt.Sprintf("/orders/%s/track", order.ID),
+			TrackingURL: trackingURL,
+		},
+	}
+
+	// The order's code belongs to the branch that fills it
+	if order.BranchID != nil {
+		ctx = database.WithBranch(ctx, *order.BranchID)
+	}
+	return s.saveQRCode(ctx, tx, qrData, userID)
+}
+
+// GenerateVaccinationQR generates the verification QR code for a
+// vaccination certificate
+func (s *QRService) GenerateVaccinationQR(ctx context.Context, recordID uuid.UUID, userID *uuid.UUID) (*models.QRCode, error) {
+	var record models.VaccinationRecord
+	if err := s.db.Preload("Customer", WithDeleted).First(&record, recordID).Error; err != nil {
+		return nil, fmt.Errorf("vaccination record not found: %w", err)
+	}
+
+	name := ""
+	if record.Customer != nil {
+		name = record.Customer.FirstName + " " + record.Customer.LastName
+	}
+
+	qrData := QRData{
+		Type:       models.QRTypeVaccination,
+		EntityID:   recordID,
+		EntityType: "vaccination",
+		Timestamp:  time.Now().UTC(),
+		Version:    "1.0",
+		Extra: VaccinationQRData{
+			RecordID:       record.ID,
+			Name:           name,
+			Vaccine:        record.VaccineName,
+			DoseNumber:     record.DoseNumber,
+			AdministeredAt: record.AdministeredAt,
 		},
 	}
 
 	return s.generateQRCode(ctx, qrData, userID)
 }
 
+// CreateFeedbackQR creates the QR code for an order's feedback link with
+// db, e.g. the transaction creating the feedback request. It stops working
+// when the link does.
+func (s *QRService) CreateFeedbackQR(ctx context.Context, db *gorm.DB, feedback *models.Feedback, orderNumber, link string) (*models.QRCode, error) {
+	qrData := QRData{
+		Type:       models.QRTypeFeedback,
+		EntityID:   feedback.ID,
+		EntityType: "feedback",
+		Timestamp:  time.Now().UTC(),
+		Version:    "1.0",
+		Extra: FeedbackQRData{
+			OrderNumber: orderNumber,
+			URL:         link,
+		},
+	}
+
+	qrCode, err := s.saveQRCode(ctx, db, qrData, nil)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := feedback.ExpiresAt
+	if err := db.Model(qrCode).Update("expires_at", expiresAt).Error; err != nil {
+		return nil, fmt.Errorf("failed to set QR code expiry: %w", err)
+	}
+	qrCode.ExpiresAt = &expiresAt
+	return qrCode, nil
+}
+
+// GenerateEmployeeQR issues an employee's personal badge for clocking in
+// and out at a register. The badges issued before it stop working.
+func (s *QRService) GenerateEmployeeQR(ctx context.Context, employeeID uuid.UUID, userID *uuid.UUID) (*models.QRCode, error) {
+	var employee models.User
+	if err := s.db.First(&employee, "id = ?", employeeID).Error; err != nil {
+		return nil, fmt.Errorf("user: %w", err)
+	}
+
+	qrData := QRData{
+		Type:       models.QRTypeEmployee,
+		EntityID:   employee.ID,
+		EntityType: "user",
+		Timestamp:  time.Now().UTC(),
+		Version:    "1.0",
+		Extra: EmployeeQRData{
+			Name: employee.FirstName,
+		},
+	}
+
+	var qrCode *models.QRCode
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.QRCode{}).
+			Where("entity_id = ? AND type = ? AND is_active = ?", employee.ID, models.QRTypeEmployee, true).
+			Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now().UTC()}).Error; err != nil {
+			return fmt.Errorf("failed to retire previous badges: %w", err)
+		}
+		var err error
+		qrCode, err = s.saveQRCode(ctx, tx, qrData, userID)
+		return err
+	})
+	return qrCode, err
+}
+
 // ScanQR scans and validates a QR code
 func (s *QRService) ScanQR(ctx context.Context, code string, scanContext ScanContext) (*QRScanResult, error) {
 	// Find QR code in database
@@ -189,7 +324,7 @@ func (s *QRService) ScanQR(ctx context.Context, code string, scanContext ScanCon
 	}
 
 	// Load entity details based on type
-	if err := s.loadEntityDetails(ctx, result); err != nil {
+	if err := s.loadEntityDetails(ctx, result, scanContext); err != nil {
 		return nil, fmt.Errorf("failed to load entity details: %w", err)
 	}
 
@@ -214,13 +349,42 @@ func (s *QRService) DeactivateQRCode(ctx context.Context, qrCodeID uuid.UUID, re
 
 // GetScanHistory retrieves scan history for analytics
 func (s *QRService) GetScanHistory(ctx context.Context, filters ScanHistoryFilters) ([]models.QRScanLog, error) {
-	query := s.db.Model(&models.QRScanLog{}).Preload("QRCode")
+	var scanLogs []models.QRScanLog
+	err := s.scanHistoryQuery(ctx, filters).Order("qr_scan_logs.created_at DESC").Limit(filters.Limit).Offset(filters.Offset).Find(&scanLogs).Error
+	return scanLogs, err
+}
+
+// GetScanHistoryAfter is GetScanHistory with keyset pagination. It returns
+// the scans after cursor and the cursor of the next page, empty on the last.
+func (s *QRService) GetScanHistoryAfter(ctx context.Context, filters ScanHistoryFilters, cursor string) ([]models.QRScanLog, string, error) {
+	filters.Limit = query.CursorPageSize(filters.Limit, 50)
+	after, err := query.AfterCursor(s.scanHistoryQuery(ctx, filters), "qr_scan_logs", cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var scanLogs []models.QRScanLog
+	if err := after.Limit(filters.Limit + 1).Find(&scanLogs).Error; err != nil {
+		return nil, "", err
+	}
+	if len(scanLogs) <= filters.Limit {
+		return scanLogs, "", nil
+	}
+	scanLogs = scanLogs[:filters.Limit]
+	last := scanLogs[len(scanLogs)-1]
+	return scanLogs, query.EncodeCursor(last.CreatedAt, last.ID), nil
+}
+
+// Private helper methods
+
+func (s *QRService) scanHistoryQuery(ctx context.Context, filters ScanHistoryFilters) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.QRScanLog{}).Preload("QRCode")
 	
 	if !filters.StartDate.IsZero() {
-		query = query.Where("created_at >= ?", filters.StartDate)
+		query = query.Where("qr_scan_logs.created_at >= ?", filters.StartDate)
 	}
 	if !filters.EndDate.IsZero() {
-		query = query.Where("created_at <= ?", filters.EndDate)
+		query = query.Where("qr_scan_logs.created_at <= ?", filters.EndDate)
 	}
 	if filters.EntityType != "" {
 		query = query.Joins("JOIN qr_codes ON qr_scan_logs.qr_code_id = qr_codes.id").
@@ -229,15 +393,15 @@ func (s *QRService) GetScanHistory(ctx context.Context, filters ScanHistoryFilte
 	if filters.Success != nil {
 		query = query.Where("success = ?", *filters.Success)
 	}
-
-	var scanLogs []models.QRScanLog
-	err := query.Order("created_at DESC").Limit(filters.Limit).Offset(filters.Offset).Find(&scanLogs).Error
-	return scanLogs, err
+	return query
 }
 
-// Private helper methods
-
 func (s *QRService) generateQRCode(ctx context.Context, qrData QRData, userID *uuid.UUID) (*models.QRCode, error) {
+	return s.saveQRCode(ctx, s.db, qrData, userID)
+}
+
+// saveQRCode is generateQRCode saving with db, e.g. a transaction
+func (s *QRService) saveQRCode(ctx context.Context, db *gorm.DB, qrData QRData, userID *uuid.UUID) (*models.QRCode, error) {
 	// Generate unique code
 	code, err := s.generateUniqueCode()
 	if err != nil {
@@ -268,8 +432,8 @@ func (s *QRService) generateQRCode(ctx context.Context, qrData QRData, userID *u
 		qrCode.ExpiresAt = &expiry
 	}
 
-	// Save to database
-	if err := s.db.Create(qrCode).Error; err != nil {
+	// Save to database. The code belongs to the branch ctx is limited to.
+	if err := db.WithContext(ctx).Create(qrCode).Error; err != nil {
 		return nil, fmt.Errorf("failed to save QR code: %w", err)
 	}
 
@@ -335,7 +499,7 @@ func (s *QRService) logScan(ctx context.Context, qrCodeID uuid.UUID, scanContext
 	}()
 }
 
-func (s *QRService) loadEntityDetails(ctx context.Context, result *QRScanResult) error {
+func (s *QRService) loadEntityDetails(ctx context.Context, result *QRScanResult, scanContext ScanContext) error {
 	switch result.Type {
 	case models.QRTypeProduct:
 		var product models.Product
@@ -345,19 +509,53 @@ func (s *QRService) loadEntityDetails(ctx context.Context, result *QRScanResult)
 		result.Entity = &product
 
 	case models.QRTypeCustomer:
+		// Flags are staff notes, so anonymous scans don't see them
+		query := s.db
+		if scanContext.UserID != nil {
+			query = query.Preload("Flags", ActiveFlags)
+		}
 		var customer models.Customer
-		if err := s.db.First(&customer, result.EntityID).Error; err != nil {
+		if err := query.First(&customer, result.EntityID).Error; err != nil {
 			return err
 		}
 		result.Entity = &customer
 
 	case models.QRTypeOrder:
+		// Anonymous scans get what the tracking page shows; the customer
+		// and delivery address are for staff
+		query := s.db.Preload("OrderItems.Product", WithDeleted)
+		if scanContext.UserID != nil {
+			query = query.Preload("Customer", WithDeleted)
+		}
 		var order models.OnlineOrder
-		if err := s.db.Preload("OrderItems.Product").Preload("Customer").
-			First(&order, result.EntityID).Error; err != nil {
+		if err := query.First(&order, result.EntityID).Error; err != nil {
+			return err
+		}
+		if scanContext.UserID == nil {
+			tracking, err := newOrderTracking(s.db, &order)
+			if err != nil {
+				return err
+			}
+			result.Entity = tracking
+		} else {
+			result.Entity = &order
+		}
+
+	case models.QRTypeVaccination:
+		// Scans are public, so only the verification details are returned
+		var record models.VaccinationRecord
+		if err := s.db.Preload("Customer", WithDeleted).First(&record, result.EntityID).Error; err != nil {
+			return err
+		}
+		result.Entity = newVaccinationVerification(record)
+
+	case models.QRTypeFeedback:
+		// Scans are public, so only the feedback form is returned
+		var feedback models.Feedback
+		if err := s.db.Preload("Order").Preload("Staff").First(&feedback, result.EntityID).Error; err != nil {
 			return err
 		}
-		result.Entity = &order
+		result.Entity = newFeedbackForm(feedback)
 	}
 
 	return nil
@@ -0,0 +1,490 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrReferralCodeUnknown = errors.New("referral code not found")
+	ErrReferralSelf        = errors.New("customers cannot refer themselves")
+	ErrReferralNotNew      = errors.New("only customers who have not bought anything yet can be referred")
+	ErrReferralExists      = errors.New("customer has already been referred")
+	ErrReferralDependent   = errors.New("dependents take part in referrals through their guardian")
+)
+
+// referralCodeAlphabet leaves out characters read aloud or written down
+// ambiguously, such as 0 and O
+const referralCodeAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// ReferralService tracks the customers brought in with other customers'
+// referral codes, and rewards both when the new customer's first order
+// qualifies
+type ReferralService struct {
+	db      *gorm.DB
+	loyalty *LoyaltyService
+	config  config.ReferralConfig
+}
+
+func NewReferralService(db *gorm.DB, loyalty *LoyaltyService, cfg config.ReferralConfig) *ReferralService {
+	return &ReferralService{
+		db:      db,
+		loyalty: loyalty,
+		config:  cfg,
+	}
+}
+
+// GetCode returns a customer's referral code, issuing one the first time
+func (s *ReferralService) GetCode(ctx context.Context, customerID uuid.UUID) (*models.ReferralCode, error) {
+	var customer models.Customer
+	if err := s.db.Select("id", "first_name", "guardian_id").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.GuardianID != nil {
+		return nil, ErrReferralDependent
+	}
+
+	var code models.ReferralCode
+	err := s.db.Where("customer_id = ?", customerID).First(&code).Error
+	if err == nil {
+		return &code, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	for attempts := 0; attempts < 5; attempts++ {
+		value, err := newReferralCode(customer.FirstName)
+		if err != nil {
+			return nil, err
+		}
+		code = models.ReferralCode{CustomerID: customerID, Code: value}
+		if err := s.db.Create(&code).Error; err == nil {
+			return &code, nil
+		}
+		// Issued meanwhile by another request, or the code is taken
+		if err := s.db.Where("customer_id = ?", customerID).First(&code).Error; err == nil {
+			return &code, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to issue a unique referral code")
+}
+
+// Record credits a new customer to the customer whose referral code they
+// signed up with. They have until the referral window closes to place
+// their first order.
+func (s *ReferralService) Record(ctx context.Context, customerID uuid.UUID, req RecordReferralRequest, userID uuid.UUID) (*models.Referral, error) {
+	var customer models.Customer
+	if err := s.db.Select("id", "guardian_id").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	if customer.GuardianID != nil {
+		return nil, ErrReferralDependent
+	}
+
+	var code models.ReferralCode
+	if err := s.db.Where("code = ?", normalizeReferralCode(req.Code)).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrReferralCodeUnknown
+		}
+		return nil, err
+	}
+	if code.CustomerID == customerID {
+		return nil, ErrReferralSelf
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.Referral{}).Where("referred_id = ?", customerID).Count(&existing).Error; err != nil {
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, ErrReferralExists
+	}
+	bought, err := s.hasBought(customerID)
+	if err != nil {
+		return nil, err
+	}
+	if bought {
+		return nil, ErrReferralNotNew
+	}
+
+	referral := &models.Referral{
+		ReferrerID: code.CustomerID,
+		ReferredID: customerID,
+		Code:       code.Code,
+		Status:     models.ReferralStatusPending,
+		ExpiresAt:  time.Now().UTC().AddDate(0, 0, s.config.WindowDays),
+		RecordedBy: &userID,
+	}
+	if err := s.db.Create(referral).Error; err != nil {
+		if s.db.Model(&models.Referral{}).Where("referred_id = ?", customerID).Count(&existing); existing > 0 {
+			return nil, ErrReferralExists
+		}
+		return nil, fmt.Errorf("failed to record referral: %w", err)
+	}
+	return referral, nil
+}
+
+// QualifySale settles a referral on the new customer's first sale
+func (s *ReferralService) QualifySale(ctx context.Context, sale *models.Sale) error {
+	if sale.CustomerID == nil {
+		return nil
+	}
+	return s.settle(*sale.CustomerID, &sale.ID, nil, sale.Total, sale.SaleNumber)
+}
+
+// QualifyOrder settles a referral on the new customer's first online order
+// once it is fulfilled. Delivery fees don't count towards the minimum.
+func (s *ReferralService) QualifyOrder(ctx context.Context, orderID uuid.UUID) error {
+	var order models.OnlineOrder
+	if err := s.db.First(&order, orderID).Error; err != nil {
+		return fmt.Errorf("order not found: %w", err)
+	}
+	if order.CustomerID == nil {
+		return nil
+	}
+	return s.settle(*order.CustomerID, nil, &order.ID, order.Total-order.DeliveryFee, order.OrderNumber)
+}
+
+// GetCustomerReferrals returns a customer's referral code, who referred
+// them and the customers they have referred
+func (s *ReferralService) GetCustomerReferrals(ctx context.Context, customerID uuid.UUID) (*CustomerReferrals, error) {
+	code, err := s.GetCode(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CustomerReferrals{Code: code.Code, Referrals: []models.Referral{}}
+	var referredBy models.Referral
+	if err := s.db.Preload("Referrer", WithDeleted).Where("referred_id = ?", customerID).First(&referredBy).Error; err == nil {
+		result.ReferredBy = &referredBy
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if err := s.db.Preload("Referred", WithDeleted).Where("referrer_id = ?", customerID).
+		Order("created_at DESC").Find(&result.Referrals).Error; err != nil {
+		return nil, fmt.Errorf("failed to load referrals: %w", err)
+	}
+	for _, referral := range result.Referrals {
+		if referral.Status == models.ReferralStatusQualified {
+			result.Qualified++
+			result.PointsEarned += referral.ReferrerPoints
+			result.CreditEarned += referral.ReferrerCredit
+		}
+	}
+	return result, nil
+}
+
+// ListReferrals lists referrals, newest first
+func (s *ReferralService) ListReferrals(ctx context.Context, filter ReferralFilter) ([]models.Referral, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Referral{})
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ReferrerID != nil {
+		query = query.Where("referrer_id = ?", *filter.ReferrerID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	var referrals []models.Referral
+	err := query.Preload("Referrer", WithDeleted).Preload("Referred", WithDeleted).
+		Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&referrals).Error
+	return referrals, total, err
+}
+
+// Report sums up the referrals recorded in the filter's period: how many
+// qualified, what their first orders brought in, the rewards granted, the
+// month-by-month trend and the customers who referred the most
+func (s *ReferralService) Report(ctx context.Context, filter ReferralReportFilter) (*ReferralReport, error) {
+	query := s.db.WithContext(ctx).Model(&models.Referral{})
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+	var referrals []models.Referral
+	if err := query.Order("created_at ASC").Find(&referrals).Error; err != nil {
+		return nil, fmt.Errorf("failed to load referrals: %w", err)
+	}
+
+	report := &ReferralReport{
+		From:         filter.From,
+		To:           filter.To,
+		Trend:        []ReferralTrendPoint{},
+		TopReferrers: []ReferrerPerformance{},
+	}
+	var periods []string
+	byPeriod := map[string]*ReferralTrendPoint{}
+	byReferrer := map[uuid.UUID]*ReferrerPerformance{}
+	for _, referral := range referrals {
+		period := referral.CreatedAt.UTC().Format("2006-01")
+		if byPeriod[period] == nil {
+			byPeriod[period] = &ReferralTrendPoint{Period: period}
+			periods = append(periods, period)
+		}
+		if byReferrer[referral.ReferrerID] == nil {
+			byReferrer[referral.ReferrerID] = &ReferrerPerformance{CustomerID: referral.ReferrerID, Code: referral.Code}
+		}
+		point, referrer := byPeriod[period], byReferrer[referral.ReferrerID]
+
+		report.Referrals++
+		point.Referrals++
+		referrer.Referrals++
+		switch referral.Status {
+		case models.ReferralStatusPending:
+			report.Pending++
+		case models.ReferralStatusLapsed:
+			report.Lapsed++
+		case models.ReferralStatusQualified:
+			report.Qualified++
+			point.Qualified++
+			referrer.Qualified++
+			report.FirstOrderRevenue += referral.OrderTotal
+			referrer.FirstOrderRevenue += referral.OrderTotal
+			report.PointsAwarded += referral.ReferrerPoints + referral.RefereePoints
+			report.CreditAwarded += referral.ReferrerCredit + referral.RefereeCredit
+		}
+	}
+	if report.Referrals > 0 {
+		report.ConversionRate = math.Round(float64(report.Qualified)*1000/float64(report.Referrals)) / 10
+	}
+	for _, period := range periods {
+		report.Trend = append(report.Trend, *byPeriod[period])
+	}
+
+	for _, referrer := range byReferrer {
+		report.TopReferrers = append(report.TopReferrers, *referrer)
+	}
+	sort.Slice(report.TopReferrers, func(i, j int) bool {
+		a, b := report.TopReferrers[i], report.TopReferrers[j]
+		if a.Qualified != b.Qualified {
+			return a.Qualified > b.Qualified
+		}
+		return a.Referrals > b.Referrals
+	})
+	if len(report.TopReferrers) > 10 {
+		report.TopReferrers = report.TopReferrers[:10]
+	}
+
+	if len(report.TopReferrers) > 0 {
+		ids := make([]uuid.UUID, len(report.TopReferrers))
+		for i, referrer := range report.TopReferrers {
+			ids[i] = referrer.CustomerID
+		}
+		var customers []models.Customer
+		if err := s.db.Scopes(WithDeleted).Select("id", "first_name", "last_name").Where("id IN ?", ids).Find(&customers).Error; err != nil {
+			return nil, fmt.Errorf("failed to load referrers: %w", err)
+		}
+		names := make(map[uuid.UUID]models.Customer, len(customers))
+		for _, customer := range customers {
+			names[customer.ID] = customer
+		}
+		for i := range report.TopReferrers {
+			customer := names[report.TopReferrers[i].CustomerID]
+			report.TopReferrers[i].FirstName = customer.FirstName
+			report.TopReferrers[i].LastName = customer.LastName
+		}
+	}
+	return report, nil
+}
+
+// Private helper methods
+
+// settle decides a pending referral on the new customer's first order and
+// rewards both customers when it qualifies. Later orders find nothing
+// pending.
+func (s *ReferralService) settle(customerID uuid.UUID, saleID, orderID *uuid.UUID, total models.Money, reference string) error {
+	var referral models.Referral
+	err := s.db.Where("referred_id = ? AND status = ?", customerID, models.ReferralStatusPending).First(&referral).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"sale_id":     saleID,
+		"order_id":    orderID,
+		"order_total": total,
+		"settled_at":  now,
+		"updated_at":  now,
+	}
+
+	minimum := models.NewMoney(s.config.MinFirstOrder)
+	lapse := ""
+	switch {
+	case now.After(referral.ExpiresAt):
+		lapse = "first order placed after the referral window closed"
+	case total < minimum:
+		lapse = fmt.Sprintf("first order came to less than %s", minimum)
+	}
+	if lapse != "" {
+		updates["status"] = models.ReferralStatusLapsed
+		updates["lapse_reason"] = lapse
+		return s.db.Model(&models.Referral{}).
+			Where("id = ? AND status = ?", referral.ID, models.ReferralStatusPending).
+			Updates(updates).Error
+	}
+
+	updates["status"] = models.ReferralStatusQualified
+	updates["reward_type"] = s.config.RewardType
+	referrerPoints, refereePoints := 0, 0
+	var referrerCredit, refereeCredit models.Money
+	if s.config.RewardType == "credit" {
+		referrerCredit, refereeCredit = models.NewMoney(s.config.ReferrerReward), models.NewMoney(s.config.RefereeReward)
+	} else {
+		referrerPoints, refereePoints = int(math.Round(s.config.ReferrerReward)), int(math.Round(s.config.RefereeReward))
+	}
+	updates["referrer_points"], updates["referee_points"] = referrerPoints, refereePoints
+	updates["referrer_credit"], updates["referee_credit"] = referrerCredit, refereeCredit
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Referral{}).
+			Where("id = ? AND status = ?", referral.ID, models.ReferralStatusPending).
+			Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		notes := "Referral, first order " + reference
+		if _, err := s.loyalty.GrantPoints(tx, referral.ReferrerID, models.LoyaltyReferralBonus, referral.ID, referrerPoints, notes); err != nil {
+			return err
+		}
+		if _, err := s.loyalty.GrantPoints(tx, referral.ReferredID, models.LoyaltyReferralWelcome, referral.ID, refereePoints, notes); err != nil {
+			return err
+		}
+		if _, err := s.loyalty.GrantCredit(tx, referral.ReferrerID, models.LoyaltyReferralBonus, referral.ID, referrerCredit, notes); err != nil {
+			return err
+		}
+		_, err := s.loyalty.GrantCredit(tx, referral.ReferredID, models.LoyaltyReferralWelcome, referral.ID, refereeCredit, notes)
+		return err
+	})
+}
+
+// hasBought reports whether a customer has completed a sale or received an
+// online order
+func (s *ReferralService) hasBought(customerID uuid.UUID) (bool, error) {
+	var sales int64
+	if err := s.db.Model(&models.Sale{}).Where("customer_id = ? AND status = ?", customerID, "completed").
+		Count(&sales).Error; err != nil {
+		return false, err
+	}
+	var orders int64
+	if err := s.db.Model(&models.OnlineOrder{}).
+		Where("customer_id = ? AND status IN ?", customerID, []models.OrderStatus{models.OrderStatusDelivered, models.OrderStatusPickedUp}).
+		Count(&orders).Error; err != nil {
+		return false, err
+	}
+	return sales+orders > 0, nil
+}
+
+// newReferralCode makes a code from the customer's first name and a random
+// suffix, e.g. MARIA-7K3Q
+func newReferralCode(firstName string) (string, error) {
+	var prefix strings.Builder
+	for _, r := range strings.ToUpper(firstName) {
+		if r >= 'A' && r <= 'Z' && prefix.Len() < 8 {
+			prefix.WriteRune(r)
+		}
+	}
+	if prefix.Len() == 0 {
+		prefix.WriteString("FRIEND")
+	}
+
+	suffix := make([]byte, 4)
+	for i := range suffix {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(referralCodeAlphabet))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate referral code: %w", err)
+		}
+		suffix[i] = referralCodeAlphabet[n.Int64()]
+	}
+	return prefix.String() + "-" + string(suffix), nil
+}
+
+func normalizeReferralCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Request/Response types
+
+type RecordReferralRequest struct {
+	Code string `json:"code" binding:"required,max=20"`
+}
+
+type CustomerReferrals struct {
+	Code         string            `json:"code"`
+	ReferredBy   *models.Referral  `json:"referred_by"`
+	Referrals    []models.Referral `json:"referrals"`
+	Qualified    int               `json:"qualified"`
+	PointsEarned int               `json:"points_earned"`
+	CreditEarned models.Money      `json:"credit_earned"`
+}
+
+type ReferralFilter struct {
+	Status     models.ReferralStatus
+	ReferrerID *uuid.UUID
+	Limit      int
+	Offset     int
+}
+
+type ReferralReportFilter struct {
+	From *time.Time
+	To   *time.Time
+}
+
+type ReferralReport struct {
+	From              *time.Time            `json:"from,omitempty"`
+	To                *time.Time            `json:"to,omitempty"`
+	Referrals         int                   `json:"referrals"`
+	Pending           int                   `json:"pending"`
+	Qualified         int                   `json:"qualified"`
+	Lapsed            int                   `json:"lapsed"`
+	ConversionRate    float64               `json:"conversion_rate"` // percent of referrals that qualified
+	FirstOrderRevenue models.Money          `json:"first_order_revenue"`
+	PointsAwarded     int                   `json:"points_awarded"`
+	CreditAwarded     models.Money          `json:"credit_awarded"`
+	Trend             []ReferralTrendPoint  `json:"trend"`
+	TopReferrers      []ReferrerPerformance `json:"top_referrers"`
+}
+
+type ReferralTrendPoint struct {
+	Period    string `json:"period"` // month
+	Referrals int    `json:"referrals"`
+	Qualified int    `json:"qualified"`
+}
+
+type ReferrerPerformance struct {
+	CustomerID        uuid.UUID    `json:"customer_id"`
+	FirstName         string       `json:"first_name"`
+	LastName          string       `json:"last_name"`
+	Code              string       `json:"code"`
+	Referrals         int          `json:"referrals"`
+	Qualified         int          `json:"qualified"`
+	FirstOrderRevenue models.Money `json:"first_order_revenue"`
+}
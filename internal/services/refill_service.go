@@ -0,0 +1,313 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var durationPattern = regexp.MustCompile(`(?i)(\d+)\s*(day|week|month)s?`)
+
+type RefillService struct {
+	db                 *gorm.DB
+	onlineOrderService *OnlineOrderService
+	communications     *CommunicationService
+	config             config.RefillConfig
+}
+
+func NewRefillService(db *gorm.DB, onlineOrderService *OnlineOrderService, communications *CommunicationService, cfg config.RefillConfig) *RefillService {
+	return &RefillService{
+		db:                 db,
+		onlineOrderService: onlineOrderService,
+		communications:     communications,
+		config:             cfg,
+	}
+}
+
+// RecordSaleRefills schedules refills for the items of a completed sale
+func (s *RefillService) RecordSaleRefills(ctx context.Context, sale *models.Sale) error {
+	if sale.CustomerID == nil {
+		return nil
+	}
+	for _, item := range sale.SaleItems {
+		if item.ProductID == nil {
+			continue
+		}
+		daysSupply := resolveDaysSupply(item.DaysSupply, item.Duration)
+		if daysSupply == 0 {
+			continue
+		}
+		itemID := item.ID
+		if err := s.schedule(*sale.CustomerID, *item.ProductID, item.Quantity, daysSupply, &itemID, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordOrderRefills schedules refills for the items of a fulfilled online order
+func (s *RefillService) RecordOrderRefills(ctx context.Context, orderID uuid.UUID) error {
+	var order models.OnlineOrder
+	if err := s.db.Preload("OrderItems").First(&order, orderID).Error; err != nil {
+		return fmt.Errorf("order not found: %w", err)
+	}
+	if order.CustomerID == nil {
+		return nil
+	}
+	for _, item := range order.OrderItems {
+		daysSupply := resolveDaysSupply(item.DaysSupply, item.Duration)
+		if daysSupply == 0 {
+			continue
+		}
+		itemID := item.ID
+		if err := s.schedule(*order.CustomerID, item.ProductID, item.Quantity, daysSupply, nil, &itemID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetUpcomingRefills lists open refills due within the given number of days,
+// soonest first. Overdue refills are included.
+func (s *RefillService) GetUpcomingRefills(ctx context.Context, withinDays, limit, offset int) ([]models.Refill, int64, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, withinDays)
+	query := s.db.WithContext(ctx).Model(&models.Refill{}).
+		Where("status IN ?", []models.RefillStatus{models.RefillStatusScheduled, models.RefillStatusReminded}).
+		Where("due_date <= ?", cutoff)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var refills []models.Refill
+	err := query.Preload("Customer", WithDeleted).Preload("Product", WithDeleted).
+		Order("due_date ASC").Limit(limit).Offset(offset).
+		Find(&refills).Error
+	return refills, total, err
+}
+
+// GetCustomerRefills lists a customer's refills, most recently dispensed first
+func (s *RefillService) GetCustomerRefills(ctx context.Context, customerID uuid.UUID) ([]models.Refill, error) {
+	var refills []models.Refill
+	err := s.db.Preload("Product", WithDeleted).
+		Where("customer_id = ?", customerID).
+		Order("dispensed_at DESC").
+		Find(&refills).Error
+	return refills, err
+}
+
+// CancelRefill stops reminders for a refill, e.g. when therapy has ended
+func (s *RefillService) CancelRefill(ctx context.Context, id uuid.UUID) error {
+	result := s.db.Model(&models.Refill{}).
+		Where("id = ? AND status IN ?", id, []models.RefillStatus{models.RefillStatusScheduled, models.RefillStatusReminded}).
+		Updates(map[string]interface{}{
+			"status":     models.RefillStatusCancelled,
+			"updated_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to cancel refill: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("refill not found or already closed")
+	}
+	return nil
+}
+
+// SendDueReminders notifies targeted customers whose refills fall due within
+// the configured window. Each refill is reminded once. It returns the number
+// of reminders sent.
+func (s *RefillService) SendDueReminders(ctx context.Context, targeting query.Targeting) (int, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, s.config.ReminderDaysAhead)
+
+	var refills []models.Refill
+	query := s.db.Preload("Customer", WithDeleted).Preload("Product", WithDeleted).
+		Where("status = ? AND due_date <= ?", models.RefillStatusScheduled, cutoff)
+	if err := targeting.Apply(query, "refills.customer_id").Find(&refills).Error; err != nil {
+		return 0, fmt.Errorf("failed to load due refills: %w", err)
+	}
+
+	sent := 0
+	for _, refill := range refills {
+		if refill.Customer == nil || refill.Product == nil {
+			continue
+		}
+
+		subject := fmt.Sprintf("Time to refill your %s", refill.Product.Name)
+		body := fmt.Sprintf("Hi %s, your %s is due for a refill on %s. Reorder in one tap: %s",
+			refill.Customer.FirstName, refill.Product.Name, refill.DueDate.Format("Jan 2"), s.ReorderLink(refill))
+		sms := &SMSText{
+			Template: SMSTemplateRefillReminder,
+			Data: map[string]string{
+				"first_name":   refill.Customer.FirstName,
+				"product":      refill.Product.Name,
+				"due_date":     refill.DueDate.Format("Jan 2"),
+				"reorder_link": s.ReorderLink(refill),
+			},
+		}
+		channel, err := s.communications.NotifyCustomerWithTemplate(ctx, refill.Customer, models.PurposeReminders, subject, body, MessageTemplates{SMS: sms})
+		if errors.Is(err, ErrNotificationSuppressed) {
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("refill_id", refill.ID).Warn("Failed to send refill reminder")
+			continue
+		}
+
+		now := time.Now().UTC()
+		if err := s.db.Model(&refill).Updates(map[string]interface{}{
+			"status":           models.RefillStatusReminded,
+			"reminded_at":      now,
+			"reminder_channel": channel,
+			"updated_at":       now,
+		}).Error; err != nil {
+			return sent, fmt.Errorf("failed to update refill: %w", err)
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// RunReminders sends due reminders on the configured interval until ctx is done
+func (s *RefillService) RunReminders(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReminderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if sent, err := s.SendDueReminders(lifecycle.WorkContext(ctx), query.Targeting{}); err != nil {
+				logrus.WithError(err).Error("Refill reminder run failed")
+			} else if sent > 0 {
+				logrus.WithField("sent", sent).Info("Refill reminders sent")
+			}
+		}
+	}
+}
+
+// ReorderLink returns the one-tap reorder URL for a refill
+func (s *RefillService) ReorderLink(refill models.Refill) string {
+	return strings.TrimRight(s.config.ReorderBaseURL, "/") + "/" + refill.ReorderToken
+}
+
+// Reorder adds the refilled product to the customer's cart using a reorder
+// token from a reminder
+func (s *RefillService) Reorder(ctx context.Context, token string) (*models.ShoppingCart, *models.Refill, error) {
+	var refill models.Refill
+	if err := s.db.Where("reorder_token = ?", token).First(&refill).Error; err != nil {
+		return nil, nil, fmt.Errorf("refill not found: %w", err)
+	}
+	if !refill.Status.IsOpen() {
+		return nil, nil, fmt.Errorf("refill has already been %s", refill.Status)
+	}
+
+	cartItem, err := s.onlineOrderService.AddToCart(ctx, AddToCartRequest{
+		CustomerID: &refill.CustomerID,
+		ProductID:  refill.ProductID,
+		Quantity:   refill.Quantity,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	refill.Status = models.RefillStatusReordered
+	refill.ReorderedAt = &now
+	if err := s.db.Save(&refill).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to update refill: %w", err)
+	}
+
+	return cartItem, &refill, nil
+}
+
+// Private helper methods
+
+func (s *RefillService) schedule(customerID, productID uuid.UUID, quantity, daysSupply int, saleItemID, orderItemID *uuid.UUID) error {
+	now := time.Now().UTC()
+
+	// A new dispense of the same product supersedes any open refill
+	if err := s.db.Model(&models.Refill{}).
+		Where("customer_id = ? AND product_id = ? AND status IN ?", customerID, productID,
+			[]models.RefillStatus{models.RefillStatusScheduled, models.RefillStatusReminded}).
+		Updates(map[string]interface{}{
+			"status":     models.RefillStatusFilled,
+			"updated_at": now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to close previous refills: %w", err)
+	}
+
+	token, err := generateReorderToken()
+	if err != nil {
+		return err
+	}
+
+	refill := &models.Refill{
+		CustomerID:   customerID,
+		ProductID:    productID,
+		SaleItemID:   saleItemID,
+		OrderItemID:  orderItemID,
+		Quantity:     quantity,
+		DaysSupply:   daysSupply,
+		DispensedAt:  now,
+		DueDate:      now.AddDate(0, 0, daysSupply),
+		Status:       models.RefillStatusScheduled,
+		ReorderToken: token,
+	}
+	if err := s.db.Create(refill).Error; err != nil {
+		return fmt.Errorf("failed to schedule refill: %w", err)
+	}
+	return nil
+}
+
+// resolveDaysSupply prefers the explicit days supply and falls back to
+// parsing free-text durations such as "30 days" or "2 weeks"
+func resolveDaysSupply(daysSupply *int, duration *string) int {
+	if daysSupply != nil && *daysSupply > 0 {
+		return *daysSupply
+	}
+	if duration == nil {
+		return 0
+	}
+
+	match := durationPattern.FindStringSubmatch(*duration)
+	if match == nil {
+		return 0
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(match[2]) {
+	case "week":
+		return n * 7
+	case "month":
+		return n * 30
+	}
+	return n
+}
+
+func generateReorderToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate reorder token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrSaleRefunded = errors.New("the sale has already been refunded")
+
+// RefundService refunds sales made at the till. A refund is of the whole
+// sale: its products go back into stock at the branch they were sold from
+// and it drops out of takings, purchase history and the medication
+// profile. Compounded preparations and services can't be put back, so
+// they are refunded without a stock movement.
+type RefundService struct {
+	db     *gorm.DB
+	stock  *StockService
+	outbox *OutboxService
+}
+
+func NewRefundService(db *gorm.DB, stock *StockService) *RefundService {
+	return &RefundService{db: db, stock: stock}
+}
+
+// SetOutbox sends refunds to the webhook subscribers
+func (s *RefundService) SetOutbox(outbox *OutboxService) {
+	s.outbox = outbox
+}
+
+// RefundSale refunds a completed sale and restocks its products in one
+// transaction. It fails with ErrSaleRefunded when the sale was refunded
+// already, however many tills try at once, and ErrSaleNotCompleted when it
+// is in any other state. The stock movements are returned for the caller to
+// announce.
+func (s *RefundService) RefundSale(ctx context.Context, saleID uuid.UUID, req RefundSaleRequest, userID uuid.UUID) (*models.Sale, []*models.StockMovement, error) {
+	var sale models.Sale
+	var movements []*models.StockMovement
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only the first refund gets past the update; the others see it
+		// already set
+		now := time.Now()
+		result := tx.Model(&models.Sale{}).
+			Where("id = ? AND status = ? AND refunded_at IS NULL", saleID, "completed").
+			Updates(map[string]interface{}{
+				"status":        "refunded",
+				"refunded_at":   now,
+				"refund_reason": req.Reason,
+				"updated_by":    userID,
+			})
+		if result.Error != nil {
+			return fmt.Errorf("failed to refund sale: %w", result.Error)
+		}
+		if err := tx.Preload("SaleItems").First(&sale, "id = ?", saleID).Error; err != nil {
+			return fmt.Errorf("sale: %w", err)
+		}
+		if result.RowsAffected == 0 {
+			if sale.RefundedAt != nil {
+				return ErrSaleRefunded
+			}
+			return ErrSaleNotCompleted
+		}
+
+		for _, item := range sale.SaleItems {
+			if item.ProductID == nil {
+				continue
+			}
+			movement, err := s.stock.Apply(tx, StockChange{
+				ProductID: *item.ProductID,
+				BranchID:  sale.BranchID,
+				Quantity:  item.Quantity,
+				Type:      models.MovementTypeReturn,
+				Reason:    "Refund",
+				Reference: &sale.SaleNumber,
+				UserID:    &userID,
+				Notes:     req.Reason,
+			})
+			if err != nil {
+				return err
+			}
+			movements = append(movements, movement)
+		}
+
+		if s.outbox == nil {
+			return nil
+		}
+		return s.outbox.QueueWebhook(tx, "sale.refunded", map[string]interface{}{
+			"sale_id":        sale.ID,
+			"sale_number":    sale.SaleNumber,
+			"invoice_number": sale.InvoiceNumber,
+			"total":          sale.Total,
+			"customer_id":    sale.CustomerID,
+			"reason":         req.Reason,
+		})
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &sale, movements, nil
+}
+
+// Request/Response types
+
+type RefundSaleRequest struct {
+	Reason string `json:"reason" binding:"required,max=2000"`
+}
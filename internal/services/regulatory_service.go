@@ -0,0 +1,715 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRegistration is returned for a registration number that is
+	// not in the FDA's format
+	ErrInvalidRegistration = errors.New("invalid FDA registration number")
+	// ErrRegistryUnavailable is returned when no registry dataset URL is
+	// configured
+	ErrRegistryUnavailable = errors.New("no FDA registry dataset configured")
+	// ErrRegistryEmpty is returned for a dataset without any usable rows,
+	// which would otherwise empty the cache
+	ErrRegistryEmpty = errors.New("FDA registry dataset has no registrations")
+)
+
+// registrationPattern matches FDA certificate of product registration
+// numbers such as DR-XY12345, DRP-1234-01, FR-4000001234567 or HRP-000-123
+var registrationPattern = regexp.MustCompile(`^[A-Z]{2,5}-[A-Z0-9][A-Z0-9-]{2,}$`)
+
+// registryBatchSize is how many registrations are written per upsert
+const registryBatchSize = 500
+
+// registryColumns maps normalized CSV header names to registration fields.
+// Headers are compared lower-cased with everything but letters and digits
+// removed, so "Registration Number" and "REGISTRATION_NO." both match.
+var registryColumns = map[string]string{
+	"registrationnumber":        "registration_number",
+	"registrationno":            "registration_number",
+	"regno":                     "registration_number",
+	"genericname":               "generic_name",
+	"brandname":                 "brand_name",
+	"dosagestrength":            "dosage_strength",
+	"dosageform":                "dosage_form",
+	"classification":            "classification",
+	"manufacturer":              "manufacturer",
+	"countryoforigin":           "country",
+	"country":                   "country",
+	"traderimporterdistributor": "distributor",
+	"distributor":               "distributor",
+	"issuancedate":              "issued_at",
+	"dateissued":                "issued_at",
+	"expirydate":                "expires_at",
+	"expirationdate":            "expires_at",
+	"validuntil":                "expires_at",
+}
+
+// recallColumns maps normalized CSV header names to recall fields
+var recallColumns = map[string]string{
+	"registrationnumber": "registration_number",
+	"registrationno":     "registration_number",
+	"regno":              "registration_number",
+	"batchnumber":        "batch_number",
+	"batchno":            "batch_number",
+	"lotnumber":          "batch_number",
+	"lotno":              "batch_number",
+	"advisory":           "advisory",
+	"advisoryno":         "advisory",
+	"reason":             "reason",
+	"dateissued":         "issued_at",
+	"issuancedate":       "issued_at",
+	"date":               "issued_at",
+}
+
+var headerCleanup = regexp.MustCompile(`[^a-z0-9]+`)
+
+// RegulatoryService keeps a local copy of the FDA Philippines
+// registered-products dataset and checks product registration numbers
+// against it and against recalls
+type RegulatoryService struct {
+	db     *gorm.DB
+	client *http.Client
+	config config.FDAConfig
+}
+
+func NewRegulatoryService(db *gorm.DB, cfg config.FDAConfig) *RegulatoryService {
+	return &RegulatoryService{
+		db:     db,
+		client: &http.Client{Timeout: cfg.Timeout},
+		config: cfg,
+	}
+}
+
+// Enabled reports whether the registry can be refreshed from the FDA
+// dataset, rather than only by import
+func (s *RegulatoryService) Enabled() bool {
+	return s.config.RegistryURL != ""
+}
+
+// CheckProduct normalizes the product's registration number and sets its
+// regulatory status. Only a malformed number is an error; a number that is
+// unregistered, expired or recalled is saved with the product and flagged.
+func (s *RegulatoryService) CheckProduct(ctx context.Context, product *models.Product) error {
+	loaded, err := s.registryLoaded(ctx)
+	if err != nil {
+		return err
+	}
+
+	number, err := NormalizeRegistrationNumber(product.FDARegistrationNumber)
+	if err != nil {
+		return err
+	}
+	product.FDARegistrationNumber = number
+
+	status, err := s.assess(ctx, loaded, product.ProductType, number, product.BatchNumber)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	product.RegulatoryStatus = status
+	product.RegulatoryCheckedAt = &now
+	return nil
+}
+
+// ProductStatus returns the product's registration, the registry entry and
+// recalls for it, and what that means for selling it
+func (s *RegulatoryService) ProductStatus(ctx context.Context, productID uuid.UUID) (*ProductRegulatoryStatus, error) {
+	var product models.Product
+	if err := s.db.WithContext(ctx).First(&product, "id = ?", productID).Error; err != nil {
+		return nil, fmt.Errorf("product: %w", err)
+	}
+
+	view := &ProductRegulatoryStatus{
+		ProductID:          product.ID,
+		Name:               product.Name,
+		RegistrationNumber: product.FDARegistrationNumber,
+		Status:             product.RegulatoryStatus,
+		Flagged:            product.RegulatoryStatus.Flagged(),
+		CheckedAt:          product.RegulatoryCheckedAt,
+		Recalls:            []models.FDARecall{},
+	}
+
+	var latest models.FDARegistration
+	err := s.db.WithContext(ctx).Select("refreshed_at").Order("refreshed_at DESC").Take(&latest).Error
+	if err == nil {
+		view.RegistryRefreshedAt = &latest.RefreshedAt
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load registry: %w", err)
+	}
+
+	if product.FDARegistrationNumber != nil {
+		var registration models.FDARegistration
+		err := s.db.WithContext(ctx).First(&registration, "registration_number = ?", *product.FDARegistrationNumber).Error
+		if err == nil {
+			view.Registration = &registration
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("failed to load registration: %w", err)
+		}
+
+		if err := s.db.WithContext(ctx).
+			Where("registration_number = ?", *product.FDARegistrationNumber).
+			Order("issued_at DESC, created_at DESC").
+			Find(&view.Recalls).Error; err != nil {
+			return nil, fmt.Errorf("failed to load recalls: %w", err)
+		}
+	}
+
+	view.Reason = regulatoryReason(product.RegulatoryStatus, view.Registration)
+	return view, nil
+}
+
+// RefreshRegistry downloads the registry dataset and the recalls list,
+// replaces the local copy with them, and rechecks every product
+func (s *RegulatoryService) RefreshRegistry(ctx context.Context) (*RegistryRefreshResult, error) {
+	if !s.Enabled() {
+		return nil, ErrRegistryUnavailable
+	}
+
+	body, err := s.download(ctx, s.config.RegistryURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download FDA registry: %w", err)
+	}
+	defer body.Close()
+
+	result, err := s.importRegistry(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.config.RecallsURL != "" {
+		recalls, err := s.download(ctx, s.config.RecallsURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download FDA recalls: %w", err)
+		}
+		defer recalls.Close()
+
+		if result.Recalls, err = s.replaceFeedRecalls(ctx, recalls); err != nil {
+			return nil, err
+		}
+	}
+
+	if result.Flagged, err = s.ReflagProducts(ctx); err != nil {
+		return nil, err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"imported": result.Imported,
+		"removed":  result.Removed,
+		"recalls":  result.Recalls,
+		"flagged":  result.Flagged,
+	}).Info("Refreshed FDA registry")
+	return result, nil
+}
+
+// ImportRegistry replaces the local copy of the registry with an uploaded
+// export of the dataset and rechecks every product
+func (s *RegulatoryService) ImportRegistry(ctx context.Context, r io.Reader) (*RegistryRefreshResult, error) {
+	result, err := s.importRegistry(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	if result.Flagged, err = s.ReflagProducts(ctx); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ReflagProducts rechecks every product with the registry and recalls and
+// returns how many are flagged
+func (s *RegulatoryService) ReflagProducts(ctx context.Context) (int, error) {
+	loaded, err := s.registryLoaded(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	flagged := 0
+	now := time.Now()
+	var products []models.Product
+	err = s.db.WithContext(ctx).Model(&models.Product{}).
+		Select("id", "product_type", "fda_registration_number", "batch_number", "regulatory_status").
+		FindInBatches(&products, registryBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, product := range products {
+				status, err := s.assess(ctx, loaded, product.ProductType, product.FDARegistrationNumber, product.BatchNumber)
+				if err != nil {
+					// Numbers saved before they were validated
+					status = models.RegulatoryUnregistered
+				}
+				if status.Flagged() {
+					flagged++
+				}
+				if err := s.db.WithContext(ctx).Model(&models.Product{}).Where("id = ?", product.ID).
+					UpdateColumns(map[string]interface{}{
+						"regulatory_status":     status,
+						"regulatory_checked_at": now,
+					}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to recheck products: %w", err)
+	}
+	return flagged, nil
+}
+
+// SearchRegistry finds registrations by number, generic or brand name
+func (s *RegulatoryService) SearchRegistry(ctx context.Context, query string, limit, offset int) ([]models.FDARegistration, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	db := s.db.WithContext(ctx).Model(&models.FDARegistration{})
+	if query = strings.TrimSpace(query); query != "" {
+		pattern := "%" + strings.ToLower(query) + "%"
+		db = db.Where("LOWER(registration_number) LIKE ? OR LOWER(generic_name) LIKE ? OR LOWER(brand_name) LIKE ?", pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count registrations: %w", err)
+	}
+
+	var registrations []models.FDARegistration
+	if err := db.Order("brand_name ASC, registration_number ASC").Limit(limit).Offset(offset).Find(&registrations).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search registry: %w", err)
+	}
+	return registrations, total, nil
+}
+
+// FlaggedProducts lists the products that are unregistered, expired,
+// recalled or missing a registration
+func (s *RegulatoryService) FlaggedProducts(ctx context.Context, limit, offset int) ([]models.Product, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	statuses := []models.RegulatoryStatus{
+		models.RegulatoryRecalled, models.RegulatoryUnregistered,
+		models.RegulatoryExpired, models.RegulatoryMissing,
+	}
+	db := s.db.WithContext(ctx).Model(&models.Product{}).Where("regulatory_status IN ?", statuses)
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count flagged products: %w", err)
+	}
+
+	var products []models.Product
+	if err := db.Order("regulatory_status ASC, name ASC").Limit(limit).Offset(offset).Find(&products).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load flagged products: %w", err)
+	}
+	return products, total, nil
+}
+
+// ListRecalls returns the recalls, newest first, optionally for one
+// registration number
+func (s *RegulatoryService) ListRecalls(ctx context.Context, registrationNumber string) ([]models.FDARecall, error) {
+	db := s.db.WithContext(ctx)
+	if registrationNumber != "" {
+		db = db.Where("registration_number = ?", strings.ToUpper(strings.TrimSpace(registrationNumber)))
+	}
+
+	var recalls []models.FDARecall
+	if err := db.Order("issued_at DESC, created_at DESC").Find(&recalls).Error; err != nil {
+		return nil, fmt.Errorf("failed to load recalls: %w", err)
+	}
+	return recalls, nil
+}
+
+// CreateRecall records a recall from an FDA advisory and flags the
+// products it covers
+func (s *RegulatoryService) CreateRecall(ctx context.Context, req CreateRecallRequest, createdBy uuid.UUID) (*models.FDARecall, error) {
+	number, err := NormalizeRegistrationNumber(&req.RegistrationNumber)
+	if err != nil || number == nil {
+		return nil, ErrInvalidRegistration
+	}
+
+	recall := models.FDARecall{
+		RegistrationNumber: *number,
+		BatchNumber:        strings.TrimSpace(req.BatchNumber),
+		Advisory:           strings.TrimSpace(req.Advisory),
+		Reason:             strings.TrimSpace(req.Reason),
+		Source:             models.RecallSourceManual,
+		CreatedBy:          &createdBy,
+	}
+	if req.IssuedAt != nil {
+		issued := req.IssuedAt.Time
+		recall.IssuedAt = &issued
+	}
+	if err := s.db.WithContext(ctx).Create(&recall).Error; err != nil {
+		return nil, fmt.Errorf("failed to create recall: %w", err)
+	}
+
+	if _, err := s.ReflagProducts(ctx); err != nil {
+		return nil, err
+	}
+	return &recall, nil
+}
+
+// DeleteRecall removes a manually entered recall, e.g. one entered by
+// mistake or lifted by the FDA, and rechecks the products it covered
+func (s *RegulatoryService) DeleteRecall(ctx context.Context, id uuid.UUID) (*models.FDARecall, error) {
+	var recall models.FDARecall
+	if err := s.db.WithContext(ctx).First(&recall, "id = ? AND source = ?", id, models.RecallSourceManual).Error; err != nil {
+		return nil, fmt.Errorf("recall: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&recall).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete recall: %w", err)
+	}
+
+	if _, err := s.ReflagProducts(ctx); err != nil {
+		return nil, err
+	}
+	return &recall, nil
+}
+
+// NormalizeRegistrationNumber upper-cases and trims a registration number,
+// returning nil for a blank one and ErrInvalidRegistration for one that is
+// not in the FDA's format
+func NormalizeRegistrationNumber(number *string) (*string, error) {
+	if number == nil {
+		return nil, nil
+	}
+	normalized := strings.ToUpper(strings.Join(strings.Fields(*number), ""))
+	if normalized == "" {
+		return nil, nil
+	}
+	if !registrationPattern.MatchString(normalized) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRegistration, *number)
+	}
+	return &normalized, nil
+}
+
+// Private helper methods
+
+// assess works out a product's status. Recalls apply even before a
+// registry has been loaded; whether a number is registered can only be
+// told once one has.
+func (s *RegulatoryService) assess(ctx context.Context, loaded bool, productType models.ProductType, number *string, batch string) (models.RegulatoryStatus, error) {
+	if number == nil || *number == "" {
+		if productType == models.ProductTypeGrocery {
+			return models.RegulatoryUnchecked, nil
+		}
+		return models.RegulatoryMissing, nil
+	}
+	if !registrationPattern.MatchString(*number) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidRegistration, *number)
+	}
+
+	var recalls int64
+	if err := s.db.WithContext(ctx).Model(&models.FDARecall{}).
+		Where("registration_number = ? AND (batch_number = '' OR batch_number = ?)", *number, batch).
+		Count(&recalls).Error; err != nil {
+		return "", fmt.Errorf("failed to check recalls: %w", err)
+	}
+	if recalls > 0 {
+		return models.RegulatoryRecalled, nil
+	}
+
+	if !loaded {
+		return models.RegulatoryUnchecked, nil
+	}
+
+	var registration models.FDARegistration
+	err := s.db.WithContext(ctx).Select("expires_at").First(&registration, "registration_number = ?", *number).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.RegulatoryUnregistered, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check registration: %w", err)
+	}
+	if registration.ExpiresAt != nil && registration.ExpiresAt.Before(time.Now()) {
+		return models.RegulatoryExpired, nil
+	}
+	return models.RegulatoryRegistered, nil
+}
+
+func (s *RegulatoryService) registryLoaded(ctx context.Context) (bool, error) {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.FDARegistration{}).Limit(1).Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check registry: %w", err)
+	}
+	return count > 0, nil
+}
+
+func (s *RegulatoryService) download(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// importRegistry upserts every row of the dataset, then removes the
+// registrations it no longer lists
+func (s *RegulatoryService) importRegistry(ctx context.Context, r io.Reader) (*RegistryRefreshResult, error) {
+	reader, columns, err := openDatasetCSV(r, registryColumns)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := columns["registration_number"]; !ok {
+		return nil, fmt.Errorf("%w: no registration number column", ErrRegistryEmpty)
+	}
+
+	started := time.Now().UTC()
+	result := &RegistryRefreshResult{RefreshedAt: started}
+	seen := make(map[string]bool)
+	batch := make([]models.FDARegistration, 0, registryBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		onConflict := clause.OnConflict{
+			Columns: []clause.Column{{Name: "registration_number"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"generic_name", "brand_name", "dosage_strength", "dosage_form", "classification",
+				"manufacturer", "country", "distributor", "issued_at", "expires_at", "refreshed_at", "updated_at",
+			}),
+		}
+		if err := s.db.WithContext(ctx).Clauses(onConflict).Create(&batch).Error; err != nil {
+			return fmt.Errorf("failed to save registrations: %w", err)
+		}
+		result.Imported += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read FDA registry: %w", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		number := strings.ToUpper(strings.Join(strings.Fields(field("registration_number")), ""))
+		if !registrationPattern.MatchString(number) || seen[number] {
+			result.Skipped++
+			continue
+		}
+		seen[number] = true
+
+		batch = append(batch, models.FDARegistration{
+			RegistrationNumber: number,
+			GenericName:        truncate(field("generic_name"), 500),
+			BrandName:          truncate(field("brand_name"), 255),
+			DosageStrength:     truncate(field("dosage_strength"), 255),
+			DosageForm:         truncate(field("dosage_form"), 255),
+			Classification:     truncate(field("classification"), 100),
+			Manufacturer:       truncate(field("manufacturer"), 500),
+			Country:            truncate(field("country"), 100),
+			Distributor:        truncate(field("distributor"), 500),
+			IssuedAt:           parseDatasetDate(field("issued_at")),
+			ExpiresAt:          parseDatasetDate(field("expires_at")),
+			RefreshedAt:        started,
+		})
+		if len(batch) == registryBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	// A truncated or empty download must not wipe out the cache
+	if result.Imported == 0 {
+		return nil, ErrRegistryEmpty
+	}
+
+	removed := s.db.WithContext(ctx).Unscoped().Where("refreshed_at < ?", started).Delete(&models.FDARegistration{})
+	if removed.Error != nil {
+		return nil, fmt.Errorf("failed to remove old registrations: %w", removed.Error)
+	}
+	result.Removed = int(removed.RowsAffected)
+	return result, nil
+}
+
+// replaceFeedRecalls swaps the recalls from the previous download for the
+// ones in this one, leaving those entered by staff alone
+func (s *RegulatoryService) replaceFeedRecalls(ctx context.Context, r io.Reader) (int, error) {
+	reader, columns, err := openDatasetCSV(r, recallColumns)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := columns["registration_number"]; !ok {
+		return 0, errors.New("FDA recalls have no registration number column")
+	}
+
+	var recalls []models.FDARecall
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read FDA recalls: %w", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		number := strings.ToUpper(strings.Join(strings.Fields(field("registration_number")), ""))
+		if !registrationPattern.MatchString(number) {
+			continue
+		}
+		recalls = append(recalls, models.FDARecall{
+			RegistrationNumber: number,
+			BatchNumber:        truncate(field("batch_number"), 100),
+			Advisory:           truncate(field("advisory"), 255),
+			Reason:             field("reason"),
+			IssuedAt:           parseDatasetDate(field("issued_at")),
+			Source:             models.RecallSourceFeed,
+		})
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("source = ?", models.RecallSourceFeed).Delete(&models.FDARecall{}).Error; err != nil {
+			return err
+		}
+		if len(recalls) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&recalls, registryBatchSize).Error
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to save FDA recalls: %w", err)
+	}
+	return len(recalls), nil
+}
+
+// openDatasetCSV reads the header row and returns the column index of each
+// known field
+func openDatasetCSV(r io.Reader, known map[string]string) (*csv.Reader, map[string]int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, ErrRegistryEmpty
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		key := headerCleanup.ReplaceAllString(strings.ToLower(name), "")
+		if field, ok := known[key]; ok {
+			if _, taken := columns[field]; !taken {
+				columns[field] = i
+			}
+		}
+	}
+	return reader, columns, nil
+}
+
+func parseDatasetDate(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	for _, layout := range append(importDateLayouts, "2006-01-02 15:04:05", "02-Jan-2006", "02-Jan-06") {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
+
+func regulatoryReason(status models.RegulatoryStatus, registration *models.FDARegistration) string {
+	switch status {
+	case models.RegulatoryRegistered:
+		return "Registered with the FDA"
+	case models.RegulatoryUnregistered:
+		return "The registration number is not in the FDA registry"
+	case models.RegulatoryExpired:
+		if registration != nil && registration.ExpiresAt != nil {
+			return fmt.Sprintf("The registration expired on %s", registration.ExpiresAt.Format("2006-01-02"))
+		}
+		return "The registration has expired"
+	case models.RegulatoryRecalled:
+		return "The product or its batch is under an FDA recall"
+	case models.RegulatoryMissing:
+		return "The drug has no FDA registration number"
+	}
+	return "Not checked against the FDA registry"
+}
+
+// Request/Response types
+
+type ProductRegulatoryStatus struct {
+	ProductID           uuid.UUID               `json:"product_id"`
+	Name                string                  `json:"name"`
+	RegistrationNumber  *string                 `json:"fda_registration_number"`
+	Status              models.RegulatoryStatus `json:"regulatory_status"`
+	Flagged             bool                    `json:"flagged"`
+	Reason              string                  `json:"reason"`
+	Registration        *models.FDARegistration `json:"registration,omitempty"`
+	Recalls             []models.FDARecall      `json:"recalls"`
+	CheckedAt           *time.Time              `json:"checked_at,omitempty"`
+	RegistryRefreshedAt *time.Time              `json:"registry_refreshed_at,omitempty"`
+}
+
+type RegistryRefreshResult struct {
+	Imported    int       `json:"imported"`
+	Skipped     int       `json:"skipped"`
+	Removed     int       `json:"removed"`
+	Recalls     int       `json:"recalls"`
+	Flagged     int       `json:"flagged"`
+	RefreshedAt time.Time `json:"refreshed_at"`
+}
+
+type CreateRecallRequest struct {
+	RegistrationNumber string             `json:"registration_number" binding:"required"`
+	BatchNumber        string             `json:"batch_number" binding:"max=100"`
+	Advisory           string             `json:"advisory" binding:"required,max=255"`
+	Reason             string             `json:"reason"`
+	IssuedAt           *models.CustomDate `json:"issued_at"`
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SalesAnalyticsService totals completed sales for the analytics page: the
+// takings, the products and services they came from, and how they compare
+// with the period before
+type SalesAnalyticsService struct {
+	db *gorm.DB
+}
+
+func NewSalesAnalyticsService(db *gorm.DB) *SalesAnalyticsService {
+	return &SalesAnalyticsService{db: db}
+}
+
+// Report totals completed sales in [from, to), limited to branchID when
+// set. Growth is against the period of the same length just before from,
+// and is zero when nothing was sold then.
+func (s *SalesAnalyticsService) Report(ctx context.Context, branchID *uuid.UUID, from, to time.Time) (*SalesAnalytics, error) {
+	report := &SalesAnalytics{From: from, To: to}
+
+	current, err := s.totals(ctx, branchID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.totals(ctx, branchID, from.Add(-to.Sub(from)), from)
+	if err != nil {
+		return nil, err
+	}
+	report.TotalOrders = current.SaleCount
+	report.TotalRevenue = current.Revenue
+	report.TotalDiscounts = current.Discounts
+	report.AverageOrderValue = current.averageSale()
+	report.RevenueGrowth = percentChange(previous.Revenue.Float64(), current.Revenue.Float64())
+	report.OrderGrowth = percentChange(float64(previous.SaleCount), float64(current.SaleCount))
+	report.AOVChange = percentChange(previous.averageSale().Float64(), report.AverageOrderValue.Float64())
+
+	if err := s.sales(ctx, branchID, from, to).
+		Select("DATE(created_at) AS date, COUNT(*) AS orders, COALESCE(SUM(total), 0) AS revenue").
+		Group("DATE(created_at)").Order("date ASC").
+		Scan(&report.DailySales).Error; err != nil {
+		return nil, fmt.Errorf("failed to total daily sales: %w", err)
+	}
+
+	if err := s.items(ctx, branchID, from, to).
+		Select("products.id AS product_id, products.name, products.category, " +
+			"SUM(sale_items.quantity) AS units_sold, SUM(sale_items.total_price) AS revenue").
+		Joins("JOIN products ON products.id = sale_items.product_id").
+		Group("products.id, products.name, products.category").
+		Order("revenue DESC").
+		Scan(&report.ProductPerformance).Error; err != nil {
+		return nil, fmt.Errorf("failed to total product sales: %w", err)
+	}
+	if err := s.items(ctx, branchID, from, to).
+		Select("services.id AS service_id, services.name, services.category, " +
+			"SUM(sale_items.quantity) AS quantity, SUM(sale_items.total_price) AS revenue").
+		Joins("JOIN services ON services.id = sale_items.service_id").
+		Group("services.id, services.name, services.category").
+		Order("revenue DESC").
+		Scan(&report.ServicePerformance).Error; err != nil {
+		return nil, fmt.Errorf("failed to total service sales: %w", err)
+	}
+
+	for _, total := range report.ProductPerformance {
+		report.ProductRevenue += total.Revenue
+	}
+	for _, total := range report.ServicePerformance {
+		report.ServiceRevenue += total.Revenue
+	}
+	return report, nil
+}
+
+// Private helper methods
+
+type salesTotals struct {
+	SaleCount int64
+	Revenue   models.Money
+	Discounts models.Money
+}
+
+func (t salesTotals) averageSale() models.Money {
+	if t.SaleCount == 0 {
+		return 0
+	}
+	return t.Revenue.MulRate(1 / float64(t.SaleCount))
+}
+
+func (s *SalesAnalyticsService) totals(ctx context.Context, branchID *uuid.UUID, from, to time.Time) (salesTotals, error) {
+	var totals salesTotals
+	if err := s.sales(ctx, branchID, from, to).
+		Select("COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS revenue, COALESCE(SUM(discount), 0) AS discounts").
+		Scan(&totals).Error; err != nil {
+		return totals, fmt.Errorf("failed to total sales: %w", err)
+	}
+	return totals, nil
+}
+
+// sales is the completed sales in [from, to) and the branch, when set
+func (s *SalesAnalyticsService) sales(ctx context.Context, branchID *uuid.UUID, from, to time.Time) *gorm.DB {
+	query := s.db.WithContext(ctx).Model(&models.Sale{}).
+		Where("status = ? AND created_at >= ? AND created_at < ?", "completed", from, to)
+	if branchID != nil {
+		query = query.Where("branch_id = ?", *branchID)
+	}
+	return query
+}
+
+// items is the lines of the completed sales in [from, to)
+func (s *SalesAnalyticsService) items(ctx context.Context, branchID *uuid.UUID, from, to time.Time) *gorm.DB {
+	return s.db.WithContext(ctx).Table("sale_items").
+		Where("sale_items.sale_id IN (?) AND sale_items.deleted_at IS NULL", s.sales(ctx, branchID, from, to).Select("id"))
+}
+
+// percentChange is how far current moved from previous, in percent
+func percentChange(previous, current float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return math.Round((current-previous)/previous*1000) / 10
+}
+
+// Request/Response types
+
+// SalesAnalytics is keyed in camelCase, as the analytics page reads it.
+// Revenue is what the sales took after discounts; ProductRevenue and
+// ServiceRevenue are their lines' totals.
+type SalesAnalytics struct {
+	From               time.Time            `json:"from"`
+	To                 time.Time            `json:"to"`
+	TotalRevenue       models.Money         `json:"totalRevenue"`
+	TotalOrders        int64                `json:"totalOrders"`
+	TotalDiscounts     models.Money         `json:"totalDiscounts"`
+	AverageOrderValue  models.Money         `json:"averageOrderValue"`
+	ProductRevenue     models.Money         `json:"productRevenue"`
+	ServiceRevenue     models.Money         `json:"serviceRevenue"`
+	RevenueGrowth      float64              `json:"revenueGrowth"`
+	OrderGrowth        float64              `json:"orderGrowth"`
+	AOVChange          float64              `json:"aovChange"`
+	DailySales         []DailySalesPoint    `json:"dailySales"`
+	ProductPerformance []ProductPerformance `json:"productPerformance"`
+	ServicePerformance []ServicePerformance `json:"servicePerformance"`
+}
+
+type DailySalesPoint struct {
+	Date    string       `json:"date"`
+	Revenue models.Money `json:"revenue"`
+	Orders  int64        `json:"orders"`
+}
+
+type ProductPerformance struct {
+	ProductID uuid.UUID    `json:"productId"`
+	Name      string       `json:"name"`
+	Category  string       `json:"category"`
+	UnitsSold int64        `json:"unitsSold"`
+	Revenue   models.Money `json:"revenue"`
+}
+
+type ServicePerformance struct {
+	ServiceID uuid.UUID              `json:"serviceId"`
+	Name      string                 `json:"name"`
+	Category  models.ServiceCategory `json:"category"`
+	Quantity  int64                  `json:"quantity"`
+	Revenue   models.Money           `json:"revenue"`
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/alerting"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// allergyClasses maps allergy classes customers commonly report to the
+// ingredients that share the sensitivity
+var allergyClasses = map[string][]string{
+	"penicillin":      {"penicillin", "amoxicillin", "ampicillin", "co-amoxiclav", "cloxacillin", "piperacillin"},
+	"cephalosporin":   {"cefalexin", "cephalexin", "cefuroxime", "ceftriaxone", "cefixime", "cefaclor"},
+	"sulfa":           {"sulfamethoxazole", "sulfasalazine", "sulfadiazine", "cotrimoxazole"},
+	"sulfonamide":     {"sulfamethoxazole", "sulfasalazine", "sulfadiazine", "cotrimoxazole"},
+	"nsaid":           {"ibuprofen", "naproxen", "mefenamic acid", "diclofenac", "celecoxib", "ketorolac", "aspirin"},
+	"aspirin":         {"aspirin", "acetylsalicylic acid"},
+	"macrolide":       {"azithromycin", "clarithromycin", "erythromycin"},
+	"quinolone":       {"ciprofloxacin", "levofloxacin", "ofloxacin", "moxifloxacin"},
+	"fluoroquinolone": {"ciprofloxacin", "levofloxacin", "ofloxacin", "moxifloxacin"},
+	"opioid":          {"codeine", "tramadol", "morphine", "oxycodone"},
+	"codeine":         {"codeine"},
+}
+
+type ScreeningService struct {
+	db     *gorm.DB
+	alerts *alerting.Notifier
+}
+
+func NewScreeningService(db *gorm.DB) *ScreeningService {
+	return &ScreeningService{db: db}
+}
+
+// SetAlerting posts overrides of alerts on controlled substances to the
+// operations channels
+func (s *ScreeningService) SetAlerting(alerts *alerting.Notifier) {
+	s.alerts = alerts
+}
+
+// ScreeningAlert describes one allergy or contraindication match
+type ScreeningAlert struct {
+	Key         string                     `json:"key"`
+	Type        string                     `json:"type"` // allergy, contraindication
+	Level       models.ScreeningAlertLevel `json:"level"`
+	ProductID   uuid.UUID                  `json:"product_id"`
+	ProductName string                     `json:"product_name"`
+	Matched     string                     `json:"matched"`
+	Message     string                     `json:"message"`
+}
+
+// ScreenProducts cross-checks products against a customer's allergies and
+// medical history. Allergy matches are blocking; contraindications matching
+// the medical history are advisory. Blocking alerts are returned first.
+func (s *ScreeningService) ScreenProducts(ctx context.Context, customerID uuid.UUID, productIDs []uuid.UUID) ([]ScreeningAlert, error) {
+	alerts := []ScreeningAlert{}
+	if len(productIDs) == 0 {
+		return alerts, nil
+	}
+
+	var customer models.Customer
+	if err := s.db.First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+	allergies, err := customer.Allergies.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt allergies: %w", err)
+	}
+	history, err := customer.MedicalHistory.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt medical history: %w", err)
+	}
+	if len(allergies) == 0 && len(history) == 0 {
+		return alerts, nil
+	}
+
+	var products []models.Product
+	if err := s.db.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+		return nil, fmt.Errorf("failed to load products: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	add := func(alert ScreeningAlert) {
+		if !seen[alert.Key] {
+			seen[alert.Key] = true
+			alerts = append(alerts, alert)
+		}
+	}
+
+	for _, product := range products {
+		ingredients := productIngredients(product)
+		text := strings.Join(ingredients, " ")
+
+		for _, allergy := range allergies {
+			allergy = strings.ToLower(strings.TrimSpace(allergy))
+			if allergy == "" {
+				continue
+			}
+			if term, ok := matchAllergy(allergy, text, ingredients); ok {
+				add(ScreeningAlert{
+					Key:         "allergy:" + product.ID.String() + ":" + allergy,
+					Type:        "allergy",
+					Level:       models.ScreeningAlertBlocking,
+					ProductID:   product.ID,
+					ProductName: product.Name,
+					Matched:     allergy,
+					Message:     fmt.Sprintf("Customer is allergic to %s; %s contains %s", allergy, product.Name, term),
+				})
+			}
+			// Contraindications often name hypersensitivities directly
+			for _, contraindication := range product.Contraindications {
+				if containsWord(strings.ToLower(contraindication), allergy) {
+					add(ScreeningAlert{
+						Key:         "allergy:" + product.ID.String() + ":" + allergy,
+						Type:        "allergy",
+						Level:       models.ScreeningAlertBlocking,
+						ProductID:   product.ID,
+						ProductName: product.Name,
+						Matched:     allergy,
+						Message:     fmt.Sprintf("%s is contraindicated: %s", product.Name, contraindication),
+					})
+				}
+			}
+		}
+
+		for _, contraindication := range product.Contraindications {
+			contraindication = strings.ToLower(strings.TrimSpace(contraindication))
+			if contraindication == "" {
+				continue
+			}
+			for _, condition := range history {
+				condition = strings.ToLower(strings.TrimSpace(condition))
+				if condition == "" {
+					continue
+				}
+				if containsWord(condition, contraindication) || containsWord(contraindication, condition) {
+					add(ScreeningAlert{
+						Key:         "contraindication:" + product.ID.String() + ":" + contraindication,
+						Type:        "contraindication",
+						Level:       models.ScreeningAlertAdvisory,
+						ProductID:   product.ID,
+						ProductName: product.Name,
+						Matched:     condition,
+						Message:     fmt.Sprintf("%s is contraindicated in %s (medical history: %s)", product.Name, contraindication, condition),
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Level == models.ScreeningAlertBlocking && alerts[j].Level != models.ScreeningAlertBlocking
+	})
+
+	return alerts, nil
+}
+
+// RecordOverrides stores the reason a pharmacist dispensed despite the
+// given blocking alerts
+func (s *ScreeningService) RecordOverrides(ctx context.Context, req ScreeningOverrideRequest) error {
+	now := time.Now().UTC()
+	var productIDs []uuid.UUID
+	for _, alert := range req.Alerts {
+		if alert.Level != models.ScreeningAlertBlocking {
+			continue
+		}
+		productIDs = append(productIDs, alert.ProductID)
+		override := &models.ScreeningOverride{
+			CustomerID:   req.CustomerID,
+			ProductID:    alert.ProductID,
+			SaleID:       req.SaleID,
+			OrderID:      req.OrderID,
+			AlertKey:     alert.Key,
+			AlertType:    alert.Type,
+			Level:        alert.Level,
+			Reason:       req.Reason,
+			OverriddenBy: req.UserID,
+			OverriddenAt: now,
+		}
+		if err := s.db.Create(override).Error; err != nil {
+			return fmt.Errorf("failed to record screening override: %w", err)
+		}
+	}
+
+	if s.alerts.Enabled() && len(productIDs) > 0 {
+		s.alertControlledOverrides(req, productIDs)
+	}
+	return nil
+}
+
+// alertControlledOverrides posts the overridden alerts on controlled
+// substances. Only IDs are posted about the customer, the chat channel is
+// no place for their medical details.
+func (s *ScreeningService) alertControlledOverrides(req ScreeningOverrideRequest, productIDs []uuid.UUID) {
+	var controlled []uuid.UUID
+	if err := s.db.Model(&models.Product{}).
+		Where("id IN ? AND controlled_substance = ?", productIDs, true).
+		Pluck("id", &controlled).Error; err != nil || len(controlled) == 0 {
+		return
+	}
+	isControlled := make(map[uuid.UUID]bool, len(controlled))
+	for _, id := range controlled {
+		isControlled[id] = true
+	}
+
+	var user models.User
+	s.db.Select("username").First(&user, "id = ?", req.UserID)
+
+	dispense := "Sale"
+	dispenseID := ""
+	if req.SaleID != nil {
+		dispenseID = req.SaleID.String()
+	} else if req.OrderID != nil {
+		dispense, dispenseID = "Order", req.OrderID.String()
+	}
+
+	for _, alert := range req.Alerts {
+		if alert.Level != models.ScreeningAlertBlocking || !isControlled[alert.ProductID] {
+			continue
+		}
+		s.alerts.Notify(alerting.Alert{
+			Event:    alerting.EventControlledOverride,
+			Severity: alerting.SeverityWarning,
+			Title:    "Controlled substance dispensed over a screening alert",
+			Message:  fmt.Sprintf("%s overrode the %s alert on %s", user.Username, alert.Type, alert.ProductName),
+			Fields: []alerting.Field{
+				{Name: "Product", Value: alert.ProductName},
+				{Name: "Reason", Value: req.Reason},
+				{Name: dispense, Value: dispenseID},
+				{Name: "Customer", Value: req.CustomerID.String()},
+			},
+			Key: alert.Key + ":" + dispenseID,
+		})
+	}
+}
+
+// GetOrderOverriddenKeys returns the alert keys already overridden for an order
+func (s *ScreeningService) GetOrderOverriddenKeys(ctx context.Context, orderID uuid.UUID) ([]string, error) {
+	var keys []string
+	err := s.db.Model(&models.ScreeningOverride{}).
+		Where("order_id = ?", orderID).
+		Pluck("alert_key", &keys).Error
+	return keys, err
+}
+
+// UnresolvedAlerts returns the blocking alerts whose keys are not in overridden
+func UnresolvedAlerts(alerts []ScreeningAlert, overridden []string) []ScreeningAlert {
+	overriddenSet := make(map[string]bool, len(overridden))
+	for _, key := range overridden {
+		overriddenSet[key] = true
+	}
+
+	var pending []ScreeningAlert
+	for _, alert := range alerts {
+		if alert.Level == models.ScreeningAlertBlocking && !overriddenSet[alert.Key] {
+			pending = append(pending, alert)
+		}
+	}
+	return pending
+}
+
+// Private helper methods
+
+// productIngredients returns the lowercase names a product is known by
+func productIngredients(product models.Product) []string {
+	names := []string{strings.ToLower(product.Name)}
+	if product.GenericName != nil && *product.GenericName != "" {
+		names = append(names, strings.ToLower(*product.GenericName))
+	}
+	if product.ActiveIngredient != nil && *product.ActiveIngredient != "" {
+		names = append(names, strings.ToLower(*product.ActiveIngredient))
+	}
+	return names
+}
+
+// matchAllergy reports whether a recorded allergy applies to a product and
+// which ingredient triggered the match
+func matchAllergy(allergy, productText string, ingredients []string) (string, bool) {
+	if containsWord(productText, allergy) {
+		return allergy, true
+	}
+
+	// Allergies are often recorded with a reaction, e.g. "amoxicillin - rash"
+	for _, ingredient := range ingredients[1:] {
+		if containsWord(allergy, ingredient) {
+			return ingredient, true
+		}
+	}
+
+	for class, members := range allergyClasses {
+		if !containsWord(allergy, class) {
+			continue
+		}
+		for _, member := range members {
+			if containsWord(productText, member) {
+				return member, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Request/Response types
+
+type ScreeningOverrideRequest struct {
+	CustomerID uuid.UUID
+	SaleID     *uuid.UUID
+	OrderID    *uuid.UUID
+	Alerts     []ScreeningAlert
+	Reason     string
+	UserID     uuid.UUID
+}
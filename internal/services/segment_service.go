@@ -0,0 +1,416 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SegmentService manages customer tags and rule-based segments
+type SegmentService struct {
+	db             *gorm.DB
+	communications *CommunicationService
+	config         config.SegmentConfig
+}
+
+func NewSegmentService(db *gorm.DB, communications *CommunicationService, cfg config.SegmentConfig) *SegmentService {
+	return &SegmentService{
+		db:             db,
+		communications: communications,
+		config:         cfg,
+	}
+}
+
+// Tags
+
+// AddTags attaches tags to a customer. Tags already present are ignored.
+func (s *SegmentService) AddTags(ctx context.Context, customerID uuid.UUID, tags []string, createdBy *uuid.UUID) ([]models.CustomerTag, error) {
+	var customer models.Customer
+	if err := s.db.Select("id").First(&customer, customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	for _, tag := range tags {
+		normalized := models.NormalizeTag(tag)
+		if normalized == "" {
+			continue
+		}
+		if len(normalized) > 50 {
+			return nil, fmt.Errorf("tag %q is longer than 50 characters", tag)
+		}
+		row := &models.CustomerTag{CustomerID: customerID, Tag: normalized, CreatedBy: createdBy}
+		if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(row).Error; err != nil {
+			return nil, fmt.Errorf("failed to add tag: %w", err)
+		}
+	}
+	return s.GetCustomerTags(ctx, customerID)
+}
+
+// RemoveTag detaches a tag from a customer
+func (s *SegmentService) RemoveTag(ctx context.Context, customerID uuid.UUID, tag string) error {
+	result := s.db.Unscoped().Where("customer_id = ? AND tag = ?", customerID, models.NormalizeTag(tag)).
+		Delete(&models.CustomerTag{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove tag: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("customer does not have tag %q", tag)
+	}
+	return nil
+}
+
+// GetCustomerTags lists a customer's tags alphabetically
+func (s *SegmentService) GetCustomerTags(ctx context.Context, customerID uuid.UUID) ([]models.CustomerTag, error) {
+	var tags []models.CustomerTag
+	err := s.db.Where("customer_id = ?", customerID).Order("tag ASC").Find(&tags).Error
+	return tags, err
+}
+
+// GetTagCounts lists every tag in use with the number of customers carrying it
+func (s *SegmentService) GetTagCounts(ctx context.Context) ([]TagCount, error) {
+	var counts []TagCount
+	err := s.db.WithContext(ctx).Model(&models.CustomerTag{}).
+		Select("tag, COUNT(*) AS customers").
+		Group("tag").Order("tag ASC").
+		Scan(&counts).Error
+	return counts, err
+}
+
+// Segments
+
+// CreateSegment defines a segment and computes its members straight away
+func (s *SegmentService) CreateSegment(ctx context.Context, segment *models.Segment) error {
+	segment.Slug = models.NormalizeTag(segment.Slug)
+	if segment.Slug == "" {
+		segment.Slug = models.NormalizeTag(segment.Name)
+	}
+	if err := validateSegment(segment); err != nil {
+		return err
+	}
+	segment.IsActive = true
+
+	if err := s.db.Create(segment).Error; err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	return s.RefreshSegment(ctx, segment)
+}
+
+// UpdateSegment changes a segment's definition and recomputes its members
+func (s *SegmentService) UpdateSegment(ctx context.Context, id uuid.UUID, req UpdateSegmentRequest) (*models.Segment, error) {
+	segment, err := s.GetSegment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		segment.Name = *req.Name
+	}
+	if req.Description != nil {
+		segment.Description = *req.Description
+	}
+	if req.Keyword != nil {
+		segment.Keyword = *req.Keyword
+	}
+	if req.Category != nil {
+		segment.Category = *req.Category
+	}
+	if req.Days != nil {
+		segment.Days = *req.Days
+	}
+	if req.MinSpend != nil {
+		segment.MinSpend = *req.MinSpend
+	}
+	if req.IsActive != nil {
+		segment.IsActive = *req.IsActive
+	}
+	if err := validateSegment(segment); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(segment).Error; err != nil {
+		return nil, fmt.Errorf("failed to update segment: %w", err)
+	}
+	if err := s.RefreshSegment(ctx, segment); err != nil {
+		return nil, err
+	}
+	return segment, nil
+}
+
+// GetSegment returns a segment by ID
+func (s *SegmentService) GetSegment(ctx context.Context, id uuid.UUID) (*models.Segment, error) {
+	var segment models.Segment
+	if err := s.db.First(&segment, id).Error; err != nil {
+		return nil, fmt.Errorf("segment not found: %w", err)
+	}
+	return &segment, nil
+}
+
+// ListSegments lists all segments by name
+func (s *SegmentService) ListSegments(ctx context.Context) ([]models.Segment, error) {
+	var segments []models.Segment
+	err := s.db.WithContext(ctx).Order("name ASC").Find(&segments).Error
+	return segments, err
+}
+
+// DeleteSegment removes a segment and its memberships
+func (s *SegmentService) DeleteSegment(ctx context.Context, id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("segment_id = ?", id).Delete(&models.SegmentMember{}).Error; err != nil {
+			return fmt.Errorf("failed to delete segment members: %w", err)
+		}
+		result := tx.Delete(&models.Segment{}, id)
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete segment: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("segment not found")
+		}
+		return nil
+	})
+}
+
+// GetMembers lists a segment's customers as of the last refresh
+func (s *SegmentService) GetMembers(ctx context.Context, id uuid.UUID, limit, offset int) ([]models.Customer, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Customer{}).
+		Where("id IN (SELECT customer_id FROM segment_members WHERE segment_id = ?)", id)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var customers []models.Customer
+	err := query.Order("last_name ASC, first_name ASC").Limit(limit).Offset(offset).Find(&customers).Error
+	return customers, total, err
+}
+
+// RefreshSegment recomputes a segment's members. Inactive segments are
+// emptied.
+func (s *SegmentService) RefreshSegment(ctx context.Context, segment *models.Segment) error {
+	var memberIDs []uuid.UUID
+	if segment.IsActive {
+		var err error
+		if memberIDs, err = s.computeMembers(segment); err != nil {
+			return fmt.Errorf("failed to compute segment %s: %w", segment.Slug, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("segment_id = ?", segment.ID).Delete(&models.SegmentMember{}).Error; err != nil {
+			return err
+		}
+		members := make([]models.SegmentMember, len(memberIDs))
+		for i, customerID := range memberIDs {
+			members[i] = models.SegmentMember{SegmentID: segment.ID, CustomerID: customerID, ComputedAt: now}
+		}
+		if len(members) > 0 {
+			if err := tx.CreateInBatches(members, 500).Error; err != nil {
+				return err
+			}
+		}
+
+		segment.MemberCount = len(members)
+		segment.LastComputedAt = &now
+		return tx.Model(segment).Updates(map[string]interface{}{
+			"member_count":     segment.MemberCount,
+			"last_computed_at": now,
+		}).Error
+	})
+}
+
+// RefreshAll recomputes every segment. It returns the number refreshed.
+func (s *SegmentService) RefreshAll(ctx context.Context) (int, error) {
+	segments, err := s.ListSegments(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load segments: %w", err)
+	}
+
+	refreshed := 0
+	for i := range segments {
+		if err := s.RefreshSegment(ctx, &segments[i]); err != nil {
+			logrus.WithError(err).WithField("segment", segments[i].Slug).Warn("Failed to refresh segment")
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, nil
+}
+
+// RunRefresh recomputes segments on the configured interval until ctx is done
+func (s *SegmentService) RunRefresh(ctx context.Context) {
+	ticker := time.NewTicker(s.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if refreshed, err := s.RefreshAll(lifecycle.WorkContext(ctx)); err != nil {
+				logrus.WithError(err).Error("Segment refresh failed")
+			} else {
+				logrus.WithField("segments", refreshed).Debug("Segments refreshed")
+			}
+		}
+	}
+}
+
+// SendPromotion sends a marketing message to targeted customers who have
+// opted in to marketing on at least one channel
+func (s *SegmentService) SendPromotion(ctx context.Context, req PromotionRequest) (*PromotionResult, error) {
+	if req.Targeting.IsEmpty() {
+		return nil, fmt.Errorf("a promotion must target at least one tag or segment")
+	}
+
+	var customers []models.Customer
+	query := s.db.Model(&models.Customer{}).Where("anonymized_at IS NULL")
+	if err := req.Targeting.Apply(query, "customers.id").Find(&customers).Error; err != nil {
+		return nil, fmt.Errorf("failed to load targeted customers: %w", err)
+	}
+
+	result := &PromotionResult{Targeted: len(customers)}
+	for i := range customers {
+		_, err := s.communications.NotifyCustomer(ctx, &customers[i], models.PurposeMarketing, req.Subject, req.Message)
+		switch {
+		case err == nil:
+			result.Sent++
+		case errors.Is(err, ErrNotificationSuppressed):
+			result.Suppressed++
+		default:
+			logrus.WithError(err).WithField("customer_id", customers[i].ID).Warn("Failed to send promotion")
+			result.Failed++
+		}
+	}
+	return result, nil
+}
+
+// Private helper methods
+
+func (s *SegmentService) computeMembers(segment *models.Segment) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	history := s.db.Model(&models.PurchaseHistory{}).
+		Joins("JOIN customers c ON c.id = purchase_histories.customer_id AND c.anonymized_at IS NULL AND c.deleted_at IS NULL")
+
+	switch segment.Rule {
+	case models.SegmentRuleCondition:
+		return s.conditionMembers(segment.Keyword)
+	case models.SegmentRuleCategory:
+		err := history.Joins("JOIN products p ON p.id = purchase_histories.product_id").
+			Where("p.category = ? AND purchase_histories.purchase_date >= ?", segment.Category, since(segment.Days)).
+			Distinct().Pluck("purchase_histories.customer_id", &ids).Error
+		return ids, err
+	case models.SegmentRuleHighValue:
+		if segment.Days > 0 {
+			history = history.Where("purchase_histories.purchase_date >= ?", since(segment.Days))
+		}
+		err := history.Group("purchase_histories.customer_id").
+			Having("SUM(purchase_histories.total_price) >= ?", segment.MinSpend).
+			Pluck("purchase_histories.customer_id", &ids).Error
+		return ids, err
+	case models.SegmentRuleLapsed:
+		err := history.Group("purchase_histories.customer_id").
+			Having("MAX(purchase_histories.purchase_date) < ?", since(segment.Days)).
+			Pluck("purchase_histories.customer_id", &ids).Error
+		return ids, err
+	}
+	return nil, fmt.Errorf("unknown segment rule: %s", segment.Rule)
+}
+
+// conditionMembers matches the keyword against decrypted medical history and
+// current medications, so it has to scan customers in Go rather than SQL
+func (s *SegmentService) conditionMembers(keyword string) ([]uuid.UUID, error) {
+	keyword = strings.ToLower(keyword)
+	var ids []uuid.UUID
+	var batch []models.Customer
+	err := s.db.Select("id", "medical_history", "current_medications").
+		Where("anonymized_at IS NULL").
+		FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				history, _ := batch[i].MedicalHistory.Get()
+				medications, _ := batch[i].CurrentMedications.Get()
+				for _, entry := range append(history, medications...) {
+					if strings.Contains(strings.ToLower(entry), keyword) {
+						ids = append(ids, batch[i].ID)
+						break
+					}
+				}
+			}
+			return nil
+		}).Error
+	return ids, err
+}
+
+func validateSegment(segment *models.Segment) error {
+	if segment.Name == "" {
+		return fmt.Errorf("segment name is required")
+	}
+	if !segment.Rule.IsValid() {
+		return fmt.Errorf("invalid segment rule: %s", segment.Rule)
+	}
+	switch segment.Rule {
+	case models.SegmentRuleCondition:
+		if segment.Keyword == "" {
+			return fmt.Errorf("a condition segment needs a keyword")
+		}
+	case models.SegmentRuleCategory:
+		if segment.Category == "" || segment.Days <= 0 {
+			return fmt.Errorf("a category segment needs a category and days")
+		}
+	case models.SegmentRuleHighValue:
+		if segment.MinSpend <= 0 {
+			return fmt.Errorf("a high value segment needs a minimum spend")
+		}
+	case models.SegmentRuleLapsed:
+		if segment.Days <= 0 {
+			return fmt.Errorf("a lapsed segment needs days")
+		}
+	}
+	return nil
+}
+
+func since(days int) time.Time {
+	return time.Now().UTC().AddDate(0, 0, -days)
+}
+
+// Request/Response types
+
+type UpdateSegmentRequest struct {
+	Name        *string       `json:"name"`
+	Description *string       `json:"description"`
+	Keyword     *string       `json:"keyword"`
+	Category    *string       `json:"category"`
+	Days        *int          `json:"days"`
+	MinSpend    *models.Money `json:"min_spend"`
+	IsActive    *bool         `json:"is_active"`
+}
+
+type TagCount struct {
+	Tag       string `json:"tag"`
+	Customers int64  `json:"customers"`
+}
+
+type PromotionRequest struct {
+	Subject   string          `json:"subject" binding:"required"`
+	Message   string          `json:"message" binding:"required"`
+	Targeting query.Targeting `json:"targeting"`
+}
+
+type PromotionResult struct {
+	Targeted   int `json:"targeted"`
+	Sent       int `json:"sent"`
+	Suppressed int `json:"suppressed"` // not opted in to marketing
+	Failed     int `json:"failed"`
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSaleItemType         = errors.New("a sale item is a product with product_id, a service with service_id or a compounded preparation with preparation_id")
+	ErrServiceInactive      = errors.New("the service is not offered any more")
+	ErrServiceNeedsRx       = errors.New("the service needs a prescription number on the sale")
+	ErrPerformerNotStaff    = errors.New("the service must be performed by active staff")
+	ErrPerformerUnqualified = errors.New("the service must be performed by a pharmacist")
+	ErrNotServiceItem       = errors.New("the sale item is not a service")
+	ErrServiceCompleted     = errors.New("the service has already been performed")
+	ErrSaleNotCompleted     = errors.New("the sale is not completed")
+)
+
+// ServiceSaleService checks the services rung up with a sale and records
+// who performed them. A service is performed when it is sold unless it is
+// scheduled for later, when staff complete it once they have.
+type ServiceSaleService struct {
+	db *gorm.DB
+}
+
+func NewServiceSaleService(db *gorm.DB) *ServiceSaleService {
+	return &ServiceSaleService{db: db}
+}
+
+// PrepareItems checks the sale's items are each a product, an active
+// service or a preparation, before they are priced. Services sold for now are attributed to
+// who performed them, by default sellerID, and marked performed.
+func (s *ServiceSaleService) PrepareItems(ctx context.Context, sale *models.Sale, sellerID uuid.UUID) error {
+	tx := s.db.WithContext(ctx)
+	now := time.Now().UTC()
+	for i := range sale.SaleItems {
+		item := &sale.SaleItems[i]
+		switch {
+		case item.ProductID != nil && item.ServiceID == nil && item.PreparationID == nil && item.ItemType != "service" && item.ItemType != "compound":
+			item.ItemType = "product"
+			item.ScheduledDate, item.ServiceNotes, item.PerformedBy = nil, nil, nil
+			item.ServiceCompleted, item.ServiceCompletedAt = false, nil
+			continue
+		case item.PreparationID != nil && item.ProductID == nil && item.ServiceID == nil && (item.ItemType == "" || item.ItemType == "compound"):
+			// Checked against the preparation by CompoundingService
+			item.ItemType = "compound"
+			item.ScheduledDate, item.ServiceNotes, item.PerformedBy = nil, nil, nil
+			item.ServiceCompleted, item.ServiceCompletedAt = false, nil
+			continue
+		case item.ServiceID != nil && item.ProductID == nil && item.PreparationID == nil && item.ItemType != "product" && item.ItemType != "compound":
+			item.ItemType = "service"
+		default:
+			return ErrSaleItemType
+		}
+
+		var service models.Service
+		if err := tx.First(&service, "id = ?", *item.ServiceID).Error; err != nil {
+			return fmt.Errorf("service: %w", err)
+		}
+		if !service.IsActive {
+			return fmt.Errorf("%w: %s", ErrServiceInactive, service.Name)
+		}
+		if service.RequiresPrescription && (sale.PrescriptionNumber == nil || *sale.PrescriptionNumber == "") {
+			return fmt.Errorf("%w: %s", ErrServiceNeedsRx, service.Name)
+		}
+
+		// Batches are for stock, which services don't take
+		item.BatchNumber, item.ExpiryDate = "", nil
+		item.ServiceCompleted, item.ServiceCompletedAt = false, nil
+		if item.ScheduledDate != nil && item.ScheduledDate.After(now) {
+			if item.PerformedBy != nil {
+				if err := s.checkPerformer(tx, *item.PerformedBy, &service); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if item.PerformedBy == nil {
+			item.PerformedBy = &sellerID
+		}
+		if err := s.checkPerformer(tx, *item.PerformedBy, &service); err != nil {
+			return err
+		}
+		item.ServiceCompleted = true
+		item.ServiceCompletedAt = &now
+	}
+	return nil
+}
+
+// Complete records a scheduled service on a completed sale as performed,
+// by req.PerformedBy or else userID
+func (s *ServiceSaleService) Complete(ctx context.Context, saleID, itemID uuid.UUID, req CompleteServiceRequest, userID uuid.UUID) (*models.SaleItem, error) {
+	var item models.SaleItem
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Service").
+			First(&item, "id = ? AND sale_id = ?", itemID, saleID).Error; err != nil {
+			return fmt.Errorf("sale item: %w", err)
+		}
+		if item.ServiceID == nil || item.Service == nil {
+			return ErrNotServiceItem
+		}
+		var sale models.Sale
+		if err := tx.Select("id, status").First(&sale, "id = ?", saleID).Error; err != nil {
+			return fmt.Errorf("sale: %w", err)
+		}
+		if sale.Status != "completed" {
+			return ErrSaleNotCompleted
+		}
+
+		performer := userID
+		if req.PerformedBy != nil {
+			performer = *req.PerformedBy
+		}
+		if err := s.checkPerformer(tx, performer, item.Service); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		updates := map[string]interface{}{
+			"performed_by":         performer,
+			"service_completed":    true,
+			"service_completed_at": now,
+		}
+		if req.Notes != "" {
+			updates["service_notes"] = req.Notes
+		}
+		// Only one of two staff completing it at once records it
+		result := tx.Model(&models.SaleItem{}).
+			Where("id = ? AND service_completed = ?", item.ID, false).
+			Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to complete service: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrServiceCompleted
+		}
+		item.PerformedBy = &performer
+		item.ServiceCompleted = true
+		item.ServiceCompletedAt = &now
+		if req.Notes != "" {
+			item.ServiceNotes = &req.Notes
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// Report totals the services sold on completed sales in [filter.From,
+// filter.To), by service and by the staff who performed them
+func (s *ServiceSaleService) Report(ctx context.Context, filter ServiceReportFilter) (*ServiceSalesReport, error) {
+	report := &ServiceSalesReport{From: filter.From, To: filter.To}
+
+	if err := s.serviceItems(ctx, filter).
+		Select("services.id AS service_id, services.name, services.category, " +
+			"COALESCE(SUM(sale_items.quantity), 0) AS quantity, COALESCE(SUM(sale_items.total_price), 0) AS revenue, " +
+			"COUNT(CASE WHEN sale_items.service_completed THEN 1 END) AS performed, " +
+			"COUNT(CASE WHEN NOT sale_items.service_completed THEN 1 END) AS pending").
+		Joins("JOIN services ON services.id = sale_items.service_id").
+		Group("services.id, services.name, services.category").
+		Order("revenue DESC").
+		Scan(&report.Services).Error; err != nil {
+		return nil, fmt.Errorf("failed to total service sales: %w", err)
+	}
+
+	if err := s.serviceItems(ctx, filter).
+		Select("users.id AS user_id, users.first_name, users.last_name, users.role, "+
+			"COUNT(*) AS performed, COALESCE(SUM(sale_items.total_price), 0) AS revenue").
+		Joins("JOIN users ON users.id = sale_items.performed_by").
+		Where("sale_items.service_completed = ?", true).
+		Group("users.id, users.first_name, users.last_name, users.role").
+		Order("revenue DESC").
+		Scan(&report.Staff).Error; err != nil {
+		return nil, fmt.Errorf("failed to total services by staff: %w", err)
+	}
+
+	for _, total := range report.Services {
+		report.Quantity += total.Quantity
+		report.Revenue += total.Revenue
+		report.Pending += total.Pending
+	}
+	return report, nil
+}
+
+// Private helper methods
+
+// checkPerformer checks the staff member can perform the service
+func (s *ServiceSaleService) checkPerformer(tx *gorm.DB, userID uuid.UUID, service *models.Service) error {
+	var user models.User
+	if err := tx.Select("id, role, is_active").First(&user, "id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPerformerNotStaff
+		}
+		return fmt.Errorf("failed to load performer: %w", err)
+	}
+	if !user.IsActive {
+		return ErrPerformerNotStaff
+	}
+	if service.RequiresQualifiedStaff && user.Role != models.RolePharmacist && user.Role != models.RoleAdmin {
+		return fmt.Errorf("%w: %s", ErrPerformerUnqualified, service.Name)
+	}
+	return nil
+}
+
+// serviceItems is the service items of completed sales in the filter's
+// period and branch
+func (s *ServiceSaleService) serviceItems(ctx context.Context, filter ServiceReportFilter) *gorm.DB {
+	query := s.db.WithContext(ctx).Table("sale_items").
+		Joins("JOIN sales ON sales.id = sale_items.sale_id").
+		Where("sale_items.service_id IS NOT NULL AND sale_items.deleted_at IS NULL").
+		Where("sales.status = ? AND sales.deleted_at IS NULL", "completed")
+	if filter.BranchID != nil {
+		query = query.Where("sales.branch_id = ?", *filter.BranchID)
+	}
+	if filter.From != nil {
+		query = query.Where("sales.created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("sales.created_at < ?", *filter.To)
+	}
+	return query
+}
+
+// Request/Response types
+
+type CompleteServiceRequest struct {
+	PerformedBy *uuid.UUID `json:"performed_by"` // defaults to who records it
+	Notes       string     `json:"notes" binding:"max=2000"`
+}
+
+type ServiceReportFilter struct {
+	BranchID *uuid.UUID
+	From     *time.Time
+	To       *time.Time
+}
+
+type ServiceSalesReport struct {
+	From     *time.Time          `json:"from,omitempty"`
+	To       *time.Time          `json:"to,omitempty"`
+	Quantity int64               `json:"quantity"`
+	Revenue  models.Money        `json:"revenue"`
+	Pending  int64               `json:"pending"`
+	Services []ServiceSalesTotal `json:"services"`
+	Staff    []StaffServiceTotal `json:"staff"`
+}
+
+// ServiceSalesTotal is one service's sales. Performed and Pending count
+// sale lines; Quantity counts what was sold on them.
+type ServiceSalesTotal struct {
+	ServiceID uuid.UUID              `json:"service_id"`
+	Name      string                 `json:"name"`
+	Category  models.ServiceCategory `json:"category"`
+	Quantity  int64                  `json:"quantity"`
+	Revenue   models.Money           `json:"revenue"`
+	Performed int64                  `json:"performed"`
+	Pending   int64                  `json:"pending"`
+}
+
+// StaffServiceTotal is the services one staff member performed and what
+// they were sold for
+type StaffServiceTotal struct {
+	UserID    uuid.UUID       `json:"user_id"`
+	FirstName string          `json:"first_name"`
+	LastName  string          `json:"last_name"`
+	Role      models.UserRole `json:"role"`
+	Performed int64           `json:"performed"`
+	Revenue   models.Money    `json:"revenue"`
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+)
+
+// ErrInvalidPhone is returned for a number that can't be texted
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// SMSGateway sends text messages through a provider
+type SMSGateway interface {
+	Name() string
+	// Send texts message to an E.164 number. Priority messages, such as
+	// one-time codes, skip the provider's queue where it has one.
+	Send(ctx context.Context, to, message string, priority bool) (*SMSReceipt, error)
+}
+
+// SMSStatusPoller is a gateway whose delivery receipts are fetched rather
+// than posted back to us
+type SMSStatusPoller interface {
+	Status(ctx context.Context, messageID string) (*SMSReceipt, error)
+}
+
+// SMSReceipt is what the provider reported about a message
+type SMSReceipt struct {
+	MessageID      string
+	Status         models.SMSStatus
+	ProviderStatus string
+	Segments       int // 0 if the provider didn't say
+	Error          string
+}
+
+// NewSMSGateway builds the gateway named in the configuration, or returns
+// nil when SMS is not configured
+func NewSMSGateway(cfg config.SMSConfig) SMSGateway {
+	client := &http.Client{Timeout: cfg.Timeout}
+	switch cfg.Provider {
+	case "semaphore":
+		baseURL := cfg.APIURL
+		if baseURL == "" {
+			baseURL = "https://api.semaphore.co/api/v4"
+		}
+		return &SemaphoreGateway{
+			BaseURL:    baseURL,
+			APIKey:     cfg.SemaphoreAPIKey,
+			SenderName: cfg.SenderName,
+			Client:     client,
+		}
+	case "twilio":
+		baseURL := cfg.APIURL
+		if baseURL == "" {
+			baseURL = "https://api.twilio.com"
+		}
+		return &TwilioGateway{
+			BaseURL:             baseURL,
+			AccountSID:          cfg.TwilioAccountSID,
+			AuthToken:           cfg.TwilioAuthToken,
+			From:                cfg.TwilioFrom,
+			MessagingServiceSID: cfg.TwilioMessagingServiceSID,
+			StatusCallbackURL:   cfg.StatusCallbackURL,
+			Client:              client,
+		}
+	}
+	return nil
+}
+
+// SemaphoreGateway sends through Semaphore (semaphore.co), which delivers
+// to Philippine numbers on every local network. It has no delivery
+// callbacks, so receipts are polled.
+type SemaphoreGateway struct {
+	BaseURL    string
+	APIKey     string
+	SenderName string // defaults to the account's sender name
+	Client     *http.Client
+}
+
+func (g *SemaphoreGateway) Name() string { return "semaphore" }
+
+func (g *SemaphoreGateway) Send(ctx context.Context, to, message string, priority bool) (*SMSReceipt, error) {
+	form := url.Values{
+		"apikey":  {g.APIKey},
+		"number":  {strings.TrimPrefix(to, "+")},
+		"message": {message},
+	}
+	if g.SenderName != "" {
+		form.Set("sendername", g.SenderName)
+	}
+	endpoint := "/messages"
+	if priority {
+		endpoint = "/priority"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(g.BaseURL, "/")+endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Semaphore request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return g.do(req)
+}
+
+func (g *SemaphoreGateway) Status(ctx context.Context, messageID string) (*SMSReceipt, error) {
+	endpoint := fmt.Sprintf("%s/messages/%s?%s", strings.TrimRight(g.BaseURL, "/"), url.PathEscape(messageID),
+		url.Values{"apikey": {g.APIKey}}.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Semaphore request: %w", err)
+	}
+	return g.do(req)
+}
+
+// do sends a request answered with a list holding the message. Semaphore
+// reports invalid input as an object of field errors instead.
+func (g *SemaphoreGateway) do(req *http.Request) (*SMSReceipt, error) {
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Semaphore request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Semaphore response: %w", err)
+	}
+	var messages []struct {
+		MessageID json.Number `json:"message_id"`
+		Status    string      `json:"status"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &messages) != nil || len(messages) == 0 {
+		return nil, fmt.Errorf("Semaphore returned %d: %s", resp.StatusCode, truncate(strings.TrimSpace(string(body)), 512))
+	}
+
+	receipt := &SMSReceipt{
+		MessageID:      messages[0].MessageID.String(),
+		ProviderStatus: messages[0].Status,
+	}
+	switch strings.ToLower(messages[0].Status) {
+	case "sent":
+		// Semaphore's final status once the network accepts the message;
+		// it has no handset receipts
+		receipt.Status = models.SMSDelivered
+	case "failed", "refunded":
+		receipt.Status = models.SMSFailed
+		receipt.Error = "Semaphore reported the message as " + strings.ToLower(messages[0].Status)
+	default: // queued, pending
+		receipt.Status = models.SMSQueued
+	}
+	return receipt, nil
+}
+
+// TwilioGateway sends through Twilio's Messages API. Delivery receipts are
+// posted back to StatusCallbackURL when it is set.
+type TwilioGateway struct {
+	BaseURL             string
+	AccountSID          string
+	AuthToken           string
+	From                string
+	MessagingServiceSID string
+	StatusCallbackURL   string
+	Client              *http.Client
+}
+
+func (g *TwilioGateway) Name() string { return "twilio" }
+
+func (g *TwilioGateway) Send(ctx context.Context, to, message string, priority bool) (*SMSReceipt, error) {
+	form := url.Values{
+		"To":   {to},
+		"Body": {message},
+	}
+	if g.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", g.MessagingServiceSID)
+	} else {
+		form.Set("From", g.From)
+	}
+	if g.StatusCallbackURL != "" {
+		form.Set("StatusCallback", g.StatusCallbackURL)
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", strings.TrimRight(g.BaseURL, "/"), url.PathEscape(g.AccountSID))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build Twilio request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(g.AccountSID, g.AuthToken)
+
+	resp, err := g.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Twilio request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		SID          string `json:"sid"`
+		Status       string `json:"status"`
+		NumSegments  string `json:"num_segments"`
+		ErrorMessage string `json:"error_message"`
+		Message      string `json:"message"` // set on API errors
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid Twilio response (%d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("Twilio returned %d: %s", resp.StatusCode, result.Message)
+	}
+
+	receipt := &SMSReceipt{
+		MessageID:      result.SID,
+		Status:         TwilioStatus(result.Status),
+		ProviderStatus: result.Status,
+		Error:          result.ErrorMessage,
+	}
+	receipt.Segments, _ = strconv.Atoi(result.NumSegments)
+	return receipt, nil
+}
+
+// ValidSignature checks the X-Twilio-Signature of a request Twilio posted to
+// callbackURL: the base64 HMAC-SHA1, keyed with the auth token, of the URL
+// followed by each form field's name and value in name order
+func (g *TwilioGateway) ValidSignature(callbackURL string, form url.Values, signature string) bool {
+	names := make([]string, 0, len(form))
+	for name := range form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(g.AuthToken))
+	mac.Write([]byte(callbackURL))
+	for _, name := range names {
+		for _, value := range form[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// TwilioStatus maps a Twilio message status to ours
+func TwilioStatus(status string) models.SMSStatus {
+	switch status {
+	case "sent":
+		return models.SMSSent
+	case "delivered", "read":
+		return models.SMSDelivered
+	case "undelivered", "failed", "canceled":
+		return models.SMSFailed
+	}
+	return models.SMSQueued // accepted, scheduled, queued, sending
+}
+
+// NormalizePhone returns a number in E.164 form. Local Philippine numbers,
+// such as 0917 123 4567 or 917-123-4567, get the +63 country code; other
+// numbers must already start with + and their country code.
+func NormalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	international := strings.HasPrefix(phone, "+")
+
+	digits := make([]rune, 0, len(phone))
+	for _, r := range phone {
+		switch {
+		case unicode.IsDigit(r):
+			digits = append(digits, r)
+		case r == '+' || r == '-' || r == ' ' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+	number := string(digits)
+
+	switch {
+	case international:
+	case strings.HasPrefix(number, "63") && len(number) == 12:
+	case strings.HasPrefix(number, "09") && len(number) == 11:
+		number = "63" + number[1:]
+	case strings.HasPrefix(number, "9") && len(number) == 10:
+		number = "63" + number
+	default:
+		return "", ErrInvalidPhone
+	}
+	if len(number) < 8 || len(number) > 15 || (strings.HasPrefix(number, "63") && len(number) != 12) {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// MaskPhone hides the middle of an E.164 number for logs, e.g.
+// +63917***4567
+func MaskPhone(phone string) string {
+	if len(phone) < 9 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:len(phone)-7] + "***" + phone[len(phone)-4:]
+}
+
+// smsSegments counts the parts a message is sent in: 160 characters, or 70
+// when it needs Unicode, with a little less per part once it is split
+func smsSegments(message string) int {
+	length, single, multi := 0, 160, 153
+	for _, r := range message {
+		length++
+		if r > unicode.MaxASCII {
+			single, multi = 70, 67
+		}
+	}
+	if length <= single {
+		return 1
+	}
+	return (length + multi - 1) / multi
+}
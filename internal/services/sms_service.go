@@ -0,0 +1,525 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSMSUnavailable        = errors.New("no SMS provider configured")
+	ErrInvalidSMSSignature   = errors.New("invalid delivery receipt signature")
+	ErrVerificationNotFound  = errors.New("no verification code has been sent to this number")
+	ErrVerificationExpired   = errors.New("verification code has expired, request a new one")
+	ErrVerificationLocked    = errors.New("too many incorrect codes, request a new one")
+	ErrVerificationIncorrect = errors.New("incorrect verification code")
+	ErrVerificationTooSoon   = errors.New("a code was sent less than a minute ago")
+)
+
+const (
+	// smsReceiptWindow is how long after sending a message's delivery
+	// receipt is still polled for
+	smsReceiptWindow = 24 * time.Hour
+	smsPollBatchSize = 200
+
+	otpLength      = 6
+	otpResendDelay = time.Minute
+)
+
+// SMS template names. Order updates use "order." followed by the status.
+const (
+	SMSTemplateRefillReminder    = "refill.reminder"
+	SMSTemplatePhoneVerification = "phone.verification"
+)
+
+// SMSService texts customers through the configured gateway, logging each
+// message and its delivery receipts. It also keeps the message templates
+// and verifies customers' phone numbers with one-time codes.
+type SMSService struct {
+	db      *gorm.DB
+	gateway SMSGateway
+	config  config.SMSConfig
+}
+
+func NewSMSService(db *gorm.DB, gateway SMSGateway, cfg config.SMSConfig) *SMSService {
+	return &SMSService{
+		db:      db,
+		gateway: gateway,
+		config:  cfg,
+	}
+}
+
+// Enabled reports whether an SMS provider is configured
+func (s *SMSService) Enabled() bool {
+	return s.gateway != nil
+}
+
+// Send texts body to a number, so the service can stand in as the SMS
+// Notifier. Texts have no subject.
+func (s *SMSService) Send(ctx context.Context, to, subject, body string) error {
+	_, err := s.SendSMS(ctx, SMSRequest{To: to, Text: body})
+	return err
+}
+
+// SendSMS texts a message and logs it. A failure the provider reports is
+// logged on the message and returned.
+func (s *SMSService) SendSMS(ctx context.Context, req SMSRequest) (*models.SMSMessage, error) {
+	if s.gateway == nil {
+		return nil, ErrSMSUnavailable
+	}
+	to, err := NormalizePhone(req.To)
+	if err != nil {
+		return nil, err
+	}
+
+	message := &models.SMSMessage{
+		Provider:   s.gateway.Name(),
+		Recipient:  MaskPhone(to),
+		CustomerID: req.CustomerID,
+		Template:   req.Template,
+		Segments:   smsSegments(req.Text),
+		Status:     models.SMSQueued,
+	}
+	if err := s.db.WithContext(ctx).Create(message).Error; err != nil {
+		return nil, fmt.Errorf("failed to log SMS: %w", err)
+	}
+
+	receipt, sendErr := s.gateway.Send(ctx, to, req.Text, req.Priority)
+	if sendErr != nil {
+		receipt = &SMSReceipt{Status: models.SMSFailed, Error: sendErr.Error()}
+	}
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"provider_message_id": receipt.MessageID,
+		"status":              receipt.Status,
+		"provider_status":     receipt.ProviderStatus,
+		"error":               receipt.Error,
+	}
+	if sendErr == nil {
+		updates["sent_at"] = now
+	}
+	if receipt.Segments > 0 {
+		updates["segments"] = receipt.Segments
+	}
+	if receipt.Status == models.SMSDelivered {
+		updates["delivered_at"] = now
+	}
+	if err := s.db.WithContext(ctx).Model(message).Updates(updates).Error; err != nil {
+		logrus.WithError(err).WithField("sms_id", message.ID).Error("Failed to record SMS result")
+	}
+
+	if sendErr != nil {
+		return message, sendErr
+	}
+	if receipt.Status == models.SMSFailed {
+		return message, fmt.Errorf("SMS rejected: %s", receipt.Error)
+	}
+	return message, nil
+}
+
+// Render fills the named template's placeholders from data. The fallback
+// text is used when the template is missing or inactive.
+func (s *SMSService) Render(ctx context.Context, name string, data map[string]string, fallback string) string {
+	var template models.SMSTemplate
+	err := s.db.WithContext(ctx).Where("name = ? AND is_active = ?", name, true).First(&template).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logrus.WithError(err).WithField("template", name).Warn("Failed to load SMS template, sending the default text")
+		}
+		return fallback
+	}
+	return renderSMSTemplate(template.Body, data)
+}
+
+// ListMessages returns logged messages, newest first, optionally filtered by
+// status and customer
+func (s *SMSService) ListMessages(ctx context.Context, status string, customerID *uuid.UUID, limit, offset int) ([]models.SMSMessage, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.SMSMessage{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if customerID != nil {
+		query = query.Where("customer_id = ?", *customerID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count SMS messages: %w", err)
+	}
+
+	var messages []models.SMSMessage
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&messages).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load SMS messages: %w", err)
+	}
+	return messages, total, nil
+}
+
+// Templates
+
+// ListTemplates returns every template by name
+func (s *SMSService) ListTemplates(ctx context.Context) ([]models.SMSTemplate, error) {
+	var templates []models.SMSTemplate
+	if err := s.db.WithContext(ctx).Order("name ASC").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to load SMS templates: %w", err)
+	}
+	return templates, nil
+}
+
+func (s *SMSService) CreateTemplate(ctx context.Context, req SMSTemplateRequest, userID *uuid.UUID) (*models.SMSTemplate, error) {
+	template := &models.SMSTemplate{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Body:        req.Body,
+		IsActive:    true,
+		UpdatedBy:   userID,
+	}
+	if req.IsActive != nil {
+		template.IsActive = *req.IsActive
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Unscoped().Model(&models.SMSTemplate{}).Where("name = ?", template.Name).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check SMS template: %w", err)
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("an SMS template named %s already exists", template.Name)
+	}
+
+	if err := s.db.WithContext(ctx).Create(template).Error; err != nil {
+		return nil, fmt.Errorf("failed to create SMS template: %w", err)
+	}
+	return template, nil
+}
+
+// UpdateTemplate changes a template's wording, description or whether it
+// is used. The name stays, as the code sending the message looks it up.
+func (s *SMSService) UpdateTemplate(ctx context.Context, id uuid.UUID, req UpdateSMSTemplateRequest, userID *uuid.UUID) (*models.SMSTemplate, error) {
+	var template models.SMSTemplate
+	if err := s.db.WithContext(ctx).First(&template, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("SMS template: %w", err)
+	}
+
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+	if req.Body != nil {
+		if strings.TrimSpace(*req.Body) == "" {
+			return nil, fmt.Errorf("template body cannot be empty")
+		}
+		template.Body = *req.Body
+	}
+	if req.IsActive != nil {
+		template.IsActive = *req.IsActive
+	}
+	template.UpdatedBy = userID
+
+	if err := s.db.WithContext(ctx).Save(&template).Error; err != nil {
+		return nil, fmt.Errorf("failed to update SMS template: %w", err)
+	}
+	return &template, nil
+}
+
+// DeleteTemplate removes a template, so its messages go back to their
+// built-in text. Starter templates are created again on the next start;
+// deactivate those instead.
+func (s *SMSService) DeleteTemplate(ctx context.Context, id uuid.UUID) (*models.SMSTemplate, error) {
+	var template models.SMSTemplate
+	if err := s.db.WithContext(ctx).First(&template, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("SMS template: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(&template).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete SMS template: %w", err)
+	}
+	return &template, nil
+}
+
+// Delivery receipts
+
+// HandleTwilioStatus applies a status callback Twilio posted to
+// callbackURL, after checking its signature
+func (s *SMSService) HandleTwilioStatus(ctx context.Context, callbackURL string, form url.Values, signature string) error {
+	gateway, ok := s.gateway.(*TwilioGateway)
+	if !ok {
+		return ErrSMSUnavailable
+	}
+	if !gateway.ValidSignature(callbackURL, form, signature) {
+		return ErrInvalidSMSSignature
+	}
+
+	receipt := &SMSReceipt{
+		MessageID:      form.Get("MessageSid"),
+		Status:         TwilioStatus(form.Get("MessageStatus")),
+		ProviderStatus: form.Get("MessageStatus"),
+	}
+	if code := form.Get("ErrorCode"); code != "" {
+		receipt.Error = "Twilio error " + code
+	}
+
+	var message models.SMSMessage
+	if err := s.db.WithContext(ctx).Where("provider = ? AND provider_message_id = ?", gateway.Name(), receipt.MessageID).
+		First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Not one of ours, or sent before logging began
+			return nil
+		}
+		return fmt.Errorf("failed to load SMS message: %w", err)
+	}
+	return s.applyReceipt(ctx, &message, receipt)
+}
+
+// PollDeliveryStatus fetches receipts for recent messages without a final
+// status, for gateways that don't post them back. It returns the number of
+// messages whose status changed.
+func (s *SMSService) PollDeliveryStatus(ctx context.Context) (int, error) {
+	poller, ok := s.gateway.(SMSStatusPoller)
+	if !ok {
+		return 0, nil
+	}
+
+	var pending []models.SMSMessage
+	if err := s.db.WithContext(ctx).
+		Where("provider = ? AND status IN ? AND provider_message_id <> '' AND created_at >= ?",
+			s.gateway.Name(), []models.SMSStatus{models.SMSQueued, models.SMSSent}, time.Now().UTC().Add(-smsReceiptWindow)).
+		Order("created_at ASC").Limit(smsPollBatchSize).
+		Find(&pending).Error; err != nil {
+		return 0, fmt.Errorf("failed to load SMS messages: %w", err)
+	}
+
+	changed := 0
+	for i := range pending {
+		message := &pending[i]
+		receipt, err := poller.Status(ctx, message.ProviderMessageID)
+		if err != nil {
+			return changed, err
+		}
+		if receipt.Status == message.Status {
+			continue
+		}
+		if err := s.applyReceipt(ctx, message, receipt); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// Phone verification
+
+// SendPhoneVerification texts a one-time code to the customer's phone
+// number. Confirming it marks the number verified.
+func (s *SMSService) SendPhoneVerification(ctx context.Context, customerID uuid.UUID, createdBy *uuid.UUID) (*models.PhoneVerification, error) {
+	if s.gateway == nil {
+		return nil, ErrSMSUnavailable
+	}
+
+	var customer models.Customer
+	if err := s.db.WithContext(ctx).First(&customer, "id = ?", customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer: %w", err)
+	}
+	phone, err := NormalizePhone(customer.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	var recent int64
+	if err := s.db.WithContext(ctx).Model(&models.PhoneVerification{}).
+		Where("customer_id = ? AND created_at > ?", customerID, time.Now().UTC().Add(-otpResendDelay)).
+		Count(&recent).Error; err != nil {
+		return nil, fmt.Errorf("failed to check verification codes: %w", err)
+	}
+	if recent > 0 {
+		return nil, ErrVerificationTooSoon
+	}
+
+	code, err := generateOTP()
+	if err != nil {
+		return nil, err
+	}
+	verification := &models.PhoneVerification{
+		CustomerID: customerID,
+		Phone:      phone,
+		ExpiresAt:  time.Now().UTC().Add(s.config.OTPTTL),
+		CreatedBy:  createdBy,
+	}
+	verification.ID = uuid.New()
+	verification.CodeHash = hashSecret(verification.ID.String() + ":" + code)
+	if err := s.db.WithContext(ctx).Create(verification).Error; err != nil {
+		return nil, fmt.Errorf("failed to save verification code: %w", err)
+	}
+
+	minutes := strconv.Itoa(int(s.config.OTPTTL.Minutes()))
+	text := s.Render(ctx, SMSTemplatePhoneVerification, map[string]string{"code": code, "minutes": minutes},
+		fmt.Sprintf("Your verification code is %s. It expires in %s minutes. Never share it with anyone.", code, minutes))
+	if _, err := s.SendSMS(ctx, SMSRequest{
+		To:         phone,
+		Text:       text,
+		CustomerID: &customerID,
+		Template:   SMSTemplatePhoneVerification,
+		Priority:   true,
+	}); err != nil {
+		s.db.WithContext(ctx).Unscoped().Delete(verification)
+		return nil, err
+	}
+	return verification, nil
+}
+
+// ConfirmPhoneVerification checks the code last sent to the customer and
+// marks their phone number verified when it matches
+func (s *SMSService) ConfirmPhoneVerification(ctx context.Context, customerID uuid.UUID, code string) (*models.Customer, error) {
+	var customer models.Customer
+	if err := s.db.WithContext(ctx).First(&customer, "id = ?", customerID).Error; err != nil {
+		return nil, fmt.Errorf("customer: %w", err)
+	}
+	phone, err := NormalizePhone(customer.Phone)
+	if err != nil {
+		return nil, err
+	}
+
+	var verification models.PhoneVerification
+	if err := s.db.WithContext(ctx).Where("customer_id = ? AND verified_at IS NULL", customerID).
+		Order("created_at DESC").First(&verification).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVerificationNotFound
+		}
+		return nil, fmt.Errorf("failed to load verification code: %w", err)
+	}
+	// A code sent to the customer's previous number doesn't verify this one
+	if verification.Phone != phone {
+		return nil, ErrVerificationNotFound
+	}
+	if time.Now().UTC().After(verification.ExpiresAt) {
+		return nil, ErrVerificationExpired
+	}
+	if verification.Attempts >= s.config.OTPMaxAttempts {
+		return nil, ErrVerificationLocked
+	}
+
+	// Count the attempt first so concurrent guesses can't exceed the limit
+	result := s.db.WithContext(ctx).Model(&models.PhoneVerification{}).
+		Where("id = ? AND attempts < ?", verification.ID, s.config.OTPMaxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to record verification attempt: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrVerificationLocked
+	}
+	if hashSecret(verification.ID.String()+":"+strings.TrimSpace(code)) != verification.CodeHash {
+		return nil, ErrVerificationIncorrect
+	}
+
+	now := time.Now().UTC()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&verification).Update("verified_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Model(&customer).Update("phone_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify phone number: %w", err)
+	}
+	customer.PhoneVerifiedAt = &now
+	return &customer, nil
+}
+
+// Private helper methods
+
+// applyReceipt records a delivery receipt. Receipts can arrive out of order,
+// so a final status is never replaced.
+func (s *SMSService) applyReceipt(ctx context.Context, message *models.SMSMessage, receipt *SMSReceipt) error {
+	if message.Status.IsFinal() {
+		return nil
+	}
+
+	updates := map[string]interface{}{
+		"status":          receipt.Status,
+		"provider_status": receipt.ProviderStatus,
+	}
+	if receipt.Error != "" {
+		updates["error"] = receipt.Error
+	}
+	if receipt.Status == models.SMSDelivered {
+		updates["delivered_at"] = time.Now().UTC()
+	}
+	if err := s.db.WithContext(ctx).Model(message).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record SMS receipt: %w", err)
+	}
+	return nil
+}
+
+// renderSMSTemplate replaces each {{name}} in body with data["name"]
+func renderSMSTemplate(body string, data map[string]string) string {
+	pairs := make([]string, 0, len(data)*2)
+	for name, value := range data {
+		pairs = append(pairs, "{{"+name+"}}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(body)
+}
+
+func generateOTP() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < otpLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %w", err)
+	}
+	return fmt.Sprintf("%0*d", otpLength, n), nil
+}
+
+// Request/Response types
+
+// SMSRequest is one text message. Template names the template Text was
+// rendered from, for the log.
+type SMSRequest struct {
+	To         string
+	Text       string
+	CustomerID *uuid.UUID
+	Template   string
+	Priority   bool
+}
+
+// SMSText asks for a notification's SMS to be written from a stored template
+// rather than the notification body
+type SMSText struct {
+	Template string            `json:"template"`
+	Data     map[string]string `json:"data,omitempty"`
+}
+
+type SMSTemplateRequest struct {
+	Name        string `json:"name" binding:"required,max=100"`
+	Description string `json:"description" binding:"max=255"`
+	Body        string `json:"body" binding:"required"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+type UpdateSMSTemplateRequest struct {
+	Description *string `json:"description" binding:"omitempty,max=255"`
+	Body        *string `json:"body"`
+	IsActive    *bool   `json:"is_active"`
+}
+
+type ConfirmPhoneVerificationRequest struct {
+	Code string `json:"code" binding:"required"`
+}
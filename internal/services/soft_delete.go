@@ -0,0 +1,12 @@
+package services
+
+import "gorm.io/gorm"
+
+// WithDeleted is a Preload condition that includes soft-deleted records, for
+// history that has to keep showing a product or customer after it was
+// deleted:
+//
+//	db.Preload("SaleItems.Product", services.WithDeleted).First(&sale, id)
+func WithDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
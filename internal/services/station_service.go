@@ -0,0 +1,569 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/realtime"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTerminalNotPaired   = errors.New("the terminal has no paired station to send jobs to")
+	ErrSaleOtherBranch     = errors.New("the sale was made at another branch")
+	ErrLabelFormat         = errors.New("label format must be pdf or escpos")
+	ErrLabelSource         = errors.New("labels are printed for either a sale_id or an order_id")
+	ErrStationJobNotSent   = errors.New("the job is not waiting on this station's result")
+	ErrStationJobNotQueued = errors.New("only jobs not yet sent to the station can be cancelled")
+	ErrStationJobNotFailed = errors.New("only failed, expired or cancelled jobs can be sent again")
+)
+
+// stationClaimLimit is the most jobs an agent is handed in one poll
+const stationClaimLimit = 10
+
+// StationService queues print and cash drawer jobs for the agents running
+// beside paired terminals, hands them out when an agent polls and tracks
+// how they went. An agent that doesn't report back gets a job again once
+// its lease runs out; jobs nobody takes in time expire.
+type StationService struct {
+	db       *gorm.DB
+	labels   *LabelService
+	pharmacy labels.Pharmacy
+	config   config.StationConfig
+	events   *realtime.Hub
+}
+
+func NewStationService(db *gorm.DB, labelService *LabelService, pharmacy config.PharmacyConfig, cfg config.StationConfig) *StationService {
+	return &StationService{
+		db:     db,
+		labels: labelService,
+		pharmacy: labels.Pharmacy{
+			Name:          pharmacy.Name,
+			Address:       pharmacy.Address,
+			Phone:         pharmacy.Phone,
+			LicenseNumber: pharmacy.LicenseNumber,
+		},
+		config: cfg,
+	}
+}
+
+// SetEvents pushes job status changes to the screens watching them
+func (s *StationService) SetEvents(events *realtime.Hub) {
+	s.events = events
+}
+
+// PollInterval is how often agents are told to poll
+func (s *StationService) PollInterval() time.Duration {
+	return s.config.PollInterval
+}
+
+// QueueReceipt queues a sale's receipt for the terminal's receipt printer.
+// The cash drawer opens with it for cash sales unless req.OpenDrawer says
+// otherwise.
+func (s *StationService) QueueReceipt(ctx context.Context, terminal *models.Terminal, req ReceiptJobRequest, userID uuid.UUID) (*models.StationJob, error) {
+	var sale models.Sale
+	if err := s.db.WithContext(ctx).
+		Preload("Customer", WithDeleted).Preload("Cashier").Preload("Pharmacist").
+		Preload("SaleItems.Product", WithDeleted).Preload("SaleItems.Service", WithDeleted).
+		First(&sale, "id = ?", req.SaleID).Error; err != nil {
+		return nil, fmt.Errorf("sale: %w", err)
+	}
+	if sale.BranchID != nil && *sale.BranchID != terminal.BranchID {
+		return nil, ErrSaleOtherBranch
+	}
+
+	openDrawer := sale.PaymentMethod == models.PaymentMethodCash
+	if req.OpenDrawer != nil {
+		openDrawer = *req.OpenDrawer
+	}
+
+	receipt := s.receipt(&sale, terminal)
+	job := &models.StationJob{
+		Kind:        models.StationJobReceipt,
+		Device:      models.DeviceReceiptPrinter,
+		Format:      "escpos",
+		ContentType: "application/octet-stream",
+		Payload:     labels.RenderReceiptESCPOS(receipt, openDrawer),
+		Reference:   receipt.Reference,
+		SaleID:      &sale.ID,
+		RequestedBy: &userID,
+	}
+	if err := s.Enqueue(ctx, terminal, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// QueueLabels queues dispensing labels for a sale or an online order, or
+// one line of it, for the terminal's label printer
+func (s *StationService) QueueLabels(ctx context.Context, terminal *models.Terminal, req LabelJobRequest, userID uuid.UUID) (*models.StationJob, error) {
+	if (req.SaleID == nil) == (req.OrderID == nil) {
+		return nil, ErrLabelSource
+	}
+	format := req.Format
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "escpos" {
+		return nil, ErrLabelFormat
+	}
+
+	job := &models.StationJob{
+		Kind:        models.StationJobLabel,
+		Device:      models.DeviceLabelPrinter,
+		Format:      format,
+		SaleID:      req.SaleID,
+		OrderID:     req.OrderID,
+		RequestedBy: &userID,
+	}
+
+	var printed []labels.Label
+	var err error
+	if req.SaleID != nil {
+		var sale models.Sale
+		if err := s.db.WithContext(ctx).Select("id, sale_number, branch_id").First(&sale, "id = ?", *req.SaleID).Error; err != nil {
+			return nil, fmt.Errorf("sale: %w", err)
+		}
+		if sale.BranchID != nil && *sale.BranchID != terminal.BranchID {
+			return nil, ErrSaleOtherBranch
+		}
+		job.Reference = sale.SaleNumber
+		printed, err = s.labels.SaleLabels(ctx, *req.SaleID, req.ItemID)
+	} else {
+		var order models.OnlineOrder
+		if err := s.db.WithContext(ctx).Select("id, order_number").First(&order, "id = ?", *req.OrderID).Error; err != nil {
+			return nil, fmt.Errorf("order: %w", err)
+		}
+		job.Reference = order.OrderNumber
+		printed, err = s.labels.OrderLabels(ctx, *req.OrderID, req.ItemID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "pdf" {
+		job.ContentType = "application/pdf"
+		job.Payload = labels.RenderPDF(printed)
+	} else {
+		job.ContentType = "application/octet-stream"
+		job.Payload = labels.RenderESCPOS(printed)
+	}
+	if err := s.Enqueue(ctx, terminal, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// QueuePickList queues a pick list for the terminal's receipt printer
+func (s *StationService) QueuePickList(ctx context.Context, terminal *models.Terminal, list labels.PickList, userID uuid.UUID) (*models.StationJob, error) {
+	job := &models.StationJob{
+		Kind:        models.StationJobPickList,
+		Device:      models.DeviceReceiptPrinter,
+		Format:      "escpos",
+		ContentType: "application/octet-stream",
+		Payload:     labels.RenderPickListESCPOS(list),
+		RequestedBy: &userID,
+	}
+	// The orders it covers, as far as they fit
+	job.Reference = strings.Join(list.Orders, ", ")
+	if len(job.Reference) > 100 {
+		job.Reference = job.Reference[:97] + "..."
+	}
+	if err := s.Enqueue(ctx, terminal, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// OpenDrawer queues a no-sale opening of the terminal's cash drawer
+func (s *StationService) OpenDrawer(ctx context.Context, terminal *models.Terminal, req OpenDrawerRequest, userID uuid.UUID) (*models.StationJob, error) {
+	job := &models.StationJob{
+		Kind:        models.StationJobOpenDrawer,
+		Device:      models.DeviceCashDrawer,
+		Format:      "escpos",
+		ContentType: "application/octet-stream",
+		Payload:     labels.RenderDrawerKick(),
+		Reason:      req.Reason,
+		RequestedBy: &userID,
+	}
+	if err := s.Enqueue(ctx, terminal, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Enqueue queues a rendered job for the terminal's station, which has to
+// be paired to ever take it
+func (s *StationService) Enqueue(ctx context.Context, terminal *models.Terminal, job *models.StationJob) error {
+	if !terminal.IsActive || terminal.PairedAt == nil {
+		return ErrTerminalNotPaired
+	}
+
+	job.TerminalID = terminal.ID
+	job.BranchID = terminal.BranchID
+	job.Status = models.StationJobQueued
+	job.ExpiresAt = time.Now().UTC().Add(s.ttl(job.Kind))
+	if err := s.db.WithContext(ctx).Create(job).Error; err != nil {
+		return fmt.Errorf("failed to queue station job: %w", err)
+	}
+	s.announce(ctx, job)
+	return nil
+}
+
+// ListJobs returns a terminal's jobs, newest first
+func (s *StationService) ListJobs(ctx context.Context, filter StationJobFilter) ([]models.StationJob, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.StationJob{}).Where("terminal_id = ?", filter.TerminalID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count station jobs: %w", err)
+	}
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+
+	var jobs []models.StationJob
+	if err := query.Omit("payload").Order("created_at DESC").
+		Limit(filter.Limit).Offset(filter.Offset).Find(&jobs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load station jobs: %w", err)
+	}
+	return jobs, total, nil
+}
+
+func (s *StationService) GetJob(ctx context.Context, id uuid.UUID) (*models.StationJob, error) {
+	var job models.StationJob
+	if err := s.db.WithContext(ctx).Omit("payload").First(&job, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("station job: %w", err)
+	}
+	return &job, nil
+}
+
+// Cancel withdraws a job the station hasn't taken yet
+func (s *StationService) Cancel(ctx context.Context, id uuid.UUID) (*models.StationJob, error) {
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	ok, err := s.transition(ctx, job, models.StationJobQueued, map[string]interface{}{
+		"status":       models.StationJobCancelled,
+		"completed_at": now,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrStationJobNotQueued
+	}
+	job.Status, job.CompletedAt = models.StationJobCancelled, &now
+	s.announce(ctx, job)
+	return job, nil
+}
+
+// Retry queues a job that failed, expired or was cancelled again, with
+// its attempts and time to live starting over
+func (s *StationService) Retry(ctx context.Context, id uuid.UUID) (*models.StationJob, error) {
+	job, err := s.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	switch job.Status {
+	case models.StationJobFailed, models.StationJobExpired, models.StationJobCancelled:
+	default:
+		return nil, ErrStationJobNotFailed
+	}
+
+	expiresAt := time.Now().UTC().Add(s.ttl(job.Kind))
+	ok, err := s.transition(ctx, job, job.Status, map[string]interface{}{
+		"status":       models.StationJobQueued,
+		"attempts":     0,
+		"sent_at":      nil,
+		"completed_at": nil,
+		"error":        "",
+		"expires_at":   expiresAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrStationJobNotFailed
+	}
+	job.Status, job.Attempts, job.SentAt, job.CompletedAt, job.Error = models.StationJobQueued, 0, nil, nil, ""
+	job.ExpiresAt = expiresAt
+	s.announce(ctx, job)
+	return job, nil
+}
+
+// Claim hands the terminal's agent its jobs that are due, oldest first:
+// those queued and those it was sent before but never reported back on.
+// Each is marked sent; the agent has the job lease to report how it went.
+func (s *StationService) Claim(ctx context.Context, terminal *models.Terminal) ([]StationWork, error) {
+	if _, err := s.expire(ctx, &terminal.ID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var due []models.StationJob
+	if err := s.db.WithContext(ctx).
+		Where("terminal_id = ? AND expires_at > ?", terminal.ID, now).
+		Where("(status = ? OR (status = ? AND sent_at < ? AND attempts < ?))",
+			models.StationJobQueued, models.StationJobSent, now.Add(-s.config.JobLease), s.config.MaxAttempts).
+		Order("created_at ASC").Limit(stationClaimLimit).
+		Find(&due).Error; err != nil {
+		return nil, fmt.Errorf("failed to load station jobs: %w", err)
+	}
+
+	work := make([]StationWork, 0, len(due))
+	for i := range due {
+		job := &due[i]
+		// Another poll by the same agent may have taken it meanwhile
+		ok, err := s.transition(ctx, job, job.Status, map[string]interface{}{
+			"status":   models.StationJobSent,
+			"attempts": job.Attempts + 1,
+			"sent_at":  now,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		job.Status, job.Attempts, job.SentAt = models.StationJobSent, job.Attempts+1, &now
+		s.announce(ctx, job)
+		work = append(work, StationWork{StationJob: *job, Payload: job.Payload})
+	}
+	return work, nil
+}
+
+// Report records how the terminal's agent got on with a job it was sent
+func (s *StationService) Report(ctx context.Context, terminal *models.Terminal, id uuid.UUID, req StationJobResult) (*models.StationJob, error) {
+	var job models.StationJob
+	if err := s.db.WithContext(ctx).Omit("payload").
+		First(&job, "id = ? AND terminal_id = ?", id, terminal.ID).Error; err != nil {
+		return nil, fmt.Errorf("station job: %w", err)
+	}
+	if job.Status != models.StationJobSent {
+		return nil, ErrStationJobNotSent
+	}
+
+	now := time.Now().UTC()
+	status := models.StationJobDone
+	if req.Status == "failed" {
+		status = models.StationJobFailed
+	}
+	ok, err := s.transition(ctx, &job, models.StationJobSent, map[string]interface{}{
+		"status":       status,
+		"completed_at": now,
+		"error":        strings.TrimSpace(req.Error),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrStationJobNotSent
+	}
+	job.Status, job.CompletedAt, job.Error = status, &now, strings.TrimSpace(req.Error)
+	s.announce(ctx, &job)
+	return &job, nil
+}
+
+// Sweep expires the jobs of every terminal that no agent took in time and
+// fails those sent as often as allowed without a result, returning how
+// many it settled. Agents sweep their own terminal's when they poll; this
+// catches the terminals whose agent is offline.
+func (s *StationService) Sweep(ctx context.Context) (int, error) {
+	return s.expire(ctx, nil)
+}
+
+// Private helper methods
+
+// expire settles the overdue jobs of one terminal, or all with a nil
+// terminalID
+func (s *StationService) expire(ctx context.Context, terminalID *uuid.UUID) (int, error) {
+	now := time.Now().UTC()
+	leaseCutoff := now.Add(-s.config.JobLease)
+
+	query := s.db.WithContext(ctx).Omit("payload").
+		Where("((status = ? AND expires_at <= ?) OR (status = ? AND sent_at < ? AND (attempts >= ? OR expires_at <= ?)))",
+			models.StationJobQueued, now, models.StationJobSent, leaseCutoff, s.config.MaxAttempts, now)
+	if terminalID != nil {
+		query = query.Where("terminal_id = ?", *terminalID)
+	}
+	var overdue []models.StationJob
+	if err := query.Limit(500).Find(&overdue).Error; err != nil {
+		return 0, fmt.Errorf("failed to load overdue station jobs: %w", err)
+	}
+
+	settled := 0
+	for i := range overdue {
+		job := &overdue[i]
+		status, reason := models.StationJobExpired, "no station took the job in time"
+		switch {
+		case job.Status == models.StationJobSent && job.Attempts >= s.config.MaxAttempts:
+			status, reason = models.StationJobFailed, fmt.Sprintf("the station did not report back after %d attempts", job.Attempts)
+		case job.Status == models.StationJobSent:
+			reason = "the station did not report back in time"
+		}
+		ok, err := s.transition(ctx, job, job.Status, map[string]interface{}{
+			"status":       status,
+			"completed_at": now,
+			"error":        reason,
+		})
+		if err != nil {
+			return settled, err
+		}
+		if !ok {
+			continue
+		}
+		job.Status, job.CompletedAt, job.Error = status, &now, reason
+		s.announce(ctx, job)
+		settled++
+	}
+	return settled, nil
+}
+
+// transition applies updates to the job if it is still in status from with
+// the attempts it was loaded with, reporting whether it was
+func (s *StationService) transition(ctx context.Context, job *models.StationJob, from models.StationJobStatus, updates map[string]interface{}) (bool, error) {
+	result := s.db.WithContext(ctx).Model(&models.StationJob{}).
+		Where("id = ? AND status = ? AND attempts = ?", job.ID, from, job.Attempts).
+		Updates(updates)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update station job: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (s *StationService) announce(ctx context.Context, job *models.StationJob) {
+	s.events.Publish(ctx, realtime.TopicStationJobs, &job.BranchID, StationJobEvent{
+		JobID:      job.ID,
+		TerminalID: job.TerminalID,
+		Kind:       job.Kind,
+		Status:     job.Status,
+		Reference:  job.Reference,
+		Attempts:   job.Attempts,
+		Error:      job.Error,
+	})
+}
+
+func (s *StationService) ttl(kind models.StationJobKind) time.Duration {
+	if kind == models.StationJobOpenDrawer {
+		return s.config.DrawerJobTTL
+	}
+	return s.config.PrintJobTTL
+}
+
+// receipt lays out a sale as its receipt
+func (s *StationService) receipt(sale *models.Sale, terminal *models.Terminal) labels.Receipt {
+	receipt := labels.Receipt{
+		Pharmacy:      s.pharmacy,
+		Reference:     sale.SaleNumber,
+		MachineID:     terminal.MachineID,
+		SoldAt:        sale.CreatedAt,
+		PaymentMethod: strings.ToUpper(string(sale.PaymentMethod)),
+		Subtotal:      sale.Subtotal.String(),
+		Tax:           sale.Tax.String(),
+		Total:         sale.Total.String(),
+		Currency:      sale.Currency,
+		Footer:        "Thank you! Please keep this receipt for returns.",
+	}
+	if sale.InvoiceNumber != nil {
+		receipt.Reference = *sale.InvoiceNumber
+	}
+	if sale.Discount != 0 {
+		receipt.Discount = sale.Discount.String()
+	}
+	if sale.Customer != nil {
+		receipt.Customer = sale.Customer.FirstName + " " + sale.Customer.LastName
+	}
+	cashier := sale.Cashier
+	if cashier == nil {
+		cashier = sale.Pharmacist
+	}
+	if cashier != nil {
+		receipt.Cashier = cashier.FirstName + " " + cashier.LastName
+	}
+
+	for _, item := range sale.SaleItems {
+		line := labels.ReceiptLine{
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice.String(),
+			Total:     item.TotalPrice.String(),
+		}
+		switch {
+		case item.Product != nil:
+			line.Description = item.Product.Name
+		case item.Service != nil:
+			line.Description = item.Service.Name
+		default:
+			line.Description = "Item"
+		}
+		receipt.Lines = append(receipt.Lines, line)
+	}
+	return receipt
+}
+
+// Request/Response types
+
+type ReceiptJobRequest struct {
+	SaleID     uuid.UUID `json:"sale_id" binding:"required"`
+	OpenDrawer *bool     `json:"open_drawer"` // defaults to whether the sale was paid in cash
+}
+
+type LabelJobRequest struct {
+	SaleID  *uuid.UUID `json:"sale_id"`
+	OrderID *uuid.UUID `json:"order_id"`
+	ItemID  *uuid.UUID `json:"item_id"` // to print a single line
+	Format  string     `json:"format"`  // pdf (default) or escpos
+}
+
+type OpenDrawerRequest struct {
+	Reason string `json:"reason" binding:"required,max=255"`
+}
+
+type StationJobFilter struct {
+	TerminalID uuid.UUID
+	Status     models.StationJobStatus
+	Kind       models.StationJobKind
+	Limit      int
+	Offset     int
+}
+
+// StationWork is a job as handed to the agent, with what to send the
+// device base64 encoded in payload
+type StationWork struct {
+	models.StationJob
+	Payload []byte `json:"payload"`
+}
+
+// StationJobResult is what the agent reports back about a job
+type StationJobResult struct {
+	Status string `json:"status" binding:"required,oneof=done failed"`
+	Error  string `json:"error" binding:"max=2000"` // why it failed, e.g. the printer is out of paper
+}
+
+// StationJobEvent is pushed on realtime.TopicStationJobs when a job
+// changes status
+type StationJobEvent struct {
+	JobID      uuid.UUID               `json:"job_id"`
+	TerminalID uuid.UUID               `json:"terminal_id"`
+	Kind       models.StationJobKind   `json:"kind"`
+	Status     models.StationJobStatus `json:"status"`
+	Reference  string                  `json:"reference,omitempty"`
+	Attempts   int                     `json:"attempts"`
+	Error      string                  `json:"error,omitempty"`
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"pharmacy-backend/internal/cache"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/realtime"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInsufficientStock = errors.New("not enough stock")
+	ErrStockChanged      = errors.New("stock changed while it was being updated, try again")
+)
+
+// StockService changes stock levels. Every change is a single conditional
+// UPDATE of the product's stock, so concurrent sales, orders and
+// adjustments can't overwrite each other or sell stock that isn't there.
+type StockService struct {
+	db     *gorm.DB
+	outbox *OutboxService
+	events *realtime.Hub
+	cache  *cache.Cache
+}
+
+func NewStockService(db *gorm.DB) *StockService {
+	return &StockService{db: db}
+}
+
+// SetOutbox alerts staff, through the outbox, when a change takes a product
+// down to its minimum stock
+func (s *StockService) SetOutbox(outbox *OutboxService) {
+	s.outbox = outbox
+}
+
+// SetEvents pushes stock levels to the screens watching them once changes
+// are announced
+func (s *StockService) SetEvents(events *realtime.Hub) {
+	s.events = events
+}
+
+// SetCache drops cached product listings once changes are announced, as
+// they show stock levels
+func (s *StockService) SetCache(responses *cache.Cache) {
+	s.cache = responses
+}
+
+// Apply changes a product's stock in tx and records the movement. It fails
+// with ErrInsufficientStock rather than take stock below zero, at the
+// branch when the change is at one, and with ErrStockChanged when
+// ExpectedStock is set and the stock is no longer that. tx must be rolled
+// back on an error.
+func (s *StockService) Apply(tx *gorm.DB, change StockChange) (*models.StockMovement, error) {
+	query := tx.Model(&models.Product{}).Where("id = ?", change.ProductID)
+	if change.ExpectedStock != nil {
+		query = query.Where("stock = ?", *change.ExpectedStock)
+	}
+	if change.Quantity < 0 {
+		query = query.Where("stock >= ?", -change.Quantity)
+	}
+	result := query.Update("stock", gorm.Expr("stock + ?", change.Quantity))
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update stock: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		var product models.Product
+		if err := tx.Select("id").First(&product, "id = ?", change.ProductID).Error; err != nil {
+			return nil, fmt.Errorf("product: %w", err)
+		}
+		if change.ExpectedStock != nil {
+			return nil, ErrStockChanged
+		}
+		return nil, ErrInsufficientStock
+	}
+
+	// The update holds the product's row until tx ends, so the branch's
+	// stock, summed from its movements, can't move under us either
+	if change.BranchID != nil && change.Quantity < 0 {
+		branchStock, err := stockOf(tx, *change.BranchID, change.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		if branchStock+change.Quantity < 0 {
+			return nil, ErrInsufficientStock
+		}
+	}
+
+	var product models.Product
+	if err := tx.Select("id", "name", "stock", "min_stock").First(&product, "id = ?", change.ProductID).Error; err != nil {
+		return nil, fmt.Errorf("failed to read stock: %w", err)
+	}
+
+	quantity := change.Quantity
+	if quantity < 0 {
+		quantity = -quantity
+	}
+	movement := &models.StockMovement{
+		ProductID:   change.ProductID,
+		BranchID:    change.BranchID,
+		Type:        change.Type,
+		Quantity:    quantity,
+		Reason:      change.Reason,
+		Reference:   change.Reference,
+		StockBefore: product.Stock - change.Quantity,
+		StockAfter:  product.Stock,
+		UserID:      change.UserID,
+		Notes:       change.Notes,
+	}
+	if err := tx.Create(movement).Error; err != nil {
+		return nil, fmt.Errorf("failed to record stock movement: %w", err)
+	}
+
+	// Alert once, as the stock crosses the minimum
+	if s.outbox != nil && movement.StockBefore > product.MinStock && movement.StockAfter <= product.MinStock {
+		if err := s.outbox.QueueStaffAlert(tx, StaffAlertMessage{
+			Alert: models.StaffAlertLowStock,
+			Title: "Low stock: " + product.Name,
+			Body:  fmt.Sprintf("%s is down to %d in stock (minimum %d).", product.Name, product.Stock, product.MinStock),
+			Data:  map[string]string{"product_id": product.ID.String()},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return movement, nil
+}
+
+// Announce pushes the stock levels movements left to the screens watching
+// them, and drops cached product listings. It is called once the
+// transaction that applied them has committed, so a change that was rolled
+// back is never shown.
+func (s *StockService) Announce(ctx context.Context, movements ...*models.StockMovement) {
+	if len(movements) > 0 {
+		s.cache.Invalidate(ctx, cache.Products)
+	}
+	if s.events == nil {
+		return
+	}
+	for _, movement := range movements {
+		if movement == nil {
+			continue
+		}
+		level := StockLevelEvent{
+			ProductID:    movement.ProductID,
+			BranchID:     movement.BranchID,
+			Stock:        movement.StockAfter,
+			Change:       movement.StockAfter - movement.StockBefore,
+			MovementType: movement.Type,
+		}
+		if movement.BranchID != nil {
+			branchStock, err := stockOf(s.db.WithContext(ctx), *movement.BranchID, movement.ProductID)
+			if err != nil {
+				continue
+			}
+			level.BranchStock = &branchStock
+		}
+		s.events.Publish(ctx, realtime.TopicStock, movement.BranchID, level)
+	}
+}
+
+// Private helper methods
+
+// stockOf returns the branch's stock of a product, summed from its
+// movements in tx
+func stockOf(tx *gorm.DB, branchID, productID uuid.UUID) (int, error) {
+	var stock int
+	if err := tx.Model(&models.StockMovement{}).
+		Select("COALESCE(SUM(stock_after - stock_before), 0)").
+		Where("branch_id = ? AND product_id = ?", branchID, productID).
+		Scan(&stock).Error; err != nil {
+		return 0, fmt.Errorf("failed to read branch stock: %w", err)
+	}
+	return stock, nil
+}
+
+// Request/Response types
+
+// StockChange is a change to a product's stock and the movement recorded
+// for it. Quantity is negative for stock going out.
+type StockChange struct {
+	ProductID uuid.UUID
+	BranchID  *uuid.UUID
+	Quantity  int
+	Type      models.MovementType
+	Reason    string
+	Reference *string
+	UserID    *uuid.UUID
+	Notes     string
+
+	// ExpectedStock makes the change only if the product's stock is still
+	// this, for changes worked out from a level read earlier
+	ExpectedStock *int
+}
+
+// StockLevelEvent is a product's stock after a change, as pushed to the
+// screens watching stock. BranchStock is the branch's stock when the
+// change was at one.
+type StockLevelEvent struct {
+	ProductID    uuid.UUID           `json:"product_id"`
+	BranchID     *uuid.UUID          `json:"branch_id,omitempty"`
+	Stock        int                 `json:"stock"`
+	BranchStock  *int                `json:"branch_stock,omitempty"`
+	Change       int                 `json:"change"`
+	MovementType models.MovementType `json:"movement_type"`
+}
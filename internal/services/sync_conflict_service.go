@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrSyncConflictReviewed = errors.New("sync conflict has already been reviewed")
+
+// SyncConflictService lets admins review rows that were changed in two
+// databases between syncs. The sync applies the later change; a review
+// either accepts that or restores the version it discarded.
+type SyncConflictService struct {
+	db *gorm.DB
+}
+
+func NewSyncConflictService(db *gorm.DB) *SyncConflictService {
+	return &SyncConflictService{db: db}
+}
+
+// ListConflicts returns conflicts, newest first, optionally filtered by
+// status and table
+func (s *SyncConflictService) ListConflicts(ctx context.Context, status, table string, limit, offset int) ([]models.SyncConflict, int64, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.SyncConflict{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if table != "" {
+		query = query.Where("table_name = ?", table)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count sync conflicts: %w", err)
+	}
+
+	var conflicts []models.SyncConflict
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&conflicts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load sync conflicts: %w", err)
+	}
+	return conflicts, total, nil
+}
+
+func (s *SyncConflictService) GetConflict(ctx context.Context, id uuid.UUID) (*models.SyncConflict, error) {
+	var conflict models.SyncConflict
+	if err := s.db.WithContext(ctx).First(&conflict, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("sync conflict: %w", err)
+	}
+	return &conflict, nil
+}
+
+// ResolveConflict closes an open conflict. Reverting writes the discarded
+// version back over the row with a new updated_at, so that it also wins in
+// the other database on the next sync.
+func (s *SyncConflictService) ResolveConflict(ctx context.Context, id, reviewerID uuid.UUID, req ResolveSyncConflictRequest) (*models.SyncConflict, error) {
+	var conflict models.SyncConflict
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&conflict, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("sync conflict: %w", err)
+		}
+		if conflict.Status != models.SyncConflictOpen {
+			return ErrSyncConflictReviewed
+		}
+
+		conflict.Status = models.SyncConflictAccepted
+		if req.Action == "revert" {
+			if err := restoreDiscardedVersion(tx, &conflict); err != nil {
+				return err
+			}
+			conflict.Status = models.SyncConflictReverted
+		}
+
+		now := time.Now()
+		conflict.ReviewedBy = &reviewerID
+		conflict.ReviewedAt = &now
+		conflict.ReviewNotes = req.Notes
+		return tx.Save(&conflict).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+// Private helper methods
+
+// restoreDiscardedVersion writes the losing version of a conflicting row
+// back. Product stock is left alone as it follows the stock movements.
+func restoreDiscardedVersion(tx *gorm.DB, conflict *models.SyncConflict) error {
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(conflict.DiscardedData), &values); err != nil {
+		return fmt.Errorf("failed to read discarded version: %w", err)
+	}
+	delete(values, "id")
+	delete(values, "created_at")
+	if conflict.TableName == "products" {
+		delete(values, "stock")
+	}
+	values["updated_at"] = time.Now()
+
+	result := tx.Table(conflict.TableName).Where("id = ?", conflict.RowID).Updates(values)
+	if result.Error != nil {
+		return fmt.Errorf("failed to restore discarded version: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%s %s: %w", conflict.TableName, conflict.RowID, gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// Request/Response types
+
+type ResolveSyncConflictRequest struct {
+	Action string `json:"action" binding:"required,oneof=accept revert"`
+	Notes  string `json:"notes" binding:"max=1000"`
+}
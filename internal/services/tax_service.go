@@ -0,0 +1,118 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TaxService works out the VAT on sales and orders. The rate is the
+// branch's own, or the pharmacy's when the branch has none; a branch with
+// a zero rate, such as one in an economic zone, makes zero-rated sales.
+// VAT-exempt products, and everything sold to a customer with a verified
+// senior citizen or PWD ID, are VAT-exempt.
+type TaxService struct {
+	db          *gorm.DB
+	defaultRate float64
+	currencies  *CurrencyService
+}
+
+func NewTaxService(db *gorm.DB, defaultRate float64, currencies *CurrencyService) *TaxService {
+	return &TaxService{db: db, defaultRate: defaultRate, currencies: currencies}
+}
+
+// Rate returns the VAT rate at the branch, read in tx
+func (s *TaxService) Rate(tx *gorm.DB, branchID *uuid.UUID) (float64, error) {
+	if branchID == nil {
+		return s.defaultRate, nil
+	}
+
+	var branch models.Branch
+	if err := tx.Select("tax_rate").First(&branch, "id = ?", *branchID).Error; err != nil {
+		return 0, fmt.Errorf("branch: %w", err)
+	}
+	if branch.TaxRate == nil {
+		return s.defaultRate, nil
+	}
+	return *branch.TaxRate, nil
+}
+
+// Compute returns the tax breakdown of the lines sold at the branch to the
+// customer, read in tx. Lines are amounts after their own discounts.
+func (s *TaxService) Compute(tx *gorm.DB, branchID, customerID *uuid.UUID, lines []TaxLine) (models.TaxBreakdown, error) {
+	var breakdown models.TaxBreakdown
+
+	rate, err := s.Rate(tx, branchID)
+	if err != nil {
+		return breakdown, err
+	}
+	breakdown.Rate = rate
+
+	if customerID != nil {
+		var customer models.Customer
+		if err := tx.First(&customer, "id = ?", *customerID).Error; err != nil {
+			return breakdown, fmt.Errorf("customer: %w", err)
+		}
+		breakdown.ExemptionType = customer.ActiveDiscountType(time.Now())
+	}
+
+	exemptProducts, err := s.exemptProducts(tx, lines)
+	if err != nil {
+		return breakdown, err
+	}
+	for _, line := range lines {
+		switch {
+		case breakdown.ExemptionType != "", line.ProductID != nil && exemptProducts[*line.ProductID]:
+			breakdown.VATExemptSales += line.Amount
+		case rate == 0:
+			breakdown.ZeroRatedSales += line.Amount
+		default:
+			breakdown.VATableSales += line.Amount
+		}
+	}
+	breakdown.VATableSales = s.currencies.Round(breakdown.VATableSales)
+	breakdown.VATExemptSales = s.currencies.Round(breakdown.VATExemptSales)
+	breakdown.ZeroRatedSales = s.currencies.Round(breakdown.ZeroRatedSales)
+	breakdown.VATAmount = s.currencies.Round(breakdown.VATableSales.MulRate(rate))
+	return breakdown, nil
+}
+
+// Private helper methods
+
+// exemptProducts returns which of the lines' products are VAT-exempt
+func (s *TaxService) exemptProducts(tx *gorm.DB, lines []TaxLine) (map[uuid.UUID]bool, error) {
+	var productIDs []uuid.UUID
+	for _, line := range lines {
+		if line.ProductID != nil {
+			productIDs = append(productIDs, *line.ProductID)
+		}
+	}
+	exempt := make(map[uuid.UUID]bool)
+	if len(productIDs) == 0 {
+		return exempt, nil
+	}
+
+	var exemptIDs []uuid.UUID
+	if err := tx.Model(&models.Product{}).
+		Where("id IN ? AND vat_exempt = ?", productIDs, true).
+		Pluck("id", &exemptIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to load VAT-exempt products: %w", err)
+	}
+	for _, id := range exemptIDs {
+		exempt[id] = true
+	}
+	return exempt, nil
+}
+
+// Request/Response types
+
+// TaxLine is a sale or order line as far as VAT is concerned. ProductID is
+// nil for services.
+type TaxLine struct {
+	ProductID *uuid.UUID
+	Amount    models.Money
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPairingCodeInvalid = errors.New("pairing code is invalid or has expired")
+	ErrTerminalUnknown    = errors.New("terminal is not paired or is inactive")
+)
+
+const (
+	pairingCodeTTL      = 15 * time.Minute
+	pairingCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789" // no look-alikes
+	pairingCodeLength   = 8
+
+	// lastSeenInterval limits how often a busy terminal's last-seen time is
+	// written
+	lastSeenInterval = time.Minute
+)
+
+// TerminalService registers POS terminals, pairs devices with them and
+// numbers the invoices of the sales they ring up
+type TerminalService struct {
+	db *gorm.DB
+}
+
+func NewTerminalService(db *gorm.DB) *TerminalService {
+	return &TerminalService{db: db}
+}
+
+// ListTerminals returns terminals by name, optionally for one branch
+func (s *TerminalService) ListTerminals(ctx context.Context, branchID *uuid.UUID) ([]models.Terminal, error) {
+	query := s.db.WithContext(ctx).Preload("Branch").Order("name ASC")
+	if branchID != nil {
+		query = query.Where("branch_id = ?", *branchID)
+	}
+
+	var terminals []models.Terminal
+	if err := query.Find(&terminals).Error; err != nil {
+		return nil, fmt.Errorf("failed to load terminals: %w", err)
+	}
+	return terminals, nil
+}
+
+func (s *TerminalService) GetTerminal(ctx context.Context, id uuid.UUID) (*models.Terminal, error) {
+	var terminal models.Terminal
+	if err := s.db.WithContext(ctx).First(&terminal, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("terminal: %w", err)
+	}
+	return &terminal, nil
+}
+
+func (s *TerminalService) CreateTerminal(ctx context.Context, req TerminalRequest) (*models.Terminal, error) {
+	if err := s.checkBranch(ctx, req.BranchID); err != nil {
+		return nil, err
+	}
+
+	terminal := &models.Terminal{
+		Name:              req.Name,
+		BranchID:          req.BranchID,
+		InvoicePrefix:     strings.ToUpper(req.InvoicePrefix),
+		NextInvoiceNumber: 1,
+		MachineID:         req.MachineID,
+		IsActive:          true,
+	}
+	if req.NextInvoiceNumber > 0 {
+		terminal.NextInvoiceNumber = req.NextInvoiceNumber
+	}
+	if req.IsActive != nil {
+		terminal.IsActive = *req.IsActive
+	}
+	if err := s.db.WithContext(ctx).Create(terminal).Error; err != nil {
+		return nil, fmt.Errorf("failed to create terminal: %w", err)
+	}
+	return terminal, nil
+}
+
+// UpdateTerminal changes a terminal's details. Its invoice series stays as
+// it is once it has issued invoices, so numbers are never reused.
+func (s *TerminalService) UpdateTerminal(ctx context.Context, id uuid.UUID, req TerminalRequest) (*models.Terminal, error) {
+	var terminal models.Terminal
+	if err := s.db.WithContext(ctx).First(&terminal, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("terminal: %w", err)
+	}
+	if err := s.checkBranch(ctx, req.BranchID); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"name":       req.Name,
+		"branch_id":  req.BranchID,
+		"machine_id": req.MachineID,
+	}
+	if req.IsActive != nil {
+		updates["is_active"] = *req.IsActive
+	}
+	if terminal.NextInvoiceNumber == 1 {
+		updates["invoice_prefix"] = strings.ToUpper(req.InvoicePrefix)
+		if req.NextInvoiceNumber > 0 {
+			updates["next_invoice_number"] = req.NextInvoiceNumber
+		}
+	}
+	if err := s.db.WithContext(ctx).Model(&terminal).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to update terminal: %w", err)
+	}
+	if err := s.db.WithContext(ctx).First(&terminal, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("terminal: %w", err)
+	}
+	return &terminal, nil
+}
+
+// StartPairing issues a one-time code a device enters to pair with the
+// terminal. A new code replaces any earlier one; the device already paired
+// keeps working until another device pairs.
+func (s *TerminalService) StartPairing(ctx context.Context, id uuid.UUID) (string, time.Time, error) {
+	code, err := generatePairingCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().UTC().Add(pairingCodeTTL)
+
+	result := s.db.WithContext(ctx).Model(&models.Terminal{}).
+		Where("id = ? AND is_active = ?", id, true).
+		Updates(map[string]interface{}{
+			"pairing_code_hash":  hashSecret(code),
+			"pairing_expires_at": expiresAt,
+		})
+	if result.Error != nil {
+		return "", time.Time{}, fmt.Errorf("failed to start pairing: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return "", time.Time{}, fmt.Errorf("terminal: %w", gorm.ErrRecordNotFound)
+	}
+	return code, expiresAt, nil
+}
+
+// Pair redeems a pairing code and returns the device token the device
+// sends from then on. The code works once.
+func (s *TerminalService) Pair(ctx context.Context, code string) (*models.Terminal, string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate device token: %w", err)
+	}
+
+	var terminal models.Terminal
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+		err := tx.Where("pairing_code_hash = ? AND pairing_expires_at > ? AND is_active = ?",
+			hashSecret(strings.ToUpper(strings.TrimSpace(code))), now, true).
+			First(&terminal).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPairingCodeInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		terminal.PairingExpiresAt = nil
+		terminal.PairedAt = &now
+		terminal.LastSeenAt = &now
+		return tx.Model(&terminal).Updates(map[string]interface{}{
+			"pairing_code_hash":  "",
+			"pairing_expires_at": nil,
+			"device_token_hash":  hashSecret(token),
+			"paired_at":          now,
+			"last_seen_at":       now,
+		}).Error
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &terminal, token, nil
+}
+
+// Unpair forgets the terminal's device, which has to pair again
+func (s *TerminalService) Unpair(ctx context.Context, id uuid.UUID) error {
+	result := s.db.WithContext(ctx).Model(&models.Terminal{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"pairing_code_hash":  "",
+			"pairing_expires_at": nil,
+			"device_token_hash":  "",
+			"paired_at":          nil,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unpair terminal: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("terminal: %w", gorm.ErrRecordNotFound)
+	}
+	return nil
+}
+
+// Authenticate returns the active terminal paired with the device token
+// and notes that it was seen from ip
+func (s *TerminalService) Authenticate(ctx context.Context, token, ip string) (*models.Terminal, error) {
+	if token == "" {
+		return nil, ErrTerminalUnknown
+	}
+
+	var terminal models.Terminal
+	err := s.db.WithContext(ctx).
+		Where("device_token_hash = ? AND is_active = ?", hashSecret(token), true).
+		First(&terminal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTerminalUnknown
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load terminal: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if terminal.LastSeenAt == nil || now.Sub(*terminal.LastSeenAt) >= lastSeenInterval || terminal.LastSeenIP != ip {
+		if err := s.db.WithContext(ctx).Model(&terminal).
+			Updates(map[string]interface{}{"last_seen_at": now, "last_seen_ip": ip}).Error; err != nil {
+			return nil, fmt.Errorf("failed to record terminal last seen: %w", err)
+		}
+	}
+	return &terminal, nil
+}
+
+// NextInvoiceNumber takes the terminal's next invoice number in tx. The
+// row stays locked until tx ends, so concurrent sales on one register get
+// consecutive numbers and a rolled back sale gives its number back.
+func (s *TerminalService) NextInvoiceNumber(tx *gorm.DB, terminal *models.Terminal) (string, error) {
+	if err := tx.Model(&models.Terminal{}).Where("id = ?", terminal.ID).
+		Update("next_invoice_number", gorm.Expr("next_invoice_number + 1")).Error; err != nil {
+		return "", fmt.Errorf("failed to take invoice number: %w", err)
+	}
+
+	var next int64
+	if err := tx.Model(&models.Terminal{}).Select("next_invoice_number").
+		Where("id = ?", terminal.ID).Scan(&next).Error; err != nil {
+		return "", fmt.Errorf("failed to take invoice number: %w", err)
+	}
+	return fmt.Sprintf("%s-%010d", terminal.InvoicePrefix, next-1), nil
+}
+
+// ZReport totals a terminal's sales on day, the register's end-of-day
+// reading
+func (s *TerminalService) ZReport(ctx context.Context, id uuid.UUID, day time.Time) (*ZReport, error) {
+	var terminal models.Terminal
+	if err := s.db.WithContext(ctx).Preload("Branch").First(&terminal, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("terminal: %w", err)
+	}
+
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	sales := func() *gorm.DB {
+		return s.db.WithContext(ctx).Model(&models.Sale{}).
+			Where("terminal_id = ? AND created_at >= ? AND created_at < ?", id, start, start.AddDate(0, 0, 1))
+	}
+
+	report := &ZReport{Terminal: terminal, Date: start.Format("2006-01-02")}
+	if err := sales().
+		Select("COUNT(*) AS sale_count, COALESCE(SUM(subtotal), 0) AS gross_sales, " +
+			"COALESCE(SUM(discount), 0) AS discounts, COALESCE(SUM(tax), 0) AS tax, " +
+			"COALESCE(SUM(total), 0) AS net_sales, MIN(invoice_number) AS first_invoice, MAX(invoice_number) AS last_invoice").
+		Scan(&report.ZReportTotals).Error; err != nil {
+		return nil, fmt.Errorf("failed to total terminal sales: %w", err)
+	}
+	if err := sales().Where("refunded_at IS NOT NULL").
+		Select("COUNT(*) AS refund_count, COALESCE(SUM(total), 0) AS refunds").
+		Scan(&report.ZReportRefunds).Error; err != nil {
+		return nil, fmt.Errorf("failed to total terminal refunds: %w", err)
+	}
+	if err := sales().
+		Select("payment_method, COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS total").
+		Group("payment_method").Order("payment_method ASC").
+		Scan(&report.Payments).Error; err != nil {
+		return nil, fmt.Errorf("failed to total terminal payments: %w", err)
+	}
+	return report, nil
+}
+
+// Private helper methods
+
+func (s *TerminalService) checkBranch(ctx context.Context, branchID uuid.UUID) error {
+	var branch models.Branch
+	if err := s.db.WithContext(ctx).First(&branch, "id = ?", branchID).Error; err != nil {
+		return fmt.Errorf("branch: %w", err)
+	}
+	if !branch.IsActive {
+		return ErrBranchInactive
+	}
+	return nil
+}
+
+func generatePairingCode() (string, error) {
+	code := make([]byte, pairingCodeLength)
+	max := big.NewInt(int64(len(pairingCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate pairing code: %w", err)
+		}
+		code[i] = pairingCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Request/Response types
+
+type TerminalRequest struct {
+	Name              string    `json:"name" binding:"required,max=100"`
+	BranchID          uuid.UUID `json:"branch_id" binding:"required"`
+	InvoicePrefix     string    `json:"invoice_prefix" binding:"required,max=20,alphanum"`
+	NextInvoiceNumber int64     `json:"next_invoice_number" binding:"min=0"` // to continue an existing series
+	MachineID         string    `json:"machine_id" binding:"max=50"`
+	IsActive          *bool     `json:"is_active"`
+}
+
+type PairTerminalRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type ZReport struct {
+	Terminal models.Terminal `json:"terminal"`
+	Date     string          `json:"date"`
+	ZReportTotals
+	ZReportRefunds
+	Payments []ZReportPayment `json:"payments"`
+}
+
+type ZReportTotals struct {
+	SaleCount    int64        `json:"sale_count"`
+	GrossSales   models.Money `json:"gross_sales"`
+	Discounts    models.Money `json:"discounts"`
+	Tax          models.Money `json:"tax"`
+	NetSales     models.Money `json:"net_sales"`
+	FirstInvoice *string      `json:"first_invoice"`
+	LastInvoice  *string      `json:"last_invoice"`
+}
+
+type ZReportRefunds struct {
+	RefundCount int64        `json:"refund_count"`
+	Refunds     models.Money `json:"refunds"`
+}
+
+type ZReportPayment struct {
+	PaymentMethod string       `json:"payment_method"`
+	SaleCount     int64        `json:"sale_count"`
+	Total         models.Money `json:"total"`
+}
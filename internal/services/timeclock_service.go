@@ -0,0 +1,633 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAlreadyClockedIn   = errors.New("already clocked in")
+	ErrNotClockedIn       = errors.New("not clocked in")
+	ErrShiftClosed        = errors.New("the shift has already ended")
+	ErrDrawerInUse        = errors.New("the register's cash drawer is kept by another open shift")
+	ErrShiftOpeningCash   = errors.New("opening_cash must be counted when taking a register's drawer")
+	ErrShiftClosingCash   = errors.New("closing_cash must be counted to end a shift that kept a drawer")
+	ErrShiftTerminal      = errors.New("the register is inactive or in another branch")
+	ErrEmployeeInactive   = errors.New("the employee is inactive")
+	ErrBadgeUnknown       = errors.New("the badge is not a current employee badge")
+	ErrShiftNegativeCount = errors.New("cash counts cannot be negative")
+)
+
+// TimeClockService clocks employees in and out, keeps the cash drawer count
+// of the shifts worked at a register, and puts sales down to the shift
+// they were rung up in
+type TimeClockService struct {
+	db *gorm.DB
+	qr *QRService
+}
+
+func NewTimeClockService(db *gorm.DB, qr *QRService) *TimeClockService {
+	return &TimeClockService{db: db, qr: qr}
+}
+
+// CurrentShift returns the employee's open shift, or nil when they are off
+// the clock
+func (s *TimeClockService) CurrentShift(ctx context.Context, userID uuid.UUID) (*models.Shift, error) {
+	var shift models.Shift
+	err := s.db.WithContext(ctx).Preload("Terminal").
+		Where("user_id = ? AND clock_out_at IS NULL", userID).First(&shift).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load current shift: %w", err)
+	}
+	return &shift, nil
+}
+
+// ClockIn starts a shift at branchID. With a terminal the shift takes that
+// register's cash drawer, counted in with the opening cash.
+func (s *TimeClockService) ClockIn(ctx context.Context, userID uuid.UUID, branchID *uuid.UUID, req ClockInRequest, method models.ClockMethod) (*models.Shift, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("user: %w", err)
+	}
+	if !user.IsActive {
+		return nil, ErrEmployeeInactive
+	}
+
+	shift := &models.Shift{
+		UserID:        userID,
+		BranchID:      branchID,
+		OpenUserID:    &userID,
+		ClockInAt:     time.Now().UTC(),
+		ClockInMethod: method,
+		Notes:         req.Notes,
+	}
+	if req.TerminalID != nil {
+		var terminal models.Terminal
+		if err := s.db.WithContext(ctx).First(&terminal, "id = ?", *req.TerminalID).Error; err != nil {
+			return nil, fmt.Errorf("terminal: %w", err)
+		}
+		if !terminal.IsActive || (user.BranchID != nil && *user.BranchID != terminal.BranchID) {
+			return nil, ErrShiftTerminal
+		}
+		if req.OpeningCash == nil {
+			return nil, ErrShiftOpeningCash
+		}
+		shift.TerminalID = &terminal.ID
+		shift.OpenTerminalID = &terminal.ID
+		shift.BranchID = &terminal.BranchID
+	}
+	if req.OpeningCash != nil {
+		if *req.OpeningCash < 0 {
+			return nil, ErrShiftNegativeCount
+		}
+		shift.OpeningCash = req.OpeningCash
+	}
+
+	if err := s.checkOpen(ctx, shift); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(shift).Error; err != nil {
+		// Someone clocked in at the same moment; the open-shift indexes
+		// kept the second one out
+		if openErr := s.checkOpen(ctx, shift); openErr != nil {
+			return nil, openErr
+		}
+		return nil, fmt.Errorf("failed to clock in: %w", err)
+	}
+	return s.GetShift(ctx, shift.ID)
+}
+
+// ClockOut ends the employee's open shift
+func (s *TimeClockService) ClockOut(ctx context.Context, userID uuid.UUID, req ClockOutRequest, method models.ClockMethod) (*models.Shift, error) {
+	shift, err := s.CurrentShift(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if shift == nil {
+		return nil, ErrNotClockedIn
+	}
+	if err := s.close(ctx, shift, req, method, nil); err != nil {
+		return nil, err
+	}
+	return s.GetShift(ctx, shift.ID)
+}
+
+// CloseShift lets a manager end a shift the employee forgot to clock out of
+func (s *TimeClockService) CloseShift(ctx context.Context, id uuid.UUID, req ClockOutRequest, managerID uuid.UUID) (*models.Shift, error) {
+	var shift models.Shift
+	if err := s.db.WithContext(ctx).First(&shift, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("shift: %w", err)
+	}
+	if !shift.IsOpen() {
+		return nil, ErrShiftClosed
+	}
+	if err := s.close(ctx, &shift, req, models.ClockManager, &managerID); err != nil {
+		return nil, err
+	}
+	return s.GetShift(ctx, id)
+}
+
+// BadgeClock clocks the employee whose personal QR badge was scanned at the
+// register in, or out when they are on the clock. Clocking in with an
+// opening count takes the register's drawer. It reports whether the
+// employee clocked in.
+func (s *TimeClockService) BadgeClock(ctx context.Context, terminal *models.Terminal, req BadgeClockRequest, scan ScanContext) (*models.Shift, bool, error) {
+	result, err := s.qr.ScanQR(ctx, req.Code, scan)
+	if err != nil || result.Type != models.QRTypeEmployee {
+		return nil, false, ErrBadgeUnknown
+	}
+	userID := result.EntityID
+
+	var user models.User
+	if err := s.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return nil, false, ErrBadgeUnknown
+	}
+	if user.BranchID != nil && *user.BranchID != terminal.BranchID {
+		return nil, false, ErrShiftTerminal
+	}
+
+	current, err := s.CurrentShift(ctx, userID)
+	if err != nil {
+		return nil, false, err
+	}
+	if current != nil {
+		shift, err := s.ClockOut(ctx, userID, ClockOutRequest{ClosingCash: req.ClosingCash, Notes: req.Notes}, models.ClockBadge)
+		return shift, false, err
+	}
+
+	clockIn := ClockInRequest{OpeningCash: req.OpeningCash, Notes: req.Notes}
+	if req.OpeningCash != nil {
+		clockIn.TerminalID = &terminal.ID
+	}
+	shift, err := s.ClockIn(ctx, userID, &terminal.BranchID, clockIn, models.ClockBadge)
+	return shift, true, err
+}
+
+// AttributeSale puts a sale down to the open shift of the employee ringing
+// it up, if they are clocked in
+func (s *TimeClockService) AttributeSale(ctx context.Context, sale *models.Sale) error {
+	sale.ShiftID = nil
+	if sale.PharmacistID == nil {
+		return nil
+	}
+	shift, err := s.CurrentShift(ctx, *sale.PharmacistID)
+	if err != nil || shift == nil {
+		return err
+	}
+	sale.ShiftID = &shift.ID
+	return nil
+}
+
+// IssueBadge issues an employee a new personal QR badge for the time clock
+func (s *TimeClockService) IssueBadge(ctx context.Context, employeeID, issuedBy uuid.UUID) (*models.QRCode, error) {
+	return s.qr.GenerateEmployeeQR(ctx, employeeID, &issuedBy)
+}
+
+func (s *TimeClockService) GetShift(ctx context.Context, id uuid.UUID) (*models.Shift, error) {
+	var shift models.Shift
+	if err := s.db.WithContext(ctx).Preload("User").Preload("Terminal").
+		First(&shift, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("shift: %w", err)
+	}
+	return &shift, nil
+}
+
+// ListShifts lists shifts, latest clock-in first, with the sales rung up in
+// each
+func (s *TimeClockService) ListShifts(ctx context.Context, filter ShiftFilter) ([]ShiftView, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Shift{})
+	if filter.BranchID != nil {
+		query = query.Where("branch_id = ?", *filter.BranchID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.TerminalID != nil {
+		query = query.Where("terminal_id = ?", *filter.TerminalID)
+	}
+	if filter.Open != nil {
+		if *filter.Open {
+			query = query.Where("clock_out_at IS NULL")
+		} else {
+			query = query.Where("clock_out_at IS NOT NULL")
+		}
+	}
+	if filter.From != nil {
+		query = query.Where("clock_in_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("clock_in_at < ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	var shifts []models.Shift
+	if err := query.Preload("User").Preload("Terminal").
+		Order("clock_in_at DESC").Limit(filter.Limit).Offset(filter.Offset).
+		Find(&shifts).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load shifts: %w", err)
+	}
+	views, err := s.shiftViews(ctx, shifts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return views, total, nil
+}
+
+// GetShiftView returns a shift with the sales rung up in it
+func (s *TimeClockService) GetShiftView(ctx context.Context, id uuid.UUID) (*ShiftView, error) {
+	shift, err := s.GetShift(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	views, err := s.shiftViews(ctx, []models.Shift{*shift})
+	if err != nil {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// Productivity reports each employee's hours on the clock in [from, to)
+// and what they did in them: sales rung up, prescriptions verified,
+// preparations compounded and order items picked. With branchID it covers
+// that branch.
+func (s *TimeClockService) Productivity(ctx context.Context, branchID *uuid.UUID, from, to *time.Time) (*ProductivityReport, error) {
+	now := time.Now().UTC()
+	rows := map[uuid.UUID]*EmployeeProductivity{}
+	row := func(userID uuid.UUID) *EmployeeProductivity {
+		if rows[userID] == nil {
+			rows[userID] = &EmployeeProductivity{UserID: userID}
+		}
+		return rows[userID]
+	}
+	period := func(query *gorm.DB, column string) *gorm.DB {
+		if from != nil {
+			query = query.Where(column+" >= ?", *from)
+		}
+		if to != nil {
+			query = query.Where(column+" < ?", *to)
+		}
+		return query
+	}
+	db := s.db.WithContext(ctx)
+
+	shifts := period(db.Model(&models.Shift{}), "clock_in_at")
+	if branchID != nil {
+		shifts = shifts.Where("branch_id = ?", *branchID)
+	}
+	var worked []models.Shift
+	if err := shifts.Select("user_id", "clock_in_at", "clock_out_at").Find(&worked).Error; err != nil {
+		return nil, fmt.Errorf("failed to load shifts: %w", err)
+	}
+	for _, shift := range worked {
+		employee := row(shift.UserID)
+		employee.Shifts++
+		employee.HoursWorked += shift.Worked(now).Hours()
+	}
+
+	var sales []struct {
+		PharmacistID      uuid.UUID
+		SaleCount         int64
+		Revenue           models.Money
+		PrescriptionSales int64
+	}
+	salesQuery := period(db.Model(&models.Sale{}), "created_at").
+		Where("status = ? AND pharmacist_id IS NOT NULL", "completed")
+	if branchID != nil {
+		salesQuery = salesQuery.Where("branch_id = ?", *branchID)
+	}
+	if err := salesQuery.Select("pharmacist_id, COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS revenue, " +
+		"COALESCE(SUM(CASE WHEN prescription_number IS NOT NULL AND prescription_number <> '' THEN 1 ELSE 0 END), 0) AS prescription_sales").
+		Group("pharmacist_id").Scan(&sales).Error; err != nil {
+		return nil, fmt.Errorf("failed to total sales by employee: %w", err)
+	}
+	for _, total := range sales {
+		employee := row(total.PharmacistID)
+		employee.Sales = total.SaleCount
+		employee.Revenue = total.Revenue
+		employee.PrescriptionSales = total.PrescriptionSales
+	}
+
+	var items []activityCount
+	itemsQuery := period(db.Table("sale_items").Joins("JOIN sales ON sales.id = sale_items.sale_id"), "sales.created_at").
+		Where("sales.status = ? AND sales.pharmacist_id IS NOT NULL AND sale_items.deleted_at IS NULL AND sales.deleted_at IS NULL", "completed")
+	if branchID != nil {
+		itemsQuery = itemsQuery.Where("sales.branch_id = ?", *branchID)
+	}
+	if err := itemsQuery.Select("sales.pharmacist_id AS user_id, COALESCE(SUM(sale_items.quantity), 0) AS count").
+		Group("sales.pharmacist_id").Scan(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to total items sold by employee: %w", err)
+	}
+	for _, total := range items {
+		row(total.UserID).ItemsSold = total.Count
+	}
+
+	var verified []activityCount
+	verifiedQuery := period(db.Table("prescription_uploads").
+		Joins("LEFT JOIN online_orders ON online_orders.id = prescription_uploads.order_id"), "prescription_uploads.verified_at").
+		Where("prescription_uploads.verified_by IS NOT NULL AND prescription_uploads.deleted_at IS NULL")
+	if branchID != nil {
+		verifiedQuery = verifiedQuery.Where("online_orders.branch_id = ?", *branchID)
+	}
+	if err := verifiedQuery.Select("prescription_uploads.verified_by AS user_id, COUNT(*) AS count").
+		Group("prescription_uploads.verified_by").Scan(&verified).Error; err != nil {
+		return nil, fmt.Errorf("failed to count prescriptions verified: %w", err)
+	}
+	for _, total := range verified {
+		row(total.UserID).PrescriptionsVerified = total.Count
+	}
+
+	var prepared []activityCount
+	preparedQuery := period(db.Model(&models.CompoundPreparation{}), "prepared_at").Where("prepared_by IS NOT NULL")
+	if branchID != nil {
+		preparedQuery = preparedQuery.Where("branch_id = ?", *branchID)
+	}
+	if err := preparedQuery.Select("prepared_by AS user_id, COUNT(*) AS count").
+		Group("prepared_by").Scan(&prepared).Error; err != nil {
+		return nil, fmt.Errorf("failed to count preparations: %w", err)
+	}
+	for _, total := range prepared {
+		row(total.UserID).PreparationsCompleted = total.Count
+	}
+
+	var picked []activityCount
+	pickedQuery := period(db.Table("online_order_items").Joins("JOIN online_orders ON online_orders.id = online_order_items.order_id"), "online_order_items.picked_at").
+		Where("online_order_items.picked_by IS NOT NULL AND online_order_items.deleted_at IS NULL")
+	if branchID != nil {
+		pickedQuery = pickedQuery.Where("online_orders.branch_id = ?", *branchID)
+	}
+	if err := pickedQuery.Select("online_order_items.picked_by AS user_id, COALESCE(SUM(online_order_items.picked_quantity), 0) AS count").
+		Group("online_order_items.picked_by").Scan(&picked).Error; err != nil {
+		return nil, fmt.Errorf("failed to count items picked: %w", err)
+	}
+	for _, total := range picked {
+		row(total.UserID).ItemsPicked = total.Count
+	}
+
+	report := &ProductivityReport{From: from, To: to, Employees: []EmployeeProductivity{}}
+	if len(rows) == 0 {
+		return report, nil
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	var users []models.User
+	if err := db.Unscoped().Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to load employees: %w", err)
+	}
+	for _, user := range users {
+		employee := rows[user.ID]
+		employee.Name = user.FirstName + " " + user.LastName
+		employee.Role = user.Role
+	}
+
+	for _, employee := range rows {
+		employee.HoursWorked = math.Round(employee.HoursWorked*100) / 100
+		if employee.HoursWorked > 0 {
+			employee.SalesPerHour = math.Round(float64(employee.Sales)/employee.HoursWorked*100) / 100
+			employee.RevenuePerHour = employee.Revenue.MulRate(1 / employee.HoursWorked)
+		}
+		report.HoursWorked += employee.HoursWorked
+		report.Sales += employee.Sales
+		report.Revenue += employee.Revenue
+		report.Employees = append(report.Employees, *employee)
+	}
+	report.HoursWorked = math.Round(report.HoursWorked*100) / 100
+	sort.Slice(report.Employees, func(i, j int) bool {
+		a, b := report.Employees[i], report.Employees[j]
+		if a.Revenue != b.Revenue {
+			return a.Revenue > b.Revenue
+		}
+		return a.Name < b.Name
+	})
+	return report, nil
+}
+
+// Private helper methods
+
+// checkOpen reports whether the employee or the register shift would take
+// is already on an open shift
+func (s *TimeClockService) checkOpen(ctx context.Context, shift *models.Shift) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.Shift{}).
+		Where("open_user_id = ?", shift.UserID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrAlreadyClockedIn
+	}
+	if shift.TerminalID == nil {
+		return nil
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Shift{}).
+		Where("open_terminal_id = ?", *shift.TerminalID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDrawerInUse
+	}
+	return nil
+}
+
+// close ends an open shift. A shift that kept a drawer is counted out: the
+// cash sales rung up on its register during it and the drawer openings
+// without a sale are tallied against the closing count.
+func (s *TimeClockService) close(ctx context.Context, shift *models.Shift, req ClockOutRequest, method models.ClockMethod, closedBy *uuid.UUID) error {
+	now := time.Now().UTC()
+	updates := map[string]interface{}{
+		"clock_out_at":     now,
+		"clock_out_method": method,
+		"closed_by":        closedBy,
+		"open_user_id":     nil,
+		"open_terminal_id": nil,
+		"updated_at":       now,
+	}
+	if req.Notes != "" {
+		notes := req.Notes
+		if shift.Notes != "" {
+			notes = shift.Notes + "\n" + req.Notes
+		}
+		updates["notes"] = notes
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if shift.TerminalID != nil {
+			if req.ClosingCash == nil {
+				return ErrShiftClosingCash
+			}
+			if *req.ClosingCash < 0 {
+				return ErrShiftNegativeCount
+			}
+
+			var cash struct {
+				SaleCount int
+				Total     models.Money
+			}
+			if err := tx.Model(&models.Sale{}).
+				Where("shift_id = ? AND terminal_id = ? AND payment_method = ? AND status = ? AND refunded_at IS NULL",
+					shift.ID, *shift.TerminalID, models.PaymentMethodCash, "completed").
+				Select("COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS total").
+				Scan(&cash).Error; err != nil {
+				return fmt.Errorf("failed to total cash sales: %w", err)
+			}
+			var openings int64
+			if err := tx.Model(&models.StationJob{}).
+				Where("terminal_id = ? AND requested_by = ? AND kind = ? AND status = ? AND created_at >= ? AND created_at <= ?",
+					*shift.TerminalID, shift.UserID, models.StationJobOpenDrawer, models.StationJobDone, shift.ClockInAt, now).
+				Count(&openings).Error; err != nil {
+				return fmt.Errorf("failed to count drawer openings: %w", err)
+			}
+
+			var opening models.Money
+			if shift.OpeningCash != nil {
+				opening = *shift.OpeningCash
+			}
+			expected := opening + cash.Total
+			updates["closing_cash"] = *req.ClosingCash
+			updates["expected_cash"] = expected
+			updates["cash_variance"] = *req.ClosingCash - expected
+			updates["cash_sales"] = cash.SaleCount
+			updates["no_sale_openings"] = int(openings)
+		} else if req.ClosingCash != nil {
+			updates["closing_cash"] = *req.ClosingCash
+		}
+
+		result := tx.Model(&models.Shift{}).Where("id = ? AND clock_out_at IS NULL", shift.ID).Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to clock out: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrShiftClosed
+		}
+		return nil
+	})
+}
+
+// shiftViews adds the sales rung up in each shift
+func (s *TimeClockService) shiftViews(ctx context.Context, shifts []models.Shift) ([]ShiftView, error) {
+	views := make([]ShiftView, len(shifts))
+	if len(shifts) == 0 {
+		return views, nil
+	}
+	ids := make([]uuid.UUID, len(shifts))
+	for i, shift := range shifts {
+		ids[i] = shift.ID
+	}
+	var totals []struct {
+		ShiftID   uuid.UUID
+		SaleCount int64
+		Revenue   models.Money
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Sale{}).
+		Where("shift_id IN ? AND status = ?", ids, "completed").
+		Select("shift_id, COUNT(*) AS sale_count, COALESCE(SUM(total), 0) AS revenue").
+		Group("shift_id").Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to total shift sales: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for i, shift := range shifts {
+		views[i] = ShiftView{
+			Shift:       shift,
+			Open:        shift.IsOpen(),
+			HoursWorked: math.Round(shift.Worked(now).Hours()*100) / 100,
+		}
+		for _, total := range totals {
+			if total.ShiftID == shift.ID {
+				views[i].Sales = total.SaleCount
+				views[i].Revenue = total.Revenue
+			}
+		}
+	}
+	return views, nil
+}
+
+type activityCount struct {
+	UserID uuid.UUID
+	Count  int64
+}
+
+// Request/Response types
+
+type ClockInRequest struct {
+	TerminalID  *uuid.UUID    `json:"terminal_id"`  // the register whose drawer the shift takes
+	OpeningCash *models.Money `json:"opening_cash"` // the drawer's float, counted in
+	Notes       string        `json:"notes" binding:"max=1000"`
+}
+
+type ClockOutRequest struct {
+	ClosingCash *models.Money `json:"closing_cash"` // the drawer counted out
+	Notes       string        `json:"notes" binding:"max=1000"`
+}
+
+// BadgeClockRequest is a personal QR badge scanned at a register
+type BadgeClockRequest struct {
+	Code        string        `json:"code" binding:"required"`
+	OpeningCash *models.Money `json:"opening_cash"` // clocking in with it takes the register's drawer
+	ClosingCash *models.Money `json:"closing_cash"`
+	Notes       string        `json:"notes" binding:"max=1000"`
+}
+
+type ShiftFilter struct {
+	BranchID   *uuid.UUID
+	UserID     *uuid.UUID
+	TerminalID *uuid.UUID
+	Open       *bool
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+type ShiftView struct {
+	models.Shift
+	Open        bool         `json:"open"`
+	HoursWorked float64      `json:"hours_worked"`
+	Sales       int64        `json:"sales"`
+	Revenue     models.Money `json:"revenue"`
+}
+
+type ProductivityReport struct {
+	From        *time.Time             `json:"from,omitempty"`
+	To          *time.Time             `json:"to,omitempty"`
+	HoursWorked float64                `json:"hours_worked"`
+	Sales       int64                  `json:"sales"`
+	Revenue     models.Money           `json:"revenue"`
+	Employees   []EmployeeProductivity `json:"employees"`
+}
+
+type EmployeeProductivity struct {
+	UserID                uuid.UUID       `json:"user_id"`
+	Name                  string          `json:"name"`
+	Role                  models.UserRole `json:"role"`
+	Shifts                int             `json:"shifts"`
+	HoursWorked           float64         `json:"hours_worked"`
+	Sales                 int64           `json:"sales"`
+	Revenue               models.Money    `json:"revenue"`
+	ItemsSold             int64           `json:"items_sold"`
+	PrescriptionSales     int64           `json:"prescription_sales"`
+	PrescriptionsVerified int64           `json:"prescriptions_verified"`
+	PreparationsCompleted int64           `json:"preparations_completed"`
+	ItemsPicked           int64           `json:"items_picked"`
+	SalesPerHour          float64         `json:"sales_per_hour"`
+	RevenuePerHour        models.Money    `json:"revenue_per_hour"`
+}
@@ -0,0 +1,352 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/labels"
+	"pharmacy-backend/internal/lifecycle"
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/query"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+type VaccinationService struct {
+	db             *gorm.DB
+	qrService      *QRService
+	communications *CommunicationService
+	config         config.VaccinationConfig
+	pharmacy       labels.Pharmacy
+}
+
+func NewVaccinationService(db *gorm.DB, qrService *QRService, communications *CommunicationService, cfg config.VaccinationConfig, pharmacy config.PharmacyConfig) *VaccinationService {
+	return &VaccinationService{
+		db:             db,
+		qrService:      qrService,
+		communications: communications,
+		config:         cfg,
+		pharmacy: labels.Pharmacy{
+			Name:          pharmacy.Name,
+			Address:       pharmacy.Address,
+			Phone:         pharmacy.Phone,
+			LicenseNumber: pharmacy.LicenseNumber,
+		},
+	}
+}
+
+// RecordAdministration records a vaccine dose given under a vaccination
+// service, closes the customer's previous dose in the series and issues a
+// certificate code
+func (s *VaccinationService) RecordAdministration(ctx context.Context, req RecordVaccinationRequest, staffID uuid.UUID) (*models.VaccinationRecord, error) {
+	var service models.Service
+	if err := s.db.First(&service, req.ServiceID).Error; err != nil {
+		return nil, fmt.Errorf("service not found: %w", err)
+	}
+	if service.Category != models.ServiceCategoryVaccination {
+		return nil, fmt.Errorf("service %s is not a vaccination service", service.Name)
+	}
+
+	var customer models.Customer
+	if err := s.db.Select("id").First(&customer, req.CustomerID).Error; err != nil {
+		return nil, fmt.Errorf("customer not found: %w", err)
+	}
+
+	if req.SaleItemID != nil {
+		var count int64
+		s.db.Model(&models.SaleItem{}).
+			Joins("JOIN sales ON sales.id = sale_items.sale_id").
+			Where("sale_items.id = ? AND sale_items.service_id = ? AND sales.customer_id = ?", *req.SaleItemID, req.ServiceID, req.CustomerID).
+			Count(&count)
+		if count == 0 {
+			return nil, fmt.Errorf("sale item does not match this customer and service")
+		}
+	}
+
+	administeredAt := time.Now().UTC()
+	if req.AdministeredAt != nil {
+		administeredAt = req.AdministeredAt.UTC()
+	}
+
+	record := &models.VaccinationRecord{
+		CustomerID:     req.CustomerID,
+		ServiceID:      req.ServiceID,
+		SaleItemID:     req.SaleItemID,
+		ProductID:      req.ProductID,
+		VaccineName:    req.VaccineName,
+		Manufacturer:   req.Manufacturer,
+		BatchNumber:    req.BatchNumber,
+		ExpiryDate:     req.ExpiryDate,
+		DoseNumber:     req.DoseNumber,
+		TotalDoses:     req.TotalDoses,
+		Site:           req.Site,
+		Route:          req.Route,
+		Notes:          req.Notes,
+		AdministeredBy: staffID,
+		AdministeredAt: administeredAt,
+	}
+
+	// Fill vaccine details from the stock item when not given explicitly
+	if req.ProductID != nil {
+		var product models.Product
+		if err := s.db.First(&product, *req.ProductID).Error; err != nil {
+			return nil, fmt.Errorf("vaccine product not found: %w", err)
+		}
+		if record.VaccineName == "" {
+			record.VaccineName = product.Name
+		}
+		if record.Manufacturer == "" {
+			record.Manufacturer = product.Manufacturer
+		}
+		if record.BatchNumber == "" {
+			record.BatchNumber = product.BatchNumber
+		}
+		if record.ExpiryDate == nil && !product.ExpiryDate.IsZero() {
+			expiry := product.ExpiryDate.Time
+			record.ExpiryDate = &expiry
+		}
+	}
+
+	if err := validateVaccinationRecord(record); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case req.NextDoseDue != nil:
+		due := req.NextDoseDue.UTC()
+		record.NextDoseDue = &due
+	case req.NextDoseInDays > 0:
+		due := administeredAt.AddDate(0, 0, req.NextDoseInDays)
+		record.NextDoseDue = &due
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// This dose fulfils any earlier dose that was waiting on it
+		if err := tx.Model(&models.VaccinationRecord{}).
+			Where("customer_id = ? AND service_id = ? AND next_dose_due IS NOT NULL AND next_dose_given_at IS NULL", req.CustomerID, req.ServiceID).
+			Update("next_dose_given_at", administeredAt).Error; err != nil {
+			return fmt.Errorf("failed to close previous dose: %w", err)
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return fmt.Errorf("failed to save vaccination record: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	qrCode, err := s.qrService.GenerateVaccinationQR(ctx, record.ID, &staffID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate code: %w", err)
+	}
+	record.CertificateCode = qrCode.Code
+	if err := s.db.Model(record).Update("certificate_code", qrCode.Code).Error; err != nil {
+		return nil, fmt.Errorf("failed to save certificate code: %w", err)
+	}
+
+	return record, nil
+}
+
+// GetRecord returns a vaccination record with its service and vaccine
+func (s *VaccinationService) GetRecord(ctx context.Context, id uuid.UUID) (*models.VaccinationRecord, error) {
+	var record models.VaccinationRecord
+	if err := s.db.Preload("Service", WithDeleted).Preload("Product", WithDeleted).Preload("Administrator").
+		First(&record, id).Error; err != nil {
+		return nil, fmt.Errorf("vaccination record not found: %w", err)
+	}
+	return &record, nil
+}
+
+// GetCustomerVaccinations lists a customer's vaccinations, most recent first
+func (s *VaccinationService) GetCustomerVaccinations(ctx context.Context, customerID uuid.UUID) ([]models.VaccinationRecord, error) {
+	var records []models.VaccinationRecord
+	err := s.db.Preload("Service", WithDeleted).Preload("Administrator").
+		Where("customer_id = ?", customerID).
+		Order("administered_at DESC").
+		Find(&records).Error
+	return records, err
+}
+
+// Certificate builds the printable certificate for a vaccination record
+func (s *VaccinationService) Certificate(ctx context.Context, id uuid.UUID) (*labels.VaccinationCertificate, error) {
+	var record models.VaccinationRecord
+	if err := s.db.Preload("Customer", WithDeleted).Preload("Administrator").First(&record, id).Error; err != nil {
+		return nil, fmt.Errorf("vaccination record not found: %w", err)
+	}
+
+	cert := &labels.VaccinationCertificate{
+		Pharmacy:         s.pharmacy,
+		Vaccine:          record.VaccineName,
+		Manufacturer:     record.Manufacturer,
+		BatchNumber:      record.BatchNumber,
+		DoseNumber:       record.DoseNumber,
+		TotalDoses:       record.TotalDoses,
+		Site:             string(record.Site),
+		AdministeredAt:   record.AdministeredAt,
+		NextDoseDue:      record.NextDoseDue,
+		VerificationCode: record.CertificateCode,
+	}
+	if record.Customer != nil {
+		cert.PatientName = record.Customer.FirstName + " " + record.Customer.LastName
+		cert.DateOfBirth = record.Customer.DateOfBirth
+	}
+	if record.Administrator != nil {
+		cert.AdministeredBy = record.Administrator.FirstName + " " + record.Administrator.LastName
+	}
+	if record.CertificateCode != "" {
+		cert.VerificationURL = strings.TrimRight(s.config.VerifyBaseURL, "/") + "/" + record.CertificateCode
+	}
+	return cert, nil
+}
+
+// GetDueDoses lists pending next doses due within the given number of days.
+// Overdue doses are included.
+func (s *VaccinationService) GetDueDoses(ctx context.Context, withinDays int) ([]models.VaccinationRecord, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, withinDays)
+
+	var records []models.VaccinationRecord
+	err := s.db.WithContext(ctx).Preload("Customer", WithDeleted).Preload("Service", WithDeleted).
+		Where("next_dose_due IS NOT NULL AND next_dose_given_at IS NULL AND next_dose_due <= ?", cutoff).
+		Order("next_dose_due ASC").
+		Find(&records).Error
+	return records, err
+}
+
+// SendDueDoseReminders notifies targeted customers whose next dose falls due
+// within the configured window. Each dose is reminded once. It returns the
+// number of reminders sent.
+func (s *VaccinationService) SendDueDoseReminders(ctx context.Context, targeting query.Targeting) (int, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, s.config.ReminderDaysAhead)
+
+	var records []models.VaccinationRecord
+	query := s.db.Preload("Customer", WithDeleted).
+		Where("next_dose_due IS NOT NULL AND next_dose_due <= ?", cutoff).
+		Where("next_dose_given_at IS NULL AND next_dose_reminded_at IS NULL")
+	if err := targeting.Apply(query, "vaccination_records.customer_id").Find(&records).Error; err != nil {
+		return 0, fmt.Errorf("failed to load due doses: %w", err)
+	}
+
+	sent := 0
+	for _, record := range records {
+		if record.Customer == nil {
+			continue
+		}
+
+		subject := fmt.Sprintf("Your next %s dose is due", record.VaccineName)
+		body := fmt.Sprintf("Hi %s, dose %d of your %s vaccination is due on %s. Visit %s to get it.",
+			record.Customer.FirstName, record.DoseNumber+1, record.VaccineName,
+			record.NextDoseDue.Format("Jan 2"), s.pharmacy.Name)
+		_, err := s.communications.NotifyCustomer(ctx, record.Customer, models.PurposeReminders, subject, body)
+		if errors.Is(err, ErrNotificationSuppressed) {
+			continue
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("vaccination_id", record.ID).Warn("Failed to send vaccination reminder")
+			continue
+		}
+
+		if err := s.db.Model(&record).Update("next_dose_reminded_at", time.Now().UTC()).Error; err != nil {
+			return sent, fmt.Errorf("failed to update vaccination record: %w", err)
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// RunReminders sends due dose reminders on the configured interval until ctx
+// is done
+func (s *VaccinationService) RunReminders(ctx context.Context) {
+	ticker := time.NewTicker(s.config.ReminderInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if sent, err := s.SendDueDoseReminders(lifecycle.WorkContext(ctx), query.Targeting{}); err != nil {
+				logrus.WithError(err).Error("Vaccination reminder run failed")
+			} else if sent > 0 {
+				logrus.WithField("sent", sent).Info("Vaccination reminders sent")
+			}
+		}
+	}
+}
+
+// Private helper methods
+
+func validateVaccinationRecord(record *models.VaccinationRecord) error {
+	if record.VaccineName == "" {
+		return fmt.Errorf("vaccine name is required")
+	}
+	if record.BatchNumber == "" {
+		return fmt.Errorf("batch number is required")
+	}
+	if record.DoseNumber < 1 {
+		return fmt.Errorf("dose number must be at least 1")
+	}
+	if record.TotalDoses > 0 && record.DoseNumber > record.TotalDoses {
+		return fmt.Errorf("dose %d exceeds the %d-dose series", record.DoseNumber, record.TotalDoses)
+	}
+	if record.Site != "" && !record.Site.IsValid() {
+		return fmt.Errorf("invalid administration site: %s", record.Site)
+	}
+	if record.ExpiryDate != nil && record.ExpiryDate.Before(record.AdministeredAt) {
+		return fmt.Errorf("vaccine batch %s expired on %s", record.BatchNumber, record.ExpiryDate.Format("2006-01-02"))
+	}
+	return nil
+}
+
+func newVaccinationVerification(record models.VaccinationRecord) *VaccinationVerification {
+	verification := &VaccinationVerification{
+		Vaccine:        record.VaccineName,
+		DoseNumber:     record.DoseNumber,
+		TotalDoses:     record.TotalDoses,
+		AdministeredAt: record.AdministeredAt,
+	}
+	if record.Customer != nil {
+		verification.Name = record.Customer.FirstName + " " + record.Customer.LastName
+		verification.DateOfBirth = record.Customer.DateOfBirth.Format("2006-01-02")
+	}
+	return verification
+}
+
+// Request/Response types
+
+type RecordVaccinationRequest struct {
+	CustomerID     uuid.UUID              `json:"customer_id" binding:"required"`
+	ServiceID      uuid.UUID              `json:"service_id" binding:"required"`
+	SaleItemID     *uuid.UUID             `json:"sale_item_id"`
+	ProductID      *uuid.UUID             `json:"product_id"`
+	VaccineName    string                 `json:"vaccine_name"`
+	Manufacturer   string                 `json:"manufacturer"`
+	BatchNumber    string                 `json:"batch_number"`
+	ExpiryDate     *time.Time             `json:"expiry_date"`
+	DoseNumber     int                    `json:"dose_number" binding:"required"`
+	TotalDoses     int                    `json:"total_doses"`
+	Site           models.VaccinationSite `json:"site"`
+	Route          string                 `json:"route"`
+	Notes          string                 `json:"notes"`
+	AdministeredAt *time.Time             `json:"administered_at"`
+	NextDoseDue    *time.Time             `json:"next_dose_due"`
+	NextDoseInDays int                    `json:"next_dose_in_days"`
+}
+
+// VaccinationVerification is the public view returned when a certificate QR
+// code is scanned
+type VaccinationVerification struct {
+	Name           string    `json:"name"`
+	DateOfBirth    string    `json:"date_of_birth"`
+	Vaccine        string    `json:"vaccine"`
+	DoseNumber     int       `json:"dose_number"`
+	TotalDoses     int       `json:"total_doses"`
+	AdministeredAt time.Time `json:"administered_at"`
+}
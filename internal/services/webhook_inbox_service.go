@@ -0,0 +1,372 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pharmacy-backend/internal/config"
+	"pharmacy-backend/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUnknownIntegration      = errors.New("unknown webhook integration")
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	ErrStaleWebhook            = errors.New("webhook timestamp is missing or too far from now")
+	ErrWebhookQueued           = errors.New("webhook is already waiting to be processed")
+)
+
+// WebhookProcessJob is the job type that processes a stored inbound webhook
+const WebhookProcessJob = "webhook.process"
+
+// InboundWebhookHandler processes one event. Events are processed at least
+// once, so handlers must be safe to repeat; an error retries the event.
+type InboundWebhookHandler func(ctx context.Context, event *models.InboundWebhook, payload []byte) error
+
+// WebhookScheme reads the requests of one kind of sender: how they are
+// signed and where the event's ID and type are
+type WebhookScheme interface {
+	// Verify checks the request was signed with secret, and for schemes
+	// that timestamp requests, that it was sent within tolerance of now
+	Verify(secret []byte, header http.Header, body []byte, now time.Time, tolerance time.Duration) error
+	// Event returns the event's ID and type. Events without an ID are
+	// told apart by their body.
+	Event(header http.Header, body []byte) (id, eventType string)
+}
+
+// SignedWebhookScheme is how integrations without a scheme of their own
+// sign requests, the same way our outgoing webhooks are signed plus a
+// timestamp: X-Webhook-Signature is "sha256=" and the hex HMAC-SHA256 of
+// X-Webhook-Timestamp (Unix seconds), a dot and the body. X-Webhook-ID and
+// X-Webhook-Event name the event, or the body's id and type fields.
+type SignedWebhookScheme struct{}
+
+func (SignedWebhookScheme) Verify(secret []byte, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+	timestamp := header.Get("X-Webhook-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleWebhook
+	}
+	if age := now.Sub(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return ErrStaleWebhook
+	}
+
+	signature, ok := strings.CutPrefix(header.Get("X-Webhook-Signature"), "sha256=")
+	if !ok {
+		return ErrInvalidWebhookSignature
+	}
+	given, err := hex.DecodeString(signature)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	if !hmac.Equal(given, mac.Sum(nil)) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+func (SignedWebhookScheme) Event(header http.Header, body []byte) (string, string) {
+	id, eventType := header.Get("X-Webhook-ID"), header.Get("X-Webhook-Event")
+	if id == "" || eventType == "" {
+		var fields struct {
+			ID   interface{} `json:"id"`
+			Type string      `json:"type"`
+		}
+		if json.Unmarshal(body, &fields) == nil {
+			if id == "" && fields.ID != nil {
+				id = fmt.Sprint(fields.ID)
+			}
+			if eventType == "" {
+				eventType = fields.Type
+			}
+		}
+	}
+	return id, eventType
+}
+
+// WebhookInboxService receives the events third parties post to us:
+// payment providers, couriers and marketplaces. Each request is checked
+// against its integration's secret, stored, and processed by a background
+// job with the handler registered for its event type. Repeats of an event
+// are stored once and not processed again.
+type WebhookInboxService struct {
+	db     *gorm.DB
+	jobs   *JobService
+	config config.WebhookInboxConfig
+
+	mu       sync.RWMutex
+	schemes  map[string]WebhookScheme
+	handlers map[string]InboundWebhookHandler
+}
+
+func NewWebhookInboxService(db *gorm.DB, jobs *JobService, cfg config.WebhookInboxConfig) *WebhookInboxService {
+	return &WebhookInboxService{
+		db:       db,
+		jobs:     jobs,
+		config:   cfg,
+		schemes:  map[string]WebhookScheme{},
+		handlers: map[string]InboundWebhookHandler{},
+	}
+}
+
+// Integrations lists the integrations with a secret configured
+func (s *WebhookInboxService) Integrations() []string {
+	names := make([]string, 0, len(s.config.Secrets))
+	for name := range s.config.Secrets {
+		names = append(names, name)
+	}
+	return names
+}
+
+// SetScheme sets how an integration signs its requests, for senders that
+// don't use SignedWebhookScheme
+func (s *WebhookInboxService) SetScheme(integration string, scheme WebhookScheme) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schemes[integration] = scheme
+}
+
+// Handle sets the handler for an integration's events of eventType, or
+// with "*" for its events that have no handler of their own
+func (s *WebhookInboxService) Handle(integration, eventType string, handler InboundWebhookHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[integration+"|"+eventType] = handler
+}
+
+// Receive checks a request posted for integration and stores its event to
+// be processed. The event is returned with duplicate set when it had
+// already been received.
+func (s *WebhookInboxService) Receive(ctx context.Context, integration string, header http.Header, body []byte, sourceIP string) (*models.InboundWebhook, bool, error) {
+	secret, ok := s.config.Secrets[integration]
+	if !ok || secret == "" {
+		return nil, false, ErrUnknownIntegration
+	}
+	scheme := s.scheme(integration)
+	if err := scheme.Verify([]byte(secret), header, body, time.Now(), s.config.Tolerance); err != nil {
+		return nil, false, err
+	}
+
+	eventID, eventType := scheme.Event(header, body)
+	if eventID == "" {
+		sum := sha256.Sum256(body)
+		eventID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	event := &models.InboundWebhook{
+		Integration: integration,
+		EventID:     truncate(eventID, 200),
+		EventType:   truncate(eventType, 100),
+		SourceIP:    sourceIP,
+		Status:      models.InboundWebhookReceived,
+	}
+	if err := event.Payload.Set(string(body)); err != nil {
+		return nil, false, fmt.Errorf("failed to encrypt webhook payload: %w", err)
+	}
+
+	duplicate := false
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "integration"}, {Name: "event_id"}},
+			DoNothing: true,
+		}).Create(event)
+		if result.Error != nil {
+			return fmt.Errorf("failed to store webhook: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			duplicate = true
+			var existing models.InboundWebhook
+			if err := tx.Where("integration = ? AND event_id = ?", event.Integration, event.EventID).First(&existing).Error; err != nil {
+				return fmt.Errorf("failed to load repeated webhook: %w", err)
+			}
+			*event = existing
+			return nil
+		}
+		_, err := s.jobs.EnqueueTx(tx, WebhookProcessJob, webhookJobPayload{EventID: event.ID})
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return event, duplicate, nil
+}
+
+// Process runs the handler for a stored event. It is the work of the
+// webhook.process job; events already processed are left alone.
+func (s *WebhookInboxService) Process(ctx context.Context, payload []byte) error {
+	var job webhookJobPayload
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return fmt.Errorf("invalid webhook job payload: %w", err)
+	}
+
+	var event models.InboundWebhook
+	if err := s.db.WithContext(ctx).First(&event, "id = ?", job.EventID).Error; err != nil {
+		return fmt.Errorf("inbound webhook: %w", err)
+	}
+	if event.Status == models.InboundWebhookProcessed || event.Status == models.InboundWebhookIgnored {
+		return nil
+	}
+
+	handler, ok := s.handler(event.Integration, event.EventType)
+	if !ok {
+		return s.finish(ctx, &event, models.InboundWebhookIgnored, nil)
+	}
+	body, err := event.Payload.Get()
+	if err != nil {
+		return fmt.Errorf("failed to decrypt webhook payload: %w", err)
+	}
+	if err := handler(ctx, &event, []byte(body)); err != nil {
+		if saveErr := s.finish(ctx, &event, models.InboundWebhookFailed, err); saveErr != nil {
+			logrus.WithError(saveErr).WithField("event_id", event.ID).Error("Failed to record inbound webhook failure")
+		}
+		return err
+	}
+	return s.finish(ctx, &event, models.InboundWebhookProcessed, nil)
+}
+
+// Replay processes an event again, e.g. once a handler for it exists or
+// after fixing what made it fail
+func (s *WebhookInboxService) Replay(ctx context.Context, id uuid.UUID) (*models.InboundWebhook, error) {
+	var event models.InboundWebhook
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&event, "id = ?", id).Error; err != nil {
+			return fmt.Errorf("inbound webhook: %w", err)
+		}
+		if event.Status == models.InboundWebhookReceived {
+			return ErrWebhookQueued
+		}
+		event.Status = models.InboundWebhookReceived
+		if err := tx.Model(&event).Update("status", event.Status).Error; err != nil {
+			return fmt.Errorf("failed to update inbound webhook: %w", err)
+		}
+		_, err := s.jobs.EnqueueTx(tx, WebhookProcessJob, webhookJobPayload{EventID: event.ID})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// List returns received events, newest first, without their payloads
+func (s *WebhookInboxService) List(ctx context.Context, filter InboundWebhookFilter) ([]models.InboundWebhook, int64, error) {
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	query := s.db.WithContext(ctx).Model(&models.InboundWebhook{})
+	if filter.Integration != "" {
+		query = query.Where("integration = ?", filter.Integration)
+	}
+	if filter.EventType != "" {
+		query = query.Where("event_type = ?", filter.EventType)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count inbound webhooks: %w", err)
+	}
+	var events []models.InboundWebhook
+	if err := query.Omit("payload").Order("created_at DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to load inbound webhooks: %w", err)
+	}
+	return events, total, nil
+}
+
+// Get returns an event with its payload
+func (s *WebhookInboxService) Get(ctx context.Context, id uuid.UUID) (*models.InboundWebhook, error) {
+	var event models.InboundWebhook
+	if err := s.db.WithContext(ctx).First(&event, "id = ?", id).Error; err != nil {
+		return nil, fmt.Errorf("inbound webhook: %w", err)
+	}
+	return &event, nil
+}
+
+// PruneProcessed deletes processed and ignored events past the retention.
+// Their IDs are forgotten with them, so a sender repeating one after that
+// would have it processed again.
+func (s *WebhookInboxService) PruneProcessed(ctx context.Context) (int64, error) {
+	if s.config.RetentionDays <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -s.config.RetentionDays)
+	result := s.db.WithContext(ctx).Unscoped().
+		Where("status IN ? AND created_at < ?", []models.InboundWebhookStatus{models.InboundWebhookProcessed, models.InboundWebhookIgnored}, cutoff).
+		Delete(&models.InboundWebhook{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune inbound webhooks: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Private helper methods
+
+func (s *WebhookInboxService) scheme(integration string) WebhookScheme {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if scheme, ok := s.schemes[integration]; ok {
+		return scheme
+	}
+	return SignedWebhookScheme{}
+}
+
+func (s *WebhookInboxService) handler(integration, eventType string) (InboundWebhookHandler, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if handler, ok := s.handlers[integration+"|"+eventType]; ok {
+		return handler, true
+	}
+	handler, ok := s.handlers[integration+"|*"]
+	return handler, ok
+}
+
+func (s *WebhookInboxService) finish(ctx context.Context, event *models.InboundWebhook, status models.InboundWebhookStatus, cause error) error {
+	updates := map[string]interface{}{
+		"status":   status,
+		"attempts": gorm.Expr("attempts + 1"),
+	}
+	switch status {
+	case models.InboundWebhookFailed:
+		updates["last_error"] = cause.Error()
+	default:
+		now := time.Now().UTC()
+		updates["processed_at"] = &now
+		updates["last_error"] = ""
+	}
+	if err := s.db.WithContext(ctx).Model(event).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update inbound webhook: %w", err)
+	}
+	return nil
+}
+
+// Request/Response types
+
+type webhookJobPayload struct {
+	EventID uuid.UUID `json:"event_id"`
+}
+
+type InboundWebhookFilter struct {
+	Integration string
+	EventType   string
+	Status      models.InboundWebhookStatus
+	Limit       int
+	Offset      int
+}
@@ -0,0 +1,140 @@
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Client makes requests to the API, as staff once it has logged in
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// StatusError is a response other than the one a step expected
+type StatusError struct {
+	Method string
+	Path   string
+	Status int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s %s: status %d: %s", e.Method, e.Path, e.Status, e.Body)
+}
+
+// Login logs in as the seeded manager and makes the client's later
+// requests with their token
+func (c *Client) Login(ctx context.Context, seed *Seed) error {
+	var session struct {
+		AccessToken string `json:"access_token"`
+	}
+	body := map[string]string{"username": seed.Username, "password": seed.Password}
+	if err := c.Do(ctx, http.MethodPost, "/auth/login", nil, body, &session); err != nil {
+		return err
+	}
+	if session.AccessToken == "" {
+		return fmt.Errorf("login returned no access token")
+	}
+	c.token = session.AccessToken
+	return nil
+}
+
+// WithBaseURL returns a client for another base URL, e.g. another API
+// version, signed in as this one is
+func (c *Client) WithBaseURL(baseURL string) *Client {
+	other := NewClient(baseURL)
+	other.token = c.token
+	return other
+}
+
+// Stock reads a product's stock as staff see it
+func (c *Client) Stock(ctx context.Context, productID uuid.UUID) (int, error) {
+	var product struct {
+		Stock int `json:"stock"`
+	}
+	if err := c.Do(ctx, http.MethodGet, "/products/"+productID.String(), nil, nil, &product); err != nil {
+		return 0, err
+	}
+	return product.Stock, nil
+}
+
+// Anonymous makes a request without the staff token, as the shop does
+func (c *Client) Anonymous(ctx context.Context, method, path string, header http.Header, body, out interface{}) error {
+	return NewClient(c.baseURL).Do(ctx, method, path, header, body, out)
+}
+
+// Do makes a request and decodes a 2xx JSON response into out, when given.
+// Any other status is a *StatusError.
+func (c *Client) Do(ctx context.Context, method, path string, header http.Header, body, out interface{}) error {
+	status, data, err := c.Raw(ctx, method, path, header, body)
+	if err != nil {
+		return err
+	}
+	if status < 200 || status >= 300 {
+		text := string(data)
+		if len(text) > 300 {
+			text = text[:300] + "..."
+		}
+		return &StatusError{Method: method, Path: path, Status: status, Body: text}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// Raw makes a request and returns the response's status and body
+func (c *Client) Raw(ctx context.Context, method, path string, header http.Header, body interface{}) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, data, nil
+}
@@ -0,0 +1,185 @@
+// Package testutil helps the end-to-end tests run the server against real
+// dependencies: throwaway PostgreSQL and Redis containers, a migrated
+// database seeded with fixtures, the server binary itself, and a client
+// that drives its API the way the shop and the tills do. Only tests import
+// it.
+package testutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrDockerUnavailable = errors.New("docker is not available")
+	ErrNotReady          = errors.New("not ready in time")
+)
+
+// Credentials of the database in the Postgres container
+const (
+	postgresUser     = "pharmacy"
+	postgresPassword = "pharmacy"
+	postgresDB       = "pharmacy_test"
+)
+
+// ContainerOptions choose the images the containers run
+type ContainerOptions struct {
+	PostgresImage string
+	RedisImage    string
+	// Timeout is how long each container gets to accept connections
+	Timeout time.Duration
+}
+
+// Containers are a Postgres and a Redis container started for one run.
+// They are removed by Close, and by Docker if the run dies first.
+type Containers struct {
+	postgres     string // container IDs
+	redis        string
+	postgresPort string // host ports they are published on
+	redisPort    string
+}
+
+// StartContainers starts Postgres and Redis with the docker command line
+// and waits until both accept connections
+func StartContainers(ctx context.Context, opts ContainerOptions) (*Containers, error) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, ErrDockerUnavailable
+	}
+	if opts.PostgresImage == "" {
+		opts.PostgresImage = "postgres:16-alpine"
+	}
+	if opts.RedisImage == "" {
+		opts.RedisImage = "redis:7-alpine"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+
+	c := &Containers{}
+	var err error
+	suffix := uuid.NewString()[:8]
+	c.postgres, c.postgresPort, err = runContainer(ctx, "pharmacy-test-postgres-"+suffix, "5432", opts.PostgresImage,
+		"-e", "POSTGRES_USER="+postgresUser,
+		"-e", "POSTGRES_PASSWORD="+postgresPassword,
+		"-e", "POSTGRES_DB="+postgresDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start postgres: %w", err)
+	}
+	c.redis, c.redisPort, err = runContainer(ctx, "pharmacy-test-redis-"+suffix, "6379", opts.RedisImage)
+	if err != nil {
+		c.Close()
+		return nil, fmt.Errorf("failed to start redis: %w", err)
+	}
+
+	// The ports are published before the servers behind them listen, so
+	// readiness is asked of the servers themselves
+	checks := []struct {
+		name      string
+		container string
+		command   []string
+	}{
+		{"postgres", c.postgres, []string{"pg_isready", "-h", "127.0.0.1", "-U", postgresUser, "-d", postgresDB}},
+		{"redis", c.redis, []string{"redis-cli", "ping"}},
+	}
+	for _, check := range checks {
+		if err := waitForContainer(ctx, check.container, check.command, opts.Timeout); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("%s: %w", check.name, err)
+		}
+	}
+	return c, nil
+}
+
+// Env is the configuration that points the server at the containers. The
+// database host is an address rather than localhost, which a development
+// configuration would take to mean SQLite.
+func (c *Containers) Env() map[string]string {
+	return map[string]string{
+		"DB_HOST":        "127.0.0.1",
+		"DB_PORT":        c.postgresPort,
+		"DB_USER":        postgresUser,
+		"DB_PASSWORD":    postgresPassword,
+		"DB_NAME":        postgresDB,
+		"DB_SSL_MODE":    "disable",
+		"REDIS_ENABLED":  "true",
+		"REDIS_HOST":     "127.0.0.1",
+		"REDIS_PORT":     c.redisPort,
+		"REDIS_PASSWORD": "",
+	}
+}
+
+// Close removes the containers and what they stored
+func (c *Containers) Close() error {
+	var errs []error
+	for _, id := range []string{c.redis, c.postgres} {
+		if id == "" {
+			continue
+		}
+		if _, err := docker(context.Background(), "rm", "-f", "-v", id); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Private helper methods
+
+// runContainer starts image detached as name, publishing port on a free
+// host port, and returns the container ID and that host port
+func runContainer(ctx context.Context, name, port, image string, args ...string) (string, string, error) {
+	run := append([]string{"run", "-d", "--rm", "--name", name, "-p", "127.0.0.1::" + port}, args...)
+	id, err := docker(ctx, append(run, image)...)
+	if err != nil {
+		return "", "", err
+	}
+	published, err := docker(ctx, "port", id, port+"/tcp")
+	if err != nil {
+		docker(context.Background(), "rm", "-f", "-v", id)
+		return "", "", err
+	}
+	// e.g. 127.0.0.1:49153, one line per address
+	_, hostPort, err := net.SplitHostPort(strings.SplitN(published, "\n", 2)[0])
+	if err != nil {
+		docker(context.Background(), "rm", "-f", "-v", id)
+		return "", "", fmt.Errorf("unexpected published port %q", published)
+	}
+	return id, hostPort, nil
+}
+
+// waitForContainer runs command in the container until it succeeds
+func waitForContainer(ctx context.Context, container string, command []string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, err := docker(ctx, append([]string{"exec", container}, command...)...); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return ErrNotReady
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// docker runs the docker command line and returns what it printed
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,322 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"pharmacy-backend/internal/models"
+	"pharmacy-backend/internal/services"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Fixtures builds records straight into the database. Every builder fills
+// in a valid record with unique keys, so runs can share a database, and
+// takes functions that change it before it is created.
+type Fixtures struct {
+	db *gorm.DB
+}
+
+func NewFixtures(db *gorm.DB) *Fixtures {
+	return &Fixtures{db: db}
+}
+
+// Staff creates an active staff account with role and returns it with its
+// password. The password is hashed at the lowest bcrypt cost, as nobody
+// attacks a test database.
+func (f *Fixtures) Staff(ctx context.Context, role models.UserRole, changes ...func(*models.User)) (*models.User, string, error) {
+	password := "it-" + uuid.NewString()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return nil, "", err
+	}
+	key := shortKey()
+	user := &models.User{
+		Username:     "it-" + key,
+		Email:        "it-" + key + "@example.com",
+		PasswordHash: string(hash),
+		FirstName:    "Integration",
+		LastName:     "Tester",
+		Role:         role,
+		IsActive:     true,
+	}
+	for _, change := range changes {
+		change(user)
+	}
+	if err := f.db.WithContext(ctx).Create(user).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create staff fixture: %w", err)
+	}
+	return user, password, nil
+}
+
+// Product creates an active over the counter product in stock
+func (f *Fixtures) Product(ctx context.Context, changes ...func(*models.Product)) (*models.Product, error) {
+	key := shortKey()
+	product := &models.Product{
+		Name:            "Integration Product " + key,
+		Category:        "Integration",
+		Manufacturer:    "Integration",
+		ProductType:     models.ProductTypeDrug,
+		SKU:             "IT-" + key,
+		Price:           models.NewMoney(100),
+		Cost:            models.NewMoney(60),
+		Stock:           100,
+		BatchNumber:     "IT-" + key,
+		ExpiryDate:      models.CustomDate{Time: time.Now().AddDate(2, 0, 0)},
+		ManufactureDate: models.CustomDate{Time: time.Now().AddDate(-1, 0, 0)},
+		IsActive:        true,
+	}
+	for _, change := range changes {
+		change(product)
+	}
+	if err := f.db.WithContext(ctx).Create(product).Error; err != nil {
+		return nil, fmt.Errorf("failed to create product fixture: %w", err)
+	}
+	return product, nil
+}
+
+// Customer creates an adult customer with no discount claims
+func (f *Fixtures) Customer(ctx context.Context, changes ...func(*models.Customer)) (*models.Customer, error) {
+	key := shortKey()
+	customer := &models.Customer{
+		FirstName:   "Integration",
+		LastName:    "Customer " + key,
+		Email:       "it-" + key + "@example.com",
+		Phone:       "09170000000",
+		DateOfBirth: time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC),
+		QRCode:      "IT-" + key,
+	}
+	for _, change := range changes {
+		change(customer)
+	}
+	if err := f.db.WithContext(ctx).Create(customer).Error; err != nil {
+		return nil, fmt.Errorf("failed to create customer fixture: %w", err)
+	}
+	return customer, nil
+}
+
+// Supplier creates an active supplier
+func (f *Fixtures) Supplier(ctx context.Context, changes ...func(*models.Supplier)) (*models.Supplier, error) {
+	key := shortKey()
+	supplier := &models.Supplier{
+		Name:          "Integration Supplier " + key,
+		ContactPerson: "Integration Contact",
+		Email:         "it-" + key + "@example.com",
+		Phone:         "0281234567",
+		IsActive:      true,
+	}
+	for _, change := range changes {
+		change(supplier)
+	}
+	if err := f.db.WithContext(ctx).Create(supplier).Error; err != nil {
+		return nil, fmt.Errorf("failed to create supplier fixture: %w", err)
+	}
+	return supplier, nil
+}
+
+// Branch creates an active branch
+func (f *Fixtures) Branch(ctx context.Context, changes ...func(*models.Branch)) (*models.Branch, error) {
+	key := shortKey()
+	branch := &models.Branch{
+		Code:     "IT-" + key,
+		Name:     "Integration Branch " + key,
+		IsActive: true,
+	}
+	for _, change := range changes {
+		change(branch)
+	}
+	if err := f.db.WithContext(ctx).Create(branch).Error; err != nil {
+		return nil, fmt.Errorf("failed to create branch fixture: %w", err)
+	}
+	return branch, nil
+}
+
+// Terminal creates an active register at branchID and starts its pairing,
+// returning it with the one-time code a device pairs with
+func (f *Fixtures) Terminal(ctx context.Context, branchID uuid.UUID, changes ...func(*models.Terminal)) (*models.Terminal, string, error) {
+	key := shortKey()
+	terminal := &models.Terminal{
+		Name:          "Integration Register " + key,
+		BranchID:      branchID,
+		InvoicePrefix: "IT" + key,
+		IsActive:      true,
+	}
+	for _, change := range changes {
+		change(terminal)
+	}
+	if err := f.db.WithContext(ctx).Create(terminal).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create terminal fixture: %w", err)
+	}
+	code, _, err := services.NewTerminalService(f.db).StartPairing(ctx, terminal.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	return terminal, code, nil
+}
+
+// Order creates a pickup order the customer has picked up
+func (f *Fixtures) Order(ctx context.Context, customerID uuid.UUID, changes ...func(*models.OnlineOrder)) (*models.OnlineOrder, error) {
+	key := shortKey()
+	order := &models.OnlineOrder{
+		OrderNumber: "IT-" + key,
+		QRCode:      "IT-" + key,
+		CustomerID:  &customerID,
+		Status:      models.OrderStatusPickedUp,
+		OrderType:   models.OrderTypePickup,
+		Subtotal:    models.NewMoney(100),
+		Total:       models.NewMoney(100),
+	}
+	for _, change := range changes {
+		change(order)
+	}
+	if err := f.db.WithContext(ctx).Create(order).Error; err != nil {
+		return nil, fmt.Errorf("failed to create order fixture: %w", err)
+	}
+	return order, nil
+}
+
+// Feedback asks for feedback on an order, waiting on the customer
+func (f *Fixtures) Feedback(ctx context.Context, order *models.OnlineOrder, changes ...func(*models.Feedback)) (*models.Feedback, error) {
+	feedback := &models.Feedback{
+		OrderID:    order.ID,
+		CustomerID: order.CustomerID,
+		Token:      token(),
+		ExpiresAt:  time.Now().UTC().AddDate(0, 0, 30),
+		Status:     models.FeedbackStatusRequested,
+	}
+	for _, change := range changes {
+		change(feedback)
+	}
+	if err := f.db.WithContext(ctx).Create(feedback).Error; err != nil {
+		return nil, fmt.Errorf("failed to create feedback fixture: %w", err)
+	}
+	return feedback, nil
+}
+
+// PrescriptionUpload records a prescription uploaded to an order, waiting
+// to be verified. No file is stored for it.
+func (f *Fixtures) PrescriptionUpload(ctx context.Context, order *models.OnlineOrder, changes ...func(*models.PrescriptionUpload)) (*models.PrescriptionUpload, error) {
+	upload := &models.PrescriptionUpload{
+		OrderID:    &order.ID,
+		CustomerID: order.CustomerID,
+		FileName:   "prescription.jpg",
+		FileSize:   1024,
+		MimeType:   "image/jpeg",
+		FileHash:   strings.ReplaceAll(uuid.NewString()+uuid.NewString(), "-", ""),
+	}
+	for _, change := range changes {
+		change(upload)
+	}
+	if err := f.db.WithContext(ctx).Create(upload).Error; err != nil {
+		return nil, fmt.Errorf("failed to create prescription upload fixture: %w", err)
+	}
+	return upload, nil
+}
+
+// Refill creates a refill of one unit of a product, due for its reminder
+func (f *Fixtures) Refill(ctx context.Context, customerID, productID uuid.UUID, changes ...func(*models.Refill)) (*models.Refill, error) {
+	now := time.Now().UTC()
+	refill := &models.Refill{
+		CustomerID:   customerID,
+		ProductID:    productID,
+		Quantity:     1,
+		DaysSupply:   30,
+		DispensedAt:  now.AddDate(0, 0, -27),
+		DueDate:      now.AddDate(0, 0, 3),
+		Status:       models.RefillStatusReminded,
+		ReorderToken: token(),
+	}
+	for _, change := range changes {
+		change(refill)
+	}
+	if err := f.db.WithContext(ctx).Create(refill).Error; err != nil {
+		return nil, fmt.Errorf("failed to create refill fixture: %w", err)
+	}
+	return refill, nil
+}
+
+// CommunicationPreference opts a customer in to marketing emails
+func (f *Fixtures) CommunicationPreference(ctx context.Context, customerID uuid.UUID, changes ...func(*models.CommunicationPreference)) (*models.CommunicationPreference, error) {
+	pref := &models.CommunicationPreference{
+		CustomerID:       customerID,
+		Channel:          "email",
+		Purpose:          models.PurposeMarketing,
+		OptedIn:          true,
+		Source:           "customer",
+		UnsubscribeToken: token(),
+	}
+	for _, change := range changes {
+		change(pref)
+	}
+	if err := f.db.WithContext(ctx).Create(pref).Error; err != nil {
+		return nil, fmt.Errorf("failed to create communication preference fixture: %w", err)
+	}
+	return pref, nil
+}
+
+// Seed is what the end-to-end tests start from
+type Seed struct {
+	Username string
+	Password string
+	Products []models.Product
+	// LowStock is below its minimum stock and expires within the month, so
+	// the low stock and expiring lists aren't empty
+	LowStock models.Product
+	Customer models.Customer
+	Supplier models.Supplier
+}
+
+// Seed creates a manager to log in as, a few products to sell, one running
+// out, a customer and a supplier
+func (f *Fixtures) Seed(ctx context.Context) (*Seed, error) {
+	manager, password, err := f.Staff(ctx, models.RoleManager)
+	if err != nil {
+		return nil, err
+	}
+	customer, err := f.Customer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	supplier, err := f.Supplier(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lowStock, err := f.Product(ctx, func(p *models.Product) {
+		p.Stock = 5
+		p.ExpiryDate = models.CustomDate{Time: time.Now().AddDate(0, 0, 10)}
+	})
+	if err != nil {
+		return nil, err
+	}
+	seed := &Seed{
+		Username: manager.Username,
+		Password: password,
+		LowStock: *lowStock,
+		Customer: *customer,
+		Supplier: *supplier,
+	}
+	for i := 0; i < 3; i++ {
+		product, err := f.Product(ctx)
+		if err != nil {
+			return nil, err
+		}
+		seed.Products = append(seed.Products, *product)
+	}
+	return seed, nil
+}
+
+// Private helper methods
+
+// shortKey tells apart the records of one run from another's
+func shortKey() string {
+	return uuid.NewString()[:8]
+}
+
+// token is an unguessable link token, like those the services issue
+func token() string {
+	return strings.ReplaceAll(uuid.NewString(), "-", "")
+}
@@ -0,0 +1,117 @@
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// Server is the server binary run for a test on a free local port
+type Server struct {
+	URL     string // e.g. http://127.0.0.1:40123
+	BaseURL string // URL + /api/v1
+	cmd     *exec.Cmd
+	exited  chan error
+}
+
+// ServerOptions say how to start the server
+type ServerOptions struct {
+	Binary string
+	Args   []string
+	// Dir is the working directory, where a SQLite database is kept
+	Dir string
+	// Env is added to the environment the server inherits
+	Env map[string]string
+	// Log is where the server's output goes
+	Log *os.File
+	// Timeout is how long the server gets to become ready
+	Timeout time.Duration
+}
+
+// StartServer starts the server and waits until /readyz answers 200
+func StartServer(ctx context.Context, opts ServerOptions) (*Server, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(opts.Binary, opts.Args...)
+	cmd.Dir = opts.Dir
+	cmd.Env = os.Environ()
+	for key, value := range opts.Env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	cmd.Env = append(cmd.Env, "SERVER_HOST=127.0.0.1", "SERVER_PORT="+port)
+	cmd.Stdout = opts.Log
+	cmd.Stderr = opts.Log
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start the server: %w", err)
+	}
+
+	s := &Server{
+		URL:     "http://127.0.0.1:" + port,
+		BaseURL: "http://127.0.0.1:" + port + "/api/v1",
+		cmd:     cmd,
+		exited:  make(chan error, 1),
+	}
+	go func() { s.exited <- cmd.Wait() }()
+
+	ready := s.URL + "/readyz"
+	deadline := time.Now().Add(opts.Timeout)
+	for {
+		if resp, err := http.Get(ready); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return s, nil
+			}
+		}
+		if time.Now().After(deadline) {
+			s.Stop(context.Background())
+			return nil, fmt.Errorf("server: %w", ErrNotReady)
+		}
+		select {
+		case err := <-s.exited:
+			return nil, fmt.Errorf("server exited before it was ready: %v", err)
+		case <-ctx.Done():
+			s.Stop(context.Background())
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// Stop shuts the server down as an orchestrator would, with SIGTERM, and
+// kills it if it hasn't exited by the time ctx is done
+func (s *Server) Stop(ctx context.Context) error {
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case err := <-s.exited:
+		return err
+	case <-ctx.Done():
+		s.cmd.Process.Kill()
+		return fmt.Errorf("server didn't shut down in time: %w", ctx.Err())
+	}
+}
+
+// Private helper methods
+
+// freePort returns a local port nothing listens on
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	return port, err
+}
@@ -12,9 +12,9 @@ import (
 	"io"
 )
 
-var encryptionKey []byte
-
-// InitializeEncryption sets up the encryption key
+// InitializeEncryption sets up the key from ENCRYPTION_KEY. Without managed
+// data keys (see SetDataKeys) it encrypts everything; with them it is only
+// used to decrypt values written before key management was enabled.
 func InitializeEncryption(key string) error {
 	if len(key) != 32 {
 		return fmt.Errorf("encryption key must be exactly 32 characters long")
@@ -22,7 +22,7 @@ func InitializeEncryption(key string) error {
 	
 	// Use SHA256 to ensure we have a proper 32-byte key
 	hash := sha256.Sum256([]byte(key))
-	encryptionKey = hash[:]
+	keys.setLegacy(hash[:])
 	return nil
 }
 
@@ -244,18 +244,19 @@ func (esa *EncryptedStringArray) UnmarshalJSON(data []byte) error {
 	return esa.Set(value)
 }
 
-// Encrypt encrypts a string using AES-256-GCM
+// Encrypt encrypts a string using AES-256-GCM with the current data key
 func Encrypt(plaintext string) (string, error) {
-	if encryptionKey == nil {
-		return "", fmt.Errorf("encryption key not initialized")
-	}
-	
 	if plaintext == "" {
 		return "", nil
 	}
 
+	keyID, key, err := keys.current()
+	if err != nil {
+		return "", err
+	}
+
 	// Create AES cipher
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -275,28 +276,35 @@ func Encrypt(plaintext string) (string, error) {
 	// Encrypt the data
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 
-	// Encode to base64 for storage
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	// Encode to base64 for storage, tagged with the key that can open it
+	encoded := base64.StdEncoding.EncodeToString(ciphertext)
+	if keyID == "" {
+		return encoded, nil
+	}
+	return keyID + keyIDSeparator + encoded, nil
 }
 
-// Decrypt decrypts a string using AES-256-GCM
+// Decrypt decrypts a string using AES-256-GCM with the key it was written
+// with
 func Decrypt(ciphertext string) (string, error) {
-	if encryptionKey == nil {
-		return "", fmt.Errorf("encryption key not initialized")
-	}
-	
 	if ciphertext == "" {
 		return "", nil
 	}
 
+	keyID, encoded := splitCiphertext(ciphertext)
+	key, err := keys.get(keyID)
+	if err != nil {
+		return "", err
+	}
+
 	// Decode from base64
-	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
 		return "", err
 	}
 
 	// Create AES cipher
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -324,6 +332,44 @@ func Decrypt(ciphertext string) (string, error) {
 	return string(plaintext), nil
 }
 
+// SealBytes encrypts data with AES-256-GCM under key, for binary payloads
+// such as backups that carry their own key. The nonce is prepended.
+func SealBytes(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// OpenBytes decrypts data written by SealBytes. It fails if the data was
+// changed or key is wrong.
+func OpenBytes(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	return gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+}
+
 // HashPassword creates a secure hash of a password
 func HashPassword(password string) (string, error) {
 	// This would typically use bcrypt, but for simplicity using a basic hash
@@ -349,33 +395,3 @@ func GenerateSecureToken(length int) (string, error) {
 	}
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
-
-// SanitizeInput removes potentially dangerous characters from input
-func SanitizeInput(input string) string {
-	// Basic sanitization - in production, use a proper sanitization library
-	// Remove common SQL injection patterns
-	dangerous := []string{"'", "\"", ";", "--", "/*", "*/", "xp_", "sp_", "DROP", "DELETE", "INSERT", "UPDATE", "SELECT"}
-	
-	result := input
-	for _, pattern := range dangerous {
-		// Simple replacement - in production, use proper escaping
-		result = replaceAll(result, pattern, "")
-	}
-	
-	return result
-}
-
-// Simple string replacement function
-func replaceAll(s, old, new string) string {
-	result := ""
-	for i := 0; i < len(s); {
-		if i+len(old) <= len(s) && s[i:i+len(old)] == old {
-			result += new
-			i += len(old)
-		} else {
-			result += string(s[i])
-			i++
-		}
-	}
-	return result
-}
\ No newline at end of file
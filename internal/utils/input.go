@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Queries bind user input as parameters, so nothing here escapes for SQL.
+// These helpers only tidy up what people type before it is matched or
+// logged.
+
+// MaxSearchLength caps search terms, each word of which becomes a set of
+// LIKE conditions
+const MaxSearchLength = 100
+
+// NormalizeText drops invalid UTF-8 and control characters and trims the
+// surrounding whitespace. Tabs and newlines become spaces. Control characters
+// never belong in names or search terms and would let input forge log lines.
+func NormalizeText(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			if unicode.IsSpace(r) {
+				return ' '
+			}
+			return -1
+		}
+		return r
+	}, s)
+	return strings.TrimSpace(s)
+}
+
+// NormalizeSearchTerm is NormalizeText with runs of whitespace collapsed and
+// the result cut to MaxSearchLength characters
+func NormalizeSearchTerm(s string) string {
+	s = strings.Join(strings.Fields(NormalizeText(s)), " ")
+	if runes := []rune(s); len(runes) > MaxSearchLength {
+		s = strings.TrimSpace(string(runes[:MaxSearchLength]))
+	}
+	return s
+}
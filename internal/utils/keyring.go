@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Ciphertexts written with a managed data key start with the key's ID, e.g.
+// "v2:BASE64". Ciphertexts without one predate key management and are
+// opened with the ENCRYPTION_KEY key. Base64 never contains a colon, so the
+// two forms can't be confused.
+const keyIDSeparator = ":"
+
+// DataKeySize is the length of an AES-256 data key in bytes
+const DataKeySize = 32
+
+type keyring struct {
+	mu        sync.RWMutex
+	legacy    []byte
+	dataKeys  map[string][]byte
+	currentID string // empty while only the legacy key is configured
+	loader    func(keyID string) ([]byte, error)
+}
+
+var keys = &keyring{dataKeys: make(map[string][]byte)}
+
+// SetDataKeys installs the managed data keys and the ID of the one new values
+// are encrypted with. Keys already loaded stay available for decryption.
+func SetDataKeys(dataKeys map[string][]byte, currentID string) error {
+	for id, key := range dataKeys {
+		if len(key) != DataKeySize {
+			return fmt.Errorf("data key %s must be %d bytes", id, DataKeySize)
+		}
+		if id == "" || strings.Contains(id, keyIDSeparator) {
+			return fmt.Errorf("invalid data key ID %q", id)
+		}
+	}
+
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+
+	for id, key := range dataKeys {
+		keys.dataKeys[id] = key
+	}
+	if _, ok := keys.dataKeys[currentID]; !ok {
+		return fmt.Errorf("current data key %s is not loaded", currentID)
+	}
+	keys.currentID = currentID
+	return nil
+}
+
+// SetDataKeyLoader sets how a data key missing from the keyring is fetched,
+// e.g. after another server rotated to a key this one hasn't loaded yet
+func SetDataKeyLoader(loader func(keyID string) ([]byte, error)) {
+	keys.mu.Lock()
+	defer keys.mu.Unlock()
+	keys.loader = loader
+}
+
+// CurrentKeyID returns the ID new values are encrypted with, empty while only
+// the legacy key is configured
+func CurrentKeyID() string {
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	return keys.currentID
+}
+
+// CiphertextKeyID returns the ID of the data key that wrote ciphertext, empty
+// for legacy ciphertexts
+func CiphertextKeyID(ciphertext string) string {
+	keyID, _ := splitCiphertext(ciphertext)
+	return keyID
+}
+
+// Reencrypt rewrites ciphertext under the current data key. It returns
+// ciphertext unchanged and false when it is empty or already current.
+func Reencrypt(ciphertext string) (string, bool, error) {
+	if ciphertext == "" || CiphertextKeyID(ciphertext) == CurrentKeyID() {
+		return ciphertext, false, nil
+	}
+	plaintext, err := Decrypt(ciphertext)
+	if err != nil {
+		return "", false, err
+	}
+	reencrypted, err := Encrypt(plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return reencrypted, true, nil
+}
+
+func splitCiphertext(ciphertext string) (keyID, encoded string) {
+	if keyID, encoded, found := strings.Cut(ciphertext, keyIDSeparator); found {
+		return keyID, encoded
+	}
+	return "", ciphertext
+}
+
+func (k *keyring) setLegacy(key []byte) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.legacy = key
+}
+
+// current returns the key new values are encrypted with
+func (k *keyring) current() (string, []byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.currentID != "" {
+		return k.currentID, k.dataKeys[k.currentID], nil
+	}
+	if k.legacy == nil {
+		return "", nil, fmt.Errorf("encryption key not initialized")
+	}
+	return "", k.legacy, nil
+}
+
+// get returns the key with the given ID, loading it if needed. The empty ID
+// is the legacy key.
+func (k *keyring) get(keyID string) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.dataKeys[keyID]
+	legacy, loader := k.legacy, k.loader
+	k.mu.RUnlock()
+
+	if keyID == "" {
+		if legacy == nil {
+			return nil, fmt.Errorf("encryption key not initialized")
+		}
+		return legacy, nil
+	}
+	if ok {
+		return key, nil
+	}
+	if loader == nil {
+		return nil, fmt.Errorf("unknown data key %s", keyID)
+	}
+
+	// Loaded without the lock held, the loader may hit the database
+	key, err := loader(keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load data key %s: %w", keyID, err)
+	}
+	if len(key) != DataKeySize {
+		return nil, fmt.Errorf("data key %s must be %d bytes", keyID, DataKeySize)
+	}
+
+	k.mu.Lock()
+	k.dataKeys[keyID] = key
+	k.mu.Unlock()
+	return key, nil
+}
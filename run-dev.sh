@@ -77,7 +77,7 @@ fi
 
 # Start backend server
 echo -e "${GREEN}📡 Starting Backend Server...${NC}"
-ENV=development go run cmd/server/main.go &
+ENV=development go run -tags dev cmd/server/main.go &
 BACKEND_PID=$!
 
 # Wait for backend to start
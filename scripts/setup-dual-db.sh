@@ -197,6 +197,8 @@ DB_CONN_MAX_LIFETIME=3600
 # Sync Configuration
 DB_SYNC_ENABLED=true
 DB_SYNC_INTERVAL=300  # 5 minutes
+DB_SYNC_BATCH_SIZE=500  # rows per table per transaction
+DB_SYNC_BIDIRECTIONAL=true  # store keeps selling offline, pulls cloud changes back
 DB_BACKUP_ENABLED=true
 DB_BACKUP_INTERVAL=3600  # 1 hour
 
@@ -260,10 +262,12 @@ READ_REPLICA_PORT=5432
 READ_REPLICA_USER=
 READ_REPLICA_PASSWORD=
 READ_REPLICA_NAME=
+READ_REPLICA_MAX_LAG=5
 
 # Sync Configuration
 DB_SYNC_ENABLED=true
 DB_SYNC_INTERVAL=900   # 15 minutes
+DB_SYNC_BATCH_SIZE=500 # rows per table per transaction
 DB_BACKUP_ENABLED=true
 DB_BACKUP_INTERVAL=1800 # 30 minutes
 